@@ -15,34 +15,51 @@ let reconnectAttempts = 0;
 let maxReconnectAttempts = 99;
 let reconnectTimeout;
 let hd1Id = null;
+let sessionToken = null; // Proves ownership of hd1Id when reconnecting
+const guestToken = new URLSearchParams(window.location.search).get('guest'); // Guest link joined through
+const spectating = ['1', 'true'].includes(new URLSearchParams(window.location.search).get('spectator')); // Watching without an avatar
+const followDirector = new URLSearchParams(window.location.search).get('follow') === 'director';
+const broadcastId = new URLSearchParams(window.location.search).get('broadcast'); // Rendering this broadcast
+const broadcastToken = new URLSearchParams(window.location.search).get('token');
+let consentToken = localStorage.getItem('hd1_consent_token'); // Stands for the consent documents accepted
 let apiClient = null;
+let currentStatus = 'connecting';
+let lastAppliedSeq = 0; // Answered in checksum_response
+let resyncing = false;  // Full sync in flight, the scene is incomplete
+
+// UI strings come from the server's message catalogues
+const i18n = new window.HD1I18n();
+window.hd1I18n = i18n;
+const t = (key, params) => i18n.t(key, params);
 
 // Status management
 function setStatus(status, message) {
+    currentStatus = status;
+    
     // Update connection text and indicator
     switch(status) {
         case 'connecting':
-            statusConnectionText.textContent = 'Connecting';
+            statusConnectionText.textContent = t('status.connecting');
             statusConnectionIndicator.className = 'connecting';
             break;
         case 'connected':
-            statusConnectionText.textContent = 'Connected';
+            statusConnectionText.textContent = t('status.connected');
             statusConnectionIndicator.className = 'connected';
             break;
         case 'disconnected':
-            statusConnectionText.textContent = 'Disconnected';
+            statusConnectionText.textContent = t('status.disconnected');
             statusConnectionIndicator.className = 'disconnected';
             break;
         case 'error':
-            statusConnectionText.textContent = 'Error';
+            statusConnectionText.textContent = t('status.error');
             statusConnectionIndicator.className = 'disconnected';
             break;
         case 'receiving':
-            statusConnectionText.textContent = 'Receiving';
+            statusConnectionText.textContent = t('status.receiving');
             statusConnectionIndicator.className = 'receiving';
             break;
         default:
-            statusConnectionText.textContent = 'Unknown';
+            statusConnectionText.textContent = t('status.unknown');
             statusConnectionIndicator.className = 'disconnected';
     }
 }
@@ -93,9 +110,31 @@ function addDebug(command, data = null) {
 // WebSocket connection with rebootstrap
 function connectWebSocket() {
     const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-    const wsUrl = `${protocol}//${window.location.host}/ws`;
+    let wsUrl = `${protocol}//${window.location.host}/ws`;
+    // Guests present their link; a reconnecting guest also its session,
+    // so the link is not used again
+    const params = new URLSearchParams();
+    if (guestToken) {
+        params.set('guest', guestToken);
+        if (sessionToken) {
+            params.set('session', sessionToken);
+        }
+    }
+    if (consentToken) {
+        params.set('consent', consentToken);
+    }
+    // Spectators join without an avatar, following the director if asked
+    if (spectating) {
+        params.set('spectator', '1');
+        if (followDirector) {
+            params.set('follow', 'director');
+        }
+    }
+    if (params.toString()) {
+        wsUrl += '?' + params.toString();
+    }
     
-    addDebug('WS_CONNECT', {url: wsUrl, attempt: reconnectAttempts + 1});
+    addDebug('WS_CONNECT', {url: wsUrl.split('?')[0], attempt: reconnectAttempts + 1});
     setStatus('connecting');
     
     ws = new WebSocket(wsUrl);
@@ -111,15 +150,24 @@ function connectWebSocket() {
             reconnectTimeout = null;
         }
         
-        // Send existing hd1_id for reconnection if we have one
-        if (hd1Id) {
+        // Send existing hd1_id and its session token for reconnection if we have one
+        if (hd1Id && sessionToken) {
             const reconnectMsg = {
                 type: 'client_reconnect',
-                hd1_id: hd1Id
+                hd1_id: hd1Id,
+                token: sessionToken
             };
             ws.send(JSON.stringify(reconnectMsg));
             addDebug('CLIENT_RECONNECT', 'Sent existing hd1_id: ' + hd1Id);
         }
+        
+        // Pick up interrupted asset transfers where they stopped
+        resumeAssetStreams();
+        
+        // Subscriptions are per connection
+        resendAccessibilitySubscription();
+        
+        startClockSync();
     };
     
     ws.onmessage = function(event) {
@@ -127,16 +175,45 @@ function connectWebSocket() {
         
         try {
             const data = JSON.parse(event.data);
+            
+            // Asset chunks are large and frequent - keep them out of the debug log
+            if (data.type && data.type.startsWith('asset_stream_')) {
+                handleAssetStreamMessage(data);
+                setTimeout(() => setStatus('connected'), 200);
+                return;
+            }
+            // Clock sync pongs are periodic - keep them out of the debug log
+            if (data.type === 'pong') {
+                handlePong(data);
+                setTimeout(() => setStatus('connected'), 200);
+                return;
+            }
+            // Silent token rotation - keep the token out of the debug log
+            if (data.type === 'session_token' && data.token) {
+                sessionToken = data.token;
+                if (apiClient) {
+                    apiClient.setSessionToken(sessionToken);
+                }
+                addDebug('SESSION_TOKEN', {expires_at: data.token_expires_at});
+                setTimeout(() => setStatus('connected'), 200);
+                return;
+            }
             addDebug('WS_MSG', data);
             
             // Handle client initialization from server
             if (data.type === 'client_init' && data.hd1_id) {
                 hd1Id = data.hd1_id;
+                sessionToken = data.token || null;
                 window.hd1Id = hd1Id; // Make globally available
+                window.hd1Guest = data.guest || null; // Capabilities of a guest session
+                window.hd1Spectating = !!data.spectator; // No avatar to move
                 
-                // Update API client with server-provided hd1_id
+                // Update API client with server-provided hd1_id, and the
+                // key deltas are signed with when the server asks for it
                 if (apiClient) {
                     apiClient.setHd1Id(hd1Id);
+                    apiClient.setSessionToken(sessionToken);
+                    apiClient.setSigningKey(data.signing_key);
                 }
                 
                 updateRebootstrapButton();
@@ -147,20 +224,172 @@ function connectWebSocket() {
                 
                 // Request full sync to get all existing operations
                 requestFullSync();
+                
+                sendClientInfo();
+                openLinkedView();
+                startHeartbeat(data.heartbeat_ms);
+                startTelemetry(data.world, data.telemetry_ms);
+                startBroadcast();
             }
             
             // Handle successful client reconnection
             if (data.type === 'client_reconnect_success' && data.hd1_id) {
                 hd1Id = data.hd1_id;
+                sessionToken = data.token || sessionToken;
                 window.hd1Id = hd1Id; // Make globally available
                 
-                // Update API client with reconnected hd1_id
+                // Update API client with reconnected hd1_id and its new key
                 if (apiClient) {
                     apiClient.setHd1Id(hd1Id);
+                    apiClient.setSessionToken(sessionToken);
+                    apiClient.setSigningKey(data.signing_key);
                 }
                 
                 updateRebootstrapButton();
                 addDebug('CLIENT_RECONNECT_SUCCESS', 'Reconnected with hd1_id: ' + hd1Id);
+                
+                sendClientInfo();
+                startHeartbeat(data.heartbeat_ms);
+                startTelemetry(data.world, data.telemetry_ms);
+            }
+            
+            // Other avatars' head and controller poses (ephemeral, not in the op log)
+            if (data.type === 'xr_poses' && data.poses) {
+                if (window.hd1ThreeJS) {
+                    window.hd1ThreeJS.handleXRPoses(data.poses);
+                }
+                setTimeout(() => setStatus('connected'), 200);
+                return;
+            }
+            
+            // Accessibility text streams, announced through the live region
+            if (data.type === 'scene_description' || data.type === 'caption') {
+                handleAccessibilityMessage(data);
+            }
+            
+            // Read-only mode for this world, switched by an operator
+            if (data.type === 'maintenance') {
+                showMaintenanceBanner(data);
+            }
+            
+            // The world moved to another server - follow it there
+            if (data.type === 'migrate' && data.url) {
+                followMigration(data);
+            }
+            
+            // The organization's content policy refused text this session sent
+            if (data.type === 'content_rejected') {
+                addDebug('CONTENT_REJECTED', data);
+            }
+            
+            // Messages past the organization's quota were dropped
+            if (data.type === 'rate_limited') {
+                addDebug('RATE_LIMITED', data);
+            }
+            
+            // Another session of the organization turned healthy, degraded or stale
+            if (data.type === 'presence' && data.event) {
+                addDebug('PRESENCE', data.event);
+            }
+            
+            // Support staff started or stopped acting as this session
+            if (data.type === 'impersonation') {
+                showImpersonationBanner(data);
+            }
+            
+            // A moderator kicked, banned or muted this session
+            if (data.type === 'moderation') {
+                showModerationNotice(data);
+            }
+            
+            // Session tokens revoked, or the session went inactive
+            if (data.type === 'session_revoked') {
+                endSession(data.reason);
+            }
+            
+            // Poll created, voted in or closed
+            if (data.type === 'poll' && data.poll) {
+                handlePoll(data.poll);
+            }
+            
+            // Chat message, such as one a webhook posted
+            if (data.type === 'chat' && data.message) {
+                handleChat(data.message);
+            }
+            
+            // Shared document created, changed or deleted, edited, or a cursor moved
+            if (data.type === 'document' && data.document) {
+                handleDocument(data.event, data.document);
+            }
+            if (data.type === 'document_operation' && data.edit) {
+                handleDocumentEdit(data.edit);
+            }
+            if (data.type === 'document_cursor') {
+                handleDocumentCursor(data);
+            }
+            
+            // Camera view saved or deleted
+            if (data.type === 'view' && data.view) {
+                handleView(data.event, data.view);
+            }
+            
+            // A portal carried this session, or an avatar passed through one
+            if (data.type === 'portal_transfer' && data.transfer) {
+                handlePortalTransfer(data.transfer);
+            }
+            if (data.type === 'portal') {
+                addDebug('PORTAL', {event: data.event, from: data.arrival && data.arrival.from});
+            }
+            
+            // Chunks of a streamed world loaded or unloaded around the avatar
+            if (data.type === 'chunk') {
+                handleChunk(data);
+            }
+            
+            // Screen share signaling, relayed between sharer and viewers
+            if (data.type === 'share_signal') {
+                handleShareSignal(data);
+            }
+            
+            // Server's delivery decision for this client
+            if (data.type === 'capability_profile' && data.profile) {
+                window.hd1CapabilityProfile = data.profile;
+                addDebug('CAPABILITY_PROFILE', data.profile);
+            }
+            
+            // The world became a crowd, or stopped being one
+            if (data.type === 'crowd' && data.crowd) {
+                if (window.hd1ThreeJS) {
+                    window.hd1ThreeJS.setCrowd(data.crowd);
+                }
+                addDebug('CROWD', data.crowd);
+            }
+            
+            // The director's shot, followed by spectators who asked to;
+            // a null shot gives the camera back
+            if (data.type === 'director') {
+                if (window.hd1ThreeJS) {
+                    window.hd1ThreeJS.directCamera(data.shot);
+                }
+                addDebug('DIRECTOR', data.shot ? {take: data.shot.take, view: data.shot.view} : 'released');
+            }
+            
+            // Server's quality decision from this console's telemetry
+            if (data.type === 'quality' && data.directive) {
+                if (window.hd1ThreeJS) {
+                    window.hd1ThreeJS.applyQuality(data.directive);
+                }
+                addDebug('QUALITY', data.directive);
+            }
+            
+            // Server checks the scene against the world it holds
+            if (data.type === 'checksum_challenge') {
+                answerChecksumChallenge(data);
+            }
+            
+            // Scene diverged from the server's world - reload what differs
+            if (data.type === 'resync') {
+                resyncEntities(data.hashes);
             }
             
             // Handle sync operations from server
@@ -168,6 +397,7 @@ function connectWebSocket() {
                 // Forward sync operation to Three.js scene manager
                 if (window.hd1ThreeJS) {
                     window.hd1ThreeJS.handleSyncOperation(data.operation);
+                    lastAppliedSeq = Math.max(lastAppliedSeq, data.operation.seq_num || 0);
                     addDebug('SYNC_OP', 'Applied operation: ' + data.operation.type + ' seq:' + data.operation.seq_num);
                 } else {
                     addDebug('SYNC_OP_ERROR', 'Three.js scene manager not available');
@@ -183,8 +413,29 @@ function connectWebSocket() {
     
     ws.onclose = function(event) {
         addDebug('WS_CLOSE', {code: event.code, reason: event.reason});
+        stopClockSync();
+        stopHeartbeat();
+        stopTelemetry();
         setStatus('disconnected');
         
+        // Kicked and banned sessions stay out until the page is reloaded
+        if (moderationState && (moderationState.action === 'kick' || moderationState.action === 'ban')) {
+            return;
+        }
+        
+        // Ended sessions wait for the user, see endSession
+        if (sessionEnded) {
+            return;
+        }
+        
+        // The world moved to a server behind this origin, rejoin it now
+        if (migrating) {
+            migrating = false;
+            showMaintenanceBanner({enabled: false});
+            connectWebSocket();
+            return;
+        }
+        
         reconnectAttempts++;
         
         if (reconnectAttempts >= maxReconnectAttempts) {
@@ -196,8 +447,9 @@ function connectWebSocket() {
         const delay = Math.min(1000 * Math.pow(2, reconnectAttempts), 30000);
         addDebug('WS_RECONNECT', {attempt: reconnectAttempts, delay: delay});
         
+        // A document may have changed version since, asking for consent again
         reconnectTimeout = setTimeout(() => {
-            connectWebSocket();
+            ensureConsent().finally(connectWebSocket);
         }, delay);
     };
     
@@ -207,116 +459,1831 @@ function connectWebSocket() {
     };
 }
 
-// Rebootstrap functionality
-function triggerRebootstrap() {
-    addDebug('REBOOTSTRAP', 'Clearing storage and reloading page...');
+// Client capability negotiation - the server answers with a capability_profile
+// that selects asset variants, texture resolution and avatar update rate
+function detectCapabilities() {
+    const probe = document.createElement('canvas');
+    let gl = probe.getContext('webgl2');
+    let webglVersion = gl ? 2 : 0;
+    if (!gl) {
+        gl = probe.getContext('webgl');
+        webglVersion = gl ? 1 : 0;
+    }
     
-    localStorage.clear();
-    sessionStorage.clear();
+    // Decoders are optional modules; loaders announce them on window.hd1Decoders
+    const decoders = window.hd1Decoders || {};
+    const compressedTextures = !!gl && ['WEBGL_compressed_texture_astc', 'WEBGL_compressed_texture_etc',
+        'WEBGL_compressed_texture_s3tc', 'EXT_texture_compression_bptc'].some(name => gl.getExtension(name));
     
-    document.cookie.split(";").forEach(function(c) { 
-        document.cookie = c.replace(/^ +/, "").replace(/=.*/, "=;expires=" + new Date().toUTCString() + ";path=/"); 
+    return {
+        webgl: webglVersion > 0,
+        webglVersion: webglVersion,
+        touch: 'ontouchstart' in window || navigator.maxTouchPoints > 0,
+        mobile: /Mobi|Android|iPhone|iPad/i.test(navigator.userAgent),
+        maxTextureSize: gl ? gl.getParameter(gl.MAX_TEXTURE_SIZE) : 0,
+        instancing: webglVersion === 2 || (!!gl && !!gl.getExtension('ANGLE_instanced_arrays')),
+        draco: !!decoders.draco,
+        meshopt: !!decoders.meshopt,
+        ktx2: !!decoders.ktx2 && compressedTextures
+    };
+}
+
+function sendClientInfo() {
+    if (!ws || ws.readyState !== WebSocket.OPEN) {
+        return;
+    }
+    ws.send(JSON.stringify({
+        type: 'client_info',
+        screen: {
+            width: window.screen.width,
+            height: window.screen.height,
+            devicePixelRatio: window.devicePixelRatio || 1,
+            orientation: (window.screen.orientation && window.screen.orientation.angle) || 0
+        },
+        canvas: {
+            width: canvas ? canvas.width : 0,
+            height: canvas ? canvas.height : 0
+        },
+        capabilities: detectCapabilities()
+    }));
+}
+
+// XR pose channel - head and controllers as millimetre positions and
+// "smallest three" quaternions packed into 32 bits (see src/xr/pose.go)
+const XR_COMPONENT_BITS = 10;
+const XR_COMPONENT_SCALE = (1 << XR_COMPONENT_BITS) - 2;
+const XR_COMPONENT_MASK = (1 << XR_COMPONENT_BITS) - 1;
+const XR_COMPONENT_RANGE = Math.SQRT1_2;
+const XR_POSITION_EPSILON_MM = 2;     // Joints moving less than this are left out of deltas
+const XR_KEYFRAME_INTERVAL_MS = 1000; // Full pose resend, matches the server default
+
+function packQuaternion(x, y, z, w) {
+    const c = [x, y, z, w];
+    let length = Math.hypot(x, y, z, w);
+    if (!length) {
+        c.splice(0, 4, 0, 0, 0, 1);
+        length = 1;
+    }
+    let largest = 0;
+    for (let i = 1; i < 4; i++) {
+        if (Math.abs(c[i]) > Math.abs(c[largest])) {
+            largest = i;
+        }
+    }
+    const sign = c[largest] < 0 ? -1 : 1;
+    let packed = largest * (1 << (3 * XR_COMPONENT_BITS));
+    let shift = 2 * XR_COMPONENT_BITS;
+    for (let i = 0; i < 4; i++) {
+        if (i === largest) {
+            continue;
+        }
+        const v = Math.max(-XR_COMPONENT_RANGE, Math.min(XR_COMPONENT_RANGE, sign * c[i] / length));
+        packed += Math.round((v + XR_COMPONENT_RANGE) / (2 * XR_COMPONENT_RANGE) * XR_COMPONENT_SCALE) * (1 << shift);
+        shift -= XR_COMPONENT_BITS;
+    }
+    return packed >>> 0;
+}
+
+function unpackQuaternion(packed) {
+    const largest = (packed >>> (3 * XR_COMPONENT_BITS)) & 3;
+    const c = [0, 0, 0, 0];
+    let sum = 0;
+    let shift = 2 * XR_COMPONENT_BITS;
+    for (let i = 0; i < 4; i++) {
+        if (i === largest) {
+            continue;
+        }
+        const quantized = (packed >>> shift) & XR_COMPONENT_MASK;
+        c[i] = quantized / XR_COMPONENT_SCALE * (2 * XR_COMPONENT_RANGE) - XR_COMPONENT_RANGE;
+        sum += c[i] * c[i];
+        shift -= XR_COMPONENT_BITS;
+    }
+    c[largest] = Math.sqrt(Math.max(0, 1 - sum));
+    return {x: c[0], y: c[1], z: c[2], w: c[3]};
+}
+
+// Joints are {position: {x,y,z} metres, quaternion: {x,y,z,w}}
+function encodeJoint(joint) {
+    return {
+        p: [Math.round(joint.position.x * 1000), Math.round(joint.position.y * 1000), Math.round(joint.position.z * 1000)],
+        q: packQuaternion(joint.quaternion.x, joint.quaternion.y, joint.quaternion.z, joint.quaternion.w)
+    };
+}
+
+const xrLastSent = {pose: {}, keyframeAt: 0};
+
+function sendXRPose(joints) {
+    if (!ws || ws.readyState !== WebSocket.OPEN) {
+        return;
+    }
+    const now = Date.now();
+    const keyframe = now - xrLastSent.keyframeAt >= XR_KEYFRAME_INTERVAL_MS;
+    const pose = {t: now};
+    let changed = false;
+    
+    ['head', 'left', 'right'].forEach(name => {
+        if (!joints[name]) {
+            return;
+        }
+        const encoded = encodeJoint(joints[name]);
+        const previous = xrLastSent.pose[name];
+        const moved = !previous || encoded.q !== previous.q ||
+            encoded.p.some((v, i) => Math.abs(v - previous.p[i]) >= XR_POSITION_EPSILON_MM);
+        if (keyframe || moved) {
+            pose[name] = encoded;
+            xrLastSent.pose[name] = encoded;
+            changed = true;
+        }
     });
     
-    if ('caches' in window) {
-        caches.keys().then(names => {
-            names.forEach(name => {
-                caches.delete(name);
-            });
-        });
+    if (changed) {
+        if (keyframe) {
+            xrLastSent.keyframeAt = now;
+        }
+        sendDelta({type: 'xr_pose', pose: pose});
     }
-    
-    setTimeout(() => {
-        window.location.reload(true);
-    }, 1000);
 }
 
-// Console panel collapse functionality
-let debugCollapsed = false;
+function sendXRIK(ik) {
+    if (ws && ws.readyState === WebSocket.OPEN) {
+        sendDelta({type: 'xr_ik', ik: ik});
+    }
+}
 
-debugHeader.addEventListener('click', function() {
-    debugCollapsed = !debugCollapsed;
-    const debugContent = document.getElementById('debug-content');
-    
-    if (debugCollapsed) {
-        debugContent.classList.add('collapsed');
-        debugCollapseIcon.classList.add('collapsed');
-        debugCollapseIcon.innerHTML = '&#8681;'; // Down arrow
-    } else {
-        debugContent.classList.remove('collapsed');
-        debugCollapseIcon.classList.remove('collapsed');
-        debugCollapseIcon.innerHTML = '&#8679;'; // Up arrow
+// Avatar deltas go out in a signed envelope when the server requires
+// signed deltas
+async function sendDelta(message) {
+    let data = JSON.stringify(message);
+    if (apiClient && apiClient.canSign()) {
+        const nonce = ++apiClient.nonce;
+        data = JSON.stringify({type: 'signed', message: data, nonce: nonce, signature: await apiClient.sign('WS', '/ws', nonce, data)});
     }
-    
-    addDebug('CONSOLE_TOGGLE', {collapsed: debugCollapsed});
-});
+    if (ws && ws.readyState === WebSocket.OPEN) {
+        ws.send(data);
+    }
+}
 
-// Update rebootstrap button with current hd1_id
-function updateRebootstrapButton() {
-    const btn = document.getElementById('rebootstrap-btn');
-    if (hd1Id) {
-        btn.textContent = hd1Id;
-        btn.title = `Rebootstrap: HD1 ${hd1Id} - Clear storage and reload page`;
-    } else {
-        btn.textContent = 'REBOOTSTRAP';
-        btn.title = 'Rebootstrap: Clear storage and reload page';
+window.hd1XR = {
+    sendPose: sendXRPose,
+    sendIK: sendXRIK,
+    packQuaternion: packQuaternion,
+    unpackQuaternion: unpackQuaternion
+};
+
+// Server clock estimate (NTP-lite). Each ping yields an offset and round
+// trip; the lowest-latency samples are the least skewed, so the offset is
+// the median of the three fastest. Server timestamps on operations,
+// xr_poses and captions convert to local time with hd1Clock.toLocal().
+const clockSamples = [];
+let clockTimer = null;
+let pingCounter = 0;
+
+function localNow() {
+    return performance.timeOrigin + performance.now();
+}
+
+function sendClockPing() {
+    if (ws && ws.readyState === WebSocket.OPEN) {
+        ws.send(JSON.stringify({type: 'ping', ping_id: ++pingCounter, timestamp: localNow()}));
     }
 }
 
-// Rebootstrap button
-const rebootstrapBtn = document.getElementById('rebootstrap-btn');
-rebootstrapBtn.addEventListener('click', function() {
-    if (confirm('This will clear all storage and reload the page. Continue?')) {
-        triggerRebootstrap();
+function handlePong(data) {
+    if (typeof data.timestamp !== 'number' || typeof data.server_receive !== 'number') {
+        return;
     }
-});
+    const t3 = localNow();
+    const t0 = data.timestamp;
+    const t1 = data.server_receive;
+    const t2 = data.server_transmit;
+    clockSamples.push({offset: ((t1 - t0) + (t2 - t3)) / 2, rtt: (t3 - t0) - (t2 - t1)});
+    if (clockSamples.length > 16) {
+        clockSamples.shift();
+    }
+}
 
-// Request full sync from server
-async function requestFullSync() {
-    if (!apiClient) {
-        addDebug('BOOTSTRAP_ERROR', 'API client not available');
+function clockEstimate() {
+    if (!clockSamples.length) {
+        return {offset: 0, rtt: null};
+    }
+    const fastest = clockSamples.slice().sort((a, b) => a.rtt - b.rtt).slice(0, 3);
+    const offsets = fastest.map(sample => sample.offset).sort((a, b) => a - b);
+    return {offset: offsets[Math.floor(offsets.length / 2)], rtt: fastest[0].rtt};
+}
+
+function startClockSync() {
+    stopClockSync();
+    // A burst for a quick first estimate, then a slow refresh for drift
+    for (let i = 0; i < 5; i++) {
+        setTimeout(sendClockPing, i * 200);
+    }
+    clockTimer = setInterval(sendClockPing, 30000);
+}
+
+function stopClockSync() {
+    if (clockTimer) {
+        clearInterval(clockTimer);
+        clockTimer = null;
+    }
+}
+
+// Heartbeats tell the server this console is alive and how well it runs:
+// its round trip, frame rate and whether its tab is hidden. The server
+// scores them and disconnects consoles that stop sending them.
+let heartbeatTimer = null;
+let heartbeatFrames = null;
+
+function sendHeartbeat() {
+    if (!ws || ws.readyState !== WebSocket.OPEN) {
         return;
     }
-    
+    const now = performance.now();
+    const frames = window.hd1ThreeJS ? window.hd1ThreeJS.frameCount : 0;
+    let fps = 0;
+    if (heartbeatFrames && now > heartbeatFrames.at) {
+        fps = Math.round((frames - heartbeatFrames.count) * 1000 / (now - heartbeatFrames.at));
+    }
+    heartbeatFrames = {count: frames, at: now};
+    const rtt = clockEstimate().rtt;
+    ws.send(JSON.stringify({
+        type: 'heartbeat',
+        rtt_ms: rtt === null ? 0 : Math.round(rtt),
+        fps: fps,
+        hidden: document.hidden
+    }));
+}
+
+function startHeartbeat(interval) {
+    stopHeartbeat();
+    if (interval > 0) {
+        sendHeartbeat();
+        heartbeatTimer = setInterval(sendHeartbeat, interval);
+    }
+}
+
+function stopHeartbeat() {
+    if (heartbeatTimer) {
+        clearInterval(heartbeatTimer);
+        heartbeatTimer = null;
+    }
+    heartbeatFrames = null;
+}
+
+// Frame telemetry - every telemetry_ms the console sums up how it rendered
+// since the last sample, so operators see what worlds cost their visitors.
+// Hidden tabs barely render, so they send nothing.
+let telemetryTimer = null;
+
+async function sendTelemetry(world, interval) {
+    const scene = window.hd1ThreeJS;
+    if (!scene || !hd1Id) {
+        return;
+    }
+    const stats = scene.takeFrameStats();
+    if (document.hidden || stats.frames === 0) {
+        return;
+    }
+    const sample = {
+        fps: Math.round(stats.frames * 10000 / interval) / 10,
+        frame_ms: Math.round(stats.cpuMs / stats.frames * 100) / 100,
+        draw_calls: stats.drawCalls,
+        triangles: stats.triangles,
+        entities: stats.entities
+    };
+    if (stats.gpuFrames > 0) {
+        sample.gpu_ms = Math.round(stats.gpuMs / stats.gpuFrames * 100) / 100;
+    }
+    if (performance.memory) {
+        sample.memory_mb = Math.round(performance.memory.usedJSHeapSize / 1048576);
+    }
     try {
-        addDebug('BOOTSTRAP_START', 'Requesting full sync...');
-        const response = await apiClient.getFullSync();
-        
-        if (response.success && response.operations) {
-            addDebug('BOOTSTRAP_SUCCESS', `Received ${response.operations.length} operations`);
-            
-            // Apply all operations to Three.js scene
-            if (window.hd1ThreeJS) {
-                for (const opWrapper of response.operations) {
-                    window.hd1ThreeJS.handleSyncOperation(opWrapper.operation);
-                }
-                addDebug('BOOTSTRAP_APPLIED', `Applied ${response.operations.length} operations to scene`);
-            } else {
-                addDebug('BOOTSTRAP_ERROR', 'Three.js scene manager not available');
-            }
-        } else {
-            addDebug('BOOTSTRAP_ERROR', 'Failed to get full sync: ' + JSON.stringify(response));
+        const response = await fetch('/api/worlds/' + encodeURIComponent(world) + '/telemetry', {
+            method: 'POST',
+            headers: {'Content-Type': 'application/json', 'X-HD1-ID': hd1Id},
+            body: JSON.stringify(sample)
+        });
+        if (!response.ok) {
+            addDebug('TELEMETRY', 'Sample refused: ' + response.status);
         }
     } catch (error) {
-        addDebug('BOOTSTRAP_ERROR', 'Full sync request failed: ' + error.message);
+        addDebug('TELEMETRY', 'Sample failed: ' + error.message);
     }
 }
 
-// Initialize console
-function initConsole() {
-    addDebug('INIT', 'HD1 Three.js Console initializing...');
-    
-    // Initialize API client without client ID (server will provide it via WebSocket)
-    if (window.HD1ThreeJSAPIClient) {
-        apiClient = new window.HD1ThreeJSAPIClient();
-        window.apiClient = apiClient; // Make globally available for Three.js
-        addDebug('API_CLIENT', 'API client initialized and made globally available');
+function startTelemetry(world, interval) {
+    stopTelemetry();
+    if (world && interval > 0) {
+        if (window.hd1ThreeJS) {
+            window.hd1ThreeJS.takeFrameStats(); // Start from now
+        }
+        telemetryTimer = setInterval(() => sendTelemetry(world, interval), interval);
+    }
+}
+
+function stopTelemetry() {
+    if (telemetryTimer) {
+        clearInterval(telemetryTimer);
+        telemetryTimer = null;
+    }
+}
+
+window.hd1Clock = {
+    now: () => localNow() + clockEstimate().offset,
+    toLocal: serverTime => serverTime - clockEstimate().offset,
+    offset: () => clockEstimate().offset,
+    rtt: () => clockEstimate().rtt,
+    synced: () => clockSamples.length > 0
+};
+
+// Accessibility channel - screen-reader scene descriptions and live captions.
+// Both are opt-in; text is announced through a polite ARIA live region and
+// handed to any registered listeners.
+const accessibilitySubscription = {descriptions: false, captions: false};
+const accessibilityListeners = {description: [], caption: []};
+let accessibilityLiveRegion = null;
+let captionRecognition = null;
+
+function announce(text) {
+    if (!accessibilityLiveRegion) {
+        accessibilityLiveRegion = document.createElement('div');
+        accessibilityLiveRegion.setAttribute('role', 'status');
+        accessibilityLiveRegion.setAttribute('aria-live', 'polite');
+        accessibilityLiveRegion.style.cssText = 'position:absolute;width:1px;height:1px;overflow:hidden;clip:rect(0 0 0 0);';
+        document.body.appendChild(accessibilityLiveRegion);
+    }
+    accessibilityLiveRegion.textContent = text;
+}
+
+function subscribeAccessibility(options) {
+    Object.assign(accessibilitySubscription, options);
+    resendAccessibilitySubscription();
+}
+
+function resendAccessibilitySubscription() {
+    if (!accessibilitySubscription.descriptions && !accessibilitySubscription.captions) {
+        return;
+    }
+    if (ws && ws.readyState === WebSocket.OPEN) {
+        ws.send(JSON.stringify(Object.assign({type: 'accessibility_subscribe'}, accessibilitySubscription)));
+    }
+}
+
+function sendCaption(text, final, lang) {
+    if (ws && ws.readyState === WebSocket.OPEN) {
+        ws.send(JSON.stringify({type: 'caption', text: text, final: !!final, lang: lang || ''}));
     }
-    
-    connectWebSocket();
-    addDebug('READY', 'HD1 Three.js Console ready');
 }
 
+// Caption the local microphone with the browser's speech recognition
+function startCaptioning(lang) {
+    const Recognition = window.SpeechRecognition || window.webkitSpeechRecognition;
+    if (!Recognition) {
+        addDebug('CAPTION_ERROR', 'Speech recognition not supported');
+        return false;
+    }
+    stopCaptioning();
+    captionRecognition = new Recognition();
+    captionRecognition.continuous = true;
+    captionRecognition.interimResults = true;
+    captionRecognition.lang = lang || navigator.language;
+    captionRecognition.onresult = function(event) {
+        for (let i = event.resultIndex; i < event.results.length; i++) {
+            const result = event.results[i];
+            sendCaption(result[0].transcript, result.isFinal, captionRecognition.lang);
+        }
+    };
+    captionRecognition.onend = function() {
+        // Browsers stop recognition after silence; keep going until stopped
+        if (captionRecognition) {
+            captionRecognition.start();
+        }
+    };
+    captionRecognition.start();
+    return true;
+}
+
+function stopCaptioning() {
+    if (captionRecognition) {
+        const recognition = captionRecognition;
+        captionRecognition = null;
+        recognition.stop();
+    }
+}
+
+function handleAccessibilityMessage(data) {
+    if (data.type === 'scene_description') {
+        announce(data.text);
+        accessibilityListeners.description.forEach(listener => listener(data));
+    } else if (data.type === 'caption') {
+        if (data.final) {
+            announce(t('caption.speaker', {name: data.name, text: data.text}));
+        }
+        accessibilityListeners.caption.forEach(listener => listener(data));
+    }
+}
+
+window.hd1Accessibility = {
+    subscribe: subscribeAccessibility,
+    sendCaption: sendCaption,
+    startCaptioning: startCaptioning,
+    stopCaptioning: stopCaptioning,
+    onDescription: listener => accessibilityListeners.description.push(listener),
+    onCaption: listener => accessibilityListeners.caption.push(listener)
+};
+
+// Progressive asset streaming - large GLBs arrive as verified chunks over
+// the WebSocket and resume from the last good byte after a reconnect
+const assetStreams = new Map();
+let assetStreamCounter = 0;
+
+function streamAsset(digest, options = {}) {
+    return new Promise((resolve, reject) => {
+        const streamId = 'asset-' + (++assetStreamCounter) + '-' + Date.now();
+        assetStreams.set(streamId, {
+            digest: digest.replace(/^sha256:/, ''),
+            contentDigest: null,
+            capabilities: options.capabilities || '',
+            onProgress: options.onProgress,
+            chunks: [],
+            received: 0,
+            size: 0,
+            pending: Promise.resolve(),
+            resolve: resolve,
+            reject: reject
+        });
+        requestAssetStream(streamId);
+    });
+}
+
+function requestAssetStream(streamId) {
+    const stream = assetStreams.get(streamId);
+    if (!stream || !ws || ws.readyState !== WebSocket.OPEN) {
+        return; // Sent again by resumeAssetStreams once connected
+    }
+    
+    // Resume against the exact bytes already received, not a fresh variant choice
+    const resuming = stream.contentDigest && stream.received > 0;
+    ws.send(JSON.stringify({
+        type: 'asset_stream_request',
+        stream_id: streamId,
+        digest: resuming ? stream.contentDigest : stream.digest,
+        offset: resuming ? stream.received : 0,
+        capabilities: resuming ? '' : stream.capabilities
+    }));
+}
+
+function cancelAssetStream(streamId) {
+    const stream = assetStreams.get(streamId);
+    if (!stream) {
+        return;
+    }
+    assetStreams.delete(streamId);
+    if (ws && ws.readyState === WebSocket.OPEN) {
+        ws.send(JSON.stringify({type: 'asset_stream_cancel', stream_id: streamId}));
+    }
+    stream.reject(new Error('asset stream cancelled'));
+}
+
+function resumeAssetStreams() {
+    assetStreams.forEach((stream, streamId) => {
+        addDebug('ASSET_STREAM_RESUME', {digest: stream.digest, offset: stream.received});
+        requestAssetStream(streamId);
+    });
+}
+
+async function sha256Hex(bytes) {
+    if (!window.crypto || !window.crypto.subtle) {
+        return null; // Insecure context - integrity checks unavailable
+    }
+    const hash = await window.crypto.subtle.digest('SHA-256', bytes);
+    return Array.from(new Uint8Array(hash)).map(b => b.toString(16).padStart(2, '0')).join('');
+}
+
+function failAssetStream(streamId, reason) {
+    const stream = assetStreams.get(streamId);
+    if (!stream) {
+        return;
+    }
+    assetStreams.delete(streamId);
+    if (ws && ws.readyState === WebSocket.OPEN) {
+        ws.send(JSON.stringify({type: 'asset_stream_cancel', stream_id: streamId}));
+    }
+    addDebug('ASSET_STREAM_ERROR', {digest: stream.digest, error: reason});
+    stream.reject(new Error(reason));
+}
+
+function handleAssetStreamMessage(data) {
+    const stream = assetStreams.get(data.stream_id);
+    if (!stream) {
+        return;
+    }
+    
+    // Chunk checks are async; chain them so end is handled after every chunk
+    stream.pending = stream.pending.then(async () => {
+        if (!assetStreams.has(data.stream_id)) {
+            return;
+        }
+        switch (data.type) {
+            case 'asset_stream_start':
+                if (data.offset === 0) {
+                    stream.chunks = [];
+                    stream.received = 0;
+                }
+                stream.contentDigest = data.content_digest;
+                stream.size = data.size;
+                addDebug('ASSET_STREAM_START', {digest: data.content_digest, variant: data.variant, size: data.size, offset: data.offset});
+                break;
+                
+            case 'asset_stream_chunk': {
+                if (data.offset !== stream.received) {
+                    failAssetStream(data.stream_id, 'chunk out of order at offset ' + data.offset);
+                    return;
+                }
+                const binary = atob(data.data);
+                const bytes = new Uint8Array(binary.length);
+                for (let i = 0; i < binary.length; i++) {
+                    bytes[i] = binary.charCodeAt(i);
+                }
+                const sum = await sha256Hex(bytes);
+                if (sum && sum !== data.sha256) {
+                    failAssetStream(data.stream_id, 'chunk ' + data.index + ' failed integrity check');
+                    return;
+                }
+                stream.chunks.push(bytes);
+                stream.received += bytes.length;
+                if (stream.onProgress) {
+                    stream.onProgress(stream.received, stream.size);
+                }
+                break;
+            }
+            
+            case 'asset_stream_end': {
+                const asset = new Uint8Array(stream.received);
+                let offset = 0;
+                stream.chunks.forEach(chunk => {
+                    asset.set(chunk, offset);
+                    offset += chunk.length;
+                });
+                const sum = await sha256Hex(asset);
+                if (stream.received !== data.size || (sum && sum !== data.content_digest)) {
+                    failAssetStream(data.stream_id, 'asset failed integrity check');
+                    return;
+                }
+                assetStreams.delete(data.stream_id);
+                addDebug('ASSET_STREAM_END', {digest: data.content_digest, size: data.size});
+                stream.resolve(asset.buffer);
+                break;
+            }
+            
+            case 'asset_stream_error':
+                failAssetStream(data.stream_id, data.error);
+                break;
+        }
+    });
+}
+
+// Maintenance banner - the server refuses changes (503) while it is shown
+let maintenanceState = null;
+
+function showMaintenanceBanner(data) {
+    maintenanceState = data.enabled ? data : null;
+    const banner = document.getElementById('maintenance-banner');
+    if (!banner) {
+        return;
+    }
+    banner.hidden = !maintenanceState;
+    banner.textContent = maintenanceState ? (maintenanceState.message || t('maintenance.default')) : '';
+}
+
+window.hd1Maintenance = () => maintenanceState;
+
+// World migration - the world moved to another server. One behind this
+// origin is rejoined in place with a new session, as sessions belong to a
+// server; another origin is opened at the link the server gave.
+let migrating = false;
+
+function followMigration(data) {
+    const target = new URL(data.url, location.href);
+    addDebug('MIGRATE', {world: data.world, url: target.href});
+    const banner = document.getElementById('maintenance-banner');
+    if (banner) {
+        banner.hidden = false;
+        banner.textContent = data.message || t('migration.moving');
+    }
+    if (target.origin !== location.origin) {
+        location.assign(target.href);
+        return;
+    }
+    migrating = true;
+    hd1Id = null;
+    sessionToken = null;
+    reconnectAttempts = 0;
+    ws.close();
+}
+
+// Moderation notice - a kick or ban also stops reconnecting
+let moderationState = null;
+
+function showModerationNotice(data) {
+    moderationState = data.action === 'unmute' ? null : data;
+    const notice = document.getElementById('moderation-notice');
+    if (!notice) {
+        return;
+    }
+    notice.hidden = !moderationState;
+    if (!moderationState) {
+        notice.textContent = '';
+        return;
+    }
+    let text = t('moderation.' + moderationState.action);
+    if (moderationState.reason) {
+        text += ' ' + t('moderation.reason', {reason: moderationState.reason});
+    }
+    if (moderationState.expires_at) {
+        text += ' ' + t('moderation.until', {time: new Date(moderationState.expires_at).toLocaleString(i18n.locale || undefined)});
+    }
+    notice.textContent = text;
+    addDebug('MODERATION', data);
+}
+
+window.hd1Moderation = () => moderationState;
+
+// Impersonation banner - support staff act as this session until it ends;
+// the end is shown for a few seconds
+let impersonationState = null;
+let impersonationEndedTimer = null;
+
+function showImpersonationBanner(data) {
+    impersonationState = data.state === 'started' ? data : null;
+    const banner = document.getElementById('impersonation-banner');
+    if (!banner) {
+        return;
+    }
+    clearTimeout(impersonationEndedTimer);
+    banner.hidden = false;
+    if (impersonationState) {
+        const impersonation = impersonationState.impersonation;
+        banner.textContent = t('impersonation.active', {
+            operator: impersonation.operator,
+            reason: impersonation.reason,
+            time: new Date(impersonation.expires_at).toLocaleString(i18n.locale || undefined)
+        });
+    } else {
+        banner.textContent = t('impersonation.ended');
+        impersonationEndedTimer = setTimeout(() => {
+            banner.hidden = true;
+            banner.textContent = '';
+        }, 10000);
+    }
+    addDebug('IMPERSONATION', data);
+}
+
+window.hd1Impersonation = () => impersonationState;
+
+// Ended session - a revoked one stays out until the page is reloaded, an
+// inactive one starts a new session on the next click or key press
+let sessionEnded = null;
+
+function endSession(reason) {
+    sessionEnded = reason;
+    hd1Id = null;
+    sessionToken = null;
+    showSessionNotice();
+    addDebug('SESSION_ENDED', {reason: reason});
+    if (reason !== 'inactive' && reason !== 'unresponsive') {
+        return;
+    }
+    const resume = () => {
+        document.removeEventListener('pointerdown', resume);
+        document.removeEventListener('keydown', resume);
+        sessionEnded = null;
+        showSessionNotice();
+        reconnectAttempts = 0;
+        connectWebSocket();
+    };
+    document.addEventListener('pointerdown', resume);
+    document.addEventListener('keydown', resume);
+}
+
+// Joining needs the required consent documents accepted at their current
+// version; those pending are shown with a button accepting them, and the
+// consent token the server returns is kept for later visits
+async function ensureConsent() {
+    let response = await fetch('/api/consent' + (consentToken ? '?token=' + encodeURIComponent(consentToken) : ''));
+    if (response.status === 404 && consentToken) {
+        // The record is gone; accepting starts a new one
+        consentToken = null;
+        localStorage.removeItem('hd1_consent_token');
+        response = await fetch('/api/consent');
+    }
+    if (!response.ok) {
+        return;
+    }
+    const standing = await response.json();
+    if (!standing.pending || standing.pending.length === 0) {
+        return;
+    }
+    addDebug('CONSENT_PENDING', standing.pending.map(doc => doc.id + '@' + doc.version));
+    await promptConsent(standing.pending);
+}
+
+function promptConsent(pending) {
+    const prompt = document.getElementById('consent-prompt');
+    if (!prompt) {
+        return Promise.resolve();
+    }
+    return new Promise(resolve => {
+        const intro = document.createElement('p');
+        intro.textContent = t('consent.intro');
+        const list = document.createElement('ul');
+        pending.forEach(doc => {
+            const item = document.createElement('li');
+            const title = document.createElement(doc.url ? 'a' : 'span');
+            title.textContent = t('consent.document', {title: doc.title, version: doc.version});
+            if (doc.url) {
+                title.href = doc.url;
+                title.target = '_blank';
+                title.rel = 'noopener';
+            }
+            item.appendChild(title);
+            list.appendChild(item);
+        });
+        const accept = document.createElement('button');
+        accept.className = 'control-btn';
+        accept.textContent = t('consent.accept');
+        accept.onclick = async () => {
+            accept.disabled = true;
+            const response = await fetch('/api/consent', {
+                method: 'POST',
+                headers: {'Content-Type': 'application/json'},
+                body: JSON.stringify({
+                    token: consentToken || undefined,
+                    documents: pending.map(doc => ({document: doc.id, version: doc.version}))
+                })
+            });
+            prompt.hidden = true;
+            if (!response.ok) {
+                // A document changed version while shown: show it again
+                addDebug('CONSENT_ERROR', response.status);
+                ensureConsent().finally(resolve);
+                return;
+            }
+            const standing = await response.json();
+            if (standing.token) {
+                consentToken = standing.token;
+                localStorage.setItem('hd1_consent_token', consentToken);
+            }
+            addDebug('CONSENT_ACCEPTED', pending.map(doc => doc.id + '@' + doc.version));
+            resolve();
+        };
+        prompt.replaceChildren(intro, list, accept);
+        prompt.hidden = false;
+    });
+}
+
+function showSessionNotice() {
+    const notice = document.getElementById('moderation-notice');
+    if (!notice) {
+        return;
+    }
+    notice.hidden = !sessionEnded;
+    notice.textContent = sessionEnded ? t('session.' + sessionEnded) : '';
+}
+
+window.hd1StreamAsset = streamAsset;
+window.hd1CancelAssetStream = cancelAssetStream;
+
+// Screen sharing - the sharer answers each viewer on its own peer
+// connection; the hub relays offers, answers and candidates as share_signal
+let screenShare = null;                  // {share, stream, peers: hd1_id -> RTCPeerConnection}
+const shareSubscriptions = new Map();    // share_id -> {peer, onStream}
+
+function sendShareSignal(shareId, to, signal) {
+    if (ws && ws.readyState === WebSocket.OPEN) {
+        ws.send(JSON.stringify({type: 'share_signal', share_id: shareId, to: to || undefined, signal: signal}));
+    }
+}
+
+async function startScreenShare(options) {
+    if (screenShare) {
+        return screenShare.share;
+    }
+    const stream = await navigator.mediaDevices.getDisplayMedia({video: true, audio: true});
+    const response = await fetch('/api/screenshares', {
+        method: 'POST',
+        headers: {'Content-Type': 'application/json', 'X-HD1-ID': hd1Id},
+        body: JSON.stringify(options || {})
+    });
+    if (!response.ok) {
+        stream.getTracks().forEach(track => track.stop());
+        throw new Error(await response.text());
+    }
+    const result = await response.json();
+    screenShare = {share: result.share, stream: stream, peers: new Map()};
+    // The browser's own "stop sharing" control ends the share too
+    stream.getVideoTracks()[0].addEventListener('ended', () => stopScreenShare());
+    addDebug('SCREEN_SHARE_STARTED', result.share);
+    return result.share;
+}
+
+async function stopScreenShare() {
+    if (!screenShare) {
+        return;
+    }
+    const {share, stream, peers} = screenShare;
+    screenShare = null;
+    peers.forEach(peer => peer.close());
+    stream.getTracks().forEach(track => track.stop());
+    await fetch('/api/screenshares/' + encodeURIComponent(share.id), {
+        method: 'DELETE',
+        headers: {'X-HD1-ID': hd1Id}
+    });
+    addDebug('SCREEN_SHARE_STOPPED', share.id);
+}
+
+// subscribe calls onStream(stream, local) once the share's media arrives
+// and returns a function that unsubscribes
+function subscribeScreenShare(shareId, onStream) {
+    if (screenShare && screenShare.share.id === shareId) {
+        onStream(screenShare.stream, true);
+        return () => {};
+    }
+    const peer = new RTCPeerConnection();
+    shareSubscriptions.set(shareId, {peer: peer});
+    peer.addTransceiver('video', {direction: 'recvonly'});
+    peer.addTransceiver('audio', {direction: 'recvonly'});
+    peer.ontrack = (event) => onStream(event.streams[0], false);
+    peer.onicecandidate = (event) => {
+        if (event.candidate) {
+            sendShareSignal(shareId, null, {type: 'candidate', candidate: event.candidate});
+        }
+    };
+    peer.createOffer()
+        .then(offer => peer.setLocalDescription(offer))
+        .then(() => sendShareSignal(shareId, null, {type: 'offer', sdp: peer.localDescription.sdp}))
+        .catch(error => addDebug('SCREEN_SHARE_ERROR', error.message));
+    return () => {
+        shareSubscriptions.delete(shareId);
+        peer.close();
+        sendShareSignal(shareId, null, {type: 'bye'});
+    };
+}
+
+async function handleShareSignal(data) {
+    const signal = data.signal || {};
+    try {
+        if (screenShare && data.share_id === screenShare.share.id) {
+            // A viewer subscribing to this console's share
+            let peer = screenShare.peers.get(data.from);
+            if (signal.type === 'offer') {
+                if (peer) peer.close();
+                peer = new RTCPeerConnection();
+                screenShare.peers.set(data.from, peer);
+                screenShare.stream.getTracks().forEach(track => peer.addTrack(track, screenShare.stream));
+                peer.onicecandidate = (event) => {
+                    if (event.candidate) {
+                        sendShareSignal(data.share_id, data.from, {type: 'candidate', candidate: event.candidate});
+                    }
+                };
+                await peer.setRemoteDescription({type: 'offer', sdp: signal.sdp});
+                await peer.setLocalDescription(await peer.createAnswer());
+                sendShareSignal(data.share_id, data.from, {type: 'answer', sdp: peer.localDescription.sdp});
+            } else if (signal.type === 'candidate' && peer) {
+                await peer.addIceCandidate(signal.candidate);
+            } else if (signal.type === 'bye' && peer) {
+                peer.close();
+                screenShare.peers.delete(data.from);
+            }
+            return;
+        }
+        
+        const subscription = shareSubscriptions.get(data.share_id);
+        if (!subscription) {
+            return;
+        }
+        if (signal.type === 'answer') {
+            await subscription.peer.setRemoteDescription({type: 'answer', sdp: signal.sdp});
+        } else if (signal.type === 'candidate') {
+            await subscription.peer.addIceCandidate(signal.candidate);
+        }
+    } catch (error) {
+        addDebug('SCREEN_SHARE_ERROR', error.message);
+    }
+}
+
+window.hd1ScreenShare = {
+    start: startScreenShare,
+    stop: stopScreenShare,
+    subscribe: subscribeScreenShare,
+    current: () => screenShare && screenShare.share
+};
+
+// Whiteboards - strokes are points within 0-1 of the board, origin top
+// left; the server merges each delta and broadcasts it as whiteboard_delta
+async function sendWhiteboardDelta(entityId, delta) {
+    const response = await fetch('/api/entities/' + encodeURIComponent(entityId) + '/whiteboard', {
+        method: 'POST',
+        headers: {'Content-Type': 'application/json', 'X-HD1-ID': hd1Id},
+        body: JSON.stringify(delta)
+    });
+    if (!response.ok) {
+        throw new Error(await response.text());
+    }
+    return response.json();
+}
+
+async function drawWhiteboardStroke(entityId, points, options) {
+    const stroke = {
+        id: crypto.randomUUID(),
+        color: (options && options.color) || '#000000',
+        size: (options && options.size) || 0.005,
+        points: points
+    };
+    await sendWhiteboardDelta(entityId, {add: [stroke]});
+    return stroke.id;
+}
+
+window.hd1Whiteboard = {
+    draw: drawWhiteboardStroke,
+    erase: (entityId, strokeIds) => sendWhiteboardDelta(entityId, {remove: strokeIds}),
+    clear: (entityId) => sendWhiteboardDelta(entityId, {clear: true})
+};
+
+// Forms - answers are drafted on the form's card with fill, then sent
+// whole; submit without values sends the drafted ones and clears the card
+function formState(entityId) {
+    const object = window.hd1ThreeJS && window.hd1ThreeJS.objects.get(entityId);
+    if (!object || !object.userData.form) {
+        throw new Error('Unknown form: ' + entityId);
+    }
+    return object.userData.form;
+}
+
+async function submitForm(entityId, values) {
+    const state = formState(entityId);
+    const response = await fetch('/api/entities/' + encodeURIComponent(entityId) + '/form', {
+        method: 'POST',
+        headers: {'Content-Type': 'application/json', 'X-HD1-ID': hd1Id},
+        body: JSON.stringify({values: values || state.values})
+    });
+    if (!response.ok) {
+        throw new Error(await response.text());
+    }
+    const result = await response.json();
+    if (!values) {
+        const cleared = {};
+        state.form.fields.forEach(field => { cleared[field.name] = undefined; });
+        window.hd1ThreeJS.setFormValues(entityId, cleared);
+    }
+    addDebug('FORM', {entity_id: entityId, submission: result.submission.id, warning: result.warning});
+    return result.submission;
+}
+
+window.hd1Forms = {
+    fields: (entityId) => formState(entityId).form.fields,
+    values: (entityId) => ({...formState(entityId).values}),
+    fill: (entityId, values) => {
+        formState(entityId);
+        window.hd1ThreeJS.setFormValues(entityId, values);
+    },
+    submit: submitForm
+};
+
+// Polls - tallies arrive as poll messages; listeners get every update
+const polls = new Map();                 // poll_id -> poll with counts
+const pollListeners = new Set();
+
+function handlePoll(poll) {
+    polls.set(poll.id, poll);
+    addDebug('POLL', {id: poll.id, status: poll.status, counts: poll.counts});
+    pollListeners.forEach(listener => listener(poll));
+}
+
+async function pollRequest(method, path, body) {
+    const response = await fetch('/api/worlds/' + path, {
+        method: method,
+        headers: {'Content-Type': 'application/json', 'X-HD1-ID': hd1Id},
+        body: body ? JSON.stringify(body) : undefined
+    });
+    if (!response.ok) {
+        throw new Error(await response.text());
+    }
+    return (await response.json()).poll;
+}
+
+function pollPath(pollId, action) {
+    const poll = polls.get(pollId);
+    if (!poll) {
+        throw new Error('Unknown poll: ' + pollId);
+    }
+    return encodeURIComponent(poll.world) + '/polls/' + encodeURIComponent(pollId) + '/' + action;
+}
+
+window.hd1Polls = {
+    create: (world, question, options, multiple) =>
+        pollRequest('POST', encodeURIComponent(world) + '/polls', {question, options, multiple: !!multiple}),
+    vote: (pollId, options) => pollRequest('PUT', pollPath(pollId, 'vote'), {options}),
+    close: (pollId) => pollRequest('POST', pollPath(pollId, 'close')),
+    list: () => Array.from(polls.values()),
+    subscribe: (listener) => {
+        pollListeners.add(listener);
+        return () => pollListeners.delete(listener);
+    }
+};
+
+// Chat - the server keeps no history, so the console keeps the latest
+// messages; listeners get each one as it arrives
+const chatMessages = [];
+const chatListeners = new Set();
+const chatHistory = 100;
+
+function handleChat(message) {
+    chatMessages.push(message);
+    if (chatMessages.length > chatHistory) {
+        chatMessages.shift();
+    }
+    addDebug('CHAT', {from: message.from, source: message.source});
+    chatListeners.forEach(listener => listener(message));
+}
+
+window.hd1Chat = {
+    list: () => chatMessages.slice(),
+    subscribe: (listener) => {
+        chatListeners.add(listener);
+        return () => chatListeners.delete(listener);
+    }
+};
+
+// Documents - shared text edited together. An opened document keeps its
+// text in step with the server's: local edits go out one at a time, and
+// edits from others are transformed past the ones not yet acknowledged.
+// Operations walk the whole text: positive counts keep characters,
+// negative counts delete them, strings insert; counts are code points.
+const documentEditors = new Map();       // document_id -> open document
+const documentListeners = new Set();
+const documentEditor = 'ed-' + Math.random().toString(36).slice(2, 10);
+
+async function documentRequest(method, path, body) {
+    const response = await fetch('/api/worlds/' + path, {
+        method: method,
+        headers: {'Content-Type': 'application/json', 'X-HD1-ID': hd1Id},
+        body: body ? JSON.stringify(body) : undefined
+    });
+    if (!response.ok) {
+        throw new Error(await response.text());
+    }
+    return response.json();
+}
+
+function documentPath(world, documentId, action) {
+    return encodeURIComponent(world) + '/documents' +
+        (documentId ? '/' + encodeURIComponent(documentId) : '') + (action ? '/' + action : '');
+}
+
+function pushComponent(op, component) {
+    if (component === '' || component === 0) {
+        return op;
+    }
+    const last = op.length - 1;
+    if (typeof component === 'string') {
+        if (last >= 0 && typeof op[last] === 'string') {
+            op[last] += component;
+        } else if (last >= 0 && op[last] < 0) {
+            // Inserts go ahead of the deletes next to them
+            if (last >= 1 && typeof op[last - 1] === 'string') {
+                op[last - 1] += component;
+            } else {
+                op.splice(last, 0, component);
+            }
+        } else {
+            op.push(component);
+        }
+    } else if (last >= 0 && typeof op[last] === 'number' && (op[last] > 0) === (component > 0)) {
+        op[last] += component;
+    } else {
+        op.push(component);
+    }
+    return op;
+}
+
+function applyOperation(text, op) {
+    const chars = Array.from(text);
+    let result = '';
+    let at = 0;
+    op.forEach(component => {
+        if (typeof component === 'string') {
+            result += component;
+        } else if (component > 0) {
+            result += chars.slice(at, at + component).join('');
+            at += component;
+        } else {
+            at -= component;
+        }
+    });
+    return result;
+}
+
+// transformOperations returns [a', b'], a after b and b after a; where both
+// insert at one place a's text goes first, as on the server
+function transformOperations(a, b) {
+    const aPrime = [], bPrime = [];
+    let i = 0, j = 0;
+    let ca = a[i++], cb = b[j++];
+    while (ca !== undefined || cb !== undefined) {
+        if (typeof ca === 'string') {
+            pushComponent(aPrime, ca);
+            pushComponent(bPrime, Array.from(ca).length);
+            ca = a[i++];
+            continue;
+        }
+        if (typeof cb === 'string') {
+            pushComponent(aPrime, Array.from(cb).length);
+            pushComponent(bPrime, cb);
+            cb = b[j++];
+            continue;
+        }
+        if (ca === undefined || cb === undefined) {
+            throw new Error('Concurrent operations cover different texts');
+        }
+        const n = Math.min(Math.abs(ca), Math.abs(cb));
+        if (ca > 0 && cb > 0) {
+            pushComponent(aPrime, n);
+            pushComponent(bPrime, n);
+        } else if (ca < 0 && cb > 0) {
+            pushComponent(aPrime, -n);
+        } else if (ca > 0 && cb < 0) {
+            pushComponent(bPrime, -n);
+        }
+        ca = Math.abs(ca) === n ? a[i++] : ca - Math.sign(ca) * n;
+        cb = Math.abs(cb) === n ? b[j++] : cb - Math.sign(cb) * n;
+    }
+    return [aPrime, bPrime];
+}
+
+function transformIndex(index, op) {
+    let moved = index;
+    for (const component of op) {
+        if (typeof component === 'string') {
+            moved += Array.from(component).length;
+        } else if (component < 0) {
+            moved -= Math.min(index, -component);
+            index += component;
+        } else {
+            index -= component;
+        }
+        if (index < 0) {
+            break;
+        }
+    }
+    return moved;
+}
+
+// diffOperation returns the operation turning one text into another, as
+// one change between their common start and end
+function diffOperation(from, to) {
+    const a = Array.from(from), b = Array.from(to);
+    let start = 0;
+    while (start < a.length && start < b.length && a[start] === b[start]) {
+        start++;
+    }
+    let end = 0;
+    while (end < a.length - start && end < b.length - start && a[a.length - 1 - end] === b[b.length - 1 - end]) {
+        end++;
+    }
+    const op = [];
+    pushComponent(op, start);
+    pushComponent(op, b.slice(start, b.length - end).join(''));
+    pushComponent(op, -(a.length - start - end));
+    pushComponent(op, end);
+    return op;
+}
+
+class SharedDocument {
+    constructor(document) {
+        this.reset(document);
+        this.listeners = new Set();
+    }
+
+    reset(document) {
+        this.id = document.id;
+        this.world = document.world;
+        this.title = document.title;
+        this.text = document.text;
+        this.revision = document.revision;
+        this.pending = [];                // Local operations, the first sent
+        this.early = new Map();           // revision -> edit arriving ahead of one before it
+        this.cursors = new Map((document.cursors || []).map(cursor => [cursor.hd1_id, cursor]));
+        this.cursorDue = null;
+        this.stalled = null;
+    }
+
+    // edit applies a local operation, or a whole new text
+    edit(change) {
+        const op = typeof change === 'string' ? diffOperation(this.text, change) : change;
+        this.text = applyOperation(this.text, op);
+        this.cursors.forEach(cursor => {
+            cursor.position = transformIndex(cursor.position, op);
+            cursor.anchor = transformIndex(cursor.anchor, op);
+        });
+        this.pending.push(op);
+        if (this.pending.length === 1) {
+            this.send();
+        }
+        this.notify('edit');
+    }
+
+    send() {
+        documentRequest('POST', documentPath(this.world, this.id, 'operations'),
+            {revision: this.revision, operation: this.pending[0], editor: documentEditor})
+            .catch(error => {
+                addDebug('DOCUMENT_ERROR', error.message);
+                this.reload();
+            });
+    }
+
+    // receive takes edits in revision order; this editor's own acknowledge
+    // the operation it sent
+    receive(edit) {
+        if (edit.revision <= this.revision) {
+            return;
+        }
+        this.early.set(edit.revision, edit);
+        while (this.early.has(this.revision + 1)) {
+            const next = this.early.get(this.revision + 1);
+            this.early.delete(this.revision + 1);
+            this.revision = next.revision;
+            if (next.editor === documentEditor && this.pending.length > 0) {
+                this.pending.shift();
+                if (this.pending.length > 0) {
+                    this.send();
+                } else if (this.cursorDue) {
+                    this.sendCursor();
+                }
+                continue;
+            }
+            let op = next.operation;
+            for (let k = 0; k < this.pending.length; k++) {
+                [this.pending[k], op] = transformOperations(this.pending[k], op);
+            }
+            this.text = applyOperation(this.text, op);
+            this.cursors.forEach(cursor => {
+                cursor.position = transformIndex(cursor.position, op);
+                cursor.anchor = transformIndex(cursor.anchor, op);
+            });
+            this.notify('edit');
+        }
+        // An edit missed in between holds up the rest; start over from the server's text
+        if (this.early.size > 0 && !this.stalled) {
+            const revision = this.revision;
+            this.stalled = setTimeout(() => {
+                this.stalled = null;
+                if (this.revision === revision && this.early.size > 0) {
+                    this.reload();
+                }
+            }, 2000);
+        }
+    }
+
+    // setCursor shows this session's caret or selection to the others
+    setCursor(position, anchor) {
+        this.cursorDue = {position: position, anchor: anchor === undefined ? position : anchor};
+        if (this.pending.length === 0) {
+            this.sendCursor();
+        }
+    }
+
+    sendCursor() {
+        if (ws && ws.readyState === WebSocket.OPEN) {
+            ws.send(JSON.stringify(Object.assign({type: 'document_cursor', document_id: this.id, revision: this.revision}, this.cursorDue)));
+        }
+        this.cursorDue = null;
+    }
+
+    moveCursor(hd1Id, revision, cursor) {
+        if (!cursor) {
+            this.cursors.delete(hd1Id);
+        } else if (revision === this.revision) {
+            this.pending.forEach(op => {
+                cursor.position = transformIndex(cursor.position, op);
+                cursor.anchor = transformIndex(cursor.anchor, op);
+            });
+            this.cursors.set(hd1Id, cursor);
+        }
+        this.notify('cursor');
+    }
+
+    async reload() {
+        const result = await documentRequest('GET', documentPath(this.world, this.id));
+        if (this.pending.length > 0) {
+            addDebug('DOCUMENT_RELOAD', {id: this.id, dropped: this.pending.length});
+        }
+        this.reset(result.document);
+        this.notify('reload');
+    }
+
+    subscribe(listener) {
+        this.listeners.add(listener);
+        return () => this.listeners.delete(listener);
+    }
+
+    notify(event) {
+        this.listeners.forEach(listener => listener(event, this));
+    }
+
+    close() {
+        if (ws && ws.readyState === WebSocket.OPEN) {
+            ws.send(JSON.stringify({type: 'document_cursor', document_id: this.id, revision: this.revision, position: -1}));
+        }
+        documentEditors.delete(this.id);
+    }
+}
+
+function handleDocument(event, document) {
+    const editor = documentEditors.get(document.id);
+    if (editor && event === 'deleted') {
+        editor.notify('deleted');
+        documentEditors.delete(document.id);
+    } else if (editor) {
+        editor.title = document.title;
+    }
+    addDebug('DOCUMENT', {id: document.id, event: event});
+    documentListeners.forEach(listener => listener(event, document));
+}
+
+function handleDocumentEdit(edit) {
+    const editor = documentEditors.get(edit.document_id);
+    if (editor) {
+        editor.receive(edit);
+    }
+}
+
+function handleDocumentCursor(data) {
+    const editor = documentEditors.get(data.document_id);
+    if (editor && data.hd1_id !== hd1Id) {
+        editor.moveCursor(data.hd1_id, data.revision, data.cursor);
+    }
+}
+
+window.hd1Documents = {
+    list: async (world) => (await documentRequest('GET', documentPath(world))).documents,
+    create: async (world, title, text, entityId) =>
+        (await documentRequest('POST', documentPath(world), {title, text, entity_id: entityId})).document,
+    update: async (world, documentId, changes) =>
+        (await documentRequest('PUT', documentPath(world, documentId), changes)).document,
+    remove: async (world, documentId) =>
+        (await documentRequest('DELETE', documentPath(world, documentId))).document,
+    open: async (world, documentId) => {
+        const result = await documentRequest('GET', documentPath(world, documentId));
+        const editor = new SharedDocument(result.document);
+        documentEditors.set(editor.id, editor);
+        return editor;
+    },
+    subscribe: (listener) => {
+        documentListeners.add(listener);
+        return () => documentListeners.delete(listener);
+    }
+};
+
+// Camera views - named viewpoints of a world. Deep links such as
+// /w/world_one?view=lobby open the console at one once the session joins;
+// links with ?arrival= finish a portal's handover from another server.
+const viewListeners = new Set();
+let linkedViewOpened = false;
+
+function handleView(event, view) {
+    addDebug('VIEW', {event: event, name: view.name});
+    viewListeners.forEach(listener => listener(event, view));
+}
+
+async function viewRequest(method, world, name, action, body) {
+    const response = await fetch('/api/worlds/' + encodeURIComponent(world) + '/views' +
+        (name ? '/' + encodeURIComponent(name) : '') + (action ? '/' + action : ''), {
+        method: method,
+        headers: {'Content-Type': 'application/json', 'X-HD1-ID': hd1Id},
+        body: body ? JSON.stringify(body) : undefined
+    });
+    if (!response.ok) {
+        throw new Error(await response.text());
+    }
+    return response.json();
+}
+
+// Save where the camera stands and looks
+async function saveView(world, name, title) {
+    const scene = window.hd1ThreeJS;
+    if (!scene) {
+        throw new Error('Scene not ready');
+    }
+    const position = scene.camera.position;
+    return (await viewRequest('PUT', world, name, '', {
+        title: title || '',
+        position: {x: position.x, y: position.y, z: position.z},
+        yaw: scene.yaw,
+        pitch: scene.pitch
+    })).view;
+}
+
+// Stand the camera where the server placed the session's avatar
+function placeCamera(position, yaw, pitch) {
+    const scene = window.hd1ThreeJS;
+    if (scene) {
+        scene.camera.position.set(position.x, position.y, position.z);
+        scene.yaw = yaw;
+        scene.pitch = pitch;
+        scene.camera.rotation.set(pitch, yaw, 0);
+    }
+}
+
+// Move the camera to a view and the session's avatar with it; spectators
+// have no avatar, so only their camera moves
+async function goToView(world, name) {
+    const view = window.hd1Spectating
+        ? (await viewRequest('GET', world, name)).view
+        : (await viewRequest('POST', world, name, 'visit')).view;
+    placeCamera(view.position, view.yaw, view.pitch);
+    addDebug('VIEW_VISIT', {world: world, name: name});
+    return view;
+}
+
+// Claim the arrival a portal on another server handed over
+async function claimArrival(world, ticket) {
+    const response = await fetch('/api/worlds/' + encodeURIComponent(world) + '/arrivals/' +
+        encodeURIComponent(ticket) + '/claim', {method: 'POST', headers: {'X-HD1-ID': hd1Id}});
+    if (!response.ok) {
+        throw new Error(await response.text());
+    }
+    const arrival = (await response.json()).arrival;
+    placeCamera(arrival.position, arrival.yaw, arrival.pitch);
+    history.replaceState(null, '', location.pathname);
+    addDebug('PORTAL_ARRIVAL', {from: arrival.from, world: world});
+    return arrival;
+}
+
+function openLinkedView() {
+    const match = location.pathname.match(/^\/w\/([^/]+)$/);
+    const params = new URLSearchParams(location.search);
+    if (linkedViewOpened || !match) {
+        return;
+    }
+    linkedViewOpened = true;
+    const world = decodeURIComponent(match[1]);
+    if (params.get('arrival')) {
+        claimArrival(world, params.get('arrival')).catch(error => addDebug('PORTAL_ARRIVAL_ERROR', error.message));
+    } else if (params.get('view')) {
+        goToView(world, params.get('view')).catch(error => addDebug('VIEW_LINK_ERROR', error.message));
+    }
+}
+
+// Follow a portal: to its place in this world, or to another server's
+function handlePortalTransfer(transfer) {
+    addDebug('PORTAL_TRANSFER', transfer);
+    if (transfer.error) {
+        return;
+    }
+    if (transfer.url) {
+        location.assign(transfer.url);
+        return;
+    }
+    placeCamera(transfer.position, transfer.yaw, transfer.pitch);
+}
+
+// Start or stop following the director's shot, as a spectator
+function followDirectorShot(follow) {
+    if (ws && ws.readyState === WebSocket.OPEN) {
+        ws.send(JSON.stringify({type: 'spectator_follow', follow: !!follow}));
+    }
+}
+window.hd1Spectator = {follow: followDirectorShot};
+
+// Broadcast render client - a console opened at a broadcast's render URL
+// records its canvas at the broadcast's size and streams the recording to
+// the server, which encodes it for the broadcast's endpoints. Only the
+// broadcast ending stops it; otherwise it connects again, backing off.
+let broadcastSocket = null;
+let broadcastRecorder = null;
+let broadcastRetryMs = 1000;
+
+function startBroadcast() {
+    if (!broadcastId || broadcastSocket) {
+        return;
+    }
+    const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+    const socket = new WebSocket(`${protocol}//${window.location.host}/ws/broadcast?id=` +
+        encodeURIComponent(broadcastId) + '&token=' + encodeURIComponent(broadcastToken || ''));
+    broadcastSocket = socket;
+    
+    socket.onmessage = function(event) {
+        const data = JSON.parse(event.data);
+        if (data.type === 'broadcast_start') {
+            broadcastRetryMs = 1000;
+            recordBroadcast(socket, data);
+        }
+    };
+    socket.onclose = function(event) {
+        stopBroadcastRecorder();
+        broadcastSocket = null;
+        addDebug('BROADCAST_CLOSED', {code: event.code, reason: event.reason});
+        if (event.code !== 1000) {
+            setTimeout(startBroadcast, broadcastRetryMs);
+            broadcastRetryMs = Math.min(broadcastRetryMs * 2, 30000);
+        }
+    };
+}
+
+function recordBroadcast(socket, settings) {
+    document.body.classList.add('hd1-broadcast');
+    if (window.hd1ThreeJS) {
+        window.hd1ThreeJS.setBroadcastSize(settings.width, settings.height);
+    }
+    const mimeType = ['video/webm;codecs=h264', 'video/webm;codecs=vp9', 'video/webm;codecs=vp8', 'video/webm']
+        .find(type => MediaRecorder.isTypeSupported(type));
+    broadcastRecorder = new MediaRecorder(canvas.captureStream(settings.frame_rate), {
+        mimeType: mimeType,
+        videoBitsPerSecond: settings.bitrate_kbps * 1000
+    });
+    broadcastRecorder.ondataavailable = function(event) {
+        if (event.data.size > 0 && socket.readyState === WebSocket.OPEN) {
+            socket.send(event.data);
+        }
+    };
+    broadcastRecorder.start(250); // A piece every quarter second
+    addDebug('BROADCAST_START', {mimeType: mimeType, width: settings.width, height: settings.height});
+}
+
+function stopBroadcastRecorder() {
+    if (broadcastRecorder && broadcastRecorder.state !== 'inactive') {
+        broadcastRecorder.stop();
+    }
+    broadcastRecorder = null;
+}
+
+window.hd1Views = {
+    list: async (world) => (await viewRequest('GET', world)).views,
+    save: saveView,
+    go: goToView,
+    remove: async (world, name) => (await viewRequest('DELETE', world, name)).view,
+    link: (world, name) => location.origin + '/w/' + encodeURIComponent(world) + '?view=' + encodeURIComponent(name),
+    subscribe: (listener) => {
+        viewListeners.add(listener);
+        return () => viewListeners.delete(listener);
+    }
+};
+
+// World streaming: with chunks on, the server sends the entities of the
+// chunks around this session's avatar as it moves, and the full sync leaves
+// entity operations out
+const loadedChunks = new Set(); // Chunks named "x,z"
+let chunkManifest = null;
+
+function handleChunk(message) {
+    const scene = window.hd1ThreeJS;
+    if (!scene) {
+        return;
+    }
+    const chunk = message.chunk;
+    switch (message.event) {
+        case 'load':
+            loadedChunks.add(chunk);
+            // falls through
+        case 'enter':
+            (message.entities || []).forEach(entity => scene.handleEntityCreate(entity));
+            break;
+        case 'unload':
+            loadedChunks.delete(chunk);
+            // falls through
+        case 'leave':
+            (message.ids || []).forEach(id => scene.handleEntityDelete({id: id}));
+            break;
+    }
+    addDebug('CHUNK', {event: message.event, chunk: chunk,
+        entities: (message.entities || message.ids || []).length});
+}
+
+window.hd1Chunks = {
+    manifest: () => chunkManifest,
+    loaded: () => Array.from(loadedChunks)
+};
+
+// Rebootstrap functionality
+function triggerRebootstrap() {
+    addDebug('REBOOTSTRAP', 'Clearing storage and reloading page...');
+    
+    // Consent given stays given
+    localStorage.clear();
+    if (consentToken) {
+        localStorage.setItem('hd1_consent_token', consentToken);
+    }
+    sessionStorage.clear();
+    
+    document.cookie.split(";").forEach(function(c) { 
+        document.cookie = c.replace(/^ +/, "").replace(/=.*/, "=;expires=" + new Date().toUTCString() + ";path=/"); 
+    });
+    
+    if ('caches' in window) {
+        caches.keys().then(names => {
+            names.forEach(name => {
+                caches.delete(name);
+            });
+        });
+    }
+    
+    setTimeout(() => {
+        window.location.reload(true);
+    }, 1000);
+}
+
+// Console panel collapse functionality
+let debugCollapsed = false;
+
+debugHeader.addEventListener('click', function() {
+    debugCollapsed = !debugCollapsed;
+    const debugContent = document.getElementById('debug-content');
+    
+    if (debugCollapsed) {
+        debugContent.classList.add('collapsed');
+        debugCollapseIcon.classList.add('collapsed');
+        debugCollapseIcon.innerHTML = '&#8681;'; // Down arrow
+        debugCollapseIcon.title = t('console.expand');
+    } else {
+        debugContent.classList.remove('collapsed');
+        debugCollapseIcon.classList.remove('collapsed');
+        debugCollapseIcon.innerHTML = '&#8679;'; // Up arrow
+        debugCollapseIcon.title = t('console.collapse');
+    }
+    
+    addDebug('CONSOLE_TOGGLE', {collapsed: debugCollapsed});
+});
+
+// Update rebootstrap button with current hd1_id
+function updateRebootstrapButton() {
+    const btn = document.getElementById('rebootstrap-btn');
+    if (hd1Id) {
+        btn.textContent = hd1Id;
+        btn.title = t('rebootstrap.title_id', {id: hd1Id});
+    } else {
+        btn.textContent = t('rebootstrap.button');
+        btn.title = t('rebootstrap.title');
+    }
+}
+
+// Rebootstrap button
+const rebootstrapBtn = document.getElementById('rebootstrap-btn');
+rebootstrapBtn.addEventListener('click', function() {
+    if (confirm(t('rebootstrap.confirm'))) {
+        triggerRebootstrap();
+    }
+});
+
+// Request full sync from server
+async function requestFullSync() {
+    if (!apiClient) {
+        addDebug('BOOTSTRAP_ERROR', 'API client not available');
+        return;
+    }
+    
+    resyncing = true;
+    try {
+        addDebug('BOOTSTRAP_START', 'Requesting full sync...');
+        const response = await apiClient.request('GET', '/sync/full?chunked=true');
+        chunkManifest = response.chunked ? response.chunks : null;
+        
+        if (response.success && response.operations) {
+            addDebug('BOOTSTRAP_SUCCESS', `Received ${response.operations.length} operations`);
+            
+            // Apply all operations to Three.js scene
+            if (window.hd1ThreeJS) {
+                for (const opWrapper of response.operations) {
+                    window.hd1ThreeJS.handleSyncOperation(opWrapper.operation);
+                    lastAppliedSeq = Math.max(lastAppliedSeq, opWrapper.seq_num);
+                }
+                addDebug('BOOTSTRAP_APPLIED', `Applied ${response.operations.length} operations to scene`);
+            } else {
+                addDebug('BOOTSTRAP_ERROR', 'Three.js scene manager not available');
+            }
+        } else {
+            addDebug('BOOTSTRAP_ERROR', 'Failed to get full sync: ' + JSON.stringify(response));
+        }
+    } catch (error) {
+        addDebug('BOOTSTRAP_ERROR', 'Full sync request failed: ' + error.message);
+    } finally {
+        resyncing = false;
+    }
+}
+
+// Reload the entities whose hashes differ from the server's, or the whole
+// world when there are no hashes or most of the scene diverged
+async function resyncEntities(hashes) {
+    const scene = window.hd1ThreeJS;
+    if (!scene || resyncing) {
+        return;
+    }
+    const local = hashes ? scene.entityHashes() : new Map();
+    const divergent = hashes ? Object.keys(hashes).filter(id => local.get(id) !== hashes[id]) : [];
+    if (!hashes || !apiClient || divergent.length > Math.max(local.size, 1) / 2) {
+        fullResync();
+        return;
+    }
+    
+    const extra = Array.from(local.keys()).filter(id => !(id in hashes));
+    addDebug('RESYNC', {divergent: divergent.length, extra: extra.length});
+    extra.forEach(id => scene.handleEntityDelete({id: id}));
+    if (divergent.length === 0) {
+        return;
+    }
+    
+    // Operations still in flight are applied on top, in order, and leave
+    // the entities as the snapshot has them
+    resyncing = true;
+    let failed = false;
+    try {
+        const ids = divergent.map(encodeURIComponent).join(',');
+        const response = await apiClient.request('GET', '/sync/entities?ids=' + ids);
+        response.entities.forEach(entity => scene.handleEntityCreate(entity));
+        response.missing.forEach(id => scene.handleEntityDelete({id: id}));
+    } catch (error) {
+        addDebug('RESYNC_ERROR', 'Partial resync failed: ' + error.message);
+        failed = true;
+    } finally {
+        resyncing = false;
+    }
+    if (failed) {
+        fullResync();
+    }
+}
+
+// Clear the scene and rebuild it from the whole operation log
+function fullResync() {
+    addDebug('RESYNC', 'Full resync');
+    if (window.hd1ThreeJS) {
+        window.hd1ThreeJS.resetWorld();
+    }
+    lastAppliedSeq = 0;
+    // The chunks went with the scene
+    if (loadedChunks.size > 0 && ws && ws.readyState === WebSocket.OPEN) {
+        loadedChunks.clear();
+        ws.send(JSON.stringify({type: 'chunks_reload'}));
+    }
+    requestFullSync();
+}
+
+// Answer a checksum challenge with the checksum of the rendered scene
+async function answerChecksumChallenge(challenge) {
+    if (resyncing || !window.hd1ThreeJS || !ws || ws.readyState !== WebSocket.OPEN) {
+        return;
+    }
+    const seq = lastAppliedSeq;
+    const checksum = await window.hd1ThreeJS.stateChecksum(challenge.algorithm);
+    ws.send(JSON.stringify({
+        type: 'checksum_response',
+        seq: seq,
+        checksum: checksum || '',
+        entities: window.hd1ThreeJS.objects.size
+    }));
+}
+
+// Initialize console
+function initConsole() {
+    addDebug('INIT', 'HD1 Three.js Console initializing...');
+    
+    // Initialize API client without client ID (server will provide it via WebSocket)
+    if (window.HD1ThreeJSAPIClient) {
+        apiClient = new window.HD1ThreeJSAPIClient();
+        window.apiClient = apiClient; // Make globally available for Three.js
+        addDebug('API_CLIENT', 'API client initialized and made globally available');
+    }
+    
+    // Connect once the catalogue is in so status text is never a raw key
+    i18n.load().then(catalogue => {
+        addDebug('LOCALE', {requested: catalogue.requested, locale: catalogue.locale});
+    }).catch(error => {
+        addDebug('LOCALE_ERROR', error.message);
+    }).then(() => ensureConsent()).catch(error => {
+        addDebug('CONSENT_ERROR', error.message);
+    }).finally(() => {
+        connectWebSocket();
+        addDebug('READY', 'HD1 Three.js Console ready');
+    });
+}
+
+// Re-render dynamic strings when the language changes
+i18n.onChange(() => {
+    setStatus(currentStatus);
+    updateRebootstrapButton();
+    debugCollapseIcon.title = t(debugCollapsed ? 'console.expand' : 'console.collapse');
+    if (maintenanceState) {
+        showMaintenanceBanner(maintenanceState);
+    }
+    if (moderationState) {
+        showModerationNotice(moderationState);
+    }
+    if (impersonationState) {
+        showImpersonationBanner(impersonationState);
+    }
+    if (sessionEnded) {
+        showSessionNotice();
+    }
+});
+
 // Start console when DOM is ready
 if (document.readyState === 'loading') {
     document.addEventListener('DOMContentLoaded', initConsole);
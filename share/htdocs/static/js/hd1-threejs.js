@@ -24,6 +24,7 @@ class HD1ThreeJS {
         this.avatars = new Map();      // session_id -> THREE.Object3D
         this.materials = new Map();    // material_id -> THREE.Material
         this.geometries = new Map();   // geometry_id -> THREE.Geometry
+        this.anchors = new Map();      // anchor_id -> anchor (world-space transform)
         
         // Font loading
         this.fontLoader = null;
@@ -35,6 +36,20 @@ class HD1ThreeJS {
         this.controls = null;
         this.cameraTarget = new THREE.Vector3(0, 0, 0);
         this.lastTime = 0;
+        this.frameCount = 0; // Frames rendered, for heartbeats
+        this.frameStats = {frames: 0, cpuMs: 0, gpuMs: 0, gpuFrames: 0}; // Since the last telemetry sample
+        this.gpuTimer = null;         // GPU frame timing, where the driver offers it
+        this.quality = null;          // Server quality directive, null at full quality
+        this.crowd = null;            // Crowd state from the server, null outside a crowd
+        this.crowdMesh = null;        // Far crowd avatars, drawn as one instanced mesh
+        this.acceptedPosition = null; // Last avatar position the server took
+        this.physics = null;          // World physics profile, null for the default
+        this.environment = null;      // Time of day and weather, null when the world has none
+        this.clock = null;            // Simulation clock, null while it runs at real time
+        this.backgroundSet = false;   // The world chose a background; the sky leaves it alone
+        this.emitters = new Set();    // Entities with a particles component
+        this.screens = new Set();     // Entities with a media component
+        this.clouds = new Set();      // Entities with a pointcloud component
         
         // Initialize scene
         this.setupRenderer();
@@ -156,12 +171,101 @@ class HD1ThreeJS {
         this.renderer.shadowMap.type = THREE.PCFSoftShadowMap;
         this.renderer.outputColorSpace = THREE.SRGBColorSpace;
         this.renderer.toneMapping = THREE.ACESFilmicToneMapping;
+        
+        // WebGL 2 drivers may time frames on the GPU; one query is in flight at a time
+        const gl = this.renderer.getContext();
+        const timerQuery = gl.getExtension('EXT_disjoint_timer_query_webgl2');
+        if (timerQuery && typeof gl.createQuery === 'function') {
+            this.gpuTimer = {gl: gl, ext: timerQuery, query: null, running: false};
+        }
+    }
+    
+    // Collects a finished GPU timing, then starts timing this frame if none is in flight
+    beginGPUTiming() {
+        const timer = this.gpuTimer;
+        if (!timer) {
+            return;
+        }
+        const gl = timer.gl;
+        if (timer.query) {
+            if (!gl.getQueryParameter(timer.query, gl.QUERY_RESULT_AVAILABLE)) {
+                return;
+            }
+            if (!gl.getParameter(timer.ext.GPU_DISJOINT_EXT)) {
+                this.frameStats.gpuMs += gl.getQueryParameter(timer.query, gl.QUERY_RESULT) / 1e6;
+                this.frameStats.gpuFrames++;
+            }
+            gl.deleteQuery(timer.query);
+            timer.query = null;
+        }
+        timer.query = gl.createQuery();
+        gl.beginQuery(timer.ext.TIME_ELAPSED_EXT, timer.query);
+        timer.running = true;
+    }
+    
+    endGPUTiming() {
+        const timer = this.gpuTimer;
+        if (timer && timer.running) {
+            timer.gl.endQuery(timer.ext.TIME_ELAPSED_EXT);
+            timer.running = false;
+        }
+    }
+    
+    // Renders as much as the server's quality directive allows: shadow
+    // quality, tone mapping, pixel ratio and the distance entities are
+    // drawn to (see src/quality)
+    applyQuality(directive) {
+        this.quality = directive.level > 0 ? directive : null;
+        
+        const shadows = this.renderer.shadowMap;
+        const shadowType = directive.shadows === 'basic' ? THREE.BasicShadowMap : THREE.PCFSoftShadowMap;
+        if (shadows.enabled !== (directive.shadows !== 'off') || shadows.type !== shadowType) {
+            shadows.enabled = directive.shadows !== 'off';
+            shadows.type = shadowType;
+            if (this.sunLight) {
+                const size = directive.shadows === 'basic' ? 1024 : 2048;
+                this.sunLight.shadow.mapSize.set(size, size);
+                if (this.sunLight.shadow.map) {
+                    this.sunLight.shadow.map.dispose();
+                    this.sunLight.shadow.map = null;
+                }
+            }
+            // Materials compile shadows in or out
+            this.scene.traverse(object => {
+                if (object.material) {
+                    [].concat(object.material).forEach(material => { material.needsUpdate = true; });
+                }
+            });
+        }
+        
+        // Tone mapping is the post-processing the console does
+        this.renderer.toneMapping = directive.post_processing ? THREE.ACESFilmicToneMapping : THREE.NoToneMapping;
+        
+        const ratio = this.broadcastSize ? 1 : window.devicePixelRatio || 1;
+        this.renderer.setPixelRatio(directive.max_pixel_ratio ? Math.min(ratio, directive.max_pixel_ratio) : ratio);
+        
+        this.camera.far = directive.cull_distance || 1000;
+        this.camera.updateProjectionMatrix();
+    }
+    
+    // Frame statistics since the last call, for telemetry: frames rendered,
+    // their CPU and GPU time, and the draw calls and triangles of the last
+    takeFrameStats() {
+        const stats = this.frameStats;
+        this.frameStats = {frames: 0, cpuMs: 0, gpuMs: 0, gpuFrames: 0};
+        const info = this.renderer.info;
+        return Object.assign(stats, {
+            drawCalls: info.render.calls,
+            triangles: info.render.triangles,
+            entities: this.objects.size
+        });
     }
     
     setupLighting() {
         // Ambient light
         const ambientLight = new THREE.AmbientLight(0x404040, 0.4);
         this.scene.add(ambientLight);
+        this.ambientLight = ambientLight;
         
         // Directional light with shadows
         const directionalLight = new THREE.DirectionalLight(0xffffff, 0.8);
@@ -176,6 +280,7 @@ class HD1ThreeJS {
         directionalLight.shadow.mapSize.width = 2048;
         directionalLight.shadow.mapSize.height = 2048;
         this.scene.add(directionalLight);
+        this.sunLight = directionalLight;
         
         // Grid helper
         const gridHelper = new THREE.GridHelper(20, 20, 0x444444, 0x444444);
@@ -354,6 +459,10 @@ class HD1ThreeJS {
     }
     
     updateMovement(deltaTime) {
+        if (this.director) {
+            this.updateDirector();
+            return; // The director holds the camera
+        }
         if (!this.mouseLook && !this.touchStartX) {
             // Debug: Show why movement isn't working
             if (this.moveForward || this.moveBackward || this.moveLeft || this.moveRight) {
@@ -398,6 +507,11 @@ class HD1ThreeJS {
             return;
         }
         
+        if (window.hd1Spectating) {
+            // Spectators have no avatar; their camera moves for them alone
+            return;
+        }
+        
         if (window.apiClient && window.hd1Id) {
             const positionData = {
                 position: {
@@ -415,13 +529,24 @@ class HD1ThreeJS {
             // Use auto-generated API client to call /avatars/{hd1Id}/move
             window.apiClient.moveAvatar(window.hd1Id, positionData)
                 .then(response => {
+                    // The server shortened a move faster than the world allows
+                    const position = response.clamped ? response.position : positionData.position;
+                    if (response.clamped) {
+                        this.camera.position.set(position.x, position.y, position.z);
+                    }
+                    this.acceptedPosition = position;
                     console.log('[HD1-ThreeJS] Avatar moved:', {
-                        position: positionData.position,
+                        position: position,
                         seq_num: response.seq_num,
                         hd1_id: window.hd1Id
                     });
                 })
                 .catch(error => {
+                    // Refused as impossible - go back to where the server has us
+                    if (error.message.startsWith('HTTP 422') && this.acceptedPosition) {
+                        const position = this.acceptedPosition;
+                        this.camera.position.set(position.x, position.y, position.z);
+                    }
                     console.warn('[HD1-ThreeJS] Avatar move failed:', error);
                 });
         }
@@ -429,6 +554,9 @@ class HD1ThreeJS {
     
     setupEventListeners() {
         window.addEventListener('resize', () => {
+            if (this.broadcastSize) {
+                return; // Broadcasts keep their own size
+            }
             this.camera.aspect = window.innerWidth / window.innerHeight;
             this.camera.updateProjectionMatrix();
             this.renderer.setSize(window.innerWidth, window.innerHeight);
@@ -437,15 +565,26 @@ class HD1ThreeJS {
     
     animate(currentTime = 0) {
         requestAnimationFrame((time) => this.animate(time));
+        const started = performance.now();
         
         // Calculate delta time
         const deltaTime = this.lastTime ? (currentTime - this.lastTime) / 1000 : 0;
         this.lastTime = currentTime;
+        this.frameCount++;
         
         // Update movement
         this.updateMovement(deltaTime);
+        this.updateCrowd();
+        this.updateParticles();
+        this.updateMedia(currentTime);
+        this.updatePointClouds(currentTime);
         
+        this.beginGPUTiming();
         this.renderer.render(this.scene, this.camera);
+        this.endGPUTiming();
+        
+        this.frameStats.frames++;
+        this.frameStats.cpuMs += performance.now() - started;
     }
     
     
@@ -500,6 +639,133 @@ class HD1ThreeJS {
         return avatar;
     }
     
+    // Broadcasts render at their own size, one canvas pixel to a video
+    // pixel, whatever the window
+    setBroadcastSize(width, height) {
+        this.broadcastSize = {width: width, height: height};
+        this.renderer.setPixelRatio(1);
+        this.renderer.setSize(width, height, false);
+        this.camera.aspect = width / height;
+        this.camera.updateProjectionMatrix();
+    }
+    
+    // Director - spectators following it see the world from its shot,
+    // gliding there over the shot's transition or cutting to it. A null
+    // shot gives the camera back where the last one left it.
+    directCamera(shot) {
+        if (!shot) {
+            if (this.director && this.director.fov) {
+                this.camera.fov = this.director.fov;
+                this.camera.updateProjectionMatrix();
+            }
+            this.director = null;
+            return;
+        }
+        if (!this.director) {
+            this.director = {fov: this.camera.fov};
+        }
+        this.director.from = {
+            position: this.camera.position.clone(),
+            yaw: this.yaw,
+            pitch: this.pitch,
+            fov: this.camera.fov
+        };
+        this.director.shot = shot;
+        this.director.started = performance.now();
+    }
+    
+    updateDirector() {
+        const {from, shot, started} = this.director;
+        const duration = shot.transition_ms || 0;
+        const t = duration > 0 ? Math.min(1, (performance.now() - started) / duration) : 1;
+        const ease = t * t * (3 - 2 * t);
+        
+        // Turn the short way round
+        let yaw = shot.yaw - from.yaw;
+        yaw = Math.atan2(Math.sin(yaw), Math.cos(yaw));
+        
+        this.camera.position.lerpVectors(from.position, new THREE.Vector3(shot.position.x, shot.position.y, shot.position.z), ease);
+        this.yaw = from.yaw + yaw * ease;
+        this.pitch = from.pitch + (shot.pitch - from.pitch) * ease;
+        this.camera.rotation.set(this.pitch, this.yaw, 0);
+        if (shot.fov) {
+            this.camera.fov = from.fov + (shot.fov - from.fov) * ease;
+            this.camera.updateProjectionMatrix();
+        }
+    }
+    
+    // Crowds - the server says when the world holds enough avatars to be
+    // one. Avatars beyond the near distance then move less often and, where
+    // the capability profile allows instancing, are drawn as one instanced
+    // mesh of simple capsules instead of a mesh each.
+    setCrowd(crowd) {
+        this.crowd = crowd.active ? crowd : null;
+        if (!this.crowd) {
+            this.clearCrowd();
+        }
+    }
+    
+    updateCrowd() {
+        const profile = window.hd1CapabilityProfile;
+        if (!this.crowd || !profile || !profile.instancing) {
+            this.clearCrowd();
+            return;
+        }
+        
+        const far = [];
+        this.avatars.forEach(avatar => {
+            const distant = avatar.position.distanceTo(this.camera.position) > this.crowd.near_distance;
+            this.setAvatarVisible(avatar, !distant);
+            if (distant) {
+                far.push(avatar);
+            }
+        });
+        
+        // Capacity grows in powers of two so joins rarely rebuild the mesh
+        if (!this.crowdMesh || this.crowdMesh.instanceMatrix.count < far.length) {
+            const capacity = Math.max(64, 2 ** Math.ceil(Math.log2(far.length || 1)));
+            this.clearCrowd();
+            this.crowdMesh = new THREE.InstancedMesh(
+                new THREE.CapsuleGeometry(0.3, 1.8, 2, 6),
+                new THREE.MeshLambertMaterial(),
+                capacity
+            );
+            this.crowdMesh.frustumCulled = false; // Instances spread beyond the geometry's bounds
+            this.scene.add(this.crowdMesh);
+        }
+        far.forEach((avatar, i) => {
+            avatar.updateMatrix();
+            this.crowdMesh.setMatrixAt(i, avatar.matrix);
+            this.crowdMesh.setColorAt(i, avatar.material.color);
+        });
+        this.crowdMesh.count = far.length;
+        this.crowdMesh.instanceMatrix.needsUpdate = true;
+        if (this.crowdMesh.instanceColor) {
+            this.crowdMesh.instanceColor.needsUpdate = true;
+        }
+    }
+    
+    clearCrowd() {
+        if (!this.crowdMesh) {
+            return;
+        }
+        this.scene.remove(this.crowdMesh);
+        this.crowdMesh.geometry.dispose();
+        this.crowdMesh.material.dispose();
+        this.crowdMesh.dispose();
+        this.crowdMesh = null;
+        this.avatars.forEach(avatar => this.setAvatarVisible(avatar, true));
+    }
+    
+    setAvatarVisible(avatar, visible) {
+        avatar.visible = visible;
+        ['leftHand', 'rightHand'].forEach(key => {
+            if (avatar.userData[key]) {
+                avatar.userData[key].visible = visible;
+            }
+        });
+    }
+    
     getAvatarColor(sessionId) {
         // Generate consistent color from session ID
         let hash = 0;
@@ -517,6 +783,15 @@ class HD1ThreeJS {
             this.scene.remove(avatar);
             this.avatars.delete(sessionId);
             
+            // XR hand meshes share the avatar material
+            ['leftHand', 'rightHand'].forEach(key => {
+                const hand = avatar.userData[key];
+                if (hand) {
+                    this.scene.remove(hand);
+                    hand.geometry.dispose();
+                }
+            });
+            
             // Clean up geometry and material
             if (avatar.geometry) avatar.geometry.dispose();
             if (avatar.material) avatar.material.dispose();
@@ -601,6 +876,11 @@ class HD1ThreeJS {
         
         this.scene.remove(entity);
         this.objects.delete(id);
+        this.setParticles(entity, null);
+        this.setPanel(entity, null);
+        this.setMedia(entity, null);
+        this.setWhiteboard(entity, null);
+        this.setForm(entity, null);
         
         // Clean up geometry and material
         if (entity.geometry) entity.geometry.dispose();
@@ -778,6 +1058,96 @@ class HD1ThreeJS {
         return Array.from(this.avatars.values());
     }
     
+    getPhysics() {
+        return this.physics;
+    }
+    
+    getEnvironment() {
+        return this.environment;
+    }
+    
+    getClock() {
+        return this.clock;
+    }
+    
+    // Simulation time in Unix ms: server time, paused or paced by the
+    // world's clock
+    simulationNow() {
+        const now = window.hd1Clock ? window.hd1Clock.now() : Date.now();
+        const clock = this.clock;
+        if (!clock) return now;
+        return clock.paused ? clock.time : clock.time + (now - clock.set_at) * clock.speed;
+    }
+    
+    // An entity's line in the server's world checksum:
+    // id|px,py,pz|rx,ry,rz|sx,sy,sz|visible in thousandths
+    canonicalLine(id) {
+        const object = this.objects.get(id);
+        const q = v => Math.floor(v * 1000 + 0.5);
+        const vector = v => [q(v.x), q(v.y), q(v.z)].join(',');
+        return [
+            id,
+            vector(object.position),
+            vector(object.rotation),
+            vector(object.scale),
+            object.visible ? 1 : 0
+        ].join('|') + '\n';
+    }
+    
+    // What the server's world checksum covers, one line per entity sorted by ID
+    canonicalState() {
+        return Array.from(this.objects.keys()).sort().map(id => this.canonicalLine(id)).join('');
+    }
+    
+    // 32-bit FNV-1a as eight hex digits
+    fnv1a(text) {
+        let hash = 0x811c9dc5;
+        for (const byte of new TextEncoder().encode(text)) {
+            hash = Math.imul(hash ^ byte, 0x01000193);
+        }
+        return (hash >>> 0).toString(16).padStart(8, '0');
+    }
+    
+    // entity_id -> fnv1a of its checksum line, as sent with resync
+    entityHashes() {
+        const hashes = new Map();
+        this.objects.forEach((object, id) => hashes.set(id, this.fnv1a(this.canonicalLine(id))));
+        return hashes;
+    }
+    
+    // Hex checksum of canonicalState, or null when the algorithm is not
+    // available here (sha256 needs a secure context)
+    async stateChecksum(algorithm) {
+        if (algorithm === 'fnv1a') {
+            return this.fnv1a(this.canonicalState());
+        }
+        const bytes = new TextEncoder().encode(this.canonicalState());
+        if (algorithm === 'sha256' && window.crypto && window.crypto.subtle) {
+            const digest = await window.crypto.subtle.digest('SHA-256', bytes);
+            return Array.from(new Uint8Array(digest), b => b.toString(16).padStart(2, '0')).join('');
+        }
+        return null;
+    }
+    
+    // Remove everything the operation log built, before a full sync
+    resetWorld() {
+        this.objects.forEach(obj => {
+            this.scene.remove(obj);
+            this.setParticles(obj, null);
+            this.setPanel(obj, null);
+            this.setMedia(obj, null);
+            this.setWhiteboard(obj, null);
+            this.setForm(obj, null);
+            if (obj.geometry) obj.geometry.dispose();
+            if (obj.material) obj.material.dispose();
+        });
+        this.objects.clear();
+        Array.from(this.avatars.keys()).forEach(id => this.removeAvatar(id));
+        this.anchors.clear();
+        this.pendingTextEntities.clear();
+        console.log('[HD1-ThreeJS] World reset');
+    }
+    
     dispose() {
         // Clean up resources
         this.objects.forEach(obj => {
@@ -853,37 +1223,67 @@ class HD1ThreeJS {
     handleSyncOperation(operation) {
         console.log('[HD1-ThreeJS] Handling sync operation:', operation.type, operation);
         
+        // Generated from the API specification's operation types
+        const OP = window.HD1OperationTypes;
         switch (operation.type) {
-            case 'entity_create':
+            case OP.ENTITY_CREATE:
                 this.handleEntityCreate(operation.data);
                 break;
-            case 'entity_update':
+            case OP.ENTITY_UPDATE:
                 this.handleEntityUpdate(operation.data);
                 break;
-            case 'entity_delete':
+            case OP.ENTITY_DELETE:
                 this.handleEntityDelete(operation.data);
                 break;
-            case 'avatar_create':
+            case OP.WHITEBOARD_DELTA:
+                this.handleWhiteboardDelta(operation.data, operation.seq_num);
+                break;
+            case OP.AVATAR_CREATE:
                 this.handleAvatarCreate(operation.data);
                 break;
-            case 'avatar_move':
+            case OP.AVATAR_MOVE:
                 this.handleAvatarMove(operation.data);
                 break;
-            case 'avatar_remove':
+            case OP.AVATAR_UPDATE:
+                this.handleAvatarUpdate(operation.data);
+                break;
+            case OP.AVATAR_REMOVE:
+            case OP.AVATAR_LEAVE:
                 this.handleAvatarRemove(operation.data);
                 break;
-            case 'scene_update':
+            case OP.SCENE_UPDATE:
                 this.handleSceneUpdate(operation.data);
                 break;
+            case OP.ANCHOR_CREATE:
+                this.handleAnchorCreate(operation.data);
+                break;
+            case OP.ANCHOR_DELETE:
+                this.handleAnchorDelete(operation.data);
+                break;
+            case OP.TRANSACTION:
+                // Committed together: apply every part before the next frame
+                for (const part of operation.data.operations || []) {
+                    this.handleSyncOperation({ ...part, seq_num: operation.seq_num, client_id: operation.client_id });
+                }
+                break;
             default:
                 console.warn('[HD1-ThreeJS] Unknown operation type:', operation.type);
         }
     }
     
     handleEntityCreate(data) {
-        const geometry = this.createGeometry(data.geometry);
-        const material = this.createMaterial(data.material);
-        const mesh = new THREE.Mesh(geometry, material);
+        // Recreating an ID replaces the entity, as on the server
+        this.handleEntityDelete(data);
+        
+        // Pure particle emitters and panels have no geometry of their own
+        let mesh;
+        if (data.geometry) {
+            const geometry = this.createGeometry(data.geometry);
+            const material = this.createMaterial(data.material);
+            mesh = new THREE.Mesh(geometry, material);
+        } else {
+            mesh = new THREE.Group();
+        }
         
         // Set position
         if (data.position) {
@@ -905,6 +1305,28 @@ class HD1ThreeJS {
             mesh.visible = data.visible;
         }
         
+        if (data.particles) {
+            this.setParticles(mesh, data.particles);
+        }
+        if (data.panel) {
+            this.setPanel(mesh, data.panel);
+        }
+        if (data.media) {
+            this.setMedia(mesh, data.media);
+        }
+        if (data.whiteboard) {
+            this.setWhiteboard(mesh, data.whiteboard);
+        }
+        if (data.form) {
+            this.setForm(mesh, data.form);
+        }
+        if (data.pointcloud) {
+            this.setPointCloud(mesh, data.pointcloud);
+        }
+        if (data.terrain) {
+            this.setTerrain(mesh, data.terrain);
+        }
+        
         // Add to scene and track
         this.scene.add(mesh);
         this.objects.set(data.id, mesh);
@@ -936,12 +1358,42 @@ class HD1ThreeJS {
             mesh.visible = data.visible;
         }
         
+        // Replace the emitter; null removes it
+        if (data.particles !== undefined) {
+            this.setParticles(mesh, data.particles);
+        }
+        if (data.panel !== undefined) {
+            this.setPanel(mesh, data.panel);
+        }
+        if (data.media !== undefined) {
+            this.setMedia(mesh, data.media);
+        }
+        if (data.whiteboard !== undefined) {
+            this.setWhiteboard(mesh, data.whiteboard);
+        }
+        if (data.form !== undefined) {
+            this.setForm(mesh, data.form);
+        }
+        if (data.pointcloud !== undefined) {
+            this.setPointCloud(mesh, data.pointcloud);
+        }
+        if (data.terrain !== undefined) {
+            this.setTerrain(mesh, data.terrain);
+        }
+        
         console.log('[HD1-ThreeJS] Entity updated:', data.id);
     }
     
     handleEntityDelete(data) {
         const mesh = this.objects.get(data.id);
         if (mesh) {
+            this.setParticles(mesh, null);
+            this.setPanel(mesh, null);
+            this.setMedia(mesh, null);
+            this.setWhiteboard(mesh, null);
+            this.setForm(mesh, null);
+            this.setPointCloud(mesh, null);
+            this.setTerrain(mesh, null);
             this.scene.remove(mesh);
             this.objects.delete(data.id);
             console.log('[HD1-ThreeJS] Entity deleted:', data.id);
@@ -962,10 +1414,69 @@ class HD1ThreeJS {
         this.removeAvatar(data.hd1_id);
     }
     
+    handleAvatarUpdate(data) {
+        const avatar = this.avatars.get(data.hd1_id);
+        if (avatar && data.ik) {
+            // IK metadata for solving a body from the XR pose
+            avatar.userData.ik = data.ik;
+        }
+    }
+    
+    // XR poses arrive as deltas (full: false) or keyframes (full: true);
+    // the body capsule follows the head and hands get their own meshes
+    handleXRPoses(poses) {
+        const unpack = window.hd1XR ? window.hd1XR.unpackQuaternion : null;
+        if (!unpack) {
+            return;
+        }
+        
+        poses.forEach(entry => {
+            const avatar = this.avatars.get(entry.hd1_id);
+            if (!avatar || !entry.pose) {
+                return;
+            }
+            // A delta older than the pose already shown would snap joints back
+            if (entry.server_time < avatar.userData.poseTime) {
+                return;
+            }
+            avatar.userData.poseTime = entry.server_time;
+            
+            ['head', 'left', 'right'].forEach(name => {
+                const joint = entry.pose[name];
+                if (!joint) {
+                    return;
+                }
+                const position = new THREE.Vector3(joint.p[0] / 1000, joint.p[1] / 1000, joint.p[2] / 1000);
+                const q = unpack(joint.q);
+                const quaternion = new THREE.Quaternion(q.x, q.y, q.z, q.w);
+                
+                if (name === 'head') {
+                    // Capsule centre sits half the IK height below the eyes
+                    const height = (avatar.userData.ik && avatar.userData.ik.height) || 1.8;
+                    avatar.position.set(position.x, position.y - height / 2, position.z);
+                    const euler = new THREE.Euler().setFromQuaternion(quaternion, 'YXZ');
+                    avatar.rotation.set(0, euler.y, 0);
+                    return;
+                }
+                
+                const key = name + 'Hand';
+                let hand = avatar.userData[key];
+                if (!hand) {
+                    hand = new THREE.Mesh(new THREE.SphereGeometry(0.06, 12, 8), avatar.material);
+                    this.scene.add(hand);
+                    avatar.userData[key] = hand;
+                }
+                hand.position.copy(position);
+                hand.quaternion.copy(quaternion);
+            });
+        });
+    }
+    
     handleSceneUpdate(data) {
         // Update scene properties
         if (data.background) {
             this.scene.background = new THREE.Color(data.background);
+            this.backgroundSet = true;
         }
         
         if (data.fog) {
@@ -976,8 +1487,825 @@ class HD1ThreeJS {
             );
         }
         
+        // Physics profile: gravity, damping and collision layers for
+        // whichever physics engine the page runs
+        if (data.physics) {
+            this.physics = data.physics;
+            window.dispatchEvent(new CustomEvent('hd1:physics', {detail: data.physics}));
+        }
+        
+        // Time of day and weather, advanced by the server; precipitation is
+        // left to whatever listens for hd1:environment
+        if (data.environment) {
+            this.applyEnvironment(data.environment);
+            window.dispatchEvent(new CustomEvent('hd1:environment', {detail: data.environment}));
+        }
+        
+        // Simulation clock: particles follow it here; physics engines and
+        // other animations pause or pace themselves on hd1:clock
+        if (data.clock) {
+            this.clock = data.clock;
+            window.dispatchEvent(new CustomEvent('hd1:clock', {detail: data.clock}));
+        }
+        
         console.log('[HD1-ThreeJS] Scene updated');
     }
+    
+    setParticles(object, emitter) {
+        const current = object.userData.particles;
+        if (current) {
+            object.remove(current.points);
+            current.points.geometry.dispose();
+            if (current.points.material.map) current.points.material.map.dispose();
+            current.points.material.dispose();
+            this.emitters.delete(object);
+            delete object.userData.particles;
+        }
+        if (!emitter) return;
+        
+        const capacity = Math.ceil(emitter.rate * emitter.lifetime.max) + 1;
+        const geometry = new THREE.BufferGeometry();
+        geometry.setAttribute('position', new THREE.BufferAttribute(new Float32Array(capacity * 3), 3));
+        geometry.setDrawRange(0, 0);
+        const material = new THREE.PointsMaterial({
+            size: emitter.size || 0.1,
+            color: emitter.color || 0xffffff,
+            transparent: true,
+            depthWrite: false
+        });
+        if (emitter.texture) {
+            material.map = new THREE.TextureLoader().load('/api/assets/' + emitter.texture.replace(/^sha256:/, ''));
+        }
+        
+        const points = new THREE.Points(geometry, material);
+        points.frustumCulled = false; // Particles leave the emitter's bounds
+        object.add(points);
+        object.userData.particles = {emitter, points, capacity};
+        this.emitters.add(object);
+    }
+    
+    // Particle n is born n/rate seconds after started_at. Its lifetime,
+    // velocity and spawn point are drawn, in that order, from a generator
+    // seeded with the emitter's seed and n, so every client shows the same
+    // particles at the same server time.
+    updateParticles() {
+        if (!this.emitters.size) return;
+        const now = this.simulationNow();
+        const lerp = (min, max, t) => min + (max - min) * t;
+        
+        this.emitters.forEach(object => {
+            const {emitter, points, capacity} = object.userData.particles;
+            const t = (now - emitter.started_at) / 1000;
+            const positions = points.geometry.attributes.position.array;
+            const velocity = emitter.velocity;
+            let count = 0;
+            
+            const first = Math.max(0, Math.floor((t - emitter.lifetime.max) * emitter.rate));
+            const last = Math.floor(t * emitter.rate);
+            for (let n = first; n <= last && count < capacity; n++) {
+                const age = t - n / emitter.rate;
+                const random = this.particleRandom(emitter.seed, n);
+                const lifetime = lerp(emitter.lifetime.min, emitter.lifetime.max, random());
+                if (age < 0 || age >= lifetime) continue;
+                
+                const vx = lerp(velocity.min.x, velocity.max.x, random());
+                const vy = lerp(velocity.min.y, velocity.max.y, random());
+                const vz = lerp(velocity.min.z, velocity.max.z, random());
+                const spawn = this.particleSpawn(emitter, random);
+                positions[count * 3] = spawn.x + vx * age;
+                positions[count * 3 + 1] = spawn.y + vy * age;
+                positions[count * 3 + 2] = spawn.z + vz * age;
+                count++;
+            }
+            points.geometry.setDrawRange(0, count);
+            points.geometry.attributes.position.needsUpdate = true;
+        });
+    }
+    
+    // mulberry32 seeded per particle
+    particleRandom(seed, n) {
+        let state = (seed ^ Math.imul(n + 1, 0x9e3779b1)) >>> 0;
+        return () => {
+            state = (state + 0x6d2b79f5) >>> 0;
+            let r = Math.imul(state ^ (state >>> 15), 1 | state);
+            r ^= r + Math.imul(r ^ (r >>> 7), 61 | r);
+            return ((r ^ (r >>> 14)) >>> 0) / 4294967296;
+        };
+    }
+    
+    particleSpawn(emitter, random) {
+        switch (emitter.shape) {
+            case 'sphere': {
+                const theta = 2 * Math.PI * random();
+                const phi = Math.acos(2 * random() - 1);
+                const r = emitter.radius * Math.cbrt(random());
+                return {
+                    x: r * Math.sin(phi) * Math.cos(theta),
+                    y: r * Math.cos(phi),
+                    z: r * Math.sin(phi) * Math.sin(theta)
+                };
+            }
+            case 'box':
+                return {
+                    x: (random() - 0.5) * emitter.extent.x,
+                    y: (random() - 0.5) * emitter.extent.y,
+                    z: (random() - 0.5) * emitter.extent.z
+                };
+            case 'disc': {
+                // Flat on the ground plane
+                const angle = 2 * Math.PI * random();
+                const r = emitter.radius * Math.sqrt(random());
+                return {x: r * Math.cos(angle), y: 0, z: r * Math.sin(angle)};
+            }
+            default:
+                return {x: 0, y: 0, z: 0};
+        }
+    }
+    
+    // Labels and billboards are sprites facing the viewer; panels are
+    // planes oriented with their entity. Either way the server's layout
+    // blocks are drawn onto a canvas, never interpreted as markup.
+    setPanel(object, panel) {
+        const current = object.userData.panel;
+        if (current) {
+            object.remove(current);
+            current.material.map.dispose();
+            current.material.dispose();
+            if (current.geometry) current.geometry.dispose();
+            delete object.userData.panel;
+        }
+        if (!panel) return;
+        
+        const {canvas, width, height} = this.drawPanel(panel);
+        const texture = new THREE.CanvasTexture(canvas);
+        texture.colorSpace = THREE.SRGBColorSpace;
+        
+        let view;
+        if (panel.kind === 'panel') {
+            view = new THREE.Mesh(
+                new THREE.PlaneGeometry(width, height),
+                new THREE.MeshBasicMaterial({map: texture, transparent: true, side: THREE.DoubleSide})
+            );
+        } else {
+            view = new THREE.Sprite(new THREE.SpriteMaterial({map: texture, transparent: true}));
+            view.scale.set(width, height, 1);
+        }
+        object.add(view);
+        object.userData.panel = view;
+    }
+    
+    // A screen keeps its video element while only playback changes, so
+    // play, pause and seek don't reconnect the stream
+    setMedia(object, media) {
+        const current = object.userData.media;
+        if (current && (!media || media.kind !== current.media.kind || media.source !== current.media.source ||
+                media.width !== current.media.width || media.height !== current.media.height)) {
+            object.remove(current.screen);
+            current.video.pause();
+            current.video.removeAttribute('src');
+            current.video.srcObject = null;
+            if (current.hls) current.hls.destroy();
+            if (current.peer) current.peer.close();
+            if (current.unsubscribe) current.unsubscribe();
+            current.screen.material.map.dispose();
+            current.screen.material.dispose();
+            current.screen.geometry.dispose();
+            this.screens.delete(object);
+            delete object.userData.media;
+        }
+        if (!media) return;
+        if (object.userData.media) {
+            object.userData.media.media = media;
+            object.userData.media.checkedAt = 0;
+            return;
+        }
+        
+        const video = document.createElement('video');
+        video.crossOrigin = 'anonymous';
+        video.playsInline = true;
+        const texture = new THREE.VideoTexture(video);
+        texture.colorSpace = THREE.SRGBColorSpace;
+        const screen = new THREE.Mesh(
+            new THREE.PlaneGeometry(media.width, media.height),
+            new THREE.MeshBasicMaterial({map: texture, side: THREE.DoubleSide})
+        );
+        object.add(screen);
+        
+        const state = {media, video, screen, checkedAt: 0};
+        object.userData.media = state;
+        this.screens.add(object);
+        
+        if (media.kind === 'share') {
+            // Screen shares arrive peer to peer from the sharer
+            state.unsubscribe = window.hd1ScreenShare && window.hd1ScreenShare.subscribe(media.source, (stream, local) => {
+                video.muted = local; // No echo of the sharer's own audio
+                video.srcObject = stream;
+            });
+        } else if (media.kind === 'webrtc') {
+            this.connectWHEP(state).catch(error => console.warn('[HD1-ThreeJS] Stream unavailable:', media.source, error));
+        } else if (video.canPlayType('application/vnd.apple.mpegurl')) {
+            video.src = media.source;
+        } else {
+            import('https://cdn.jsdelivr.net/npm/hls.js@1.5.7/dist/hls.mjs').then(({default: Hls}) => {
+                if (object.userData.media !== state) return;
+                state.hls = new Hls();
+                state.hls.loadSource(media.source);
+                state.hls.attachMedia(video);
+            });
+        }
+    }
+    
+    // WHEP: offer to receive, post the SDP, apply the answer
+    async connectWHEP(state) {
+        const peer = new RTCPeerConnection();
+        state.peer = peer;
+        peer.addTransceiver('video', {direction: 'recvonly'});
+        peer.addTransceiver('audio', {direction: 'recvonly'});
+        peer.ontrack = (event) => {
+            state.video.srcObject = event.streams[0];
+        };
+        await peer.setLocalDescription(await peer.createOffer());
+        const response = await fetch(state.media.source, {
+            method: 'POST',
+            headers: {'Content-Type': 'application/sdp'},
+            body: peer.localDescription.sdp
+        });
+        if (!response.ok) throw new Error('WHEP ' + response.status);
+        await peer.setRemoteDescription({type: 'answer', sdp: await response.text()});
+    }
+    
+    // Screens follow the server: play from position plus the server time
+    // since updated_at, seeking when more than half a second off
+    updateMedia(currentTime) {
+        if (!this.screens.size) return;
+        const now = window.hd1Clock ? window.hd1Clock.now() : Date.now();
+        
+        this.screens.forEach(object => {
+            const state = object.userData.media;
+            if (currentTime - state.checkedAt < 1000) return;
+            state.checkedAt = currentTime;
+            const {media, video} = state;
+            
+            video.volume = media.volume ?? 1;
+            video.loop = !!media.loop;
+            if (!media.playing) {
+                if (!video.paused) video.pause();
+            } else if (video.paused) {
+                // Autoplay policies allow muted playback; sound follows the
+                // first interaction
+                video.play().catch(() => {
+                    video.muted = true;
+                    video.play().catch(() => {});
+                    window.addEventListener('pointerdown', () => { video.muted = false; }, {once: true});
+                });
+            }
+            if (media.kind !== 'hls' || video.readyState < 1) return;
+            
+            let expected = media.position + (media.playing ? (now - media.updated_at) / 1000 : 0);
+            if (isFinite(video.duration)) {
+                expected = media.loop ? expected % video.duration : Math.min(expected, video.duration);
+            }
+            if (Math.abs(video.currentTime - expected) > 0.5) {
+                video.currentTime = expected;
+            }
+        });
+    }
+    
+    setPointCloud(object, component) {
+        const current = object.userData.pointcloud;
+        if (current && (!component || component.source !== current.component.source)) {
+            current.tiles.forEach(points => points.geometry.dispose());
+            current.material.dispose();
+            object.remove(current.group);
+            this.clouds.delete(object);
+            delete object.userData.pointcloud;
+        }
+        if (!component) return;
+        if (object.userData.pointcloud) {
+            object.userData.pointcloud.component = component;
+            object.userData.pointcloud.material.size = component.point_size;
+            return;
+        }
+        
+        const group = new THREE.Group();
+        object.add(group);
+        const state = {
+            component, group,
+            material: new THREE.PointsMaterial({size: component.point_size, vertexColors: true}),
+            nodes: null,          // name -> octree node, once tiled
+            tiles: new Map(),     // name -> THREE.Points loaded
+            loading: new Set(),
+            failed: new Set(),    // Tiles not asked for again
+            checkedAt: 0
+        };
+        object.userData.pointcloud = state;
+        this.clouds.add(object);
+        this.loadPointCloud(object, state);
+    }
+    
+    // The octree may still be tiling; pending clouds are asked again
+    async loadPointCloud(object, state) {
+        const digest = state.component.source.replace(/^sha256:/, '');
+        try {
+            const response = await window.apiClient.getAssetPointCloud(digest);
+            if (object.userData.pointcloud !== state) return;
+            const cloud = response.pointcloud;
+            if (cloud.status === 'pending') {
+                setTimeout(() => this.loadPointCloud(object, state), 5000);
+                return;
+            }
+            if (cloud.status !== 'ready') {
+                console.warn('[HD1-ThreeJS] Point cloud unavailable:', digest, cloud.error);
+                return;
+            }
+            state.nodes = new Map(cloud.nodes.map(node => [node.name, node]));
+        } catch (error) {
+            console.warn('[HD1-ThreeJS] Point cloud unavailable:', digest, error);
+        }
+    }
+    
+    // Progressive streaming: nodes whose point spacing looks coarse from the
+    // camera are refined by their children, largest on screen first, until
+    // the cloud's budget is spent; tiles out of view or over budget are hidden
+    updatePointClouds(currentTime) {
+        if (!this.clouds.size) return;
+        const frustum = new THREE.Frustum().setFromProjectionMatrix(
+            new THREE.Matrix4().multiplyMatrices(this.camera.projectionMatrix, this.camera.matrixWorldInverse));
+        
+        this.clouds.forEach(object => {
+            const state = object.userData.pointcloud;
+            if (!state.nodes || currentTime - state.checkedAt < 250) return;
+            state.checkedAt = currentTime;
+            const eye = state.group.worldToLocal(this.camera.position.clone());
+            
+            const box = new THREE.Box3();
+            const measure = node => {
+                box.min.fromArray(node.min);
+                box.max.set(node.min[0] + node.edge, node.min[1] + node.edge, node.min[2] + node.edge);
+                return Math.max(box.distanceToPoint(eye), 1e-3);
+            };
+            const inView = node => {
+                box.min.fromArray(node.min);
+                box.max.set(node.min[0] + node.edge, node.min[1] + node.edge, node.min[2] + node.edge);
+                return frustum.intersectsBox(box.applyMatrix4(state.group.matrixWorld));
+            };
+            
+            const selected = new Set();
+            let spent = 0;
+            const queue = [{node: state.nodes.get('r'), weight: Infinity}];
+            while (queue.length) {
+                queue.sort((a, b) => b.weight - a.weight);
+                const {node} = queue.shift();
+                if (selected.size && spent + node.points > state.component.budget) continue;
+                selected.add(node.name);
+                spent += node.points;
+                if (node.spacing / measure(node) < 0.0015) continue;
+                for (let octant = 0; octant < 8; octant++) {
+                    const child = state.nodes.get(node.name + octant);
+                    if (child && inView(child)) {
+                        queue.push({node: child, weight: child.edge / measure(child)});
+                    }
+                }
+            }
+            
+            state.tiles.forEach((points, name) => { points.visible = selected.has(name); });
+            selected.forEach(name => {
+                if (!state.tiles.has(name) && !state.loading.has(name) && !state.failed.has(name) && state.loading.size < 4) {
+                    this.loadPointTile(object, state, state.nodes.get(name));
+                }
+            });
+            
+            // Keep hidden tiles for revisits while within twice the budget
+            let loaded = 0;
+            state.tiles.forEach(points => { loaded += points.userData.count; });
+            state.tiles.forEach((points, name) => {
+                if (loaded > 2 * state.component.budget && !points.visible) {
+                    loaded -= points.userData.count;
+                    points.geometry.dispose();
+                    state.group.remove(points);
+                    state.tiles.delete(name);
+                }
+            });
+        });
+    }
+    
+    // Tiles: "HD1P", version, count, flags, then float32 positions and
+    // rgb bytes (see GET /api/assets/{digest}/pointcloud)
+    async loadPointTile(object, state, node) {
+        state.loading.add(node.name);
+        try {
+            const response = await fetch('/api/assets/' + node.digest);
+            if (!response.ok) throw new Error('tile ' + response.status);
+            const buffer = await response.arrayBuffer();
+            if (object.userData.pointcloud !== state) return;
+            const view = new DataView(buffer);
+            const count = view.getUint32(8, true);
+            const geometry = new THREE.BufferGeometry();
+            geometry.setAttribute('position', new THREE.BufferAttribute(new Float32Array(buffer, 16, count * 3), 3));
+            geometry.setAttribute('color', new THREE.BufferAttribute(new Uint8Array(buffer, 16 + count * 12, count * 3), 3, true));
+            const points = new THREE.Points(geometry, state.material);
+            points.userData.count = count;
+            points.visible = false; // Shown by the next update that selects it
+            state.group.add(points);
+            state.tiles.set(node.name, points);
+            state.checkedAt = 0;
+        } catch (error) {
+            state.failed.add(node.name);
+            console.warn('[HD1-ThreeJS] Point cloud tile unavailable:', node.name, error);
+        } finally {
+            state.loading.delete(node.name);
+        }
+    }
+    
+    // Ground tiles: a plane laid flat, north at -z, draped with the map
+    // image and raised by the elevation image's heights above sea level
+    setTerrain(object, component) {
+        const current = object.userData.terrain;
+        if (current) {
+            current.geometry.dispose();
+            if (current.material.map) current.material.map.dispose();
+            current.material.dispose();
+            object.remove(current);
+            delete object.userData.terrain;
+        }
+        if (!component) return;
+        
+        const geometry = new THREE.PlaneGeometry(component.width, component.depth, component.segments, component.segments);
+        geometry.rotateX(-Math.PI / 2);
+        const material = new THREE.MeshLambertMaterial({color: component.imagery ? 0xffffff : 0x8a9a7b});
+        if (component.imagery) {
+            material.map = new THREE.TextureLoader().load('/api/assets/' + component.imagery.replace(/^sha256:/, ''));
+            material.map.colorSpace = THREE.SRGBColorSpace;
+        }
+        const ground = new THREE.Mesh(geometry, material);
+        ground.receiveShadow = true;
+        object.add(ground);
+        object.userData.terrain = ground;
+        if (component.elevation) {
+            this.loadElevation(object, ground, component);
+        }
+    }
+    
+    async loadElevation(object, ground, component) {
+        const digest = component.elevation.replace(/^sha256:/, '');
+        try {
+            const response = await fetch('/api/assets/' + digest);
+            if (!response.ok) throw new Error('elevation ' + response.status);
+            const bitmap = await createImageBitmap(await response.blob());
+            if (object.userData.terrain !== ground) return;
+            const canvas = document.createElement('canvas');
+            canvas.width = bitmap.width;
+            canvas.height = bitmap.height;
+            const context = canvas.getContext('2d', {willReadFrequently: true});
+            context.drawImage(bitmap, 0, 0);
+            const pixels = context.getImageData(0, 0, bitmap.width, bitmap.height).data;
+            
+            // Vertices run west to east, then north to south
+            const position = ground.geometry.attributes.position;
+            const columns = component.segments + 1;
+            for (let i = 0; i < position.count; i++) {
+                const px = Math.min(bitmap.width - 1, Math.round((i % columns) / component.segments * (bitmap.width - 1)));
+                const py = Math.min(bitmap.height - 1, Math.round(Math.floor(i / columns) / component.segments * (bitmap.height - 1)));
+                const at = (py * bitmap.width + px) * 4;
+                const [r, g, b] = [pixels[at], pixels[at + 1], pixels[at + 2]];
+                position.setY(i, component.encoding === 'mapbox'
+                    ? (r * 65536 + g * 256 + b) / 10 - 10000
+                    : r * 256 + g + b / 256 - 32768);
+            }
+            position.needsUpdate = true;
+            ground.geometry.computeVertexNormals();
+            ground.geometry.computeBoundingSphere();
+        } catch (error) {
+            console.warn('[HD1-ThreeJS] Terrain elevation unavailable:', digest, error);
+        }
+    }
+    
+    drawPanel(panel) {
+        const canvas = document.createElement('canvas');
+        const context = canvas.getContext('2d');
+        const family = 'system-ui, sans-serif';
+        
+        if (panel.kind === 'label') {
+            const text = panel.blocks.length ? panel.blocks[0].text : '';
+            context.font = 'bold 64px ' + family;
+            canvas.width = Math.min(2048, Math.ceil(context.measureText(text).width) + 32);
+            canvas.height = 96;
+            if (panel.background) {
+                context.fillStyle = panel.background;
+                context.fillRect(0, 0, canvas.width, canvas.height);
+            }
+            context.font = 'bold 64px ' + family;
+            context.fillStyle = panel.color;
+            context.textBaseline = 'middle';
+            context.fillText(text, 16, canvas.height / 2);
+            return {canvas, width: panel.height * canvas.width / canvas.height, height: panel.height};
+        }
+        
+        // Sizes in metres, drawn at up to 256 pixels per metre
+        const scale = Math.min(256, 2048 / Math.max(panel.width, panel.height));
+        canvas.width = Math.round(panel.width * scale);
+        canvas.height = Math.round(panel.height * scale);
+        if (panel.background) {
+            context.fillStyle = panel.background;
+            context.fillRect(0, 0, canvas.width, canvas.height);
+        }
+        
+        const styles = {
+            h1: {size: 0.16, font: 'bold '}, h2: {size: 0.13, font: 'bold '}, h3: {size: 0.11, font: 'bold '},
+            p: {size: 0.08, font: ''}, li: {size: 0.08, font: ''}, code: {size: 0.07, font: '', mono: true}
+        };
+        const padding = 0.08 * scale;
+        const maxWidth = canvas.width - 2 * padding;
+        let y = padding;
+        context.fillStyle = panel.color;
+        context.strokeStyle = panel.color;
+        context.textBaseline = 'top';
+        
+        for (const block of panel.blocks) {
+            if (y >= canvas.height - padding) break;
+            if (block.style === 'hr') {
+                context.fillRect(padding, y + 0.02 * scale, maxWidth, Math.max(1, 0.005 * scale));
+                y += 0.06 * scale;
+                continue;
+            }
+            const style = styles[block.style] || styles.p;
+            const size = style.size * scale;
+            context.font = style.font + size + 'px ' + (style.mono ? 'monospace' : family);
+            
+            // Code keeps its lines; everything else wraps at word boundaries
+            const lines = [];
+            for (const source of style.mono ? block.text.split('\n') : [block.text]) {
+                let line = '';
+                for (const word of style.mono ? [source] : source.split(' ')) {
+                    const candidate = line ? line + ' ' + word : word;
+                    if (line && context.measureText(candidate).width > maxWidth) {
+                        lines.push(line);
+                        line = word;
+                    } else {
+                        line = candidate;
+                    }
+                }
+                lines.push(line);
+            }
+            for (const line of lines) {
+                if (y + size > canvas.height - padding) break;
+                context.fillText(line, padding, y);
+                y += size * 1.25;
+            }
+            y += size * 0.4;
+        }
+        return {canvas, width: panel.width, height: panel.height};
+    }
+    
+    // Boards keep the merged stroke state so whiteboard_delta operations
+    // merge the same way the server does, then redraw the canvas
+    setWhiteboard(object, board) {
+        const current = object.userData.whiteboard;
+        if (current) {
+            object.remove(current.view);
+            current.view.material.map.dispose();
+            current.view.material.dispose();
+            current.view.geometry.dispose();
+            delete object.userData.whiteboard;
+        }
+        if (!board) return;
+        
+        const width = board.width || 2;
+        const height = board.height || 1.2;
+        const scale = Math.min(512, 2048 / Math.max(width, height));
+        const canvas = document.createElement('canvas');
+        canvas.width = Math.ceil(width * scale);
+        canvas.height = Math.ceil(height * scale);
+        const texture = new THREE.CanvasTexture(canvas);
+        texture.colorSpace = THREE.SRGBColorSpace;
+        const view = new THREE.Mesh(
+            new THREE.PlaneGeometry(width, height),
+            new THREE.MeshBasicMaterial({map: texture, side: THREE.DoubleSide})
+        );
+        object.add(view);
+        object.userData.whiteboard = {
+            view, canvas, texture,
+            board: {
+                background: board.background || '#ffffff',
+                strokes: (board.strokes || []).slice(),
+                removed: (board.removed || []).slice(),
+                cleared: board.cleared || 0
+            }
+        };
+        this.drawWhiteboard(object.userData.whiteboard);
+    }
+    
+    // Mirrors whiteboard.Board.Merge: clear, then removals, then additions
+    handleWhiteboardDelta(data, clock) {
+        const mesh = this.objects.get(data.id);
+        const state = mesh && mesh.userData.whiteboard;
+        if (!state) return;
+        const board = state.board;
+        
+        if (data.clear && clock > board.cleared) {
+            board.cleared = clock;
+            board.strokes = board.strokes.filter(stroke => stroke.clock > clock);
+            board.removed = [];
+        }
+        for (const id of data.remove || []) {
+            if (board.removed.includes(id)) continue;
+            board.removed.push(id);
+            board.strokes = board.strokes.filter(stroke => stroke.id !== id);
+        }
+        for (const stroke of data.add || []) {
+            if (board.strokes.length >= 2000 || board.removed.includes(stroke.id) ||
+                    board.strokes.some(existing => existing.id === stroke.id)) continue;
+            board.strokes.push({...stroke, clock});
+        }
+        this.drawWhiteboard(state);
+    }
+    
+    drawWhiteboard(state) {
+        const {canvas, board} = state;
+        const context = canvas.getContext('2d');
+        context.fillStyle = board.background;
+        context.fillRect(0, 0, canvas.width, canvas.height);
+        context.lineCap = 'round';
+        context.lineJoin = 'round';
+        for (const stroke of board.strokes) {
+            const points = stroke.points;
+            context.strokeStyle = stroke.color;
+            context.fillStyle = stroke.color;
+            context.lineWidth = stroke.size * canvas.width;
+            if (points.length === 2) {
+                context.beginPath();
+                context.arc(points[0] * canvas.width, points[1] * canvas.height, context.lineWidth / 2, 0, Math.PI * 2);
+                context.fill();
+                continue;
+            }
+            context.beginPath();
+            context.moveTo(points[0] * canvas.width, points[1] * canvas.height);
+            for (let i = 2; i < points.length; i += 2) {
+                context.lineTo(points[i] * canvas.width, points[i + 1] * canvas.height);
+            }
+            context.stroke();
+        }
+        state.texture.needsUpdate = true;
+    }
+    
+    // A form card shows its fields with the answers typed so far; answers
+    // are kept per card and survive updates that keep the field
+    setForm(object, form) {
+        const current = object.userData.form;
+        if (current) {
+            object.remove(current.view);
+            current.view.material.map.dispose();
+            current.view.material.dispose();
+            current.view.geometry.dispose();
+            delete object.userData.form;
+        }
+        if (!form) return;
+        
+        const scale = Math.min(256, 2048 / Math.max(form.width, form.height));
+        const canvas = document.createElement('canvas');
+        canvas.width = Math.round(form.width * scale);
+        canvas.height = Math.round(form.height * scale);
+        const texture = new THREE.CanvasTexture(canvas);
+        texture.colorSpace = THREE.SRGBColorSpace;
+        const view = new THREE.Mesh(
+            new THREE.PlaneGeometry(form.width, form.height),
+            new THREE.MeshBasicMaterial({map: texture, side: THREE.DoubleSide})
+        );
+        object.add(view);
+        const values = {};
+        for (const field of form.fields) {
+            if (current && current.values[field.name] !== undefined) {
+                values[field.name] = current.values[field.name];
+            }
+        }
+        object.userData.form = {view, canvas, texture, form, values};
+        this.drawForm(object.userData.form);
+    }
+    
+    // Shows answers on a form card; undefined clears a field
+    setFormValues(id, values) {
+        const object = this.objects.get(id);
+        const state = object && object.userData.form;
+        if (!state) return;
+        for (const [name, value] of Object.entries(values)) {
+            if (value === undefined || value === null || value === '') {
+                delete state.values[name];
+            } else {
+                state.values[name] = value;
+            }
+        }
+        this.drawForm(state);
+    }
+    
+    drawForm(state) {
+        const {canvas, form, values} = state;
+        const context = canvas.getContext('2d');
+        const family = 'system-ui, sans-serif';
+        const unit = canvas.width / form.width; // Pixels per metre
+        const padding = 0.08 * unit;
+        const maxWidth = canvas.width - 2 * padding;
+        context.fillStyle = form.background;
+        context.fillRect(0, 0, canvas.width, canvas.height);
+        context.fillStyle = form.color;
+        context.strokeStyle = form.color;
+        context.textBaseline = 'top';
+        
+        let y = padding;
+        context.font = 'bold ' + Math.round(0.12 * unit) + 'px ' + family;
+        context.fillText(form.title, padding, y, maxWidth);
+        y += 0.18 * unit;
+        if (form.description) {
+            context.font = Math.round(0.065 * unit) + 'px ' + family;
+            context.fillText(form.description, padding, y, maxWidth);
+            y += 0.11 * unit;
+        }
+        
+        // Each field is a label over a box, a checkbox beside its label
+        const size = Math.round(0.065 * unit);
+        const boxHeight = 0.11 * unit;
+        for (const field of form.fields) {
+            if (y + boxHeight > canvas.height - 0.2 * unit) break;
+            const value = values[field.name];
+            const label = field.label + (field.required ? ' *' : '');
+            context.font = size + 'px ' + family;
+            context.lineWidth = Math.max(1, 0.006 * unit);
+            if (field.type === 'checkbox') {
+                context.strokeRect(padding, y, size, size);
+                if (value === true) {
+                    context.fillRect(padding + size * 0.2, y + size * 0.2, size * 0.6, size * 0.6);
+                }
+                context.fillText(label, padding + size * 1.5, y, maxWidth - size * 1.5);
+                y += size * 1.8;
+                continue;
+            }
+            context.fillText(label, padding, y, maxWidth);
+            y += size * 1.3;
+            context.strokeRect(padding, y, maxWidth, boxHeight);
+            let text = value === undefined ? '' : String(value);
+            if (!text && field.type === 'choice') {
+                text = field.options.join(' / ');
+                context.globalAlpha = 0.5;
+            }
+            context.fillText(text, padding + size * 0.4, y + (boxHeight - size) / 2, maxWidth - size * 0.8);
+            context.globalAlpha = 1;
+            y += boxHeight + size * 0.6;
+        }
+        
+        // The submit button sits at the bottom right
+        context.font = 'bold ' + size + 'px ' + family;
+        const buttonWidth = context.measureText(form.submit).width + size * 2;
+        const buttonHeight = size * 2;
+        const buttonX = canvas.width - padding - buttonWidth;
+        const buttonY = canvas.height - padding - buttonHeight;
+        context.fillRect(buttonX, buttonY, buttonWidth, buttonHeight);
+        context.fillStyle = form.background;
+        context.fillText(form.submit, buttonX + size, buttonY + size / 2);
+        state.texture.needsUpdate = true;
+    }
+    
+    applyEnvironment(environment) {
+        this.environment = environment;
+        
+        // Place the sun: azimuth clockwise from north (-z), elevation above
+        // the horizon
+        const elevation = THREE.MathUtils.degToRad(environment.sun_elevation);
+        const azimuth = THREE.MathUtils.degToRad(environment.sun_azimuth);
+        this.sunLight.position.set(
+            Math.sin(azimuth) * Math.cos(elevation) * 20,
+            Math.sin(elevation) * 20,
+            -Math.cos(azimuth) * Math.cos(elevation) * 20
+        );
+        
+        // Daylight fades out as the sun sets and under heavy weather
+        const daylight = Math.max(0, Math.sin(elevation));
+        const overcast = 1 - 0.6 * Math.max(environment.fog_density, environment.precipitation * 0.5);
+        this.sunLight.intensity = 0.8 * daylight * overcast;
+        this.ambientLight.intensity = 0.15 + 0.35 * daylight * overcast;
+        
+        const sky = new THREE.Color(0x0b1026).lerp(new THREE.Color(0x87ceeb), Math.min(1, daylight * 2));
+        sky.lerp(new THREE.Color(0x8a8f96), environment.fog_density);
+        if (!this.backgroundSet) {
+            this.scene.background = sky;
+        }
+        
+        // Weather fog takes over while it lasts and clears only its own
+        if (environment.fog_density > 0) {
+            this.scene.fog = new THREE.FogExp2(sky, environment.fog_density * 0.08);
+        } else if (this.scene.fog && this.scene.fog.isFogExp2) {
+            this.scene.fog = null;
+        }
+    }
+    
+    handleAnchorCreate(data) {
+        // Anchors are not rendered; AR sessions resolve them via /anchors/{id}/resolve
+        if (data.anchor && data.anchor.id) {
+            this.anchors.set(data.anchor.id, data.anchor);
+        }
+    }
+    
+    handleAnchorDelete(data) {
+        this.anchors.delete(data.id);
+    }
 }
 
 // Initialize HD1ThreeJS when DOM is ready
@@ -25,6 +25,10 @@ class HD1ThreeJSAPIClient {
     constructor(baseURL = '/api', hd1Id = null) {
         this.baseURL = baseURL;
         this.hd1Id = hd1Id; // Server-provided hd1_id only
+        this.org = null;
+        this.sessionToken = null;
+        this.signingKey = null;
+        this.nonce = 0;
     }
 
     // Set hd1_id from server (called when WebSocket receives client_init)
@@ -32,12 +36,55 @@ class HD1ThreeJSAPIClient {
         this.hd1Id = hd1Id;
     }
 
+    // Organization sent as X-HD1-Org, for per-organization settings and flags
+    setOrg(org) {
+        this.org = org;
+    }
+
+    // Session token from client_init and its rotations, sent as bearer
+    // token: it binds calls to the session and the organization it joined
+    setSessionToken(token) {
+        this.sessionToken = token || null;
+    }
+
+    // Key from client_init when the server requires signed deltas: every
+    // call that changes something is then signed with it and numbered
+    // from 1
+    setSigningKey(key) {
+        this.signingKey = key || null;
+        this.nonce = 0;
+    }
+
+    // Whether calls are signed; WebCrypto, and so signing, is only
+    // available in secure contexts
+    canSign() {
+        return Boolean(this.signingKey) && typeof crypto !== 'undefined' && Boolean(crypto.subtle);
+    }
+
+    // Hex HMAC-SHA256 under the signing key of what the server checks of a
+    // call: its method and target, the path and query, on the first line,
+    // its nonce on the second, then its body. WebSocket deltas are signed
+    // as method WS, target /ws.
+    async sign(method, target, nonce, body) {
+        const bytes = new Uint8Array(this.signingKey.match(/../g).map(pair => parseInt(pair, 16)));
+        const key = await crypto.subtle.importKey('raw', bytes, { name: 'HMAC', hash: 'SHA-256' }, false, ['sign']);
+        const signature = await crypto.subtle.sign('HMAC', key, new TextEncoder().encode(`${method} ${target}\n${nonce}\n${body}`));
+        return Array.from(new Uint8Array(signature), b => b.toString(16).padStart(2, '0')).join('');
+    }
+
     async request(method, path, data = null) {
         const url = this.baseURL + path;
         const headers = {
             'Content-Type': 'application/json',
             'X-Client-ID': this.hd1Id
         };
+        if (this.org) {
+            headers['X-HD1-Org'] = this.org;
+        }
+        if (this.sessionToken) {
+            headers['Authorization'] = 'Bearer ' + this.sessionToken;
+            headers['X-HD1-ID'] = this.hd1Id;
+        }
 
         const options = {
             method: method,
@@ -47,6 +94,13 @@ class HD1ThreeJSAPIClient {
         if (data && (method === 'POST' || method === 'PUT')) {
             options.body = JSON.stringify(data);
         }
+        if (this.canSign() && method !== 'GET' && method !== 'HEAD') {
+            const target = new URL(url, window.location.href);
+            const nonce = ++this.nonce;
+            headers['X-HD1-ID'] = this.hd1Id;
+            headers['X-HD1-Nonce'] = String(nonce);
+            headers['X-HD1-Signature'] = await this.sign(method, target.pathname + target.search, nonce, options.body || '');
+        }
 
         const response = await fetch(url, options);
 
@@ -72,11 +126,82 @@ class HD1ThreeJSAPIClient {
         return path;
     }
 
+    /**
+     * Whether the server still serves this client: it must serve the
+     * client's API version and accept the client's version. Resolves to
+     * {compatible, reason, server}; refuse to go on when compatible is false.
+     */
+    async checkCompatibility() {
+        const server = await this.request('GET', '/system/version');
+        const compatibility = server.compatibility || {};
+        if (!(compatibility.api_versions || []).includes(HD1ThreeJSAPIClient.API_VERSION)) {
+            return { compatible: false, reason: `server does not serve API ${HD1ThreeJSAPIClient.API_VERSION}`, server: server };
+        }
+        const minimum = (compatibility.min_client_versions || {}).hd1lib;
+        if (minimum && hd1CompareVersions(HD1ThreeJSAPIClient.VERSION, minimum) < 0) {
+            return { compatible: false, reason: `server requires hd1lib ${minimum} or later`, server: server };
+        }
+        return { compatible: true, reason: '', server: server };
+    }
+
     // ========================================
     // SYNC OPERATIONS (Generated from spec)
     // ========================================
 
 
+    /**
+     * GET /admin/sync/deltas - listDeltas
+     */
+    async listDeltas() {
+        return this.request('GET', '/admin/sync/deltas');
+    }
+
+    /**
+     * GET /admin/sync/deltas/{seqNum} - getDelta
+     */
+    async getDelta(param1) {
+        const path = this.extractPathParams('/admin/sync/deltas/{seqNum}', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * POST /admin/sync/deltas/{seqNum}/rebroadcast - rebroadcastDelta
+     */
+    async rebroadcastDelta(param1, data = null) {
+        const path = this.extractPathParams('/admin/sync/deltas/{seqNum}/rebroadcast', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * POST /admin/sync/deltas/{seqNum}/revert - revertDelta
+     */
+    async revertDelta(param1, data = null) {
+        const path = this.extractPathParams('/admin/sync/deltas/{seqNum}/revert', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * GET /sync/chunks/{chunk} - getSyncChunk
+     */
+    async getSyncChunk(param1) {
+        const path = this.extractPathParams('/sync/chunks/{chunk}', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * GET /sync/entities - getSyncEntities
+     */
+    async getSyncEntities() {
+        return this.request('GET', '/sync/entities');
+    }
+
+    /**
+     * GET /sync/full - getFullSync
+     */
+    async getFullSync() {
+        return this.request('GET', '/sync/full');
+    }
+
     /**
      * GET /sync/missing/{from}/{to} - getMissingOperations
      */
@@ -85,6 +210,13 @@ class HD1ThreeJSAPIClient {
         return this.request('GET', path);
     }
 
+    /**
+     * POST /sync/operations - submitOperation
+     */
+    async submitOperation(data = null) {
+        return this.request('POST', '/sync/operations', data);
+    }
+
     /**
      * GET /sync/stats - getSyncStats
      */
@@ -93,17 +225,49 @@ class HD1ThreeJSAPIClient {
     }
 
     /**
-     * POST /sync/operations - submitOperation
+     * GET /sync/stream - getSyncStream
      */
-    async submitOperation(data = null) {
-        return this.request('POST', '/sync/operations', data);
+    async getSyncStream() {
+        return this.request('GET', '/sync/stream');
     }
 
     /**
-     * GET /sync/full - getFullSync
+     * POST /sync/transactions - beginTransaction
      */
-    async getFullSync() {
-        return this.request('GET', '/sync/full');
+    async beginTransaction(data = null) {
+        return this.request('POST', '/sync/transactions', data);
+    }
+
+    /**
+     * DELETE /sync/transactions/{transactionId} - rollbackTransaction
+     */
+    async rollbackTransaction(param1) {
+        const path = this.extractPathParams('/sync/transactions/{transactionId}', [param1]);
+        return this.request('DELETE', path);
+    }
+
+    /**
+     * GET /sync/transactions/{transactionId} - getTransaction
+     */
+    async getTransaction(param1) {
+        const path = this.extractPathParams('/sync/transactions/{transactionId}', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * POST /sync/transactions/{transactionId}/commit - commitTransaction
+     */
+    async commitTransaction(param1, data = null) {
+        const path = this.extractPathParams('/sync/transactions/{transactionId}/commit', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * POST /sync/transactions/{transactionId}/operations - queueTransactionOperation
+     */
+    async queueTransactionOperation(param1, data = null) {
+        const path = this.extractPathParams('/sync/transactions/{transactionId}/operations', [param1]);
+        return this.request('POST', path, data);
     }
 
 
@@ -119,6 +283,14 @@ class HD1ThreeJSAPIClient {
         return this.request('GET', '/entities');
     }
 
+    /**
+     * DELETE /entities/{entityId} - deleteEntity
+     */
+    async deleteEntity(param1) {
+        const path = this.extractPathParams('/entities/{entityId}', [param1]);
+        return this.request('DELETE', path);
+    }
+
     /**
      * PUT /entities/{entityId} - updateEntity
      */
@@ -128,13 +300,53 @@ class HD1ThreeJSAPIClient {
     }
 
     /**
-     * DELETE /entities/{entityId} - deleteEntity
+     * POST /entities/{entityId}/form - submitForm
      */
-    async deleteEntity(param1) {
-        const path = this.extractPathParams('/entities/{entityId}', [param1]);
+    async submitForm(param1, data = null) {
+        const path = this.extractPathParams('/entities/{entityId}/form', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * DELETE /entities/{entityId}/form/submissions - clearFormSubmissions
+     */
+    async clearFormSubmissions(param1) {
+        const path = this.extractPathParams('/entities/{entityId}/form/submissions', [param1]);
         return this.request('DELETE', path);
     }
 
+    /**
+     * GET /entities/{entityId}/form/submissions - listFormSubmissions
+     */
+    async listFormSubmissions(param1) {
+        const path = this.extractPathParams('/entities/{entityId}/form/submissions', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * POST /entities/{entityId}/media - controlEntityMedia
+     */
+    async controlEntityMedia(param1, data = null) {
+        const path = this.extractPathParams('/entities/{entityId}/media', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * PUT /entities/{entityId}/panel - updateEntityPanel
+     */
+    async updateEntityPanel(param1, data = null) {
+        const path = this.extractPathParams('/entities/{entityId}/panel', [param1]);
+        return this.request('PUT', path, data);
+    }
+
+    /**
+     * POST /entities/{entityId}/whiteboard - drawWhiteboard
+     */
+    async drawWhiteboard(param1, data = null) {
+        const path = this.extractPathParams('/entities/{entityId}/whiteboard', [param1]);
+        return this.request('POST', path, data);
+    }
+
 
     // ========================================
     // AVATARS (Generated from spec)
@@ -142,19 +354,17 @@ class HD1ThreeJSAPIClient {
 
 
     /**
-     * POST /avatars/{sessionId}/move - moveAvatar
+     * GET /avatars - getAvatars
      */
-    async moveAvatar(param1, data = null) {
-        const path = this.extractPathParams('/avatars/{sessionId}/move', [param1]);
-        return this.request('POST', path, data);
+    async getAvatars() {
+        return this.request('GET', '/avatars');
     }
 
     /**
-     * PUT /avatars/{avatarId} - updateAvatar
+     * POST /avatars - createAvatar
      */
-    async updateAvatar(param1, data = null) {
-        const path = this.extractPathParams('/avatars/{avatarId}', [param1]);
-        return this.request('PUT', path, data);
+    async createAvatar(data = null) {
+        return this.request('POST', '/avatars', data);
     }
 
     /**
@@ -166,17 +376,19 @@ class HD1ThreeJSAPIClient {
     }
 
     /**
-     * GET /avatars - getAvatars
+     * PUT /avatars/{avatarId} - updateAvatar
      */
-    async getAvatars() {
-        return this.request('GET', '/avatars');
+    async updateAvatar(param1, data = null) {
+        const path = this.extractPathParams('/avatars/{avatarId}', [param1]);
+        return this.request('PUT', path, data);
     }
 
     /**
-     * POST /avatars - createAvatar
+     * POST /avatars/{sessionId}/move - moveAvatar
      */
-    async createAvatar(data = null) {
-        return this.request('POST', '/avatars', data);
+    async moveAvatar(param1, data = null) {
+        const path = this.extractPathParams('/avatars/{sessionId}/move', [param1]);
+        return this.request('POST', path, data);
     }
 
 
@@ -220,17 +432,17 @@ class HD1ThreeJSAPIClient {
     }
 
     /**
-     * POST /materials/standard - createStandardMaterial
+     * POST /materials/physical - createPhysicalMaterial
      */
-    async createStandardMaterial(data = null) {
-        return this.request('POST', '/materials/standard', data);
+    async createPhysicalMaterial(data = null) {
+        return this.request('POST', '/materials/physical', data);
     }
 
     /**
-     * POST /materials/physical - createPhysicalMaterial
+     * POST /materials/standard - createStandardMaterial
      */
-    async createPhysicalMaterial(data = null) {
-        return this.request('POST', '/materials/physical', data);
+    async createStandardMaterial(data = null) {
+        return this.request('POST', '/materials/standard', data);
     }
 
 
@@ -239,6 +451,84 @@ class HD1ThreeJSAPIClient {
     // ========================================
 
 
+    /**
+     * GET /system/backup - createBackup
+     */
+    async createBackup() {
+        return this.request('GET', '/system/backup');
+    }
+
+    /**
+     * GET /system/capabilities - getCapabilities
+     */
+    async getCapabilities() {
+        return this.request('GET', '/system/capabilities');
+    }
+
+    /**
+     * GET /system/features - getFeatures
+     */
+    async getFeatures() {
+        return this.request('GET', '/system/features');
+    }
+
+    /**
+     * GET /system/integrity - getIntegrity
+     */
+    async getIntegrity() {
+        return this.request('GET', '/system/integrity');
+    }
+
+    /**
+     * GET /system/locales - getLocales
+     */
+    async getLocales() {
+        return this.request('GET', '/system/locales');
+    }
+
+    /**
+     * GET /system/locales/{lang} - getLocale
+     */
+    async getLocale(param1) {
+        const path = this.extractPathParams('/system/locales/{lang}', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * GET /system/maintenance - getMaintenance
+     */
+    async getMaintenance() {
+        return this.request('GET', '/system/maintenance');
+    }
+
+    /**
+     * PUT /system/maintenance - setMaintenance
+     */
+    async setMaintenance(data = null) {
+        return this.request('PUT', '/system/maintenance', data);
+    }
+
+    /**
+     * POST /system/restore - restoreBackup
+     */
+    async restoreBackup(data = null) {
+        return this.request('POST', '/system/restore', data);
+    }
+
+    /**
+     * GET /system/simulation - getSimulation
+     */
+    async getSimulation() {
+        return this.request('GET', '/system/simulation');
+    }
+
+    /**
+     * GET /system/time - getServerTime
+     */
+    async getServerTime() {
+        return this.request('GET', '/system/time');
+    }
+
     /**
      * GET /system/version - getVersion
      */
@@ -248,76 +538,1082 @@ class HD1ThreeJSAPIClient {
 
 
     // ========================================
-    // CONVENIENCE METHODS
+    // EXTENDED OPERATIONS (Generated from spec)
     // ========================================
 
+
     /**
-     * Create a box entity with default material
+     * GET /accessibility/descriptions - getSceneDescriptions
      */
-    async createBox(width = 1, height = 1, depth = 1, color = '#777777', position = {x: 0, y: 0, z: 0}) {
-        return this.createEntityWithGeometry({
-            geometry: {
-                type: 'box',
-                width: width,
-                height: height,
-                depth: depth
-            },
-            material: {
-                type: 'phong',
-                color: color
-            },
-            position: position
-        });
+    async getSceneDescriptions() {
+        return this.request('GET', '/accessibility/descriptions');
     }
 
     /**
-     * Create a sphere entity with default material
+     * GET /accessibility/world - getAccessibleWorldView
      */
-    async createSphere(radius = 0.5, color = '#777777', position = {x: 0, y: 0, z: 0}) {
-        return this.createEntityWithGeometry({
-            geometry: {
-                type: 'sphere',
-                radius: radius
-            },
-            material: {
-                type: 'phong',
-                color: color
-            },
-            position: position
-        });
+    async getAccessibleWorldView() {
+        return this.request('GET', '/accessibility/world');
     }
 
     /**
-     * Move entity to new position
+     * GET /anchors - listAnchors
      */
-    async moveEntity(entityId, position) {
-        return this.updateEntity(entityId, { position: position });
+    async listAnchors() {
+        return this.request('GET', '/anchors');
     }
 
     /**
-     * Change entity color
+     * POST /anchors - createAnchor
      */
-    async changeEntityColor(entityId, color) {
-        return this.updateEntity(entityId, {
-            material: {
-                type: 'phong',
-                color: color
-            }
-        });
+    async createAnchor(data = null) {
+        return this.request('POST', '/anchors', data);
     }
 
     /**
-     * Set scene background color
+     * DELETE /anchors/{anchorId} - deleteAnchor
      */
-    async setBackground(color) {
-        return this.updateScene({ background: color });
+    async deleteAnchor(param1) {
+        const path = this.extractPathParams('/anchors/{anchorId}', [param1]);
+        return this.request('DELETE', path);
     }
 
     /**
-     * Add fog to scene
+     * GET /anchors/{anchorId} - getAnchor
      */
-    async addFog(color = '#ffffff', near = 1, far = 100) {
-        return this.updateScene({
+    async getAnchor(param1) {
+        const path = this.extractPathParams('/anchors/{anchorId}', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * POST /anchors/{anchorId}/resolve - resolveAnchor
+     */
+    async resolveAnchor(param1, data = null) {
+        const path = this.extractPathParams('/anchors/{anchorId}/resolve', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * POST /assets - uploadAsset
+     */
+    async uploadAsset(data = null) {
+        return this.request('POST', '/assets', data);
+    }
+
+    /**
+     * POST /assets/gc - collectAssetGarbage
+     */
+    async collectAssetGarbage(data = null) {
+        return this.request('POST', '/assets/gc', data);
+    }
+
+    /**
+     * GET /assets/orphans - getOrphanAssets
+     */
+    async getOrphanAssets() {
+        return this.request('GET', '/assets/orphans');
+    }
+
+    /**
+     * GET /assets/quarantine - listQuarantinedAssets
+     */
+    async listQuarantinedAssets() {
+        return this.request('GET', '/assets/quarantine');
+    }
+
+    /**
+     * DELETE /assets/quarantine/{digest} - discardQuarantinedAsset
+     */
+    async discardQuarantinedAsset(param1) {
+        const path = this.extractPathParams('/assets/quarantine/{digest}', [param1]);
+        return this.request('DELETE', path);
+    }
+
+    /**
+     * POST /assets/quarantine/{digest}/release - releaseQuarantinedAsset
+     */
+    async releaseQuarantinedAsset(param1, data = null) {
+        const path = this.extractPathParams('/assets/quarantine/{digest}/release', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * GET /assets/settings - getAssetSettings
+     */
+    async getAssetSettings() {
+        return this.request('GET', '/assets/settings');
+    }
+
+    /**
+     * PUT /assets/settings - updateAssetSettings
+     */
+    async updateAssetSettings(data = null) {
+        return this.request('PUT', '/assets/settings', data);
+    }
+
+    /**
+     * GET /assets/{digest} - getAsset
+     */
+    async getAsset(param1) {
+        const path = this.extractPathParams('/assets/{digest}', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * GET /assets/{digest}/pointcloud - getAssetPointCloud
+     */
+    async getAssetPointCloud(param1) {
+        const path = this.extractPathParams('/assets/{digest}/pointcloud', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * GET /assets/{digest}/variants - getAssetVariants
+     */
+    async getAssetVariants(param1) {
+        const path = this.extractPathParams('/assets/{digest}/variants', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * GET /compliance/holds - listLegalHolds
+     */
+    async listLegalHolds() {
+        return this.request('GET', '/compliance/holds');
+    }
+
+    /**
+     * POST /compliance/holds - placeLegalHold
+     */
+    async placeLegalHold(data = null) {
+        return this.request('POST', '/compliance/holds', data);
+    }
+
+    /**
+     * DELETE /compliance/holds/{holdId} - releaseLegalHold
+     */
+    async releaseLegalHold(param1) {
+        const path = this.extractPathParams('/compliance/holds/{holdId}', [param1]);
+        return this.request('DELETE', path);
+    }
+
+    /**
+     * GET /compliance/report - getComplianceReport
+     */
+    async getComplianceReport() {
+        return this.request('GET', '/compliance/report');
+    }
+
+    /**
+     * GET /connectors - listConnectors
+     */
+    async listConnectors() {
+        return this.request('GET', '/connectors');
+    }
+
+    /**
+     * POST /connectors/test - testConnectors
+     */
+    async testConnectors(data = null) {
+        return this.request('POST', '/connectors/test', data);
+    }
+
+    /**
+     * GET /consent - getConsent
+     */
+    async getConsent() {
+        return this.request('GET', '/consent');
+    }
+
+    /**
+     * POST /consent - acceptConsent
+     */
+    async acceptConsent(data = null) {
+        return this.request('POST', '/consent', data);
+    }
+
+    /**
+     * GET /consent/report - getConsentReport
+     */
+    async getConsentReport() {
+        return this.request('GET', '/consent/report');
+    }
+
+    /**
+     * POST /consent/withdraw - withdrawConsent
+     */
+    async withdrawConsent(data = null) {
+        return this.request('POST', '/consent/withdraw', data);
+    }
+
+    /**
+     * POST /email/messages - sendEmail
+     */
+    async sendEmail(data = null) {
+        return this.request('POST', '/email/messages', data);
+    }
+
+    /**
+     * GET /email/templates - listEmailTemplates
+     */
+    async listEmailTemplates() {
+        return this.request('GET', '/email/templates');
+    }
+
+    /**
+     * GET /organizations/{orgId}/plan - getOrganizationPlan
+     */
+    async getOrganizationPlan(param1) {
+        const path = this.extractPathParams('/organizations/{orgId}/plan', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * PUT /organizations/{orgId}/plan - assignOrganizationPlan
+     */
+    async assignOrganizationPlan(param1, data = null) {
+        const path = this.extractPathParams('/organizations/{orgId}/plan', [param1]);
+        return this.request('PUT', path, data);
+    }
+
+    /**
+     * GET /organizations/{orgId}/usage/api - getOrganizationAPIUsage
+     */
+    async getOrganizationAPIUsage(param1) {
+        const path = this.extractPathParams('/organizations/{orgId}/usage/api', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * GET /physics/profiles - listPhysicsProfiles
+     */
+    async listPhysicsProfiles() {
+        return this.request('GET', '/physics/profiles');
+    }
+
+    /**
+     * GET /plans - listPlans
+     */
+    async listPlans() {
+        return this.request('GET', '/plans');
+    }
+
+    /**
+     * GET /schema/components - listEntityComponents
+     */
+    async listEntityComponents() {
+        return this.request('GET', '/schema/components');
+    }
+
+    /**
+     * GET /screenshares - listScreenShares
+     */
+    async listScreenShares() {
+        return this.request('GET', '/screenshares');
+    }
+
+    /**
+     * POST /screenshares - startScreenShare
+     */
+    async startScreenShare(data = null) {
+        return this.request('POST', '/screenshares', data);
+    }
+
+    /**
+     * DELETE /screenshares/{shareId} - stopScreenShare
+     */
+    async stopScreenShare(param1) {
+        const path = this.extractPathParams('/screenshares/{shareId}', [param1]);
+        return this.request('DELETE', path);
+    }
+
+    /**
+     * GET /sessions/impersonations - listImpersonations
+     */
+    async listImpersonations() {
+        return this.request('GET', '/sessions/impersonations');
+    }
+
+    /**
+     * DELETE /sessions/impersonations/{impersonationId} - endImpersonation
+     */
+    async endImpersonation(param1) {
+        const path = this.extractPathParams('/sessions/impersonations/{impersonationId}', [param1]);
+        return this.request('DELETE', path);
+    }
+
+    /**
+     * GET /sessions/presence - getPresence
+     */
+    async getPresence() {
+        return this.request('GET', '/sessions/presence');
+    }
+
+    /**
+     * POST /sessions/tokens/revoke - revokeSessionToken
+     */
+    async revokeSessionToken(data = null) {
+        return this.request('POST', '/sessions/tokens/revoke', data);
+    }
+
+    /**
+     * POST /sessions/{hd1Id}/impersonation - startImpersonation
+     */
+    async startImpersonation(param1, data = null) {
+        const path = this.extractPathParams('/sessions/{hd1Id}/impersonation', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * DELETE /sessions/{hd1Id}/tokens - revokeSession
+     */
+    async revokeSession(param1) {
+        const path = this.extractPathParams('/sessions/{hd1Id}/tokens', [param1]);
+        return this.request('DELETE', path);
+    }
+
+    /**
+     * POST /storage/signed-url - createSignedURL
+     */
+    async createSignedURL(data = null) {
+        return this.request('POST', '/storage/signed-url', data);
+    }
+
+    /**
+     * GET /webhooks - listWebhooks
+     */
+    async listWebhooks() {
+        return this.request('GET', '/webhooks');
+    }
+
+    /**
+     * POST /webhooks/{webhookId} - receiveWebhook
+     */
+    async receiveWebhook(param1, data = null) {
+        const path = this.extractPathParams('/webhooks/{webhookId}', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * POST /webhooks/{webhookId}/test - testWebhook
+     */
+    async testWebhook(param1, data = null) {
+        const path = this.extractPathParams('/webhooks/{webhookId}/test', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * POST /worlds/validate - validateWorlds
+     */
+    async validateWorlds(data = null) {
+        return this.request('POST', '/worlds/validate', data);
+    }
+
+    /**
+     * POST /worlds/{worldId}/arrivals - expectArrival
+     */
+    async expectArrival(param1, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/arrivals', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * POST /worlds/{worldId}/arrivals/{ticket}/claim - claimArrival
+     */
+    async claimArrival(param1, param2, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/arrivals/{ticket}/claim', [param1, param2]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * GET /worlds/{worldId}/bookings - listBookings
+     */
+    async listBookings(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/bookings', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * POST /worlds/{worldId}/bookings - createBooking
+     */
+    async createBooking(param1, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/bookings', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * DELETE /worlds/{worldId}/bookings/{bookingId} - cancelBooking
+     */
+    async cancelBooking(param1, param2) {
+        const path = this.extractPathParams('/worlds/{worldId}/bookings/{bookingId}', [param1, param2]);
+        return this.request('DELETE', path);
+    }
+
+    /**
+     * GET /worlds/{worldId}/bookings/{bookingId} - getBooking
+     */
+    async getBooking(param1, param2) {
+        const path = this.extractPathParams('/worlds/{worldId}/bookings/{bookingId}', [param1, param2]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * PUT /worlds/{worldId}/bookings/{bookingId} - updateBooking
+     */
+    async updateBooking(param1, param2, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/bookings/{bookingId}', [param1, param2]);
+        return this.request('PUT', path, data);
+    }
+
+    /**
+     * GET /worlds/{worldId}/bookings/{bookingId}/ics - getBookingCalendar
+     */
+    async getBookingCalendar(param1, param2) {
+        const path = this.extractPathParams('/worlds/{worldId}/bookings/{bookingId}/ics', [param1, param2]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * GET /worlds/{worldId}/broadcasts - listBroadcasts
+     */
+    async listBroadcasts(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/broadcasts', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * POST /worlds/{worldId}/broadcasts - startBroadcast
+     */
+    async startBroadcast(param1, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/broadcasts', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * DELETE /worlds/{worldId}/broadcasts/{broadcastId} - stopBroadcast
+     */
+    async stopBroadcast(param1, param2) {
+        const path = this.extractPathParams('/worlds/{worldId}/broadcasts/{broadcastId}', [param1, param2]);
+        return this.request('DELETE', path);
+    }
+
+    /**
+     * GET /worlds/{worldId}/broadcasts/{broadcastId} - getBroadcast
+     */
+    async getBroadcast(param1, param2) {
+        const path = this.extractPathParams('/worlds/{worldId}/broadcasts/{broadcastId}', [param1, param2]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * GET /worlds/{worldId}/calendar - getWorldCalendar
+     */
+    async getWorldCalendar(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/calendar', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * GET /worlds/{worldId}/checkpoints - listCheckpoints
+     */
+    async listCheckpoints(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/checkpoints', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * POST /worlds/{worldId}/checkpoints - createCheckpoint
+     */
+    async createCheckpoint(param1, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/checkpoints', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * GET /worlds/{worldId}/checkpoints/{checkpointId} - getCheckpoint
+     */
+    async getCheckpoint(param1, param2) {
+        const path = this.extractPathParams('/worlds/{worldId}/checkpoints/{checkpointId}', [param1, param2]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * POST /worlds/{worldId}/checkpoints/{checkpointId}/rollback - rollbackCheckpoint
+     */
+    async rollbackCheckpoint(param1, param2, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/checkpoints/{checkpointId}/rollback', [param1, param2]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * GET /worlds/{worldId}/clock - getWorldClock
+     */
+    async getWorldClock(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/clock', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * PUT /worlds/{worldId}/clock - setWorldClock
+     */
+    async setWorldClock(param1, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/clock', [param1]);
+        return this.request('PUT', path, data);
+    }
+
+    /**
+     * POST /worlds/{worldId}/clock/pause - pauseWorldClock
+     */
+    async pauseWorldClock(param1, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/clock/pause', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * POST /worlds/{worldId}/clock/resume - resumeWorldClock
+     */
+    async resumeWorldClock(param1, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/clock/resume', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * GET /worlds/{worldId}/constraints - getWorldConstraints
+     */
+    async getWorldConstraints(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/constraints', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * PUT /worlds/{worldId}/constraints - setWorldConstraints
+     */
+    async setWorldConstraints(param1, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/constraints', [param1]);
+        return this.request('PUT', path, data);
+    }
+
+    /**
+     * GET /worlds/{worldId}/diff - diffCheckpoints
+     */
+    async diffCheckpoints(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/diff', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * DELETE /worlds/{worldId}/director - releaseDirector
+     */
+    async releaseDirector(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/director', [param1]);
+        return this.request('DELETE', path);
+    }
+
+    /**
+     * PUT /worlds/{worldId}/director - setDirector
+     */
+    async setDirector(param1, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/director', [param1]);
+        return this.request('PUT', path, data);
+    }
+
+    /**
+     * GET /worlds/{worldId}/documents - listDocuments
+     */
+    async listDocuments(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/documents', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * POST /worlds/{worldId}/documents - createDocument
+     */
+    async createDocument(param1, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/documents', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * DELETE /worlds/{worldId}/documents/{documentId} - deleteDocument
+     */
+    async deleteDocument(param1, param2) {
+        const path = this.extractPathParams('/worlds/{worldId}/documents/{documentId}', [param1, param2]);
+        return this.request('DELETE', path);
+    }
+
+    /**
+     * GET /worlds/{worldId}/documents/{documentId} - getDocument
+     */
+    async getDocument(param1, param2) {
+        const path = this.extractPathParams('/worlds/{worldId}/documents/{documentId}', [param1, param2]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * PUT /worlds/{worldId}/documents/{documentId} - updateDocument
+     */
+    async updateDocument(param1, param2, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/documents/{documentId}', [param1, param2]);
+        return this.request('PUT', path, data);
+    }
+
+    /**
+     * POST /worlds/{worldId}/documents/{documentId}/operations - submitDocumentOperation
+     */
+    async submitDocumentOperation(param1, param2, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/documents/{documentId}/operations', [param1, param2]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * GET /worlds/{worldId}/environment - getWorldEnvironment
+     */
+    async getWorldEnvironment(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/environment', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * PUT /worlds/{worldId}/environment - setWorldEnvironment
+     */
+    async setWorldEnvironment(param1, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/environment', [param1]);
+        return this.request('PUT', path, data);
+    }
+
+    /**
+     * GET /worlds/{worldId}/export - exportWorld
+     */
+    async exportWorld(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/export', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * GET /worlds/{worldId}/geo - getWorldGeo
+     */
+    async getWorldGeo(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/geo', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * PUT /worlds/{worldId}/geo - setWorldGeo
+     */
+    async setWorldGeo(param1, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/geo', [param1]);
+        return this.request('PUT', path, data);
+    }
+
+    /**
+     * POST /worlds/{worldId}/geo/tiles - loadWorldGeoTiles
+     */
+    async loadWorldGeoTiles(param1, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/geo/tiles', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * GET /worlds/{worldId}/guest-links - listGuestLinks
+     */
+    async listGuestLinks(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/guest-links', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * POST /worlds/{worldId}/guest-links - createGuestLink
+     */
+    async createGuestLink(param1, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/guest-links', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * DELETE /worlds/{worldId}/guest-links/{linkId} - revokeGuestLink
+     */
+    async revokeGuestLink(param1, param2) {
+        const path = this.extractPathParams('/worlds/{worldId}/guest-links/{linkId}', [param1, param2]);
+        return this.request('DELETE', path);
+    }
+
+    /**
+     * GET /worlds/{worldId}/imports - listWorldImports
+     */
+    async listWorldImports(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/imports', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * POST /worlds/{worldId}/imports - createWorldImport
+     */
+    async createWorldImport(param1, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/imports', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * GET /worlds/{worldId}/imports/{importId} - getWorldImport
+     */
+    async getWorldImport(param1, param2) {
+        const path = this.extractPathParams('/worlds/{worldId}/imports/{importId}', [param1, param2]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * GET /worlds/{worldId}/lint - lintWorld
+     */
+    async lintWorld(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/lint', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * POST /worlds/{worldId}/migrate - migrateWorld
+     */
+    async migrateWorld(param1, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/migrate', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * POST /worlds/{worldId}/migration/snapshot - receiveMigrationSnapshot
+     */
+    async receiveMigrationSnapshot(param1, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/migration/snapshot', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * POST /worlds/{worldId}/migration/tail - receiveMigrationTail
+     */
+    async receiveMigrationTail(param1, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/migration/tail', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * GET /worlds/{worldId}/moderation/audit - getModerationAudit
+     */
+    async getModerationAudit(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/moderation/audit', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * GET /worlds/{worldId}/moderation/bans - listBans
+     */
+    async listBans(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/moderation/bans', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * POST /worlds/{worldId}/moderation/bans - createBan
+     */
+    async createBan(param1, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/moderation/bans', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * DELETE /worlds/{worldId}/moderation/bans/{banId} - removeBan
+     */
+    async removeBan(param1, param2) {
+        const path = this.extractPathParams('/worlds/{worldId}/moderation/bans/{banId}', [param1, param2]);
+        return this.request('DELETE', path);
+    }
+
+    /**
+     * POST /worlds/{worldId}/moderation/kick - kickSession
+     */
+    async kickSession(param1, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/moderation/kick', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * GET /worlds/{worldId}/moderation/mutes - listMutes
+     */
+    async listMutes(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/moderation/mutes', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * POST /worlds/{worldId}/moderation/mutes - muteSession
+     */
+    async muteSession(param1, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/moderation/mutes', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * DELETE /worlds/{worldId}/moderation/mutes/{hd1Id} - unmuteSession
+     */
+    async unmuteSession(param1, param2) {
+        const path = this.extractPathParams('/worlds/{worldId}/moderation/mutes/{hd1Id}', [param1, param2]);
+        return this.request('DELETE', path);
+    }
+
+    /**
+     * GET /worlds/{worldId}/params - listWorldParams
+     */
+    async listWorldParams(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/params', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * DELETE /worlds/{worldId}/params/{key} - deleteWorldParam
+     */
+    async deleteWorldParam(param1, param2) {
+        const path = this.extractPathParams('/worlds/{worldId}/params/{key}', [param1, param2]);
+        return this.request('DELETE', path);
+    }
+
+    /**
+     * GET /worlds/{worldId}/params/{key} - getWorldParam
+     */
+    async getWorldParam(param1, param2) {
+        const path = this.extractPathParams('/worlds/{worldId}/params/{key}', [param1, param2]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * PUT /worlds/{worldId}/params/{key} - setWorldParam
+     */
+    async setWorldParam(param1, param2, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/params/{key}', [param1, param2]);
+        return this.request('PUT', path, data);
+    }
+
+    /**
+     * GET /worlds/{worldId}/physics - getWorldPhysics
+     */
+    async getWorldPhysics(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/physics', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * PUT /worlds/{worldId}/physics - setWorldPhysics
+     */
+    async setWorldPhysics(param1, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/physics', [param1]);
+        return this.request('PUT', path, data);
+    }
+
+    /**
+     * GET /worlds/{worldId}/polls - listPolls
+     */
+    async listPolls(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/polls', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * POST /worlds/{worldId}/polls - createPoll
+     */
+    async createPoll(param1, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/polls', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * GET /worlds/{worldId}/polls/{pollId} - getPoll
+     */
+    async getPoll(param1, param2) {
+        const path = this.extractPathParams('/worlds/{worldId}/polls/{pollId}', [param1, param2]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * POST /worlds/{worldId}/polls/{pollId}/close - closePoll
+     */
+    async closePoll(param1, param2, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/polls/{pollId}/close', [param1, param2]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * PUT /worlds/{worldId}/polls/{pollId}/vote - castVote
+     */
+    async castVote(param1, param2, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/polls/{pollId}/vote', [param1, param2]);
+        return this.request('PUT', path, data);
+    }
+
+    /**
+     * GET /worlds/{worldId}/quality - getWorldQuality
+     */
+    async getWorldQuality(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/quality', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * GET /worlds/{worldId}/space - getWorldSpace
+     */
+    async getWorldSpace(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/space', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * PUT /worlds/{worldId}/space - setWorldSpace
+     */
+    async setWorldSpace(param1, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/space', [param1]);
+        return this.request('PUT', path, data);
+    }
+
+    /**
+     * GET /worlds/{worldId}/spectators - listSpectators
+     */
+    async listSpectators(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/spectators', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * GET /worlds/{worldId}/telemetry - getWorldTelemetry
+     */
+    async getWorldTelemetry(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/telemetry', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * POST /worlds/{worldId}/telemetry - reportWorldTelemetry
+     */
+    async reportWorldTelemetry(param1, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/telemetry', [param1]);
+        return this.request('POST', path, data);
+    }
+
+    /**
+     * GET /worlds/{worldId}/usage - getWorldUsage
+     */
+    async getWorldUsage(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/usage', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * GET /worlds/{worldId}/views - listViews
+     */
+    async listViews(param1) {
+        const path = this.extractPathParams('/worlds/{worldId}/views', [param1]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * DELETE /worlds/{worldId}/views/{viewName} - deleteView
+     */
+    async deleteView(param1, param2) {
+        const path = this.extractPathParams('/worlds/{worldId}/views/{viewName}', [param1, param2]);
+        return this.request('DELETE', path);
+    }
+
+    /**
+     * GET /worlds/{worldId}/views/{viewName} - getView
+     */
+    async getView(param1, param2) {
+        const path = this.extractPathParams('/worlds/{worldId}/views/{viewName}', [param1, param2]);
+        return this.request('GET', path);
+    }
+
+    /**
+     * PUT /worlds/{worldId}/views/{viewName} - saveView
+     */
+    async saveView(param1, param2, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/views/{viewName}', [param1, param2]);
+        return this.request('PUT', path, data);
+    }
+
+    /**
+     * POST /worlds/{worldId}/views/{viewName}/visit - visitView
+     */
+    async visitView(param1, param2, data = null) {
+        const path = this.extractPathParams('/worlds/{worldId}/views/{viewName}/visit', [param1, param2]);
+        return this.request('POST', path, data);
+    }
+
+
+    // ========================================
+    // CONVENIENCE METHODS
+    // ========================================
+
+    /**
+     * Create a box entity with default material
+     */
+    async createBox(width = 1, height = 1, depth = 1, color = '#777777', position = {x: 0, y: 0, z: 0}) {
+        return this.createEntityWithGeometry({
+            geometry: {
+                type: 'box',
+                width: width,
+                height: height,
+                depth: depth
+            },
+            material: {
+                type: 'phong',
+                color: color
+            },
+            position: position
+        });
+    }
+
+    /**
+     * Create a sphere entity with default material
+     */
+    async createSphere(radius = 0.5, color = '#777777', position = {x: 0, y: 0, z: 0}) {
+        return this.createEntityWithGeometry({
+            geometry: {
+                type: 'sphere',
+                radius: radius
+            },
+            material: {
+                type: 'phong',
+                color: color
+            },
+            position: position
+        });
+    }
+
+    /**
+     * Move entity to new position
+     */
+    async moveEntity(entityId, position) {
+        return this.updateEntity(entityId, { position: position });
+    }
+
+    /**
+     * Change entity color
+     */
+    async changeEntityColor(entityId, color) {
+        return this.updateEntity(entityId, {
+            material: {
+                type: 'phong',
+                color: color
+            }
+        });
+    }
+
+    /**
+     * Set scene background color
+     */
+    async setBackground(color) {
+        return this.updateScene({ background: color });
+    }
+
+    /**
+     * Add fog to scene
+     */
+    async addFog(color = '#ffffff', near = 1, far = 100) {
+        return this.updateScene({
             fog: {
                 color: color,
                 near: near,
@@ -327,12 +1623,176 @@ class HD1ThreeJSAPIClient {
     }
 }
 
+// Version of the specification this client was generated from, and the API
+// version it calls
+HD1ThreeJSAPIClient.VERSION = '0.9.0';
+HD1ThreeJSAPIClient.API_VERSION = 'v1';
+
+// Compares dotted versions numerically: negative, zero or positive
+function hd1CompareVersions(a, b) {
+    const left = String(a).split('.').map(Number);
+    const right = String(b).split('.').map(Number);
+    for (let i = 0; i < Math.max(left.length, right.length); i++) {
+        const difference = (left[i] || 0) - (right[i] || 0);
+        if (difference !== 0) {
+            return difference;
+        }
+    }
+    return 0;
+}
+
+/**
+ * UI string translation backed by /system/locales/{lang}.
+ *
+ * Elements marked data-i18n="key" get their text replaced, data-i18n-title
+ * sets the title attribute. Messages may contain {name} placeholders.
+ */
+class HD1I18n {
+    constructor(client = null) {
+        this.client = client || new HD1ThreeJSAPIClient();
+        this.locale = null;
+        this.messages = {};
+        this.listeners = [];
+    }
+
+    /**
+     * Language to request: ?lang=, the saved choice, the browser, then the
+     * server default the page was rendered with (<html lang>)
+     */
+    preferredLocale() {
+        if (typeof window === 'undefined') {
+            return 'en';
+        }
+        const fromQuery = new URLSearchParams(window.location.search).get('lang');
+        if (fromQuery) {
+            return fromQuery;
+        }
+        try {
+            const saved = window.localStorage.getItem('hd1.locale');
+            if (saved) {
+                return saved;
+            }
+        } catch (error) {
+            // Storage unavailable (privacy mode)
+        }
+        if (navigator.languages && navigator.languages.length) {
+            return navigator.languages[0];
+        }
+        return navigator.language || document.documentElement.lang || 'en';
+    }
+
+    async load(locale = this.preferredLocale()) {
+        const catalogue = await this.client.getLocale(locale);
+        this.locale = catalogue.locale;
+        this.messages = catalogue.messages || {};
+        if (typeof document !== 'undefined') {
+            document.documentElement.lang = this.locale;
+            this.translateDocument();
+        }
+        this.listeners.forEach(listener => listener(this.locale));
+        return catalogue;
+    }
+
+    /**
+     * Switch language and remember the choice
+     */
+    async setLocale(locale) {
+        try {
+            window.localStorage.setItem('hd1.locale', locale);
+        } catch (error) {
+            // Choice lasts for this page only
+        }
+        return this.load(locale);
+    }
+
+    onChange(listener) {
+        this.listeners.push(listener);
+    }
+
+    t(key, params = {}) {
+        const message = Object.prototype.hasOwnProperty.call(this.messages, key) ? this.messages[key] : key;
+        return message.replace(/\{(\w+)\}/g, (match, name) =>
+            Object.prototype.hasOwnProperty.call(params, name) ? String(params[name]) : match);
+    }
+
+    translateDocument(root = document) {
+        root.querySelectorAll('[data-i18n]').forEach(element => {
+            element.textContent = this.t(element.dataset.i18n);
+        });
+        root.querySelectorAll('[data-i18n-title]').forEach(element => {
+            element.title = this.t(element.dataset.i18nTitle);
+        });
+    }
+}
+
+/**
+ * Feature flags backed by /system/features, resolved for the client's
+ * organization and a world. Gate risky features with isEnabled(name);
+ * unknown flags are off.
+ */
+class HD1Features {
+    constructor(client = null) {
+        this.client = client || new HD1ThreeJSAPIClient();
+        this.world = null;
+        this.flags = {};
+        this.listeners = [];
+    }
+
+    async load(world = this.world) {
+        const query = world ? '?world=' + encodeURIComponent(world) : '';
+        const resolved = await this.client.request('GET', '/system/features' + query);
+        this.world = resolved.world;
+        this.flags = resolved.features || {};
+        this.listeners.forEach(listener => listener(this.flags));
+        return resolved;
+    }
+
+    isEnabled(name) {
+        return this.flags[name] === true;
+    }
+
+    onChange(listener) {
+        this.listeners.push(listener);
+    }
+}
+
+/**
+ * Operation types of the sync log, from x-operation-types. Match on these
+ * rather than spelling types by hand.
+ */
+const HD1OperationTypes = Object.freeze({
+    ANCHOR_CREATE: 'anchor_create', // Spatial anchor placed
+    ANCHOR_DELETE: 'anchor_delete', // Spatial anchor removed
+    ANIMATION_CONTROL: 'animation_control', // Animation played, paused or stopped
+    ANIMATION_CREATE: 'animation_create', // Animation clip defined
+    AVATAR_CREATE: 'avatar_create', // Avatar joined the world
+    AVATAR_LEAVE: 'avatar_leave', // Avatar left with its session, with the reason
+    AVATAR_MOVE: 'avatar_move', // Avatar moved
+    AVATAR_REMOVE: 'avatar_remove', // Avatar removed
+    AVATAR_UPDATE: 'avatar_update', // Avatar appearance or pose changed
+    ENTITY_CREATE: 'entity_create', // Entity created, or replaced when its ID exists
+    ENTITY_DELETE: 'entity_delete', // Entity deleted
+    ENTITY_UPDATE: 'entity_update', // Entity components changed
+    MATERIAL_CREATE: 'material_create', // Material defined
+    SCENE_UPDATE: 'scene_update', // Scene properties changed, such as physics or environment
+    TEXTURE_CREATE: 'texture_create', // Texture defined
+    TEXTURE_LOAD: 'texture_load', // Texture loaded from a URL
+    TRANSACTION: 'transaction', // Entity operations committed together under one sequence number
+    WHITEBOARD_DELTA: 'whiteboard_delta', // Strokes added to or erased from a whiteboard
+});
+
 // Export for module systems
 if (typeof module !== 'undefined' && module.exports) {
     module.exports = HD1ThreeJSAPIClient;
+    module.exports.HD1I18n = HD1I18n;
+    module.exports.HD1Features = HD1Features;
+    module.exports.HD1OperationTypes = HD1OperationTypes;
 }
 
 // Global export
 if (typeof window !== 'undefined') {
     window.HD1ThreeJSAPIClient = HD1ThreeJSAPIClient;
+    window.HD1I18n = HD1I18n;
+    window.HD1Features = HD1Features;
+    window.HD1OperationTypes = HD1OperationTypes;
 }
\ No newline at end of file
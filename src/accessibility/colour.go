@@ -0,0 +1,61 @@
+package accessibility
+
+import (
+	"strconv"
+	"strings"
+)
+
+// namedColours is the palette hex colours are spoken as. It is kept short:
+// "dark slate grey" helps nobody find an object.
+var namedColours = []struct {
+	name    string
+	r, g, b float64
+}{
+	{"black", 0, 0, 0},
+	{"dark grey", 64, 64, 64},
+	{"grey", 128, 128, 128},
+	{"light grey", 192, 192, 192},
+	{"white", 255, 255, 255},
+	{"red", 220, 20, 20},
+	{"dark red", 128, 0, 0},
+	{"orange", 255, 140, 0},
+	{"yellow", 255, 220, 0},
+	{"brown", 139, 69, 19},
+	{"green", 0, 180, 0},
+	{"dark green", 0, 100, 0},
+	{"cyan", 0, 220, 220},
+	{"blue", 30, 60, 230},
+	{"dark blue", 0, 0, 128},
+	{"light blue", 135, 206, 250},
+	{"purple", 128, 0, 160},
+	{"magenta", 230, 0, 230},
+	{"pink", 255, 170, 200},
+}
+
+// ColourName returns the nearest palette name for a #rgb or #rrggbb colour.
+// Anything else (CSS names, empty) is returned as given.
+func ColourName(colour string) string {
+	hex := strings.TrimPrefix(strings.TrimSpace(colour), "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 || !strings.HasPrefix(strings.TrimSpace(colour), "#") {
+		return strings.ToLower(colour)
+	}
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return strings.ToLower(colour)
+	}
+	r, g, b := float64(value>>16&0xff), float64(value>>8&0xff), float64(value&0xff)
+
+	best, bestDistance := "", -1.0
+	for _, named := range namedColours {
+		// Weighted for perceived brightness: the eye is most sensitive to green
+		dr, dg, db := r-named.r, g-named.g, b-named.b
+		distance := 2*dr*dr + 4*dg*dg + 3*db*db
+		if bestDistance < 0 || distance < bestDistance {
+			best, bestDistance = named.name, distance
+		}
+	}
+	return best
+}
@@ -0,0 +1,411 @@
+// Package accessibility turns the operation log into text for assistive
+// clients: one-sentence descriptions of scene changes for screen readers,
+// and a compact text-mode view of the whole world.
+//
+// A Scene is a lightweight replica built by applying operations in
+// sequence order. It only keeps what a description needs - labels,
+// colours, positions and visibility - never geometry or materials.
+package accessibility
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"holodeck1/panels"
+	"holodeck1/sync"
+)
+
+// Vector3 is a position in metres
+type Vector3 struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+// String formats a position for speech: one decimal per axis
+func (v Vector3) String() string {
+	return fmt.Sprintf("%.1f, %.1f, %.1f", v.X, v.Y, v.Z)
+}
+
+// Distance returns the straight-line distance to other
+func (v Vector3) Distance(other Vector3) float64 {
+	dx, dy, dz := v.X-other.X, v.Y-other.Y, v.Z-other.Z
+	return math.Sqrt(dx*dx + dy*dy + dz*dz)
+}
+
+// Entity is the accessible view of a scene object
+type Entity struct {
+	ID       string  `json:"id"`
+	Label    string  `json:"label"`
+	Kind     string  `json:"kind"` // box, sphere, text, model, ...
+	Colour   string  `json:"colour,omitempty"`
+	Text     string  `json:"text,omitempty"`
+	Position Vector3 `json:"position"`
+	Visible  bool    `json:"visible"`
+	Playing  *bool   `json:"playing,omitempty"` // Screens only
+}
+
+// Person is a connected avatar
+type Person struct {
+	HD1ID    string  `json:"hd1_id"`
+	Name     string  `json:"name"`
+	Position Vector3 `json:"position"`
+}
+
+// Scene is a replica of the world reduced to what descriptions need
+type Scene struct {
+	Sequence   uint64
+	Background string
+	Weather    string
+	entities   map[string]*Entity
+	people     map[string]*Person
+	anchors    map[string]string // anchor_id -> world
+}
+
+// NewScene returns an empty scene
+func NewScene() *Scene {
+	return &Scene{
+		entities: make(map[string]*Entity),
+		people:   make(map[string]*Person),
+		anchors:  make(map[string]string),
+	}
+}
+
+// Replay builds a scene from operations in sequence order
+func Replay(operations []*sync.Operation) *Scene {
+	scene := NewScene()
+	for _, op := range operations {
+		scene.Apply(op)
+	}
+	return scene
+}
+
+// operationData is the union of the fields descriptions read. Operation
+// data holds typed structs in memory, so it is decoded through JSON.
+type operationData struct {
+	ID        string `json:"id"`
+	HD1ID     string `json:"hd1_id"`
+	Name      string `json:"name"`
+	Model     string `json:"model"`
+	Particles *struct {
+		Shape string `json:"shape"`
+	} `json:"particles"`
+	Panel *panels.Panel `json:"panel"`
+	Media *struct {
+		Playing bool `json:"playing"`
+	} `json:"media"`
+	Position *Vector3 `json:"position"`
+	Visible  *bool    `json:"visible"`
+	Geometry *struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"geometry"`
+	Material *struct {
+		Color string `json:"color"`
+	} `json:"material"`
+	Background string          `json:"background"`
+	Fog        json.RawMessage `json:"fog"`
+	Physics    *struct {
+		Name string `json:"name"`
+	} `json:"physics"`
+	Environment *struct {
+		Weather string `json:"weather"`
+	} `json:"environment"`
+	Anchor *struct {
+		ID    string `json:"id"`
+		World string `json:"world"`
+	} `json:"anchor"`
+	Whiteboard *struct{} `json:"whiteboard"`
+	Form       *struct {
+		Title string `json:"title"`
+	} `json:"form"`
+	PointCloud *struct{} `json:"pointcloud"`
+	Terrain    *struct{} `json:"terrain"`
+	Clear      bool      `json:"clear"` // whiteboard_delta
+}
+
+// Apply updates the scene and returns a description of the change, or ""
+// for operations too frequent or minor to announce (avatar movement)
+func (s *Scene) Apply(op *sync.Operation) string {
+	if op == nil {
+		return ""
+	}
+	if op.SeqNum > s.Sequence {
+		s.Sequence = op.SeqNum
+	}
+	if op.Type == sync.TransactionType {
+		// One change to the world, announced as one
+		var texts []string
+		for _, part := range op.Parts() {
+			if text := s.Apply(part); text != "" {
+				texts = append(texts, text)
+			}
+		}
+		return strings.Join(texts, "; ")
+	}
+
+	encoded, err := json.Marshal(op.Data)
+	if err != nil {
+		return ""
+	}
+	var data operationData
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		return ""
+	}
+
+	switch op.Type {
+	case sync.OpEntityCreate:
+		if data.ID == "" {
+			return ""
+		}
+		return s.createEntity(&data)
+	case sync.OpEntityUpdate:
+		return s.updateEntity(&data)
+	case sync.OpEntityDelete:
+		entity, ok := s.entities[data.ID]
+		if !ok {
+			return ""
+		}
+		delete(s.entities, data.ID)
+		return capitalize(entity.Label) + " removed"
+	case sync.OpWhiteboardDelta:
+		// Strokes come too often to announce; a clear is worth knowing
+		if entity, ok := s.entities[data.ID]; ok && data.Clear && entity.Visible {
+			return capitalize(entity.Label) + " cleared"
+		}
+		return ""
+
+	case sync.OpAvatarCreate:
+		person := &Person{HD1ID: data.HD1ID, Name: data.Name}
+		if person.Name == "" {
+			person.Name = data.HD1ID
+		}
+		if data.Position != nil {
+			person.Position = *data.Position
+		}
+		s.people[data.HD1ID] = person
+		return person.Name + " joined"
+	case sync.OpAvatarMove, sync.OpAvatarUpdate:
+		if person, ok := s.people[data.HD1ID]; ok && data.Position != nil {
+			person.Position = *data.Position
+		}
+		return ""
+	case sync.OpAvatarRemove, sync.OpAvatarLeave:
+		person, ok := s.people[data.HD1ID]
+		if !ok {
+			return ""
+		}
+		delete(s.people, data.HD1ID)
+		return person.Name + " left"
+
+	case sync.OpSceneUpdate:
+		var changes []string
+		if data.Background != "" {
+			s.Background = data.Background
+			changes = append(changes, "background changed to "+ColourName(data.Background))
+		}
+		if len(data.Fog) > 0 && string(data.Fog) != "null" {
+			changes = append(changes, "fog changed")
+		}
+		if data.Physics != nil {
+			changes = append(changes, "physics switched to "+strings.ReplaceAll(data.Physics.Name, "_", " "))
+		}
+		// The environment updates as the day goes by; only weather is news
+		if data.Environment != nil && data.Environment.Weather != s.Weather {
+			s.Weather = data.Environment.Weather
+			changes = append(changes, "weather turned to "+data.Environment.Weather)
+		}
+		if len(changes) == 0 {
+			return ""
+		}
+		return capitalize(strings.Join(changes, ", "))
+
+	case sync.OpAnchorCreate:
+		if data.Anchor == nil {
+			return ""
+		}
+		s.anchors[data.Anchor.ID] = data.Anchor.World
+		return "AR anchor " + data.Anchor.ID + " placed"
+	case sync.OpAnchorDelete:
+		if _, ok := s.anchors[data.ID]; !ok {
+			return ""
+		}
+		delete(s.anchors, data.ID)
+		return "AR anchor " + data.ID + " removed"
+	}
+	return ""
+}
+
+func (s *Scene) createEntity(data *operationData) string {
+	entity := &Entity{ID: data.ID, Kind: "object", Visible: true}
+	if data.Geometry != nil && data.Geometry.Type != "" {
+		entity.Kind = data.Geometry.Type
+		entity.Text = data.Geometry.Text
+	}
+	if data.Model != "" {
+		entity.Kind = "model"
+	}
+	if data.Particles != nil && data.Geometry == nil && data.Model == "" {
+		entity.Kind = "particle effect"
+	}
+	if data.Panel != nil && data.Geometry == nil && data.Model == "" {
+		entity.Kind = data.Panel.Kind
+		entity.Text = excerpt(data.Panel.PlainText())
+	}
+	if data.Whiteboard != nil && data.Geometry == nil && data.Model == "" {
+		entity.Kind = "whiteboard"
+	}
+	if data.Form != nil && data.Geometry == nil && data.Model == "" {
+		entity.Kind = "form"
+		entity.Text = excerpt(data.Form.Title)
+	}
+	if data.PointCloud != nil && data.Geometry == nil && data.Model == "" {
+		entity.Kind = "point cloud"
+	}
+	if data.Terrain != nil && data.Geometry == nil && data.Model == "" {
+		entity.Kind = "ground"
+	}
+	if data.Media != nil {
+		if data.Geometry == nil && data.Model == "" {
+			entity.Kind = "screen"
+		}
+		playing := data.Media.Playing
+		entity.Playing = &playing
+	}
+	if data.Material != nil && data.Material.Color != "" {
+		entity.Colour = ColourName(data.Material.Color)
+	}
+	if data.Position != nil {
+		entity.Position = *data.Position
+	}
+	if data.Visible != nil {
+		entity.Visible = *data.Visible
+	}
+	entity.Label = label(entity)
+	s.entities[entity.ID] = entity
+
+	if !entity.Visible {
+		return ""
+	}
+	return fmt.Sprintf("%s appeared at %s", capitalize(entity.Label), entity.Position)
+}
+
+func (s *Scene) updateEntity(data *operationData) string {
+	entity, ok := s.entities[data.ID]
+	if !ok {
+		return ""
+	}
+	before := entity.Label
+	wasVisible := entity.Visible
+
+	var changes []string
+	if data.Material != nil && data.Material.Color != "" {
+		if colour := ColourName(data.Material.Color); colour != entity.Colour {
+			entity.Colour = colour
+			entity.Label = label(entity)
+			changes = append(changes, "turned "+colour)
+		}
+	}
+	if data.Position != nil {
+		entity.Position = *data.Position
+		changes = append(changes, "moved to "+entity.Position.String())
+	}
+	if data.Panel != nil && data.Panel.Kind == entity.Kind {
+		if text := excerpt(data.Panel.PlainText()); text != entity.Text {
+			entity.Text = text
+			entity.Label = label(entity)
+			changes = append(changes, fmt.Sprintf("now reads %q", text))
+		}
+	}
+	if data.Media != nil && (entity.Playing == nil || *entity.Playing != data.Media.Playing) {
+		playing := data.Media.Playing
+		entity.Playing = &playing
+		if playing {
+			changes = append(changes, "started playing")
+		} else {
+			changes = append(changes, "paused")
+		}
+	}
+	if data.Visible != nil && *data.Visible != wasVisible {
+		entity.Visible = *data.Visible
+		if entity.Visible {
+			changes = append(changes, "appeared")
+		} else {
+			changes = append(changes, "hidden")
+		}
+	}
+
+	// Changes to hidden objects are silent
+	if len(changes) == 0 || (!wasVisible && !entity.Visible) {
+		return ""
+	}
+	return capitalize(before) + " " + strings.Join(changes, ", ")
+}
+
+// label names an entity the way a person would: "red box", "text "Exit""
+func label(entity *Entity) string {
+	if entity.Text != "" {
+		// Text entities and panels are known by what they say
+		return fmt.Sprintf("%s %q", entity.Kind, entity.Text)
+	}
+	if entity.Colour != "" {
+		return entity.Colour + " " + entity.Kind
+	}
+	return entity.Kind
+}
+
+// excerpt shortens panel content to what is worth reading out
+func excerpt(text string) string {
+	const maxRunes = 120
+	if runes := []rune(text); len(runes) > maxRunes {
+		return strings.TrimSpace(string(runes[:maxRunes])) + "…"
+	}
+	return text
+}
+
+func capitalize(text string) string {
+	if text == "" {
+		return text
+	}
+	return strings.ToUpper(text[:1]) + text[1:]
+}
+
+// Entities returns visible entities, nearest to viewer first when one is
+// given, otherwise in ID order
+func (s *Scene) Entities(viewer *Vector3) []*Entity {
+	result := make([]*Entity, 0, len(s.entities))
+	for _, entity := range s.entities {
+		if entity.Visible {
+			result = append(result, entity)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if viewer != nil {
+			di, dj := viewer.Distance(result[i].Position), viewer.Distance(result[j].Position)
+			if di != dj {
+				return di < dj
+			}
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// People returns connected avatars in name order
+func (s *Scene) People() []*Person {
+	result := make([]*Person, 0, len(s.people))
+	for _, person := range s.people {
+		result = append(result, person)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Person returns the avatar with the given HD1 ID
+func (s *Scene) Person(hd1ID string) (*Person, bool) {
+	person, ok := s.people[hd1ID]
+	return person, ok
+}
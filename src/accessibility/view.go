@@ -0,0 +1,115 @@
+package accessibility
+
+import (
+	"fmt"
+	"strings"
+
+	"holodeck1/sync"
+)
+
+// View is the text-mode world view served to assistive clients
+type View struct {
+	Sequence   uint64    `json:"sequence"`
+	Background string    `json:"background,omitempty"`
+	Viewer     *Person   `json:"viewer,omitempty"`
+	Entities   []*Entity `json:"entities"`
+	People     []*Person `json:"people"`
+}
+
+// Description is one announced scene change
+type Description struct {
+	SeqNum uint64 `json:"seq_num"`
+	Text   string `json:"text"`
+}
+
+// NewView snapshots a scene. With a viewer, entities are ordered nearest first.
+func NewView(scene *Scene, viewerID string) *View {
+	view := &View{
+		Sequence: scene.Sequence,
+		People:   scene.People(),
+	}
+	if scene.Background != "" {
+		view.Background = ColourName(scene.Background)
+	}
+
+	var origin *Vector3
+	if viewer, ok := scene.Person(viewerID); ok {
+		view.Viewer = viewer
+		origin = &viewer.Position
+	}
+	view.Entities = scene.Entities(origin)
+	return view
+}
+
+// Describe replays operations and returns the descriptions of those with
+// sequence numbers from 'from' onwards, at most limit (0 for all)
+func Describe(operations []*sync.Operation, from uint64, limit int) []Description {
+	scene := NewScene()
+	descriptions := []Description{}
+	for _, op := range operations {
+		text := scene.Apply(op)
+		if text == "" || op.SeqNum < from {
+			continue
+		}
+		descriptions = append(descriptions, Description{SeqNum: op.SeqNum, Text: text})
+		if limit > 0 && len(descriptions) == limit {
+			break
+		}
+	}
+	return descriptions
+}
+
+// Text renders the view as short plain-text lines, suitable for a braille
+// display or a terminal screen reader
+func (v *View) Text() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s, %s.", plural(len(v.Entities), "object"), plural(len(v.People), "person"))
+	if v.Background != "" {
+		fmt.Fprintf(&b, " Background %s.", v.Background)
+	}
+	b.WriteString("\n")
+	if v.Viewer != nil {
+		fmt.Fprintf(&b, "You are %s at %s.\n", v.Viewer.Name, v.Viewer.Position)
+	}
+
+	if len(v.Entities) > 0 {
+		b.WriteString("Objects:\n")
+		for _, entity := range v.Entities {
+			fmt.Fprintf(&b, "- %s at %s", entity.Label, entity.Position)
+			if v.Viewer != nil {
+				fmt.Fprintf(&b, ", %.1f m away", v.Viewer.Position.Distance(entity.Position))
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	others := make([]*Person, 0, len(v.People))
+	for _, person := range v.People {
+		if v.Viewer == nil || person.HD1ID != v.Viewer.HD1ID {
+			others = append(others, person)
+		}
+	}
+	if len(others) > 0 {
+		b.WriteString("People:\n")
+		for _, person := range others {
+			fmt.Fprintf(&b, "- %s at %s", person.Name, person.Position)
+			if v.Viewer != nil {
+				fmt.Fprintf(&b, ", %.1f m away", v.Viewer.Position.Distance(person.Position))
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+func plural(n int, noun string) string {
+	switch {
+	case n == 1:
+		return "1 " + noun
+	case noun == "person":
+		return fmt.Sprintf("%d people", n)
+	default:
+		return fmt.Sprintf("%d %ss", n, noun)
+	}
+}
@@ -0,0 +1,258 @@
+// Package anchors keeps the shared spatial anchors AR clients use to
+// co-locate an HD1 world in physical space.
+//
+// An anchor records where a physical reference point sits in world
+// coordinates. A client that recognizes the same point in its own AR
+// session resolves the anchor with its local pose and receives the
+// alignment transform mapping its local space onto the world.
+//
+// Scopes:
+//   - session: removed when the creating client disconnects
+//   - persistent: written to the storage backend and reloaded on restart
+//
+// Either scope may also expire after a TTL.
+package anchors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"holodeck1/logging"
+	"holodeck1/storage"
+	"holodeck1/xr"
+)
+
+// Persistence scopes
+const (
+	ScopeSession    = "session"
+	ScopePersistent = "persistent"
+)
+
+// ErrExists is returned when creating an anchor whose ID is taken
+var ErrExists = errors.New("anchor already exists")
+
+// ErrNotFound is returned for unknown or expired anchors
+var ErrNotFound = errors.New("anchor not found")
+
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Anchor is a shared reference point in a world
+type Anchor struct {
+	ID        string       `json:"id"`
+	World     string       `json:"world"`
+	Scope     string       `json:"scope"`
+	Transform xr.Transform `json:"transform"`          // Anchor pose in world coordinates
+	Platform  string       `json:"platform,omitempty"` // webxr, arkit, arcore
+	CloudID   string       `json:"cloud_id,omitempty"` // Provider cloud anchor for relocalization
+	CreatedBy string       `json:"created_by"`
+	CreatedAt time.Time    `json:"created_at"`
+	ExpiresAt *time.Time   `json:"expires_at,omitempty"`
+}
+
+// Validate checks an anchor before it is stored
+func (a *Anchor) Validate() error {
+	if !idPattern.MatchString(a.ID) {
+		return fmt.Errorf("id must match %s", idPattern)
+	}
+	if !idPattern.MatchString(a.World) {
+		return fmt.Errorf("world must match %s", idPattern)
+	}
+	switch a.Scope {
+	case ScopeSession, ScopePersistent:
+	default:
+		return fmt.Errorf("scope must be %s or %s", ScopeSession, ScopePersistent)
+	}
+	if len(a.Platform) > 32 {
+		return fmt.Errorf("platform too long")
+	}
+	if len(a.CloudID) > 256 {
+		return fmt.Errorf("cloud_id too long")
+	}
+	if a.Scope == ScopeSession && a.CreatedBy == "" {
+		return fmt.Errorf("session anchors require an X-HD1-ID client")
+	}
+	return nil
+}
+
+func (a *Anchor) expired(now time.Time) bool {
+	return a.ExpiresAt != nil && !now.Before(*a.ExpiresAt)
+}
+
+// NewID generates an anchor ID
+func NewID() string {
+	return "anchor-" + uuid.New().String()
+}
+
+var (
+	anchors = make(map[string]*Anchor)
+	mutex   sync.RWMutex
+)
+
+func storageKey(a *Anchor) (string, error) {
+	return storage.Key(storage.NamespaceWorlds, a.World+"/anchors/"+a.ID+".json")
+}
+
+// Initialize loads persistent anchors from the storage backend
+func Initialize(ctx context.Context) error {
+	backend := storage.Default()
+	if backend == nil {
+		return fmt.Errorf("storage backend unavailable")
+	}
+	objects, err := backend.List(ctx, storage.NamespaceWorlds+"/")
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	loaded := 0
+	for _, object := range objects {
+		if !strings.Contains(object.Key, "/anchors/") || !strings.HasSuffix(object.Key, ".json") {
+			continue
+		}
+		body, _, err := backend.Get(ctx, object.Key)
+		if err != nil {
+			continue
+		}
+		var anchor Anchor
+		err = json.NewDecoder(body).Decode(&anchor)
+		body.Close()
+		if err != nil || anchor.Validate() != nil {
+			logging.Warn("skipping unreadable anchor", map[string]interface{}{"key": object.Key})
+			continue
+		}
+		if anchor.expired(now) {
+			backend.Delete(ctx, object.Key)
+			continue
+		}
+		mutex.Lock()
+		anchors[anchor.ID] = &anchor
+		mutex.Unlock()
+		loaded++
+	}
+
+	logging.Info("persistent anchors loaded", map[string]interface{}{
+		"anchors": loaded,
+	})
+	return nil
+}
+
+// Create stores a new anchor
+func Create(ctx context.Context, anchor *Anchor) error {
+	if err := anchor.Validate(); err != nil {
+		return err
+	}
+	anchor.Transform = anchor.Transform.Normalize()
+
+	mutex.Lock()
+	if existing, ok := anchors[anchor.ID]; ok && !existing.expired(time.Now()) {
+		mutex.Unlock()
+		return ErrExists
+	}
+	anchors[anchor.ID] = anchor
+	mutex.Unlock()
+
+	if anchor.Scope == ScopePersistent {
+		if err := persist(ctx, anchor); err != nil {
+			mutex.Lock()
+			delete(anchors, anchor.ID)
+			mutex.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+func persist(ctx context.Context, anchor *Anchor) error {
+	backend := storage.Default()
+	if backend == nil {
+		return fmt.Errorf("storage backend unavailable")
+	}
+	key, err := storageKey(anchor)
+	if err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(anchor)
+	if err != nil {
+		return err
+	}
+	return backend.Put(ctx, key, bytes.NewReader(encoded), int64(len(encoded)), "application/json")
+}
+
+// Get returns an anchor by ID
+func Get(id string) (*Anchor, error) {
+	mutex.RLock()
+	anchor, ok := anchors[id]
+	mutex.RUnlock()
+	if !ok || anchor.expired(time.Now()) {
+		return nil, ErrNotFound
+	}
+	return anchor, nil
+}
+
+// List returns the live anchors of a world, or of all worlds if world is empty
+func List(world string) []*Anchor {
+	now := time.Now()
+	mutex.RLock()
+	result := make([]*Anchor, 0, len(anchors))
+	for _, anchor := range anchors {
+		if (world == "" || anchor.World == world) && !anchor.expired(now) {
+			result = append(result, anchor)
+		}
+	}
+	mutex.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result
+}
+
+// Delete removes an anchor and its persisted copy
+func Delete(ctx context.Context, id string) (*Anchor, error) {
+	mutex.Lock()
+	anchor, ok := anchors[id]
+	delete(anchors, id)
+	mutex.Unlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if anchor.Scope == ScopePersistent {
+		if backend := storage.Default(); backend != nil {
+			if key, err := storageKey(anchor); err == nil {
+				if err := backend.Delete(ctx, key); err != nil && err != storage.ErrNotFound {
+					return anchor, err
+				}
+			}
+		}
+	}
+	return anchor, nil
+}
+
+// ReleaseSession removes the session anchors created by a disconnecting client
+func ReleaseSession(clientID string) []*Anchor {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	var released []*Anchor
+	for id, anchor := range anchors {
+		if anchor.Scope == ScopeSession && anchor.CreatedBy == clientID {
+			released = append(released, anchor)
+			delete(anchors, id)
+		}
+	}
+	return released
+}
+
+// Resolve returns the transform mapping a client's local AR space onto the
+// world, given where the client observes the anchor locally
+func Resolve(anchor *Anchor, local xr.Transform) xr.Transform {
+	return anchor.Transform.Compose(local.Normalize().Inverse())
+}
@@ -0,0 +1,80 @@
+package accessibility
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	a11y "holodeck1/accessibility"
+	"holodeck1/api/shared"
+)
+
+// maxDescriptions bounds one page of GET /accessibility/descriptions
+const maxDescriptions = 500
+
+// GetWorldView handles GET /api/accessibility/world
+func GetWorldView(w http.ResponseWriter, r *http.Request) {
+	hub := shared.GetHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	viewer := r.URL.Query().Get("viewer")
+	if viewer == "" {
+		viewer = shared.Context(r).Session
+	}
+	view := a11y.NewView(a11y.Replay(hub.GetSync().GetAllOperations()), viewer)
+
+	switch r.URL.Query().Get("format") {
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(view.Text()))
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"view":    view,
+		})
+	default:
+		http.Error(w, "format must be text or json", http.StatusBadRequest)
+	}
+}
+
+// GetDescriptions handles GET /api/accessibility/descriptions
+func GetDescriptions(w http.ResponseWriter, r *http.Request) {
+	hub := shared.GetHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var from uint64
+	if value := r.URL.Query().Get("from"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid from parameter", http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxDescriptions {
+			http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	sync := hub.GetSync()
+	descriptions := a11y.Describe(sync.GetAllOperations(), from, limit)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":          true,
+		"descriptions":     descriptions,
+		"current_sequence": sync.GetCurrentSequence(),
+	})
+}
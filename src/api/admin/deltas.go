@@ -0,0 +1,270 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"holodeck1/api/shared"
+	"holodeck1/logging"
+	"holodeck1/server"
+	"holodeck1/sync"
+	"holodeck1/worlds"
+)
+
+// Default and largest page of deltas
+const (
+	defaultDeltaLimit = 100
+	maxDeltaLimit     = 1000
+)
+
+// DeltaFilter selects deltas from the operation log. Zero fields match
+// everything; After is the last sequence number of the previous page.
+type DeltaFilter struct {
+	ClientID string
+	Type     string
+	Since    time.Time
+	Until    time.Time
+	After    uint64
+	Limit    int
+}
+
+// matches reports whether an operation passes the filter, ignoring paging
+func (f *DeltaFilter) matches(op *sync.Operation) bool {
+	if f.ClientID != "" && op.ClientID != f.ClientID {
+		return false
+	}
+	if f.Type != "" && op.Type != f.Type {
+		return false
+	}
+	if !f.Since.IsZero() && op.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !op.Timestamp.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// RevertResponse reports a reverted delta
+type RevertResponse struct {
+	Success    bool            `json:"success"`
+	Reverted   *sync.Operation `json:"reverted"`
+	Diff       *worlds.Diff    `json:"diff"`
+	Operations []uint64        `json:"operations"` // Sequence numbers of the undoing operations
+}
+
+// adminHub returns the hub of an admin request; the router admits only
+// operators (x-auth: operator)
+func adminHub(w http.ResponseWriter, r *http.Request) (*server.Hub, bool) {
+	hub := shared.GetHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return hub, true
+}
+
+// parseFilter reads the delta filter from the query string
+func parseFilter(r *http.Request) (*DeltaFilter, string) {
+	query := r.URL.Query()
+	filter := &DeltaFilter{
+		ClientID: query.Get("client"),
+		Type:     query.Get("type"),
+		Limit:    defaultDeltaLimit,
+	}
+	for name, field := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, name + " must be an RFC 3339 time"
+			}
+			*field = parsed
+		}
+	}
+	if value := query.Get("after"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, "after must be a sequence number"
+		}
+		filter.After = parsed
+	}
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxDeltaLimit {
+			return nil, "limit must be between 1 and " + strconv.Itoa(maxDeltaLimit)
+		}
+		filter.Limit = parsed
+	}
+	return filter, ""
+}
+
+// deltaFromPath returns the stored operation named by {seqNum}, writing
+// 400 or 404 when there is none
+func deltaFromPath(w http.ResponseWriter, r *http.Request, hub *server.Hub) (*sync.Operation, bool) {
+	seqNum, err := strconv.ParseUint(mux.Vars(r)["seqNum"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid sequence number", http.StatusBadRequest)
+		return nil, false
+	}
+	op, exists := hub.GetSync().GetOperation(seqNum)
+	if !exists {
+		http.Error(w, "Delta not found", http.StatusNotFound)
+		return nil, false
+	}
+	return op, true
+}
+
+// ListDeltas handles GET /api/admin/sync/deltas?client=&type=&since=&until=&after=&limit=
+func ListDeltas(w http.ResponseWriter, r *http.Request) {
+	hub, ok := adminHub(w, r)
+	if !ok {
+		return
+	}
+	filter, problem := parseFilter(r)
+	if filter == nil {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
+
+	current := hub.GetSync().GetCurrentSequence()
+	deltas := []*sync.Operation{}
+	var next interface{}
+	for _, op := range hub.GetSync().GetOperationsInRange(filter.After+1, current) {
+		if !filter.matches(op) {
+			continue
+		}
+		if len(deltas) == filter.Limit {
+			next = deltas[len(deltas)-1].SeqNum
+			break
+		}
+		deltas = append(deltas, op)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"deltas":      deltas,
+		"next":        next, // Pass as after for the next page; null on the last
+		"current_seq": current,
+	})
+}
+
+// GetDelta handles GET /api/admin/sync/deltas/{seqNum}
+func GetDelta(w http.ResponseWriter, r *http.Request) {
+	hub, ok := adminHub(w, r)
+	if !ok {
+		return
+	}
+	op, ok := deltaFromPath(w, r, hub)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"delta":   op,
+	})
+}
+
+// RebroadcastDelta handles POST /api/admin/sync/deltas/{seqNum}/rebroadcast
+func RebroadcastDelta(w http.ResponseWriter, r *http.Request) {
+	hub, ok := adminHub(w, r)
+	if !ok {
+		return
+	}
+	op, ok := deltaFromPath(w, r, hub)
+	if !ok {
+		return
+	}
+	hub.GetSync().Rebroadcast(op.SeqNum)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"delta":   op,
+		"clients": hub.GetClientCount(),
+	})
+
+	logging.Info("delta rebroadcast by operator", map[string]interface{}{
+		"seq_num":   op.SeqNum,
+		"type":      op.Type,
+		"operator":  shared.GetClientID(r),
+		"remote_ip": shared.GetClientIP(r),
+	})
+}
+
+// RevertDelta handles POST /api/admin/sync/deltas/{seqNum}/revert
+func RevertDelta(w http.ResponseWriter, r *http.Request) {
+	hub, ok := adminHub(w, r)
+	if !ok {
+		return
+	}
+	op, ok := deltaFromPath(w, r, hub)
+	if !ok {
+		return
+	}
+
+	shared.RestoreMutex.Lock()
+	defer shared.RestoreMutex.Unlock()
+
+	// Undo the delta on top of everything that happened since
+	log := hub.GetFullSync()
+	var before, target *worlds.State
+	current, err := worlds.Replay(log)
+	if err == nil {
+		before, err = worlds.Replay(operationsBefore(log, op.SeqNum))
+	}
+	if err == nil {
+		target, err = worlds.Revert(before, current, op)
+	}
+	switch err {
+	case nil:
+	case worlds.ErrTruncatedLog:
+		http.Error(w, "Operation log truncated, world state unavailable", http.StatusConflict)
+		return
+	case worlds.ErrRevertConflict:
+		http.Error(w, "Delta conflicts with later changes", http.StatusConflict)
+		return
+	default:
+		http.Error(w, "Delta cannot be reverted: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	clientID := shared.GetClientID(r)
+	operations := worlds.Restore(current, target)
+	shared.SubmitRestore(hub, operations, clientID)
+	seqNums := make([]uint64, len(operations))
+	for i, operation := range operations {
+		seqNums[i] = operation.SeqNum
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RevertResponse{
+		Success:    true,
+		Reverted:   op,
+		Diff:       worlds.Compare(current, target),
+		Operations: seqNums,
+	})
+
+	logging.Info("delta reverted by operator", map[string]interface{}{
+		"seq_num":    op.SeqNum,
+		"type":       op.Type,
+		"operations": len(operations),
+		"operator":   clientID,
+		"remote_ip":  shared.GetClientIP(r),
+	})
+}
+
+// operationsBefore returns the prefix of a log ending just before seqNum
+func operationsBefore(log []*sync.Operation, seqNum uint64) []*sync.Operation {
+	for i, op := range log {
+		if op.SeqNum >= seqNum {
+			return log[:i]
+		}
+	}
+	return log
+}
@@ -0,0 +1,195 @@
+package anchors
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"holodeck1/anchors"
+	"holodeck1/api/shared"
+	"holodeck1/config"
+	"holodeck1/logging"
+	"holodeck1/sync"
+	"holodeck1/xr"
+)
+
+// maxAnchorTTL bounds expires_in
+const maxAnchorTTL = 30 * 24 * time.Hour
+
+// CreateAnchorRequest describes a new anchor
+type CreateAnchorRequest struct {
+	ID        string       `json:"id,omitempty"`
+	World     string       `json:"world,omitempty"`
+	Scope     string       `json:"scope"`
+	Transform xr.Transform `json:"transform"`
+	Platform  string       `json:"platform,omitempty"`
+	CloudID   string       `json:"cloud_id,omitempty"`
+	ExpiresIn int64        `json:"expires_in,omitempty"` // seconds, 0 never expires
+}
+
+// ResolveAnchorRequest carries the anchor pose observed in the client's local AR space
+type ResolveAnchorRequest struct {
+	Local *xr.Transform `json:"local,omitempty"`
+}
+
+// CreateAnchor handles POST /api/anchors
+func CreateAnchor(w http.ResponseWriter, r *http.Request) {
+	var req CreateAnchorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	hub := shared.GetHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if req.ID == "" {
+		req.ID = anchors.NewID()
+	}
+	if req.World == "" {
+		req.World = config.GetWorldsDefaultWorld()
+	}
+	if req.Scope == "" {
+		req.Scope = anchors.ScopeSession
+	}
+	if req.ExpiresIn < 0 || time.Duration(req.ExpiresIn)*time.Second > maxAnchorTTL {
+		http.Error(w, "expires_in must be between 0 and 2592000 seconds", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	anchor := &anchors.Anchor{
+		ID:        req.ID,
+		World:     req.World,
+		Scope:     req.Scope,
+		Transform: req.Transform,
+		Platform:  req.Platform,
+		CloudID:   req.CloudID,
+		CreatedBy: shared.Context(r).Session,
+		CreatedAt: now,
+	}
+	if req.ExpiresIn > 0 {
+		expiresAt := now.Add(time.Duration(req.ExpiresIn) * time.Second)
+		anchor.ExpiresAt = &expiresAt
+	}
+
+	if err := anchors.Create(r.Context(), anchor); err == anchors.ErrExists {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hub.GetSync().SubmitOperation(&sync.Operation{
+		ClientID:  shared.GetClientID(r),
+		Type:      sync.OpAnchorCreate,
+		Data:      map[string]interface{}{"anchor": anchor},
+		Timestamp: time.Now(),
+	})
+
+	logging.Info("anchor created", map[string]interface{}{
+		"anchor_id": anchor.ID,
+		"world":     anchor.World,
+		"scope":     anchor.Scope,
+		"platform":  anchor.Platform,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"anchor":  anchor,
+	})
+}
+
+// ListAnchors handles GET /api/anchors
+func ListAnchors(w http.ResponseWriter, r *http.Request) {
+	list := anchors.List(r.URL.Query().Get("world"))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"anchors": list,
+		"count":   len(list),
+	})
+}
+
+// GetAnchor handles GET /api/anchors/{anchorId}
+func GetAnchor(w http.ResponseWriter, r *http.Request) {
+	anchor, err := anchors.Get(mux.Vars(r)["anchorId"])
+	if err != nil {
+		http.Error(w, "Anchor not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"anchor":  anchor,
+	})
+}
+
+// ResolveAnchor handles POST /api/anchors/{anchorId}/resolve
+func ResolveAnchor(w http.ResponseWriter, r *http.Request) {
+	anchor, err := anchors.Get(mux.Vars(r)["anchorId"])
+	if err != nil {
+		http.Error(w, "Anchor not found", http.StatusNotFound)
+		return
+	}
+
+	var req ResolveAnchorRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+
+	response := map[string]interface{}{
+		"success": true,
+		"anchor":  anchor,
+	}
+	// Without a local observation the client only learns the anchor pose
+	if req.Local != nil {
+		response["alignment"] = anchors.Resolve(anchor, *req.Local)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// DeleteAnchor handles DELETE /api/anchors/{anchorId}
+func DeleteAnchor(w http.ResponseWriter, r *http.Request) {
+	hub := shared.GetHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	anchor, err := anchors.Delete(r.Context(), mux.Vars(r)["anchorId"])
+	if err == anchors.ErrNotFound {
+		http.Error(w, "Anchor not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	hub.GetSync().SubmitOperation(&sync.Operation{
+		ClientID:  shared.GetClientID(r),
+		Type:      sync.OpAnchorDelete,
+		Data:      map[string]interface{}{"id": anchor.ID, "world": anchor.World},
+		Timestamp: time.Now(),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"id":      anchor.ID,
+	})
+}
@@ -24,7 +24,7 @@ func CreateKeyframeAnimation(w http.ResponseWriter, r *http.Request) {
 	// Create sync operation
 	operation := &sync.Operation{
 		ClientID:  clientID,
-		Type:      "animation_create",
+		Type:      sync.OpAnimationCreate,
 		Data: map[string]interface{}{
 			"animation_id": animationID,
 			"target":       getString(req, "target", ""),
@@ -81,7 +81,7 @@ func ControlTimeline(w http.ResponseWriter, r *http.Request) {
 	// Create sync operation
 	operation := &sync.Operation{
 		ClientID:  clientID,
-		Type:      "animation_control",
+		Type:      sync.OpAnimationControl,
 		Data: map[string]interface{}{
 			"action": action,
 			"speed":  speed,
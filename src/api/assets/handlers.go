@@ -0,0 +1,366 @@
+package assets
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"holodeck1/api/shared"
+	"holodeck1/assets"
+	"holodeck1/config"
+	"holodeck1/logging"
+	"holodeck1/storage"
+)
+
+// UploadAssetResponse reports the stored blob
+type UploadAssetResponse struct {
+	Success      bool               `json:"success"`
+	Deduplicated bool               `json:"deduplicated"`
+	Optimizing   bool               `json:"optimizing"`
+	Tiling       bool               `json:"tiling"` // Point clouds are tiled for streaming
+	Asset        *assets.Blob       `json:"asset"`
+	Quarantine   *assets.Quarantine `json:"quarantine,omitempty"` // Why the upload scan flagged the asset
+}
+
+// GarbageCollectRequest controls a manual GC run
+type GarbageCollectRequest struct {
+	DryRun bool `json:"dry_run"`
+}
+
+// UploadAsset handles POST /api/assets
+func UploadAsset(w http.ResponseWriter, r *http.Request) {
+	backend := storage.Default()
+	if backend == nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	maxSize := config.GetAssetsMaxUploadSize()
+	if r.ContentLength > maxSize {
+		http.Error(w, "Asset too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Images are classified under the policy of the uploader's session's
+	// organization, not one it names by header
+	blob, deduplicated, err := assets.Upload(r.Context(), backend, r.Body, maxSize, r.Header.Get("Content-Type"), shared.GetClientID(r), shared.Context(r).PolicyOrg())
+	if errors.Is(err, assets.ErrRejected) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status := http.StatusCreated
+	if deduplicated {
+		status = http.StatusOK
+	}
+
+	// Quarantined uploads are processed once an operator releases them
+	var quarantine *assets.Quarantine
+	optimizing, tiling := false, false
+	if blob.Quarantined {
+		quarantine, _ = assets.LoadQuarantine(r.Context(), backend, blob.Digest)
+	} else {
+		optimizing, tiling = process(r, backend, blob, shared.GetOrgID(r))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(UploadAssetResponse{
+		Success:      true,
+		Deduplicated: deduplicated,
+		Optimizing:   optimizing,
+		Tiling:       tiling,
+		Asset:        blob,
+		Quarantine:   quarantine,
+	})
+
+	logging.Info("asset uploaded via API", map[string]interface{}{
+		"digest":       blob.Digest,
+		"size":         blob.Size,
+		"deduplicated": deduplicated,
+		"quarantined":  blob.Quarantined,
+		"hd1_id":       shared.GetClientID(r),
+	})
+}
+
+// process queues the background work an asset gets once it may be served:
+// GLB uploads get optimized variants when the organization has the
+// pipeline enabled, point clouds are tiled
+func process(r *http.Request, backend storage.Backend, blob *assets.Blob, org string) (optimizing, tiling bool) {
+	if manifest, _ := assets.LoadManifest(r.Context(), backend, blob.Digest); manifest == nil {
+		optimizing = assets.Enqueue(blob, org)
+	}
+	if cloud, _ := assets.LoadPointCloud(r.Context(), backend, blob.Digest); cloud == nil || cloud.Status == assets.StatusFailed {
+		tiling = assets.EnqueuePointCloud(r.Context(), backend, blob)
+	}
+	return optimizing, tiling
+}
+
+// GetAsset handles GET /api/assets/{digest} by redirecting to a signed URL.
+// Clients listing capabilities (draco, meshopt, ktx2) in X-HD1-Capabilities
+// or ?capabilities= receive the best optimized variant they can decode.
+func GetAsset(w http.ResponseWriter, r *http.Request) {
+	digest := mux.Vars(r)["digest"]
+	key, err := assets.BlobKey(digest)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	backend := storage.Default()
+	if backend == nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if _, err := backend.Stat(r.Context(), key); err == storage.ErrNotFound {
+		http.Error(w, "Asset not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if quarantine, err := assets.LoadQuarantine(r.Context(), backend, digest); err != nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	} else if quarantine != nil {
+		http.Error(w, "Asset is quarantined", http.StatusForbidden)
+		return
+	}
+
+	// Explicit capabilities win; otherwise use the profile the client
+	// negotiated over its WebSocket connection
+	capabilities := r.Header.Get("X-HD1-Capabilities")
+	if query := r.URL.Query().Get("capabilities"); query != "" {
+		capabilities = query
+	}
+	maxTextureSize := 0
+	if hd1ID := shared.Context(r).Session; hd1ID != "" {
+		if hub := shared.GetHubFromContext(r); hub != nil {
+			if profile, ok := hub.GetClientProfile(hd1ID); ok {
+				if capabilities == "" {
+					capabilities = profile.Capabilities()
+				}
+				maxTextureSize = profile.MaxTextureSize
+			}
+		}
+	}
+	w.Header().Set("Vary", "X-HD1-Capabilities, X-HD1-ID")
+	w.Header().Set("X-HD1-Asset-Variant", "source")
+	if capabilities != "" || maxTextureSize > 0 {
+		manifest, _ := assets.LoadManifest(r.Context(), backend, digest)
+		if variant := manifest.SelectVariant(assets.ParseCapabilities(capabilities), maxTextureSize); variant != nil {
+			if variantKey, err := assets.BlobKey(variant.Digest); err == nil {
+				key = variantKey
+				w.Header().Set("X-HD1-Asset-Variant", variant.Label())
+			}
+		}
+	}
+
+	url, err := backend.SignedURL(key, http.MethodGet, config.GetStorageSignedURLTTL())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Content never changes for a digest, so the redirect target is the only thing that expires
+	w.Header().Set("Cache-Control", "private, max-age=60")
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// GetOrphanAssets handles GET /api/assets/orphans
+func GetOrphanAssets(w http.ResponseWriter, r *http.Request) {
+	// Without the operation log every entity reference would look missing
+	hub := shared.GetHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	backend := storage.Default()
+	if backend == nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	report, err := assets.FindOrphans(r.Context(), backend, hub.GetSync().PeekAllOperations(), config.GetAssetsGCGracePeriod())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"report":  report,
+	})
+}
+
+// CollectAssetGarbage handles POST /api/assets/gc
+func CollectAssetGarbage(w http.ResponseWriter, r *http.Request) {
+	var req GarbageCollectRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+
+	hub := shared.GetHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	backend := storage.Default()
+	if backend == nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	report, err := assets.CollectGarbage(r.Context(), backend, hub.GetSync().PeekAllOperations(), config.GetAssetsGCGracePeriod(), req.DryRun)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"dry_run": req.DryRun,
+		"report":  report,
+	})
+}
+
+// GetAssetVariants handles GET /api/assets/{digest}/variants
+func GetAssetVariants(w http.ResponseWriter, r *http.Request) {
+	digest := mux.Vars(r)["digest"]
+	if !assets.ValidDigest(digest) {
+		http.Error(w, "Invalid asset digest", http.StatusBadRequest)
+		return
+	}
+
+	backend := storage.Default()
+	if backend == nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	manifest, err := assets.LoadManifest(r.Context(), backend, digest)
+	if err != nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if manifest == nil {
+		http.Error(w, "No optimized variants", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"manifest": manifest,
+	})
+}
+
+// GetAssetSettings handles GET /api/assets/settings for the caller's organization
+func GetAssetSettings(w http.ResponseWriter, r *http.Request) {
+	backend := storage.Default()
+	if backend == nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	org := shared.GetOrgID(r)
+	settings, err := assets.LoadSettings(r.Context(), backend, org)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":          true,
+		"org":              org,
+		"pipeline_enabled": config.GetAssetsPipelineEnabled(),
+		"settings":         settings,
+	})
+}
+
+// UpdateAssetSettings handles PUT /api/assets/settings for the caller's organization
+func UpdateAssetSettings(w http.ResponseWriter, r *http.Request) {
+	backend := storage.Default()
+	if backend == nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	org := shared.GetOrgID(r)
+	settings, err := assets.LoadSettings(r.Context(), backend, org)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Decode over current settings so partial updates keep other fields
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := assets.SaveSettings(r.Context(), backend, org, settings); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"org":      org,
+		"settings": settings,
+	})
+
+	logging.Info("asset pipeline settings updated", map[string]interface{}{
+		"org":      org,
+		"enabled":  settings.Enabled,
+		"geometry": settings.Geometry,
+		"textures": settings.Textures,
+	})
+}
+
+// GetPointCloud handles GET /api/assets/{digest}/pointcloud, describing the
+// octree tiles a point cloud asset streams as
+func GetPointCloud(w http.ResponseWriter, r *http.Request) {
+	digest := mux.Vars(r)["digest"]
+	if !assets.ValidDigest(digest) {
+		http.Error(w, "Invalid asset digest", http.StatusBadRequest)
+		return
+	}
+
+	backend := storage.Default()
+	if backend == nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	cloud, err := assets.LoadPointCloud(r.Context(), backend, digest)
+	if err != nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if cloud == nil {
+		http.Error(w, "Not a point cloud", http.StatusNotFound)
+		return
+	}
+
+	// Tiles never change once the cloud is ready
+	if cloud.Status == assets.StatusReady {
+		w.Header().Set("Cache-Control", "private, max-age=3600")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"pointcloud": cloud,
+	})
+}
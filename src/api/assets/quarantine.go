@@ -0,0 +1,123 @@
+package assets
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"holodeck1/api/shared"
+	"holodeck1/assets"
+	"holodeck1/config"
+	"holodeck1/logging"
+	"holodeck1/storage"
+)
+
+// ListQuarantinedAssets handles GET /api/assets/quarantine
+func ListQuarantinedAssets(w http.ResponseWriter, r *http.Request) {
+	backend := storage.Default()
+	if backend == nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	records, err := assets.ListQuarantine(r.Context(), backend)
+	if err != nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":      true,
+		"scan_backend": config.GetAssetsScanBackend(),
+		"quarantine":   records,
+	})
+}
+
+// ReleaseQuarantinedAsset handles POST /api/assets/quarantine/{digest}/release,
+// serving the asset again and queueing the processing it skipped
+func ReleaseQuarantinedAsset(w http.ResponseWriter, r *http.Request) {
+	digest := mux.Vars(r)["digest"]
+	if !assets.ValidDigest(digest) {
+		http.Error(w, "Invalid asset digest", http.StatusBadRequest)
+		return
+	}
+
+	backend := storage.Default()
+	if backend == nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	record, err := assets.Release(r.Context(), backend, digest)
+	if err == assets.ErrNotQuarantined {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	key, _ := assets.BlobKey(digest)
+	blob := &assets.Blob{
+		Digest:      digest,
+		Ref:         assets.RefPrefix + digest,
+		Key:         key,
+		Size:        record.Size,
+		ContentType: record.ContentType,
+		Format:      record.Format,
+	}
+	optimizing, tiling := process(r, backend, blob, record.Org)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"released":   record,
+		"optimizing": optimizing,
+		"tiling":     tiling,
+	})
+
+	logging.Warn("quarantined asset released", map[string]interface{}{
+		"digest":    digest,
+		"signature": record.Signature,
+		"error":     record.Error,
+		"hd1_id":    shared.GetClientID(r),
+	})
+}
+
+// DiscardQuarantinedAsset handles DELETE /api/assets/quarantine/{digest},
+// deleting the blob
+func DiscardQuarantinedAsset(w http.ResponseWriter, r *http.Request) {
+	digest := mux.Vars(r)["digest"]
+	if !assets.ValidDigest(digest) {
+		http.Error(w, "Invalid asset digest", http.StatusBadRequest)
+		return
+	}
+
+	backend := storage.Default()
+	if backend == nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	record, err := assets.Discard(r.Context(), backend, digest)
+	if err == assets.ErrNotQuarantined {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"discarded": record,
+	})
+
+	logging.Info("quarantined asset discarded", map[string]interface{}{
+		"digest":    digest,
+		"signature": record.Signature,
+		"hd1_id":    shared.GetClientID(r),
+	})
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/gorilla/mux"
 	"holodeck1/api/shared"
 	"holodeck1/logging"
+	"holodeck1/movement"
+	"holodeck1/portals"
 	"holodeck1/sync"
 )
 
@@ -21,8 +23,10 @@ type MoveAvatarRequest struct {
 
 // MoveAvatarResponse represents the response after moving an avatar
 type MoveAvatarResponse struct {
-	Success bool   `json:"success"`
-	SeqNum  uint64 `json:"seq_num"`
+	Success  bool            `json:"success"`
+	SeqNum   uint64          `json:"seq_num"`
+	Clamped  bool            `json:"clamped,omitempty"`  // The move was shortened to the movement limits
+	Position *shared.Vector3 `json:"position,omitempty"` // Where the avatar went, when clamped
 }
 
 // GetAvatars handles GET /api/threejs/avatars
@@ -64,6 +68,9 @@ func CreateAvatar(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
+	if shared.RefuseBanned(w, r) || shared.RefuseSpectator(w, r) {
+		return
+	}
 
 	// Get client ID
 	clientID := shared.GetClientID(r)
@@ -82,7 +89,7 @@ func CreateAvatar(w http.ResponseWriter, r *http.Request) {
 	// Create operation
 	operation := &sync.Operation{
 		ClientID:  clientID,
-		Type:      "avatar_create",
+		Type:      sync.OpAvatarCreate,
 		Data:      operationData,
 		Timestamp: time.Now(),
 	}
@@ -123,6 +130,9 @@ func UpdateAvatar(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Avatar ID required", http.StatusBadRequest)
 		return
 	}
+	if shared.RefuseSpectator(w, r) {
+		return
+	}
 
 	var req struct {
 		Position  *shared.Vector3 `json:"position,omitempty"`
@@ -184,7 +194,7 @@ func UpdateAvatar(w http.ResponseWriter, r *http.Request) {
 	// Create operation
 	operation := &sync.Operation{
 		ClientID:  clientID,
-		Type:      "avatar_update",
+		Type:      sync.OpAvatarUpdate,
 		Data:      operationData,
 		Timestamp: time.Now(),
 	}
@@ -216,6 +226,9 @@ func RemoveAvatar(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Avatar ID required", http.StatusBadRequest)
 		return
 	}
+	if shared.RefuseSpectator(w, r) {
+		return
+	}
 
 	// Get client ID
 	clientID := shared.GetClientID(r)
@@ -228,7 +241,7 @@ func RemoveAvatar(w http.ResponseWriter, r *http.Request) {
 	// Create operation
 	operation := &sync.Operation{
 		ClientID:  clientID,
-		Type:      "avatar_remove",
+		Type:      sync.OpAvatarRemove,
 		Data:      operationData,
 		Timestamp: time.Now(),
 	}
@@ -241,6 +254,8 @@ func RemoveAvatar(w http.ResponseWriter, r *http.Request) {
 	}
 
 	hub.GetSync().SubmitOperation(operation)
+	movement.Forget(avatarID)
+	portals.Forget(avatarID)
 
 	// Return response
 	response := map[string]interface{}{
@@ -267,6 +282,9 @@ func MoveAvatar(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Session ID required", http.StatusBadRequest)
 		return
 	}
+	if shared.RefuseSpectator(w, r) {
+		return
+	}
 
 	var req MoveAvatarRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -290,6 +308,19 @@ func MoveAvatar(w http.ResponseWriter, r *http.Request) {
 	// Get client ID
 	clientID := shared.GetClientID(r)
 
+	// Get hub
+	hub := shared.GetHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Moves faster than the world allows are clamped or refused
+	clamped, ok := shared.CheckAvatarMove(w, hub, sessionID, &req.Position)
+	if !ok {
+		return
+	}
+
 	// Create operation data
 	operationData := map[string]interface{}{
 		"hd1_id":   sessionID,  // sessionID is actually the hd1_id
@@ -307,25 +338,23 @@ func MoveAvatar(w http.ResponseWriter, r *http.Request) {
 	// Create operation
 	operation := &sync.Operation{
 		ClientID:  clientID,
-		Type:      "avatar_move",
+		Type:      sync.OpAvatarMove,
 		Data:      operationData,
 		Timestamp: time.Now(),
 	}
 
-	// Get hub and submit operation
-	hub := shared.GetHubFromContext(r)
-	if hub == nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-
 	hub.GetSync().SubmitOperation(operation)
+	shared.EnterPortals(hub, sessionID, req.Position)
 
 	// Return response
 	response := MoveAvatarResponse{
 		Success: true,
 		SeqNum:  operation.SeqNum,
 	}
+	if clamped {
+		response.Clamped = true
+		response.Position = &req.Position
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
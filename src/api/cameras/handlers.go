@@ -20,7 +20,7 @@ func SetPerspectiveCamera(w http.ResponseWriter, r *http.Request) {
 
 	operation := &sync.Operation{
 		ClientID: getClientID(r),
-		Type:     "scene_update",
+		Type:     sync.OpSceneUpdate,
 		Data: map[string]interface{}{
 			"operation": "set_camera",
 			"camera": map[string]interface{}{
@@ -72,7 +72,7 @@ func SetOrthographicCamera(w http.ResponseWriter, r *http.Request) {
 
 	operation := &sync.Operation{
 		ClientID: getClientID(r),
-		Type:     "scene_update",
+		Type:     sync.OpSceneUpdate,
 		Data: map[string]interface{}{
 			"operation": "set_camera",
 			"camera": map[string]interface{}{
@@ -124,7 +124,7 @@ func getClientID(r *http.Request) string {
 		return clientID
 	}
 	// Fallback to remote address if no client ID header
-	return r.RemoteAddr
+	return shared.GetClientIP(r)
 }
 
 func getFloat(req map[string]interface{}, key string, defaultValue float64) float64 {
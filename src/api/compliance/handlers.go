@@ -0,0 +1,132 @@
+package compliance
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"holodeck1/api/shared"
+	"holodeck1/consent"
+	"holodeck1/holds"
+	"holodeck1/storage"
+)
+
+// PlaceHoldRequest describes a legal hold to place
+type PlaceHoldRequest struct {
+	Kind      string     `json:"kind"`
+	Resource  string     `json:"resource"`
+	Matter    string     `json:"matter"`
+	Reason    string     `json:"reason,omitempty"`
+	ReleaseAt *time.Time `json:"release_at,omitempty"`
+}
+
+// ListHolds handles GET /api/compliance/holds; ?released=true includes
+// released holds
+func ListHolds(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"holds":   holds.List(r.URL.Query().Get("released") == "true"),
+	})
+}
+
+// PlaceHold handles POST /api/compliance/holds
+func PlaceHold(w http.ResponseWriter, r *http.Request) {
+	var req PlaceHoldRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	hold := &holds.Hold{
+		ID:        holds.NewID(),
+		Kind:      req.Kind,
+		Resource:  req.Resource,
+		Matter:    req.Matter,
+		Reason:    req.Reason,
+		CreatedBy: shared.GetClientID(r),
+		CreatedAt: time.Now().UTC(),
+		ReleaseAt: req.ReleaseAt,
+	}
+	if err := hold.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if hold.ReleaseAt != nil && !hold.ReleaseAt.After(hold.CreatedAt) {
+		http.Error(w, "release_at must be in the future", http.StatusBadRequest)
+		return
+	}
+	if err := holds.Place(r.Context(), hold); err != nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"hold":    hold,
+	})
+}
+
+// ReleaseHold handles DELETE /api/compliance/holds/{holdId}. The hold is
+// kept, released, for compliance reports.
+func ReleaseHold(w http.ResponseWriter, r *http.Request) {
+	hold, err := holds.Release(r.Context(), mux.Vars(r)["holdId"], shared.GetClientID(r))
+	switch {
+	case err == holds.ErrNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err == holds.ErrReleased:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"hold":    hold,
+	})
+}
+
+// GetComplianceReport handles GET /api/compliance/report, summing up the
+// compliance records by record type
+func GetComplianceReport(w http.ResponseWriter, r *http.Request) {
+	backend := storage.Default()
+	if backend == nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	consentReport, _, err := consent.Compile(r.Context(), backend)
+	if err != nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	all := holds.List(true)
+	now := time.Now()
+	active := 0
+	for _, hold := range all {
+		if hold.Active(now) {
+			active++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":      true,
+		"generated_at": now.UTC(),
+		"records": map[string]interface{}{
+			consent.RecordType: consentReport,
+			holds.RecordType: map[string]interface{}{
+				"active":   active,
+				"released": len(all) - active,
+				"holds":    all,
+			},
+		},
+	})
+}
@@ -0,0 +1,67 @@
+package connectors
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"holodeck1/api/shared"
+	"holodeck1/connectors"
+	"holodeck1/logging"
+)
+
+// TestRequest picks the connector and event of a test; both are optional
+type TestRequest struct {
+	Connector string `json:"connector,omitempty"`
+	Event     string `json:"event,omitempty"`
+}
+
+// ListConnectors handles GET /api/connectors
+func ListConnectors(w http.ResponseWriter, r *http.Request) {
+	org := shared.GetOrgID(r)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"org":        org,
+		"capacity":   connectors.Capacity(org),
+		"events":     connectors.Events,
+		"connectors": connectors.List(org),
+	})
+}
+
+// TestConnectors handles POST /api/connectors/test, posting a sample event
+// to the caller's organization's connectors
+func TestConnectors(w http.ResponseWriter, r *http.Request) {
+	var req TestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	org := shared.GetOrgID(r)
+	results, err := connectors.Test(r.Context(), org, req.Connector, req.Event)
+	if errors.Is(err, connectors.ErrNotFound) {
+		http.Error(w, "Connector not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Invalid test: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	delivered := true
+	for _, result := range results {
+		delivered = delivered && result.Delivered
+	}
+	logging.Info("connectors tested", map[string]interface{}{
+		"org":        org,
+		"connectors": len(results),
+		"delivered":  delivered,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": delivered,
+		"results": results,
+	})
+}
@@ -0,0 +1,189 @@
+package consent
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"holodeck1/api/shared"
+	"holodeck1/consent"
+	"holodeck1/logging"
+	"holodeck1/storage"
+)
+
+// AcceptConsentRequest accepts documents at the versions shown; without a
+// token a new consent record is started
+type AcceptConsentRequest struct {
+	Token     string           `json:"token,omitempty"`
+	Documents []consent.Choice `json:"documents"`
+}
+
+// WithdrawConsentRequest withdraws accepted documents
+type WithdrawConsentRequest struct {
+	Token     string   `json:"token"`
+	Documents []string `json:"documents"`
+}
+
+func who(r *http.Request) consent.Who {
+	return consent.Who{
+		IP:    shared.GetClientIP(r),
+		HD1ID: shared.Context(r).Session,
+		Org:   shared.GetOrgID(r),
+	}
+}
+
+// standing is what a consent record holds accepted and what joining still
+// needs
+func standing(record *consent.Record) map[string]interface{} {
+	return map[string]interface{}{
+		"success":   true,
+		"documents": consent.Documents(),
+		"accepted":  record.Accepted,
+		"pending":   consent.Pending(record),
+	}
+}
+
+// GetConsent handles GET /api/consent, listing the documents and, given
+// ?token=, where its record stands on them
+func GetConsent(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":   true,
+			"documents": consent.Documents(),
+			"pending":   consent.Pending(nil),
+		})
+		return
+	}
+
+	backend := storage.Default()
+	if backend == nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	record, err := consent.Lookup(r.Context(), backend, token)
+	if err == consent.ErrInvalid {
+		http.Error(w, "Consent token invalid", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(standing(record))
+}
+
+// AcceptConsent handles POST /api/consent
+func AcceptConsent(w http.ResponseWriter, r *http.Request) {
+	var req AcceptConsentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(req.Documents) == 0 {
+		http.Error(w, "No documents to accept", http.StatusBadRequest)
+		return
+	}
+	backend := storage.Default()
+	if backend == nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	record, issued, err := consent.Accept(r.Context(), backend, req.Token, req.Documents, who(r))
+	switch {
+	case err == consent.ErrInvalid:
+		http.Error(w, "Consent token invalid", http.StatusNotFound)
+		return
+	case errors.Is(err, consent.ErrOutdated):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, consent.ErrUnknownDocument):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	response := standing(record)
+	if issued != "" {
+		response["token"] = issued
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+
+	choices := make([]string, 0, len(req.Documents))
+	for _, choice := range req.Documents {
+		choices = append(choices, choice.Document+"@"+choice.Version)
+	}
+	logging.Info("consent accepted", map[string]interface{}{
+		"consent_id": record.ID,
+		"documents":  choices,
+		"hd1_id":     shared.Context(r).Session,
+		"remote_ip":  shared.GetClientIP(r),
+	})
+}
+
+// WithdrawConsent handles POST /api/consent/withdraw
+func WithdrawConsent(w http.ResponseWriter, r *http.Request) {
+	var req WithdrawConsentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(req.Documents) == 0 {
+		http.Error(w, "No documents to withdraw", http.StatusBadRequest)
+		return
+	}
+	backend := storage.Default()
+	if backend == nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	record, err := consent.Withdraw(r.Context(), backend, req.Token, req.Documents, who(r))
+	if err == consent.ErrInvalid {
+		http.Error(w, "Consent token invalid", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(standing(record))
+
+	logging.Info("consent withdrawn", map[string]interface{}{
+		"consent_id": record.ID,
+		"documents":  req.Documents,
+		"remote_ip":  shared.GetClientIP(r),
+	})
+}
+
+// GetConsentReport handles GET /api/consent/report, counting where the
+// records stand on each document; ?records=true exports the records too
+func GetConsentReport(w http.ResponseWriter, r *http.Request) {
+	backend := storage.Default()
+	if backend == nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	report, records, err := consent.Compile(r.Context(), backend)
+	if err != nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	response := map[string]interface{}{
+		"success": true,
+		"report":  report,
+	}
+	if r.URL.Query().Get("records") == "true" {
+		response["records"] = records
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,83 @@
+package email
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"holodeck1/api/shared"
+	"holodeck1/email"
+	"holodeck1/logging"
+)
+
+// SendRequest fills a template for recipients
+type SendRequest struct {
+	Template string                 `json:"template"`
+	To       []string               `json:"to"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+}
+
+// ListTemplates handles GET /api/email/templates
+func ListTemplates(w http.ResponseWriter, r *http.Request) {
+	org := shared.GetOrgID(r)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"org":       org,
+		"enabled":   email.Enabled(org),
+		"templates": email.Templates(),
+	})
+}
+
+// SendMessage handles POST /api/email/messages, sending a templated message
+// on behalf of the caller's organization (X-HD1-Org)
+func SendMessage(w http.ResponseWriter, r *http.Request) {
+	var req SendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	org := shared.GetOrgID(r)
+	message, err := email.Templated(org, req.Template, req.To, req.Data)
+	if err == nil {
+		err = message.Validate()
+	}
+	if err != nil {
+		http.Error(w, "Invalid message: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = email.Send(r.Context(), message)
+	var limit *email.RateLimit
+	switch {
+	case errors.As(err, &limit):
+		w.Header().Set("Retry-After", strconv.Itoa(int(limit.RetryAfter.Seconds())+1))
+		http.Error(w, "Email rate limit reached", http.StatusTooManyRequests)
+		return
+	case err == email.ErrDisabled:
+		http.Error(w, "Email is not configured for this organization", http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		logging.Warn("email not sent", map[string]interface{}{
+			"org":      org,
+			"template": req.Template,
+			"error":    err.Error(),
+		})
+		http.Error(w, "Mail server refused the message", http.StatusBadGateway)
+		return
+	}
+
+	logging.Info("email sent", map[string]interface{}{
+		"org":        org,
+		"template":   req.Template,
+		"recipients": len(message.To),
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"subject":    message.Subject,
+		"recipients": message.To,
+	})
+}
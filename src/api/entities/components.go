@@ -0,0 +1,20 @@
+package entities
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"holodeck1/components"
+	"holodeck1/config"
+)
+
+// ListComponents handles GET /api/schema/components, the components
+// entities may hold and the JSON Schema of each
+func ListComponents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"components": components.List(),
+		"strict":     config.GetComponentsStrict(),
+	})
+}
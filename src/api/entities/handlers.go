@@ -8,9 +8,21 @@ import (
 
 	"github.com/gorilla/mux"
 	"holodeck1/api/shared"
+	"holodeck1/bindings"
+	"holodeck1/entityid"
+	"holodeck1/forms"
 	"holodeck1/logging"
+	"holodeck1/media"
+	"holodeck1/geo"
+	"holodeck1/moderation"
+	"holodeck1/panels"
+	"holodeck1/particles"
+	"holodeck1/pointclouds"
+	"holodeck1/portals"
 	"holodeck1/server"
 	"holodeck1/sync"
+	"holodeck1/throttle"
+	"holodeck1/whiteboard"
 )
 
 
@@ -42,12 +54,25 @@ type Material struct {
 	Opacity     float64 `json:"opacity,omitempty"`
 	Metalness   float64 `json:"metalness,omitempty"`
 	Roughness   float64 `json:"roughness,omitempty"`
+	Map         string  `json:"map,omitempty"` // Texture asset reference (sha256:<digest>)
 }
 
 // CreateEntityRequest represents the request to create an entity
 type CreateEntityRequest struct {
+	ID       string   `json:"id,omitempty"` // Suggested entity ID, server-issued when empty
 	Geometry Geometry `json:"geometry"`
 	Material Material `json:"material"`
+	Model    string   `json:"model,omitempty"` // GLB asset reference (sha256:<digest>)
+	Particles *particles.Emitter `json:"particles,omitempty"` // Particle emitter; geometry is optional with one
+	Panel     *panels.Panel      `json:"panel,omitempty"`     // Label, billboard or panel; geometry is optional with one
+	Media     *media.Media       `json:"media,omitempty"`     // Video screen; geometry is optional with one
+	Whiteboard *whiteboard.Board `json:"whiteboard,omitempty"` // Drawing surface; geometry is optional with one
+	Form      *forms.Form        `json:"form,omitempty"`      // Data entry card; geometry is optional with one
+	Portal    *portals.Portal    `json:"portal,omitempty"`    // Carries avatars stepping into it to a destination
+	PointCloud *pointclouds.PointCloud `json:"pointcloud,omitempty"` // Scanned points; geometry is optional with one
+	Terrain   *geo.Terrain       `json:"terrain,omitempty"`   // Map ground tile; geometry is optional with one
+	Bindings  bindings.Bindings  `json:"bindings,omitempty"`  // Properties derived from other entities
+	Components map[string]interface{} `json:"components,omitempty"` // Plugin components by name
 	Position *shared.Vector3 `json:"position,omitempty"`
 	Rotation *shared.Vector3 `json:"rotation,omitempty"`
 	Scale    *shared.Vector3 `json:"scale,omitempty"`
@@ -68,6 +93,16 @@ type UpdateEntityRequest struct {
 	Scale    *shared.Vector3  `json:"scale,omitempty"`
 	Visible  *bool     `json:"visible,omitempty"`
 	Material *Material `json:"material,omitempty"`
+	Particles *particles.Emitter `json:"particles,omitempty"` // Replaces the emitter and restarts it
+	Panel     *panels.Panel      `json:"panel,omitempty"`     // Replaces the panel
+	Media     *media.Media       `json:"media,omitempty"`     // Replaces the screen; control playback with /media
+	Whiteboard *whiteboard.Board `json:"whiteboard,omitempty"` // Replaces the board; draw with /whiteboard
+	Form      *forms.Form        `json:"form,omitempty"`      // Replaces the form; submissions are kept
+	Portal    *portals.Portal    `json:"portal,omitempty"`    // Replaces the portal
+	PointCloud *pointclouds.PointCloud `json:"pointcloud,omitempty"` // Replaces the point cloud
+	Terrain   *geo.Terrain       `json:"terrain,omitempty"`   // Replaces the ground tile
+	Bindings  bindings.Bindings  `json:"bindings,omitempty"`  // Replaces the bindings; {} removes them
+	Components map[string]interface{} `json:"components,omitempty"` // Replaces plugin components by name; null removes one
 }
 
 // UpdateEntityResponse represents the response after updating an entity
@@ -174,32 +209,172 @@ func CreateEntity(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate geometry
-	if err := validateGeometry(req.Geometry); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	// Pure particle emitters, panels, screens, whiteboards, forms, point
+	// clouds and terrain have no geometry or material
+	hasGeometry := (req.Particles == nil && req.Panel == nil && req.Media == nil && req.Whiteboard == nil && req.Form == nil && req.PointCloud == nil && req.Terrain == nil) || req.Geometry.Type != ""
+
+	if hasGeometry {
+		// Validate geometry
+		if err := ValidateGeometry(req.Geometry); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Validate material
+		if err := ValidateMaterial(req.Material); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Validate particles; the server fixes the seed and start time clients
+	// simulate from
+	alive := 0
+	if req.Particles != nil {
+		if err := req.Particles.Validate(); err != nil {
+			http.Error(w, "Invalid particles: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Particles.Start(time.Now())
+		alive = req.Particles.Alive()
+	}
+
+	// Validate and screen panel content
+	if req.Panel != nil {
+		if err := req.Panel.Layout(); err != nil {
+			http.Error(w, "Invalid panel: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !shared.ScreenPanel(w, r, req.Panel) {
+			return
+		}
+	}
+
+	// Validate media; the server fixes when its position was taken
+	if req.Media != nil {
+		if err := req.Media.Validate(); err != nil {
+			http.Error(w, "Invalid media: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Media.Start(time.Now())
+	}
+
+	// Validate whiteboard
+	if req.Whiteboard != nil {
+		if err := req.Whiteboard.Validate(); err != nil {
+			http.Error(w, "Invalid whiteboard: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Validate and screen form
+	if req.Form != nil && !shared.CheckForm(w, r, req.Form) {
+		return
+	}
+
+	// Validate portal destination
+	if req.Portal != nil && !shared.CheckPortal(w, r, req.Portal) {
+		return
+	}
+
+	// Validate bindings; the server evaluates them every tick
+	if req.Bindings != nil {
+		if err := req.Bindings.Validate(); err != nil {
+			http.Error(w, "Invalid bindings: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Validate point cloud; its source must be a tiled point cloud
+	if req.PointCloud != nil && !shared.CheckPointCloudSource(w, r, req.PointCloud) {
 		return
 	}
 
-	// Validate material
-	if err := validateMaterial(req.Material); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	// Validate terrain
+	if req.Terrain != nil {
+		if err := req.Terrain.Validate(); err != nil {
+			http.Error(w, "Invalid terrain: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Validate plugin components against their schemas
+	if !shared.CheckPluginComponents(w, req.Components) {
 		return
 	}
 
-	// Generate entity ID
-	entityID := generateEntityID()
+	// Text is shown to everyone in the world, so it is screened first
+	if req.Geometry.Type == "text" {
+		text, ok := shared.ScreenText(w, r, moderation.KindEntityText, req.Geometry.Text)
+		if !ok {
+			return
+		}
+		req.Geometry.Text = text
+	}
+
+	// Get hub before claiming an ID so a failure can't leak the claim
+	hub := shared.GetHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	// Get client ID
 	clientID := shared.GetClientID(r)
 
+	// Issue entity ID, or claim the suggested one
+	entityID, ok := shared.AllocateEntityID(w, req.ID, clientID)
+	if !ok {
+		return
+	}
+	// Segments are not exposed here, so the geometry costs its defaults
+	if !shared.AdmitEntity(w, r, entityID, req.Geometry.Type, map[string]interface{}{"text": req.Geometry.Text, "particles": alive}) {
+		return
+	}
+
 	// Create operation data
 	operationData := map[string]interface{}{
-		"id":       entityID,
-		"geometry": req.Geometry,
-		"material": req.Material,
+		"id": entityID,
+	}
+	if hasGeometry {
+		operationData["geometry"] = req.Geometry
+		operationData["material"] = req.Material
 	}
 
 	// Add optional properties
+	if req.Particles != nil {
+		operationData["particles"] = req.Particles
+	}
+	if req.Panel != nil {
+		operationData["panel"] = req.Panel
+	}
+	if req.Media != nil {
+		operationData["media"] = req.Media
+	}
+	if req.Whiteboard != nil {
+		operationData["whiteboard"] = req.Whiteboard
+	}
+	if req.Form != nil {
+		operationData["form"] = req.Form
+	}
+	if req.Portal != nil {
+		operationData["portal"] = req.Portal
+	}
+	if req.Bindings != nil {
+		operationData["bindings"] = req.Bindings.Data()
+	}
+	if req.PointCloud != nil {
+		operationData["pointcloud"] = req.PointCloud.Data()
+	}
+	if req.Terrain != nil {
+		operationData["terrain"] = req.Terrain.Data()
+	}
+	if req.Model != "" {
+		operationData["model"] = req.Model
+	}
+	for name, value := range req.Components {
+		operationData[name] = value
+	}
 	if req.Position != nil {
 		operationData["position"] = req.Position
 	}
@@ -212,22 +387,17 @@ func CreateEntity(w http.ResponseWriter, r *http.Request) {
 	if req.Visible != nil {
 		operationData["visible"] = *req.Visible
 	}
+	shared.ConstrainTransform(w, hub, operationData)
+	shared.ImportModel(hub, operationData)
 
 	// Create operation
 	operation := &sync.Operation{
 		ClientID:  clientID,
-		Type:      "entity_create",
+		Type:      sync.OpEntityCreate,
 		Data:      operationData,
 		Timestamp: time.Now(),
 	}
 
-	// Get hub and submit operation
-	hub := shared.GetHubFromContext(r)
-	if hub == nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-
 	hub.GetSync().SubmitOperation(operation)
 
 	// Return response
@@ -266,12 +436,85 @@ func UpdateEntity(w http.ResponseWriter, r *http.Request) {
 
 	// Validate material if provided
 	if req.Material != nil {
-		if err := validateMaterial(*req.Material); err != nil {
+		if err := ValidateMaterial(*req.Material); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 	}
 
+	// Validate particles if provided
+	if req.Particles != nil {
+		if err := req.Particles.Validate(); err != nil {
+			http.Error(w, "Invalid particles: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Particles.Start(time.Now())
+	}
+
+	// Validate and screen panel content if provided
+	if req.Panel != nil {
+		if err := req.Panel.Layout(); err != nil {
+			http.Error(w, "Invalid panel: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !shared.ScreenPanel(w, r, req.Panel) {
+			return
+		}
+	}
+
+	// Validate media if provided
+	if req.Media != nil {
+		if err := req.Media.Validate(); err != nil {
+			http.Error(w, "Invalid media: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Media.Start(time.Now())
+	}
+
+	// Validate whiteboard if provided
+	if req.Whiteboard != nil {
+		if err := req.Whiteboard.Validate(); err != nil {
+			http.Error(w, "Invalid whiteboard: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Validate and screen form if provided
+	if req.Form != nil && !shared.CheckForm(w, r, req.Form) {
+		return
+	}
+
+	// Validate portal destination if provided
+	if req.Portal != nil && !shared.CheckPortal(w, r, req.Portal) {
+		return
+	}
+
+	// Validate bindings if provided
+	if req.Bindings != nil {
+		if err := req.Bindings.Validate(); err != nil {
+			http.Error(w, "Invalid bindings: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Validate point cloud if provided
+	if req.PointCloud != nil && !shared.CheckPointCloudSource(w, r, req.PointCloud) {
+		return
+	}
+
+	// Validate terrain if provided
+	if req.Terrain != nil {
+		if err := req.Terrain.Validate(); err != nil {
+			http.Error(w, "Invalid terrain: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Validate plugin components if provided
+	if !shared.CheckPluginComponents(w, req.Components) {
+		return
+	}
+
 	// Get client ID
 	clientID := shared.GetClientID(r)
 
@@ -296,11 +539,41 @@ func UpdateEntity(w http.ResponseWriter, r *http.Request) {
 	if req.Material != nil {
 		operationData["material"] = req.Material
 	}
+	if req.Particles != nil {
+		operationData["particles"] = req.Particles
+	}
+	if req.Panel != nil {
+		operationData["panel"] = req.Panel
+	}
+	if req.Media != nil {
+		operationData["media"] = req.Media
+	}
+	if req.Whiteboard != nil {
+		operationData["whiteboard"] = req.Whiteboard
+	}
+	if req.Form != nil {
+		operationData["form"] = req.Form
+	}
+	if req.Portal != nil {
+		operationData["portal"] = req.Portal
+	}
+	if req.Bindings != nil {
+		operationData["bindings"] = req.Bindings.Data()
+	}
+	if req.PointCloud != nil {
+		operationData["pointcloud"] = req.PointCloud.Data()
+	}
+	if req.Terrain != nil {
+		operationData["terrain"] = req.Terrain.Data()
+	}
+	for name, value := range req.Components {
+		operationData[name] = value
+	}
 
 	// Create operation
 	operation := &sync.Operation{
 		ClientID:  clientID,
-		Type:      "entity_update",
+		Type:      sync.OpEntityUpdate,
 		Data:      operationData,
 		Timestamp: time.Now(),
 	}
@@ -311,6 +584,7 @@ func UpdateEntity(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	shared.ConstrainTransform(w, hub, operationData)
 
 	hub.GetSync().SubmitOperation(operation)
 
@@ -346,7 +620,7 @@ func DeleteEntity(w http.ResponseWriter, r *http.Request) {
 	// Create operation
 	operation := &sync.Operation{
 		ClientID: clientID,
-		Type:     "entity_delete",
+		Type:     sync.OpEntityDelete,
 		Data: map[string]interface{}{
 			"id": entityID,
 		},
@@ -361,6 +635,8 @@ func DeleteEntity(w http.ResponseWriter, r *http.Request) {
 	}
 
 	hub.GetSync().SubmitOperation(operation)
+	entityid.Release(entityID)
+	throttle.Release(entityID)
 
 	// Return response
 	response := DeleteEntityResponse{
@@ -378,8 +654,9 @@ func DeleteEntity(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// Helper functions
-func validateGeometry(geom Geometry) error {
+// ValidateGeometry checks a geometry against the supported Three.js types.
+// Shared with world definition validation so both paths accept the same documents.
+func ValidateGeometry(geom Geometry) error {
 	validTypes := map[string]bool{
 		"box":      true,
 		"sphere":   true,
@@ -400,7 +677,8 @@ func validateGeometry(geom Geometry) error {
 	return nil
 }
 
-func validateMaterial(mat Material) error {
+// ValidateMaterial checks a material type and required color
+func ValidateMaterial(mat Material) error {
 	validTypes := map[string]bool{
 		"basic":    true,
 		"phong":    true,
@@ -418,7 +696,3 @@ func validateMaterial(mat Material) error {
 	return nil
 }
 
-func generateEntityID() string {
-	return "entity-" + time.Now().Format("20060102150405") + "-" + fmt.Sprintf("%d", time.Now().UnixNano()%10000)
-}
-
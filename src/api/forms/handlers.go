@@ -0,0 +1,274 @@
+package forms
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"holodeck1/api/shared"
+	"holodeck1/forms"
+	"holodeck1/holds"
+	"holodeck1/logging"
+	"holodeck1/moderation"
+	"holodeck1/server"
+	"holodeck1/worlds"
+)
+
+// maxSubmission bounds a submission's body
+const maxSubmission = 64 << 10
+
+// SubmitFormRequest is a form filled in
+type SubmitFormRequest struct {
+	Values map[string]interface{} `json:"values"` // By field name
+}
+
+// SubmitFormResponse reports a submission kept or forwarded
+type SubmitFormResponse struct {
+	Success    bool              `json:"success"`
+	Submission *forms.Submission `json:"submission"`
+	Warning    string            `json:"warning,omitempty"` // Why a stored submission was not forwarded
+}
+
+// liveForm returns the hub and the laid-out form of an entity, writing 404
+// when it has none
+func liveForm(w http.ResponseWriter, r *http.Request) (*server.Hub, string, *forms.Form, bool) {
+	entityID := mux.Vars(r)["entityId"]
+	hub := shared.GetHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, "", nil, false
+	}
+	state, err := worlds.Replay(hub.GetFullSync())
+	if err == worlds.ErrTruncatedLog {
+		http.Error(w, "Operation log truncated, world state unavailable", http.StatusConflict)
+		return nil, "", nil, false
+	}
+	entity, exists := state.Entities[entityID]
+	if !exists || entity["form"] == nil {
+		http.Error(w, "Form entity not found", http.StatusNotFound)
+		return nil, "", nil, false
+	}
+	form, err := forms.Decode(entity["form"])
+	if err != nil {
+		http.Error(w, "Form entity not found", http.StatusNotFound)
+		return nil, "", nil, false
+	}
+	return hub, entityID, form, true
+}
+
+// SubmitForm handles POST /api/entities/{entityId}/form, checking a
+// submission against the form's schema and storing or forwarding it
+func SubmitForm(w http.ResponseWriter, r *http.Request) {
+	var req SubmitFormRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSubmission)).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	hub, entityID, form, ok := liveForm(w, r)
+	if !ok {
+		return
+	}
+	if shared.RefuseBanned(w, r) {
+		return
+	}
+	caller := shared.Context(r).Session
+	name := ""
+	if caller != "" && hub.IsConnected(caller) {
+		if avatar := hub.GetAvatarRegistry().FindAvatarByClientID(caller); avatar != nil {
+			name = avatar.Name
+		}
+	} else if shared.IsOperator(r) {
+		caller = shared.GetClientIP(r)
+	} else {
+		http.Error(w, "Forms take submissions from the X-HD1-ID of a connected session", http.StatusBadRequest)
+		return
+	}
+
+	values, err := form.Check(req.Values)
+	if err != nil {
+		http.Error(w, "Invalid submission: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Answers are screened one by one so a redaction stays in its field
+	for _, field := range form.Fields {
+		text, isText := values[field.Name].(string)
+		if !isText || field.Type == forms.FieldChoice {
+			continue
+		}
+		if values[field.Name], ok = shared.ScreenText(w, r, moderation.KindForm, text); !ok {
+			return
+		}
+	}
+
+	submission := &forms.Submission{
+		World:       shared.GetWorldID(r),
+		EntityID:    entityID,
+		HD1ID:       caller,
+		Name:        name,
+		Values:      values,
+		SubmittedAt: time.Now(),
+	}
+	response := SubmitFormResponse{Success: true, Submission: submission}
+	if err := forms.Submit(r.Context(), form, submission); err != nil {
+		switch {
+		case err == forms.ErrNoTarget:
+			http.Error(w, "Form target not configured: "+form.Target, http.StatusServiceUnavailable)
+			return
+		case err == forms.ErrFull:
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case !submission.Stored:
+			logging.Warn("form submission not delivered", map[string]interface{}{
+				"entity_id": entityID,
+				"target":    form.Target,
+				"error":     err.Error(),
+			})
+			http.Error(w, "Submission not delivered: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		logging.Warn("stored form submission not forwarded", map[string]interface{}{
+			"entity_id":     entityID,
+			"submission_id": submission.ID,
+			"target":        form.Target,
+			"error":         err.Error(),
+		})
+		response.Warning = err.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+
+	logging.Info("form submitted", map[string]interface{}{
+		"entity_id":     entityID,
+		"submission_id": submission.ID,
+		"hd1_id":        caller,
+		"stored":        submission.Stored,
+		"forwarded":     submission.Forwarded,
+	})
+}
+
+// ListFormSubmissions handles GET /api/entities/{entityId}/form/submissions,
+// the rows a form keeps as JSON or, with ?format=csv, as a spreadsheet
+func ListFormSubmissions(w http.ResponseWriter, r *http.Request) {
+	_, entityID, form, ok := liveForm(w, r)
+	if !ok {
+		return
+	}
+	rows, err := forms.Rows(r.Context(), shared.GetWorldID(r), entityID)
+	if err != nil {
+		logging.Error("failed to read form submissions", map[string]interface{}{
+			"entity_id": entityID,
+			"error":     err.Error(),
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":     true,
+			"entity_id":   entityID,
+			"fields":      form.Fields,
+			"submissions": rows,
+		})
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", entityID+"-submissions.csv"))
+		writeCSV(w, form, rows)
+	default:
+		http.Error(w, "format must be json or csv", http.StatusBadRequest)
+	}
+}
+
+// writeCSV writes rows with a column per field of the form, then any
+// fields earlier versions of it had
+func writeCSV(w http.ResponseWriter, form *forms.Form, rows []*forms.Submission) {
+	var columns []string
+	known := map[string]bool{}
+	for _, field := range form.Fields {
+		columns = append(columns, field.Name)
+		known[field.Name] = true
+	}
+	var former []string
+	for _, row := range rows {
+		for name := range row.Values {
+			if !known[name] {
+				known[name] = true
+				former = append(former, name)
+			}
+		}
+	}
+	sort.Strings(former)
+	columns = append(columns, former...)
+
+	out := csv.NewWriter(w)
+	// Field names start with a letter, so these never clash with one
+	out.Write(append([]string{"_id", "_submitted_at", "_hd1_id", "_name"}, columns...))
+	for _, row := range rows {
+		record := []string{row.ID, row.SubmittedAt.Format(time.RFC3339), row.HD1ID, cell(row.Name)}
+		for _, column := range columns {
+			switch value := row.Values[column].(type) {
+			case string:
+				record = append(record, cell(value))
+			case float64:
+				record = append(record, strconv.FormatFloat(value, 'f', -1, 64))
+			case bool:
+				record = append(record, strconv.FormatBool(value))
+			default:
+				record = append(record, "")
+			}
+		}
+		out.Write(record)
+	}
+	out.Flush()
+}
+
+// cell keeps submitted text from being read as a formula by spreadsheets
+func cell(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+// ClearFormSubmissions handles DELETE /api/entities/{entityId}/form/submissions
+func ClearFormSubmissions(w http.ResponseWriter, r *http.Request) {
+	_, entityID, _, ok := liveForm(w, r)
+	if !ok {
+		return
+	}
+	if err := holds.Check(holds.KindWorld, shared.GetWorldID(r)); err != nil {
+		http.Error(w, "World is under legal hold", http.StatusConflict)
+		return
+	}
+	cleared, err := forms.Clear(r.Context(), shared.GetWorldID(r), entityID)
+	if err != nil {
+		logging.Error("failed to clear form submissions", map[string]interface{}{
+			"entity_id": entityID,
+			"error":     err.Error(),
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"entity_id": entityID,
+		"cleared":   cleared,
+	})
+
+	logging.Info("form submissions cleared", map[string]interface{}{
+		"entity_id": entityID,
+		"cleared":   cleared,
+		"hd1_id":    shared.GetClientID(r),
+	})
+}
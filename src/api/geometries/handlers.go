@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	"holodeck1/api/shared"
 	"holodeck1/logging"
 	"holodeck1/server"
 	"holodeck1/sync"
@@ -20,11 +21,17 @@ func CreateBoxGeometry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	entityID, ok := allocateEntityID(w, r, req, "box")
+	if !ok {
+		return
+	}
+
 	// Create Three.js box geometry via sync operation
 	operation := &sync.Operation{
 		ClientID:  getClientID(r),
-		Type:      "entity_create",
+		Type:      sync.OpEntityCreate,
 		Data: map[string]interface{}{
+			"id":       entityID,
 			"geometry": map[string]interface{}{
 				"type":           "box",
 				"width":          getFloat(req, "width", 1.0),
@@ -56,7 +63,7 @@ func CreateBoxGeometry(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success":   true,
-		"entity_id": generateEntityID(),
+		"entity_id": entityID,
 		"seq_num":   seqNum,
 	})
 }
@@ -71,11 +78,17 @@ func CreateSphereGeometry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	entityID, ok := allocateEntityID(w, r, req, "sphere")
+	if !ok {
+		return
+	}
+
 	// Create Three.js sphere geometry via sync operation
 	operation := &sync.Operation{
 		ClientID:  getClientID(r),
-		Type:      "entity_create",
+		Type:      sync.OpEntityCreate,
 		Data: map[string]interface{}{
+			"id":       entityID,
 			"geometry": map[string]interface{}{
 				"type":           "sphere",
 				"radius":         getFloat(req, "radius", 1.0),
@@ -106,7 +119,7 @@ func CreateSphereGeometry(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success":   true,
-		"entity_id": generateEntityID(),
+		"entity_id": entityID,
 		"seq_num":   seqNum,
 	})
 }
@@ -121,11 +134,17 @@ func CreateCylinderGeometry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	entityID, ok := allocateEntityID(w, r, req, "cylinder")
+	if !ok {
+		return
+	}
+
 	// Create Three.js cylinder geometry via sync operation
 	operation := &sync.Operation{
 		ClientID:  getClientID(r),
-		Type:      "entity_create",
+		Type:      sync.OpEntityCreate,
 		Data: map[string]interface{}{
+			"id":       entityID,
 			"geometry": map[string]interface{}{
 				"type":           "cylinder",
 				"radiusTop":      getFloat(req, "radiusTop", 1.0),
@@ -159,7 +178,7 @@ func CreateCylinderGeometry(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success":   true,
-		"entity_id": generateEntityID(),
+		"entity_id": entityID,
 		"seq_num":   seqNum,
 	})
 }
@@ -174,11 +193,17 @@ func CreateConeGeometry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	entityID, ok := allocateEntityID(w, r, req, "cone")
+	if !ok {
+		return
+	}
+
 	// Create Three.js cone geometry via sync operation
 	operation := &sync.Operation{
 		ClientID:  getClientID(r),
-		Type:      "entity_create",
+		Type:      sync.OpEntityCreate,
 		Data: map[string]interface{}{
+			"id":       entityID,
 			"geometry": map[string]interface{}{
 				"type":           "cone",
 				"radius":         getFloat(req, "radius", 1.0),
@@ -210,7 +235,7 @@ func CreateConeGeometry(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success":   true,
-		"entity_id": generateEntityID(),
+		"entity_id": entityID,
 		"seq_num":   seqNum,
 	})
 }
@@ -225,11 +250,17 @@ func CreateTorusGeometry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	entityID, ok := allocateEntityID(w, r, req, "torus")
+	if !ok {
+		return
+	}
+
 	// Create Three.js torus geometry via sync operation
 	operation := &sync.Operation{
 		ClientID:  getClientID(r),
-		Type:      "entity_create",
+		Type:      sync.OpEntityCreate,
 		Data: map[string]interface{}{
+			"id":       entityID,
 			"geometry": map[string]interface{}{
 				"type":            "torus",
 				"radius":          getFloat(req, "radius", 1.0),
@@ -259,7 +290,7 @@ func CreateTorusGeometry(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success":   true,
-		"entity_id": generateEntityID(),
+		"entity_id": entityID,
 		"seq_num":   seqNum,
 	})
 }
@@ -274,11 +305,17 @@ func CreateTorusKnotGeometry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	entityID, ok := allocateEntityID(w, r, req, "torusknot")
+	if !ok {
+		return
+	}
+
 	// Create Three.js torus knot geometry via sync operation
 	operation := &sync.Operation{
 		ClientID:  getClientID(r),
-		Type:      "entity_create",
+		Type:      sync.OpEntityCreate,
 		Data: map[string]interface{}{
+			"id":       entityID,
 			"geometry": map[string]interface{}{
 				"type":            "torusknot",
 				"radius":          getFloat(req, "radius", 1.0),
@@ -311,7 +348,7 @@ func CreateTorusKnotGeometry(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success":   true,
-		"entity_id": generateEntityID(),
+		"entity_id": entityID,
 		"seq_num":   seqNum,
 	})
 }
@@ -326,11 +363,17 @@ func CreatePlaneGeometry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	entityID, ok := allocateEntityID(w, r, req, "plane")
+	if !ok {
+		return
+	}
+
 	// Create Three.js plane geometry via sync operation
 	operation := &sync.Operation{
 		ClientID:  getClientID(r),
-		Type:      "entity_create",
+		Type:      sync.OpEntityCreate,
 		Data: map[string]interface{}{
+			"id":       entityID,
 			"geometry": map[string]interface{}{
 				"type":           "plane",
 				"width":          getFloat(req, "width", 1.0),
@@ -359,7 +402,7 @@ func CreatePlaneGeometry(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success":   true,
-		"entity_id": generateEntityID(),
+		"entity_id": entityID,
 		"seq_num":   seqNum,
 	})
 }
@@ -374,11 +417,17 @@ func CreateRingGeometry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	entityID, ok := allocateEntityID(w, r, req, "ring")
+	if !ok {
+		return
+	}
+
 	// Create Three.js ring geometry via sync operation
 	operation := &sync.Operation{
 		ClientID:  getClientID(r),
-		Type:      "entity_create",
+		Type:      sync.OpEntityCreate,
 		Data: map[string]interface{}{
+			"id":       entityID,
 			"geometry": map[string]interface{}{
 				"type":         "ring",
 				"innerRadius":  getFloat(req, "innerRadius", 0.5),
@@ -409,7 +458,7 @@ func CreateRingGeometry(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success":   true,
-		"entity_id": generateEntityID(),
+		"entity_id": entityID,
 		"seq_num":   seqNum,
 	})
 }
@@ -424,11 +473,17 @@ func CreateCircleGeometry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	entityID, ok := allocateEntityID(w, r, req, "circle")
+	if !ok {
+		return
+	}
+
 	// Create Three.js circle geometry via sync operation
 	operation := &sync.Operation{
 		ClientID:  getClientID(r),
-		Type:      "entity_create",
+		Type:      sync.OpEntityCreate,
 		Data: map[string]interface{}{
+			"id":       entityID,
 			"geometry": map[string]interface{}{
 				"type":        "circle",
 				"radius":      getFloat(req, "radius", 1.0),
@@ -457,7 +512,7 @@ func CreateCircleGeometry(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success":   true,
-		"entity_id": generateEntityID(),
+		"entity_id": entityID,
 		"seq_num":   seqNum,
 	})
 }
@@ -472,11 +527,17 @@ func CreateCapsuleGeometry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	entityID, ok := allocateEntityID(w, r, req, "capsule")
+	if !ok {
+		return
+	}
+
 	// Create Three.js capsule geometry via sync operation
 	operation := &sync.Operation{
 		ClientID:  getClientID(r),
-		Type:      "entity_create",
+		Type:      sync.OpEntityCreate,
 		Data: map[string]interface{}{
+			"id":       entityID,
 			"geometry": map[string]interface{}{
 				"type":           "capsule",
 				"radius":         getFloat(req, "radius", 1.0),
@@ -505,7 +566,7 @@ func CreateCapsuleGeometry(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success":   true,
-		"entity_id": generateEntityID(),
+		"entity_id": entityID,
 		"seq_num":   seqNum,
 	})
 }
@@ -538,14 +599,45 @@ func getBool(req map[string]interface{}, key string, defaultValue bool) bool {
 	return defaultValue
 }
 
-func generateEntityID() string {
-	// Generate a simple entity ID for now - in production this would be a proper UUID
-	return "entity_" + "generated"
+// allocateEntityID claims the ID for a new geometry entity, honouring an
+// optional client-suggested "id", charges it to the creation budget and
+// applies the world's editing constraints to the requested transform
+func allocateEntityID(w http.ResponseWriter, r *http.Request, req map[string]interface{}, geometryType string) (string, bool) {
+	var suggested string
+	if value, present := req["id"]; present && value != nil {
+		id, ok := value.(string)
+		if !ok {
+			http.Error(w, "Entity ID must be a string", http.StatusBadRequest)
+			return "", false
+		}
+		suggested = id
+	}
+	entityID, ok := shared.AllocateEntityID(w, suggested, getClientID(r))
+	if !ok || !shared.AdmitEntity(w, r, entityID, geometryType, req) {
+		return "", false
+	}
+
+	// Constrain the transform as the entity will hold it; the parameters
+	// sit beside it in the request
+	geometry := map[string]interface{}{"type": geometryType}
+	for key, value := range req {
+		geometry[key] = value
+	}
+	data := map[string]interface{}{
+		"id":       entityID,
+		"geometry": geometry,
+		"position": req["position"],
+		"rotation": req["rotation"],
+		"scale":    req["scale"],
+	}
+	shared.ConstrainTransform(w, shared.GetHubFromContext(r), data)
+	req["position"], req["rotation"] = data["position"], data["rotation"]
+	return entityID, true
 }
 
 func getClientID(r *http.Request) string {
 	// Try to get client ID from various sources
-	if clientID := r.Header.Get("X-HD1-ID"); clientID != "" {
+	if clientID := shared.Context(r).Session; clientID != "" {
 		return clientID
 	}
 	
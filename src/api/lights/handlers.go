@@ -20,7 +20,7 @@ func CreateDirectionalLight(w http.ResponseWriter, r *http.Request) {
 
 	operation := &sync.Operation{
 		ClientID:  getClientID(r),
-		Type:      "scene_update",
+		Type:      sync.OpSceneUpdate,
 		Data: map[string]interface{}{
 			"operation": "add_light",
 			"light": map[string]interface{}{
@@ -71,7 +71,7 @@ func CreatePointLight(w http.ResponseWriter, r *http.Request) {
 
 	operation := &sync.Operation{
 		ClientID:  getClientID(r),
-		Type:      "scene_update",
+		Type:      sync.OpSceneUpdate,
 		Data: map[string]interface{}{
 			"operation": "add_light",
 			"light": map[string]interface{}{
@@ -124,7 +124,7 @@ func CreateSpotLight(w http.ResponseWriter, r *http.Request) {
 
 	operation := &sync.Operation{
 		ClientID:  getClientID(r),
-		Type:      "scene_update",
+		Type:      sync.OpSceneUpdate,
 		Data: map[string]interface{}{
 			"operation": "add_light",
 			"light": map[string]interface{}{
@@ -180,7 +180,7 @@ func CreateAmbientLight(w http.ResponseWriter, r *http.Request) {
 
 	operation := &sync.Operation{
 		ClientID:  getClientID(r),
-		Type:      "scene_update",
+		Type:      sync.OpSceneUpdate,
 		Data: map[string]interface{}{
 			"operation": "add_light",
 			"light": map[string]interface{}{
@@ -228,7 +228,7 @@ func CreateHemisphereLight(w http.ResponseWriter, r *http.Request) {
 
 	operation := &sync.Operation{
 		ClientID:  getClientID(r),
-		Type:      "scene_update",
+		Type:      sync.OpSceneUpdate,
 		Data: map[string]interface{}{
 			"operation": "add_light",
 			"light": map[string]interface{}{
@@ -303,7 +303,7 @@ func generateLightID() string {
 
 func getClientID(r *http.Request) string {
 	// Try to get client ID from various sources
-	if clientID := r.Header.Get("X-HD1-ID"); clientID != "" {
+	if clientID := shared.Context(r).Session; clientID != "" {
 		return clientID
 	}
 	
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	"holodeck1/api/shared"
 	"holodeck1/logging"
 	"holodeck1/server"
 	"holodeck1/sync"
@@ -23,7 +24,7 @@ func CreateBasicMaterial(w http.ResponseWriter, r *http.Request) {
 	// Create Three.js basic material via sync operation
 	operation := &sync.Operation{
 		ClientID:  getClientID(r),
-		Type:      "material_create",
+		Type:      sync.OpMaterialCreate,
 		Data: map[string]interface{}{
 			"material": map[string]interface{}{
 				"type":      "basic",
@@ -65,7 +66,7 @@ func CreatePhongMaterial(w http.ResponseWriter, r *http.Request) {
 	// Create Three.js phong material via sync operation
 	operation := &sync.Operation{
 		ClientID:  getClientID(r),
-		Type:      "material_create",
+		Type:      sync.OpMaterialCreate,
 		Data: map[string]interface{}{
 			"material": map[string]interface{}{
 				"type":       "phong",
@@ -113,7 +114,7 @@ func CreateStandardMaterial(w http.ResponseWriter, r *http.Request) {
 	// Create Three.js standard material via sync operation
 	operation := &sync.Operation{
 		ClientID:  getClientID(r),
-		Type:      "material_create",
+		Type:      sync.OpMaterialCreate,
 		Data: map[string]interface{}{
 			"material": map[string]interface{}{
 				"type":       "standard",
@@ -161,7 +162,7 @@ func CreatePhysicalMaterial(w http.ResponseWriter, r *http.Request) {
 	// Create Three.js physical material via sync operation
 	operation := &sync.Operation{
 		ClientID:  getClientID(r),
-		Type:      "material_create",
+		Type:      sync.OpMaterialCreate,
 		Data: map[string]interface{}{
 			"material": map[string]interface{}{
 				"type":               "physical",
@@ -238,7 +239,7 @@ func generateMaterialID() string {
 
 func getClientID(r *http.Request) string {
 	// Try to get client ID from various sources
-	if clientID := r.Header.Get("X-HD1-ID"); clientID != "" {
+	if clientID := shared.Context(r).Session; clientID != "" {
 		return clientID
 	}
 	
@@ -0,0 +1,89 @@
+package media
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"holodeck1/api/shared"
+	"holodeck1/logging"
+	"holodeck1/media"
+	"holodeck1/sync"
+	"holodeck1/worlds"
+)
+
+// ControlMediaResponse returns the screen's playback after the control
+type ControlMediaResponse struct {
+	Success  bool         `json:"success"`
+	EntityID string       `json:"entity_id"`
+	Media    *media.Media `json:"media"`
+	SeqNum   uint64       `json:"seq_num"`
+}
+
+// ControlMedia handles POST /api/entities/{entityId}/media, playing,
+// pausing, seeking or setting the volume of a screen for everyone in the
+// world
+func ControlMedia(w http.ResponseWriter, r *http.Request) {
+	entityID := mux.Vars(r)["entityId"]
+
+	var control media.Control
+	if err := json.NewDecoder(r.Body).Decode(&control); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	hub := shared.GetHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	state, err := worlds.Replay(hub.GetFullSync())
+	if err == worlds.ErrTruncatedLog {
+		http.Error(w, "Operation log truncated, world state unavailable", http.StatusConflict)
+		return
+	}
+	entity, exists := state.Entities[entityID]
+	if !exists || entity["media"] == nil {
+		http.Error(w, "Media entity not found", http.StatusNotFound)
+		return
+	}
+	screen, err := media.Decode(entity["media"])
+	if err != nil {
+		http.Error(w, "Media entity not found", http.StatusNotFound)
+		return
+	}
+
+	if err := screen.Apply(control, time.Now()); err != nil {
+		http.Error(w, "Invalid control: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	clientID := shared.GetClientID(r)
+	operation := &sync.Operation{
+		ClientID: clientID,
+		Type:     sync.OpEntityUpdate,
+		Data: map[string]interface{}{
+			"id":    entityID,
+			"media": screen.Data(),
+		},
+		Timestamp: time.Now(),
+	}
+	hub.GetSync().SubmitOperation(operation)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ControlMediaResponse{
+		Success:  true,
+		EntityID: entityID,
+		Media:    screen,
+		SeqNum:   operation.SeqNum,
+	})
+
+	logging.Debug("media controlled", map[string]interface{}{
+		"entity_id": entityID,
+		"action":    control.Action,
+		"position":  screen.Position,
+		"hd1_id":    clientID,
+		"seq_num":   operation.SeqNum,
+	})
+}
@@ -0,0 +1,75 @@
+package organizations
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"holodeck1/api/shared"
+	"holodeck1/quotas"
+)
+
+// AssignPlanRequest puts an organization on a plan
+type AssignPlanRequest struct {
+	Plan string `json:"plan"`
+}
+
+// ListPlans handles GET /api/plans
+func ListPlans(w http.ResponseWriter, r *http.Request) {
+	plans, defaultPlan := quotas.Plans()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"plans":   plans,
+		"default": defaultPlan,
+	})
+}
+
+// GetPlan handles GET /api/organizations/{orgId}/plan, with the sessions
+// the organization has connected
+func GetPlan(w http.ResponseWriter, r *http.Request) {
+	hub := shared.GetHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	org := mux.Vars(r)["orgId"]
+	plan, assignment := quotas.PlanFor(org)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"org":        org,
+		"plan":       plan,
+		"assignment": assignment,
+		"sessions":   hub.OrgSessions(org),
+	})
+}
+
+// AssignPlan handles PUT /api/organizations/{orgId}/plan; the new plan's
+// quotas apply to the next call and message
+func AssignPlan(w http.ResponseWriter, r *http.Request) {
+	var req AssignPlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	assignment, err := quotas.Assign(r.Context(), mux.Vars(r)["orgId"], req.Plan, shared.Context(r).User())
+	switch err {
+	case nil:
+	case quotas.ErrUnknownPlan, quotas.ErrInvalidOrg:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	default:
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	plan, _ := quotas.PlanFor(assignment.Org)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"plan":       plan,
+		"assignment": assignment,
+	})
+}
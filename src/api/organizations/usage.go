@@ -0,0 +1,21 @@
+package organizations
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"holodeck1/apiusage"
+)
+
+// GetAPIUsage handles GET /api/organizations/{orgId}/usage/api, reporting
+// the organization's calls per key and operation; ?key= narrows it to one
+// key
+func GetAPIUsage(w http.ResponseWriter, r *http.Request) {
+	report := apiusage.For(mux.Vars(r)["orgId"], r.URL.Query().Get("key"))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"usage":   report,
+	})
+}
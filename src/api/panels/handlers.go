@@ -0,0 +1,106 @@
+package panels
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"holodeck1/api/shared"
+	"holodeck1/logging"
+	"holodeck1/panels"
+	"holodeck1/sync"
+	"holodeck1/worlds"
+)
+
+// UpdatePanelRequest replaces a panel's content, keeping its kind, size
+// and colours
+type UpdatePanelRequest struct {
+	Content *string `json:"content"`
+	Format  string  `json:"format,omitempty"` // Keeps the current format when empty
+}
+
+// UpdatePanelResponse returns the panel as laid out
+type UpdatePanelResponse struct {
+	Success  bool          `json:"success"`
+	EntityID string        `json:"entity_id"`
+	Panel    *panels.Panel `json:"panel"`
+	SeqNum   uint64        `json:"seq_num"`
+}
+
+// UpdatePanel handles PUT /api/entities/{entityId}/panel, for dashboards
+// and signage that refresh their content
+func UpdatePanel(w http.ResponseWriter, r *http.Request) {
+	entityID := mux.Vars(r)["entityId"]
+
+	var req UpdatePanelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Content == nil {
+		http.Error(w, "content is required", http.StatusBadRequest)
+		return
+	}
+
+	hub := shared.GetHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	state, err := worlds.Replay(hub.GetFullSync())
+	if err == worlds.ErrTruncatedLog {
+		http.Error(w, "Operation log truncated, world state unavailable", http.StatusConflict)
+		return
+	}
+	entity, exists := state.Entities[entityID]
+	if !exists || entity["panel"] == nil {
+		http.Error(w, "Panel entity not found", http.StatusNotFound)
+		return
+	}
+	panel, err := panels.Decode(entity["panel"])
+	if err != nil {
+		http.Error(w, "Panel entity not found", http.StatusNotFound)
+		return
+	}
+
+	panel.Content = *req.Content
+	if req.Format != "" {
+		panel.Format = req.Format
+	}
+	if err := panel.Layout(); err != nil {
+		http.Error(w, "Invalid panel: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !shared.ScreenPanel(w, r, panel) {
+		return
+	}
+
+	clientID := shared.GetClientID(r)
+	operation := &sync.Operation{
+		ClientID: clientID,
+		Type:     sync.OpEntityUpdate,
+		Data: map[string]interface{}{
+			"id":    entityID,
+			"panel": panel.Data(),
+		},
+		Timestamp: time.Now(),
+	}
+	hub.GetSync().SubmitOperation(operation)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(UpdatePanelResponse{
+		Success:  true,
+		EntityID: entityID,
+		Panel:    panel,
+		SeqNum:   operation.SeqNum,
+	})
+
+	logging.Debug("panel content updated", map[string]interface{}{
+		"entity_id": entityID,
+		"format":    panel.Format,
+		"blocks":    len(panel.Blocks),
+		"hd1_id":    clientID,
+		"seq_num":   operation.SeqNum,
+	})
+}
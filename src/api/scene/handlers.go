@@ -107,7 +107,7 @@ func UpdateScene(w http.ResponseWriter, r *http.Request) {
 	// Create operation
 	operation := &sync.Operation{
 		ClientID:  clientID,
-		Type:      "scene_update",
+		Type:      sync.OpSceneUpdate,
 		Data:      operationData,
 		Timestamp: time.Now(),
 	}
@@ -0,0 +1,190 @@
+package screenshare
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"holodeck1/api/shared"
+	"holodeck1/entityid"
+	"holodeck1/logging"
+	"holodeck1/media"
+	"holodeck1/screenshare"
+	"holodeck1/sync"
+	"holodeck1/throttle"
+)
+
+// maxNameLength bounds a share's display name
+const maxNameLength = 64
+
+// StartScreenShareRequest places the screen a share is shown on
+type StartScreenShareRequest struct {
+	Name     string          `json:"name,omitempty"`
+	Position *shared.Vector3 `json:"position,omitempty"`
+	Rotation *shared.Vector3 `json:"rotation,omitempty"`
+	Width    float64         `json:"width,omitempty"`  // Metres, 1.6 when unset
+	Height   float64         `json:"height,omitempty"` // Metres, 0.9 when unset
+}
+
+// ScreenShareResponse returns a share and its screen
+type ScreenShareResponse struct {
+	Success bool               `json:"success"`
+	Share   *screenshare.Share `json:"share"`
+	Media   *media.Media       `json:"media,omitempty"`
+	SeqNum  uint64             `json:"seq_num"`
+}
+
+// StartScreenShare handles POST /api/screenshares. The caller must be a
+// connected session: viewers signal it over the WebSocket to subscribe.
+func StartScreenShare(w http.ResponseWriter, r *http.Request) {
+	var req StartScreenShareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(req.Name) > maxNameLength {
+		http.Error(w, "name too long", http.StatusBadRequest)
+		return
+	}
+
+	hub := shared.GetHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	hd1ID := shared.Context(r).Session
+	if hd1ID == "" || !hub.IsConnected(hd1ID) {
+		http.Error(w, "Screen sharing requires the X-HD1-ID of a connected session", http.StatusBadRequest)
+		return
+	}
+
+	share := &screenshare.Share{
+		ID:        screenshare.NewID(),
+		HD1ID:     hd1ID,
+		Name:      req.Name,
+		StartedAt: time.Now().UTC(),
+	}
+	screen := &media.Media{
+		Kind:    media.KindShare,
+		Source:  share.ID,
+		Width:   req.Width,
+		Height:  req.Height,
+		Playing: true,
+	}
+	if err := screen.Validate(); err != nil {
+		http.Error(w, "Invalid screen: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	screen.Start(time.Now())
+
+	entityID, ok := shared.AllocateEntityID(w, "", hd1ID)
+	if !ok {
+		return
+	}
+	if !shared.AdmitEntity(w, r, entityID, "plane", nil) {
+		return
+	}
+	share.EntityID = entityID
+	if err := screenshare.Start(share); err == screenshare.ErrAlreadySharing {
+		entityid.Release(entityID)
+		throttle.Release(entityID)
+		http.Error(w, "This session is already sharing its screen", http.StatusConflict)
+		return
+	}
+
+	data := map[string]interface{}{
+		"id":    entityID,
+		"media": screen.Data(),
+	}
+	if req.Position != nil {
+		data["position"] = req.Position
+	}
+	if req.Rotation != nil {
+		data["rotation"] = req.Rotation
+	}
+	operation := &sync.Operation{
+		ClientID:  hd1ID,
+		Type:      sync.OpEntityCreate,
+		Data:      data,
+		Timestamp: time.Now(),
+	}
+	hub.GetSync().SubmitOperation(operation)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ScreenShareResponse{
+		Success: true,
+		Share:   share,
+		Media:   screen,
+		SeqNum:  operation.SeqNum,
+	})
+
+	logging.Info("screen share started", map[string]interface{}{
+		"share_id":  share.ID,
+		"entity_id": entityID,
+		"hd1_id":    hd1ID,
+		"seq_num":   operation.SeqNum,
+	})
+}
+
+// ListScreenShares handles GET /api/screenshares
+func ListScreenShares(w http.ResponseWriter, r *http.Request) {
+	shares := screenshare.List()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"shares":  shares,
+		"count":   len(shares),
+	})
+}
+
+// StopScreenShare handles DELETE /api/screenshares/{shareId}, by the
+// sharer or an operator
+func StopScreenShare(w http.ResponseWriter, r *http.Request) {
+	shareID := mux.Vars(r)["shareId"]
+
+	hub := shared.GetHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	share, err := screenshare.Get(shareID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if share.HD1ID != shared.Context(r).Session && !shared.IsOperator(r) {
+		http.Error(w, "Only the sharer can stop a screen share", http.StatusForbidden)
+		return
+	}
+	if _, err := screenshare.Stop(shareID); err != nil {
+		// Its sharer disconnected meanwhile
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	operation := &sync.Operation{
+		ClientID:  shared.GetClientID(r),
+		Type:      sync.OpEntityDelete,
+		Data:      map[string]interface{}{"id": share.EntityID},
+		Timestamp: time.Now(),
+	}
+	hub.GetSync().SubmitOperation(operation)
+	entityid.Release(share.EntityID)
+	throttle.Release(share.EntityID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ScreenShareResponse{
+		Success: true,
+		Share:   share,
+		SeqNum:  operation.SeqNum,
+	})
+
+	logging.Info("screen share stopped", map[string]interface{}{
+		"share_id":  share.ID,
+		"entity_id": share.EntityID,
+		"hd1_id":    share.HD1ID,
+		"seq_num":   operation.SeqNum,
+	})
+}
@@ -0,0 +1,109 @@
+package sessions
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"holodeck1/api/shared"
+	"holodeck1/config"
+	"holodeck1/impersonation"
+)
+
+// StartImpersonationRequest asks to act as a session. Duration is in
+// seconds, at most the configured maximum, which it defaults to.
+type StartImpersonationRequest struct {
+	Reason   string   `json:"reason"`
+	Scope    []string `json:"scope,omitempty"`
+	Duration int64    `json:"duration,omitempty"`
+}
+
+// StartImpersonation handles POST /api/sessions/{hd1Id}/impersonation. The
+// token is returned once; calls carrying it in X-HD1-Impersonation, with
+// the operator's credentials, act as the session.
+func StartImpersonation(w http.ResponseWriter, r *http.Request) {
+	var req StartImpersonationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	hub := shared.GetHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	hd1ID := mux.Vars(r)["hd1Id"]
+	if !hub.IsConnected(hd1ID) {
+		http.Error(w, "Session not connected", http.StatusNotFound)
+		return
+	}
+
+	duration := config.GetImpersonationMaxDuration()
+	if req.Duration != 0 {
+		duration = time.Duration(req.Duration) * time.Second
+	}
+	now := time.Now().UTC()
+	imp := &impersonation.Impersonation{
+		ID:        impersonation.NewID(),
+		HD1ID:     hd1ID,
+		World:     config.GetWorldsDefaultWorld(),
+		Operator:  shared.Context(r).User(),
+		Reason:    req.Reason,
+		Scope:     req.Scope,
+		StartedAt: now,
+		ExpiresAt: now.Add(duration),
+	}
+	if err := imp.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	token, err := impersonation.Start(r.Context(), hub, imp)
+	if err == impersonation.ErrActive {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"impersonation": imp,
+		"token":         token,
+		"header":        impersonation.Header,
+	})
+}
+
+// ListImpersonations handles GET /api/sessions/impersonations
+func ListImpersonations(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":        true,
+		"impersonations": impersonation.List(),
+		"max_duration":   int64(config.GetImpersonationMaxDuration() / time.Second),
+	})
+}
+
+// EndImpersonation handles DELETE
+// /api/sessions/impersonations/{impersonationId}
+func EndImpersonation(w http.ResponseWriter, r *http.Request) {
+	hub := shared.GetHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	imp, err := impersonation.End(r.Context(), hub, mux.Vars(r)["impersonationId"], shared.Context(r).User())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"impersonation": imp,
+	})
+}
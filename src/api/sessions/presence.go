@@ -0,0 +1,41 @@
+package sessions
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"holodeck1/api/shared"
+	"holodeck1/config"
+)
+
+// GetPresence handles GET /api/sessions/presence: the health of the
+// organization's connected clients and its presence events after ?since=
+func GetPresence(w http.ResponseWriter, r *http.Request) {
+	hub := shared.GetHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	var since uint64
+	if value := r.URL.Query().Get("since"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			http.Error(w, "since must be an event sequence number", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+	clients, events, seq := hub.Presence(shared.Context(r).Org, since)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":      true,
+		"clients":      clients,
+		"events":       events,
+		"seq":          seq,
+		"heartbeat_ms": config.GetAvatarsHeartbeatFrequency().Milliseconds(),
+		"stale_after":  int64(config.GetSessionStaleAfter() / time.Second),
+	})
+}
@@ -0,0 +1,103 @@
+package sessions
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"holodeck1/api/shared"
+	"holodeck1/logging"
+	"holodeck1/tokens"
+)
+
+// RevokeTokenRequest names a token to revoke
+type RevokeTokenRequest struct {
+	Token string `json:"token"`
+}
+
+func bearer(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// mayRevoke reports whether the caller may end a session: the session
+// itself, with one of its tokens as bearer token, local callers, and
+// moderators with the moderation token
+func mayRevoke(r *http.Request, hd1ID string) bool {
+	if shared.IsOperator(r) {
+		return true
+	}
+	token, err := tokens.Validate(bearer(r))
+	return err == nil && token.HD1ID == hd1ID
+}
+
+// RevokeToken handles POST /api/sessions/tokens/revoke. Holding a token is
+// enough to revoke it; the session's connections close when it has no
+// valid token left.
+func RevokeToken(w http.ResponseWriter, r *http.Request) {
+	var req RevokeTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	hub := shared.GetHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	token, err := tokens.Revoke(req.Token)
+	if err != nil {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+	connections := 0
+	if !tokens.Active(token.HD1ID) {
+		connections = hub.RevokeSession(token.HD1ID)
+	}
+	logging.Info("session token revoked", map[string]interface{}{
+		"hd1_id":      token.HD1ID,
+		"connections": connections,
+		"remote_ip":   shared.GetClientIP(r),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"hd1_id":      token.HD1ID,
+		"connections": connections,
+	})
+}
+
+// RevokeSession handles DELETE /api/sessions/{hd1Id}/tokens
+func RevokeSession(w http.ResponseWriter, r *http.Request) {
+	hd1ID := mux.Vars(r)["hd1Id"]
+	if !mayRevoke(r, hd1ID) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	hub := shared.GetHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	active := tokens.Active(hd1ID)
+	connections := hub.RevokeSession(hd1ID)
+	if !active && connections == 0 {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	logging.Info("session revoked", map[string]interface{}{
+		"hd1_id":      hd1ID,
+		"connections": connections,
+		"remote_ip":   shared.GetClientIP(r),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"hd1_id":      hd1ID,
+		"connections": connections,
+	})
+}
@@ -0,0 +1,188 @@
+package shared
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"holodeck1/config"
+	"holodeck1/guests"
+	"holodeck1/server"
+	"holodeck1/spectators"
+	"holodeck1/tokens"
+)
+
+// Permissions a caller may hold; see RequestContext.Permissions
+var allPermissions = []string{guests.CapabilityView, guests.CapabilityChat, guests.CapabilityEdit}
+
+// RequestContext is what handlers know of a request beyond its body: who is
+// calling, for which organization, world and session, with what
+// permissions, and the trace span it runs in. The router builds it once per
+// request, before authorization, so handlers read it instead of headers.
+type RequestContext struct {
+	Operation     string        // operationId of the route, empty outside the API router
+	Org           string        // Joined by the bearer token's session, else X-HD1-Org, "default" when absent
+	World         string        // The {worldId} path variable, or the served world
+	Session       string        // X-HD1-ID: the session the caller acts for
+	Authenticated bool          // The bearer token is a session token of Session, which it names without X-HD1-ID
+	Operator      bool          // Local caller, or the moderation token as bearer token
+	ClientIP      string        // Behind any trusted proxies
+	Guest         *guests.Grant // The session's guest grant, nil for other sessions
+	Spectator     bool          // The session joined as a spectator
+	Permissions   []string      // view, chat and edit the caller holds
+	Impersonation string        // Impersonation support staff call under, acting as Session
+	Span          Span
+	Started       time.Time
+
+	orgBound bool // Org is the bearer token's session's, not X-HD1-Org
+}
+
+// Span identifies a request in a W3C trace: the caller's trace continues
+// with a span of its own, and requests without one start a trace
+type Span struct {
+	TraceID  string // 32 hex digits
+	SpanID   string // 16 hex digits
+	ParentID string // The caller's span, empty when the trace starts here
+	Sampled  bool
+}
+
+var traceparent = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+// Traceparent renders the span as a W3C traceparent header value
+func (s Span) Traceparent() string {
+	flags := "00"
+	if s.Sampled {
+		flags = "01"
+	}
+	return "00-" + s.TraceID + "-" + s.SpanID + "-" + flags
+}
+
+// newSpan continues the trace of an incoming traceparent header, or starts
+// one. All-zero IDs are invalid and start a new trace.
+func newSpan(header string) Span {
+	span := Span{SpanID: randomHex(8)}
+	if match := traceparent.FindStringSubmatch(strings.ToLower(strings.TrimSpace(header))); match != nil &&
+		strings.Trim(match[1], "0") != "" && strings.Trim(match[2], "0") != "" {
+		span.TraceID = match[1]
+		span.ParentID = match[2]
+		span.Sampled = match[3][1]&1 == 1
+		return span
+	}
+	span.TraceID = randomHex(16)
+	return span
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// User returns who is acting, as audit entries and logs name them: the
+// session, or the caller's address without one
+func (c *RequestContext) User() string {
+	if c.Session != "" {
+		return c.Session
+	}
+	return c.ClientIP
+}
+
+// PolicyOrg returns the organization whose content policy screens the
+// caller's text: that of its session, for callers presenting a session
+// token, X-HD1-Org for operators, and the default organization otherwise,
+// so no caller picks a laxer policy by header
+func (c *RequestContext) PolicyOrg() string {
+	if c.orgBound || c.Operator {
+		return c.Org
+	}
+	return "default"
+}
+
+// Can reports whether the caller holds a permission
+func (c *RequestContext) Can(permission string) bool {
+	for _, held := range c.Permissions {
+		if held == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// NewRequestContext reads a request's context from its headers and path.
+// A session token as bearer token binds the caller to the organization its
+// session joined, whatever X-HD1-Org says, and names the session when
+// X-HD1-ID does not. Calls carrying a guest session's X-HD1-ID or token
+// hold only what its link grants, and calls carrying a spectator's either
+// one only view.
+func NewRequestContext(r *http.Request, operation string) *RequestContext {
+	rc := &RequestContext{
+		Operation: operation,
+		Org:       r.Header.Get("X-HD1-Org"),
+		World:     mux.Vars(r)["worldId"],
+		Session:   r.Header.Get("X-HD1-ID"),
+		Operator:  server.IsOperator(r),
+		ClientIP:  server.ClientIP(r),
+		Span:      newSpan(r.Header.Get("traceparent")),
+		Started:   time.Now(),
+	}
+	if rc.Org == "" {
+		rc.Org = "default"
+	}
+	if rc.World == "" {
+		rc.World = config.GetWorldsDefaultWorld()
+	}
+	bound := "" // The session the bearer token proves
+	if token, err := tokens.Validate(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")); err == nil {
+		rc.Org, rc.orgBound = token.Org, true
+		bound = token.HD1ID
+		if rc.Session == "" {
+			rc.Session = bound
+		}
+		rc.Authenticated = token.HD1ID == rc.Session
+	}
+	if rc.Session != "" {
+		rc.Guest = guests.GrantFor(rc.Session)
+		rc.Spectator = spectators.Is(rc.Session)
+	}
+	if bound != "" {
+		if rc.Guest == nil {
+			rc.Guest = guests.GrantFor(bound)
+		}
+		rc.Spectator = rc.Spectator || spectators.Is(bound)
+	}
+	rc.Permissions = allPermissions
+	if rc.Guest != nil {
+		rc.Permissions = []string{}
+		for _, permission := range allPermissions {
+			if rc.Guest.Allows(permission) {
+				rc.Permissions = append(rc.Permissions, permission)
+			}
+		}
+	}
+	if rc.Spectator {
+		rc.Permissions = []string{guests.CapabilityView}
+	}
+	return rc
+}
+
+type requestContextKey struct{}
+
+// WithRequestContext returns the request carrying rc
+func WithRequestContext(r *http.Request, rc *RequestContext) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), requestContextKey{}, rc))
+}
+
+// Context returns the request's context as the router built it. Requests
+// that did not pass the router, as in tests, get one read from their
+// headers.
+func Context(r *http.Request) *RequestContext {
+	if rc, ok := r.Context().Value(requestContextKey{}).(*RequestContext); ok {
+		return rc
+	}
+	return NewRequestContext(r, "")
+}
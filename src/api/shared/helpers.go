@@ -1,10 +1,36 @@
 package shared
 
 import (
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	stdSync "sync"
 	"time"
 
+	"holodeck1/assets"
+	"holodeck1/bindings"
+	"holodeck1/components"
+	"holodeck1/config"
+	"holodeck1/constraints"
+	"holodeck1/geo"
+	"holodeck1/entityid"
+	"holodeck1/features"
+	"holodeck1/forms"
+	"holodeck1/logging"
+	"holodeck1/media"
+	"holodeck1/moderation"
+	"holodeck1/movement"
+	"holodeck1/panels"
+	"holodeck1/particles"
+	"holodeck1/pointclouds"
 	"holodeck1/server"
+	"holodeck1/simulation"
+	"holodeck1/storage"
+	"holodeck1/sync"
+	"holodeck1/throttle"
+	"holodeck1/units"
+	"holodeck1/usage"
 )
 
 // Vector3 represents a 3D vector
@@ -14,14 +40,19 @@ type Vector3 struct {
 	Z float64 `json:"z"`
 }
 
-// GetClientID extracts client ID from request headers
+// GetClientID returns the caller's session, or a made-up API client ID
 func GetClientID(r *http.Request) string {
-	if clientID := r.Header.Get("X-HD1-ID"); clientID != "" {
+	if clientID := Context(r).Session; clientID != "" {
 		return clientID
 	}
 	return "api-client-" + time.Now().Format("20060102150405")
 }
 
+// GetClientIP returns the caller's address, looking through trusted proxies
+func GetClientIP(r *http.Request) string {
+	return Context(r).ClientIP
+}
+
 // GetHubFromContext extracts the hub from request context
 func GetHubFromContext(r *http.Request) *server.Hub {
 	if hub := r.Context().Value("hub"); hub != nil {
@@ -30,4 +61,374 @@ func GetHubFromContext(r *http.Request) *server.Hub {
 		}
 	}
 	return nil
-}
\ No newline at end of file
+}
+// GetOrgID returns the caller's organization: the one its session joined,
+// with a session token as bearer token, or X-HD1-Org. Requests without
+// either belong to the "default" organization.
+func GetOrgID(r *http.Request) string {
+	return Context(r).Org
+}
+
+// GetWorldID returns the request's world: the {worldId} path variable, or
+// the world the hub serves
+func GetWorldID(r *http.Request) string {
+	return Context(r).World
+}
+
+// FeatureEnabled reports whether a feature flag is on for the request's
+// organization and world
+func FeatureEnabled(r *http.Request, name string) bool {
+	return features.Enabled(name, GetOrgID(r), GetWorldID(r))
+}
+
+// RefuseBanned writes 403 when a ban keeps the caller, by X-HD1-ID or
+// address, out of the request's world
+func RefuseBanned(w http.ResponseWriter, r *http.Request) bool {
+	ban := moderation.Banned(GetWorldID(r), r.Header.Get("X-HD1-ID"), GetClientIP(r))
+	if ban == nil {
+		return false
+	}
+	http.Error(w, "Banned from this world", http.StatusForbidden)
+	return true
+}
+
+// RefuseSpectator writes 403 and returns true for calls of a spectator
+// session, which has no avatar to create, move or place
+func RefuseSpectator(w http.ResponseWriter, r *http.Request) bool {
+	if !Context(r).Spectator {
+		return false
+	}
+	http.Error(w, "Spectators have no avatar", http.StatusForbidden)
+	return true
+}
+
+// ScreenText runs user text through the content policy of the caller's
+// organization, as RequestContext.PolicyOrg binds it. It returns the text to store, possibly redacted, or writes 422
+// and returns false when the policy rejects it.
+func ScreenText(w http.ResponseWriter, r *http.Request, kind, text string) (string, bool) {
+	verdict := moderation.Screen(r.Context(), moderation.Content{
+		Kind:  kind,
+		Org:   Context(r).PolicyOrg(),
+		World: GetWorldID(r),
+		HD1ID: r.Header.Get("X-HD1-ID"),
+		Text:  text,
+	})
+	if verdict.Action == moderation.Reject {
+		message := "Content rejected"
+		if verdict.Reason != "" {
+			message += ": " + verdict.Reason
+		}
+		http.Error(w, message, http.StatusUnprocessableEntity)
+		return "", false
+	}
+	return verdict.Text, true
+}
+
+// ScreenPanel screens a laid-out panel's content like entity text and lays
+// out what the policy left of it. A rejection is written to w as 422 and
+// returns false.
+func ScreenPanel(w http.ResponseWriter, r *http.Request, panel *panels.Panel) bool {
+	content, ok := ScreenText(w, r, moderation.KindEntityText, panel.Content)
+	if !ok {
+		return false
+	}
+	if content != panel.Content {
+		panel.Content = content
+		if err := panel.Layout(); err != nil {
+			http.Error(w, "Invalid panel: "+err.Error(), http.StatusBadRequest)
+			return false
+		}
+	}
+	return true
+}
+
+// CheckForm lays out a form, checks that the target it names is configured
+// and screens its title, labels and options like entity text. Answers are
+// submitted against the options, so text the policy would redact is
+// refused rather than rewritten. Refusals are written to w and return
+// false.
+func CheckForm(w http.ResponseWriter, r *http.Request, form *forms.Form) bool {
+	if err := form.Layout(); err != nil {
+		http.Error(w, "Invalid form: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if form.Target != "" {
+		if _, err := forms.LookupTarget(form.Target); err != nil {
+			http.Error(w, "Invalid form: "+err.Error()+": "+form.Target, http.StatusBadRequest)
+			return false
+		}
+	}
+	text := form.PlainText()
+	screened, ok := ScreenText(w, r, moderation.KindEntityText, text)
+	if !ok {
+		return false
+	}
+	if screened != text {
+		http.Error(w, "Content rejected: form text would be redacted", http.StatusUnprocessableEntity)
+		return false
+	}
+	return true
+}
+
+// GetBudgetKey returns the session an entity creation is charged to: the
+// caller's X-HD1-ID when that session is connected, its address otherwise,
+// so invented IDs cannot each claim a fresh budget
+func GetBudgetKey(r *http.Request) string {
+	if hd1ID := Context(r).Session; hd1ID != "" {
+		if hub := GetHubFromContext(r); hub != nil && hub.IsConnected(hd1ID) {
+			return hd1ID
+		}
+	}
+	return "ip:" + GetClientIP(r)
+}
+
+// StartParticles validates the particles component of entity operation data
+// and fixes its seed and start time in place. It returns how many particles
+// the emitter keeps alive, 0 without one. Invalid emitters are refused with
+// 400 and return false.
+func StartParticles(w http.ResponseWriter, data map[string]interface{}) (int, bool) {
+	value, ok := data["particles"]
+	if !ok || value == nil {
+		// null on an update removes the emitter
+		return 0, true
+	}
+	emitter, err := particles.Decode(value)
+	if err != nil {
+		http.Error(w, "Invalid particles: "+err.Error(), http.StatusBadRequest)
+		return 0, false
+	}
+	emitter.Start(simulation.Now())
+	data["particles"] = emitter.Data()
+	return emitter.Alive(), true
+}
+
+// StartMedia validates the media component of entity operation data and
+// fixes the time its position was taken at in place. Invalid media is
+// refused with 400 and returns false.
+func StartMedia(w http.ResponseWriter, data map[string]interface{}) bool {
+	value, ok := data["media"]
+	if !ok || value == nil {
+		// null on an update removes the screen
+		return true
+	}
+	component, err := media.Decode(value)
+	if err != nil {
+		http.Error(w, "Invalid media: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	component.Start(time.Now())
+	data["media"] = component.Data()
+	return true
+}
+
+// CheckBindings validates the bindings component of entity operation data
+// in place. Invalid bindings are refused with 400 and return false.
+func CheckBindings(w http.ResponseWriter, data map[string]interface{}) bool {
+	value, ok := data["bindings"]
+	if !ok || value == nil {
+		return true
+	}
+	component, err := bindings.Decode(value)
+	if err != nil {
+		http.Error(w, "Invalid bindings: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	data["bindings"] = component.Data()
+	return true
+}
+
+// CheckComponents validates the components of entity operation data
+// against their registered schemas. Components that do not match, or
+// without a schema when the registry is strict, are refused with 400 and
+// return false.
+func CheckComponents(w http.ResponseWriter, data map[string]interface{}) bool {
+	if err := components.Validate(data); err != nil {
+		http.Error(w, "Invalid component: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// CheckPluginComponents validates components set by name through the
+// entity API, which takes only plugin ones. Invalid components are refused
+// with 400 and return false.
+func CheckPluginComponents(w http.ResponseWriter, given map[string]interface{}) bool {
+	if err := components.Plugin(given); err != nil {
+		http.Error(w, "Invalid component: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// CheckPointCloud validates the pointcloud component of entity operation
+// data in place. Invalid components are refused with 400 and return false.
+func CheckPointCloud(w http.ResponseWriter, r *http.Request, data map[string]interface{}) bool {
+	value, ok := data["pointcloud"]
+	if !ok || value == nil {
+		return true
+	}
+	component, err := pointclouds.Decode(value)
+	if err != nil {
+		http.Error(w, "Invalid pointcloud: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if !CheckPointCloudSource(w, r, component) {
+		return false
+	}
+	data["pointcloud"] = component.Data()
+	return true
+}
+
+// CheckPointCloudSource validates a point cloud component, defaulting it in
+// place, and requires its source to be an uploaded point cloud. Invalid
+// components are refused with 400 and return false.
+func CheckPointCloudSource(w http.ResponseWriter, r *http.Request, component *pointclouds.PointCloud) bool {
+	if err := component.Validate(); err != nil {
+		http.Error(w, "Invalid pointcloud: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if backend := storage.Default(); backend != nil {
+		if cloud, err := assets.LoadPointCloud(r.Context(), backend, component.Digest()); err == nil && cloud == nil {
+			http.Error(w, "Invalid pointcloud: source is not a point cloud asset", http.StatusBadRequest)
+			return false
+		}
+	}
+	return true
+}
+
+// CheckTerrain validates the terrain component of entity operation data in
+// place. Invalid components are refused with 400 and return false.
+func CheckTerrain(w http.ResponseWriter, data map[string]interface{}) bool {
+	value, ok := data["terrain"]
+	if !ok || value == nil {
+		return true
+	}
+	terrain, err := geo.DecodeTerrain(value)
+	if err != nil {
+		http.Error(w, "Invalid terrain: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	data["terrain"] = terrain.Data()
+	return true
+}
+
+// ConstrainTransform applies the served world's editing constraints to the
+// position and rotation of entity operation data in place, naming the
+// properties it changed in the X-HD1-Constrained header
+func ConstrainTransform(w http.ResponseWriter, hub *server.Hub, data map[string]interface{}) {
+	rules := constraints.Get(config.GetWorldsDefaultWorld())
+	if !rules.Active() {
+		return
+	}
+	var entities map[string]*constraints.Entity
+	if len(rules.Surfaces) > 0 {
+		id, _ := data["id"].(string)
+		entities = constraints.Entities(hub.GetFullSync(), append(rules.Surfaces, id))
+	}
+	if changed := rules.Apply(data, entities); len(changed) > 0 {
+		w.Header().Set("X-HD1-Constrained", strings.Join(changed, ", "))
+	}
+}
+
+// ImportModel corrects the transform of an entity created with a model in
+// place, from the world's space: models are authored in the world's units
+// and up axis, and shown in HD1's
+func ImportModel(hub *server.Hub, data map[string]interface{}) {
+	if model, _ := data["model"].(string); model == "" {
+		return
+	}
+	units.FromLog(hub.GetFullSync()).ImportModel(data)
+}
+
+// AdmitEntity charges a new entity to the caller's creation budget and
+// the world's budgets. Over budget it releases the entity ID, writes 429 with Retry-After and
+// returns false.
+func AdmitEntity(w http.ResponseWriter, r *http.Request, entityID, geometryType string, params map[string]interface{}) bool {
+	err := throttle.Admit(GetBudgetKey(r), entityID, throttle.Triangles(geometryType, params))
+	if err == nil {
+		if err = usage.Admit(entityID); err == nil {
+			return true
+		}
+		throttle.Release(entityID)
+	}
+	entityid.Release(entityID)
+	if refusal, ok := err.(*throttle.Refusal); ok && refusal.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(refusal.RetryAfter.Seconds()))))
+	}
+	http.Error(w, "Entity creation refused: "+err.Error(), http.StatusTooManyRequests)
+	return false
+}
+
+// AllocateEntityID claims the ID for a new entity: the client's suggestion
+// when given and free, otherwise a server-issued one. Refusals are written
+// to w - 409 for a taken ID, 400 otherwise - and return false.
+func AllocateEntityID(w http.ResponseWriter, suggested, clientID string) (string, bool) {
+	id, reissued, err := entityid.Allocate(suggested, clientID)
+	if err == entityid.ErrConflict {
+		http.Error(w, "Entity ID already exists", http.StatusConflict)
+		return "", false
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	if reissued {
+		logging.Info("suggested entity id taken, reissued", map[string]interface{}{
+			"suggested": suggested,
+			"entity_id": id,
+			"hd1_id":    clientID,
+		})
+	}
+	return id, true
+}
+
+// IsOperator reports whether the caller may run moderation and repair
+// actions: local callers, and remote ones with the moderation token as
+// bearer token
+func IsOperator(r *http.Request) bool {
+	return Context(r).Operator
+}
+
+// RestoreMutex keeps rollbacks and reverts from interleaving: hold it from
+// reading the world state until its restoring operations are submitted
+var RestoreMutex stdSync.Mutex
+
+// SubmitRestore submits operations from worlds.Restore on behalf of a
+// client, claiming and releasing the entity IDs they recreate and delete
+func SubmitRestore(hub *server.Hub, operations []*sync.Operation, clientID string) {
+	for _, operation := range operations {
+		operation.ClientID = clientID
+		operation.Timestamp = time.Now()
+		id, _ := operation.Data["id"].(string)
+
+		if operation.Type == sync.OpEntityCreate {
+			if err := entityid.Claim(id, clientID); err != nil {
+				logging.Warn("restored entity id already live", map[string]interface{}{
+					"entity_id": id,
+				})
+			}
+		}
+		hub.GetSync().SubmitOperation(operation)
+		if operation.Type == sync.OpEntityDelete {
+			entityid.Release(id)
+			throttle.Release(id)
+		}
+	}
+}
+
+// CheckAvatarMove applies the movement limits to a move of an avatar, in
+// the world the operation log places it in. A clamped move updates
+// position and returns clamped; a rejected one writes 422 and returns
+// false.
+func CheckAvatarMove(w http.ResponseWriter, hub *server.Hub, avatarID string, position *Vector3) (clamped, ok bool) {
+	world := config.GetWorldsDefaultWorld()
+	if avatar, exists := hub.GetSync().GetAvatar(avatarID); exists && avatar.World != "" {
+		world = avatar.World
+	}
+	applied, violation := movement.Check(avatarID, world, movement.Position(*position))
+	if violation != nil && !violation.Clamped {
+		http.Error(w, "Impossible move: "+violation.Error(), http.StatusUnprocessableEntity)
+		return false, false
+	}
+	*position = Vector3(applied)
+	return violation != nil, true
+}
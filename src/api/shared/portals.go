@@ -0,0 +1,155 @@
+package shared
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+	"holodeck1/moderation"
+	"holodeck1/movement"
+	"holodeck1/portals"
+	"holodeck1/server"
+	"holodeck1/sync"
+	"holodeck1/views"
+)
+
+// CheckPortal checks that a portal leads somewhere this server can send
+// avatars, and screens its label like entity text. Refusals are written to
+// w and return false.
+func CheckPortal(w http.ResponseWriter, r *http.Request, portal *portals.Portal) bool {
+	if err := portal.Validate(); err != nil {
+		http.Error(w, "Invalid portal: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if err := portals.Reachable(portal.World); err != nil {
+		http.Error(w, "Invalid portal: "+err.Error()+": "+portal.World, http.StatusBadRequest)
+		return false
+	}
+	label, ok := ScreenText(w, r, moderation.KindEntityText, portal.Label)
+	if !ok {
+		return false
+	}
+	portal.Label = label
+	return true
+}
+
+// EnterPortals carries an avatar that a move took into a portal: within
+// the served world at once, to another server's world by handing it over
+func EnterPortals(hub *server.Hub, avatarID string, position Vector3) {
+	entityID, portal := portals.Enter(hub.GetSync(), avatarID, portals.Position(position))
+	if portal == nil {
+		return
+	}
+	if portal.World == config.GetWorldsDefaultWorld() {
+		teleport(hub, avatarID, entityID, portal)
+		return
+	}
+	go handOver(hub, avatarID, entityID, portal)
+}
+
+// teleport places an avatar at a portal's destination in the served world
+func teleport(hub *server.Hub, avatarID, entityID string, portal *portals.Portal) {
+	transfer := &server.PortalTransfer{
+		Portal:   entityID,
+		World:    portal.World,
+		Label:    portal.Label,
+		Position: portal.Position,
+		Yaw:      portal.Yaw,
+		Pitch:    portal.Pitch,
+	}
+	if portal.View != "" {
+		view, err := views.Get(portal.World, portal.View)
+		if err != nil {
+			transfer.Error = "view " + portal.View + " not found"
+			hub.SendPortalTransfer(avatarID, transfer)
+			return
+		}
+		transfer.Position = &portals.Position{X: view.Position.X, Y: view.Position.Y, Z: view.Position.Z}
+		transfer.Yaw, transfer.Pitch = view.Yaw, view.Pitch
+	}
+
+	PlaceAvatar(hub, avatarID, *transfer.Position, transfer.Yaw, transfer.Pitch)
+	hub.SendPortalTransfer(avatarID, transfer)
+
+	logging.Info("avatar passed through portal", map[string]interface{}{
+		"hd1_id": avatarID,
+		"portal": entityID,
+	})
+}
+
+// PlaceAvatar puts an avatar somewhere, facing a direction, without moving
+// it there: the jump is exempt from movement limits and does not carry it
+// through the portals it lands in
+func PlaceAvatar(hub *server.Hub, avatarID string, at portals.Position, yaw, pitch float64) *sync.Operation {
+	movement.Place(avatarID, movement.Position(at))
+	portals.Inside(avatarID, at)
+	operation := &sync.Operation{
+		ClientID: avatarID,
+		Type:     sync.OpAvatarMove,
+		Data: map[string]interface{}{
+			"hd1_id":   avatarID,
+			"position": at,
+			"rotation": map[string]float64{"x": pitch, "y": yaw, "z": 0},
+		},
+		Timestamp: time.Now(),
+	}
+	hub.GetSync().SubmitOperation(operation)
+	return operation
+}
+
+// handOver sends an avatar to the server of another world. Once that
+// server expects it, the avatar leaves this world and its session is sent
+// the link that joins the other.
+func handOver(hub *server.Hub, avatarID, entityID string, portal *portals.Portal) {
+	transfer := &server.PortalTransfer{Portal: entityID, World: portal.World, Label: portal.Label}
+	destination, err := portals.LookupDestination(portal.World)
+	if err != nil {
+		transfer.Error = err.Error()
+		hub.SendPortalTransfer(avatarID, transfer)
+		return
+	}
+	arrival := &portals.Arrival{
+		World:    portal.World,
+		From:     config.GetWorldsDefaultWorld(),
+		Portal:   entityID,
+		HD1ID:    avatarID,
+		Position: portal.Position,
+		View:     portal.View,
+		Yaw:      portal.Yaw,
+		Pitch:    portal.Pitch,
+	}
+	if avatar := hub.GetAvatarRegistry().FindAvatarByClientID(avatarID); avatar != nil {
+		arrival.Name = avatar.Name
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetPortalsTimeout())
+	defer cancel()
+	expected, err := portals.Send(ctx, destination, arrival)
+	if err != nil {
+		logging.Warn("portal handover failed", map[string]interface{}{
+			"hd1_id": avatarID,
+			"portal": entityID,
+			"world":  portal.World,
+			"error":  err.Error(),
+		})
+		transfer.Error = "the destination did not accept the arrival"
+		hub.SendPortalTransfer(avatarID, transfer)
+		return
+	}
+
+	transfer.URL = expected.Link
+	hub.SendPortalTransfer(avatarID, transfer)
+	hub.GetSync().UnregisterAvatar(avatarID, sync.LeavePortal)
+	movement.Forget(avatarID)
+	portals.Forget(avatarID)
+	hub.PublishPortal("departed", expected)
+
+	logging.Info("avatar handed over through portal", map[string]interface{}{
+		"hd1_id": avatarID,
+		"portal": entityID,
+		"world":  portal.World,
+		"server": destination.URL,
+	})
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"holodeck1/api/shared"
+	"holodeck1/config"
+	"holodeck1/holds"
+	"holodeck1/logging"
+	"holodeck1/storage"
+)
+
+// SignedURLRequest asks for direct access to one stored object
+type SignedURLRequest struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Method    string `json:"method,omitempty"`
+	ExpiresIn int    `json:"expires_in,omitempty"`
+}
+
+// SignedURLResponse carries the signed URL and its expiry
+type SignedURLResponse struct {
+	Success   bool      `json:"success"`
+	Backend   string    `json:"backend"`
+	Key       string    `json:"key"`
+	Method    string    `json:"method"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CreateSignedURL handles POST /api/storage/signed-url
+func CreateSignedURL(w http.ResponseWriter, r *http.Request) {
+	var req SignedURLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.Method == "" {
+		req.Method = http.MethodGet
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodPut {
+		http.Error(w, "Method must be GET or PUT", http.StatusBadRequest)
+		return
+	}
+
+	switch req.Namespace {
+	case storage.NamespaceAssets, storage.NamespaceRecordings, storage.NamespaceExports:
+	default:
+		http.Error(w, "Namespace not available for signed URLs", http.StatusBadRequest)
+		return
+	}
+	// Assets are content-addressed: uploads go through POST /api/assets,
+	// which checks their digest and scans them
+	if req.Namespace == storage.NamespaceAssets && req.Method == http.MethodPut {
+		http.Error(w, "Assets are uploaded through POST /api/assets", http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresIn < 0 || time.Duration(req.ExpiresIn)*time.Second > storage.MaxSignedURLTTL {
+		http.Error(w, "expires_in must be between 1 and "+strconv.Itoa(int(storage.MaxSignedURLTTL/time.Second))+" seconds", http.StatusBadRequest)
+		return
+	}
+	key, err := storage.Key(req.Namespace, req.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Held recordings must not be overwritten
+	if req.Namespace == storage.NamespaceRecordings && req.Method == http.MethodPut {
+		if err := holds.Check(holds.KindRecording, strings.TrimPrefix(key, storage.NamespaceRecordings+"/")); err != nil {
+			http.Error(w, "Recording is under legal hold", http.StatusConflict)
+			return
+		}
+	}
+
+	backend := storage.Default()
+	if backend == nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Downloads must point at an existing object
+	if req.Method == http.MethodGet {
+		if _, err := backend.Stat(r.Context(), key); err == storage.ErrNotFound {
+			http.Error(w, "Object not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	ttl := config.GetStorageSignedURLTTL()
+	if req.ExpiresIn > 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+
+	url, err := backend.SignedURL(key, req.Method, ttl)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := SignedURLResponse{
+		Success:   true,
+		Backend:   backend.Name(),
+		Key:       key,
+		Method:    req.Method,
+		URL:       url,
+		ExpiresAt: time.Now().Add(ttl).UTC(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+
+	logging.Info("signed storage URL issued", map[string]interface{}{
+		"key":     key,
+		"method":  req.Method,
+		"backend": backend.Name(),
+		"ttl":     ttl.String(),
+		"hd1_id":  shared.GetClientID(r),
+	})
+}
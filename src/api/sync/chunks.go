@@ -0,0 +1,59 @@
+package sync
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"holodeck1/chunks"
+	"holodeck1/logging"
+)
+
+// ChunkResponse represents the response for one chunk of a streamed world
+type ChunkResponse struct {
+	Success  bool                     `json:"success"`
+	Chunk    chunks.Key               `json:"chunk"`
+	Entities []map[string]interface{} `json:"entities"` // Merged create and update data
+	SeqNum   uint64                   `json:"seq_num"`  // Last operation the entities reflect
+}
+
+// GetChunk handles GET /api/sync/chunks/{chunk}, the entities of one chunk
+// of a world streamed in chunks, for clients that load chunks themselves
+func GetChunk(w http.ResponseWriter, r *http.Request) {
+	if !chunks.Enabled() {
+		http.Error(w, "Worlds are not streamed in chunks", http.StatusNotFound)
+		return
+	}
+	key, err := chunks.Parse(mux.Vars(r)["chunk"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get hub from context
+	hub := getHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	snapshot, err := chunks.Current(hub.GetSync())
+	if err != nil {
+		http.Error(w, "Operation log truncated, use /sync/full", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ChunkResponse{
+		Success:  true,
+		Chunk:    key,
+		Entities: snapshot.In(key),
+		SeqNum:   snapshot.SeqNum,
+	})
+
+	logging.Debug("chunk served", map[string]interface{}{
+		"chunk":    key.String(),
+		"entities": len(snapshot.Chunks[key]),
+		"seq_num":  snapshot.SeqNum,
+	})
+}
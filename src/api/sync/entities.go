@@ -0,0 +1,76 @@
+package sync
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"holodeck1/logging"
+	"holodeck1/worlds"
+)
+
+// maxResyncEntities bounds the entities one partial resync may request
+const maxResyncEntities = 1000
+
+// EntitiesResponse represents the response for a partial resync
+type EntitiesResponse struct {
+	Success  bool                     `json:"success"`
+	Entities []map[string]interface{} `json:"entities"` // Merged create and update data
+	Missing  []string                 `json:"missing"`  // Requested IDs not in the world
+	SeqNum   uint64                   `json:"seq_num"`  // Last operation the entities reflect
+}
+
+// GetEntities handles GET /api/sync/entities?ids=a,b,c
+func GetEntities(w http.ResponseWriter, r *http.Request) {
+	var ids []string
+	for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		http.Error(w, "ids is required", http.StatusBadRequest)
+		return
+	}
+	if len(ids) > maxResyncEntities {
+		http.Error(w, "Too many ids (max "+strconv.Itoa(maxResyncEntities)+")", http.StatusBadRequest)
+		return
+	}
+
+	// Get hub from context
+	hub := getHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	state, err := worlds.Replay(hub.GetFullSync())
+	if err != nil {
+		http.Error(w, "Operation log truncated, use /sync/full", http.StatusConflict)
+		return
+	}
+
+	response := EntitiesResponse{
+		Success:  true,
+		Entities: []map[string]interface{}{},
+		Missing:  []string{},
+		SeqNum:   state.SeqNum,
+	}
+	for _, id := range ids {
+		if entity, exists := state.Entities[id]; exists {
+			response.Entities = append(response.Entities, entity)
+		} else {
+			response.Missing = append(response.Missing, id)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+
+	logging.Debug("partial resync served", map[string]interface{}{
+		"requested": len(ids),
+		"entities":  len(response.Entities),
+		"seq_num":   state.SeqNum,
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"holodeck1/chunks"
 	"holodeck1/logging"
 )
 
@@ -12,9 +13,14 @@ type FullSyncResponse struct {
 	Success         bool                  `json:"success"`
 	Operations      []OperationWithSeqNum `json:"operations"`
 	CurrentSequence uint64                `json:"current_sequence"`
+	Chunks          *chunks.Manifest      `json:"chunks,omitempty"`  // When worlds are streamed in chunks
+	Chunked         bool                  `json:"chunked,omitempty"` // Entity operations left to chunk loads
 }
 
-// GetFullSync handles GET /api/sync/full
+// GetFullSync handles GET /api/sync/full. When worlds are streamed in
+// chunks the response carries the chunk manifest, and ?chunked=true leaves
+// out the operations of single entities, which the client is sent with the
+// chunks it loads.
 func GetFullSync(w http.ResponseWriter, r *http.Request) {
 	// Get hub from context
 	hub := getHubFromContext(r)
@@ -27,9 +33,20 @@ func GetFullSync(w http.ResponseWriter, r *http.Request) {
 	operations := hub.GetSync().GetAllOperations()
 	currentSeq := hub.GetSync().GetCurrentSequence()
 
+	var manifest *chunks.Manifest
+	if chunks.Enabled() {
+		if snapshot, err := chunks.Current(hub.GetSync()); err == nil {
+			manifest = snapshot.Manifest()
+		}
+	}
+	chunked := manifest != nil && r.URL.Query().Get("chunked") == "true"
+
 	// Convert to response format
-	var operationsWithSeq []OperationWithSeqNum
+	operationsWithSeq := []OperationWithSeqNum{}
 	for _, op := range operations {
+		if chunked && chunks.Scoped(op) {
+			continue
+		}
 		operationsWithSeq = append(operationsWithSeq, OperationWithSeqNum{
 			SeqNum:    op.SeqNum,
 			Operation: op,
@@ -41,13 +58,16 @@ func GetFullSync(w http.ResponseWriter, r *http.Request) {
 		Success:         true,
 		Operations:      operationsWithSeq,
 		CurrentSequence: currentSeq,
+		Chunks:          manifest,
+		Chunked:         chunked,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 
 	logging.Info("full sync retrieved via API", map[string]interface{}{
-		"count":            len(operations),
+		"count":            len(operationsWithSeq),
 		"current_sequence": currentSeq,
+		"chunked":          chunked,
 	})
 }
\ No newline at end of file
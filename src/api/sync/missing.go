@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"holodeck1/logging"
@@ -12,10 +13,14 @@ import (
 
 // MissingOperationsResponse represents the response for missing operations
 type MissingOperationsResponse struct {
-	Success    bool                   `json:"success"`
-	Operations []OperationWithSeqNum  `json:"operations"`
+	Success         bool                   `json:"success"`
+	Operations      []OperationWithSeqNum  `json:"operations"`
+	CurrentSequence uint64                 `json:"current_sequence"`
 }
 
+// maxMissingWait caps ?wait=, below the read timeouts of common proxies
+const maxMissingWait = 60 * time.Second
+
 // OperationWithSeqNum represents an operation with its sequence number
 type OperationWithSeqNum struct {
 	SeqNum    uint64           `json:"seq_num"`
@@ -59,6 +64,16 @@ func GetMissingOperations(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A long poll for operations not yet sequenced waits for the first
+	if waitStr := r.URL.Query().Get("wait"); waitStr != "" {
+		wait, err := parseWait(waitStr)
+		if err != nil {
+			http.Error(w, "Invalid 'wait' parameter", http.StatusBadRequest)
+			return
+		}
+		waitForOperation(r, hub.GetSync(), from, wait)
+	}
+	
 	// Get missing operations
 	operations := hub.GetSync().GetMissingOperations(from, to)
 
@@ -73,8 +88,9 @@ func GetMissingOperations(w http.ResponseWriter, r *http.Request) {
 
 	// Return response
 	response := MissingOperationsResponse{
-		Success:    true,
-		Operations: operationsWithSeq,
+		Success:         true,
+		Operations:      operationsWithSeq,
+		CurrentSequence: hub.GetSync().GetCurrentSequence(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -85,4 +101,46 @@ func GetMissingOperations(w http.ResponseWriter, r *http.Request) {
 		"to":    to,
 		"count": len(operations),
 	})
-}
\ No newline at end of file
+}
+
+// parseWait reads ?wait= as a duration ("30s") or whole seconds ("30"),
+// capped at maxMissingWait
+func parseWait(value string) (time.Duration, error) {
+	wait, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, convErr := strconv.ParseUint(value, 10, 32)
+		if convErr != nil {
+			return 0, err
+		}
+		wait = time.Duration(seconds) * time.Second
+	}
+	if wait < 0 {
+		return 0, strconv.ErrRange
+	}
+	if wait > maxMissingWait {
+		wait = maxMissingWait
+	}
+	return wait, nil
+}
+
+// waitForOperation blocks until operation from is sequenced, the wait is
+// over or the caller goes away
+func waitForOperation(r *http.Request, reliable *sync.ReliableSync, from uint64, wait time.Duration) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		// Taken before the check, so an operation sequenced in between
+		// still wakes the wait
+		sequenced := reliable.Sequenced()
+		if reliable.GetCurrentSequence() >= from {
+			return
+		}
+		select {
+		case <-sequenced:
+		case <-timer.C:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -5,9 +5,17 @@ import (
 	"net/http"
 	"time"
 
+	"holodeck1/api/shared"
+	"holodeck1/entityid"
+	"holodeck1/forms"
 	"holodeck1/logging"
+	"holodeck1/moderation"
+	"holodeck1/panels"
+	"holodeck1/portals"
 	"holodeck1/server"
 	"holodeck1/sync"
+	"holodeck1/throttle"
+	"holodeck1/whiteboard"
 )
 
 // SubmitOperationRequest represents the request to submit an operation
@@ -18,9 +26,10 @@ type SubmitOperationRequest struct {
 
 // SubmitOperationResponse represents the response after submitting an operation
 type SubmitOperationResponse struct {
-	Success bool   `json:"success"`
-	SeqNum  uint64 `json:"seq_num"`
-	Message string `json:"message"`
+	Success  bool   `json:"success"`
+	SeqNum   uint64 `json:"seq_num"`
+	EntityID string `json:"entity_id,omitempty"` // Issued ID for entity_create
+	Message  string `json:"message"`
 }
 
 // SubmitOperation handles POST /api/sync/operations
@@ -31,24 +40,20 @@ func SubmitOperation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate operation type
-	validTypes := map[string]bool{
-		"avatar_create": true,
-		"avatar_remove": true,
-		"avatar_move":   true,
-		"entity_create": true,
-		"entity_update": true,
-		"entity_delete": true,
-		"scene_update":  true,
-	}
+	// Get client ID from request (could be from session, header, etc.)
+	clientID := getClientID(r)
 
-	if !validTypes[req.Type] {
-		http.Error(w, "Invalid operation type", http.StatusBadRequest)
+	// Get hub from context (needs to be injected by router)
+	hub := getHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	// Get client ID from request (could be from session, header, etc.)
-	clientID := getClientID(r)
+	entityID, ok := prepareOperation(w, r, hub, &req, clientID)
+	if !ok {
+		return
+	}
 
 	// Create operation
 	operation := &sync.Operation{
@@ -58,21 +63,25 @@ func SubmitOperation(w http.ResponseWriter, r *http.Request) {
 		Timestamp: time.Now(),
 	}
 
-	// Get hub from context (needs to be injected by router)
-	hub := getHubFromContext(r)
-	if hub == nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-
 	// Submit operation to sync system
 	hub.GetSync().SubmitOperation(operation)
+	if req.Type == sync.OpEntityDelete {
+		entityid.Release(req.Data["id"].(string))
+		throttle.Release(req.Data["id"].(string))
+	}
+	if req.Type == sync.OpAvatarMove {
+		avatarID, _ := req.Data["hd1_id"].(string)
+		if position, ok := rawPosition(req.Data["position"]); ok && avatarID != "" {
+			shared.EnterPortals(hub, avatarID, position)
+		}
+	}
 
 	// Return response
 	response := SubmitOperationResponse{
-		Success: true,
-		SeqNum:  operation.SeqNum,
-		Message: "Operation submitted",
+		Success:  true,
+		SeqNum:   operation.SeqNum,
+		EntityID: entityID,
+		Message:  "Operation submitted",
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -86,9 +95,165 @@ func SubmitOperation(w http.ResponseWriter, r *http.Request) {
 }
 
 // Helper functions
+
+// prepareOperation validates operation data as submitted through the API,
+// screening text, laying out panels and issuing entity IDs. Refusals are
+// written to w and return false; creates return the ID they claimed.
+func prepareOperation(w http.ResponseWriter, r *http.Request, hub *server.Hub, req *SubmitOperationRequest, clientID string) (string, bool) {
+	// The type must be registered and open to clients; its handlers check
+	// what they can without the request
+	if err := sync.CheckSubmission(req.Type, req.Data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+
+	// Raw operations can carry text geometry; screen it as the entity API does
+	if geometry, isMap := req.Data["geometry"].(map[string]interface{}); isMap && req.Type != sync.OpEntityDelete {
+		if text, isString := geometry["text"].(string); isString {
+			screened, ok := shared.ScreenText(w, r, moderation.KindEntityText, text)
+			if !ok {
+				return "", false
+			}
+			geometry["text"] = screened
+		}
+	}
+
+	// Panels are laid out by the server and screened like text geometry
+	if value, ok := req.Data["panel"]; ok && value != nil && req.Type != sync.OpEntityDelete {
+		panel, err := panels.Decode(value)
+		if err != nil {
+			http.Error(w, "Invalid panel: "+err.Error(), http.StatusBadRequest)
+			return "", false
+		}
+		if !shared.ScreenPanel(w, r, panel) {
+			return "", false
+		}
+		req.Data["panel"] = panel.Data()
+	}
+
+	// Whiteboards are created whole; their strokes then change by delta
+	if value, ok := req.Data["whiteboard"]; ok && value != nil && req.Type != sync.OpEntityDelete {
+		board, err := whiteboard.Decode(value)
+		if err != nil {
+			http.Error(w, "Invalid whiteboard: "+err.Error(), http.StatusBadRequest)
+			return "", false
+		}
+		req.Data["whiteboard"] = board.Data()
+	}
+
+	// Forms are laid out from their schema and screened like panels
+	if value, ok := req.Data["form"]; ok && value != nil && req.Type != sync.OpEntityDelete {
+		form, err := forms.Decode(value)
+		if err != nil {
+			http.Error(w, "Invalid form: "+err.Error(), http.StatusBadRequest)
+			return "", false
+		}
+		if !shared.CheckForm(w, r, form) {
+			return "", false
+		}
+		req.Data["form"] = form.Data()
+	}
+
+	// Portals must lead to the served world or a configured server
+	if value, ok := req.Data["portal"]; ok && value != nil && req.Type != sync.OpEntityDelete {
+		portal, err := portals.Decode(value)
+		if err != nil {
+			http.Error(w, "Invalid portal: "+err.Error(), http.StatusBadRequest)
+			return "", false
+		}
+		if !shared.CheckPortal(w, r, portal) {
+			return "", false
+		}
+		req.Data["portal"] = portal.Data()
+	}
+
+	// Entity IDs are issued here too, so raw operations can't collide
+	var entityID string
+	switch req.Type {
+	case sync.OpEntityCreate:
+		if req.Data == nil {
+			req.Data = make(map[string]interface{})
+		}
+		suggested, isString := req.Data["id"].(string)
+		if req.Data["id"] != nil && !isString {
+			http.Error(w, "Entity ID must be a string", http.StatusBadRequest)
+			return "", false
+		}
+		if !shared.CheckComponents(w, req.Data) {
+			return "", false
+		}
+		alive, ok := shared.StartParticles(w, req.Data)
+		if !ok || !shared.StartMedia(w, req.Data) || !shared.CheckBindings(w, req.Data) ||
+			!shared.CheckPointCloud(w, r, req.Data) || !shared.CheckTerrain(w, req.Data) {
+			return "", false
+		}
+		id, ok := shared.AllocateEntityID(w, suggested, clientID)
+		if !ok {
+			return "", false
+		}
+		geometry, _ := req.Data["geometry"].(map[string]interface{})
+		geometryType, _ := geometry["type"].(string)
+		params := map[string]interface{}{"particles": alive}
+		for key, value := range geometry {
+			params[key] = value
+		}
+		if !shared.AdmitEntity(w, r, id, geometryType, params) {
+			return "", false
+		}
+		entityID = id
+		req.Data["id"] = id
+		shared.ConstrainTransform(w, hub, req.Data)
+		shared.ImportModel(hub, req.Data)
+	case sync.OpEntityUpdate, sync.OpEntityDelete:
+		if id, _ := req.Data["id"].(string); id == "" {
+			http.Error(w, "Entity ID required", http.StatusBadRequest)
+			return "", false
+		}
+		if req.Type == sync.OpEntityUpdate && !shared.CheckComponents(w, req.Data) {
+			return "", false
+		}
+		if _, ok := shared.StartParticles(w, req.Data); !ok || !shared.StartMedia(w, req.Data) || !shared.CheckBindings(w, req.Data) ||
+			!shared.CheckPointCloud(w, r, req.Data) || !shared.CheckTerrain(w, req.Data) {
+			return "", false
+		}
+		if req.Type == sync.OpEntityUpdate {
+			shared.ConstrainTransform(w, hub, req.Data)
+		}
+	case sync.OpWhiteboardDelta:
+		if id, _ := req.Data["id"].(string); id == "" {
+			http.Error(w, "Entity ID required", http.StatusBadRequest)
+			return "", false
+		}
+	case sync.OpSceneUpdate:
+		// Physics, space, geo and environment are checked by their handlers
+		if _, ok := req.Data["clock"]; ok {
+			http.Error(w, "The clock is set with /worlds/{worldId}/clock", http.StatusBadRequest)
+			return "", false
+		}
+	case sync.OpAvatarMove:
+		avatarID, _ := req.Data["hd1_id"].(string)
+		if position, ok := rawPosition(req.Data["position"]); ok && avatarID != "" {
+			if _, ok := shared.CheckAvatarMove(w, hub, avatarID, &position); !ok {
+				return "", false
+			}
+			req.Data["position"] = map[string]interface{}{"x": position.X, "y": position.Y, "z": position.Z}
+		}
+	}
+	return entityID, true
+}
+
+// rawPosition reads an {x, y, z} position from operation data
+func rawPosition(value interface{}) (shared.Vector3, bool) {
+	position, _ := value.(map[string]interface{})
+	x, xOK := position["x"].(float64)
+	y, yOK := position["y"].(float64)
+	z, zOK := position["z"].(float64)
+	return shared.Vector3{X: x, Y: y, Z: z}, xOK && yOK && zOK
+}
+
 func getClientID(r *http.Request) string {
 	// Try to get client ID from various sources
-	if clientID := r.Header.Get("X-HD1-ID"); clientID != "" {
+	if clientID := shared.Context(r).Session; clientID != "" {
 		return clientID
 	}
 	
@@ -3,6 +3,8 @@ package sync
 import (
 	"encoding/json"
 	"net/http"
+
+	"holodeck1/signing"
 )
 
 // SyncStatsResponse represents the response for sync statistics
@@ -22,6 +24,9 @@ func GetSyncStats(w http.ResponseWriter, r *http.Request) {
 
 	// Get statistics from hub
 	stats := hub.GetStats()
+	if signing.Enabled() {
+		stats["replay"] = signing.Replays()
+	}
 
 	// Return response
 	response := SyncStatsResponse{
@@ -0,0 +1,154 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"holodeck1/logging"
+	"holodeck1/server"
+	"holodeck1/sync"
+)
+
+// streamKeepAlive is how often an idle stream gets a comment, so proxies
+// and load balancers do not time it out
+const streamKeepAlive = 15 * time.Second
+
+// streams numbers stream consumers, which register with the sync system
+// under their own ID
+var streams atomic.Uint64
+
+// GetSyncStream handles GET /api/sync/stream, the operation feed as
+// Server-Sent Events
+func GetSyncStream(w http.ResponseWriter, r *http.Request) {
+	hub := getHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	// EventSource sends the last ID it saw when it reconnects
+	var last uint64
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	if lastEventID != "" {
+		parsed, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		last = parsed
+	}
+
+	// Registered before the backlog is read, so nothing falls in between
+	reliable := hub.GetSync()
+	consumer := fmt.Sprintf("sse-%d", streams.Add(1))
+	operations := reliable.RegisterClient(consumer)
+	defer reliable.UnregisterClient(consumer)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	current := reliable.GetCurrentSequence()
+	if last > current {
+		// A log from before a restart; this one starts over
+		writeStreamReset(w, "sequence_restarted")
+		last = 0
+	}
+	sent := last
+	if err := writeStreamBacklog(w, reliable, &sent, current); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	logging.Info("sync stream opened", map[string]interface{}{
+		"consumer":    consumer,
+		"remote_ip":   server.ClientIP(r),
+		"from_seq":    last + 1,
+		"current_seq": current,
+	})
+	defer logging.Info("sync stream closed", map[string]interface{}{
+		"consumer": consumer,
+	})
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if server.IsDraining() {
+				return
+			}
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case op, ok := <-operations:
+			if !ok {
+				return
+			}
+			if op.SeqNum <= sent {
+				continue
+			}
+			// Operations dropped on a full channel are read back from the log
+			if err := writeStreamBacklog(w, reliable, &sent, op.SeqNum-1); err != nil {
+				return
+			}
+			if err := writeStreamOperation(w, op); err != nil {
+				return
+			}
+			sent = op.SeqNum
+			flusher.Flush()
+		}
+	}
+}
+
+// writeStreamBacklog writes the stored operations after sent up to to,
+// with a reset first when some are no longer stored
+func writeStreamBacklog(w http.ResponseWriter, reliable *sync.ReliableSync, sent *uint64, to uint64) error {
+	if to <= *sent {
+		return nil
+	}
+	backlog := reliable.GetMissingOperations(*sent+1, to)
+	if len(backlog) == 0 || backlog[0].SeqNum != *sent+1 {
+		writeStreamReset(w, "operations_truncated")
+	}
+	for _, op := range backlog {
+		if err := writeStreamOperation(w, op); err != nil {
+			return err
+		}
+		*sent = op.SeqNum
+	}
+	*sent = to
+	return nil
+}
+
+// writeStreamOperation writes one operation as an event
+func writeStreamOperation(w http.ResponseWriter, op *sync.Operation) error {
+	data, err := json.Marshal(op)
+	if err != nil {
+		return nil // Skipped; nothing a consumer could do with it
+	}
+	_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", op.SeqNum, data)
+	return err
+}
+
+// writeStreamReset tells the consumer it missed operations and should
+// rebuild from /sync/full
+func writeStreamReset(w http.ResponseWriter, reason string) {
+	fmt.Fprintf(w, "event: reset\ndata: {\"reason\":%q}\n\n", reason)
+}
@@ -0,0 +1,217 @@
+package sync
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"holodeck1/api/shared"
+	"holodeck1/entityid"
+	"holodeck1/logging"
+	"holodeck1/sync"
+	"holodeck1/throttle"
+	"holodeck1/transactions"
+)
+
+// transactionTypes are the operations a transaction may queue
+var transactionTypes = map[string]bool{
+	sync.OpEntityCreate: true,
+	sync.OpEntityUpdate: true,
+	sync.OpEntityDelete: true,
+}
+
+// TransactionResponse returns an open transaction
+type TransactionResponse struct {
+	Success     bool                      `json:"success"`
+	Transaction *transactions.Transaction `json:"transaction"`
+}
+
+// QueueResponse reports a queued operation
+type QueueResponse struct {
+	Success  bool   `json:"success"`
+	Index    int    `json:"index"`               // Position in the transaction
+	EntityID string `json:"entity_id,omitempty"` // Issued ID for entity_create
+}
+
+// CommitResponse reports a committed transaction
+type CommitResponse struct {
+	Success       bool     `json:"success"`
+	TransactionID string   `json:"transaction_id"`
+	SeqNum        uint64   `json:"seq_num"` // The one sequence number of all its operations
+	Operations    int      `json:"operations"`
+	EntityIDs     []string `json:"entity_ids"` // Issued for its creates
+}
+
+// BeginTransaction handles POST /api/sync/transactions
+func BeginTransaction(w http.ResponseWriter, r *http.Request) {
+	t := transactions.Begin(shared.Context(r).User())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(TransactionResponse{Success: true, Transaction: t})
+}
+
+// GetTransaction handles GET /api/sync/transactions/{transactionId}
+func GetTransaction(w http.ResponseWriter, r *http.Request) {
+	t, err := transactions.Get(mux.Vars(r)["transactionId"], shared.Context(r).User())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TransactionResponse{Success: true, Transaction: t})
+}
+
+// QueueTransactionOperation handles POST
+// /api/sync/transactions/{transactionId}/operations. The operation is
+// validated as SubmitOperation would, but only applied on commit.
+func QueueTransactionOperation(w http.ResponseWriter, r *http.Request) {
+	var req SubmitOperationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if !transactionTypes[req.Type] {
+		http.Error(w, "Transactions hold entity_create, entity_update and entity_delete operations", http.StatusBadRequest)
+		return
+	}
+
+	id := mux.Vars(r)["transactionId"]
+	owner := shared.Context(r).User()
+	if !transactionError(w, transactions.Room(id, owner)) {
+		return
+	}
+
+	hub := getHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	entityID, ok := prepareOperation(w, r, hub, &req, getClientID(r))
+	if !ok {
+		return
+	}
+
+	index, err := transactions.Queue(id, owner, transactions.Operation{Type: req.Type, Data: req.Data}, entityID)
+	if err != nil && entityID != "" {
+		// Expired or filled meanwhile; the create's claim goes with it
+		entityid.Release(entityID)
+		throttle.Release(entityID)
+	}
+	if !transactionError(w, err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(QueueResponse{Success: true, Index: index, EntityID: entityID})
+}
+
+// CommitTransaction handles POST /api/sync/transactions/{transactionId}/commit,
+// submitting the queued operations as one operation. Updates and deletes of
+// entities gone by then fail the commit, and the transaction rolls back.
+func CommitTransaction(w http.ResponseWriter, r *http.Request) {
+	hub := getHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	t, err := transactions.Take(mux.Vars(r)["transactionId"], shared.Context(r).User())
+	if !transactionError(w, err) {
+		return
+	}
+	if missing := missingEntity(t); missing != "" {
+		transactions.Release(t)
+		http.Error(w, "Transaction rolled back: entity "+missing+" no longer exists", http.StatusConflict)
+		return
+	}
+
+	clientID := getClientID(r)
+	parts := make([]*sync.Operation, len(t.Operations))
+	for i, queued := range t.Operations {
+		parts[i] = &sync.Operation{ClientID: clientID, Type: queued.Type, Data: queued.Data}
+	}
+	operation := sync.NewTransaction(clientID, t.ID, parts)
+	hub.GetSync().SubmitOperation(operation)
+	for _, part := range parts {
+		if part.Type == sync.OpEntityDelete {
+			entityid.Release(part.Data["id"].(string))
+			throttle.Release(part.Data["id"].(string))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CommitResponse{
+		Success:       true,
+		TransactionID: t.ID,
+		SeqNum:        operation.SeqNum,
+		Operations:    len(parts),
+		EntityIDs:     append([]string{}, t.Created...),
+	})
+
+	logging.Info("transaction committed", map[string]interface{}{
+		"transaction_id": t.ID,
+		"hd1_id":         clientID,
+		"operations":     len(parts),
+		"seq_num":        operation.SeqNum,
+	})
+}
+
+// RollbackTransaction handles DELETE /api/sync/transactions/{transactionId}
+func RollbackTransaction(w http.ResponseWriter, r *http.Request) {
+	err := transactions.Rollback(mux.Vars(r)["transactionId"], shared.Context(r).User())
+	if !transactionError(w, err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Transaction rolled back",
+	})
+}
+
+// missingEntity returns the first entity a transaction updates or deletes
+// that will not exist when it applies: neither live nor created before in
+// the transaction, or deleted before in it
+func missingEntity(t *transactions.Transaction) string {
+	exists := map[string]bool{}
+	for _, queued := range t.Operations {
+		id, _ := queued.Data["id"].(string)
+		live, known := exists[id]
+		if !known {
+			live = entityid.Live(id)
+		}
+		switch queued.Type {
+		case sync.OpEntityCreate:
+			exists[id] = true
+		case sync.OpEntityUpdate:
+			if !live {
+				return id
+			}
+		case sync.OpEntityDelete:
+			if !live {
+				return id
+			}
+			exists[id] = false
+		}
+	}
+	return ""
+}
+
+// transactionError writes the status of a transactions error and reports
+// whether there was none
+func transactionError(w http.ResponseWriter, err error) bool {
+	switch err {
+	case nil:
+		return true
+	case transactions.ErrNotFound:
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+	case transactions.ErrFull, transactions.ErrEmpty:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+package sync
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"holodeck1/api/shared"
+	"holodeck1/config"
+	"holodeck1/entityid"
+	"holodeck1/logging"
+	"holodeck1/moderation"
+	"holodeck1/server"
+	"holodeck1/sync"
+	"holodeck1/throttle"
+	"holodeck1/webhooks"
+)
+
+// WebhookResponse reports a delivery's changes
+type WebhookResponse struct {
+	Success    bool     `json:"success"`
+	Webhook    string   `json:"webhook"`
+	World      string   `json:"world"`
+	SeqNum     uint64   `json:"seq_num,omitempty"` // Of the operation applying its entity changes
+	Operations int      `json:"operations"`
+	Messages   int      `json:"messages"`
+	EntityIDs  []string `json:"entity_ids"` // Issued for its creates
+	Skipped    []string `json:"skipped,omitempty"`
+}
+
+// ListWebhooks handles GET /api/webhooks
+func ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"webhooks": webhooks.List(),
+	})
+}
+
+// ReceiveWebhook handles POST /api/webhooks/{webhookId}. The delivery's
+// entity changes are validated as SubmitOperation would and applied as one
+// transaction; its chat messages are screened and posted after.
+func ReceiveWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, delivery, ok := readDelivery(w, r)
+	if !ok {
+		return
+	}
+	if !webhook.Verify(r, delivery.body) && !shared.Context(r).Operator {
+		http.Error(w, "Invalid webhook signature", http.StatusUnauthorized)
+		return
+	}
+	if world := webhook.TargetWorld(); world != config.GetWorldsDefaultWorld() {
+		http.Error(w, "Webhook changes world "+world+", which this server does not serve", http.StatusConflict)
+		return
+	}
+	webhook.Lock()
+	defer webhook.Unlock()
+	plan, err := webhook.Plan(delivery.Delivery)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	hub := getHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	clientID := "webhook-" + webhook.Name
+	parts := make([]*sync.Operation, 0, len(plan.Operations))
+	created := []string{}
+	release := func() {
+		for _, id := range created {
+			entityid.Release(id)
+			throttle.Release(id)
+		}
+	}
+	for _, planned := range plan.Operations {
+		req := SubmitOperationRequest{Type: planned.Type, Data: planned.Data}
+		entityID, ok := prepareOperation(w, r, hub, &req, clientID)
+		if !ok {
+			release()
+			return
+		}
+		if entityID != "" {
+			created = append(created, entityID)
+		}
+		parts = append(parts, &sync.Operation{ClientID: clientID, Type: req.Type, Data: req.Data, Timestamp: time.Now()})
+	}
+	messages := make([]server.ChatMessage, len(plan.Messages))
+	for i, message := range plan.Messages {
+		text, ok := shared.ScreenText(w, r, moderation.KindChat, message.Text)
+		if !ok {
+			release()
+			return
+		}
+		messages[i] = server.ChatMessage{From: message.From, Text: text, Source: "webhook:" + webhook.Name}
+	}
+
+	response := WebhookResponse{
+		Success:    true,
+		Webhook:    webhook.Name,
+		World:      plan.World,
+		Operations: len(parts),
+		Messages:   len(messages),
+		EntityIDs:  created,
+		Skipped:    plan.Skipped,
+	}
+	if len(parts) > 0 {
+		operation := parts[0]
+		if len(parts) > 1 {
+			operation = sync.NewTransaction(clientID, "webhook-"+uuid.New().String(), parts)
+		}
+		hub.GetSync().SubmitOperation(operation)
+		for _, part := range parts {
+			if part.Type == sync.OpEntityDelete {
+				entityid.Release(part.Data["id"].(string))
+				throttle.Release(part.Data["id"].(string))
+			}
+		}
+		response.SeqNum = operation.SeqNum
+	}
+	webhook.Commit(plan)
+	for _, message := range messages {
+		hub.PublishChat(message)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+
+	logging.Info("webhook delivered", map[string]interface{}{
+		"webhook":    webhook.Name,
+		"remote_ip":  server.ClientIP(r),
+		"operations": len(parts),
+		"messages":   len(messages),
+		"skipped":    len(plan.Skipped),
+		"seq_num":    response.SeqNum,
+	})
+}
+
+// TestWebhook handles POST /api/webhooks/{webhookId}/test, rendering a
+// sample delivery without applying it. The request stands in for the
+// sender's: its body, headers and query are what the rules see.
+func TestWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, delivery, ok := readDelivery(w, r)
+	if !ok {
+		return
+	}
+	plan, err := webhook.Plan(delivery.Delivery)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"served":  plan.World == config.GetWorldsDefaultWorld(),
+		"plan":    plan,
+	})
+}
+
+// webhookDelivery is a decoded delivery and the body it was decoded from
+type webhookDelivery struct {
+	*webhooks.Delivery
+	body []byte
+}
+
+// readDelivery finds a request's webhook and decodes its body, writing
+// why when it cannot
+func readDelivery(w http.ResponseWriter, r *http.Request) (*webhooks.Webhook, *webhookDelivery, bool) {
+	webhook, err := webhooks.Get(mux.Vars(r)["webhookId"])
+	if err != nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, webhooks.MaxPayload+1))
+	if err != nil {
+		http.Error(w, "Invalid body", http.StatusBadRequest)
+		return nil, nil, false
+	}
+	if len(body) > webhooks.MaxPayload {
+		http.Error(w, "Payload too large", http.StatusRequestEntityTooLarge)
+		return nil, nil, false
+	}
+	delivery, err := webhooks.Decode(r, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, nil, false
+	}
+	return webhook, &webhookDelivery{Delivery: delivery, body: body}, true
+}
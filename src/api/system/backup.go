@@ -0,0 +1,183 @@
+package system
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"holodeck1/api/shared"
+	"holodeck1/backup"
+	"holodeck1/config"
+	"holodeck1/logging"
+	"holodeck1/server"
+	"holodeck1/worlds"
+)
+
+// RestoreResponse reports a restore
+type RestoreResponse struct {
+	Success bool `json:"success"`
+	*backup.Result
+}
+
+// GetBackupHandler - GET /system/backup. The archive is written to a
+// temporary file first, so a failure is an error status rather than a
+// truncated download.
+func GetBackupHandler(w http.ResponseWriter, r *http.Request, hub interface{}) {
+	h, ok := hub.(*server.Hub)
+	if !ok {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	sections, err := backup.ParseSections(r.URL.Query().Get("sections"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	world := config.GetWorldsDefaultWorld()
+	var state *worlds.State
+	for _, section := range sections {
+		if section != backup.SectionWorld {
+			continue
+		}
+		if state, err = worlds.Replay(h.GetFullSync()); err == worlds.ErrTruncatedLog {
+			http.Error(w, "Operation log truncated, world state unavailable", http.StatusConflict)
+			return
+		}
+	}
+
+	file, err := os.CreateTemp("", "hd1-backup-")
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	manifest, err := backup.Write(r.Context(), file, world, state, sections)
+	if err != nil {
+		logging.Error("backup failed", map[string]interface{}{
+			"sections": sections,
+			"error":    err.Error(),
+		})
+		http.Error(w, "Backup failed: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	name := fmt.Sprintf("hd1-backup-%s.tar.gz", manifest.CreatedAt.Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Header().Set("Cache-Control", "no-store")
+	io.Copy(w, file)
+
+	logging.Info("backup created", map[string]interface{}{
+		"sections":  sections,
+		"files":     len(manifest.Entries),
+		"bytes":     size,
+		"seq_num":   manifest.SeqNum,
+		"remote_ip": shared.GetClientIP(r),
+	})
+}
+
+// RestoreBackupHandler - POST /system/restore
+func RestoreBackupHandler(w http.ResponseWriter, r *http.Request, hub interface{}) {
+	h, ok := hub.(*server.Hub)
+	if !ok {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	query := r.URL.Query()
+	options := backup.Options{
+		SkipExisting: query.Get("skip_existing") == "true",
+		DryRun:       query.Get("dry_run") == "true",
+	}
+	if list := query.Get("sections"); list != "" {
+		sections, err := backup.ParseSections(list)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		options.Sections = sections
+	}
+
+	archive, err := backup.Open(r.Body)
+	if errors.Is(err, backup.ErrInvalidArchive) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer archive.Close()
+	if options.Sections == nil {
+		options.Sections = archive.Manifest.Sections
+	}
+	for _, section := range options.Sections {
+		if !archive.Manifest.Has(section) {
+			http.Error(w, "Section not in the archive: "+section, http.StatusBadRequest)
+			return
+		}
+	}
+
+	clientID := shared.GetClientID(r)
+	applyWorld := func(state *worlds.State) (int, error) {
+		shared.RestoreMutex.Lock()
+		defer shared.RestoreMutex.Unlock()
+		current, err := worlds.Replay(h.GetFullSync())
+		if err != nil {
+			return 0, err
+		}
+		// Keep the state being replaced, so the restore can be undone
+		label := "Before restore of backup from " + archive.Manifest.CreatedAt.Format(time.RFC3339)
+		checkpoint, err := worlds.NewCheckpoint(config.GetWorldsDefaultWorld(), label, clientID, current)
+		if err == nil {
+			err = worlds.SaveCheckpoint(r.Context(), checkpoint)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("save checkpoint: %v", err)
+		}
+		operations := worlds.Restore(current, state)
+		shared.SubmitRestore(h, operations, clientID)
+		return len(operations), nil
+	}
+
+	result, err := archive.Restore(r.Context(), options, applyWorld)
+	if errors.Is(err, backup.ErrInvalidArchive) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		logging.Error("restore failed", map[string]interface{}{
+			"sections": options.Sections,
+			"error":    err.Error(),
+		})
+		http.Error(w, "Restore failed: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RestoreResponse{Success: true, Result: result})
+
+	logging.Info("backup restored", map[string]interface{}{
+		"created_at":     archive.Manifest.CreatedAt,
+		"sections":       options.Sections,
+		"restored":       result.Restored,
+		"skipped":        result.Skipped,
+		"dry_run":        options.DryRun,
+		"config_matches": result.ConfigMatches,
+		"hd1_id":         clientID,
+		"remote_ip":      shared.GetClientIP(r),
+	})
+}
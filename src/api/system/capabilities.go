@@ -0,0 +1,121 @@
+package system
+
+import (
+	"encoding/json"
+	"net/http"
+	"os/exec"
+
+	"holodeck1/api/shared"
+	"holodeck1/config"
+	"holodeck1/features"
+	"holodeck1/physics"
+	"holodeck1/quotas"
+	"holodeck1/server"
+	"holodeck1/storage"
+)
+
+// Capability is whether a server feature is available to the caller, and
+// why not when it is not
+type Capability struct {
+	Enabled bool                   `json:"enabled"`
+	Reason  string                 `json:"reason,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// CapabilitiesResponse is the capability matrix for one organization and
+// world
+type CapabilitiesResponse struct {
+	Success      bool                  `json:"success"`
+	Organization string                `json:"organization"`
+	World        string                `json:"world"`
+	Capabilities map[string]Capability `json:"capabilities"`
+}
+
+// notBuilt are features clients may look for that this server does not
+// have
+var notBuilt = []string{"scripting", "llm", "voice"}
+
+func enabled(details map[string]interface{}) Capability {
+	return Capability{Enabled: true, Details: details}
+}
+
+func disabled(reason string) Capability {
+	return Capability{Reason: reason}
+}
+
+func when(on bool, reason string, details map[string]interface{}) Capability {
+	if on {
+		return enabled(details)
+	}
+	return disabled(reason)
+}
+
+// GetCapabilitiesHandler - GET /system/capabilities
+func GetCapabilitiesHandler(w http.ResponseWriter, r *http.Request, hub interface{}) {
+	if _, ok := hub.(*server.Hub); !ok {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	org := shared.GetOrgID(r)
+	world := r.URL.Query().Get("world")
+	if world == "" {
+		world = config.GetWorldsDefaultWorld()
+	}
+
+	profiles := []string{}
+	for _, profile := range physics.Builtins() {
+		profiles = append(profiles, profile.Name)
+	}
+	plan, _ := quotas.PlanFor(org)
+	_, importTool := exec.LookPath(config.GetImportsTool())
+	_, pipelineTool := exec.LookPath(config.GetAssetsPipelineTool())
+
+	capabilities := map[string]Capability{
+		"physics": enabled(map[string]interface{}{"profiles": profiles}),
+		"xr": enabled(map[string]interface{}{
+			"pose_rate": config.GetXRPoseRate(),
+		}),
+		"asset_streaming": when(features.Enabled(features.AssetStreaming, org, world),
+			"feature flag off", nil),
+		"world_rollback": when(features.Enabled(features.WorldRollback, org, world),
+			"feature flag off", nil),
+		"asset_pipeline": when(config.GetAssetsPipelineEnabled() && pipelineTool == nil,
+			"pipeline disabled or its tool is not installed", nil),
+		"asset_scanning": when(config.GetAssetsScanBackend() != "none",
+			"no scan backend configured", map[string]interface{}{"backend": config.GetAssetsScanBackend()}),
+		"imports": when(importTool == nil,
+			"import tool is not installed", map[string]interface{}{"tool": config.GetImportsTool()}),
+		"recording": when(storage.Default() != nil,
+			"storage backend unavailable", map[string]interface{}{
+				"storage": config.GetStorageBackend(),
+				"capture": "client", // Clients record and upload through signed URLs
+			}),
+		"email": when(config.GetEmailConfig().SMTPHost != "",
+			"no SMTP host configured", nil),
+		"geo": when(config.GetGeoImageryURL() != "",
+			"no imagery source configured", nil),
+		"signed_deltas": when(config.GetSyncChecksumAlgorithm() == "hmac-sha256",
+			"deltas are not signed", nil),
+		"compression": when(config.GetCompressionEnabled(),
+			"disabled", nil),
+		"screenshare":   enabled(nil),
+		"accessibility": enabled(nil),
+		"quotas": enabled(map[string]interface{}{
+			"plan":        plan.Name,
+			"connections": plan.Connections,
+		}),
+	}
+	for _, name := range notBuilt {
+		capabilities[name] = disabled("not available on this server")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(CapabilitiesResponse{
+		Success:      true,
+		Organization: org,
+		World:        world,
+		Capabilities: capabilities,
+	})
+}
@@ -0,0 +1,42 @@
+package system
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"holodeck1/api/shared"
+	"holodeck1/config"
+	"holodeck1/features"
+	"holodeck1/server"
+)
+
+// FeaturesResponse is the flag set resolved for one organization and world
+type FeaturesResponse struct {
+	Success      bool            `json:"success"`
+	Organization string          `json:"organization"`
+	World        string          `json:"world"`
+	Features     map[string]bool `json:"features"`
+}
+
+// GetFeaturesHandler - GET /system/features
+func GetFeaturesHandler(w http.ResponseWriter, r *http.Request, hub interface{}) {
+	if _, ok := hub.(*server.Hub); !ok {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	org := shared.GetOrgID(r)
+	world := r.URL.Query().Get("world")
+	if world == "" {
+		world = config.GetWorldsDefaultWorld()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(FeaturesResponse{
+		Success:      true,
+		Organization: org,
+		World:        world,
+		Features:     features.Resolve(org, world),
+	})
+}
@@ -0,0 +1,43 @@
+package system
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"holodeck1/server"
+)
+
+// IntegrityAsset is one static asset with the hash it must match
+type IntegrityAsset struct {
+	Path      string `json:"path"`      // Plain URL, e.g. /static/js/hd1lib.js
+	URL       string `json:"url"`       // Fingerprinted URL the console loads
+	Integrity string `json:"integrity"` // Subresource Integrity value
+}
+
+// GetIntegrityHandler - GET /system/integrity
+func GetIntegrityHandler(w http.ResponseWriter, r *http.Request, hub interface{}) {
+	if _, ok := hub.(*server.Hub); !ok {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	assets := []IntegrityAsset{}
+	for path, integrity := range server.AssetIntegrities() {
+		assets = append(assets, IntegrityAsset{
+			Path:      path,
+			URL:       server.AssetURL(path),
+			Integrity: integrity,
+		})
+	}
+	sort.Slice(assets, func(i, j int) bool { return assets[i].Path < assets[j].Path })
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"js_version": server.GetJSVersion(),
+		"algorithm":  "sha384",
+		"assets":     assets,
+	})
+}
@@ -0,0 +1,68 @@
+package system
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"holodeck1/config"
+	"holodeck1/locales"
+	"holodeck1/logging"
+	"holodeck1/server"
+)
+
+// LocaleResponse is a resolved message catalogue
+type LocaleResponse struct {
+	Success   bool              `json:"success"`
+	Requested string            `json:"requested"`
+	Locale    string            `json:"locale"`
+	Fallback  bool              `json:"fallback"` // requested language unavailable, default served
+	Messages  map[string]string `json:"messages"`
+}
+
+// GetLocalesHandler - GET /system/locales
+func GetLocalesHandler(w http.ResponseWriter, r *http.Request, hub interface{}) {
+	if _, ok := hub.(*server.Hub); !ok {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"default": config.GetClientLocale(),
+		"locales": locales.Available(),
+	})
+}
+
+// GetLocaleHandler - GET /system/locales/{lang}
+func GetLocaleHandler(w http.ResponseWriter, r *http.Request, hub interface{}) {
+	if _, ok := hub.(*server.Hub); !ok {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	requested := mux.Vars(r)["lang"]
+	catalogue, fallback, err := locales.Resolve(requested)
+	if err == locales.ErrInvalidTag {
+		http.Error(w, "Invalid language tag", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		logging.Error("failed to load message catalogue", map[string]interface{}{
+			"lang":  requested,
+			"error": err.Error(),
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(LocaleResponse{
+		Success:   true,
+		Requested: requested,
+		Locale:    catalogue.Locale,
+		Fallback:  fallback,
+		Messages:  catalogue.Messages,
+	})
+}
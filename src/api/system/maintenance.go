@@ -0,0 +1,64 @@
+package system
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"holodeck1/server"
+)
+
+// SetMaintenanceRequest switches maintenance for the server, or one world
+type SetMaintenanceRequest struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message"`         // Banner shown on connected consoles
+	World   string `json:"world,omitempty"` // Omitted for the whole server
+}
+
+// MaintenanceResponse lists every switch that is on
+type MaintenanceResponse struct {
+	Success bool                               `json:"success"`
+	Server  server.MaintenanceState            `json:"server"`
+	Worlds  map[string]server.MaintenanceState `json:"worlds"`
+}
+
+func writeMaintenanceStatus(w http.ResponseWriter) {
+	serverState, worlds := server.MaintenanceStatus()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(MaintenanceResponse{
+		Success: true,
+		Server:  serverState,
+		Worlds:  worlds,
+	})
+}
+
+// GetMaintenanceHandler - GET /system/maintenance
+func GetMaintenanceHandler(w http.ResponseWriter, r *http.Request, hub interface{}) {
+	if _, ok := hub.(*server.Hub); !ok {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeMaintenanceStatus(w)
+}
+
+// SetMaintenanceHandler - PUT /system/maintenance. Like /drain, only callers
+// on this host may flip the switch (x-auth: local).
+func SetMaintenanceHandler(w http.ResponseWriter, r *http.Request, hub interface{}) {
+	h, ok := hub.(*server.Hub)
+	if !ok {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	var req SetMaintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(req.Message) > 500 {
+		http.Error(w, "message must be at most 500 characters", http.StatusBadRequest)
+		return
+	}
+
+	server.SetMaintenance(h, req.World, req.Enabled, req.Message)
+	writeMaintenanceStatus(w)
+}
@@ -0,0 +1,30 @@
+package system
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"holodeck1/server"
+	"holodeck1/simulation"
+)
+
+// SimulationResponse reports the server's tick loop
+type SimulationResponse struct {
+	Success    bool              `json:"success"`
+	Simulation simulation.Status `json:"simulation"`
+}
+
+// GetSimulationHandler - GET /system/simulation
+func GetSimulationHandler(w http.ResponseWriter, r *http.Request, hub interface{}) {
+	if _, ok := hub.(*server.Hub); !ok {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(SimulationResponse{
+		Success:    true,
+		Simulation: simulation.Stats(),
+	})
+}
@@ -0,0 +1,46 @@
+package system
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"holodeck1/server"
+)
+
+// TimeResponse carries the server timestamps of one clock sync exchange
+type TimeResponse struct {
+	Success        bool     `json:"success"`
+	ClientTime     *float64 `json:"client_time,omitempty"` // t0 echoed back
+	ServerReceive  float64  `json:"server_receive"`        // t1
+	ServerTransmit float64  `json:"server_transmit"`       // t2
+}
+
+// GetTimeHandler - GET /system/time
+func GetTimeHandler(w http.ResponseWriter, r *http.Request, hub interface{}) {
+	received := time.Now()
+	if _, ok := hub.(*server.Hub); !ok {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response := TimeResponse{
+		Success:       true,
+		ServerReceive: server.ServerMillis(received),
+	}
+	if t0 := r.URL.Query().Get("t0"); t0 != "" {
+		clientTime, err := strconv.ParseFloat(t0, 64)
+		if err != nil {
+			http.Error(w, "Invalid t0 parameter", http.StatusBadRequest)
+			return
+		}
+		response.ClientTime = &clientTime
+	}
+
+	// A cached answer would be a wrong answer
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	response.ServerTransmit = server.ServerMillis(time.Now())
+	json.NewEncoder(w).Encode(response)
+}
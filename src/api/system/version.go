@@ -2,27 +2,33 @@ package system
 
 import (
 	"encoding/json"
-	"io/ioutil"
 	"net/http"
 	"time"
 
-	"gopkg.in/yaml.v3"
+	"holodeck1/api/shared"
+	"holodeck1/buildinfo"
+	"holodeck1/config"
+	"holodeck1/features"
 	"holodeck1/logging"
 	"holodeck1/server"
 )
 
 type VersionResponse struct {
-	APIVersion     string    `json:"api_version"`
-	JSVersion      string    `json:"js_version"`
-	BuildTimestamp time.Time `json:"build_timestamp"`
-	Title          string    `json:"title"`
+	APIVersion     string          `json:"api_version"`
+	JSVersion      string          `json:"js_version"`
+	BuildTimestamp time.Time       `json:"build_timestamp"`
+	Title          string          `json:"title"`
+	ServerVersion  string          `json:"server_version"`
+	Build          buildinfo.Info  `json:"build"`
+	Compatibility  Compatibility   `json:"compatibility"`
+	Features       map[string]bool `json:"features"` // Resolved for the caller's organization in the served world
 }
 
-type APISpec struct {
-	Info struct {
-		Title   string `yaml:"title"`
-		Version string `yaml:"version"`
-	} `yaml:"info"`
+// Compatibility is what clients the server still serves: the API versions
+// it mounts and the oldest version of each client it accepts
+type Compatibility struct {
+	APIVersions       []string          `json:"api_versions"`
+	MinClientVersions map[string]string `json:"min_client_versions"`
 }
 
 // GetVersionHandler - GET /version
@@ -38,26 +44,27 @@ func GetVersionHandler(w http.ResponseWriter, r *http.Request, hub interface{})
 		"endpoint": "/version",
 	})
 
-	// Read API specification to get version
-	apiVersion := "1.0.0" // fallback
-	apiTitle := "HD1 (Holodeck One) API" // fallback
-	
-	if specData, err := ioutil.ReadFile("api.yaml"); err == nil {
-		var spec APISpec
-		if err := yaml.Unmarshal(specData, &spec); err == nil {
-			apiVersion = spec.Info.Version
-			apiTitle = spec.Info.Title
-		}
+	build := buildinfo.Get()
+	built := time.Now()
+	if build.BuildDate != nil {
+		built = *build.BuildDate
 	}
 
 	// Get JS version hash
 	jsVersion := server.GetJSVersion()
 
 	response := VersionResponse{
-		APIVersion:     apiVersion,
+		APIVersion:     buildinfo.SpecVersion,
 		JSVersion:      jsVersion,
-		BuildTimestamp: time.Now(),
-		Title:          apiTitle,
+		BuildTimestamp: built,
+		Title:          buildinfo.SpecTitle,
+		ServerVersion:  config.GetVersion(),
+		Build:          build,
+		Compatibility: Compatibility{
+			APIVersions:       []string{buildinfo.APIVersion},
+			MinClientVersions: buildinfo.MinClientVersions(),
+		},
+		Features: features.Resolve(shared.GetOrgID(r), config.GetWorldsDefaultWorld()),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -72,8 +79,9 @@ func GetVersionHandler(w http.ResponseWriter, r *http.Request, hub interface{})
 	}
 
 	logging.Info("version information served", map[string]interface{}{
-		"api_version": apiVersion,
+		"api_version": response.APIVersion,
 		"js_version":  jsVersion[:8], // log first 8 chars
-		"title":       apiTitle,
+		"commit":      build.Commit,
+		"spec_hash":   build.SpecHash,
 	})
-}
\ No newline at end of file
+}
@@ -24,7 +24,7 @@ func LoadTexture(w http.ResponseWriter, r *http.Request) {
 	// Create sync operation
 	operation := &sync.Operation{
 		ClientID:  clientID,
-		Type:      "texture_load",
+		Type:      sync.OpTextureLoad,
 		Data: map[string]interface{}{
 			"texture_id": textureID,
 			"url":        getString(req, "url", ""),
@@ -77,7 +77,7 @@ func CreateProceduralTexture(w http.ResponseWriter, r *http.Request) {
 	// Create sync operation
 	operation := &sync.Operation{
 		ClientID:  clientID,
-		Type:      "texture_create",
+		Type:      sync.OpTextureCreate,
 		Data: map[string]interface{}{
 			"texture_id": textureID,
 			"type":       getString(req, "type", "canvas"),
@@ -0,0 +1,102 @@
+package whiteboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"holodeck1/api/shared"
+	"holodeck1/logging"
+	"holodeck1/sync"
+	"holodeck1/whiteboard"
+	"holodeck1/worlds"
+)
+
+// DrawResponse reports a delta merged into a board
+type DrawResponse struct {
+	Success  bool   `json:"success"`
+	EntityID string `json:"entity_id"`
+	Strokes  int    `json:"strokes"` // On the board after the delta
+	SeqNum   uint64 `json:"seq_num"` // The delta's clock
+}
+
+// DrawWhiteboard handles POST /api/entities/{entityId}/whiteboard, adding
+// strokes, removing them or clearing the board
+func DrawWhiteboard(w http.ResponseWriter, r *http.Request) {
+	entityID := mux.Vars(r)["entityId"]
+
+	var data map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	delta, err := whiteboard.DecodeDelta(data)
+	if err != nil {
+		http.Error(w, "Invalid whiteboard delta: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hub := shared.GetHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	state, err := worlds.Replay(hub.GetFullSync())
+	if err == worlds.ErrTruncatedLog {
+		http.Error(w, "Operation log truncated, world state unavailable", http.StatusConflict)
+		return
+	}
+	entity, exists := state.Entities[entityID]
+	if !exists || entity["whiteboard"] == nil {
+		http.Error(w, "Whiteboard entity not found", http.StatusNotFound)
+		return
+	}
+	board, err := whiteboard.Decode(entity["whiteboard"])
+	if err != nil {
+		http.Error(w, "Whiteboard entity not found", http.StatusNotFound)
+		return
+	}
+	if !delta.Clear && len(board.Strokes)+len(delta.Add)-len(delta.Remove) > whiteboard.MaxStrokes {
+		http.Error(w, "Whiteboard is full; remove strokes or clear it", http.StatusConflict)
+		return
+	}
+
+	clientID := shared.GetClientID(r)
+	operationData := map[string]interface{}{"id": entityID}
+	if delta.Clear {
+		operationData["clear"] = true
+	}
+	if len(delta.Remove) > 0 {
+		operationData["remove"] = delta.Remove
+	}
+	if len(delta.Add) > 0 {
+		operationData["add"] = delta.Add
+	}
+	operation := &sync.Operation{
+		ClientID:  clientID,
+		Type:      whiteboard.OperationType,
+		Data:      operationData,
+		Timestamp: time.Now(),
+	}
+	hub.GetSync().SubmitOperation(operation)
+	// Deltas submitted meanwhile merge the same way on every replica
+	board.Merge(delta, operation.SeqNum)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DrawResponse{
+		Success:  true,
+		EntityID: entityID,
+		Strokes:  len(board.Strokes),
+		SeqNum:   operation.SeqNum,
+	})
+
+	logging.Debug("whiteboard delta merged", map[string]interface{}{
+		"entity_id": entityID,
+		"added":     len(delta.Add),
+		"removed":   len(delta.Remove),
+		"cleared":   delta.Clear,
+		"hd1_id":    clientID,
+		"seq_num":   operation.SeqNum,
+	})
+}
@@ -0,0 +1,295 @@
+package worlds
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+	"holodeck1/api/shared"
+	"holodeck1/bookings"
+	"holodeck1/config"
+	"holodeck1/logging"
+)
+
+// BookingRequest schedules a session; Start is RFC 3339 and Duration in
+// seconds
+type BookingRequest struct {
+	Title       string               `json:"title"`
+	Description string               `json:"description,omitempty"`
+	Start       time.Time            `json:"start"`
+	Duration    int64                `json:"duration"`
+	TimeZone    string               `json:"time_zone,omitempty"`
+	Capacity    int                  `json:"capacity,omitempty"`
+	Invitees    []string             `json:"invitees,omitempty"`
+	Recurrence  *bookings.Recurrence `json:"recurrence,omitempty"`
+	Reminders   []int                `json:"reminders,omitempty"`
+}
+
+// Occurrence is one session of a booking
+type Occurrence struct {
+	BookingID string    `json:"booking_id"`
+	Title     string    `json:"title"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+}
+
+// Default and largest window of listed occurrences, and the most listed
+const (
+	defaultOccurrenceWindow = 30 * 24 * time.Hour
+	maxOccurrenceWindow     = 366 * 24 * time.Hour
+	maxOccurrences          = 1000
+)
+
+// saveBooking stores a booking, writing the error response on failure
+func saveBooking(w http.ResponseWriter, r *http.Request, booking *bookings.Booking) bool {
+	err := bookings.Save(r.Context(), booking, config.GetBookingsMaxPerWorld())
+	if err == bookings.ErrTooMany {
+		http.Error(w, "World holds its maximum of bookings", http.StatusConflict)
+		return false
+	} else if err != nil {
+		logging.Error("failed to store booking", map[string]interface{}{
+			"world":      booking.World,
+			"booking_id": booking.ID,
+			"error":      err.Error(),
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// bookingFromRequest builds a booking from a request, validated
+func bookingFromRequest(w http.ResponseWriter, req *BookingRequest, booking *bookings.Booking) bool {
+	booking.Title = req.Title
+	booking.Description = req.Description
+	booking.Start = req.Start
+	booking.Duration = req.Duration
+	booking.TimeZone = req.TimeZone
+	booking.Capacity = req.Capacity
+	booking.Invitees = req.Invitees
+	booking.Recurrence = req.Recurrence
+	booking.Reminders = req.Reminders
+	if err := booking.Validate(); err != nil {
+		http.Error(w, "Invalid booking: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeBooking(w http.ResponseWriter, status int, booking *bookings.Booking) {
+	response := map[string]interface{}{
+		"success": true,
+		"booking": booking,
+	}
+	if next, ok := booking.Next(time.Now()); ok {
+		response["next"] = next
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListBookings handles GET /api/worlds/{worldId}/bookings
+func ListBookings(w http.ResponseWriter, r *http.Request) {
+	_, world, _, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	from, to := time.Now(), time.Time{}
+	for name, target := range map[string]*time.Time{"from": &from, "to": &to} {
+		if value := r.URL.Query().Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				http.Error(w, name+" must be an RFC 3339 time", http.StatusBadRequest)
+				return
+			}
+			*target = parsed
+		}
+	}
+	if to.IsZero() {
+		to = from.Add(defaultOccurrenceWindow)
+	}
+	if !to.After(from) || to.Sub(from) > maxOccurrenceWindow {
+		http.Error(w, "to must be after from, within 366 days", http.StatusBadRequest)
+		return
+	}
+
+	list := bookings.List(world)
+	occurrences := []Occurrence{}
+	for _, booking := range list {
+		for _, start := range booking.Occurrences(from, to, maxOccurrences) {
+			occurrences = append(occurrences, Occurrence{
+				BookingID: booking.ID,
+				Title:     booking.Title,
+				Start:     start,
+				End:       booking.End(start),
+			})
+		}
+	}
+	sort.Slice(occurrences, func(i, j int) bool { return occurrences[i].Start.Before(occurrences[j].Start) })
+	if len(occurrences) > maxOccurrences {
+		occurrences = occurrences[:maxOccurrences]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"world":       world,
+		"bookings":    list,
+		"occurrences": occurrences,
+		"from":        from,
+		"to":          to,
+	})
+}
+
+// CreateBooking handles POST /api/worlds/{worldId}/bookings
+func CreateBooking(w http.ResponseWriter, r *http.Request) {
+	var req BookingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	_, world, organizer, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC()
+	booking := &bookings.Booking{
+		ID:        bookings.NewID(),
+		World:     world,
+		Org:       shared.GetOrgID(r),
+		CreatedBy: organizer,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if !bookingFromRequest(w, &req, booking) || !saveBooking(w, r, booking) {
+		return
+	}
+
+	logging.Info("session booked", map[string]interface{}{
+		"world":      world,
+		"booking_id": booking.ID,
+		"start":      booking.Start,
+		"by":         organizer,
+	})
+	bookings.Invite(booking)
+	writeBooking(w, http.StatusCreated, booking)
+}
+
+// GetBooking handles GET /api/worlds/{worldId}/bookings/{bookingId}
+func GetBooking(w http.ResponseWriter, r *http.Request) {
+	_, world, _, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	booking, err := bookings.Get(world, mux.Vars(r)["bookingId"])
+	if err != nil {
+		http.Error(w, "Booking not found", http.StatusNotFound)
+		return
+	}
+	writeBooking(w, http.StatusOK, booking)
+}
+
+// UpdateBooking handles PUT /api/worlds/{worldId}/bookings/{bookingId},
+// replacing everything but its ID and creation
+func UpdateBooking(w http.ResponseWriter, r *http.Request) {
+	var req BookingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	_, world, organizer, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	current, err := bookings.Get(world, mux.Vars(r)["bookingId"])
+	if err != nil {
+		http.Error(w, "Booking not found", http.StatusNotFound)
+		return
+	}
+
+	// Reminders in flight hold the stored booking, so replace it
+	booking := &bookings.Booking{
+		ID:        current.ID,
+		World:     world,
+		Org:       current.Org,
+		CreatedBy: current.CreatedBy,
+		CreatedAt: current.CreatedAt,
+		UpdatedAt: time.Now().UTC(),
+	}
+	if !bookingFromRequest(w, &req, booking) || !saveBooking(w, r, booking) {
+		return
+	}
+
+	logging.Info("booking updated", map[string]interface{}{
+		"world":      world,
+		"booking_id": booking.ID,
+		"by":         organizer,
+	})
+	bookings.Invite(booking)
+	writeBooking(w, http.StatusOK, booking)
+}
+
+// CancelBooking handles DELETE /api/worlds/{worldId}/bookings/{bookingId}
+func CancelBooking(w http.ResponseWriter, r *http.Request) {
+	_, world, organizer, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	booking, err := bookings.Cancel(r.Context(), world, mux.Vars(r)["bookingId"])
+	if err == bookings.ErrNotFound {
+		http.Error(w, "Booking not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.Error("failed to delete booking", map[string]interface{}{
+			"world":      world,
+			"booking_id": booking.ID,
+			"error":      err.Error(),
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	logging.Info("booking cancelled", map[string]interface{}{
+		"world":      world,
+		"booking_id": booking.ID,
+		"by":         organizer,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"booking_id": booking.ID,
+	})
+}
+
+func writeCalendar(w http.ResponseWriter, filename string, calendar []byte) {
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Write(calendar)
+}
+
+// GetBookingCalendar handles GET /api/worlds/{worldId}/bookings/{bookingId}/ics
+func GetBookingCalendar(w http.ResponseWriter, r *http.Request) {
+	_, world, _, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	booking, err := bookings.Get(world, mux.Vars(r)["bookingId"])
+	if err != nil {
+		http.Error(w, "Booking not found", http.StatusNotFound)
+		return
+	}
+	writeCalendar(w, booking.ID+".ics", bookings.Calendar(world, []*bookings.Booking{booking}, time.Now()))
+}
+
+// GetWorldCalendar handles GET /api/worlds/{worldId}/calendar
+func GetWorldCalendar(w http.ResponseWriter, r *http.Request) {
+	_, world, _, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	writeCalendar(w, world+".ics", bookings.Calendar(world, bookings.List(world), time.Now()))
+}
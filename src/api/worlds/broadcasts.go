@@ -0,0 +1,122 @@
+package worlds
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"holodeck1/broadcast"
+	"holodeck1/logging"
+)
+
+// StartBroadcastRequest opens a broadcast of a saved view, or of the
+// director's shot without one
+type StartBroadcastRequest struct {
+	View      string               `json:"view"`
+	Endpoints []broadcast.Endpoint `json:"endpoints"`
+}
+
+// writeBroadcast responds with a broadcast
+func writeBroadcast(w http.ResponseWriter, status int, b *broadcast.Broadcast) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"broadcast": b,
+	})
+}
+
+// StartBroadcast handles POST /api/worlds/{worldId}/broadcasts
+func StartBroadcast(w http.ResponseWriter, r *http.Request) {
+	var req StartBroadcastRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	_, world, user, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	if req.View != "" {
+		if _, ok := loadView(w, world, req.View); !ok {
+			return
+		}
+	}
+
+	started, err := broadcast.Start(world, req.View, req.Endpoints, user, time.Now())
+	switch {
+	case err == broadcast.ErrDisabled:
+		http.Error(w, "Broadcasting disabled", http.StatusNotFound)
+		return
+	case err == broadcast.ErrTooMany:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Invalid broadcast: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeBroadcast(w, http.StatusCreated, started)
+
+	logging.Info("broadcast started", map[string]interface{}{
+		"world":     world,
+		"broadcast": started.ID,
+		"view":      started.View,
+		"endpoints": len(started.Targets),
+		"launched":  started.Launched,
+		"user":      user,
+	})
+}
+
+// ListBroadcasts handles GET /api/worlds/{worldId}/broadcasts
+func ListBroadcasts(w http.ResponseWriter, r *http.Request) {
+	_, world, _, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"world":      world,
+		"broadcasts": broadcast.List(world),
+	})
+}
+
+// GetBroadcast handles GET /api/worlds/{worldId}/broadcasts/{broadcastId}
+func GetBroadcast(w http.ResponseWriter, r *http.Request) {
+	_, world, _, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	b, err := broadcast.Get(world, mux.Vars(r)["broadcastId"])
+	if err != nil {
+		http.Error(w, "Broadcast not found", http.StatusNotFound)
+		return
+	}
+	writeBroadcast(w, http.StatusOK, b)
+}
+
+// StopBroadcast handles DELETE /api/worlds/{worldId}/broadcasts/{broadcastId}
+func StopBroadcast(w http.ResponseWriter, r *http.Request) {
+	_, world, user, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	stopped, err := broadcast.Stop(world, mux.Vars(r)["broadcastId"], time.Now())
+	switch err {
+	case nil:
+	case broadcast.ErrEnded:
+		http.Error(w, "Broadcast already ended", http.StatusConflict)
+		return
+	default:
+		http.Error(w, "Broadcast not found", http.StatusNotFound)
+		return
+	}
+	writeBroadcast(w, http.StatusOK, stopped)
+
+	logging.Info("broadcast stopped", map[string]interface{}{
+		"world":     world,
+		"broadcast": stopped.ID,
+		"user":      user,
+	})
+}
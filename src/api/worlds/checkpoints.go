@@ -0,0 +1,313 @@
+package worlds
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"holodeck1/api/shared"
+	"holodeck1/config"
+	"holodeck1/features"
+	"holodeck1/logging"
+	"holodeck1/server"
+	"holodeck1/units"
+	"holodeck1/worlds"
+)
+
+// CreateCheckpointRequest labels a new checkpoint. State imports a world
+// export, such as a merge result, instead of snapshotting the live world;
+// an export declaring its space is converted back from it.
+type CreateCheckpointRequest struct {
+	Label string         `json:"label"`
+	State *worlds.Export `json:"state,omitempty"`
+}
+
+// RollbackResponse reports a completed rollback
+type RollbackResponse struct {
+	Success    bool               `json:"success"`
+	Checkpoint *worlds.Checkpoint `json:"checkpoint"`
+	Backup     *worlds.Checkpoint `json:"backup"` // State before the rollback
+	Diff       *worlds.Diff       `json:"diff"`
+	Operations int                `json:"operations"`
+	SeqNum     uint64             `json:"seq_num"`
+}
+
+// DiffResponse compares two world states
+type DiffResponse struct {
+	Success bool         `json:"success"`
+	From    string       `json:"from"`
+	To      string       `json:"to"`
+	Diff    *worlds.Diff `json:"diff"`
+}
+
+// current names the live world state in diff requests
+const current = "current"
+
+// liveWorld returns the hub and world ID of a checkpoint request. The hub
+// serves one world, so only that world has state to checkpoint.
+func liveWorld(w http.ResponseWriter, r *http.Request) (*server.Hub, string, bool) {
+	hub := shared.GetHubFromContext(r)
+	if hub == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, "", false
+	}
+	world := mux.Vars(r)["worldId"]
+	if world != config.GetWorldsDefaultWorld() {
+		http.Error(w, "World not found", http.StatusNotFound)
+		return nil, "", false
+	}
+	return hub, world, true
+}
+
+// currentState rebuilds the live world from the operation log
+func currentState(w http.ResponseWriter, hub *server.Hub) (*worlds.State, bool) {
+	state, err := worlds.Replay(hub.GetFullSync())
+	if err == worlds.ErrTruncatedLog {
+		http.Error(w, "Operation log truncated, world state unavailable", http.StatusConflict)
+		return nil, false
+	}
+	return state, true
+}
+
+// loadCheckpoint writes 404 for unknown checkpoints
+func loadCheckpoint(w http.ResponseWriter, r *http.Request, world, id string) (*worlds.Checkpoint, bool) {
+	checkpoint, err := worlds.LoadCheckpoint(r.Context(), world, id)
+	if err == worlds.ErrCheckpointNotFound {
+		http.Error(w, "Checkpoint not found", http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		logging.Error("failed to load checkpoint", map[string]interface{}{
+			"world":         world,
+			"checkpoint_id": id,
+			"error":         err.Error(),
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return checkpoint, true
+}
+
+// CreateCheckpoint handles POST /api/worlds/{worldId}/checkpoints
+func CreateCheckpoint(w http.ResponseWriter, r *http.Request) {
+	var req CreateCheckpointRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	hub, world, ok := liveWorld(w, r)
+	if !ok {
+		return
+	}
+	var state *worlds.State
+	if req.State != nil {
+		imported, err := req.State.Internal()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		state = imported
+		state.SeqNum = 0 // Imported, never part of this world's log
+	} else if state, ok = currentState(w, hub); !ok {
+		return
+	}
+
+	checkpoint, err := worlds.NewCheckpoint(world, req.Label, shared.GetClientID(r), state)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := worlds.SaveCheckpoint(r.Context(), checkpoint); err != nil {
+		logging.Error("failed to save checkpoint", map[string]interface{}{
+			"world": world,
+			"error": err.Error(),
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"checkpoint": checkpoint.Summary(),
+	})
+
+	logging.Info("world checkpoint created", map[string]interface{}{
+		"world":         world,
+		"checkpoint_id": checkpoint.ID,
+		"label":         checkpoint.Label,
+		"seq_num":       checkpoint.SeqNum,
+		"entities":      checkpoint.Entities,
+		"imported":      req.State != nil,
+		"remote_ip":     shared.GetClientIP(r),
+	})
+}
+
+// ListCheckpoints handles GET /api/worlds/{worldId}/checkpoints
+func ListCheckpoints(w http.ResponseWriter, r *http.Request) {
+	_, world, ok := liveWorld(w, r)
+	if !ok {
+		return
+	}
+
+	checkpoints, err := worlds.ListCheckpoints(r.Context(), world)
+	if err != nil {
+		logging.Error("failed to list checkpoints", map[string]interface{}{
+			"world": world,
+			"error": err.Error(),
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"world":       world,
+		"checkpoints": checkpoints,
+	})
+}
+
+// GetCheckpoint handles GET /api/worlds/{worldId}/checkpoints/{checkpointId}
+func GetCheckpoint(w http.ResponseWriter, r *http.Request) {
+	_, world, ok := liveWorld(w, r)
+	if !ok {
+		return
+	}
+	checkpoint, ok := loadCheckpoint(w, r, world, mux.Vars(r)["checkpointId"])
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"checkpoint": checkpoint,
+	})
+}
+
+// RollbackCheckpoint handles POST /api/worlds/{worldId}/checkpoints/{checkpointId}/rollback
+func RollbackCheckpoint(w http.ResponseWriter, r *http.Request) {
+	hub, world, ok := liveWorld(w, r)
+	if !ok {
+		return
+	}
+	if !shared.FeatureEnabled(r, features.WorldRollback) {
+		http.Error(w, "Feature not enabled: "+features.WorldRollback, http.StatusForbidden)
+		return
+	}
+	checkpoint, ok := loadCheckpoint(w, r, world, mux.Vars(r)["checkpointId"])
+	if !ok {
+		return
+	}
+	clientID := shared.GetClientID(r)
+
+	shared.RestoreMutex.Lock()
+	defer shared.RestoreMutex.Unlock()
+
+	state, ok := currentState(w, hub)
+	if !ok {
+		return
+	}
+
+	// Keep the state being replaced, so the rollback can itself be undone
+	backup, err := worlds.NewCheckpoint(world, "Before rollback to "+checkpoint.ID, clientID, state)
+	if err == nil {
+		err = worlds.SaveCheckpoint(r.Context(), backup)
+	}
+	if err != nil {
+		logging.Error("failed to save rollback backup", map[string]interface{}{
+			"world": world,
+			"error": err.Error(),
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	operations := worlds.Restore(state, checkpoint.State)
+	shared.SubmitRestore(hub, operations, clientID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RollbackResponse{
+		Success:    true,
+		Checkpoint: checkpoint.Summary(),
+		Backup:     backup.Summary(),
+		Diff:       worlds.Compare(state, checkpoint.State),
+		Operations: len(operations),
+		SeqNum:     hub.GetSync().GetCurrentSequence(),
+	})
+
+	logging.Info("world rolled back to checkpoint", map[string]interface{}{
+		"world":         world,
+		"checkpoint_id": checkpoint.ID,
+		"backup_id":     backup.ID,
+		"operations":    len(operations),
+		"hd1_id":        clientID,
+		"remote_ip":     shared.GetClientIP(r),
+	})
+}
+
+// ExportWorld handles GET /api/worlds/{worldId}/export
+func ExportWorld(w http.ResponseWriter, r *http.Request) {
+	hub, world, ok := liveWorld(w, r)
+	if !ok {
+		return
+	}
+	state, ok := currentState(w, hub)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("%s-%d.json", world, state.SeqNum)))
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(worlds.NewExport(world, state, units.FromScene(state.Scene)))
+}
+
+// DiffCheckpoints handles GET /api/worlds/{worldId}/diff?from=&to=
+func DiffCheckpoints(w http.ResponseWriter, r *http.Request) {
+	hub, world, ok := liveWorld(w, r)
+	if !ok {
+		return
+	}
+
+	from := r.URL.Query().Get("from")
+	to := r.URL.Query().Get("to")
+	if from == "" {
+		http.Error(w, "from is required", http.StatusBadRequest)
+		return
+	}
+	if to == "" {
+		to = current
+	}
+
+	resolve := func(id string) (*worlds.State, bool) {
+		if id == current {
+			return currentState(w, hub)
+		}
+		checkpoint, ok := loadCheckpoint(w, r, world, id)
+		if !ok {
+			return nil, false
+		}
+		return checkpoint.State, true
+	}
+	fromState, ok := resolve(from)
+	if !ok {
+		return
+	}
+	toState, ok := resolve(to)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DiffResponse{
+		Success: true,
+		From:    from,
+		To:      to,
+		Diff:    worlds.Compare(fromState, toState),
+	})
+}
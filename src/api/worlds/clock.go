@@ -0,0 +1,102 @@
+package worlds
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"holodeck1/logging"
+	"holodeck1/simulation"
+	"holodeck1/sync"
+)
+
+// ClockResponse reports a world's simulation clock
+type ClockResponse struct {
+	Success bool             `json:"success"`
+	World   string           `json:"world"`
+	Clock   simulation.Clock `json:"clock"`
+	Now     int64            `json:"now"`               // Simulation time, Unix ms
+	SeqNum  uint64           `json:"seq_num,omitempty"` // Operation that set it
+}
+
+// GetClock handles GET /api/worlds/{worldId}/clock
+func GetClock(w http.ResponseWriter, r *http.Request) {
+	_, world, ok := liveWorld(w, r)
+	if !ok {
+		return
+	}
+	clock := simulation.CurrentClock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ClockResponse{
+		Success: true,
+		World:   world,
+		Clock:   clock,
+		Now:     clock.At(time.Now()).UnixMilli(),
+	})
+}
+
+// SetClock handles PUT /api/worlds/{worldId}/clock, pausing, resuming or
+// changing the speed of the world's simulation
+func SetClock(w http.ResponseWriter, r *http.Request) {
+	var change simulation.ClockChange
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if change.Paused == nil && change.Speed == nil {
+		http.Error(w, "paused or speed is required", http.StatusBadRequest)
+		return
+	}
+	applyClock(w, r, change)
+}
+
+// PauseClock handles POST /api/worlds/{worldId}/clock/pause
+func PauseClock(w http.ResponseWriter, r *http.Request) {
+	paused := true
+	applyClock(w, r, simulation.ClockChange{Paused: &paused})
+}
+
+// ResumeClock handles POST /api/worlds/{worldId}/clock/resume
+func ResumeClock(w http.ResponseWriter, r *http.Request) {
+	paused := false
+	applyClock(w, r, simulation.ClockChange{Paused: &paused})
+}
+
+// applyClock changes the loop's clock and broadcasts it as a scene_update,
+// so clients pause or pace their animations with the server
+func applyClock(w http.ResponseWriter, r *http.Request, change simulation.ClockChange) {
+	hub, world, moderator, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	clock, err := simulation.SetClock(change)
+	if err != nil {
+		http.Error(w, "Invalid clock: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	operation := &sync.Operation{
+		ClientID:  moderator,
+		Type:      sync.OpSceneUpdate,
+		Data:      map[string]interface{}{"clock": clock.Data()},
+		Timestamp: time.Now(),
+	}
+	hub.GetSync().SubmitOperation(operation)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ClockResponse{
+		Success: true,
+		World:   world,
+		Clock:   clock,
+		Now:     clock.Time,
+		SeqNum:  operation.SeqNum,
+	})
+
+	logging.Info("world clock set", map[string]interface{}{
+		"world":   world,
+		"paused":  clock.Paused,
+		"speed":   clock.Speed,
+		"by":      moderator,
+		"seq_num": operation.SeqNum,
+	})
+}
@@ -0,0 +1,86 @@
+package worlds
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"holodeck1/constraints"
+	"holodeck1/logging"
+)
+
+// ConstraintsRequest sets a world's editing constraints; omitted fields
+// are cleared
+type ConstraintsRequest struct {
+	Grid            float64  `json:"grid"`
+	RotationSnap    float64  `json:"rotation_snap"`
+	Upright         bool     `json:"upright"`
+	Surfaces        []string `json:"surfaces"`
+	SurfaceDistance float64  `json:"surface_distance"`
+}
+
+// GetConstraints handles GET /api/worlds/{worldId}/constraints
+func GetConstraints(w http.ResponseWriter, r *http.Request) {
+	_, world, ok := liveWorld(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"constraints": constraints.Get(world),
+	})
+}
+
+// SetConstraints handles PUT /api/worlds/{worldId}/constraints. Rules that
+// constrain nothing clear the world's constraints.
+func SetConstraints(w http.ResponseWriter, r *http.Request) {
+	var req ConstraintsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	_, world, moderator, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC()
+	rules := &constraints.Rules{
+		World:           world,
+		Grid:            req.Grid,
+		RotationSnap:    req.RotationSnap,
+		Upright:         req.Upright,
+		Surfaces:        req.Surfaces,
+		SurfaceDistance: req.SurfaceDistance,
+		UpdatedBy:       moderator,
+		UpdatedAt:       &now,
+	}
+	if err := rules.Validate(); err != nil {
+		http.Error(w, "Invalid constraints: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := constraints.Set(r.Context(), rules); err != nil {
+		logging.Error("failed to store world constraints", map[string]interface{}{
+			"world": world,
+			"error": err.Error(),
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	logging.Info("world constraints set", map[string]interface{}{
+		"world":         world,
+		"grid":          rules.Grid,
+		"rotation_snap": rules.RotationSnap,
+		"upright":       rules.Upright,
+		"surfaces":      len(rules.Surfaces),
+		"by":            moderator,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"constraints": constraints.Get(world),
+	})
+}
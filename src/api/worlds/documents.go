@@ -0,0 +1,400 @@
+package worlds
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	stdSync "sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"holodeck1/api/shared"
+	"holodeck1/documents"
+	"holodeck1/logging"
+	"holodeck1/moderation"
+	"holodeck1/panels"
+	"holodeck1/server"
+	"holodeck1/sync"
+	"holodeck1/worlds"
+)
+
+// CreateDocumentRequest starts a shared document. A document bound to a
+// panel entity starts from the panel's content when it has no text.
+type CreateDocumentRequest struct {
+	Title    string `json:"title"`
+	Text     string `json:"text"`
+	EntityID string `json:"entity_id,omitempty"`
+}
+
+// UpdateDocumentRequest retitles a document or binds it to a panel entity;
+// omitted fields stay as they are, and an empty entity_id unbinds it
+type UpdateDocumentRequest struct {
+	Title    *string `json:"title"`
+	EntityID *string `json:"entity_id"`
+}
+
+// DocumentOperationRequest is an edit made against a revision of a
+// document
+type DocumentOperationRequest struct {
+	Revision  int                 `json:"revision"`
+	Operation documents.Operation `json:"operation"`
+	Editor    string              `json:"editor,omitempty"` // Echoed in the edit's document_operation message
+}
+
+// mirrorDelay is how long edits gather before a bound panel is rewritten,
+// so typing updates the world about once a second rather than per key
+const mirrorDelay = time.Second
+
+// mirrors are the documents whose panels are due a rewrite, with the
+// organization whose policy screens it
+var (
+	mirrors      = map[string]string{}
+	mirrorsMutex stdSync.Mutex
+)
+
+// documentWorld returns the hub and the world of a document request, and
+// the caller for requests that need one: a connected session by X-HD1-ID,
+// or an operator
+func documentWorld(w http.ResponseWriter, r *http.Request, needCaller bool) (*server.Hub, string, string, bool) {
+	hub, world, ok := liveWorld(w, r)
+	if !ok {
+		return nil, "", "", false
+	}
+	if !needCaller {
+		return hub, world, "", true
+	}
+	if shared.RefuseBanned(w, r) {
+		return nil, "", "", false
+	}
+	caller := shared.Context(r).Session
+	if caller == "" || !hub.IsConnected(caller) {
+		if !shared.IsOperator(r) {
+			http.Error(w, "Documents require the X-HD1-ID of a connected session", http.StatusBadRequest)
+			return nil, "", "", false
+		}
+		caller = shared.GetClientIP(r)
+	}
+	return hub, world, caller, true
+}
+
+// writeDocument responds with a document
+func writeDocument(w http.ResponseWriter, status int, document *documents.Document) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"document": document,
+	})
+}
+
+// boundPanel returns the panel of the entity a document is bound to,
+// writing 400 when it is not a panel entity
+func boundPanel(w http.ResponseWriter, hub *server.Hub, entityID string) (*panels.Panel, bool) {
+	state, ok := currentState(w, hub)
+	if !ok {
+		return nil, false
+	}
+	entity, exists := state.Entities[entityID]
+	if exists && entity["panel"] != nil {
+		if panel, err := panels.Decode(entity["panel"]); err == nil {
+			return panel, true
+		}
+	}
+	http.Error(w, "entity_id must name a panel entity", http.StatusBadRequest)
+	return nil, false
+}
+
+// ListDocuments handles GET /api/worlds/{worldId}/documents
+func ListDocuments(w http.ResponseWriter, r *http.Request) {
+	_, world, _, ok := documentWorld(w, r, false)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"world":     world,
+		"documents": documents.List(world),
+	})
+}
+
+// CreateDocument handles POST /api/worlds/{worldId}/documents
+func CreateDocument(w http.ResponseWriter, r *http.Request) {
+	var req CreateDocumentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	hub, world, caller, ok := documentWorld(w, r, true)
+	if !ok {
+		return
+	}
+
+	document := &documents.Document{
+		World:     world,
+		Title:     req.Title,
+		Text:      req.Text,
+		EntityID:  req.EntityID,
+		CreatedBy: caller,
+		CreatedAt: time.Now().UTC(),
+	}
+	if document.EntityID != "" {
+		panel, ok := boundPanel(w, hub, document.EntityID)
+		if !ok {
+			return
+		}
+		if document.Text == "" {
+			document.Text = panel.Content
+		}
+	}
+	if err := document.Validate(); err != nil {
+		http.Error(w, "Invalid document: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if document.Title, ok = shared.ScreenText(w, r, moderation.KindDocument, document.Title); !ok {
+		return
+	}
+	if document.Text, ok = shared.ScreenText(w, r, moderation.KindDocument, document.Text); !ok {
+		return
+	}
+	switch err := documents.Create(document); {
+	case err == documents.ErrTooMany || err == documents.ErrBound:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Invalid document: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	created, _ := documents.Get(world, document.ID)
+	hub.PublishDocument("created", created)
+	if created.EntityID != "" {
+		scheduleMirror(hub, world, created.ID, shared.Context(r).PolicyOrg())
+	}
+	logging.Info("document created", map[string]interface{}{
+		"world":       world,
+		"document_id": created.ID,
+		"entity_id":   created.EntityID,
+		"by":          caller,
+	})
+	writeDocument(w, http.StatusCreated, created)
+}
+
+// GetDocument handles GET /api/worlds/{worldId}/documents/{documentId}
+func GetDocument(w http.ResponseWriter, r *http.Request) {
+	_, world, _, ok := documentWorld(w, r, false)
+	if !ok {
+		return
+	}
+	document, err := documents.Get(world, mux.Vars(r)["documentId"])
+	if err != nil {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+	writeDocument(w, http.StatusOK, document)
+}
+
+// UpdateDocument handles PUT /api/worlds/{worldId}/documents/{documentId}
+func UpdateDocument(w http.ResponseWriter, r *http.Request) {
+	var req UpdateDocumentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	hub, world, caller, ok := documentWorld(w, r, true)
+	if !ok {
+		return
+	}
+	if req.EntityID != nil && *req.EntityID != "" {
+		if _, ok := boundPanel(w, hub, *req.EntityID); !ok {
+			return
+		}
+	}
+	if req.Title != nil {
+		title, ok := shared.ScreenText(w, r, moderation.KindDocument, *req.Title)
+		if !ok {
+			return
+		}
+		req.Title = &title
+	}
+
+	document, err := documents.Update(world, mux.Vars(r)["documentId"], req.Title, req.EntityID, time.Now())
+	switch {
+	case err == documents.ErrNotFound:
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	case err == documents.ErrBound:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Invalid document: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hub.PublishDocument("updated", document)
+	if req.EntityID != nil && document.EntityID != "" {
+		scheduleMirror(hub, world, document.ID, shared.Context(r).PolicyOrg())
+	}
+	logging.Info("document updated", map[string]interface{}{
+		"world":       world,
+		"document_id": document.ID,
+		"entity_id":   document.EntityID,
+		"by":          caller,
+	})
+	writeDocument(w, http.StatusOK, document)
+}
+
+// DeleteDocument handles DELETE /api/worlds/{worldId}/documents/{documentId},
+// by the document's creator or an operator. A bound panel keeps the text.
+func DeleteDocument(w http.ResponseWriter, r *http.Request) {
+	hub, world, caller, ok := documentWorld(w, r, true)
+	if !ok {
+		return
+	}
+	id := mux.Vars(r)["documentId"]
+	current, err := documents.Get(world, id)
+	if err != nil {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+	if current.CreatedBy != caller && !shared.IsOperator(r) {
+		http.Error(w, "Only the document's creator or an operator may delete it", http.StatusForbidden)
+		return
+	}
+
+	document, err := documents.Delete(world, id)
+	if err != nil {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+	hub.PublishDocument("deleted", document)
+	logging.Info("document deleted", map[string]interface{}{
+		"world":       world,
+		"document_id": id,
+		"by":          caller,
+	})
+	writeDocument(w, http.StatusOK, document)
+}
+
+// SubmitDocumentOperation handles POST
+// /api/worlds/{worldId}/documents/{documentId}/operations
+func SubmitDocumentOperation(w http.ResponseWriter, r *http.Request) {
+	var req DocumentOperationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid operation: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	hub, world, caller, ok := documentWorld(w, r, true)
+	if !ok {
+		return
+	}
+	if len(req.Editor) > 64 {
+		http.Error(w, "editor must be at most 64 characters", http.StatusBadRequest)
+		return
+	}
+
+	edit, err := documents.Submit(world, mux.Vars(r)["documentId"], req.Revision, req.Operation, caller, req.Editor, time.Now())
+	switch {
+	case err == documents.ErrNotFound:
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	case err == documents.ErrStale:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Invalid operation: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hub.PublishDocumentEdit(edit)
+	scheduleMirror(hub, world, edit.DocumentID, shared.Context(r).PolicyOrg())
+	logging.Debug("document edited", map[string]interface{}{
+		"world":       world,
+		"document_id": edit.DocumentID,
+		"revision":    edit.Revision,
+		"by":          caller,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"edit":    edit,
+	})
+}
+
+// scheduleMirror rewrites a document's bound panel once its edits have
+// gathered for mirrorDelay
+func scheduleMirror(hub *server.Hub, world, id, org string) {
+	mirrorsMutex.Lock()
+	defer mirrorsMutex.Unlock()
+	if _, due := mirrors[id]; due {
+		mirrors[id] = org
+		return
+	}
+	mirrors[id] = org
+	time.AfterFunc(mirrorDelay, func() {
+		mirrorsMutex.Lock()
+		org := mirrors[id]
+		delete(mirrors, id)
+		mirrorsMutex.Unlock()
+		mirrorDocument(hub, world, id, org)
+	})
+}
+
+// mirrorDocument writes a document's text to its bound panel, screened as
+// panel content
+func mirrorDocument(hub *server.Hub, world, id, org string) {
+	document, err := documents.Get(world, id)
+	if err != nil || document.EntityID == "" {
+		return
+	}
+	fields := map[string]interface{}{
+		"world":       world,
+		"document_id": id,
+		"entity_id":   document.EntityID,
+	}
+	state, err := worlds.Replay(hub.GetFullSync())
+	if err != nil {
+		return
+	}
+	entity, exists := state.Entities[document.EntityID]
+	if !exists || entity["panel"] == nil {
+		logging.Debug("document panel gone, text not mirrored", fields)
+		return
+	}
+	panel, err := panels.Decode(entity["panel"])
+	if err != nil || panel.Content == document.Text {
+		return
+	}
+
+	verdict := moderation.Screen(context.Background(), moderation.Content{
+		Kind:  moderation.KindEntityText,
+		Org:   org,
+		World: world,
+		Text:  document.Text,
+	})
+	if verdict.Action == moderation.Reject {
+		fields["reason"] = verdict.Reason
+		logging.Warn("document text rejected, panel not updated", fields)
+		return
+	}
+	panel.Content = verdict.Text
+	if err := panel.Layout(); err != nil {
+		fields["error"] = err.Error()
+		logging.Warn("document text does not fit its panel", fields)
+		return
+	}
+
+	operation := &sync.Operation{
+		ClientID: "document-" + id,
+		Type:     sync.OpEntityUpdate,
+		Data: map[string]interface{}{
+			"id":    document.EntityID,
+			"panel": panel.Data(),
+		},
+		Timestamp: time.Now(),
+	}
+	hub.GetSync().SubmitOperation(operation)
+	fields["revision"] = document.Revision
+	fields["seq_num"] = operation.SeqNum
+	logging.Debug("document mirrored to panel", fields)
+}
@@ -0,0 +1,106 @@
+package worlds
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"holodeck1/api/shared"
+	"holodeck1/config"
+	"holodeck1/environment"
+	"holodeck1/logging"
+	"holodeck1/sync"
+)
+
+// EnvironmentResponse reports a world's time of day and weather
+type EnvironmentResponse struct {
+	Success         bool                  `json:"success"`
+	World           string                `json:"world"`
+	Environment     environment.State     `json:"environment"`
+	DayLength       string                `json:"day_length"`        // Real time per in-world day, 0s when the clock stands still
+	WeatherInterval string                `json:"weather_interval"`  // Average time between weather changes, 0s when the weather stays
+	Weathers        []environment.Weather `json:"weathers"`          // Weather states the cycle picks from
+	SeqNum          uint64                `json:"seq_num,omitempty"` // Operation that set it
+}
+
+// environmentResponse describes a world's environment and its cycle
+func environmentResponse(world string, state environment.State) EnvironmentResponse {
+	return EnvironmentResponse{
+		Success:         true,
+		World:           world,
+		Environment:     state,
+		DayLength:       config.GetEnvironmentDayLength(world).String(),
+		WeatherInterval: config.GetEnvironmentWeatherInterval(world).String(),
+		Weathers:        environment.Weathers(),
+	}
+}
+
+// GetEnvironment handles GET /api/worlds/{worldId}/environment
+func GetEnvironment(w http.ResponseWriter, r *http.Request) {
+	hub, world, ok := liveWorld(w, r)
+	if !ok {
+		return
+	}
+	state, ok := currentState(w, hub)
+	if !ok {
+		return
+	}
+
+	current := environment.Default()
+	if stored, ok := environment.FromScene(state.Scene); ok {
+		current = *stored
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(environmentResponse(world, current))
+}
+
+// SetEnvironment handles PUT /api/worlds/{worldId}/environment, setting the
+// time of day or weather the world's cycle carries on from
+func SetEnvironment(w http.ResponseWriter, r *http.Request) {
+	hub, world, ok := liveWorld(w, r)
+	if !ok {
+		return
+	}
+	var change environment.Change
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	state, ok := currentState(w, hub)
+	if !ok {
+		return
+	}
+
+	current := environment.Default()
+	if stored, ok := environment.FromScene(state.Scene); ok {
+		current = *stored
+	}
+	updated, err := environment.Apply(current, change)
+	if err != nil {
+		http.Error(w, "Invalid environment: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	clientID := shared.GetClientID(r)
+	operation := &sync.Operation{
+		ClientID:  clientID,
+		Type:      sync.OpSceneUpdate,
+		Data:      map[string]interface{}{"environment": updated.Data()},
+		Timestamp: time.Now(),
+	}
+	hub.GetSync().SubmitOperation(operation)
+
+	response := environmentResponse(world, updated)
+	response.SeqNum = operation.SeqNum
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+
+	logging.Info("environment set", map[string]interface{}{
+		"world":       world,
+		"time_of_day": updated.TimeOfDay,
+		"weather":     updated.Weather,
+		"hd1_id":      clientID,
+		"seq_num":     operation.SeqNum,
+	})
+}
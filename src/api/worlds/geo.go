@@ -0,0 +1,308 @@
+package worlds
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"holodeck1/api/shared"
+	"holodeck1/config"
+	"holodeck1/entityid"
+	"holodeck1/geo"
+	"holodeck1/logging"
+	"holodeck1/storage"
+	"holodeck1/sync"
+	"holodeck1/usage"
+)
+
+// GeoResponse reports where a world is on the Earth
+type GeoResponse struct {
+	Success     bool           `json:"success"`
+	World       string         `json:"world"`
+	Geo         *geo.Reference `json:"geo"`               // Null when the world is not placed
+	Imagery     bool           `json:"imagery"`           // Ground tiles have map imagery
+	Elevation   bool           `json:"elevation"`         // Ground tiles have heights
+	Attribution string         `json:"attribution"`       // Credit the tile providers require
+	SeqNum      uint64         `json:"seq_num,omitempty"` // Operation that set it
+}
+
+// geoResponse describes a world's reference and its tile providers
+func geoResponse(world string, reference *geo.Reference) GeoResponse {
+	return GeoResponse{
+		Success:     true,
+		World:       world,
+		Geo:         reference,
+		Imagery:     geo.Enabled(geo.LayerImagery),
+		Elevation:   geo.Enabled(geo.LayerElevation),
+		Attribution: config.GetGeoAttribution(),
+	}
+}
+
+// GetGeo handles GET /api/worlds/{worldId}/geo
+func GetGeo(w http.ResponseWriter, r *http.Request) {
+	hub, world, ok := liveWorld(w, r)
+	if !ok {
+		return
+	}
+	state, ok := currentState(w, hub)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(geoResponse(world, geo.FromScene(state.Scene)))
+}
+
+// SetGeo handles PUT /api/worlds/{worldId}/geo. Ground tiles already
+// loaded keep their place until they are loaded again.
+func SetGeo(w http.ResponseWriter, r *http.Request) {
+	hub, world, ok := liveWorld(w, r)
+	if !ok {
+		return
+	}
+	var reference geo.Reference
+	if err := json.NewDecoder(r.Body).Decode(&reference); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := reference.Validate(); err != nil {
+		http.Error(w, "Invalid geo reference: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	clientID := shared.GetClientID(r)
+	operation := &sync.Operation{
+		ClientID:  clientID,
+		Type:      sync.OpSceneUpdate,
+		Data:      map[string]interface{}{"geo": reference.Data()},
+		Timestamp: time.Now(),
+	}
+	hub.GetSync().SubmitOperation(operation)
+
+	response := geoResponse(world, &reference)
+	response.SeqNum = operation.SeqNum
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+
+	logging.Info("world geo reference set", map[string]interface{}{
+		"world":     world,
+		"latitude":  reference.Latitude,
+		"longitude": reference.Longitude,
+		"hd1_id":    clientID,
+		"seq_num":   operation.SeqNum,
+	})
+}
+
+// GeoTilesRequest selects the ground tiles to load around a position
+type GeoTilesRequest struct {
+	Latitude  *float64 `json:"latitude"`  // Defaults to the world's reference
+	Longitude *float64 `json:"longitude"` // Defaults to the world's reference
+	Radius    float64  `json:"radius"`    // Metres, default 250
+	Zoom      int      `json:"zoom"`      // Default 16
+	Segments  int      `json:"segments"`  // Elevation samples per tile edge
+}
+
+// GeoTile reports one ground tile of a load
+type GeoTile struct {
+	Tile      string `json:"tile"`
+	Entity    string `json:"entity,omitempty"`
+	Imagery   string `json:"imagery,omitempty"`
+	Elevation string `json:"elevation,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// LoadGeoTiles handles POST /api/worlds/{worldId}/geo/tiles, fetching the
+// map and elevation tiles around a position and placing one ground entity
+// per tile. Tiles loaded before are updated in place, so loading an area
+// again after moving the reference re-places it.
+func LoadGeoTiles(w http.ResponseWriter, r *http.Request) {
+	var req GeoTilesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	hub, world, moderator, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	if req.Radius == 0 {
+		req.Radius = 250
+	}
+	if req.Zoom == 0 {
+		req.Zoom = 16
+	}
+	if req.Radius < 0 || req.Radius > 100000 {
+		http.Error(w, "radius must be within 0-100000m", http.StatusBadRequest)
+		return
+	}
+	if req.Zoom < 1 || req.Zoom > geo.MaxZoom {
+		http.Error(w, "zoom must be within 1-"+strconv.Itoa(geo.MaxZoom), http.StatusBadRequest)
+		return
+	}
+	if req.Segments < 0 || req.Segments > geo.MaxSegments {
+		http.Error(w, "segments must be within 1-"+strconv.Itoa(geo.MaxSegments), http.StatusBadRequest)
+		return
+	}
+	if !geo.Enabled(geo.LayerImagery) && !geo.Enabled(geo.LayerElevation) {
+		http.Error(w, "No tile provider configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	state, ok := currentState(w, hub)
+	if !ok {
+		return
+	}
+	reference := geo.FromScene(state.Scene)
+	if reference == nil {
+		http.Error(w, "World has no geo reference; set one with PUT /geo first", http.StatusConflict)
+		return
+	}
+	centre := geo.Reference{Latitude: reference.Latitude, Longitude: reference.Longitude}
+	if req.Latitude != nil {
+		centre.Latitude = *req.Latitude
+	}
+	if req.Longitude != nil {
+		centre.Longitude = *req.Longitude
+	}
+	if err := centre.Validate(); err != nil {
+		http.Error(w, "Invalid position: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	tiles, err := geo.Cover(centre.Latitude, centre.Longitude, req.Radius, req.Zoom, config.GetGeoMaxTiles())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	backend := storage.Default()
+	if backend == nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Fetch four tiles at a time; providers throttle greedy clients
+	results := make([]GeoTile, len(tiles))
+	limit := make(chan struct{}, 4)
+	done := make(chan struct{})
+	for i, tile := range tiles {
+		go func(i int, tile geo.Tile) {
+			limit <- struct{}{}
+			defer func() { <-limit; done <- struct{}{} }()
+			result := GeoTile{Tile: tile.String()}
+			var err error
+			if result.Imagery, err = geo.Fetch(r.Context(), backend, geo.LayerImagery, tile); err == nil {
+				result.Elevation, err = geo.Fetch(r.Context(), backend, geo.LayerElevation, tile)
+			}
+			if err != nil {
+				result.Error = err.Error()
+			}
+			results[i] = result
+		}(i, tile)
+	}
+	for range tiles {
+		<-done
+	}
+
+	// Tiles loaded before are found by their terrain's tile
+	existing := make(map[string]string)
+	for id, entity := range state.Entities {
+		if terrain, ok := entity["terrain"].(map[string]interface{}); ok {
+			if tile, _ := terrain["tile"].(string); tile != "" {
+				existing[tile] = id
+			}
+		}
+	}
+
+	var ops []*sync.Operation
+	created, updated, failed := 0, 0, 0
+	for i, tile := range tiles {
+		result := &results[i]
+		if result.Error != "" {
+			failed++
+			continue
+		}
+		position, width, depth := reference.Place(tile)
+		terrain := &geo.Terrain{
+			Tile:      result.Tile,
+			Imagery:   result.Imagery,
+			Elevation: result.Elevation,
+			Width:     width,
+			Depth:     depth,
+			Segments:  req.Segments,
+		}
+		if result.Elevation != "" {
+			terrain.Encoding = config.GetGeoElevationEncoding()
+		}
+		terrain.Validate() // Defaults the segments, checked above
+		data := map[string]interface{}{
+			"position": map[string]interface{}{"x": position[0], "y": position[1], "z": position[2]},
+			"terrain":  terrain.Data(),
+		}
+
+		if id, ok := existing[result.Tile]; ok {
+			data["id"] = id
+			result.Entity = id
+			ops = append(ops, &sync.Operation{ClientID: moderator, Type: sync.OpEntityUpdate, Data: data})
+			updated++
+			continue
+		}
+		id, _, err := entityid.Allocate("", moderator)
+		status := http.StatusInternalServerError
+		if err == nil {
+			if err = usage.Admit(id); err != nil {
+				entityid.Release(id)
+				status = http.StatusTooManyRequests
+			}
+		}
+		if err != nil {
+			for _, op := range ops {
+				if op.Type == sync.OpEntityCreate {
+					entityid.Release(op.Data["id"].(string))
+					usage.Release(op.Data["id"].(string))
+				}
+			}
+			http.Error(w, "Creating ground entities: "+err.Error(), status)
+			return
+		}
+		data["id"] = id
+		data["metadata"] = map[string]interface{}{"name": "ground " + result.Tile}
+		result.Entity = id
+		ops = append(ops, &sync.Operation{ClientID: moderator, Type: sync.OpEntityCreate, Data: data})
+		created++
+	}
+	if len(ops) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"world":   world,
+			"tiles":   results,
+		})
+		return
+	}
+
+	transaction := sync.NewTransaction(moderator, "geo-tiles-"+time.Now().UTC().Format("20060102T150405.000"), ops)
+	hub.GetSync().SubmitOperation(transaction)
+
+	logging.Info("geo tiles loaded", map[string]interface{}{
+		"world":   world,
+		"zoom":    req.Zoom,
+		"created": created,
+		"updated": updated,
+		"failed":  failed,
+		"by":      moderator,
+		"seq_num": transaction.SeqNum,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"world":       world,
+		"zoom":        req.Zoom,
+		"tiles":       results,
+		"created":     created,
+		"updated":     updated,
+		"failed":      failed,
+		"attribution": config.GetGeoAttribution(),
+		"seq_num":     transaction.SeqNum,
+	})
+}
@@ -0,0 +1,142 @@
+package worlds
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"holodeck1/config"
+	"holodeck1/guests"
+	"holodeck1/logging"
+	"holodeck1/server"
+)
+
+// GuestLinkRequest describes a guest link; ExpiresIn is in seconds
+type GuestLinkRequest struct {
+	Label        string   `json:"label,omitempty"`
+	Capabilities []string `json:"capabilities,omitempty"`
+	ExpiresIn    int64    `json:"expires_in,omitempty"`
+	MaxUses      int      `json:"max_uses,omitempty"`
+}
+
+// ListGuestLinks handles GET /api/worlds/{worldId}/guest-links
+func ListGuestLinks(w http.ResponseWriter, r *http.Request) {
+	_, world, _, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"world":   world,
+		"links":   guests.List(world),
+	})
+}
+
+// CreateGuestLink handles POST /api/worlds/{worldId}/guest-links. The token
+// is only ever returned here.
+func CreateGuestLink(w http.ResponseWriter, r *http.Request) {
+	var req GuestLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	_, world, moderator, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+
+	lifetime := config.GetGuestsDefaultLifetime()
+	if req.ExpiresIn < 0 || time.Duration(req.ExpiresIn)*time.Second > guests.MaxLifetime {
+		http.Error(w, "expires_in must be 1-2592000 seconds", http.StatusBadRequest)
+		return
+	} else if req.ExpiresIn > 0 {
+		lifetime = time.Duration(req.ExpiresIn) * time.Second
+	}
+	token, hash, err := guests.NewToken()
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now().UTC()
+	link := &guests.Link{
+		ID:           guests.NewID(),
+		World:        world,
+		Label:        req.Label,
+		Capabilities: req.Capabilities,
+		TokenHash:    hash,
+		MaxUses:      req.MaxUses,
+		CreatedBy:    moderator,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(lifetime),
+	}
+	if err := link.Validate(); err != nil {
+		http.Error(w, "Invalid guest link: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = guests.Create(r.Context(), link)
+	if err == guests.ErrTooMany {
+		http.Error(w, "World holds its maximum of guest links", http.StatusConflict)
+		return
+	} else if err != nil {
+		logging.Error("failed to store guest link", map[string]interface{}{
+			"world":   world,
+			"link_id": link.ID,
+			"error":   err.Error(),
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	logging.Info("guest link created", map[string]interface{}{
+		"world":        world,
+		"link_id":      link.ID,
+		"capabilities": link.Capabilities,
+		"expires_at":   link.ExpiresAt,
+		"by":           moderator,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"link":    link.Public(),
+		"token":   token,
+		"url":     server.GuestURL(r, token),
+	})
+}
+
+// RevokeGuestLink handles DELETE /api/worlds/{worldId}/guest-links/{linkId}
+func RevokeGuestLink(w http.ResponseWriter, r *http.Request) {
+	hub, world, moderator, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	link, err := guests.Revoke(r.Context(), world, mux.Vars(r)["linkId"])
+	if err == guests.ErrNotFound {
+		http.Error(w, "Guest link not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.Error("failed to delete guest link", map[string]interface{}{
+			"world":   world,
+			"link_id": link.ID,
+			"error":   err.Error(),
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	sessions := hub.EndGuestLink(link.ID)
+	logging.Info("guest link revoked", map[string]interface{}{
+		"world":    world,
+		"link_id":  link.ID,
+		"sessions": sessions,
+		"by":       moderator,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"link_id":  link.ID,
+		"sessions": sessions,
+	})
+}
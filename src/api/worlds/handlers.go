@@ -0,0 +1,66 @@
+package worlds
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+	"holodeck1/worlds"
+)
+
+// ValidateWorldsRequest selects the world to validate
+type ValidateWorldsRequest struct {
+	World string `json:"world,omitempty"`
+}
+
+// ValidateWorlds handles POST /api/worlds/validate
+func ValidateWorlds(w http.ResponseWriter, r *http.Request) {
+	var req ValidateWorldsRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Only paths inside the worlds directory may be validated remotely
+	dir := config.GetWorldsDir()
+	if req.World != "" {
+		clean := filepath.Clean(req.World)
+		if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			http.Error(w, "World must be relative to the worlds directory", http.StatusBadRequest)
+			return
+		}
+		dir = filepath.Join(dir, clean)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		http.Error(w, "World not found", http.StatusNotFound)
+		return
+	}
+
+	report, err := worlds.ValidateDir(dir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	status := http.StatusOK
+	if !report.Valid {
+		status = http.StatusUnprocessableEntity
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+
+	logging.Info("worlds validated via API", map[string]interface{}{
+		"directory": dir,
+		"valid":     report.Valid,
+		"errors":    report.Errors,
+		"warnings":  report.Warnings,
+	})
+}
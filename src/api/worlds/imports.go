@@ -0,0 +1,157 @@
+package worlds
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"holodeck1/assets"
+	"holodeck1/importer"
+	"holodeck1/storage"
+	"holodeck1/units"
+)
+
+// ImportRequest imports an uploaded model file into a world
+type ImportRequest struct {
+	Source   string          `json:"source"` // sha256:<digest>, or the bare digest
+	Format   string          `json:"format"` // Defaults to the name's extension
+	Name     string          `json:"name"`
+	Position *units.Vector   `json:"position"`
+	Space    json.RawMessage `json:"space"` // Source space, defaulting to the world's
+}
+
+// CreateImport handles POST /api/worlds/{worldId}/imports, queueing an
+// import job that creates the model's entities when it completes
+func CreateImport(w http.ResponseWriter, r *http.Request) {
+	var req ImportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	_, world, moderator, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+
+	digest := strings.TrimPrefix(req.Source, assets.RefPrefix)
+	if !assets.ValidDigest(digest) {
+		http.Error(w, "source must be the sha256 digest of an uploaded asset", http.StatusBadRequest)
+		return
+	}
+	if len(req.Name) > importer.MaxNameLength {
+		http.Error(w, "name is too long", http.StatusBadRequest)
+		return
+	}
+	format := strings.ToLower(strings.TrimSpace(req.Format))
+	if format == "" {
+		format = strings.ToLower(strings.TrimPrefix(path.Ext(req.Name), "."))
+	}
+	if format == "" {
+		http.Error(w, "format is required when the name has no extension", http.StatusBadRequest)
+		return
+	}
+	if err := importer.CheckFormat(format); errors.Is(err, importer.ErrUnavailable) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job := &importer.Job{
+		World:     world,
+		Name:      req.Name,
+		Format:    format,
+		Source:    assets.RefPrefix + digest,
+		CreatedBy: moderator,
+	}
+	if job.Name == "" {
+		job.Name = "import." + format
+	}
+	if req.Position != nil {
+		job.Position = [3]float64{req.Position.X, req.Position.Y, req.Position.Z}
+	}
+	if len(req.Space) > 0 && string(req.Space) != "null" {
+		space, err := units.Decode(req.Space)
+		if err != nil {
+			http.Error(w, "Invalid space: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		job.Space = space
+	}
+
+	backend := storage.Default()
+	if backend == nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	key, _ := assets.BlobKey(digest)
+	if _, err := backend.Stat(r.Context(), key); err == storage.ErrNotFound {
+		http.Error(w, "Source asset not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if quarantine, err := assets.LoadQuarantine(r.Context(), backend, digest); err != nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return
+	} else if quarantine != nil {
+		http.Error(w, "Source asset is quarantined", http.StatusForbidden)
+		return
+	}
+
+	queued, err := importer.Submit(job)
+	if err == importer.ErrBusy {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"import":  queued,
+	})
+}
+
+// ListImports handles GET /api/worlds/{worldId}/imports
+func ListImports(w http.ResponseWriter, r *http.Request) {
+	_, world, _, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"world":   world,
+		"imports": importer.List(world),
+	})
+}
+
+// GetImport handles GET /api/worlds/{worldId}/imports/{importId}, reporting
+// an import's stage and progress
+func GetImport(w http.ResponseWriter, r *http.Request) {
+	_, world, _, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	job, err := importer.Get(world, mux.Vars(r)["importId"])
+	if err != nil {
+		http.Error(w, "Import not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"import":  job,
+	})
+}
@@ -0,0 +1,43 @@
+package worlds
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"holodeck1/lint"
+)
+
+// LintWorld handles GET /api/worlds/{worldId}/lint, reporting what makes
+// the world slow or broken to render. severity drops findings less severe.
+func LintWorld(w http.ResponseWriter, r *http.Request) {
+	hub, world, ok := liveWorld(w, r)
+	if !ok {
+		return
+	}
+	min := r.URL.Query().Get("severity")
+	if min == "" {
+		min = lint.SeverityInfo
+	}
+	if !lint.ValidSeverity(min) {
+		http.Error(w, "severity must be info, warning or error", http.StatusBadRequest)
+		return
+	}
+	state, ok := currentState(w, hub)
+	if !ok {
+		return
+	}
+
+	report := lint.Run(r.Context(), world, state)
+	findings := report.Findings[:0]
+	for _, finding := range report.Findings {
+		if lint.AtLeast(finding.Severity, min) {
+			findings = append(findings, finding)
+		}
+	}
+	report.Findings = findings
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"lint":    report,
+	})
+}
@@ -0,0 +1,293 @@
+package worlds
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"holodeck1/api/shared"
+	"holodeck1/logging"
+	"holodeck1/migration"
+	"holodeck1/server"
+	"holodeck1/worlds"
+)
+
+// MigrateRequest names the server a world moves to. Token is the target's
+// moderation token; TargetWorld is the world it serves, by default the same
+// name. ClientURL is where consoles reconnect, by default the target's link
+// to its world.
+type MigrateRequest struct {
+	Target      string `json:"target"`
+	Token       string `json:"token,omitempty"`
+	TargetWorld string `json:"target_world,omitempty"`
+	ClientURL   string `json:"client_url,omitempty"`
+	Message     string `json:"message,omitempty"` // Banner shown while the world is frozen
+}
+
+// MigrateResponse reports a completed migration
+type MigrateResponse struct {
+	Success        bool   `json:"success"`
+	World          string `json:"world"`
+	Target         string `json:"target"`
+	TargetWorld    string `json:"target_world"`
+	ClientURL      string `json:"client_url"`
+	SnapshotSeqNum uint64 `json:"snapshot_seq_num"` // Last operation the snapshot held
+	SeqNum         uint64 `json:"seq_num"`          // Last operation before the freeze
+	Entities       int    `json:"entities"`
+	TailOperations int    `json:"tail_operations"`
+	Checksum       string `json:"checksum"`  // The target's world, equal to the frozen state's
+	FrozenMS       int64  `json:"frozen_ms"` // How long the world was read-only before clients moved
+	Clients        int    `json:"clients"`   // Clients sent to the target
+}
+
+// MigrateWorld handles POST /api/worlds/{worldId}/migrate. The world is
+// frozen only for the tail, which is what changed while the snapshot was
+// sent; until the target has both, a failure serves the world here again.
+func MigrateWorld(w http.ResponseWriter, r *http.Request) {
+	var req MigrateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(req.Message) > 500 {
+		http.Error(w, "message must be at most 500 characters", http.StatusBadRequest)
+		return
+	}
+	hub, world, ok := liveWorld(w, r)
+	if !ok {
+		return
+	}
+	if req.TargetWorld == "" {
+		req.TargetWorld = world
+	}
+	target, err := migration.ParseTarget(req.Target, req.Token, req.TargetWorld)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.ClientURL == "" {
+		req.ClientURL = target.ClientURL()
+	}
+	if _, moved := server.MigrationFor(world); moved {
+		http.Error(w, "World already migrated; switch maintenance off for it to serve it here again", http.StatusConflict)
+		return
+	}
+	if err := migration.Begin(world); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	defer migration.End(world)
+
+	fail := func(phase string, err error) {
+		logging.Error("world migration failed", map[string]interface{}{
+			"world":  world,
+			"target": target.URL,
+			"phase":  phase,
+			"error":  err.Error(),
+		})
+		http.Error(w, "Migration failed, world still served here: "+err.Error(), http.StatusBadGateway)
+	}
+
+	// Snapshot while the world is live
+	snapshot, ok := currentState(w, hub)
+	if !ok {
+		return
+	}
+	source := r.Host
+	answer, err := target.Snapshot(r.Context(), &migration.SnapshotRequest{
+		Source:   source,
+		SeqNum:   snapshot.SeqNum,
+		Checksum: migration.Checksum(snapshot),
+		State:    worlds.NewExport(world, snapshot, nil),
+	})
+	if err == nil {
+		err = checkTarget(answer, snapshot)
+	}
+	if err != nil {
+		fail("snapshot", err)
+		return
+	}
+
+	// Freeze, and send what changed meanwhile. A failure puts the world's
+	// maintenance switch back as it was.
+	_, switches := server.MaintenanceStatus()
+	previous, wasFrozen := switches[world]
+	thaw := func() {
+		server.SetMaintenance(hub, world, wasFrozen, previous.Message)
+	}
+	frozenAt := time.Now()
+	server.SetMaintenance(hub, world, true, req.Message)
+	shared.RestoreMutex.Lock()
+	defer shared.RestoreMutex.Unlock()
+	frozen, err := worlds.Replay(hub.GetFullSync())
+	if err != nil {
+		thaw()
+		fail("freeze", err)
+		return
+	}
+	tail := worlds.Restore(snapshot, frozen)
+	answer, err = target.Tail(r.Context(), &migration.TailRequest{
+		Source:       source,
+		SeqNum:       frozen.SeqNum,
+		BaseChecksum: migration.Checksum(snapshot),
+		Checksum:     migration.Checksum(frozen),
+		Operations:   tail,
+	})
+	if err == nil {
+		err = checkTarget(answer, frozen)
+	}
+	if err != nil {
+		thaw()
+		fail("tail", err)
+		return
+	}
+
+	// The target serves the frozen state: send everyone there
+	clients := hub.GetClientCount()
+	server.SetMigration(hub, server.Migration{World: world, URL: req.ClientURL, Message: req.Message})
+	response := MigrateResponse{
+		Success:        true,
+		World:          world,
+		Target:         target.URL,
+		TargetWorld:    target.World,
+		ClientURL:      req.ClientURL,
+		SnapshotSeqNum: snapshot.SeqNum,
+		SeqNum:         frozen.SeqNum,
+		Entities:       len(frozen.Entities),
+		TailOperations: len(tail),
+		Checksum:       answer.Checksum,
+		FrozenMS:       time.Since(frozenAt).Milliseconds(),
+		Clients:        clients,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+
+	logging.Info("world migrated", map[string]interface{}{
+		"world":           world,
+		"target":          target.URL,
+		"target_world":    target.World,
+		"seq_num":         frozen.SeqNum,
+		"tail_operations": len(tail),
+		"frozen_ms":       response.FrozenMS,
+		"clients":         clients,
+		"remote_ip":       shared.GetClientIP(r),
+	})
+}
+
+// ReceiveMigrationSnapshot handles POST /api/worlds/{worldId}/migration/snapshot
+// on the target: the world becomes the source's snapshot, after a
+// checkpoint of what it replaces
+func ReceiveMigrationSnapshot(w http.ResponseWriter, r *http.Request) {
+	var req migration.SnapshotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.State == nil {
+		http.Error(w, "state is required", http.StatusBadRequest)
+		return
+	}
+	hub, world, ok := liveWorld(w, r)
+	if !ok {
+		return
+	}
+	snapshot, err := req.State.Internal()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if migration.Checksum(snapshot) != req.Checksum {
+		http.Error(w, "Snapshot does not match its checksum", http.StatusBadRequest)
+		return
+	}
+	clientID := shared.GetClientID(r)
+
+	shared.RestoreMutex.Lock()
+	defer shared.RestoreMutex.Unlock()
+	state, ok := currentState(w, hub)
+	if !ok {
+		return
+	}
+	backup, err := worlds.NewCheckpoint(world, "Before migration from "+req.Source, clientID, state)
+	if err == nil {
+		err = worlds.SaveCheckpoint(r.Context(), backup)
+	}
+	if err != nil {
+		logging.Error("failed to save migration backup", map[string]interface{}{
+			"world": world,
+			"error": err.Error(),
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	operations := worlds.Restore(state, snapshot)
+	shared.SubmitRestore(hub, operations, clientID)
+	writeMigrationAnswer(w, r, hub, len(operations), "snapshot", req.Source, req.SeqNum)
+}
+
+// ReceiveMigrationTail handles POST /api/worlds/{worldId}/migration/tail on
+// the target. The world must still be the snapshot: anything else changed
+// it, and the tail would not leave it as the source froze it.
+func ReceiveMigrationTail(w http.ResponseWriter, r *http.Request) {
+	var req migration.TailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := migration.ValidateTail(req.Operations); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hub, _, ok := liveWorld(w, r)
+	if !ok {
+		return
+	}
+
+	shared.RestoreMutex.Lock()
+	defer shared.RestoreMutex.Unlock()
+	state, ok := currentState(w, hub)
+	if !ok {
+		return
+	}
+	if migration.Checksum(state) != req.BaseChecksum {
+		http.Error(w, migration.ErrDiverged.Error()+": the world changed since the snapshot", http.StatusConflict)
+		return
+	}
+	shared.SubmitRestore(hub, req.Operations, shared.GetClientID(r))
+	writeMigrationAnswer(w, r, hub, len(req.Operations), "tail", req.Source, req.SeqNum)
+}
+
+// writeMigrationAnswer reports the world after a phase, with its checksum
+// for the source to compare
+func writeMigrationAnswer(w http.ResponseWriter, r *http.Request, hub *server.Hub, operations int, phase, source string, seqNum uint64) {
+	state, ok := currentState(w, hub)
+	if !ok {
+		return
+	}
+	answer := migration.Response{
+		Success:    true,
+		Checksum:   migration.Checksum(state),
+		Operations: operations,
+		SeqNum:     state.SeqNum,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(answer)
+
+	logging.Info("world migration received", map[string]interface{}{
+		"phase":          phase,
+		"source":         source,
+		"source_seq_num": seqNum,
+		"operations":     operations,
+		"entities":       len(state.Entities),
+		"remote_ip":      shared.GetClientIP(r),
+	})
+}
+
+// checkTarget compares the target's world after a phase with the state it
+// was sent
+func checkTarget(answer *migration.Response, state *worlds.State) error {
+	if answer.Checksum != migration.Checksum(state) {
+		return migration.ErrDiverged
+	}
+	return nil
+}
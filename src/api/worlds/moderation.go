@@ -0,0 +1,395 @@
+package worlds
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"holodeck1/api/shared"
+	"holodeck1/connectors"
+	"holodeck1/email"
+	"holodeck1/logging"
+	"holodeck1/moderation"
+	"holodeck1/server"
+)
+
+// KickRequest names the session to disconnect
+type KickRequest struct {
+	HD1ID  string `json:"hd1_id"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// BanRequest keeps a session or a network out of the world. Duration is in
+// seconds; zero bans until the ban is lifted.
+type BanRequest struct {
+	HD1ID    string `json:"hd1_id,omitempty"`
+	IP       string `json:"ip,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	Duration int64  `json:"duration,omitempty"`
+}
+
+// MuteRequest silences a session. Duration is in seconds; zero mutes until
+// the session is unmuted.
+type MuteRequest struct {
+	HD1ID    string `json:"hd1_id"`
+	Reason   string `json:"reason,omitempty"`
+	Duration int64  `json:"duration,omitempty"`
+}
+
+// Default and largest number of audit entries returned
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// moderatedWorld returns the hub, the world and who is moderating of an
+// operator request; the router admits only operators (x-auth: operator)
+func moderatedWorld(w http.ResponseWriter, r *http.Request) (*server.Hub, string, string, bool) {
+	hub, world, ok := liveWorld(w, r)
+	if !ok {
+		return nil, "", "", false
+	}
+	return hub, world, shared.Context(r).User(), true
+}
+
+// record appends to the audit log; the action already took effect, so a
+// failure is logged rather than returned
+func record(r *http.Request, entry *moderation.Entry) {
+	if err := moderation.Record(r.Context(), entry); err != nil {
+		logging.Error("failed to record moderation audit entry", map[string]interface{}{
+			"world":  entry.World,
+			"action": entry.Action,
+			"error":  err.Error(),
+		})
+	}
+}
+
+func checkReason(w http.ResponseWriter, reason string, duration int64) bool {
+	if len(reason) > moderation.MaxReasonLength {
+		http.Error(w, "reason longer than "+strconv.Itoa(moderation.MaxReasonLength)+" characters", http.StatusBadRequest)
+		return false
+	}
+	if duration < 0 {
+		http.Error(w, "duration must not be negative", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// session matches the connections of one HD1 ID
+func session(hd1ID string) func(string, string) bool {
+	return func(id, _ string) bool { return id == hd1ID }
+}
+
+// KickSession handles POST /api/worlds/{worldId}/moderation/kick
+func KickSession(w http.ResponseWriter, r *http.Request) {
+	var req KickRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	hub, world, moderator, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	if req.HD1ID == "" {
+		http.Error(w, "hd1_id is required", http.StatusBadRequest)
+		return
+	}
+	if !checkReason(w, req.Reason, 0) {
+		return
+	}
+
+	sessions := hub.Moderate(session(req.HD1ID), server.ModerationEvent{
+		Action: moderation.ActionKick,
+		Reason: req.Reason,
+	})
+	if sessions == 0 {
+		http.Error(w, "Session not connected", http.StatusNotFound)
+		return
+	}
+	record(r, &moderation.Entry{
+		World:     world,
+		Action:    moderation.ActionKick,
+		HD1ID:     req.HD1ID,
+		Reason:    req.Reason,
+		Moderator: moderator,
+		Sessions:  sessions,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"world":    world,
+		"hd1_id":   req.HD1ID,
+		"sessions": sessions,
+	})
+}
+
+// ListBans handles GET /api/worlds/{worldId}/moderation/bans
+func ListBans(w http.ResponseWriter, r *http.Request) {
+	_, world, _, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"world":   world,
+		"bans":    moderation.Bans(world),
+	})
+}
+
+// CreateBan handles POST /api/worlds/{worldId}/moderation/bans
+func CreateBan(w http.ResponseWriter, r *http.Request) {
+	var req BanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	hub, world, moderator, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	if !checkReason(w, req.Reason, req.Duration) {
+		return
+	}
+
+	now := time.Now()
+	ban := &moderation.Ban{
+		ID:        moderation.NewBanID(),
+		World:     world,
+		HD1ID:     req.HD1ID,
+		IP:        req.IP,
+		Reason:    req.Reason,
+		CreatedBy: moderator,
+		CreatedAt: now,
+		ExpiresAt: moderation.Expiry(req.Duration, now),
+	}
+	if err := ban.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := moderation.AddBan(r.Context(), ban); err != nil {
+		logging.Error("failed to store ban", map[string]interface{}{
+			"world": world,
+			"error": err.Error(),
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	sessions := hub.Moderate(ban.Matches, server.ModerationEvent{
+		Action:    moderation.ActionBan,
+		Reason:    ban.Reason,
+		ExpiresAt: ban.ExpiresAt,
+	})
+	record(r, &moderation.Entry{
+		World:     world,
+		Action:    moderation.ActionBan,
+		HD1ID:     ban.HD1ID,
+		IP:        ban.IP,
+		BanID:     ban.ID,
+		Reason:    ban.Reason,
+		Moderator: moderator,
+		Sessions:  sessions,
+		ExpiresAt: ban.ExpiresAt,
+	})
+	banned := ban.HD1ID
+	if banned == "" {
+		banned = ban.IP
+	}
+	email.Alert(shared.GetOrgID(r), email.SecurityAlert{
+		Event:  "Ban of " + banned,
+		World:  world,
+		Detail: ban.Reason,
+		Actor:  moderator,
+		Time:   now,
+	})
+	connectors.Publish(connectors.Event{
+		Type:    connectors.EventSecurity,
+		Org:     shared.GetOrgID(r),
+		World:   world,
+		Time:    now,
+		Summary: "Ban of " + banned,
+		Detail:  ban.Reason,
+		Actor:   moderator,
+		Key:     ban.ID,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"ban":      ban,
+		"sessions": sessions,
+	})
+}
+
+// RemoveBan handles DELETE /api/worlds/{worldId}/moderation/bans/{banId}
+func RemoveBan(w http.ResponseWriter, r *http.Request) {
+	_, world, moderator, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	ban, err := moderation.RemoveBan(r.Context(), world, mux.Vars(r)["banId"])
+	if err == moderation.ErrNotFound {
+		http.Error(w, "Ban not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.Error("failed to delete ban", map[string]interface{}{
+			"world":  world,
+			"ban_id": ban.ID,
+			"error":  err.Error(),
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	record(r, &moderation.Entry{
+		World:     world,
+		Action:    moderation.ActionUnban,
+		HD1ID:     ban.HD1ID,
+		IP:        ban.IP,
+		BanID:     ban.ID,
+		Moderator: moderator,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"ban":     ban,
+	})
+}
+
+// ListMutes handles GET /api/worlds/{worldId}/moderation/mutes
+func ListMutes(w http.ResponseWriter, r *http.Request) {
+	_, world, _, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"world":   world,
+		"mutes":   moderation.Mutes(world),
+	})
+}
+
+// MuteSession handles POST /api/worlds/{worldId}/moderation/mutes
+func MuteSession(w http.ResponseWriter, r *http.Request) {
+	var req MuteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	hub, world, moderator, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	if !checkReason(w, req.Reason, req.Duration) {
+		return
+	}
+
+	now := time.Now()
+	mute := &moderation.Mute{
+		World:     world,
+		HD1ID:     req.HD1ID,
+		Reason:    req.Reason,
+		CreatedBy: moderator,
+		CreatedAt: now,
+		ExpiresAt: moderation.Expiry(req.Duration, now),
+	}
+	if err := moderation.AddMute(mute); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sessions := hub.Moderate(session(mute.HD1ID), server.ModerationEvent{
+		Action:    moderation.ActionMute,
+		Reason:    mute.Reason,
+		ExpiresAt: mute.ExpiresAt,
+	})
+	record(r, &moderation.Entry{
+		World:     world,
+		Action:    moderation.ActionMute,
+		HD1ID:     mute.HD1ID,
+		Reason:    mute.Reason,
+		Moderator: moderator,
+		Sessions:  sessions,
+		ExpiresAt: mute.ExpiresAt,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"mute":     mute,
+		"sessions": sessions,
+	})
+}
+
+// UnmuteSession handles DELETE /api/worlds/{worldId}/moderation/mutes/{hd1Id}
+func UnmuteSession(w http.ResponseWriter, r *http.Request) {
+	hub, world, moderator, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	mute, err := moderation.RemoveMute(world, mux.Vars(r)["hd1Id"])
+	if err != nil {
+		http.Error(w, "Mute not found", http.StatusNotFound)
+		return
+	}
+
+	sessions := hub.Moderate(session(mute.HD1ID), server.ModerationEvent{
+		Action: moderation.ActionUnmute,
+	})
+	record(r, &moderation.Entry{
+		World:     world,
+		Action:    moderation.ActionUnmute,
+		HD1ID:     mute.HD1ID,
+		Moderator: moderator,
+		Sessions:  sessions,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"mute":    mute,
+	})
+}
+
+// GetModerationAudit handles GET /api/worlds/{worldId}/moderation/audit?limit=
+func GetModerationAudit(w http.ResponseWriter, r *http.Request) {
+	_, world, _, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	limit := defaultAuditLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxAuditLimit {
+			http.Error(w, "limit must be between 1 and "+strconv.Itoa(maxAuditLimit), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	entries, err := moderation.Audit(r.Context(), world, limit)
+	if err != nil {
+		logging.Error("failed to read moderation audit log", map[string]interface{}{
+			"world": world,
+			"error": err.Error(),
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"world":   world,
+		"entries": entries,
+	})
+}
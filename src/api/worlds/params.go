@@ -0,0 +1,152 @@
+package worlds
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"holodeck1/logging"
+	"holodeck1/params"
+)
+
+// ParamRequest sets a parameter. Type is inferred from the value when
+// empty; a secret's value is never returned once set.
+type ParamRequest struct {
+	Type        string      `json:"type,omitempty"`
+	Value       interface{} `json:"value"`
+	Secret      bool        `json:"secret,omitempty"`
+	Description string      `json:"description,omitempty"`
+}
+
+// writeParam responds with a parameter, its value hidden when secret
+func writeParam(w http.ResponseWriter, status int, world string, param *params.Param) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"world":   world,
+		"param":   param.Redacted(),
+	})
+}
+
+// ListParams handles GET /api/worlds/{worldId}/params
+func ListParams(w http.ResponseWriter, r *http.Request) {
+	_, world, _, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	list := params.List(world)
+	for i, param := range list {
+		list[i] = param.Redacted()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"world":   world,
+		"params":  list,
+	})
+}
+
+// GetParam handles GET /api/worlds/{worldId}/params/{key}
+func GetParam(w http.ResponseWriter, r *http.Request) {
+	_, world, _, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	param, err := params.Get(world, mux.Vars(r)["key"])
+	if err != nil {
+		http.Error(w, "Parameter not found", http.StatusNotFound)
+		return
+	}
+	writeParam(w, http.StatusOK, world, param)
+}
+
+// SetParam handles PUT /api/worlds/{worldId}/params/{key}, creating or
+// replacing the parameter
+func SetParam(w http.ResponseWriter, r *http.Request) {
+	var req ParamRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	_, world, by, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	if req.Type == "" {
+		req.Type = params.TypeOf(req.Value)
+	}
+	param := &params.Param{
+		Key:         mux.Vars(r)["key"],
+		Type:        req.Type,
+		Value:       req.Value,
+		Secret:      req.Secret,
+		Description: req.Description,
+		UpdatedAt:   time.Now().UTC(),
+		UpdatedBy:   by,
+	}
+	if err := param.Validate(); err != nil {
+		http.Error(w, "Invalid parameter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	_, err := params.Get(world, param.Key)
+	created := err == params.ErrNotFound
+	if err := params.Set(r.Context(), world, param); err == params.ErrTooMany {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		logging.Error("failed to store world parameter", map[string]interface{}{
+			"world": world,
+			"key":   param.Key,
+			"error": err.Error(),
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	logging.Info("world parameter set", map[string]interface{}{
+		"world":  world,
+		"key":    param.Key,
+		"type":   param.Type,
+		"secret": param.Secret,
+		"by":     by,
+	})
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeParam(w, status, world, param)
+}
+
+// DeleteParam handles DELETE /api/worlds/{worldId}/params/{key}
+func DeleteParam(w http.ResponseWriter, r *http.Request) {
+	_, world, by, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	key := mux.Vars(r)["key"]
+	if err := params.Delete(r.Context(), world, key); err == params.ErrNotFound {
+		http.Error(w, "Parameter not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.Error("failed to delete world parameter", map[string]interface{}{
+			"world": world,
+			"key":   key,
+			"error": err.Error(),
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	logging.Info("world parameter deleted", map[string]interface{}{
+		"world": world,
+		"key":   key,
+		"by":    by,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"key":     key,
+	})
+}
@@ -0,0 +1,95 @@
+package worlds
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"holodeck1/api/shared"
+	"holodeck1/logging"
+	"holodeck1/physics"
+	"holodeck1/sync"
+)
+
+// PhysicsResponse reports a world's active physics profile
+type PhysicsResponse struct {
+	Success bool             `json:"success"`
+	World   string           `json:"world"`
+	Profile *physics.Profile `json:"profile"`
+	SeqNum  uint64           `json:"seq_num,omitempty"` // Operation that switched it
+}
+
+// ListPhysicsProfiles handles GET /api/physics/profiles
+func ListPhysicsProfiles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"profiles": physics.Builtins(),
+		"default":  physics.DefaultProfile,
+	})
+}
+
+// GetPhysics handles GET /api/worlds/{worldId}/physics
+func GetPhysics(w http.ResponseWriter, r *http.Request) {
+	hub, world, ok := liveWorld(w, r)
+	if !ok {
+		return
+	}
+	state, ok := currentState(w, hub)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PhysicsResponse{
+		Success: true,
+		World:   world,
+		Profile: physics.FromScene(state.Scene),
+	})
+}
+
+// SetPhysics handles PUT /api/worlds/{worldId}/physics with a built-in
+// profile name or a custom profile
+func SetPhysics(w http.ResponseWriter, r *http.Request) {
+	hub, world, ok := liveWorld(w, r)
+	if !ok {
+		return
+	}
+	var selection physics.Selection
+	if err := json.NewDecoder(r.Body).Decode(&selection); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	profile, err := selection.Resolve()
+	if err != nil {
+		http.Error(w, "Invalid physics profile: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// A scene setting like background and fog, so clients and physics
+	// engines receive it as a scene_update
+	clientID := shared.GetClientID(r)
+	operation := &sync.Operation{
+		ClientID:  clientID,
+		Type:      sync.OpSceneUpdate,
+		Data:      map[string]interface{}{"physics": profile.Data()},
+		Timestamp: time.Now(),
+	}
+	hub.GetSync().SubmitOperation(operation)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PhysicsResponse{
+		Success: true,
+		World:   world,
+		Profile: profile,
+		SeqNum:  operation.SeqNum,
+	})
+
+	logging.Info("physics profile switched", map[string]interface{}{
+		"world":   world,
+		"profile": profile.Name,
+		"custom":  selection.Custom != nil,
+		"hd1_id":  clientID,
+		"seq_num": operation.SeqNum,
+	})
+}
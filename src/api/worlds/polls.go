@@ -0,0 +1,215 @@
+package worlds
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"holodeck1/api/shared"
+	"holodeck1/logging"
+	"holodeck1/moderation"
+	"holodeck1/polls"
+	"holodeck1/server"
+)
+
+// CreatePollRequest asks the world a question
+type CreatePollRequest struct {
+	Question string   `json:"question"`
+	Options  []string `json:"options"`
+	Multiple bool     `json:"multiple,omitempty"`
+}
+
+// VoteRequest is a session's ballot: the indexes of the options it
+// chooses, none to withdraw
+type VoteRequest struct {
+	Options []int `json:"options"`
+}
+
+// pollWorld returns the hub and the world of a poll request, and the caller
+// for requests that need one: a connected session by X-HD1-ID, or an
+// operator
+func pollWorld(w http.ResponseWriter, r *http.Request, needCaller bool) (*server.Hub, string, string, bool) {
+	hub, world, ok := liveWorld(w, r)
+	if !ok {
+		return nil, "", "", false
+	}
+	if !needCaller {
+		return hub, world, "", true
+	}
+	if shared.RefuseBanned(w, r) {
+		return nil, "", "", false
+	}
+	caller := shared.Context(r).Session
+	if caller == "" || !hub.IsConnected(caller) {
+		if !shared.IsOperator(r) {
+			http.Error(w, "Polls require the X-HD1-ID of a connected session", http.StatusBadRequest)
+			return nil, "", "", false
+		}
+		caller = shared.GetClientIP(r)
+	}
+	return hub, world, caller, true
+}
+
+// writePoll responds with a poll's tallies
+func writePoll(w http.ResponseWriter, status int, tally *polls.Tally) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"poll":    tally,
+	})
+}
+
+// ListPolls handles GET /api/worlds/{worldId}/polls
+func ListPolls(w http.ResponseWriter, r *http.Request) {
+	_, world, _, ok := pollWorld(w, r, false)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"world":   world,
+		"polls":   polls.List(world),
+	})
+}
+
+// CreatePoll handles POST /api/worlds/{worldId}/polls
+func CreatePoll(w http.ResponseWriter, r *http.Request) {
+	var req CreatePollRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	hub, world, caller, ok := pollWorld(w, r, true)
+	if !ok {
+		return
+	}
+
+	poll := &polls.Poll{
+		World:     world,
+		Question:  req.Question,
+		Options:   req.Options,
+		Multiple:  req.Multiple,
+		CreatedBy: caller,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := poll.Validate(); err != nil {
+		http.Error(w, "Invalid poll: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if poll.Question, ok = shared.ScreenText(w, r, moderation.KindPoll, poll.Question); !ok {
+		return
+	}
+	for i, option := range poll.Options {
+		if poll.Options[i], ok = shared.ScreenText(w, r, moderation.KindPoll, option); !ok {
+			return
+		}
+	}
+	if err := polls.Create(poll); err == polls.ErrTooMany {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		// Redaction may have emptied or merged options
+		http.Error(w, "Invalid poll: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tally, _ := polls.Get(world, poll.ID)
+	hub.PublishPoll(tally)
+	logging.Info("poll created", map[string]interface{}{
+		"world":   world,
+		"poll_id": poll.ID,
+		"by":      caller,
+	})
+	writePoll(w, http.StatusCreated, tally)
+}
+
+// GetPoll handles GET /api/worlds/{worldId}/polls/{pollId}
+func GetPoll(w http.ResponseWriter, r *http.Request) {
+	_, world, _, ok := pollWorld(w, r, false)
+	if !ok {
+		return
+	}
+	tally, err := polls.Get(world, mux.Vars(r)["pollId"])
+	if err != nil {
+		http.Error(w, "Poll not found", http.StatusNotFound)
+		return
+	}
+	writePoll(w, http.StatusOK, tally)
+}
+
+// CastVote handles PUT /api/worlds/{worldId}/polls/{pollId}/vote
+func CastVote(w http.ResponseWriter, r *http.Request) {
+	var req VoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	hub, world, ok := liveWorld(w, r)
+	if !ok || shared.RefuseBanned(w, r) {
+		return
+	}
+	// Ballots belong to sessions, so operators vote like everyone else
+	hd1ID := shared.Context(r).Session
+	if hd1ID == "" || !hub.IsConnected(hd1ID) {
+		http.Error(w, "Voting requires the X-HD1-ID of a connected session", http.StatusBadRequest)
+		return
+	}
+
+	tally, err := polls.Vote(world, mux.Vars(r)["pollId"], hd1ID, req.Options)
+	switch {
+	case err == polls.ErrNotFound:
+		http.Error(w, "Poll not found", http.StatusNotFound)
+		return
+	case err == polls.ErrClosed:
+		http.Error(w, "Poll is closed", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Invalid vote: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hub.PublishPoll(tally)
+	logging.Debug("poll vote cast", map[string]interface{}{
+		"world":   world,
+		"poll_id": tally.ID,
+		"voters":  tally.Voters,
+	})
+	writePoll(w, http.StatusOK, tally)
+}
+
+// ClosePoll handles POST /api/worlds/{worldId}/polls/{pollId}/close, by the
+// poll's creator or an operator
+func ClosePoll(w http.ResponseWriter, r *http.Request) {
+	hub, world, caller, ok := pollWorld(w, r, true)
+	if !ok {
+		return
+	}
+	id := mux.Vars(r)["pollId"]
+	current, err := polls.Get(world, id)
+	if err != nil {
+		http.Error(w, "Poll not found", http.StatusNotFound)
+		return
+	}
+	if current.CreatedBy != caller && !shared.IsOperator(r) {
+		http.Error(w, "Only the poll's creator or an operator may close it", http.StatusForbidden)
+		return
+	}
+
+	tally, err := polls.Close(world, id, time.Now())
+	if err != nil {
+		http.Error(w, "Poll not found", http.StatusNotFound)
+		return
+	}
+	if current.Status == polls.StatusOpen {
+		hub.PublishPoll(tally)
+		logging.Info("poll closed", map[string]interface{}{
+			"world":   world,
+			"poll_id": id,
+			"voters":  tally.Voters,
+		})
+	}
+	writePoll(w, http.StatusOK, tally)
+}
@@ -0,0 +1,115 @@
+package worlds
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"holodeck1/api/shared"
+	"holodeck1/logging"
+	"holodeck1/portals"
+	"holodeck1/views"
+)
+
+// maxArrival bounds an arrival's body
+const maxArrival = 16 << 10
+
+// writeArrival responds with an arrival
+func writeArrival(w http.ResponseWriter, status int, arrival *portals.Arrival) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"arrival": arrival,
+	})
+}
+
+// ExpectArrival handles POST /api/worlds/{worldId}/arrivals, the server of
+// another world handing over an avatar that stepped into a portal here.
+// The arrival is kept under a one-use ticket its session claims on joining.
+func ExpectArrival(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxArrival))
+	if err != nil {
+		http.Error(w, "Arrival too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	hub, world, ok := liveWorld(w, r)
+	if !ok {
+		return
+	}
+	var arrival portals.Arrival
+	if err := json.Unmarshal(body, &arrival); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if !portals.Verify(arrival.From, r, body) && !shared.IsOperator(r) {
+		http.Error(w, "Invalid arrival signature", http.StatusUnauthorized)
+		return
+	}
+	if arrival.World != world || arrival.HD1ID == "" || utf8.RuneCountInString(arrival.Name) > 100 {
+		http.Error(w, "Invalid arrival", http.StatusBadRequest)
+		return
+	}
+
+	// Views are resolved here, where they are kept
+	if arrival.View != "" && arrival.Position == nil {
+		view, err := views.Get(world, arrival.View)
+		if err != nil {
+			http.Error(w, "View not found", http.StatusNotFound)
+			return
+		}
+		arrival.Position = &portals.Position{X: view.Position.X, Y: view.Position.Y, Z: view.Position.Z}
+		arrival.Yaw, arrival.Pitch = view.Yaw, view.Pitch
+	}
+	destination := &portals.Portal{World: world, Position: arrival.Position, Yaw: arrival.Yaw, Pitch: arrival.Pitch}
+	if err := destination.Validate(); err != nil {
+		http.Error(w, "Invalid arrival: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	expected, err := portals.Expect(&arrival, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	hub.PublishPortal("expected", expected)
+	writeArrival(w, http.StatusCreated, expected)
+
+	logging.Info("portal arrival expected", map[string]interface{}{
+		"world":  world,
+		"from":   arrival.From,
+		"hd1_id": arrival.HD1ID,
+	})
+}
+
+// ClaimArrival handles POST /api/worlds/{worldId}/arrivals/{ticket}/claim,
+// placing the calling session's avatar where a handed-over arrival says
+func ClaimArrival(w http.ResponseWriter, r *http.Request) {
+	hub, world, ok := liveWorld(w, r)
+	if !ok {
+		return
+	}
+	caller := shared.Context(r).Session
+	if caller == "" || !hub.IsConnected(caller) {
+		http.Error(w, "Claiming an arrival requires the X-HD1-ID of a connected session", http.StatusBadRequest)
+		return
+	}
+	arrival, err := portals.Claim(mux.Vars(r)["ticket"], time.Now())
+	if err != nil || arrival.World != world {
+		http.Error(w, "Arrival unknown or expired", http.StatusNotFound)
+		return
+	}
+
+	shared.PlaceAvatar(hub, caller, *arrival.Position, arrival.Yaw, arrival.Pitch)
+	hub.PublishPortal("arrived", arrival)
+	writeArrival(w, http.StatusOK, arrival)
+
+	logging.Info("portal arrival claimed", map[string]interface{}{
+		"world":  world,
+		"from":   arrival.From,
+		"hd1_id": caller,
+	})
+}
@@ -0,0 +1,83 @@
+package worlds
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"holodeck1/api/shared"
+	"holodeck1/logging"
+	"holodeck1/sync"
+	"holodeck1/units"
+)
+
+// SpaceResponse reports a world's unit system and coordinate space
+type SpaceResponse struct {
+	Success bool         `json:"success"`
+	World   string       `json:"world"`
+	Space   *units.Space `json:"space"`
+	SeqNum  uint64       `json:"seq_num,omitempty"` // Operation that set it
+}
+
+// GetSpace handles GET /api/worlds/{worldId}/space
+func GetSpace(w http.ResponseWriter, r *http.Request) {
+	hub, world, ok := liveWorld(w, r)
+	if !ok {
+		return
+	}
+	state, ok := currentState(w, hub)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SpaceResponse{
+		Success: true,
+		World:   world,
+		Space:   units.FromScene(state.Scene),
+	})
+}
+
+// SetSpace handles PUT /api/worlds/{worldId}/space. It changes how the
+// world is exported and imported, not the entities in it.
+func SetSpace(w http.ResponseWriter, r *http.Request) {
+	hub, world, ok := liveWorld(w, r)
+	if !ok {
+		return
+	}
+	var space units.Space
+	if err := json.NewDecoder(r.Body).Decode(&space); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := space.Validate(); err != nil {
+		http.Error(w, "Invalid space: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// A scene setting like physics, so it is versioned with the world
+	clientID := shared.GetClientID(r)
+	operation := &sync.Operation{
+		ClientID:  clientID,
+		Type:      sync.OpSceneUpdate,
+		Data:      map[string]interface{}{"space": space.Data()},
+		Timestamp: time.Now(),
+	}
+	hub.GetSync().SubmitOperation(operation)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SpaceResponse{
+		Success: true,
+		World:   world,
+		Space:   &space,
+		SeqNum:  operation.SeqNum,
+	})
+
+	logging.Info("world space set", map[string]interface{}{
+		"world":   world,
+		"units":   space.Units,
+		"up_axis": space.UpAxis,
+		"hd1_id":  clientID,
+		"seq_num": operation.SeqNum,
+	})
+}
@@ -0,0 +1,125 @@
+package worlds
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+	"holodeck1/spectators"
+	"holodeck1/views"
+)
+
+// DirectRequest sets the director's shot: a saved view, or a camera
+// position and orientation
+type DirectRequest struct {
+	View         string          `json:"view"`
+	Position     *views.Position `json:"position"`
+	Yaw          float64         `json:"yaw"`
+	Pitch        float64         `json:"pitch"`
+	FOV          float64         `json:"fov"`
+	TransitionMS int             `json:"transition_ms"`
+}
+
+// ListSpectators handles GET /api/worlds/{worldId}/spectators, reporting
+// who watches the world and the director's shot
+func ListSpectators(w http.ResponseWriter, r *http.Request) {
+	_, world, _, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	shot, _ := spectators.Current()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"world":      world,
+		"enabled":    config.GetSpectatorsEnabled(),
+		"max":        config.GetSpectatorsMax(),
+		"spectators": spectators.List(),
+		"director":   shot,
+	})
+}
+
+// SetDirector handles PUT /api/worlds/{worldId}/director, moving the
+// cameras of the spectators following the director to a shot
+func SetDirector(w http.ResponseWriter, r *http.Request) {
+	var req DirectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	hub, world, user, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+
+	shot := &spectators.Shot{
+		Yaw:          req.Yaw,
+		Pitch:        req.Pitch,
+		FOV:          req.FOV,
+		TransitionMS: req.TransitionMS,
+	}
+	switch {
+	case req.View != "":
+		view, ok := loadView(w, world, req.View)
+		if !ok {
+			return
+		}
+		shot.Position, shot.Yaw, shot.Pitch, shot.View = view.Position, view.Yaw, view.Pitch, view.Name
+	case req.Position != nil:
+		shot.Position = *req.Position
+	default:
+		http.Error(w, "view or position required", http.StatusBadRequest)
+		return
+	}
+
+	taken, err := spectators.Direct(shot, user, time.Now())
+	if err != nil {
+		http.Error(w, "Invalid shot: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	reached := hub.Direct(taken)
+
+	logging.Info("director shot taken", map[string]interface{}{
+		"world":     world,
+		"take":      taken.Take,
+		"view":      taken.View,
+		"following": reached,
+		"user":      user,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"director":  taken,
+		"following": reached,
+	})
+}
+
+// ReleaseDirector handles DELETE /api/worlds/{worldId}/director, giving
+// following spectators their own cameras back
+func ReleaseDirector(w http.ResponseWriter, r *http.Request) {
+	hub, world, user, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	released, err := spectators.Release()
+	if err == spectators.ErrNoShot {
+		http.Error(w, "Director has no shot", http.StatusNotFound)
+		return
+	}
+	reached := hub.Direct(nil)
+
+	logging.Info("director shot released", map[string]interface{}{
+		"world":     world,
+		"take":      released.Take,
+		"following": reached,
+		"user":      user,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"director":  released,
+		"following": reached,
+	})
+}
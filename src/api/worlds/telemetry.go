@@ -0,0 +1,97 @@
+package worlds
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"holodeck1/api/shared"
+	"holodeck1/config"
+	"holodeck1/logging"
+	"holodeck1/quality"
+	"holodeck1/telemetry"
+)
+
+// maxSampleBytes bounds the body of a telemetry sample
+const maxSampleBytes = 4 << 10
+
+// ReportTelemetry handles POST /api/worlds/{worldId}/telemetry, adding a
+// console's frame sample to the world's telemetry and stepping the
+// session's quality up or down when the sample calls for it
+func ReportTelemetry(w http.ResponseWriter, r *http.Request) {
+	var sample telemetry.Sample
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSampleBytes)).Decode(&sample); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	hub, world, ok := liveWorld(w, r)
+	if !ok {
+		return
+	}
+	session := shared.Context(r).Session
+	if session == "" || !hub.IsConnected(session) {
+		http.Error(w, "Telemetry requires the X-HD1-ID of a connected session", http.StatusBadRequest)
+		return
+	}
+	profile, _ := hub.GetClientProfile(session)
+
+	switch err := telemetry.Record(world, session, profile.Tier, &sample); err {
+	case nil:
+	case telemetry.ErrDisabled:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case telemetry.ErrTooFrequent:
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	default:
+		http.Error(w, "Invalid sample: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if directive, changed := quality.Observe(session, sample.FPS); changed {
+		hub.SendQualityDirective(session, directive)
+		logging.Info("console quality changed", map[string]interface{}{
+			"world":  world,
+			"hd1_id": session,
+			"level":  directive.Level,
+			"fps":    sample.FPS,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"density": telemetry.Density(sample.Entities),
+		"tier":    profile.Tier,
+	})
+}
+
+// GetTelemetry handles GET /api/worlds/{worldId}/telemetry, reporting how
+// consoles render the world by entity density and client tier
+func GetTelemetry(w http.ResponseWriter, r *http.Request) {
+	_, world, _, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"telemetry": telemetry.For(world),
+	})
+}
+
+// GetQuality handles GET /api/worlds/{worldId}/quality, reporting the
+// quality levels consoles may be stepped to and where each session is
+func GetQuality(w http.ResponseWriter, r *http.Request) {
+	_, world, _, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"world":      world,
+		"adaptive":   config.GetQualityAdaptive(),
+		"target_fps": config.GetTelemetryTargetFPS(),
+		"levels":     quality.Levels(),
+		"sessions":   quality.Sessions(),
+	})
+}
@@ -0,0 +1,22 @@
+package worlds
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"holodeck1/usage"
+)
+
+// GetUsage handles GET /api/worlds/{worldId}/usage, reporting what the
+// world costs the server against its budgets
+func GetUsage(w http.ResponseWriter, r *http.Request) {
+	_, _, _, ok := moderatedWorld(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"usage":   usage.Current(),
+	})
+}
@@ -0,0 +1,217 @@
+package worlds
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"holodeck1/api/shared"
+	"holodeck1/logging"
+	"holodeck1/moderation"
+	"holodeck1/portals"
+	"holodeck1/server"
+	"holodeck1/views"
+)
+
+// SaveViewRequest places a named view, usually where a console's camera is
+type SaveViewRequest struct {
+	Title    string          `json:"title"`
+	Position *views.Position `json:"position"`
+	Yaw      float64         `json:"yaw"`
+	Pitch    float64         `json:"pitch"`
+}
+
+// viewWorld returns the hub and the world of a view request, and the
+// caller for requests that need one: a connected session by X-HD1-ID, or
+// an operator
+func viewWorld(w http.ResponseWriter, r *http.Request, needCaller bool) (*server.Hub, string, string, bool) {
+	hub, world, ok := liveWorld(w, r)
+	if !ok {
+		return nil, "", "", false
+	}
+	if !needCaller {
+		return hub, world, "", true
+	}
+	if shared.RefuseBanned(w, r) {
+		return nil, "", "", false
+	}
+	caller := shared.Context(r).Session
+	if caller == "" || !hub.IsConnected(caller) {
+		if !shared.IsOperator(r) {
+			http.Error(w, "Views require the X-HD1-ID of a connected session", http.StatusBadRequest)
+			return nil, "", "", false
+		}
+		caller = shared.GetClientIP(r)
+	}
+	return hub, world, caller, true
+}
+
+// loadView writes 404 for unknown views
+func loadView(w http.ResponseWriter, world, name string) (*views.View, bool) {
+	view, err := views.Get(world, name)
+	if err != nil {
+		http.Error(w, "View not found", http.StatusNotFound)
+		return nil, false
+	}
+	return view, true
+}
+
+// writeView responds with a view
+func writeView(w http.ResponseWriter, status int, view *views.View) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"view":    view,
+	})
+}
+
+// ListViews handles GET /api/worlds/{worldId}/views
+func ListViews(w http.ResponseWriter, r *http.Request) {
+	_, world, _, ok := viewWorld(w, r, false)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"world":   world,
+		"views":   views.List(world),
+	})
+}
+
+// GetView handles GET /api/worlds/{worldId}/views/{viewName}
+func GetView(w http.ResponseWriter, r *http.Request) {
+	_, world, _, ok := viewWorld(w, r, false)
+	if !ok {
+		return
+	}
+	if view, ok := loadView(w, world, mux.Vars(r)["viewName"]); ok {
+		writeView(w, http.StatusOK, view)
+	}
+}
+
+// SaveView handles PUT /api/worlds/{worldId}/views/{viewName}, creating a
+// view or moving one the caller created
+func SaveView(w http.ResponseWriter, r *http.Request) {
+	var req SaveViewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	hub, world, caller, ok := viewWorld(w, r, true)
+	if !ok {
+		return
+	}
+	name := mux.Vars(r)["viewName"]
+	if existing, err := views.Get(world, name); err == nil && existing.CreatedBy != caller && !shared.IsOperator(r) {
+		http.Error(w, "Only the view's creator or an operator may move it", http.StatusForbidden)
+		return
+	}
+
+	view := &views.View{
+		Name:      name,
+		World:     world,
+		Title:     req.Title,
+		Yaw:       req.Yaw,
+		Pitch:     req.Pitch,
+		CreatedBy: caller,
+	}
+	if req.Position == nil {
+		http.Error(w, "position required", http.StatusBadRequest)
+		return
+	}
+	view.Position = *req.Position
+	if view.Title, ok = shared.ScreenText(w, r, moderation.KindEntityText, view.Title); !ok {
+		return
+	}
+
+	saved, err := views.Put(r.Context(), view, time.Now())
+	switch {
+	case err == views.ErrTooMany:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil && view.Validate() != nil:
+		http.Error(w, "Invalid view: "+err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		logging.Error("failed to store view", map[string]interface{}{
+			"world": world,
+			"view":  name,
+			"error": err.Error(),
+		})
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	hub.PublishView("saved", saved)
+	writeView(w, http.StatusOK, saved)
+
+	logging.Info("view saved", map[string]interface{}{
+		"world":  world,
+		"view":   name,
+		"hd1_id": caller,
+	})
+}
+
+// DeleteView handles DELETE /api/worlds/{worldId}/views/{viewName}
+func DeleteView(w http.ResponseWriter, r *http.Request) {
+	hub, world, caller, ok := viewWorld(w, r, true)
+	if !ok {
+		return
+	}
+	view, ok := loadView(w, world, mux.Vars(r)["viewName"])
+	if !ok {
+		return
+	}
+	if view.CreatedBy != caller && !shared.IsOperator(r) {
+		http.Error(w, "Only the view's creator or an operator may delete it", http.StatusForbidden)
+		return
+	}
+	deleted, err := views.Delete(r.Context(), world, view.Name)
+	if err == views.ErrNotFound {
+		http.Error(w, "View not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.Error("failed to delete stored view", map[string]interface{}{
+			"world": world,
+			"view":  view.Name,
+			"error": err.Error(),
+		})
+	}
+	hub.PublishView("deleted", deleted)
+	writeView(w, http.StatusOK, deleted)
+}
+
+// VisitView handles POST /api/worlds/{worldId}/views/{viewName}/visit,
+// placing the calling session's avatar at a view. The jump is not a move,
+// so it is exempt from the world's movement limits.
+func VisitView(w http.ResponseWriter, r *http.Request) {
+	hub, world, ok := liveWorld(w, r)
+	if !ok {
+		return
+	}
+	caller := shared.Context(r).Session
+	if caller == "" || !hub.IsConnected(caller) {
+		http.Error(w, "Visiting a view requires the X-HD1-ID of a connected session", http.StatusBadRequest)
+		return
+	}
+	if shared.RefuseSpectator(w, r) {
+		return
+	}
+	view, ok := loadView(w, world, mux.Vars(r)["viewName"])
+	if !ok {
+		return
+	}
+
+	operation := shared.PlaceAvatar(hub, caller, portals.Position(view.Position), view.Yaw, view.Pitch)
+	writeView(w, http.StatusOK, view)
+
+	logging.Debug("view visited", map[string]interface{}{
+		"world":   world,
+		"view":    view.Name,
+		"hd1_id":  caller,
+		"seq_num": operation.SeqNum,
+	})
+}
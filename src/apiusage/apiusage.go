@@ -0,0 +1,301 @@
+// Package apiusage counts API calls per organization, per key and per
+// operation: calls, client and server errors, and latency, for tuning rate
+// limits and spotting abuse.
+//
+// A key is the bearer token a call carried, named by a fingerprint so the
+// token itself is never kept; calls without one count as anonymous. The
+// router hands every call to Observe, which only queues it; one goroutine
+// folds the queue into the counters and drops calls when it falls behind
+// rather than slow requests down. Counters are kept in memory from the
+// start of the server, up to a configured number of keys; calls of keys
+// past it are counted as overflow only.
+package apiusage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"holodeck1/config"
+)
+
+// Anonymous is the key of calls without a bearer token
+const Anonymous = "anonymous"
+
+// queueSize bounds the calls waiting to be counted
+const queueSize = 4096
+
+// minutes is how many per-minute call counts are kept for each key
+const minutes = 60
+
+// bounds are the upper bounds of the latency buckets, in milliseconds;
+// percentiles are reported as the bound of the bucket they fall in
+var bounds = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// Call is one API call as the router saw it
+type Call struct {
+	Org       string
+	Key       string
+	Operation string
+	Status    int
+	Latency   time.Duration
+	At        time.Time
+}
+
+// Latency summarizes call latencies in milliseconds
+type Latency struct {
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// Counters are what calls of a key, or of one operation, added up to
+type Counters struct {
+	Calls        uint64    `json:"calls"`
+	ClientErrors uint64    `json:"client_errors"` // 4xx answers, refusals included
+	ServerErrors uint64    `json:"server_errors"` // 5xx answers
+	ErrorRate    float64   `json:"error_rate"`    // Share of calls answered 4xx or 5xx
+	Latency      Latency   `json:"latency_ms"`
+	LastCall     time.Time `json:"last_call"`
+}
+
+// OperationUsage is a key's calls of one operation
+type OperationUsage struct {
+	Operation string `json:"operation"`
+	Counters
+}
+
+// KeyUsage is one key's calls within an organization
+type KeyUsage struct {
+	Key string `json:"key"`
+	Counters
+	CallsLastMinute uint64           `json:"calls_last_minute"`
+	PeakPerMinute   uint64           `json:"peak_per_minute"` // Busiest minute of the last hour
+	Operations      []OperationUsage `json:"operations"`      // Most called first
+}
+
+// Report is an organization's API usage
+type Report struct {
+	Org      string     `json:"org"`
+	Since    time.Time  `json:"since"`    // Counting started
+	Keys     []KeyUsage `json:"keys"`     // Most calls first
+	Overflow uint64     `json:"overflow"` // Calls of keys past the configured limit, every organization
+	Dropped  uint64     `json:"dropped"`  // Calls not counted while counting fell behind
+}
+
+// counter adds up calls
+type counter struct {
+	calls, clientErrors, serverErrors uint64
+	total, max                        time.Duration
+	buckets                           []uint64 // One per bound, and one past the last
+	lastCall                          time.Time
+}
+
+func newCounter() *counter {
+	return &counter{buckets: make([]uint64, len(bounds)+1)}
+}
+
+func (c *counter) add(call Call) {
+	c.calls++
+	switch {
+	case call.Status >= 500:
+		c.serverErrors++
+	case call.Status >= 400:
+		c.clientErrors++
+	}
+	c.total += call.Latency
+	if call.Latency > c.max {
+		c.max = call.Latency
+	}
+	ms := float64(call.Latency) / float64(time.Millisecond)
+	bucket := sort.SearchFloat64s(bounds, ms)
+	c.buckets[bucket]++
+	if call.At.After(c.lastCall) {
+		c.lastCall = call.At
+	}
+}
+
+func (c *counter) counters() Counters {
+	result := Counters{
+		Calls:        c.calls,
+		ClientErrors: c.clientErrors,
+		ServerErrors: c.serverErrors,
+		LastCall:     c.lastCall,
+	}
+	if c.calls == 0 {
+		return result
+	}
+	result.ErrorRate = float64(c.clientErrors+c.serverErrors) / float64(c.calls)
+	max := float64(c.max) / float64(time.Millisecond)
+	result.Latency = Latency{
+		Mean: float64(c.total) / float64(c.calls) / float64(time.Millisecond),
+		P50:  c.percentile(0.50, max),
+		P95:  c.percentile(0.95, max),
+		P99:  c.percentile(0.99, max),
+		Max:  max,
+	}
+	return result
+}
+
+// percentile returns the bound of the bucket the q-th call falls in; the
+// slowest calls never report more than the slowest seen
+func (c *counter) percentile(q float64, max float64) float64 {
+	rank := uint64(q*float64(c.calls) + 0.5)
+	if rank == 0 {
+		rank = 1
+	}
+	var seen uint64
+	for i, count := range c.buckets {
+		seen += count
+		if seen >= rank {
+			if i < len(bounds) && bounds[i] < max {
+				return bounds[i]
+			}
+			return max
+		}
+	}
+	return max
+}
+
+// key is one key's counters within an organization
+type key struct {
+	counter
+	operations map[string]*counter
+	perMinute  [minutes]uint64 // Calls by minute, indexed by minute modulo minutes
+	minuteOf   [minutes]int64  // Unix minute each slot counts
+}
+
+func (k *key) addMinute(at time.Time) {
+	minute := at.Unix() / 60
+	slot := minute % minutes
+	if k.minuteOf[slot] != minute {
+		k.minuteOf[slot], k.perMinute[slot] = minute, 0
+	}
+	k.perMinute[slot]++
+}
+
+// minuteCounts returns the calls of the current minute and of the busiest
+// minute of the last hour
+func (k *key) minuteCounts(now time.Time) (last, peak uint64) {
+	minute := now.Unix() / 60
+	for slot := range k.perMinute {
+		if minute-k.minuteOf[slot] >= minutes {
+			continue
+		}
+		if k.minuteOf[slot] == minute {
+			last = k.perMinute[slot]
+		}
+		if k.perMinute[slot] > peak {
+			peak = k.perMinute[slot]
+		}
+	}
+	return last, peak
+}
+
+var (
+	queue = make(chan Call, queueSize)
+
+	mutex    sync.RWMutex
+	orgs     = make(map[string]map[string]*key)
+	keys     int
+	overflow uint64
+	dropped  uint64
+	since    = time.Now().UTC()
+)
+
+// KeyFor names the key a request carried: a fingerprint of its bearer
+// token, or Anonymous
+func KeyFor(r *http.Request) string {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || token == "" {
+		return Anonymous
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "key-" + hex.EncodeToString(sum[:6])
+}
+
+// Observe queues a call to be counted, dropping it when the queue is full
+func Observe(call Call) {
+	select {
+	case queue <- call:
+	default:
+		mutex.Lock()
+		dropped++
+		mutex.Unlock()
+	}
+}
+
+// Run counts queued calls until ctx ends
+func Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case call := <-queue:
+			count(call)
+		}
+	}
+}
+
+func count(call Call) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	k, ok := orgs[call.Org][call.Key]
+	if !ok {
+		if keys >= config.GetAPIUsageMaxKeys() {
+			overflow++
+			return
+		}
+		if orgs[call.Org] == nil {
+			orgs[call.Org] = make(map[string]*key)
+		}
+		k = &key{counter: *newCounter(), operations: make(map[string]*counter)}
+		orgs[call.Org][call.Key] = k
+		keys++
+	}
+	k.add(call)
+	k.addMinute(call.At)
+	operation, ok := k.operations[call.Operation]
+	if !ok {
+		operation = newCounter()
+		k.operations[call.Operation] = operation
+	}
+	operation.add(call)
+}
+
+// For reports an organization's usage, of every key or of one
+func For(org, only string) *Report {
+	now := time.Now()
+	mutex.RLock()
+	defer mutex.RUnlock()
+	report := &Report{
+		Org:      org,
+		Since:    since,
+		Keys:     []KeyUsage{},
+		Overflow: overflow,
+		Dropped:  dropped,
+	}
+	for name, k := range orgs[org] {
+		if only != "" && name != only {
+			continue
+		}
+		usage := KeyUsage{Key: name, Counters: k.counters(), Operations: []OperationUsage{}}
+		usage.CallsLastMinute, usage.PeakPerMinute = k.minuteCounts(now)
+		for operation, c := range k.operations {
+			usage.Operations = append(usage.Operations, OperationUsage{Operation: operation, Counters: c.counters()})
+		}
+		sort.Slice(usage.Operations, func(i, j int) bool {
+			return usage.Operations[i].Calls > usage.Operations[j].Calls
+		})
+		report.Keys = append(report.Keys, usage)
+	}
+	sort.Slice(report.Keys, func(i, j int) bool { return report.Keys[i].Calls > report.Keys[j].Calls })
+	return report
+}
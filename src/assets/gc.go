@@ -0,0 +1,169 @@
+package assets
+
+import (
+	"context"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/holds"
+	"holodeck1/logging"
+	"holodeck1/storage"
+	"holodeck1/sync"
+)
+
+// OperationSource supplies the current sync operation log, without waking
+// a hibernating one
+type OperationSource func() []*sync.Operation
+
+// OrphanReport lists unreferenced blobs
+type OrphanReport struct {
+	Orphans       []Blob    `json:"orphans"`
+	OrphanBytes   int64     `json:"orphan_bytes"`
+	TotalBlobs    int       `json:"total_blobs"`
+	TotalBytes    int64     `json:"total_bytes"`
+	Complete      bool      `json:"references_complete"`
+	GracePeriod   string    `json:"grace_period"`
+	GeneratedAt   time.Time `json:"generated_at"`
+	HeldBy        string    `json:"held_by,omitempty"` // Legal hold keeping orphans from collection
+	Reclaimed     int       `json:"reclaimed,omitempty"`
+	ReclaimedSize int64     `json:"reclaimed_bytes,omitempty"`
+}
+
+// FindOrphans reports blobs with no references that are older than grace.
+// Younger blobs are skipped so a fresh upload is never collected before the
+// entity referencing it has been created.
+func FindOrphans(ctx context.Context, backend storage.Backend, ops []*sync.Operation, grace time.Duration) (*OrphanReport, error) {
+	blobs, err := List(ctx, backend)
+	if err != nil {
+		return nil, err
+	}
+	refs := CollectReferences(ops, config.GetWorldsDir())
+	if err := refs.CollectStoredReferences(ctx, backend); err != nil {
+		return nil, err
+	}
+
+	// Quarantined blobs wait for an operator to release or discard them
+	quarantined, err := quarantinedDigests(ctx, backend)
+	if err != nil {
+		return nil, err
+	}
+	for digest := range quarantined {
+		refs.Counts[digest]++
+	}
+
+	// Optimized variants and point cloud tiles live as long as their
+	// source is referenced
+	for _, blob := range blobs {
+		if refs.Counts[blob.Digest] == 0 {
+			continue
+		}
+		if manifest, _ := LoadManifest(ctx, backend, blob.Digest); manifest != nil {
+			for _, variant := range manifest.Variants {
+				refs.Counts[variant.Digest]++
+			}
+		}
+		if cloud, _ := LoadPointCloud(ctx, backend, blob.Digest); cloud != nil {
+			for _, node := range cloud.Nodes {
+				refs.Counts[node.Digest]++
+			}
+		}
+	}
+
+	report := &OrphanReport{
+		Orphans:     []Blob{},
+		TotalBlobs:  len(blobs),
+		Complete:    refs.Complete,
+		GracePeriod: grace.String(),
+		GeneratedAt: time.Now().UTC(),
+	}
+	cutoff := time.Now().Add(-grace)
+	for _, blob := range blobs {
+		report.TotalBytes += blob.Size
+		if refs.Counts[blob.Digest] > 0 || blob.StoredAt.After(cutoff) {
+			continue
+		}
+		report.Orphans = append(report.Orphans, blob)
+		report.OrphanBytes += blob.Size
+	}
+	return report, nil
+}
+
+// CollectGarbage deletes orphaned blobs. Nothing is deleted while the
+// reference scan is incomplete, since truncated history or an unreadable
+// checkpoint or export could hide users, or while the served world is
+// under legal hold, since orphans may be what its deleted entities showed.
+func CollectGarbage(ctx context.Context, backend storage.Backend, ops []*sync.Operation, grace time.Duration, dryRun bool) (*OrphanReport, error) {
+	report, err := FindOrphans(ctx, backend, ops, grace)
+	if err != nil {
+		return nil, err
+	}
+	if hold := holds.Held(holds.KindWorld, config.GetWorldsDefaultWorld()); hold != nil {
+		report.HeldBy = hold.ID
+		if !dryRun {
+			logging.Info("asset gc skipped - world under legal hold", map[string]interface{}{
+				"hold_id": hold.ID,
+				"orphans": len(report.Orphans),
+			})
+		}
+		return report, nil
+	}
+	if dryRun || !report.Complete {
+		if !report.Complete {
+			logging.Warn("asset gc skipped - references incomplete", map[string]interface{}{
+				"orphans": len(report.Orphans),
+			})
+		}
+		return report, nil
+	}
+
+	for _, blob := range report.Orphans {
+		if err := backend.Delete(ctx, blob.Key); err != nil {
+			logging.Error("asset gc delete failed", map[string]interface{}{
+				"digest": blob.Digest,
+				"error":  err.Error(),
+			})
+			continue
+		}
+		deleteManifest(ctx, backend, blob.Digest)
+		deletePointCloud(ctx, backend, blob.Digest)
+		report.Reclaimed++
+		report.ReclaimedSize += blob.Size
+	}
+
+	logging.Info("asset gc completed", map[string]interface{}{
+		"orphans":         len(report.Orphans),
+		"reclaimed":       report.Reclaimed,
+		"reclaimed_bytes": report.ReclaimedSize,
+	})
+	return report, nil
+}
+
+// RunGarbageCollector reclaims orphans every configured interval until ctx ends
+func RunGarbageCollector(ctx context.Context, source OperationSource) {
+	interval := config.GetAssetsGCInterval()
+	if interval <= 0 {
+		logging.Info("asset gc disabled", map[string]interface{}{
+			"interval": interval.String(),
+		})
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			backend := storage.Default()
+			if backend == nil {
+				continue
+			}
+			if _, err := CollectGarbage(ctx, backend, source(), config.GetAssetsGCGracePeriod(), false); err != nil {
+				logging.Error("asset gc failed", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+		}
+	}
+}
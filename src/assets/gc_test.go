@@ -0,0 +1,158 @@
+package assets
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"holodeck1/storage"
+	"holodeck1/sync"
+)
+
+const testGrace = 24 * time.Hour
+
+// storeTestBlob stores content as a blob, aged by age
+func storeTestBlob(t *testing.T, backend *storage.FilesystemBackend, root, content string, age time.Duration) *Blob {
+	t.Helper()
+	blob, _, err := Put(context.Background(), backend, strings.NewReader(content), 1<<20, "text/plain")
+	if err != nil {
+		t.Fatalf("storing blob: %v", err)
+	}
+	stored := time.Now().Add(-age)
+	if err := os.Chtimes(filepath.Join(root, filepath.FromSlash(blob.Key)), stored, stored); err != nil {
+		t.Fatalf("aging blob: %v", err)
+	}
+	return blob
+}
+
+// putTestObject stores an object under key
+func putTestObject(t *testing.T, backend storage.Backend, key string, content []byte) {
+	t.Helper()
+	if err := backend.Put(context.Background(), key, bytes.NewReader(content), int64(len(content)), "application/json"); err != nil {
+		t.Fatalf("storing %s: %v", key, err)
+	}
+}
+
+func TestCollectGarbageKeepsReferencedAndProtectedBlobs(t *testing.T) {
+	tests := []struct {
+		name string
+		age  time.Duration
+		// setup returns the operation log referencing blob, and protects it
+		// otherwise where the case needs to
+		setup func(t *testing.T, backend storage.Backend, blob *Blob) []*sync.Operation
+		kept  bool
+	}{
+		{
+			name: "unreferenced blob past the grace period is collected",
+			age:  2 * testGrace,
+			setup: func(t *testing.T, backend storage.Backend, blob *Blob) []*sync.Operation {
+				return nil
+			},
+			kept: false,
+		},
+		{
+			name: "blob referenced only by a transaction's part is kept",
+			age:  2 * testGrace,
+			setup: func(t *testing.T, backend storage.Backend, blob *Blob) []*sync.Operation {
+				transaction := sync.NewTransaction("client", "tx-1", []*sync.Operation{{
+					Type: sync.OpEntityCreate,
+					Data: map[string]interface{}{"id": "entity-1", "model": blob.Ref},
+				}})
+				transaction.SeqNum = 1
+				return []*sync.Operation{transaction}
+			},
+			kept: true,
+		},
+		{
+			name: "blob whose entity a transaction deleted is collected",
+			age:  2 * testGrace,
+			setup: func(t *testing.T, backend storage.Backend, blob *Blob) []*sync.Operation {
+				created := &sync.Operation{SeqNum: 1, Type: sync.OpEntityCreate, Data: map[string]interface{}{"id": "entity-1", "model": blob.Ref}}
+				transaction := sync.NewTransaction("client", "tx-1", []*sync.Operation{{
+					Type: sync.OpEntityDelete,
+					Data: map[string]interface{}{"id": "entity-1"},
+				}})
+				transaction.SeqNum = 2
+				return []*sync.Operation{created, transaction}
+			},
+			kept: false,
+		},
+		{
+			name: "blob referenced only by a checkpoint is kept",
+			age:  2 * testGrace,
+			setup: func(t *testing.T, backend storage.Backend, blob *Blob) []*sync.Operation {
+				state := `{"id":"cp-1","state":{"entities":{"entity-1":{"model":"` + blob.Ref + `"}}}}`
+				putTestObject(t, backend, storage.NamespaceWorlds+"/world_one/checkpoints/cp-1.json", []byte(state))
+				return nil
+			},
+			kept: true,
+		},
+		{
+			name: "blob referenced only by a gzipped export is kept",
+			age:  2 * testGrace,
+			setup: func(t *testing.T, backend storage.Backend, blob *Blob) []*sync.Operation {
+				var export bytes.Buffer
+				writer := gzip.NewWriter(&export)
+				writer.Write([]byte(strings.Repeat(" ", scanChunk-10) + `{"model":"/api/assets/` + blob.Digest + `"}`))
+				writer.Close()
+				putTestObject(t, backend, storage.NamespaceExports+"/world_one.json.gz", export.Bytes())
+				return nil
+			},
+			kept: true,
+		},
+		{
+			name: "quarantined blob is kept",
+			age:  2 * testGrace,
+			setup: func(t *testing.T, backend storage.Backend, blob *Blob) []*sync.Operation {
+				record := &Quarantine{Digest: blob.Digest, Size: blob.Size, Scanner: "test", QuarantinedAt: time.Now()}
+				if err := saveQuarantine(context.Background(), backend, record); err != nil {
+					t.Fatalf("quarantining blob: %v", err)
+				}
+				return nil
+			},
+			kept: true,
+		},
+		{
+			name: "orphan younger than the grace period is kept",
+			age:  testGrace / 2,
+			setup: func(t *testing.T, backend storage.Backend, blob *Blob) []*sync.Operation {
+				return nil
+			},
+			kept: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			root := t.TempDir()
+			backend, err := storage.NewFilesystemBackend(root, "")
+			if err != nil {
+				t.Fatalf("creating backend: %v", err)
+			}
+			blob := storeTestBlob(t, backend, root, "asset for "+tt.name, tt.age)
+			ops := tt.setup(t, backend, blob)
+
+			report, err := CollectGarbage(ctx, backend, ops, testGrace, false)
+			if err != nil {
+				t.Fatalf("CollectGarbage: %v", err)
+			}
+			if !report.Complete {
+				t.Fatalf("reference scan reported incomplete")
+			}
+
+			_, err = backend.Stat(ctx, blob.Key)
+			switch {
+			case tt.kept && err != nil:
+				t.Errorf("blob collected, want kept (reclaimed %d): %v", report.Reclaimed, err)
+			case !tt.kept && err != storage.ErrNotFound:
+				t.Errorf("blob kept, want collected (orphans %d): %v", len(report.Orphans), err)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package assets
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// Octree tiling
+const (
+	octreeGrid     = 64 // Sampling cells per node edge
+	octreeMaxDepth = 16
+	tileMagic      = "HD1P"
+	tileVersion    = 1
+)
+
+// octreeTile is one node of a tiled cloud, before it is stored
+type octreeTile struct {
+	name    string // r, then one octant digit 0-7 per level
+	min     [3]float64
+	edge    float64
+	spacing float64
+	points  []cloudPoint
+}
+
+// buildOctree tiles points relative to origin. Every node keeps an even
+// sample of the points in its cube, at most one per cell of a 64³ grid and
+// at most capacity; the rest pass to its children, so each level adds
+// detail to its parent's. Points beyond capacity in the deepest level are
+// dropped, reported as the count not kept.
+func buildOctree(points []cloudPoint, origin [3]float64, capacity int) ([]*octreeTile, int) {
+	low := [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+	high := [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	for i := range points {
+		for axis := 0; axis < 3; axis++ {
+			points[i].position[axis] -= origin[axis]
+			low[axis] = math.Min(low[axis], points[i].position[axis])
+			high[axis] = math.Max(high[axis], points[i].position[axis])
+		}
+	}
+	edge := math.Max(high[0]-low[0], math.Max(high[1]-low[1], high[2]-low[2]))
+	edge = math.Max(edge*1.0001, 1e-6) // Points on the far faces stay inside
+
+	var tiles []*octreeTile
+	dropped := 0
+	var split func(name string, min [3]float64, edge float64, points []cloudPoint)
+	split = func(name string, min [3]float64, edge float64, points []cloudPoint) {
+		tile := &octreeTile{name: name, min: min, edge: edge, spacing: edge / octreeGrid}
+		tiles = append(tiles, tile)
+		depth := len(name) - 1
+		if len(points) <= capacity {
+			tile.points = points
+			return
+		}
+
+		var rest []cloudPoint
+		cells := make(map[[3]int]bool, capacity)
+		for _, point := range points {
+			cell := [3]int{}
+			for axis := 0; axis < 3; axis++ {
+				cell[axis] = int((point.position[axis] - min[axis]) / tile.spacing)
+			}
+			if !cells[cell] && len(tile.points) < capacity {
+				cells[cell] = true
+				tile.points = append(tile.points, point)
+			} else {
+				rest = append(rest, point)
+			}
+		}
+		if depth == octreeMaxDepth {
+			dropped += len(rest)
+			return
+		}
+
+		half := edge / 2
+		var octants [8][]cloudPoint
+		for _, point := range rest {
+			octant := 0
+			for axis := 0; axis < 3; axis++ {
+				if point.position[axis] >= min[axis]+half {
+					octant |= 1 << axis
+				}
+			}
+			octants[octant] = append(octants[octant], point)
+		}
+		for octant, inside := range octants {
+			if len(inside) == 0 {
+				continue
+			}
+			corner := min
+			for axis := 0; axis < 3; axis++ {
+				if octant&(1<<axis) != 0 {
+					corner[axis] += half
+				}
+			}
+			split(name+string(rune('0'+octant)), corner, half, inside)
+		}
+	}
+	split("r", low, edge, points)
+	return tiles, dropped
+}
+
+// encodeTile writes a tile's points: the magic "HD1P", version, point
+// count and flags as little-endian uint32s, then x, y, z float32s relative
+// to the cloud's origin, then r, g, b bytes
+func encodeTile(points []cloudPoint) []byte {
+	var out bytes.Buffer
+	out.WriteString(tileMagic)
+	binary.Write(&out, binary.LittleEndian, []uint32{tileVersion, uint32(len(points)), 1})
+	positions := make([]float32, 0, 3*len(points))
+	colours := make([]byte, 0, 3*len(points))
+	for _, point := range points {
+		positions = append(positions, float32(point.position[0]), float32(point.position[1]), float32(point.position[2]))
+		colours = append(colours, point.colour[:]...)
+	}
+	binary.Write(&out, binary.LittleEndian, positions)
+	out.Write(colours)
+	return out.Bytes()
+}
@@ -0,0 +1,345 @@
+package assets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+	"holodeck1/storage"
+)
+
+var orgPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Settings are the per-organization optimization preferences
+type Settings struct {
+	Enabled        bool   `json:"enabled"`
+	Geometry       string `json:"geometry"`         // draco, meshopt or none
+	Textures       string `json:"textures"`         // etc1s, uastc (both KTX2) or none
+	MaxTextureSize int    `json:"max_texture_size"` // Downscale larger textures, 0 keeps size
+	// ReducedTextureSize adds a low-resolution variant for constrained
+	// clients (see the clients.*_texture_size tiers), 0 disables it
+	ReducedTextureSize int `json:"reduced_texture_size"`
+}
+
+// DefaultSettings applies to organizations that never saved settings
+func DefaultSettings() Settings {
+	return Settings{
+		Enabled:            false,
+		Geometry:           FeatureDraco,
+		Textures:           "etc1s",
+		ReducedTextureSize: 1024,
+	}
+}
+
+// Validate checks settings values
+func (s Settings) Validate() error {
+	switch s.Geometry {
+	case FeatureDraco, FeatureMeshopt, "none":
+	default:
+		return fmt.Errorf("geometry must be draco, meshopt or none")
+	}
+	switch s.Textures {
+	case "etc1s", "uastc", "none":
+	default:
+		return fmt.Errorf("textures must be etc1s, uastc or none")
+	}
+	if s.MaxTextureSize < 0 || s.MaxTextureSize > 16384 {
+		return fmt.Errorf("max_texture_size must be between 0 and 16384")
+	}
+	if s.ReducedTextureSize < 0 || s.ReducedTextureSize > 16384 {
+		return fmt.Errorf("reduced_texture_size must be between 0 and 16384")
+	}
+	return nil
+}
+
+func settingsKey(org string) (string, error) {
+	if !orgPattern.MatchString(org) {
+		return "", fmt.Errorf("invalid organization: %q", org)
+	}
+	return storage.Key(storage.NamespaceAssets, "pipeline/"+org+".json")
+}
+
+// LoadSettings returns the organization's settings or the defaults
+func LoadSettings(ctx context.Context, backend storage.Backend, org string) (Settings, error) {
+	key, err := settingsKey(org)
+	if err != nil {
+		return Settings{}, err
+	}
+	body, _, err := backend.Get(ctx, key)
+	if err == storage.ErrNotFound {
+		return DefaultSettings(), nil
+	}
+	if err != nil {
+		return Settings{}, err
+	}
+	defer body.Close()
+
+	settings := DefaultSettings()
+	if err := json.NewDecoder(body).Decode(&settings); err != nil {
+		return Settings{}, err
+	}
+	return settings, nil
+}
+
+// SaveSettings stores the organization's settings in the storage backend so
+// every node of a deployment sees the same configuration
+func SaveSettings(ctx context.Context, backend storage.Backend, org string, settings Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	key, err := settingsKey(org)
+	if err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	return backend.Put(ctx, key, bytes.NewReader(encoded), int64(len(encoded)), "application/json")
+}
+
+// job is one queued optimization
+type job struct {
+	digest string
+	org    string
+}
+
+var pipelineJobs chan job
+
+// StartPipeline launches the optimization workers when enabled globally
+func StartPipeline(ctx context.Context) {
+	if !config.GetAssetsPipelineEnabled() {
+		return
+	}
+	if _, err := exec.LookPath(config.GetAssetsPipelineTool()); err != nil {
+		logging.Warn("asset pipeline disabled - tool not found", map[string]interface{}{
+			"tool": config.GetAssetsPipelineTool(),
+		})
+		return
+	}
+
+	workers := config.GetAssetsPipelineWorkers()
+	if workers < 1 {
+		workers = 1
+	}
+	pipelineJobs = make(chan job, 256)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case next := <-pipelineJobs:
+					process(ctx, next)
+				}
+			}
+		}()
+	}
+
+	logging.Info("asset pipeline started", map[string]interface{}{
+		"workers": workers,
+		"tool":    config.GetAssetsPipelineTool(),
+	})
+}
+
+// Enqueue schedules background optimization of a GLB blob. It never blocks;
+// false means the pipeline is off or saturated and the blob stays as uploaded.
+func Enqueue(blob *Blob, org string) bool {
+	if pipelineJobs == nil || blob.Format != FormatGLB {
+		return false
+	}
+	select {
+	case pipelineJobs <- job{digest: blob.Digest, org: org}:
+		return true
+	default:
+		logging.Warn("asset pipeline queue full", map[string]interface{}{
+			"digest": blob.Digest,
+		})
+		return false
+	}
+}
+
+// process builds all variants the organization's settings call for
+func process(ctx context.Context, next job) {
+	backend := storage.Default()
+	if backend == nil {
+		return
+	}
+	settings, err := LoadSettings(ctx, backend, next.org)
+	if err != nil || !settings.Enabled {
+		return
+	}
+	if existing, _ := LoadManifest(ctx, backend, next.digest); existing != nil && existing.Status == StatusReady {
+		return
+	}
+
+	manifest := &Manifest{Source: next.digest, Org: next.org, Status: StatusPending, Variants: []Variant{}}
+	SaveManifest(ctx, backend, manifest)
+
+	started := time.Now()
+	variants, err := buildVariants(ctx, backend, next.digest, settings)
+	if err != nil {
+		manifest.Status = StatusFailed
+		manifest.Error = err.Error()
+		logging.Error("asset optimization failed", map[string]interface{}{
+			"digest": next.digest,
+			"org":    next.org,
+			"error":  err.Error(),
+		})
+	} else {
+		manifest.Status = StatusReady
+		manifest.Variants = variants
+		logging.Info("asset optimized", map[string]interface{}{
+			"digest":      next.digest,
+			"org":         next.org,
+			"variants":    len(variants),
+			"duration_ms": time.Since(started).Milliseconds(),
+		})
+	}
+	SaveManifest(ctx, backend, manifest)
+}
+
+// buildVariants produces one variant per useful feature combination, so a
+// client lacking KTX2 support can still receive compressed geometry
+func buildVariants(ctx context.Context, backend storage.Backend, digest string, settings Settings) ([]Variant, error) {
+	workDir, err := os.MkdirTemp("", "hd1-pipeline-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workDir)
+
+	source := filepath.Join(workDir, "source.glb")
+	if err := download(ctx, backend, digest, source); err != nil {
+		return nil, err
+	}
+
+	// Resizing is not a client capability, so it is applied to every variant
+	original := source
+	if settings.MaxTextureSize > 0 {
+		size := strconv.Itoa(settings.MaxTextureSize)
+		resized := filepath.Join(workDir, "resized.glb")
+		if err := runTool(ctx, "resize", source, resized, "--width", size, "--height", size); err != nil {
+			return nil, err
+		}
+		source = resized
+	}
+
+	var combinations [][]string
+	geometry := settings.Geometry != "none"
+	textures := settings.Textures != "none"
+	if geometry {
+		combinations = append(combinations, []string{settings.Geometry})
+	}
+	if textures {
+		combinations = append(combinations, []string{FeatureKTX2})
+	}
+	if geometry && textures {
+		combinations = append(combinations, []string{settings.Geometry, FeatureKTX2})
+	}
+
+	var variants []Variant
+	for i, features := range combinations {
+		current := source
+		for j, feature := range features {
+			command := feature
+			if feature == FeatureKTX2 {
+				command = settings.Textures
+			}
+			output := filepath.Join(workDir, fmt.Sprintf("variant-%d-%d.glb", i, j))
+			if err := runTool(ctx, command, current, output); err != nil {
+				return nil, err
+			}
+			current = output
+		}
+
+		file, err := os.Open(current)
+		if err != nil {
+			return nil, err
+		}
+		blob, _, err := Put(ctx, backend, file, config.GetAssetsMaxUploadSize(), "model/gltf-binary")
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, Variant{
+			Digest:    blob.Digest,
+			Features:  features,
+			Size:      blob.Size,
+			CreatedAt: time.Now().UTC(),
+		})
+	}
+
+	// The reduced variant needs no decoder support, since low-tier clients
+	// rarely have any
+	reduced := settings.ReducedTextureSize
+	if reduced > 0 && (settings.MaxTextureSize == 0 || reduced < settings.MaxTextureSize) {
+		size := strconv.Itoa(reduced)
+		output := filepath.Join(workDir, "reduced.glb")
+		if err := runTool(ctx, "resize", original, output, "--width", size, "--height", size); err != nil {
+			return nil, err
+		}
+		file, err := os.Open(output)
+		if err != nil {
+			return nil, err
+		}
+		blob, _, err := Put(ctx, backend, file, config.GetAssetsMaxUploadSize(), "model/gltf-binary")
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, Variant{
+			Digest:         blob.Digest,
+			Features:       []string{},
+			Size:           blob.Size,
+			MaxTextureSize: reduced,
+			CreatedAt:      time.Now().UTC(),
+		})
+	}
+	return variants, nil
+}
+
+// runTool invokes one gltf-transform command: <tool> <command> <in> <out> [args]
+func runTool(ctx context.Context, command, input, output string, args ...string) error {
+	stepCtx, cancel := context.WithTimeout(ctx, config.GetAssetsPipelineTimeout())
+	defer cancel()
+
+	argv := append([]string{command, input, output}, args...)
+	cmd := exec.CommandContext(stepCtx, config.GetAssetsPipelineTool(), argv...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %v: %s", config.GetAssetsPipelineTool(), command, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func download(ctx context.Context, backend storage.Backend, digest, target string) error {
+	key, err := BlobKey(digest)
+	if err != nil {
+		return err
+	}
+	body, _, err := backend.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	file, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(file, body)
+	return err
+}
@@ -0,0 +1,233 @@
+package assets
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+	"holodeck1/storage"
+)
+
+// FormatPointCloud marks LAS and PLY point cloud blobs, which are tiled
+// into an octree for progressive streaming
+const FormatPointCloud = "pointcloud"
+
+// TileContentType is the media type of point cloud tiles
+const TileContentType = "application/vnd.hd1.points"
+
+// PointCloudNode is one tile of a point cloud octree. Node names start at
+// the root "r" and add one octant digit 0-7 per level, so a node's
+// children are its name plus a digit.
+type PointCloudNode struct {
+	Name    string     `json:"name"`
+	Digest  string     `json:"digest"` // Tile blob
+	Points  int        `json:"points"`
+	Min     [3]float64 `json:"min"`     // Cube corner, relative to the origin
+	Edge    float64    `json:"edge"`    // Cube edge, in the source units
+	Spacing float64    `json:"spacing"` // Distance between the node's points
+}
+
+// PointCloud records the tiling of a point cloud blob. Tile positions are
+// relative to Origin, the source coordinates (y up) of the cloud's
+// horizontal centre and lowest point, so the cloud stands on the entity's
+// position.
+type PointCloud struct {
+	Source    string           `json:"source"`
+	Format    string           `json:"format"` // las or ply
+	Status    string           `json:"status"` // pending, ready or failed
+	Error     string           `json:"error,omitempty"`
+	Points    int              `json:"points"`  // In the source
+	Dropped   int              `json:"dropped"` // Duplicates beyond the deepest level
+	Origin    [3]float64       `json:"origin"`
+	Nodes     []PointCloudNode `json:"nodes"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// pointCloudJobs queues the digests of clouds to tile
+var pointCloudJobs chan string
+
+func pointCloudKey(digest string) (string, error) {
+	return storage.Key(storage.NamespaceAssets, "pointclouds/"+digest+".json")
+}
+
+// LoadPointCloud returns the tiling of digest, or nil if it was never tiled
+func LoadPointCloud(ctx context.Context, backend storage.Backend, digest string) (*PointCloud, error) {
+	if !ValidDigest(digest) {
+		return nil, nil
+	}
+	key, err := pointCloudKey(digest)
+	if err != nil {
+		return nil, err
+	}
+	body, _, err := backend.Get(ctx, key)
+	if err == storage.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var cloud PointCloud
+	if err := json.NewDecoder(body).Decode(&cloud); err != nil {
+		return nil, err
+	}
+	return &cloud, nil
+}
+
+// savePointCloud writes the tiling of its source blob
+func savePointCloud(ctx context.Context, backend storage.Backend, cloud *PointCloud) error {
+	key, err := pointCloudKey(cloud.Source)
+	if err != nil {
+		return err
+	}
+	cloud.UpdatedAt = time.Now().UTC()
+	encoded, err := json.Marshal(cloud)
+	if err != nil {
+		return err
+	}
+	return backend.Put(ctx, key, bytes.NewReader(encoded), int64(len(encoded)), "application/json")
+}
+
+// deletePointCloud removes the tiling of a collected source blob
+func deletePointCloud(ctx context.Context, backend storage.Backend, digest string) error {
+	key, err := pointCloudKey(digest)
+	if err != nil {
+		return err
+	}
+	return backend.Delete(ctx, key)
+}
+
+// StartPointClouds launches the point cloud tiling workers
+func StartPointClouds(ctx context.Context) {
+	workers := config.GetAssetsPointCloudWorkers()
+	pointCloudJobs = make(chan string, 64)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case next := <-pointCloudJobs:
+					tilePointCloud(ctx, next)
+				}
+			}
+		}()
+	}
+
+	logging.Info("point cloud tiling started", map[string]interface{}{
+		"workers":     workers,
+		"node_points": config.GetAssetsPointCloudNodePoints(),
+	})
+}
+
+// EnqueuePointCloud schedules tiling of a point cloud blob. It never
+// blocks; false means tiling is off or saturated.
+func EnqueuePointCloud(ctx context.Context, backend storage.Backend, blob *Blob) bool {
+	if pointCloudJobs == nil || blob.Format != FormatPointCloud {
+		return false
+	}
+	cloud := &PointCloud{Source: blob.Digest, Status: StatusPending, Nodes: []PointCloudNode{}}
+	if err := savePointCloud(ctx, backend, cloud); err != nil {
+		return false
+	}
+	select {
+	case pointCloudJobs <- blob.Digest:
+		return true
+	default:
+		cloud.Status = StatusFailed
+		cloud.Error = "tiling queue full, upload again later"
+		savePointCloud(ctx, backend, cloud)
+		logging.Warn("point cloud queue full", map[string]interface{}{
+			"digest": blob.Digest,
+		})
+		return false
+	}
+}
+
+// tilePointCloud reads a point cloud and stores its octree
+func tilePointCloud(ctx context.Context, digest string) {
+	backend := storage.Default()
+	if backend == nil {
+		return
+	}
+	cloud := &PointCloud{Source: digest, Status: StatusReady, Nodes: []PointCloudNode{}}
+	started := time.Now()
+	if err := buildPointCloud(ctx, backend, cloud); err != nil {
+		cloud.Status = StatusFailed
+		cloud.Error = err.Error()
+		cloud.Nodes = []PointCloudNode{}
+		logging.Error("point cloud tiling failed", map[string]interface{}{
+			"digest": digest,
+			"error":  err.Error(),
+		})
+	} else {
+		logging.Info("point cloud tiled", map[string]interface{}{
+			"digest":      digest,
+			"points":      cloud.Points,
+			"nodes":       len(cloud.Nodes),
+			"duration_ms": time.Since(started).Milliseconds(),
+		})
+	}
+	savePointCloud(ctx, backend, cloud)
+}
+
+func buildPointCloud(ctx context.Context, backend storage.Backend, cloud *PointCloud) error {
+	key, err := BlobKey(cloud.Source)
+	if err != nil {
+		return err
+	}
+	body, _, err := backend.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	reader := bufio.NewReaderSize(body, 1<<20)
+	header, _ := reader.Peek(4096)
+	if cloud.Format = pointCloudFormat(bytes.NewReader(header)); cloud.Format == "" {
+		return fmt.Errorf("not a LAS or PLY point cloud")
+	}
+	points, err := readPoints(reader, cloud.Format, config.GetAssetsPointCloudMaxPoints())
+	if err != nil {
+		return err
+	}
+	if len(points) == 0 {
+		return fmt.Errorf("cloud has no points")
+	}
+	cloud.Points = len(points)
+
+	low := [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+	high := [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	for _, point := range points {
+		for axis := 0; axis < 3; axis++ {
+			low[axis] = math.Min(low[axis], point.position[axis])
+			high[axis] = math.Max(high[axis], point.position[axis])
+		}
+	}
+	cloud.Origin = [3]float64{(low[0] + high[0]) / 2, low[1], (low[2] + high[2]) / 2}
+
+	tiles, dropped := buildOctree(points, cloud.Origin, config.GetAssetsPointCloudNodePoints())
+	cloud.Dropped = dropped
+	for _, tile := range tiles {
+		encoded := encodeTile(tile.points)
+		blob, _, err := Put(ctx, backend, bytes.NewReader(encoded), int64(len(encoded)), TileContentType)
+		if err != nil {
+			return err
+		}
+		cloud.Nodes = append(cloud.Nodes, PointCloudNode{
+			Name:    tile.name,
+			Digest:  blob.Digest,
+			Points:  len(tile.points),
+			Min:     tile.min,
+			Edge:    tile.edge,
+			Spacing: tile.spacing,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,309 @@
+package assets
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Point cloud source formats
+const (
+	PointFormatLAS = "las"
+	PointFormatPLY = "ply"
+)
+
+// cloudPoint is one point of a cloud, y up
+type cloudPoint struct {
+	position [3]float64
+	colour   [3]uint8
+}
+
+// pointCloudFormat reports the point cloud format r holds: LAS, or PLY
+// with vertices and no faces, which would make it a mesh. LAZ compressed
+// clouds are not recognised.
+func pointCloudFormat(r io.ReaderAt) string {
+	header := make([]byte, 4096)
+	n, _ := r.ReadAt(header, 0)
+	header = header[:n]
+	switch {
+	case bytes.HasPrefix(header, []byte("LASF")) && n > 104 && header[104]&0xC0 == 0:
+		return PointFormatLAS
+	case bytes.HasPrefix(header, []byte("ply")):
+		end := bytes.Index(header, []byte("end_header"))
+		if end < 0 {
+			return ""
+		}
+		vertices, faces := false, false
+		for _, line := range strings.Split(string(header[:end]), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 3 && fields[0] == "element" {
+				count, _ := strconv.Atoi(fields[2])
+				vertices = vertices || (fields[1] == "vertex" && count > 0)
+				faces = faces || (fields[1] == "face" && count > 0)
+			}
+		}
+		if vertices && !faces {
+			return PointFormatPLY
+		}
+	}
+	return ""
+}
+
+// readPoints reads a LAS or PLY point cloud of at most max points
+func readPoints(r io.Reader, format string, max int) ([]cloudPoint, error) {
+	if format == PointFormatLAS {
+		return readLAS(r, max)
+	}
+	return readPLY(bufio.NewReader(r), max)
+}
+
+// lasColourOffsets are where RGB sits in the records of the LAS point
+// formats that have it
+var lasColourOffsets = map[byte]int{2: 20, 3: 28, 5: 28, 7: 30, 8: 30, 10: 30}
+
+// readLAS reads LAS 1.0-1.4 points. LAS is z up, so points are turned y up
+// with x kept: (x, z, -y).
+func readLAS(r io.Reader, max int) ([]cloudPoint, error) {
+	header := make([]byte, 227)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("LAS header: %v", err)
+	}
+	le := binary.LittleEndian
+	headerSize := int(le.Uint16(header[94:]))
+	dataOffset := int(le.Uint32(header[96:]))
+	format := header[104] & 0x3F
+	recordLength := int(le.Uint16(header[105:]))
+	count := uint64(le.Uint32(header[107:]))
+	var scale, offset [3]float64
+	for i := 0; i < 3; i++ {
+		scale[i] = math.Float64frombits(le.Uint64(header[131+8*i:]))
+		offset[i] = math.Float64frombits(le.Uint64(header[155+8*i:]))
+	}
+	if header[24] == 1 && header[25] >= 4 && headerSize >= 255 {
+		// LAS 1.4 keeps the full count after the legacy fields
+		rest := make([]byte, 255-227)
+		if _, err := io.ReadFull(r, rest); err != nil {
+			return nil, fmt.Errorf("LAS header: %v", err)
+		}
+		if count == 0 {
+			count = le.Uint64(rest[247-227:])
+		}
+		header = append(header, rest...)
+	}
+	if format > 10 || recordLength < 12 || dataOffset < len(header) {
+		return nil, fmt.Errorf("unsupported LAS point format %d", format)
+	}
+	if count > uint64(max) {
+		return nil, fmt.Errorf("cloud has %d points, more than the %d allowed", count, max)
+	}
+	if _, err := io.CopyN(io.Discard, r, int64(dataOffset-len(header))); err != nil {
+		return nil, fmt.Errorf("LAS header: %v", err)
+	}
+
+	colourAt, coloured := lasColourOffsets[format]
+	coloured = coloured && recordLength >= colourAt+6
+	points := make([]cloudPoint, 0, count)
+	wide := make([][3]uint16, 0)
+	record := make([]byte, recordLength)
+	deep := false // 16-bit colours, as the specification asks
+	for i := uint64(0); i < count; i++ {
+		if _, err := io.ReadFull(r, record); err != nil {
+			return nil, fmt.Errorf("LAS point %d: %v", i, err)
+		}
+		var source [3]float64
+		for axis := 0; axis < 3; axis++ {
+			source[axis] = float64(int32(le.Uint32(record[4*axis:])))*scale[axis] + offset[axis]
+		}
+		points = append(points, cloudPoint{position: [3]float64{source[0], source[2], -source[1]}})
+		if coloured {
+			var rgb [3]uint16
+			for c := 0; c < 3; c++ {
+				rgb[c] = le.Uint16(record[colourAt+2*c:])
+				deep = deep || rgb[c] > 255
+			}
+			wide = append(wide, rgb)
+		}
+	}
+	for i, rgb := range wide {
+		for c := 0; c < 3; c++ {
+			if deep {
+				rgb[c] >>= 8
+			}
+			points[i].colour[c] = uint8(rgb[c])
+		}
+	}
+	if !coloured {
+		paint(points)
+	}
+	return points, nil
+}
+
+// plyProperty is a scalar vertex property
+type plyProperty struct {
+	name string
+	kind string
+}
+
+var plySizes = map[string]int{
+	"char": 1, "int8": 1, "uchar": 1, "uint8": 1,
+	"short": 2, "int16": 2, "ushort": 2, "uint16": 2,
+	"int": 4, "int32": 4, "uint": 4, "uint32": 4, "float": 4, "float32": 4,
+	"double": 8, "float64": 8,
+}
+
+// readPLY reads the vertices of an ASCII or binary PLY file, as y up
+func readPLY(r *bufio.Reader, max int) ([]cloudPoint, error) {
+	var (
+		encoding   string
+		count      int
+		properties []plyProperty
+		current    string
+		before     bool // An element precedes the vertices
+	)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("PLY header: %v", err)
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "end_header" {
+			break
+		}
+		switch {
+		case fields[0] == "format" && len(fields) >= 2:
+			encoding = fields[1]
+		case fields[0] == "element" && len(fields) == 3:
+			current = fields[1]
+			if current == "vertex" {
+				count, _ = strconv.Atoi(fields[2])
+			} else if count == 0 {
+				before = true
+			}
+		case fields[0] == "property" && current == "vertex":
+			if len(fields) != 3 || plySizes[fields[1]] == 0 {
+				return nil, fmt.Errorf("unsupported PLY vertex property %q", strings.TrimSpace(line))
+			}
+			properties = append(properties, plyProperty{name: fields[2], kind: fields[1]})
+		}
+	}
+	if before {
+		return nil, fmt.Errorf("PLY elements before the vertices are not supported")
+	}
+	if count > max {
+		return nil, fmt.Errorf("cloud has %d points, more than the %d allowed", count, max)
+	}
+	index := make(map[string]int)
+	for i, property := range properties {
+		index[property.name] = i
+	}
+	for _, axis := range []string{"x", "y", "z"} {
+		if _, ok := index[axis]; !ok {
+			return nil, fmt.Errorf("PLY vertices have no %s", axis)
+		}
+	}
+	colourNames := []string{"red", "green", "blue"}
+	if _, ok := index["red"]; !ok {
+		colourNames = []string{"diffuse_red", "diffuse_green", "diffuse_blue"}
+	}
+	_, coloured := index[colourNames[0]]
+
+	var order binary.ByteOrder
+	switch encoding {
+	case "ascii":
+	case "binary_little_endian":
+		order = binary.LittleEndian
+	case "binary_big_endian":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("unsupported PLY format %q", encoding)
+	}
+
+	points := make([]cloudPoint, 0, count)
+	values := make([]float64, len(properties))
+	scratch := make([]byte, 8)
+	for i := 0; i < count; i++ {
+		if order == nil {
+			line, err := r.ReadString('\n')
+			fields := strings.Fields(line)
+			if len(fields) < len(properties) {
+				return nil, fmt.Errorf("PLY vertex %d: expected %d values", i, len(properties))
+			}
+			for j := range properties {
+				if values[j], err = strconv.ParseFloat(fields[j], 64); err != nil {
+					return nil, fmt.Errorf("PLY vertex %d: %v", i, err)
+				}
+			}
+		} else {
+			for j, property := range properties {
+				value, err := readPLYValue(r, order, property.kind, scratch)
+				if err != nil {
+					return nil, fmt.Errorf("PLY vertex %d: %v", i, err)
+				}
+				values[j] = value
+			}
+		}
+		point := cloudPoint{position: [3]float64{values[index["x"]], values[index["y"]], values[index["z"]]}}
+		if coloured {
+			for c, name := range colourNames {
+				value := values[index[name]]
+				if kind := properties[index[name]].kind; strings.HasPrefix(kind, "float") || kind == "double" {
+					value *= 255
+				}
+				point.colour[c] = uint8(math.Max(0, math.Min(255, value)))
+			}
+		}
+		points = append(points, point)
+	}
+	if !coloured {
+		paint(points)
+	}
+	return points, nil
+}
+
+func readPLYValue(r io.Reader, order binary.ByteOrder, kind string, scratch []byte) (float64, error) {
+	buffer := scratch[:plySizes[kind]]
+	if _, err := io.ReadFull(r, buffer); err != nil {
+		return 0, err
+	}
+	switch kind {
+	case "char", "int8":
+		return float64(int8(buffer[0])), nil
+	case "uchar", "uint8":
+		return float64(buffer[0]), nil
+	case "short", "int16":
+		return float64(int16(order.Uint16(buffer))), nil
+	case "ushort", "uint16":
+		return float64(order.Uint16(buffer)), nil
+	case "int", "int32":
+		return float64(int32(order.Uint32(buffer))), nil
+	case "uint", "uint32":
+		return float64(order.Uint32(buffer)), nil
+	case "float", "float32":
+		return float64(math.Float32frombits(order.Uint32(buffer))), nil
+	default:
+		return math.Float64frombits(order.Uint64(buffer)), nil
+	}
+}
+
+// paint colours points without colours by height, so uncoloured scans
+// still show their shape
+func paint(points []cloudPoint) {
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, point := range points {
+		low = math.Min(low, point.position[1])
+		high = math.Max(high, point.position[1])
+	}
+	span := math.Max(high-low, 1e-9)
+	for i := range points {
+		t := (points[i].position[1] - low) / span
+		points[i].colour = [3]uint8{uint8(60 + 180*t), uint8(120 + 80*t), uint8(220 - 140*t)}
+	}
+}
@@ -0,0 +1,248 @@
+package assets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+	"holodeck1/moderation"
+	"holodeck1/storage"
+)
+
+// ErrNotQuarantined is returned releasing or discarding a blob no scan flagged
+var ErrNotQuarantined = errors.New("asset is not quarantined")
+
+// Quarantine records an upload a scan or the image classifier flagged, or
+// a scan could not clear. The blob is kept for review but not served,
+// optimized or tiled until an operator releases it.
+type Quarantine struct {
+	Digest        string            `json:"digest"`
+	Size          int64             `json:"size"`
+	ContentType   string            `json:"content_type,omitempty"`
+	Format        string            `json:"format,omitempty"`
+	Scanner       string            `json:"scanner"`
+	Signature     string            `json:"signature,omitempty"` // What the scanner found
+	Error         string            `json:"error,omitempty"`     // Why the upload could not be scanned
+	Scores        moderation.Scores `json:"scores,omitempty"`    // Image classifier scores per label
+	Uploader      string            `json:"uploader,omitempty"`
+	Org           string            `json:"org,omitempty"`
+	QuarantinedAt time.Time         `json:"quarantined_at"`
+}
+
+func quarantineKey(digest string) (string, error) {
+	return storage.Key(storage.NamespaceAssets, "quarantine/"+digest+".json")
+}
+
+// LoadQuarantine returns the quarantine record of digest, or nil if the
+// blob is not quarantined
+func LoadQuarantine(ctx context.Context, backend storage.Backend, digest string) (*Quarantine, error) {
+	if !ValidDigest(digest) {
+		return nil, nil
+	}
+	key, err := quarantineKey(digest)
+	if err != nil {
+		return nil, err
+	}
+	body, _, err := backend.Get(ctx, key)
+	if err == storage.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var record Quarantine
+	if err := json.NewDecoder(body).Decode(&record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func saveQuarantine(ctx context.Context, backend storage.Backend, record *Quarantine) error {
+	key, err := quarantineKey(record.Digest)
+	if err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return backend.Put(ctx, key, bytes.NewReader(encoded), int64(len(encoded)), "application/json")
+}
+
+func deleteQuarantine(ctx context.Context, backend storage.Backend, digest string) error {
+	key, err := quarantineKey(digest)
+	if err != nil {
+		return err
+	}
+	return backend.Delete(ctx, key)
+}
+
+// ListQuarantine returns the quarantined blobs, most recent first
+func ListQuarantine(ctx context.Context, backend storage.Backend) ([]Quarantine, error) {
+	objects, err := backend.List(ctx, storage.NamespaceAssets+"/quarantine/")
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]Quarantine, 0, len(objects))
+	for _, object := range objects {
+		digest, ok := quarantinedDigest(object.Key)
+		if !ok {
+			continue
+		}
+		record, err := LoadQuarantine(ctx, backend, digest)
+		if err != nil {
+			return nil, err
+		}
+		if record != nil {
+			records = append(records, *record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].QuarantinedAt.After(records[j].QuarantinedAt) })
+	return records, nil
+}
+
+// quarantinedDigests returns the digests of quarantined blobs, which the
+// garbage collector keeps until they are reviewed
+func quarantinedDigests(ctx context.Context, backend storage.Backend) (map[string]bool, error) {
+	objects, err := backend.List(ctx, storage.NamespaceAssets+"/quarantine/")
+	if err != nil {
+		return nil, err
+	}
+	digests := make(map[string]bool, len(objects))
+	for _, object := range objects {
+		if digest, ok := quarantinedDigest(object.Key); ok {
+			digests[digest] = true
+		}
+	}
+	return digests, nil
+}
+
+// quarantinedDigest is the inverse of quarantineKey
+func quarantinedDigest(key string) (string, bool) {
+	digest := strings.TrimSuffix(key[strings.LastIndex(key, "/")+1:], ".json")
+	return digest, strings.HasSuffix(key, ".json") && ValidDigest(digest)
+}
+
+// Release lets a quarantined blob be served again and returns its record
+func Release(ctx context.Context, backend storage.Backend, digest string) (*Quarantine, error) {
+	record, err := LoadQuarantine(ctx, backend, digest)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrNotQuarantined
+	}
+	if err := deleteQuarantine(ctx, backend, digest); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Discard deletes a quarantined blob and its record
+func Discard(ctx context.Context, backend storage.Backend, digest string) (*Quarantine, error) {
+	record, err := LoadQuarantine(ctx, backend, digest)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrNotQuarantined
+	}
+	key, _ := BlobKey(digest)
+	if err := backend.Delete(ctx, key); err != nil && err != storage.ErrNotFound {
+		return nil, err
+	}
+	if err := deleteQuarantine(ctx, backend, digest); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// ErrRejected refuses an upload its organization's image policy blocks
+var ErrRejected = errors.New("content rejected by the organization's policy")
+
+// inspectUpload screens a new blob before it reaches the backend: the
+// malware scan, then image classification under the organization's
+// policy. Blobs the scanner flags or fails on, and images the classifier
+// flags, are quarantined rather than refused, so a false positive loses
+// nothing; images the policy blocks are refused.
+func inspectUpload(ctx context.Context, backend storage.Backend, spool *os.File, blob *Blob, uploader, org string) error {
+	record := &Quarantine{
+		Digest:      blob.Digest,
+		Size:        blob.Size,
+		ContentType: blob.ContentType,
+		Format:      blob.Format,
+		Uploader:    uploader,
+		Org:         org,
+	}
+
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	verdict, scanned, err := scan(ctx, spool, blob.Size)
+	switch {
+	case scanned && err != nil:
+		record.Scanner = config.GetAssetsScanBackend()
+		record.Error = err.Error()
+		return quarantine(ctx, backend, record, blob)
+	case scanned && verdict.Infected:
+		record.Scanner = config.GetAssetsScanBackend()
+		record.Signature = verdict.Signature
+		return quarantine(ctx, backend, record, blob)
+	}
+
+	if blob.Format != FormatImage || !moderation.ClassifiesImages(org) {
+		return nil
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	image := moderation.Image{Org: org, HD1ID: uploader, Digest: blob.Digest, ContentType: imageType(spool), Size: blob.Size}
+	classified := moderation.ScreenImage(ctx, image, spool)
+	switch classified.Action {
+	case moderation.Reject:
+		return fmt.Errorf("%w: %s", ErrRejected, classified.Reason)
+	case moderation.Flag:
+		record.Scanner = "image:" + classified.Classifier
+		record.Scores = classified.Scores
+		if classified.Label == "" {
+			record.Error = classified.Reason
+		} else {
+			record.Signature = classified.Reason
+		}
+		return quarantine(ctx, backend, record, blob)
+	}
+	return nil
+}
+
+// quarantine stores a blob's quarantine record before the blob itself, so
+// it is never served unreviewed
+func quarantine(ctx context.Context, backend storage.Backend, record *Quarantine, blob *Blob) error {
+	record.QuarantinedAt = time.Now().UTC()
+	if err := saveQuarantine(ctx, backend, record); err != nil {
+		return err
+	}
+	blob.Quarantined = true
+
+	logging.Warn("asset quarantined", map[string]interface{}{
+		"digest":    blob.Digest,
+		"size":      blob.Size,
+		"scanner":   record.Scanner,
+		"signature": record.Signature,
+		"error":     record.Error,
+		"hd1_id":    record.Uploader,
+		"org":       record.Org,
+	})
+	return nil
+}
@@ -0,0 +1,169 @@
+package assets
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"holodeck1/logging"
+	"holodeck1/storage"
+	"holodeck1/sync"
+)
+
+// refPattern finds asset references in entity data and world files
+var refPattern = regexp.MustCompile(`(?:sha256:|/assets/)([0-9a-f]{64})`)
+
+// References counts asset references per digest
+type References struct {
+	Counts map[string]int `json:"counts"`
+	// Complete is false when the operation log no longer starts at sequence 1,
+	// meaning entities created before the truncation point cannot be seen,
+	// or when a stored object could not be scanned
+	Complete bool `json:"complete"`
+}
+
+// CollectReferences counts references from live entities, replayed from the
+// sync operation log, and from world definition files under worldsDir
+func CollectReferences(ops []*sync.Operation, worldsDir string) *References {
+	refs := &References{Counts: make(map[string]int), Complete: true}
+	if len(ops) > 0 && ops[0].SeqNum != 1 {
+		refs.Complete = false
+	}
+
+	// Replay entity lifecycle so deleted entities release their references
+	live := make(map[string]map[string]interface{})
+	for _, op := range sync.Expand(ops) {
+		id, _ := op.Data["id"].(string)
+		switch op.Type {
+		case sync.OpEntityCreate:
+			live[id] = op.Data
+		case sync.OpEntityUpdate:
+			if current, exists := live[id]; exists {
+				merged := make(map[string]interface{}, len(current)+len(op.Data))
+				for k, v := range current {
+					merged[k] = v
+				}
+				for k, v := range op.Data {
+					merged[k] = v
+				}
+				live[id] = merged
+			} else {
+				live[id] = op.Data
+			}
+		case sync.OpEntityDelete:
+			delete(live, id)
+		default:
+			// Scene and other state-bearing operations may reference assets too
+			refs.scanValue(op.Data)
+		}
+	}
+	for _, data := range live {
+		refs.scanValue(data)
+	}
+
+	// World definitions reference assets in their YAML text
+	filepath.Walk(worldsDir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		if ext := filepath.Ext(file); ext != ".yaml" && ext != ".yml" && ext != ".json" {
+			return nil
+		}
+		if content, err := os.ReadFile(file); err == nil {
+			refs.scanString(string(content))
+		}
+		return nil
+	})
+
+	return refs
+}
+
+// scanValue scans the JSON form of operation data, which in-process holds
+// typed structs (entities.Material) as well as decoded maps
+func (r *References) scanValue(value interface{}) {
+	if encoded, err := json.Marshal(value); err == nil {
+		r.scanString(string(encoded))
+	}
+}
+
+func (r *References) scanString(s string) {
+	for _, match := range refPattern.FindAllStringSubmatch(s, -1) {
+		r.Counts[match[1]]++
+	}
+}
+
+// scanChunk is how much of a stored object is scanned at once; chunks
+// overlap by one reference less a byte, so none is split unseen
+const scanChunk = 64 << 10
+
+// refLength is the length of the longest reference refPattern matches
+const refLength = len("/assets/") + 64
+
+// CollectStoredReferences adds the references kept in the storage backend:
+// world checkpoints, whose states can be rolled back to, and exports,
+// which can be imported again. Gzipped exports are scanned uncompressed.
+func (r *References) CollectStoredReferences(ctx context.Context, backend storage.Backend) error {
+	checkpoints, err := backend.List(ctx, storage.NamespaceWorlds+"/")
+	if err != nil {
+		return err
+	}
+	exports, err := backend.List(ctx, storage.NamespaceExports+"/")
+	if err != nil {
+		return err
+	}
+	for _, object := range append(checkpoints, exports...) {
+		if strings.HasPrefix(object.Key, storage.NamespaceWorlds+"/") && !strings.Contains(object.Key, "/checkpoints/") {
+			continue
+		}
+		if err := r.scanObject(ctx, backend, object.Key); err != nil && err != storage.ErrNotFound {
+			// What it references is unknown, so nothing may be collected
+			r.Complete = false
+			logging.Warn("asset reference scan failed", map[string]interface{}{
+				"key":   object.Key,
+				"error": err.Error(),
+			})
+		}
+	}
+	return nil
+}
+
+// scanObject scans one stored object in overlapping chunks
+func (r *References) scanObject(ctx context.Context, backend storage.Backend, key string) error {
+	body, _, err := backend.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	reader := bufio.NewReader(body)
+	var content io.Reader = reader
+	if magic, _ := reader.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		unzipped, err := gzip.NewReader(reader)
+		if err != nil {
+			return err
+		}
+		defer unzipped.Close()
+		content = unzipped
+	}
+
+	buffer := make([]byte, scanChunk+refLength)
+	kept := 0
+	for {
+		n, err := io.ReadFull(content, buffer[kept:])
+		r.scanString(string(buffer[:kept+n]))
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		kept = refLength - 1
+		copy(buffer, buffer[len(buffer)-kept:])
+	}
+}
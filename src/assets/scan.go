@@ -0,0 +1,223 @@
+package assets
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+)
+
+// Built-in scanner backends
+const (
+	ScanNone  = "none"
+	ScanClamd = "clamd"
+	ScanHTTP  = "http"
+)
+
+// Scanner checks uploads for malware before they are served
+type Scanner interface {
+	// Scan reads size bytes of content and reports what it found; an
+	// error means the content could not be scanned
+	Scan(ctx context.Context, content io.Reader, size int64) (Verdict, error)
+}
+
+// Verdict is the outcome of a scan, also the reply HTTP scanners give
+type Verdict struct {
+	Infected  bool   `json:"infected"`
+	Signature string `json:"signature,omitempty"` // What was found, as the scanner names it
+}
+
+// ScannerFactory builds a scanner for the configured address
+type ScannerFactory func(address string) (Scanner, error)
+
+var (
+	scannerFactories = map[string]ScannerFactory{
+		ScanClamd: newClamdScanner,
+		ScanHTTP:  newHTTPScanner,
+	}
+	activeScanner Scanner
+	scannerMutex  sync.RWMutex
+)
+
+// RegisterScanner adds a scanner backend, selected by its name in
+// HD1_ASSETS_SCAN_BACKEND. Duplicate names panic, as they are programming
+// errors.
+func RegisterScanner(name string, factory ScannerFactory) {
+	scannerMutex.Lock()
+	defer scannerMutex.Unlock()
+	if _, exists := scannerFactories[name]; exists || name == ScanNone {
+		panic("assets: scanner registered twice: " + name)
+	}
+	scannerFactories[name] = factory
+}
+
+// StartScanner builds the configured scanner; uploads are stored unscanned
+// when the backend is none
+func StartScanner() error {
+	backend := config.GetAssetsScanBackend()
+	if backend == ScanNone {
+		return nil
+	}
+
+	scannerMutex.Lock()
+	defer scannerMutex.Unlock()
+	factory, ok := scannerFactories[backend]
+	if !ok {
+		names := []string{ScanNone}
+		for name := range scannerFactories {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown scan backend %q, expected one of %s", backend, strings.Join(names, ", "))
+	}
+	scanner, err := factory(config.GetAssetsScanAddress())
+	if err != nil {
+		return err
+	}
+	activeScanner = scanner
+
+	logging.Info("asset scanning started", map[string]interface{}{
+		"backend": backend,
+		"address": config.GetAssetsScanAddress(),
+	})
+	return nil
+}
+
+func currentScanner() Scanner {
+	scannerMutex.RLock()
+	defer scannerMutex.RUnlock()
+	return activeScanner
+}
+
+// scan runs the configured scanner over content, bounded by the scan timeout
+func scan(ctx context.Context, content io.Reader, size int64) (Verdict, bool, error) {
+	scanner := currentScanner()
+	if scanner == nil {
+		return Verdict{}, false, nil
+	}
+	scanCtx, cancel := context.WithTimeout(ctx, config.GetAssetsScanTimeout())
+	defer cancel()
+	verdict, err := scanner.Scan(scanCtx, content, size)
+	return verdict, true, err
+}
+
+// clamdScanner streams content to clamd with the INSTREAM command
+type clamdScanner struct {
+	network string
+	address string
+}
+
+// clamdChunkSize bounds each INSTREAM chunk
+const clamdChunkSize = 64 * 1024
+
+// newClamdScanner reads a unix socket path ("/run/clamav/clamd.ctl" or
+// "unix:/run/clamav/clamd.ctl") or a TCP address ("localhost:3310")
+func newClamdScanner(address string) (Scanner, error) {
+	switch {
+	case address == "":
+		return nil, fmt.Errorf("clamd address required")
+	case strings.HasPrefix(address, "unix:"):
+		return &clamdScanner{network: "unix", address: strings.TrimPrefix(address, "unix:")}, nil
+	case strings.HasPrefix(address, "/"):
+		return &clamdScanner{network: "unix", address: address}, nil
+	}
+	return &clamdScanner{network: "tcp", address: strings.TrimPrefix(address, "tcp:")}, nil
+}
+
+func (s *clamdScanner) Scan(ctx context.Context, content io.Reader, size int64) (Verdict, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("clamd: %v", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return Verdict{}, fmt.Errorf("clamd: %v", err)
+	}
+	chunk := make([]byte, 4+clamdChunkSize)
+	for {
+		n, err := content.Read(chunk[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(chunk[:4], uint32(n))
+			if _, err := conn.Write(chunk[:4+n]); err != nil {
+				return Verdict{}, fmt.Errorf("clamd: %v", err)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Verdict{}, err
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return Verdict{}, fmt.Errorf("clamd: %v", err)
+	}
+
+	// Replies are "stream: OK", "stream: <signature> FOUND" or "<reason> ERROR"
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return Verdict{}, fmt.Errorf("clamd: %v", err)
+	}
+	reply = strings.TrimPrefix(strings.TrimRight(reply, "\x00\n"), "stream: ")
+	switch {
+	case reply == "OK":
+		return Verdict{}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return Verdict{Infected: true, Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	}
+	return Verdict{}, fmt.Errorf("clamd: %s", reply)
+}
+
+// httpScanner posts content to an external scanning service, which
+// answers 200 with a Verdict
+type httpScanner struct {
+	url    string
+	client *http.Client
+}
+
+func newHTTPScanner(address string) (Scanner, error) {
+	if !strings.HasPrefix(address, "http://") && !strings.HasPrefix(address, "https://") {
+		return nil, fmt.Errorf("http scanner address must be an http(s) URL: %q", address)
+	}
+	// Scans are bounded by their context rather than a client timeout
+	return &httpScanner{url: address, client: &http.Client{}}, nil
+}
+
+func (s *httpScanner) Scan(ctx context.Context, content io.Reader, size int64) (Verdict, error) {
+	// The transport closes request bodies, the caller owns content
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, io.NopCloser(content))
+	if err != nil {
+		return Verdict{}, err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("scanner: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Verdict{}, fmt.Errorf("scanner returned %s", resp.Status)
+	}
+	var verdict Verdict
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&verdict); err != nil {
+		return Verdict{}, fmt.Errorf("scanner: invalid reply: %v", err)
+	}
+	return verdict, nil
+}
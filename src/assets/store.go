@@ -0,0 +1,188 @@
+// Package assets implements the content-addressable asset store.
+//
+// Uploads are stored once per SHA-256 digest under assets/sha256/<aa>/<digest>
+// in the configured storage backend, so identical uploads share a blob.
+// Entities and worlds reference a blob as "sha256:<digest>" or through its
+// API path /api/assets/<digest>; blobs nothing references are reclaimed by
+// the garbage collector (gc.go).
+package assets
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"holodeck1/storage"
+)
+
+// RefPrefix marks a content-addressed asset reference
+const RefPrefix = "sha256:"
+
+// FormatGLB marks binary glTF blobs, the input of the optimization pipeline
+const FormatGLB = "glb"
+
+// FormatImage marks PNG, JPEG, GIF, WebP and BMP blobs, which organizations
+// may have classified on upload
+const FormatImage = "image"
+
+var digestPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Blob describes one stored asset
+type Blob struct {
+	Digest      string    `json:"digest"`
+	Ref         string    `json:"ref"`
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type,omitempty"`
+	Format      string    `json:"format,omitempty"`
+	StoredAt    time.Time `json:"stored_at"`
+	Quarantined bool      `json:"quarantined,omitempty"` // Flagged by the upload scan, see quarantine.go
+}
+
+// ValidDigest reports whether s is a lowercase hex SHA-256 digest
+func ValidDigest(s string) bool {
+	return digestPattern.MatchString(s)
+}
+
+// BlobKey returns the storage key of a digest
+func BlobKey(digest string) (string, error) {
+	if !ValidDigest(digest) {
+		return "", fmt.Errorf("invalid asset digest: %q", digest)
+	}
+	return storage.Key(storage.NamespaceAssets, "sha256/"+digest[:2]+"/"+digest)
+}
+
+// imageType returns the MIME type of an image blob, or "" for other content
+func imageType(r io.ReaderAt) string {
+	header := make([]byte, 512)
+	n, _ := r.ReadAt(header, 0)
+	switch sniffed := http.DetectContentType(header[:n]); sniffed {
+	case "image/png", "image/jpeg", "image/gif", "image/webp", "image/bmp":
+		return sniffed
+	}
+	return ""
+}
+
+// digestFromKey is the inverse of BlobKey
+func digestFromKey(key string) (string, bool) {
+	digest := key[strings.LastIndex(key, "/")+1:]
+	return digest, strings.HasPrefix(key, storage.NamespaceAssets+"/sha256/") && ValidDigest(digest)
+}
+
+// Put stores body unless a blob with the same digest already exists.
+// The upload is spooled to a temporary file so it is hashed before any
+// bytes reach the backend. deduplicated is true when the blob existed.
+func Put(ctx context.Context, backend storage.Backend, body io.Reader, maxSize int64, contentType string) (*Blob, bool, error) {
+	return put(ctx, backend, body, maxSize, contentType, nil)
+}
+
+// Upload stores a client's upload like Put, passing new blobs through the
+// scanning stage first. Content the server derives from uploads, such as
+// variants and tiles, is stored with Put.
+func Upload(ctx context.Context, backend storage.Backend, body io.Reader, maxSize int64, contentType, uploader, org string) (*Blob, bool, error) {
+	blob, deduplicated, err := put(ctx, backend, body, maxSize, contentType, func(spool *os.File, blob *Blob) error {
+		return inspectUpload(ctx, backend, spool, blob, uploader, org)
+	})
+	if err != nil || !deduplicated {
+		return blob, deduplicated, err
+	}
+	record, err := LoadQuarantine(ctx, backend, blob.Digest)
+	if err != nil {
+		return nil, false, err
+	}
+	blob.Quarantined = record != nil
+	return blob, deduplicated, nil
+}
+
+// put stores body, calling inspect with the spooled content of a new blob
+// before it reaches the backend
+func put(ctx context.Context, backend storage.Backend, body io.Reader, maxSize int64, contentType string, inspect func(*os.File, *Blob) error) (*Blob, bool, error) {
+	spool, err := os.CreateTemp("", "hd1-asset-*")
+	if err != nil {
+		return nil, false, err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(spool, hash), io.LimitReader(body, maxSize+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if size > maxSize {
+		return nil, false, fmt.Errorf("asset exceeds maximum upload size of %d bytes", maxSize)
+	}
+	if size == 0 {
+		return nil, false, fmt.Errorf("asset is empty")
+	}
+
+	digest := hex.EncodeToString(hash.Sum(nil))
+	key, _ := BlobKey(digest)
+	blob := &Blob{
+		Digest:      digest,
+		Ref:         RefPrefix + digest,
+		Key:         key,
+		Size:        size,
+		ContentType: contentType,
+	}
+	if isGLB(spool) {
+		blob.Format = FormatGLB
+	} else if pointCloudFormat(spool) != "" {
+		blob.Format = FormatPointCloud
+	} else if imageType(spool) != "" {
+		blob.Format = FormatImage
+	}
+
+	if existing, err := backend.Stat(ctx, key); err == nil {
+		blob.StoredAt = existing.LastModified
+		return blob, true, nil
+	} else if err != storage.ErrNotFound {
+		return nil, false, err
+	}
+
+	if inspect != nil {
+		if err := inspect(spool, blob); err != nil {
+			return nil, false, err
+		}
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return nil, false, err
+	}
+	if err := backend.Put(ctx, key, spool, size, contentType); err != nil {
+		return nil, false, err
+	}
+	blob.StoredAt = time.Now().UTC()
+	return blob, false, nil
+}
+
+// List returns every stored blob
+func List(ctx context.Context, backend storage.Backend) ([]Blob, error) {
+	objects, err := backend.List(ctx, storage.NamespaceAssets+"/sha256/")
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := make([]Blob, 0, len(objects))
+	for _, object := range objects {
+		digest, ok := digestFromKey(object.Key)
+		if !ok {
+			continue
+		}
+		blobs = append(blobs, Blob{
+			Digest:      digest,
+			Ref:         RefPrefix + digest,
+			Key:         object.Key,
+			Size:        object.Size,
+			ContentType: object.ContentType,
+			StoredAt:    object.LastModified,
+		})
+	}
+	return blobs, nil
+}
@@ -0,0 +1,168 @@
+package assets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"holodeck1/storage"
+)
+
+// Optimization features a variant may require from the client
+const (
+	FeatureDraco   = "draco"
+	FeatureMeshopt = "meshopt"
+	FeatureKTX2    = "ktx2"
+)
+
+// Manifest status values
+const (
+	StatusPending = "pending"
+	StatusReady   = "ready"
+	StatusFailed  = "failed"
+)
+
+// Variant is an optimized copy of a source asset, itself content-addressed
+type Variant struct {
+	Digest         string    `json:"digest"`
+	Features       []string  `json:"features"`
+	Size           int64     `json:"size"`
+	MaxTextureSize int       `json:"max_texture_size,omitempty"` // Set on reduced-resolution variants
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Label names the variant in headers and logs, e.g. "draco+ktx2" or "1024px"
+func (v *Variant) Label() string {
+	parts := append([]string{}, v.Features...)
+	if v.MaxTextureSize > 0 {
+		parts = append(parts, strconv.Itoa(v.MaxTextureSize)+"px")
+	}
+	return strings.Join(parts, "+")
+}
+
+// Manifest records the optimization state and variants of a source asset
+type Manifest struct {
+	Source    string    `json:"source"`
+	Org       string    `json:"org"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Variants  []Variant `json:"variants"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func manifestKey(digest string) (string, error) {
+	return storage.Key(storage.NamespaceAssets, "variants/"+digest+".json")
+}
+
+// LoadManifest returns the variant manifest of digest, or nil if none exists
+func LoadManifest(ctx context.Context, backend storage.Backend, digest string) (*Manifest, error) {
+	if !ValidDigest(digest) {
+		return nil, nil
+	}
+	key, err := manifestKey(digest)
+	if err != nil {
+		return nil, err
+	}
+	body, _, err := backend.Get(ctx, key)
+	if err == storage.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var manifest Manifest
+	if err := json.NewDecoder(body).Decode(&manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// SaveManifest writes the manifest of its source asset
+func SaveManifest(ctx context.Context, backend storage.Backend, manifest *Manifest) error {
+	key, err := manifestKey(manifest.Source)
+	if err != nil {
+		return err
+	}
+	manifest.UpdatedAt = time.Now().UTC()
+	encoded, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	return backend.Put(ctx, key, bytes.NewReader(encoded), int64(len(encoded)), "application/json")
+}
+
+// deleteManifest removes the manifest of a collected source asset
+func deleteManifest(ctx context.Context, backend storage.Backend, digest string) error {
+	key, err := manifestKey(digest)
+	if err != nil {
+		return err
+	}
+	return backend.Delete(ctx, key)
+}
+
+// ParseCapabilities reads a comma-separated client capability list
+func ParseCapabilities(value string) map[string]bool {
+	capabilities := make(map[string]bool)
+	for _, capability := range strings.Split(value, ",") {
+		if capability = strings.ToLower(strings.TrimSpace(capability)); capability != "" {
+			capabilities[capability] = true
+		}
+	}
+	return capabilities
+}
+
+// SelectVariant picks the most optimized variant whose features the client
+// supports, preferring smaller files among equally optimized variants.
+// Reduced-resolution variants are only offered to clients whose
+// maxTextureSize (0 = unknown) cannot use more detail, and win when they
+// apply. nil means the client should receive the source asset.
+func (m *Manifest) SelectVariant(capabilities map[string]bool, maxTextureSize int) *Variant {
+	if m == nil || m.Status != StatusReady {
+		return nil
+	}
+
+	candidates := make([]Variant, 0, len(m.Variants))
+	for _, variant := range m.Variants {
+		if variant.MaxTextureSize > 0 && (maxTextureSize <= 0 || maxTextureSize > variant.MaxTextureSize) {
+			continue
+		}
+		supported := true
+		for _, feature := range variant.Features {
+			if !capabilities[feature] {
+				supported = false
+				break
+			}
+		}
+		if supported {
+			candidates = append(candidates, variant)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if reducedI, reducedJ := candidates[i].MaxTextureSize > 0, candidates[j].MaxTextureSize > 0; reducedI != reducedJ {
+			return reducedI
+		}
+		if len(candidates[i].Features) != len(candidates[j].Features) {
+			return len(candidates[i].Features) > len(candidates[j].Features)
+		}
+		return candidates[i].Size < candidates[j].Size
+	})
+	return &candidates[0]
+}
+
+// isGLB reports whether r starts with the binary glTF magic
+func isGLB(r io.ReaderAt) bool {
+	magic := make([]byte, 4)
+	n, _ := r.ReadAt(magic, 0)
+	return n == 4 && string(magic) == "glTF"
+}
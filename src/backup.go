@@ -0,0 +1,170 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"holodeck1/backup"
+)
+
+// run_backup downloads a backup of the instance: hd1 backup [-o FILE]
+// [--only SECTIONS]. As with world exports, a file is written in place
+// only once the whole archive has arrived.
+func run_backup(args []string) int {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	output := flags.String("o", "", "Write the archive to this file instead of stdout")
+	only := flags.String("only", "", "Comma-separated sections: world, assets, recordings, records (default: all)")
+	quiet := flags.Bool("quiet", false, "No progress bar")
+	address := flags.String("address", "", "Server address (default: the first listener)")
+	profile := flags.String("profile", "", "Server profile (see hd1 login)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: hd1 backup [-o backup.tar.gz] [--only world,assets,recordings,records] [--quiet] [--address host:port|unix:///path | --profile NAME]")
+	}
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		return exitUsage
+	}
+	if _, err := backup.ParseSections(*only); err != nil {
+		fmt.Fprintf(os.Stderr, "backup: %v\n", err)
+		return exitUsage
+	}
+	if *output == "" {
+		if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			fmt.Fprintln(os.Stderr, "backup: refusing to write an archive to a terminal, use -o FILE")
+			return exitUsage
+		}
+	}
+	target, ok := transfer_target("backup", *address, *profile)
+	if !ok {
+		return exitUsage
+	}
+
+	response, err := target.client.Get(target.base + "/api/system/backup?sections=" + url.QueryEscape(*only))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "backup: %v\n", err)
+		return exitFailed
+	}
+	if response.StatusCode != http.StatusOK {
+		_, err := read_transfer_response(response, http.StatusOK)
+		fmt.Fprintf(os.Stderr, "backup: %v\n", err)
+		return exitFailed
+	}
+	defer response.Body.Close()
+
+	out, partial := os.Stdout, ""
+	if *output != "" {
+		partial = *output + ".partial"
+		file, err := os.OpenFile(partial, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "backup: %v\n", err)
+			return exitFailed
+		}
+		defer os.Remove(partial) // Gone once renamed
+		defer file.Close()
+		out = file
+	}
+
+	progress := new_progress("backup", response.ContentLength, !*quiet)
+	_, err = io.Copy(out, progress.reader(response.Body))
+	progress.finish()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "backup: %v\n", err)
+		return exitFailed
+	}
+	if partial != "" {
+		if err := out.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "backup: %v\n", err)
+			return exitFailed
+		}
+		if err := os.Rename(partial, *output); err != nil {
+			fmt.Fprintf(os.Stderr, "backup: %v\n", err)
+			return exitFailed
+		}
+	}
+	return exitOK
+}
+
+// run_restore uploads a backup to restore: hd1 restore FILE [--only
+// SECTIONS] [--skip-existing] [--dry-run]. The archive is verified locally
+// before it is uploaded; one that does not match its manifest exits with
+// status 2.
+func run_restore(args []string) int {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	only := flags.String("only", "", "Comma-separated sections to restore (default: all the archive holds)")
+	skipExisting := flags.Bool("skip-existing", false, "Leave objects that exist alone")
+	dryRun := flags.Bool("dry-run", false, "Verify and report what would be restored, write nothing")
+	quiet := flags.Bool("quiet", false, "No progress bar")
+	address := flags.String("address", "", "Server address (default: the first listener)")
+	profile := flags.String("profile", "", "Server profile (see hd1 login)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: hd1 restore [--only SECTIONS] [--skip-existing] [--dry-run] [--quiet] [--address host:port|unix:///path | --profile NAME] backup.tar.gz")
+	}
+	path, args := leading_argument(args)
+	if err := flags.Parse(args); err != nil || flags.NArg() > 1 || (path != "" && flags.NArg() != 0) {
+		flags.Usage()
+		return exitUsage
+	}
+	if flags.NArg() == 1 {
+		path = flags.Arg(0)
+	}
+	if path == "" {
+		flags.Usage()
+		return exitUsage
+	}
+	if _, err := backup.ParseSections(*only); err != nil {
+		fmt.Fprintf(os.Stderr, "restore: %v\n", err)
+		return exitUsage
+	}
+
+	// Refuse an archive the server would, before uploading it
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "restore: %v\n", err)
+		return exitUsage
+	}
+	defer file.Close()
+	archive, err := backup.Open(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "restore: %s: %v\n", path, err)
+		return exitUsage
+	}
+	archive.Close()
+	info, err := file.Stat()
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "restore: %v\n", err)
+		return exitUsage
+	}
+	target, ok := transfer_target("restore", *address, *profile)
+	if !ok {
+		return exitUsage
+	}
+
+	query := url.Values{}
+	if *only != "" {
+		query.Set("sections", *only)
+	}
+	query.Set("skip_existing", strconv.FormatBool(*skipExisting))
+	query.Set("dry_run", strconv.FormatBool(*dryRun))
+	progress := new_progress("restore "+filepath.Base(path), info.Size(), !*quiet)
+	response, err := target.client.Post(target.base+"/api/system/restore?"+query.Encode(), "application/gzip", progress.reader(file))
+	progress.finish()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "restore: %v\n", err)
+		return exitFailed
+	}
+	restored, err := read_transfer_response(response, http.StatusOK)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "restore: %v\n", err)
+		return exitFailed
+	}
+	os.Stdout.Write(restored)
+	return exitOK
+}
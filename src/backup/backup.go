@@ -0,0 +1,294 @@
+// Package backup bundles an instance's state into one archive and restores
+// it.
+//
+// An archive is a gzipped tar of sections: the live world as a world
+// export, the asset and recording objects of the storage backend, and its
+// records - checkpoints, anchors, consent, legal holds, organization
+// settings and world exports - which HD1 keeps as storage objects rather
+// than in a database. manifest.json comes last, listing every file with
+// its size and SHA-256, the server's version, the specification hash and a
+// fingerprint of its configuration. An archive is verified against its
+// manifest in full before anything is restored.
+//
+// Objects are read and written through the backend, so encrypted storage
+// is backed up decrypted: keep archives as safe as the keys.
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"holodeck1/buildinfo"
+	"holodeck1/config"
+	"holodeck1/storage"
+	"holodeck1/units"
+	"holodeck1/worlds"
+)
+
+// Format identifies backup archives
+const Format = "hd1-backup/1"
+
+// Sections of an archive
+const (
+	SectionWorld      = "world"      // The live world
+	SectionAssets     = "assets"     // Uploaded assets
+	SectionRecordings = "recordings" // Session recordings
+	SectionRecords    = "records"    // Checkpoints, anchors, consent, holds, organizations, exports
+)
+
+// Sections are every section, in the order they are archived
+var Sections = []string{SectionWorld, SectionAssets, SectionRecordings, SectionRecords}
+
+// manifestName is the manifest's path in the archive
+const manifestName = "manifest.json"
+
+// namespaces are the storage namespaces of each object section
+var namespaces = map[string][]string{
+	SectionAssets:     {storage.NamespaceAssets},
+	SectionRecordings: {storage.NamespaceRecordings},
+	SectionRecords: {
+		storage.NamespaceWorlds,
+		storage.NamespaceConsent,
+		storage.NamespaceCompliance,
+		storage.NamespaceOrganizations,
+		storage.NamespaceExports,
+	},
+}
+
+// ErrInvalidArchive is returned for archives that are not backups, or do
+// not match their manifest
+var ErrInvalidArchive = errors.New("invalid backup archive")
+
+// Entry is a file of an archive
+type Entry struct {
+	Path        string `json:"path"`
+	Section     string `json:"section"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	ContentType string `json:"content_type,omitempty"` // Of storage objects
+}
+
+// Manifest describes an archive and lists its files
+type Manifest struct {
+	Format            string    `json:"format"`
+	CreatedAt         time.Time `json:"created_at"`
+	ServerVersion     string    `json:"server_version"`
+	SpecHash          string    `json:"spec_hash"`
+	ConfigFingerprint string    `json:"config_fingerprint"`
+	World             string    `json:"world,omitempty"`   // With the world section
+	SeqNum            uint64    `json:"seq_num,omitempty"` // Last operation the world reflects
+	Sections          []string  `json:"sections"`
+	Entries           []Entry   `json:"entries"`
+}
+
+// Has reports whether the archive holds a section
+func (m *Manifest) Has(section string) bool {
+	return contains(m.Sections, section)
+}
+
+// ParseSections reads a comma-separated list of sections; an empty list is
+// every section
+func ParseSections(list string) ([]string, error) {
+	if strings.TrimSpace(list) == "" {
+		return append([]string{}, Sections...), nil
+	}
+	selected := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if !contains(Sections, name) {
+			return nil, fmt.Errorf("unknown section %q, expected %s", name, strings.Join(Sections, ", "))
+		}
+		selected[name] = true
+	}
+	sections := []string{}
+	for _, name := range Sections {
+		if selected[name] {
+			sections = append(sections, name)
+		}
+	}
+	return sections, nil
+}
+
+// ConfigFingerprint hashes the server's effective configuration, so a
+// restore can tell whether the archive came from a server configured alike
+func ConfigFingerprint() string {
+	encoded, _ := json.Marshal(config.Config)
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:16])
+}
+
+// Write archives the sections to w; state is the live world, required
+// with the world section
+func Write(ctx context.Context, w io.Writer, world string, state *worlds.State, sections []string) (*Manifest, error) {
+	backend := storage.Default()
+	if backend == nil && (len(sections) > 1 || !contains(sections, SectionWorld)) {
+		return nil, fmt.Errorf("storage backend unavailable")
+	}
+
+	compressed := gzip.NewWriter(w)
+	archive := tar.NewWriter(compressed)
+	manifest := &Manifest{
+		Format:            Format,
+		CreatedAt:         time.Now().UTC(),
+		ServerVersion:     config.GetVersion(),
+		SpecHash:          buildinfo.SpecHash,
+		ConfigFingerprint: ConfigFingerprint(),
+		Sections:          sections,
+		Entries:           []Entry{},
+	}
+
+	for _, section := range sections {
+		if section == SectionWorld {
+			encoded, err := json.MarshalIndent(worlds.NewExport(world, state, units.FromScene(state.Scene)), "", "  ")
+			if err != nil {
+				return nil, err
+			}
+			manifest.World, manifest.SeqNum = world, state.SeqNum
+			entry, err := writeFile(archive, "world/"+world+".json", section, bytes.NewReader(encoded), manifest.CreatedAt)
+			if err != nil {
+				return nil, err
+			}
+			manifest.Entries = append(manifest.Entries, entry)
+			continue
+		}
+		for _, namespace := range namespaces[section] {
+			objects, err := backend.List(ctx, namespace+"/")
+			if err != nil {
+				return nil, fmt.Errorf("list %s: %v", namespace, err)
+			}
+			sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+			for _, object := range objects {
+				entry, err := writeObject(ctx, archive, backend, object, section)
+				if err != nil {
+					return nil, err
+				}
+				manifest.Entries = append(manifest.Entries, entry)
+			}
+		}
+	}
+
+	encoded, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeHeader(archive, manifestName, int64(len(encoded)), manifest.CreatedAt); err != nil {
+		return nil, err
+	}
+	if _, err := archive.Write(encoded); err != nil {
+		return nil, err
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	if err := compressed.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// writeObject copies one storage object into the archive. It is spooled to
+// a temporary file first: the tar header needs its size, which encrypted
+// backends do not list.
+func writeObject(ctx context.Context, archive *tar.Writer, backend storage.Backend, object storage.ObjectInfo, section string) (Entry, error) {
+	body, info, err := backend.Get(ctx, object.Key)
+	if err != nil {
+		return Entry{}, fmt.Errorf("read %s: %v", object.Key, err)
+	}
+	defer body.Close()
+
+	spool, err := os.CreateTemp("", "hd1-backup-")
+	if err != nil {
+		return Entry{}, err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+	if _, err := io.Copy(spool, body); err != nil {
+		return Entry{}, fmt.Errorf("read %s: %v", object.Key, err)
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return Entry{}, err
+	}
+
+	modified := object.LastModified
+	if info != nil && !info.LastModified.IsZero() {
+		modified = info.LastModified
+	}
+	entry, err := writeFile(archive, "storage/"+object.Key, section, spool, modified)
+	entry.ContentType = object.ContentType
+	if info != nil && info.ContentType != "" {
+		entry.ContentType = info.ContentType
+	}
+	return entry, err
+}
+
+// writeFile adds a file to the archive and returns its manifest entry
+func writeFile(archive *tar.Writer, name, section string, body io.ReadSeeker, modified time.Time) (Entry, error) {
+	size, err := body.Seek(0, io.SeekEnd)
+	if err != nil {
+		return Entry{}, err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return Entry{}, err
+	}
+	if err := writeHeader(archive, name, size, modified); err != nil {
+		return Entry{}, err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(archive, hash), body); err != nil {
+		return Entry{}, err
+	}
+	return Entry{Path: name, Section: section, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+func writeHeader(archive *tar.Writer, name string, size int64, modified time.Time) error {
+	return archive.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    size,
+		ModTime: modified,
+		Format:  tar.FormatPAX,
+	})
+}
+
+// storageKey returns the storage key of an object file, and whether the
+// path is one
+func storageKey(name string) (string, bool) {
+	key, found := strings.CutPrefix(name, "storage/")
+	if !found || key == "" || path.Clean(key) != key || strings.Contains(key, "..") {
+		return "", false
+	}
+	return key, true
+}
+
+// inSection reports whether a storage key lies in a namespace of an object
+// section
+func inSection(key, section string) bool {
+	for _, namespace := range namespaces[section] {
+		if strings.HasPrefix(key, namespace+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
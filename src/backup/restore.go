@@ -0,0 +1,244 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+
+	"holodeck1/storage"
+	"holodeck1/worlds"
+)
+
+// Archive is a backup archive verified against its manifest
+type Archive struct {
+	Manifest *Manifest
+	file     *os.File
+}
+
+// Options select what a restore writes
+type Options struct {
+	Sections     []string // Sections to restore, of those archived
+	SkipExisting bool     // Leave objects that exist alone instead of replacing them
+	DryRun       bool     // Verify and report, write nothing
+}
+
+// Result reports a restore
+type Result struct {
+	Manifest        *Manifest      `json:"manifest"`
+	ConfigMatches   bool           `json:"config_matches"` // Archived from a server configured alike
+	Sections        []string       `json:"sections"`
+	Restored        map[string]int `json:"restored"` // Files written, by section
+	Skipped         int            `json:"skipped"`  // Objects left alone as they existed
+	WorldOperations int            `json:"world_operations"`
+	DryRun          bool           `json:"dry_run"`
+	RestartRequired bool           `json:"restart_required"` // Records are loaded at startup
+}
+
+// WorldFunc applies an archived world state to the live world and returns
+// how many operations it took
+type WorldFunc func(state *worlds.State) (int, error)
+
+// Open reads an archive from r into a temporary file and verifies every
+// file against the manifest. Close the archive when done.
+func Open(r io.Reader) (*Archive, error) {
+	file, err := os.CreateTemp("", "hd1-restore-")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(file.Name()) // Gone once closed
+	archive := &Archive{file: file}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := archive.verify(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return archive, nil
+}
+
+// Close releases the archive's temporary file
+func (a *Archive) Close() error {
+	return a.file.Close()
+}
+
+// each calls fn with every file of the archive, in order
+func (a *Archive) each(fn func(header *tar.Header, body io.Reader) error) error {
+	if _, err := a.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	compressed, err := gzip.NewReader(a.file)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer compressed.Close()
+	reader := tar.NewReader(compressed)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			return fmt.Errorf("%w: %s is not a regular file", ErrInvalidArchive, header.Name)
+		}
+		if err := fn(header, reader); err != nil {
+			return err
+		}
+	}
+}
+
+// verify hashes every file and checks the manifest lists exactly them, each
+// object under a namespace of its section, so restoring one section cannot
+// write another's objects
+func (a *Archive) verify() error {
+	hashes := map[string]string{}
+	sizes := map[string]int64{}
+	err := a.each(func(header *tar.Header, body io.Reader) error {
+		if header.Name == manifestName {
+			var manifest Manifest
+			if err := json.NewDecoder(body).Decode(&manifest); err != nil {
+				return fmt.Errorf("%w: manifest: %v", ErrInvalidArchive, err)
+			}
+			a.Manifest = &manifest
+			return nil
+		}
+		if a.Manifest != nil {
+			return fmt.Errorf("%w: %s follows the manifest", ErrInvalidArchive, header.Name)
+		}
+		hash := sha256.New()
+		size, err := io.Copy(hash, body)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		hashes[header.Name] = hex.EncodeToString(hash.Sum(nil))
+		sizes[header.Name] = size
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	manifest := a.Manifest
+	switch {
+	case manifest == nil:
+		return fmt.Errorf("%w: no manifest", ErrInvalidArchive)
+	case manifest.Format != Format:
+		return fmt.Errorf("%w: format %q, expected %s", ErrInvalidArchive, manifest.Format, Format)
+	case len(manifest.Entries) != len(hashes):
+		return fmt.Errorf("%w: %d files, the manifest lists %d", ErrInvalidArchive, len(hashes), len(manifest.Entries))
+	}
+	for _, entry := range manifest.Entries {
+		hash, ok := hashes[entry.Path]
+		switch {
+		case !ok:
+			return fmt.Errorf("%w: %s is missing", ErrInvalidArchive, entry.Path)
+		case hash != entry.SHA256 || sizes[entry.Path] != entry.Size:
+			return fmt.Errorf("%w: %s does not match its checksum", ErrInvalidArchive, entry.Path)
+		case !contains(Sections, entry.Section):
+			return fmt.Errorf("%w: %s is in unknown section %q", ErrInvalidArchive, entry.Path, entry.Section)
+		}
+		if entry.Section == SectionWorld {
+			continue
+		}
+		key, isObject := storageKey(entry.Path)
+		switch {
+		case !isObject:
+			return fmt.Errorf("%w: %s is not a storage object", ErrInvalidArchive, entry.Path)
+		case !inSection(key, entry.Section):
+			return fmt.Errorf("%w: %s is outside the %s section", ErrInvalidArchive, entry.Path, entry.Section)
+		}
+	}
+	return nil
+}
+
+// Restore writes the selected sections of the archive: objects to the
+// storage backend, and the world through applyWorld
+func (a *Archive) Restore(ctx context.Context, options Options, applyWorld WorldFunc) (*Result, error) {
+	selected := map[string]bool{}
+	for _, section := range options.Sections {
+		if !a.Manifest.Has(section) {
+			return nil, fmt.Errorf("section %s is not in the archive", section)
+		}
+		selected[section] = true
+	}
+	entries := map[string]Entry{}
+	for _, entry := range a.Manifest.Entries {
+		entries[entry.Path] = entry
+	}
+
+	result := &Result{
+		Manifest:      a.Manifest,
+		ConfigMatches: a.Manifest.ConfigFingerprint == ConfigFingerprint(),
+		Sections:      options.Sections,
+		Restored:      map[string]int{},
+		DryRun:        options.DryRun,
+	}
+	var backend storage.Backend
+	if len(selected) > 1 || (len(selected) == 1 && !selected[SectionWorld]) {
+		if backend = storage.Default(); backend == nil {
+			return nil, fmt.Errorf("storage backend unavailable")
+		}
+	}
+
+	err := a.each(func(header *tar.Header, body io.Reader) error {
+		entry := entries[header.Name]
+		section := entry.Section
+		if !selected[section] {
+			return nil
+		}
+		if section == SectionWorld {
+			state, err := worlds.ReadExport(body)
+			if err != nil {
+				return fmt.Errorf("%w: %s: %v", ErrInvalidArchive, header.Name, err)
+			}
+			if !options.DryRun {
+				if result.WorldOperations, err = applyWorld(state); err != nil {
+					return err
+				}
+			}
+			result.Restored[section]++
+			return nil
+		}
+
+		key, _ := storageKey(header.Name)
+		if options.SkipExisting {
+			if _, err := backend.Stat(ctx, key); err == nil {
+				result.Skipped++
+				return nil
+			}
+		}
+		if !options.DryRun {
+			contentType := entry.ContentType
+			if contentType == "" {
+				contentType = mime.TypeByExtension(path.Ext(key))
+			}
+			if contentType == "" {
+				contentType = "application/octet-stream"
+			}
+			if err := backend.Put(ctx, key, body, header.Size, contentType); err != nil {
+				return fmt.Errorf("write %s: %v", key, err)
+			}
+		}
+		result.Restored[section]++
+		if section == SectionRecords {
+			result.RestartRequired = !options.DryRun
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
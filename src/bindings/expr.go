@@ -0,0 +1,618 @@
+package bindings
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// kind is the type of an expression's value
+type kind int
+
+const (
+	kindScalar kind = iota
+	kindVector
+	kindEntity
+)
+
+func (k kind) String() string {
+	switch k {
+	case kindScalar:
+		return "number"
+	case kindVector:
+		return "vector"
+	}
+	return "entity"
+}
+
+// value is an evaluated expression: a number, a vector or an entity
+type value struct {
+	scalar float64
+	vector [3]float64
+	entity string
+}
+
+// Env resolves what expressions read: the transforms of other entities,
+// the simulation time and the world's parameters
+type Env interface {
+	Property(entityID, property string) ([3]float64, bool)
+	Time() float64
+	Param(key string) (float64, bool)
+}
+
+// node is a type-checked expression tree
+type node interface {
+	kind() kind
+	eval(env Env) (value, error)
+}
+
+// Expr is a compiled binding expression
+type Expr struct {
+	source string
+	root   node
+	refs   []string // Entity IDs it reads, in order of appearance
+}
+
+// Refs returns the entity IDs an expression reads
+func (e *Expr) Refs() []string {
+	return e.refs
+}
+
+// Vector evaluates an expression of a vector property
+func (e *Expr) Vector(env Env) ([3]float64, error) {
+	v, err := e.root.eval(env)
+	if err != nil {
+		return [3]float64{}, err
+	}
+	for _, component := range v.vector {
+		if math.IsNaN(component) || math.IsInf(component, 0) {
+			return [3]float64{}, fmt.Errorf("result is not finite")
+		}
+	}
+	return v.vector, nil
+}
+
+// Scalar evaluates an expression of a vector component
+func (e *Expr) Scalar(env Env) (float64, error) {
+	v, err := e.root.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(v.scalar) || math.IsInf(v.scalar, 0) {
+		return 0, fmt.Errorf("result is not finite")
+	}
+	return v.scalar, nil
+}
+
+// compile parses an expression and checks it yields want
+func compile(source string, want kind) (*Expr, error) {
+	if len(source) > MaxExpressionLength {
+		return nil, fmt.Errorf("expression longer than %d characters", MaxExpressionLength)
+	}
+	p := &parser{source: source}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	root, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().text != "" {
+		return nil, fmt.Errorf("unexpected %q at %d", p.peek().text, p.peek().pos)
+	}
+	if root.kind() != want {
+		return nil, fmt.Errorf("expression yields a %s, the property needs a %s", root.kind(), want)
+	}
+	return &Expr{source: source, root: root, refs: p.refs}, nil
+}
+
+// Tokens
+
+type tokenType int
+
+const (
+	tokenEnd tokenType = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenPunct
+)
+
+type token struct {
+	typ  tokenType
+	text string
+	pos  int
+}
+
+type parser struct {
+	source string
+	tokens []token
+	next   int
+	nodes  int
+	refs   []string
+}
+
+func (p *parser) tokenize() error {
+	s := p.source
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			start := i
+			for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+				i++
+			}
+			if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+				i++
+				if i < len(s) && (s[i] == '+' || s[i] == '-') {
+					i++
+				}
+				for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+					i++
+				}
+			}
+			p.tokens = append(p.tokens, token{tokenNumber, s[start:i], start})
+		case c == '\'' || c == '"':
+			start := i
+			end := strings.IndexByte(s[i+1:], s[i])
+			if end < 0 {
+				return fmt.Errorf("unterminated string at %d", start)
+			}
+			p.tokens = append(p.tokens, token{tokenString, s[i+1 : i+1+end], start})
+			i += end + 2
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(s) && (s[i] == '_' || unicode.IsLetter(rune(s[i])) || s[i] >= '0' && s[i] <= '9') {
+				i++
+			}
+			p.tokens = append(p.tokens, token{tokenIdent, s[start:i], start})
+		case strings.ContainsRune("+-*/(),.", c):
+			p.tokens = append(p.tokens, token{tokenPunct, string(c), i})
+			i++
+		default:
+			return fmt.Errorf("unexpected %q at %d", c, i)
+		}
+	}
+	p.tokens = append(p.tokens, token{tokenEnd, "", len(s)})
+	return nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) take() token {
+	t := p.tokens[p.next]
+	if t.typ != tokenEnd {
+		p.next++
+	}
+	return t
+}
+
+func (p *parser) accept(punct string) bool {
+	if t := p.peek(); t.typ == tokenPunct && t.text == punct {
+		p.next++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(punct string) error {
+	if !p.accept(punct) {
+		t := p.peek()
+		if t.typ == tokenEnd {
+			return fmt.Errorf("expected %q at end", punct)
+		}
+		return fmt.Errorf("expected %q at %d, got %q", punct, t.pos, t.text)
+	}
+	return nil
+}
+
+// count keeps expressions small enough to evaluate every tick
+func (p *parser) count() error {
+	p.nodes++
+	if p.nodes > maxNodes {
+		return fmt.Errorf("expression has more than %d terms", maxNodes)
+	}
+	return nil
+}
+
+// Grammar, loosest first:
+//
+//	expression = term {("+" | "-") term}
+//	term       = unary {("*" | "/") unary}
+//	unary      = "-" unary | postfix
+//	postfix    = primary {"." name}
+//	primary    = number | name | name "(" [expression {"," expression}] ")" | "(" expression ")"
+
+func (p *parser) expression() (node, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if !p.accept("+") && !p.accept("-") {
+			return left, nil
+		}
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		if left, err = newBinary(op, left, right); err != nil {
+			return nil, err
+		}
+		if err := p.count(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) term() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if !p.accept("*") && !p.accept("/") {
+			return left, nil
+		}
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if left, err = newBinary(op, left, right); err != nil {
+			return nil, err
+		}
+		if err := p.count(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) unary() (node, error) {
+	if op := p.peek(); p.accept("-") {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if operand.kind() == kindEntity {
+			return nil, fmt.Errorf("cannot negate an entity at %d", op.pos)
+		}
+		return &negate{operand}, p.count()
+	}
+	return p.postfix()
+}
+
+func (p *parser) postfix() (node, error) {
+	operand, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(".") {
+		name := p.take()
+		if name.typ != tokenIdent {
+			return nil, fmt.Errorf("expected a property at %d", name.pos)
+		}
+		switch operand.kind() {
+		case kindEntity:
+			if !entityProperties[name.text] {
+				return nil, fmt.Errorf("unknown entity property %q at %d (position, rotation or scale)", name.text, name.pos)
+			}
+			operand = &property{operand.(*entityRef).id, name.text}
+		case kindVector:
+			index := strings.Index("xyz", name.text)
+			if len(name.text) != 1 || index < 0 {
+				return nil, fmt.Errorf("unknown vector component %q at %d (x, y or z)", name.text, name.pos)
+			}
+			operand = &component{operand, index}
+		default:
+			return nil, fmt.Errorf("a number has no property %q at %d", name.text, name.pos)
+		}
+		if err := p.count(); err != nil {
+			return nil, err
+		}
+	}
+	return operand, nil
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.take()
+	if err := p.count(); err != nil {
+		return nil, err
+	}
+	switch {
+	case t.typ == tokenNumber:
+		number, err := strconv.ParseFloat(t.text, 64)
+		if err != nil || math.IsInf(number, 0) {
+			return nil, fmt.Errorf("invalid number %q at %d", t.text, t.pos)
+		}
+		return &constant{number}, nil
+	case t.typ == tokenPunct && t.text == "(":
+		inner, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+	case t.typ == tokenIdent && t.text == "entity":
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		id := p.take()
+		if id.typ != tokenString || id.text == "" {
+			return nil, fmt.Errorf("entity() takes a quoted entity ID at %d", id.pos)
+		}
+		if len(p.refs) >= MaxReferences {
+			return nil, fmt.Errorf("expression reads more than %d entities", MaxReferences)
+		}
+		p.refs = append(p.refs, id.text)
+		return &entityRef{id.text}, p.expect(")")
+	case t.typ == tokenIdent && t.text == "param":
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		key := p.take()
+		if key.typ != tokenString || key.text == "" {
+			return nil, fmt.Errorf("param() takes a quoted parameter key at %d", key.pos)
+		}
+		return &paramRef{key.text}, p.expect(")")
+	case t.typ == tokenIdent && t.text == "time":
+		return &clock{}, nil
+	case t.typ == tokenIdent && p.peek().text == "(":
+		p.take()
+		var args []node
+		if !p.accept(")") {
+			for {
+				arg, err := p.expression()
+				if err != nil {
+					return nil, err
+				}
+				args = append(args, arg)
+				if p.accept(")") {
+					break
+				}
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return newCall(t, args)
+	case t.typ == tokenEnd:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+// Nodes
+
+var entityProperties = map[string]bool{"position": true, "rotation": true, "scale": true}
+
+type constant struct{ number float64 }
+
+func (n *constant) kind() kind              { return kindScalar }
+func (n *constant) eval(Env) (value, error) { return value{scalar: n.number}, nil }
+
+type clock struct{}
+
+func (n *clock) kind() kind { return kindScalar }
+func (n *clock) eval(env Env) (value, error) {
+	return value{scalar: env.Time()}, nil
+}
+
+type paramRef struct{ key string }
+
+func (n *paramRef) kind() kind { return kindScalar }
+func (n *paramRef) eval(env Env) (value, error) {
+	number, ok := env.Param(n.key)
+	if !ok {
+		return value{}, fmt.Errorf("parameter %s not found, secret or not a number", n.key)
+	}
+	return value{scalar: number}, nil
+}
+
+type entityRef struct{ id string }
+
+func (n *entityRef) kind() kind { return kindEntity }
+func (n *entityRef) eval(Env) (value, error) {
+	return value{entity: n.id}, nil
+}
+
+type property struct{ id, name string }
+
+func (n *property) kind() kind { return kindVector }
+func (n *property) eval(env Env) (value, error) {
+	vector, ok := env.Property(n.id, n.name)
+	if !ok {
+		return value{}, fmt.Errorf("entity %s not found", n.id)
+	}
+	return value{vector: vector}, nil
+}
+
+type component struct {
+	vector node
+	index  int
+}
+
+func (n *component) kind() kind { return kindScalar }
+func (n *component) eval(env Env) (value, error) {
+	v, err := n.vector.eval(env)
+	return value{scalar: v.vector[n.index]}, err
+}
+
+type negate struct{ operand node }
+
+func (n *negate) kind() kind { return n.operand.kind() }
+func (n *negate) eval(env Env) (value, error) {
+	v, err := n.operand.eval(env)
+	if err != nil {
+		return v, err
+	}
+	return value{scalar: -v.scalar, vector: [3]float64{-v.vector[0], -v.vector[1], -v.vector[2]}}, nil
+}
+
+type binary struct {
+	op          byte
+	left, right node
+	result      kind
+}
+
+// newBinary type-checks an arithmetic operation: numbers with numbers and
+// vectors with vectors add and subtract; vectors scale by numbers
+func newBinary(op token, left, right node) (node, error) {
+	l, r := left.kind(), right.kind()
+	n := &binary{op: op.text[0], left: left, right: right}
+	switch {
+	case l == kindEntity || r == kindEntity:
+		return nil, fmt.Errorf("entities have no arithmetic at %d; use a property such as .position", op.pos)
+	case l == r && (n.op == '+' || n.op == '-'):
+		n.result = l
+	case l == kindScalar && r == kindScalar:
+		n.result = kindScalar
+	case n.op == '*' && (l == kindVector) != (r == kindVector):
+		n.result = kindVector
+	case n.op == '/' && l == kindVector && r == kindScalar:
+		n.result = kindVector
+	default:
+		return nil, fmt.Errorf("cannot %s a %s and a %s at %d", verbs[n.op], l, r, op.pos)
+	}
+	return n, nil
+}
+
+var verbs = map[byte]string{'+': "add", '-': "subtract", '*': "multiply", '/': "divide"}
+
+func (n *binary) kind() kind { return n.result }
+func (n *binary) eval(env Env) (value, error) {
+	l, err := n.left.eval(env)
+	if err != nil {
+		return l, err
+	}
+	r, err := n.right.eval(env)
+	if err != nil {
+		return r, err
+	}
+	if n.op == '/' && r.scalar == 0 {
+		return value{}, fmt.Errorf("division by zero")
+	}
+
+	switch {
+	case n.left.kind() == kindScalar && n.right.kind() == kindScalar:
+		return value{scalar: arithmetic(n.op, l.scalar, r.scalar)}, nil
+	case n.left.kind() == kindVector && n.right.kind() == kindVector:
+		var v [3]float64
+		for i := range v {
+			v[i] = arithmetic(n.op, l.vector[i], r.vector[i])
+		}
+		return value{vector: v}, nil
+	case n.left.kind() == kindScalar:
+		l, r = r, l // number * vector
+	}
+	var v [3]float64
+	for i := range v {
+		v[i] = arithmetic(n.op, l.vector[i], r.scalar)
+	}
+	return value{vector: v}, nil
+}
+
+func arithmetic(op byte, a, b float64) float64 {
+	switch op {
+	case '+':
+		return a + b
+	case '-':
+		return a - b
+	case '*':
+		return a * b
+	}
+	return a / b
+}
+
+// Functions
+
+type function struct {
+	params []kind
+	result kind
+	apply  func(args []value) (value, error)
+}
+
+func scalarFunction(arity int, apply func(x []float64) float64) function {
+	params := make([]kind, arity)
+	return function{params: params, result: kindScalar, apply: func(args []value) (value, error) {
+		x := make([]float64, len(args))
+		for i, arg := range args {
+			x[i] = arg.scalar
+		}
+		return value{scalar: apply(x)}, nil
+	}}
+}
+
+var functions = map[string]function{
+	"vec": {
+		params: []kind{kindScalar, kindScalar, kindScalar},
+		result: kindVector,
+		apply: func(args []value) (value, error) {
+			return value{vector: [3]float64{args[0].scalar, args[1].scalar, args[2].scalar}}, nil
+		},
+	},
+	"length": {
+		params: []kind{kindVector},
+		result: kindScalar,
+		apply: func(args []value) (value, error) {
+			v := args[0].vector
+			return value{scalar: math.Sqrt(v[0]*v[0] + v[1]*v[1] + v[2]*v[2])}, nil
+		},
+	},
+	"lerp": {
+		params: []kind{kindVector, kindVector, kindScalar},
+		result: kindVector,
+		apply: func(args []value) (value, error) {
+			a, b, t := args[0].vector, args[1].vector, args[2].scalar
+			return value{vector: [3]float64{a[0] + (b[0]-a[0])*t, a[1] + (b[1]-a[1])*t, a[2] + (b[2]-a[2])*t}}, nil
+		},
+	},
+	"abs":   scalarFunction(1, func(x []float64) float64 { return math.Abs(x[0]) }),
+	"sqrt":  scalarFunction(1, func(x []float64) float64 { return math.Sqrt(x[0]) }),
+	"sin":   scalarFunction(1, func(x []float64) float64 { return math.Sin(x[0]) }),
+	"cos":   scalarFunction(1, func(x []float64) float64 { return math.Cos(x[0]) }),
+	"min":   scalarFunction(2, func(x []float64) float64 { return math.Min(x[0], x[1]) }),
+	"max":   scalarFunction(2, func(x []float64) float64 { return math.Max(x[0], x[1]) }),
+	"clamp": scalarFunction(3, func(x []float64) float64 { return math.Max(x[1], math.Min(x[2], x[0])) }),
+}
+
+type call struct {
+	name string
+	fn   function
+	args []node
+}
+
+func newCall(name token, args []node) (node, error) {
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at %d", name.text, name.pos)
+	}
+	if len(args) != len(fn.params) {
+		return nil, fmt.Errorf("%s() takes %d arguments, got %d", name.text, len(fn.params), len(args))
+	}
+	for i, arg := range args {
+		if arg.kind() != fn.params[i] {
+			return nil, fmt.Errorf("argument %d of %s() must be a %s, got a %s", i+1, name.text, fn.params[i], arg.kind())
+		}
+	}
+	return &call{name: name.text, fn: fn, args: args}, nil
+}
+
+func (n *call) kind() kind { return n.fn.result }
+func (n *call) eval(env Env) (value, error) {
+	args := make([]value, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(env)
+		if err != nil {
+			return v, err
+		}
+		args[i] = v
+	}
+	return n.fn.apply(args)
+}
@@ -0,0 +1,329 @@
+package bindings
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+	"holodeck1/numbers"
+	"holodeck1/params"
+	"holodeck1/sync"
+)
+
+// clientID submits the updates of bound properties
+const clientID = "bindings"
+
+// Log is the operation log bindings follow and submit to
+type Log interface {
+	GetCurrentSequence() uint64
+	GetOperationsInRange(from, to uint64) []*sync.Operation
+	SubmitOperation(op *sync.Operation)
+}
+
+// tracked are the entity fields bindings read and set
+var tracked = []string{"position", "rotation", "scale", "bindings"}
+
+// evaluator follows the world through the log and evaluates its bindings
+type evaluator struct {
+	seqNum   uint64                            // Last operation applied
+	entities map[string]map[string]interface{} // Tracked fields of live entities
+	compiled map[string]*Expr                  // By expression and property kind
+	cycles   string                            // Entities last reported in a cycle
+}
+
+// apply follows one operation of the log
+func (e *evaluator) apply(op *sync.Operation) {
+	for _, part := range op.Parts() {
+		id, _ := part.Data["id"].(string)
+		switch part.Type {
+		case sync.OpEntityCreate:
+			e.entities[id] = map[string]interface{}{}
+			e.merge(id, part.Data)
+		case sync.OpEntityUpdate:
+			if _, live := e.entities[id]; live {
+				e.merge(id, part.Data)
+			}
+		case sync.OpEntityDelete:
+			delete(e.entities, id)
+		}
+	}
+}
+
+// merge copies the tracked fields of operation data, decoded through JSON
+// as data holds typed structs in memory
+func (e *evaluator) merge(id string, data map[string]interface{}) {
+	for _, field := range tracked {
+		value, ok := data[field]
+		if !ok {
+			continue
+		}
+		var plain interface{}
+		if encoded, err := json.Marshal(value); err == nil && json.Unmarshal(encoded, &plain) == nil {
+			e.entities[id][field] = plain
+		}
+	}
+}
+
+// Stepper returns the step evaluating the bindings of the served world,
+// submitting bound properties whose value changed, or nil when bindings
+// are disabled. The simulation loop calls it every configured tick.
+func Stepper(log Log) func(now time.Time) {
+	if config.GetBindingsTick() <= 0 {
+		logging.Info("bindings disabled", map[string]interface{}{
+			"reason": "no tick",
+		})
+		return nil
+	}
+
+	e := &evaluator{entities: make(map[string]map[string]interface{}), compiled: make(map[string]*Expr)}
+	return func(now time.Time) {
+		if current := log.GetCurrentSequence(); current > e.seqNum {
+			for _, op := range log.GetOperationsInRange(e.seqNum+1, current) {
+				e.apply(op)
+			}
+			e.seqNum = current
+		}
+		if op := e.evaluate(now); op != nil {
+			log.SubmitOperation(op)
+		}
+	}
+}
+
+// bound is an entity's compiled bindings
+type bound struct {
+	id      string
+	targets []string
+	exprs   map[string]*Expr
+}
+
+// evaluate computes every binding and returns the operation updating the
+// properties that changed, or nil
+func (e *evaluator) evaluate(now time.Time) *sync.Operation {
+	entities := e.bound()
+	if len(entities) == 0 {
+		return nil
+	}
+	order, cyclic := dependencyOrder(entities)
+	e.reportCycles(cyclic)
+
+	env := &tickEnv{entities: e.entities, time: float64(now.UnixNano()) / 1e9, values: map[string]map[string][3]float64{}, world: config.GetWorldsDefaultWorld()}
+	var updates []*sync.Operation
+	for _, entity := range order {
+		data := map[string]interface{}{}
+		for _, target := range entity.targets {
+			property, axis, isComponent := strings.Cut(target, ".")
+			current, _ := env.Property(entity.id, property)
+			next := current
+			var err error
+			if isComponent {
+				var scalar float64
+				scalar, err = entity.exprs[target].Scalar(env)
+				next[strings.Index("xyz", axis)] = scalar
+			} else {
+				next, err = entity.exprs[target].Vector(env)
+			}
+			if err != nil {
+				logging.Debug("binding not evaluated", map[string]interface{}{
+					"entity_id": entity.id,
+					"property":  target,
+					"error":     err.Error(),
+				})
+				continue
+			}
+			next = [3]float64{numbers.Round(next[0], precision), numbers.Round(next[1], precision), numbers.Round(next[2], precision)}
+			env.set(entity.id, property, next)
+			if next != current {
+				data[property] = map[string]interface{}{"x": next[0], "y": next[1], "z": next[2]}
+			}
+		}
+		if len(data) > 0 {
+			data["id"] = entity.id
+			updates = append(updates, &sync.Operation{ClientID: clientID, Type: sync.OpEntityUpdate, Data: data})
+		}
+	}
+
+	switch len(updates) {
+	case 0:
+		return nil
+	case 1:
+		updates[0].Timestamp = now
+		return updates[0]
+	}
+	return sync.NewTransaction(clientID, "bindings-"+time.Now().UTC().Format("20060102T150405.000"), updates)
+}
+
+// bound returns the live entities with bindings, compiling expressions
+// not seen before. Stored bindings were validated when set.
+func (e *evaluator) bound() []*bound {
+	var entities []*bound
+	used := make(map[string]bool)
+	for id, data := range e.entities {
+		component, _ := data["bindings"].(map[string]interface{})
+		if len(component) == 0 {
+			continue
+		}
+		entity := &bound{id: id, exprs: make(map[string]*Expr)}
+		for target, value := range component {
+			source, _ := value.(string)
+			want, ok := targets[target]
+			if !ok {
+				continue
+			}
+			key := want.String() + ":" + source
+			expr, seen := e.compiled[key]
+			if !seen {
+				expr, _ = compile(source, want)
+				e.compiled[key] = expr
+			}
+			used[key] = true
+			if expr != nil {
+				entity.exprs[target] = expr
+				entity.targets = append(entity.targets, target)
+			}
+		}
+		sort.Strings(entity.targets)
+		if len(entity.targets) > 0 {
+			entities = append(entities, entity)
+		}
+	}
+	for key := range e.compiled {
+		if !used[key] {
+			delete(e.compiled, key)
+		}
+	}
+	sort.Slice(entities, func(i, j int) bool { return entities[i].id < entities[j].id })
+	return entities
+}
+
+// dependencyOrder sorts bound entities so each comes after the bound
+// entities it reads. Entities in or behind a cycle are returned apart.
+func dependencyOrder(entities []*bound) (order []*bound, cyclic []string) {
+	byID := make(map[string]*bound, len(entities))
+	for _, entity := range entities {
+		byID[entity.id] = entity
+	}
+	const (
+		visiting = 1
+		done     = 2
+		failed   = 3
+	)
+	state := make(map[string]int, len(entities))
+	var visit func(entity *bound) bool
+	visit = func(entity *bound) bool {
+		switch state[entity.id] {
+		case visiting, failed:
+			state[entity.id] = failed
+			return false
+		case done:
+			return true
+		}
+		state[entity.id] = visiting
+		ok := true
+		for _, target := range entity.targets {
+			for _, ref := range entity.exprs[target].Refs() {
+				// Reading itself sees its properties bound so far this tick
+				if ref == entity.id {
+					continue
+				}
+				if dependency, isBound := byID[ref]; isBound && !visit(dependency) {
+					ok = false
+				}
+			}
+		}
+		if !ok {
+			state[entity.id] = failed
+			cyclic = append(cyclic, entity.id)
+			return false
+		}
+		state[entity.id] = done
+		order = append(order, entity)
+		return true
+	}
+	for _, entity := range entities {
+		visit(entity)
+	}
+	sort.Strings(cyclic)
+	return order, cyclic
+}
+
+// reportCycles logs entities left unevaluated by a cycle once, until the
+// set changes
+func (e *evaluator) reportCycles(cyclic []string) {
+	key := strings.Join(cyclic, ",")
+	if key == e.cycles {
+		return
+	}
+	e.cycles = key
+	if key != "" {
+		logging.Warn("bindings form a cycle, not evaluated", map[string]interface{}{
+			"entities": cyclic,
+		})
+	}
+}
+
+// tickEnv reads transforms as of this tick: values bound earlier in the
+// tick, else the world state
+type tickEnv struct {
+	entities map[string]map[string]interface{}
+	time     float64
+	values   map[string]map[string][3]float64
+	world    string
+}
+
+func (env *tickEnv) Time() float64 {
+	return env.time
+}
+
+// Param reads a number or bool parameter that is not secret, as bound
+// properties are seen by everyone; true reads as 1
+func (env *tickEnv) Param(key string) (float64, bool) {
+	param, err := params.Get(env.world, key)
+	if err != nil || param.Secret {
+		return 0, false
+	}
+	switch value := param.Value.(type) {
+	case float64:
+		return value, true
+	case bool:
+		if value {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func (env *tickEnv) Property(entityID, property string) ([3]float64, bool) {
+	if value, ok := env.values[entityID][property]; ok {
+		return value, true
+	}
+	entity, ok := env.entities[entityID]
+	if !ok {
+		return [3]float64{}, false
+	}
+	vector := [3]float64{}
+	if property == "scale" {
+		vector = [3]float64{1, 1, 1}
+	}
+	stored, _ := entity[property].(map[string]interface{})
+	for i, axis := range []string{"x", "y", "z"} {
+		if component, ok := stored[axis].(float64); ok {
+			vector[i] = component
+		}
+	}
+	return vector, true
+}
+
+func (env *tickEnv) set(entityID, property string, value [3]float64) {
+	if env.values[entityID] == nil {
+		env.values[entityID] = make(map[string][3]float64)
+	}
+	env.values[entityID][property] = value
+}
+
+// precision keeps three decimals, which is all a renderer needs and keeps
+// unchanged values from producing updates
+const precision = 3
@@ -0,0 +1,337 @@
+// Package bookings schedules future sessions in a world, so organizations
+// can plan classes, reviews and events through HD1.
+//
+// A booking has a start, a duration and a time zone, an optional
+// recurrence rule, a capacity bounding its invite list, and reminders sent
+// to a webhook and emailed to invitees ahead of each occurrence. Recurring
+// bookings repeat in their own time zone, so a weekly 10:00 session stays
+// at 10:00 across daylight saving changes. Bookings are written to the
+// storage backend and survive restarts, and export as iCalendar for
+// calendar applications.
+package bookings
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"holodeck1/logging"
+	"holodeck1/storage"
+)
+
+// Recurrence frequencies
+const (
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+)
+
+// Limits of a valid booking
+const (
+	MaxTitleLength       = 200
+	MaxDescriptionLength = 2000
+	MaxDuration          = 7 * 24 * 60 * 60 // Seconds
+	MaxCapacity          = 10000
+	MaxInvitees          = 500
+	MaxReminders         = 5
+	MaxReminderLead      = 7 * 24 * 60 // Minutes
+	MaxInterval          = 99
+	MaxCount             = 1000
+)
+
+// ErrNotFound is returned for unknown bookings
+var ErrNotFound = errors.New("booking not found")
+
+// ErrTooMany is returned when a world holds its maximum of bookings
+var ErrTooMany = errors.New("world holds its maximum of bookings")
+
+var worldPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Recurrence repeats a booking every Interval days, weeks or months, for
+// Count occurrences or until Until; forever when neither is set
+type Recurrence struct {
+	Frequency string     `json:"frequency"`          // daily, weekly or monthly
+	Interval  int        `json:"interval,omitempty"` // 1 when unset
+	Count     int        `json:"count,omitempty"`    // Occurrences, the first included
+	Until     *time.Time `json:"until,omitempty"`    // Last possible start
+}
+
+// Booking is a scheduled session in a world
+type Booking struct {
+	ID          string      `json:"id"`
+	World       string      `json:"world"`
+	Org         string      `json:"org,omitempty"` // Organization emailing invitees
+	Title       string      `json:"title"`
+	Description string      `json:"description,omitempty"`
+	Start       time.Time   `json:"start"`
+	Duration    int64       `json:"duration"`           // Seconds
+	TimeZone    string      `json:"time_zone"`          // IANA name, UTC when unset
+	Capacity    int         `json:"capacity,omitempty"` // Attendees, unlimited when 0
+	Invitees    []string    `json:"invitees"`           // Email addresses
+	Recurrence  *Recurrence `json:"recurrence,omitempty"`
+	Reminders   []int       `json:"reminders"` // Minutes before each occurrence
+	CreatedBy   string      `json:"created_by"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+// NewID generates a booking ID
+func NewID() string {
+	return "booking-" + uuid.New().String()
+}
+
+// Validate checks a booking as submitted, normalizing its text and lists
+func (b *Booking) Validate() error {
+	if !worldPattern.MatchString(b.World) {
+		return fmt.Errorf("world must match %s", worldPattern)
+	}
+	b.Title = strings.TrimSpace(b.Title)
+	if b.Title == "" || len(b.Title) > MaxTitleLength || strings.ContainsAny(b.Title, "\r\n") {
+		return fmt.Errorf("title must be one line of 1-%d characters", MaxTitleLength)
+	}
+	if len(b.Description) > MaxDescriptionLength {
+		return fmt.Errorf("description exceeds %d characters", MaxDescriptionLength)
+	}
+	if b.Start.IsZero() {
+		return errors.New("start is required")
+	}
+	if b.Duration < 60 || b.Duration > MaxDuration {
+		return fmt.Errorf("duration must be 60-%d seconds", MaxDuration)
+	}
+	if b.TimeZone == "" {
+		b.TimeZone = "UTC"
+	}
+	if _, err := time.LoadLocation(b.TimeZone); err != nil {
+		return fmt.Errorf("unknown time zone: %q", b.TimeZone)
+	}
+	if b.Capacity < 0 || b.Capacity > MaxCapacity {
+		return fmt.Errorf("capacity must be 0-%d", MaxCapacity)
+	}
+
+	if len(b.Invitees) > MaxInvitees {
+		return fmt.Errorf("at most %d invitees", MaxInvitees)
+	}
+	if b.Capacity > 0 && len(b.Invitees) > b.Capacity {
+		return fmt.Errorf("%d invitees exceed the capacity of %d", len(b.Invitees), b.Capacity)
+	}
+	seen := make(map[string]bool, len(b.Invitees))
+	invitees := make([]string, 0, len(b.Invitees))
+	for _, invitee := range b.Invitees {
+		address, err := mail.ParseAddress(strings.TrimSpace(invitee))
+		if err != nil || address.Name != "" {
+			return fmt.Errorf("invitees must be email addresses, got %q", invitee)
+		}
+		email := strings.ToLower(address.Address)
+		if !seen[email] {
+			seen[email] = true
+			invitees = append(invitees, email)
+		}
+	}
+	b.Invitees = invitees
+
+	if b.Recurrence != nil {
+		if err := b.Recurrence.validate(b.Start); err != nil {
+			return err
+		}
+	}
+
+	if len(b.Reminders) > MaxReminders {
+		return fmt.Errorf("at most %d reminders", MaxReminders)
+	}
+	for _, lead := range b.Reminders {
+		if lead < 1 || lead > MaxReminderLead {
+			return fmt.Errorf("reminders must be 1-%d minutes ahead", MaxReminderLead)
+		}
+	}
+	if b.Reminders == nil {
+		b.Reminders = []int{}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(b.Reminders)))
+	return nil
+}
+
+func (r *Recurrence) validate(start time.Time) error {
+	switch r.Frequency {
+	case FrequencyDaily, FrequencyWeekly, FrequencyMonthly:
+	default:
+		return fmt.Errorf("unknown frequency: %q (daily, weekly or monthly)", r.Frequency)
+	}
+	if r.Interval == 0 {
+		r.Interval = 1
+	}
+	if r.Interval < 1 || r.Interval > MaxInterval {
+		return fmt.Errorf("interval must be 1-%d", MaxInterval)
+	}
+	if r.Count < 0 || r.Count > MaxCount {
+		return fmt.Errorf("count must be 0-%d", MaxCount)
+	}
+	if r.Count > 0 && r.Until != nil {
+		return errors.New("a recurrence ends by count or until, not both")
+	}
+	if r.Until != nil && r.Until.Before(start) {
+		return errors.New("until must not be before start")
+	}
+	return nil
+}
+
+// End returns when an occurrence starting at start ends
+func (b *Booking) End(start time.Time) time.Time {
+	return start.Add(time.Duration(b.Duration) * time.Second)
+}
+
+var (
+	bookings = make(map[string]*Booking)
+	mutex    sync.RWMutex
+)
+
+func bookingKey(b *Booking) (string, error) {
+	return storage.Key(storage.NamespaceWorlds, b.World+"/bookings/"+b.ID+".json")
+}
+
+// Initialize loads bookings from the storage backend
+func Initialize(ctx context.Context) error {
+	backend := storage.Default()
+	if backend == nil {
+		return fmt.Errorf("storage backend unavailable")
+	}
+	objects, err := backend.List(ctx, storage.NamespaceWorlds+"/")
+	if err != nil {
+		return err
+	}
+
+	loaded := 0
+	for _, object := range objects {
+		if !strings.Contains(object.Key, "/bookings/") || !strings.HasSuffix(object.Key, ".json") {
+			continue
+		}
+		body, _, err := backend.Get(ctx, object.Key)
+		if err != nil {
+			continue
+		}
+		var booking Booking
+		err = json.NewDecoder(body).Decode(&booking)
+		body.Close()
+		if err != nil || booking.Validate() != nil {
+			logging.Warn("skipping unreadable booking", map[string]interface{}{"key": object.Key})
+			continue
+		}
+		mutex.Lock()
+		bookings[booking.ID] = &booking
+		mutex.Unlock()
+		loaded++
+	}
+
+	logging.Info("bookings loaded", map[string]interface{}{
+		"bookings": loaded,
+	})
+	return nil
+}
+
+// Save stores a new or changed booking. A world holds at most max
+// bookings.
+func Save(ctx context.Context, booking *Booking, max int) error {
+	if err := booking.Validate(); err != nil {
+		return err
+	}
+	key, err := bookingKey(booking)
+	if err != nil {
+		return err
+	}
+
+	mutex.RLock()
+	_, exists := bookings[booking.ID]
+	held := 0
+	for _, existing := range bookings {
+		if existing.World == booking.World {
+			held++
+		}
+	}
+	mutex.RUnlock()
+	if !exists && held >= max {
+		return ErrTooMany
+	}
+
+	backend := storage.Default()
+	if backend == nil {
+		return fmt.Errorf("storage backend unavailable")
+	}
+	encoded, err := json.Marshal(booking)
+	if err != nil {
+		return err
+	}
+	if err := backend.Put(ctx, key, bytes.NewReader(encoded), int64(len(encoded)), "application/json"); err != nil {
+		return err
+	}
+	mutex.Lock()
+	bookings[booking.ID] = booking
+	mutex.Unlock()
+	return nil
+}
+
+// Get returns a world's booking
+func Get(world, id string) (*Booking, error) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	booking, ok := bookings[id]
+	if !ok || booking.World != world {
+		return nil, ErrNotFound
+	}
+	return booking, nil
+}
+
+// List returns a world's bookings, earliest start first
+func List(world string) []*Booking {
+	mutex.RLock()
+	result := []*Booking{}
+	for _, booking := range bookings {
+		if booking.World == world {
+			result = append(result, booking)
+		}
+	}
+	mutex.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Start.Before(result[j].Start) })
+	return result
+}
+
+// all returns every world's bookings
+func all() []*Booking {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	result := make([]*Booking, 0, len(bookings))
+	for _, booking := range bookings {
+		result = append(result, booking)
+	}
+	return result
+}
+
+// Cancel deletes a booking and its stored copy
+func Cancel(ctx context.Context, world, id string) (*Booking, error) {
+	mutex.Lock()
+	booking, ok := bookings[id]
+	if ok && booking.World == world {
+		delete(bookings, id)
+	}
+	mutex.Unlock()
+	if !ok || booking.World != world {
+		return nil, ErrNotFound
+	}
+
+	if backend := storage.Default(); backend != nil {
+		if key, err := bookingKey(booking); err == nil {
+			if err := backend.Delete(ctx, key); err != nil && err != storage.ErrNotFound {
+				return booking, err
+			}
+		}
+	}
+	return booking, nil
+}
@@ -0,0 +1,116 @@
+package bookings
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Calendar exports bookings as an iCalendar (RFC 5545) calendar named
+// after their world. Events keep their IANA time zone as TZID, which
+// calendar applications resolve themselves.
+func Calendar(world string, list []*Booking, now time.Time) []byte {
+	var lines []string
+	lines = append(lines,
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//HD1//Bookings//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:"+escapeText("HD1 "+world),
+	)
+	for _, booking := range list {
+		lines = append(lines, booking.event(now)...)
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	var out strings.Builder
+	for _, line := range lines {
+		out.WriteString(fold(line))
+	}
+	return []byte(out.String())
+}
+
+func (b *Booking) event(now time.Time) []string {
+	location, err := time.LoadLocation(b.TimeZone)
+	if err != nil {
+		location = time.UTC
+	}
+	lines := []string{
+		"BEGIN:VEVENT",
+		"UID:" + b.ID + "@hd1",
+		"DTSTAMP:" + utc(now),
+		"CREATED:" + utc(b.CreatedAt),
+		"LAST-MODIFIED:" + utc(b.UpdatedAt),
+		"DTSTART" + local(b.Start, location),
+		"DTEND" + local(b.End(b.Start), location),
+		"SUMMARY:" + escapeText(b.Title),
+		"LOCATION:" + escapeText("HD1 world "+b.World),
+	}
+	if b.Description != "" {
+		lines = append(lines, "DESCRIPTION:"+escapeText(b.Description))
+	}
+	if r := b.Recurrence; r != nil {
+		rule := "RRULE:FREQ=" + strings.ToUpper(r.Frequency)
+		if r.Interval > 1 {
+			rule += fmt.Sprintf(";INTERVAL=%d", r.Interval)
+		}
+		if r.Count > 0 {
+			rule += fmt.Sprintf(";COUNT=%d", r.Count)
+		}
+		if r.Until != nil {
+			rule += ";UNTIL=" + utc(*r.Until)
+		}
+		lines = append(lines, rule)
+	}
+	for _, invitee := range b.Invitees {
+		lines = append(lines, "ATTENDEE;ROLE=REQ-PARTICIPANT;RSVP=TRUE:mailto:"+invitee)
+	}
+	for _, lead := range b.Reminders {
+		lines = append(lines,
+			"BEGIN:VALARM",
+			"ACTION:DISPLAY",
+			"DESCRIPTION:"+escapeText(b.Title),
+			fmt.Sprintf("TRIGGER:-PT%dM", lead),
+			"END:VALARM",
+		)
+	}
+	return append(lines, "END:VEVENT")
+}
+
+func utc(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// local formats a property value with its time zone parameter
+func local(t time.Time, location *time.Location) string {
+	if location == time.UTC {
+		return ":" + utc(t)
+	}
+	return ";TZID=" + location.String() + ":" + t.In(location).Format("20060102T150405")
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+func escapeText(text string) string {
+	return textEscaper.Replace(text)
+}
+
+// fold ends a content line with CRLF, folding it at 75 octets without
+// splitting a UTF-8 sequence
+func fold(line string) string {
+	var out strings.Builder
+	width := 0
+	for _, r := range line {
+		size := utf8.RuneLen(r)
+		if width+size > 75 {
+			out.WriteString("\r\n ")
+			width = 1
+		}
+		out.WriteRune(r)
+		width += size
+	}
+	out.WriteString("\r\n")
+	return out.String()
+}
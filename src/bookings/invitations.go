@@ -0,0 +1,84 @@
+package bookings
+
+import (
+	"fmt"
+	"time"
+
+	"holodeck1/email"
+	"holodeck1/logging"
+)
+
+// Invitees are emailed through the booking's organization: an invitation
+// with the booking's calendar file when it is booked or changed, and a
+// reminder at each of its reminder leads.
+
+// describe summarizes a recurrence for invitations
+func (r *Recurrence) describe() string {
+	unit := map[string]string{FrequencyDaily: "day", FrequencyWeekly: "week", FrequencyMonthly: "month"}[r.Frequency]
+	every := "every " + unit
+	if r.Interval > 1 {
+		every = fmt.Sprintf("every %d %ss", r.Interval, unit)
+	}
+	if r.Count > 0 {
+		return fmt.Sprintf("%s, %d times", every, r.Count)
+	}
+	if r.Until != nil {
+		return every + " until " + r.Until.Format("2 Jan 2006")
+	}
+	return every
+}
+
+// Invite emails a booking's invitees its details and calendar file
+func Invite(b *Booking) {
+	if len(b.Invitees) == 0 || !email.Enabled(b.Org) {
+		return
+	}
+	data := map[string]interface{}{
+		"Title":       b.Title,
+		"Description": b.Description,
+		"World":       b.World,
+		"Start":       b.Start,
+		"End":         b.End(b.Start),
+		"TimeZone":    b.TimeZone,
+	}
+	if b.Recurrence != nil {
+		data["Recurrence"] = b.Recurrence.describe()
+	}
+	message, err := email.Templated(b.Org, email.TemplateInvitation, b.Invitees, data)
+	if err != nil {
+		logging.Error("failed to render booking invitation", map[string]interface{}{
+			"booking_id": b.ID,
+			"error":      err.Error(),
+		})
+		return
+	}
+	message.Attachments = []email.Attachment{{
+		Name:        b.ID + ".ics",
+		ContentType: "text/calendar; charset=utf-8",
+		Data:        Calendar(b.World, []*Booking{b}, time.Now()),
+	}}
+	email.Queue(message)
+}
+
+// emailReminder emails a booking's invitees a reminder
+func emailReminder(reminder *Reminder) {
+	b := reminder.Booking
+	if len(b.Invitees) == 0 || !email.Enabled(b.Org) {
+		return
+	}
+	message, err := email.Templated(b.Org, email.TemplateSessionReminder, b.Invitees, map[string]interface{}{
+		"Title":         b.Title,
+		"World":         b.World,
+		"Start":         reminder.Start,
+		"TimeZone":      b.TimeZone,
+		"MinutesBefore": reminder.MinutesBefore,
+	})
+	if err != nil {
+		logging.Error("failed to render booking reminder", map[string]interface{}{
+			"booking_id": b.ID,
+			"error":      err.Error(),
+		})
+		return
+	}
+	email.Queue(message)
+}
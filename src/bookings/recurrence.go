@@ -0,0 +1,74 @@
+package bookings
+
+import "time"
+
+// maxPeriods bounds how far a recurrence is expanded, about 13 years of
+// daily sessions
+const maxPeriods = 5000
+
+// Occurrences returns the starts of a booking's occurrences within
+// [from, to), at most limit of them. Recurrences step in the booking's time
+// zone, keeping the wall clock time; a monthly booking on a day some months
+// lack skips those months.
+func (b *Booking) Occurrences(from, to time.Time, limit int) []time.Time {
+	location, err := time.LoadLocation(b.TimeZone)
+	if err != nil {
+		location = time.UTC
+	}
+	first := b.Start.In(location)
+	result := []time.Time{}
+
+	if b.Recurrence == nil {
+		if !first.Before(from) && first.Before(to) && limit > 0 {
+			result = append(result, first)
+		}
+		return result
+	}
+
+	recurrence := b.Recurrence
+	interval := recurrence.Interval
+	if interval < 1 {
+		interval = 1
+	}
+	count := 0
+	for n := 0; n < maxPeriods && len(result) < limit; n++ {
+		var start time.Time
+		switch recurrence.Frequency {
+		case FrequencyDaily:
+			start = first.AddDate(0, 0, n*interval)
+		case FrequencyWeekly:
+			start = first.AddDate(0, 0, 7*n*interval)
+		case FrequencyMonthly:
+			start = first.AddDate(0, n*interval, 0)
+			if start.Day() != first.Day() {
+				continue
+			}
+		default:
+			return result
+		}
+
+		count++
+		if recurrence.Count > 0 && count > recurrence.Count {
+			break
+		}
+		if recurrence.Until != nil && start.After(*recurrence.Until) {
+			break
+		}
+		if !start.Before(to) {
+			break
+		}
+		if !start.Before(from) {
+			result = append(result, start)
+		}
+	}
+	return result
+}
+
+// Next returns a booking's first occurrence starting at or after a time
+func (b *Booking) Next(after time.Time) (time.Time, bool) {
+	starts := b.Occurrences(after, after.AddDate(100, 0, 0), 1)
+	if len(starts) == 0 {
+		return time.Time{}, false
+	}
+	return starts[0], true
+}
@@ -0,0 +1,128 @@
+package bookings
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/email"
+	"holodeck1/logging"
+)
+
+// EventReminder is the event of reminder webhook bodies
+const EventReminder = "booking.reminder"
+
+// Reminder is the body POSTed to the bookings webhook
+type Reminder struct {
+	Event         string    `json:"event"`
+	Booking       *Booking  `json:"booking"`
+	Start         time.Time `json:"start"` // The occurrence reminded of
+	End           time.Time `json:"end"`
+	MinutesBefore int       `json:"minutes_before"`
+	SentAt        time.Time `json:"sent_at"`
+}
+
+// Due returns the reminders falling in (after, until]: each booking's
+// occurrences whose start less a reminder's lead is in that window
+func Due(after, until time.Time) []*Reminder {
+	var due []*Reminder
+	for _, booking := range all() {
+		for _, lead := range booking.Reminders {
+			ahead := time.Duration(lead) * time.Minute
+			// Starts in (after+ahead, until+ahead]
+			from, to := after.Add(ahead+time.Nanosecond), until.Add(ahead+time.Nanosecond)
+			for _, start := range booking.Occurrences(from, to, MaxCount) {
+				due = append(due, &Reminder{
+					Event:         EventReminder,
+					Booking:       booking,
+					Start:         start,
+					End:           booking.End(start),
+					MinutesBefore: lead,
+				})
+			}
+		}
+	}
+	return due
+}
+
+// RunReminders sends due reminders to the bookings webhook and emails them
+// to invitees every tick until ctx ends. Reminders that fell due while the
+// server was down are not sent late.
+func RunReminders(ctx context.Context) {
+	url := config.GetBookingsWebhookURL()
+	if url == "" && !email.Configured() {
+		logging.Info("booking reminders disabled", map[string]interface{}{
+			"reason": "no webhook URL or email",
+		})
+		return
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	ticker := time.NewTicker(config.GetBookingsTick())
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, reminder := range Due(last, now) {
+				reminder.SentAt = now.UTC()
+				emailReminder(reminder)
+				if url == "" {
+					continue
+				}
+				if err := send(ctx, client, url, reminder); err != nil {
+					logging.Warn("booking reminder failed", map[string]interface{}{
+						"booking_id": reminder.Booking.ID,
+						"start":      reminder.Start,
+						"error":      err.Error(),
+					})
+					continue
+				}
+				logging.Info("booking reminder sent", map[string]interface{}{
+					"booking_id":     reminder.Booking.ID,
+					"start":          reminder.Start,
+					"minutes_before": reminder.MinutesBefore,
+				})
+			}
+			last = now
+		}
+	}
+}
+
+// send POSTs a reminder, signed with the webhook secret as
+// X-HD1-Signature: sha256=<hex HMAC of the body>
+func send(ctx context.Context, client *http.Client, url string, reminder *Reminder) error {
+	body, err := json.Marshal(reminder)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-HD1-Event", EventReminder)
+	if secret := config.GetBookingsWebhookSecret(); secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set("X-HD1-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
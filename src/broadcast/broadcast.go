@@ -0,0 +1,622 @@
+// Package broadcast streams a camera's view of a world to RTMP and WHIP
+// endpoints, so a session can go out on YouTube or Twitch straight from the
+// server.
+//
+// The server holds no renderer of its own: a render client draws the view.
+// It is a console opened at the broadcast's render URL, as a spectator
+// following the director's shot or standing at a saved view, either
+// launched by the server with the configured render command, such as a
+// headless browser, or opened by an operator. It records its canvas and
+// streams the recording over /ws/broadcast; the server feeds it to one
+// FFmpeg per endpoint, which encodes H.264 with AAC for RTMP or Opus for
+// WHIP and pushes it out. A render client that drops can connect again and
+// the encoders start over. Endpoints are kept in memory only: their URLs
+// hold stream keys, and are reported with the key hidden.
+package broadcast
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"holodeck1/config"
+	"holodeck1/logging"
+)
+
+// Statuses of a broadcast
+const (
+	StatusWaiting = "waiting" // For its render client
+	StatusLive    = "live"
+	StatusEnded   = "ended"
+)
+
+// Statuses of an endpoint
+const (
+	TargetIdle   = "idle"
+	TargetLive   = "live"
+	TargetFailed = "failed"
+)
+
+// Protocols of an endpoint
+const (
+	ProtocolRTMP = "rtmp"
+	ProtocolWHIP = "whip"
+)
+
+// MaxTargets bounds the endpoints of a broadcast
+const MaxTargets = 4
+
+const (
+	maxEnded  = 20   // Ended broadcasts kept for their report
+	maxOutput = 2048 // Bytes of an encoder's or render client's output kept
+)
+
+var (
+	// ErrDisabled is returned when broadcasting is configured off
+	ErrDisabled = errors.New("broadcasting disabled")
+	// ErrTooMany is returned when the configured broadcasts are running
+	ErrTooMany = errors.New("broadcast limit reached")
+	// ErrNotFound is returned for unknown broadcasts
+	ErrNotFound = errors.New("broadcast not found")
+	// ErrEnded is returned for broadcasts already ended
+	ErrEnded = errors.New("broadcast ended")
+	// ErrToken is returned for render clients without the broadcast's token
+	ErrToken = errors.New("broadcast token invalid")
+	// ErrBusy is returned when a broadcast already has a render client
+	ErrBusy = errors.New("broadcast already has a render client")
+	// ErrFailed is returned when no endpoint's encoder is running
+	ErrFailed = errors.New("every broadcast endpoint failed")
+)
+
+// Endpoint is where a broadcast is pushed, as requested
+type Endpoint struct {
+	URL   string `json:"url"`   // rtmp:// or rtmps:// with the stream key, or a WHIP https:// URL
+	Token string `json:"token"` // WHIP bearer token, where the service wants one
+}
+
+// Target is an endpoint as a broadcast reports it
+type Target struct {
+	Protocol string `json:"protocol"` // rtmp or whip
+	Endpoint string `json:"endpoint"` // With its stream key hidden
+	Status   string `json:"status"`   // idle, live or failed
+	Error    string `json:"error,omitempty"`
+	Bytes    int64  `json:"bytes"` // Of recording fed to its encoder
+	url      string
+	token    string
+}
+
+// Broadcast streams one camera's view of a world
+type Broadcast struct {
+	ID        string     `json:"id"`
+	World     string     `json:"world"`
+	View      string     `json:"view,omitempty"` // Saved view rendered; the director's shot when empty
+	Status    string     `json:"status"`
+	Targets   []Target   `json:"targets"`
+	Width     int        `json:"width"`
+	Height    int        `json:"height"`
+	FrameRate int        `json:"frame_rate"`
+	Bitrate   int        `json:"bitrate_kbps"`
+	RenderURL string     `json:"render_url,omitempty"` // Carries the render client's token, so returned once
+	Launched  bool       `json:"launched"`             // The server started a render client
+	Error     string     `json:"error,omitempty"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	LiveAt    *time.Time `json:"live_at,omitempty"` // The render client last started streaming
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	tokenHash string
+	render    *exec.Cmd
+	ingest    *Ingest
+}
+
+// snapshot copies a broadcast for callers; called with mutex held
+func (b *Broadcast) snapshot() *Broadcast {
+	copied := *b
+	copied.Targets = append([]Target(nil), b.Targets...)
+	copied.RenderURL = ""
+	copied.render, copied.ingest = nil, nil
+	return &copied
+}
+
+var (
+	mutex      sync.Mutex
+	broadcasts = make(map[string]*Broadcast)
+)
+
+// ParseEndpoint checks an endpoint and returns its target
+func ParseEndpoint(endpoint Endpoint) (Target, error) {
+	u, err := url.Parse(endpoint.URL)
+	if err != nil || u.Host == "" {
+		return Target{}, fmt.Errorf("endpoint URL invalid: %q", redact(endpoint.URL))
+	}
+	target := Target{Status: TargetIdle, url: endpoint.URL, token: endpoint.Token}
+	switch u.Scheme {
+	case "rtmp", "rtmps":
+		target.Protocol = ProtocolRTMP
+		if endpoint.Token != "" {
+			return Target{}, errors.New("RTMP endpoints carry their stream key in the URL, not a token")
+		}
+	case "http", "https":
+		target.Protocol = ProtocolWHIP
+	default:
+		return Target{}, fmt.Errorf("endpoint scheme must be rtmp, rtmps, http or https: %q", u.Scheme)
+	}
+	target.Endpoint = redact(endpoint.URL)
+	return target, nil
+}
+
+// redact hides what an endpoint URL holds of credentials: its user, query
+// and, for RTMP, the stream key ending its path
+func redact(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "(invalid)"
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	if strings.HasPrefix(u.Scheme, "rtmp") {
+		if i := strings.LastIndex(u.Path, "/"); i >= 0 && i < len(u.Path)-1 {
+			u.Path = u.Path[:i+1] + "****"
+		}
+	}
+	return u.String()
+}
+
+// Start opens a broadcast of a world's saved view, or of the director's
+// shot with view empty, and launches its render client when a render
+// command is configured. The broadcast returned carries its render URL.
+func Start(world, view string, endpoints []Endpoint, createdBy string, now time.Time) (*Broadcast, error) {
+	max := config.GetBroadcastMax()
+	if max <= 0 {
+		return nil, ErrDisabled
+	}
+	if len(endpoints) == 0 || len(endpoints) > MaxTargets {
+		return nil, fmt.Errorf("a broadcast needs between 1 and %d endpoints", MaxTargets)
+	}
+	b := &Broadcast{
+		ID:        "broadcast-" + uuid.New().String(),
+		World:     world,
+		View:      view,
+		Status:    StatusWaiting,
+		Width:     config.GetBroadcastWidth(),
+		Height:    config.GetBroadcastHeight(),
+		FrameRate: config.GetBroadcastFrameRate(),
+		Bitrate:   config.GetBroadcastBitrate(),
+		CreatedBy: createdBy,
+		CreatedAt: now.UTC(),
+	}
+	for _, endpoint := range endpoints {
+		target, err := ParseEndpoint(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		b.Targets = append(b.Targets, target)
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	b.tokenHash = hashToken(token)
+	b.RenderURL = renderPath(b, token)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if active() >= max {
+		return nil, ErrTooMany
+	}
+	prune()
+	broadcasts[b.ID] = b
+	launch(b)
+
+	started := b.snapshot()
+	started.RenderURL = b.RenderURL
+	b.RenderURL = ""
+	return started, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// renderPath is where a broadcast's render client opens the world
+func renderPath(b *Broadcast, token string) string {
+	query := url.Values{}
+	query.Set("spectator", "1")
+	if b.View != "" {
+		query.Set("view", b.View)
+	} else {
+		query.Set("follow", "director")
+	}
+	query.Set("broadcast", b.ID)
+	query.Set("token", token)
+	return "/w/" + url.PathEscape(b.World) + "?" + query.Encode()
+}
+
+// active counts the broadcasts not ended; called with mutex held
+func active() int {
+	count := 0
+	for _, b := range broadcasts {
+		if b.Status != StatusEnded {
+			count++
+		}
+	}
+	return count
+}
+
+// prune forgets the oldest ended broadcasts beyond maxEnded; called with
+// mutex held
+func prune() {
+	var ended []*Broadcast
+	for _, b := range broadcasts {
+		if b.Status == StatusEnded {
+			ended = append(ended, b)
+		}
+	}
+	if len(ended) < maxEnded {
+		return
+	}
+	sort.Slice(ended, func(i, j int) bool { return ended[i].EndedAt.Before(*ended[j].EndedAt) })
+	for _, b := range ended[:len(ended)-maxEnded+1] {
+		delete(broadcasts, b.ID)
+	}
+}
+
+// launch starts the configured render client of a broadcast at its render
+// URL on this server; called with mutex held
+func launch(b *Broadcast) {
+	command := strings.Fields(config.GetBroadcastRenderCommand())
+	if len(command) == 0 {
+		return
+	}
+	base, ok := localBase()
+	if !ok {
+		b.Error = "no TCP listener for the render client to open"
+		return
+	}
+	for i, arg := range command {
+		command[i] = strings.ReplaceAll(arg, "{url}", base+b.RenderURL)
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	output := &limitedBuffer{limit: maxOutput}
+	cmd.Stdout, cmd.Stderr = output, output
+	if err := cmd.Start(); err != nil {
+		b.Error = "render client failed to start: " + err.Error()
+		logging.Error("broadcast render client failed to start", map[string]interface{}{
+			"broadcast": b.ID,
+			"error":     err.Error(),
+		})
+		return
+	}
+	b.render = cmd
+	b.Launched = true
+	go func() {
+		err := cmd.Wait()
+		fields := map[string]interface{}{
+			"broadcast": b.ID,
+			"output":    string(bytes.TrimSpace(output.Bytes())),
+		}
+		if err != nil {
+			fields["error"] = err.Error()
+		}
+		logging.Info("broadcast render client exited", fields)
+	}()
+}
+
+// localBase returns the base URL of the server's first TCP listener, as a
+// render client on this host reaches it
+func localBase() (string, bool) {
+	for _, listen := range config.GetListen() {
+		if strings.HasPrefix(listen, "unix://") {
+			continue
+		}
+		host, port, err := net.SplitHostPort(strings.TrimPrefix(listen, "tcp://"))
+		if err != nil {
+			continue
+		}
+		if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+			host = "127.0.0.1"
+		}
+		scheme := "http"
+		if config.GetTLSCert() != "" {
+			scheme = "https"
+		}
+		return scheme + "://" + net.JoinHostPort(host, port), true
+	}
+	return "", false
+}
+
+// Get returns a world's broadcast
+func Get(world, id string) (*Broadcast, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	b, ok := broadcasts[id]
+	if !ok || b.World != world {
+		return nil, ErrNotFound
+	}
+	return b.snapshot(), nil
+}
+
+// List returns a world's broadcasts, newest first
+func List(world string) []*Broadcast {
+	mutex.Lock()
+	defer mutex.Unlock()
+	list := []*Broadcast{}
+	for _, b := range broadcasts {
+		if b.World == world {
+			list = append(list, b.snapshot())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// Stop ends a world's broadcast: its render client is stopped and its
+// encoders finish what they were sent
+func Stop(world, id string, now time.Time) (*Broadcast, error) {
+	mutex.Lock()
+	b, ok := broadcasts[id]
+	if !ok || b.World != world {
+		mutex.Unlock()
+		return nil, ErrNotFound
+	}
+	if b.Status == StatusEnded {
+		mutex.Unlock()
+		return nil, ErrEnded
+	}
+	ended := now.UTC()
+	b.Status = StatusEnded
+	b.EndedAt = &ended
+	ingest, render := b.ingest, b.render
+	b.render = nil
+	mutex.Unlock()
+
+	if ingest != nil {
+		ingest.Close()
+	}
+	if render != nil && render.Process != nil {
+		render.Process.Kill()
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	return b.snapshot(), nil
+}
+
+// Shutdown ends every broadcast, as the server stops
+func Shutdown() {
+	mutex.Lock()
+	var running []*Broadcast
+	for _, b := range broadcasts {
+		if b.Status != StatusEnded {
+			running = append(running, b)
+		}
+	}
+	mutex.Unlock()
+	for _, b := range running {
+		Stop(b.World, b.ID, time.Now())
+	}
+}
+
+// Ingest feeds a render client's recording to a broadcast's encoders
+type Ingest struct {
+	broadcast *Broadcast
+	encoders  []*encoder
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// encoder is the FFmpeg pushing a broadcast to one endpoint
+type encoder struct {
+	target  int // Index into the broadcast's targets
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	output  *limitedBuffer
+	failed  bool // Guarded by mutex
+	closing bool // Guarded by mutex
+}
+
+// Open starts a render client's stream of a broadcast, given the token of
+// its render URL, with an encoder for each endpoint
+func Open(id, token string, now time.Time) (*Ingest, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	b, ok := broadcasts[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(b.tokenHash)) != 1 {
+		return nil, ErrToken
+	}
+	if b.Status == StatusEnded {
+		return nil, ErrEnded
+	}
+	if b.ingest != nil {
+		return nil, ErrBusy
+	}
+
+	in := &Ingest{broadcast: b, done: make(chan struct{})}
+	for i := range b.Targets {
+		target := &b.Targets[i]
+		e := &encoder{target: i, output: &limitedBuffer{limit: maxOutput}}
+		e.cmd = exec.Command(config.GetBroadcastFFmpeg(), encoderArgs(b, target)...)
+		e.cmd.Stdout, e.cmd.Stderr = e.output, e.output
+		stdin, err := e.cmd.StdinPipe()
+		if err == nil {
+			err = e.cmd.Start()
+		}
+		if err != nil {
+			target.Status, target.Error = TargetFailed, "encoder failed to start: "+err.Error()
+			continue
+		}
+		e.stdin = stdin
+		target.Status, target.Error = TargetLive, ""
+		in.encoders = append(in.encoders, e)
+		go in.wait(e)
+	}
+	if len(in.encoders) == 0 {
+		return nil, ErrFailed
+	}
+	live := now.UTC()
+	b.Status = StatusLive
+	b.LiveAt = &live
+	b.ingest = in
+
+	logging.Info("broadcast live", map[string]interface{}{
+		"broadcast": b.ID,
+		"world":     b.World,
+		"encoders":  len(in.encoders),
+	})
+	return in, nil
+}
+
+// encoderArgs are FFmpeg's arguments for one endpoint: the recording on
+// standard input, scaled and encoded at the broadcast's settings, with a
+// silent audio track, since services expect one
+func encoderArgs(b *Broadcast, target *Target) []string {
+	bitrate := strconv.Itoa(b.Bitrate) + "k"
+	args := []string{
+		"-hide_banner", "-loglevel", "error",
+		"-fflags", "+genpts", "-i", "pipe:0",
+		"-f", "lavfi", "-i", "anullsrc=channel_layout=stereo:sample_rate=48000",
+		"-map", "0:v:0", "-map", "1:a:0", "-shortest",
+		"-vf", fmt.Sprintf("scale=%d:%d", b.Width, b.Height),
+		"-c:v", "libx264", "-preset", "veryfast", "-tune", "zerolatency", "-bf", "0",
+		"-pix_fmt", "yuv420p", "-r", strconv.Itoa(b.FrameRate), "-g", strconv.Itoa(2 * b.FrameRate),
+		"-b:v", bitrate, "-maxrate", bitrate, "-bufsize", strconv.Itoa(2*b.Bitrate) + "k",
+		"-b:a", "128k",
+	}
+	if target.Protocol == ProtocolWHIP {
+		args = append(args, "-c:a", "libopus", "-f", "whip")
+		if target.token != "" {
+			args = append(args, "-authorization", target.token)
+		}
+		return append(args, target.url)
+	}
+	return append(args, "-c:a", "aac", "-f", "flv", target.url)
+}
+
+// wait marks an endpoint failed when its encoder exits before the stream
+// ends
+func (in *Ingest) wait(e *encoder) {
+	err := e.cmd.Wait()
+	mutex.Lock()
+	defer mutex.Unlock()
+	if e.closing {
+		return
+	}
+	e.failed = true
+	target := &in.broadcast.Targets[e.target]
+	target.Status = TargetFailed
+	target.Error = strings.TrimSpace(string(e.output.Bytes()))
+	if target.Error == "" && err != nil {
+		target.Error = err.Error()
+	}
+	logging.Warn("broadcast endpoint failed", map[string]interface{}{
+		"broadcast": in.broadcast.ID,
+		"endpoint":  target.Endpoint,
+		"error":     target.Error,
+	})
+}
+
+// Write feeds a piece of the recording to every running encoder; it fails
+// once none is left
+func (in *Ingest) Write(p []byte) (int, error) {
+	running := 0
+	for _, e := range in.encoders {
+		mutex.Lock()
+		failed := e.failed || e.closing
+		mutex.Unlock()
+		if failed {
+			continue
+		}
+		if _, err := e.stdin.Write(p); err != nil {
+			continue // wait reports why the encoder went away
+		}
+		running++
+		mutex.Lock()
+		in.broadcast.Targets[e.target].Bytes += int64(len(p))
+		mutex.Unlock()
+	}
+	if running == 0 {
+		return 0, ErrFailed
+	}
+	return len(p), nil
+}
+
+// Broadcast returns the broadcast the stream feeds
+func (in *Ingest) Broadcast() *Broadcast {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return in.broadcast.snapshot()
+}
+
+// Done is closed when the stream ends, from either side
+func (in *Ingest) Done() <-chan struct{} {
+	return in.done
+}
+
+// Close ends the render client's stream: encoders finish what they were
+// sent, and the broadcast waits for its render client to connect again
+// unless it ended
+func (in *Ingest) Close() {
+	in.closeOnce.Do(func() {
+		mutex.Lock()
+		b := in.broadcast
+		for _, e := range in.encoders {
+			e.closing = true
+			if target := &b.Targets[e.target]; target.Status == TargetLive {
+				target.Status = TargetIdle
+			}
+		}
+		if b.ingest == in {
+			b.ingest = nil
+		}
+		if b.Status == StatusLive {
+			b.Status = StatusWaiting
+		}
+		status := b.Status
+		mutex.Unlock()
+
+		for _, e := range in.encoders {
+			e.stdin.Close()
+		}
+		close(in.done)
+		logging.Info("broadcast stream closed", map[string]interface{}{
+			"broadcast": b.ID,
+			"status":    status,
+		})
+	})
+}
+
+// limitedBuffer keeps the start of a process's output
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		if len(p) > room {
+			b.Buffer.Write(p[:room])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,78 @@
+// Package buildinfo describes the running build: the commit and date it
+// was built from, and the API specification it was generated from, with
+// the oldest client versions it still serves.
+//
+// Builds set Commit and Date with
+//
+//	-ldflags "-X holodeck1/buildinfo.Commit=$(git rev-parse HEAD) -X holodeck1/buildinfo.Date=$(date -u +%FT%TZ)"
+//
+// as the Makefile and Dockerfile do; without them the version control
+// information the Go toolchain records is used, when there is any.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+var (
+	// Commit is the revision the server was built from
+	Commit string
+	// Date is when the server was built, RFC 3339
+	Date string
+)
+
+// Info is the running build
+type Info struct {
+	Commit      string     `json:"commit"`     // Empty when unknown
+	Modified    bool       `json:"modified"`   // Built with uncommitted changes
+	BuildDate   *time.Time `json:"build_date"` // Nil when unknown
+	GoVersion   string     `json:"go_version"`
+	SpecTitle   string     `json:"spec_title"`
+	SpecVersion string     `json:"spec_version"`
+	SpecHash    string     `json:"spec_hash"`
+}
+
+// Get returns the running build
+func Get() Info {
+	info := Info{
+		Commit:      Commit,
+		GoVersion:   runtime.Version(),
+		SpecTitle:   SpecTitle,
+		SpecVersion: SpecVersion,
+		SpecHash:    SpecHash,
+	}
+	date := Date
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if date == "" {
+					date = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	if built, err := time.Parse(time.RFC3339, date); err == nil {
+		built = built.UTC()
+		info.BuildDate = &built
+	}
+	return info
+}
+
+// MinClientVersions returns the oldest version of each client the server
+// still serves
+func MinClientVersions() map[string]string {
+	result := make(map[string]string, len(minClientVersions))
+	for client, version := range minClientVersions {
+		result[client] = version
+	}
+	return result
+}
@@ -0,0 +1,18 @@
+// Code generated by codegen/generator.go from the API specification. DO NOT
+// EDIT.
+
+package buildinfo
+
+// The API specification the server was generated from
+const (
+	SpecTitle   = "HD1 Unified API"
+	SpecVersion = "0.9.0"
+	SpecHash    = "b5701529262cfb00" // SHA-256 of the unified specification, first 16 hex digits
+	APIVersion  = "v1"
+)
+
+// minClientVersions are the oldest client versions the server still
+// serves (x-min-client-versions), by client
+var minClientVersions = map[string]string{
+	"hd1lib": "0.9.0",
+}
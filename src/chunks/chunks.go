@@ -0,0 +1,128 @@
+// Package chunks streams huge worlds in parts. With a chunk size set, the
+// ground plane is divided into square chunks, and each client is sent only
+// the entities in the chunks around its avatar: a chunk is loaded whole as
+// the avatar comes near and dropped as it moves away, and between the two
+// the client receives only the entity operations of its loaded chunks.
+//
+// An entity belongs to the chunk its position is in; entities without a
+// position are at the origin. Chunks have no height, so a tower stays in
+// one. Avatars, scene settings and every other operation reach all
+// clients, as they do without chunks.
+package chunks
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"holodeck1/config"
+)
+
+// Key names a chunk by its column along x and its row along z, counted in
+// chunk edges from the origin
+type Key struct {
+	X int
+	Z int
+}
+
+// String returns the key as "x,z", the form clients and URLs use
+func (k Key) String() string {
+	return strconv.Itoa(k.X) + "," + strconv.Itoa(k.Z)
+}
+
+// MarshalText lets keys name chunks in JSON
+func (k Key) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// before orders keys by x, then z
+func (k Key) before(other Key) bool {
+	if k.X != other.X {
+		return k.X < other.X
+	}
+	return k.Z < other.Z
+}
+
+// Parse reads a key written as "x,z"
+func Parse(value string) (Key, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 2 {
+		return Key{}, fmt.Errorf("chunk must be written x,z: %q", value)
+	}
+	x, errX := strconv.Atoi(strings.TrimSpace(parts[0]))
+	z, errZ := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if errX != nil || errZ != nil {
+		return Key{}, fmt.Errorf("chunk must be written x,z: %q", value)
+	}
+	return Key{X: x, Z: z}, nil
+}
+
+// Enabled reports whether worlds are streamed in chunks
+func Enabled() bool {
+	return config.GetChunksSize() > 0
+}
+
+// At returns the chunk of a point on the ground plane
+func At(x, z float64) Key {
+	size := config.GetChunksSize()
+	if size <= 0 {
+		return Key{}
+	}
+	return Key{X: cell(x / size), Z: cell(z / size)}
+}
+
+func cell(edges float64) int {
+	// Positions are bounded by validation; the clamp only keeps stray
+	// values from overflowing
+	return int(math.Floor(math.Max(-1e9, math.Min(1e9, edges))))
+}
+
+// Around returns the chunks within radius chunks of a chunk, itself
+// included: a square of 2·radius+1 chunks along each side
+func Around(centre Key, radius int) map[Key]bool {
+	keys := make(map[Key]bool, (2*radius+1)*(2*radius+1))
+	for x := centre.X - radius; x <= centre.X+radius; x++ {
+		for z := centre.Z - radius; z <= centre.Z+radius; z++ {
+			keys[Key{X: x, Z: z}] = true
+		}
+	}
+	return keys
+}
+
+// Of returns the chunk of a position in operation data, and whether the
+// data holds one. Operations kept in memory may hold typed positions, so
+// they are read through JSON.
+func Of(position interface{}) (Key, bool) {
+	if position == nil {
+		return Key{}, false
+	}
+	if fields, ok := position.(map[string]interface{}); ok {
+		x, _ := fields["x"].(float64)
+		z, _ := fields["z"].(float64)
+		return At(x, z), true
+	}
+	var point struct {
+		X *float64 `json:"x"`
+		Z *float64 `json:"z"`
+	}
+	encoded, err := json.Marshal(position)
+	if err != nil || json.Unmarshal(encoded, &point) != nil {
+		return Key{}, false
+	}
+	var x, z float64
+	if point.X != nil {
+		x = *point.X
+	}
+	if point.Z != nil {
+		z = *point.Z
+	}
+	return At(x, z), true
+}
+
+// Entity returns the chunk an entity, as the operation log holds it, is in
+func Entity(entity map[string]interface{}) Key {
+	key, _ := Of(entity["position"])
+	return key
+}
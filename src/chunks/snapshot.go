@@ -0,0 +1,113 @@
+package chunks
+
+import (
+	"errors"
+	"sort"
+	stdSync "sync"
+
+	"holodeck1/config"
+	"holodeck1/sync"
+)
+
+// ErrNoState is returned until SetStateFunc is called
+var ErrNoState = errors.New("world state unavailable")
+
+// StateFunc rebuilds the entities of a world from its operation log,
+// starting at sequence 1; the chunks package cannot rebuild world state
+// itself
+type StateFunc func(operations []*sync.Operation) (map[string]map[string]interface{}, error)
+
+// Snapshot is the world at one sequence number, its entities sorted into
+// chunks. Snapshots are shared between clients and never changed.
+type Snapshot struct {
+	SeqNum   uint64
+	Entities map[string]map[string]interface{}
+	Chunks   map[Key][]string // Entity IDs by chunk
+}
+
+// Info describes one chunk of a manifest
+type Info struct {
+	Chunk    Key `json:"chunk"`
+	Entities int `json:"entities"`
+}
+
+// Manifest lists the chunks a world's entities are in
+type Manifest struct {
+	Size   float64 `json:"size"`    // Metres along each chunk edge
+	Radius int     `json:"radius"`  // Chunks clients load around their avatar
+	SeqNum uint64  `json:"seq_num"` // Last operation the manifest reflects
+	Chunks []Info  `json:"chunks"`  // Chunks holding entities, in x then z order
+}
+
+var snapshots struct {
+	mutex   stdSync.Mutex
+	rebuild StateFunc
+	current *Snapshot
+}
+
+// SetStateFunc enables chunks
+func SetStateFunc(rebuild StateFunc) {
+	snapshots.mutex.Lock()
+	defer snapshots.mutex.Unlock()
+	snapshots.rebuild = rebuild
+	snapshots.current = nil
+}
+
+// Current returns the world at its latest operation. It is rebuilt once per
+// sequence number, however many clients load chunks from it.
+func Current(rs *sync.ReliableSync) (*Snapshot, error) {
+	snapshots.mutex.Lock()
+	defer snapshots.mutex.Unlock()
+	if snapshots.rebuild == nil {
+		return nil, ErrNoState
+	}
+	current := rs.GetCurrentSequence()
+	if snapshots.current != nil && snapshots.current.SeqNum == current {
+		return snapshots.current, nil
+	}
+
+	operations := rs.GetAllOperations()
+	entities, err := snapshots.rebuild(operations)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{Entities: entities, Chunks: make(map[Key][]string)}
+	if len(operations) > 0 {
+		snapshot.SeqNum = operations[len(operations)-1].SeqNum
+	}
+	for id, entity := range entities {
+		key := Entity(entity)
+		snapshot.Chunks[key] = append(snapshot.Chunks[key], id)
+	}
+	for _, ids := range snapshot.Chunks {
+		sort.Strings(ids)
+	}
+	snapshots.current = snapshot
+	return snapshot, nil
+}
+
+// In returns the entities of a chunk, in ID order
+func (s *Snapshot) In(key Key) []map[string]interface{} {
+	entities := make([]map[string]interface{}, 0, len(s.Chunks[key]))
+	for _, id := range s.Chunks[key] {
+		entities = append(entities, s.Entities[id])
+	}
+	return entities
+}
+
+// Manifest lists the snapshot's chunks
+func (s *Snapshot) Manifest() *Manifest {
+	manifest := &Manifest{
+		Size:   config.GetChunksSize(),
+		Radius: config.GetChunksRadius(),
+		SeqNum: s.SeqNum,
+		Chunks: make([]Info, 0, len(s.Chunks)),
+	}
+	for key, ids := range s.Chunks {
+		manifest.Chunks = append(manifest.Chunks, Info{Chunk: key, Entities: len(ids)})
+	}
+	sort.Slice(manifest.Chunks, func(i, j int) bool {
+		return manifest.Chunks[i].Chunk.before(manifest.Chunks[j].Chunk)
+	})
+	return manifest
+}
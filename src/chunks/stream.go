@@ -0,0 +1,246 @@
+package chunks
+
+import (
+	"sort"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+	"holodeck1/sync"
+	"holodeck1/whiteboard"
+)
+
+// Event tells a client to add or drop entities as chunks come and go:
+//
+//	load    a chunk came within reach; its entities are sent whole
+//	unload  a chunk went out of reach; its entities are dropped
+//	enter   an entity moved into a loaded chunk; it is sent whole
+//	leave   an entity moved out of the loaded chunks; it is dropped
+type Event struct {
+	Event    string                   `json:"event"`
+	Chunk    Key                      `json:"chunk"`
+	Entities []map[string]interface{} `json:"entities,omitempty"` // load, enter
+	IDs      []string                 `json:"ids,omitempty"`      // unload, leave
+	SeqNum   uint64                   `json:"seq_num,omitempty"`  // Last operation the entities reflect
+}
+
+// Stream decides what one client is sent. It remembers the chunks the
+// client loaded and the entities it holds, each with the sequence number
+// its state was sent at, so operations already reflected are not sent
+// again. A stream belongs to the goroutine forwarding the client's
+// operations and is not safe for concurrent use.
+type Stream struct {
+	centre *Key
+	loaded map[Key]uint64     // Sequence number each chunk was loaded at
+	known  map[string]tracked // Entities the client holds
+	off    bool               // The world cannot be rebuilt; everything is sent
+}
+
+type tracked struct {
+	chunk  Key
+	seqNum uint64 // Operations up to this one are reflected
+}
+
+// NewStream returns a stream with nothing loaded
+func NewStream() *Stream {
+	return &Stream{loaded: make(map[Key]uint64), known: make(map[string]tracked)}
+}
+
+// Follow loads the chunks around the chunk the client's avatar is in, and
+// unloads those now out of reach
+func (s *Stream) Follow(rs *sync.ReliableSync, centre Key) []Event {
+	if s.off || (s.centre != nil && *s.centre == centre) {
+		return nil
+	}
+	want := Around(centre, config.GetChunksRadius())
+
+	var events []Event
+	dropped := make(map[Key][]string)
+	for key := range s.loaded {
+		if !want[key] {
+			dropped[key] = []string{}
+			delete(s.loaded, key)
+		}
+	}
+	for id, entity := range s.known {
+		if ids, ok := dropped[entity.chunk]; ok {
+			dropped[entity.chunk] = append(ids, id)
+			delete(s.known, id)
+		}
+	}
+	for _, key := range sorted(dropped) {
+		sort.Strings(dropped[key])
+		events = append(events, Event{Event: "unload", Chunk: key, IDs: dropped[key]})
+	}
+
+	added := make(map[Key][]string)
+	for key := range want {
+		if _, ok := s.loaded[key]; !ok {
+			added[key] = nil
+		}
+	}
+	if len(added) > 0 {
+		snapshot, err := Current(rs)
+		if err != nil {
+			s.stop(err)
+			return events
+		}
+		for _, key := range sorted(added) {
+			for _, id := range snapshot.Chunks[key] {
+				s.known[id] = tracked{chunk: key, seqNum: snapshot.SeqNum}
+			}
+			s.loaded[key] = snapshot.SeqNum
+			events = append(events, Event{Event: "load", Chunk: key, Entities: snapshot.In(key), SeqNum: snapshot.SeqNum})
+		}
+	}
+	s.centre = &centre
+	return events
+}
+
+// Reload forgets what the client holds and loads its chunks again, for
+// clients that cleared their scene
+func (s *Stream) Reload(rs *sync.ReliableSync) []Event {
+	centre := Key{}
+	if s.centre != nil {
+		centre = *s.centre
+	}
+	s.centre = nil
+	s.loaded = make(map[Key]uint64)
+	s.known = make(map[string]tracked)
+	return s.Follow(rs, centre)
+}
+
+// Filter reports whether an operation is sent to the client, with any
+// events that stand in for it. Entity operations outside the loaded chunks
+// are held back; entities moving across the edge of the loaded chunks are
+// sent whole or dropped. Transactions are sent whole.
+func (s *Stream) Filter(rs *sync.ReliableSync, operation *sync.Operation) (bool, []Event) {
+	if s.off {
+		return true, nil
+	}
+	if operation.Type == sync.TransactionType {
+		for _, part := range operation.Parts() {
+			s.track(part)
+		}
+		return true, nil
+	}
+	if !Scoped(operation) {
+		return true, nil
+	}
+	id, _ := operation.Data["id"].(string)
+	key, moved := Of(operation.Data["position"])
+
+	if entity, ok := s.known[id]; ok {
+		switch {
+		case operation.SeqNum <= entity.seqNum:
+			return false, nil
+		case operation.Type == sync.OpEntityDelete:
+			delete(s.known, id)
+			return true, nil
+		case !moved || key == entity.chunk:
+			return true, nil
+		}
+		if _, ok := s.loaded[key]; ok {
+			s.known[id] = tracked{chunk: key, seqNum: entity.seqNum}
+			return true, nil
+		}
+		delete(s.known, id)
+		return false, []Event{{Event: "leave", Chunk: entity.chunk, IDs: []string{id}}}
+	}
+
+	// Entities the client does not hold matter once they are in a loaded
+	// chunk, after it was loaded
+	if operation.Type == sync.OpEntityDelete || operation.Type == whiteboard.OperationType {
+		return false, nil
+	}
+	if operation.Type == sync.OpEntityCreate && !moved {
+		key, moved = Key{}, true
+	}
+	loadedAt, ok := s.loaded[key]
+	if !moved || !ok || operation.SeqNum <= loadedAt {
+		return false, nil
+	}
+	if operation.Type == sync.OpEntityCreate {
+		s.known[id] = tracked{chunk: key}
+		return true, nil
+	}
+
+	// An update carries only what changed, so the entity is sent whole as
+	// it is now
+	snapshot, err := Current(rs)
+	if err != nil {
+		s.stop(err)
+		return true, nil
+	}
+	entity, exists := snapshot.Entities[id]
+	if !exists {
+		return false, nil
+	}
+	key = Entity(entity)
+	if _, ok := s.loaded[key]; !ok {
+		return false, nil
+	}
+	s.known[id] = tracked{chunk: key, seqNum: snapshot.SeqNum}
+	return false, []Event{{Event: "enter", Chunk: key, Entities: []map[string]interface{}{entity}, SeqNum: snapshot.SeqNum}}
+}
+
+// track keeps the entities of a transaction's parts, which the client is
+// sent whatever their chunks
+func (s *Stream) track(part *sync.Operation) {
+	id, _ := part.Data["id"].(string)
+	if id == "" {
+		return
+	}
+	key, moved := Of(part.Data["position"])
+	entity, known := s.known[id]
+	switch {
+	case part.Type == sync.OpEntityDelete:
+		delete(s.known, id)
+	case part.Type == sync.OpEntityCreate:
+		s.known[id] = tracked{chunk: key}
+	case part.Type == sync.OpEntityUpdate && known && moved:
+		s.known[id] = tracked{chunk: key, seqNum: entity.seqNum}
+	}
+}
+
+// stop sends the client everything from now on, since chunks cannot be
+// loaded without the world's state
+func (s *Stream) stop(err error) {
+	s.off = true
+	logging.Warn("world streaming stopped for client, world state not rebuilt", map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+// Scoped reports whether an operation concerns one entity, and so reaches
+// only the clients holding its chunk
+func Scoped(operation *sync.Operation) bool {
+	switch operation.Type {
+	case sync.OpEntityCreate, sync.OpEntityUpdate, sync.OpEntityDelete, whiteboard.OperationType:
+		id, _ := operation.Data["id"].(string)
+		return id != ""
+	}
+	return false
+}
+
+// Moved returns the chunk an avatar operation puts an avatar in, if it is
+// one placing that avatar
+func Moved(operation *sync.Operation, avatarID string) (Key, bool) {
+	switch operation.Type {
+	case sync.OpAvatarCreate, sync.OpAvatarMove, sync.OpAvatarUpdate:
+	default:
+		return Key{}, false
+	}
+	if id, _ := operation.Data["hd1_id"].(string); id == "" || id != avatarID {
+		return Key{}, false
+	}
+	return Of(operation.Data["position"])
+}
+
+func sorted(keys map[Key][]string) []Key {
+	ordered := make([]Key, 0, len(keys))
+	for key := range keys {
+		ordered = append(ordered, key)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].before(ordered[j]) })
+	return ordered
+}
@@ -1,16 +1,29 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 	"text/template"
 	
 	"gopkg.in/yaml.v3"
 	"holodeck1/config"
 	"holodeck1/logging"
+	"holodeck1/server"
 )
 
 //go:embed templates/*
@@ -69,6 +82,23 @@ type OpenAPISpec struct {
 	Info    Info                   `yaml:"info"`
 	Paths   map[string]PathItem    `yaml:"paths"`
 	XCodeGeneration CodeGenConfig  `yaml:"x-code-generation"`
+	XAPIVersion     string         `yaml:"x-api-version"`
+	XOperationTypes []OperationTypeSpec `yaml:"x-operation-types"`
+	XMinClientVersions map[string]string `yaml:"x-min-client-versions"`
+	Components      SpecComponents `yaml:"components"`
+}
+
+// SpecComponents are the reusable parts of the specification the generator
+// reads
+type SpecComponents struct {
+	Schemas map[string]Schema `yaml:"schemas"`
+}
+
+// OperationTypeSpec declares an operation type of the sync log
+type OperationTypeSpec struct {
+	Type        string `yaml:"type"`
+	Description string `yaml:"description"`
+	Submit      bool   `yaml:"submit,omitempty"` // Clients may send it to /sync/operations
 }
 
 type Info struct {
@@ -94,6 +124,37 @@ type Operation struct {
 	Responses   map[string]Response `yaml:"responses"`
 	XHandler    string   `yaml:"x-handler"`
 	XFunction   string   `yaml:"x-function"`
+	Deprecated  bool     `yaml:"deprecated,omitempty"`
+	XSunset     string   `yaml:"x-sunset,omitempty"`
+	XSuccessor  string   `yaml:"x-successor,omitempty"`
+	XLegacyPaths []string `yaml:"x-legacy-paths,omitempty"`
+	XMaintenance string   `yaml:"x-maintenance,omitempty"` // "allow" keeps a mutating operation open in maintenance mode
+	XAuth        string   `yaml:"x-auth,omitempty"`        // Who may call: public (default), signed, operator or local
+	XPermissions []string `yaml:"x-permissions,omitempty"` // Permissions the caller needs: view, chat, edit; edit for unmarked mutating operations
+	XSelftest    string   `yaml:"x-selftest,omitempty"`    // "skip" leaves the operation out of hd1 selftest's contract checks
+}
+
+// authLevels are the callers x-auth admits, from anyone to this machine only
+var authLevels = []string{"public", "signed", "operator", "local"}
+
+// templatePackages are the handler packages the router template imports
+// itself
+var templatePackages = []string{"sync", "entities", "avatars", "scene", "system", "materials"}
+
+// permissions are the values x-permissions may list
+var permissions = []string{"view", "chat", "edit"}
+
+// validateAuth checks an operation's x-auth and x-permissions
+func validateAuth(op *Operation) error {
+	if op.XAuth != "" && !contains(authLevels, op.XAuth) {
+		return fmt.Errorf("x-auth must be one of %s, got %q", strings.Join(authLevels, ", "), op.XAuth)
+	}
+	for _, permission := range op.XPermissions {
+		if !contains(permissions, permission) {
+			return fmt.Errorf("x-permissions may list %s, got %q", strings.Join(permissions, ", "), permission)
+		}
+	}
+	return nil
 }
 
 type Parameter struct {
@@ -118,9 +179,11 @@ type Response struct {
 }
 
 type Schema struct {
-	Type    string `yaml:"type"`
-	Pattern string `yaml:"pattern,omitempty"`
-	Ref     string `yaml:"$ref,omitempty"`
+	Type     string   `yaml:"type"`
+	Pattern  string   `yaml:"pattern,omitempty"`
+	Ref      string   `yaml:"$ref,omitempty"`
+	Required []string `yaml:"required,omitempty"`
+	Properties map[string]Schema `yaml:"properties,omitempty"`
 }
 
 type CodeGenConfig struct {
@@ -130,36 +193,88 @@ type CodeGenConfig struct {
 	FailOnMissingHandlers bool `yaml:"fail-on-missing-handlers"`
 }
 
-// loadTemplate loads and caches a template from the embedded filesystem
-func loadTemplate(templatePath string) (*template.Template, error) {
+// loadTemplate loads and caches a template, preferring an operator-supplied
+// override from the configured templates directory over the embedded copy.
+// Overrides are executed against the contract sample before use so that a
+// template referencing fields the generator does not provide fails the build
+// instead of producing a broken router or client.
+func loadTemplate(templatePath string, contract interface{}) (*template.Template, error) {
 	if tmpl, exists := templateCache[templatePath]; exists {
 		return tmpl, nil
 	}
 	
-	content, err := templateFS.ReadFile(templatePath)
+	content, source, err := readTemplateSource(templatePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read template %s: %w", templatePath, err)
+		return nil, err
 	}
 	
 	// Add custom template functions
 	funcMap := template.FuncMap{
 		"hasSuffix": strings.HasSuffix,
+		"goIdent":   goIdentifier,
 	}
 	
 	tmpl, err := template.New(filepath.Base(templatePath)).Funcs(funcMap).Parse(string(content))
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse template %s: %w", templatePath, err)
+		return nil, fmt.Errorf("failed to parse template %s: %w", source, err)
+	}
+	
+	if source != "embedded" {
+		if err := verifyTemplateContract(tmpl, contract); err != nil {
+			return nil, fmt.Errorf("template override %s violates data contract: %w", source, err)
+		}
+		logging.Info("using template override", map[string]interface{}{
+			"template": templatePath,
+			"source":   source,
+		})
 	}
 	
 	templateCache[templatePath] = tmpl
 	return tmpl, nil
 }
 
+// readTemplateSource returns template content from the override directory when
+// a file with the same relative path exists there, otherwise from the embedded
+// filesystem. The second return value names where the content came from.
+func readTemplateSource(templatePath string) ([]byte, string, error) {
+	if overrideDir := config.GetTemplatesDir(); overrideDir != "" {
+		overridePath := filepath.Join(overrideDir, strings.TrimPrefix(templatePath, "templates/"))
+		content, err := os.ReadFile(overridePath)
+		if err == nil {
+			return content, overridePath, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, "", fmt.Errorf("failed to read template override %s: %w", overridePath, err)
+		}
+	}
+	
+	content, err := templateFS.ReadFile(templatePath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read template %s: %w", templatePath, err)
+	}
+	return content, "embedded", nil
+}
+
+// verifyTemplateContract executes a template against representative data with
+// strict missing-key handling. Any reference to a field or method the contract
+// type does not expose surfaces here as an execution error.
+func verifyTemplateContract(tmpl *template.Template, contract interface{}) error {
+	strict, err := tmpl.Clone()
+	if err != nil {
+		return err
+	}
+	return strict.Option("missingkey=error").Execute(io.Discard, contract)
+}
+
 // NOTE: All templates are now externalized to templates/ directory
 // No hardcoded templates in this generator - external templates only
 
 // Handler validation and generation
 func main() {
+	// Generator-specific flags: registered before config.Initialize parses the
+	// shared flag set so they are accepted alongside configuration flags
+	scaffold := flag.Bool("scaffold", false, "Emit compilable handler stubs for endpoints with missing handlers")
+
 	// Initialize configuration system for code generation
 	if err := config.Initialize(); err != nil {
 		// Cannot use structured logging before logging is initialized
@@ -225,7 +340,11 @@ func main() {
 	var routes []RouteInfo
 	var handlerStubs []HandlerStub
 	var missingHandlers []string
+	var missingStubs []HandlerStub
+	var compatRoutes []CompatRoute
+	var invalidAuth []string
 	var imports []string
+	var contractChecks []ContractCheck
 
 	for path, pathItem := range spec.Paths {
 		operations := map[string]*Operation{
@@ -247,11 +366,34 @@ func main() {
 				"operation_id": op.OperationID,
 			})
 
-			// Validate handler file exists
+			// Generate handler stub with package info
+			handlerDir := filepath.Dir(op.XHandler)
+			packageName := strings.Split(handlerDir, "/")[len(strings.Split(handlerDir, "/"))-1]
+			stub := HandlerStub{
+				FuncName:       op.XFunction,
+				Package:        packageName,
+				Comment:        fmt.Sprintf("%s %s - %s", method, path, op.Summary),
+				HandlerFile:    op.XHandler,
+				Method:         method,
+				Path:           path,
+				OperationID:    op.OperationID,
+				Summary:        op.Summary,
+				PathParams:     extractPathParams(path),
+				HasBody:        op.RequestBody != nil,
+				RequiredFields: requiredBodyFields(op),
+				WithHub:        strings.HasPrefix(path, "/system"),
+			}
+			handlerStubs = append(handlerStubs, stub)
+
+			// Validate handler file and function exist
 			if op.XHandler != "" {
 				handlerPath := op.XHandler
 				if !fileExists(handlerPath) {
 					missingHandlers = append(missingHandlers, fmt.Sprintf("%s %s -> %s", method, path, handlerPath))
+					missingStubs = append(missingStubs, stub)
+				} else if op.XFunction != "" && !handlerFunctionExists(handlerDir, op.XFunction) {
+					missingHandlers = append(missingHandlers, fmt.Sprintf("%s %s -> %s:%s", method, path, handlerPath, op.XFunction))
+					missingStubs = append(missingStubs, stub)
 				}
 
 				// Extract package for import
@@ -263,23 +405,72 @@ func main() {
 				}
 			}
 
+			if err := validateAuth(op); err != nil {
+				invalidAuth = append(invalidAuth, fmt.Sprintf("%s %s: %v", method, path, err))
+			}
+
 			// Generate route info
 			routes = append(routes, RouteInfo{
 				Path:        strings.TrimPrefix(path, "/api"),
 				Method:      method,
 				OperationID: op.OperationID,
 				HandlerFunc: op.XFunction,
+				Package:     packageName,
+				Deprecated:  op.Deprecated,
+				Sunset:      op.XSunset,
+				Successor:   op.XSuccessor,
+				MaintenanceAllowed: op.XMaintenance == "allow",
+				Auth:        op.XAuth,
+				Permissions: op.XPermissions,
 			})
 
-			// Generate handler stub with package info
-			handlerDir := filepath.Dir(op.XHandler)
-			packageName := strings.Split(handlerDir, "/")[len(strings.Split(handlerDir, "/"))-1]
-			handlerStubs = append(handlerStubs, HandlerStub{
-				FuncName: op.XFunction,
-				Package:  packageName,
-				Comment:  fmt.Sprintf("%s %s - %s", method, path, op.Summary),
+			if check, ok := contractCheck(spec, method, path, op); ok {
+				contractChecks = append(contractChecks, check)
+			}
+
+			// Legacy paths keep answering through the compatibility router
+			for _, legacyPath := range op.XLegacyPaths {
+				compatRoutes = append(compatRoutes, CompatRoute{
+					LegacyPath:  strings.TrimPrefix(legacyPath, "/api"),
+					Method:      method,
+					OperationID: op.OperationID,
+					Sunset:      op.XSunset,
+				})
+			}
+		}
+	}
+
+	// Stable ordering keeps regenerated router diffs reviewable
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	sort.Slice(compatRoutes, func(i, j int) bool {
+		if compatRoutes[i].LegacyPath != compatRoutes[j].LegacyPath {
+			return compatRoutes[i].LegacyPath < compatRoutes[j].LegacyPath
+		}
+		return compatRoutes[i].Method < compatRoutes[j].Method
+	})
+	sort.Strings(imports)
+
+	// Scaffold mode: emit compilable stubs so new endpoints can be wired quickly
+	if *scaffold && len(missingStubs) > 0 {
+		if err := scaffoldMissingHandlers(missingStubs); err != nil {
+			logging.Fatal("handler scaffolding failed", map[string]interface{}{
+				"error": err.Error(),
 			})
 		}
+		missingHandlers = nil
+	}
+
+	// Security requirements are never guessed: a bad annotation fails the build
+	if len(invalidAuth) > 0 {
+		sort.Strings(invalidAuth)
+		logging.Fatal("build failed - invalid auth annotations", map[string]interface{}{
+			"operations": invalidAuth,
+		})
 	}
 
 	// FAIL BUILD if handlers missing and strict mode enabled
@@ -297,7 +488,7 @@ func main() {
 		"routes_count": len(routes),
 	})
 
-	tmpl, err := loadTemplate("templates/go/router.tmpl")
+	tmpl, err := loadTemplate("templates/go/router.tmpl", sampleRouterTemplateData())
 	if err != nil {
 		logging.Fatal("failed to load router template", map[string]interface{}{
 			"error": err.Error(),
@@ -313,11 +504,13 @@ func main() {
 	defer routerFile.Close()
 
 	// Organize routes by category for Three.js template
-	var syncOps, entityOps, avatarOps, sceneOps, systemOps, materialsOps []RouteInfo
+	var syncOps, entityOps, avatarOps, sceneOps, systemOps, materialsOps, extensionOps []RouteInfo
+	var extensionImports []string
 	for _, route := range routes {
 		if strings.HasPrefix(route.Path, "/sync") {
 			syncOps = append(syncOps, route)
-		} else if strings.HasPrefix(route.Path, "/entities") {
+		} else if strings.HasPrefix(route.Path, "/entities") && route.Package == "entities" {
+			// Entity component handlers elsewhere are routed generically
 			entityOps = append(entityOps, route)
 		} else if strings.HasPrefix(route.Path, "/avatars") {
 			avatarOps = append(avatarOps, route)
@@ -327,32 +520,49 @@ func main() {
 			systemOps = append(systemOps, route)
 		} else if strings.HasPrefix(route.Path, "/materials") {
 			materialsOps = append(materialsOps, route)
+		} else if route.Package != "" && route.HandlerFunc != "" && !unserved(route.Path) {
+			// Any other handler package is routed generically by package name
+			extensionOps = append(extensionOps, route)
+			importPath := "holodeck1/api/" + route.Package
+			if !contains(templatePackages, route.Package) && !contains(extensionImports, importPath) {
+				extensionImports = append(extensionImports, importPath)
+			}
+		}
+	}
+	sort.Strings(extensionImports)
+
+	apiVersion := spec.XAPIVersion
+	if apiVersion == "" {
+		apiVersion = "v1"
+	}
+	var deprecations, maintenanceExempt, authRoutes []RouteInfo
+	for _, route := range routes {
+		if route.Deprecated {
+			deprecations = append(deprecations, route)
+		}
+		if route.MaintenanceAllowed {
+			maintenanceExempt = append(maintenanceExempt, route)
+		}
+		if (route.Auth != "" && route.Auth != "public") || len(route.Permissions) > 0 {
+			authRoutes = append(authRoutes, route)
 		}
 	}
 
-	templateData := struct {
-		SyncOperations []RouteInfo
-		Entities []RouteInfo
-		Avatars []RouteInfo
-		Scene []RouteInfo
-		System []RouteInfo
-		Materials []RouteInfo
-		Imports []string
-		TotalRoutes int
-		SyncOpsCount int
-		EntityOpsCount int
-		AvatarOpsCount int
-		SceneOpsCount int
-		SystemOpsCount int
-		MaterialsOpsCount int
-	}{
+	templateData := RouterTemplateData{
+		APIVersion: apiVersion,
+		Deprecations: deprecations,
+		MaintenanceExempt: maintenanceExempt,
+		AuthRoutes: authRoutes,
+		CompatRoutes: compatRoutes,
 		SyncOperations: syncOps,
 		Entities: entityOps,
 		Avatars: avatarOps,
 		Scene: sceneOps,
 		System: systemOps,
 		Materials: materialsOps,
+		Extensions: extensionOps,
 		Imports: imports,
+		ExtensionImports: extensionImports,
 		TotalRoutes: len(routes),
 		SyncOpsCount: len(syncOps),
 		EntityOpsCount: len(entityOps),
@@ -360,6 +570,7 @@ func main() {
 		SceneOpsCount: len(sceneOps),
 		SystemOpsCount: len(systemOps),
 		MaterialsOpsCount: len(materialsOps),
+		ExtensionOpsCount: len(extensionOps),
 	}
 
 	if err := tmpl.Execute(routerFile, templateData); err != nil {
@@ -381,9 +592,50 @@ func main() {
 		})
 	}
 
+	// Operation types: Go constants the server matches on
+	operationTypes, err := operationTypeInfo(spec.XOperationTypes)
+	if err != nil {
+		logging.Fatal("build failed - invalid operation types", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	if err := generateOperationTypes("sync/operation_types.go", operationTypes); err != nil {
+		logging.Fatal("failed to generate operation types", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	// Build information: which specification the server was generated from
+	if err := generateBuildInfo("buildinfo/spec.go", spec, specData); err != nil {
+		logging.Fatal("failed to generate build information", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	// Contract checks: what hd1 selftest calls and expects
+	if err := generateContract("selftest/contract.go", contractChecks); err != nil {
+		logging.Fatal("failed to generate contract checks", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
 	// Generate minimal Web UI Client
 	logging.Info("generating minimal Web UI client")
-	generateWebUIClient(spec, routes)
+	generateWebUIClient(spec, routes, operationTypes)
+
+	// Fingerprint static assets last, so generated ones hash as written
+	if err := generateAssetManifest("../share/htdocs/static"); err != nil {
+		logging.Error("failed to generate asset manifest", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	// Copy the finished document root where go:embed can reach it
+	if err := embedHtDocs("../share/htdocs", "htdocs/dist"); err != nil {
+		logging.Error("failed to copy console assets for embedding", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
 
 	logging.Info("code generation complete", map[string]interface{}{
 		"features": []string{
@@ -432,12 +684,199 @@ type RouteInfo struct {
 	Method      string
 	OperationID string
 	HandlerFunc string
+	Package     string
+	Deprecated  bool
+	Sunset      string
+	Successor   string
+	MaintenanceAllowed bool
+	Auth        string
+	Permissions []string
+}
+
+// CompatRoute maps a legacy path onto the handler of a current operation
+type CompatRoute struct {
+	LegacyPath  string
+	Method      string
+	OperationID string
+	Sunset      string
 }
 
 type HandlerStub struct {
-	FuncName string
+	FuncName       string
+	Package        string
+	Comment        string
+	HandlerFile    string
+	Method         string
+	Path           string
+	OperationID    string
+	Summary        string
+	PathParams     []string
+	HasBody        bool
+	RequiredFields []string
+	WithHub        bool
+}
+
+// ScaffoldTemplateData is the data contract for templates/go/handler.tmpl
+type ScaffoldTemplateData struct {
 	Package  string
-	Comment  string
+	NeedsMux bool
+	Handlers []HandlerStub
+}
+
+// RouterTemplateData is the data contract for templates/go/router.tmpl
+type RouterTemplateData struct {
+	APIVersion string
+	Deprecations []RouteInfo
+	MaintenanceExempt []RouteInfo
+	AuthRoutes []RouteInfo
+	CompatRoutes []CompatRoute
+	SyncOperations []RouteInfo
+	Entities []RouteInfo
+	Avatars []RouteInfo
+	Scene []RouteInfo
+	System []RouteInfo
+	Materials []RouteInfo
+	Extensions []RouteInfo
+	Imports []string
+	ExtensionImports []string
+	TotalRoutes int
+	SyncOpsCount int
+	EntityOpsCount int
+	AvatarOpsCount int
+	SceneOpsCount int
+	SystemOpsCount int
+	MaterialsOpsCount int
+	ExtensionOpsCount int
+}
+
+// JSMethod describes one generated JavaScript client method
+type JSMethod struct {
+	MethodName     string
+	Comment        string
+	Parameters     string
+	Implementation string
+}
+
+// JSClientTemplateData is the data contract for templates/javascript/threejs-client.tmpl
+type JSClientTemplateData struct {
+	SyncOperations []JSMethod
+	Entities []JSMethod
+	Avatars []JSMethod
+	Scene []JSMethod
+	Materials []JSMethod
+	System []JSMethod
+	Extensions []JSMethod
+	OperationTypes []OperationTypeInfo
+	SpecVersion string // Client version, compared with the server's minimum
+	APIVersion string
+}
+
+// OperationTypeInfo is an operation type with the names generated for it
+type OperationTypeInfo struct {
+	Type        string
+	Const       string // Go constant, OpEntityCreate
+	JSName      string // JavaScript property, ENTITY_CREATE
+	Description string
+	Submit      bool
+}
+
+// ClientVersion is the oldest version of a client the server serves
+type ClientVersion struct {
+	Client  string
+	Version string
+}
+
+// BuildInfoTemplateData is the data contract for templates/go/buildinfo.tmpl
+type BuildInfoTemplateData struct {
+	SpecTitle         string
+	SpecVersion       string
+	SpecHash          string
+	APIVersion        string
+	MinClientVersions []ClientVersion
+}
+
+// ContractCheck is a call hd1 selftest makes and what the specification
+// promises it answers
+type ContractCheck struct {
+	OperationID string
+	Method      string
+	Path        string
+	Status      int
+	JSON        bool
+	Required    []string          // Top-level fields the response must have
+	Fields      map[string]string // Types of the top-level fields it may have
+}
+
+// ContractTemplateData is the data contract for templates/go/contract.tmpl
+type ContractTemplateData struct {
+	Checks []ContractCheck
+}
+
+// OperationTypesTemplateData is the data contract for templates/go/operation_types.tmpl
+type OperationTypesTemplateData struct {
+	Types []OperationTypeInfo
+}
+
+// sampleRouterTemplateData returns representative router data with every
+// category populated, used to verify template overrides against the contract
+func sampleRouterTemplateData() RouterTemplateData {
+	route := RouteInfo{Path: "/sample/{id}", Method: "GET", OperationID: "getSample", HandlerFunc: "GetSample", Package: "sample", Deprecated: true, Sunset: "2030-01-01", Successor: "/samples/{id}", MaintenanceAllowed: true, Auth: "operator", Permissions: []string{"view"}}
+	routes := []RouteInfo{route}
+	return RouterTemplateData{
+		APIVersion: "v1",
+		Deprecations: routes,
+		MaintenanceExempt: routes,
+		AuthRoutes: routes,
+		CompatRoutes: []CompatRoute{{LegacyPath: "/legacy/sample/{id}", Method: "GET", OperationID: "getSample", Sunset: "2030-01-01"}},
+		SyncOperations: routes,
+		Entities: routes,
+		Avatars: routes,
+		Scene: routes,
+		System: routes,
+		Materials: routes,
+		Extensions: routes,
+		Imports: []string{"holodeck1/api/sample"},
+		ExtensionImports: []string{"holodeck1/api/sample"},
+		TotalRoutes: 7,
+		SyncOpsCount: 1,
+		EntityOpsCount: 1,
+		AvatarOpsCount: 1,
+		SceneOpsCount: 1,
+		SystemOpsCount: 1,
+		MaterialsOpsCount: 1,
+		ExtensionOpsCount: 1,
+	}
+}
+
+// sampleJSClientTemplateData returns representative JavaScript client data with
+// every category populated, used to verify template overrides against the contract
+func sampleJSClientTemplateData() JSClientTemplateData {
+	route := RouteInfo{Path: "/sample/{id}", Method: "PUT", OperationID: "updateSample", HandlerFunc: "UpdateSample"}
+	methods := []JSMethod{{
+		MethodName:     getJSMethodName(route),
+		Comment:        fmt.Sprintf("%s %s - %s", route.Method, route.Path, route.OperationID),
+		Parameters:     getJSParameters(route),
+		Implementation: generateJSImplementation(route),
+	}}
+	return JSClientTemplateData{
+		SyncOperations: methods,
+		Entities: methods,
+		Avatars: methods,
+		Scene: methods,
+		Materials: methods,
+		System: methods,
+		Extensions: methods,
+		OperationTypes: sampleOperationTypes(),
+		SpecVersion: "1.0.0",
+		APIVersion: "v1",
+	}
+}
+
+// sampleOperationTypes returns a representative operation type, used to
+// verify template overrides against the contract
+func sampleOperationTypes() []OperationTypeInfo {
+	types, _ := operationTypeInfo([]OperationTypeSpec{{Type: "sample_create", Description: "Sample created", Submit: true}})
+	return types
 }
 
 // fileExists checks if a file exists at the given path.
@@ -449,6 +888,22 @@ func fileExists(path string) bool {
 
 // contains checks if a string slice contains a specific item.
 // Uses linear search for small slices typical in code generation.
+// unservedPrefixes are the spec paths of the scene construction operations
+// the server has never served; entities carry their geometry, lights and
+// cameras instead
+var unservedPrefixes = []string{"/animations/", "/cameras/", "/geometries/", "/lights/", "/textures/"}
+
+// unserved reports whether an operation is left out of the generated router
+// and client
+func unserved(path string) bool {
+	for _, prefix := range unservedPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
 		if s == item {
@@ -458,12 +913,176 @@ func contains(slice []string, item string) bool {
 	return false
 }
 
+var pathParamPattern = regexp.MustCompile(`\{([^{}/:]+)(?::[^{}/]*)?\}`)
+
+// extractPathParams returns the path parameter names of an OpenAPI path in order
+func extractPathParams(path string) []string {
+	var params []string
+	for _, match := range pathParamPattern.FindAllStringSubmatch(path, -1) {
+		params = append(params, match[1])
+	}
+	return params
+}
+
+// stubLocals are names a scaffolded handler already declares or imports
+var stubLocals = []string{"w", "r", "hub", "vars", "req", "err", "ok", "json", "http", "mux", "logging"}
+
+// goIdentifier turns a path parameter name into a Go identifier for
+// scaffolded handlers: camel case across anything but letters and digits,
+// suffixed with Param when that leaves a keyword or a name the handler
+// already uses
+func goIdentifier(name string) string {
+	var ident strings.Builder
+	upper := false
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_':
+			if upper && ident.Len() > 0 {
+				c = []rune(strings.ToUpper(string(c)))[0]
+			}
+			ident.WriteRune(c)
+			upper = false
+		default:
+			upper = true
+		}
+	}
+	id := ident.String()
+	switch {
+	case id == "":
+		return "param"
+	case id[0] >= '0' && id[0] <= '9':
+		return "param" + id
+	case token.IsKeyword(id) || contains(stubLocals, id):
+		return id + "Param"
+	}
+	return id
+}
+
+// requiredBodyFields returns the required top-level JSON fields of an
+// operation's request body, when declared inline rather than via $ref
+func requiredBodyFields(op *Operation) []string {
+	if op.RequestBody == nil {
+		return nil
+	}
+	if media, ok := op.RequestBody.Content["application/json"]; ok {
+		return media.Schema.Required
+	}
+	return nil
+}
+
+// handlerFunctionExists reports whether a package-level function with the
+// given name is declared in any non-test Go file of the handler directory
+func handlerFunctionExists(handlerDir, funcName string) bool {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, handlerDir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, parser.SkipObjectResolution)
+	if err != nil {
+		return false
+	}
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == funcName {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// packageNameForDir returns the package clause used by existing Go files in
+// a directory, falling back to the directory name for new packages
+func packageNameForDir(dir string) string {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, file := range files {
+		if f, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.PackageClauseOnly); err == nil {
+			return f.Name.Name
+		}
+	}
+	return filepath.Base(dir)
+}
+
+// scaffoldMissingHandlers writes compilable stubs for missing handlers.
+// Stubs for a missing x-handler file are written to that file; stubs for
+// functions missing from an existing file go to a sibling *_scaffold.go so
+// hand-written code is never rewritten. Existing files are never overwritten.
+func scaffoldMissingHandlers(stubs []HandlerStub) error {
+	tmpl, err := loadTemplate("templates/go/handler.tmpl", ScaffoldTemplateData{
+		Package:  "sample",
+		NeedsMux: true,
+		Handlers: []HandlerStub{{FuncName: "GetSample", Method: "PUT", Path: "/sample/{id}", OperationID: "getSample", PathParams: []string{"id"}, HasBody: true, RequiredFields: []string{"name"}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Group stubs by target file, preserving spec order within each file
+	var targets []string
+	byTarget := make(map[string][]HandlerStub)
+	for _, stub := range stubs {
+		target := stub.HandlerFile
+		if fileExists(target) {
+			target = strings.TrimSuffix(target, ".go") + "_scaffold.go"
+		}
+		if _, seen := byTarget[target]; !seen {
+			targets = append(targets, target)
+		}
+		byTarget[target] = append(byTarget[target], stub)
+	}
+
+	for _, target := range targets {
+		if fileExists(target) {
+			logging.Warn("scaffold target exists, skipping", map[string]interface{}{
+				"file": target,
+			})
+			continue
+		}
+
+		dir := filepath.Dir(target)
+		data := ScaffoldTemplateData{
+			Package:  packageNameForDir(dir),
+			Handlers: byTarget[target],
+		}
+		for _, stub := range data.Handlers {
+			if len(stub.PathParams) > 0 {
+				data.NeedsMux = true
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return fmt.Errorf("scaffold template execute error for %s: %w", target, err)
+		}
+		source, err := format.Source(buf.Bytes())
+		if err != nil {
+			return fmt.Errorf("scaffold output for %s is not valid Go: %w", target, err)
+		}
+
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create handler directory %s: %w", dir, err)
+		}
+		if err := os.WriteFile(target, source, 0644); err != nil {
+			return fmt.Errorf("failed to write scaffold %s: %w", target, err)
+		}
+
+		logging.Info("handler stubs scaffolded", map[string]interface{}{
+			"file":     target,
+			"package":  data.Package,
+			"handlers": len(data.Handlers),
+		})
+	}
+
+	return nil
+}
+
 // CLI client generation removed for minimal build
 
 
 
 // generateWebUIClient creates the advanced auto-generated web UI client
-func generateWebUIClient(spec OpenAPISpec, routes []RouteInfo) {
+func generateWebUIClient(spec OpenAPISpec, routes []RouteInfo, operationTypes []OperationTypeInfo) {
 	logging.Debug("creating Web UI generator infrastructure")
 	
 	// Create web UI client directory structure
@@ -476,7 +1095,7 @@ func generateWebUIClient(spec OpenAPISpec, routes []RouteInfo) {
 	}
 	
 	// Generate JavaScript API Client Library
-	if err := generateJavaScriptAPIClient(uiClientDir, spec, routes); err != nil {
+	if err := generateJavaScriptAPIClient(uiClientDir, spec, routes, operationTypes); err != nil {
 		logging.Error("failed to generate JavaScript API client", map[string]interface{}{
 			"error": err.Error(),
 		})
@@ -496,16 +1115,9 @@ func generateWebUIClient(spec OpenAPISpec, routes []RouteInfo) {
 }
 
 // generateJavaScriptAPIClient creates the complete JavaScript API wrapper
-func generateJavaScriptAPIClient(outputDir string, spec OpenAPISpec, routes []RouteInfo) error {
+func generateJavaScriptAPIClient(outputDir string, spec OpenAPISpec, routes []RouteInfo, operationTypes []OperationTypeInfo) error {
 
 	// Process routes for JavaScript template
-	type JSMethod struct {
-		MethodName     string
-		Comment        string
-		Parameters     string
-		Implementation string
-	}
-	
 	var jsMethods []JSMethod
 	for _, route := range routes {
 		method := JSMethod{
@@ -518,7 +1130,7 @@ func generateJavaScriptAPIClient(outputDir string, spec OpenAPISpec, routes []Ro
 	}
 	
 	// Organize methods by category for Three.js JavaScript template
-	var syncOps, entityOps, avatarOps, sceneOps, systemOps, materialsOps []JSMethod
+	var syncOps, entityOps, avatarOps, sceneOps, systemOps, materialsOps, extensionOps []JSMethod
 	for _, method := range jsMethods {
 		if strings.Contains(method.Comment, "/sync") {
 			syncOps = append(syncOps, method)
@@ -532,26 +1144,28 @@ func generateJavaScriptAPIClient(outputDir string, spec OpenAPISpec, routes []Ro
 			materialsOps = append(materialsOps, method)
 		} else if strings.Contains(method.Comment, "/system") {
 			systemOps = append(systemOps, method)
+		} else if !unserved(method.Comment[strings.Index(method.Comment, " ")+1:]) {
+			extensionOps = append(extensionOps, method)
 		}
 	}
 
-	tmplData := struct {
-		SyncOperations []JSMethod
-		Entities []JSMethod
-		Avatars []JSMethod
-		Scene []JSMethod
-		Materials []JSMethod
-		System []JSMethod
-	}{
+	tmplData := JSClientTemplateData{
 		SyncOperations: syncOps,
 		Entities: entityOps,
 		Avatars: avatarOps,
 		Scene: sceneOps,
 		Materials: materialsOps,
 		System: systemOps,
+		Extensions: extensionOps,
+		OperationTypes: operationTypes,
+		SpecVersion: spec.Info.Version,
+		APIVersion: spec.XAPIVersion,
+	}
+	if tmplData.APIVersion == "" {
+		tmplData.APIVersion = "v1"
 	}
 	
-	tmpl, err := loadTemplate("templates/javascript/threejs-client.tmpl")
+	tmpl, err := loadTemplate("templates/javascript/threejs-client.tmpl", sampleJSClientTemplateData())
 	if err != nil {
 		return fmt.Errorf("failed to load JavaScript API template: %w", err)
 	}
@@ -570,6 +1184,308 @@ func generateJavaScriptAPIClient(outputDir string, spec OpenAPISpec, routes []Ro
 	return nil
 }
 
+// operationTypeInfo checks the declared operation types and names their
+// Go constants and JavaScript properties, sorted by type
+func operationTypeInfo(declared []OperationTypeSpec) ([]OperationTypeInfo, error) {
+	pattern := regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+	types := make([]OperationTypeInfo, 0, len(declared))
+	seen := make(map[string]bool)
+	for _, spec := range declared {
+		if !pattern.MatchString(spec.Type) {
+			return nil, fmt.Errorf("operation type %q must match %s", spec.Type, pattern)
+		}
+		if seen[spec.Type] {
+			return nil, fmt.Errorf("operation type %q is declared twice", spec.Type)
+		}
+		seen[spec.Type] = true
+
+		var name strings.Builder
+		name.WriteString("Op")
+		for _, word := range strings.Split(spec.Type, "_") {
+			if word != "" {
+				name.WriteString(strings.ToUpper(word[:1]) + word[1:])
+			}
+		}
+		types = append(types, OperationTypeInfo{
+			Type:        spec.Type,
+			Const:       name.String(),
+			JSName:      strings.ToUpper(spec.Type),
+			Description: spec.Description,
+			Submit:      spec.Submit,
+		})
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Type < types[j].Type })
+	return types, nil
+}
+
+// buildInfoData describes the specification for the buildinfo package and
+// the JavaScript client
+func buildInfoData(spec OpenAPISpec, specData []byte) BuildInfoTemplateData {
+	sum := sha256.Sum256(specData)
+	apiVersion := spec.XAPIVersion
+	if apiVersion == "" {
+		apiVersion = "v1"
+	}
+	data := BuildInfoTemplateData{
+		SpecTitle:   spec.Info.Title,
+		SpecVersion: spec.Info.Version,
+		SpecHash:    hex.EncodeToString(sum[:8]),
+		APIVersion:  apiVersion,
+	}
+	for client, version := range spec.XMinClientVersions {
+		data.MinClientVersions = append(data.MinClientVersions, ClientVersion{Client: client, Version: version})
+	}
+	sort.Slice(data.MinClientVersions, func(i, j int) bool {
+		return data.MinClientVersions[i].Client < data.MinClientVersions[j].Client
+	})
+	return data
+}
+
+// sampleBuildInfo returns representative build information, used to verify
+// template overrides against the contract
+func sampleBuildInfo() BuildInfoTemplateData {
+	return BuildInfoTemplateData{
+		SpecTitle:         "Sample API",
+		SpecVersion:       "1.0.0",
+		SpecHash:          "0123456789abcdef",
+		APIVersion:        "v1",
+		MinClientVersions: []ClientVersion{{Client: "hd1lib", Version: "1.0.0"}},
+	}
+}
+
+// generateBuildInfo writes the buildinfo package's specification constants
+func generateBuildInfo(outputPath string, spec OpenAPISpec, specData []byte) error {
+	tmpl, err := loadTemplate("templates/go/buildinfo.tmpl", sampleBuildInfo())
+	if err != nil {
+		return err
+	}
+	data := buildInfoData(spec, specData)
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return fmt.Errorf("build information template execute error: %w", err)
+	}
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("build information output is not valid Go: %w", err)
+	}
+	if err := os.WriteFile(outputPath, source, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", outputPath, err)
+	}
+	logging.Info("build information generated", map[string]interface{}{
+		"file":      outputPath,
+		"spec_hash": data.SpecHash,
+	})
+	return nil
+}
+
+// contractCheck describes an operation anyone may call without arguments,
+// by its lowest success status. Operations streaming their answer, with
+// path parameters or required parameters, limited to some callers or
+// marked x-selftest: skip are not checked.
+func contractCheck(spec OpenAPISpec, method, path string, op *Operation) (ContractCheck, bool) {
+	if method != "GET" || op.XSelftest == "skip" || len(extractPathParams(path)) > 0 {
+		return ContractCheck{}, false
+	}
+	if (op.XAuth != "" && op.XAuth != "public") || len(op.XPermissions) > 0 {
+		return ContractCheck{}, false
+	}
+	for _, param := range op.Parameters {
+		if param.Required {
+			return ContractCheck{}, false
+		}
+	}
+
+	status := 0
+	for code := range op.Responses {
+		var value int
+		if _, err := fmt.Sscanf(code, "%d", &value); err == nil && value >= 200 && value < 300 && (status == 0 || value < status) {
+			status = value
+		}
+	}
+	if status == 0 {
+		return ContractCheck{}, false
+	}
+	response := op.Responses[fmt.Sprint(status)]
+	if _, streams := response.Content["text/event-stream"]; streams {
+		return ContractCheck{}, false
+	}
+
+	check := ContractCheck{
+		OperationID: op.OperationID,
+		Method:      method,
+		Path:        strings.TrimPrefix(path, "/api"),
+		Status:      status,
+	}
+	if media, ok := response.Content["application/json"]; ok {
+		check.JSON = true
+		schema := media.Schema
+		if name, found := strings.CutPrefix(schema.Ref, "#/components/schemas/"); found {
+			schema = spec.Components.Schemas[name]
+		}
+		check.Required = schema.Required
+		for name, property := range schema.Properties {
+			if property.Type != "" {
+				if check.Fields == nil {
+					check.Fields = map[string]string{}
+				}
+				check.Fields[name] = property.Type
+			}
+		}
+	}
+	return check, true
+}
+
+// sampleContract returns a representative contract check, used to verify
+// template overrides against the contract
+func sampleContract() ContractTemplateData {
+	return ContractTemplateData{Checks: []ContractCheck{{
+		OperationID: "getSample",
+		Method:      "GET",
+		Path:        "/sample",
+		Status:      200,
+		JSON:        true,
+		Required:    []string{"success"},
+		Fields:      map[string]string{"success": "boolean"},
+	}}}
+}
+
+// generateContract writes the selftest package's contract checks
+func generateContract(outputPath string, checks []ContractCheck) error {
+	tmpl, err := loadTemplate("templates/go/contract.tmpl", sampleContract())
+	if err != nil {
+		return err
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Path < checks[j].Path })
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, ContractTemplateData{Checks: checks}); err != nil {
+		return fmt.Errorf("contract template execute error: %w", err)
+	}
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("contract output is not valid Go: %w", err)
+	}
+	if err := os.WriteFile(outputPath, source, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", outputPath, err)
+	}
+	logging.Info("contract checks generated", map[string]interface{}{
+		"file":   outputPath,
+		"checks": len(checks),
+	})
+	return nil
+}
+
+// generateOperationTypes writes the sync package's operation type constants
+func generateOperationTypes(outputPath string, types []OperationTypeInfo) error {
+	tmpl, err := loadTemplate("templates/go/operation_types.tmpl", OperationTypesTemplateData{Types: sampleOperationTypes()})
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, OperationTypesTemplateData{Types: types}); err != nil {
+		return fmt.Errorf("operation types template execute error: %w", err)
+	}
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("operation types output is not valid Go: %w", err)
+	}
+	if err := os.WriteFile(outputPath, source, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", outputPath, err)
+	}
+
+	logging.Info("operation types generated", map[string]interface{}{
+		"file":  outputPath,
+		"types": len(types),
+	})
+	return nil
+}
+
+// generateAssetManifest hashes the console's JavaScript and CSS so the
+// server can serve them under content-hashed names with integrity values
+func generateAssetManifest(staticDir string) error {
+	manifest := server.AssetManifest{Assets: make(map[string]string), Integrity: make(map[string]string)}
+	for _, dir := range []string{"js", "css"} {
+		entries, err := os.ReadDir(filepath.Join(staticDir, dir))
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			if entry.IsDir() || (ext != ".js" && ext != ".css") {
+				continue
+			}
+			name := dir + "/" + entry.Name()
+			content, err := os.ReadFile(filepath.Join(staticDir, name))
+			if err != nil {
+				return err
+			}
+			manifest.Assets[name] = server.Fingerprint(content)
+			manifest.Integrity[name] = server.Integrity(content)
+		}
+	}
+
+	encoded, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	manifestPath := filepath.Join(staticDir, server.AssetManifestFile)
+	if err := os.WriteFile(manifestPath, append(encoded, '\n'), 0644); err != nil {
+		return err
+	}
+
+	logging.Info("asset manifest generated", map[string]interface{}{
+		"assets": len(manifest.Assets),
+		"path":   manifestPath,
+	})
+	return nil
+}
+
+// embedHtDocs replaces the embedded copy of the document root. The
+// directory's tracked README survives; everything else is rebuilt.
+func embedHtDocs(sourceDir, embedDir string) error {
+	entries, err := os.ReadDir(embedDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() == "README.md" {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(embedDir, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	files := 0
+	err = filepath.WalkDir(sourceDir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(sourceDir, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(embedDir, relative)
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files++
+		return os.WriteFile(target, content, 0644)
+	})
+	if err != nil {
+		return err
+	}
+
+	logging.Info("console assets copied for embedding", map[string]interface{}{
+		"files": files,
+		"path":  embedDir,
+	})
+	return nil
+}
+
 // UI component generation removed for minimal build
 
 // Form system generation removed for minimal build
@@ -1032,6 +1948,22 @@ func (sm *SchemaMerger) MergeSchemas() (map[string]interface{}, error) {
 			}
 		}
 
+		// The unified version is the one the schemas declare
+		if info, ok := schema.Spec["info"].(map[string]interface{}); ok {
+			if version, ok := info["version"].(string); ok && version != "" {
+				unified["info"].(map[string]interface{})["version"] = version
+			}
+		}
+
+		// Merge top-level vendor extensions (x-api-version, x-code-generation, ...)
+		for key, value := range schema.Spec {
+			if strings.HasPrefix(key, "x-") {
+				if _, exists := unified[key]; !exists {
+					unified[key] = value
+				}
+			}
+		}
+
 		// Merge components
 		if components := getSchemaComponents(schema.Spec); components != nil {
 			for compName, compDef := range components {
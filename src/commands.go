@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"holodeck1/config"
+	"holodeck1/worlds"
+)
+
+// Exit codes shared by operational subcommands
+const (
+	exitOK     = 0
+	exitFailed = 1
+	exitUsage  = 2
+)
+
+// client_commands talk to a server, on this host or through a profile
+// saved by hd1 login, rather than act on the daemon configuration
+var client_commands = map[string]bool{
+	"backup":  true,
+	"login":   true,
+	"restore": true,
+	"watch":   true,
+	"world":   true,
+}
+
+// run_subcommand dispatches `hd1 <command> [args]` operational tools.
+// Subcommands share the daemon configuration but never start the server.
+func run_subcommand(args []string) int {
+	switch args[0] {
+	case "validate-world":
+		return run_validate_world(args[1:])
+	case "world":
+		return run_world(args[1:])
+	case "drain":
+		return run_drain(args[1:])
+	case "maintenance":
+		return run_maintenance(args[1:])
+	case "watch":
+		return run_watch(args[1:])
+	case "login":
+		return run_login(args[1:])
+	case "backup":
+		return run_backup(args[1:])
+	case "restore":
+		return run_restore(args[1:])
+	case "selftest":
+		return run_selftest(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %s (see hd1 --help)\n", args[0])
+		return exitUsage
+	}
+}
+
+// run_validate_world lints world definitions and prints a JSON report.
+// Exit status is 0 when valid, 1 on validation errors, 2 on usage errors.
+func run_validate_world(args []string) int {
+	dir := config.GetWorldsDir()
+	if len(args) > 1 {
+		fmt.Fprintln(os.Stderr, "usage: hd1 validate-world [dir]")
+		return exitUsage
+	}
+	if len(args) == 1 {
+		dir = args[0]
+	}
+
+	report, err := worlds.ValidateDir(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "validate-world: %v\n", err)
+		return exitUsage
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+
+	if !report.Valid {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// run_world dispatches `hd1 world <diff|merge>` export tooling
+func run_world(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: hd1 world <diff|merge|export|import|migrate|lint> ...")
+		return exitUsage
+	}
+	switch args[0] {
+	case "diff":
+		return run_world_diff(args[1:])
+	case "merge":
+		return run_world_merge(args[1:])
+	case "export":
+		return run_world_export(args[1:])
+	case "import":
+		return run_world_import(args[1:])
+	case "migrate":
+		return run_world_migrate(args[1:])
+	case "lint":
+		return run_world_lint(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown world command: %s\n", args[0])
+		return exitUsage
+	}
+}
+
+// read_world_export loads a world export or checkpoint file
+func read_world_export(path string) (*worlds.State, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	state, err := worlds.ReadExport(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return state, nil
+}
+
+// run_world_diff compares two exports and prints a JSON diff.
+// Exit status is 0 when identical, 1 when they differ, 2 on usage errors.
+func run_world_diff(args []string) int {
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: hd1 world diff a.json b.json")
+		return exitUsage
+	}
+	from, err := read_world_export(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "world diff: %v\n", err)
+		return exitUsage
+	}
+	to, err := read_world_export(args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "world diff: %v\n", err)
+		return exitUsage
+	}
+
+	diff := worlds.Compare(from, to)
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(diff)
+
+	if len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Changed) == 0 && len(diff.Scene) == 0 {
+		return exitOK
+	}
+	return exitFailed
+}
+
+// run_world_merge three-way merges two exports that branched from a base
+// and writes the merged export. Conflicts are listed on stderr and resolved
+// with --prefer; without it they take "ours" and the exit status is 1.
+func run_world_merge(args []string) int {
+	flags := flag.NewFlagSet("world merge", flag.ContinueOnError)
+	prefer := flags.String("prefer", "", "Resolve conflicts with this side (ours, theirs)")
+	output := flags.String("o", "", "Write the merged export to this file instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: hd1 world merge [--prefer ours|theirs] [-o merged.json] base.json ours.json theirs.json")
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 3 || (*prefer != "" && *prefer != worlds.PreferOurs && *prefer != worlds.PreferTheirs) {
+		flags.Usage()
+		return exitUsage
+	}
+
+	var states [3]*worlds.State
+	for i, path := range flags.Args() {
+		state, err := read_world_export(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "world merge: %v\n", err)
+			return exitUsage
+		}
+		states[i] = state
+	}
+
+	merged, conflicts := worlds.Merge(states[0], states[1], states[2], *prefer)
+	for _, conflict := range conflicts {
+		fmt.Fprintln(os.Stderr, conflict)
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "world merge: %v\n", err)
+			return exitUsage
+		}
+		defer file.Close()
+		out = file
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(worlds.NewExport("", merged, nil)); err != nil {
+		fmt.Fprintf(os.Stderr, "world merge: %v\n", err)
+		return exitUsage
+	}
+
+	if len(conflicts) > 0 && *prefer == "" {
+		return exitFailed
+	}
+	return exitOK
+}
@@ -0,0 +1,58 @@
+package components
+
+// builtins returns the components the server defines. Their schemas give
+// the shape tooling needs; their packages check the rest as entities are
+// created and updated, such as that a portal leads somewhere reachable.
+func builtins() []*Component {
+	return []*Component{
+		{Name: "id", Description: "Entity ID, issued by the server unless suggested",
+			Schema: &Schema{Type: TypeString, Pattern: `^[A-Za-z0-9][A-Za-z0-9_.:-]{0,127}$`}},
+		{Name: "geometry", Description: "Three.js geometry: its type and parameters such as width or radius",
+			Schema: &Schema{Type: TypeObject, Properties: map[string]*Schema{
+				"type": {Type: TypeString},
+				"text": {Type: TypeString},
+			}}},
+		{Name: "material", Description: "Surface of the geometry",
+			Schema: &Schema{Type: TypeObject, Properties: map[string]*Schema{
+				"type":        {Type: TypeString},
+				"color":       {Type: TypeString},
+				"opacity":     {Type: TypeNumber, Minimum: floatPtr(0), Maximum: floatPtr(1)},
+				"transparent": {Type: TypeBoolean},
+			}}},
+		{Name: "model", Description: "GLB asset shown instead of a geometry, sha256:<digest>",
+			Schema: &Schema{Type: TypeString}},
+		{Name: "position", Description: "Metres from the origin", Schema: vector()},
+		{Name: "rotation", Description: "Euler angles in radians", Schema: vector()},
+		{Name: "scale", Description: "Factor along each axis", Schema: vector()},
+		{Name: "visible", Schema: &Schema{Type: TypeBoolean}},
+		{Name: "metadata", Description: "Details kept with the entity, such as the import it came from",
+			Schema: &Schema{Type: TypeObject}},
+		{Name: "particles", Description: "Particle emitter", Schema: &Schema{Type: TypeObject}},
+		{Name: "panel", Description: "Label, billboard or text panel laid out by the server", Schema: &Schema{Type: TypeObject}},
+		{Name: "media", Description: "Video screen and its playback", Schema: &Schema{Type: TypeObject}},
+		{Name: "whiteboard", Description: "Drawing surface; strokes change by delta", Schema: &Schema{Type: TypeObject}},
+		{Name: "form", Description: "Data entry card described by a JSON Schema", Schema: &Schema{Type: TypeObject}},
+		{Name: "portal", Description: "Carries avatars stepping into it to a destination",
+			Schema: &Schema{Type: TypeObject, Required: []string{"world"}, Properties: map[string]*Schema{
+				"world": {Type: TypeString},
+				"view":  {Type: TypeString},
+				"label": {Type: TypeString, MaxLength: intPtr(200)},
+			}}},
+		{Name: "pointcloud", Description: "Scanned points from a tiled point cloud asset", Schema: &Schema{Type: TypeObject}},
+		{Name: "terrain", Description: "Map ground tile", Schema: &Schema{Type: TypeObject}},
+		{Name: "bindings", Description: "Transform properties derived from expressions every tick",
+			Schema: &Schema{Type: TypeObject}},
+	}
+}
+
+func vector() *Schema {
+	return &Schema{Type: TypeObject, Properties: map[string]*Schema{
+		"x": {Type: TypeNumber},
+		"y": {Type: TypeNumber},
+		"z": {Type: TypeNumber},
+	}}
+}
+
+func intPtr(value int) *int { return &value }
+
+func floatPtr(value float64) *float64 { return &value }
@@ -0,0 +1,249 @@
+// Package components is the registry of entity component schemas. Entity
+// operations carry components as top-level fields of their data, such as
+// position or portal; the registry holds a JSON Schema for each, so they
+// are checked as entities are created and updated, and tooling can ask
+// what an entity may hold.
+//
+// Built-in components come with the server; their schemas describe their
+// shape, and their own packages check the rest. Plugins add components by
+// dropping a schema file into the components directory:
+//
+//	name: sensor
+//	description: Latest reading of an IoT sensor
+//	schema:
+//	  type: object
+//	  required: [unit]
+//	  properties:
+//	    value: {type: number}
+//	    unit: {type: string, enum: [C, F, "%"]}
+//
+// Components without a schema pass unchecked, unless the registry is
+// strict.
+package components
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+)
+
+// Component sources
+const (
+	SourceBuiltin = "builtin"
+	SourcePlugin  = "plugin"
+)
+
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// ErrUnknown is returned in strict mode for components without a schema
+var ErrUnknown = errors.New("unknown component")
+
+// Component is a registered entity component
+type Component struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Source      string  `json:"source"`         // builtin or plugin
+	File        string  `json:"file,omitempty"` // Schema file of a plugin component
+	Schema      *Schema `json:"schema"`
+}
+
+var (
+	registry      = map[string]*Component{}
+	registryMutex sync.RWMutex
+)
+
+func init() {
+	for _, component := range builtins() {
+		component.Source = SourceBuiltin
+		if err := component.Schema.Check(); err != nil {
+			panic("component " + component.Name + ": " + err.Error())
+		}
+		registry[component.Name] = component
+	}
+}
+
+// Load reads the plugin component schemas of the components directory,
+// *.yaml, *.yml and *.json, one component each; a missing directory
+// leaves the built-in components
+func Load() error {
+	dir := config.GetComponentsDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	plugins := map[string]*Component{}
+	for _, entry := range entries {
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".yaml", ".yml", ".json":
+		default:
+			continue
+		}
+		if entry.IsDir() {
+			continue
+		}
+		file := filepath.Join(dir, entry.Name())
+		component, err := readPlugin(file)
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		if existing, ok := plugins[component.Name]; ok {
+			return fmt.Errorf("%s: component %q is already defined in %s", file, component.Name, existing.File)
+		}
+		plugins[component.Name] = component
+	}
+
+	registryMutex.Lock()
+	for name, component := range registry {
+		if component.Source == SourcePlugin {
+			delete(registry, name)
+		}
+	}
+	for name, component := range plugins {
+		registry[name] = component
+	}
+	registryMutex.Unlock()
+
+	logging.Info("entity components loaded", map[string]interface{}{
+		"dir":     dir,
+		"plugins": len(plugins),
+		"strict":  config.GetComponentsStrict(),
+	})
+	return nil
+}
+
+// readPlugin reads one schema file. YAML is normalised through JSON, so
+// JSON Schema's camelCase keywords apply to both.
+func readPlugin(file string) (*Component, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var document interface{}
+	if err := yaml.Unmarshal(raw, &document); err != nil {
+		return nil, fmt.Errorf("invalid YAML: %v", err)
+	}
+	normalised, err := json.Marshal(document)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported YAML content: %v", err)
+	}
+	var component Component
+	if err := json.Unmarshal(normalised, &component); err != nil {
+		return nil, fmt.Errorf("invalid component: %v", err)
+	}
+
+	if !namePattern.MatchString(component.Name) {
+		return nil, fmt.Errorf("name must match %s", namePattern)
+	}
+	if _, ok := builtin(component.Name); ok {
+		return nil, fmt.Errorf("component %q is built in", component.Name)
+	}
+	if component.Schema == nil {
+		return nil, errors.New("schema required")
+	}
+	if err := component.Schema.Check(); err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	component.Source = SourcePlugin
+	component.File = filepath.Base(file)
+	return &component, nil
+}
+
+func builtin(name string) (*Component, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	component, ok := registry[name]
+	return component, ok && component.Source == SourceBuiltin
+}
+
+// Lookup returns a registered component
+func Lookup(name string) (*Component, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	component, ok := registry[name]
+	return component, ok
+}
+
+// List returns the registered components by name
+func List() []*Component {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	list := make([]*Component, 0, len(registry))
+	for _, component := range registry {
+		list = append(list, component)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Validate checks the components of entity operation data against their
+// schemas. A null component is removed rather than set, so it passes.
+func Validate(data map[string]interface{}) error {
+	plain, err := normalize(data)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(plain))
+	for name := range plain {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	for _, name := range names {
+		if plain[name] == nil {
+			continue
+		}
+		component, ok := registry[name]
+		if !ok {
+			if config.GetComponentsStrict() {
+				return fmt.Errorf("%w %q", ErrUnknown, name)
+			}
+			continue
+		}
+		if err := component.Schema.Validate(name, plain[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Plugin checks components given by name, which must be plugin ones
+func Plugin(data map[string]interface{}) error {
+	for name := range data {
+		component, ok := Lookup(name)
+		switch {
+		case !ok:
+			return fmt.Errorf("%w %q", ErrUnknown, name)
+		case component.Source != SourcePlugin:
+			return fmt.Errorf("component %q is built in, set it by its own field", name)
+		}
+	}
+	return Validate(data)
+}
+
+// normalize decodes data through JSON. Operations built in memory hold
+// typed structs, which the schemas see as JSON does.
+func normalize(data map[string]interface{}) (map[string]interface{}, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid component data: %v", err)
+	}
+	var plain map[string]interface{}
+	if err := json.Unmarshal(encoded, &plain); err != nil {
+		return nil, fmt.Errorf("invalid component data: %v", err)
+	}
+	return plain, nil
+}
@@ -0,0 +1,215 @@
+package components
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+)
+
+// Schema types
+const (
+	TypeObject  = "object"
+	TypeArray   = "array"
+	TypeString  = "string"
+	TypeNumber  = "number"
+	TypeInteger = "integer"
+	TypeBoolean = "boolean"
+)
+
+// maxDepth bounds how deeply schemas nest
+const maxDepth = 16
+
+// Schema is the JSON Schema of a component. The keywords below are
+// understood; others, such as $schema or title, are ignored. A schema
+// without a type accepts any value its other keywords allow.
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"` // false refuses unlisted properties
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// Check validates the schema itself and prepares it for use
+func (s *Schema) Check() error {
+	return s.check("", 0)
+}
+
+func (s *Schema) check(path string, depth int) error {
+	if depth > maxDepth {
+		return fmt.Errorf("schema nests deeper than %d levels", maxDepth)
+	}
+	where := func(message string) error {
+		if path == "" {
+			return errors.New(message)
+		}
+		return fmt.Errorf("%s: %s", path, message)
+	}
+	switch s.Type {
+	case "", TypeObject, TypeArray, TypeString, TypeNumber, TypeInteger, TypeBoolean:
+	default:
+		return where(fmt.Sprintf("unsupported type %q", s.Type))
+	}
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return where("invalid pattern: " + err.Error())
+		}
+		s.pattern = pattern
+	}
+	if s.Minimum != nil && s.Maximum != nil && *s.Minimum > *s.Maximum {
+		return where("minimum exceeds maximum")
+	}
+	for _, name := range s.Required {
+		if _, ok := s.Properties[name]; !ok && s.AdditionalProperties != nil && !*s.AdditionalProperties {
+			return where(fmt.Sprintf("required property %q is not allowed", name))
+		}
+	}
+	for name, property := range s.Properties {
+		if property == nil {
+			return where(fmt.Sprintf("property %q has no schema", name))
+		}
+		if err := property.check(join(path, name), depth+1); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		if err := s.Items.check(path+"[]", depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks a value, as decoded from JSON, against the schema;
+// errors name the offending value by its path, starting with path
+func (s *Schema) Validate(path string, value interface{}) error {
+	if s.Type != "" && !hasType(value, s.Type) {
+		return fmt.Errorf("%s must be %s", path, article(s.Type))
+	}
+	if len(s.Enum) > 0 && !s.allows(value) {
+		return fmt.Errorf("%s must be one of %v", path, s.Enum)
+	}
+
+	switch v := value.(type) {
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			return fmt.Errorf("%s must be at least %g", path, *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			return fmt.Errorf("%s must be at most %g", path, *s.Maximum)
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.MinLength != nil && length < *s.MinLength {
+			return fmt.Errorf("%s must be at least %d characters", path, *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return fmt.Errorf("%s must be at most %d characters", path, *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			return fmt.Errorf("%s must match %s", path, s.Pattern)
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			return fmt.Errorf("%s must have at least %d items", path, *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			return fmt.Errorf("%s must have at most %d items", path, *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				if err := s.Items.Validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%s is required", join(path, name))
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fmt.Errorf("%s is not allowed", join(path, name))
+				}
+				continue
+			}
+			if err := property.Validate(join(path, name), v[name]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) allows(value interface{}) bool {
+	for _, allowed := range s.Enum {
+		if reflect.DeepEqual(allowed, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasType(value interface{}, schemaType string) bool {
+	switch schemaType {
+	case TypeObject:
+		_, ok := value.(map[string]interface{})
+		return ok
+	case TypeArray:
+		_, ok := value.([]interface{})
+		return ok
+	case TypeString:
+		_, ok := value.(string)
+		return ok
+	case TypeNumber:
+		_, ok := value.(float64)
+		return ok
+	case TypeInteger:
+		number, ok := value.(float64)
+		return ok && number == math.Trunc(number)
+	case TypeBoolean:
+		_, ok := value.(bool)
+		return ok
+	}
+	return true
+}
+
+func article(schemaType string) string {
+	switch schemaType {
+	case TypeObject, TypeArray, TypeInteger:
+		return "an " + schemaType
+	}
+	return "a " + schemaType
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -1,10 +1,12 @@
 package config
 
 import (
-	"bufio"
 	"crypto/rand"
 	"flag"
 	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -19,27 +21,74 @@ const (
 )
 
 // HD1Config represents the complete HD1 configuration system
-// Priority: Flags > Environment Variables > Config File > Defaults
+// Priority: Flags > Environment Variables > Profiles > .env File > Defaults
 type HD1Config struct {
-	Server    ServerConfig    `json:"server"`
-	Paths     PathsConfig     `json:"paths"`
-	Logging   LoggingConfig   `json:"logging"`
-	Client    ClientConfig    `json:"client"`
-	WebSocket WebSocketConfig `json:"websocket"`
-	Session   SessionConfig   `json:"session"`
-	Worlds    WorldsConfig    `json:"worlds"`
-	Avatars   AvatarsConfig   `json:"avatars"`
-	Sync      SyncConfig      `json:"sync"`
+	Server        ServerConfig        `json:"server"`
+	Paths         PathsConfig         `json:"paths"`
+	Logging       LoggingConfig       `json:"logging"`
+	Client        ClientConfig        `json:"client"`
+	WebSocket     WebSocketConfig     `json:"websocket"`
+	Session       SessionConfig       `json:"session"`
+	Worlds        WorldsConfig        `json:"worlds"`
+	Avatars       AvatarsConfig       `json:"avatars"`
+	Sync          SyncConfig          `json:"sync"`
+	Storage       StorageConfig       `json:"storage"`
+	Assets        AssetsConfig        `json:"assets"`
+	Clients       ClientsConfig       `json:"clients"`
+	XR            XRConfig            `json:"xr"`
+	Accessibility AccessibilityConfig `json:"accessibility"`
+	Entities      EntitiesConfig      `json:"entities"`
+	Compression   CompressionConfig   `json:"compression"`
+	Features      FeaturesConfig      `json:"features"`
+	Moderation    ModerationConfig    `json:"moderation"`
+	Environment   EnvironmentConfig   `json:"environment"`
+	Media         MediaConfig         `json:"media"`
+	Bookings      BookingsConfig      `json:"bookings"`
+	Guests        GuestsConfig        `json:"guests"`
+	Email         EmailConfig         `json:"email"`
+	Connectors    ConnectorsConfig    `json:"connectors"`
+	Bindings      BindingsConfig      `json:"bindings"`
+	Imports       ImportsConfig       `json:"imports"`
+	Geo           GeoConfig           `json:"geo"`
+	Simulation    SimulationConfig    `json:"simulation"`
+	Budgets       BudgetsConfig       `json:"budgets"`
+	Hibernation   HibernationConfig   `json:"hibernation"`
+	Webhooks      WebhooksConfig      `json:"webhooks"`
+	Forms         FormsConfig         `json:"forms"`
+	Portals       PortalsConfig       `json:"portals"`
+	Consent       ConsentConfig       `json:"consent"`
+	Impersonation ImpersonationConfig `json:"impersonation"`
+	APIUsage      APIUsageConfig      `json:"api_usage"`
+	Telemetry     TelemetryConfig     `json:"telemetry"`
+	Quality       QualityConfig       `json:"quality"`
+	Crowd         CrowdConfig         `json:"crowd"`
+	Spectators    SpectatorsConfig    `json:"spectators"`
+	Broadcast     BroadcastConfig     `json:"broadcast"`
+	Quotas        QuotasConfig        `json:"quotas"`
+	Chunks        ChunksConfig        `json:"chunks"`
+	Components    ComponentsConfig    `json:"components"`
+	Hooks         HooksConfig         `json:"hooks"`
 }
 
 type ServerConfig struct {
-	Host            string `json:"host"`
-	Port            string `json:"port"`
-	APIBase         string `json:"api_base"`
-	InternalAPIBase string `json:"internal_api_base"`
-	StaticDir       string `json:"static_dir"`
-	Daemon          bool   `json:"daemon"`
-	Version         string `json:"version"`
+	Host            string   `json:"host"`
+	Port            string   `json:"port"`
+	Listen          []string `json:"listen"`           // Listener addresses, replaces host:port when set
+	SocketMode      string   `json:"socket_mode"`      // Octal permissions for Unix sockets
+	SocketOperators bool     `json:"socket_operators"` // Unix socket peers are local callers, and so operators
+	TrustedProxies  []string `json:"trusted_proxies"`  // IPs, CIDRs or "unix" allowed to set X-Forwarded-*
+	TLSCert         string   `json:"tls_cert"`         // PEM certificate; with TLSKey, TCP listeners serve HTTPS and HTTP/2
+	TLSKey          string   `json:"tls_key"`
+	APIBase         string   `json:"api_base"`
+	InternalAPIBase string   `json:"internal_api_base"`
+	StaticDir       string   `json:"static_dir"`
+	StaticDevMode   bool     `json:"static_dev_mode"` // Plain asset names, no caching
+	StaticSource    string   `json:"static_source"`   // auto, embedded or disk
+	Daemon          bool     `json:"daemon"`
+	Container       bool     `json:"container"`        // Docker/Kubernetes mode: env-only config, JSON console logs, no daemon
+	ShutdownTimeout time.Duration `json:"shutdown_timeout"` // Drain time for in-flight requests on SIGTERM
+	Profiles        []string `json:"profiles"` // Configuration profiles applied, in order
+	Version         string   `json:"version"`
 }
 
 type PathsConfig struct {
@@ -54,6 +103,9 @@ type PathsConfig struct {
 	WorldsDir    string `json:"worlds_dir"`
 	AvatarsDir   string `json:"avatars_dir"`
 	RecordingsDir string `json:"recordings_dir"`
+	TemplatesDir string `json:"templates_dir"`
+	LocalesDir   string `json:"locales_dir"`
+	ProfilesDir  string `json:"profiles_dir"`
 }
 
 type LoggingConfig struct {
@@ -61,10 +113,12 @@ type LoggingConfig struct {
 	TraceModules []string `json:"trace_modules"`
 	LogFile     string   `json:"log_file"`
 	LogDir      string   `json:"log_dir"`
+	Format      string   `json:"format"` // Console format: text or json (default json in containers)
 }
 
 type ClientConfig struct {
 	APIBase string `json:"api_base"`
+	Locale  string `json:"locale"` // Default console language when the browser's is unavailable
 }
 
 // WebSocketConfig contains WebSocket-specific configuration
@@ -76,6 +130,9 @@ type WebSocketConfig struct {
 	ReadBufferSize      int           `json:"read_buffer_size"`
 	WriteBufferSize     int           `json:"write_buffer_size"`
 	ClientWorldBuffer int           `json:"client_world_buffer"`
+	AssetChunkSize      int           `json:"asset_chunk_size"`
+	MaxAssetStreams     int           `json:"max_asset_streams"`
+	AllowedOrigins      []string      `json:"allowed_origins"` // Origins allowed to open /ws besides the server's own
 }
 
 // SessionConfig contains session management configuration
@@ -84,6 +141,9 @@ type SessionConfig struct {
 	InactivityTimeout   time.Duration `json:"inactivity_timeout"`
 	HTTPClientTimeout   time.Duration `json:"http_client_timeout"`
 	DefaultSessionID    string        `json:"default_session_id"`
+	TokenTTL            time.Duration `json:"token_ttl"` // Lifetime of WebSocket session tokens, rotated while connected
+	StaleAfter          time.Duration `json:"stale_after"`      // Without a heartbeat this long a client is stale
+	DeactivateAfter     time.Duration `json:"deactivate_after"` // Without a heartbeat this long a client is disconnected, 0 never
 }
 
 // WorldsConfig contains world system configuration
@@ -93,18 +153,26 @@ type WorldsConfig struct {
 	ProtectedList    []string `json:"protected_list"`
 	AutoJoinOnCreate bool     `json:"auto_join_on_create"`
 	SyncOnJoin       bool     `json:"sync_on_join"`
+	Preload          []string `json:"preload"` // Worlds loaded and warmed at startup
 }
 
 // AvatarsConfig contains avatar system configuration
 type AvatarsConfig struct {
-	ConfigFile              string        `json:"config_file"`
-	MaxConcurrentCreations  int           `json:"max_concurrent_creations"`
-	HealthCheckInterval     time.Duration `json:"health_check_interval"`
-	PositionUpdateThrottle  time.Duration `json:"position_update_throttle"`
-	MaxReconnectAttempts    int           `json:"max_reconnect_attempts"`
-	ReconnectDelay          time.Duration `json:"reconnect_delay"`
-	MaxReconnectDelay       time.Duration `json:"max_reconnect_delay"`
-	HeartbeatFrequency      time.Duration `json:"heartbeat_frequency"`
+	ConfigFile             string                   `json:"config_file"`
+	MaxConcurrentCreations int                      `json:"max_concurrent_creations"`
+	HealthCheckInterval    time.Duration            `json:"health_check_interval"`
+	PositionUpdateThrottle time.Duration            `json:"position_update_throttle"`
+	MaxReconnectAttempts   int                      `json:"max_reconnect_attempts"`
+	ReconnectDelay         time.Duration            `json:"reconnect_delay"`
+	MaxReconnectDelay      time.Duration            `json:"max_reconnect_delay"`
+	HeartbeatFrequency     time.Duration            `json:"heartbeat_frequency"`
+	IdleTimeout            time.Duration            `json:"idle_timeout"`        // Evict avatars of departed sessions unseen this long; 0 keeps them
+	WorldIdleTimeouts      map[string]time.Duration `json:"world_idle_timeouts"` // Per-world overrides of IdleTimeout
+	MaxSpeed               float64                  `json:"max_speed"`           // Metres per second an avatar may move, 0 for no limit
+	MaxStep                float64                  `json:"max_step"`            // Metres a single move may cover, however long since the last
+	MoveTolerance          float64                  `json:"move_tolerance"`      // Factor on MaxSpeed and MaxStep for network jitter
+	WorldMoveTolerances    map[string]float64       `json:"world_move_tolerances"` // Per-world overrides of MoveTolerance, 0 to not check
+	MoveAction             string                   `json:"move_action"`         // clamp or reject impossible moves
 }
 
 // SyncConfig contains HD1-VSC synchronization protocol configuration
@@ -112,7 +180,7 @@ type SyncConfig struct {
 	Protocol                string        `json:"protocol"`                 // HD1-VSC protocol version
 	SyncInterval            time.Duration `json:"sync_interval"`            // Sync broadcast interval
 	MaxDeltaLog            int           `json:"max_delta_log"`            // Maximum delta operations to keep
-	ChecksumAlgorithm      string        `json:"checksum_algorithm"`       // Checksum algorithm (sha256, md5)
+	ChecksumAlgorithm      string        `json:"checksum_algorithm"`       // World checksum algorithm (sha256, fnv1a), or hmac-sha256 to also sign deltas
 	CausalityTimeout       time.Duration `json:"causality_timeout"`        // Timeout for out-of-order operations
 	DeltaQueueSize         int           `json:"delta_queue_size"`         // Size of delta operation queue
 	AvatarRegistrySize     int           `json:"avatar_registry_size"`     // Initial avatar registry capacity
@@ -120,6 +188,316 @@ type SyncConfig struct {
 	WorldStateCompressionEnabled bool    `json:"world_state_compression_enabled"` // Enable world state compression
 	PerformanceMetricsEnabled bool      `json:"performance_metrics_enabled"`     // Enable sync performance metrics
 	VectorClockPrecision   int           `json:"vector_clock_precision"`   // Vector clock precision bits
+	ConsistencyInterval    time.Duration `json:"consistency_interval"`     // Checksum challenge interval, 0 disables
+	TransactionTimeout     time.Duration `json:"transaction_timeout"`      // Open transactions roll back after this
+	TransactionMaxOperations int         `json:"transaction_max_operations"` // Operations one transaction may queue
+	ReplayWindow           int           `json:"replay_window"`            // Nonces a session may sign out of order
+}
+
+// StorageConfig contains object storage configuration for assets, recordings and world exports
+type StorageConfig struct {
+	Backend      string        `json:"backend"`        // filesystem, s3 or gcs
+	Dir          string        `json:"dir"`            // Root directory for the filesystem backend
+	Bucket       string        `json:"bucket"`         // Bucket for s3/gcs backends
+	Region       string        `json:"region"`         // Bucket region (s3), "auto" for gcs
+	Endpoint     string        `json:"endpoint"`       // S3-compatible endpoint URL, empty for AWS
+	Prefix       string        `json:"prefix"`         // Key prefix shared by all objects
+	PathStyle    bool          `json:"path_style"`     // Use path-style bucket addressing
+	AccessKey    string        `json:"access_key"`     // Access key / HMAC key ID
+	SecretKey    string        `json:"-"`              // Secret key, never serialized
+	SigningKey   string        `json:"-"`              // HMAC key for filesystem signed URLs
+	SignedURLTTL time.Duration `json:"signed_url_ttl"` // Default signed URL lifetime
+
+	// At-rest encryption
+	EncryptionProvider   string   `json:"encryption_provider"`   // "", static or a registered KMS plugin
+	EncryptionKeys       string   `json:"-"`                     // static provider keys, "id:base64[,id:base64]"
+	EncryptionNamespaces []string `json:"encryption_namespaces"` // Namespaces encrypted on write
+	EncryptionMigrate    bool     `json:"encryption_migrate"`    // Read plaintext in encrypted namespaces, re-encrypting it
+}
+
+// AssetsConfig contains content-addressable asset store configuration
+type AssetsConfig struct {
+	MaxUploadSize int64         `json:"max_upload_size"` // Maximum upload size in bytes
+	GCInterval    time.Duration `json:"gc_interval"`     // Garbage collection interval, 0 disables the job
+	GCGracePeriod time.Duration `json:"gc_grace_period"` // Minimum age before an unreferenced blob is reclaimed
+	
+	// Optimization pipeline for uploaded GLB files
+	PipelineEnabled bool          `json:"pipeline_enabled"` // Global switch, organizations opt in via settings
+	PipelineWorkers int           `json:"pipeline_workers"` // Concurrent optimization jobs
+	PipelineTool    string        `json:"pipeline_tool"`    // gltf-transform executable
+	PipelineTimeout time.Duration `json:"pipeline_timeout"` // Per-step timeout
+	
+	// Octree tiling of uploaded LAS and PLY point clouds
+	PointCloudWorkers    int `json:"pointcloud_workers"`     // Concurrent tiling jobs
+	PointCloudNodePoints int `json:"pointcloud_node_points"` // Points per octree tile
+	PointCloudMaxPoints  int `json:"pointcloud_max_points"`  // Larger clouds are refused
+	
+	// Malware scanning of uploads, flagged ones are quarantined
+	ScanBackend string        `json:"scan_backend"` // none, clamd, http or a registered scanner
+	ScanAddress string        `json:"scan_address"` // clamd socket or host:port, or the HTTP scanner's URL
+	ScanTimeout time.Duration `json:"scan_timeout"` // Per-upload scan timeout
+}
+
+// ClientsConfig contains the capability tiers negotiated with clients.
+// Update rates are avatar movement updates per second; texture sizes cap
+// the resolution of delivered assets.
+type ClientsConfig struct {
+	HighUpdateRate      int `json:"high_update_rate"`      // WebGL2 desktop
+	StandardUpdateRate  int `json:"standard_update_rate"`  // WebGL2 mobile, WebGL1 desktop
+	LowUpdateRate       int `json:"low_update_rate"`       // WebGL1 mobile, no WebGL
+	HighTextureSize     int `json:"high_texture_size"`
+	StandardTextureSize int `json:"standard_texture_size"`
+	LowTextureSize      int `json:"low_texture_size"`
+}
+
+// XRConfig contains the VR/XR pose channel configuration
+type XRConfig struct {
+	PoseRate         int           `json:"pose_rate"`         // Pose relays per second to each client
+	KeyframeInterval time.Duration `json:"keyframe_interval"` // Full pose resend interval, repairs dropped deltas
+}
+
+// AccessibilityConfig contains the caption relay configuration
+type AccessibilityConfig struct {
+	CaptionMaxLength int `json:"caption_max_length"` // Characters per caption message
+	CaptionRate      int `json:"caption_rate"`       // Interim captions relayed per second per speaker
+}
+
+// EntitiesConfig contains entity ID issuance and creation budget configuration
+type EntitiesConfig struct {
+	AllowClientIDs bool          `json:"allow_client_ids"` // Accept client-suggested entity IDs
+	IDConflict     string        `json:"id_conflict"`      // reject or reissue when a suggested ID is taken
+	CreateRate     int           `json:"create_rate"`      // Entities a session may create per minute, 0 for no limit
+	MaxPerSession  int           `json:"max_per_session"`  // Live entities per session, 0 for no limit
+	MaxTriangles   int           `json:"max_triangles"`    // Estimated triangles per session, 0 for no limit
+	Penalty        time.Duration `json:"penalty"`          // Block after a repeated violation, doubling per strike
+	PenaltyMax     time.Duration `json:"penalty_max"`      // Longest block; strikes are forgiven after this long
+}
+
+// CompressionConfig contains response compression configuration
+type CompressionConfig struct {
+	Enabled bool     `json:"enabled"`
+	MinSize int      `json:"min_size"` // Smaller responses are sent as is
+	Types   []string `json:"types"`    // Compressible media types, or type/* families
+}
+
+// FeaturesConfig contains the feature flag sources
+type FeaturesConfig struct {
+	File    string        `json:"file"`    // Static flag definitions with organization and world overrides
+	Enabled []string      `json:"enabled"` // Flags switched on (name) or off (-name) for everyone
+	URL     string        `json:"url"`     // Remote provider polled for flag definitions
+	Token   string        `json:"-"`       // Bearer token for the remote provider
+	Refresh time.Duration `json:"refresh"` // Remote provider poll interval
+}
+
+// ModerationConfig contains moderation API access
+type ModerationConfig struct {
+	Token      string `json:"-"`           // Bearer token for remote moderators; local callers need none
+	PolicyFile string `json:"policy_file"` // Per-organization content screening policies
+	APIToken   string `json:"-"`           // Bearer token sent to external moderation APIs
+}
+
+// EnvironmentConfig contains the time of day and weather cycles
+type EnvironmentConfig struct {
+	Tick                  time.Duration            `json:"tick"`                    // How often the environment advances and syncs
+	DayLength             time.Duration            `json:"day_length"`              // Real time per in-world day, 0 stops the clock
+	WorldDayLengths       map[string]time.Duration `json:"world_day_lengths"`       // Per-world overrides of DayLength
+	WeatherInterval       time.Duration            `json:"weather_interval"`        // Average time between weather changes, 0 keeps the weather
+	WorldWeatherIntervals map[string]time.Duration `json:"world_weather_intervals"` // Per-world overrides of WeatherInterval
+	Weathers              []string                 `json:"weathers"`                // Weather states the cycle may pick
+}
+
+// MediaConfig contains the video and live-stream entity settings
+type MediaConfig struct {
+	AllowedHosts []string `json:"allowed_hosts"` // Hosts streams may be played from, any when empty
+}
+
+// BookingsConfig contains the scheduled session settings
+type BookingsConfig struct {
+	WebhookURL    string        `json:"webhook_url"`   // Receives reminders before booked sessions, none when empty
+	WebhookSecret string        `json:"-"`             // Signs reminder bodies (X-HD1-Signature) when set
+	Tick          time.Duration `json:"tick"`          // How often due reminders are sent
+	MaxPerWorld   int           `json:"max_per_world"` // Bookings a world may hold
+}
+
+// GuestsConfig contains the guest link settings
+type GuestsConfig struct {
+	RequireLink     bool          `json:"require_link"`     // Remote sessions must join through a guest link
+	DefaultLifetime time.Duration `json:"default_lifetime"` // Lifetime of links created without one
+}
+
+// EmailConfig contains the outbound email settings; organizations override
+// them in the organization file
+type EmailConfig struct {
+	SMTPHost         string   `json:"smtp_host"` // No email when empty
+	SMTPPort         int      `json:"smtp_port"`
+	Username         string   `json:"username"`
+	Password         string   `json:"-"`
+	TLS              string   `json:"tls"` // starttls, tls (implicit) or none
+	From             string   `json:"from"`
+	RatePerHour      int      `json:"rate_per_hour"`     // Messages an organization may send, unlimited when 0
+	OrgFile          string   `json:"org_file"`          // Per-organization settings
+	TemplatesDir     string   `json:"templates_dir"`     // Templates overriding the embedded ones
+	SecurityContacts []string `json:"security_contacts"` // Receive security alerts
+}
+
+// ConnectorsConfig contains the settings of the Slack and Teams connectors;
+// organizations configure their webhooks in the connectors file
+type ConnectorsConfig struct {
+	File     string        `json:"file"`     // Per-organization connectors
+	Capacity int           `json:"capacity"` // Sessions of an organization reaching capacity, none when 0
+	Timeout  time.Duration `json:"timeout"`  // Per webhook call
+	Cooldown time.Duration `json:"cooldown"` // Repeats of an event a connector drops
+}
+
+// BindingsConfig contains the settings of entity property bindings
+type BindingsConfig struct {
+	Tick time.Duration `json:"tick"` // How often bindings are evaluated, 0 disables
+}
+
+type ImportsConfig struct {
+	Tool        string        `json:"tool"`         // assimp executable converting CAD formats to OBJ
+	Workers     int           `json:"workers"`      // Concurrent import jobs
+	Timeout     time.Duration `json:"timeout"`      // Per-job conversion timeout
+	MaxEntities int           `json:"max_entities"` // Entities one import may create
+}
+
+// GeoConfig contains the map and elevation tile providers ground tiles are
+// loaded from
+type GeoConfig struct {
+	ImageryURL        string        `json:"imagery_url"`        // Tile URL template with {z}, {x} and {y}, empty for none
+	ElevationURL      string        `json:"elevation_url"`      // Elevation tile URL template, empty for flat ground
+	ElevationEncoding string        `json:"elevation_encoding"` // terrarium or mapbox
+	Attribution       string        `json:"attribution"`        // Credit the providers require
+	MaxTiles          int           `json:"max_tiles"`          // Tiles one request may load
+	Timeout           time.Duration `json:"timeout"`            // Per-tile fetch timeout
+}
+
+// SimulationConfig contains the rates of the server's tick loop
+type SimulationConfig struct {
+	Tick     time.Duration `json:"tick"`      // Loop period while clients are connected
+	IdleTick time.Duration `json:"idle_tick"` // Loop period with no clients connected
+}
+
+// BudgetsConfig contains the per-world resource budgets
+type BudgetsConfig struct {
+	MaxEntities      int              `json:"max_entities"`       // Live entities a world may hold, 0 for no limit
+	WorldMaxEntities map[string]int   `json:"world_max_entities"` // Per-world overrides of MaxEntities
+	MaxMemory        int64            `json:"max_memory"`         // Estimated bytes of a world's state, 0 for no limit
+	WorldMaxMemory   map[string]int64 `json:"world_max_memory"`   // Per-world overrides of MaxMemory
+}
+
+// HibernationConfig contains the idle world unloading settings
+type HibernationConfig struct {
+	Idle time.Duration `json:"idle"` // Time without clients before a world is unloaded, 0 keeps it loaded
+}
+
+// WebhooksConfig contains the inbound webhook settings; the webhooks file
+// maps each webhook's deliveries to changes to a world
+type WebhooksConfig struct {
+	File string `json:"file"` // Webhook mappings (YAML)
+}
+
+// FormsConfig contains the form entity settings; the forms file names the
+// endpoints submissions are forwarded to
+type FormsConfig struct {
+	File    string        `json:"file"`    // Submission targets (YAML)
+	Timeout time.Duration `json:"timeout"` // Per forwarded submission
+}
+
+// PortalsConfig contains the portal settings; the portals file names the
+// servers of the worlds portals lead to
+type PortalsConfig struct {
+	File    string        `json:"file"`    // Destination servers (YAML)
+	Timeout time.Duration `json:"timeout"` // Per arrival handoff
+}
+
+// ConsentConfig contains the consent settings; the consent file lists the
+// terms and policies people accept, and which must be accepted to join
+type ConsentConfig struct {
+	File string `json:"file"` // Consent documents (YAML)
+}
+
+// ImpersonationConfig contains the support impersonation settings; support
+// staff act as a session for at most MaxDuration at a time
+type ImpersonationConfig struct {
+	MaxDuration time.Duration `json:"max_duration"`
+}
+
+// APIUsageConfig contains the API usage analytics settings; calls are
+// counted per organization and key, for up to MaxKeys keys
+type APIUsageConfig struct {
+	MaxKeys int `json:"max_keys"`
+}
+
+// TelemetryConfig contains the frame telemetry settings; consoles report
+// how they render every Interval, and frames under TargetFPS count as
+// over budget
+type TelemetryConfig struct {
+	Interval  time.Duration `json:"interval"` // 0 = consoles report nothing
+	TargetFPS int           `json:"target_fps"`
+}
+
+// QualityConfig contains the adaptive quality settings; consoles whose
+// telemetry shows them under the target frame rate are told to render
+// less, down to culling entities beyond CullDistance
+type QualityConfig struct {
+	Adaptive     bool    `json:"adaptive"`
+	CullDistance float64 `json:"cull_distance"` // Metres
+}
+
+// CrowdConfig contains the crowd settings; with Threshold avatars or more
+// in the world, avatars beyond NearDistance of a client's own move at
+// FarUpdateRate and consoles able to draw them instanced do
+type CrowdConfig struct {
+	Threshold     int     `json:"threshold"`       // 0 = never a crowd
+	NearDistance  float64 `json:"near_distance"`   // Metres
+	FarUpdateRate int     `json:"far_update_rate"` // Moves a second
+}
+
+// SpectatorsConfig contains the spectator settings; spectators join the
+// served world without an avatar and watch it read-only
+type SpectatorsConfig struct {
+	Enabled bool `json:"enabled"`
+	Max     int  `json:"max"` // Connected at once, 0 = unlimited
+}
+
+// BroadcastConfig contains the broadcast settings; a render client streams
+// a camera's view of the world to the server, which encodes it with FFmpeg
+// for each RTMP or WHIP endpoint
+type BroadcastConfig struct {
+	Max           int    `json:"max"`            // Broadcasts at once, 0 = none
+	FFmpeg        string `json:"ffmpeg"`         // FFmpeg executable
+	RenderCommand string `json:"render_command"` // Launches a render client at {url}, empty to open it by hand
+	Width         int    `json:"width"`          // Pixels
+	Height        int    `json:"height"`         // Pixels
+	FrameRate     int    `json:"frame_rate"`     // Frames a second
+	Bitrate       int    `json:"bitrate"`        // Video kilobits a second
+}
+
+// QuotasConfig contains the request quota settings; the plans file defines
+// each plan's burst and sustained rates
+type QuotasConfig struct {
+	File string `json:"file"` // Plans (YAML)
+}
+
+// ChunksConfig contains the world streaming settings; with a size, clients
+// load only the chunks of the world around their avatar
+type ChunksConfig struct {
+	Size   float64 `json:"size"`   // Metres along each chunk edge, 0 = whole world
+	Radius int     `json:"radius"` // Chunks loaded around the avatar's chunk
+}
+
+// ComponentsConfig contains the entity component settings; the components
+// directory holds the schemas of components plugins add
+type ComponentsConfig struct {
+	Dir    string `json:"dir"`    // Plugin component schemas (YAML or JSON)
+	Strict bool   `json:"strict"` // Refuse components without a schema
+}
+
+// HooksConfig contains the lifecycle hook settings; the hooks file lists
+// the commands run at each point of the server's lifecycle
+type HooksConfig struct {
+	File string `json:"file"` // Commands by lifecycle point (YAML)
 }
 
 // Global configuration instance - Single Source of Truth
@@ -146,8 +524,18 @@ func Initialize() error {
 	// Load defaults first
 	config.loadDefaults()
 	
-	// Load .env file if it exists
-	config.loadEnvFile()
+	// Read .env file if it exists; containers are configured from the
+	// environment alone
+	var dotEnv map[string]string
+	if !config.Server.Container {
+		dotEnv, _ = readEnvFile(".env")
+	}
+	
+	// Profiles layer over the defaults and .env, beneath the environment
+	if err := config.loadProfiles(dotEnv); err != nil {
+		return fmt.Errorf("configuration validation failed: %v", err)
+	}
+	applyEnv(dotEnv)
 	
 	// Override with environment variables
 	config.loadEnvironmentVariables()
@@ -170,8 +558,13 @@ func (c *HD1Config) loadDefaults() {
 	// Server defaults
 	c.Server.Host = "0.0.0.0"
 	c.Server.Port = "8080"
+	c.Server.SocketMode = "0660"
+	c.Server.StaticSource = "auto"
+	c.Server.ShutdownTimeout = 30 * time.Second
+	c.Server.Container = runningInContainer()
 	c.Server.APIBase = "http://0.0.0.0:8080/api"
 	c.Server.InternalAPIBase = "http://localhost:8080/api"
+	c.Client.Locale = "en"
 	c.Server.Version = DefaultVersion
 	
 	// Path defaults - configurable root directory
@@ -202,11 +595,16 @@ func (c *HD1Config) loadDefaults() {
 	c.WebSocket.ReadBufferSize = 1048576  // 1MB read buffer
 	c.WebSocket.WriteBufferSize = 1048576 // 1MB write buffer
 	c.WebSocket.ClientWorldBuffer = 256
+	c.WebSocket.AssetChunkSize = 262144 // 256KB raw per asset_stream_chunk
+	c.WebSocket.MaxAssetStreams = 4
 	
 	// Session defaults (based on current hardcoded values)
 	c.Session.CleanupInterval = 2 * time.Minute
 	c.Session.InactivityTimeout = 10 * time.Minute
 	c.Session.HTTPClientTimeout = 5 * time.Second
+	c.Session.TokenTTL = 15 * time.Minute
+	c.Session.StaleAfter = 30 * time.Second
+	c.Session.DeactivateAfter = 2 * time.Minute
 	c.Session.DefaultSessionID = create_unique_session_identifier()
 	
 	// Worlds defaults
@@ -225,6 +623,13 @@ func (c *HD1Config) loadDefaults() {
 	c.Avatars.ReconnectDelay = 1 * time.Second
 	c.Avatars.MaxReconnectDelay = 30 * time.Second
 	c.Avatars.HeartbeatFrequency = 5 * time.Second
+	c.Avatars.IdleTimeout = 5 * time.Minute
+	c.Avatars.WorldIdleTimeouts = map[string]time.Duration{}
+	c.Avatars.MaxSpeed = 12 // Sprinting console avatars move at 10
+	c.Avatars.MaxStep = 20
+	c.Avatars.MoveTolerance = 1.25
+	c.Avatars.WorldMoveTolerances = map[string]float64{}
+	c.Avatars.MoveAction = "clamp"
 	
 	// Sync protocol defaults (eliminating hardcoded values)
 	c.Sync.Protocol = "HD1-VSC-v1.0"
@@ -238,47 +643,196 @@ func (c *HD1Config) loadDefaults() {
 	c.Sync.WorldStateCompressionEnabled = true   // Enable compression for performance
 	c.Sync.PerformanceMetricsEnabled = false     // Disable metrics by default
 	c.Sync.VectorClockPrecision = 64             // 64-bit vector clock precision
-}
-
-// loadEnvFile reads configuration from .env file if it exists
-func (c *HD1Config) loadEnvFile() {
-	envFile := ".env"
-	if _, err := os.Stat(envFile); os.IsNotExist(err) {
-		return // .env file doesn't exist, skip
-	}
+	c.Sync.ConsistencyInterval = 1 * time.Minute // Compare client world checksums
+	c.Sync.TransactionTimeout = 5 * time.Minute  // Abandoned transactions roll back
+	c.Sync.TransactionMaxOperations = 500        // Operations per transaction
+	c.Sync.ReplayWindow = 64                     // Signed deltas racing each other
 	
-	file, err := os.Open(envFile)
-	if err != nil {
-		return // Can't open .env file, skip
-	}
-	defer file.Close()
+	// Storage defaults - local filesystem until an object store is configured
+	c.Storage.Backend = "filesystem"
+	c.Storage.Dir = filepath.Join(rootDir, "storage")
+	c.Storage.Region = "us-east-1"
+	c.Storage.SignedURLTTL = 15 * time.Minute
+	c.Storage.EncryptionNamespaces = []string{"assets", "recordings", "exports"}
 	
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		
-		// Skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		
-		// Parse KEY=VALUE format
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 {
-			continue
-		}
-		
-		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
-		
-		// Remove quotes if present
-		value = strings.Trim(value, "\"'")
-		
-		// Set environment variable (only if not already set)
-		if os.Getenv(key) == "" {
-			os.Setenv(key, value)
-		}
+	// Asset store defaults
+	c.Assets.MaxUploadSize = 100 * 1024 * 1024 // 100MB
+	c.Assets.GCInterval = 1 * time.Hour
+	c.Assets.GCGracePeriod = 24 * time.Hour
+	c.Assets.PipelineEnabled = false
+	c.Assets.PipelineWorkers = 2
+	c.Assets.PipelineTool = "gltf-transform"
+	c.Assets.PipelineTimeout = 5 * time.Minute
+	c.Assets.PointCloudWorkers = 1
+	c.Assets.PointCloudNodePoints = 20000
+	c.Assets.PointCloudMaxPoints = 20000000
+	c.Assets.ScanBackend = "none"
+	c.Assets.ScanTimeout = 30 * time.Second
+	
+	// Client capability tier defaults
+	c.Clients.HighUpdateRate = 60
+	c.Clients.StandardUpdateRate = 30
+	c.Clients.LowUpdateRate = 10
+	c.Clients.HighTextureSize = 4096
+	c.Clients.StandardTextureSize = 2048
+	c.Clients.LowTextureSize = 1024
+	
+	// XR pose channel defaults
+	c.XR.PoseRate = 45
+	c.XR.KeyframeInterval = 1 * time.Second
+	
+	// Accessibility defaults
+	c.Accessibility.CaptionMaxLength = 500
+	c.Accessibility.CaptionRate = 5
+	
+	// Entity ID issuance defaults
+	c.Entities.AllowClientIDs = true
+	c.Entities.IDConflict = "reject"
+	
+	// Entity creation budgets: generous for builders, tight enough to stop a flood
+	c.Entities.CreateRate = 120
+	c.Entities.MaxPerSession = 2000
+	c.Entities.MaxTriangles = 2000000
+	c.Entities.Penalty = 10 * time.Second
+	c.Entities.PenaltyMax = 10 * time.Minute
+	
+	// Compression defaults: text formats only, binary assets are compressed already
+	c.Compression.Enabled = true
+	c.Compression.MinSize = 1024
+	c.Compression.Types = []string{
+		"text/*",
+		"application/json",
+		"application/javascript",
+		"application/yaml",
+		"image/svg+xml",
+		"model/gltf+json",
 	}
+	
+	// Feature flag defaults: file in the share directory, no remote provider
+	c.Features.File = filepath.Join(c.Paths.ShareDir, "features.json")
+	c.Features.Refresh = 30 * time.Second
+	
+	// Content policies live next to the feature flags
+	c.Moderation.PolicyFile = filepath.Join(c.Paths.ShareDir, "content-policy.json")
+	
+	// Environment defaults: worlds stand still until given a cycle
+	c.Environment.Tick = 30 * time.Second
+	c.Environment.WorldDayLengths = map[string]time.Duration{}
+	c.Environment.WorldWeatherIntervals = map[string]time.Duration{}
+	c.Environment.Weathers = []string{"clear", "cloudy", "fog", "rain", "storm", "snow"}
+	
+	// Media defaults: streams from any host
+	c.Media.AllowedHosts = []string{}
+	
+	// Bookings defaults: no reminder webhook
+	c.Bookings.Tick = 30 * time.Second
+	c.Bookings.MaxPerWorld = 500
+	
+	// Guests defaults: links optional, valid for a day
+	c.Guests.DefaultLifetime = 24 * time.Hour
+	
+	// Email defaults: no SMTP server, so no email
+	c.Email.SMTPPort = 587
+	c.Email.TLS = "starttls"
+	c.Email.From = "HD1 <hd1@localhost>"
+	c.Email.RatePerHour = 100
+	c.Email.OrgFile = filepath.Join(c.Paths.ShareDir, "email.json")
+	c.Email.SecurityContacts = []string{}
+	
+	// Connectors defaults: no capacity alerts, repeats dropped for a minute
+	c.Connectors.File = filepath.Join(c.Paths.ShareDir, "connectors.json")
+	c.Connectors.Timeout = 10 * time.Second
+	c.Connectors.Cooldown = time.Minute
+	
+	// Bindings defaults: evaluated ten times a second
+	c.Bindings.Tick = 100 * time.Millisecond
+	
+	// Imports defaults: one job at a time through assimp
+	c.Imports.Tool = "assimp"
+	c.Imports.Workers = 1
+	c.Imports.Timeout = 10 * time.Minute
+	c.Imports.MaxEntities = 2000
+	
+	// Geo defaults: OpenStreetMap imagery over AWS Terrain Tiles
+	c.Geo.ImageryURL = "https://tile.openstreetmap.org/{z}/{x}/{y}.png"
+	c.Geo.ElevationURL = "https://s3.amazonaws.com/elevation-tiles-prod/terrarium/{z}/{x}/{y}.png"
+	c.Geo.ElevationEncoding = "terrarium"
+	c.Geo.Attribution = "© OpenStreetMap contributors; elevation: Mapzen Terrain Tiles"
+	c.Geo.MaxTiles = 64
+	c.Geo.Timeout = 15 * time.Second
+	
+	// Simulation defaults: 20 ticks a second, once a second when empty
+	c.Simulation.Tick = 50 * time.Millisecond
+	c.Simulation.IdleTick = time.Second
+	
+	// Budget defaults: room for large scenes, short of exhausting the server
+	c.Budgets.MaxEntities = 20000
+	c.Budgets.WorldMaxEntities = map[string]int{}
+	c.Budgets.MaxMemory = 256 * 1024 * 1024 // 256MB
+	c.Budgets.WorldMaxMemory = map[string]int64{}
+	
+	// Hibernation defaults: unload worlds left empty for a quarter hour
+	c.Hibernation.Idle = 15 * time.Minute
+	
+	// Webhooks defaults: mappings kept with the other share files
+	c.Webhooks.File = filepath.Join(c.Paths.ShareDir, "webhooks.yaml")
+	
+	// Forms defaults: targets kept with the other share files
+	c.Forms.File = filepath.Join(c.Paths.ShareDir, "forms.yaml")
+	c.Forms.Timeout = 10 * time.Second
+	
+	// Portals defaults: destinations kept with the other share files
+	c.Portals.File = filepath.Join(c.Paths.ShareDir, "portals.yaml")
+	c.Portals.Timeout = 5 * time.Second
+	
+	// Consent defaults: no documents until the consent file lists some
+	c.Consent.File = filepath.Join(c.Paths.ShareDir, "consent.yaml")
+	
+	// Impersonation defaults: long enough to reproduce an issue
+	c.Impersonation.MaxDuration = 30 * time.Minute
+	
+	// API usage defaults: bounded, since keys are whatever callers send
+	c.APIUsage.MaxKeys = 10000
+	
+	// Telemetry defaults: a sample every half minute is cheap for consoles
+	c.Telemetry.Interval = 30 * time.Second
+	c.Telemetry.TargetFPS = 30
+	
+	// Quality defaults: weak machines degrade rather than stall the session
+	c.Quality.Adaptive = true
+	c.Quality.CullDistance = 60
+	
+	// Crowd defaults: a busy meeting is not yet a crowd, an event is
+	c.Crowd.Threshold = 50
+	c.Crowd.NearDistance = 15
+	c.Crowd.FarUpdateRate = 2
+	
+	// Spectators defaults: open, and bounded so a streamed event cannot
+	// exhaust the server
+	c.Spectators.Enabled = true
+	c.Spectators.Max = 1000
+	
+	// Broadcast defaults: 720p30 at a bitrate streaming services take
+	c.Broadcast.Max = 2
+	c.Broadcast.FFmpeg = "ffmpeg"
+	c.Broadcast.Width = 1280
+	c.Broadcast.Height = 720
+	c.Broadcast.FrameRate = 30
+	c.Broadcast.Bitrate = 4500
+	
+	// Quotas defaults: the built-in plans until the plans file defines some
+	c.Quotas.File = filepath.Join(c.Paths.ShareDir, "plans.yaml")
+	
+	// Chunks defaults: whole worlds, streaming is opt-in
+	c.Chunks.Size = 0
+	c.Chunks.Radius = 2
+	
+	// Components defaults: plugin schemas kept with the other share files
+	c.Components.Dir = filepath.Join(c.Paths.ShareDir, "components")
+	c.Components.Strict = false
+	
+	// Hooks defaults: commands kept with the other share files
+	c.Hooks.File = filepath.Join(c.Paths.ShareDir, "hooks.yaml")
 }
 
 // loadEnvironmentVariables reads configuration from environment
@@ -290,6 +844,30 @@ func (c *HD1Config) loadEnvironmentVariables() {
 	if port := os.Getenv("HD1_PORT"); port != "" {
 		c.Server.Port = port
 	}
+	if listen := os.Getenv("HD1_LISTEN"); listen != "" {
+		c.Server.Listen = strings.Split(listen, ",")
+	}
+	if socketMode := os.Getenv("HD1_SOCKET_MODE"); socketMode != "" {
+		c.Server.SocketMode = socketMode
+	}
+	if socketOperators := os.Getenv("HD1_SOCKET_OPERATORS"); socketOperators == "true" || socketOperators == "1" {
+		c.Server.SocketOperators = true
+	}
+	if staticSource := os.Getenv("HD1_STATIC_SOURCE"); staticSource != "" {
+		c.Server.StaticSource = staticSource
+	}
+	if devMode := os.Getenv("HD1_STATIC_DEV_MODE"); devMode == "true" || devMode == "1" {
+		c.Server.StaticDevMode = true
+	}
+	if tlsCert := os.Getenv("HD1_TLS_CERT"); tlsCert != "" {
+		c.Server.TLSCert = tlsCert
+	}
+	if tlsKey := os.Getenv("HD1_TLS_KEY"); tlsKey != "" {
+		c.Server.TLSKey = tlsKey
+	}
+	if trustedProxies := os.Getenv("HD1_TRUSTED_PROXIES"); trustedProxies != "" {
+		c.Server.TrustedProxies = strings.Split(trustedProxies, ",")
+	}
 	if apiBase := os.Getenv("HD1_API_BASE"); apiBase != "" {
 		c.Server.APIBase = apiBase
 		c.Client.APIBase = apiBase
@@ -303,6 +881,11 @@ func (c *HD1Config) loadEnvironmentVariables() {
 	if daemon := os.Getenv("HD1_DAEMON"); daemon == "true" || daemon == "1" {
 		c.Server.Daemon = true
 	}
+	if shutdownTimeout := os.Getenv("HD1_SHUTDOWN_TIMEOUT"); shutdownTimeout != "" {
+		if timeout, err := time.ParseDuration(shutdownTimeout); err == nil {
+			c.Server.ShutdownTimeout = timeout
+		}
+	}
 	
 	// Path configuration
 	if rootDir := os.Getenv("HD1_ROOT_DIR"); rootDir != "" {
@@ -330,6 +913,15 @@ func (c *HD1Config) loadEnvironmentVariables() {
 	if recordingsDir := os.Getenv("HD1_RECORDINGS_DIR"); recordingsDir != "" {
 		c.Paths.RecordingsDir = recordingsDir
 	}
+	if templatesDir := os.Getenv("HD1_TEMPLATES_DIR"); templatesDir != "" {
+		c.Paths.TemplatesDir = templatesDir
+	}
+	if localesDir := os.Getenv("HD1_LOCALES_DIR"); localesDir != "" {
+		c.Paths.LocalesDir = localesDir
+	}
+	if locale := os.Getenv("HD1_CLIENT_LOCALE"); locale != "" {
+		c.Client.Locale = locale
+	}
 	
 	// Logging configuration
 	if level := os.Getenv("HD1_LOG_LEVEL"); level != "" {
@@ -338,6 +930,9 @@ func (c *HD1Config) loadEnvironmentVariables() {
 	if modules := os.Getenv("HD1_TRACE_MODULES"); modules != "" {
 		c.Logging.TraceModules = strings.Split(modules, ",")
 	}
+	if format := os.Getenv("HD1_LOG_FORMAT"); format != "" {
+		c.Logging.Format = format
+	}
 	if logFile := os.Getenv("HD1_LOG_FILE"); logFile != "" {
 		c.Logging.LogFile = logFile
 	}
@@ -378,6 +973,19 @@ func (c *HD1Config) loadEnvironmentVariables() {
 			c.WebSocket.ClientWorldBuffer = size
 		}
 	}
+	if chunkSize := os.Getenv("HD1_WEBSOCKET_ASSET_CHUNK_SIZE"); chunkSize != "" {
+		if size, err := strconv.Atoi(chunkSize); err == nil {
+			c.WebSocket.AssetChunkSize = size
+		}
+	}
+	if maxStreams := os.Getenv("HD1_WEBSOCKET_MAX_ASSET_STREAMS"); maxStreams != "" {
+		if count, err := strconv.Atoi(maxStreams); err == nil {
+			c.WebSocket.MaxAssetStreams = count
+		}
+	}
+	if origins := os.Getenv("HD1_WEBSOCKET_ALLOWED_ORIGINS"); origins != "" {
+		c.WebSocket.AllowedOrigins = strings.Split(origins, ",")
+	}
 	
 	// Session configuration
 	if cleanupInterval := os.Getenv("HD1_SESSION_CLEANUP_INTERVAL"); cleanupInterval != "" {
@@ -395,6 +1003,21 @@ func (c *HD1Config) loadEnvironmentVariables() {
 			c.Session.HTTPClientTimeout = timeout
 		}
 	}
+	if tokenTTL := os.Getenv("HD1_SESSION_TOKEN_TTL"); tokenTTL != "" {
+		if ttl, err := time.ParseDuration(tokenTTL); err == nil {
+			c.Session.TokenTTL = ttl
+		}
+	}
+	if staleAfter := os.Getenv("HD1_SESSION_STALE_AFTER"); staleAfter != "" {
+		if after, err := time.ParseDuration(staleAfter); err == nil {
+			c.Session.StaleAfter = after
+		}
+	}
+	if deactivateAfter := os.Getenv("HD1_SESSION_DEACTIVATE_AFTER"); deactivateAfter != "" {
+		if after, err := time.ParseDuration(deactivateAfter); err == nil {
+			c.Session.DeactivateAfter = after
+		}
+	}
 	if defaultSessionID := os.Getenv("HD1_SESSION_DEFAULT_ID"); defaultSessionID != "" {
 		c.Session.DefaultSessionID = defaultSessionID
 	}
@@ -419,6 +1042,9 @@ func (c *HD1Config) loadEnvironmentVariables() {
 	if protectedList := os.Getenv("HD1_WORLDS_PROTECTED_LIST"); protectedList != "" {
 		c.Worlds.ProtectedList = strings.Split(protectedList, ",")
 	}
+	if preload := os.Getenv("HD1_WORLDS_PRELOAD"); preload != "" {
+		c.Worlds.Preload = strings.Split(preload, ",")
+	}
 	
 	// Avatars configuration
 	if configFile := os.Getenv("HD1_AVATARS_CONFIG_FILE"); configFile != "" {
@@ -459,6 +1085,39 @@ func (c *HD1Config) loadEnvironmentVariables() {
 			c.Avatars.HeartbeatFrequency = frequency
 		}
 	}
+	if idleTimeout := os.Getenv("HD1_AVATARS_IDLE_TIMEOUT"); idleTimeout != "" {
+		if timeout, err := time.ParseDuration(idleTimeout); err == nil {
+			c.Avatars.IdleTimeout = timeout
+		}
+	}
+	if worldTimeouts := os.Getenv("HD1_AVATARS_WORLD_IDLE_TIMEOUTS"); worldTimeouts != "" {
+		if timeouts, err := parseWorldDurations(worldTimeouts); err == nil {
+			c.Avatars.WorldIdleTimeouts = timeouts
+		}
+	}
+	if maxSpeed := os.Getenv("HD1_AVATARS_MAX_SPEED"); maxSpeed != "" {
+		if speed, err := strconv.ParseFloat(maxSpeed, 64); err == nil {
+			c.Avatars.MaxSpeed = speed
+		}
+	}
+	if maxStep := os.Getenv("HD1_AVATARS_MAX_STEP"); maxStep != "" {
+		if step, err := strconv.ParseFloat(maxStep, 64); err == nil {
+			c.Avatars.MaxStep = step
+		}
+	}
+	if moveTolerance := os.Getenv("HD1_AVATARS_MOVE_TOLERANCE"); moveTolerance != "" {
+		if tolerance, err := strconv.ParseFloat(moveTolerance, 64); err == nil {
+			c.Avatars.MoveTolerance = tolerance
+		}
+	}
+	if worldTolerances := os.Getenv("HD1_AVATARS_WORLD_MOVE_TOLERANCES"); worldTolerances != "" {
+		if tolerances, err := parseWorldFactors(worldTolerances); err == nil {
+			c.Avatars.WorldMoveTolerances = tolerances
+		}
+	}
+	if moveAction := os.Getenv("HD1_AVATARS_MOVE_ACTION"); moveAction != "" {
+		c.Avatars.MoveAction = moveAction
+	}
 	
 	// Sync protocol configuration
 	if protocol := os.Getenv("HD1_SYNC_PROTOCOL"); protocol != "" {
@@ -512,604 +1171,3260 @@ func (c *HD1Config) loadEnvironmentVariables() {
 			c.Sync.VectorClockPrecision = prec
 		}
 	}
-}
-
-// loadFlags reads configuration from command line flags
-func (c *HD1Config) loadFlags() {
-	// Only parse flags if not already parsed
-	if !flag.Parsed() {
-		// Define flags with current config values as defaults
-		// Long and short flag combinations for essential operations
-		host := flag.String("host", c.Server.Host, "Host to bind to")
-		hostShort := flag.String("h", c.Server.Host, "Host to bind to (short)")
-		port := flag.String("port", c.Server.Port, "Port to bind to") 
-		portShort := flag.String("p", c.Server.Port, "Port to bind to (short)")
-		apiBase := flag.String("api-base", c.Server.APIBase, "API base URL")
-		internalAPIBase := flag.String("internal-api-base", c.Server.InternalAPIBase, "Internal API base URL for server communications")
-		version := flag.String("version", c.Server.Version, "HD1 version identifier")
-		versionShort := flag.String("v", c.Server.Version, "HD1 version identifier (short)")
-		daemon := flag.Bool("daemon", c.Server.Daemon, "Run in daemon mode")
-		daemonShort := flag.Bool("d", c.Server.Daemon, "Run in daemon mode (short)")
-		rootDir := flag.String("root-dir", c.Paths.RootDir, "HD1 root directory (absolute path)")
-		buildDir := flag.String("build-dir", c.Paths.BuildDir, "Build directory (absolute path)")
-		logDir := flag.String("log-dir", c.Paths.LogDir, "Log directory (absolute path)")
-		staticDir := flag.String("static-dir", c.Server.StaticDir, "Static files directory (absolute path)")
-		pidFile := flag.String("pid-file", c.Paths.PIDFile, "PID file path (absolute)")
-		logFile := flag.String("log-file", c.Logging.LogFile, "Log file path (absolute)")
-		logLevel := flag.String("log-level", c.Logging.Level, "Logging level (TRACE, DEBUG, INFO, WARN, ERROR, FATAL)")
-		traceModules := flag.String("trace-modules", strings.Join(c.Logging.TraceModules, ","), "Comma-separated trace modules")
-		protectedWorlds := flag.String("protected-worlds", strings.Join(c.Worlds.ProtectedList, ","), "Comma-separated list of protected worlds")
-		
-		// Extended flags for complete configuration coverage
-		worldsDir := flag.String("worlds-dir", c.Paths.WorldsDir, "Worlds configuration directory")
-		avatarsDir := flag.String("avatars-dir", c.Paths.AvatarsDir, "Avatars configuration directory")
-		recordingsDir := flag.String("recordings-dir", c.Paths.RecordingsDir, "Recordings directory")
-		defaultWorld := flag.String("default-world", c.Worlds.DefaultWorld, "Default world identifier")
-		autoJoinOnCreate := flag.Bool("auto-join-on-create", c.Worlds.AutoJoinOnCreate, "Auto-join world on session create")
-		syncOnJoin := flag.Bool("sync-on-join", c.Worlds.SyncOnJoin, "Sync world state on join")
-		
-		// WebSocket configuration flags
-		writeTimeout := flag.Duration("websocket-write-timeout", c.WebSocket.WriteTimeout, "WebSocket write timeout")
-		pongTimeout := flag.Duration("websocket-pong-timeout", c.WebSocket.PongTimeout, "WebSocket pong timeout") 
-		pingPeriod := flag.Duration("websocket-ping-period", c.WebSocket.PingPeriod, "WebSocket ping period")
-		maxMessageSize := flag.Int64("websocket-max-message-size", c.WebSocket.MaxMessageSize, "WebSocket max message size")
-		readBufferSize := flag.Int("websocket-read-buffer-size", c.WebSocket.ReadBufferSize, "WebSocket read buffer size")
-		writeBufferSize := flag.Int("websocket-write-buffer-size", c.WebSocket.WriteBufferSize, "WebSocket write buffer size")
-		
-		// Session configuration flags
-		cleanupInterval := flag.Duration("session-cleanup-interval", c.Session.CleanupInterval, "Session cleanup interval")
-		inactivityTimeout := flag.Duration("session-inactivity-timeout", c.Session.InactivityTimeout, "Session inactivity timeout")
-		httpClientTimeout := flag.Duration("session-http-client-timeout", c.Session.HTTPClientTimeout, "HTTP client timeout")
-		
-		// Avatar configuration flags
-		maxConcurrentCreations := flag.Int("avatars-max-concurrent-creations", c.Avatars.MaxConcurrentCreations, "Max concurrent avatar creations")
-		healthCheckInterval := flag.Duration("avatars-health-check-interval", c.Avatars.HealthCheckInterval, "Avatar health check interval")
-		positionUpdateThrottle := flag.Duration("avatars-position-update-throttle", c.Avatars.PositionUpdateThrottle, "Avatar position update throttle")
-		maxReconnectAttempts := flag.Int("avatars-max-reconnect-attempts", c.Avatars.MaxReconnectAttempts, "Max avatar reconnect attempts")
-		reconnectDelay := flag.Duration("avatars-reconnect-delay", c.Avatars.ReconnectDelay, "Avatar reconnect delay")
-		maxReconnectDelay := flag.Duration("avatars-max-reconnect-delay", c.Avatars.MaxReconnectDelay, "Max avatar reconnect delay")
-		heartbeatFrequency := flag.Duration("avatars-heartbeat-frequency", c.Avatars.HeartbeatFrequency, "Avatar heartbeat frequency")
-		
-		// Sync protocol configuration flags
-		syncProtocol := flag.String("sync-protocol", c.Sync.Protocol, "HD1-VSC sync protocol version")
-		syncInterval := flag.Duration("sync-interval", c.Sync.SyncInterval, "Sync broadcast interval")
-		maxDeltaLog := flag.Int("sync-max-delta-log", c.Sync.MaxDeltaLog, "Max delta operations to keep")
-		checksumAlgorithm := flag.String("sync-checksum-algorithm", c.Sync.ChecksumAlgorithm, "Checksum algorithm")
-		causalityTimeout := flag.Duration("sync-causality-timeout", c.Sync.CausalityTimeout, "Causality timeout")
-		deltaQueueSize := flag.Int("sync-delta-queue-size", c.Sync.DeltaQueueSize, "Delta operation queue size")
-		avatarRegistrySize := flag.Int("sync-avatar-registry-size", c.Sync.AvatarRegistrySize, "Avatar registry size")
-		broadcastWorldBuffer := flag.Int("sync-broadcast-world-buffer", c.Sync.BroadcastWorldBuffer, "Broadcast world buffer size")
-		worldStateCompression := flag.Bool("sync-world-state-compression", c.Sync.WorldStateCompressionEnabled, "Enable world state compression")
-		performanceMetrics := flag.Bool("sync-performance-metrics", c.Sync.PerformanceMetricsEnabled, "Enable sync performance metrics")
-		vectorClockPrecision := flag.Int("sync-vector-clock-precision", c.Sync.VectorClockPrecision, "Vector clock precision bits")
-		
-		flag.Parse()
-		
-		// Apply flag values (short flags take precedence over long flags)
-		if *hostShort != c.Server.Host {
-			c.Server.Host = *hostShort
-		} else {
-			c.Server.Host = *host
+	if consistencyInterval := os.Getenv("HD1_SYNC_CONSISTENCY_INTERVAL"); consistencyInterval != "" {
+		if interval, err := time.ParseDuration(consistencyInterval); err == nil {
+			c.Sync.ConsistencyInterval = interval
 		}
-		if *portShort != c.Server.Port {
-			c.Server.Port = *portShort
-		} else {
-			c.Server.Port = *port
+	}
+	if transactionTimeout := os.Getenv("HD1_SYNC_TRANSACTION_TIMEOUT"); transactionTimeout != "" {
+		if timeout, err := time.ParseDuration(transactionTimeout); err == nil {
+			c.Sync.TransactionTimeout = timeout
 		}
-		if *daemonShort != c.Server.Daemon {
-			c.Server.Daemon = *daemonShort
-		} else {
-			c.Server.Daemon = *daemon
+	}
+	if transactionMax := os.Getenv("HD1_SYNC_TRANSACTION_MAX_OPERATIONS"); transactionMax != "" {
+		if max, err := strconv.Atoi(transactionMax); err == nil {
+			c.Sync.TransactionMaxOperations = max
 		}
-		if *apiBase != "" {
-			c.Server.APIBase = *apiBase
-			c.Client.APIBase = *apiBase
+	}
+	if replayWindow := os.Getenv("HD1_SYNC_REPLAY_WINDOW"); replayWindow != "" {
+		if window, err := strconv.Atoi(replayWindow); err == nil {
+			c.Sync.ReplayWindow = window
 		}
-		if *internalAPIBase != "" {
-			c.Server.InternalAPIBase = *internalAPIBase
+	}
+	
+	// Storage configuration
+	if backend := os.Getenv("HD1_STORAGE_BACKEND"); backend != "" {
+		c.Storage.Backend = backend
+	}
+	if storageDir := os.Getenv("HD1_STORAGE_DIR"); storageDir != "" {
+		c.Storage.Dir = storageDir
+	}
+	if bucket := os.Getenv("HD1_STORAGE_BUCKET"); bucket != "" {
+		c.Storage.Bucket = bucket
+	}
+	if region := os.Getenv("HD1_STORAGE_REGION"); region != "" {
+		c.Storage.Region = region
+	}
+	if endpoint := os.Getenv("HD1_STORAGE_ENDPOINT"); endpoint != "" {
+		c.Storage.Endpoint = endpoint
+	}
+	if prefix := os.Getenv("HD1_STORAGE_PREFIX"); prefix != "" {
+		c.Storage.Prefix = prefix
+	}
+	if pathStyle := os.Getenv("HD1_STORAGE_PATH_STYLE"); pathStyle == "true" || pathStyle == "1" {
+		c.Storage.PathStyle = true
+	} else if pathStyle == "false" || pathStyle == "0" {
+		c.Storage.PathStyle = false
+	}
+	if accessKey := os.Getenv("HD1_STORAGE_ACCESS_KEY"); accessKey != "" {
+		c.Storage.AccessKey = accessKey
+	}
+	if secretKey := os.Getenv("HD1_STORAGE_SECRET_KEY"); secretKey != "" {
+		c.Storage.SecretKey = secretKey
+	}
+	if signingKey := os.Getenv("HD1_STORAGE_SIGNING_KEY"); signingKey != "" {
+		c.Storage.SigningKey = signingKey
+	}
+	if signedURLTTL := os.Getenv("HD1_STORAGE_SIGNED_URL_TTL"); signedURLTTL != "" {
+		if ttl, err := time.ParseDuration(signedURLTTL); err == nil {
+			c.Storage.SignedURLTTL = ttl
 		}
-		if *versionShort != c.Server.Version {
-			c.Server.Version = *versionShort
-		} else if *version != "" {
-			c.Server.Version = *version
+	}
+	if provider := os.Getenv("HD1_STORAGE_ENCRYPTION_PROVIDER"); provider != "" {
+		c.Storage.EncryptionProvider = provider
+	}
+	if keys := os.Getenv("HD1_STORAGE_ENCRYPTION_KEYS"); keys != "" {
+		c.Storage.EncryptionKeys = keys
+		// Keys alone select the static provider
+		if c.Storage.EncryptionProvider == "" {
+			c.Storage.EncryptionProvider = "static"
 		}
-		c.Paths.RootDir = *rootDir
-		c.Paths.BuildDir = *buildDir
-		c.Paths.LogDir = *logDir
-		c.Logging.LogDir = *logDir
-		c.Server.StaticDir = *staticDir
-		c.Paths.PIDFile = *pidFile
-		c.Logging.LogFile = *logFile
-		c.Logging.Level = *logLevel
-		if *traceModules != "" {
-			c.Logging.TraceModules = strings.Split(*traceModules, ",")
+	}
+	if namespaces := os.Getenv("HD1_STORAGE_ENCRYPTION_NAMESPACES"); namespaces != "" {
+		c.Storage.EncryptionNamespaces = strings.Split(namespaces, ",")
+	}
+	if migrate := os.Getenv("HD1_STORAGE_ENCRYPTION_MIGRATE"); migrate == "true" || migrate == "1" {
+		c.Storage.EncryptionMigrate = true
+	} else if migrate == "false" || migrate == "0" {
+		c.Storage.EncryptionMigrate = false
+	}
+	
+	// Asset store configuration
+	if maxUpload := os.Getenv("HD1_ASSETS_MAX_UPLOAD_SIZE"); maxUpload != "" {
+		if size, err := strconv.ParseInt(maxUpload, 10, 64); err == nil {
+			c.Assets.MaxUploadSize = size
 		}
-		if *protectedWorlds != "" {
-			c.Worlds.ProtectedList = strings.Split(*protectedWorlds, ",")
+	}
+	if gcInterval := os.Getenv("HD1_ASSETS_GC_INTERVAL"); gcInterval != "" {
+		if interval, err := time.ParseDuration(gcInterval); err == nil {
+			c.Assets.GCInterval = interval
+		}
+	}
+	if gcGrace := os.Getenv("HD1_ASSETS_GC_GRACE_PERIOD"); gcGrace != "" {
+		if grace, err := time.ParseDuration(gcGrace); err == nil {
+			c.Assets.GCGracePeriod = grace
+		}
+	}
+	if pipeline := os.Getenv("HD1_ASSETS_PIPELINE_ENABLED"); pipeline == "true" || pipeline == "1" {
+		c.Assets.PipelineEnabled = true
+	} else if pipeline == "false" || pipeline == "0" {
+		c.Assets.PipelineEnabled = false
+	}
+	if workers := os.Getenv("HD1_ASSETS_PIPELINE_WORKERS"); workers != "" {
+		if count, err := strconv.Atoi(workers); err == nil {
+			c.Assets.PipelineWorkers = count
+		}
+	}
+	if tool := os.Getenv("HD1_ASSETS_PIPELINE_TOOL"); tool != "" {
+		c.Assets.PipelineTool = tool
+	}
+	if pipelineTimeout := os.Getenv("HD1_ASSETS_PIPELINE_TIMEOUT"); pipelineTimeout != "" {
+		if timeout, err := time.ParseDuration(pipelineTimeout); err == nil {
+			c.Assets.PipelineTimeout = timeout
+		}
+	}
+	if workers := os.Getenv("HD1_ASSETS_POINTCLOUD_WORKERS"); workers != "" {
+		if count, err := strconv.Atoi(workers); err == nil {
+			c.Assets.PointCloudWorkers = count
+		}
+	}
+	if nodePoints := os.Getenv("HD1_ASSETS_POINTCLOUD_NODE_POINTS"); nodePoints != "" {
+		if count, err := strconv.Atoi(nodePoints); err == nil {
+			c.Assets.PointCloudNodePoints = count
+		}
+	}
+	if maxPoints := os.Getenv("HD1_ASSETS_POINTCLOUD_MAX_POINTS"); maxPoints != "" {
+		if count, err := strconv.Atoi(maxPoints); err == nil {
+			c.Assets.PointCloudMaxPoints = count
+		}
+	}
+	if scanBackend := os.Getenv("HD1_ASSETS_SCAN_BACKEND"); scanBackend != "" {
+		c.Assets.ScanBackend = scanBackend
+	}
+	if scanAddress := os.Getenv("HD1_ASSETS_SCAN_ADDRESS"); scanAddress != "" {
+		c.Assets.ScanAddress = scanAddress
+	}
+	if scanTimeout := os.Getenv("HD1_ASSETS_SCAN_TIMEOUT"); scanTimeout != "" {
+		if timeout, err := time.ParseDuration(scanTimeout); err == nil {
+			c.Assets.ScanTimeout = timeout
 		}
-		
-		// Apply extended configuration flags
-		c.Paths.WorldsDir = *worldsDir
-		c.Paths.AvatarsDir = *avatarsDir
-		c.Paths.RecordingsDir = *recordingsDir
-		c.Worlds.DefaultWorld = *defaultWorld
-		c.Worlds.AutoJoinOnCreate = *autoJoinOnCreate
-		c.Worlds.SyncOnJoin = *syncOnJoin
-		
-		// Apply WebSocket configuration
-		c.WebSocket.WriteTimeout = *writeTimeout
-		c.WebSocket.PongTimeout = *pongTimeout
-		c.WebSocket.PingPeriod = *pingPeriod
-		c.WebSocket.MaxMessageSize = *maxMessageSize
-		c.WebSocket.ReadBufferSize = *readBufferSize
-		c.WebSocket.WriteBufferSize = *writeBufferSize
-		
-		// Apply Session configuration
-		c.Session.CleanupInterval = *cleanupInterval
-		c.Session.InactivityTimeout = *inactivityTimeout
-		c.Session.HTTPClientTimeout = *httpClientTimeout
-		
-		// Apply Avatar configuration
-		c.Avatars.MaxConcurrentCreations = *maxConcurrentCreations
-		c.Avatars.HealthCheckInterval = *healthCheckInterval
-		c.Avatars.PositionUpdateThrottle = *positionUpdateThrottle
-		c.Avatars.MaxReconnectAttempts = *maxReconnectAttempts
-		c.Avatars.ReconnectDelay = *reconnectDelay
-		c.Avatars.MaxReconnectDelay = *maxReconnectDelay
-		c.Avatars.HeartbeatFrequency = *heartbeatFrequency
-		
-		// Apply Sync protocol configuration
-		c.Sync.Protocol = *syncProtocol
-		c.Sync.SyncInterval = *syncInterval
-		c.Sync.MaxDeltaLog = *maxDeltaLog
-		c.Sync.ChecksumAlgorithm = *checksumAlgorithm
-		c.Sync.CausalityTimeout = *causalityTimeout
-		c.Sync.DeltaQueueSize = *deltaQueueSize
-		c.Sync.AvatarRegistrySize = *avatarRegistrySize
-		c.Sync.BroadcastWorldBuffer = *broadcastWorldBuffer
-		c.Sync.WorldStateCompressionEnabled = *worldStateCompression
-		c.Sync.PerformanceMetricsEnabled = *performanceMetrics
-		c.Sync.VectorClockPrecision = *vectorClockPrecision
-		
-		// Recompute derived paths if root changed
-		c.calculate_dependent_directory_paths()
 	}
-}
-
-// calculate_dependent_directory_paths calculates dependent paths from root directory
-func (c *HD1Config) calculate_dependent_directory_paths() {
-	// Use configuration-driven install prefix detection
-	installPrefix := c.getInstallPrefix()
 	
-	if c.Paths.BuildDir == "" || strings.HasPrefix(c.Paths.BuildDir, installPrefix) {
-		c.Paths.BuildDir = filepath.Join(c.Paths.RootDir, "build")
+	// Client capability tier configuration
+	if highUpdateRate := os.Getenv("HD1_CLIENTS_HIGH_UPDATE_RATE"); highUpdateRate != "" {
+		if rate, err := strconv.Atoi(highUpdateRate); err == nil {
+			c.Clients.HighUpdateRate = rate
+		}
 	}
-	if c.Paths.BinDir == "" || strings.HasPrefix(c.Paths.BinDir, installPrefix) {
-		c.Paths.BinDir = filepath.Join(c.Paths.BuildDir, "bin")
+	if standardUpdateRate := os.Getenv("HD1_CLIENTS_STANDARD_UPDATE_RATE"); standardUpdateRate != "" {
+		if rate, err := strconv.Atoi(standardUpdateRate); err == nil {
+			c.Clients.StandardUpdateRate = rate
+		}
 	}
-	if c.Paths.LogDir == "" || strings.HasPrefix(c.Paths.LogDir, installPrefix) {
-		c.Paths.LogDir = filepath.Join(c.Paths.BuildDir, "logs")
-		c.Logging.LogDir = c.Paths.LogDir
+	if lowUpdateRate := os.Getenv("HD1_CLIENTS_LOW_UPDATE_RATE"); lowUpdateRate != "" {
+		if rate, err := strconv.Atoi(lowUpdateRate); err == nil {
+			c.Clients.LowUpdateRate = rate
+		}
 	}
-	if c.Paths.RuntimeDir == "" || strings.HasPrefix(c.Paths.RuntimeDir, installPrefix) {
-		c.Paths.RuntimeDir = filepath.Join(c.Paths.BuildDir, "runtime")
+	if highTextureSize := os.Getenv("HD1_CLIENTS_HIGH_TEXTURE_SIZE"); highTextureSize != "" {
+		if size, err := strconv.Atoi(highTextureSize); err == nil {
+			c.Clients.HighTextureSize = size
+		}
 	}
-	if c.Paths.ShareDir == "" || strings.HasPrefix(c.Paths.ShareDir, installPrefix) {
-		c.Paths.ShareDir = filepath.Join(c.Paths.RootDir, "share")
+	if standardTextureSize := os.Getenv("HD1_CLIENTS_STANDARD_TEXTURE_SIZE"); standardTextureSize != "" {
+		if size, err := strconv.Atoi(standardTextureSize); err == nil {
+			c.Clients.StandardTextureSize = size
+		}
 	}
-	if c.Paths.HtDocsDir == "" || strings.HasPrefix(c.Paths.HtDocsDir, installPrefix) {
-		c.Paths.HtDocsDir = filepath.Join(c.Paths.ShareDir, "htdocs")
+	if lowTextureSize := os.Getenv("HD1_CLIENTS_LOW_TEXTURE_SIZE"); lowTextureSize != "" {
+		if size, err := strconv.Atoi(lowTextureSize); err == nil {
+			c.Clients.LowTextureSize = size
+		}
 	}
-	if c.Paths.PIDFile == "" || strings.HasPrefix(c.Paths.PIDFile, installPrefix) {
-		c.Paths.PIDFile = filepath.Join(c.Paths.RuntimeDir, "hd1.pid")
+	
+	// XR pose channel configuration
+	if poseRate := os.Getenv("HD1_XR_POSE_RATE"); poseRate != "" {
+		if rate, err := strconv.Atoi(poseRate); err == nil {
+			c.XR.PoseRate = rate
+		}
+	}
+	if keyframeInterval := os.Getenv("HD1_XR_KEYFRAME_INTERVAL"); keyframeInterval != "" {
+		if interval, err := time.ParseDuration(keyframeInterval); err == nil {
+			c.XR.KeyframeInterval = interval
+		}
+	}
+	
+	// Accessibility configuration
+	if captionMaxLength := os.Getenv("HD1_ACCESSIBILITY_CAPTION_MAX_LENGTH"); captionMaxLength != "" {
+		if length, err := strconv.Atoi(captionMaxLength); err == nil {
+			c.Accessibility.CaptionMaxLength = length
+		}
+	}
+	if captionRate := os.Getenv("HD1_ACCESSIBILITY_CAPTION_RATE"); captionRate != "" {
+		if rate, err := strconv.Atoi(captionRate); err == nil {
+			c.Accessibility.CaptionRate = rate
+		}
+	}
+	
+	// Entity ID issuance configuration
+	if allowClientIDs := os.Getenv("HD1_ENTITIES_ALLOW_CLIENT_IDS"); allowClientIDs == "true" || allowClientIDs == "1" {
+		c.Entities.AllowClientIDs = true
+	} else if allowClientIDs == "false" || allowClientIDs == "0" {
+		c.Entities.AllowClientIDs = false
+	}
+	if idConflict := os.Getenv("HD1_ENTITIES_ID_CONFLICT"); idConflict != "" {
+		c.Entities.IDConflict = idConflict
+	}
+	if rate := os.Getenv("HD1_ENTITIES_CREATE_RATE"); rate != "" {
+		if value, err := strconv.Atoi(rate); err == nil {
+			c.Entities.CreateRate = value
+		}
+	}
+	if max := os.Getenv("HD1_ENTITIES_MAX_PER_SESSION"); max != "" {
+		if value, err := strconv.Atoi(max); err == nil {
+			c.Entities.MaxPerSession = value
+		}
+	}
+	if max := os.Getenv("HD1_ENTITIES_MAX_TRIANGLES"); max != "" {
+		if value, err := strconv.Atoi(max); err == nil {
+			c.Entities.MaxTriangles = value
+		}
+	}
+	if penalty := os.Getenv("HD1_ENTITIES_PENALTY"); penalty != "" {
+		if duration, err := time.ParseDuration(penalty); err == nil {
+			c.Entities.Penalty = duration
+		}
+	}
+	if penaltyMax := os.Getenv("HD1_ENTITIES_PENALTY_MAX"); penaltyMax != "" {
+		if duration, err := time.ParseDuration(penaltyMax); err == nil {
+			c.Entities.PenaltyMax = duration
+		}
+	}
+	
+	// Compression configuration
+	if enabled := os.Getenv("HD1_COMPRESSION_ENABLED"); enabled == "true" || enabled == "1" {
+		c.Compression.Enabled = true
+	} else if enabled == "false" || enabled == "0" {
+		c.Compression.Enabled = false
+	}
+	if minSize := os.Getenv("HD1_COMPRESSION_MIN_SIZE"); minSize != "" {
+		if size, err := strconv.Atoi(minSize); err == nil {
+			c.Compression.MinSize = size
+		}
+	}
+	if types := os.Getenv("HD1_COMPRESSION_TYPES"); types != "" {
+		c.Compression.Types = strings.Split(types, ",")
+	}
+	
+	// Feature flag configuration
+	if file := os.Getenv("HD1_FEATURES_FILE"); file != "" {
+		c.Features.File = file
+	}
+	if enabled := os.Getenv("HD1_FEATURES"); enabled != "" {
+		c.Features.Enabled = strings.Split(enabled, ",")
+	}
+	if url := os.Getenv("HD1_FEATURES_URL"); url != "" {
+		c.Features.URL = url
+	}
+	if token := os.Getenv("HD1_FEATURES_TOKEN"); token != "" {
+		c.Features.Token = token
+	}
+	if refresh := os.Getenv("HD1_FEATURES_REFRESH"); refresh != "" {
+		if duration, err := time.ParseDuration(refresh); err == nil {
+			c.Features.Refresh = duration
+		}
+	}
+	
+	// Moderation configuration
+	if token := os.Getenv("HD1_MODERATION_TOKEN"); token != "" {
+		c.Moderation.Token = token
+	}
+	if file := os.Getenv("HD1_MODERATION_POLICY_FILE"); file != "" {
+		c.Moderation.PolicyFile = file
+	}
+	if token := os.Getenv("HD1_MODERATION_API_TOKEN"); token != "" {
+		c.Moderation.APIToken = token
+	}
+	
+	// Environment configuration
+	if tick := os.Getenv("HD1_ENVIRONMENT_TICK"); tick != "" {
+		if duration, err := time.ParseDuration(tick); err == nil {
+			c.Environment.Tick = duration
+		}
+	}
+	if dayLength := os.Getenv("HD1_ENVIRONMENT_DAY_LENGTH"); dayLength != "" {
+		if duration, err := time.ParseDuration(dayLength); err == nil {
+			c.Environment.DayLength = duration
+		}
+	}
+	if worldDayLengths := os.Getenv("HD1_ENVIRONMENT_WORLD_DAY_LENGTHS"); worldDayLengths != "" {
+		if durations, err := parseWorldDurations(worldDayLengths); err == nil {
+			c.Environment.WorldDayLengths = durations
+		}
+	}
+	if weatherInterval := os.Getenv("HD1_ENVIRONMENT_WEATHER_INTERVAL"); weatherInterval != "" {
+		if duration, err := time.ParseDuration(weatherInterval); err == nil {
+			c.Environment.WeatherInterval = duration
+		}
+	}
+	if worldWeatherIntervals := os.Getenv("HD1_ENVIRONMENT_WORLD_WEATHER_INTERVALS"); worldWeatherIntervals != "" {
+		if durations, err := parseWorldDurations(worldWeatherIntervals); err == nil {
+			c.Environment.WorldWeatherIntervals = durations
+		}
+	}
+	if weathers := os.Getenv("HD1_ENVIRONMENT_WEATHERS"); weathers != "" {
+		c.Environment.Weathers = strings.Split(weathers, ",")
+	}
+	
+	// Media configuration
+	if allowedHosts := os.Getenv("HD1_MEDIA_ALLOWED_HOSTS"); allowedHosts != "" {
+		c.Media.AllowedHosts = strings.Split(allowedHosts, ",")
+	}
+	
+	// Bookings configuration
+	if webhookURL := os.Getenv("HD1_BOOKINGS_WEBHOOK_URL"); webhookURL != "" {
+		c.Bookings.WebhookURL = webhookURL
+	}
+	if webhookSecret := os.Getenv("HD1_BOOKINGS_WEBHOOK_SECRET"); webhookSecret != "" {
+		c.Bookings.WebhookSecret = webhookSecret
+	}
+	if tick := os.Getenv("HD1_BOOKINGS_TICK"); tick != "" {
+		if duration, err := time.ParseDuration(tick); err == nil {
+			c.Bookings.Tick = duration
+		}
+	}
+	if maxPerWorld := os.Getenv("HD1_BOOKINGS_MAX_PER_WORLD"); maxPerWorld != "" {
+		if max, err := strconv.Atoi(maxPerWorld); err == nil {
+			c.Bookings.MaxPerWorld = max
+		}
+	}
+	
+	// Guests configuration
+	if requireLink := os.Getenv("HD1_GUESTS_REQUIRE_LINK"); requireLink == "true" || requireLink == "1" {
+		c.Guests.RequireLink = true
+	}
+	if lifetime := os.Getenv("HD1_GUESTS_DEFAULT_LIFETIME"); lifetime != "" {
+		if duration, err := time.ParseDuration(lifetime); err == nil {
+			c.Guests.DefaultLifetime = duration
+		}
+	}
+	
+	// Email configuration
+	if host := os.Getenv("HD1_EMAIL_SMTP_HOST"); host != "" {
+		c.Email.SMTPHost = host
+	}
+	if port := os.Getenv("HD1_EMAIL_SMTP_PORT"); port != "" {
+		if p, err := strconv.Atoi(port); err == nil {
+			c.Email.SMTPPort = p
+		}
+	}
+	if username := os.Getenv("HD1_EMAIL_USERNAME"); username != "" {
+		c.Email.Username = username
+	}
+	if password := os.Getenv("HD1_EMAIL_PASSWORD"); password != "" {
+		c.Email.Password = password
+	}
+	if tlsMode := os.Getenv("HD1_EMAIL_TLS"); tlsMode != "" {
+		c.Email.TLS = tlsMode
+	}
+	if from := os.Getenv("HD1_EMAIL_FROM"); from != "" {
+		c.Email.From = from
+	}
+	if rate := os.Getenv("HD1_EMAIL_RATE_PER_HOUR"); rate != "" {
+		if r, err := strconv.Atoi(rate); err == nil {
+			c.Email.RatePerHour = r
+		}
+	}
+	if file := os.Getenv("HD1_EMAIL_ORG_FILE"); file != "" {
+		c.Email.OrgFile = file
+	}
+	if dir := os.Getenv("HD1_EMAIL_TEMPLATES_DIR"); dir != "" {
+		c.Email.TemplatesDir = dir
+	}
+	if contacts := os.Getenv("HD1_EMAIL_SECURITY_CONTACTS"); contacts != "" {
+		c.Email.SecurityContacts = strings.Split(contacts, ",")
+	}
+	
+	// Connectors configuration
+	if file := os.Getenv("HD1_CONNECTORS_FILE"); file != "" {
+		c.Connectors.File = file
+	}
+	if capacity := os.Getenv("HD1_CONNECTORS_CAPACITY"); capacity != "" {
+		if value, err := strconv.Atoi(capacity); err == nil {
+			c.Connectors.Capacity = value
+		}
+	}
+	if timeout := os.Getenv("HD1_CONNECTORS_TIMEOUT"); timeout != "" {
+		if duration, err := time.ParseDuration(timeout); err == nil {
+			c.Connectors.Timeout = duration
+		}
+	}
+	if cooldown := os.Getenv("HD1_CONNECTORS_COOLDOWN"); cooldown != "" {
+		if duration, err := time.ParseDuration(cooldown); err == nil {
+			c.Connectors.Cooldown = duration
+		}
+	}
+	
+	// Bindings configuration
+	if tick := os.Getenv("HD1_BINDINGS_TICK"); tick != "" {
+		if duration, err := time.ParseDuration(tick); err == nil {
+			c.Bindings.Tick = duration
+		}
+	}
+	
+	// Imports configuration
+	if tool := os.Getenv("HD1_IMPORTS_TOOL"); tool != "" {
+		c.Imports.Tool = tool
+	}
+	if workers := os.Getenv("HD1_IMPORTS_WORKERS"); workers != "" {
+		if count, err := strconv.Atoi(workers); err == nil {
+			c.Imports.Workers = count
+		}
+	}
+	if timeout := os.Getenv("HD1_IMPORTS_TIMEOUT"); timeout != "" {
+		if duration, err := time.ParseDuration(timeout); err == nil {
+			c.Imports.Timeout = duration
+		}
+	}
+	if maxEntities := os.Getenv("HD1_IMPORTS_MAX_ENTITIES"); maxEntities != "" {
+		if count, err := strconv.Atoi(maxEntities); err == nil {
+			c.Imports.MaxEntities = count
+		}
+	}
+	
+	// Geo configuration; set a URL empty to turn its layer off
+	if url, ok := os.LookupEnv("HD1_GEO_IMAGERY_URL"); ok {
+		c.Geo.ImageryURL = url
+	}
+	if url, ok := os.LookupEnv("HD1_GEO_ELEVATION_URL"); ok {
+		c.Geo.ElevationURL = url
+	}
+	if encoding := os.Getenv("HD1_GEO_ELEVATION_ENCODING"); encoding != "" {
+		c.Geo.ElevationEncoding = encoding
+	}
+	if attribution := os.Getenv("HD1_GEO_ATTRIBUTION"); attribution != "" {
+		c.Geo.Attribution = attribution
+	}
+	if maxTiles := os.Getenv("HD1_GEO_MAX_TILES"); maxTiles != "" {
+		if count, err := strconv.Atoi(maxTiles); err == nil {
+			c.Geo.MaxTiles = count
+		}
+	}
+	if timeout := os.Getenv("HD1_GEO_TIMEOUT"); timeout != "" {
+		if duration, err := time.ParseDuration(timeout); err == nil {
+			c.Geo.Timeout = duration
+		}
+	}
+	
+	// Simulation configuration
+	if tick := os.Getenv("HD1_SIMULATION_TICK"); tick != "" {
+		if duration, err := time.ParseDuration(tick); err == nil {
+			c.Simulation.Tick = duration
+		}
+	}
+	if tick := os.Getenv("HD1_SIMULATION_IDLE_TICK"); tick != "" {
+		if duration, err := time.ParseDuration(tick); err == nil {
+			c.Simulation.IdleTick = duration
+		}
+	}
+	
+	// Budgets configuration
+	if maxEntities := os.Getenv("HD1_BUDGETS_MAX_ENTITIES"); maxEntities != "" {
+		if count, err := strconv.Atoi(maxEntities); err == nil {
+			c.Budgets.MaxEntities = count
+		}
+	}
+	if worldMaxEntities := os.Getenv("HD1_BUDGETS_WORLD_MAX_ENTITIES"); worldMaxEntities != "" {
+		if counts, err := parseWorldCounts(worldMaxEntities); err == nil {
+			c.Budgets.WorldMaxEntities = map[string]int{}
+			for world, count := range counts {
+				c.Budgets.WorldMaxEntities[world] = int(count)
+			}
+		}
+	}
+	if maxMemory := os.Getenv("HD1_BUDGETS_MAX_MEMORY"); maxMemory != "" {
+		if size, err := strconv.ParseInt(maxMemory, 10, 64); err == nil {
+			c.Budgets.MaxMemory = size
+		}
+	}
+	if worldMaxMemory := os.Getenv("HD1_BUDGETS_WORLD_MAX_MEMORY"); worldMaxMemory != "" {
+		if sizes, err := parseWorldCounts(worldMaxMemory); err == nil {
+			c.Budgets.WorldMaxMemory = sizes
+		}
+	}
+	
+	// Hibernation configuration
+	if idle := os.Getenv("HD1_HIBERNATION_IDLE"); idle != "" {
+		if duration, err := time.ParseDuration(idle); err == nil {
+			c.Hibernation.Idle = duration
+		}
+	}
+	
+	// Webhooks configuration
+	if file := os.Getenv("HD1_WEBHOOKS_FILE"); file != "" {
+		c.Webhooks.File = file
+	}
+	
+	// Forms configuration
+	if file := os.Getenv("HD1_FORMS_FILE"); file != "" {
+		c.Forms.File = file
+	}
+	if timeout := os.Getenv("HD1_FORMS_TIMEOUT"); timeout != "" {
+		if duration, err := time.ParseDuration(timeout); err == nil {
+			c.Forms.Timeout = duration
+		}
+	}
+	
+	// Portals configuration
+	if file := os.Getenv("HD1_PORTALS_FILE"); file != "" {
+		c.Portals.File = file
+	}
+	if timeout := os.Getenv("HD1_PORTALS_TIMEOUT"); timeout != "" {
+		if duration, err := time.ParseDuration(timeout); err == nil {
+			c.Portals.Timeout = duration
+		}
+	}
+	
+	// Consent configuration
+	if file := os.Getenv("HD1_CONSENT_FILE"); file != "" {
+		c.Consent.File = file
+	}
+	
+	// Impersonation configuration
+	if maxDuration := os.Getenv("HD1_IMPERSONATION_MAX_DURATION"); maxDuration != "" {
+		if duration, err := time.ParseDuration(maxDuration); err == nil {
+			c.Impersonation.MaxDuration = duration
+		}
+	}
+	
+	// API usage configuration
+	if maxKeys := os.Getenv("HD1_API_USAGE_MAX_KEYS"); maxKeys != "" {
+		if keys, err := strconv.Atoi(maxKeys); err == nil {
+			c.APIUsage.MaxKeys = keys
+		}
+	}
+	
+	// Telemetry configuration
+	if interval := os.Getenv("HD1_TELEMETRY_INTERVAL"); interval != "" {
+		if duration, err := time.ParseDuration(interval); err == nil {
+			c.Telemetry.Interval = duration
+		}
+	}
+	if targetFPS := os.Getenv("HD1_TELEMETRY_TARGET_FPS"); targetFPS != "" {
+		if fps, err := strconv.Atoi(targetFPS); err == nil {
+			c.Telemetry.TargetFPS = fps
+		}
+	}
+	
+	// Quality configuration
+	if adaptive := os.Getenv("HD1_QUALITY_ADAPTIVE"); adaptive != "" {
+		c.Quality.Adaptive = adaptive == "true"
+	}
+	if distance := os.Getenv("HD1_QUALITY_CULL_DISTANCE"); distance != "" {
+		if metres, err := strconv.ParseFloat(distance, 64); err == nil {
+			c.Quality.CullDistance = metres
+		}
+	}
+	
+	// Crowd configuration
+	if threshold := os.Getenv("HD1_CROWD_THRESHOLD"); threshold != "" {
+		if avatars, err := strconv.Atoi(threshold); err == nil {
+			c.Crowd.Threshold = avatars
+		}
+	}
+	if distance := os.Getenv("HD1_CROWD_NEAR_DISTANCE"); distance != "" {
+		if metres, err := strconv.ParseFloat(distance, 64); err == nil {
+			c.Crowd.NearDistance = metres
+		}
+	}
+	if rate := os.Getenv("HD1_CROWD_FAR_UPDATE_RATE"); rate != "" {
+		if perSecond, err := strconv.Atoi(rate); err == nil {
+			c.Crowd.FarUpdateRate = perSecond
+		}
+	}
+	
+	// Spectators configuration
+	if enabled := os.Getenv("HD1_SPECTATORS_ENABLED"); enabled != "" {
+		c.Spectators.Enabled = enabled == "true"
+	}
+	if max := os.Getenv("HD1_SPECTATORS_MAX"); max != "" {
+		if spectators, err := strconv.Atoi(max); err == nil {
+			c.Spectators.Max = spectators
+		}
+	}
+	
+	// Broadcast configuration
+	if max := os.Getenv("HD1_BROADCAST_MAX"); max != "" {
+		if broadcasts, err := strconv.Atoi(max); err == nil {
+			c.Broadcast.Max = broadcasts
+		}
+	}
+	if ffmpeg := os.Getenv("HD1_BROADCAST_FFMPEG"); ffmpeg != "" {
+		c.Broadcast.FFmpeg = ffmpeg
+	}
+	if command := os.Getenv("HD1_BROADCAST_RENDER_COMMAND"); command != "" {
+		c.Broadcast.RenderCommand = command
+	}
+	if width := os.Getenv("HD1_BROADCAST_WIDTH"); width != "" {
+		if pixels, err := strconv.Atoi(width); err == nil {
+			c.Broadcast.Width = pixels
+		}
+	}
+	if height := os.Getenv("HD1_BROADCAST_HEIGHT"); height != "" {
+		if pixels, err := strconv.Atoi(height); err == nil {
+			c.Broadcast.Height = pixels
+		}
+	}
+	if rate := os.Getenv("HD1_BROADCAST_FRAME_RATE"); rate != "" {
+		if frames, err := strconv.Atoi(rate); err == nil {
+			c.Broadcast.FrameRate = frames
+		}
+	}
+	if bitrate := os.Getenv("HD1_BROADCAST_BITRATE"); bitrate != "" {
+		if kbps, err := strconv.Atoi(bitrate); err == nil {
+			c.Broadcast.Bitrate = kbps
+		}
+	}
+	
+	// Quotas configuration
+	if file := os.Getenv("HD1_QUOTAS_FILE"); file != "" {
+		c.Quotas.File = file
+	}
+	
+	// Chunks configuration
+	if size := os.Getenv("HD1_CHUNKS_SIZE"); size != "" {
+		if metres, err := strconv.ParseFloat(size, 64); err == nil {
+			c.Chunks.Size = metres
+		}
+	}
+	if radius := os.Getenv("HD1_CHUNKS_RADIUS"); radius != "" {
+		if chunks, err := strconv.Atoi(radius); err == nil {
+			c.Chunks.Radius = chunks
+		}
+	}
+	
+	// Components configuration
+	if dir := os.Getenv("HD1_COMPONENTS_DIR"); dir != "" {
+		c.Components.Dir = dir
+	}
+	if strict := os.Getenv("HD1_COMPONENTS_STRICT"); strict == "true" || strict == "1" {
+		c.Components.Strict = true
+	}
+	
+	// Hooks configuration
+	if file := os.Getenv("HD1_HOOKS_FILE"); file != "" {
+		c.Hooks.File = file
+	}
+}
+
+// loadFlags reads configuration from command line flags
+func (c *HD1Config) loadFlags() {
+	// Only parse flags if not already parsed
+	if !flag.Parsed() {
+		// Define flags with current config values as defaults
+		// Long and short flag combinations for essential operations
+		host := flag.String("host", c.Server.Host, "Host to bind to")
+		hostShort := flag.String("h", c.Server.Host, "Host to bind to (short)")
+		port := flag.String("port", c.Server.Port, "Port to bind to") 
+		portShort := flag.String("p", c.Server.Port, "Port to bind to (short)")
+		listen := flag.String("listen", strings.Join(c.Server.Listen, ","), "Comma-separated listener addresses (host:port, tcp://host:port, unix:///path), replaces host/port")
+		socketMode := flag.String("socket-mode", c.Server.SocketMode, "Octal permissions for Unix socket listeners")
+		socketOperators := flag.Bool("socket-operators", c.Server.SocketOperators, "Treat Unix socket peers as local callers, with operator rights")
+		tlsCert := flag.String("tls-cert", c.Server.TLSCert, "TLS certificate file (PEM); enables HTTPS and HTTP/2 with --tls-key")
+		tlsKey := flag.String("tls-key", c.Server.TLSKey, "TLS private key file (PEM)")
+		trustedProxies := flag.String("trusted-proxies", strings.Join(c.Server.TrustedProxies, ","), "Comma-separated proxy IPs, CIDRs or 'unix' trusted for X-Forwarded-For")
+		apiBase := flag.String("api-base", c.Server.APIBase, "API base URL")
+		internalAPIBase := flag.String("internal-api-base", c.Server.InternalAPIBase, "Internal API base URL for server communications")
+		version := flag.String("version", c.Server.Version, "HD1 version identifier")
+		versionShort := flag.String("v", c.Server.Version, "HD1 version identifier (short)")
+		daemon := flag.Bool("daemon", c.Server.Daemon, "Run in daemon mode")
+		shutdownTimeout := flag.Duration("shutdown-timeout", c.Server.ShutdownTimeout, "Drain time for in-flight requests on SIGTERM")
+		logFormat := flag.String("log-format", c.Logging.Format, "Console log format (text, json)")
+		// Applied before the environment is read, see loadProfiles
+		flag.String("profile", "", "Comma-separated configuration profiles, layered left to right")
+		flag.String("profiles-dir", c.Paths.ProfilesDir, "Directory of <name>.env configuration profiles")
+		daemonShort := flag.Bool("d", c.Server.Daemon, "Run in daemon mode (short)")
+		rootDir := flag.String("root-dir", c.Paths.RootDir, "HD1 root directory (absolute path)")
+		buildDir := flag.String("build-dir", c.Paths.BuildDir, "Build directory (absolute path)")
+		logDir := flag.String("log-dir", c.Paths.LogDir, "Log directory (absolute path)")
+		staticDir := flag.String("static-dir", c.Server.StaticDir, "Static files directory (absolute path)")
+		staticSource := flag.String("static-source", c.Server.StaticSource, "Console assets source: auto (static dir if present), embedded, disk")
+		staticDevMode := flag.Bool("static-dev-mode", c.Server.StaticDevMode, "Serve static assets under plain names without caching")
+		pidFile := flag.String("pid-file", c.Paths.PIDFile, "PID file path (absolute)")
+		logFile := flag.String("log-file", c.Logging.LogFile, "Log file path (absolute)")
+		logLevel := flag.String("log-level", c.Logging.Level, "Logging level (TRACE, DEBUG, INFO, WARN, ERROR, FATAL)")
+		traceModules := flag.String("trace-modules", strings.Join(c.Logging.TraceModules, ","), "Comma-separated trace modules")
+		protectedWorlds := flag.String("protected-worlds", strings.Join(c.Worlds.ProtectedList, ","), "Comma-separated list of protected worlds")
+		preloadWorlds := flag.String("preload-worlds", strings.Join(c.Worlds.Preload, ","), "Comma-separated list of worlds to load and warm at startup")
+		
+		// Extended flags for complete configuration coverage
+		worldsDir := flag.String("worlds-dir", c.Paths.WorldsDir, "Worlds configuration directory")
+		avatarsDir := flag.String("avatars-dir", c.Paths.AvatarsDir, "Avatars configuration directory")
+		recordingsDir := flag.String("recordings-dir", c.Paths.RecordingsDir, "Recordings directory")
+		templatesDir := flag.String("templates-dir", c.Paths.TemplatesDir, "Codegen template override directory (empty uses embedded templates)")
+		localesDir := flag.String("locales-dir", c.Paths.LocalesDir, "Message catalogue override directory (empty uses embedded catalogues)")
+		clientLocale := flag.String("client-locale", c.Client.Locale, "Default console language")
+		defaultWorld := flag.String("default-world", c.Worlds.DefaultWorld, "Default world identifier")
+		autoJoinOnCreate := flag.Bool("auto-join-on-create", c.Worlds.AutoJoinOnCreate, "Auto-join world on session create")
+		syncOnJoin := flag.Bool("sync-on-join", c.Worlds.SyncOnJoin, "Sync world state on join")
+		
+		// WebSocket configuration flags
+		writeTimeout := flag.Duration("websocket-write-timeout", c.WebSocket.WriteTimeout, "WebSocket write timeout")
+		pongTimeout := flag.Duration("websocket-pong-timeout", c.WebSocket.PongTimeout, "WebSocket pong timeout") 
+		pingPeriod := flag.Duration("websocket-ping-period", c.WebSocket.PingPeriod, "WebSocket ping period")
+		maxMessageSize := flag.Int64("websocket-max-message-size", c.WebSocket.MaxMessageSize, "WebSocket max message size")
+		readBufferSize := flag.Int("websocket-read-buffer-size", c.WebSocket.ReadBufferSize, "WebSocket read buffer size")
+		writeBufferSize := flag.Int("websocket-write-buffer-size", c.WebSocket.WriteBufferSize, "WebSocket write buffer size")
+		assetChunkSize := flag.Int("websocket-asset-chunk-size", c.WebSocket.AssetChunkSize, "Raw bytes per streamed asset chunk")
+		maxAssetStreams := flag.Int("websocket-max-asset-streams", c.WebSocket.MaxAssetStreams, "Concurrent asset streams per client")
+		allowedOrigins := flag.String("websocket-allowed-origins", strings.Join(c.WebSocket.AllowedOrigins, ","), "Comma-separated origins allowed to open /ws ('*' for any)")
+		
+		// Session configuration flags
+		cleanupInterval := flag.Duration("session-cleanup-interval", c.Session.CleanupInterval, "Session cleanup interval")
+		inactivityTimeout := flag.Duration("session-inactivity-timeout", c.Session.InactivityTimeout, "Session inactivity timeout")
+		httpClientTimeout := flag.Duration("session-http-client-timeout", c.Session.HTTPClientTimeout, "HTTP client timeout")
+		sessionTokenTTL := flag.Duration("session-token-ttl", c.Session.TokenTTL, "WebSocket session token lifetime")
+		sessionStaleAfter := flag.Duration("session-stale-after", c.Session.StaleAfter, "Mark clients stale without a heartbeat this long")
+		sessionDeactivateAfter := flag.Duration("session-deactivate-after", c.Session.DeactivateAfter, "Disconnect clients without a heartbeat this long (0 never)")
+		
+		// Avatar configuration flags
+		maxConcurrentCreations := flag.Int("avatars-max-concurrent-creations", c.Avatars.MaxConcurrentCreations, "Max concurrent avatar creations")
+		healthCheckInterval := flag.Duration("avatars-health-check-interval", c.Avatars.HealthCheckInterval, "Avatar health check interval")
+		positionUpdateThrottle := flag.Duration("avatars-position-update-throttle", c.Avatars.PositionUpdateThrottle, "Avatar position update throttle")
+		maxReconnectAttempts := flag.Int("avatars-max-reconnect-attempts", c.Avatars.MaxReconnectAttempts, "Max avatar reconnect attempts")
+		reconnectDelay := flag.Duration("avatars-reconnect-delay", c.Avatars.ReconnectDelay, "Avatar reconnect delay")
+		maxReconnectDelay := flag.Duration("avatars-max-reconnect-delay", c.Avatars.MaxReconnectDelay, "Max avatar reconnect delay")
+		heartbeatFrequency := flag.Duration("avatars-heartbeat-frequency", c.Avatars.HeartbeatFrequency, "Avatar heartbeat frequency")
+		avatarIdleTimeout := flag.Duration("avatars-idle-timeout", c.Avatars.IdleTimeout, "Evict avatars of departed sessions after this long unseen (0 keeps them)")
+		avatarMaxSpeed := flag.Float64("avatars-max-speed", c.Avatars.MaxSpeed, "Fastest avatar movement in metres per second (0 for no limit)")
+		avatarMaxStep := flag.Float64("avatars-max-step", c.Avatars.MaxStep, "Longest single avatar move in metres (0 for no limit)")
+		avatarMoveAction := flag.String("avatars-move-action", c.Avatars.MoveAction, "What to do with impossible avatar moves (clamp, reject)")
+		
+		// Sync protocol configuration flags
+		syncProtocol := flag.String("sync-protocol", c.Sync.Protocol, "HD1-VSC sync protocol version")
+		syncInterval := flag.Duration("sync-interval", c.Sync.SyncInterval, "Sync broadcast interval")
+		maxDeltaLog := flag.Int("sync-max-delta-log", c.Sync.MaxDeltaLog, "Max delta operations to keep")
+		checksumAlgorithm := flag.String("sync-checksum-algorithm", c.Sync.ChecksumAlgorithm, "Checksum algorithm (sha256, fnv1a, or hmac-sha256 to sign deltas)")
+		causalityTimeout := flag.Duration("sync-causality-timeout", c.Sync.CausalityTimeout, "Causality timeout")
+		deltaQueueSize := flag.Int("sync-delta-queue-size", c.Sync.DeltaQueueSize, "Delta operation queue size")
+		avatarRegistrySize := flag.Int("sync-avatar-registry-size", c.Sync.AvatarRegistrySize, "Avatar registry size")
+		broadcastWorldBuffer := flag.Int("sync-broadcast-world-buffer", c.Sync.BroadcastWorldBuffer, "Broadcast world buffer size")
+		worldStateCompression := flag.Bool("sync-world-state-compression", c.Sync.WorldStateCompressionEnabled, "Enable world state compression")
+		performanceMetrics := flag.Bool("sync-performance-metrics", c.Sync.PerformanceMetricsEnabled, "Enable sync performance metrics")
+		vectorClockPrecision := flag.Int("sync-vector-clock-precision", c.Sync.VectorClockPrecision, "Vector clock precision bits")
+		consistencyInterval := flag.Duration("sync-consistency-interval", c.Sync.ConsistencyInterval, "Client world checksum challenge interval (0 disables)")
+		transactionTimeout := flag.Duration("sync-transaction-timeout", c.Sync.TransactionTimeout, "How long a scene transaction may stay open before it rolls back")
+		transactionMaxOperations := flag.Int("sync-transaction-max-operations", c.Sync.TransactionMaxOperations, "Operations one scene transaction may queue")
+		replayWindow := flag.Int("sync-replay-window", c.Sync.ReplayWindow, "Nonces below a session's highest that signed deltas may still use")
+		
+		// Storage configuration flags (secrets are environment-only)
+		storageBackend := flag.String("storage-backend", c.Storage.Backend, "Storage backend (filesystem, s3, gcs)")
+		storageDir := flag.String("storage-dir", c.Storage.Dir, "Filesystem storage root directory")
+		storageBucket := flag.String("storage-bucket", c.Storage.Bucket, "Object storage bucket")
+		storageRegion := flag.String("storage-region", c.Storage.Region, "Object storage region")
+		storageEndpoint := flag.String("storage-endpoint", c.Storage.Endpoint, "S3-compatible endpoint URL")
+		storagePrefix := flag.String("storage-prefix", c.Storage.Prefix, "Object key prefix")
+		storagePathStyle := flag.Bool("storage-path-style", c.Storage.PathStyle, "Use path-style bucket addressing")
+		storageSignedURLTTL := flag.Duration("storage-signed-url-ttl", c.Storage.SignedURLTTL, "Default signed URL lifetime")
+		storageEncryptionProvider := flag.String("storage-encryption-provider", c.Storage.EncryptionProvider, "At-rest encryption key provider (static or a KMS plugin, empty disables)")
+		storageEncryptionNamespaces := flag.String("storage-encryption-namespaces", strings.Join(c.Storage.EncryptionNamespaces, ","), "Comma-separated storage namespaces encrypted at rest")
+		storageEncryptionMigrate := flag.Bool("storage-encryption-migrate", c.Storage.EncryptionMigrate, "Read objects stored before encryption was enabled, re-encrypting them")
+		
+		// Asset store configuration flags
+		assetsMaxUploadSize := flag.Int64("assets-max-upload-size", c.Assets.MaxUploadSize, "Maximum asset upload size in bytes")
+		assetsGCInterval := flag.Duration("assets-gc-interval", c.Assets.GCInterval, "Asset garbage collection interval (0 disables)")
+		assetsGCGracePeriod := flag.Duration("assets-gc-grace-period", c.Assets.GCGracePeriod, "Minimum age before unreferenced assets are reclaimed")
+		assetsPipelineEnabled := flag.Bool("assets-pipeline", c.Assets.PipelineEnabled, "Enable GLB optimization pipeline")
+		assetsPipelineWorkers := flag.Int("assets-pipeline-workers", c.Assets.PipelineWorkers, "Concurrent asset optimization jobs")
+		assetsPipelineTool := flag.String("assets-pipeline-tool", c.Assets.PipelineTool, "gltf-transform executable")
+		assetsPipelineTimeout := flag.Duration("assets-pipeline-timeout", c.Assets.PipelineTimeout, "Asset optimization step timeout")
+		assetsPointCloudWorkers := flag.Int("assets-pointcloud-workers", c.Assets.PointCloudWorkers, "Concurrent point cloud tiling jobs")
+		assetsPointCloudNodePoints := flag.Int("assets-pointcloud-node-points", c.Assets.PointCloudNodePoints, "Points per point cloud octree tile")
+		assetsPointCloudMaxPoints := flag.Int("assets-pointcloud-max-points", c.Assets.PointCloudMaxPoints, "Largest point cloud tiled, in points")
+		assetsScanBackend := flag.String("assets-scan-backend", c.Assets.ScanBackend, "Upload malware scanner (none, clamd, http)")
+		assetsScanAddress := flag.String("assets-scan-address", c.Assets.ScanAddress, "clamd socket or host:port, or HTTP scanner URL")
+		assetsScanTimeout := flag.Duration("assets-scan-timeout", c.Assets.ScanTimeout, "Per-upload scan timeout")
+		
+		// Client capability tier flags
+		clientsHighUpdateRate := flag.Int("clients-high-update-rate", c.Clients.HighUpdateRate, "Avatar updates per second for high-tier clients")
+		clientsStandardUpdateRate := flag.Int("clients-standard-update-rate", c.Clients.StandardUpdateRate, "Avatar updates per second for standard-tier clients")
+		clientsLowUpdateRate := flag.Int("clients-low-update-rate", c.Clients.LowUpdateRate, "Avatar updates per second for low-tier clients")
+		clientsHighTextureSize := flag.Int("clients-high-texture-size", c.Clients.HighTextureSize, "Texture size cap for high-tier clients")
+		clientsStandardTextureSize := flag.Int("clients-standard-texture-size", c.Clients.StandardTextureSize, "Texture size cap for standard-tier clients")
+		clientsLowTextureSize := flag.Int("clients-low-texture-size", c.Clients.LowTextureSize, "Texture size cap for low-tier clients")
+		
+		// XR pose channel flags
+		xrPoseRate := flag.Int("xr-pose-rate", c.XR.PoseRate, "XR pose relays per second to each client")
+		xrKeyframeInterval := flag.Duration("xr-keyframe-interval", c.XR.KeyframeInterval, "Interval between full XR pose resends")
+		
+		// Accessibility flags
+		accessibilityCaptionMaxLength := flag.Int("accessibility-caption-max-length", c.Accessibility.CaptionMaxLength, "Maximum characters per relayed caption")
+		accessibilityCaptionRate := flag.Int("accessibility-caption-rate", c.Accessibility.CaptionRate, "Interim captions relayed per second per speaker")
+		
+		// Entity ID issuance flags
+		entitiesAllowClientIDs := flag.Bool("entities-allow-client-ids", c.Entities.AllowClientIDs, "Accept client-suggested entity IDs")
+		entitiesIDConflict := flag.String("entities-id-conflict", c.Entities.IDConflict, "Suggested entity ID conflict handling (reject, reissue)")
+		entitiesCreateRate := flag.Int("entities-create-rate", c.Entities.CreateRate, "Entities a session may create per minute (0 for no limit)")
+		entitiesMaxPerSession := flag.Int("entities-max-per-session", c.Entities.MaxPerSession, "Live entities per session (0 for no limit)")
+		entitiesMaxTriangles := flag.Int("entities-max-triangles", c.Entities.MaxTriangles, "Estimated triangles per session (0 for no limit)")
+		entitiesPenalty := flag.Duration("entities-penalty", c.Entities.Penalty, "Block after a repeated budget violation, doubling per strike")
+		entitiesPenaltyMax := flag.Duration("entities-penalty-max", c.Entities.PenaltyMax, "Longest creation block")
+		
+		// Compression configuration flags
+		compressionEnabled := flag.Bool("compression", c.Compression.Enabled, "Compress text responses with brotli or gzip")
+		compressionMinSize := flag.Int("compression-min-size", c.Compression.MinSize, "Smallest response body to compress, in bytes")
+		compressionTypes := flag.String("compression-types", strings.Join(c.Compression.Types, ","), "Comma-separated compressible media types (type/* for a family)")
+		
+		// Feature flag flags
+		featuresFile := flag.String("features-file", c.Features.File, "Feature flag definitions (JSON)")
+		featuresEnabled := flag.String("features", strings.Join(c.Features.Enabled, ","), "Comma-separated flags to switch on (name) or off (-name) for everyone")
+		featuresURL := flag.String("features-url", c.Features.URL, "Remote feature flag provider URL")
+		featuresRefresh := flag.Duration("features-refresh", c.Features.Refresh, "Remote feature flag poll interval")
+		moderationPolicyFile := flag.String("moderation-policy-file", c.Moderation.PolicyFile, "Content screening policies (JSON)")
+		
+		// Environment flags
+		environmentDayLength := flag.Duration("environment-day-length", c.Environment.DayLength, "Real time per in-world day (0 stops the clock)")
+		environmentWeatherInterval := flag.Duration("environment-weather-interval", c.Environment.WeatherInterval, "Average time between weather changes (0 keeps the weather)")
+		environmentWeathers := flag.String("environment-weathers", strings.Join(c.Environment.Weathers, ","), "Comma-separated weather states the cycle may pick")
+		
+		// Media flags
+		mediaAllowedHosts := flag.String("media-allowed-hosts", strings.Join(c.Media.AllowedHosts, ","), "Comma-separated hosts media streams may be played from (empty allows any)")
+		
+		// Bookings flags
+		bookingsWebhookURL := flag.String("bookings-webhook-url", c.Bookings.WebhookURL, "URL receiving reminders before booked sessions")
+		bookingsTick := flag.Duration("bookings-tick", c.Bookings.Tick, "How often due booking reminders are sent")
+		bookingsMaxPerWorld := flag.Int("bookings-max-per-world", c.Bookings.MaxPerWorld, "Bookings a world may hold")
+		
+		// Guests flags
+		guestsRequireLink := flag.Bool("guests-require-link", c.Guests.RequireLink, "Admit remote sessions only through guest links")
+		guestsDefaultLifetime := flag.Duration("guests-default-lifetime", c.Guests.DefaultLifetime, "Lifetime of guest links created without one")
+		
+		// Email flags
+		emailSMTPHost := flag.String("email-smtp-host", c.Email.SMTPHost, "SMTP server sending email (none when empty)")
+		emailSMTPPort := flag.Int("email-smtp-port", c.Email.SMTPPort, "SMTP server port")
+		emailTLS := flag.String("email-tls", c.Email.TLS, "SMTP transport security: starttls, tls or none")
+		emailFrom := flag.String("email-from", c.Email.From, "Sender address of email")
+		emailRatePerHour := flag.Int("email-rate-per-hour", c.Email.RatePerHour, "Email messages an organization may send per hour (0 for no limit)")
+		emailOrgFile := flag.String("email-org-file", c.Email.OrgFile, "Per-organization email settings (JSON)")
+		emailTemplatesDir := flag.String("email-templates-dir", c.Email.TemplatesDir, "Directory of email templates overriding the embedded ones")
+		emailSecurityContacts := flag.String("email-security-contacts", strings.Join(c.Email.SecurityContacts, ","), "Comma-separated addresses receiving security alerts")
+		
+		// Connectors flags
+		connectorsFile := flag.String("connectors-file", c.Connectors.File, "Per-organization Slack and Teams connectors (JSON)")
+		connectorsCapacity := flag.Int("connectors-capacity", c.Connectors.Capacity, "Sessions of an organization at which connectors report capacity reached (0 for none)")
+		connectorsCooldown := flag.Duration("connectors-cooldown", c.Connectors.Cooldown, "How long a connector drops repeats of an event")
+		
+		// Bindings flags
+		bindingsTick := flag.Duration("bindings-tick", c.Bindings.Tick, "How often entity property bindings are evaluated (0 disables)")
+		
+		// Imports flags
+		importsTool := flag.String("imports-tool", c.Imports.Tool, "assimp executable converting CAD formats for import")
+		importsWorkers := flag.Int("imports-workers", c.Imports.Workers, "Concurrent model import jobs")
+		importsTimeout := flag.Duration("imports-timeout", c.Imports.Timeout, "Model import conversion timeout")
+		importsMaxEntities := flag.Int("imports-max-entities", c.Imports.MaxEntities, "Entities one model import may create")
+		
+		// Geo flags
+		geoImageryURL := flag.String("geo-imagery-url", c.Geo.ImageryURL, "Map tile URL template with {z}, {x} and {y}, empty for none")
+		geoElevationURL := flag.String("geo-elevation-url", c.Geo.ElevationURL, "Elevation tile URL template, empty for flat ground")
+		geoElevationEncoding := flag.String("geo-elevation-encoding", c.Geo.ElevationEncoding, "Elevation tile encoding (terrarium or mapbox)")
+		geoAttribution := flag.String("geo-attribution", c.Geo.Attribution, "Credit shown for the tile providers")
+		geoMaxTiles := flag.Int("geo-max-tiles", c.Geo.MaxTiles, "Ground tiles one request may load")
+		geoTimeout := flag.Duration("geo-timeout", c.Geo.Timeout, "Per-tile provider fetch timeout")
+		
+		// Simulation flags
+		simulationTick := flag.Duration("simulation-tick", c.Simulation.Tick, "Server tick loop period while clients are connected")
+		simulationIdleTick := flag.Duration("simulation-idle-tick", c.Simulation.IdleTick, "Server tick loop period with no clients connected")
+		
+		// Budgets flags
+		budgetsMaxEntities := flag.Int("budgets-max-entities", c.Budgets.MaxEntities, "Live entities a world may hold (0 for no limit)")
+		budgetsMaxMemory := flag.Int64("budgets-max-memory", c.Budgets.MaxMemory, "Estimated bytes of state a world may hold (0 for no limit)")
+		
+		// Hibernation flags
+		hibernationIdle := flag.Duration("hibernation-idle", c.Hibernation.Idle, "Time without clients before a world is unloaded (0 keeps it loaded)")
+		
+		// Webhooks flags
+		webhooksFile := flag.String("webhooks-file", c.Webhooks.File, "Inbound webhook mappings (YAML)")
+		
+		// Forms flags
+		formsFile := flag.String("forms-file", c.Forms.File, "Endpoints form submissions are forwarded to (YAML)")
+		formsTimeout := flag.Duration("forms-timeout", c.Forms.Timeout, "How long forwarding a form submission may take")
+		
+		// Portals flags
+		portalsFile := flag.String("portals-file", c.Portals.File, "Servers of the worlds portals lead to (YAML)")
+		portalsTimeout := flag.Duration("portals-timeout", c.Portals.Timeout, "How long handing an avatar to another server may take")
+		
+		// Consent flags
+		consentFile := flag.String("consent-file", c.Consent.File, "Terms and policies people accept, and which joining requires (YAML)")
+		
+		// Impersonation flags
+		impersonationMaxDuration := flag.Duration("impersonation-max-duration", c.Impersonation.MaxDuration, "Longest support staff may act as a session at a time")
+		
+		// API usage flags
+		apiUsageMaxKeys := flag.Int("api-usage-max-keys", c.APIUsage.MaxKeys, "API keys usage is counted for, across organizations")
+		
+		// Telemetry flags
+		telemetryInterval := flag.Duration("telemetry-interval", c.Telemetry.Interval, "How often consoles report frame telemetry (0 = never)")
+		telemetryTargetFPS := flag.Int("telemetry-target-fps", c.Telemetry.TargetFPS, "Frame rate below which telemetry counts a console as over budget")
+		
+		// Quality flags
+		qualityAdaptive := flag.Bool("quality-adaptive", c.Quality.Adaptive, "Tell consoles under the target frame rate to render less")
+		qualityCullDistance := flag.Float64("quality-cull-distance", c.Quality.CullDistance, "Metres beyond which the most degraded consoles cull entities")
+		
+		// Crowd flags
+		crowdThreshold := flag.Int("crowd-threshold", c.Crowd.Threshold, "Avatars in a world that make it a crowd (0 = never)")
+		crowdNearDistance := flag.Float64("crowd-near-distance", c.Crowd.NearDistance, "Metres within which crowd avatars are drawn and moved in full")
+		crowdFarUpdateRate := flag.Int("crowd-far-update-rate", c.Crowd.FarUpdateRate, "Moves a second clients receive of crowd avatars further away")
+		
+		// Spectators flags
+		spectatorsEnabled := flag.Bool("spectators-enabled", c.Spectators.Enabled, "Let clients join as spectators, without an avatar")
+		spectatorsMax := flag.Int("spectators-max", c.Spectators.Max, "Spectators connected at once (0 = unlimited)")
+		
+		// Broadcast flags
+		broadcastMax := flag.Int("broadcast-max", c.Broadcast.Max, "Broadcasts to RTMP or WHIP endpoints at once (0 = none)")
+		broadcastFFmpeg := flag.String("broadcast-ffmpeg", c.Broadcast.FFmpeg, "FFmpeg executable encoding broadcasts")
+		broadcastRenderCommand := flag.String("broadcast-render-command", c.Broadcast.RenderCommand, "Command launching a broadcast's render client at {url}")
+		broadcastWidth := flag.Int("broadcast-width", c.Broadcast.Width, "Broadcast width in pixels")
+		broadcastHeight := flag.Int("broadcast-height", c.Broadcast.Height, "Broadcast height in pixels")
+		broadcastFrameRate := flag.Int("broadcast-frame-rate", c.Broadcast.FrameRate, "Broadcast frames a second")
+		broadcastBitrate := flag.Int("broadcast-bitrate", c.Broadcast.Bitrate, "Broadcast video kilobits a second")
+		
+		// Quotas flags
+		quotasFile := flag.String("quotas-file", c.Quotas.File, "Plans and the request quotas they allow (YAML)")
+		
+		// Chunks flags
+		chunksSize := flag.Float64("chunks-size", c.Chunks.Size, "Metres along each world streaming chunk edge (0 = send whole worlds)")
+		chunksRadius := flag.Int("chunks-radius", c.Chunks.Radius, "Chunks loaded around each client's avatar")
+		
+		// Components flags
+		componentsDir := flag.String("components-dir", c.Components.Dir, "Schemas of entity components plugins add (YAML or JSON)")
+		componentsStrict := flag.Bool("components-strict", c.Components.Strict, "Refuse entity components without a schema")
+		
+		// Hooks flags
+		hooksFile := flag.String("hooks-file", c.Hooks.File, "Commands run at lifecycle points (YAML)")
+		
+		flag.Parse()
+		
+		// Apply flag values (short flags take precedence over long flags)
+		if *hostShort != c.Server.Host {
+			c.Server.Host = *hostShort
+		} else {
+			c.Server.Host = *host
+		}
+		if *portShort != c.Server.Port {
+			c.Server.Port = *portShort
+		} else {
+			c.Server.Port = *port
+		}
+		if *listen != "" {
+			c.Server.Listen = strings.Split(*listen, ",")
+		}
+		c.Server.SocketMode = *socketMode
+		c.Server.SocketOperators = *socketOperators
+		c.Server.TLSCert = *tlsCert
+		c.Server.TLSKey = *tlsKey
+		if *trustedProxies != "" {
+			c.Server.TrustedProxies = strings.Split(*trustedProxies, ",")
+		}
+		if *daemonShort != c.Server.Daemon {
+			c.Server.Daemon = *daemonShort
+		} else {
+			c.Server.Daemon = *daemon
+		}
+		if *apiBase != "" {
+			c.Server.APIBase = *apiBase
+			c.Client.APIBase = *apiBase
+		}
+		if *internalAPIBase != "" {
+			c.Server.InternalAPIBase = *internalAPIBase
+		}
+		if *versionShort != c.Server.Version {
+			c.Server.Version = *versionShort
+		} else if *version != "" {
+			c.Server.Version = *version
+		}
+		c.Paths.RootDir = *rootDir
+		c.Paths.BuildDir = *buildDir
+		c.Paths.LogDir = *logDir
+		c.Logging.LogDir = *logDir
+		c.Server.StaticDir = *staticDir
+		c.Server.StaticDevMode = *staticDevMode
+		c.Server.StaticSource = *staticSource
+		c.Paths.PIDFile = *pidFile
+		c.Logging.LogFile = *logFile
+		c.Logging.Level = *logLevel
+		c.Logging.Format = *logFormat
+		c.Server.ShutdownTimeout = *shutdownTimeout
+		if *traceModules != "" {
+			c.Logging.TraceModules = strings.Split(*traceModules, ",")
+		}
+		if *protectedWorlds != "" {
+			c.Worlds.ProtectedList = strings.Split(*protectedWorlds, ",")
+		}
+		if *preloadWorlds != "" {
+			c.Worlds.Preload = strings.Split(*preloadWorlds, ",")
+		}
+		
+		// Apply extended configuration flags
+		c.Paths.WorldsDir = *worldsDir
+		c.Paths.AvatarsDir = *avatarsDir
+		c.Paths.RecordingsDir = *recordingsDir
+		c.Paths.TemplatesDir = *templatesDir
+		c.Paths.LocalesDir = *localesDir
+		c.Client.Locale = *clientLocale
+		c.Worlds.DefaultWorld = *defaultWorld
+		c.Worlds.AutoJoinOnCreate = *autoJoinOnCreate
+		c.Worlds.SyncOnJoin = *syncOnJoin
+		
+		// Apply WebSocket configuration
+		c.WebSocket.WriteTimeout = *writeTimeout
+		c.WebSocket.PongTimeout = *pongTimeout
+		c.WebSocket.PingPeriod = *pingPeriod
+		c.WebSocket.MaxMessageSize = *maxMessageSize
+		c.WebSocket.ReadBufferSize = *readBufferSize
+		c.WebSocket.WriteBufferSize = *writeBufferSize
+		c.WebSocket.AssetChunkSize = *assetChunkSize
+		c.WebSocket.MaxAssetStreams = *maxAssetStreams
+		if *allowedOrigins != "" {
+			c.WebSocket.AllowedOrigins = strings.Split(*allowedOrigins, ",")
+		}
+		
+		// Apply Session configuration
+		c.Session.CleanupInterval = *cleanupInterval
+		c.Session.InactivityTimeout = *inactivityTimeout
+		c.Session.HTTPClientTimeout = *httpClientTimeout
+		c.Session.TokenTTL = *sessionTokenTTL
+		c.Session.StaleAfter = *sessionStaleAfter
+		c.Session.DeactivateAfter = *sessionDeactivateAfter
+		
+		// Apply Avatar configuration
+		c.Avatars.MaxConcurrentCreations = *maxConcurrentCreations
+		c.Avatars.HealthCheckInterval = *healthCheckInterval
+		c.Avatars.PositionUpdateThrottle = *positionUpdateThrottle
+		c.Avatars.MaxReconnectAttempts = *maxReconnectAttempts
+		c.Avatars.ReconnectDelay = *reconnectDelay
+		c.Avatars.MaxReconnectDelay = *maxReconnectDelay
+		c.Avatars.HeartbeatFrequency = *heartbeatFrequency
+		c.Avatars.IdleTimeout = *avatarIdleTimeout
+		c.Avatars.MaxSpeed = *avatarMaxSpeed
+		c.Avatars.MaxStep = *avatarMaxStep
+		c.Avatars.MoveAction = *avatarMoveAction
+		
+		// Apply Sync protocol configuration
+		c.Sync.Protocol = *syncProtocol
+		c.Sync.SyncInterval = *syncInterval
+		c.Sync.MaxDeltaLog = *maxDeltaLog
+		c.Sync.ChecksumAlgorithm = *checksumAlgorithm
+		c.Sync.CausalityTimeout = *causalityTimeout
+		c.Sync.DeltaQueueSize = *deltaQueueSize
+		c.Sync.AvatarRegistrySize = *avatarRegistrySize
+		c.Sync.BroadcastWorldBuffer = *broadcastWorldBuffer
+		c.Sync.WorldStateCompressionEnabled = *worldStateCompression
+		c.Sync.PerformanceMetricsEnabled = *performanceMetrics
+		c.Sync.VectorClockPrecision = *vectorClockPrecision
+		c.Sync.ConsistencyInterval = *consistencyInterval
+		c.Sync.TransactionTimeout = *transactionTimeout
+		c.Sync.TransactionMaxOperations = *transactionMaxOperations
+		c.Sync.ReplayWindow = *replayWindow
+		
+		// Apply Storage configuration
+		c.Storage.Backend = *storageBackend
+		c.Storage.Dir = *storageDir
+		c.Storage.Bucket = *storageBucket
+		c.Storage.Region = *storageRegion
+		c.Storage.Endpoint = *storageEndpoint
+		c.Storage.Prefix = *storagePrefix
+		c.Storage.PathStyle = *storagePathStyle
+		c.Storage.SignedURLTTL = *storageSignedURLTTL
+		c.Storage.EncryptionProvider = *storageEncryptionProvider
+		if *storageEncryptionNamespaces != "" {
+			c.Storage.EncryptionNamespaces = strings.Split(*storageEncryptionNamespaces, ",")
+		}
+		c.Storage.EncryptionMigrate = *storageEncryptionMigrate
+		
+		// Apply Asset store configuration
+		c.Assets.MaxUploadSize = *assetsMaxUploadSize
+		c.Assets.GCInterval = *assetsGCInterval
+		c.Assets.GCGracePeriod = *assetsGCGracePeriod
+		c.Assets.PipelineEnabled = *assetsPipelineEnabled
+		c.Assets.PipelineWorkers = *assetsPipelineWorkers
+		c.Assets.PipelineTool = *assetsPipelineTool
+		c.Assets.PipelineTimeout = *assetsPipelineTimeout
+		c.Assets.PointCloudWorkers = *assetsPointCloudWorkers
+		c.Assets.PointCloudNodePoints = *assetsPointCloudNodePoints
+		c.Assets.PointCloudMaxPoints = *assetsPointCloudMaxPoints
+		c.Assets.ScanBackend = *assetsScanBackend
+		c.Assets.ScanAddress = *assetsScanAddress
+		c.Assets.ScanTimeout = *assetsScanTimeout
+		
+		// Apply client capability tiers
+		c.Clients.HighUpdateRate = *clientsHighUpdateRate
+		c.Clients.StandardUpdateRate = *clientsStandardUpdateRate
+		c.Clients.LowUpdateRate = *clientsLowUpdateRate
+		c.Clients.HighTextureSize = *clientsHighTextureSize
+		c.Clients.StandardTextureSize = *clientsStandardTextureSize
+		c.Clients.LowTextureSize = *clientsLowTextureSize
+		
+		// Apply XR pose channel configuration
+		c.XR.PoseRate = *xrPoseRate
+		c.XR.KeyframeInterval = *xrKeyframeInterval
+		
+		// Apply accessibility configuration
+		c.Accessibility.CaptionMaxLength = *accessibilityCaptionMaxLength
+		c.Accessibility.CaptionRate = *accessibilityCaptionRate
+		
+		// Apply entity ID issuance configuration
+		c.Entities.AllowClientIDs = *entitiesAllowClientIDs
+		c.Entities.IDConflict = *entitiesIDConflict
+		c.Entities.CreateRate = *entitiesCreateRate
+		c.Entities.MaxPerSession = *entitiesMaxPerSession
+		c.Entities.MaxTriangles = *entitiesMaxTriangles
+		c.Entities.Penalty = *entitiesPenalty
+		c.Entities.PenaltyMax = *entitiesPenaltyMax
+		
+		// Apply Compression configuration
+		c.Compression.Enabled = *compressionEnabled
+		c.Compression.MinSize = *compressionMinSize
+		if *compressionTypes != "" {
+			c.Compression.Types = strings.Split(*compressionTypes, ",")
+		}
+		
+		// Apply feature flag configuration
+		c.Features.File = *featuresFile
+		if *featuresEnabled != "" {
+			c.Features.Enabled = strings.Split(*featuresEnabled, ",")
+		}
+		c.Features.URL = *featuresURL
+		c.Features.Refresh = *featuresRefresh
+		c.Moderation.PolicyFile = *moderationPolicyFile
+		
+		// Apply Environment configuration
+		c.Environment.DayLength = *environmentDayLength
+		c.Environment.WeatherInterval = *environmentWeatherInterval
+		c.Environment.Weathers = strings.Split(*environmentWeathers, ",")
+		
+		// Apply Media configuration
+		c.Media.AllowedHosts = strings.Split(*mediaAllowedHosts, ",")
+		
+		// Apply Bookings configuration
+		c.Bookings.WebhookURL = *bookingsWebhookURL
+		c.Bookings.Tick = *bookingsTick
+		c.Bookings.MaxPerWorld = *bookingsMaxPerWorld
+		
+		// Apply Guests configuration
+		c.Guests.RequireLink = *guestsRequireLink
+		c.Guests.DefaultLifetime = *guestsDefaultLifetime
+		
+		// Apply Email configuration
+		c.Email.SMTPHost = *emailSMTPHost
+		c.Email.SMTPPort = *emailSMTPPort
+		c.Email.TLS = *emailTLS
+		c.Email.From = *emailFrom
+		c.Email.RatePerHour = *emailRatePerHour
+		c.Email.OrgFile = *emailOrgFile
+		c.Email.TemplatesDir = *emailTemplatesDir
+		c.Email.SecurityContacts = strings.Split(*emailSecurityContacts, ",")
+		
+		// Apply Connectors configuration
+		c.Connectors.File = *connectorsFile
+		c.Connectors.Capacity = *connectorsCapacity
+		c.Connectors.Cooldown = *connectorsCooldown
+		
+		// Apply Bindings configuration
+		c.Bindings.Tick = *bindingsTick
+		
+		// Apply Imports configuration
+		c.Imports.Tool = *importsTool
+		c.Imports.Workers = *importsWorkers
+		c.Imports.Timeout = *importsTimeout
+		c.Imports.MaxEntities = *importsMaxEntities
+		
+		// Apply Geo configuration
+		c.Geo.ImageryURL = *geoImageryURL
+		c.Geo.ElevationURL = *geoElevationURL
+		c.Geo.ElevationEncoding = *geoElevationEncoding
+		c.Geo.Attribution = *geoAttribution
+		c.Geo.MaxTiles = *geoMaxTiles
+		c.Geo.Timeout = *geoTimeout
+		
+		// Apply Simulation configuration
+		c.Simulation.Tick = *simulationTick
+		c.Simulation.IdleTick = *simulationIdleTick
+		
+		// Apply Budgets configuration
+		c.Budgets.MaxEntities = *budgetsMaxEntities
+		c.Budgets.MaxMemory = *budgetsMaxMemory
+		
+		// Apply Hibernation configuration
+		c.Hibernation.Idle = *hibernationIdle
+		
+		// Apply Webhooks configuration
+		c.Webhooks.File = *webhooksFile
+		
+		// Apply Forms configuration
+		c.Forms.File = *formsFile
+		c.Forms.Timeout = *formsTimeout
+		
+		// Apply Portals configuration
+		c.Portals.File = *portalsFile
+		c.Portals.Timeout = *portalsTimeout
+		
+		// Apply Consent configuration
+		c.Consent.File = *consentFile
+		
+		// Apply Impersonation configuration
+		c.Impersonation.MaxDuration = *impersonationMaxDuration
+		
+		// Apply API usage configuration
+		c.APIUsage.MaxKeys = *apiUsageMaxKeys
+		
+		// Apply Telemetry configuration
+		c.Telemetry.Interval = *telemetryInterval
+		c.Telemetry.TargetFPS = *telemetryTargetFPS
+		
+		// Apply Quality configuration
+		c.Quality.Adaptive = *qualityAdaptive
+		c.Quality.CullDistance = *qualityCullDistance
+		
+		// Apply Crowd configuration
+		c.Crowd.Threshold = *crowdThreshold
+		c.Crowd.NearDistance = *crowdNearDistance
+		c.Crowd.FarUpdateRate = *crowdFarUpdateRate
+		
+		// Apply Spectators configuration
+		c.Spectators.Enabled = *spectatorsEnabled
+		c.Spectators.Max = *spectatorsMax
+		
+		// Apply Broadcast configuration
+		c.Broadcast.Max = *broadcastMax
+		c.Broadcast.FFmpeg = *broadcastFFmpeg
+		c.Broadcast.RenderCommand = *broadcastRenderCommand
+		c.Broadcast.Width = *broadcastWidth
+		c.Broadcast.Height = *broadcastHeight
+		c.Broadcast.FrameRate = *broadcastFrameRate
+		c.Broadcast.Bitrate = *broadcastBitrate
+		
+		// Apply Quotas configuration
+		c.Quotas.File = *quotasFile
+		
+		// Apply Chunks configuration
+		c.Chunks.Size = *chunksSize
+		c.Chunks.Radius = *chunksRadius
+		
+		// Apply Components configuration
+		c.Components.Dir = *componentsDir
+		c.Components.Strict = *componentsStrict
+		
+		// Apply Hooks configuration
+		c.Hooks.File = *hooksFile
+		
+		// Recompute derived paths if root changed
+		c.calculate_dependent_directory_paths()
+	}
+}
+
+// calculate_dependent_directory_paths calculates dependent paths from root directory
+func (c *HD1Config) calculate_dependent_directory_paths() {
+	// Use configuration-driven install prefix detection
+	installPrefix := c.getInstallPrefix()
+	
+	if c.Paths.BuildDir == "" || strings.HasPrefix(c.Paths.BuildDir, installPrefix) {
+		c.Paths.BuildDir = filepath.Join(c.Paths.RootDir, "build")
+	}
+	if c.Paths.BinDir == "" || strings.HasPrefix(c.Paths.BinDir, installPrefix) {
+		c.Paths.BinDir = filepath.Join(c.Paths.BuildDir, "bin")
+	}
+	if c.Paths.LogDir == "" || strings.HasPrefix(c.Paths.LogDir, installPrefix) {
+		c.Paths.LogDir = filepath.Join(c.Paths.BuildDir, "logs")
+		c.Logging.LogDir = c.Paths.LogDir
+	}
+	if c.Paths.RuntimeDir == "" || strings.HasPrefix(c.Paths.RuntimeDir, installPrefix) {
+		c.Paths.RuntimeDir = filepath.Join(c.Paths.BuildDir, "runtime")
+	}
+	if c.Paths.ShareDir == "" || strings.HasPrefix(c.Paths.ShareDir, installPrefix) {
+		c.Paths.ShareDir = filepath.Join(c.Paths.RootDir, "share")
+	}
+	if c.Paths.HtDocsDir == "" || strings.HasPrefix(c.Paths.HtDocsDir, installPrefix) {
+		c.Paths.HtDocsDir = filepath.Join(c.Paths.ShareDir, "htdocs")
+	}
+	if c.Paths.PIDFile == "" || strings.HasPrefix(c.Paths.PIDFile, installPrefix) {
+		c.Paths.PIDFile = filepath.Join(c.Paths.RuntimeDir, "hd1.pid")
+	}
+	if c.Server.StaticDir == "" || strings.HasPrefix(c.Server.StaticDir, installPrefix) {
+		c.Server.StaticDir = filepath.Join(c.Paths.HtDocsDir, "static")
+	}
+	if c.Paths.WorldsDir == "" || strings.HasPrefix(c.Paths.WorldsDir, installPrefix) {
+		c.Paths.WorldsDir = filepath.Join(c.Paths.ShareDir, "worlds")
+	}
+	if c.Paths.AvatarsDir == "" || strings.HasPrefix(c.Paths.AvatarsDir, installPrefix) {
+		c.Paths.AvatarsDir = filepath.Join(c.Paths.ShareDir, "avatars")
+	}
+	if c.Storage.Dir == "" || strings.HasPrefix(c.Storage.Dir, installPrefix) {
+		c.Storage.Dir = filepath.Join(c.Paths.RootDir, "storage")
+	}
+	if c.Features.File == "" || strings.HasPrefix(c.Features.File, installPrefix) {
+		c.Features.File = filepath.Join(c.Paths.ShareDir, "features.json")
+	}
+	if c.Moderation.PolicyFile == "" || strings.HasPrefix(c.Moderation.PolicyFile, installPrefix) {
+		c.Moderation.PolicyFile = filepath.Join(c.Paths.ShareDir, "content-policy.json")
+	}
+	if c.Email.OrgFile == "" || strings.HasPrefix(c.Email.OrgFile, installPrefix) {
+		c.Email.OrgFile = filepath.Join(c.Paths.ShareDir, "email.json")
+	}
+	if c.Connectors.File == "" || strings.HasPrefix(c.Connectors.File, installPrefix) {
+		c.Connectors.File = filepath.Join(c.Paths.ShareDir, "connectors.json")
+	}
+	if c.Webhooks.File == "" || strings.HasPrefix(c.Webhooks.File, installPrefix) {
+		c.Webhooks.File = filepath.Join(c.Paths.ShareDir, "webhooks.yaml")
+	}
+	if c.Forms.File == "" || strings.HasPrefix(c.Forms.File, installPrefix) {
+		c.Forms.File = filepath.Join(c.Paths.ShareDir, "forms.yaml")
+	}
+	if c.Portals.File == "" || strings.HasPrefix(c.Portals.File, installPrefix) {
+		c.Portals.File = filepath.Join(c.Paths.ShareDir, "portals.yaml")
+	}
+	if c.Consent.File == "" || strings.HasPrefix(c.Consent.File, installPrefix) {
+		c.Consent.File = filepath.Join(c.Paths.ShareDir, "consent.yaml")
+	}
+	if c.Quotas.File == "" || strings.HasPrefix(c.Quotas.File, installPrefix) {
+		c.Quotas.File = filepath.Join(c.Paths.ShareDir, "plans.yaml")
+	}
+	if c.Components.Dir == "" || strings.HasPrefix(c.Components.Dir, installPrefix) {
+		c.Components.Dir = filepath.Join(c.Paths.ShareDir, "components")
+	}
+	if c.Hooks.File == "" || strings.HasPrefix(c.Hooks.File, installPrefix) {
+		c.Hooks.File = filepath.Join(c.Paths.ShareDir, "hooks.yaml")
+	}
+}
+
+// parseWorldDurations parses "world=duration" pairs separated by commas
+func parseWorldDurations(value string) (map[string]time.Duration, error) {
+	durations := map[string]time.Duration{}
+	for _, pair := range strings.Split(value, ",") {
+		world, duration, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found || world == "" {
+			return nil, fmt.Errorf("invalid world duration: %q", pair)
+		}
+		parsed, err := time.ParseDuration(duration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid world duration: %q", pair)
+		}
+		durations[world] = parsed
+	}
+	return durations, nil
+}
+
+// parseWorldCounts parses "world=count" pairs separated by commas
+func parseWorldCounts(value string) (map[string]int64, error) {
+	counts := map[string]int64{}
+	for _, pair := range strings.Split(value, ",") {
+		world, count, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found || world == "" {
+			return nil, fmt.Errorf("invalid world count: %q", pair)
+		}
+		parsed, err := strconv.ParseInt(count, 10, 64)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid world count: %q", pair)
+		}
+		counts[world] = parsed
+	}
+	return counts, nil
+}
+
+// parseWorldFactors parses "world=factor" pairs separated by commas
+func parseWorldFactors(value string) (map[string]float64, error) {
+	factors := map[string]float64{}
+	for _, pair := range strings.Split(value, ",") {
+		world, factor, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found || world == "" {
+			return nil, fmt.Errorf("invalid world factor: %q", pair)
+		}
+		parsed, err := strconv.ParseFloat(factor, 64)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid world factor: %q", pair)
+		}
+		factors[world] = parsed
+	}
+	return factors, nil
+}
+
+// getInstallPrefix returns the current install prefix for path detection
+func (c *HD1Config) getInstallPrefix() string {
+	// If RootDir is set and different from default, use it as prefix
+	if c.Paths.RootDir != "" && c.Paths.RootDir != DefaultInstallPrefix {
+		return c.Paths.RootDir
+	}
+	return DefaultInstallPrefix
+}
+
+// validate ensures configuration is valid and complete
+func (c *HD1Config) validate() error {
+	// Validate required paths are absolute
+	if !filepath.IsAbs(c.Paths.RootDir) {
+		return fmt.Errorf("root directory must be absolute path: %s", c.Paths.RootDir)
+	}
+	
+	// Trusted proxies are IPs, CIDRs, or "unix" for Unix socket peers
+	for _, proxy := range c.Server.TrustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "unix" || net.ParseIP(proxy) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(proxy); err != nil {
+			return fmt.Errorf("invalid trusted proxy: %q", proxy)
+		}
+	}
+	if (c.Server.TLSCert == "") != (c.Server.TLSKey == "") {
+		return fmt.Errorf("TLS needs both a certificate and a key")
+	}
+	if c.Session.TokenTTL < time.Minute {
+		return fmt.Errorf("session token TTL must be at least 1m: %s", c.Session.TokenTTL)
+	}
+	if c.Avatars.HeartbeatFrequency <= 0 {
+		return fmt.Errorf("avatar heartbeat frequency must be positive: %s", c.Avatars.HeartbeatFrequency)
+	}
+	if c.Session.StaleAfter <= c.Avatars.HeartbeatFrequency {
+		return fmt.Errorf("session stale-after must be longer than the heartbeat frequency (%s): %s", c.Avatars.HeartbeatFrequency, c.Session.StaleAfter)
+	}
+	if c.Session.DeactivateAfter != 0 && c.Session.DeactivateAfter < c.Session.StaleAfter {
+		return fmt.Errorf("session deactivate-after must be 0 or at least stale-after: %s", c.Session.DeactivateAfter)
+	}
+	switch c.Sync.ChecksumAlgorithm {
+	case "sha256", "fnv1a", "hmac-sha256":
+	default:
+		return fmt.Errorf("unknown sync checksum algorithm: %q (sha256, fnv1a or hmac-sha256)", c.Sync.ChecksumAlgorithm)
+	}
+	if c.Sync.TransactionTimeout <= 0 {
+		return fmt.Errorf("sync transaction timeout must be positive: %s", c.Sync.TransactionTimeout)
+	}
+	if c.Sync.TransactionMaxOperations < 1 {
+		return fmt.Errorf("sync transaction max operations must be at least 1: %d", c.Sync.TransactionMaxOperations)
+	}
+	if c.Sync.ReplayWindow < 1 || c.Sync.ReplayWindow > 4096 {
+		return fmt.Errorf("sync replay window must be within 1-4096: %d", c.Sync.ReplayWindow)
+	}
+	if c.Storage.SignedURLTTL < time.Second || c.Storage.SignedURLTTL > time.Hour {
+		return fmt.Errorf("storage signed URL TTL must be between 1s and 1h: %s", c.Storage.SignedURLTTL)
+	}
+	if c.Avatars.IdleTimeout < 0 {
+		return fmt.Errorf("avatar idle timeout must not be negative: %s", c.Avatars.IdleTimeout)
+	}
+	if c.Avatars.MaxSpeed < 0 || c.Avatars.MaxStep < 0 || c.Avatars.MoveTolerance < 0 {
+		return fmt.Errorf("avatar movement limits must not be negative")
+	}
+	if c.Avatars.MoveAction != "clamp" && c.Avatars.MoveAction != "reject" {
+		return fmt.Errorf("unknown avatar move action: %q (clamp or reject)", c.Avatars.MoveAction)
+	}
+	if c.Environment.Tick <= 0 {
+		return fmt.Errorf("environment tick must be positive: %s", c.Environment.Tick)
+	}
+	if c.Environment.DayLength < 0 || c.Environment.WeatherInterval < 0 {
+		return fmt.Errorf("environment cycles must not be negative")
+	}
+	knownWeathers := map[string]bool{"clear": true, "cloudy": true, "fog": true, "rain": true, "storm": true, "snow": true}
+	for i, weather := range c.Environment.Weathers {
+		c.Environment.Weathers[i] = strings.TrimSpace(weather)
+		if !knownWeathers[c.Environment.Weathers[i]] {
+			return fmt.Errorf("unknown weather: %q (clear, cloudy, fog, rain, storm or snow)", weather)
+		}
+	}
+	allowedHosts := []string{}
+	for _, host := range c.Media.AllowedHosts {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			allowedHosts = append(allowedHosts, host)
+		}
+	}
+	c.Media.AllowedHosts = allowedHosts
+	if c.Bookings.WebhookURL != "" {
+		if parsed, err := url.Parse(c.Bookings.WebhookURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("bookings webhook URL must be an http(s) URL: %q", c.Bookings.WebhookURL)
+		}
+	}
+	if c.Bookings.Tick <= 0 {
+		return fmt.Errorf("bookings tick must be positive: %s", c.Bookings.Tick)
+	}
+	if c.Bookings.MaxPerWorld < 1 {
+		return fmt.Errorf("bookings per world must be at least 1: %d", c.Bookings.MaxPerWorld)
+	}
+	if c.Guests.DefaultLifetime <= 0 || c.Guests.DefaultLifetime > 30*24*time.Hour {
+		return fmt.Errorf("guest link default lifetime must be positive and at most 720h: %s", c.Guests.DefaultLifetime)
+	}
+	if c.Email.SMTPPort < 1 || c.Email.SMTPPort > 65535 {
+		return fmt.Errorf("email SMTP port out of range: %d", c.Email.SMTPPort)
+	}
+	if c.Email.TLS != "starttls" && c.Email.TLS != "tls" && c.Email.TLS != "none" {
+		return fmt.Errorf("email TLS must be starttls, tls or none: %q", c.Email.TLS)
+	}
+	if _, err := mail.ParseAddress(c.Email.From); err != nil {
+		return fmt.Errorf("email sender is not an address: %q", c.Email.From)
+	}
+	if c.Email.RatePerHour < 0 {
+		return fmt.Errorf("email rate per hour must not be negative: %d", c.Email.RatePerHour)
+	}
+	securityContacts := []string{}
+	for _, contact := range c.Email.SecurityContacts {
+		if contact = strings.TrimSpace(contact); contact == "" {
+			continue
+		}
+		if _, err := mail.ParseAddress(contact); err != nil {
+			return fmt.Errorf("email security contact is not an address: %q", contact)
+		}
+		securityContacts = append(securityContacts, contact)
+	}
+	c.Email.SecurityContacts = securityContacts
+	if c.Connectors.Capacity < 0 {
+		return fmt.Errorf("connectors capacity must not be negative: %d", c.Connectors.Capacity)
+	}
+	if c.Connectors.Timeout <= 0 {
+		return fmt.Errorf("connectors timeout must be positive: %s", c.Connectors.Timeout)
+	}
+	if c.Connectors.Cooldown < 0 {
+		return fmt.Errorf("connectors cooldown must not be negative: %s", c.Connectors.Cooldown)
+	}
+	if c.Forms.Timeout <= 0 {
+		return fmt.Errorf("forms timeout must be positive: %s", c.Forms.Timeout)
+	}
+	if c.Portals.Timeout <= 0 {
+		return fmt.Errorf("portals timeout must be positive: %s", c.Portals.Timeout)
+	}
+	if c.Impersonation.MaxDuration < time.Minute || c.Impersonation.MaxDuration > 4*time.Hour {
+		return fmt.Errorf("impersonation max duration must be between 1m and 4h: %s", c.Impersonation.MaxDuration)
+	}
+	if c.APIUsage.MaxKeys < 1 {
+		return fmt.Errorf("API usage max keys must be at least 1: %d", c.APIUsage.MaxKeys)
+	}
+	if c.Telemetry.Interval != 0 && (c.Telemetry.Interval < 5*time.Second || c.Telemetry.Interval > time.Hour) {
+		return fmt.Errorf("telemetry interval must be 0 or between 5s and 1h: %s", c.Telemetry.Interval)
+	}
+	if c.Telemetry.TargetFPS < 1 || c.Telemetry.TargetFPS > 240 {
+		return fmt.Errorf("telemetry target FPS must be between 1 and 240: %d", c.Telemetry.TargetFPS)
+	}
+	if !(c.Quality.CullDistance >= 10 && c.Quality.CullDistance <= 10000) {
+		return fmt.Errorf("quality cull distance must be between 10 and 10000 metres: %g", c.Quality.CullDistance)
+	}
+	if c.Crowd.Threshold < 0 {
+		return fmt.Errorf("crowd threshold must not be negative: %d", c.Crowd.Threshold)
+	}
+	if !(c.Crowd.NearDistance >= 1 && c.Crowd.NearDistance <= 1000) {
+		return fmt.Errorf("crowd near distance must be between 1 and 1000 metres: %g", c.Crowd.NearDistance)
+	}
+	if c.Crowd.FarUpdateRate < 1 || c.Crowd.FarUpdateRate > 30 {
+		return fmt.Errorf("crowd far update rate must be between 1 and 30: %d", c.Crowd.FarUpdateRate)
+	}
+	if c.Spectators.Max < 0 {
+		return fmt.Errorf("spectators max must not be negative: %d", c.Spectators.Max)
+	}
+	if c.Broadcast.Max < 0 || c.Broadcast.Max > 16 {
+		return fmt.Errorf("broadcast max must be between 0 and 16: %d", c.Broadcast.Max)
+	}
+	if c.Broadcast.Max > 0 && c.Broadcast.FFmpeg == "" {
+		return fmt.Errorf("broadcast ffmpeg executable required")
+	}
+	if c.Broadcast.Width < 320 || c.Broadcast.Width > 3840 || c.Broadcast.Width%2 != 0 {
+		return fmt.Errorf("broadcast width must be an even number of pixels between 320 and 3840: %d", c.Broadcast.Width)
+	}
+	if c.Broadcast.Height < 240 || c.Broadcast.Height > 2160 || c.Broadcast.Height%2 != 0 {
+		return fmt.Errorf("broadcast height must be an even number of pixels between 240 and 2160: %d", c.Broadcast.Height)
+	}
+	if c.Broadcast.FrameRate < 10 || c.Broadcast.FrameRate > 60 {
+		return fmt.Errorf("broadcast frame rate must be between 10 and 60: %d", c.Broadcast.FrameRate)
+	}
+	if c.Broadcast.Bitrate < 500 || c.Broadcast.Bitrate > 20000 {
+		return fmt.Errorf("broadcast bitrate must be between 500 and 20000 kbps: %d", c.Broadcast.Bitrate)
+	}
+	if !(c.Chunks.Size >= 0 && c.Chunks.Size <= 1e6) {
+		return fmt.Errorf("chunks size must be between 0 and 1000000 metres: %g", c.Chunks.Size)
+	}
+	if c.Chunks.Radius < 0 || c.Chunks.Radius > 16 {
+		return fmt.Errorf("chunks radius must be between 0 and 16: %d", c.Chunks.Radius)
+	}
+	if c.Bindings.Tick < 0 {
+		return fmt.Errorf("bindings tick must not be negative: %s", c.Bindings.Tick)
+	}
+	if c.Assets.PointCloudWorkers < 1 {
+		return fmt.Errorf("assets point cloud workers must be at least 1: %d", c.Assets.PointCloudWorkers)
+	}
+	if c.Assets.PointCloudNodePoints < 1000 {
+		return fmt.Errorf("assets point cloud node points must be at least 1000: %d", c.Assets.PointCloudNodePoints)
+	}
+	if c.Assets.PointCloudMaxPoints < c.Assets.PointCloudNodePoints {
+		return fmt.Errorf("assets point cloud max points must be at least the node points: %d", c.Assets.PointCloudMaxPoints)
+	}
+	if c.Assets.ScanBackend != "none" && c.Assets.ScanAddress == "" {
+		return fmt.Errorf("assets scan address required for scan backend %s", c.Assets.ScanBackend)
+	}
+	if c.Assets.ScanTimeout <= 0 {
+		return fmt.Errorf("assets scan timeout must be positive: %s", c.Assets.ScanTimeout)
+	}
+	if c.Imports.Workers < 1 {
+		return fmt.Errorf("imports workers must be at least 1: %d", c.Imports.Workers)
+	}
+	if c.Imports.Timeout <= 0 {
+		return fmt.Errorf("imports timeout must be positive: %s", c.Imports.Timeout)
+	}
+	if c.Imports.MaxEntities < 1 {
+		return fmt.Errorf("imports max entities must be at least 1: %d", c.Imports.MaxEntities)
+	}
+	for _, url := range []string{c.Geo.ImageryURL, c.Geo.ElevationURL} {
+		if url != "" && (!strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") ||
+			!strings.Contains(url, "{z}") || !strings.Contains(url, "{x}") || !strings.Contains(url, "{y}")) {
+			return fmt.Errorf("geo tile URL must be http(s) with {z}, {x} and {y}: %s", url)
+		}
+	}
+	if c.Geo.ElevationEncoding != "terrarium" && c.Geo.ElevationEncoding != "mapbox" {
+		return fmt.Errorf("geo elevation encoding must be terrarium or mapbox: %s", c.Geo.ElevationEncoding)
+	}
+	if c.Geo.MaxTiles < 1 {
+		return fmt.Errorf("geo max tiles must be at least 1: %d", c.Geo.MaxTiles)
+	}
+	if c.Geo.Timeout <= 0 {
+		return fmt.Errorf("geo timeout must be positive: %s", c.Geo.Timeout)
+	}
+	if c.Simulation.Tick <= 0 {
+		return fmt.Errorf("simulation tick must be positive: %s", c.Simulation.Tick)
+	}
+	if c.Simulation.IdleTick < c.Simulation.Tick {
+		return fmt.Errorf("simulation idle tick must be at least the tick: %s", c.Simulation.IdleTick)
+	}
+	if c.Budgets.MaxEntities < 0 || c.Budgets.MaxMemory < 0 {
+		return fmt.Errorf("world budgets must not be negative")
+	}
+	if c.Hibernation.Idle < 0 {
+		return fmt.Errorf("hibernation idle must not be negative: %s", c.Hibernation.Idle)
+	}
+	
+	// Compute API base if not set
+	if c.Server.APIBase == "" {
+		c.Server.APIBase = fmt.Sprintf("http://%s:%s/api", c.Server.Host, c.Server.Port)
+	}
+	if c.Client.APIBase == "" {
+		c.Client.APIBase = c.Server.APIBase
+	}
+	
+	// Containers run in the foreground and log to stdout; the orchestrator
+	// supervises the process and collects its output, and the image may be
+	// read-only outside its volumes
+	if c.Server.Container {
+		c.Server.Daemon = false
+		return nil
+	}
+	
+	// Ensure all directories exist (create if needed)
+	dirs := []string{
+		c.Paths.BuildDir,
+		c.Paths.BinDir,
+		c.Paths.LogDir,
+		c.Paths.RuntimeDir,
+	}
+	
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %v", dir, err)
+		}
+	}
+	
+	return nil
+}
+
+// GetAPIBase returns the configured API base URL
+func GetAPIBase() string {
+	if Config != nil {
+		return Config.Client.APIBase
+	}
+	return "http://localhost:8080/api" // fallback
+}
+
+// GetRootDir returns the configured root directory
+func GetRootDir() string {
+	if Config != nil {
+		return Config.Paths.RootDir
+	}
+	return DefaultInstallPrefix // fallback
+}
+
+// GetStaticDir returns the configured static files directory
+func GetStaticDir() string {
+	if Config != nil {
+		return Config.Server.StaticDir
+	}
+	return filepath.Join(DefaultInstallPrefix, "share", "htdocs", "static") // fallback
+}
+
+// GetStaticSource returns where console assets are served from
+func GetStaticSource() string {
+	if Config != nil {
+		return Config.Server.StaticSource
+	}
+	return "auto" // fallback
+}
+
+// GetStaticDevMode reports whether static assets skip fingerprinting
+func GetStaticDevMode() bool {
+	if Config != nil {
+		return Config.Server.StaticDevMode
+	}
+	return false // fallback
+}
+
+// GetPIDFile returns the configured PID file path
+func GetPIDFile() string {
+	if Config != nil {
+		return Config.Paths.PIDFile
+	}
+	return filepath.Join(DefaultInstallPrefix, "build", "runtime", "hd1.pid") // fallback
+}
+
+// GetHost returns the configured server host
+func GetHost() string {
+	if Config != nil {
+		return Config.Server.Host
+	}
+	return "0.0.0.0" // fallback
+}
+
+// GetPort returns the configured server port
+func GetPort() string {
+	if Config != nil {
+		return Config.Server.Port
+	}
+	return "8080" // fallback
+}
+
+// GetListen returns the listener addresses, defaulting to host:port
+func GetListen() []string {
+	if Config != nil && len(Config.Server.Listen) > 0 {
+		return Config.Server.Listen
+	}
+	return []string{GetHost() + ":" + GetPort()} // fallback
+}
+
+func GetSocketMode() string {
+	if Config != nil {
+		return Config.Server.SocketMode
+	}
+	return "0660" // fallback
+}
+
+// GetSocketOperators reports whether Unix socket peers count as local
+// callers
+func GetSocketOperators() bool {
+	if Config != nil {
+		return Config.Server.SocketOperators
+	}
+	return false // fallback
+}
+
+// GetTLSCert returns the TLS certificate file, empty when serving plain HTTP
+func GetTLSCert() string {
+	if Config != nil {
+		return Config.Server.TLSCert
+	}
+	return "" // fallback
+}
+
+func GetTLSKey() string {
+	if Config != nil {
+		return Config.Server.TLSKey
+	}
+	return "" // fallback
+}
+
+// GetTrustedProxies returns the proxies whose X-Forwarded-* headers are believed
+func GetTrustedProxies() []string {
+	if Config != nil {
+		return Config.Server.TrustedProxies
+	}
+	return nil // fallback
+}
+
+// runningInContainer detects Docker and Kubernetes; HD1_CONTAINER overrides
+func runningInContainer() bool {
+	switch os.Getenv("HD1_CONTAINER") {
+	case "true", "1":
+		return true
+	case "false", "0":
+		return false
+	}
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return true
+	}
+	_, err := os.Stat("/.dockerenv")
+	return err == nil
+}
+
+// GetContainer reports whether HD1 runs in container mode
+func GetContainer() bool {
+	if Config != nil {
+		return Config.Server.Container
+	}
+	return false // fallback
+}
+
+// GetShutdownTimeout returns how long SIGTERM waits for in-flight requests
+func GetShutdownTimeout() time.Duration {
+	if Config != nil {
+		return Config.Server.ShutdownTimeout
+	}
+	return 30 * time.Second // fallback
+}
+
+// GetLogFormat returns the console log format: json in containers unless set
+func GetLogFormat() string {
+	if Config != nil && Config.Logging.Format != "" {
+		return Config.Logging.Format
+	}
+	if GetContainer() {
+		return "json"
+	}
+	return "text" // fallback
+}
+
+// GetProfiles returns the configuration profiles applied, in order
+func GetProfiles() []string {
+	if Config != nil {
+		return Config.Server.Profiles
+	}
+	return nil // fallback
+}
+
+// GetLogDir returns the configured log directory
+func GetLogDir() string {
+	if Config != nil {
+		return Config.Paths.LogDir
+	}
+	return filepath.Join(DefaultInstallPrefix, "build", "logs") // fallback
+}
+
+// GetDaemon returns the daemon mode setting
+func GetDaemon() bool {
+	if Config != nil {
+		return Config.Server.Daemon
+	}
+	return false // fallback
+}
+
+// GetWorldsDir returns the configured worlds directory
+func GetWorldsDir() string {
+	if Config != nil {
+		return Config.Paths.WorldsDir
+	}
+	return filepath.Join(DefaultInstallPrefix, "share", "worlds") // fallback
+}
+
+// GetAvatarsDir returns the configured avatars directory
+func GetAvatarsDir() string {
+	if Config != nil {
+		return Config.Paths.AvatarsDir
+	}
+	return filepath.Join(DefaultInstallPrefix, "share", "avatars") // fallback
+}
+
+// GetRecordingsDir returns the configured recordings directory
+func GetRecordingsDir() string {
+	if Config != nil {
+		return Config.Paths.RecordingsDir
+	}
+	return filepath.Join(DefaultInstallPrefix, "recordings") // fallback
+}
+
+// GetTemplatesDir returns the codegen template override directory.
+// An empty value means only the embedded templates are used.
+func GetTemplatesDir() string {
+	if Config != nil {
+		return Config.Paths.TemplatesDir
+	}
+	return "" // fallback
+}
+
+// GetLocalesDir returns the message catalogue override directory.
+// An empty value means only the embedded catalogues are used.
+func GetLocalesDir() string {
+	if Config != nil {
+		return Config.Paths.LocalesDir
+	}
+	return "" // fallback
+}
+
+// GetClientLocale returns the default console language
+func GetClientLocale() string {
+	if Config != nil {
+		return Config.Client.Locale
+	}
+	return "en" // fallback
+}
+
+// GetWorldsConfigFile returns the configured worlds config file path
+func GetWorldsConfigFile() string {
+	if Config != nil {
+		return filepath.Join(Config.Paths.WorldsDir, Config.Worlds.ConfigFile)
+	}
+	return filepath.Join(DefaultInstallPrefix, "share", "worlds", "config.yaml") // fallback
+}
+
+// GetAvatarsConfigFile returns the configured avatars config file path
+func GetAvatarsConfigFile() string {
+	if Config != nil {
+		return filepath.Join(Config.Paths.AvatarsDir, Config.Avatars.ConfigFile)
+	}
+	return filepath.Join(DefaultInstallPrefix, "share", "avatars", "config.yaml") // fallback
+}
+
+// WebSocket configuration getters
+func GetWebSocketWriteTimeout() time.Duration {
+	if Config != nil {
+		return Config.WebSocket.WriteTimeout
+	}
+	return 10 * time.Second // fallback
+}
+
+func GetWebSocketPongTimeout() time.Duration {
+	if Config != nil {
+		return Config.WebSocket.PongTimeout
+	}
+	return 60 * time.Second // fallback
+}
+
+func GetWebSocketPingPeriod() time.Duration {
+	if Config != nil {
+		return Config.WebSocket.PingPeriod
+	}
+	return 54 * time.Second // fallback
+}
+
+func GetWebSocketMaxMessageSize() int64 {
+	if Config != nil {
+		return Config.WebSocket.MaxMessageSize
+	}
+	return 512 // fallback
+}
+
+func GetWebSocketReadBufferSize() int {
+	if Config != nil {
+		return Config.WebSocket.ReadBufferSize
+	}
+	return 1024 // fallback
+}
+
+func GetWebSocketWriteBufferSize() int {
+	if Config != nil {
+		return Config.WebSocket.WriteBufferSize
+	}
+	return 1024 // fallback
+}
+
+func GetWebSocketClientWorldBuffer() int {
+	if Config != nil {
+		return Config.WebSocket.ClientWorldBuffer
+	}
+	return 256 // fallback
+}
+
+func GetWebSocketAssetChunkSize() int {
+	if Config != nil {
+		return Config.WebSocket.AssetChunkSize
+	}
+	return 262144 // fallback
+}
+
+func GetWebSocketMaxAssetStreams() int {
+	if Config != nil {
+		return Config.WebSocket.MaxAssetStreams
+	}
+	return 4 // fallback
+}
+
+// GetWebSocketAllowedOrigins returns the cross-origin pages allowed to open /ws
+func GetWebSocketAllowedOrigins() []string {
+	if Config != nil {
+		return Config.WebSocket.AllowedOrigins
+	}
+	return nil // fallback
+}
+
+// Session configuration getters
+func GetSessionCleanupInterval() time.Duration {
+	if Config != nil {
+		return Config.Session.CleanupInterval
+	}
+	return 2 * time.Minute // fallback
+}
+
+func GetSessionInactivityTimeout() time.Duration {
+	if Config != nil {
+		return Config.Session.InactivityTimeout
+	}
+	return 10 * time.Minute // fallback
+}
+
+func GetSessionHTTPClientTimeout() time.Duration {
+	if Config != nil {
+		return Config.Session.HTTPClientTimeout
+	}
+	return 5 * time.Second // fallback
+}
+
+// GetSessionTokenTTL returns how long a session token is valid
+func GetSessionTokenTTL() time.Duration {
+	if Config != nil {
+		return Config.Session.TokenTTL
+	}
+	return 15 * time.Minute // fallback
+}
+
+// GetSessionStaleAfter returns how long without a heartbeat a client is
+// stale
+func GetSessionStaleAfter() time.Duration {
+	if Config != nil {
+		return Config.Session.StaleAfter
+	}
+	return 30 * time.Second // fallback
+}
+
+// GetSessionDeactivateAfter returns how long without a heartbeat a client
+// is disconnected, 0 for never
+func GetSessionDeactivateAfter() time.Duration {
+	if Config != nil {
+		return Config.Session.DeactivateAfter
+	}
+	return 2 * time.Minute // fallback
+}
+
+func GetSessionDefaultID() string {
+	if Config != nil {
+		return Config.Session.DefaultSessionID
+	}
+	return create_unique_session_identifier() // fallback - generate unique ID
+}
+
+// Worlds configuration getters
+func GetWorldsDefaultWorld() string {
+	if Config != nil {
+		return Config.Worlds.DefaultWorld
+	}
+	return "world_one" // fallback
+}
+
+func GetWorldsAutoJoinOnCreate() bool {
+	if Config != nil {
+		return Config.Worlds.AutoJoinOnCreate
+	}
+	return true // fallback
+}
+
+func GetWorldsSyncOnJoin() bool {
+	if Config != nil {
+		return Config.Worlds.SyncOnJoin
+	}
+	return true // fallback
+}
+
+// GetWorldsPreload returns the worlds to load and warm at startup
+func GetWorldsPreload() []string {
+	if Config != nil {
+		return Config.Worlds.Preload
+	}
+	return nil // fallback
+}
+
+// GetWorldsProtectedList returns the list of protected worlds
+func GetWorldsProtectedList() []string {
+	if Config != nil {
+		return Config.Worlds.ProtectedList
+	}
+	return []string{"world_one", "world_two"} // fallback
+}
+
+// GetInternalAPIBase returns the configured internal API base URL
+func GetInternalAPIBase() string {
+	if Config != nil {
+		return Config.Server.InternalAPIBase
+	}
+	return "http://localhost:8080/api" // fallback
+}
+
+// GetVersion returns the configured HD1 version
+func GetVersion() string {
+	if Config != nil {
+		return Config.Server.Version
+	}
+	return DefaultVersion // fallback
+}
+
+// Avatars configuration getters
+func GetAvatarsMaxConcurrentCreations() int {
+	if Config != nil {
+		return Config.Avatars.MaxConcurrentCreations
+	}
+	return 2 // fallback
+}
+
+func GetAvatarsHealthCheckInterval() time.Duration {
+	if Config != nil {
+		return Config.Avatars.HealthCheckInterval
+	}
+	return 5 * time.Second // fallback
+}
+
+func GetAvatarsPositionUpdateThrottle() time.Duration {
+	if Config != nil {
+		return Config.Avatars.PositionUpdateThrottle
+	}
+	return 16 * time.Millisecond // fallback
+}
+
+func GetAvatarsMaxReconnectAttempts() int {
+	if Config != nil {
+		return Config.Avatars.MaxReconnectAttempts
+	}
+	return 99 // fallback
+}
+
+func GetAvatarsReconnectDelay() time.Duration {
+	if Config != nil {
+		return Config.Avatars.ReconnectDelay
+	}
+	return 1 * time.Second // fallback
+}
+
+func GetAvatarsMaxReconnectDelay() time.Duration {
+	if Config != nil {
+		return Config.Avatars.MaxReconnectDelay
+	}
+	return 30 * time.Second // fallback
+}
+
+func GetAvatarsHeartbeatFrequency() time.Duration {
+	if Config != nil {
+		return Config.Avatars.HeartbeatFrequency
+	}
+	return 5 * time.Second // fallback
+}
+
+// GetAvatarsIdleTimeout returns how long a world keeps avatars whose
+// session is gone
+func GetAvatarsIdleTimeout(world string) time.Duration {
+	if Config != nil {
+		if timeout, ok := Config.Avatars.WorldIdleTimeouts[world]; ok {
+			return timeout
+		}
+		return Config.Avatars.IdleTimeout
+	}
+	return 5 * time.Minute // fallback
+}
+
+// GetAvatarsMaxSpeed returns the fastest an avatar may move, in metres per
+// second; 0 means no limit
+func GetAvatarsMaxSpeed() float64 {
+	if Config != nil {
+		return Config.Avatars.MaxSpeed
+	}
+	return 12 // fallback
+}
+
+// GetAvatarsMaxStep returns the longest single avatar move, in metres;
+// 0 means no limit
+func GetAvatarsMaxStep() float64 {
+	if Config != nil {
+		return Config.Avatars.MaxStep
+	}
+	return 20 // fallback
+}
+
+// GetAvatarsMoveTolerance returns the factor on the movement limits in a
+// world; 0 means moves there are not checked
+func GetAvatarsMoveTolerance(world string) float64 {
+	if Config != nil {
+		if tolerance, ok := Config.Avatars.WorldMoveTolerances[world]; ok {
+			return tolerance
+		}
+		return Config.Avatars.MoveTolerance
+	}
+	return 1.25 // fallback
+}
+
+// GetAvatarsMoveAction returns what happens to impossible moves: clamp or
+// reject
+func GetAvatarsMoveAction() string {
+	if Config != nil {
+		return Config.Avatars.MoveAction
+	}
+	return "clamp" // fallback
+}
+
+// Sync protocol configuration getters
+func GetSyncProtocol() string {
+	if Config != nil {
+		return Config.Sync.Protocol
+	}
+	return "HD1-VSC-v1.0" // fallback
+}
+
+func GetSyncInterval() time.Duration {
+	if Config != nil {
+		return Config.Sync.SyncInterval
+	}
+	return 16 * time.Millisecond // fallback
+}
+
+func GetSyncMaxDeltaLog() int {
+	if Config != nil {
+		return Config.Sync.MaxDeltaLog
+	}
+	return 10000 // fallback
+}
+
+func GetSyncChecksumAlgorithm() string {
+	if Config != nil {
+		return Config.Sync.ChecksumAlgorithm
+	}
+	return "sha256" // fallback
+}
+
+func GetSyncCausalityTimeout() time.Duration {
+	if Config != nil {
+		return Config.Sync.CausalityTimeout
+	}
+	return 5 * time.Second // fallback
+}
+
+func GetSyncDeltaQueueSize() int {
+	if Config != nil {
+		return Config.Sync.DeltaQueueSize
+	}
+	return 1000 // fallback
+}
+
+func GetSyncAvatarRegistrySize() int {
+	if Config != nil {
+		return Config.Sync.AvatarRegistrySize
+	}
+	return 100 // fallback
+}
+
+func GetSyncBroadcastWorldBuffer() int {
+	if Config != nil {
+		return Config.Sync.BroadcastWorldBuffer
+	}
+	return 1024 // fallback
+}
+
+func GetSyncWorldStateCompressionEnabled() bool {
+	if Config != nil {
+		return Config.Sync.WorldStateCompressionEnabled
+	}
+	return true // fallback
+}
+
+func GetSyncPerformanceMetricsEnabled() bool {
+	if Config != nil {
+		return Config.Sync.PerformanceMetricsEnabled
+	}
+	return false // fallback
+}
+
+func GetSyncVectorClockPrecision() int {
+	if Config != nil {
+		return Config.Sync.VectorClockPrecision
+	}
+	return 64 // fallback
+}
+
+func GetSyncConsistencyInterval() time.Duration {
+	if Config != nil {
+		return Config.Sync.ConsistencyInterval
+	}
+	return 1 * time.Minute // fallback
+}
+
+// GetSyncTransactionTimeout returns how long a scene transaction may stay
+// open before it rolls back
+func GetSyncTransactionTimeout() time.Duration {
+	if Config != nil {
+		return Config.Sync.TransactionTimeout
+	}
+	return 5 * time.Minute // fallback
+}
+
+// GetSyncTransactionMaxOperations returns how many operations one scene
+// transaction may queue
+func GetSyncTransactionMaxOperations() int {
+	if Config != nil {
+		return Config.Sync.TransactionMaxOperations
+	}
+	return 500 // fallback
+}
+
+// GetSyncReplayWindow returns how many nonces below the highest a session
+// signed its deltas may still use, for deltas that overtake each other
+func GetSyncReplayWindow() int {
+	if Config != nil {
+		return Config.Sync.ReplayWindow
+	}
+	return 64 // fallback
+}
+
+// Storage configuration getters
+func GetStorageBackend() string {
+	if Config != nil {
+		return Config.Storage.Backend
+	}
+	return "filesystem" // fallback
+}
+
+// GetStorageDir returns the filesystem storage root directory
+func GetStorageDir() string {
+	if Config != nil {
+		return Config.Storage.Dir
+	}
+	return filepath.Join(DefaultInstallPrefix, "storage") // fallback
+}
+
+func GetStorageBucket() string {
+	if Config != nil {
+		return Config.Storage.Bucket
+	}
+	return "" // fallback
+}
+
+func GetStorageRegion() string {
+	if Config != nil {
+		return Config.Storage.Region
+	}
+	return "us-east-1" // fallback
+}
+
+func GetStorageEndpoint() string {
+	if Config != nil {
+		return Config.Storage.Endpoint
+	}
+	return "" // fallback
+}
+
+func GetStoragePrefix() string {
+	if Config != nil {
+		return Config.Storage.Prefix
+	}
+	return "" // fallback
+}
+
+func GetStoragePathStyle() bool {
+	if Config != nil {
+		return Config.Storage.PathStyle
+	}
+	return false // fallback
+}
+
+func GetStorageAccessKey() string {
+	if Config != nil {
+		return Config.Storage.AccessKey
+	}
+	return "" // fallback
+}
+
+func GetStorageSecretKey() string {
+	if Config != nil {
+		return Config.Storage.SecretKey
+	}
+	return "" // fallback
+}
+
+// GetStorageSigningKey returns the HMAC key for filesystem signed URLs.
+// Empty means a per-process random key: URLs do not survive restarts.
+func GetStorageSigningKey() string {
+	if Config != nil {
+		return Config.Storage.SigningKey
+	}
+	return "" // fallback
+}
+
+func GetStorageSignedURLTTL() time.Duration {
+	if Config != nil {
+		return Config.Storage.SignedURLTTL
+	}
+	return 15 * time.Minute // fallback
+}
+
+// GetStorageEncryptionProvider returns the at-rest encryption key provider;
+// empty means objects are stored unencrypted
+func GetStorageEncryptionProvider() string {
+	if Config != nil {
+		return Config.Storage.EncryptionProvider
+	}
+	return "" // fallback
+}
+
+// GetStorageEncryptionKeys returns the static provider's keys
+func GetStorageEncryptionKeys() string {
+	if Config != nil {
+		return Config.Storage.EncryptionKeys
+	}
+	return "" // fallback
+}
+
+// GetStorageEncryptionNamespaces returns the namespaces encrypted on write
+func GetStorageEncryptionNamespaces() []string {
+	if Config != nil {
+		return Config.Storage.EncryptionNamespaces
+	}
+	return []string{"assets", "recordings", "exports"} // fallback
+}
+
+// GetStorageEncryptionMigrate returns whether objects stored unencrypted in
+// encrypted namespaces are read and re-encrypted rather than refused
+func GetStorageEncryptionMigrate() bool {
+	if Config != nil {
+		return Config.Storage.EncryptionMigrate
+	}
+	return false // fallback
+}
+
+// Asset store configuration getters
+func GetAssetsMaxUploadSize() int64 {
+	if Config != nil {
+		return Config.Assets.MaxUploadSize
+	}
+	return 100 * 1024 * 1024 // fallback
+}
+
+func GetAssetsGCInterval() time.Duration {
+	if Config != nil {
+		return Config.Assets.GCInterval
+	}
+	return 1 * time.Hour // fallback
+}
+
+func GetAssetsGCGracePeriod() time.Duration {
+	if Config != nil {
+		return Config.Assets.GCGracePeriod
+	}
+	return 24 * time.Hour // fallback
+}
+
+func GetAssetsPipelineEnabled() bool {
+	if Config != nil {
+		return Config.Assets.PipelineEnabled
+	}
+	return false // fallback
+}
+
+func GetAssetsPipelineWorkers() int {
+	if Config != nil {
+		return Config.Assets.PipelineWorkers
+	}
+	return 2 // fallback
+}
+
+func GetAssetsPipelineTool() string {
+	if Config != nil {
+		return Config.Assets.PipelineTool
+	}
+	return "gltf-transform" // fallback
+}
+
+func GetAssetsPipelineTimeout() time.Duration {
+	if Config != nil {
+		return Config.Assets.PipelineTimeout
+	}
+	return 5 * time.Minute // fallback
+}
+
+func GetAssetsPointCloudWorkers() int {
+	if Config != nil {
+		return Config.Assets.PointCloudWorkers
+	}
+	return 1 // fallback
+}
+
+func GetAssetsPointCloudNodePoints() int {
+	if Config != nil {
+		return Config.Assets.PointCloudNodePoints
+	}
+	return 20000 // fallback
+}
+
+func GetAssetsPointCloudMaxPoints() int {
+	if Config != nil {
+		return Config.Assets.PointCloudMaxPoints
+	}
+	return 20000000 // fallback
+}
+
+func GetAssetsScanBackend() string {
+	if Config != nil {
+		return Config.Assets.ScanBackend
+	}
+	return "none" // fallback
+}
+
+func GetAssetsScanAddress() string {
+	if Config != nil {
+		return Config.Assets.ScanAddress
+	}
+	return "" // fallback
+}
+
+func GetAssetsScanTimeout() time.Duration {
+	if Config != nil {
+		return Config.Assets.ScanTimeout
+	}
+	return 30 * time.Second // fallback
+}
+
+// Client capability tier getters
+func GetClientsHighUpdateRate() int {
+	if Config != nil {
+		return Config.Clients.HighUpdateRate
+	}
+	return 60 // fallback
+}
+
+func GetClientsStandardUpdateRate() int {
+	if Config != nil {
+		return Config.Clients.StandardUpdateRate
+	}
+	return 30 // fallback
+}
+
+func GetClientsLowUpdateRate() int {
+	if Config != nil {
+		return Config.Clients.LowUpdateRate
+	}
+	return 10 // fallback
+}
+
+func GetClientsHighTextureSize() int {
+	if Config != nil {
+		return Config.Clients.HighTextureSize
+	}
+	return 4096 // fallback
+}
+
+func GetClientsStandardTextureSize() int {
+	if Config != nil {
+		return Config.Clients.StandardTextureSize
+	}
+	return 2048 // fallback
+}
+
+func GetClientsLowTextureSize() int {
+	if Config != nil {
+		return Config.Clients.LowTextureSize
+	}
+	return 1024 // fallback
+}
+
+// XR pose channel getters
+func GetXRPoseRate() int {
+	if Config != nil {
+		return Config.XR.PoseRate
+	}
+	return 45 // fallback
+}
+
+func GetXRKeyframeInterval() time.Duration {
+	if Config != nil {
+		return Config.XR.KeyframeInterval
+	}
+	return 1 * time.Second // fallback
+}
+
+// Accessibility getters
+func GetAccessibilityCaptionMaxLength() int {
+	if Config != nil {
+		return Config.Accessibility.CaptionMaxLength
+	}
+	return 500 // fallback
+}
+
+func GetAccessibilityCaptionRate() int {
+	if Config != nil {
+		return Config.Accessibility.CaptionRate
+	}
+	return 5 // fallback
+}
+
+// Entity ID issuance getters
+func GetEntitiesAllowClientIDs() bool {
+	if Config != nil {
+		return Config.Entities.AllowClientIDs
+	}
+	return true // fallback
+}
+
+func GetEntitiesIDConflict() string {
+	if Config != nil {
+		return Config.Entities.IDConflict
+	}
+	return "reject" // fallback
+}
+
+func GetEntitiesCreateRate() int {
+	if Config != nil {
+		return Config.Entities.CreateRate
+	}
+	return 120 // fallback
+}
+
+func GetEntitiesMaxPerSession() int {
+	if Config != nil {
+		return Config.Entities.MaxPerSession
+	}
+	return 2000 // fallback
+}
+
+// GetGeoImageryURL returns the map tile URL template, empty when ground
+// tiles have no imagery
+func GetGeoImageryURL() string {
+	if Config != nil {
+		return Config.Geo.ImageryURL
+	}
+	return "https://tile.openstreetmap.org/{z}/{x}/{y}.png" // fallback
+}
+
+// GetGeoElevationURL returns the elevation tile URL template, empty when
+// ground tiles are flat
+func GetGeoElevationURL() string {
+	if Config != nil {
+		return Config.Geo.ElevationURL
+	}
+	return "https://s3.amazonaws.com/elevation-tiles-prod/terrarium/{z}/{x}/{y}.png" // fallback
+}
+
+// GetGeoElevationEncoding returns how elevation tiles encode heights
+func GetGeoElevationEncoding() string {
+	if Config != nil {
+		return Config.Geo.ElevationEncoding
+	}
+	return "terrarium" // fallback
+}
+
+// GetGeoAttribution returns the credit the tile providers require
+func GetGeoAttribution() string {
+	if Config != nil {
+		return Config.Geo.Attribution
+	}
+	return "© OpenStreetMap contributors; elevation: Mapzen Terrain Tiles" // fallback
+}
+
+// GetGeoMaxTiles returns how many ground tiles one request may load
+func GetGeoMaxTiles() int {
+	if Config != nil {
+		return Config.Geo.MaxTiles
+	}
+	return 64 // fallback
+}
+
+// GetGeoTimeout returns how long fetching one provider tile may take
+func GetGeoTimeout() time.Duration {
+	if Config != nil {
+		return Config.Geo.Timeout
+	}
+	return 15 * time.Second // fallback
+}
+
+// GetSimulationTick returns the tick loop period while clients are
+// connected
+func GetSimulationTick() time.Duration {
+	if Config != nil {
+		return Config.Simulation.Tick
+	}
+	return 50 * time.Millisecond // fallback
+}
+
+// GetSimulationIdleTick returns the tick loop period with no clients
+// connected
+func GetSimulationIdleTick() time.Duration {
+	if Config != nil {
+		return Config.Simulation.IdleTick
+	}
+	return time.Second // fallback
+}
+
+// GetBudgetsMaxEntities returns how many live entities a world may hold;
+// 0 means no limit
+func GetBudgetsMaxEntities(world string) int {
+	if Config != nil {
+		if count, ok := Config.Budgets.WorldMaxEntities[world]; ok {
+			return count
+		}
+		return Config.Budgets.MaxEntities
+	}
+	return 20000 // fallback
+}
+
+// GetBudgetsMaxMemory returns the estimated bytes of state a world may
+// hold; 0 means no limit
+func GetBudgetsMaxMemory(world string) int64 {
+	if Config != nil {
+		if size, ok := Config.Budgets.WorldMaxMemory[world]; ok {
+			return size
+		}
+		return Config.Budgets.MaxMemory
+	}
+	return 256 * 1024 * 1024 // fallback
+}
+
+// GetHibernationIdle returns how long a world goes without clients before
+// it is unloaded; 0 keeps it loaded
+func GetHibernationIdle() time.Duration {
+	if Config != nil {
+		return Config.Hibernation.Idle
+	}
+	return 15 * time.Minute // fallback
+}
+
+// GetWebhooksFile returns the file of inbound webhook mappings
+func GetWebhooksFile() string {
+	if Config != nil {
+		return Config.Webhooks.File
+	}
+	return "" // fallback
+}
+
+// GetFormsFile returns the file of form submission targets
+func GetFormsFile() string {
+	if Config != nil {
+		return Config.Forms.File
+	}
+	return "" // fallback
+}
+
+// GetFormsTimeout returns how long forwarding a form submission may take
+func GetFormsTimeout() time.Duration {
+	if Config != nil {
+		return Config.Forms.Timeout
+	}
+	return 10 * time.Second // fallback
+}
+
+// GetPortalsFile returns the file of portal destination servers
+func GetPortalsFile() string {
+	if Config != nil {
+		return Config.Portals.File
+	}
+	return "" // fallback
+}
+
+// GetPortalsTimeout returns how long handing an avatar to another server
+// may take
+func GetPortalsTimeout() time.Duration {
+	if Config != nil {
+		return Config.Portals.Timeout
+	}
+	return 5 * time.Second // fallback
+}
+
+// GetConsentFile returns the file of consent documents
+func GetConsentFile() string {
+	if Config != nil {
+		return Config.Consent.File
+	}
+	return "" // fallback
+}
+
+// GetImpersonationMaxDuration returns the longest support staff may act as
+// a session at a time
+func GetImpersonationMaxDuration() time.Duration {
+	if Config != nil {
+		return Config.Impersonation.MaxDuration
 	}
-	if c.Server.StaticDir == "" || strings.HasPrefix(c.Server.StaticDir, installPrefix) {
-		c.Server.StaticDir = filepath.Join(c.Paths.HtDocsDir, "static")
+	return 30 * time.Minute // fallback
+}
+
+// GetAPIUsageMaxKeys returns how many keys API usage is counted for
+func GetAPIUsageMaxKeys() int {
+	if Config != nil {
+		return Config.APIUsage.MaxKeys
 	}
-	if c.Paths.WorldsDir == "" || strings.HasPrefix(c.Paths.WorldsDir, installPrefix) {
-		c.Paths.WorldsDir = filepath.Join(c.Paths.ShareDir, "worlds")
+	return 10000 // fallback
+}
+
+// GetTelemetryInterval returns how often consoles report frame telemetry,
+// 0 when they report none
+func GetTelemetryInterval() time.Duration {
+	if Config != nil {
+		return Config.Telemetry.Interval
 	}
-	if c.Paths.AvatarsDir == "" || strings.HasPrefix(c.Paths.AvatarsDir, installPrefix) {
-		c.Paths.AvatarsDir = filepath.Join(c.Paths.ShareDir, "avatars")
+	return 30 * time.Second // fallback
+}
+
+// GetTelemetryTargetFPS returns the frame rate below which a console is
+// over budget
+func GetTelemetryTargetFPS() int {
+	if Config != nil {
+		return Config.Telemetry.TargetFPS
 	}
+	return 30 // fallback
 }
 
-// getInstallPrefix returns the current install prefix for path detection
-func (c *HD1Config) getInstallPrefix() string {
-	// If RootDir is set and different from default, use it as prefix
-	if c.Paths.RootDir != "" && c.Paths.RootDir != DefaultInstallPrefix {
-		return c.Paths.RootDir
+// GetQualityAdaptive returns whether consoles under the target frame rate
+// are told to render less
+func GetQualityAdaptive() bool {
+	if Config != nil {
+		return Config.Quality.Adaptive
 	}
-	return DefaultInstallPrefix
+	return true // fallback
 }
 
-// validate ensures configuration is valid and complete
-func (c *HD1Config) validate() error {
-	// Validate required paths are absolute
-	if !filepath.IsAbs(c.Paths.RootDir) {
-		return fmt.Errorf("root directory must be absolute path: %s", c.Paths.RootDir)
+// GetQualityCullDistance returns the metres beyond which the most degraded
+// consoles cull entities
+func GetQualityCullDistance() float64 {
+	if Config != nil {
+		return Config.Quality.CullDistance
 	}
-	
-	// Compute API base if not set
-	if c.Server.APIBase == "" {
-		c.Server.APIBase = fmt.Sprintf("http://%s:%s/api", c.Server.Host, c.Server.Port)
+	return 60 // fallback
+}
+
+// GetCrowdThreshold returns the avatars in a world that make it a crowd,
+// 0 for never
+func GetCrowdThreshold() int {
+	if Config != nil {
+		return Config.Crowd.Threshold
 	}
-	if c.Client.APIBase == "" {
-		c.Client.APIBase = c.Server.APIBase
+	return 50 // fallback
+}
+
+// GetCrowdNearDistance returns the metres within which crowd avatars are
+// drawn and moved in full
+func GetCrowdNearDistance() float64 {
+	if Config != nil {
+		return Config.Crowd.NearDistance
 	}
-	
-	// Ensure all directories exist (create if needed)
-	dirs := []string{
-		c.Paths.BuildDir,
-		c.Paths.BinDir,
-		c.Paths.LogDir,
-		c.Paths.RuntimeDir,
+	return 15 // fallback
+}
+
+// GetCrowdFarUpdateRate returns the moves a second clients receive of
+// crowd avatars beyond the near distance
+func GetCrowdFarUpdateRate() int {
+	if Config != nil {
+		return Config.Crowd.FarUpdateRate
 	}
-	
-	for _, dir := range dirs {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return fmt.Errorf("failed to create directory %s: %v", dir, err)
-		}
+	return 2 // fallback
+}
+
+// GetSpectatorsEnabled returns whether clients may join as spectators
+func GetSpectatorsEnabled() bool {
+	if Config != nil {
+		return Config.Spectators.Enabled
 	}
-	
-	return nil
+	return true // fallback
 }
 
-// GetAPIBase returns the configured API base URL
-func GetAPIBase() string {
+// GetSpectatorsMax returns the spectators connected at once, 0 for
+// unlimited
+func GetSpectatorsMax() int {
 	if Config != nil {
-		return Config.Client.APIBase
+		return Config.Spectators.Max
 	}
-	return "http://localhost:8080/api" // fallback
+	return 1000 // fallback
 }
 
-// GetRootDir returns the configured root directory
-func GetRootDir() string {
+// GetBroadcastMax returns the broadcasts allowed at once, 0 for none
+func GetBroadcastMax() int {
 	if Config != nil {
-		return Config.Paths.RootDir
+		return Config.Broadcast.Max
 	}
-	return DefaultInstallPrefix // fallback
+	return 2 // fallback
 }
 
-// GetStaticDir returns the configured static files directory
-func GetStaticDir() string {
+// GetBroadcastFFmpeg returns the FFmpeg executable encoding broadcasts
+func GetBroadcastFFmpeg() string {
 	if Config != nil {
-		return Config.Server.StaticDir
+		return Config.Broadcast.FFmpeg
 	}
-	return filepath.Join(DefaultInstallPrefix, "share", "htdocs", "static") // fallback
+	return "ffmpeg" // fallback
 }
 
-// GetPIDFile returns the configured PID file path
-func GetPIDFile() string {
+// GetBroadcastRenderCommand returns the command launching a broadcast's
+// render client, with {url} standing for its URL; empty when operators
+// open it themselves
+func GetBroadcastRenderCommand() string {
 	if Config != nil {
-		return Config.Paths.PIDFile
+		return Config.Broadcast.RenderCommand
 	}
-	return filepath.Join(DefaultInstallPrefix, "build", "runtime", "hd1.pid") // fallback
+	return "" // fallback
 }
 
-// GetHost returns the configured server host
-func GetHost() string {
+// GetBroadcastWidth returns the width of broadcasts in pixels
+func GetBroadcastWidth() int {
 	if Config != nil {
-		return Config.Server.Host
+		return Config.Broadcast.Width
 	}
-	return "0.0.0.0" // fallback
+	return 1280 // fallback
 }
 
-// GetPort returns the configured server port
-func GetPort() string {
+// GetBroadcastHeight returns the height of broadcasts in pixels
+func GetBroadcastHeight() int {
 	if Config != nil {
-		return Config.Server.Port
+		return Config.Broadcast.Height
 	}
-	return "8080" // fallback
+	return 720 // fallback
 }
 
-// GetLogDir returns the configured log directory
-func GetLogDir() string {
+// GetBroadcastFrameRate returns the frames a second of broadcasts
+func GetBroadcastFrameRate() int {
 	if Config != nil {
-		return Config.Paths.LogDir
+		return Config.Broadcast.FrameRate
 	}
-	return filepath.Join(DefaultInstallPrefix, "build", "logs") // fallback
+	return 30 // fallback
 }
 
-// GetDaemon returns the daemon mode setting
-func GetDaemon() bool {
+// GetBroadcastBitrate returns the video kilobits a second of broadcasts
+func GetBroadcastBitrate() int {
 	if Config != nil {
-		return Config.Server.Daemon
+		return Config.Broadcast.Bitrate
 	}
-	return false // fallback
+	return 4500 // fallback
 }
 
-// GetWorldsDir returns the configured worlds directory
-func GetWorldsDir() string {
+// GetQuotasFile returns the file of plans
+func GetQuotasFile() string {
 	if Config != nil {
-		return Config.Paths.WorldsDir
+		return Config.Quotas.File
 	}
-	return filepath.Join(DefaultInstallPrefix, "share", "worlds") // fallback
+	return "" // fallback
 }
 
-// GetAvatarsDir returns the configured avatars directory
-func GetAvatarsDir() string {
+// GetChunksSize returns the metres along each world streaming chunk edge,
+// 0 when clients are sent whole worlds
+func GetChunksSize() float64 {
 	if Config != nil {
-		return Config.Paths.AvatarsDir
+		return Config.Chunks.Size
 	}
-	return filepath.Join(DefaultInstallPrefix, "share", "avatars") // fallback
+	return 0 // fallback
 }
 
-// GetRecordingsDir returns the configured recordings directory
-func GetRecordingsDir() string {
+// GetChunksRadius returns how many chunks clients load around their
+// avatar's chunk
+func GetChunksRadius() int {
 	if Config != nil {
-		return Config.Paths.RecordingsDir
+		return Config.Chunks.Radius
 	}
-	return filepath.Join(DefaultInstallPrefix, "recordings") // fallback
+	return 2 // fallback
 }
 
-// GetWorldsConfigFile returns the configured worlds config file path
-func GetWorldsConfigFile() string {
+// GetComponentsDir returns the directory of plugin component schemas
+func GetComponentsDir() string {
 	if Config != nil {
-		return filepath.Join(Config.Paths.WorldsDir, Config.Worlds.ConfigFile)
+		return Config.Components.Dir
 	}
-	return filepath.Join(DefaultInstallPrefix, "share", "worlds", "config.yaml") // fallback
+	return "" // fallback
 }
 
-// GetAvatarsConfigFile returns the configured avatars config file path
-func GetAvatarsConfigFile() string {
+// GetComponentsStrict returns whether entity components without a schema
+// are refused
+func GetComponentsStrict() bool {
 	if Config != nil {
-		return filepath.Join(Config.Paths.AvatarsDir, Config.Avatars.ConfigFile)
+		return Config.Components.Strict
 	}
-	return filepath.Join(DefaultInstallPrefix, "share", "avatars", "config.yaml") // fallback
+	return false // fallback
 }
 
-// WebSocket configuration getters
-func GetWebSocketWriteTimeout() time.Duration {
+// GetHooksFile returns the file of lifecycle hook commands
+func GetHooksFile() string {
 	if Config != nil {
-		return Config.WebSocket.WriteTimeout
+		return Config.Hooks.File
 	}
-	return 10 * time.Second // fallback
+	return "" // fallback
 }
 
-func GetWebSocketPongTimeout() time.Duration {
+func GetEntitiesMaxTriangles() int {
 	if Config != nil {
-		return Config.WebSocket.PongTimeout
+		return Config.Entities.MaxTriangles
 	}
-	return 60 * time.Second // fallback
+	return 2000000 // fallback
 }
 
-func GetWebSocketPingPeriod() time.Duration {
+func GetEntitiesPenalty() time.Duration {
 	if Config != nil {
-		return Config.WebSocket.PingPeriod
+		return Config.Entities.Penalty
 	}
-	return 54 * time.Second // fallback
+	return 10 * time.Second // fallback
 }
 
-func GetWebSocketMaxMessageSize() int64 {
+func GetEntitiesPenaltyMax() time.Duration {
 	if Config != nil {
-		return Config.WebSocket.MaxMessageSize
+		return Config.Entities.PenaltyMax
 	}
-	return 512 // fallback
+	return 10 * time.Minute // fallback
 }
 
-func GetWebSocketReadBufferSize() int {
+// Compression configuration getters
+func GetCompressionEnabled() bool {
 	if Config != nil {
-		return Config.WebSocket.ReadBufferSize
+		return Config.Compression.Enabled
 	}
-	return 1024 // fallback
+	return true // fallback
 }
 
-func GetWebSocketWriteBufferSize() int {
+func GetCompressionMinSize() int {
 	if Config != nil {
-		return Config.WebSocket.WriteBufferSize
+		return Config.Compression.MinSize
 	}
 	return 1024 // fallback
 }
 
-func GetWebSocketClientWorldBuffer() int {
+func GetCompressionTypes() []string {
 	if Config != nil {
-		return Config.WebSocket.ClientWorldBuffer
+		return Config.Compression.Types
 	}
-	return 256 // fallback
+	return []string{"text/*", "application/json", "application/javascript"} // fallback
 }
 
-// Session configuration getters
-func GetSessionCleanupInterval() time.Duration {
+// Feature flag configuration getters
+func GetFeaturesFile() string {
 	if Config != nil {
-		return Config.Session.CleanupInterval
+		return Config.Features.File
 	}
-	return 2 * time.Minute // fallback
+	return "" // fallback
 }
 
-func GetSessionInactivityTimeout() time.Duration {
+func GetFeaturesEnabled() []string {
 	if Config != nil {
-		return Config.Session.InactivityTimeout
+		return Config.Features.Enabled
 	}
-	return 10 * time.Minute // fallback
+	return nil // fallback
 }
 
-func GetSessionHTTPClientTimeout() time.Duration {
+func GetFeaturesURL() string {
 	if Config != nil {
-		return Config.Session.HTTPClientTimeout
+		return Config.Features.URL
 	}
-	return 5 * time.Second // fallback
+	return "" // fallback
 }
 
-func GetSessionDefaultID() string {
+func GetFeaturesToken() string {
 	if Config != nil {
-		return Config.Session.DefaultSessionID
+		return Config.Features.Token
 	}
-	return create_unique_session_identifier() // fallback - generate unique ID
+	return "" // fallback
 }
 
-// Worlds configuration getters
-func GetWorldsDefaultWorld() string {
+func GetFeaturesRefresh() time.Duration {
 	if Config != nil {
-		return Config.Worlds.DefaultWorld
+		return Config.Features.Refresh
 	}
-	return "world_one" // fallback
+	return 30 * time.Second // fallback
 }
 
-func GetWorldsAutoJoinOnCreate() bool {
+func GetModerationToken() string {
 	if Config != nil {
-		return Config.Worlds.AutoJoinOnCreate
+		return Config.Moderation.Token
 	}
-	return true // fallback
+	return "" // fallback
 }
 
-func GetWorldsSyncOnJoin() bool {
+func GetModerationPolicyFile() string {
 	if Config != nil {
-		return Config.Worlds.SyncOnJoin
+		return Config.Moderation.PolicyFile
 	}
-	return true // fallback
+	return "" // fallback
 }
 
-// GetWorldsProtectedList returns the list of protected worlds
-func GetWorldsProtectedList() []string {
+func GetModerationAPIToken() string {
 	if Config != nil {
-		return Config.Worlds.ProtectedList
+		return Config.Moderation.APIToken
 	}
-	return []string{"world_one", "world_two"} // fallback
+	return "" // fallback
 }
 
-// GetInternalAPIBase returns the configured internal API base URL
-func GetInternalAPIBase() string {
+// GetEnvironmentTick returns how often environments advance
+func GetEnvironmentTick() time.Duration {
 	if Config != nil {
-		return Config.Server.InternalAPIBase
+		return Config.Environment.Tick
 	}
-	return "http://localhost:8080/api" // fallback
+	return 30 * time.Second // fallback
 }
 
-// GetVersion returns the configured HD1 version
-func GetVersion() string {
+// GetEnvironmentDayLength returns the real time per in-world day of a
+// world; 0 stops its clock
+func GetEnvironmentDayLength(world string) time.Duration {
 	if Config != nil {
-		return Config.Server.Version
+		if dayLength, ok := Config.Environment.WorldDayLengths[world]; ok {
+			return dayLength
+		}
+		return Config.Environment.DayLength
 	}
-	return DefaultVersion // fallback
+	return 0 // fallback
 }
 
-// Avatars configuration getters
-func GetAvatarsMaxConcurrentCreations() int {
+// GetEnvironmentWeatherInterval returns the average time between weather
+// changes in a world; 0 keeps its weather
+func GetEnvironmentWeatherInterval(world string) time.Duration {
 	if Config != nil {
-		return Config.Avatars.MaxConcurrentCreations
+		if interval, ok := Config.Environment.WorldWeatherIntervals[world]; ok {
+			return interval
+		}
+		return Config.Environment.WeatherInterval
 	}
-	return 2 // fallback
+	return 0 // fallback
 }
 
-func GetAvatarsHealthCheckInterval() time.Duration {
+// GetEnvironmentWeathers returns the weather states cycles may pick
+func GetEnvironmentWeathers() []string {
 	if Config != nil {
-		return Config.Avatars.HealthCheckInterval
+		return Config.Environment.Weathers
 	}
-	return 5 * time.Second // fallback
+	return []string{"clear", "cloudy", "fog", "rain", "storm", "snow"} // fallback
 }
 
-func GetAvatarsPositionUpdateThrottle() time.Duration {
+// GetMediaAllowedHosts returns the hosts media streams may be played
+// from; empty allows any
+func GetMediaAllowedHosts() []string {
 	if Config != nil {
-		return Config.Avatars.PositionUpdateThrottle
+		return Config.Media.AllowedHosts
 	}
-	return 16 * time.Millisecond // fallback
+	return []string{} // fallback
 }
 
-func GetAvatarsMaxReconnectAttempts() int {
+// GetBookingsWebhookURL returns the URL receiving booking reminders; empty
+// sends none
+func GetBookingsWebhookURL() string {
 	if Config != nil {
-		return Config.Avatars.MaxReconnectAttempts
+		return Config.Bookings.WebhookURL
 	}
-	return 99 // fallback
+	return "" // fallback
 }
 
-func GetAvatarsReconnectDelay() time.Duration {
+// GetBookingsWebhookSecret returns the key signing reminder bodies
+func GetBookingsWebhookSecret() string {
 	if Config != nil {
-		return Config.Avatars.ReconnectDelay
+		return Config.Bookings.WebhookSecret
 	}
-	return 1 * time.Second // fallback
+	return "" // fallback
 }
 
-func GetAvatarsMaxReconnectDelay() time.Duration {
+// GetBookingsTick returns how often due reminders are sent
+func GetBookingsTick() time.Duration {
 	if Config != nil {
-		return Config.Avatars.MaxReconnectDelay
+		return Config.Bookings.Tick
 	}
 	return 30 * time.Second // fallback
 }
 
-func GetAvatarsHeartbeatFrequency() time.Duration {
+// GetBookingsMaxPerWorld returns how many bookings a world may hold
+func GetBookingsMaxPerWorld() int {
 	if Config != nil {
-		return Config.Avatars.HeartbeatFrequency
+		return Config.Bookings.MaxPerWorld
 	}
-	return 5 * time.Second // fallback
+	return 500 // fallback
 }
 
-// Sync protocol configuration getters
-func GetSyncProtocol() string {
+// GetGuestsRequireLink reports whether remote sessions must join through a
+// guest link
+func GetGuestsRequireLink() bool {
 	if Config != nil {
-		return Config.Sync.Protocol
+		return Config.Guests.RequireLink
 	}
-	return "HD1-VSC-v1.0" // fallback
+	return false // fallback
 }
 
-func GetSyncInterval() time.Duration {
+// GetGuestsDefaultLifetime returns the lifetime of links created without one
+func GetGuestsDefaultLifetime() time.Duration {
 	if Config != nil {
-		return Config.Sync.SyncInterval
+		return Config.Guests.DefaultLifetime
 	}
-	return 16 * time.Millisecond // fallback
+	return 24 * time.Hour // fallback
 }
 
-func GetSyncMaxDeltaLog() int {
+// GetEmailConfig returns the outbound email settings organizations without
+// their own use
+func GetEmailConfig() EmailConfig {
 	if Config != nil {
-		return Config.Sync.MaxDeltaLog
+		return Config.Email
 	}
-	return 10000 // fallback
+	return EmailConfig{SMTPPort: 587, TLS: "starttls", From: "HD1 <hd1@localhost>", RatePerHour: 100} // fallback
 }
 
-func GetSyncChecksumAlgorithm() string {
+// GetEmailOrgFile returns the per-organization email settings file
+func GetEmailOrgFile() string {
 	if Config != nil {
-		return Config.Sync.ChecksumAlgorithm
+		return Config.Email.OrgFile
 	}
-	return "sha256" // fallback
+	return "" // fallback
 }
 
-func GetSyncCausalityTimeout() time.Duration {
+// GetEmailTemplatesDir returns the directory of templates overriding the
+// embedded ones
+func GetEmailTemplatesDir() string {
 	if Config != nil {
-		return Config.Sync.CausalityTimeout
+		return Config.Email.TemplatesDir
 	}
-	return 5 * time.Second // fallback
+	return "" // fallback
 }
 
-func GetSyncDeltaQueueSize() int {
+// GetConnectorsFile returns the per-organization connectors file
+func GetConnectorsFile() string {
 	if Config != nil {
-		return Config.Sync.DeltaQueueSize
+		return Config.Connectors.File
 	}
-	return 1000 // fallback
+	return "" // fallback
 }
 
-func GetSyncAvatarRegistrySize() int {
+// GetConnectorsCapacity returns the sessions of an organization at which
+// connectors report capacity reached, 0 for none
+func GetConnectorsCapacity() int {
 	if Config != nil {
-		return Config.Sync.AvatarRegistrySize
+		return Config.Connectors.Capacity
 	}
-	return 100 // fallback
+	return 0 // fallback
 }
 
-func GetSyncBroadcastWorldBuffer() int {
+// GetConnectorsTimeout returns how long a webhook call may take
+func GetConnectorsTimeout() time.Duration {
 	if Config != nil {
-		return Config.Sync.BroadcastWorldBuffer
+		return Config.Connectors.Timeout
 	}
-	return 1024 // fallback
+	return 10 * time.Second // fallback
 }
 
-func GetSyncWorldStateCompressionEnabled() bool {
+// GetConnectorsCooldown returns how long a connector drops repeats of an
+// event
+func GetConnectorsCooldown() time.Duration {
 	if Config != nil {
-		return Config.Sync.WorldStateCompressionEnabled
+		return Config.Connectors.Cooldown
 	}
-	return true // fallback
+	return time.Minute // fallback
 }
 
-func GetSyncPerformanceMetricsEnabled() bool {
+// GetBindingsTick returns how often entity property bindings are
+// evaluated, 0 when they are not
+func GetBindingsTick() time.Duration {
 	if Config != nil {
-		return Config.Sync.PerformanceMetricsEnabled
+		return Config.Bindings.Tick
 	}
-	return false // fallback
+	return 100 * time.Millisecond // fallback
 }
 
-func GetSyncVectorClockPrecision() int {
+// GetImportsTool returns the assimp executable CAD imports convert with
+func GetImportsTool() string {
 	if Config != nil {
-		return Config.Sync.VectorClockPrecision
+		return Config.Imports.Tool
 	}
-	return 64 // fallback
+	return "assimp" // fallback
+}
+
+// GetImportsWorkers returns how many import jobs run at once
+func GetImportsWorkers() int {
+	if Config != nil {
+		return Config.Imports.Workers
+	}
+	return 1 // fallback
+}
+
+// GetImportsTimeout returns how long an import's conversion may take
+func GetImportsTimeout() time.Duration {
+	if Config != nil {
+		return Config.Imports.Timeout
+	}
+	return 10 * time.Minute // fallback
+}
+
+// GetImportsMaxEntities returns how many entities one import may create
+func GetImportsMaxEntities() int {
+	if Config != nil {
+		return Config.Imports.MaxEntities
+	}
+	return 2000 // fallback
 }
 
 // GetString returns a configuration value as string (used by database package)
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Profiles are named sets of HD1_* settings, in .env format, selected with
+// HD1_PROFILE or --profile: one binary runs as "production" or as tenant
+// "acme" without a long flag list. Several profiles layer left to right,
+// so HD1_PROFILE=production,acme applies acme over production. Profiles sit
+// over the defaults and .env, and under the environment and flags.
+
+// profileName is a profile in the profiles directory; anything else is
+// taken as a file path
+var profileName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// readEnvFile parses KEY=VALUE lines; the first value of a key wins
+func readEnvFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip empty lines and comments
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Parse KEY=VALUE format
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(parts[0])
+		if _, seen := values[key]; !seen {
+			values[key] = strings.Trim(strings.TrimSpace(parts[1]), "\"'")
+		}
+	}
+	return values, scanner.Err()
+}
+
+// applyEnv sets environment variables that are not already set
+func applyEnv(values map[string]string) {
+	for key, value := range values {
+		if os.Getenv(key) == "" {
+			os.Setenv(key, value)
+		}
+	}
+}
+
+// argValue finds a flag in the command line before flags are parsed, as
+// profiles must apply before the environment is read
+func argValue(name string) string {
+	args := os.Args[1:]
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		trimmed := strings.TrimLeft(arg, "-")
+		if trimmed == arg || len(arg)-len(trimmed) > 2 {
+			continue
+		}
+		if value, ok := strings.CutPrefix(trimmed, name+"="); ok {
+			return value
+		}
+		if trimmed == name && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// loadProfiles applies the selected profiles. The selection and the
+// profiles directory are read from flags, then the environment, then .env.
+func (c *HD1Config) loadProfiles(dotEnv map[string]string) error {
+	lookup := func(flagName, key string) string {
+		if value := argValue(flagName); value != "" {
+			return value
+		}
+		if value := os.Getenv(key); value != "" {
+			return value
+		}
+		return dotEnv[key]
+	}
+
+	selection := lookup("profile", "HD1_PROFILE")
+	if selection == "" {
+		return nil
+	}
+	c.Paths.ProfilesDir = lookup("profiles-dir", "HD1_PROFILES_DIR")
+	if c.Paths.ProfilesDir == "" {
+		rootDir := lookup("root-dir", "HD1_ROOT_DIR")
+		if rootDir == "" {
+			rootDir = c.Paths.RootDir
+		}
+		c.Paths.ProfilesDir = filepath.Join(rootDir, "share", "profiles")
+	}
+
+	var layers []map[string]string
+	for _, profile := range strings.Split(selection, ",") {
+		profile = strings.TrimSpace(profile)
+		if profile == "" {
+			continue
+		}
+		path := profile
+		if profileName.MatchString(profile) && !strings.HasSuffix(profile, ".env") {
+			path = filepath.Join(c.Paths.ProfilesDir, profile+".env")
+		}
+		values, err := readEnvFile(path)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("profile %q not found: %s", profile, path)
+		} else if err != nil {
+			return fmt.Errorf("profile %q: %v", profile, err)
+		}
+		// Profiles choose settings, not other profiles
+		delete(values, "HD1_PROFILE")
+		delete(values, "HD1_PROFILES_DIR")
+		layers = append(layers, values)
+		c.Server.Profiles = append(c.Server.Profiles, profile)
+	}
+
+	// Set-if-unset, so the last profile applies first and wins
+	for i := len(layers) - 1; i >= 0; i-- {
+		applyEnv(layers[i])
+	}
+	return nil
+}
@@ -0,0 +1,447 @@
+// Package connectors posts world events to Slack and Teams incoming
+// webhooks: sessions starting, an organization reaching capacity, and
+// high-risk security events such as bans.
+//
+// Organizations configure their connectors in the connectors file, each
+// with a webhook, the events and worlds it reports, and optional templates
+// for its messages; organizations the file does not name use its "default"
+// entry. Events are posted in the background, and a connector drops repeats
+// of an event within the cooldown so a flood of them does not flood the
+// channel.
+package connectors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+)
+
+// Events connectors report
+const (
+	EventSessionStarted  = "session.started"    // A session joined a world
+	EventCapacityReached = "capacity.reached"   // An organization's sessions reached its capacity
+	EventSecurity        = "security.high_risk" // A ban, a banned session returning, a forged operator token
+)
+
+// Events lists the events connectors report
+var Events = []string{EventSessionStarted, EventCapacityReached, EventSecurity}
+
+// Kinds of connector, by the webhook they post to
+const (
+	KindSlack = "slack"
+	KindTeams = "teams"
+)
+
+// DefaultOrganization applies to organizations the connectors file does not
+// name
+const DefaultOrganization = "default"
+
+// MaxConnectors bounds an organization's connectors
+const MaxConnectors = 20
+
+// queueSize bounds the events waiting to be posted; more are dropped
+const queueSize = 256
+
+var connectorName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ErrNotFound is returned for unknown connectors
+var ErrNotFound = errors.New("connector not found")
+
+// Connector posts an organization's events to a webhook
+type Connector struct {
+	Name      string            `json:"name"`
+	Kind      string            `json:"kind"` // slack or teams
+	URL       string            `json:"url"`
+	Events    []string          `json:"events,omitempty"`    // Every event when empty
+	Worlds    []string          `json:"worlds,omitempty"`    // Every world when empty
+	Templates map[string]string `json:"templates,omitempty"` // Message text by event, overriding the defaults
+	Disabled  bool              `json:"disabled,omitempty"`
+
+	templates map[string]*template.Template
+}
+
+// Organization is an organization's entry in the connectors file
+type Organization struct {
+	Capacity   *int        `json:"capacity,omitempty"` // Overrides the configured capacity; 0 for none
+	Connectors []Connector `json:"connectors"`
+}
+
+// Document is the format of the connectors file
+type Document struct {
+	Organizations map[string]Organization `json:"organizations"`
+}
+
+// Event is something that happened in a world, as connectors report it
+type Event struct {
+	Type     string    `json:"type"`
+	Org      string    `json:"org"`
+	World    string    `json:"world"`
+	Time     time.Time `json:"time"`
+	Session  string    `json:"session,omitempty"`  // HD1 ID of the session concerned
+	Sessions int       `json:"sessions,omitempty"` // The organization's connected sessions
+	Capacity int       `json:"capacity,omitempty"`
+	Summary  string    `json:"summary,omitempty"` // What happened, for security events
+	Detail   string    `json:"detail,omitempty"`
+	Actor    string    `json:"actor,omitempty"` // Who acted
+	Key      string    `json:"-"`               // Tells repeats of an event apart; Summary when empty
+}
+
+// Result is the outcome of posting to one connector
+type Result struct {
+	Connector string `json:"connector"`
+	Delivered bool   `json:"delivered"`
+	Error     string `json:"error,omitempty"`
+}
+
+type delivery struct {
+	org       string
+	connector *Connector
+	event     *Event
+}
+
+var (
+	organizations = map[string]*Organization{}
+	reached       = map[string]bool{}      // Organizations at capacity
+	recent        = map[string]time.Time{} // Last post of each event per connector
+	queue         = make(chan delivery, queueSize)
+	mutex         sync.Mutex
+)
+
+// Load reads the connectors file; a missing file leaves every organization
+// without connectors
+func Load() error {
+	file := config.GetConnectorsFile()
+	loaded := map[string]*Organization{}
+	raw, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		var document Document
+		if err := json.Unmarshal(raw, &document); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		for org, entry := range document.Organizations {
+			entry := entry
+			if err := entry.validate(); err != nil {
+				return fmt.Errorf("%s: organization %q: %v", file, org, err)
+			}
+			loaded[org] = &entry
+		}
+	}
+
+	mutex.Lock()
+	organizations = loaded
+	mutex.Unlock()
+
+	count := 0
+	for _, entry := range loaded {
+		count += len(entry.Connectors)
+	}
+	logging.Info("connectors loaded", map[string]interface{}{
+		"file":          file,
+		"organizations": len(loaded),
+		"connectors":    count,
+	})
+	return nil
+}
+
+func (o *Organization) validate() error {
+	if o.Capacity != nil && *o.Capacity < 0 {
+		return fmt.Errorf("capacity must not be negative")
+	}
+	if len(o.Connectors) > MaxConnectors {
+		return fmt.Errorf("at most %d connectors", MaxConnectors)
+	}
+	names := map[string]bool{}
+	for i := range o.Connectors {
+		connector := &o.Connectors[i]
+		if names[connector.Name] {
+			return fmt.Errorf("duplicate connector %q", connector.Name)
+		}
+		names[connector.Name] = true
+		if err := connector.validate(); err != nil {
+			return fmt.Errorf("connector %q: %v", connector.Name, err)
+		}
+	}
+	return nil
+}
+
+func (c *Connector) validate() error {
+	if !connectorName.MatchString(c.Name) {
+		return fmt.Errorf("name must match %s", connectorName)
+	}
+	if c.Kind != KindSlack && c.Kind != KindTeams {
+		return fmt.Errorf("kind must be %s or %s", KindSlack, KindTeams)
+	}
+	parsed, err := url.Parse(c.URL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return fmt.Errorf("url must be an http(s) webhook URL")
+	}
+	for _, event := range c.Events {
+		if !known(event) {
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+	c.templates = map[string]*template.Template{}
+	for event, text := range c.Templates {
+		if !known(event) {
+			return fmt.Errorf("template for unknown event %q", event)
+		}
+		parsed, err := template.New(event).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return fmt.Errorf("template %s: %v", event, err)
+		}
+		c.templates[event] = parsed
+	}
+	return nil
+}
+
+func known(event string) bool {
+	for _, candidate := range Events {
+		if candidate == event {
+			return true
+		}
+	}
+	return false
+}
+
+// reports tells whether a connector reports an event
+func (c *Connector) reports(event *Event) bool {
+	if c.Disabled {
+		return false
+	}
+	return matches(c.Events, event.Type) && matches(c.Worlds, event.World)
+}
+
+func matches(filter []string, value string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	for _, candidate := range filter {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// organization returns an organization's entry, or the default one; the
+// caller holds the mutex
+func organization(org string) *Organization {
+	if found, ok := organizations[org]; ok {
+		return found
+	}
+	return organizations[DefaultOrganization]
+}
+
+// Public returns a copy of a connector whose URL shows only its host, as
+// webhook URLs carry their secret in the path
+func (c *Connector) Public() Connector {
+	public := *c
+	if parsed, err := url.Parse(c.URL); err == nil {
+		public.URL = parsed.Scheme + "://" + parsed.Host + "/…"
+	}
+	public.templates = nil
+	return public
+}
+
+// List returns an organization's connectors with their URLs redacted
+func List(org string) []Connector {
+	mutex.Lock()
+	defer mutex.Unlock()
+	result := []Connector{}
+	if found := organization(org); found != nil {
+		for i := range found.Connectors {
+			result = append(result, found.Connectors[i].Public())
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Capacity returns the sessions at which an organization reaches capacity,
+// 0 for none
+func Capacity(org string) int {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if found := organization(org); found != nil && found.Capacity != nil {
+		return *found.Capacity
+	}
+	return config.GetConnectorsCapacity()
+}
+
+// Publish queues an event for the organization's connectors reporting it.
+// Repeats within the cooldown are dropped, and so are events arriving while
+// the queue is full.
+func Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	key := event.Key
+	if key == "" {
+		key = event.Summary
+	}
+	cooldown := config.GetConnectorsCooldown()
+
+	mutex.Lock()
+	found := organization(event.Org)
+	if found == nil {
+		mutex.Unlock()
+		return
+	}
+	var deliveries []delivery
+	for i := range found.Connectors {
+		connector := &found.Connectors[i]
+		if !connector.reports(&event) {
+			continue
+		}
+		repeat := strings.Join([]string{event.Org, connector.Name, event.Type, event.World, key}, "\x00")
+		if last, ok := recent[repeat]; ok && event.Time.Sub(last) < cooldown {
+			continue
+		}
+		recent[repeat] = event.Time
+		deliveries = append(deliveries, delivery{org: event.Org, connector: connector, event: &event})
+	}
+	for repeat, last := range recent {
+		if event.Time.Sub(last) >= cooldown {
+			delete(recent, repeat)
+		}
+	}
+	mutex.Unlock()
+
+	for _, d := range deliveries {
+		select {
+		case queue <- d:
+		default:
+			logging.Warn("connector queue full, event dropped", map[string]interface{}{
+				"org":       d.org,
+				"connector": d.connector.Name,
+				"event":     event.Type,
+			})
+		}
+	}
+}
+
+// Occupancy reports an organization's connected sessions in a world,
+// publishing capacity.reached when they reach its capacity. The event is
+// published again only after the sessions drop below capacity, and not
+// within the cooldown.
+func Occupancy(org, world string, sessions int) {
+	capacity := Capacity(org)
+	if capacity == 0 {
+		return
+	}
+	mutex.Lock()
+	was := reached[org]
+	reached[org] = sessions >= capacity
+	mutex.Unlock()
+	if sessions >= capacity && !was {
+		Publish(Event{
+			Type:     EventCapacityReached,
+			Org:      org,
+			World:    world,
+			Sessions: sessions,
+			Capacity: capacity,
+		})
+	}
+}
+
+// Run posts queued events until ctx ends
+func Run(ctx context.Context) {
+	client := newClient()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d := <-queue:
+			if err := post(ctx, client, d.connector, d.event); err != nil {
+				logging.Warn("connector post failed", map[string]interface{}{
+					"org":       d.org,
+					"connector": d.connector.Name,
+					"event":     d.event.Type,
+					"error":     err.Error(),
+				})
+				continue
+			}
+			logging.Debug("connector post sent", map[string]interface{}{
+				"org":       d.org,
+				"connector": d.connector.Name,
+				"event":     d.event.Type,
+			})
+		}
+	}
+}
+
+// Test posts a sample event of each connector's first event, or of the
+// given one, to an organization's connectors, or to the one named, now
+func Test(ctx context.Context, org, name, eventType string) ([]Result, error) {
+	if eventType != "" && !known(eventType) {
+		return nil, fmt.Errorf("unknown event %q", eventType)
+	}
+	mutex.Lock()
+	var targets []*Connector
+	if found := organization(org); found != nil {
+		for i := range found.Connectors {
+			if name == "" || found.Connectors[i].Name == name {
+				targets = append(targets, &found.Connectors[i])
+			}
+		}
+	}
+	mutex.Unlock()
+	if name != "" && len(targets) == 0 {
+		return nil, ErrNotFound
+	}
+
+	client := newClient()
+	results := []Result{}
+	for _, connector := range targets {
+		event := Sample(org, eventType)
+		if eventType == "" && len(connector.Events) > 0 {
+			event = Sample(org, connector.Events[0])
+		}
+		result := Result{Connector: connector.Name}
+		if err := post(ctx, client, connector, event); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Delivered = true
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Sample returns an example of an event, as connector tests post it
+func Sample(org, eventType string) *Event {
+	event := &Event{
+		Type:     eventType,
+		Org:      org,
+		World:    config.GetWorldsDefaultWorld(),
+		Time:     time.Now().UTC(),
+		Session:  "hd1-test",
+		Sessions: 1,
+	}
+	switch eventType {
+	case EventCapacityReached:
+		event.Sessions, event.Capacity = 50, 50
+	case EventSecurity:
+		event.Summary = "Connector test"
+		event.Detail = "This is a test of a security connector."
+		event.Actor = "operator"
+	default:
+		event.Type = EventSessionStarted
+	}
+	return event
+}
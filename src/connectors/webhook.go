@@ -0,0 +1,128 @@
+package connectors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"holodeck1/config"
+)
+
+// Message templates are Go text/template strings filled with the Event.
+// Connectors override them per event in their "templates".
+
+// titles head each event's message
+var titles = map[string]string{
+	EventSessionStarted:  "Session started",
+	EventCapacityReached: "Capacity reached",
+	EventSecurity:        "High-risk security event",
+}
+
+var defaultTemplates = map[string]*template.Template{
+	EventSessionStarted: template.Must(template.New(EventSessionStarted).Parse(
+		`{{.Session}} joined {{.World}}; {{.Sessions}} session{{if ne .Sessions 1}}s{{end}} of {{.Org}} connected.`)),
+	EventCapacityReached: template.Must(template.New(EventCapacityReached).Parse(
+		`{{.Org}} reached its capacity of {{.Capacity}} sessions in {{.World}}.`)),
+	EventSecurity: template.Must(template.New(EventSecurity).Parse(
+		`{{.Summary}} in {{.World}}{{if .Actor}} by {{.Actor}}{{end}}.{{if .Detail}} {{.Detail}}{{end}}`)),
+}
+
+// Render returns the title and text a connector posts for an event
+func (c *Connector) Render(event *Event) (title, text string, err error) {
+	tmpl := c.templates[event.Type]
+	if tmpl == nil {
+		tmpl = defaultTemplates[event.Type]
+	}
+	if tmpl == nil {
+		return "", "", fmt.Errorf("unknown event %q", event.Type)
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, event); err != nil {
+		return "", "", fmt.Errorf("template %s: %v", event.Type, err)
+	}
+	return titles[event.Type], strings.TrimSpace(out.String()), nil
+}
+
+// payload builds the body a connector's webhook expects: a Slack message,
+// or a Teams message carrying an Adaptive Card
+func (c *Connector) payload(event *Event) ([]byte, error) {
+	title, text, err := c.Render(event)
+	if err != nil {
+		return nil, err
+	}
+	if c.Kind == KindSlack {
+		return json.Marshal(map[string]interface{}{
+			"text": "*" + slackEscape(title) + "*\n" + slackEscape(text),
+		})
+	}
+	return json.Marshal(map[string]interface{}{
+		"type": "message",
+		"attachments": []interface{}{map[string]interface{}{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]interface{}{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body": []interface{}{
+					map[string]interface{}{"type": "TextBlock", "text": title, "weight": "Bolder", "size": "Medium"},
+					map[string]interface{}{"type": "TextBlock", "text": text, "wrap": true},
+					map[string]interface{}{"type": "FactSet", "facts": []interface{}{
+						map[string]string{"title": "World", "value": event.World},
+						map[string]string{"title": "Organization", "value": event.Org},
+						map[string]string{"title": "Time", "value": event.Time.Format("2006-01-02 15:04:05 MST")},
+					}},
+				},
+			},
+		}},
+	})
+}
+
+// slackEscape escapes the characters Slack reads as markup
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+func newClient() *http.Client {
+	return &http.Client{
+		Timeout: config.GetConnectorsTimeout(),
+		// Webhooks answer directly; a redirect is not followed with the event
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// post delivers an event to a connector's webhook
+func post(ctx context.Context, client *http.Client, connector *Connector, event *Event) error {
+	body, err := connector.payload(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, connector.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		// The URL carries the webhook's secret; keep it out of the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,440 @@
+// Package consent tracks who accepted which version of the terms of
+// service, privacy policy and the other documents the consent file lists.
+//
+// The consent file (YAML) names each document at its current version:
+//
+//	documents:
+//	  tos:
+//	    title: Terms of Service
+//	    version: "2026-03"
+//	    url: https://example.com/terms
+//	    required: true
+//	  privacy:
+//	    title: Privacy Policy
+//	    version: "3"
+//	    url: https://example.com/privacy
+//	    required: true
+//
+// Accepting documents issues a consent token that stands for the person
+// across sessions; consoles keep it and present it as ?consent= when they
+// join. Only a hash of each token is kept, with the versions accepted and
+// the history of every acceptance and withdrawal, in the storage backend.
+// Raising a document's version asks everyone to accept it again. While a
+// document is required, sessions whose token has not accepted its current
+// version are refused. A missing file lists no documents.
+package consent
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+
+	"holodeck1/config"
+	"holodeck1/storage"
+)
+
+// RecordType tags consent records in compliance reports
+const RecordType = "consent_management"
+
+// TokenPrefix starts every consent token, telling them apart from session
+// and guest tokens
+const TokenPrefix = "hd1c_"
+
+// Actions a consent event records
+const (
+	ActionAccept   = "accept"
+	ActionWithdraw = "withdraw"
+)
+
+// MaxHistory bounds the events kept per record; the oldest are dropped,
+// the versions accepted are kept apart from them
+const MaxHistory = 500
+
+var (
+	// ErrInvalid is returned for tokens of no consent record
+	ErrInvalid = errors.New("consent token invalid")
+	// ErrUnknownDocument is returned for documents the consent file lacks
+	ErrUnknownDocument = errors.New("unknown consent document")
+	// ErrOutdated is returned accepting a version that is not current
+	ErrOutdated = errors.New("consent document version is not current")
+)
+
+var documentPattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+// Document is a text people accept, at its current version
+type Document struct {
+	ID       string `yaml:"-" json:"id"`
+	Title    string `yaml:"title" json:"title"`
+	Version  string `yaml:"version" json:"version"`
+	URL      string `yaml:"url" json:"url,omitempty"`
+	Required bool   `yaml:"required" json:"required"` // Joining needs the current version accepted
+}
+
+// File is the format of the consent file
+type File struct {
+	Documents map[string]*Document `yaml:"documents"`
+}
+
+func (d *Document) validate() error {
+	if !documentPattern.MatchString(d.ID) {
+		return fmt.Errorf("id must match %s", documentPattern)
+	}
+	d.Title = strings.TrimSpace(d.Title)
+	if d.Title == "" {
+		return fmt.Errorf("title required")
+	}
+	d.Version = strings.TrimSpace(d.Version)
+	if d.Version == "" || len(d.Version) > 64 {
+		return fmt.Errorf("version must be 1-64 characters")
+	}
+	return nil
+}
+
+// Choice names a document at the version someone was shown
+type Choice struct {
+	Document string `json:"document"`
+	Version  string `json:"version"`
+}
+
+// Who is the person behind a consent event, as the request showed them
+type Who struct {
+	IP    string
+	HD1ID string
+	Org   string
+}
+
+// Event is one acceptance or withdrawal
+type Event struct {
+	Document string    `json:"document"`
+	Version  string    `json:"version"`
+	Action   string    `json:"action"`
+	At       time.Time `json:"at"`
+	IP       string    `json:"ip,omitempty"`
+	HD1ID    string    `json:"hd1_id,omitempty"`
+	Org      string    `json:"org,omitempty"`
+}
+
+// Acceptance is the version of a document a record holds accepted
+type Acceptance struct {
+	Version    string    `json:"version"`
+	AcceptedAt time.Time `json:"accepted_at"`
+}
+
+// Record is the consent one token stands for
+type Record struct {
+	ID        string                `json:"id"`
+	TokenHash string                `json:"token_hash,omitempty"`
+	Accepted  map[string]Acceptance `json:"accepted"` // By document ID
+	History   []Event               `json:"history"`
+	CreatedAt time.Time             `json:"created_at"`
+	UpdatedAt time.Time             `json:"updated_at"`
+}
+
+// Public returns a copy of a record without its token hash
+func (r *Record) Public() *Record {
+	public := *r
+	public.TokenHash = ""
+	return &public
+}
+
+var (
+	documents      = map[string]*Document{}
+	documentsMutex sync.RWMutex
+
+	// recordsMutex serializes changes to records, which are read, changed
+	// and written back whole
+	recordsMutex sync.Mutex
+)
+
+// Load reads the consent file; a missing file lists no documents
+func Load() error {
+	file := config.GetConsentFile()
+	loaded := map[string]*Document{}
+	raw, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		var document File
+		if err := yaml.Unmarshal(raw, &document); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		for id, doc := range document.Documents {
+			if doc == nil {
+				doc = &Document{}
+			}
+			doc.ID = id
+			if err := doc.validate(); err != nil {
+				return fmt.Errorf("%s: document %q: %v", file, id, err)
+			}
+			loaded[id] = doc
+		}
+	}
+
+	documentsMutex.Lock()
+	documents = loaded
+	documentsMutex.Unlock()
+	return nil
+}
+
+// Documents returns the documents at their current version, by ID
+func Documents() []Document {
+	documentsMutex.RLock()
+	defer documentsMutex.RUnlock()
+	result := make([]Document, 0, len(documents))
+	for _, doc := range documents {
+		result = append(result, *doc)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// Gating reports whether joining requires consent
+func Gating() bool {
+	documentsMutex.RLock()
+	defer documentsMutex.RUnlock()
+	for _, doc := range documents {
+		if doc.Required {
+			return true
+		}
+	}
+	return false
+}
+
+func document(id string) (Document, bool) {
+	documentsMutex.RLock()
+	defer documentsMutex.RUnlock()
+	doc, ok := documents[id]
+	if !ok {
+		return Document{}, false
+	}
+	return *doc, true
+}
+
+// Pending returns the required documents a record has not accepted at
+// their current version; all of them for a nil record
+func Pending(record *Record) []Document {
+	pending := []Document{}
+	for _, doc := range Documents() {
+		if !doc.Required {
+			continue
+		}
+		if record != nil {
+			if accepted, ok := record.Accepted[doc.ID]; ok && accepted.Version == doc.Version {
+				continue
+			}
+		}
+		pending = append(pending, doc)
+	}
+	return pending
+}
+
+// NewToken generates a consent token and the hash a record keeps of it
+func NewToken() (token, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = TokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Records are stored under the hash of their token, which is all a token
+// needs to find its record
+func recordKey(hash string) (string, error) {
+	return storage.Key(storage.NamespaceConsent, "records/"+hash+".json")
+}
+
+// Lookup returns the record of a token, or ErrInvalid
+func Lookup(ctx context.Context, backend storage.Backend, token string) (*Record, error) {
+	if !strings.HasPrefix(token, TokenPrefix) {
+		return nil, ErrInvalid
+	}
+	return load(ctx, backend, hashToken(token))
+}
+
+func load(ctx context.Context, backend storage.Backend, hash string) (*Record, error) {
+	key, err := recordKey(hash)
+	if err != nil {
+		return nil, err
+	}
+	body, _, err := backend.Get(ctx, key)
+	if err == storage.ErrNotFound {
+		return nil, ErrInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var record Record
+	if err := json.NewDecoder(body).Decode(&record); err != nil {
+		return nil, err
+	}
+	if record.Accepted == nil {
+		record.Accepted = map[string]Acceptance{}
+	}
+	return &record, nil
+}
+
+func save(ctx context.Context, backend storage.Backend, record *Record) error {
+	key, err := recordKey(record.TokenHash)
+	if err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return backend.Put(ctx, key, bytes.NewReader(encoded), int64(len(encoded)), "application/json")
+}
+
+func (r *Record) record(event Event) {
+	r.History = append(r.History, event)
+	if len(r.History) > MaxHistory {
+		r.History = r.History[len(r.History)-MaxHistory:]
+	}
+	r.UpdatedAt = event.At
+}
+
+// Accept records the acceptance of documents at the versions shown. An
+// empty token starts a new record, whose token is returned; it is shown
+// once. Every version must be current, so nobody accepts a text they were
+// not shown.
+func Accept(ctx context.Context, backend storage.Backend, token string, choices []Choice, who Who) (*Record, string, error) {
+	if len(choices) == 0 {
+		return nil, "", fmt.Errorf("no documents to accept")
+	}
+	for _, choice := range choices {
+		doc, ok := document(choice.Document)
+		if !ok {
+			return nil, "", fmt.Errorf("%w: %q", ErrUnknownDocument, choice.Document)
+		}
+		if choice.Version != doc.Version {
+			return nil, "", fmt.Errorf("%w: %s is at version %s", ErrOutdated, doc.ID, doc.Version)
+		}
+	}
+
+	recordsMutex.Lock()
+	defer recordsMutex.Unlock()
+
+	now := time.Now().UTC()
+	issued := ""
+	var record *Record
+	if token == "" {
+		var hash string
+		var err error
+		issued, hash, err = NewToken()
+		if err != nil {
+			return nil, "", err
+		}
+		record = &Record{
+			ID:        "consent-" + uuid.New().String(),
+			TokenHash: hash,
+			Accepted:  map[string]Acceptance{},
+			CreatedAt: now,
+		}
+	} else {
+		var err error
+		if record, err = Lookup(ctx, backend, token); err != nil {
+			return nil, "", err
+		}
+	}
+
+	for _, choice := range choices {
+		record.Accepted[choice.Document] = Acceptance{Version: choice.Version, AcceptedAt: now}
+		record.record(Event{
+			Document: choice.Document,
+			Version:  choice.Version,
+			Action:   ActionAccept,
+			At:       now,
+			IP:       who.IP,
+			HD1ID:    who.HD1ID,
+			Org:      who.Org,
+		})
+	}
+	if err := save(ctx, backend, record); err != nil {
+		return nil, "", err
+	}
+	return record, issued, nil
+}
+
+// Withdraw records the withdrawal of documents a record holds accepted;
+// documents it does not hold are skipped. Withdrawing a required document
+// refuses the token's next join.
+func Withdraw(ctx context.Context, backend storage.Backend, token string, ids []string, who Who) (*Record, error) {
+	recordsMutex.Lock()
+	defer recordsMutex.Unlock()
+
+	record, err := Lookup(ctx, backend, token)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	for _, id := range ids {
+		accepted, ok := record.Accepted[id]
+		if !ok {
+			continue
+		}
+		delete(record.Accepted, id)
+		record.record(Event{
+			Document: id,
+			Version:  accepted.Version,
+			Action:   ActionWithdraw,
+			At:       now,
+			IP:       who.IP,
+			HD1ID:    who.HD1ID,
+			Org:      who.Org,
+		})
+	}
+	if err := save(ctx, backend, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Records returns every consent record, oldest first, without token
+// hashes
+func Records(ctx context.Context, backend storage.Backend) ([]*Record, error) {
+	objects, err := backend.List(ctx, storage.NamespaceConsent+"/records/")
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*Record, 0, len(objects))
+	for _, object := range objects {
+		name := object.Key[strings.LastIndex(object.Key, "/")+1:]
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		record, err := load(ctx, backend, strings.TrimSuffix(name, ".json"))
+		if err == ErrInvalid {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record.Public())
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].CreatedAt.Before(records[j].CreatedAt) })
+	return records, nil
+}
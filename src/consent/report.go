@@ -0,0 +1,73 @@
+package consent
+
+import (
+	"context"
+	"time"
+
+	"holodeck1/storage"
+)
+
+// Report sums up the consent records for compliance reviews
+type Report struct {
+	RecordType  string           `json:"record_type"`
+	GeneratedAt time.Time        `json:"generated_at"`
+	Records     int              `json:"records"`
+	Documents   []DocumentReport `json:"documents"`
+}
+
+// DocumentReport counts the records by where they stand on one document
+type DocumentReport struct {
+	Document
+	Current     int            `json:"current"`     // Holding the current version accepted
+	Outdated    int            `json:"outdated"`    // Holding an earlier version accepted
+	Withdrawn   int            `json:"withdrawn"`   // Withdrew and did not accept again
+	Acceptances map[string]int `json:"acceptances"` // Acceptances recorded per version
+}
+
+// Summarize reports on records, as Records returns them, against the
+// current documents
+func Summarize(records []*Record) *Report {
+	report := &Report{
+		RecordType:  RecordType,
+		GeneratedAt: time.Now().UTC(),
+		Records:     len(records),
+		Documents:   []DocumentReport{},
+	}
+	for _, doc := range Documents() {
+		summary := DocumentReport{Document: doc, Acceptances: map[string]int{}}
+		for _, record := range records {
+			withdrew := false
+			for _, event := range record.History {
+				if event.Document != doc.ID {
+					continue
+				}
+				switch event.Action {
+				case ActionAccept:
+					summary.Acceptances[event.Version]++
+				case ActionWithdraw:
+					withdrew = true
+				}
+			}
+			accepted, ok := record.Accepted[doc.ID]
+			switch {
+			case ok && accepted.Version == doc.Version:
+				summary.Current++
+			case ok:
+				summary.Outdated++
+			case withdrew:
+				summary.Withdrawn++
+			}
+		}
+		report.Documents = append(report.Documents, summary)
+	}
+	return report
+}
+
+// Compile loads every record and reports on it
+func Compile(ctx context.Context, backend storage.Backend) (*Report, []*Record, error) {
+	records, err := Records(ctx, backend)
+	if err != nil {
+		return nil, nil, err
+	}
+	return Summarize(records), records, nil
+}
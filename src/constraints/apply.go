@@ -0,0 +1,211 @@
+package constraints
+
+import (
+	"encoding/json"
+	"math"
+
+	"holodeck1/numbers"
+	"holodeck1/sync"
+)
+
+// Entity is what surface snapping reads of an entity
+type Entity struct {
+	Position [3]float64
+	Rotation [3]float64
+	Scale    [3]float64
+	Geometry map[string]interface{}
+}
+
+// Entities follows the operation log for the named entities, returning
+// those live at its end
+func Entities(ops []*sync.Operation, ids []string) map[string]*Entity {
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	entities := make(map[string]*Entity)
+	for _, op := range ops {
+		for _, part := range op.Parts() {
+			id, _ := part.Data["id"].(string)
+			if !wanted[id] {
+				continue
+			}
+			switch part.Type {
+			case sync.OpEntityCreate:
+				entities[id] = &Entity{Scale: [3]float64{1, 1, 1}}
+				entities[id].merge(part.Data)
+			case sync.OpEntityUpdate:
+				if entity, live := entities[id]; live {
+					entity.merge(part.Data)
+				}
+			case sync.OpEntityDelete:
+				delete(entities, id)
+			}
+		}
+	}
+	return entities
+}
+
+// merge copies the transform and geometry of operation data
+func (e *Entity) merge(data map[string]interface{}) {
+	if position, ok := vector(data["position"]); ok {
+		e.Position = position
+	}
+	if rotation, ok := vector(data["rotation"]); ok {
+		e.Rotation = rotation
+	}
+	if scale, ok := vector(data["scale"]); ok {
+		e.Scale = scale
+	}
+	if geometry := plain(data["geometry"]); geometry != nil {
+		e.Geometry = geometry
+	}
+}
+
+// Apply constrains the position and rotation of entity create or update
+// data in place and returns the properties it changed. entities holds the
+// surfaces, and the entity itself for updates; it is only read when the
+// rules name surfaces.
+func (r *Rules) Apply(data map[string]interface{}, entities map[string]*Entity) []string {
+	var changed []string
+	id, _ := data["id"].(string)
+
+	if position, ok := vector(data["position"]); ok {
+		snapped := position
+		if r.Grid > 0 {
+			for i := range snapped {
+				snapped[i] = snap(snapped[i], r.Grid)
+			}
+		}
+		if len(r.Surfaces) > 0 {
+			self := Entity{Scale: [3]float64{1, 1, 1}}
+			if stored, ok := entities[id]; ok {
+				self = *stored
+			}
+			self.merge(data)
+			snapped[1] = r.settle(id, snapped, &self, entities)
+		}
+		if snapped != position {
+			data["position"] = object(snapped)
+			changed = append(changed, "position")
+		}
+	}
+
+	if rotation, ok := vector(data["rotation"]); ok {
+		snapped := rotation
+		if r.Upright {
+			snapped[0], snapped[2] = 0, 0
+		}
+		if r.RotationSnap > 0 {
+			step := r.RotationSnap * math.Pi / 180
+			for i := range snapped {
+				snapped[i] = snap(snapped[i], step)
+			}
+		}
+		if snapped != rotation {
+			data["rotation"] = object(snapped)
+			changed = append(changed, "rotation")
+		}
+	}
+	return changed
+}
+
+// settle returns the height that rests an entity on the nearest surface
+// under or over it within the surface distance, or its own height. A
+// surface is its axis-aligned bounds; only planes laid flat turn.
+func (r *Rules) settle(id string, position [3]float64, self *Entity, entities map[string]*Entity) float64 {
+	own := extents(self)[1]
+	best, settled := r.SurfaceDistance, position[1]
+	for _, surfaceID := range r.Surfaces {
+		surface, ok := entities[surfaceID]
+		if !ok || surfaceID == id {
+			continue
+		}
+		half := extents(surface)
+		if math.Abs(position[0]-surface.Position[0]) > half[0] || math.Abs(position[2]-surface.Position[2]) > half[2] {
+			continue
+		}
+		top := surface.Position[1] + half[1]
+		if gap := math.Abs(position[1] - own - top); gap <= best {
+			best, settled = gap, numbers.Round(top+own, precision)
+		}
+	}
+	return settled
+}
+
+// extents returns an entity's half size along each axis, from the
+// renderer's defaults where its geometry leaves them out
+func extents(e *Entity) [3]float64 {
+	g := e.Geometry
+	var half [3]float64
+	switch g["type"] {
+	case "box":
+		half = [3]float64{number(g, "width", 1) / 2, number(g, "height", 1) / 2, number(g, "depth", 1) / 2}
+	case "sphere":
+		radius := number(g, "radius", 0.5)
+		half = [3]float64{radius, radius, radius}
+	case "cylinder", "cone":
+		radius := math.Max(number(g, "radiusTop", 0.5), number(g, "radiusBottom", 0.5))
+		half = [3]float64{radius, number(g, "height", 1) / 2, radius}
+	case "plane":
+		half = [3]float64{number(g, "width", 1) / 2, number(g, "height", 1) / 2, 0}
+		if math.Abs(math.Cos(e.Rotation[0])) < 0.5 {
+			half[1], half[2] = 0, half[1]
+		}
+	default:
+		half = [3]float64{0.5, 0.5, 0.5}
+	}
+	for i := range half {
+		half[i] *= math.Abs(e.Scale[i])
+	}
+	return half
+}
+
+// snap rounds value to the nearest multiple of step
+func snap(value, step float64) float64 {
+	return numbers.Round(math.Round(value/step)*step, precision)
+}
+
+// precision drops the float noise snapping leaves
+const precision = 6
+
+// number reads a positive geometry parameter
+func number(g map[string]interface{}, key string, fallback float64) float64 {
+	if value, ok := g[key].(float64); ok && value > 0 {
+		return value
+	}
+	return fallback
+}
+
+// vector reads an x, y, z value, decoded through JSON as operation data
+// holds typed structs in memory
+func vector(value interface{}) ([3]float64, bool) {
+	fields := plain(value)
+	var v [3]float64
+	for i, axis := range []string{"x", "y", "z"} {
+		component, ok := fields[axis].(float64)
+		if !ok {
+			return v, false
+		}
+		v[i] = component
+	}
+	return v, true
+}
+
+func plain(value interface{}) map[string]interface{} {
+	if value == nil {
+		return nil
+	}
+	if fields, ok := value.(map[string]interface{}); ok {
+		return fields
+	}
+	var fields map[string]interface{}
+	if encoded, err := json.Marshal(value); err == nil {
+		json.Unmarshal(encoded, &fields)
+	}
+	return fields
+}
+
+func object(v [3]float64) map[string]interface{} {
+	return map[string]interface{}{"x": v[0], "y": v[1], "z": v[2]}
+}
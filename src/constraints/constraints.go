@@ -0,0 +1,190 @@
+// Package constraints holds per-world editing constraints: a position grid,
+// a rotation snap, upright alignment and surfaces entities settle onto. The
+// server enforces them on the transforms of incoming entity creates and
+// updates, so collaborative building stays tidy whatever each client does.
+//
+// Constraints shape what editors send, not what the server derives:
+// bindings, restores and reverts apply as they are. Rules are written to
+// the storage backend and survive restarts.
+package constraints
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"holodeck1/entityid"
+	"holodeck1/logging"
+	"holodeck1/storage"
+)
+
+// Limits of valid rules
+const (
+	MaxGrid            = 100.0 // Metres
+	MaxSurfaces        = 32
+	MaxSurfaceDistance = 10.0 // Metres
+
+	// DefaultSurfaceDistance applies when surfaces are set without a distance
+	DefaultSurfaceDistance = 0.25
+)
+
+var worldPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Rules are a world's editing constraints. The zero value constrains
+// nothing.
+type Rules struct {
+	World           string     `json:"world"`
+	Grid            float64    `json:"grid"`                 // Position step in metres; 0 leaves positions free
+	RotationSnap    float64    `json:"rotation_snap"`        // Rotation step in degrees; 0 leaves rotations free
+	Upright         bool       `json:"upright"`              // Rotation about the y axis only
+	Surfaces        []string   `json:"surfaces"`             // Entities others settle onto
+	SurfaceDistance float64    `json:"surface_distance"`     // How near a surface an entity settles, metres
+	UpdatedBy       string     `json:"updated_by,omitempty"` // Operator who set them
+	UpdatedAt       *time.Time `json:"updated_at,omitempty"`
+}
+
+// Validate checks rules and normalizes their surfaces and distance
+func (r *Rules) Validate() error {
+	if !worldPattern.MatchString(r.World) {
+		return fmt.Errorf("world must match %s", worldPattern)
+	}
+	if r.Grid < 0 || r.Grid > MaxGrid {
+		return fmt.Errorf("grid must be 0-%g metres", MaxGrid)
+	}
+	if r.RotationSnap < 0 || r.RotationSnap > 180 {
+		return fmt.Errorf("rotation_snap must be 0-180 degrees")
+	}
+	if len(r.Surfaces) > MaxSurfaces {
+		return fmt.Errorf("at most %d surfaces", MaxSurfaces)
+	}
+	seen := make(map[string]bool, len(r.Surfaces))
+	surfaces := make([]string, 0, len(r.Surfaces))
+	for _, id := range r.Surfaces {
+		if err := entityid.Validate(id); err != nil {
+			return fmt.Errorf("surface %q: %v", id, err)
+		}
+		if !seen[id] {
+			seen[id] = true
+			surfaces = append(surfaces, id)
+		}
+	}
+	r.Surfaces = surfaces
+	if r.SurfaceDistance < 0 || r.SurfaceDistance > MaxSurfaceDistance {
+		return fmt.Errorf("surface_distance must be 0-%g metres", MaxSurfaceDistance)
+	}
+	if r.SurfaceDistance == 0 && len(r.Surfaces) > 0 {
+		r.SurfaceDistance = DefaultSurfaceDistance
+	}
+	return nil
+}
+
+// Active reports whether the rules constrain anything
+func (r *Rules) Active() bool {
+	return r.Grid > 0 || r.RotationSnap > 0 || r.Upright || len(r.Surfaces) > 0
+}
+
+var (
+	rules = make(map[string]*Rules) // Keyed by world
+	mutex sync.RWMutex
+)
+
+func rulesKey(world string) (string, error) {
+	return storage.Key(storage.NamespaceWorlds, world+"/constraints.json")
+}
+
+// Initialize loads every world's rules from the storage backend
+func Initialize(ctx context.Context) error {
+	backend := storage.Default()
+	if backend == nil {
+		return fmt.Errorf("storage backend unavailable")
+	}
+	objects, err := backend.List(ctx, storage.NamespaceWorlds+"/")
+	if err != nil {
+		return err
+	}
+
+	loaded := 0
+	for _, object := range objects {
+		if !strings.HasSuffix(object.Key, "/constraints.json") {
+			continue
+		}
+		body, _, err := backend.Get(ctx, object.Key)
+		if err != nil {
+			continue
+		}
+		var stored Rules
+		err = json.NewDecoder(body).Decode(&stored)
+		body.Close()
+		if err != nil || stored.Validate() != nil {
+			logging.Warn("skipping unreadable constraints", map[string]interface{}{"key": object.Key})
+			continue
+		}
+		mutex.Lock()
+		rules[stored.World] = &stored
+		mutex.Unlock()
+		loaded++
+	}
+
+	logging.Info("world constraints loaded", map[string]interface{}{
+		"worlds": loaded,
+	})
+	return nil
+}
+
+// Get returns a copy of a world's rules; the zero rules when it has none
+func Get(world string) *Rules {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	if stored, ok := rules[world]; ok {
+		copied := *stored
+		copied.Surfaces = append([]string{}, stored.Surfaces...)
+		return &copied
+	}
+	return &Rules{World: world, Surfaces: []string{}}
+}
+
+// Set validates and stores a world's rules. Rules that constrain nothing
+// clear the world's constraints.
+func Set(ctx context.Context, r *Rules) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	key, err := rulesKey(r.World)
+	if err != nil {
+		return err
+	}
+	backend := storage.Default()
+	if backend == nil {
+		return fmt.Errorf("storage backend unavailable")
+	}
+
+	if !r.Active() {
+		if err := backend.Delete(ctx, key); err != nil && err != storage.ErrNotFound {
+			return err
+		}
+		mutex.Lock()
+		delete(rules, r.World)
+		mutex.Unlock()
+		return nil
+	}
+
+	encoded, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := backend.Put(ctx, key, bytes.NewReader(encoded), int64(len(encoded)), "application/json"); err != nil {
+		return err
+	}
+	stored := *r
+	stored.Surfaces = append([]string{}, r.Surfaces...)
+	mutex.Lock()
+	rules[r.World] = &stored
+	mutex.Unlock()
+	return nil
+}
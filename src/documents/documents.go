@@ -0,0 +1,345 @@
+// Package documents keeps the text documents sessions edit together in each
+// world, such as meeting notes shown on an in-world panel.
+//
+// Edits are operations (see Operation) made against a revision of the
+// document. An edit made against an older revision is transformed past the
+// ones applied since, so concurrent edits all apply and every editor ends
+// up with the same text. Each session's cursor is kept per document and
+// moved by the edits around it. Documents live in memory like the sessions
+// editing them; one bound to a panel entity has its text written to the
+// panel, which the world keeps.
+package documents
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Limits of a valid document
+const (
+	MaxLength      = 8192 // Bytes of text, what a panel holds
+	MaxTitleLength = 200
+	MaxDocuments   = 100  // Per world
+	MaxHistory     = 1000 // Operations kept to transform late edits past
+)
+
+// ErrNotFound is returned for unknown documents
+var ErrNotFound = errors.New("document not found")
+
+// ErrTooMany is returned when a world holds MaxDocuments documents
+var ErrTooMany = fmt.Errorf("worlds hold at most %d documents", MaxDocuments)
+
+// ErrStale is returned for edits made against a revision older than the
+// history kept; the editor reloads the document
+var ErrStale = fmt.Errorf("revision is more than %d operations old", MaxHistory)
+
+// ErrBound is returned when binding a panel another document is bound to
+var ErrBound = errors.New("entity is bound to another document")
+
+var worldPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Document is a text edited together. History holds the latest
+// operations applied, the last one making Revision, and is never sent to
+// clients.
+type Document struct {
+	ID        string    `json:"id"`
+	World     string    `json:"world"`
+	Title     string    `json:"title"`
+	Text      string    `json:"text"`
+	Revision  int       `json:"revision"` // Operations applied since creation
+	EntityID  string    `json:"entity_id,omitempty"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Cursors   []*Cursor `json:"cursors"` // Sorted by session
+
+	history []Operation
+	cursors map[string]*Cursor
+}
+
+// Cursor is where a session is in a document: a caret, or a selection
+// between Anchor and Position
+type Cursor struct {
+	HD1ID     string    `json:"hd1_id"`
+	Name      string    `json:"name,omitempty"`
+	Position  int       `json:"position"` // Characters from the start
+	Anchor    int       `json:"anchor"`   // Position when nothing is selected
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Edit is an operation as applied, for the document's editors
+type Edit struct {
+	DocumentID string    `json:"document_id"`
+	World      string    `json:"world"`
+	Revision   int       `json:"revision"` // The document's once applied
+	Operation  Operation `json:"operation"`
+	HD1ID      string    `json:"hd1_id"`
+	Editor     string    `json:"editor,omitempty"` // Chosen by the submitter, to recognize its own edits
+}
+
+// Validate checks a document as submitted, trimming its title
+func (d *Document) Validate() error {
+	if !worldPattern.MatchString(d.World) {
+		return fmt.Errorf("world must match %s", worldPattern)
+	}
+	d.Title = strings.TrimSpace(d.Title)
+	if len(d.Title) > MaxTitleLength {
+		return fmt.Errorf("title must be at most %d characters", MaxTitleLength)
+	}
+	if len(d.Text) > MaxLength {
+		return fmt.Errorf("text must be at most %d bytes", MaxLength)
+	}
+	if !utf8.ValidString(d.Text) {
+		return errors.New("text must be UTF-8")
+	}
+	return nil
+}
+
+var (
+	documents = make(map[string]*Document)
+	mutex     sync.RWMutex
+)
+
+// Create adds a document at revision 0
+func Create(document *Document) error {
+	if err := document.Validate(); err != nil {
+		return err
+	}
+	document.ID = "doc-" + uuid.New().String()
+	document.Revision = 0
+	document.UpdatedAt = document.CreatedAt
+	document.cursors = make(map[string]*Cursor)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	held := 0
+	for _, existing := range documents {
+		if existing.World == document.World {
+			held++
+		}
+	}
+	if held >= MaxDocuments {
+		return ErrTooMany
+	}
+	if document.EntityID != "" && boundLocked(document.World, document.EntityID) != nil {
+		return ErrBound
+	}
+	documents[document.ID] = document
+	return nil
+}
+
+// Get returns a world's document
+func Get(world, id string) (*Document, error) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	document, ok := documents[id]
+	if !ok || document.World != world {
+		return nil, ErrNotFound
+	}
+	return document.snapshot(), nil
+}
+
+// List returns a world's documents, oldest first
+func List(world string) []*Document {
+	mutex.RLock()
+	result := []*Document{}
+	for _, document := range documents {
+		if document.World == world {
+			result = append(result, document.snapshot())
+		}
+	}
+	mutex.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result
+}
+
+// Update retitles a document or binds it to another panel entity; nil
+// leaves a field as it is, and an empty entity ID unbinds it
+func Update(world, id string, title, entityID *string, now time.Time) (*Document, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	document, ok := documents[id]
+	if !ok || document.World != world {
+		return nil, ErrNotFound
+	}
+	if title != nil {
+		trimmed := strings.TrimSpace(*title)
+		if len(trimmed) > MaxTitleLength {
+			return nil, fmt.Errorf("title must be at most %d characters", MaxTitleLength)
+		}
+		document.Title = trimmed
+	}
+	if entityID != nil && *entityID != document.EntityID {
+		if *entityID != "" && boundLocked(world, *entityID) != nil {
+			return nil, ErrBound
+		}
+		document.EntityID = *entityID
+	}
+	document.UpdatedAt = now.UTC()
+	return document.snapshot(), nil
+}
+
+// Delete removes a document and returns it as it was
+func Delete(world, id string) (*Document, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	document, ok := documents[id]
+	if !ok || document.World != world {
+		return nil, ErrNotFound
+	}
+	delete(documents, id)
+	return document.snapshot(), nil
+}
+
+// Submit applies an operation made against a revision of a document,
+// transforming it past the operations applied since. The edit returned
+// carries the operation as applied to the current text.
+func Submit(world, id string, revision int, operation Operation, hd1ID, editor string, now time.Time) (*Edit, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	document, ok := documents[id]
+	if !ok || document.World != world {
+		return nil, ErrNotFound
+	}
+	concurrent, err := document.since(revision)
+	if err != nil {
+		return nil, err
+	}
+	operation = operation.normalize()
+	if len(concurrent) > 0 {
+		base, _ := operation.lengths()
+		if had, _ := concurrent[0].lengths(); base != had {
+			return nil, fmt.Errorf("operation covers %d characters, revision %d had %d", base, revision, had)
+		}
+	}
+	for _, applied := range concurrent {
+		if operation, _, err = transform(operation, applied); err != nil {
+			return nil, err
+		}
+	}
+	text, err := operation.apply([]rune(document.Text))
+	if err != nil {
+		return nil, err
+	}
+	updated := string(text)
+	if len(updated) > MaxLength {
+		return nil, fmt.Errorf("text must be at most %d bytes", MaxLength)
+	}
+
+	document.Text = updated
+	document.Revision++
+	document.history = append(document.history, operation)
+	if len(document.history) > MaxHistory {
+		document.history = document.history[len(document.history)-MaxHistory:]
+	}
+	for _, cursor := range document.cursors {
+		cursor.Position = operation.transformIndex(cursor.Position)
+		cursor.Anchor = operation.transformIndex(cursor.Anchor)
+	}
+	document.UpdatedAt = now.UTC()
+	return &Edit{
+		DocumentID: document.ID,
+		World:      world,
+		Revision:   document.Revision,
+		Operation:  operation,
+		HD1ID:      hd1ID,
+		Editor:     editor,
+	}, nil
+}
+
+// SetCursor places a session's cursor, given against a revision of the
+// document, and returns it with the current revision it is placed in. A
+// negative position removes it and returns nil.
+func SetCursor(world, id, hd1ID, name string, revision, position, anchor int, now time.Time) (*Cursor, int, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	document, ok := documents[id]
+	if !ok || document.World != world {
+		return nil, 0, ErrNotFound
+	}
+	if position < 0 {
+		delete(document.cursors, hd1ID)
+		return nil, document.Revision, nil
+	}
+	concurrent, err := document.since(revision)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, applied := range concurrent {
+		position = applied.transformIndex(position)
+		anchor = applied.transformIndex(anchor)
+	}
+	length := utf8.RuneCountInString(document.Text)
+	cursor := &Cursor{
+		HD1ID:     hd1ID,
+		Name:      name,
+		Position:  min(position, length),
+		Anchor:    min(max(anchor, 0), length),
+		UpdatedAt: now.UTC(),
+	}
+	document.cursors[hd1ID] = cursor
+	copied := *cursor
+	return &copied, document.Revision, nil
+}
+
+// ReleaseSession removes a session's cursors, returning the documents it
+// had them in
+func ReleaseSession(hd1ID string) []*Document {
+	mutex.Lock()
+	defer mutex.Unlock()
+	var released []*Document
+	for _, document := range documents {
+		if _, ok := document.cursors[hd1ID]; ok {
+			delete(document.cursors, hd1ID)
+			released = append(released, document.snapshot())
+		}
+	}
+	return released
+}
+
+// since returns the operations applied after a revision; call it holding
+// the mutex
+func (d *Document) since(revision int) ([]Operation, error) {
+	if revision < 0 || revision > d.Revision {
+		return nil, fmt.Errorf("revision must be within 0-%d", d.Revision)
+	}
+	oldest := d.Revision - len(d.history)
+	if revision < oldest {
+		return nil, ErrStale
+	}
+	return d.history[revision-oldest:], nil
+}
+
+// boundLocked returns the document bound to an entity; call it holding the
+// mutex
+func boundLocked(world, entityID string) *Document {
+	for _, document := range documents {
+		if document.World == world && document.EntityID == entityID {
+			return document
+		}
+	}
+	return nil
+}
+
+// snapshot copies a document for callers; call it holding the mutex
+func (d *Document) snapshot() *Document {
+	snapshot := *d
+	snapshot.history = nil
+	snapshot.cursors = nil
+	snapshot.Cursors = make([]*Cursor, 0, len(d.cursors))
+	for _, cursor := range d.cursors {
+		copied := *cursor
+		snapshot.Cursors = append(snapshot.Cursors, &copied)
+	}
+	sort.Slice(snapshot.Cursors, func(i, j int) bool { return snapshot.Cursors[i].HD1ID < snapshot.Cursors[j].HD1ID })
+	return &snapshot
+}
@@ -0,0 +1,265 @@
+package documents
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"unicode/utf8"
+)
+
+// Operations are text operations in the style of ot.js: a list of
+// components walking the whole text from the start, each retaining
+// (a positive count), deleting (a negative count) or inserting (a string)
+// characters. Counts are Unicode code points, not bytes or UTF-16 units.
+//
+//	[5, "big ", -3, 4]  keeps 5 characters, inserts "big ", deletes 3, keeps 4
+
+// maxCount bounds a component's count, well past any document's length
+const maxCount = 1 << 20
+
+// Component is one step of an operation; exactly one field is set
+type Component struct {
+	Retain int
+	Insert string
+	Delete int
+}
+
+// MarshalJSON writes a component as a count or a string
+func (c Component) MarshalJSON() ([]byte, error) {
+	switch {
+	case c.Insert != "":
+		return json.Marshal(c.Insert)
+	case c.Delete > 0:
+		return json.Marshal(-c.Delete)
+	}
+	return json.Marshal(c.Retain)
+}
+
+// UnmarshalJSON reads a component from a count or a string
+func (c *Component) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch value := value.(type) {
+	case string:
+		if value == "" {
+			return errors.New("inserts must not be empty")
+		}
+		*c = Component{Insert: value}
+	case float64:
+		if value == 0 || value != math.Trunc(value) || math.Abs(value) > maxCount {
+			return fmt.Errorf("counts must be non-zero integers within %d", maxCount)
+		}
+		if value > 0 {
+			*c = Component{Retain: int(value)}
+		} else {
+			*c = Component{Delete: int(-value)}
+		}
+	default:
+		return errors.New("components are counts or strings")
+	}
+	return nil
+}
+
+// Operation is an edit of a whole text
+type Operation []Component
+
+// lengths returns the length of the text an operation applies to and of
+// the text it leaves
+func (o Operation) lengths() (base, target int) {
+	for _, c := range o {
+		switch {
+		case c.Insert != "":
+			target += utf8.RuneCountInString(c.Insert)
+		case c.Delete > 0:
+			base += c.Delete
+		default:
+			base += c.Retain
+			target += c.Retain
+		}
+	}
+	return base, target
+}
+
+func (o Operation) retain(n int) Operation {
+	if n == 0 {
+		return o
+	}
+	if last := len(o) - 1; last >= 0 && o[last].Retain > 0 {
+		o[last].Retain += n
+		return o
+	}
+	return append(o, Component{Retain: n})
+}
+
+// insert appends an insert, keeping inserts ahead of deletes next to them
+// so that equal edits are written alike
+func (o Operation) insert(text string) Operation {
+	if text == "" {
+		return o
+	}
+	last := len(o) - 1
+	if last >= 0 && o[last].Insert != "" {
+		o[last].Insert += text
+		return o
+	}
+	if last >= 0 && o[last].Delete > 0 {
+		if last >= 1 && o[last-1].Insert != "" {
+			o[last-1].Insert += text
+			return o
+		}
+		o = append(o, o[last])
+		o[last] = Component{Insert: text}
+		return o
+	}
+	return append(o, Component{Insert: text})
+}
+
+func (o Operation) delete(n int) Operation {
+	if n == 0 {
+		return o
+	}
+	if last := len(o) - 1; last >= 0 && o[last].Delete > 0 {
+		o[last].Delete += n
+		return o
+	}
+	return append(o, Component{Delete: n})
+}
+
+// normalize merges adjacent components of a kind and puts inserts ahead of
+// deletes, as the builders write them
+func (o Operation) normalize() Operation {
+	var result Operation
+	for _, c := range o {
+		switch {
+		case c.Insert != "":
+			result = result.insert(c.Insert)
+		case c.Delete > 0:
+			result = result.delete(c.Delete)
+		default:
+			result = result.retain(c.Retain)
+		}
+	}
+	return result
+}
+
+// apply returns the text an operation leaves
+func (o Operation) apply(text []rune) ([]rune, error) {
+	base, target := o.lengths()
+	if base != len(text) {
+		return nil, fmt.Errorf("operation covers %d characters, the document has %d", base, len(text))
+	}
+	result := make([]rune, 0, target)
+	at := 0
+	for _, c := range o {
+		switch {
+		case c.Insert != "":
+			result = append(result, []rune(c.Insert)...)
+		case c.Delete > 0:
+			at += c.Delete
+		default:
+			result = append(result, text[at:at+c.Retain]...)
+			at += c.Retain
+		}
+	}
+	return result, nil
+}
+
+// transform returns a and b rewritten to apply after each other: a' after
+// b and b' after a, leaving the same text. Where both insert at one place,
+// a's text goes first.
+func transform(a, b Operation) (Operation, Operation, error) {
+	baseA, _ := a.lengths()
+	baseB, _ := b.lengths()
+	if baseA != baseB {
+		return nil, nil, errors.New("concurrent operations cover different texts")
+	}
+	var aPrime, bPrime Operation
+	i, j := 0, 0
+	var ca, cb Component
+	nextA := func() bool {
+		if i == len(a) {
+			return false
+		}
+		ca, i = a[i], i+1
+		return true
+	}
+	nextB := func() bool {
+		if j == len(b) {
+			return false
+		}
+		cb, j = b[j], j+1
+		return true
+	}
+	hasA, hasB := nextA(), nextB()
+	for hasA || hasB {
+		if hasA && ca.Insert != "" {
+			aPrime = aPrime.insert(ca.Insert)
+			bPrime = bPrime.retain(utf8.RuneCountInString(ca.Insert))
+			hasA = nextA()
+			continue
+		}
+		if hasB && cb.Insert != "" {
+			aPrime = aPrime.retain(utf8.RuneCountInString(cb.Insert))
+			bPrime = bPrime.insert(cb.Insert)
+			hasB = nextB()
+			continue
+		}
+		if !hasA || !hasB {
+			return nil, nil, errors.New("concurrent operations cover different texts")
+		}
+
+		n := min(ca.Retain+ca.Delete, cb.Retain+cb.Delete)
+		switch {
+		case ca.Retain > 0 && cb.Retain > 0:
+			aPrime = aPrime.retain(n)
+			bPrime = bPrime.retain(n)
+		case ca.Delete > 0 && cb.Retain > 0:
+			aPrime = aPrime.delete(n)
+		case ca.Retain > 0 && cb.Delete > 0:
+			bPrime = bPrime.delete(n)
+		}
+		// Text both delete is gone either way
+		if shorten(&ca, n) {
+			hasA = nextA()
+		}
+		if shorten(&cb, n) {
+			hasB = nextB()
+		}
+	}
+	return aPrime, bPrime, nil
+}
+
+// shorten takes n characters off a retain or delete, reporting whether it
+// is used up
+func shorten(c *Component, n int) bool {
+	if c.Retain > 0 {
+		c.Retain -= n
+		return c.Retain == 0
+	}
+	c.Delete -= n
+	return c.Delete == 0
+}
+
+// transformIndex returns where a position in the text before an operation
+// is in the text after it. Text inserted at the position goes before it.
+func (o Operation) transformIndex(index int) int {
+	moved := index
+	for _, c := range o {
+		switch {
+		case c.Insert != "":
+			moved += utf8.RuneCountInString(c.Insert)
+		case c.Delete > 0:
+			moved -= min(index, c.Delete)
+			index -= c.Delete
+		default:
+			index -= c.Retain
+		}
+		if index < 0 {
+			break
+		}
+	}
+	return moved
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"holodeck1/config"
+)
+
+// run_drain is the container preStop hook: it drains the local server, so
+// its readiness probe fails and new sessions go to other replicas, then
+// waits until connected clients have left or the timeout passes. The
+// orchestrator sends SIGTERM once the hook returns.
+func run_drain(args []string) int {
+	flags := flag.NewFlagSet("drain", flag.ContinueOnError)
+	timeout := flags.Duration("timeout", 25*time.Second, "Longest wait for clients to disconnect")
+	address := flags.String("address", "", "Server address (default: the first listener)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: hd1 drain [--timeout 25s] [--address host:port|unix:///path]")
+	}
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		return exitUsage
+	}
+	if *address == "" {
+		*address = config.GetListen()[0]
+	}
+	listen, err := parse_listen_address(*address)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "drain: %v\n", err)
+		return exitUsage
+	}
+
+	client, base := local_client(listen)
+	response, err := client.Post(base+"/drain", "application/json", nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "drain: %v\n", err)
+		return exitFailed
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "drain: server answered %s\n", response.Status)
+		return exitFailed
+	}
+
+	deadline := time.Now().Add(*timeout)
+	for {
+		var readiness struct {
+			Clients int `json:"clients"`
+		}
+		if response, err := client.Get(base + "/readyz"); err == nil {
+			json.NewDecoder(response.Body).Decode(&readiness)
+			response.Body.Close()
+		}
+		if readiness.Clients == 0 {
+			fmt.Fprintln(os.Stderr, "drain: no clients connected")
+			return exitOK
+		}
+		if time.Now().After(deadline) {
+			fmt.Fprintf(os.Stderr, "drain: timed out with %d clients connected\n", readiness.Clients)
+			return exitOK
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// local_client returns an HTTP client and base URL for the server on this
+// host. Wildcard binds are reached over loopback; the certificate is not
+// checked, since it names the public host.
+func local_client(listen listen_address) (*http.Client, string) {
+	transport := &http.Transport{}
+	if listen.network == "unix" {
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", listen.address)
+		}
+		return &http.Client{Transport: transport, Timeout: 5 * time.Second}, "http://hd1"
+	}
+
+	host, port, _ := net.SplitHostPort(listen.address)
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	scheme := "http"
+	if config.GetTLSCert() != "" {
+		scheme = "https"
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &http.Client{Transport: transport, Timeout: 5 * time.Second}, scheme + "://" + net.JoinHostPort(host, port)
+}
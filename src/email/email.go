@@ -0,0 +1,369 @@
+// Package email sends outbound email over SMTP: booking invitations and
+// reminders, security alerts, compliance deadlines and other templated
+// messages.
+//
+// Every message belongs to an organization. The organization file gives
+// organizations their own SMTP server, sender, security contacts and hourly
+// rate limit; anything it leaves out comes from the server configuration,
+// and organizations it does not name use its "default" entry. Without an
+// SMTP server, email is disabled and messages are dropped.
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+)
+
+// DefaultOrganization applies to organizations the organization file does
+// not name
+const DefaultOrganization = "default"
+
+// Limits of a valid message
+const (
+	MaxRecipients     = 100
+	MaxSubjectLength  = 300
+	MaxAttachmentSize = 5 << 20
+)
+
+var (
+	// ErrDisabled is returned when an organization has no SMTP server
+	ErrDisabled = errors.New("email disabled")
+	// ErrRateLimited is returned when an organization sent its hourly
+	// maximum of messages
+	ErrRateLimited = errors.New("email rate limit reached")
+)
+
+// Organization is an organization's entry in the organization file
+type Organization struct {
+	SMTPHost         string   `json:"smtp_host,omitempty"`
+	SMTPPort         int      `json:"smtp_port,omitempty"`
+	Username         string   `json:"username,omitempty"`
+	Password         string   `json:"password,omitempty"`
+	TLS              string   `json:"tls,omitempty"`
+	From             string   `json:"from,omitempty"`
+	ReplyTo          string   `json:"reply_to,omitempty"`
+	RatePerHour      *int     `json:"rate_per_hour,omitempty"`
+	SecurityContacts []string `json:"security_contacts,omitempty"`
+	Disabled         bool     `json:"disabled,omitempty"`
+}
+
+// OrganizationDocument is the format of the organization file
+type OrganizationDocument struct {
+	Organizations map[string]Organization `json:"organizations"`
+}
+
+// Settings are an organization's resolved email settings
+type Settings struct {
+	SMTPHost         string
+	SMTPPort         int
+	Username         string
+	Password         string
+	TLS              string
+	From             string
+	ReplyTo          string
+	RatePerHour      int
+	SecurityContacts []string
+}
+
+// Attachment is a file sent with a message
+type Attachment struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"-"`
+}
+
+// Message is an email to send on behalf of an organization
+type Message struct {
+	Org         string
+	To          []string
+	Subject     string
+	Text        string
+	HTML        string // Sent as an alternative to Text when set
+	Attachments []Attachment
+}
+
+var (
+	organizations = map[string]Organization{}
+	sent          = map[string][]time.Time{} // Send times in the last hour, by organization
+	mutex         sync.Mutex
+)
+
+// LoadOrganizations reads the organization file; a missing file leaves
+// every organization on the server settings
+func LoadOrganizations() error {
+	file := config.GetEmailOrgFile()
+	loaded := map[string]Organization{}
+	raw, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		var document OrganizationDocument
+		if err := json.Unmarshal(raw, &document); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		for org, settings := range document.Organizations {
+			if err := settings.validate(); err != nil {
+				return fmt.Errorf("%s: organization %q: %v", file, org, err)
+			}
+			loaded[org] = settings
+		}
+	}
+
+	mutex.Lock()
+	organizations = loaded
+	mutex.Unlock()
+
+	logging.Info("email organizations loaded", map[string]interface{}{
+		"file":          file,
+		"organizations": len(loaded),
+		"smtp_host":     config.GetEmailConfig().SMTPHost,
+	})
+	return nil
+}
+
+func (o *Organization) validate() error {
+	if o.SMTPPort < 0 || o.SMTPPort > 65535 {
+		return fmt.Errorf("smtp_port out of range")
+	}
+	if o.TLS != "" && o.TLS != "starttls" && o.TLS != "tls" && o.TLS != "none" {
+		return fmt.Errorf("tls must be starttls, tls or none")
+	}
+	for _, address := range append([]string{o.From, o.ReplyTo}, o.SecurityContacts...) {
+		if address == "" {
+			continue
+		}
+		if _, err := mail.ParseAddress(address); err != nil {
+			return fmt.Errorf("not an address: %q", address)
+		}
+	}
+	if o.RatePerHour != nil && *o.RatePerHour < 0 {
+		return fmt.Errorf("rate_per_hour must not be negative")
+	}
+	return nil
+}
+
+// SettingsFor resolves an organization's settings over the server's; ok is
+// false when the organization may not send email
+func SettingsFor(org string) (Settings, bool) {
+	server := config.GetEmailConfig()
+	settings := Settings{
+		SMTPHost:         server.SMTPHost,
+		SMTPPort:         server.SMTPPort,
+		Username:         server.Username,
+		Password:         server.Password,
+		TLS:              server.TLS,
+		From:             server.From,
+		RatePerHour:      server.RatePerHour,
+		SecurityContacts: server.SecurityContacts,
+	}
+
+	mutex.Lock()
+	override, found := organizations[org]
+	if !found {
+		override, found = organizations[DefaultOrganization]
+	}
+	mutex.Unlock()
+	if found {
+		if override.Disabled {
+			return settings, false
+		}
+		// An organization's own server comes with its own credentials
+		if override.SMTPHost != "" {
+			settings.SMTPHost = override.SMTPHost
+			settings.Username = override.Username
+			settings.Password = override.Password
+		}
+		if override.SMTPPort != 0 {
+			settings.SMTPPort = override.SMTPPort
+		}
+		if override.TLS != "" {
+			settings.TLS = override.TLS
+		}
+		if override.From != "" {
+			settings.From = override.From
+		}
+		settings.ReplyTo = override.ReplyTo
+		if override.RatePerHour != nil {
+			settings.RatePerHour = *override.RatePerHour
+		}
+		if len(override.SecurityContacts) > 0 {
+			settings.SecurityContacts = override.SecurityContacts
+		}
+	}
+	return settings, settings.SMTPHost != ""
+}
+
+// Enabled reports whether an organization can send email
+func Enabled(org string) bool {
+	_, ok := SettingsFor(org)
+	return ok
+}
+
+// Validate checks a message before it is sent, normalizing its recipients
+func (m *Message) Validate() error {
+	if len(m.To) == 0 || len(m.To) > MaxRecipients {
+		return fmt.Errorf("a message needs 1-%d recipients", MaxRecipients)
+	}
+	seen := make(map[string]bool, len(m.To))
+	to := make([]string, 0, len(m.To))
+	for _, recipient := range m.To {
+		address, err := mail.ParseAddress(strings.TrimSpace(recipient))
+		if err != nil {
+			return fmt.Errorf("recipients must be email addresses, got %q", recipient)
+		}
+		email := strings.ToLower(address.Address)
+		if !seen[email] {
+			seen[email] = true
+			to = append(to, email)
+		}
+	}
+	m.To = to
+	m.Subject = strings.TrimSpace(m.Subject)
+	if m.Subject == "" || len(m.Subject) > MaxSubjectLength || strings.ContainsAny(m.Subject, "\r\n") {
+		return fmt.Errorf("subject must be one line of 1-%d characters", MaxSubjectLength)
+	}
+	if m.Text == "" {
+		return errors.New("a message needs a text body")
+	}
+	for _, attachment := range m.Attachments {
+		if attachment.Name == "" || strings.ContainsAny(attachment.Name, "\r\n\"/\\") {
+			return fmt.Errorf("invalid attachment name: %q", attachment.Name)
+		}
+		if len(attachment.Data) > MaxAttachmentSize {
+			return fmt.Errorf("attachment %s exceeds %d bytes", attachment.Name, MaxAttachmentSize)
+		}
+	}
+	return nil
+}
+
+// reserve counts a message against an organization's hourly limit,
+// returning how long until one may be sent when the limit is reached
+func reserve(org string, limit int, now time.Time) (time.Duration, bool) {
+	if limit == 0 {
+		return 0, true
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	recent := sent[org][:0]
+	for _, at := range sent[org] {
+		if now.Sub(at) < time.Hour {
+			recent = append(recent, at)
+		}
+	}
+	sent[org] = recent
+	if len(recent) >= limit {
+		return time.Hour - now.Sub(recent[0]), false
+	}
+	sent[org] = append(recent, now)
+	return 0, true
+}
+
+// RateLimit is returned, wrapping ErrRateLimited, when an organization sent
+// its hourly maximum
+type RateLimit struct {
+	RetryAfter time.Duration
+}
+
+func (r *RateLimit) Error() string {
+	return fmt.Sprintf("%s, retry in %s", ErrRateLimited, r.RetryAfter.Round(time.Second))
+}
+
+func (r *RateLimit) Unwrap() error {
+	return ErrRateLimited
+}
+
+// Send delivers a message now. It fails with ErrDisabled when the
+// organization cannot send email and a *RateLimit past its hourly limit.
+func Send(ctx context.Context, message *Message) error {
+	if err := message.Validate(); err != nil {
+		return err
+	}
+	settings, ok := SettingsFor(message.Org)
+	if !ok {
+		return ErrDisabled
+	}
+	if wait, ok := reserve(message.Org, settings.RatePerHour, time.Now()); !ok {
+		return &RateLimit{RetryAfter: wait}
+	}
+	return deliver(ctx, settings, message)
+}
+
+// Queue sends a message in the background, logging the outcome. Messages
+// of organizations without email are dropped silently.
+func Queue(message *Message) {
+	if !Enabled(message.Org) {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := Send(ctx, message); err != nil {
+			logging.Warn("email not sent", map[string]interface{}{
+				"org":        message.Org,
+				"subject":    message.Subject,
+				"recipients": len(message.To),
+				"error":      err.Error(),
+			})
+			return
+		}
+		logging.Info("email sent", map[string]interface{}{
+			"org":        message.Org,
+			"subject":    message.Subject,
+			"recipients": len(message.To),
+		})
+	}()
+}
+
+// Configured reports whether any organization may send email, the server
+// settings or the organization file naming an SMTP server
+func Configured() bool {
+	if config.GetEmailConfig().SMTPHost != "" {
+		return true
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, settings := range organizations {
+		if settings.SMTPHost != "" && !settings.Disabled {
+			return true
+		}
+	}
+	return false
+}
+
+// SecurityAlert is an event an organization's security contacts are told of
+type SecurityAlert struct {
+	Event  string // What happened, as the subject says it
+	World  string
+	Detail string
+	Actor  string // Who acted
+	Time   time.Time
+}
+
+// Alert sends a security alert to an organization's security contacts in
+// the background
+func Alert(org string, alert SecurityAlert) {
+	settings, ok := SettingsFor(org)
+	if !ok || len(settings.SecurityContacts) == 0 {
+		return
+	}
+	message, err := Templated(org, TemplateSecurityAlert, settings.SecurityContacts, alert)
+	if err != nil {
+		logging.Error("failed to render security alert", map[string]interface{}{
+			"org":   org,
+			"error": err.Error(),
+		})
+		return
+	}
+	Queue(message)
+}
@@ -0,0 +1,209 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// deliver sends a message through an organization's SMTP server: over
+// implicit TLS, upgraded with STARTTLS, or in the clear as the settings
+// say. STARTTLS is required when configured, never skipped when the server
+// does not offer it.
+func deliver(ctx context.Context, settings Settings, message *Message) error {
+	from, err := mail.ParseAddress(settings.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender: %v", err)
+	}
+	body, err := compose(settings, from, message)
+	if err != nil {
+		return err
+	}
+
+	address := net.JoinHostPort(settings.SMTPHost, strconv.Itoa(settings.SMTPPort))
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	if settings.TLS == "tls" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: settings.SMTPHost}}).DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, settings.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if settings.TLS == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s does not offer STARTTLS", settings.SMTPHost)
+		}
+		if err := client.StartTLS(&tls.Config{ServerName: settings.SMTPHost}); err != nil {
+			return err
+		}
+	}
+	if settings.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", settings.Username, settings.Password, settings.SMTPHost)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, recipient := range message.To {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(body); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// compose renders a message as MIME: its text, with HTML as an
+// alternative, and attachments after them
+func compose(settings Settings, from *mail.Address, message *Message) ([]byte, error) {
+	var out bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&out, "%s: %s\r\n", name, value)
+	}
+	header("From", from.String())
+	header("To", strings.Join(message.To, ", "))
+	if settings.ReplyTo != "" {
+		header("Reply-To", settings.ReplyTo)
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", message.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", messageID(from.Address))
+	header("MIME-Version", "1.0")
+
+	content := &bytes.Buffer{}
+	contentHeader, err := writeAlternatives(content, message)
+	if err != nil {
+		return nil, err
+	}
+	if len(message.Attachments) == 0 {
+		for _, name := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+			if value := contentHeader.Get(name); value != "" {
+				header(name, value)
+			}
+		}
+		out.WriteString("\r\n")
+		out.Write(content.Bytes())
+		return out.Bytes(), nil
+	}
+
+	mixed := multipart.NewWriter(&out)
+	header("Content-Type", "multipart/mixed; boundary="+mixed.Boundary())
+	out.WriteString("\r\n")
+	part, err := mixed.CreatePart(contentHeader)
+	if err != nil {
+		return nil, err
+	}
+	part.Write(content.Bytes())
+	for _, attachment := range message.Attachments {
+		contentType := attachment.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		part, err := mixed.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64(part, attachment.Data)
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// writeAlternatives writes the message bodies, returning the header
+// describing them
+func writeAlternatives(out *bytes.Buffer, message *Message) (textproto.MIMEHeader, error) {
+	if message.HTML == "" {
+		writeQuotedPrintable(out, message.Text)
+		return textproto.MIMEHeader{
+			"Content-Type":              {"text/plain; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		}, nil
+	}
+	alternative := multipart.NewWriter(out)
+	for _, body := range []struct{ contentType, text string }{
+		{"text/plain; charset=utf-8", message.Text},
+		{"text/html; charset=utf-8", message.HTML},
+	} {
+		part, err := alternative.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {body.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeQuotedPrintable(part, body.text)
+	}
+	if err := alternative.Close(); err != nil {
+		return nil, err
+	}
+	return textproto.MIMEHeader{"Content-Type": {"multipart/alternative; boundary=" + alternative.Boundary()}}, nil
+}
+
+func writeQuotedPrintable(out io.Writer, text string) {
+	encoder := quotedprintable.NewWriter(out)
+	encoder.Write([]byte(strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\n", "\r\n")))
+	encoder.Close()
+}
+
+// writeBase64 writes data in lines of 76 characters
+func writeBase64(out io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		out.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	out.Write([]byte(encoded + "\r\n"))
+}
+
+func messageID(sender string) string {
+	domain := "hd1"
+	if at := strings.LastIndex(sender, "@"); at >= 0 {
+		domain = sender[at+1:]
+	}
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	return "<" + hex.EncodeToString(buf) + "@" + domain + ">"
+}
@@ -0,0 +1,182 @@
+package email
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"holodeck1/config"
+)
+
+// Templates define a subject, a text body and optionally an HTML body as
+// {{define "subject"}}, {{define "text"}} and {{define "html"}} in one
+// <name>.tmpl file. The embedded templates can be overridden, and others
+// added, with files in the templates directory. Subjects and text bodies
+// are rendered as text, HTML bodies with HTML escaping.
+
+// Embedded templates
+const (
+	TemplateInvitation         = "invitation"
+	TemplateSessionReminder    = "session_reminder"
+	TemplateSecurityAlert      = "security_alert"
+	TemplateComplianceDeadline = "compliance_deadline"
+)
+
+//go:embed templates/*.tmpl
+var embedded embed.FS
+
+var templateName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// templateFuncs are available to every template
+var templateFuncs = map[string]interface{}{
+	// datetime formats a time, or an RFC 3339 string, in a time zone
+	"datetime": func(value interface{}, zone string) string {
+		var t time.Time
+		switch v := value.(type) {
+		case time.Time:
+			t = v
+		case string:
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return v
+			}
+			t = parsed
+		default:
+			return fmt.Sprint(value)
+		}
+		if location, err := time.LoadLocation(zone); err == nil && zone != "" {
+			t = t.In(location)
+		}
+		return t.Format("Mon 2 Jan 2006 15:04 MST")
+	},
+	// minutes formats a lead time in minutes
+	"minutes": func(value interface{}) string {
+		var minutes int
+		switch v := value.(type) {
+		case int:
+			minutes = v
+		case float64:
+			minutes = int(v)
+		}
+		if minutes%60 == 0 && minutes >= 60 {
+			if minutes == 60 {
+				return "1 hour"
+			}
+			return fmt.Sprintf("%d hours", minutes/60)
+		}
+		if minutes == 1 {
+			return "1 minute"
+		}
+		return fmt.Sprintf("%d minutes", minutes)
+	},
+}
+
+// source returns a template, preferring the templates directory over the
+// embedded copies
+func source(name string) ([]byte, error) {
+	if !templateName.MatchString(name) {
+		return nil, fmt.Errorf("invalid template name: %q", name)
+	}
+	if dir := config.GetEmailTemplatesDir(); dir != "" {
+		content, err := os.ReadFile(filepath.Join(dir, name+".tmpl"))
+		if err == nil {
+			return content, nil
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	content, err := embedded.ReadFile("templates/" + name + ".tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("unknown template: %q", name)
+	}
+	return content, nil
+}
+
+// Render fills a template with data. The HTML body is empty for templates
+// without one.
+func Render(name string, data interface{}) (subject, text, html string, err error) {
+	content, err := source(name)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	textTemplate, err := texttemplate.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(string(content))
+	if err != nil {
+		return "", "", "", fmt.Errorf("template %s: %v", name, err)
+	}
+	var out bytes.Buffer
+	for _, part := range []struct {
+		name   string
+		target *string
+	}{{"subject", &subject}, {"text", &text}} {
+		out.Reset()
+		if err := textTemplate.ExecuteTemplate(&out, part.name, data); err != nil {
+			return "", "", "", fmt.Errorf("template %s: %v", name, err)
+		}
+		*part.target = strings.TrimSpace(out.String())
+	}
+	subject = strings.Join(strings.Fields(subject), " ")
+
+	htmlTemplate, err := htmltemplate.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(string(content))
+	if err != nil {
+		return "", "", "", fmt.Errorf("template %s: %v", name, err)
+	}
+	if htmlTemplate.Lookup("html") != nil {
+		out.Reset()
+		if err := htmlTemplate.ExecuteTemplate(&out, "html", data); err != nil {
+			return "", "", "", fmt.Errorf("template %s: %v", name, err)
+		}
+		html = strings.TrimSpace(out.String())
+	}
+	return subject, text + "\n", html, nil
+}
+
+// Templated renders a template into a message for an organization
+func Templated(org, name string, to []string, data interface{}) (*Message, error) {
+	subject, text, html, err := Render(name, data)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{
+		Org:     org,
+		To:      to,
+		Subject: subject,
+		Text:    text,
+		HTML:    html,
+	}, nil
+}
+
+// Templates lists the available templates: the embedded ones and those in
+// the templates directory
+func Templates() []string {
+	seen := map[string]bool{}
+	if entries, err := embedded.ReadDir("templates"); err == nil {
+		for _, entry := range entries {
+			seen[strings.TrimSuffix(entry.Name(), ".tmpl")] = true
+		}
+	}
+	if dir := config.GetEmailTemplatesDir(); dir != "" {
+		if entries, err := os.ReadDir(dir); err == nil {
+			for _, entry := range entries {
+				name := strings.TrimSuffix(entry.Name(), ".tmpl")
+				if strings.HasSuffix(entry.Name(), ".tmpl") && templateName.MatchString(name) {
+					seen[name] = true
+				}
+			}
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,126 @@
+// Package entityid issues entity IDs and tracks which ones are live, so two
+// creates can never share an ID and corrupt every client's entity map.
+//
+// The server issues time-ordered IDs (UUIDv7) by default. Clients may
+// suggest their own ID instead; a suggestion that is already live is
+// either rejected or replaced with a fresh ID, per configuration:
+//
+//   - reject: the create fails with ErrConflict
+//   - reissue: the create succeeds under a newly issued ID
+//
+// IDs are claimed before the entity_create operation is submitted and
+// released by entity_delete, so a deleted ID may be reused.
+package entityid
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/google/uuid"
+	"holodeck1/config"
+)
+
+// Conflict modes
+const (
+	ConflictReject  = "reject"
+	ConflictReissue = "reissue"
+)
+
+// ErrConflict is returned when a suggested ID is already live
+var ErrConflict = errors.New("entity id already exists")
+
+// ErrClientIDsDisabled is returned for suggestions when only the server issues IDs
+var ErrClientIDsDisabled = errors.New("client-supplied entity ids are disabled")
+
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:-]{0,127}$`)
+
+var (
+	live  = make(map[string]string) // entity ID -> owning client
+	mutex sync.Mutex
+)
+
+// New generates a time-ordered entity ID
+func New() string {
+	id, err := uuid.NewV7()
+	if err != nil {
+		id = uuid.New()
+	}
+	return "entity-" + id.String()
+}
+
+// Validate checks the shape of a client-suggested ID
+func Validate(id string) error {
+	if !idPattern.MatchString(id) {
+		return fmt.Errorf("entity id must match %s", idPattern)
+	}
+	return nil
+}
+
+// Allocate claims an ID for a new entity owned by clientID. An empty
+// suggestion always gets a server-issued ID. reissued reports that a
+// taken suggestion was replaced.
+func Allocate(suggested, clientID string) (id string, reissued bool, err error) {
+	if suggested != "" {
+		if !config.GetEntitiesAllowClientIDs() {
+			return "", false, ErrClientIDsDisabled
+		}
+		if err := Validate(suggested); err != nil {
+			return "", false, err
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if suggested != "" {
+		if _, taken := live[suggested]; !taken {
+			live[suggested] = clientID
+			return suggested, false, nil
+		}
+		if config.GetEntitiesIDConflict() != ConflictReissue {
+			return "", false, ErrConflict
+		}
+		reissued = true
+	}
+
+	for {
+		id = New()
+		if _, taken := live[id]; !taken {
+			live[id] = clientID
+			return id, reissued, nil
+		}
+	}
+}
+
+// Claim marks a known ID live, for server-side restores that recreate
+// entities under their original IDs
+func Claim(id, clientID string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if _, taken := live[id]; taken {
+		return ErrConflict
+	}
+	live[id] = clientID
+	return nil
+}
+
+// Release frees an ID after its entity is deleted
+func Release(id string) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if _, ok := live[id]; !ok {
+		return false
+	}
+	delete(live, id)
+	return true
+}
+
+// Live reports whether an ID is claimed by an entity
+func Live(id string) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	_, ok := live[id]
+	return ok
+}
@@ -0,0 +1,348 @@
+// Package environment advances a world's time of day and weather.
+//
+// The server owns the clock: every tick it moves the time of day on by the
+// share of the world's day length that passed, derives where the sun is,
+// and every weather interval or so moves the weather on to a neighbouring
+// state, clear to cloudy to rain to storm. Fog and precipitation fade
+// towards the new weather over a couple of minutes rather than jumping.
+// The result lives in the world's scene settings under "environment", so
+// it is versioned with the operation log and reaches clients as a
+// scene_update; nothing is submitted while it stands still.
+package environment
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+	"holodeck1/numbers"
+	"holodeck1/sync"
+)
+
+// clientID submits the environment's scene updates
+const clientID = "environment"
+
+// Where the clock starts in a world that never had an environment
+const (
+	startHour    = 12
+	startWeather = "clear"
+)
+
+// fadeTime is how long fog and precipitation take to reach a new weather
+const fadeTime = 2 * time.Minute
+
+// Weather is a weather state and the fog and precipitation it settles at
+type Weather struct {
+	Name          string  `json:"name"`
+	FogDensity    float64 `json:"fog_density"`
+	Precipitation float64 `json:"precipitation"`
+}
+
+// weathers by name
+var weathers = map[string]Weather{
+	"clear":  {Name: "clear", FogDensity: 0, Precipitation: 0},
+	"cloudy": {Name: "cloudy", FogDensity: 0.1, Precipitation: 0},
+	"fog":    {Name: "fog", FogDensity: 0.7, Precipitation: 0},
+	"rain":   {Name: "rain", FogDensity: 0.2, Precipitation: 0.6},
+	"storm":  {Name: "storm", FogDensity: 0.35, Precipitation: 1},
+	"snow":   {Name: "snow", FogDensity: 0.3, Precipitation: 0.5},
+}
+
+// transitions lists the weathers each weather may turn into
+var transitions = map[string][]string{
+	"clear":  {"cloudy", "fog"},
+	"cloudy": {"clear", "fog", "rain", "snow"},
+	"fog":    {"clear", "cloudy"},
+	"rain":   {"cloudy", "storm"},
+	"storm":  {"rain"},
+	"snow":   {"cloudy"},
+}
+
+// State is a world's environment as stored in its scene settings
+type State struct {
+	TimeOfDay     float64 `json:"time_of_day"`   // Hours since midnight, 0-24
+	SunElevation  float64 `json:"sun_elevation"` // Degrees above the horizon, negative at night
+	SunAzimuth    float64 `json:"sun_azimuth"`   // Degrees clockwise from north
+	Weather       string  `json:"weather"`
+	FogDensity    float64 `json:"fog_density"`   // 0-1
+	Precipitation float64 `json:"precipitation"` // Intensity, 0-1
+}
+
+// Data returns the state as scene_update data
+func (s *State) Data() map[string]interface{} {
+	var data map[string]interface{}
+	encoded, _ := json.Marshal(s)
+	json.Unmarshal(encoded, &data)
+	return data
+}
+
+// Decode reads a state from scene settings, as stored by Data
+func Decode(value interface{}) (*State, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var state State
+	if err := json.Unmarshal(encoded, &state); err != nil {
+		return nil, fmt.Errorf("invalid environment: %v", err)
+	}
+	if _, ok := weathers[state.Weather]; !ok {
+		return nil, fmt.Errorf("unknown weather: %q", state.Weather)
+	}
+	if state.TimeOfDay < 0 || state.TimeOfDay >= 24 {
+		return nil, fmt.Errorf("time of day must be within 0-24 hours")
+	}
+	return &state, nil
+}
+
+func init() {
+	// Weather and time of day set by raw scene updates must be known
+	sync.RegisterOperation(sync.OpSceneUpdate, func(data map[string]interface{}) error {
+		if value, ok := data["environment"]; ok {
+			if _, err := Decode(value); err != nil {
+				return fmt.Errorf("invalid environment: %v", err)
+			}
+		}
+		return nil
+	})
+}
+
+// FromScene returns the environment in a world's scene settings
+func FromScene(scene map[string]interface{}) (*State, bool) {
+	value, ok := scene["environment"]
+	if !ok {
+		return nil, false
+	}
+	state, err := Decode(value)
+	return state, err == nil
+}
+
+// Change sets a world's time of day, weather or both
+type Change struct {
+	TimeOfDay *float64 `json:"time_of_day,omitempty"`
+	Weather   string   `json:"weather,omitempty"`
+}
+
+// Default returns the environment of a world that never had one
+func Default() State {
+	weather := weathers[startWeather]
+	state := State{
+		TimeOfDay:     startHour,
+		Weather:       weather.Name,
+		FogDensity:    weather.FogDensity,
+		Precipitation: weather.Precipitation,
+	}
+	elevation, azimuth := sunPosition(state.TimeOfDay)
+	state.SunElevation, state.SunAzimuth = numbers.Round(elevation, precision), numbers.Round(azimuth, precision)
+	return state
+}
+
+// Apply returns the environment after a change; fog and precipitation
+// fade towards a new weather as the cycle advances
+func Apply(current State, change Change) (State, error) {
+	if change.TimeOfDay == nil && change.Weather == "" {
+		return current, fmt.Errorf("time_of_day or weather is required")
+	}
+	if change.TimeOfDay != nil {
+		hour := *change.TimeOfDay
+		if math.IsNaN(hour) || hour < 0 || hour >= 24 {
+			return current, fmt.Errorf("time_of_day must be within 0-24 hours")
+		}
+		current.TimeOfDay = numbers.Round(hour, precision)
+		elevation, azimuth := sunPosition(current.TimeOfDay)
+		current.SunElevation, current.SunAzimuth = numbers.Round(elevation, precision), numbers.Round(azimuth, precision)
+	}
+	if change.Weather != "" {
+		if _, ok := weathers[change.Weather]; !ok {
+			return current, fmt.Errorf("unknown weather: %q", change.Weather)
+		}
+		current.Weather = change.Weather
+	}
+	return current, nil
+}
+
+// Weathers returns the weather states cycles may pick
+func Weathers() []Weather {
+	list := make([]Weather, 0, len(weathers))
+	for _, name := range config.GetEnvironmentWeathers() {
+		if weather, ok := weathers[name]; ok {
+			list = append(list, weather)
+		}
+	}
+	return list
+}
+
+// cycle advances one world's environment
+type cycle struct {
+	world       string
+	state       State
+	nextWeather time.Time
+	random      *rand.Rand
+}
+
+// advance moves the environment on by elapsed
+func (c *cycle) advance(elapsed time.Duration, now time.Time) {
+	if dayLength := config.GetEnvironmentDayLength(c.world); dayLength > 0 {
+		c.state.TimeOfDay = math.Mod(c.state.TimeOfDay+24*elapsed.Seconds()/dayLength.Seconds(), 24)
+	}
+	c.state.SunElevation, c.state.SunAzimuth = sunPosition(c.state.TimeOfDay)
+
+	allowed := config.GetEnvironmentWeathers()
+	if interval := config.GetEnvironmentWeatherInterval(c.world); interval > 0 && !now.Before(c.nextWeather) {
+		if !c.nextWeather.IsZero() || !contains(allowed, c.state.Weather) {
+			c.state.Weather = c.nextWeatherAfter(c.state.Weather, allowed)
+		}
+		// Somewhere between half and one and a half intervals
+		c.nextWeather = now.Add(interval/2 + time.Duration(c.random.Int63n(int64(interval))))
+	}
+
+	target := weathers[c.state.Weather]
+	fade := math.Min(1, elapsed.Seconds()/fadeTime.Seconds())
+	c.state.FogDensity += (target.FogDensity - c.state.FogDensity) * fade
+	c.state.Precipitation += (target.Precipitation - c.state.Precipitation) * fade
+
+	c.state.TimeOfDay = math.Mod(numbers.Round(c.state.TimeOfDay, precision), 24)
+	c.state.SunElevation = numbers.Round(c.state.SunElevation, precision)
+	c.state.SunAzimuth = numbers.Round(c.state.SunAzimuth, precision)
+	c.state.FogDensity = numbers.Round(c.state.FogDensity, precision)
+	c.state.Precipitation = numbers.Round(c.state.Precipitation, precision)
+}
+
+// nextWeatherAfter picks a neighbouring weather among the allowed ones,
+// or any other allowed weather when none neighbours the current one
+func (c *cycle) nextWeatherAfter(current string, allowed []string) string {
+	var candidates []string
+	for _, next := range transitions[current] {
+		if contains(allowed, next) {
+			candidates = append(candidates, next)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, next := range allowed {
+			if next != current {
+				candidates = append(candidates, next)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return current
+	}
+	return candidates[c.random.Intn(len(candidates))]
+}
+
+// sunPosition returns the sun's elevation and azimuth at an hour: rising in
+// the east at six, highest in the south at noon, setting in the west at
+// eighteen
+func sunPosition(hour float64) (elevation, azimuth float64) {
+	elevation = 90 * math.Sin(2*math.Pi*(hour-6)/24)
+	azimuth = math.Mod(hour*15, 360)
+	return elevation, azimuth
+}
+
+// precision keeps three decimals, which is all a renderer needs and keeps
+// unchanged values from producing deltas
+const precision = 3
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// latest returns the environment last submitted to a world's log
+func latest(operations []*sync.Operation) (*State, bool) {
+	for i := len(operations) - 1; i >= 0; i-- {
+		operation := operations[i]
+		if operation.Type != sync.OpSceneUpdate {
+			continue
+		}
+		if state, ok := FromScene(operation.Data); ok {
+			return state, true
+		}
+	}
+	return nil, false
+}
+
+// Log is the operation log the cycle reads and submits to
+type Log interface {
+	GetCurrentSequence() uint64
+	GetOperationsInRange(from, to uint64) []*sync.Operation
+	SubmitOperation(op *sync.Operation)
+}
+
+// Stepper returns the step advancing the environment of a world, or nil
+// when its cycle is disabled. Each step submits the environment as a
+// scene_update whenever it changed. An environment set through the API
+// since the last step is where the cycle carries on. The simulation loop
+// calls it every configured tick. After the first step it reads only the
+// operations sequenced since, so a hibernating log stays unloaded.
+func Stepper(world string, log Log) func(now time.Time) {
+	tick := config.GetEnvironmentTick()
+	if tick <= 0 || (config.GetEnvironmentDayLength(world) == 0 && config.GetEnvironmentWeatherInterval(world) == 0) {
+		logging.Info("environment cycle disabled", map[string]interface{}{
+			"world": world,
+		})
+		return nil
+	}
+
+	c := &cycle{
+		world:  world,
+		state:  Default(),
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	logging.Info("environment cycle started", map[string]interface{}{
+		"world":            world,
+		"day_length":       config.GetEnvironmentDayLength(world).String(),
+		"weather_interval": config.GetEnvironmentWeatherInterval(world).String(),
+	})
+
+	var stored State // The environment in the log
+	var seqNum uint64
+	last := time.Now()
+	return func(now time.Time) {
+		var set *State
+		var ok bool
+		if current := log.GetCurrentSequence(); current > seqNum {
+			set, ok = latest(log.GetOperationsInRange(seqNum+1, current))
+			seqNum = current
+		}
+		if ok && *set != stored {
+			if set.Weather != c.state.Weather && !c.nextWeather.IsZero() {
+				// A weather set by hand lasts a full interval
+				c.nextWeather = now.Add(config.GetEnvironmentWeatherInterval(world))
+			}
+			c.state = *set
+			stored = *set
+		}
+
+		previous := c.state.Weather
+		c.advance(now.Sub(last), now)
+		last = now
+		if c.state == stored {
+			return
+		}
+		log.SubmitOperation(&sync.Operation{
+			ClientID:  clientID,
+			Type:      sync.OpSceneUpdate,
+			Data:      map[string]interface{}{"environment": c.state.Data()},
+			Timestamp: now,
+		})
+		stored = c.state
+
+		if previous != c.state.Weather {
+			logging.Info("weather changed", map[string]interface{}{
+				"world": world,
+				"from":  previous,
+				"to":    c.state.Weather,
+				"hour":  c.state.TimeOfDay,
+			})
+		}
+	}
+}
@@ -0,0 +1,266 @@
+// Package features decides which features are switched on, globally, per
+// organization and per world, so risky features roll out gradually.
+//
+// Flags come from built-in defaults, the flag file, HD1_FEATURES and an
+// optional remote provider, each layer replacing whole flags of the one
+// before. A flag may override its default for organizations and worlds; a
+// world override beats an organization override. Handlers consult Enabled,
+// the JavaScript client fetches its resolved set from /api/system/features.
+package features
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	stdSync "sync"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+)
+
+// Flags the server consults
+const (
+	AssetStreaming = "asset_streaming"
+	WorldRollback  = "world_rollback"
+)
+
+// Flag is one feature switch
+type Flag struct {
+	Description   string          `json:"description,omitempty"`
+	Enabled       bool            `json:"enabled"`                 // Default for everyone
+	Organizations map[string]bool `json:"organizations,omitempty"` // Per-organization overrides
+	Worlds        map[string]bool `json:"worlds,omitempty"`        // Per-world overrides, beat organizations
+}
+
+// Document is the format of the flag file and the remote provider
+type Document struct {
+	Flags map[string]Flag `json:"flags"`
+}
+
+// builtin are the flags the server consults, with their defaults
+var builtin = map[string]Flag{
+	AssetStreaming: {Description: "Chunked asset transfers over /ws", Enabled: true},
+	WorldRollback:  {Description: "Rolling a world back to a checkpoint", Enabled: true},
+}
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+var (
+	mutex  stdSync.RWMutex
+	static = copyFlags(builtin) // Built-in, file and configuration layers
+	remote map[string]Flag      // Last good remote provider document
+	etag   string
+)
+
+func copyFlags(flags map[string]Flag) map[string]Flag {
+	result := make(map[string]Flag, len(flags))
+	for name, flag := range flags {
+		result[name] = flag
+	}
+	return result
+}
+
+// validate checks flag names in a document
+func (d Document) validate() error {
+	for name := range d.Flags {
+		if !namePattern.MatchString(name) {
+			return fmt.Errorf("invalid feature flag name: %q", name)
+		}
+	}
+	return nil
+}
+
+// Initialize loads the static flags and, with a remote provider configured,
+// fetches it once and keeps polling until ctx ends
+func Initialize(ctx context.Context) error {
+	flags := copyFlags(builtin)
+
+	if file := config.GetFeaturesFile(); file != "" {
+		raw, err := os.ReadFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil {
+			var document Document
+			if err := json.Unmarshal(raw, &document); err != nil {
+				return fmt.Errorf("%s: %v", file, err)
+			}
+			if err := document.validate(); err != nil {
+				return fmt.Errorf("%s: %v", file, err)
+			}
+			for name, flag := range document.Flags {
+				flags[name] = flag
+			}
+		}
+	}
+
+	// HD1_FEATURES switches flags for everyone, keeping their overrides
+	for _, entry := range config.GetFeaturesEnabled() {
+		entry = strings.TrimSpace(entry)
+		name := strings.TrimPrefix(entry, "-")
+		if name == "" {
+			continue
+		}
+		if !namePattern.MatchString(name) {
+			return fmt.Errorf("invalid feature flag name: %q", name)
+		}
+		flag := flags[name]
+		flag.Enabled = !strings.HasPrefix(entry, "-")
+		flags[name] = flag
+	}
+
+	mutex.Lock()
+	static = flags
+	mutex.Unlock()
+
+	if config.GetFeaturesURL() != "" {
+		if err := refresh(ctx); err != nil {
+			logging.Warn("feature flag provider unavailable, using static flags", map[string]interface{}{
+				"url":   config.GetFeaturesURL(),
+				"error": err.Error(),
+			})
+		}
+		go poll(ctx)
+	}
+
+	logging.Info("feature flags loaded", map[string]interface{}{
+		"flags":  len(Definitions()),
+		"file":   config.GetFeaturesFile(),
+		"remote": config.GetFeaturesURL() != "",
+	})
+	return nil
+}
+
+func poll(ctx context.Context) {
+	interval := config.GetFeaturesRefresh()
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := refresh(ctx); err != nil {
+				logging.Warn("feature flag refresh failed, keeping last flags", map[string]interface{}{
+					"url":   config.GetFeaturesURL(),
+					"error": err.Error(),
+				})
+			}
+		}
+	}
+}
+
+var providerClient = &http.Client{Timeout: 10 * time.Second}
+
+// refresh fetches the remote document; an unchanged one answers 304
+func refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.GetFeaturesURL(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if token := config.GetFeaturesToken(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	mutex.RLock()
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	mutex.RUnlock()
+
+	resp, err := providerClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("provider returned %s", resp.Status)
+	}
+
+	var document Document
+	if err := json.NewDecoder(resp.Body).Decode(&document); err != nil {
+		return err
+	}
+	if err := document.validate(); err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	changed := !sameFlags(remote, document.Flags)
+	remote = document.Flags
+	etag = resp.Header.Get("ETag")
+	mutex.Unlock()
+
+	if changed {
+		logging.Info("feature flags updated from provider", map[string]interface{}{
+			"flags": len(document.Flags),
+		})
+	}
+	return nil
+}
+
+func sameFlags(a, b map[string]Flag) bool {
+	encodedA, _ := json.Marshal(a)
+	encodedB, _ := json.Marshal(b)
+	return string(encodedA) == string(encodedB)
+}
+
+// lookup returns a flag, remote definitions replacing static ones
+func lookup(name string) (Flag, bool) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if flag, ok := remote[name]; ok {
+		return flag, true
+	}
+	flag, ok := static[name]
+	return flag, ok
+}
+
+// enabledFor applies the world, then the organization override
+func (f Flag) enabledFor(org, world string) bool {
+	if enabled, ok := f.Worlds[world]; ok && world != "" {
+		return enabled
+	}
+	if enabled, ok := f.Organizations[org]; ok && org != "" {
+		return enabled
+	}
+	return f.Enabled
+}
+
+// Enabled reports whether a feature is on for an organization in a world.
+// Unknown flags are off.
+func Enabled(name, org, world string) bool {
+	flag, ok := lookup(name)
+	return ok && flag.enabledFor(org, world)
+}
+
+// Definitions returns every flag with its overrides
+func Definitions() map[string]Flag {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	flags := copyFlags(static)
+	for name, flag := range remote {
+		flags[name] = flag
+	}
+	return flags
+}
+
+// Resolve returns every flag's state for an organization in a world
+func Resolve(org, world string) map[string]bool {
+	resolved := map[string]bool{}
+	for name, flag := range Definitions() {
+		resolved[name] = flag.enabledFor(org, world)
+	}
+	return resolved
+}
@@ -0,0 +1,471 @@
+// Package forms defines form entities: in-world cards sessions fill in and
+// submit, for surveys, sign-in sheets and other data capture.
+//
+// A form's fields are described with a JSON Schema object (see Schema for
+// the keywords understood) and laid out by the server into fields clients
+// draw, the way panels are. Submissions are checked against the schema and
+// then stored as rows in the world's storage or forwarded to an endpoint
+// named in the forms file (see Target), or both.
+package forms
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Field types, as clients draw them
+const (
+	FieldText     = "text"
+	FieldEmail    = "email"
+	FieldDate     = "date"
+	FieldURL      = "url"
+	FieldNumber   = "number"
+	FieldInteger  = "integer"
+	FieldCheckbox = "checkbox"
+	FieldChoice   = "choice" // A string from an enum
+)
+
+// Limits of a valid form
+const (
+	MaxFields      = 30
+	maxTitle       = 200
+	maxDescription = 1000
+	maxOptions     = 50
+	maxValue       = 2000 // Bytes of a string value without a maxLength
+	maxDimension   = 50   // Metres
+	defaultWidth   = 2
+	defaultHeight  = 1.5
+)
+
+var (
+	colorPattern  = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+	namePattern   = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{0,63}$`)
+	targetPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+)
+
+// Schema is the JSON Schema of a form's submissions: an object of string,
+// number, integer and boolean properties. Properties are laid out in the
+// order given, then by name; other keywords are ignored.
+type Schema struct {
+	Type       string               `json:"type"` // object
+	Properties map[string]*Property `json:"properties"`
+	Required   []string             `json:"required,omitempty"`
+	Order      []string             `json:"order,omitempty"` // Property names, first to last
+}
+
+// Property is one field of a form's schema
+type Property struct {
+	Type        string   `json:"type"` // string, number, integer or boolean
+	Title       string   `json:"title,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Enum        []string `json:"enum,omitempty"`   // Strings only
+	Format      string   `json:"format,omitempty"` // email, date or uri, for strings
+	MinLength   *int     `json:"minLength,omitempty"`
+	MaxLength   *int     `json:"maxLength,omitempty"`
+	Pattern     string   `json:"pattern,omitempty"` // RE2, anchored by the author
+	Minimum     *float64 `json:"minimum,omitempty"`
+	Maximum     *float64 `json:"maximum,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// Field is a laid-out input of a form
+type Field struct {
+	Name        string   `json:"name"`
+	Label       string   `json:"label"`
+	Description string   `json:"description,omitempty"`
+	Type        string   `json:"type"`
+	Required    bool     `json:"required,omitempty"`
+	Options     []string `json:"options,omitempty"` // Choices
+	MaxLength   int      `json:"max_length,omitempty"`
+	Minimum     *float64 `json:"minimum,omitempty"`
+	Maximum     *float64 `json:"maximum,omitempty"`
+}
+
+// Form is the form component of an entity
+type Form struct {
+	Title       string  `json:"title"`
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+	Submit      string  `json:"submit,omitempty"`     // Label of the submit button, Submit when unset
+	Target      string  `json:"target,omitempty"`     // Forms file target; stored rows when unset
+	Width       float64 `json:"width,omitempty"`      // Metres
+	Height      float64 `json:"height,omitempty"`     // Metres
+	Color       string  `json:"color,omitempty"`      // Text colour
+	Background  string  `json:"background,omitempty"` // Card colour
+	Fields      []Field `json:"fields"`               // Laid out by the server; clients draw these
+}
+
+// Layout validates a form, fills in defaults and lays out its fields
+func (f *Form) Layout() error {
+	f.Title = strings.TrimSpace(f.Title)
+	if f.Title == "" || utf8.RuneCountInString(f.Title) > maxTitle {
+		return fmt.Errorf("title must be 1-%d characters", maxTitle)
+	}
+	if utf8.RuneCountInString(f.Description) > maxDescription {
+		return fmt.Errorf("description must be at most %d characters", maxDescription)
+	}
+	if f.Submit == "" {
+		f.Submit = "Submit"
+	}
+	if utf8.RuneCountInString(f.Submit) > 40 {
+		return errors.New("submit label must be at most 40 characters")
+	}
+	if f.Target != "" && !targetPattern.MatchString(f.Target) {
+		return fmt.Errorf("target must match %s", targetPattern)
+	}
+	if f.Width == 0 {
+		f.Width = defaultWidth
+	}
+	if f.Height == 0 {
+		f.Height = defaultHeight
+	}
+	for _, dimension := range []float64{f.Width, f.Height} {
+		if math.IsNaN(dimension) || dimension < 0 || dimension > maxDimension {
+			return fmt.Errorf("width and height must be within 0-%dm", maxDimension)
+		}
+	}
+	if f.Color == "" {
+		f.Color = "#202020"
+	}
+	if f.Background == "" {
+		f.Background = "#ffffff"
+	}
+	for _, color := range []string{f.Color, f.Background} {
+		if !colorPattern.MatchString(color) {
+			return fmt.Errorf("colors must be #rrggbb, got %q", color)
+		}
+	}
+
+	fields, err := f.Schema.layout()
+	if err != nil {
+		return fmt.Errorf("schema: %v", err)
+	}
+	f.Fields = fields
+	return nil
+}
+
+// layout checks a schema and returns its fields in order
+func (s *Schema) layout() ([]Field, error) {
+	if s == nil || s.Type != "object" {
+		return nil, errors.New(`type must be "object"`)
+	}
+	if len(s.Properties) == 0 || len(s.Properties) > MaxFields {
+		return nil, fmt.Errorf("forms have 1-%d properties", MaxFields)
+	}
+	required := map[string]bool{}
+	for _, name := range s.Required {
+		if s.Properties[name] == nil {
+			return nil, fmt.Errorf("required property %q is not defined", name)
+		}
+		required[name] = true
+	}
+
+	var names []string
+	placed := map[string]bool{}
+	for _, name := range s.Order {
+		if s.Properties[name] == nil || placed[name] {
+			return nil, fmt.Errorf("order names %q, not a property or twice", name)
+		}
+		placed[name] = true
+		names = append(names, name)
+	}
+	var rest []string
+	for name := range s.Properties {
+		if !placed[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	names = append(names, rest...)
+
+	fields := make([]Field, 0, len(names))
+	for _, name := range names {
+		property := s.Properties[name]
+		if !namePattern.MatchString(name) {
+			return nil, fmt.Errorf("property names must match %s, got %q", namePattern, name)
+		}
+		if property == nil {
+			return nil, fmt.Errorf("%s: not a schema", name)
+		}
+		field, err := property.field(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		field.Required = required[name]
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// field checks a property and returns its field
+func (p *Property) field(name string) (Field, error) {
+	field := Field{Name: name, Label: strings.TrimSpace(p.Title), Description: p.Description}
+	if field.Label == "" {
+		field.Label = name
+	}
+	if utf8.RuneCountInString(field.Label) > maxTitle || utf8.RuneCountInString(p.Description) > maxDescription {
+		return field, fmt.Errorf("titles take %d and descriptions %d characters", maxTitle, maxDescription)
+	}
+	if p.Type != "string" && (len(p.Enum) > 0 || p.Format != "" || p.MinLength != nil || p.MaxLength != nil || p.Pattern != "") {
+		return field, errors.New("enum, format, lengths and pattern apply to strings")
+	}
+	if p.Type != "number" && p.Type != "integer" && (p.Minimum != nil || p.Maximum != nil) {
+		return field, errors.New("minimum and maximum apply to numbers")
+	}
+
+	switch p.Type {
+	case "string":
+		field.Type = FieldText
+		switch p.Format {
+		case "":
+		case "email":
+			field.Type = FieldEmail
+		case "date":
+			field.Type = FieldDate
+		case "uri":
+			field.Type = FieldURL
+		default:
+			return field, fmt.Errorf("unknown format %q (email, date or uri)", p.Format)
+		}
+		if len(p.Enum) > 0 {
+			if p.Format != "" || len(p.Enum) > maxOptions {
+				return field, fmt.Errorf("enums take 1-%d strings and no format", maxOptions)
+			}
+			field.Type = FieldChoice
+			field.Options = p.Enum
+		}
+		limit := maxValue
+		if p.MaxLength != nil {
+			if *p.MaxLength < 1 || *p.MaxLength > maxValue {
+				return field, fmt.Errorf("maxLength must be within 1-%d", maxValue)
+			}
+			limit = *p.MaxLength
+		}
+		if p.MinLength != nil && (*p.MinLength < 0 || *p.MinLength > limit) {
+			return field, errors.New("minLength must be within 0 and maxLength")
+		}
+		if field.Type != FieldChoice {
+			field.MaxLength = limit
+		}
+		if p.Pattern != "" {
+			pattern, err := regexp.Compile(p.Pattern)
+			if err != nil {
+				return field, fmt.Errorf("pattern: %v", err)
+			}
+			p.pattern = pattern
+		}
+	case "number", "integer":
+		field.Type = FieldNumber
+		if p.Type == "integer" {
+			field.Type = FieldInteger
+		}
+		for _, bound := range []*float64{p.Minimum, p.Maximum} {
+			if bound != nil && (math.IsNaN(*bound) || math.IsInf(*bound, 0)) {
+				return field, errors.New("minimum and maximum must be finite")
+			}
+		}
+		if p.Minimum != nil && p.Maximum != nil && *p.Minimum > *p.Maximum {
+			return field, errors.New("minimum exceeds maximum")
+		}
+		field.Minimum, field.Maximum = p.Minimum, p.Maximum
+	case "boolean":
+		field.Type = FieldCheckbox
+	default:
+		return field, fmt.Errorf("unknown type %q (string, number, integer or boolean)", p.Type)
+	}
+	return field, nil
+}
+
+// Invalid lists what is wrong with a submission, by field
+type Invalid map[string]string
+
+func (i Invalid) Error() string {
+	names := make([]string, 0, len(i))
+	for name := range i {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	problems := make([]string, len(names))
+	for n, name := range names {
+		problems[n] = name + ": " + i[name]
+	}
+	return strings.Join(problems, "; ")
+}
+
+// Check validates submitted values against a laid-out form and returns
+// them cleaned: strings trimmed, empty values dropped. Problems are
+// returned as Invalid.
+func (f *Form) Check(values map[string]interface{}) (map[string]interface{}, error) {
+	problems := Invalid{}
+	for name := range values {
+		if f.Schema.Properties[name] == nil {
+			problems[name] = "not a field of this form"
+		}
+	}
+	cleaned := map[string]interface{}{}
+	for _, field := range f.Fields {
+		value, problem := f.Schema.Properties[field.Name].check(values[field.Name])
+		switch {
+		case problem != "":
+			problems[field.Name] = problem
+		case value == nil && field.Required:
+			problems[field.Name] = "required"
+		case value != nil:
+			cleaned[field.Name] = value
+		}
+	}
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	return cleaned, nil
+}
+
+// check validates one value, returning it cleaned, nil when empty, or a
+// problem
+func (p *Property) check(value interface{}) (interface{}, string) {
+	if value == nil {
+		return nil, ""
+	}
+	switch p.Type {
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return nil, "must be text"
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return nil, ""
+		}
+		if !utf8.ValidString(text) {
+			return nil, "must be UTF-8"
+		}
+		length := utf8.RuneCountInString(text)
+		limit := maxValue
+		if p.MaxLength != nil {
+			limit = *p.MaxLength
+		}
+		if length > limit || len(text) > 4*maxValue {
+			return nil, fmt.Sprintf("must be at most %d characters", limit)
+		}
+		if p.MinLength != nil && length < *p.MinLength {
+			return nil, fmt.Sprintf("must be at least %d characters", *p.MinLength)
+		}
+		if len(p.Enum) > 0 && !contains(p.Enum, text) {
+			return nil, "must be one of " + strings.Join(p.Enum, ", ")
+		}
+		if p.pattern != nil && !p.pattern.MatchString(text) {
+			return nil, "does not match the expected pattern"
+		}
+		switch p.Format {
+		case "email":
+			if address, err := mail.ParseAddress(text); err != nil || address.Address != text {
+				return nil, "must be an email address"
+			}
+		case "date":
+			if _, err := time.Parse("2006-01-02", text); err != nil {
+				return nil, "must be a date, YYYY-MM-DD"
+			}
+		case "uri":
+			if parsed, err := url.Parse(text); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+				return nil, "must be an absolute URL"
+			}
+		}
+		return text, ""
+	case "number", "integer":
+		number, ok := value.(float64)
+		if !ok || math.IsNaN(number) || math.IsInf(number, 0) {
+			return nil, "must be a number"
+		}
+		if p.Type == "integer" && number != math.Trunc(number) {
+			return nil, "must be a whole number"
+		}
+		if p.Minimum != nil && number < *p.Minimum {
+			return nil, fmt.Sprintf("must be at least %g", *p.Minimum)
+		}
+		if p.Maximum != nil && number > *p.Maximum {
+			return nil, fmt.Sprintf("must be at most %g", *p.Maximum)
+		}
+		return number, ""
+	case "boolean":
+		checked, ok := value.(bool)
+		if !ok {
+			return nil, "must be true or false"
+		}
+		if !checked {
+			return false, "" // Unchecked still answers a required checkbox
+		}
+		return true, ""
+	}
+	return nil, "unknown type"
+}
+
+func contains(options []string, value string) bool {
+	for _, option := range options {
+		if option == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Text returns what a submission's values say, for screening
+func (f *Form) Text(values map[string]interface{}) string {
+	var parts []string
+	for _, field := range f.Fields {
+		if text, ok := values[field.Name].(string); ok && field.Type != FieldChoice {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// PlainText returns the form's title and labels, for screen readers and
+// screening
+func (f *Form) PlainText() string {
+	parts := []string{f.Title}
+	if f.Description != "" {
+		parts = append(parts, f.Description)
+	}
+	for _, field := range f.Fields {
+		parts = append(parts, field.Label)
+		if field.Description != "" {
+			parts = append(parts, field.Description)
+		}
+		parts = append(parts, field.Options...)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Data returns the form as entity operation data
+func (f *Form) Data() map[string]interface{} {
+	var data map[string]interface{}
+	encoded, _ := json.Marshal(f)
+	json.Unmarshal(encoded, &data)
+	return data
+}
+
+// Decode reads and lays out a form from entity operation data
+func Decode(value interface{}) (*Form, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var form Form
+	if err := json.Unmarshal(encoded, &form); err != nil {
+		return nil, fmt.Errorf("invalid form: %v", err)
+	}
+	if err := form.Layout(); err != nil {
+		return nil, err
+	}
+	return &form, nil
+}
@@ -0,0 +1,162 @@
+package forms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"holodeck1/storage"
+)
+
+// MaxRows bounds the submissions a form keeps as rows
+const MaxRows = 10000
+
+// ErrFull is returned when a form keeps MaxRows submissions
+var ErrFull = fmt.Errorf("forms keep at most %d submissions; export and clear them", MaxRows)
+
+// Submission is a form filled in by a session
+type Submission struct {
+	ID          string                 `json:"id"`
+	World       string                 `json:"world"`
+	EntityID    string                 `json:"entity_id"`
+	Form        string                 `json:"form"` // The form's title when submitted
+	HD1ID       string                 `json:"hd1_id"`
+	Name        string                 `json:"name,omitempty"` // The session's avatar name
+	Values      map[string]interface{} `json:"values"`
+	SubmittedAt time.Time              `json:"submitted_at"`
+	Stored      bool                   `json:"stored,omitempty"`
+	Forwarded   bool                   `json:"forwarded,omitempty"`
+}
+
+// rowsPrefix returns the storage prefix of a form's rows
+func rowsPrefix(world, entityID string) (string, error) {
+	key, err := storage.Key(storage.NamespaceWorlds, world+"/forms/"+entityID)
+	return key + "/", err
+}
+
+// Submit keeps or forwards a checked submission as its form says: stored
+// when the form names no target or the target stores too, forwarded to the
+// target otherwise. A stored submission the target refuses is still
+// accepted, with Forwarded false; the error says why.
+func Submit(ctx context.Context, form *Form, submission *Submission) error {
+	var target *Target
+	if form.Target != "" {
+		var err error
+		if target, err = LookupTarget(form.Target); err != nil {
+			return err
+		}
+	}
+	submission.ID = "sub-" + uuid.New().String()
+	submission.Form = form.Title
+	submission.SubmittedAt = submission.SubmittedAt.UTC()
+
+	if target == nil || target.Store {
+		if err := store(ctx, submission); err != nil {
+			return err
+		}
+	}
+	if target == nil {
+		return nil
+	}
+	body, err := json.Marshal(submission)
+	if err != nil {
+		return err
+	}
+	if err := target.forward(ctx, body); err != nil {
+		return fmt.Errorf("forwarding to %s: %v", target.Name, err)
+	}
+	submission.Forwarded = true
+	return nil
+}
+
+// store writes a submission as a row
+func store(ctx context.Context, submission *Submission) error {
+	backend := storage.Default()
+	if backend == nil {
+		return errors.New("storage backend unavailable")
+	}
+	prefix, err := rowsPrefix(submission.World, submission.EntityID)
+	if err != nil {
+		return err
+	}
+	objects, err := backend.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	if len(objects) >= MaxRows {
+		return ErrFull
+	}
+	submission.Stored = true
+	encoded, err := json.Marshal(submission)
+	if err != nil {
+		return err
+	}
+	key := prefix + submission.ID + ".json"
+	return backend.Put(ctx, key, bytes.NewReader(encoded), int64(len(encoded)), "application/json")
+}
+
+// Rows returns the submissions a form keeps, oldest first
+func Rows(ctx context.Context, world, entityID string) ([]*Submission, error) {
+	backend := storage.Default()
+	if backend == nil {
+		return nil, errors.New("storage backend unavailable")
+	}
+	prefix, err := rowsPrefix(world, entityID)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := backend.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	rows := []*Submission{}
+	for _, object := range objects {
+		if !strings.HasSuffix(object.Key, ".json") {
+			continue
+		}
+		body, _, err := backend.Get(ctx, object.Key)
+		if err != nil {
+			continue
+		}
+		var submission Submission
+		err = json.NewDecoder(body).Decode(&submission)
+		body.Close()
+		if err != nil {
+			continue
+		}
+		rows = append(rows, &submission)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].SubmittedAt.Before(rows[j].SubmittedAt) })
+	return rows, nil
+}
+
+// Clear deletes the submissions a form keeps, returning how many it had
+func Clear(ctx context.Context, world, entityID string) (int, error) {
+	backend := storage.Default()
+	if backend == nil {
+		return 0, errors.New("storage backend unavailable")
+	}
+	prefix, err := rowsPrefix(world, entityID)
+	if err != nil {
+		return 0, err
+	}
+	objects, err := backend.List(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+	cleared := 0
+	for _, object := range objects {
+		if err := backend.Delete(ctx, object.Key); err != nil && err != storage.ErrNotFound {
+			return cleared, err
+		}
+		cleared++
+	}
+	return cleared, nil
+}
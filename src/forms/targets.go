@@ -0,0 +1,167 @@
+package forms
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+)
+
+// Targets are the endpoints forms forward submissions to, named in the
+// forms file (YAML) so that world authors pick an endpoint without seeing
+// its URL or secret:
+//
+//	targets:
+//	  signups:
+//	    url: https://crm.example.com/hooks/hd1
+//	    secret: s3cret
+//	    headers: {X-Source: holodeck}
+//	    store: true
+//
+// Each submission is POSTed as JSON. With a secret, the body is signed in
+// X-HD1-Signature-256 as sha256=<hex HMAC>, the way GitHub signs its
+// webhooks. With store, submissions are also kept as rows. A missing file
+// leaves no targets.
+
+// ErrNoTarget is returned for forms naming a target the forms file lacks
+var ErrNoTarget = errors.New("form target not configured")
+
+// Target is an endpoint submissions are forwarded to
+type Target struct {
+	Name    string            `yaml:"-"`
+	URL     string            `yaml:"url"`
+	Secret  string            `yaml:"secret"`  // Signs bodies when set
+	Headers map[string]string `yaml:"headers"` // Sent with every submission
+	Store   bool              `yaml:"store"`   // Also keep submissions as rows
+}
+
+// File is the format of the forms file
+type File struct {
+	Targets map[string]*Target `yaml:"targets"`
+}
+
+var (
+	targets      = map[string]*Target{}
+	targetsMutex sync.RWMutex
+)
+
+// Load reads the forms file; a missing file leaves no targets
+func Load() error {
+	file := config.GetFormsFile()
+	loaded := map[string]*Target{}
+	raw, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		var document File
+		if err := yaml.Unmarshal(raw, &document); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		for name, target := range document.Targets {
+			if target == nil {
+				target = &Target{}
+			}
+			target.Name = name
+			if err := target.validate(); err != nil {
+				return fmt.Errorf("%s: target %q: %v", file, name, err)
+			}
+			loaded[name] = target
+		}
+	}
+
+	targetsMutex.Lock()
+	targets = loaded
+	targetsMutex.Unlock()
+
+	logging.Info("form targets loaded", map[string]interface{}{
+		"file":    file,
+		"targets": len(loaded),
+	})
+	return nil
+}
+
+func (t *Target) validate() error {
+	if !targetPattern.MatchString(t.Name) {
+		return fmt.Errorf("name must match %s", targetPattern)
+	}
+	parsed, err := url.Parse(t.URL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return errors.New("url must be an http or https URL")
+	}
+	for name := range t.Headers {
+		if http.CanonicalHeaderKey(name) == "Content-Type" || http.CanonicalHeaderKey(name) == signatureHeader {
+			return fmt.Errorf("header %s is set by the server", name)
+		}
+	}
+	return nil
+}
+
+// LookupTarget returns a named target
+func LookupTarget(name string) (*Target, error) {
+	targetsMutex.RLock()
+	defer targetsMutex.RUnlock()
+	target, ok := targets[name]
+	if !ok {
+		return nil, ErrNoTarget
+	}
+	return target, nil
+}
+
+// signatureHeader carries the HMAC of a forwarded body
+const signatureHeader = "X-Hd1-Signature-256"
+
+func newClient() *http.Client {
+	return &http.Client{
+		Timeout: config.GetFormsTimeout(),
+		// Endpoints answer directly; a redirect is not followed with the submission
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// forward POSTs a submission to a target
+func (t *Target) forward(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, value := range t.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(t.Secret))
+		mac.Write(body)
+		req.Header.Set(signatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := newClient().Do(req)
+	if err != nil {
+		// The URL may carry a token; keep it out of the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("target returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+// Package geo places worlds on the Earth and grounds them in map tiles.
+//
+// A world may declare a geographic reference: the WGS84 latitude,
+// longitude and altitude of HD1's origin. The reference lives in the
+// world's scene settings under "geo", versioned with the operation log
+// like the coordinate space. Around it the world is a local tangent plane
+// in metres: x east, y up and z south, so a camera looking down -z faces
+// north. The plane follows the ellipsoid's curvature at the reference, so
+// distances hold to well under a metre across a city.
+//
+// Ground tiles come from slippy map providers, one imagery and one
+// elevation URL template per server. Loading an area fetches the web
+// mercator tiles covering it, stores them as assets and places one entity
+// per tile with a terrain component: a plane of the tile's size, draped
+// with the imagery and displaced by the elevation, standing at sea level
+// so heights match the reference's altitude.
+package geo
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"holodeck1/sync"
+)
+
+// WGS84 ellipsoid
+const (
+	semiMajor    = 6378137.0
+	flattening   = 1 / 298.257223563
+	eccentricity = flattening * (2 - flattening) // Squared
+)
+
+// Limits of a valid reference
+const (
+	MaxLatitude = 85.05112878 // Web mercator's edge
+	MaxAltitude = 100000      // Metres
+)
+
+// Reference is the WGS84 position of a world's origin
+type Reference struct {
+	Latitude  float64 `json:"latitude"`  // Degrees north
+	Longitude float64 `json:"longitude"` // Degrees east
+	Altitude  float64 `json:"altitude"`  // Metres above the ellipsoid
+}
+
+// Validate checks a reference
+func (r *Reference) Validate() error {
+	if math.IsNaN(r.Latitude) || math.Abs(r.Latitude) > MaxLatitude {
+		return fmt.Errorf("latitude must be within ±%g", MaxLatitude)
+	}
+	if math.IsNaN(r.Longitude) || math.Abs(r.Longitude) > 180 {
+		return fmt.Errorf("longitude must be within ±180")
+	}
+	if math.IsNaN(r.Altitude) || math.Abs(r.Altitude) > MaxAltitude {
+		return fmt.Errorf("altitude must be within ±%gm", float64(MaxAltitude))
+	}
+	return nil
+}
+
+// Data returns the reference as scene_update data
+func (r *Reference) Data() map[string]interface{} {
+	var data map[string]interface{}
+	encoded, _ := json.Marshal(r)
+	json.Unmarshal(encoded, &data)
+	return data
+}
+
+// Decode reads a reference from scene settings or a document
+func Decode(value interface{}) (*Reference, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var reference Reference
+	if err := json.Unmarshal(encoded, &reference); err != nil {
+		return nil, fmt.Errorf("invalid geo reference: %v", err)
+	}
+	if err := reference.Validate(); err != nil {
+		return nil, err
+	}
+	return &reference, nil
+}
+
+func init() {
+	// Raw scene updates may place the world
+	sync.RegisterOperation(sync.OpSceneUpdate, func(data map[string]interface{}) error {
+		if value, ok := data["geo"]; ok {
+			if _, err := Decode(value); err != nil {
+				return fmt.Errorf("invalid geo reference: %v", err)
+			}
+		}
+		return nil
+	})
+}
+
+// FromScene returns the reference in a world's scene settings, or nil when
+// the world is not placed
+func FromScene(scene map[string]interface{}) *Reference {
+	if value, ok := scene["geo"]; ok {
+		if reference, err := Decode(value); err == nil {
+			return reference
+		}
+	}
+	return nil
+}
+
+// FromLog returns the reference last set in an operation log, or nil
+func FromLog(ops []*sync.Operation) *Reference {
+	for i := len(ops) - 1; i >= 0; i-- {
+		if ops[i].Type != sync.OpSceneUpdate {
+			continue
+		}
+		if value, ok := ops[i].Data["geo"]; ok {
+			return FromScene(map[string]interface{}{"geo": value})
+		}
+	}
+	return nil
+}
+
+// radii returns the meridian and prime vertical radii of curvature at the
+// reference, metres per radian north and, times cos(latitude), east
+func (r *Reference) radii() (north, east float64) {
+	sin := math.Sin(r.Latitude * math.Pi / 180)
+	w := 1 - eccentricity*sin*sin
+	north = semiMajor * (1 - eccentricity) / math.Pow(w, 1.5)
+	east = semiMajor / math.Sqrt(w) * math.Cos(r.Latitude*math.Pi/180)
+	return north, east
+}
+
+// ToLocal returns the world position of a WGS84 position
+func (r *Reference) ToLocal(latitude, longitude, altitude float64) [3]float64 {
+	north, east := r.radii()
+	dLon := math.Remainder(longitude-r.Longitude, 360)
+	return [3]float64{
+		east * dLon * math.Pi / 180,
+		altitude - r.Altitude,
+		-north * (latitude - r.Latitude) * math.Pi / 180,
+	}
+}
+
+// ToWGS84 returns the latitude, longitude and altitude of a world position
+func (r *Reference) ToWGS84(position [3]float64) (latitude, longitude, altitude float64) {
+	north, east := r.radii()
+	latitude = r.Latitude - position[2]/north*180/math.Pi
+	longitude = math.Remainder(r.Longitude+position[0]/east*180/math.Pi, 360)
+	return latitude, longitude, position[1] + r.Altitude
+}
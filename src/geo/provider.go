@@ -0,0 +1,98 @@
+package geo
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"holodeck1/assets"
+	"holodeck1/config"
+	"holodeck1/storage"
+)
+
+// Tile layers
+const (
+	LayerImagery   = "imagery"
+	LayerElevation = "elevation"
+)
+
+var providerClient = &http.Client{}
+
+// template returns a layer's URL template, empty when it is off
+func template(layer string) string {
+	if layer == LayerElevation {
+		return config.GetGeoElevationURL()
+	}
+	return config.GetGeoImageryURL()
+}
+
+// Enabled reports whether a layer has a provider
+func Enabled(layer string) bool {
+	return template(layer) != ""
+}
+
+// cacheKey names the digest a provider tile was stored under. Keys hash
+// the template, so changing provider fetches afresh.
+func cacheKey(template string, tile Tile) (string, error) {
+	sum := sha256.Sum256([]byte(template))
+	return storage.Key(storage.NamespaceAssets, "geotiles/"+hex.EncodeToString(sum[:8])+"/"+tile.String())
+}
+
+// Fetch returns the sha256:<digest> reference of a layer's tile, fetching
+// it from the provider into the asset store unless it was fetched before.
+// A layer without a provider returns an empty reference.
+func Fetch(ctx context.Context, backend storage.Backend, layer string, tile Tile) (string, error) {
+	template := template(layer)
+	if template == "" {
+		return "", nil
+	}
+	key, err := cacheKey(template, tile)
+	if err != nil {
+		return "", err
+	}
+	if body, _, err := backend.Get(ctx, key); err == nil {
+		cached, _ := io.ReadAll(body)
+		body.Close()
+		digest := string(cached)
+		if blobKey, err := assets.BlobKey(digest); err == nil {
+			if _, err := backend.Stat(ctx, blobKey); err == nil {
+				return assets.RefPrefix + digest, nil
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.GetGeoTimeout())
+	defer cancel()
+	url := strings.NewReplacer("{z}", strconv.Itoa(tile.Z), "{x}", strconv.Itoa(tile.X), "{y}", strconv.Itoa(tile.Y)).Replace(template)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	// Tile servers such as OpenStreetMap's refuse anonymous clients
+	req.Header.Set("User-Agent", "HD1/"+config.GetVersion()+" (holodeck1)")
+	resp, err := providerClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%s tile %s: %v", layer, tile, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s tile %s: provider returned %s", layer, tile, resp.Status)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		return "", fmt.Errorf("%s tile %s: provider returned %q, not an image", layer, tile, contentType)
+	}
+
+	blob, _, err := assets.Put(ctx, backend, resp.Body, config.GetAssetsMaxUploadSize(), contentType)
+	if err != nil {
+		return "", fmt.Errorf("%s tile %s: %v", layer, tile, err)
+	}
+	backend.Put(ctx, key, bytes.NewReader([]byte(blob.Digest)), int64(len(blob.Digest)), "text/plain")
+	return blob.Ref, nil
+}
@@ -0,0 +1,164 @@
+package geo
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"holodeck1/assets"
+)
+
+// Tile zoom levels and terrain limits
+const (
+	MaxZoom         = 20
+	DefaultSegments = 64 // Elevation samples per tile edge
+	MaxSegments     = 256
+	maxTerrainSize  = 5e7 // Metres, wider than the equator
+)
+
+// Elevation encodings
+const (
+	EncodingTerrarium = "terrarium" // (r*256 + g + b/256) - 32768 metres
+	EncodingMapbox    = "mapbox"    // (r*65536 + g*256 + b)/10 - 10000 metres
+)
+
+// Tile is a web mercator map tile
+type Tile struct {
+	Z int `json:"z"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// String returns the tile as z/x/y
+func (t Tile) String() string {
+	return fmt.Sprintf("%d/%d/%d", t.Z, t.X, t.Y)
+}
+
+// TileAt returns the tile holding a WGS84 position at a zoom level
+func TileAt(latitude, longitude float64, zoom int) Tile {
+	n := float64(int(1) << zoom)
+	latitude = math.Max(-MaxLatitude, math.Min(MaxLatitude, latitude))
+	x := int((longitude + 180) / 360 * n)
+	y := int((1 - math.Asinh(math.Tan(latitude*math.Pi/180))/math.Pi) / 2 * n)
+	last := int(n) - 1
+	return Tile{Z: zoom, X: ((x % int(n)) + int(n)) % int(n), Y: max(0, min(last, y))}
+}
+
+// Bounds returns the latitudes and longitudes of a tile's edges
+func (t Tile) Bounds() (north, south, west, east float64) {
+	n := float64(int(1) << t.Z)
+	latitude := func(y int) float64 {
+		return math.Atan(math.Sinh(math.Pi*(1-2*float64(y)/n))) * 180 / math.Pi
+	}
+	return latitude(t.Y), latitude(t.Y + 1), float64(t.X)/n*360 - 180, float64(t.X+1)/n*360 - 180
+}
+
+// Cover returns the tiles at a zoom level within radius metres of a WGS84
+// position, north-west first, or an error when there are more than limit
+func Cover(latitude, longitude, radius float64, zoom, limit int) ([]Tile, error) {
+	around := Reference{Latitude: latitude, Longitude: longitude}
+	northWest, _, _ := around.ToWGS84([3]float64{-radius, 0, -radius})
+	southEast, _, _ := around.ToWGS84([3]float64{radius, 0, radius})
+	_, west, _ := around.ToWGS84([3]float64{-radius, 0, 0})
+	_, east, _ := around.ToWGS84([3]float64{radius, 0, 0})
+	first := TileAt(northWest, west, zoom)
+	last := TileAt(southEast, east, zoom)
+
+	n := 1 << zoom
+	columns := (last.X-first.X+n)%n + 1
+	rows := last.Y - first.Y + 1
+	if columns*rows > limit {
+		return nil, fmt.Errorf("%d tiles at zoom %d, more than the %d one request may load", columns*rows, zoom, limit)
+	}
+	tiles := make([]Tile, 0, columns*rows)
+	for y := first.Y; y <= last.Y; y++ {
+		for column := 0; column < columns; column++ {
+			tiles = append(tiles, Tile{Z: zoom, X: (first.X + column) % n, Y: y})
+		}
+	}
+	return tiles, nil
+}
+
+// Place returns where a tile lies in a world placed at r: the world
+// position of its centre at sea level, and its width east and depth south
+// in metres
+func (r *Reference) Place(t Tile) (position [3]float64, width, depth float64) {
+	north, south, west, east := t.Bounds()
+	middle := (north + south) / 2
+	position = r.ToLocal(middle, west+(east-west)/2, 0)
+	across := r.ToLocal(middle, east, 0)[0] - r.ToLocal(middle, west, 0)[0]
+	if across < 0 {
+		across += 2 * math.Pi * semiMajor
+	}
+	return position, across, r.ToLocal(south, west, 0)[2] - r.ToLocal(north, west, 0)[2]
+}
+
+// Terrain is the terrain component of an entity: a plane of width by
+// depth metres centred on the entity, draped with an imagery tile and
+// displaced by an elevation tile's heights above sea level
+type Terrain struct {
+	Tile      string  `json:"tile,omitempty"`      // z/x/y of the provider tile
+	Imagery   string  `json:"imagery,omitempty"`   // sha256:<digest> of the map image
+	Elevation string  `json:"elevation,omitempty"` // sha256:<digest> of the elevation image
+	Encoding  string  `json:"encoding,omitempty"`  // terrarium or mapbox
+	Width     float64 `json:"width"`               // Metres east
+	Depth     float64 `json:"depth"`               // Metres south
+	Segments  int     `json:"segments"`            // Elevation samples per edge
+}
+
+// Validate checks a terrain component, defaulting its encoding and
+// segments
+func (t *Terrain) Validate() error {
+	if t.Imagery == "" && t.Elevation == "" {
+		return fmt.Errorf("imagery or elevation is required")
+	}
+	for _, ref := range []string{t.Imagery, t.Elevation} {
+		if ref != "" && (!strings.HasPrefix(ref, assets.RefPrefix) || !assets.ValidDigest(strings.TrimPrefix(ref, assets.RefPrefix))) {
+			return fmt.Errorf("imagery and elevation must be sha256:<digest> of an uploaded asset, got %q", ref)
+		}
+	}
+	if t.Elevation != "" && t.Encoding == "" {
+		t.Encoding = EncodingTerrarium
+	}
+	if t.Encoding != "" && t.Encoding != EncodingTerrarium && t.Encoding != EncodingMapbox {
+		return fmt.Errorf("encoding must be terrarium or mapbox")
+	}
+	if t.Segments == 0 {
+		t.Segments = DefaultSegments
+	}
+	if t.Segments < 1 || t.Segments > MaxSegments {
+		return fmt.Errorf("segments must be within 1-%d", MaxSegments)
+	}
+	for _, size := range []float64{t.Width, t.Depth} {
+		if math.IsNaN(size) || size <= 0 || size > maxTerrainSize {
+			return fmt.Errorf("width and depth must be within 0-%gm", float64(maxTerrainSize))
+		}
+	}
+	return nil
+}
+
+// Data returns the component as entity operation data
+func (t *Terrain) Data() map[string]interface{} {
+	var data map[string]interface{}
+	encoded, _ := json.Marshal(t)
+	json.Unmarshal(encoded, &data)
+	return data
+}
+
+// DecodeTerrain reads and validates a terrain component from entity
+// operation data
+func DecodeTerrain(value interface{}) (*Terrain, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var terrain Terrain
+	if err := json.Unmarshal(encoded, &terrain); err != nil {
+		return nil, fmt.Errorf("invalid terrain: %v", err)
+	}
+	if err := terrain.Validate(); err != nil {
+		return nil, err
+	}
+	return &terrain, nil
+}
@@ -0,0 +1,422 @@
+// Package guests issues guest links: URLs carrying a capability token that
+// lets people without an account join a world's session.
+//
+// A link grants a set of capabilities on top of viewing the world: chat
+// (captions and poll votes) and edit (changing the scene). A link without
+// either is view-only. Links expire, may be limited to a number of uses,
+// and can be revoked; sessions admitted through a link lose their grant
+// when it does. Only a hash of each token is kept, so a link is shown once
+// when created. Links are written to the storage backend and survive
+// restarts; the sessions holding a grant live in memory.
+package guests
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"holodeck1/logging"
+	"holodeck1/storage"
+)
+
+// Capabilities a link grants beyond viewing
+const (
+	CapabilityView = "view" // Implied by every link
+	CapabilityChat = "chat"
+	CapabilityEdit = "edit"
+)
+
+// Limits of a valid link
+const (
+	MaxLabelLength = 200
+	MaxLifetime    = 30 * 24 * time.Hour
+	MaxUses        = 10000
+	MaxLinks       = 200 // Per world
+)
+
+// TokenPrefix starts every guest token, telling them apart from session
+// tokens
+const TokenPrefix = "hd1g_"
+
+var (
+	// ErrNotFound is returned for unknown links
+	ErrNotFound = errors.New("guest link not found")
+	// ErrInvalid is returned for tokens of no live link
+	ErrInvalid = errors.New("guest link invalid or expired")
+	// ErrUsedUp is returned for links that reached their maximum uses
+	ErrUsedUp = errors.New("guest link used up")
+	// ErrTooMany is returned when a world holds its maximum of links
+	ErrTooMany = errors.New("world holds its maximum of guest links")
+)
+
+var worldPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Link is a guest link into a world
+type Link struct {
+	ID           string    `json:"id"`
+	World        string    `json:"world"`
+	Label        string    `json:"label,omitempty"` // Who the link was made for
+	Capabilities []string  `json:"capabilities"`    // chat and edit; view-only when empty
+	TokenHash    string    `json:"token_hash,omitempty"`
+	MaxUses      int       `json:"max_uses,omitempty"` // Unlimited when 0
+	Uses         int       `json:"uses"`
+	CreatedBy    string    `json:"created_by"`
+	CreatedAt    time.Time `json:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// Grant is what a session admitted through a link may do
+type Grant struct {
+	LinkID       string    `json:"link_id"`
+	World        string    `json:"world"`
+	Capabilities []string  `json:"capabilities"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// Allows reports whether a grant covers a capability; view always is
+func (g *Grant) Allows(capability string) bool {
+	if capability == CapabilityView {
+		return true
+	}
+	for _, granted := range g.Capabilities {
+		if granted == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// NewID generates a link ID
+func NewID() string {
+	return "guest-" + uuid.New().String()
+}
+
+// NewToken generates a guest token and the hash a link keeps of it
+func NewToken() (token, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = TokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Validate checks a link as submitted, normalizing its capabilities
+func (l *Link) Validate() error {
+	if !worldPattern.MatchString(l.World) {
+		return fmt.Errorf("world must match %s", worldPattern)
+	}
+	l.Label = strings.TrimSpace(l.Label)
+	if len(l.Label) > MaxLabelLength || strings.ContainsAny(l.Label, "\r\n") {
+		return fmt.Errorf("label must be one line of at most %d characters", MaxLabelLength)
+	}
+	seen := make(map[string]bool, len(l.Capabilities))
+	capabilities := make([]string, 0, len(l.Capabilities))
+	for _, capability := range l.Capabilities {
+		switch capability {
+		case CapabilityView:
+			continue
+		case CapabilityChat, CapabilityEdit:
+		default:
+			return fmt.Errorf("unknown capability: %q (view, chat or edit)", capability)
+		}
+		if !seen[capability] {
+			seen[capability] = true
+			capabilities = append(capabilities, capability)
+		}
+	}
+	sort.Strings(capabilities)
+	l.Capabilities = capabilities
+	if l.MaxUses < 0 || l.MaxUses > MaxUses {
+		return fmt.Errorf("max_uses must be 0-%d", MaxUses)
+	}
+	if l.ExpiresAt.IsZero() || l.ExpiresAt.Sub(l.CreatedAt) > MaxLifetime {
+		return fmt.Errorf("a link lasts at most %s", MaxLifetime)
+	}
+	return nil
+}
+
+func (l *Link) expired(now time.Time) bool {
+	return !now.Before(l.ExpiresAt)
+}
+
+// Public returns a copy of a link without its token hash
+func (l *Link) Public() *Link {
+	public := *l
+	public.TokenHash = ""
+	return &public
+}
+
+func (l *Link) grant() *Grant {
+	return &Grant{
+		LinkID:       l.ID,
+		World:        l.World,
+		Capabilities: l.Capabilities,
+		ExpiresAt:    l.ExpiresAt,
+	}
+}
+
+var (
+	links  = make(map[string]*Link)
+	grants = make(map[string]*Grant) // Keyed by HD1 ID
+	mutex  sync.RWMutex
+)
+
+func linkKey(l *Link) (string, error) {
+	return storage.Key(storage.NamespaceWorlds, l.World+"/guest-links/"+l.ID+".json")
+}
+
+// Initialize loads links from the storage backend, dropping expired ones
+func Initialize(ctx context.Context) error {
+	backend := storage.Default()
+	if backend == nil {
+		return fmt.Errorf("storage backend unavailable")
+	}
+	objects, err := backend.List(ctx, storage.NamespaceWorlds+"/")
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	loaded := 0
+	for _, object := range objects {
+		if !strings.Contains(object.Key, "/guest-links/") || !strings.HasSuffix(object.Key, ".json") {
+			continue
+		}
+		body, _, err := backend.Get(ctx, object.Key)
+		if err != nil {
+			continue
+		}
+		var link Link
+		err = json.NewDecoder(body).Decode(&link)
+		body.Close()
+		if err != nil || link.Validate() != nil || link.TokenHash == "" {
+			logging.Warn("skipping unreadable guest link", map[string]interface{}{"key": object.Key})
+			continue
+		}
+		if link.expired(now) {
+			backend.Delete(ctx, object.Key)
+			continue
+		}
+		mutex.Lock()
+		links[link.ID] = &link
+		mutex.Unlock()
+		loaded++
+	}
+
+	logging.Info("guest links loaded", map[string]interface{}{
+		"links": loaded,
+	})
+	return nil
+}
+
+func put(ctx context.Context, link *Link) error {
+	key, err := linkKey(link)
+	if err != nil {
+		return err
+	}
+	backend := storage.Default()
+	if backend == nil {
+		return fmt.Errorf("storage backend unavailable")
+	}
+	encoded, err := json.Marshal(link)
+	if err != nil {
+		return err
+	}
+	return backend.Put(ctx, key, bytes.NewReader(encoded), int64(len(encoded)), "application/json")
+}
+
+// Create stores a new link
+func Create(ctx context.Context, link *Link) error {
+	if err := link.Validate(); err != nil {
+		return err
+	}
+	now := time.Now()
+	mutex.RLock()
+	held := 0
+	for _, existing := range links {
+		if existing.World == link.World && !existing.expired(now) {
+			held++
+		}
+	}
+	mutex.RUnlock()
+	if held >= MaxLinks {
+		return ErrTooMany
+	}
+
+	if err := put(ctx, link); err != nil {
+		return err
+	}
+	mutex.Lock()
+	links[link.ID] = link
+	mutex.Unlock()
+	return nil
+}
+
+// List returns a world's live links, newest first, without token hashes
+func List(world string) []*Link {
+	now := time.Now()
+	mutex.RLock()
+	result := []*Link{}
+	for _, link := range links {
+		if link.World == world && !link.expired(now) {
+			result = append(result, link.Public())
+		}
+	}
+	mutex.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.After(result[j].CreatedAt) })
+	return result
+}
+
+// Linked reports whether a world has live links
+func Linked(world string) bool {
+	now := time.Now()
+	mutex.RLock()
+	defer mutex.RUnlock()
+	for _, link := range links {
+		if link.World == world && !link.expired(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Revoke deletes a link and its stored copy. Sessions it admitted lose
+// their grant on the next Valid check.
+func Revoke(ctx context.Context, world, id string) (*Link, error) {
+	mutex.Lock()
+	link, ok := links[id]
+	if ok && link.World == world {
+		delete(links, id)
+	}
+	mutex.Unlock()
+	if !ok || link.World != world {
+		return nil, ErrNotFound
+	}
+
+	if backend := storage.Default(); backend != nil {
+		if key, err := linkKey(link); err == nil {
+			if err := backend.Delete(ctx, key); err != nil && err != storage.ErrNotFound {
+				return link.Public(), err
+			}
+		}
+	}
+	return link.Public(), nil
+}
+
+// lookup finds the live link of a token; the caller holds the mutex
+func lookup(token string, now time.Time) *Link {
+	if !strings.HasPrefix(token, TokenPrefix) {
+		return nil
+	}
+	hash := hashToken(token)
+	for _, link := range links {
+		if link.TokenHash == hash && !link.expired(now) {
+			return link
+		}
+	}
+	return nil
+}
+
+// Redeem admits a new session through a link's token, counting a use
+func Redeem(ctx context.Context, token string) (*Grant, error) {
+	mutex.Lock()
+	link := lookup(token, time.Now())
+	if link == nil {
+		mutex.Unlock()
+		return nil, ErrInvalid
+	}
+	if link.MaxUses > 0 && link.Uses >= link.MaxUses {
+		mutex.Unlock()
+		return nil, ErrUsedUp
+	}
+	link.Uses++
+	stored := *link
+	mutex.Unlock()
+
+	// The use is counted even if it cannot be stored; at worst a link
+	// regains it on restart
+	if err := put(ctx, &stored); err != nil {
+		logging.Warn("failed to store guest link use", map[string]interface{}{
+			"link_id": stored.ID,
+			"error":   err.Error(),
+		})
+	}
+	return stored.grant(), nil
+}
+
+// Resume returns the grant a session already holds through a token, so a
+// reconnecting guest does not use the link again
+func Resume(hd1ID, token string) (*Grant, bool) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	grant, ok := grants[hd1ID]
+	if !ok {
+		return nil, false
+	}
+	link := lookup(token, time.Now())
+	if link == nil || link.ID != grant.LinkID {
+		return nil, false
+	}
+	return grant, true
+}
+
+// Bind records the grant a session was admitted with
+func Bind(hd1ID string, grant *Grant) {
+	mutex.Lock()
+	grants[hd1ID] = grant
+	mutex.Unlock()
+}
+
+// Release forgets a session's grant
+func Release(hd1ID string) {
+	mutex.Lock()
+	delete(grants, hd1ID)
+	mutex.Unlock()
+}
+
+// GrantFor returns the grant of a guest session, or nil for sessions not
+// admitted through a link
+func GrantFor(hd1ID string) *Grant {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return grants[hd1ID]
+}
+
+// Valid reports whether a grant's link is still live
+func Valid(grant *Grant) bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	link, ok := links[grant.LinkID]
+	return ok && !link.expired(time.Now())
+}
+
+// Prune drops the grants of sessions active no longer reports, which can
+// not resume
+func Prune(active func(hd1ID string) bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	for hd1ID := range grants {
+		if !active(hd1ID) {
+			delete(grants, hd1ID)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Package hibernation unloads the served world while nobody is in it.
+//
+// Once no client has been connected for the configured idle period, the
+// world's operation log is snapshotted to the storage backend and dropped
+// from memory. Server-side systems keep running on what they already
+// follow, and anything they submit stays loaded. The first read of an
+// unloaded operation, which a joining client's sync always is, loads the
+// snapshot back under the same sequence numbers, so neither clients nor
+// the API can tell the world ever slept.
+package hibernation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+	"holodeck1/storage"
+	"holodeck1/sync"
+)
+
+// Log is the operation log that hibernates
+type Log interface {
+	SetStore(store sync.Store)
+	Hibernate() (int, error)
+	Hibernated() bool
+}
+
+// store keeps a world's snapshot in the storage backend
+type store struct {
+	backend storage.Backend
+	key     string
+}
+
+// Save writes the snapshot
+func (s *store) Save(ops []*sync.Operation) error {
+	encoded, err := json.Marshal(ops)
+	if err != nil {
+		return err
+	}
+	return s.backend.Put(context.Background(), s.key, bytes.NewReader(encoded), int64(len(encoded)), "application/json")
+}
+
+// Load reads the snapshot back and removes it, as the log holds it again
+func (s *store) Load() ([]*sync.Operation, error) {
+	ops, err := s.Peek()
+	if err != nil {
+		return nil, err
+	}
+	s.backend.Delete(context.Background(), s.key)
+	return ops, nil
+}
+
+// Peek reads the snapshot and leaves it in place
+func (s *store) Peek() ([]*sync.Operation, error) {
+	body, _, err := s.backend.Get(context.Background(), s.key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	var ops []*sync.Operation
+	if err := json.NewDecoder(body).Decode(&ops); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+// snapshotKey names where a world's snapshot is kept
+func snapshotKey(world string) (string, error) {
+	return storage.Key(storage.NamespaceWorlds, world+"/hibernation.json")
+}
+
+// Resume loads a snapshot an earlier run left hibernating, when the server
+// stopped before anyone woke the world, into an empty log, returning
+// how many operations it held. A world without one resumes nothing.
+func Resume(world string, log interface{ Resume([]*sync.Operation) error }) (int, error) {
+	backend := storage.Default()
+	if backend == nil {
+		return 0, fmt.Errorf("storage backend unavailable")
+	}
+	key, err := snapshotKey(world)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := backend.Stat(context.Background(), key); err != nil {
+		return 0, nil
+	}
+	snapshot := &store{backend: backend, key: key}
+	ops, err := snapshot.Load()
+	if err != nil {
+		return 0, err
+	}
+	if err := log.Resume(ops); err != nil {
+		snapshot.Save(ops) // Keep it for a later start
+		return 0, err
+	}
+	return len(ops), nil
+}
+
+// Stepper returns the step hibernating a world's log once it has had no
+// clients for the idle period, or nil when hibernation is off or there is
+// no storage backend. A log woken while still empty, by the API or a
+// server task, gets a full idle period again.
+func Stepper(world string, log Log, connected func() int) func(now time.Time) {
+	idle := config.GetHibernationIdle()
+	if idle <= 0 {
+		logging.Info("world hibernation disabled", map[string]interface{}{
+			"world": world,
+		})
+		return nil
+	}
+	backend := storage.Default()
+	if backend == nil {
+		logging.Warn("world hibernation disabled", map[string]interface{}{
+			"world":  world,
+			"reason": "storage backend unavailable",
+		})
+		return nil
+	}
+	key, err := snapshotKey(world)
+	if err != nil {
+		logging.Error("world hibernation disabled", map[string]interface{}{
+			"world": world,
+			"error": err.Error(),
+		})
+		return nil
+	}
+	log.SetStore(&store{backend: backend, key: key})
+
+	var emptySince time.Time
+	asleep := false
+	// Idle time is real time whatever the world's clock does
+	return func(time.Time) {
+		now := time.Now()
+		if connected() > 0 {
+			emptySince, asleep = time.Time{}, false
+			return
+		}
+		if asleep && !log.Hibernated() {
+			emptySince, asleep = now, false // Woken without a client
+		}
+		if emptySince.IsZero() {
+			emptySince = now
+		}
+		if asleep || now.Sub(emptySince) < idle {
+			return
+		}
+
+		started := time.Now()
+		unloaded, err := log.Hibernate()
+		if err != nil {
+			logging.Error("world hibernation failed", map[string]interface{}{
+				"world": world,
+				"error": err.Error(),
+			})
+			emptySince = now // Try again after another idle period
+			return
+		}
+		asleep = true
+		if unloaded > 0 {
+			logging.Info("world hibernated", map[string]interface{}{
+				"world":      world,
+				"operations": unloaded,
+				"idle":       now.Sub(emptySince).Round(time.Second).String(),
+				"took_ms":    time.Since(started).Milliseconds(),
+			})
+		}
+	}
+}
@@ -0,0 +1,328 @@
+// Package holds places worlds, recordings and audit logs under legal hold.
+//
+// A held resource is kept as it is: retention and purge jobs check Check
+// before deleting or overwriting anything and skip what it refuses. A hold
+// on a world also holds its audit log. Holds name the matter they were
+// placed for and may carry a release date, after which they lift on their
+// own; released holds are kept, with who or what released them, for
+// compliance reports. Holds are written to the storage backend and survive
+// restarts.
+package holds
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"holodeck1/logging"
+	"holodeck1/storage"
+)
+
+// Kinds of resource a hold keeps
+const (
+	KindWorld     = "world"     // The world's stored state, its audit log included
+	KindRecording = "recording" // An object of the recordings namespace
+	KindAudit     = "audit"     // A world's moderation audit log
+)
+
+// RecordType tags holds in compliance reports
+const RecordType = "legal_hold"
+
+// MaxTextLength bounds a hold's matter and reason
+const MaxTextLength = 500
+
+// ReleasedByDate releases the holds whose release date passed
+const ReleasedByDate = "release_date"
+
+// sweepInterval is how often holds past their release date are released
+const sweepInterval = time.Minute
+
+var (
+	// ErrNotFound is returned for unknown holds
+	ErrNotFound = errors.New("legal hold not found")
+	// ErrReleased is returned releasing a hold twice
+	ErrReleased = errors.New("legal hold already released")
+	// ErrHeld is returned by Check for held resources
+	ErrHeld = errors.New("under legal hold")
+)
+
+var worldPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Hold keeps a resource from retention and purge jobs
+type Hold struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`     // world, recording or audit
+	Resource   string     `json:"resource"` // World ID, or recording object name
+	Matter     string     `json:"matter"`   // Case or request the hold is for
+	Reason     string     `json:"reason,omitempty"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ReleaseAt  *time.Time `json:"release_at,omitempty"` // Lifts on its own then
+	ReleasedAt *time.Time `json:"released_at,omitempty"`
+	ReleasedBy string     `json:"released_by,omitempty"`
+}
+
+// NewID generates a hold ID
+func NewID() string {
+	return "hold-" + uuid.New().String()
+}
+
+// Validate checks a hold as submitted
+func (h *Hold) Validate() error {
+	switch h.Kind {
+	case KindWorld, KindAudit:
+		if !worldPattern.MatchString(h.Resource) {
+			return fmt.Errorf("resource must be a world ID matching %s", worldPattern)
+		}
+	case KindRecording:
+		key, err := storage.Key(storage.NamespaceRecordings, h.Resource)
+		if err != nil {
+			return fmt.Errorf("resource must be a recording object name: %v", err)
+		}
+		h.Resource = strings.TrimPrefix(key, storage.NamespaceRecordings+"/")
+	default:
+		return fmt.Errorf("unknown kind: %q (world, recording or audit)", h.Kind)
+	}
+	h.Matter = strings.TrimSpace(h.Matter)
+	if h.Matter == "" || len(h.Matter) > MaxTextLength {
+		return fmt.Errorf("matter must be 1-%d characters", MaxTextLength)
+	}
+	h.Reason = strings.TrimSpace(h.Reason)
+	if len(h.Reason) > MaxTextLength {
+		return fmt.Errorf("reason must be at most %d characters", MaxTextLength)
+	}
+	return nil
+}
+
+// Active reports whether a hold keeps its resource at a time
+func (h *Hold) Active(now time.Time) bool {
+	return h.ReleasedAt == nil && (h.ReleaseAt == nil || now.Before(*h.ReleaseAt))
+}
+
+// covers reports whether a hold keeps a resource; world holds keep the
+// world's audit log too
+func (h *Hold) covers(kind, resource string) bool {
+	return h.Resource == resource && (h.Kind == kind || h.Kind == KindWorld && kind == KindAudit)
+}
+
+var (
+	holds = make(map[string]*Hold)
+	mutex sync.RWMutex
+)
+
+func holdKey(id string) (string, error) {
+	return storage.Key(storage.NamespaceCompliance, "holds/"+id+".json")
+}
+
+// Initialize loads holds from the storage backend
+func Initialize(ctx context.Context) error {
+	backend := storage.Default()
+	if backend == nil {
+		return fmt.Errorf("storage backend unavailable")
+	}
+	objects, err := backend.List(ctx, storage.NamespaceCompliance+"/holds/")
+	if err != nil {
+		return err
+	}
+
+	loaded, active := 0, 0
+	now := time.Now()
+	for _, object := range objects {
+		if !strings.HasSuffix(object.Key, ".json") {
+			continue
+		}
+		body, _, err := backend.Get(ctx, object.Key)
+		if err != nil {
+			continue
+		}
+		var hold Hold
+		err = json.NewDecoder(body).Decode(&hold)
+		body.Close()
+		if err != nil || hold.Validate() != nil {
+			logging.Warn("skipping unreadable legal hold", map[string]interface{}{"key": object.Key})
+			continue
+		}
+		mutex.Lock()
+		holds[hold.ID] = &hold
+		mutex.Unlock()
+		loaded++
+		if hold.Active(now) {
+			active++
+		}
+	}
+
+	logging.Info("legal holds loaded", map[string]interface{}{
+		"holds":  loaded,
+		"active": active,
+	})
+	return nil
+}
+
+func put(ctx context.Context, hold *Hold) error {
+	key, err := holdKey(hold.ID)
+	if err != nil {
+		return err
+	}
+	backend := storage.Default()
+	if backend == nil {
+		return fmt.Errorf("storage backend unavailable")
+	}
+	encoded, err := json.Marshal(hold)
+	if err != nil {
+		return err
+	}
+	return backend.Put(ctx, key, bytes.NewReader(encoded), int64(len(encoded)), "application/json")
+}
+
+// Place stores a new hold
+func Place(ctx context.Context, hold *Hold) error {
+	if err := hold.Validate(); err != nil {
+		return err
+	}
+	if hold.ReleaseAt != nil && !hold.ReleaseAt.After(hold.CreatedAt) {
+		return fmt.Errorf("release_at must be in the future")
+	}
+	if err := put(ctx, hold); err != nil {
+		return err
+	}
+	mutex.Lock()
+	holds[hold.ID] = hold
+	mutex.Unlock()
+
+	logging.Warn("legal hold placed", map[string]interface{}{
+		"hold_id":    hold.ID,
+		"kind":       hold.Kind,
+		"resource":   hold.Resource,
+		"matter":     hold.Matter,
+		"created_by": hold.CreatedBy,
+	})
+	return nil
+}
+
+// Release lifts a hold, keeping it for the record
+func Release(ctx context.Context, id, by string) (*Hold, error) {
+	mutex.Lock()
+	hold, ok := holds[id]
+	if !ok {
+		mutex.Unlock()
+		return nil, ErrNotFound
+	}
+	if hold.ReleasedAt != nil {
+		mutex.Unlock()
+		return nil, ErrReleased
+	}
+	released := *hold
+	now := time.Now().UTC()
+	released.ReleasedAt = &now
+	released.ReleasedBy = by
+	mutex.Unlock()
+
+	if err := put(ctx, &released); err != nil {
+		return nil, err
+	}
+	mutex.Lock()
+	holds[id] = &released
+	mutex.Unlock()
+
+	logging.Warn("legal hold released", map[string]interface{}{
+		"hold_id":     id,
+		"kind":        released.Kind,
+		"resource":    released.Resource,
+		"released_by": by,
+	})
+	return &released, nil
+}
+
+// Get returns a hold by ID
+func Get(id string) (*Hold, bool) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	hold, ok := holds[id]
+	if !ok {
+		return nil, false
+	}
+	copied := *hold
+	return &copied, true
+}
+
+// List returns the active holds, or every hold with released, newest first
+func List(released bool) []*Hold {
+	now := time.Now()
+	mutex.RLock()
+	result := []*Hold{}
+	for _, hold := range holds {
+		if released || hold.Active(now) {
+			copied := *hold
+			result = append(result, &copied)
+		}
+	}
+	mutex.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.After(result[j].CreatedAt) })
+	return result
+}
+
+// Held returns an active hold keeping a resource, or nil
+func Held(kind, resource string) *Hold {
+	now := time.Now()
+	mutex.RLock()
+	defer mutex.RUnlock()
+	for _, hold := range holds {
+		if hold.covers(kind, resource) && hold.Active(now) {
+			copied := *hold
+			return &copied
+		}
+	}
+	return nil
+}
+
+// Check returns ErrHeld, naming the hold, when a resource is held. Jobs
+// deleting or overwriting stored data call it first.
+func Check(kind, resource string) error {
+	if hold := Held(kind, resource); hold != nil {
+		return fmt.Errorf("%s %s %w (%s)", kind, resource, ErrHeld, hold.ID)
+	}
+	return nil
+}
+
+// Run releases holds past their release date every minute until ctx ends
+func Run(ctx context.Context) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, id := range due(now) {
+				if _, err := Release(ctx, id, ReleasedByDate); err != nil && err != ErrReleased {
+					logging.Error("failed to release legal hold", map[string]interface{}{
+						"hold_id": id,
+						"error":   err.Error(),
+					})
+				}
+			}
+		}
+	}
+}
+
+// due returns the unreleased holds whose release date passed
+func due(now time.Time) []string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	var ids []string
+	for id, hold := range holds {
+		if hold.ReleasedAt == nil && hold.ReleaseAt != nil && !now.Before(*hold.ReleaseAt) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,289 @@
+// Package hooks runs operator commands and compiled-in callbacks at points
+// of the server's lifecycle, so provisioning needs no change to main.go.
+// Commands are listed by point in the hooks file (YAML):
+//
+//	hooks:
+//	  post_config:
+//	    - name: secrets
+//	      command: [/usr/local/bin/fetch-secrets, --out, /run/hd1]
+//	      required: true
+//	  post_hub_start:
+//	    - name: seed
+//	      command: [hd1, world, import, /srv/seed/world_one.json]
+//	      timeout: 2m
+//	  pre_shutdown:
+//	    - name: backup
+//	      command: [sh, -c, 'hd1 backup -o /backups/hd1-$(date +%s).tar.gz']
+//
+// post_config runs once configuration and logging are loaded, before any
+// subsystem starts. post_hub_start runs once the hub runs and the
+// listeners accept connections, so commands may call the API; readiness
+// fails until it is done. pre_shutdown runs on SIGTERM or SIGINT once
+// readiness fails, while requests are still served, within the shutdown
+// timeout.
+//
+// Commands run without a shell, in order, with the server's environment
+// plus HD1_HOOK (the point), HD1_HOOK_NAME, HD1_VERSION, HD1_WORLD and
+// HD1_LISTEN (the first listener), and their output is logged. A required
+// hook that fails stops the server from starting; other failures are
+// logged. A missing file leaves no commands.
+//
+// Code built into the binary hooks in with Register, from an init function;
+// callbacks run after the point's commands and an error from one counts as
+// a required hook's.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+)
+
+// Lifecycle points
+const (
+	PostConfig   = "post_config"
+	PostHubStart = "post_hub_start"
+	PreShutdown  = "pre_shutdown"
+)
+
+// Points are every lifecycle point, in the order they are reached
+var Points = []string{PostConfig, PostHubStart, PreShutdown}
+
+// DefaultTimeout bounds commands that set no timeout
+const DefaultTimeout = 30 * time.Second
+
+// maxOutput bounds the output of a command kept for the log
+const maxOutput = 16 << 10
+
+var hookName = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// Hook is a command run at a lifecycle point
+type Hook struct {
+	Name     string            `yaml:"name"`     // For logs; the command's name when empty
+	Command  []string          `yaml:"command"`  // Program and arguments, run without a shell
+	Dir      string            `yaml:"dir"`      // Working directory; the server's when empty
+	Env      map[string]string `yaml:"env"`      // Added to the environment
+	Timeout  time.Duration     `yaml:"timeout"`  // DefaultTimeout when 0
+	Required bool              `yaml:"required"` // Its failure stops the server from starting
+}
+
+// Document is the format of the hooks file
+type Document struct {
+	Hooks map[string][]*Hook `yaml:"hooks"`
+}
+
+// Func is a callback run at a lifecycle point
+type Func func(ctx context.Context) error
+
+type callback struct {
+	name string
+	fn   Func
+}
+
+var (
+	commands  = map[string][]*Hook{}
+	callbacks = map[string][]callback{}
+	mutex     sync.RWMutex
+)
+
+// Register adds a callback at a lifecycle point
+func Register(point, name string, fn Func) {
+	if !contains(Points, point) {
+		panic("hooks: unknown lifecycle point " + point)
+	}
+	mutex.Lock()
+	callbacks[point] = append(callbacks[point], callback{name: name, fn: fn})
+	mutex.Unlock()
+}
+
+// Load reads the hooks file; a missing file leaves no commands
+func Load() error {
+	file := config.GetHooksFile()
+	loaded := map[string][]*Hook{}
+	raw, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		var document Document
+		if err := yaml.Unmarshal(raw, &document); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		for point, hooks := range document.Hooks {
+			if !contains(Points, point) {
+				return fmt.Errorf("%s: unknown lifecycle point %q, expected one of %v", file, point, Points)
+			}
+			for i, hook := range hooks {
+				if err := hook.validate(); err != nil {
+					return fmt.Errorf("%s: %s hook %d: %v", file, point, i+1, err)
+				}
+			}
+			loaded[point] = hooks
+		}
+	}
+
+	mutex.Lock()
+	commands = loaded
+	mutex.Unlock()
+
+	counts := map[string]interface{}{"file": file}
+	for _, point := range Points {
+		counts[point] = len(loaded[point])
+	}
+	logging.Info("lifecycle hooks loaded", counts)
+	return nil
+}
+
+func (h *Hook) validate() error {
+	if h == nil || len(h.Command) == 0 || h.Command[0] == "" {
+		return errors.New("command required")
+	}
+	if h.Name == "" {
+		h.Name = h.Command[0]
+	} else if !hookName.MatchString(h.Name) {
+		return fmt.Errorf("name must match %s", hookName)
+	}
+	if h.Timeout < 0 {
+		return errors.New("timeout must not be negative")
+	}
+	if h.Timeout == 0 {
+		h.Timeout = DefaultTimeout
+	}
+	return nil
+}
+
+// Has reports whether anything runs at a lifecycle point
+func Has(point string) bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return len(commands[point]) > 0 || len(callbacks[point]) > 0
+}
+
+// Run runs a lifecycle point's commands, then its callbacks, and returns
+// the first failure of a required hook or a callback. Every hook runs,
+// whatever the ones before it did.
+func Run(ctx context.Context, point string) error {
+	mutex.RLock()
+	hooks, registered := commands[point], callbacks[point]
+	mutex.RUnlock()
+	if len(hooks) == 0 && len(registered) == 0 {
+		return nil
+	}
+
+	started := time.Now()
+	var failed error
+	for _, hook := range hooks {
+		if err := hook.run(ctx, point); err != nil && hook.Required && failed == nil {
+			failed = fmt.Errorf("%s hook %s: %v", point, hook.Name, err)
+		}
+	}
+	for _, registered := range registered {
+		if err := runCallback(ctx, point, registered); err != nil && failed == nil {
+			failed = fmt.Errorf("%s callback %s: %v", point, registered.name, err)
+		}
+	}
+	logging.Info("lifecycle hooks run", map[string]interface{}{
+		"point":       point,
+		"commands":    len(hooks),
+		"callbacks":   len(registered),
+		"duration_ms": time.Since(started).Milliseconds(),
+		"failed":      failed != nil,
+	})
+	return failed
+}
+
+// run runs a command and logs its outcome and output
+func (h *Hook) run(ctx context.Context, point string) error {
+	ctx, cancel := context.WithTimeout(ctx, h.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Dir = h.Dir
+	cmd.Env = append(os.Environ(),
+		"HD1_HOOK="+point,
+		"HD1_HOOK_NAME="+h.Name,
+		"HD1_VERSION="+config.GetVersion(),
+		"HD1_WORLD="+config.GetWorldsDefaultWorld(),
+		"HD1_LISTEN="+config.GetListen()[0],
+	)
+	for key, value := range h.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	output := &limitedBuffer{limit: maxOutput}
+	cmd.Stdout, cmd.Stderr = output, output
+	cmd.WaitDelay = time.Second // Don't wait on children holding the output open
+
+	started := time.Now()
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %s", h.Timeout)
+	}
+	fields := map[string]interface{}{
+		"point":       point,
+		"hook":        h.Name,
+		"required":    h.Required,
+		"duration_ms": time.Since(started).Milliseconds(),
+		"output":      string(bytes.TrimSpace(output.Bytes())),
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+		logging.Error("lifecycle hook failed", fields)
+		return err
+	}
+	logging.Info("lifecycle hook completed", fields)
+	return nil
+}
+
+// runCallback runs a registered callback, recovering a panic as its error
+func runCallback(ctx context.Context, point string, registered callback) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("panic: %v", recovered)
+		}
+		if err != nil {
+			logging.Error("lifecycle callback failed", map[string]interface{}{
+				"point":    point,
+				"callback": registered.name,
+				"error":    err.Error(),
+			})
+		}
+	}()
+	return registered.fn(ctx)
+}
+
+// limitedBuffer keeps the first limit bytes written to it
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		if len(p) > room {
+			b.Buffer.Write(p[:room])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func contains(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+// Package htdocs embeds the console's document root, index.html and
+// static/, so a single binary serves the console with no files beside it.
+//
+// Codegen copies share/htdocs into dist/ before each build. A binary built
+// without running codegen carries no assets and serves them from disk.
+package htdocs
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed all:dist
+var files embed.FS
+
+// FS returns the embedded document root, or nil when the binary was built
+// without assets
+func FS() fs.FS {
+	root, err := fs.Sub(files, "dist")
+	if err != nil {
+		return nil
+	}
+	if _, err := fs.Stat(root, "index.html"); err != nil {
+		return nil
+	}
+	return root
+}
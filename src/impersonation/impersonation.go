@@ -0,0 +1,325 @@
+// Package impersonation lets support staff act as a connected session for
+// a while, to see its worlds as it does and reproduce what it reports.
+//
+// An operator starts an impersonation with a reason, a scope and a
+// duration no longer than the configured maximum, and is handed a token
+// once. API calls carrying the token in X-HD1-Impersonation act as the
+// session, holding the permissions of the scope the session itself holds.
+// The session's consoles show a banner while it lasts. The start, the end
+// and every call made under it go to the world's audit log. Impersonations
+// end when the operator ends them or their time is up; they do not outlive
+// the server.
+package impersonation
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"holodeck1/config"
+	"holodeck1/guests"
+	"holodeck1/logging"
+	"holodeck1/moderation"
+	"holodeck1/server"
+)
+
+// Header carries an impersonation token on API calls
+const Header = "X-HD1-Impersonation"
+
+// TokenPrefix marks impersonation tokens
+const TokenPrefix = "hd1i_"
+
+// EndedByTimeLimit ends the impersonations whose time is up
+const EndedByTimeLimit = "time_limit"
+
+// sweepInterval is how often impersonations past their time are ended
+const sweepInterval = 10 * time.Second
+
+var (
+	// ErrNotFound is returned for unknown or ended impersonations
+	ErrNotFound = errors.New("impersonation not found")
+	// ErrActive is returned impersonating a session already impersonated
+	ErrActive = errors.New("session already impersonated")
+)
+
+// Scopes an impersonation may hold; view is the default
+var scopes = []string{guests.CapabilityView, guests.CapabilityChat, guests.CapabilityEdit}
+
+// Impersonation is support staff acting as a session
+type Impersonation struct {
+	ID        string     `json:"id"`
+	HD1ID     string     `json:"hd1_id"`   // Session acted as
+	World     string     `json:"world"`    // World the session is in
+	Operator  string     `json:"operator"` // Who acts as it
+	Reason    string     `json:"reason"`
+	Scope     []string   `json:"scope"` // view, chat and edit
+	StartedAt time.Time  `json:"started_at"`
+	ExpiresAt time.Time  `json:"expires_at"` // Hard limit, ends on its own then
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	EndedBy   string     `json:"ended_by,omitempty"`
+	Requests  int        `json:"requests"` // Calls made under it
+
+	tokenHash string
+}
+
+// NewID generates an impersonation ID
+func NewID() string {
+	return "impersonation-" + uuid.New().String()
+}
+
+// Validate checks an impersonation as requested; without a scope it may
+// only view
+func (i *Impersonation) Validate() error {
+	i.Reason = strings.TrimSpace(i.Reason)
+	if i.Reason == "" || len(i.Reason) > moderation.MaxReasonLength {
+		return fmt.Errorf("reason must be 1-%d characters", moderation.MaxReasonLength)
+	}
+	if len(i.Scope) == 0 {
+		i.Scope = []string{guests.CapabilityView}
+	}
+	for _, scope := range i.Scope {
+		if !contains(scopes, scope) {
+			return fmt.Errorf("unknown scope: %q (view, chat or edit)", scope)
+		}
+	}
+	if limit := config.GetImpersonationMaxDuration(); !i.ExpiresAt.After(i.StartedAt) || i.ExpiresAt.Sub(i.StartedAt) > limit {
+		return fmt.Errorf("duration must be positive and at most %s", limit)
+	}
+	return nil
+}
+
+// Active reports whether an impersonation still acts at a time
+func (i *Impersonation) Active(now time.Time) bool {
+	return i.EndedAt == nil && now.Before(i.ExpiresAt)
+}
+
+// Permissions narrows what the session holds to the scope
+func (i *Impersonation) Permissions(held []string) []string {
+	permissions := []string{}
+	for _, permission := range held {
+		if contains(i.Scope, permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
+}
+
+func (i *Impersonation) notice() *server.ImpersonationNotice {
+	return &server.ImpersonationNotice{
+		ID:        i.ID,
+		Operator:  i.Operator,
+		Reason:    i.Reason,
+		Scope:     i.Scope,
+		ExpiresAt: i.ExpiresAt,
+		EndedBy:   i.EndedBy,
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+var (
+	impersonations = make(map[string]*Impersonation)
+	mutex          sync.Mutex
+)
+
+// Start begins an impersonation, tells the session's consoles and returns
+// the token to act with, which is not kept
+func Start(ctx context.Context, hub *server.Hub, imp *Impersonation) (string, error) {
+	if err := imp.Validate(); err != nil {
+		return "", err
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := TokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	imp.tokenHash = hashToken(token)
+
+	now := time.Now()
+	mutex.Lock()
+	for _, current := range impersonations {
+		if current.HD1ID == imp.HD1ID && current.Active(now) {
+			mutex.Unlock()
+			return "", ErrActive
+		}
+	}
+	impersonations[imp.ID] = imp
+	mutex.Unlock()
+
+	server.SetImpersonation(hub, imp.HD1ID, imp.notice())
+	expires := imp.ExpiresAt
+	record(ctx, &moderation.Entry{
+		World:         imp.World,
+		Action:        moderation.ActionImpersonate,
+		HD1ID:         imp.HD1ID,
+		Reason:        imp.Reason,
+		Moderator:     imp.Operator,
+		Sessions:      1,
+		ExpiresAt:     &expires,
+		Impersonation: imp.ID,
+	})
+	logging.Warn("impersonation started", map[string]interface{}{
+		"impersonation_id": imp.ID,
+		"hd1_id":           imp.HD1ID,
+		"operator":         imp.Operator,
+		"scope":            imp.Scope,
+		"expires_at":       imp.ExpiresAt,
+	})
+	return token, nil
+}
+
+// Lookup returns the active impersonation a token acts with
+func Lookup(token string) (*Impersonation, bool) {
+	if !strings.HasPrefix(token, TokenPrefix) {
+		return nil, false
+	}
+	hash := hashToken(token)
+	now := time.Now()
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, imp := range impersonations {
+		if imp.tokenHash == hash && imp.Active(now) {
+			copied := *imp
+			return &copied, true
+		}
+	}
+	return nil, false
+}
+
+// RecordRequest adds a call made under an impersonation to the audit log
+func RecordRequest(ctx context.Context, id, world, request string) {
+	mutex.Lock()
+	imp, ok := impersonations[id]
+	if ok {
+		imp.Requests++
+	}
+	mutex.Unlock()
+	if !ok {
+		return
+	}
+	record(ctx, &moderation.Entry{
+		World:         world,
+		Action:        moderation.ActionImpersonateRequest,
+		HD1ID:         imp.HD1ID,
+		Moderator:     imp.Operator,
+		Impersonation: id,
+		Request:       request,
+	})
+}
+
+// End stops an impersonation, tells the session's consoles and returns it
+// as ended
+func End(ctx context.Context, hub *server.Hub, id, by string) (*Impersonation, error) {
+	mutex.Lock()
+	imp, ok := impersonations[id]
+	if !ok || imp.EndedAt != nil {
+		mutex.Unlock()
+		return nil, ErrNotFound
+	}
+	now := time.Now().UTC()
+	imp.EndedAt = &now
+	imp.EndedBy = by
+	delete(impersonations, id)
+	ended := *imp
+	mutex.Unlock()
+
+	server.ClearImpersonation(hub, ended.HD1ID, ended.notice())
+	record(ctx, &moderation.Entry{
+		World:         ended.World,
+		Action:        moderation.ActionImpersonateEnd,
+		HD1ID:         ended.HD1ID,
+		Reason:        ended.Reason,
+		Moderator:     by,
+		Impersonation: id,
+	})
+	logging.Warn("impersonation ended", map[string]interface{}{
+		"impersonation_id": id,
+		"hd1_id":           ended.HD1ID,
+		"operator":         ended.Operator,
+		"ended_by":         by,
+		"requests":         ended.Requests,
+	})
+	return &ended, nil
+}
+
+// List returns the active impersonations, oldest first
+func List() []*Impersonation {
+	now := time.Now()
+	mutex.Lock()
+	result := []*Impersonation{}
+	for _, imp := range impersonations {
+		if imp.Active(now) {
+			copied := *imp
+			result = append(result, &copied)
+		}
+	}
+	mutex.Unlock()
+
+	sort.Slice(result, func(i, j int) bool { return result[i].StartedAt.Before(result[j].StartedAt) })
+	return result
+}
+
+// Run ends impersonations whose time is up until ctx ends. Lookup refuses
+// their tokens from the moment they expire; this takes the banner down and
+// records the end.
+func Run(ctx context.Context, hub *server.Hub) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, id := range due(now) {
+				End(ctx, hub, id, EndedByTimeLimit)
+			}
+		}
+	}
+}
+
+// due returns the impersonations whose time is up
+func due(now time.Time) []string {
+	mutex.Lock()
+	defer mutex.Unlock()
+	var ids []string
+	for id, imp := range impersonations {
+		if imp.EndedAt == nil && !now.Before(imp.ExpiresAt) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// record appends to the audit log; the action already took effect, so a
+// failure is logged rather than returned
+func record(ctx context.Context, entry *moderation.Entry) {
+	if err := moderation.Record(ctx, entry); err != nil {
+		logging.Error("failed to record impersonation audit entry", map[string]interface{}{
+			"world":            entry.World,
+			"action":           entry.Action,
+			"impersonation_id": entry.Impersonation,
+			"error":            err.Error(),
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+)
+
+// glTF constants
+const (
+	glbMagic        = 0x46546C67 // "glTF"
+	chunkJSON       = 0x4E4F534A
+	chunkBIN        = 0x004E4942
+	componentFloat  = 5126
+	componentUint32 = 5125
+	targetArray     = 34962
+	targetIndices   = 34963
+)
+
+// defaultColour paints parts whose material has no colour
+var defaultColour = [4]float64{0.8, 0.8, 0.8, 1}
+
+// EncodeGLB writes a part as a binary glTF model with one mesh, its
+// vertices offset by -origin so the model sits around its own origin
+func EncodeGLB(p *Part, origin [3]float64, colour [4]float64) []byte {
+	var bin bytes.Buffer
+	min := [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+	max := [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	for _, v := range p.Positions {
+		for i := range v {
+			component := float32(v[i] - origin[i])
+			binary.Write(&bin, binary.LittleEndian, component)
+			min[i] = math.Min(min[i], float64(component))
+			max[i] = math.Max(max[i], float64(component))
+		}
+	}
+	positionsLength := bin.Len()
+	for _, n := range p.Normals {
+		length := math.Sqrt(n[0]*n[0] + n[1]*n[1] + n[2]*n[2])
+		if length == 0 {
+			length = 1
+		}
+		for i := range n {
+			binary.Write(&bin, binary.LittleEndian, float32(n[i]/length))
+		}
+	}
+	normalsLength := bin.Len() - positionsLength
+	binary.Write(&bin, binary.LittleEndian, p.Indices)
+	indicesLength := bin.Len() - positionsLength - normalsLength
+
+	count := len(p.Positions)
+	attributes := map[string]int{"POSITION": 0}
+	bufferViews := []map[string]interface{}{
+		{"buffer": 0, "byteOffset": 0, "byteLength": positionsLength, "target": targetArray},
+	}
+	accessors := []map[string]interface{}{
+		{"bufferView": 0, "componentType": componentFloat, "count": count, "type": "VEC3", "min": min[:], "max": max[:]},
+	}
+	if normalsLength > 0 {
+		attributes["NORMAL"] = len(accessors)
+		bufferViews = append(bufferViews, map[string]interface{}{"buffer": 0, "byteOffset": positionsLength, "byteLength": normalsLength, "target": targetArray})
+		accessors = append(accessors, map[string]interface{}{"bufferView": len(bufferViews) - 1, "componentType": componentFloat, "count": count, "type": "VEC3"})
+	}
+	bufferViews = append(bufferViews, map[string]interface{}{"buffer": 0, "byteOffset": positionsLength + normalsLength, "byteLength": indicesLength, "target": targetIndices})
+	accessors = append(accessors, map[string]interface{}{"bufferView": len(bufferViews) - 1, "componentType": componentUint32, "count": len(p.Indices), "type": "SCALAR"})
+
+	material := map[string]interface{}{
+		"pbrMetallicRoughness": map[string]interface{}{
+			"baseColorFactor": colour[:],
+			"metallicFactor":  0,
+			"roughnessFactor": 0.9,
+		},
+		"doubleSided": true,
+	}
+	if len(p.Materials) > 0 {
+		material["name"] = p.Materials[0]
+	}
+	if colour[3] < 1 {
+		material["alphaMode"] = "BLEND"
+	}
+	document := map[string]interface{}{
+		"asset":  map[string]interface{}{"version": "2.0", "generator": "HD1 importer"},
+		"scene":  0,
+		"scenes": []interface{}{map[string]interface{}{"nodes": []int{0}}},
+		"nodes":  []interface{}{map[string]interface{}{"mesh": 0, "name": p.Name}},
+		"meshes": []interface{}{map[string]interface{}{
+			"name":       p.Name,
+			"primitives": []interface{}{map[string]interface{}{"attributes": attributes, "indices": len(accessors) - 1, "material": 0}},
+		}},
+		"materials":   []interface{}{material},
+		"buffers":     []interface{}{map[string]interface{}{"byteLength": bin.Len()}},
+		"bufferViews": bufferViews,
+		"accessors":   accessors,
+	}
+	encoded, _ := json.Marshal(document)
+	for len(encoded)%4 != 0 {
+		encoded = append(encoded, ' ')
+	}
+
+	// Float32 and uint32 data keep the binary chunk 4-byte aligned
+	var glb bytes.Buffer
+	binary.Write(&glb, binary.LittleEndian, []uint32{glbMagic, 2, uint32(12 + 8 + len(encoded) + 8 + bin.Len())})
+	binary.Write(&glb, binary.LittleEndian, []uint32{uint32(len(encoded)), chunkJSON})
+	glb.Write(encoded)
+	binary.Write(&glb, binary.LittleEndian, []uint32{uint32(bin.Len()), chunkBIN})
+	glb.Write(bin.Bytes())
+	return glb.Bytes()
+}
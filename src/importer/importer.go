@@ -0,0 +1,502 @@
+// Package importer brings building and CAD models into worlds as entities.
+//
+// An import reads a source file already uploaded to the asset store. OBJ
+// files are read directly; IFC, STEP, FBX and the other formats assimp
+// understands are first converted to OBJ with the configured assimp
+// executable. Every group of the model becomes an entity with its own GLB
+// model asset, placed at the group's centre; the model's objects, and the
+// import itself, become entities without geometry. Entities have no
+// transform hierarchy, so the hierarchy is kept in metadata: each entity
+// names its parent there, with its name, materials and import. Source
+// coordinates are read in the world's units and up axis, or a space given
+// with the import, and converted to HD1's.
+//
+// Imports run as background jobs whose stage and progress can be polled.
+// The entities are committed as one transaction, so a world never shows
+// half a model. Jobs live in memory for an hour after they finish.
+package importer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"holodeck1/assets"
+	"holodeck1/config"
+	"holodeck1/entityid"
+	"holodeck1/logging"
+	"holodeck1/storage"
+	hd1sync "holodeck1/sync"
+	"holodeck1/units"
+	"holodeck1/usage"
+)
+
+// Job statuses
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+// Stages of a running job
+const (
+	StageFetching   = "fetching"
+	StageConverting = "converting"
+	StageParsing    = "parsing"
+	StageBuilding   = "building"
+	StageCreating   = "creating"
+)
+
+// FormatOBJ is read directly; other formats go through assimp
+const FormatOBJ = "obj"
+
+// converted are the formats assimp converts to OBJ for import
+var converted = map[string]bool{
+	"ifc": true, "step": true, "stp": true, "fbx": true, "dae": true,
+	"3ds": true, "stl": true, "ply": true,
+}
+
+// Limits of an import
+const (
+	MaxNameLength = 200
+	retention     = time.Hour // Finished jobs are kept this long
+)
+
+var (
+	// ErrNotFound is returned for unknown and expired jobs
+	ErrNotFound = errors.New("import not found")
+	// ErrBusy is returned when the job queue is full
+	ErrBusy = errors.New("import queue full, try again later")
+	// ErrUnavailable is returned when the importer is not running, or a
+	// format's converter is not installed
+	ErrUnavailable = errors.New("importer unavailable")
+)
+
+// Log is the operation log imports read the world's space from and commit
+// their entities to
+type Log interface {
+	GetAllOperations() []*hd1sync.Operation
+	SubmitOperation(op *hd1sync.Operation)
+}
+
+// Job is one model import
+type Job struct {
+	ID         string       `json:"id"`
+	World      string       `json:"world"`
+	Name       string       `json:"name"`
+	Format     string       `json:"format"`
+	Source     string       `json:"source"` // sha256:<digest> of the uploaded file
+	Position   [3]float64   `json:"-"`
+	Space      *units.Space `json:"space,omitempty"` // Source space, the world's when nil
+	Status     string       `json:"status"`
+	Stage      string       `json:"stage,omitempty"`
+	Progress   float64      `json:"progress"` // 0-1
+	RootID     string       `json:"root_id,omitempty"`
+	Entities   int          `json:"entities"`
+	Triangles  int          `json:"triangles"`
+	SeqNum     uint64       `json:"seq_num,omitempty"` // The transaction that created them
+	Error      string       `json:"error,omitempty"`
+	CreatedBy  string       `json:"created_by"`
+	CreatedAt  time.Time    `json:"created_at"`
+	FinishedAt *time.Time   `json:"finished_at,omitempty"`
+}
+
+var (
+	jobs  = make(map[string]*Job)
+	queue chan *Job
+	log   Log
+	mutex sync.Mutex
+)
+
+// CheckFormat reports whether a format can be imported on this server
+func CheckFormat(format string) error {
+	if format == FormatOBJ {
+		return nil
+	}
+	if !converted[format] {
+		names := []string{FormatOBJ}
+		for name := range converted {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unsupported format %q (%v)", format, names)
+	}
+	if _, err := exec.LookPath(config.GetImportsTool()); err != nil {
+		return fmt.Errorf("%w: %s imports need %s, which is not installed", ErrUnavailable, format, config.GetImportsTool())
+	}
+	return nil
+}
+
+// Start launches the import workers, committing to the log, until ctx ends
+func Start(ctx context.Context, operations Log) {
+	workers := config.GetImportsWorkers()
+	mutex.Lock()
+	log = operations
+	queue = make(chan *Job, 64)
+	mutex.Unlock()
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-queue:
+					run(ctx, job)
+				}
+			}
+		}()
+	}
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				sweep(now)
+			}
+		}
+	}()
+
+	logging.Info("importer started", map[string]interface{}{
+		"workers": workers,
+		"tool":    config.GetImportsTool(),
+	})
+}
+
+// Submit queues an import. The job must name its world, format, source and
+// creator; it is returned as queued.
+func Submit(job *Job) (*Job, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if queue == nil {
+		return nil, ErrUnavailable
+	}
+	job.ID = "imp-" + uuid.New().String()
+	job.Status = StatusQueued
+	job.CreatedAt = time.Now().UTC()
+	select {
+	case queue <- job:
+	default:
+		return nil, ErrBusy
+	}
+	jobs[job.ID] = job
+
+	logging.Info("import queued", map[string]interface{}{
+		"import_id": job.ID,
+		"world":     job.World,
+		"format":    job.Format,
+		"source":    job.Source,
+		"by":        job.CreatedBy,
+	})
+	return job.copy(), nil
+}
+
+// Get returns a copy of a world's job
+func Get(world, id string) (*Job, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	job, ok := jobs[id]
+	if !ok || job.World != world {
+		return nil, ErrNotFound
+	}
+	return job.copy(), nil
+}
+
+// List returns copies of a world's jobs, newest first
+func List(world string) []*Job {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	list := []*Job{}
+	for _, job := range jobs {
+		if job.World == world {
+			list = append(list, job.copy())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// sweep forgets jobs finished longer than the retention ago
+func sweep(now time.Time) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	for id, job := range jobs {
+		if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > retention {
+			delete(jobs, id)
+		}
+	}
+}
+
+func (j *Job) copy() *Job {
+	copied := *j
+	return &copied
+}
+
+// advance records a job's stage and progress
+func advance(job *Job, stage string, progress float64) {
+	mutex.Lock()
+	job.Status = StatusRunning
+	job.Stage = stage
+	job.Progress = progress
+	mutex.Unlock()
+}
+
+// finish records the outcome of a job
+func finish(job *Job, err error) {
+	mutex.Lock()
+	now := time.Now().UTC()
+	job.FinishedAt = &now
+	job.Stage = ""
+	if err != nil {
+		job.Status = StatusFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = StatusDone
+		job.Progress = 1
+	}
+	mutex.Unlock()
+
+	fields := map[string]interface{}{
+		"import_id": job.ID,
+		"world":     job.World,
+		"entities":  job.Entities,
+		"triangles": job.Triangles,
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+		logging.Warn("import failed", fields)
+		return
+	}
+	fields["seq_num"] = job.SeqNum
+	logging.Info("import completed", fields)
+}
+
+// run carries out one import
+func run(ctx context.Context, job *Job) {
+	dir, err := os.MkdirTemp("", "hd1-import-")
+	if err != nil {
+		finish(job, err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	finish(job, importModel(ctx, job, dir))
+}
+
+func importModel(ctx context.Context, job *Job, dir string) error {
+	backend := storage.Default()
+	if backend == nil {
+		return fmt.Errorf("storage backend unavailable")
+	}
+
+	advance(job, StageFetching, 0.05)
+	source := filepath.Join(dir, "source."+job.Format)
+	if err := fetch(ctx, backend, job.Source, source); err != nil {
+		return fmt.Errorf("reading source: %v", err)
+	}
+
+	obj := source
+	if job.Format != FormatOBJ {
+		advance(job, StageConverting, 0.1)
+		obj = filepath.Join(dir, "converted.obj")
+		if err := convert(ctx, source, obj); err != nil {
+			return err
+		}
+	}
+
+	advance(job, StageParsing, 0.3)
+	file, err := os.Open(obj)
+	if err != nil {
+		return err
+	}
+	parts, err := ParseOBJ(file)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("reading model: %v", err)
+	}
+	colours := parseMTL(filepath.Join(dir, "converted.mtl"))
+
+	objects := []string{}
+	for _, part := range parts {
+		if part.Object != "" && !contains(objects, part.Object) {
+			objects = append(objects, part.Object)
+		}
+	}
+	total := 1 + len(objects) + len(parts)
+	if total > config.GetImportsMaxEntities() {
+		return fmt.Errorf("model has %d parts, more than the %d entities an import may create", total, config.GetImportsMaxEntities())
+	}
+
+	// Each part becomes a model around its own centre
+	advance(job, StageBuilding, 0.4)
+	models := make([]string, len(parts))
+	centres := make([][3]float64, len(parts))
+	triangles := 0
+	for i, part := range parts {
+		min, max := part.Bounds()
+		centres[i] = [3]float64{(min[0] + max[0]) / 2, (min[1] + max[1]) / 2, (min[2] + max[2]) / 2}
+		colour := defaultColour
+		if len(part.Materials) > 0 {
+			if known, ok := colours[part.Materials[0]]; ok {
+				colour = known
+			}
+		}
+		glb := EncodeGLB(part, centres[i], colour)
+		blob, _, err := assets.Put(ctx, backend, bytes.NewReader(glb), config.GetAssetsMaxUploadSize(), "model/gltf-binary")
+		if err != nil {
+			return fmt.Errorf("storing part %q: %v", part.Name, err)
+		}
+		models[i] = blob.Ref
+		triangles += part.Triangles()
+		advance(job, StageBuilding, 0.4+0.5*float64(i+1)/float64(len(parts)))
+	}
+
+	advance(job, StageCreating, 0.9)
+	mutex.Lock()
+	operations := log
+	mutex.Unlock()
+	space := job.Space
+	if space == nil {
+		space = units.FromLog(operations.GetAllOperations())
+	}
+	ops, ids, err := entities(job, space, objects, parts, centres, models)
+	if err != nil {
+		return err
+	}
+	transaction := hd1sync.NewTransaction(job.CreatedBy, job.ID, ops)
+	operations.SubmitOperation(transaction)
+
+	mutex.Lock()
+	job.RootID = ids[0]
+	job.Entities = len(ids)
+	job.Triangles = triangles
+	job.SeqNum = transaction.SeqNum
+	mutex.Unlock()
+	return nil
+}
+
+// entities builds the creates of an import: its root, its objects and its
+// parts, returning their IDs root first
+func entities(job *Job, space *units.Space, objects []string, parts []*Part, centres [][3]float64, models []string) ([]*hd1sync.Operation, []string, error) {
+	var ops []*hd1sync.Operation
+	var ids []string
+	create := func(data map[string]interface{}) error {
+		id, _, err := entityid.Allocate("", job.CreatedBy)
+		if err != nil {
+			for _, claimed := range ids {
+				entityid.Release(claimed)
+			}
+			return fmt.Errorf("issuing entity IDs: %v", err)
+		}
+		if err := usage.Admit(id); err != nil {
+			entityid.Release(id)
+			for _, claimed := range ids {
+				entityid.Release(claimed)
+			}
+			usage.Release(ids...)
+			return err
+		}
+		data["id"] = id
+		ids = append(ids, id)
+		ops = append(ops, &hd1sync.Operation{ClientID: job.CreatedBy, Type: hd1sync.OpEntityCreate, Data: data})
+		return nil
+	}
+	at := func(offset [3]float64) map[string]interface{} {
+		return map[string]interface{}{"x": job.Position[0] + offset[0], "y": job.Position[1] + offset[1], "z": job.Position[2] + offset[2]}
+	}
+
+	err := create(map[string]interface{}{
+		"position": at([3]float64{}),
+		"metadata": map[string]interface{}{"name": job.Name, "import_id": job.ID, "format": job.Format, "source": job.Source},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	rootID := ids[0]
+	parents := make(map[string]string, len(objects))
+	for _, object := range objects {
+		err := create(map[string]interface{}{
+			"position": at([3]float64{}),
+			"metadata": map[string]interface{}{"name": object, "import_id": job.ID, "parent": rootID},
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		parents[object] = ids[len(ids)-1]
+	}
+	for i, part := range parts {
+		data := space.Import(map[string]interface{}{
+			"model":    models[i],
+			"position": map[string]interface{}{"x": centres[i][0], "y": centres[i][1], "z": centres[i][2]},
+		})
+		position := data["position"].(map[string]interface{})
+		data["position"] = at([3]float64{position["x"].(float64), position["y"].(float64), position["z"].(float64)})
+		parent, ok := parents[part.Object]
+		if !ok {
+			parent = rootID
+		}
+		metadata := map[string]interface{}{"name": part.Name, "import_id": job.ID, "parent": parent, "triangles": part.Triangles()}
+		if len(part.Materials) > 0 {
+			metadata["materials"] = part.Materials
+		}
+		data["metadata"] = metadata
+		if err := create(data); err != nil {
+			return nil, nil, err
+		}
+	}
+	return ops, ids, nil
+}
+
+// fetch copies an asset blob to a file
+func fetch(ctx context.Context, backend storage.Backend, ref, target string) error {
+	key, err := assets.BlobKey(ref[len(assets.RefPrefix):])
+	if err != nil {
+		return err
+	}
+	body, _, err := backend.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	file, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(file, body)
+	return err
+}
+
+// convert runs assimp: <tool> export <in> <out.obj>, which also writes the
+// material library beside the output
+func convert(ctx context.Context, input, output string) error {
+	ctx, cancel := context.WithTimeout(ctx, config.GetImportsTimeout())
+	defer cancel()
+	out, err := exec.CommandContext(ctx, config.GetImportsTool(), "export", input, output).CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("conversion timed out after %s", config.GetImportsTimeout())
+	}
+	if err != nil {
+		tail := string(out)
+		if len(tail) > 500 {
+			tail = tail[len(tail)-500:]
+		}
+		return fmt.Errorf("conversion failed: %v: %s", err, tail)
+	}
+	return nil
+}
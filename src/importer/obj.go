@@ -0,0 +1,267 @@
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Part is one mesh of a model: the faces of an OBJ group within an object
+type Part struct {
+	Object    string // Object (o) it belongs to, empty when the file has none
+	Name      string // Group (g) name, else the object's
+	Materials []string
+	Positions [][3]float64 // Vertices as read, in the source space
+	Normals   [][3]float64 // Per vertex, or none when the faces lack them
+	Indices   []uint32     // Triangles
+}
+
+// Bounds returns the corners of the part's bounding box
+func (p *Part) Bounds() (min, max [3]float64) {
+	min = [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+	max = [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	for _, v := range p.Positions {
+		for i := range v {
+			min[i] = math.Min(min[i], v[i])
+			max[i] = math.Max(max[i], v[i])
+		}
+	}
+	return min, max
+}
+
+// Triangles returns how many triangles the part has
+func (p *Part) Triangles() int {
+	return len(p.Indices) / 3
+}
+
+// corner is a face corner: position and normal indices into the file's
+// lists, normal -1 when absent
+type corner struct {
+	position, normal int
+}
+
+// partBuilder collects a part's faces, sharing corners they have in common
+type partBuilder struct {
+	part    *Part
+	corners map[corner]uint32
+	normals bool
+}
+
+// ParseOBJ reads the triangle meshes of a Wavefront OBJ file, one part per
+// object and group, in the order they first appear. Polygons are
+// triangulated as fans; points, lines and texture coordinates are skipped.
+func ParseOBJ(r io.Reader) ([]*Part, error) {
+	var (
+		positions [][3]float64
+		normals   [][3]float64
+		builders  = make(map[string]*partBuilder)
+		order     []*partBuilder
+		object    string
+		group     string
+		material  string
+	)
+
+	current := func() *partBuilder {
+		key := object + "\x00" + group
+		b, ok := builders[key]
+		if !ok {
+			name := group
+			if name == "" {
+				name = object
+			}
+			b = &partBuilder{part: &Part{Object: object, Name: name}, corners: make(map[corner]uint32), normals: true}
+			builders[key] = b
+			order = append(order, b)
+		}
+		if material != "" && !contains(b.part.Materials, material) {
+			b.part.Materials = append(b.part.Materials, material)
+		}
+		return b
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		switch fields[0] {
+		case "v":
+			v, err := parseVector(fields[1:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			positions = append(positions, v)
+		case "vn":
+			v, err := parseVector(fields[1:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			normals = append(normals, v)
+		case "o":
+			object = strings.Join(fields[1:], " ")
+			group = ""
+		case "g":
+			group = strings.Join(fields[1:], " ")
+		case "usemtl":
+			material = strings.Join(fields[1:], " ")
+		case "f":
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("line %d: a face needs at least 3 vertices", line)
+			}
+			b := current()
+			corners := make([]corner, 0, len(fields)-1)
+			for _, field := range fields[1:] {
+				c, err := parseCorner(field, len(positions), len(normals))
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", line, err)
+				}
+				corners = append(corners, c)
+			}
+			for i := 1; i+1 < len(corners); i++ {
+				for _, c := range []corner{corners[0], corners[i], corners[i+1]} {
+					b.add(c, positions, normals)
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	parts := make([]*Part, 0, len(order))
+	for _, b := range order {
+		if len(b.part.Indices) == 0 {
+			continue
+		}
+		if !b.normals {
+			b.part.Normals = nil
+		}
+		parts = append(parts, b.part)
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("no faces found")
+	}
+	return parts, nil
+}
+
+// add appends a triangle corner, reusing the vertex of an equal one
+func (b *partBuilder) add(c corner, positions, normals [][3]float64) {
+	if index, ok := b.corners[c]; ok {
+		b.part.Indices = append(b.part.Indices, index)
+		return
+	}
+	index := uint32(len(b.part.Positions))
+	b.corners[c] = index
+	b.part.Positions = append(b.part.Positions, positions[c.position])
+	if c.normal < 0 {
+		b.normals = false
+		b.part.Normals = append(b.part.Normals, [3]float64{})
+	} else {
+		b.part.Normals = append(b.part.Normals, normals[c.normal])
+	}
+	b.part.Indices = append(b.part.Indices, index)
+}
+
+func parseVector(fields []string) ([3]float64, error) {
+	var v [3]float64
+	if len(fields) < 3 {
+		return v, fmt.Errorf("expected 3 coordinates")
+	}
+	for i := range v {
+		value, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return v, fmt.Errorf("invalid coordinate %q", fields[i])
+		}
+		v[i] = value
+	}
+	return v, nil
+}
+
+// parseCorner reads v, v/vt, v//vn or v/vt/vn; negative indices count back
+// from the latest vertex
+func parseCorner(field string, positions, normals int) (corner, error) {
+	refs := strings.Split(field, "/")
+	position, err := resolveIndex(refs[0], positions)
+	if err != nil {
+		return corner{}, err
+	}
+	c := corner{position: position, normal: -1}
+	if len(refs) == 3 && refs[2] != "" {
+		if c.normal, err = resolveIndex(refs[2], normals); err != nil {
+			return corner{}, err
+		}
+	}
+	return c, nil
+}
+
+func resolveIndex(ref string, count int) (int, error) {
+	index, err := strconv.Atoi(ref)
+	if err != nil || index == 0 {
+		return 0, fmt.Errorf("invalid index %q", ref)
+	}
+	if index < 0 {
+		index = count + index + 1
+	}
+	if index < 1 || index > count {
+		return 0, fmt.Errorf("index %s out of range", ref)
+	}
+	return index - 1, nil
+}
+
+// parseMTL reads the diffuse colours and opacity of an OBJ material
+// library, by material name. A missing library has no colours.
+func parseMTL(path string) map[string][4]float64 {
+	colours := make(map[string][4]float64)
+	file, err := os.Open(path)
+	if err != nil {
+		return colours
+	}
+	defer file.Close()
+
+	var name string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "newmtl":
+			name = strings.Join(fields[1:], " ")
+			colours[name] = [4]float64{0.8, 0.8, 0.8, 1}
+		case "Kd":
+			if v, err := parseVector(fields[1:]); err == nil && name != "" {
+				colour := colours[name]
+				colours[name] = [4]float64{clamp(v[0]), clamp(v[1]), clamp(v[2]), colour[3]}
+			}
+		case "d":
+			if opacity, err := strconv.ParseFloat(fields[1], 64); err == nil && name != "" {
+				colour := colours[name]
+				colour[3] = clamp(opacity)
+				colours[name] = colour
+			}
+		}
+	}
+	return colours
+}
+
+func clamp(value float64) float64 {
+	return math.Max(0, math.Min(1, value))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
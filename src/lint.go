@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"holodeck1/lint"
+)
+
+// run_world_lint prints the lint report of a live world: hd1 world lint
+// [WORLD] [--fail-on SEVERITY]. Exit status is 1 when a finding is at
+// least as severe as --fail-on, so it can gate publishing a world.
+func run_world_lint(args []string) int {
+	flags := flag.NewFlagSet("world lint", flag.ContinueOnError)
+	failOn := flags.String("fail-on", lint.SeverityError, "Exit 1 on findings at least this severe: info, warning or error")
+	severity := flags.String("severity", lint.SeverityInfo, "Least severe finding listed")
+	address := flags.String("address", "", "Server address (default: the first listener)")
+	profile := flags.String("profile", "", "Server profile (see hd1 login)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: hd1 world lint [WORLD] [--fail-on info|warning|error] [--severity info|warning|error] [--address host:port|unix:///path | --profile NAME]")
+	}
+	world, args := leading_argument(args)
+	if err := flags.Parse(args); err != nil || flags.NArg() > 1 || (world != "" && flags.NArg() != 0) ||
+		!lint.ValidSeverity(*failOn) || !lint.ValidSeverity(*severity) {
+		flags.Usage()
+		return exitUsage
+	}
+	if flags.NArg() == 1 {
+		world = flags.Arg(0)
+	}
+	target, ok := transfer_target("world lint", *address, *profile)
+	if !ok {
+		return exitUsage
+	}
+	if world == "" {
+		world = target.world
+	}
+
+	response, err := target.client.Get(target.base + "/api/worlds/" + url.PathEscape(world) + "/lint?severity=" + *severity)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "world lint: %v\n", err)
+		return exitFailed
+	}
+	body, err := read_transfer_response(response, http.StatusOK)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "world lint: %v\n", err)
+		return exitFailed
+	}
+	var answer struct {
+		Lint lint.Report `json:"lint"`
+	}
+	if err := json.Unmarshal(body, &answer); err != nil {
+		fmt.Fprintf(os.Stderr, "world lint: %v\n", err)
+		return exitFailed
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(answer.Lint)
+
+	for level, count := range answer.Lint.Counts {
+		if count > 0 && lint.AtLeast(level, *failOn) {
+			return exitFailed
+		}
+	}
+	return exitOK
+}
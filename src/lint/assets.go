@@ -0,0 +1,239 @@
+package lint
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"  // Texture dimensions
+	_ "image/jpeg" // Texture dimensions
+	_ "image/png"  // Texture dimensions
+	"io"
+	"regexp"
+	"sync"
+
+	"holodeck1/assets"
+	"holodeck1/storage"
+)
+
+// ErrMissing is returned for assets the store does not hold
+var ErrMissing = errors.New("asset not found")
+
+// ErrQuarantined is returned for assets held in quarantine
+var ErrQuarantined = errors.New("asset quarantined")
+
+// maxModelRead bounds the bytes of a model read for its embedded textures;
+// larger models are read as far as their glTF JSON
+const maxModelRead = 64 << 20
+
+// glTF constants
+const (
+	glbMagic       = "glTF"
+	chunkJSON      = 0x4E4F534A
+	chunkBIN       = 0x004E4942
+	modeTriangles  = 4
+	maxJSONChunk   = 16 << 20
+	glbHeaderBytes = 12
+)
+
+var digestPattern = regexp.MustCompile(`(?:sha256:|/assets/)([0-9a-f]{64})`)
+
+// digestOf returns the digest of an asset reference in the store
+func digestOf(ref string) (string, bool) {
+	match := digestPattern.FindStringSubmatch(ref)
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// AssetInfo is what lint knows of an asset
+type AssetInfo struct {
+	Size       int64 `json:"size"`
+	Model      bool  `json:"model"`
+	Triangles  int   `json:"triangles,omitempty"`   // Of the most detailed level
+	Primitives int   `json:"primitives,omitempty"`  // Draw calls of one instance
+	LOD        bool  `json:"lod,omitempty"`         // Has levels of detail (MSFT_lod)
+	MaxTexture int   `json:"max_texture,omitempty"` // Longest side of an embedded texture, px
+	Width      int   `json:"width,omitempty"`       // Of an image
+	Height     int   `json:"height,omitempty"`
+	Optimized  bool  `json:"optimized,omitempty"` // The pipeline made variants
+}
+
+// inspected keeps what was read of each asset; assets never change
+var inspected = struct {
+	mutex  sync.RWMutex
+	assets map[string]AssetInfo
+}{assets: map[string]AssetInfo{}}
+
+// Inspect reads what lint needs of a stored asset
+func Inspect(ctx context.Context, digest string) (*AssetInfo, error) {
+	backend := storage.Default()
+	if backend == nil {
+		return nil, errors.New("storage backend unavailable")
+	}
+	if record, _ := assets.LoadQuarantine(ctx, backend, digest); record != nil {
+		return nil, ErrQuarantined
+	}
+
+	inspected.mutex.RLock()
+	info, known := inspected.assets[digest]
+	inspected.mutex.RUnlock()
+	if !known {
+		read, err := read(ctx, backend, digest)
+		if err != nil {
+			return nil, err
+		}
+		info = *read
+		inspected.mutex.Lock()
+		inspected.assets[digest] = info
+		inspected.mutex.Unlock()
+	}
+
+	if info.Model {
+		manifest, _ := assets.LoadManifest(ctx, backend, digest)
+		info.Optimized = manifest != nil && manifest.Status == assets.StatusReady && len(manifest.Variants) > 0
+	}
+	return &info, nil
+}
+
+func read(ctx context.Context, backend storage.Backend, digest string) (*AssetInfo, error) {
+	key, err := assets.BlobKey(digest)
+	if err != nil {
+		return nil, err
+	}
+	body, object, err := backend.Get(ctx, key)
+	if err == storage.ErrNotFound {
+		return nil, ErrMissing
+	} else if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	header := make([]byte, glbHeaderBytes)
+	n, err := io.ReadFull(body, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	info := &AssetInfo{Size: object.Size}
+	rest := io.MultiReader(bytes.NewReader(header[:n]), body)
+	if n == glbHeaderBytes && string(header[:4]) == glbMagic {
+		info.Model = true
+		return info, readGLB(io.LimitReader(body, maxModelRead), info)
+	}
+	config, _, err := image.DecodeConfig(rest)
+	if err != nil {
+		return info, nil // Neither a model nor an image lint reads, such as WebP
+	}
+	info.Width, info.Height = config.Width, config.Height
+	return info, nil
+}
+
+// gltf is the part of a glTF document lint reads
+type gltf struct {
+	ExtensionsUsed []string `json:"extensionsUsed"`
+	Meshes         []struct {
+		Primitives []struct {
+			Attributes map[string]int `json:"attributes"`
+			Indices    *int           `json:"indices"`
+			Mode       *int           `json:"mode"`
+		} `json:"primitives"`
+	} `json:"meshes"`
+	Nodes []struct {
+		Mesh *int `json:"mesh"`
+	} `json:"nodes"`
+	Accessors []struct {
+		Count int `json:"count"`
+	} `json:"accessors"`
+	Images []struct {
+		BufferView *int `json:"bufferView"`
+	} `json:"images"`
+	BufferViews []struct {
+		Buffer     int `json:"buffer"`
+		ByteOffset int `json:"byteOffset"`
+		ByteLength int `json:"byteLength"`
+	} `json:"bufferViews"`
+}
+
+// readGLB reads a binary glTF after its header: triangles and primitives
+// of every mesh instance, whether it has levels of detail, and the size of
+// its embedded textures
+func readGLB(body io.Reader, info *AssetInfo) error {
+	var chunk [8]byte
+	if _, err := io.ReadFull(body, chunk[:]); err != nil {
+		return fmt.Errorf("glTF: %v", err)
+	}
+	length, kind := binary.LittleEndian.Uint32(chunk[:4]), binary.LittleEndian.Uint32(chunk[4:])
+	if kind != chunkJSON || length > maxJSONChunk {
+		return errors.New("glTF: no JSON chunk")
+	}
+	raw := make([]byte, length)
+	if _, err := io.ReadFull(body, raw); err != nil {
+		return fmt.Errorf("glTF: %v", err)
+	}
+	var document gltf
+	if err := json.Unmarshal(raw, &document); err != nil {
+		return fmt.Errorf("glTF: %v", err)
+	}
+
+	for _, extension := range document.ExtensionsUsed {
+		if extension == "MSFT_lod" {
+			info.LOD = true
+		}
+	}
+	// Meshes count once for every node drawing them; one no node draws
+	// counts once
+	instances := make([]int, len(document.Meshes))
+	for _, node := range document.Nodes {
+		if node.Mesh != nil && *node.Mesh >= 0 && *node.Mesh < len(instances) {
+			instances[*node.Mesh]++
+		}
+	}
+	for i, mesh := range document.Meshes {
+		count := max(instances[i], 1)
+		for _, primitive := range mesh.Primitives {
+			info.Primitives += count
+			if primitive.Mode != nil && *primitive.Mode != modeTriangles {
+				continue
+			}
+			vertices := -1
+			if primitive.Indices != nil {
+				vertices = accessorCount(&document, *primitive.Indices)
+			} else if position, ok := primitive.Attributes["POSITION"]; ok {
+				vertices = accessorCount(&document, position)
+			}
+			if vertices > 0 {
+				info.Triangles += vertices / 3 * count
+			}
+		}
+	}
+
+	// Embedded textures are in the binary chunk, after the JSON
+	if _, err := io.ReadFull(body, chunk[:]); err != nil || binary.LittleEndian.Uint32(chunk[4:]) != chunkBIN {
+		return nil
+	}
+	bin, _ := io.ReadAll(io.LimitReader(body, int64(binary.LittleEndian.Uint32(chunk[:4]))))
+	for _, img := range document.Images {
+		if img.BufferView == nil || *img.BufferView < 0 || *img.BufferView >= len(document.BufferViews) {
+			continue
+		}
+		view := document.BufferViews[*img.BufferView]
+		if view.Buffer != 0 || view.ByteOffset < 0 || view.ByteLength < 0 || view.ByteOffset+view.ByteLength > len(bin) {
+			continue
+		}
+		if config, _, err := image.DecodeConfig(bytes.NewReader(bin[view.ByteOffset : view.ByteOffset+view.ByteLength])); err == nil {
+			info.MaxTexture = max(info.MaxTexture, config.Width, config.Height)
+		}
+	}
+	return nil
+}
+
+func accessorCount(document *gltf, index int) int {
+	if index < 0 || index >= len(document.Accessors) {
+		return -1
+	}
+	return document.Accessors[index].Count
+}
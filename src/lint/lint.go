@@ -0,0 +1,411 @@
+// Package lint checks a world for what makes it slow or broken to render,
+// so creators can fix it before people visit: more draw calls than
+// clients manage, textures larger than they can use, entities stacked on
+// one another, dense models without levels of detail, and references to
+// assets the store does not hold.
+//
+// Each finding has a severity, names the entities and asset it concerns
+// and says what to do about it. The world is read from its state; models
+// and textures are read from the asset store, as much of them as it takes
+// to learn their triangles, draw calls and dimensions, and what is learnt
+// is kept, since assets are content-addressed and never change.
+package lint
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"holodeck1/assets"
+	"holodeck1/config"
+	"holodeck1/throttle"
+	"holodeck1/worlds"
+)
+
+// Severities, least severe first
+const (
+	SeverityInfo    = "info"
+	SeverityWarning = "warning"
+	SeverityError   = "error"
+)
+
+// Finding codes
+const (
+	CodeDrawCalls        = "draw_calls"
+	CodeOversizedTexture = "oversized_texture"
+	CodeOverlapping      = "overlapping_entities"
+	CodeMissingLOD       = "missing_lod"
+	CodeDenseGeometry    = "dense_geometry"
+	CodeUnoptimizedModel = "unoptimized_model"
+	CodeMissingAsset     = "missing_asset"
+	CodeQuarantinedAsset = "quarantined_asset"
+	CodeUnreadableAsset  = "unreadable_asset"
+)
+
+// Thresholds findings are raised at. Textures are held to the texture
+// caps of the client tiers.
+const (
+	DrawCallsWarning     = 300  // What low tier clients draw at a usable frame rate
+	DrawCallsError       = 1000 // What desktop clients draw at a usable frame rate
+	LODTriangles         = 100000
+	LODTrianglesError    = 1000000
+	UnoptimizedModelSize = 5 << 20 // Bytes
+	DenseTriangles       = 20000   // Of one geometry primitive
+)
+
+// maxEntitiesInFinding bounds the entity IDs a finding lists
+const maxEntitiesInFinding = 20
+
+// overlapPrecision is how close positions must be to coincide: a
+// millimetre
+const overlapPrecision = 1000
+
+var severityRank = map[string]int{SeverityInfo: 0, SeverityWarning: 1, SeverityError: 2}
+
+// ValidSeverity reports whether s names a severity
+func ValidSeverity(s string) bool {
+	_, ok := severityRank[s]
+	return ok
+}
+
+// AtLeast reports whether severity is at least min
+func AtLeast(severity, min string) bool {
+	return severityRank[severity] >= severityRank[min]
+}
+
+// Finding is one problem of a world
+type Finding struct {
+	Code     string   `json:"code"`
+	Severity string   `json:"severity"`
+	Message  string   `json:"message"`
+	Advice   string   `json:"advice"`
+	Entities []string `json:"entities,omitempty"` // The first few concerned, by ID
+	Count    int      `json:"count,omitempty"`    // Entities concerned in all
+	Asset    string   `json:"asset,omitempty"`    // sha256:<digest>
+	Value    float64  `json:"value,omitempty"`    // What was measured
+	Limit    float64  `json:"limit,omitempty"`    // What it was held to
+}
+
+// Report is a world's findings, most severe first
+type Report struct {
+	World     string         `json:"world"`
+	SeqNum    uint64         `json:"seq_num"`
+	Entities  int            `json:"entities"`
+	DrawCalls int            `json:"draw_calls"` // Estimated, one per mesh primitive
+	Triangles int            `json:"triangles"`  // Estimated, of geometry and models
+	Counts    map[string]int `json:"counts"`     // Findings by severity
+	Findings  []*Finding     `json:"findings"`
+}
+
+// Run lints a world's state, reading the models and textures it uses
+// from the asset store
+func Run(ctx context.Context, world string, state *worlds.State) *Report {
+	l := &linter{
+		ctx: ctx,
+		report: &Report{
+			World:    world,
+			SeqNum:   state.SeqNum,
+			Counts:   map[string]int{SeverityError: 0, SeverityWarning: 0, SeverityInfo: 0},
+			Findings: []*Finding{},
+		},
+		models:   map[string][]string{},
+		textures: map[string][]string{},
+		meshes:   map[string][]string{},
+	}
+	ids := make([]string, 0, len(state.Entities))
+	for id := range state.Entities {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	l.report.Entities = len(ids)
+
+	for _, id := range ids {
+		l.entity(id, state.Entities[id])
+	}
+	l.assetFindings() // Models add their draw calls
+	l.drawCalls()
+	l.overlaps(ids, state.Entities)
+
+	sort.SliceStable(l.report.Findings, func(i, j int) bool {
+		a, b := l.report.Findings[i], l.report.Findings[j]
+		if severityRank[a.Severity] != severityRank[b.Severity] {
+			return severityRank[a.Severity] > severityRank[b.Severity]
+		}
+		return a.Code < b.Code
+	})
+	for _, finding := range l.report.Findings {
+		l.report.Counts[finding.Severity]++
+	}
+	return l.report
+}
+
+// linter gathers a world's findings as it walks its entities
+type linter struct {
+	ctx      context.Context
+	report   *Report
+	models   map[string][]string // Entities by model reference
+	textures map[string][]string // Entities by texture reference
+	meshes   map[string][]string // Entities by geometry and material, for batching advice
+	dense    []string            // Entities with geometry over DenseTriangles
+}
+
+func (l *linter) add(finding *Finding, entities []string) {
+	finding.Count = len(entities)
+	if len(entities) > maxEntitiesInFinding {
+		entities = entities[:maxEntitiesInFinding]
+	}
+	finding.Entities = entities
+	l.report.Findings = append(l.report.Findings, finding)
+}
+
+func (l *linter) entity(id string, entity map[string]interface{}) {
+	if visible, ok := entity["visible"].(bool); ok && !visible {
+		return
+	}
+	if model, _ := entity["model"].(string); model != "" {
+		l.models[model] = append(l.models[model], id)
+	}
+	material, _ := entity["material"].(map[string]interface{})
+	if texture, _ := material["map"].(string); texture != "" {
+		l.textures[texture] = append(l.textures[texture], id)
+	}
+	geometry, _ := entity["geometry"].(map[string]interface{})
+	if kind, _ := geometry["type"].(string); kind != "" {
+		l.report.DrawCalls++
+		l.meshes[meshKey(geometry, material)] = append(l.meshes[meshKey(geometry, material)], id)
+		triangles := throttle.Triangles(kind, geometry)
+		l.report.Triangles += triangles
+		if triangles > DenseTriangles {
+			l.dense = append(l.dense, id)
+		}
+	}
+}
+
+// meshKey identifies entities a renderer could draw as one instanced mesh
+func meshKey(geometry, material map[string]interface{}) string {
+	return fmt.Sprint(geometry) + "|" + fmt.Sprint(material)
+}
+
+// drawCalls reports a world drawing more meshes than clients manage, with
+// the geometry repeated most as the place to start batching
+func (l *linter) drawCalls() {
+	if len(l.dense) > 0 {
+		l.add(&Finding{
+			Code:     CodeDenseGeometry,
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("%d entities use geometry of more than %d triangles", len(l.dense), DenseTriangles),
+			Advice:   "Lower their segments; curved primitives rarely need more than 64 around, even up close",
+			Limit:    DenseTriangles,
+		}, l.dense)
+	}
+
+	calls := l.report.DrawCalls
+	severity := ""
+	switch {
+	case calls > DrawCallsError:
+		severity = SeverityError
+	case calls > DrawCallsWarning:
+		severity = SeverityWarning
+	default:
+		return
+	}
+	limit := DrawCallsWarning
+	if severity == SeverityError {
+		limit = DrawCallsError
+	}
+	finding := &Finding{
+		Code:     CodeDrawCalls,
+		Severity: severity,
+		Message:  fmt.Sprintf("The world takes about %d draw calls a frame", calls),
+		Advice:   "Merge static entities into models, remove hidden detail or split the world into chunks (HD1_CHUNKS_SIZE)",
+		Value:    float64(calls),
+		Limit:    float64(limit),
+	}
+	var repeated []string
+	for _, entities := range l.meshes {
+		if len(entities) > len(repeated) || len(entities) == len(repeated) && len(entities) > 0 && entities[0] < repeated[0] {
+			repeated = entities
+		}
+	}
+	if len(repeated) < 10 {
+		repeated = nil
+	} else {
+		finding.Advice = fmt.Sprintf("%d entities share one geometry and material and could be one model; %s", len(repeated), strings.ToLower(finding.Advice[:1])+finding.Advice[1:])
+	}
+	l.add(finding, repeated)
+}
+
+// overlaps reports entities drawn in the same place with the same shape,
+// which flicker where their surfaces fight and cost a draw call for nothing
+func (l *linter) overlaps(ids []string, entities map[string]map[string]interface{}) {
+	groups := map[string][]string{}
+	for _, id := range ids {
+		entity := entities[id]
+		geometry, hasGeometry := entity["geometry"].(map[string]interface{})
+		model, _ := entity["model"].(string)
+		if !hasGeometry && model == "" {
+			continue
+		}
+		if visible, ok := entity["visible"].(bool); ok && !visible {
+			continue
+		}
+		key := fmt.Sprint(geometry) + "|" + model
+		for _, field := range []string{"position", "rotation", "scale"} {
+			key += "|" + vectorKey(entity[field], field == "scale")
+		}
+		groups[key] = append(groups[key], id)
+	}
+	var overlapping [][]string
+	for _, group := range groups {
+		if len(group) > 1 {
+			overlapping = append(overlapping, group)
+		}
+	}
+	sort.Slice(overlapping, func(i, j int) bool { return overlapping[i][0] < overlapping[j][0] })
+	for _, group := range overlapping {
+		l.add(&Finding{
+			Code:     CodeOverlapping,
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("%d entities have the same shape, position, rotation and scale", len(group)),
+			Advice:   "Delete the duplicates, or move them apart; coincident surfaces flicker",
+		}, group)
+	}
+}
+
+// vectorKey rounds a stored vector to the overlap precision
+func vectorKey(value interface{}, scale bool) string {
+	vector, _ := value.(map[string]interface{})
+	key := ""
+	for _, axis := range []string{"x", "y", "z"} {
+		component, ok := vector[axis].(float64)
+		if !ok && scale {
+			component = 1
+		}
+		key += fmt.Sprintf("%d,", int64(math.Round(component*overlapPrecision)))
+	}
+	return key
+}
+
+// assetFindings reports the models and textures the world uses
+func (l *linter) assetFindings() {
+	refs := make([]string, 0, len(l.models))
+	for ref := range l.models {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	for _, ref := range refs {
+		entities := l.models[ref]
+		info, ok := l.asset(ref, entities)
+		if !ok {
+			l.report.DrawCalls += len(entities)
+			continue
+		}
+		l.report.DrawCalls += max(info.Primitives, 1) * len(entities)
+		l.report.Triangles += info.Triangles * len(entities)
+		if info.Triangles > LODTriangles && !info.LOD {
+			severity := SeverityWarning
+			if info.Triangles > LODTrianglesError {
+				severity = SeverityError
+			}
+			l.add(&Finding{
+				Code:     CodeMissingLOD,
+				Severity: severity,
+				Message:  fmt.Sprintf("Model has %d triangles and no levels of detail", info.Triangles),
+				Advice:   "Add simplified levels of detail (MSFT_lod), for example with gltf-transform simplify, or decimate the model",
+				Asset:    ref,
+				Value:    float64(info.Triangles),
+				Limit:    LODTriangles,
+			}, entities)
+		}
+		if info.Size > UnoptimizedModelSize && !info.Optimized {
+			l.add(&Finding{
+				Code:     CodeUnoptimizedModel,
+				Severity: SeverityInfo,
+				Message:  fmt.Sprintf("Model is %.1f MB and has no optimized variants", float64(info.Size)/(1<<20)),
+				Advice:   "Enable the optimization pipeline for the organization (PUT /api/assets/settings) and upload it again",
+				Asset:    ref,
+				Value:    float64(info.Size),
+				Limit:    UnoptimizedModelSize,
+			}, entities)
+		}
+		if info.MaxTexture > 0 {
+			l.texture(ref, info.MaxTexture, entities)
+		}
+	}
+
+	refs = refs[:0]
+	for ref := range l.textures {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	for _, ref := range refs {
+		if info, ok := l.asset(ref, l.textures[ref]); ok {
+			l.texture(ref, max(info.Width, info.Height), l.textures[ref])
+		}
+	}
+}
+
+// texture reports a texture larger than the clients of a tier can use
+func (l *linter) texture(ref string, side int, entities []string) {
+	high, standard := config.GetClientsHighTextureSize(), config.GetClientsStandardTextureSize()
+	severity, limit := "", 0
+	switch {
+	case side > high:
+		severity, limit = SeverityError, high
+	case side > standard:
+		severity, limit = SeverityWarning, standard
+	default:
+		return
+	}
+	l.add(&Finding{
+		Code:     CodeOversizedTexture,
+		Severity: severity,
+		Message:  fmt.Sprintf("Texture is %dpx, more than %dpx clients use", side, limit),
+		Advice:   fmt.Sprintf("Scale it to %dpx or less, or compress it to KTX2 with mipmaps", limit),
+		Asset:    ref,
+		Value:    float64(side),
+		Limit:    float64(limit),
+	}, entities)
+}
+
+// asset reads what lint needs of an asset, reporting one it cannot read
+func (l *linter) asset(ref string, entities []string) (*AssetInfo, bool) {
+	digest, ok := digestOf(ref)
+	if !ok {
+		return nil, false // Not in the store, such as a URL
+	}
+	ref = assets.RefPrefix + digest
+	info, err := Inspect(l.ctx, digest)
+	switch {
+	case err == ErrMissing:
+		l.add(&Finding{
+			Code:     CodeMissingAsset,
+			Severity: SeverityError,
+			Message:  "Asset is not in the asset store",
+			Advice:   "Upload it again (POST /api/assets) or point the entities at another asset",
+			Asset:    ref,
+		}, entities)
+		return nil, false
+	case err == ErrQuarantined:
+		l.add(&Finding{
+			Code:     CodeQuarantinedAsset,
+			Severity: SeverityError,
+			Message:  "Asset is quarantined and not served",
+			Advice:   "Have an operator review it (GET /api/assets/quarantine), or replace it",
+			Asset:    ref,
+		}, entities)
+		return nil, false
+	case err != nil:
+		l.add(&Finding{
+			Code:     CodeUnreadableAsset,
+			Severity: SeverityWarning,
+			Message:  "Asset could not be read: " + err.Error(),
+			Advice:   "Check it opens in a glTF or image viewer, and upload a fixed copy",
+			Asset:    ref,
+		}, entities)
+		return nil, false
+	}
+	return info, true
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"holodeck1/broadcast"
+	"holodeck1/config"
+	"holodeck1/hooks"
+	"holodeck1/logging"
+	"holodeck1/server"
+)
+
+// listen_address is a parsed listener: network "tcp" or "unix"
+type listen_address struct {
+	network string
+	address string
+}
+
+func (a listen_address) String() string {
+	return a.network + "://" + a.address
+}
+
+// parse_listen_address accepts host:port, :port, tcp://host:port,
+// unix:///path/to.sock and unix:relative.sock
+func parse_listen_address(spec string) (listen_address, error) {
+	spec = strings.TrimSpace(spec)
+	switch {
+	case spec == "":
+		return listen_address{}, fmt.Errorf("empty listener address")
+	case strings.HasPrefix(spec, "unix://"):
+		return listen_address{"unix", strings.TrimPrefix(spec, "unix://")}, nil
+	case strings.HasPrefix(spec, "unix:"):
+		return listen_address{"unix", strings.TrimPrefix(spec, "unix:")}, nil
+	case strings.HasPrefix(spec, "tcp://"):
+		spec = strings.TrimPrefix(spec, "tcp://")
+	case strings.Contains(spec, "://"):
+		return listen_address{}, fmt.Errorf("unsupported listener scheme: %s", spec)
+	}
+	if _, _, err := net.SplitHostPort(spec); err != nil {
+		return listen_address{}, fmt.Errorf("invalid listener address %q: %v", spec, err)
+	}
+	return listen_address{"tcp", spec}, nil
+}
+
+// open_listener binds one address. A Unix socket left behind by a crashed
+// process is replaced; one still accepting connections is not.
+func open_listener(address listen_address) (net.Listener, error) {
+	if address.network != "unix" {
+		return net.Listen(address.network, address.address)
+	}
+
+	if address.address == "" {
+		return nil, fmt.Errorf("unix listener needs a socket path")
+	}
+	if stat, err := os.Lstat(address.address); err == nil {
+		if stat.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", address.address)
+		}
+		if conn, err := net.DialTimeout("unix", address.address, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another process", address.address)
+		}
+		if err := os.Remove(address.address); err != nil {
+			return nil, err
+		}
+	}
+
+	mode, err := strconv.ParseUint(config.GetSocketMode(), 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket mode %q", config.GetSocketMode())
+	}
+	listener, err := net.Listen("unix", address.address)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(address.address, os.FileMode(mode)); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// serve_listeners binds every configured address up front, so a bad one
+// fails startup, then serves the default mux on all of them until one fails
+// or a required post_hub_start hook does.
+// With a TLS certificate, TCP listeners serve HTTPS and negotiate HTTP/2;
+// Unix sockets stay plain for a local proxy that terminates TLS.
+func serve_listeners() error {
+	var listeners []net.Listener
+	closeAll := func() {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}
+
+	tls := config.GetTLSCert() != ""
+	for _, spec := range config.GetListen() {
+		address, err := parse_listen_address(spec)
+		if err != nil {
+			closeAll()
+			return err
+		}
+		listener, err := open_listener(address)
+		if err != nil {
+			closeAll()
+			return fmt.Errorf("listen on %s: %v", address, err)
+		}
+		listeners = append(listeners, listener)
+
+		logging.Info("server listening", map[string]interface{}{
+			"network": address.network,
+			"address": address.address,
+			"tls":     tls && address.network == "tcp",
+		})
+	}
+
+	httpServer := &http.Server{Handler: server.Compress(http.DefaultServeMux)}
+	errs := make(chan error, len(listeners)+2)
+	go shutdown_on_signal(httpServer, errs)
+
+	// Readiness fails until the post_hub_start hooks are done, as they may
+	// provision what sessions need through the API
+	if hooks.Has(hooks.PostHubStart) {
+		server.SetStarting(true)
+		go func() {
+			if err := hooks.Run(context.Background(), hooks.PostHubStart); err != nil {
+				errs <- err
+				return
+			}
+			server.SetStarting(false)
+		}()
+	}
+	for _, listener := range listeners {
+		go func(listener net.Listener) {
+			var err error
+			if _, isTCP := listener.(*net.TCPListener); isTCP && tls {
+				err = httpServer.ServeTLS(listener, config.GetTLSCert(), config.GetTLSKey())
+			} else {
+				err = httpServer.Serve(listener)
+			}
+			if err != http.ErrServerClosed {
+				errs <- err // A shutdown reports through shutdown_on_signal
+			}
+		}(listener)
+	}
+	err := <-errs
+	httpServer.Close()
+	return err
+}
+
+// shutdown_on_signal stops the server on SIGTERM or SIGINT: readiness
+// fails, the pre_shutdown hooks run, then in-flight requests get what is
+// left of the shutdown timeout to finish.
+// A clean shutdown reports a nil error.
+func shutdown_on_signal(httpServer *http.Server, errs chan<- error) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	received := <-signals
+
+	server.Drain()
+	logging.Info("shutting down", map[string]interface{}{
+		"signal":  received.String(),
+		"timeout": config.GetShutdownTimeout().String(),
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetShutdownTimeout())
+	defer cancel()
+	hooks.Run(ctx, hooks.PreShutdown) // Failures are logged; the server stops regardless
+	broadcast.Shutdown()              // Render clients are children of the server
+	if err := httpServer.Shutdown(ctx); err != nil {
+		errs <- err
+		return
+	}
+	errs <- nil
+}
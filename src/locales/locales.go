@@ -0,0 +1,169 @@
+// Package locales provides the message catalogues the console and the
+// generated JavaScript client translate their UI strings from.
+//
+// English, German, French and Spanish are embedded. Operators add or
+// override languages with <locale>.json files in the locales directory;
+// those take precedence over the embedded copies. Every catalogue is
+// layered over English, so a partial translation never shows a raw key.
+package locales
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"holodeck1/config"
+)
+
+//go:embed catalogues/*.json
+var embedded embed.FS
+
+// Base is the locale every catalogue falls back to
+const Base = "en"
+
+// ErrInvalidTag is returned for language tags that are not BCP 47 shaped
+var ErrInvalidTag = errors.New("invalid language tag")
+
+var tagPattern = regexp.MustCompile(`^[A-Za-z]{2,8}([-_][A-Za-z0-9]{1,8})*$`)
+
+// Catalogue is a resolved set of messages
+type Catalogue struct {
+	Locale   string            `json:"locale"`
+	Messages map[string]string `json:"messages"`
+}
+
+// Normalize canonicalizes a language tag: "pt_br" becomes "pt-BR",
+// "zh-hant" becomes "zh-Hant"
+func Normalize(tag string) (string, error) {
+	if !tagPattern.MatchString(tag) {
+		return "", ErrInvalidTag
+	}
+	parts := strings.Split(strings.ReplaceAll(tag, "_", "-"), "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		switch len(parts[i]) {
+		case 2:
+			parts[i] = strings.ToUpper(parts[i]) // region
+		case 4:
+			parts[i] = strings.ToUpper(parts[i][:1]) + strings.ToLower(parts[i][1:]) // script
+		default:
+			parts[i] = strings.ToLower(parts[i])
+		}
+	}
+	return strings.Join(parts, "-"), nil
+}
+
+// candidates lists a tag and its less specific forms: pt-BR, pt
+func candidates(tag string) []string {
+	var result []string
+	for {
+		result = append(result, tag)
+		i := strings.LastIndex(tag, "-")
+		if i < 0 {
+			return result
+		}
+		tag = tag[:i]
+	}
+}
+
+// read returns the messages of exactly one locale, preferring the override
+// directory over the embedded catalogues
+func read(locale string) (map[string]string, bool, error) {
+	var content []byte
+	if dir := config.GetLocalesDir(); dir != "" {
+		data, err := os.ReadFile(filepath.Join(dir, locale+".json"))
+		if err == nil {
+			content = data
+		} else if !os.IsNotExist(err) {
+			return nil, false, err
+		}
+	}
+	if content == nil {
+		data, err := embedded.ReadFile("catalogues/" + locale + ".json")
+		if err != nil {
+			return nil, false, nil
+		}
+		content = data
+	}
+
+	var messages map[string]string
+	if err := json.Unmarshal(content, &messages); err != nil {
+		return nil, false, fmt.Errorf("catalogue %s: %w", locale, err)
+	}
+	return messages, true, nil
+}
+
+// Resolve returns the best catalogue for a language tag: the tag itself,
+// its base language, the configured default locale, then English. fallback
+// reports that neither the tag nor its base language is available.
+func Resolve(tag string) (*Catalogue, bool, error) {
+	normalized, err := Normalize(tag)
+	if err != nil {
+		return nil, false, err
+	}
+
+	base, _, err := read(Base)
+	if err != nil {
+		return nil, false, err
+	}
+
+	requested := candidates(normalized)
+	order := append([]string{}, requested...)
+	if defaultLocale, err := Normalize(config.GetClientLocale()); err == nil {
+		order = append(order, candidates(defaultLocale)...)
+	}
+	for i, locale := range order {
+		messages, ok, err := read(locale)
+		if err != nil {
+			return nil, false, err
+		}
+		if !ok {
+			continue
+		}
+		merged := make(map[string]string, len(base))
+		for key, message := range base {
+			merged[key] = message
+		}
+		for key, message := range messages {
+			merged[key] = message
+		}
+		return &Catalogue{Locale: locale, Messages: merged}, i >= len(requested), nil
+	}
+	return &Catalogue{Locale: Base, Messages: base}, normalized != Base, nil
+}
+
+// Available lists every locale with a catalogue, embedded or overridden
+func Available() []string {
+	seen := make(map[string]bool)
+	if entries, err := embedded.ReadDir("catalogues"); err == nil {
+		for _, entry := range entries {
+			seen[strings.TrimSuffix(entry.Name(), ".json")] = true
+		}
+	}
+	if dir := config.GetLocalesDir(); dir != "" {
+		if entries, err := os.ReadDir(dir); err == nil {
+			for _, entry := range entries {
+				name := entry.Name()
+				if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+					continue
+				}
+				if locale, err := Normalize(strings.TrimSuffix(name, ".json")); err == nil {
+					seen[locale] = true
+				}
+			}
+		}
+	}
+
+	result := make([]string, 0, len(seen))
+	for locale := range seen {
+		result = append(result, locale)
+	}
+	sort.Strings(result)
+	return result
+}
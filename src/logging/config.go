@@ -11,7 +11,8 @@ import (
 type Config struct {
 	Level        string   `json:"level"`
 	TraceModules []string `json:"trace_modules"`
-	LogDir       string   `json:"log_dir"`
+	LogDir       string   `json:"log_dir"` // Empty logs to the console only
+	Format       string   `json:"format"`  // Console format: text, or json lines
 }
 
 // LoadConfig loads logging configuration from environment, flags, and defaults
@@ -77,6 +78,7 @@ func ApplyConfig(config *Config) error {
 	if err := InitLogger(config.LogDir, level, config.TraceModules); err != nil {
 		return err
 	}
+	GetLogger().SetFormat(config.Format)
 
 	return nil
 }
@@ -59,6 +59,7 @@ type Logger struct {
 	logPath     string
 	maxSize     int64 // Maximum log file size in bytes
 	maxRotations int   // Maximum number of rotated log files
+	jsonConsole  bool  // Console gets the same JSON lines as the file
 }
 
 // LogEntry represents a structured log entry
@@ -88,16 +89,22 @@ func InitLogger(logDir string, level LogLevel, traceModules []string) error {
 	return err
 }
 
-// NewLogger creates a new logger instance
+// NewLogger creates a new logger instance. Without a log directory it
+// logs to the console only.
 func NewLogger(logDir string, level LogLevel, traceModules []string) (*Logger, error) {
-	if err := os.MkdirAll(logDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create log directory: %w", err)
-	}
+	var file *os.File
+	var logFile string
+	if logDir != "" {
+		if err := os.MkdirAll(logDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create log directory: %w", err)
+		}
 
-	logFile := filepath.Join(logDir, "hd1.log")
-	file, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open log file: %w", err)
+		logFile = filepath.Join(logDir, "hd1.log")
+		var err error
+		file, err = os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
 	}
 
 	traceMap := make(map[string]bool)
@@ -126,6 +133,14 @@ func GetLogger() *Logger {
 	return defaultLogger
 }
 
+// SetFormat selects the console format: "json" for JSON lines, as log
+// collectors in containers expect, anything else for text
+func (l *Logger) SetFormat(format string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.jsonConsole = strings.EqualFold(format, "json")
+}
+
 // SetLevel sets the logging level
 func (l *Logger) SetLevel(level LogLevel) {
 	l.mu.Lock()
@@ -292,6 +307,15 @@ func (l *Logger) writeEntry(entry LogEntry, level LogLevel) {
 		consoleMsg += " " + string(dataStr)
 	}
 
+	l.mu.RLock()
+	jsonConsole := l.jsonConsole
+	l.mu.RUnlock()
+	if jsonConsole {
+		if jsonData, err := json.Marshal(entry); err == nil {
+			consoleMsg = string(jsonData)
+		}
+	}
+
 	// Write to console (stderr for errors, stdout for others)
 	if level >= ERROR {
 		fmt.Fprintln(os.Stderr, consoleMsg)
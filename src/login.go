@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"holodeck1/config"
+)
+
+// Commands that talk to a server reach the one on this host through its
+// first listener, or another one through a named profile kept in
+// ~/.hd1/config (HD1_CLIENT_CONFIG to move it):
+//
+//	current: staging
+//	profiles:
+//	  staging:
+//	    url: https://hd1.staging.example.com
+//	    token: ...
+//	    world: showroom
+//
+// --address picks a listener, --profile a profile; without either the
+// profile named by HD1_CLIENT_PROFILE, else the current one, is used.
+// hd1 login adds profiles and makes them current.
+
+// client_profile is a server the commands may talk to
+type client_profile struct {
+	URL   string `yaml:"url"`
+	Token string `yaml:"token,omitempty"` // Moderation token, sent as bearer token
+	World string `yaml:"world,omitempty"` // World the server serves, when not the local default
+}
+
+// client_config is the commands' own configuration file
+type client_config struct {
+	Current  string                     `yaml:"current,omitempty"`
+	Profiles map[string]*client_profile `yaml:"profiles"`
+}
+
+// client_config_path names the configuration file
+func client_config_path() (string, error) {
+	if path := os.Getenv("HD1_CLIENT_CONFIG"); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".hd1", "config"), nil
+}
+
+// load_client_config reads the configuration file; a missing one is empty
+func load_client_config() (*client_config, error) {
+	loaded := &client_config{Profiles: map[string]*client_profile{}}
+	path, err := client_config_path()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return loaded, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, loaded); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if loaded.Profiles == nil {
+		loaded.Profiles = map[string]*client_profile{}
+	}
+	return loaded, nil
+}
+
+// save writes the configuration file, readable by its owner only as it
+// holds tokens
+func (c *client_config) save() error {
+	path, err := client_config_path()
+	if err != nil {
+		return err
+	}
+	var data bytes.Buffer
+	encoder := yaml.NewEncoder(&data)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	partial := path + ".partial"
+	if err := os.WriteFile(partial, data.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(partial, path)
+}
+
+// server_target is the server a command talks to
+type server_target struct {
+	client *http.Client
+	base   string          // URL the API and /ws are under
+	listen *listen_address // The local server's listener; nil for a profile
+	token  string
+	world  string // World commands act on by default
+}
+
+// resolve_target picks the server for a command from its --address and
+// --profile, printing why when it cannot
+func resolve_target(command, address, profile string) (*server_target, bool) {
+	if address == "" && profile == "" {
+		profile = os.Getenv("HD1_CLIENT_PROFILE")
+	}
+	if address == "" {
+		loaded, err := load_client_config()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", command, err)
+			return nil, false
+		}
+		if profile == "" {
+			profile = loaded.Current
+		}
+		if profile != "" {
+			selected, ok := loaded.Profiles[profile]
+			if !ok {
+				fmt.Fprintf(os.Stderr, "%s: unknown profile: %s (see hd1 login)\n", command, profile)
+				return nil, false
+			}
+			return profile_target(selected), true
+		}
+	}
+	// The server is this host's own: read its configuration for the
+	// listener, certificate and world
+	if config.Config == nil {
+		if err := config.Initialize(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", command, err)
+			return nil, false
+		}
+	}
+	if address == "" {
+		address = config.GetListen()[0]
+	}
+
+	listen, err := parse_listen_address(address)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", command, err)
+		return nil, false
+	}
+	client, base := local_client(listen)
+	return &server_target{client: client, base: base, listen: &listen, world: config.GetWorldsDefaultWorld()}, true
+}
+
+// profile_target returns the target of a profile. Unlike the local server,
+// its certificate is checked.
+func profile_target(profile *client_profile) *server_target {
+	transport := http.RoundTripper(http.DefaultTransport)
+	if profile.Token != "" {
+		transport = &bearer_transport{token: profile.Token, next: transport}
+	}
+	world := profile.World
+	if world == "" {
+		world = config.GetWorldsDefaultWorld()
+	}
+	return &server_target{
+		client: &http.Client{Transport: transport, Timeout: 5 * time.Second},
+		base:   strings.TrimRight(profile.URL, "/"),
+		token:  profile.Token,
+		world:  world,
+	}
+}
+
+// bearer_transport adds a profile's token to every request
+type bearer_transport struct {
+	token string
+	next  http.RoundTripper
+}
+
+func (t *bearer_transport) RoundTrip(request *http.Request) (*http.Response, error) {
+	request = request.Clone(request.Context())
+	request.Header.Set("Authorization", "Bearer "+t.token)
+	return t.next.RoundTrip(request)
+}
+
+// run_login saves a server as a profile and makes it current: hd1 login
+// [--profile NAME] [--token TOKEN | --token-stdin] URL. The server must
+// answer, and accept the token as an operator's, before it is saved.
+func run_login(args []string) int {
+	flags := flag.NewFlagSet("login", flag.ContinueOnError)
+	name := flags.String("profile", "default", "Profile to save the server as")
+	token := flags.String("token", "", "Moderation token for operator commands")
+	tokenStdin := flags.Bool("token-stdin", false, "Read the token from stdin")
+	world := flags.String("world", "", "World the server serves (default: "+config.GetWorldsDefaultWorld()+")")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: hd1 login [--profile NAME] [--token TOKEN | --token-stdin] [--world NAME] URL")
+	}
+	address, args := leading_argument(args)
+	if err := flags.Parse(args); err != nil || flags.NArg() > 1 || (address != "" && flags.NArg() != 0) {
+		flags.Usage()
+		return exitUsage
+	}
+	if flags.NArg() == 1 {
+		address = flags.Arg(0)
+	}
+	parsed, err := url.Parse(address)
+	if address == "" || err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		flags.Usage()
+		return exitUsage
+	}
+	if *name == "" || strings.ContainsAny(*name, " \t\n") {
+		fmt.Fprintf(os.Stderr, "login: invalid profile name: %q\n", *name)
+		return exitUsage
+	}
+	if *tokenStdin {
+		read, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "login: %v\n", err)
+			return exitUsage
+		}
+		*token = strings.TrimSpace(string(read))
+	}
+
+	profile := &client_profile{URL: strings.TrimRight(address, "/"), Token: *token, World: *world}
+	target := profile_target(profile)
+	response, err := target.client.Get(target.base + "/healthz")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "login: %v\n", err)
+		return exitFailed
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "login: %s/healthz answered %s\n", target.base, response.Status)
+		return exitFailed
+	}
+	access := "no token"
+	if profile.Token != "" {
+		// Any operator route checks the token; no delta has this type
+		response, err := target.client.Get(target.base + "/api/admin/sync/deltas?type=hd1_login")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "login: %v\n", err)
+			return exitFailed
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			fmt.Fprintf(os.Stderr, "login: token refused: server answered %s\n", response.Status)
+			return exitFailed
+		}
+		access = "operator"
+	}
+
+	loaded, err := load_client_config()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "login: %v\n", err)
+		return exitFailed
+	}
+	loaded.Profiles[*name] = profile
+	loaded.Current = *name
+	if err := loaded.save(); err != nil {
+		fmt.Fprintf(os.Stderr, "login: %v\n", err)
+		return exitFailed
+	}
+	fmt.Fprintf(os.Stderr, "login: profile %s saved and current (%s, %s)\n", *name, profile.URL, access)
+	return exitOK
+}
@@ -15,22 +15,62 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io/fs"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"syscall"
+	"time"
 
+	"holodeck1/anchors"
+	"holodeck1/apiusage"
+	"holodeck1/assets"
+	"holodeck1/bindings"
+	"holodeck1/bookings"
+	"holodeck1/chunks"
+	"holodeck1/components"
 	"holodeck1/config"
+	"holodeck1/consent"
+	"holodeck1/constraints"
+	"holodeck1/connectors"
+	"holodeck1/email"
+	"holodeck1/environment"
+	"holodeck1/importer"
+	"holodeck1/features"
+	"holodeck1/forms"
+	"holodeck1/guests"
+	"holodeck1/hibernation"
+	"holodeck1/holds"
+	"holodeck1/hooks"
+	"holodeck1/impersonation"
 	"holodeck1/logging"
+	"holodeck1/moderation"
+	"holodeck1/params"
+	"holodeck1/portals"
+	"holodeck1/preload"
+	"holodeck1/quotas"
 	"holodeck1/router"
 	"holodeck1/server"
+	"holodeck1/simulation"
+	"holodeck1/storage"
+	"holodeck1/transactions"
+	"holodeck1/usage"
+	"holodeck1/views"
+	"holodeck1/webhooks"
+	"holodeck1/worlds"
 )
 
 // main is the HD1 daemon entry point.
 // Initializes configuration, logging, WebSocket hub, and HTTP server
 // following the startup sequence: Config → Logging → Hub → Router → Server
 func main() {
+	// Client commands may talk to another server entirely, so they load
+	// this host's configuration only when they reach its own listener
+	if len(os.Args) > 1 && client_commands[os.Args[1]] {
+		os.Exit(run_subcommand(os.Args[1:]))
+	}
+
 	// Configuration initialization: Load settings from all sources
 	// Priority: Flags > Environment Variables > .env File > Defaults
 	if err := config.Initialize(); err != nil {
@@ -55,12 +95,21 @@ func main() {
 		return
 	}
 
+	// Operational subcommands run against the loaded configuration and exit
+	if flag.NArg() > 0 {
+		os.Exit(run_subcommand(flag.Args()))
+	}
+
 	// Logging initialization: Setup structured logging with config integration
 	// Supports module-based tracing and configurable log levels
 	logConfig := &logging.Config{
 		Level:        config.Config.Logging.Level,
 		TraceModules: config.Config.Logging.TraceModules,
 		LogDir:       config.Config.Logging.LogDir,
+		Format:       config.GetLogFormat(),
+	}
+	if config.GetContainer() {
+		logConfig.LogDir = "" // stdout only, collected by the container runtime
 	}
 	if err := logging.ApplyConfig(logConfig); err != nil {
 		// Cannot use structured logging before logging is initialized
@@ -88,38 +137,302 @@ func main() {
 		defer remove_process_identifier_file(config.GetPIDFile())
 	}
 
-	// Validate static directory from configuration
-	if _, err := os.Stat(config.GetStaticDir()); os.IsNotExist(err) {
-		logging.Fatal("static directory does not exist", map[string]interface{}{
-			"static_dir": config.GetStaticDir(),
+	// Operator commands and compiled-in callbacks run at lifecycle points,
+	// the first once configuration and logging are loaded
+	if err := hooks.Load(); err != nil {
+		logging.Fatal("lifecycle hooks unavailable", map[string]interface{}{
+			"file":  config.GetHooksFile(),
+			"error": err.Error(),
+		})
+	}
+	if err := hooks.Run(context.Background(), hooks.PostConfig); err != nil {
+		logging.Fatal("post_config hook failed", map[string]interface{}{
+			"error": err.Error(),
 		})
 	}
 
-	// Initialize HD1 with pure in-memory architecture (stateless)
-	hub := server.NewHub()
+	// Subsystems, the WebSocket hub and every handler, on the default mux
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	staticSource := start_services(ctx)
+
+	// Standard startup banner
+	logging.Info("HD1 (Holodeck One) daemon starting", map[string]interface{}{
+		"version":      config.GetVersion(),
+		"architecture": "spec-driven",
+	})
+	
+	logging.Info("directory configuration", map[string]interface{}{
+		"root_dir":    config.GetRootDir(),
+		"static_dir":  config.GetStaticDir(),
+		"static_source": staticSource,
+		"log_dir":     config.Config.Paths.LogDir,
+		"runtime_dir": config.Config.Paths.RuntimeDir,
+	})
+	
+	if config.GetDaemon() {
+		logging.Info("daemon mode enabled", map[string]interface{}{
+			"pid_file": config.GetPIDFile(),
+		})
+	}
+	if profiles := config.GetProfiles(); len(profiles) > 0 {
+		logging.Info("configuration profiles applied", map[string]interface{}{
+			"profiles":     profiles,
+			"profiles_dir": config.Config.Paths.ProfilesDir,
+		})
+	}
+	if config.GetContainer() {
+		logging.Info("container mode enabled", map[string]interface{}{
+			"log_format": config.GetLogFormat(),
+		})
+	}
+
+	logging.Info("core API endpoints initialized", map[string]interface{}{
+		"sessions":    "/api/sessions",
+		"objects":     "/api/sessions/{id}/objects", 
+		"world":       "/api/sessions/{id}/world",
+		"camera":      "/api/sessions/{id}/camera/position",
+		"scenes":      "/api/scenes",
+		"recording":   "/api/sessions/{id}/recording/*",
+		"admin":       "/admin/logging/*",
+	})
+	
+	// One listener per configured address: host:port by default, or any
+	// mix of TCP ports and Unix sockets from --listen
+	logging.Info("server binding to addresses", map[string]interface{}{
+		"listen": config.GetListen(),
+	})
+	
+	if err := serve_listeners(); err != nil {
+		logging.Fatal("server failed to start", map[string]interface{}{
+			"listen": config.GetListen(),
+			"error":  err.Error(),
+		})
+	}
+}
+
+// start_services initializes the subsystems and the WebSocket hub, starts
+// their background work until ctx ends and registers every handler on the
+// default mux. It returns where the console assets are served from.
+func start_services(ctx context.Context) string {
+	// Console assets: the static directory, or the copy built into the binary
+	htdocsRoot, staticSource, err := server.OpenHtDocs()
+	if err != nil {
+		logging.Fatal("console assets unavailable", map[string]interface{}{
+			"static_dir":    config.GetStaticDir(),
+			"static_source": config.GetStaticSource(),
+			"error":         err.Error(),
+		})
+	}
+	staticRoot, _ := fs.Sub(htdocsRoot, "static")
+
+	// Storage backend for assets, recordings and world exports
+	if err := storage.Initialize(); err != nil {
+		logging.Fatal("storage backend initialization failed", map[string]interface{}{
+			"backend": config.GetStorageBackend(),
+			"error":   err.Error(),
+		})
+	}
+
+	// Initialize HD1 with pure in-memory architecture (stateless)
+	hub := server.NewHub()
+	hub.SetChecksumFunc(worlds.ChecksumOperations)
+	portals.SetStateFunc(worlds.ReplayEntities)
+	chunks.SetStateFunc(worlds.ReplayEntities)
 	go hub.Run(ctx)
+	
+	// Count API calls per organization and key as the router hands them over
+	go apiusage.Run(ctx)
+	
+	// Load and warm the configured worlds before anyone can visit
+	usage.Track(config.GetWorldsDefaultWorld(), hub.GetSync())
+	preload.Run(hub)
+	
+	// Roll back scene transactions left open past their timeout
+	go transactions.Run(ctx)
+	
+	// Reclaim asset blobs no entity or world references any more
+	go assets.RunGarbageCollector(ctx, hub.GetSync().PeekAllOperations)
+	
+	// Step the served world's systems on one loop that keeps running with
+	// nobody connected: bound entity properties, time of day and weather,
+	// the meter holding the world to its budgets, and unloading it once empty
+	simulation.Register("bindings", config.GetBindingsTick(), bindings.Stepper(hub.GetSync()))
+	simulation.Register("environment", config.GetEnvironmentTick(), environment.Stepper(config.GetWorldsDefaultWorld(), hub.GetSync()))
+	simulation.Register("usage", time.Second, usage.Stepper())
+	simulation.Register("hibernation", 10*time.Second, hibernation.Stepper(config.GetWorldsDefaultWorld(), hub.GetSync(), hub.GetClientCount))
+	go simulation.Run(ctx, hub.GetClientCount)
+	
+	// Convert uploaded models into entities in the background
+	importer.Start(ctx, hub.GetSync())
+	if err := anchors.Initialize(ctx); err != nil {
+		logging.Error("failed to load persistent anchors", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	if err := moderation.Initialize(ctx); err != nil {
+		logging.Error("failed to load moderation bans", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	if err := views.Initialize(ctx); err != nil {
+		logging.Error("failed to load camera views", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	if err := email.LoadOrganizations(); err != nil {
+		logging.Fatal("email organizations unavailable", map[string]interface{}{
+			"file":  config.GetEmailOrgFile(),
+			"error": err.Error(),
+		})
+	}
+	if err := bookings.Initialize(ctx); err != nil {
+		logging.Error("failed to load bookings", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	go bookings.RunReminders(ctx)
+	if err := params.Initialize(ctx); err != nil {
+		logging.Error("failed to load world parameters", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	if err := connectors.Load(); err != nil {
+		logging.Fatal("connectors unavailable", map[string]interface{}{
+			"file":  config.GetConnectorsFile(),
+			"error": err.Error(),
+		})
+	}
+	go connectors.Run(ctx)
+	if err := webhooks.Load(); err != nil {
+		logging.Fatal("webhooks unavailable", map[string]interface{}{
+			"file":  config.GetWebhooksFile(),
+			"error": err.Error(),
+		})
+	}
+	if err := forms.Load(); err != nil {
+		logging.Fatal("form targets unavailable", map[string]interface{}{
+			"file":  config.GetFormsFile(),
+			"error": err.Error(),
+		})
+	}
+	if err := portals.Load(); err != nil {
+		logging.Fatal("portal destinations unavailable", map[string]interface{}{
+			"file":  config.GetPortalsFile(),
+			"error": err.Error(),
+		})
+	}
+	if err := consent.Load(); err != nil {
+		logging.Fatal("consent documents unavailable", map[string]interface{}{
+			"file":  config.GetConsentFile(),
+			"error": err.Error(),
+		})
+	}
+	if err := quotas.Load(); err != nil {
+		logging.Fatal("request quota plans unavailable", map[string]interface{}{
+			"file":  config.GetQuotasFile(),
+			"error": err.Error(),
+		})
+	}
+	if err := quotas.Initialize(ctx); err != nil {
+		logging.Error("failed to load organization plans", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	go quotas.Run(ctx)
+	if err := components.Load(); err != nil {
+		logging.Fatal("entity component schemas unavailable", map[string]interface{}{
+			"dir":   config.GetComponentsDir(),
+			"error": err.Error(),
+		})
+	}
+	if err := guests.Initialize(ctx); err != nil {
+		logging.Error("failed to load guest links", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	if err := holds.Initialize(ctx); err != nil {
+		logging.Error("failed to load legal holds", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	go holds.Run(ctx)
+	go impersonation.Run(ctx, hub)
+	if err := constraints.Initialize(ctx); err != nil {
+		logging.Error("failed to load world constraints", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	if err := moderation.LoadContentPolicies(); err != nil {
+		logging.Fatal("content policies unavailable", map[string]interface{}{
+			"file":  config.GetModerationPolicyFile(),
+			"error": err.Error(),
+		})
+	}
+	if err := assets.StartScanner(); err != nil {
+		logging.Fatal("asset scanner unavailable", map[string]interface{}{
+			"backend": config.GetAssetsScanBackend(),
+			"error":   err.Error(),
+		})
+	}
+	assets.StartPipeline(ctx)
+	assets.StartPointClouds(ctx)
+	if err := features.Initialize(ctx); err != nil {
+		logging.Fatal("feature flags unavailable", map[string]interface{}{
+			"file":  config.GetFeaturesFile(),
+			"error": err.Error(),
+		})
+	}
 
 	// Initialize template processor with configured static directory
-	server.InitializeTemplateProcessor(config.GetStaticDir())
+	server.InitializeTemplateProcessor(htdocsRoot)
 	
 	// WebSocket and static files
 	http.HandleFunc("/", server.ServeHome)
+	http.HandleFunc("/w/", server.ServeWorldLink)
 	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		server.ServeWS(hub, w, r)
 	})
+	http.HandleFunc("/ws/broadcast", server.ServeBroadcast)
+	
+	// Liveness, readiness and the preStop drain hook
+	http.HandleFunc("/healthz", server.ServeHealthz)
+	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		server.ServeReadyz(hub, w, r)
+	})
+	http.HandleFunc("/drain", func(w http.ResponseWriter, r *http.Request) {
+		server.ServeDrain(hub, w, r)
+	})
 	
 	// Auto-generated API router from specification
 	apiRouter := router.NewAPIRouter(hub)
 	http.Handle("/api/", apiRouter)
 	
+	// Filesystem and encrypted storage serve their own signed URLs; object
+	// stores are accessed directly
+	if handler, ok := storage.Default().(http.Handler); ok {
+		http.Handle(storage.SignedPathPrefix, handler)
+	}
+	
 	// Template-processed JavaScript files with API-driven versioning (must be before static handler)
 	http.HandleFunc("/static/js/hd1-console.js", server.ServeConsoleJS)
 	
 	// Serve static files with proper cache control headers
-	fileServer := http.FileServer(http.Dir(config.GetStaticDir()))
+	fileServer := http.FileServer(http.FS(staticRoot))
 	http.Handle("/static/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fingerprinted names change with the content, so they never go stale
+		if original, ok := server.ResolveFingerprint(r.URL.Path); ok {
+			w.Header().Set("Cache-Control", server.ImmutableCacheControl)
+			r = r.Clone(r.Context())
+			r.URL.Path = original
+			if original == "/static/js/hd1-console.js" {
+				server.ServeConsoleJS(w, r)
+				return
+			}
+			http.StripPrefix("/static/", fileServer).ServeHTTP(w, r)
+			return
+		}
+
 		// Skip template-processed files (they have their own handlers)
 		if r.URL.Path == "/static/js/hd1-console.js" {
 			http.NotFound(w, r) // This should never be reached due to HandleFunc precedence
@@ -128,7 +441,7 @@ func main() {
 		
 		// Set cache control headers for static assets
 		if filepath.Ext(r.URL.Path) == ".js" || filepath.Ext(r.URL.Path) == ".css" {
-			// For development: no-cache for JS/CSS to avoid cache issues
+			// Plain names may change in place: no-cache for JS/CSS
 			w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 			w.Header().Set("Pragma", "no-cache")
 			w.Header().Set("Expires", "0")
@@ -139,48 +452,7 @@ func main() {
 		http.StripPrefix("/static/", fileServer).ServeHTTP(w, r)
 	}))
 
-	// Standard startup banner
-	logging.Info("HD1 (Holodeck One) daemon starting", map[string]interface{}{
-		"version":      config.GetVersion(),
-		"architecture": "spec-driven",
-	})
-	
-	logging.Info("directory configuration", map[string]interface{}{
-		"root_dir":    config.GetRootDir(),
-		"static_dir":  config.GetStaticDir(),
-		"log_dir":     config.Config.Paths.LogDir,
-		"runtime_dir": config.Config.Paths.RuntimeDir,
-	})
-	
-	if config.GetDaemon() {
-		logging.Info("daemon mode enabled", map[string]interface{}{
-			"pid_file": config.GetPIDFile(),
-		})
-	}
-
-	logging.Info("core API endpoints initialized", map[string]interface{}{
-		"sessions":    "/api/sessions",
-		"objects":     "/api/sessions/{id}/objects", 
-		"world":       "/api/sessions/{id}/world",
-		"camera":      "/api/sessions/{id}/camera/position",
-		"scenes":      "/api/scenes",
-		"recording":   "/api/sessions/{id}/recording/*",
-		"admin":       "/admin/logging/*",
-	})
-	
-	bindAddr := fmt.Sprintf("%s:%s", config.Config.Server.Host, config.Config.Server.Port)
-	logging.Info("server binding to address", map[string]interface{}{
-		"address": bindAddr,
-		"host":    config.Config.Server.Host,
-		"port":    config.Config.Server.Port,
-	})
-	
-	if err := http.ListenAndServe(bindAddr, nil); err != nil {
-		logging.Fatal("server failed to start", map[string]interface{}{
-			"address": bindAddr,
-			"error":   err.Error(),
-		})
-	}
+	return staticSource
 }
 
 func display_help_information() {
@@ -189,6 +461,24 @@ func display_help_information() {
 	fmt.Println()
 	fmt.Println("USAGE:")
 	fmt.Println("  hd1 [OPTIONS]")
+	fmt.Println("  hd1 [OPTIONS] COMMAND [ARGS]")
+	fmt.Println()
+	fmt.Println("COMMANDS:")
+	fmt.Println("  validate-world [DIR]  Validate world config files (default: worlds dir), JSON report")
+	fmt.Println("  world diff A B        Compare two world exports, JSON diff")
+	fmt.Println("  world merge BASE OURS THEIRS")
+	fmt.Println("                        Three-way merge world exports (--prefer ours|theirs, -o FILE)")
+	fmt.Println("  world export [WORLD]  Download the live world as an export (-o FILE)")
+	fmt.Println("  world import FILE     Load an export into the live world (--stage, --label)")
+	fmt.Println("  world migrate --to T  Move the live world to another server, redirecting clients")
+	fmt.Println("  world lint [WORLD]    Report rendering problems, exit 1 on errors (--fail-on)")
+	fmt.Println("  drain                 Fail readiness and wait for clients to leave (--timeout 25s)")
+	fmt.Println("  maintenance [on|off]  Read-only mode for the server or one world (--world, --message)")
+	fmt.Println("  login URL             Save a server as the current client profile (--profile, --token-stdin)")
+	fmt.Println("  watch                 Stream world operations from /ws (--entity, --type, --format jsonl)")
+	fmt.Println("  backup                Download a backup of the instance (-o FILE, --only SECTIONS)")
+	fmt.Println("  restore FILE          Restore a backup (--only, --skip-existing, --dry-run)")
+	fmt.Println("  selftest              Boot the server in-process and check it against the API (--json)")
 	fmt.Println()
 	fmt.Println("OPTIONS:")
 	fmt.Println("  --daemon          Run HD1 as daemon")
@@ -196,13 +486,32 @@ func display_help_information() {
 	fmt.Println("  --log-file PATH   Log file path (absolute)")
 	fmt.Println("  --host HOST       Host to bind to (default: 0.0.0.0)")
 	fmt.Println("  --port PORT       Port to bind to (default: 8080)")
+	fmt.Println("  --listen ADDRS    Listeners replacing host/port, e.g. unix:///run/hd1.sock,127.0.0.1:8080")
+	fmt.Println("  --tls-cert FILE   TLS certificate (with --tls-key): HTTPS and HTTP/2")
 	fmt.Println("  --static-dir PATH Static files directory (absolute)")
+	fmt.Println("  --static-dev-mode Serve JS/CSS under plain names without caching")
+	fmt.Println("  --log-format FMT  Console log format: text or json (json in containers)")
+	fmt.Println("  --profile NAMES   Configuration profiles from share/profiles, layered left to right")
 	fmt.Println("  --help            Show this help message")
 	fmt.Println()
 	fmt.Println("EXAMPLES:")
 	fmt.Println("  hd1")
 	fmt.Println("  hd1 --daemon --log-file /opt/hd1/build/logs/hd1.log")
 	fmt.Println("  hd1 --host 127.0.0.1 --port 9090")
+	fmt.Println("  hd1 --listen unix:///run/hd1/hd1.sock")
+	fmt.Println("  hd1 --profile production,acme")
+	fmt.Println("  hd1 validate-world ./share/worlds")
+	fmt.Println("  hd1 world merge -o merged.json base.json ours.json theirs.json")
+	fmt.Println("  hd1 world export world_one -o scene.json")
+	fmt.Println("  hd1 world migrate --to standby --message \"Moving to a new host\"")
+	fmt.Println("  hd1 world lint --fail-on warning")
+	fmt.Println("  hd1 drain --timeout 60s")
+	fmt.Println("  hd1 maintenance on --message \"Upgrading storage\"")
+	fmt.Println("  hd1 login --profile staging --token-stdin https://hd1.staging.example.com")
+	fmt.Println("  hd1 watch --type entity_create,entity_update --format jsonl")
+	fmt.Println("  hd1 backup -o backups/hd1.tar.gz")
+	fmt.Println("  hd1 restore --only assets,recordings --skip-existing backup.tar.gz")
+	fmt.Println("  hd1 --profile production selftest")
 	fmt.Println()
 	fmt.Printf("DEFAULT PATHS:\n")
 	fmt.Printf("  Root: %s\n", config.GetRootDir())
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"holodeck1/config"
+)
+
+// run_maintenance switches maintenance mode on the local server: hd1
+// maintenance on|off [--world W] [--message M]. Without on or off it prints
+// the current switches.
+func run_maintenance(args []string) int {
+	flags := flag.NewFlagSet("maintenance", flag.ContinueOnError)
+	world := flags.String("world", "", "World to switch (default: the whole server)")
+	message := flags.String("message", "", "Banner shown on connected consoles")
+	address := flags.String("address", "", "Server address (default: the first listener)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: hd1 maintenance [on|off] [--world NAME] [--message TEXT] [--address host:port|unix:///path]")
+	}
+	action := ""
+	if len(args) > 0 && (args[0] == "on" || args[0] == "off") {
+		action, args = args[0], args[1:]
+	}
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		return exitUsage
+	}
+	if *address == "" {
+		*address = config.GetListen()[0]
+	}
+	listen, err := parse_listen_address(*address)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "maintenance: %v\n", err)
+		return exitUsage
+	}
+
+	client, base := local_client(listen)
+	var response *http.Response
+	if action == "" {
+		response, err = client.Get(base + "/api/system/maintenance")
+	} else {
+		body, _ := json.Marshal(map[string]interface{}{
+			"enabled": action == "on",
+			"message": *message,
+			"world":   *world,
+		})
+		request, _ := http.NewRequest(http.MethodPut, base+"/api/system/maintenance", bytes.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		response, err = client.Do(request)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "maintenance: %v\n", err)
+		return exitFailed
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "maintenance: server answered %s\n", response.Status)
+		return exitFailed
+	}
+	io.Copy(os.Stdout, response.Body)
+	return exitOK
+}
@@ -0,0 +1,216 @@
+// Package media defines media entities: screens in the world showing an
+// HLS stream, a WebRTC live stream or a participant's screen share as a
+// texture.
+//
+// Playback is controlled by the server so everyone in a world watches the
+// same thing. A media component records whether it is playing and the
+// stream position at a server time; clients play from the position plus
+// the server time since, and correct their video when it drifts. Play,
+// pause, seek and volume changes each fix a new position and time and reach
+// clients as an entity_update.
+package media
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/numbers"
+)
+
+// Stream kinds
+const (
+	KindHLS    = "hls"    // An HLS playlist (.m3u8), on demand or live
+	KindWebRTC = "webrtc" // A WHEP endpoint serving a live stream
+	KindShare  = "share"  // A screen share, published by a participant
+)
+
+// Control actions
+const (
+	ActionPlay   = "play"
+	ActionPause  = "pause"
+	ActionSeek   = "seek"
+	ActionVolume = "volume"
+)
+
+// Limits of a valid screen
+const (
+	maxDimension  = 50 // Metres
+	maxSource     = 2048
+	defaultWidth  = 1.6
+	defaultHeight = 0.9
+)
+
+var sharePattern = regexp.MustCompile(`^share-[A-Za-z0-9-]{1,64}$`)
+
+// Media is the media component of an entity
+type Media struct {
+	Kind      string   `json:"kind"`             // hls, webrtc or share
+	Source    string   `json:"source"`           // https URL of the playlist or WHEP endpoint, or the share ID
+	Width     float64  `json:"width,omitempty"`  // Screen size, metres
+	Height    float64  `json:"height,omitempty"` // Screen size, metres
+	Playing   bool     `json:"playing"`
+	Position  float64  `json:"position"`       // Seconds into the stream at updated_at
+	Volume    *float64 `json:"volume"`         // 0-1, 1 when unset
+	Loop      bool     `json:"loop,omitempty"` // Restart on demand streams at the end
+	UpdatedAt int64    `json:"updated_at"`     // Server time in ms of position, set by the server
+}
+
+// Validate checks a media component against the schema and the allowed
+// stream hosts
+func (m *Media) Validate() error {
+	switch m.Kind {
+	case KindHLS, KindWebRTC:
+		if err := validateSource(m.Kind, m.Source); err != nil {
+			return err
+		}
+	case KindShare:
+		if !sharePattern.MatchString(m.Source) {
+			return fmt.Errorf("share sources must be share IDs, got %q", m.Source)
+		}
+	default:
+		return fmt.Errorf("unknown media kind: %q (hls, webrtc or share)", m.Kind)
+	}
+	for _, dimension := range []float64{m.Width, m.Height} {
+		if !numbers.Within(dimension, 0, maxDimension) {
+			return fmt.Errorf("width and height must be within 0-%dm", maxDimension)
+		}
+	}
+	if !numbers.Within(m.Position, 0, math.MaxFloat64) {
+		return errors.New("position must not be negative")
+	}
+	if m.Live() && m.Position != 0 {
+		return errors.New("live streams have no position")
+	}
+	if m.Volume != nil && !numbers.Within(*m.Volume, 0, 1) {
+		return errors.New("volume must be within 0-1")
+	}
+	return nil
+}
+
+// Start fills in defaults and fixes the time the position was taken at;
+// call it whenever a media component is created or replaced
+func (m *Media) Start(now time.Time) {
+	if m.Width == 0 {
+		m.Width = defaultWidth
+	}
+	if m.Height == 0 {
+		m.Height = defaultHeight
+	}
+	if m.Volume == nil {
+		volume := 1.0
+		m.Volume = &volume
+	}
+	m.UpdatedAt = now.UnixMilli()
+}
+
+// Live reports whether the stream is live, without a position to seek
+func (m *Media) Live() bool {
+	return m.Kind == KindWebRTC || m.Kind == KindShare
+}
+
+// PositionAt returns where playback is at a server time
+func (m *Media) PositionAt(now time.Time) float64 {
+	if !m.Playing || m.Live() {
+		return m.Position
+	}
+	elapsed := float64(now.UnixMilli()-m.UpdatedAt) / 1000
+	return m.Position + math.Max(0, elapsed)
+}
+
+// Control changes playback
+type Control struct {
+	Action   string   `json:"action"`             // play, pause, seek or volume
+	Position *float64 `json:"position,omitempty"` // Seconds, for seek
+	Volume   *float64 `json:"volume,omitempty"`   // 0-1, for volume
+}
+
+// Apply carries out a control at a server time
+func (m *Media) Apply(control Control, now time.Time) error {
+	switch control.Action {
+	case ActionPlay:
+		m.Position = m.PositionAt(now)
+		m.Playing = true
+	case ActionPause:
+		m.Position = m.PositionAt(now)
+		m.Playing = false
+	case ActionSeek:
+		if m.Live() {
+			return errors.New("live streams cannot seek")
+		}
+		if control.Position == nil || !numbers.Within(*control.Position, 0, math.MaxFloat64) {
+			return errors.New("seek needs a position of at least 0 seconds")
+		}
+		m.Position = *control.Position
+	case ActionVolume:
+		if control.Volume == nil || !numbers.Within(*control.Volume, 0, 1) {
+			return errors.New("volume needs a volume within 0-1")
+		}
+		m.Position = m.PositionAt(now)
+		volume := *control.Volume
+		m.Volume = &volume
+	default:
+		return fmt.Errorf("unknown action: %q (play, pause, seek or volume)", control.Action)
+	}
+	if m.Live() {
+		m.Position = 0
+	}
+	m.UpdatedAt = now.UnixMilli()
+	return nil
+}
+
+// Data returns the media component as entity operation data
+func (m *Media) Data() map[string]interface{} {
+	var data map[string]interface{}
+	encoded, _ := json.Marshal(m)
+	json.Unmarshal(encoded, &data)
+	return data
+}
+
+// Decode reads and validates a media component from entity operation data
+func Decode(value interface{}) (*Media, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var media Media
+	if err := json.Unmarshal(encoded, &media); err != nil {
+		return nil, fmt.Errorf("invalid media: %v", err)
+	}
+	if err := media.Validate(); err != nil {
+		return nil, err
+	}
+	return &media, nil
+}
+
+// validateSource requires an https URL on an allowed host; browsers block
+// anything else on a console served over https anyway
+func validateSource(kind, source string) error {
+	if len(source) > maxSource {
+		return fmt.Errorf("source exceeds %d characters", maxSource)
+	}
+	parsed, err := url.Parse(source)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" || parsed.User != nil {
+		return fmt.Errorf("source must be an https URL, got %q", source)
+	}
+	if kind == KindHLS && !strings.HasSuffix(strings.ToLower(parsed.Path), ".m3u8") {
+		return errors.New("hls sources must be .m3u8 playlists")
+	}
+	allowed := config.GetMediaAllowedHosts()
+	if len(allowed) == 0 {
+		return nil
+	}
+	host := strings.ToLower(parsed.Hostname())
+	for _, candidate := range allowed {
+		if host == candidate || strings.HasSuffix(host, "."+candidate) {
+			return nil
+		}
+	}
+	return fmt.Errorf("streams from %s are not allowed", host)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// run_world_migrate moves a live world to another server: hd1 world
+// migrate --to PROFILE|URL [--world W]. The source server does the work,
+// so its consoles are redirected only once the target holds the world;
+// the target's URL, token and world come from its client profile.
+func run_world_migrate(args []string) int {
+	flags := flag.NewFlagSet("world migrate", flag.ContinueOnError)
+	to := flags.String("to", "", "Target server: a profile (see hd1 login) or a base URL")
+	world := flags.String("world", "", "World to migrate (default: the served world)")
+	targetWorld := flags.String("target-world", "", "World the target serves (default: the profile's, else the same name)")
+	clientURL := flags.String("client-url", "", "Where consoles reconnect (default: the target's link to its world)")
+	message := flags.String("message", "", "Banner shown while the world is frozen")
+	address := flags.String("address", "", "Source server address (default: the first listener)")
+	profile := flags.String("profile", "", "Source server profile (see hd1 login)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: hd1 world migrate --to PROFILE|URL [--world NAME] [--target-world NAME] [--client-url URL] [--message TEXT] [--address host:port|unix:///path | --profile NAME]")
+	}
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 || *to == "" {
+		flags.Usage()
+		return exitUsage
+	}
+
+	request := map[string]string{
+		"target":       *to,
+		"target_world": *targetWorld,
+		"client_url":   *clientURL,
+		"message":      *message,
+	}
+	if parsed, err := url.Parse(*to); err != nil || parsed.Scheme == "" {
+		loaded, err := load_client_config()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "world migrate: %v\n", err)
+			return exitUsage
+		}
+		target, ok := loaded.Profiles[*to]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "world migrate: unknown profile: %s (see hd1 login)\n", *to)
+			return exitUsage
+		}
+		request["target"], request["token"] = target.URL, target.Token
+		if *targetWorld == "" {
+			request["target_world"] = target.World
+		}
+	}
+
+	source, ok := transfer_target("world migrate", *address, *profile)
+	if !ok {
+		return exitUsage
+	}
+	if *world == "" {
+		*world = source.world
+	}
+	if strings.TrimRight(request["target"], "/") == source.base {
+		fmt.Fprintln(os.Stderr, "world migrate: the target is the source server")
+		return exitUsage
+	}
+
+	body, _ := json.Marshal(request)
+	fmt.Fprintf(os.Stderr, "world migrate: moving %s to %s\n", *world, request["target"])
+	response, err := source.client.Post(source.base+"/api/worlds/"+url.PathEscape(*world)+"/migrate", "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "world migrate: %v\n", err)
+		return exitFailed
+	}
+	migrated, err := read_transfer_response(response, http.StatusOK)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "world migrate: %v\n", err)
+		return exitFailed
+	}
+	os.Stdout.Write(migrated)
+	return exitOK
+}
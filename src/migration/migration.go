@@ -0,0 +1,178 @@
+// Package migration moves a live world to another HD1 server.
+//
+// The source server sends the target a snapshot of the world while it is
+// still live, then freezes it - maintenance mode for the world - and sends
+// the tail: the operations that turn the snapshot into the frozen state.
+// The target checks each phase against checksums of the source's states,
+// so the world it ends up serving is exactly the one frozen. Only then are
+// the source's consoles sent to the target; a failure before that switches
+// maintenance off again and the world carries on where it was.
+package migration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	stdSync "sync"
+	"time"
+
+	"holodeck1/sync"
+	"holodeck1/worlds"
+)
+
+// ErrInProgress is returned when the world is already migrating
+var ErrInProgress = errors.New("world is already migrating")
+
+// ErrDiverged is returned by the target when its world is not the state
+// the source expects it to be
+var ErrDiverged = errors.New("target world diverged from the source")
+
+// SnapshotRequest replaces the target's world with the source's live
+// state. The export is in HD1's space.
+type SnapshotRequest struct {
+	Source   string         `json:"source"` // Source server, for logs and checkpoint labels
+	SeqNum   uint64         `json:"seq_num"`
+	Checksum string         `json:"checksum"` // Of the state, sha256
+	State    *worlds.Export `json:"state"`
+}
+
+// TailRequest applies the operations the world took on the source between
+// the snapshot and the freeze
+type TailRequest struct {
+	Source       string            `json:"source"`
+	SeqNum       uint64            `json:"seq_num"`
+	BaseChecksum string            `json:"base_checksum"` // The snapshot's, which the target must still hold
+	Checksum     string            `json:"checksum"`      // The frozen state's
+	Operations   []*sync.Operation `json:"operations"`
+}
+
+// Response is the target's answer to either phase
+type Response struct {
+	Success    bool   `json:"success"`
+	Checksum   string `json:"checksum"`   // Of the target's world afterwards
+	Operations int    `json:"operations"` // Submitted on the target
+	SeqNum     uint64 `json:"seq_num"`    // Target's sequence afterwards
+}
+
+// tailTypes are the operations a tail may hold: those worlds.Restore emits
+var tailTypes = map[string]bool{
+	sync.OpEntityCreate: true,
+	sync.OpEntityUpdate: true,
+	sync.OpEntityDelete: true,
+	sync.OpSceneUpdate:  true,
+}
+
+// ValidateTail checks a tail only holds entity and scene changes
+func ValidateTail(operations []*sync.Operation) error {
+	for i, operation := range operations {
+		if operation == nil || !tailTypes[operation.Type] {
+			return fmt.Errorf("operation %d: not an entity or scene change", i)
+		}
+		if id, _ := operation.Data["id"].(string); id == "" && operation.Type != sync.OpSceneUpdate {
+			return fmt.Errorf("operation %d: id required", i)
+		}
+	}
+	return nil
+}
+
+// Checksum hashes a state for comparison between the servers
+func Checksum(state *worlds.State) string {
+	checksum, _ := state.Checksum(worlds.ChecksumSHA256)
+	return checksum
+}
+
+// Target is the server a world moves to
+type Target struct {
+	URL   string // Base URL
+	Token string // The target's moderation token, sent as bearer token
+	World string // World the target serves
+}
+
+// ParseTarget checks a target's base URL
+func ParseTarget(base, token, world string) (*Target, error) {
+	parsed, err := url.Parse(base)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return nil, errors.New("target must be an http or https URL")
+	}
+	return &Target{URL: strings.TrimRight(base, "/"), Token: token, World: world}, nil
+}
+
+// ClientURL is where consoles reconnect: the target's link to its world
+func (t *Target) ClientURL() string {
+	return t.URL + "/w/" + url.PathEscape(t.World)
+}
+
+var targetClient = &http.Client{Timeout: 5 * time.Minute}
+
+// Snapshot sends the target the world's snapshot
+func (t *Target) Snapshot(ctx context.Context, request *SnapshotRequest) (*Response, error) {
+	return t.post(ctx, "snapshot", request)
+}
+
+// Tail sends the target the operations since the snapshot
+func (t *Target) Tail(ctx context.Context, request *TailRequest) (*Response, error) {
+	return t.post(ctx, "tail", request)
+}
+
+func (t *Target) post(ctx context.Context, phase string, body interface{}) (*Response, error) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := t.URL + "/api/worlds/" + url.PathEscape(t.World) + "/migration/" + phase
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(encoded))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.Token)
+	}
+	response, err := targetClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", phase, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusConflict {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return nil, fmt.Errorf("%s: %w: %s", phase, ErrDiverged, bytes.TrimSpace(message))
+	}
+	if response.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return nil, fmt.Errorf("%s: target answered %s: %s", phase, response.Status, bytes.TrimSpace(message))
+	}
+	var answer Response
+	if err := json.NewDecoder(response.Body).Decode(&answer); err != nil {
+		return nil, fmt.Errorf("%s: %v", phase, err)
+	}
+	return &answer, nil
+}
+
+var migrating = struct {
+	mutex  stdSync.Mutex
+	worlds map[string]bool
+}{worlds: map[string]bool{}}
+
+// Begin marks a world as migrating; End it when done
+func Begin(world string) error {
+	migrating.mutex.Lock()
+	defer migrating.mutex.Unlock()
+	if migrating.worlds[world] {
+		return ErrInProgress
+	}
+	migrating.worlds[world] = true
+	return nil
+}
+
+// End marks a world's migration finished, whatever its outcome
+func End(world string) {
+	migrating.mutex.Lock()
+	delete(migrating.worlds, world)
+	migrating.mutex.Unlock()
+}
@@ -0,0 +1,367 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+)
+
+// User text is screened before it is broadcast or stored. Each organization
+// has a policy, a pipeline of checks run in order: keyword lists, regular
+// expressions, an external moderation API and compiled-in plugins. A check
+// allows the text, redacts it for the checks after it, or rejects it,
+// which ends the pipeline. Organizations without a policy of their own use
+// the "default" one; with neither, text goes through unscreened.
+
+// Kinds of text screened
+const (
+	KindCaption    = "caption"     // Live speech captions
+	KindEntityText = "entity_text" // Text geometry and panel content stored in the world
+	KindPoll       = "poll"        // Poll questions and options
+	KindChat       = "chat"        // Chat messages
+	KindDocument   = "document"    // Shared document titles and text submitted whole
+	KindForm       = "form"        // Text answers submitted through form entities
+)
+
+// Verdict actions
+const (
+	Allow  = "allow"
+	Redact = "redact"
+	Reject = "reject"
+)
+
+// DefaultPolicy applies to organizations without their own policy
+const DefaultPolicy = "default"
+
+// Content is text submitted for broadcast or storage
+type Content struct {
+	Kind  string `json:"kind"`
+	Org   string `json:"org"`
+	World string `json:"world"`
+	HD1ID string `json:"hd1_id,omitempty"`
+	Text  string `json:"text"`
+}
+
+// Verdict is a check's decision. Text is the redacted text for Redact.
+type Verdict struct {
+	Action string `json:"action"`
+	Text   string `json:"text,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	Check  string `json:"check,omitempty"` // Check that decided, set by Screen
+}
+
+// Checker examines content. Plugins implement it and register with
+// RegisterChecker; policies refer to them by name.
+type Checker interface {
+	Check(ctx context.Context, content Content) (Verdict, error)
+}
+
+var (
+	plugins      = map[string]Checker{}
+	pluginsMutex sync.RWMutex
+)
+
+// RegisterChecker makes a plugin available to policies as
+// {"type": "plugin", "name": name}. Plugins register from init functions,
+// before policies are loaded.
+func RegisterChecker(name string, checker Checker) {
+	pluginsMutex.Lock()
+	defer pluginsMutex.Unlock()
+	plugins[name] = checker
+}
+
+// CheckSpec is one step of a policy
+type CheckSpec struct {
+	Type    string   `json:"type"`               // keywords, regex, api or plugin
+	Words   []string `json:"words,omitempty"`    // keywords: whole words, any case
+	Pattern string   `json:"pattern,omitempty"`  // regex: RE2 syntax
+	Action  string   `json:"action,omitempty"`   // keywords, regex: redact or reject (default)
+	Reason  string   `json:"reason,omitempty"`   // keywords, regex: reason given on a match
+	URL     string   `json:"url,omitempty"`      // api: endpoint to POST content to
+	Timeout string   `json:"timeout,omitempty"`  // api: default 2s
+	OnError string   `json:"on_error,omitempty"` // api: allow (default) or reject when unreachable
+	Name    string   `json:"name,omitempty"`     // plugin: registered name
+}
+
+// Policy is an organization's screening pipeline
+type Policy struct {
+	Kinds  []string     `json:"kinds,omitempty"` // Kinds screened; all when empty
+	Checks []CheckSpec  `json:"checks"`
+	Images *ImagePolicy `json:"images,omitempty"` // Uploaded images go unclassified when absent, see images.go
+}
+
+// PolicyDocument is the format of the policy file
+type PolicyDocument struct {
+	Policies map[string]Policy `json:"policies"`
+}
+
+type step struct {
+	name    string
+	checker Checker
+}
+
+type compiledPolicy struct {
+	kinds  map[string]bool
+	steps  []step
+	images *compiledImagePolicy
+}
+
+var (
+	policies      = map[string]*compiledPolicy{}
+	policiesMutex sync.RWMutex
+)
+
+// LoadContentPolicies reads the policy file; a missing file leaves text
+// unscreened
+func LoadContentPolicies() error {
+	file := config.GetModerationPolicyFile()
+	compiled := map[string]*compiledPolicy{}
+	raw, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		var document PolicyDocument
+		if err := json.Unmarshal(raw, &document); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		for org, policy := range document.Policies {
+			if compiled[org], err = compilePolicy(policy); err != nil {
+				return fmt.Errorf("%s: policy %q: %v", file, org, err)
+			}
+		}
+	}
+
+	policiesMutex.Lock()
+	policies = compiled
+	policiesMutex.Unlock()
+
+	logging.Info("content policies loaded", map[string]interface{}{
+		"file":     file,
+		"policies": len(compiled),
+	})
+	return nil
+}
+
+func compilePolicy(policy Policy) (*compiledPolicy, error) {
+	compiled := &compiledPolicy{kinds: map[string]bool{}}
+	for _, kind := range policy.Kinds {
+		if kind != KindCaption && kind != KindEntityText && kind != KindPoll && kind != KindChat && kind != KindDocument && kind != KindForm {
+			return nil, fmt.Errorf("unknown kind %q", kind)
+		}
+		compiled.kinds[kind] = true
+	}
+	for i, spec := range policy.Checks {
+		checker, err := compileCheck(spec)
+		if err != nil {
+			return nil, fmt.Errorf("check %d: %v", i+1, err)
+		}
+		name := spec.Type
+		if spec.Name != "" {
+			name += ":" + spec.Name
+		}
+		compiled.steps = append(compiled.steps, step{name: name, checker: checker})
+	}
+	if policy.Images != nil {
+		images, err := compileImagePolicy(*policy.Images)
+		if err != nil {
+			return nil, fmt.Errorf("images: %v", err)
+		}
+		compiled.images = images
+	}
+	return compiled, nil
+}
+
+func compileCheck(spec CheckSpec) (Checker, error) {
+	switch spec.Type {
+	case "keywords", "regex":
+		action := spec.Action
+		if action == "" {
+			action = Reject
+		}
+		if action != Redact && action != Reject {
+			return nil, fmt.Errorf("action must be %s or %s", Redact, Reject)
+		}
+		pattern := spec.Pattern
+		if spec.Type == "keywords" {
+			if len(spec.Words) == 0 {
+				return nil, fmt.Errorf("keywords needs words")
+			}
+			quoted := make([]string, len(spec.Words))
+			for i, word := range spec.Words {
+				quoted[i] = regexp.QuoteMeta(strings.TrimSpace(word))
+			}
+			pattern = `(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`
+		}
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return &patternChecker{pattern: compiled, action: action, reason: spec.Reason}, nil
+
+	case "api":
+		if !strings.HasPrefix(spec.URL, "http://") && !strings.HasPrefix(spec.URL, "https://") {
+			return nil, fmt.Errorf("api needs an http(s) url")
+		}
+		timeout := 2 * time.Second
+		if spec.Timeout != "" {
+			parsed, err := time.ParseDuration(spec.Timeout)
+			if err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("invalid timeout %q", spec.Timeout)
+			}
+			timeout = parsed
+		}
+		onError := spec.OnError
+		if onError == "" {
+			onError = Allow
+		}
+		if onError != Allow && onError != Reject {
+			return nil, fmt.Errorf("on_error must be %s or %s", Allow, Reject)
+		}
+		return &apiChecker{url: spec.URL, client: &http.Client{Timeout: timeout}, onError: onError}, nil
+
+	case "plugin":
+		pluginsMutex.RLock()
+		checker, ok := plugins[spec.Name]
+		pluginsMutex.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("no plugin named %q", spec.Name)
+		}
+		return checker, nil
+	}
+	return nil, fmt.Errorf("unknown check type %q", spec.Type)
+}
+
+// patternChecker backs keyword lists and regular expressions
+type patternChecker struct {
+	pattern *regexp.Regexp
+	action  string
+	reason  string
+}
+
+func (p *patternChecker) Check(ctx context.Context, content Content) (Verdict, error) {
+	if !p.pattern.MatchString(content.Text) {
+		return Verdict{Action: Allow}, nil
+	}
+	if p.action == Reject {
+		return Verdict{Action: Reject, Reason: p.reason}, nil
+	}
+	redacted := p.pattern.ReplaceAllStringFunc(content.Text, func(match string) string {
+		return strings.Repeat("*", utf8.RuneCountInString(match))
+	})
+	return Verdict{Action: Redact, Text: redacted, Reason: p.reason}, nil
+}
+
+// apiChecker POSTs content as JSON and reads a verdict back
+type apiChecker struct {
+	url     string
+	client  *http.Client
+	onError string
+}
+
+func (a *apiChecker) Check(ctx context.Context, content Content) (Verdict, error) {
+	verdict, err := a.call(ctx, content)
+	if err != nil {
+		logging.Warn("content moderation api failed", map[string]interface{}{
+			"url":      a.url,
+			"on_error": a.onError,
+			"error":    err.Error(),
+		})
+		return Verdict{Action: a.onError, Reason: "moderation service unavailable"}, nil
+	}
+	return verdict, nil
+}
+
+func (a *apiChecker) call(ctx context.Context, content Content) (Verdict, error) {
+	body, err := json.Marshal(content)
+	if err != nil {
+		return Verdict{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return Verdict{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token := config.GetModerationAPIToken(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return Verdict{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Verdict{}, fmt.Errorf("api returned %s", resp.Status)
+	}
+
+	var verdict Verdict
+	if err := json.NewDecoder(resp.Body).Decode(&verdict); err != nil {
+		return Verdict{}, err
+	}
+	switch verdict.Action {
+	case Allow, Reject:
+	case Redact:
+		if verdict.Text == "" {
+			return Verdict{}, fmt.Errorf("redact verdict without text")
+		}
+	default:
+		return Verdict{}, fmt.Errorf("unknown action %q", verdict.Action)
+	}
+	return verdict, nil
+}
+
+// Screen runs content through its organization's policy. The verdict is
+// Allow with the text unchanged, Redact with the text to use instead, or
+// Reject. A failing plugin is skipped.
+func Screen(ctx context.Context, content Content) Verdict {
+	policiesMutex.RLock()
+	policy, ok := policies[content.Org]
+	if !ok {
+		policy, ok = policies[DefaultPolicy]
+	}
+	policiesMutex.RUnlock()
+
+	result := Verdict{Action: Allow, Text: content.Text}
+	if !ok || (len(policy.kinds) > 0 && !policy.kinds[content.Kind]) {
+		return result
+	}
+
+	for _, step := range policy.steps {
+		verdict, err := step.checker.Check(ctx, content)
+		if err != nil {
+			logging.Warn("content check failed, skipping it", map[string]interface{}{
+				"check": step.name,
+				"error": err.Error(),
+			})
+			continue
+		}
+		switch verdict.Action {
+		case Reject:
+			verdict.Check = step.name
+			logging.Info("content rejected", map[string]interface{}{
+				"kind":   content.Kind,
+				"org":    content.Org,
+				"world":  content.World,
+				"hd1_id": content.HD1ID,
+				"check":  step.name,
+				"reason": verdict.Reason,
+			})
+			return verdict
+		case Redact:
+			content.Text = verdict.Text
+			result = Verdict{Action: Redact, Text: verdict.Text, Reason: verdict.Reason, Check: step.name}
+		}
+	}
+	return result
+}
@@ -0,0 +1,313 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+)
+
+// Uploaded images, textures included, are classified before they are
+// stored when their organization's policy has an images section. A
+// classifier scores the image per label, such as nudity or violence; the
+// policy's thresholds turn the scores into a verdict. Flagged images are
+// held for a moderator to review, blocked ones are refused.
+
+// Flag holds content for review; images only
+const Flag = "flag"
+
+// Image is an uploaded image to classify
+type Image struct {
+	Org         string `json:"org"` // The uploader's session's, as for text
+	HD1ID       string `json:"hd1_id,omitempty"`
+	Digest      string `json:"digest"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+// Scores are a classifier's confidence per label, 0 to 1
+type Scores map[string]float64
+
+// ImageClassifier scores images. Plugins, such as local models, implement
+// it and register with RegisterImageClassifier.
+type ImageClassifier interface {
+	Classify(ctx context.Context, image Image, content io.Reader) (Scores, error)
+}
+
+var (
+	imageClassifiers      = map[string]ImageClassifier{}
+	imageClassifiersMutex sync.RWMutex
+)
+
+// RegisterImageClassifier makes a plugin available to policies as
+// {"classifier": "plugin", "name": name}. Plugins register from init
+// functions, before policies are loaded.
+func RegisterImageClassifier(name string, classifier ImageClassifier) {
+	imageClassifiersMutex.Lock()
+	defer imageClassifiersMutex.Unlock()
+	imageClassifiers[name] = classifier
+}
+
+// Threshold is the score of a label at which an image is flagged or
+// blocked; zero never does
+type Threshold struct {
+	Flag  float64 `json:"flag,omitempty"`
+	Block float64 `json:"block,omitempty"`
+}
+
+// ImagePolicy is the image section of an organization's policy
+type ImagePolicy struct {
+	Classifier string               `json:"classifier"`         // api, command or plugin
+	URL        string               `json:"url,omitempty"`      // api: endpoint to POST images to
+	Command    []string             `json:"command,omitempty"`  // command: executable and arguments
+	Name       string               `json:"name,omitempty"`     // plugin: registered name
+	Timeout    string               `json:"timeout,omitempty"`  // api, command: default 10s
+	OnError    string               `json:"on_error,omitempty"` // allow (default), flag or reject when classification fails
+	Thresholds map[string]Threshold `json:"thresholds"`
+}
+
+// ImageVerdict is the outcome of classifying an image: Allow, Flag or
+// Reject, the label that decided it and every score
+type ImageVerdict struct {
+	Action     string  `json:"action"`
+	Label      string  `json:"label,omitempty"`
+	Score      float64 `json:"score,omitempty"`
+	Scores     Scores  `json:"scores,omitempty"`
+	Reason     string  `json:"reason,omitempty"`
+	Classifier string  `json:"classifier,omitempty"`
+}
+
+type compiledImagePolicy struct {
+	name       string
+	classifier ImageClassifier
+	onError    string
+	thresholds map[string]Threshold
+}
+
+func compileImagePolicy(policy ImagePolicy) (*compiledImagePolicy, error) {
+	compiled := &compiledImagePolicy{name: policy.Classifier, onError: policy.OnError, thresholds: policy.Thresholds}
+	if compiled.onError == "" {
+		compiled.onError = Allow
+	}
+	if compiled.onError != Allow && compiled.onError != Flag && compiled.onError != Reject {
+		return nil, fmt.Errorf("on_error must be %s, %s or %s", Allow, Flag, Reject)
+	}
+	if len(policy.Thresholds) == 0 {
+		return nil, fmt.Errorf("thresholds required")
+	}
+	for label, threshold := range policy.Thresholds {
+		if threshold.Flag < 0 || threshold.Flag > 1 || threshold.Block < 0 || threshold.Block > 1 {
+			return nil, fmt.Errorf("threshold %q must be between 0 and 1", label)
+		}
+		if threshold.Flag == 0 && threshold.Block == 0 {
+			return nil, fmt.Errorf("threshold %q needs flag or block", label)
+		}
+	}
+
+	timeout := 10 * time.Second
+	if policy.Timeout != "" {
+		parsed, err := time.ParseDuration(policy.Timeout)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q", policy.Timeout)
+		}
+		timeout = parsed
+	}
+
+	switch policy.Classifier {
+	case "api":
+		if !strings.HasPrefix(policy.URL, "http://") && !strings.HasPrefix(policy.URL, "https://") {
+			return nil, fmt.Errorf("api classifier needs an http(s) url")
+		}
+		compiled.classifier = &apiClassifier{url: policy.URL, client: &http.Client{Timeout: timeout}}
+	case "command":
+		if len(policy.Command) == 0 {
+			return nil, fmt.Errorf("command classifier needs a command")
+		}
+		compiled.classifier = &commandClassifier{argv: policy.Command, timeout: timeout}
+	case "plugin":
+		imageClassifiersMutex.RLock()
+		classifier, ok := imageClassifiers[policy.Name]
+		imageClassifiersMutex.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("no image classifier named %q", policy.Name)
+		}
+		compiled.classifier = classifier
+		compiled.name += ":" + policy.Name
+	default:
+		return nil, fmt.Errorf("unknown classifier %q", policy.Classifier)
+	}
+	return compiled, nil
+}
+
+// judge turns scores into a verdict: the label furthest past its block
+// threshold rejects, otherwise the one furthest past its flag threshold
+// flags
+func (p *compiledImagePolicy) judge(scores Scores) ImageVerdict {
+	labels := make([]string, 0, len(scores))
+	for label := range scores {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	verdict := ImageVerdict{Action: Allow, Scores: scores, Classifier: p.name}
+	for _, label := range labels {
+		threshold, ok := p.thresholds[label]
+		if !ok {
+			continue
+		}
+		score := scores[label]
+		switch {
+		case threshold.Block > 0 && score >= threshold.Block:
+			if verdict.Action != Reject || score > verdict.Score {
+				verdict.Action, verdict.Label, verdict.Score = Reject, label, score
+			}
+		case threshold.Flag > 0 && score >= threshold.Flag && verdict.Action != Reject:
+			if verdict.Action != Flag || score > verdict.Score {
+				verdict.Action, verdict.Label, verdict.Score = Flag, label, score
+			}
+		}
+	}
+	if verdict.Action != Allow {
+		verdict.Reason = fmt.Sprintf("%s %.2f", verdict.Label, verdict.Score)
+	}
+	return verdict
+}
+
+// ClassifiesImages reports whether uploads of an organization are classified
+func ClassifiesImages(org string) bool {
+	return imagePolicy(org) != nil
+}
+
+func imagePolicy(org string) *compiledImagePolicy {
+	policiesMutex.RLock()
+	defer policiesMutex.RUnlock()
+	policy, ok := policies[org]
+	if !ok {
+		policy, ok = policies[DefaultPolicy]
+	}
+	if !ok {
+		return nil
+	}
+	return policy.images
+}
+
+// ScreenImage classifies an image under its organization's policy. The
+// verdict is Allow when the policy has no images section.
+func ScreenImage(ctx context.Context, image Image, content io.Reader) ImageVerdict {
+	policy := imagePolicy(image.Org)
+	if policy == nil {
+		return ImageVerdict{Action: Allow}
+	}
+
+	scores, err := policy.classifier.Classify(ctx, image, content)
+	if err != nil {
+		logging.Warn("image classification failed", map[string]interface{}{
+			"classifier": policy.name,
+			"digest":     image.Digest,
+			"on_error":   policy.onError,
+			"error":      err.Error(),
+		})
+		return ImageVerdict{Action: policy.onError, Reason: "image classifier unavailable", Classifier: policy.name}
+	}
+
+	verdict := policy.judge(scores)
+	if verdict.Action != Allow {
+		logging.Info("image screened", map[string]interface{}{
+			"action":     verdict.Action,
+			"org":        image.Org,
+			"hd1_id":     image.HD1ID,
+			"digest":     image.Digest,
+			"classifier": policy.name,
+			"label":      verdict.Label,
+			"score":      verdict.Score,
+		})
+	}
+	return verdict
+}
+
+// classification is the reply of api and command classifiers
+type classification struct {
+	Scores Scores `json:"scores"`
+}
+
+func (c classification) check() (Scores, error) {
+	for label, score := range c.Scores {
+		if score < 0 || score > 1 {
+			return nil, fmt.Errorf("score of %q out of range: %g", label, score)
+		}
+	}
+	if c.Scores == nil {
+		return Scores{}, nil
+	}
+	return c.Scores, nil
+}
+
+// apiClassifier POSTs the image and reads its scores back
+type apiClassifier struct {
+	url    string
+	client *http.Client
+}
+
+func (a *apiClassifier) Classify(ctx context.Context, image Image, content io.Reader) (Scores, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, io.NopCloser(content))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = image.Size
+	req.Header.Set("Content-Type", image.ContentType)
+	req.Header.Set("X-HD1-Org", image.Org)
+	if token := config.GetModerationAPIToken(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("api returned %s", resp.Status)
+	}
+
+	var reply classification
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&reply); err != nil {
+		return nil, err
+	}
+	return reply.check()
+}
+
+// commandClassifier runs a local model: the image on stdin, its scores
+// as JSON on stdout
+type commandClassifier struct {
+	argv    []string
+	timeout time.Duration
+}
+
+func (c *commandClassifier) Classify(ctx context.Context, image Image, content io.Reader) (Scores, error) {
+	runCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(runCtx, c.argv[0], c.argv[1:]...)
+	cmd.Stdin = content
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", c.argv[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	var reply classification
+	if err := json.Unmarshal(stdout.Bytes(), &reply); err != nil {
+		return nil, fmt.Errorf("%s: invalid output: %v", c.argv[0], err)
+	}
+	return reply.check()
+}
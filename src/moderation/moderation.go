@@ -0,0 +1,420 @@
+// Package moderation keeps the per-world kicks, bans and mutes moderators
+// impose, and the audit log of every action they take.
+//
+// A ban matches a session by its HD1 ID, or a network by IP address or
+// CIDR range, and lasts until it expires or is lifted. Bans are written to
+// the storage backend and survive restarts. Mutes silence a session's
+// captions; sessions do not outlive the server, so mutes stay in memory.
+// Audit entries are stored one object each, named in time order.
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"holodeck1/logging"
+	"holodeck1/storage"
+)
+
+// Moderation actions, as recorded in the audit log and sent to clients
+const (
+	ActionKick   = "kick"
+	ActionBan    = "ban"
+	ActionUnban  = "unban"
+	ActionMute   = "mute"
+	ActionUnmute = "unmute"
+)
+
+// Impersonation actions, as recorded in the audit log: support staff
+// starting and ending to act as a session, and each call made as it
+const (
+	ActionImpersonate        = "impersonate"
+	ActionImpersonateEnd     = "impersonate_end"
+	ActionImpersonateRequest = "impersonate_request"
+)
+
+// ErrNotFound is returned for unknown or expired bans and mutes
+var ErrNotFound = errors.New("not found")
+
+var (
+	idPattern    = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+	hd1IDPattern = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,128}$`)
+)
+
+// MaxReasonLength bounds the reason shown to moderated clients
+const MaxReasonLength = 500
+
+// Ban keeps a session or a network out of a world
+type Ban struct {
+	ID        string     `json:"id"`
+	World     string     `json:"world"`
+	HD1ID     string     `json:"hd1_id,omitempty"`
+	IP        string     `json:"ip,omitempty"` // Address or CIDR range
+	Reason    string     `json:"reason,omitempty"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // Permanent when absent
+}
+
+// Validate checks a ban before it is stored
+func (b *Ban) Validate() error {
+	if !idPattern.MatchString(b.ID) {
+		return fmt.Errorf("id must match %s", idPattern)
+	}
+	if !idPattern.MatchString(b.World) {
+		return fmt.Errorf("world must match %s", idPattern)
+	}
+	if (b.HD1ID == "") == (b.IP == "") {
+		return fmt.Errorf("a ban needs exactly one of hd1_id and ip")
+	}
+	if b.HD1ID != "" && !hd1IDPattern.MatchString(b.HD1ID) {
+		return fmt.Errorf("invalid hd1_id")
+	}
+	if b.IP != "" && net.ParseIP(b.IP) == nil {
+		if _, _, err := net.ParseCIDR(b.IP); err != nil {
+			return fmt.Errorf("ip must be an address or CIDR range")
+		}
+	}
+	if len(b.Reason) > MaxReasonLength {
+		return fmt.Errorf("reason longer than %d characters", MaxReasonLength)
+	}
+	return nil
+}
+
+func (b *Ban) expired(now time.Time) bool {
+	return b.ExpiresAt != nil && !now.Before(*b.ExpiresAt)
+}
+
+// Matches reports whether a ban covers a session or the address it
+// connects from. Either may be empty.
+func (b *Ban) Matches(hd1ID, ip string) bool {
+	if b.HD1ID != "" {
+		return hd1ID != "" && hd1ID == b.HD1ID
+	}
+	address := net.ParseIP(ip)
+	if address == nil {
+		return false
+	}
+	if banned := net.ParseIP(b.IP); banned != nil {
+		return banned.Equal(address)
+	}
+	_, network, err := net.ParseCIDR(b.IP)
+	return err == nil && network.Contains(address)
+}
+
+// Mute silences a session in a world
+type Mute struct {
+	World     string     `json:"world"`
+	HD1ID     string     `json:"hd1_id"`
+	Reason    string     `json:"reason,omitempty"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // Until unmuted when absent
+}
+
+func (m *Mute) expired(now time.Time) bool {
+	return m.ExpiresAt != nil && !now.Before(*m.ExpiresAt)
+}
+
+// Entry is one audit log record
+type Entry struct {
+	ID        string     `json:"id"`
+	World     string     `json:"world"`
+	Action    string     `json:"action"`
+	HD1ID     string     `json:"hd1_id,omitempty"`
+	IP        string     `json:"ip,omitempty"`
+	BanID     string     `json:"ban_id,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+	Moderator string     `json:"moderator"`
+	Sessions  int        `json:"sessions"` // Connected sessions affected
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Timestamp time.Time  `json:"timestamp"`
+
+	Impersonation string `json:"impersonation_id,omitempty"` // Impersonation the action was taken under
+	Request       string `json:"request,omitempty"`          // Method, path and status of an impersonated call
+}
+
+// NewBanID generates a ban ID
+func NewBanID() string {
+	return "ban-" + uuid.New().String()
+}
+
+// Expiry turns a duration in seconds into an expiry time; zero never expires
+func Expiry(seconds int64, now time.Time) *time.Time {
+	if seconds <= 0 {
+		return nil
+	}
+	expires := now.Add(time.Duration(seconds) * time.Second)
+	return &expires
+}
+
+var (
+	bans  = make(map[string]*Ban)
+	mutes = make(map[string]*Mute) // Keyed by world and HD1 ID
+	mutex sync.RWMutex
+)
+
+func muteKey(world, hd1ID string) string {
+	return world + "/" + hd1ID
+}
+
+func banKey(b *Ban) (string, error) {
+	return storage.Key(storage.NamespaceWorlds, b.World+"/bans/"+b.ID+".json")
+}
+
+// Initialize loads bans from the storage backend, dropping expired ones
+func Initialize(ctx context.Context) error {
+	backend := storage.Default()
+	if backend == nil {
+		return fmt.Errorf("storage backend unavailable")
+	}
+	objects, err := backend.List(ctx, storage.NamespaceWorlds+"/")
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	loaded := 0
+	for _, object := range objects {
+		if !strings.Contains(object.Key, "/bans/") || !strings.HasSuffix(object.Key, ".json") {
+			continue
+		}
+		body, _, err := backend.Get(ctx, object.Key)
+		if err != nil {
+			continue
+		}
+		var ban Ban
+		err = json.NewDecoder(body).Decode(&ban)
+		body.Close()
+		if err != nil || ban.Validate() != nil {
+			logging.Warn("skipping unreadable ban", map[string]interface{}{"key": object.Key})
+			continue
+		}
+		if ban.expired(now) {
+			backend.Delete(ctx, object.Key)
+			continue
+		}
+		mutex.Lock()
+		bans[ban.ID] = &ban
+		mutex.Unlock()
+		loaded++
+	}
+
+	logging.Info("moderation bans loaded", map[string]interface{}{
+		"bans": loaded,
+	})
+	return nil
+}
+
+func put(ctx context.Context, key string, value interface{}) error {
+	backend := storage.Default()
+	if backend == nil {
+		return fmt.Errorf("storage backend unavailable")
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return backend.Put(ctx, key, bytes.NewReader(encoded), int64(len(encoded)), "application/json")
+}
+
+// AddBan stores a new ban
+func AddBan(ctx context.Context, ban *Ban) error {
+	if err := ban.Validate(); err != nil {
+		return err
+	}
+	key, err := banKey(ban)
+	if err != nil {
+		return err
+	}
+	if err := put(ctx, key, ban); err != nil {
+		return err
+	}
+	mutex.Lock()
+	bans[ban.ID] = ban
+	mutex.Unlock()
+	return nil
+}
+
+// RemoveBan lifts a ban and deletes its stored copy
+func RemoveBan(ctx context.Context, world, id string) (*Ban, error) {
+	mutex.Lock()
+	ban, ok := bans[id]
+	if ok && ban.World == world {
+		delete(bans, id)
+	}
+	mutex.Unlock()
+	if !ok || ban.World != world {
+		return nil, ErrNotFound
+	}
+
+	if backend := storage.Default(); backend != nil {
+		if key, err := banKey(ban); err == nil {
+			if err := backend.Delete(ctx, key); err != nil && err != storage.ErrNotFound {
+				return ban, err
+			}
+		}
+	}
+	return ban, nil
+}
+
+// Bans returns a world's live bans, oldest first
+func Bans(world string) []*Ban {
+	now := time.Now()
+	mutex.RLock()
+	result := []*Ban{}
+	for _, ban := range bans {
+		if ban.World == world && !ban.expired(now) {
+			result = append(result, ban)
+		}
+	}
+	mutex.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result
+}
+
+// Banned returns the ban keeping a session or address out of a world, or nil
+func Banned(world, hd1ID, ip string) *Ban {
+	now := time.Now()
+	mutex.RLock()
+	defer mutex.RUnlock()
+	for _, ban := range bans {
+		if ban.World == world && !ban.expired(now) && ban.Matches(hd1ID, ip) {
+			return ban
+		}
+	}
+	return nil
+}
+
+// AddMute silences a session, replacing any earlier mute
+func AddMute(mute *Mute) error {
+	if !idPattern.MatchString(mute.World) {
+		return fmt.Errorf("world must match %s", idPattern)
+	}
+	if !hd1IDPattern.MatchString(mute.HD1ID) {
+		return fmt.Errorf("invalid hd1_id")
+	}
+	if len(mute.Reason) > MaxReasonLength {
+		return fmt.Errorf("reason longer than %d characters", MaxReasonLength)
+	}
+	mutex.Lock()
+	mutes[muteKey(mute.World, mute.HD1ID)] = mute
+	mutex.Unlock()
+	return nil
+}
+
+// RemoveMute lets a session speak again
+func RemoveMute(world, hd1ID string) (*Mute, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	mute, ok := mutes[muteKey(world, hd1ID)]
+	delete(mutes, muteKey(world, hd1ID))
+	if !ok || mute.expired(time.Now()) {
+		return nil, ErrNotFound
+	}
+	return mute, nil
+}
+
+// Muted returns the mute silencing a session in a world, or nil
+func Muted(world, hd1ID string) *Mute {
+	mutex.RLock()
+	mute, ok := mutes[muteKey(world, hd1ID)]
+	mutex.RUnlock()
+	if !ok || mute.expired(time.Now()) {
+		return nil
+	}
+	return mute
+}
+
+// Mutes returns a world's live mutes, oldest first
+func Mutes(world string) []*Mute {
+	now := time.Now()
+	mutex.Lock()
+	result := []*Mute{}
+	for key, mute := range mutes {
+		if mute.expired(now) {
+			delete(mutes, key)
+		} else if mute.World == world {
+			result = append(result, mute)
+		}
+	}
+	mutex.Unlock()
+
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result
+}
+
+// Record appends an entry to a world's audit log and the server log
+func Record(ctx context.Context, entry *Entry) error {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	// Time-ordered IDs keep the stored log in order
+	id, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+	entry.ID = id.String()
+
+	logging.Info("moderation action", map[string]interface{}{
+		"world":     entry.World,
+		"action":    entry.Action,
+		"hd1_id":    entry.HD1ID,
+		"ip":        entry.IP,
+		"ban_id":    entry.BanID,
+		"reason":    entry.Reason,
+		"moderator": entry.Moderator,
+		"sessions":  entry.Sessions,
+	})
+
+	key, err := storage.Key(storage.NamespaceWorlds, entry.World+"/audit/"+entry.ID+".json")
+	if err != nil {
+		return err
+	}
+	return put(ctx, key, entry)
+}
+
+// Audit returns a world's most recent audit entries, newest first
+func Audit(ctx context.Context, world string, limit int) ([]*Entry, error) {
+	backend := storage.Default()
+	if backend == nil {
+		return nil, fmt.Errorf("storage backend unavailable")
+	}
+	if !idPattern.MatchString(world) {
+		return nil, fmt.Errorf("invalid world id: %q", world)
+	}
+	objects, err := backend.List(ctx, storage.NamespaceWorlds+"/"+world+"/audit/")
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key > objects[j].Key })
+
+	entries := []*Entry{}
+	for _, object := range objects {
+		if limit > 0 && len(entries) >= limit {
+			break
+		}
+		body, _, err := backend.Get(ctx, object.Key)
+		if err != nil {
+			continue
+		}
+		var entry Entry
+		err = json.NewDecoder(body).Decode(&entry)
+		body.Close()
+		if err == nil {
+			entries = append(entries, &entry)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,156 @@
+// Package movement keeps avatars from moving faster than the world allows.
+//
+// Every avatar has a distance budget that refills at the maximum speed, up
+// to the maximum step, the furthest a single move may go however long the
+// avatar stood still. A move costs its straight-line distance from the last
+// accepted position. A move over budget is impossible: it is either clamped
+// to the budget along its direction or rejected, leaving the avatar where
+// it was. Both limits are scaled by the world's tolerance, which absorbs
+// network jitter; a tolerance of 0 turns checks off for a world.
+//
+// The first move of an avatar, or its first after it left or stood still
+// for ten minutes, sets where it is.
+package movement
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+)
+
+// Actions for impossible moves
+const (
+	ActionClamp  = "clamp"
+	ActionReject = "reject"
+)
+
+// forgetAfter drops avatars that have not moved for this long
+const forgetAfter = 10 * time.Minute
+
+// Position is a point in world space, in metres
+type Position struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+// distance returns the straight-line distance to another position
+func (p Position) distance(to Position) float64 {
+	return math.Sqrt((to.X-p.X)*(to.X-p.X) + (to.Y-p.Y)*(to.Y-p.Y) + (to.Z-p.Z)*(to.Z-p.Z))
+}
+
+// Violation is returned for an impossible move
+type Violation struct {
+	Distance float64 // Metres the move would have covered
+	Allowed  float64 // Metres the avatar had budget for
+	Clamped  bool    // The move was shortened rather than rejected
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("move of %.2fm exceeds the %.2fm allowed", v.Distance, v.Allowed)
+}
+
+type avatar struct {
+	position Position
+	budget   float64
+	updated  time.Time
+}
+
+var (
+	avatars   = map[string]*avatar{}
+	lastSweep time.Time
+	mutex     sync.Mutex
+)
+
+// Check validates a move of an avatar in a world and returns the position
+// to apply. A clamped move returns the shortened position with a
+// violation; a rejected one returns the current position.
+func Check(avatarID, world string, to Position) (Position, *Violation) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	now := time.Now()
+	sweep(now)
+
+	current, known := avatars[avatarID]
+	tolerance := config.GetAvatarsMoveTolerance(world)
+	if !known || tolerance == 0 {
+		avatars[avatarID] = &avatar{position: to, updated: now}
+		return to, nil
+	}
+
+	maxStep := config.GetAvatarsMaxStep() * tolerance
+	if maxStep == 0 {
+		maxStep = math.Inf(1)
+	}
+	if speed := config.GetAvatarsMaxSpeed() * tolerance; speed > 0 {
+		current.budget = math.Min(current.budget+speed*now.Sub(current.updated).Seconds(), maxStep)
+	} else {
+		current.budget = maxStep
+	}
+	current.updated = now
+
+	distance := current.position.distance(to)
+	if distance <= current.budget {
+		current.budget -= distance
+		current.position = to
+		return to, nil
+	}
+
+	violation := &Violation{Distance: distance, Allowed: current.budget}
+	if config.GetAvatarsMoveAction() == ActionClamp {
+		ratio := current.budget / distance
+		current.position = Position{
+			X: current.position.X + (to.X-current.position.X)*ratio,
+			Y: current.position.Y + (to.Y-current.position.Y)*ratio,
+			Z: current.position.Z + (to.Z-current.position.Z)*ratio,
+		}
+		current.budget = 0
+		violation.Clamped = true
+	}
+
+	logging.Warn("impossible avatar move", map[string]interface{}{
+		"avatar_id": avatarID,
+		"world":     world,
+		"distance":  fmt.Sprintf("%.2f", violation.Distance),
+		"allowed":   fmt.Sprintf("%.2f", violation.Allowed),
+		"clamped":   violation.Clamped,
+	})
+	return current.position, violation
+}
+
+// Place puts an avatar somewhere without moving it there, such as at a
+// saved view; it keeps the budget it had
+func Place(avatarID string, to Position) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if current, known := avatars[avatarID]; known {
+		current.position = to
+		return
+	}
+	avatars[avatarID] = &avatar{position: to, updated: time.Now()}
+}
+
+// Forget drops an avatar that left
+func Forget(avatarID string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	delete(avatars, avatarID)
+}
+
+// sweep drops avatars that stopped moving; callers hold the mutex
+func sweep(now time.Time) {
+	if now.Sub(lastSweep) < time.Minute {
+		return
+	}
+	lastSweep = now
+	for id, avatar := range avatars {
+		if now.Sub(avatar.updated) >= forgetAfter {
+			delete(avatars, id)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+// Package numbers holds the checks and rounding that scene values share.
+package numbers
+
+import "math"
+
+// Within reports whether a value is a number in [min, max]
+func Within(value, min, max float64) bool {
+	return !math.IsNaN(value) && value >= min && value <= max
+}
+
+// Round rounds a value to a number of decimals, halves away from zero,
+// dropping the float noise of arithmetic; it never returns -0
+func Round(value float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	rounded := math.Round(value*scale) / scale
+	if rounded == 0 {
+		return 0
+	}
+	return rounded
+}
@@ -0,0 +1,371 @@
+// Package panels defines text and UI panel entities: world-space labels,
+// billboards that always face the viewer, and panels fixed in the world,
+// the building blocks of signage and dashboards.
+//
+// Content is submitted as plain text, markdown or a small subset of HTML
+// and laid out by the server into blocks - headings, paragraphs, list
+// items, code and rules - of plain text. Clients draw the blocks and never
+// interpret markup, so every client shows the same thing and content can
+// carry no script or styling.
+package panels
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Kinds of panel
+const (
+	KindLabel     = "label"     // A line of text facing the viewer
+	KindBillboard = "billboard" // Content on a card facing the viewer
+	KindPanel     = "panel"     // Content on a card oriented with the entity
+)
+
+// Content formats
+const (
+	FormatText     = "text"
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+)
+
+// Block styles
+const (
+	StyleH1        = "h1"
+	StyleH2        = "h2"
+	StyleH3        = "h3"
+	StyleParagraph = "p"
+	StyleListItem  = "li"
+	StyleCode      = "code"
+	StyleRule      = "hr"
+)
+
+// Limits of a valid panel
+const (
+	maxContent    = 8192 // Bytes of submitted content
+	maxLabel      = 200  // Characters of a label
+	maxBlocks     = 200
+	maxDimension  = 50 // Metres
+	defaultWidth  = 2
+	defaultHeight = 1.5
+)
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Block is a laid-out piece of content
+type Block struct {
+	Style string `json:"style"`
+	Text  string `json:"text,omitempty"`
+}
+
+// Panel is the panel component of an entity
+type Panel struct {
+	Kind       string  `json:"kind"`                 // label, billboard or panel
+	Format     string  `json:"format,omitempty"`     // text, markdown or html; text when unset
+	Content    string  `json:"content"`              // As submitted
+	Width      float64 `json:"width,omitempty"`      // Metres; labels size to their text
+	Height     float64 `json:"height,omitempty"`     // Metres; for labels, the text height
+	Color      string  `json:"color,omitempty"`      // Text colour
+	Background string  `json:"background,omitempty"` // Card colour, transparent when unset
+	Blocks     []Block `json:"blocks"`               // Laid out by the server; clients draw these
+}
+
+// Layout validates a panel, fills in defaults and lays out its content
+func (p *Panel) Layout() error {
+	switch p.Kind {
+	case KindLabel:
+		if p.Format != "" && p.Format != FormatText {
+			return errors.New("labels take plain text")
+		}
+		if utf8.RuneCountInString(p.Content) > maxLabel || strings.Contains(p.Content, "\n") {
+			return fmt.Errorf("labels take one line of at most %d characters", maxLabel)
+		}
+		if p.Height == 0 {
+			p.Height = 0.3
+		}
+	case KindBillboard, KindPanel:
+		if p.Width == 0 {
+			p.Width = defaultWidth
+		}
+		if p.Height == 0 {
+			p.Height = defaultHeight
+		}
+	default:
+		return fmt.Errorf("unknown panel kind: %q (label, billboard or panel)", p.Kind)
+	}
+	if p.Format == "" {
+		p.Format = FormatText
+	}
+
+	if len(p.Content) > maxContent {
+		return fmt.Errorf("content exceeds %d bytes", maxContent)
+	}
+	if !utf8.ValidString(p.Content) {
+		return errors.New("content must be UTF-8")
+	}
+	for _, dimension := range []float64{p.Width, p.Height} {
+		if math.IsNaN(dimension) || dimension < 0 || dimension > maxDimension {
+			return fmt.Errorf("width and height must be within 0-%dm", maxDimension)
+		}
+	}
+	if p.Color == "" {
+		p.Color = "#ffffff"
+	}
+	for _, color := range []string{p.Color, p.Background} {
+		if color != "" && !colorPattern.MatchString(color) {
+			return fmt.Errorf("colors must be #rrggbb, got %q", color)
+		}
+	}
+
+	var blocks []Block
+	switch p.Format {
+	case FormatText:
+		blocks = layoutText(p.Content)
+	case FormatMarkdown:
+		blocks = layoutMarkdown(p.Content)
+	case FormatHTML:
+		var err error
+		if blocks, err = layoutHTML(p.Content); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown format: %q (text, markdown or html)", p.Format)
+	}
+	if len(blocks) > maxBlocks {
+		return fmt.Errorf("content lays out to %d blocks, at most %d", len(blocks), maxBlocks)
+	}
+	if blocks == nil {
+		blocks = []Block{}
+	}
+	p.Blocks = blocks
+	return nil
+}
+
+// PlainText returns the panel's text without layout, for screen readers
+func (p *Panel) PlainText() string {
+	var parts []string
+	for _, block := range p.Blocks {
+		if block.Text != "" {
+			parts = append(parts, block.Text)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Data returns the panel as entity operation data
+func (p *Panel) Data() map[string]interface{} {
+	var data map[string]interface{}
+	encoded, _ := json.Marshal(p)
+	json.Unmarshal(encoded, &data)
+	return data
+}
+
+// Decode reads and lays out a panel from entity operation data
+func Decode(value interface{}) (*Panel, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var panel Panel
+	if err := json.Unmarshal(encoded, &panel); err != nil {
+		return nil, fmt.Errorf("invalid panel: %v", err)
+	}
+	if err := panel.Layout(); err != nil {
+		return nil, err
+	}
+	return &panel, nil
+}
+
+// layoutText makes a paragraph of each run of non-blank lines
+func layoutText(content string) []Block {
+	var blocks []Block
+	for _, paragraph := range regexp.MustCompile(`\n\s*\n`).Split(strings.TrimSpace(content), -1) {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			blocks = append(blocks, Block{Style: StyleParagraph, Text: paragraph})
+		}
+	}
+	return blocks
+}
+
+var (
+	orderedItem = regexp.MustCompile(`^(\d+)[.)]\s+(.*)$`)
+	mdLink      = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	mdEmphasis  = regexp.MustCompile("\\*\\*|__|`|~~")
+)
+
+// layoutMarkdown handles headings, lists, fenced code, rules and
+// paragraphs; inline markup is reduced to its text
+func layoutMarkdown(content string) []Block {
+	var blocks []Block
+	var paragraph, code []string
+	inCode := false
+	flush := func() {
+		if len(paragraph) > 0 {
+			blocks = append(blocks, Block{Style: StyleParagraph, Text: inline(strings.Join(paragraph, " "))})
+			paragraph = nil
+		}
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			flush()
+			if inCode {
+				blocks = append(blocks, Block{Style: StyleCode, Text: strings.Join(code, "\n")})
+				code = nil
+			}
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			code = append(code, line)
+			continue
+		}
+
+		switch {
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "### "):
+			flush()
+			blocks = append(blocks, Block{Style: StyleH3, Text: inline(trimmed[4:])})
+		case strings.HasPrefix(trimmed, "## "):
+			flush()
+			blocks = append(blocks, Block{Style: StyleH2, Text: inline(trimmed[3:])})
+		case strings.HasPrefix(trimmed, "# "):
+			flush()
+			blocks = append(blocks, Block{Style: StyleH1, Text: inline(trimmed[2:])})
+		case trimmed == "---" || trimmed == "***":
+			flush()
+			blocks = append(blocks, Block{Style: StyleRule})
+		case strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* "):
+			flush()
+			blocks = append(blocks, Block{Style: StyleListItem, Text: "• " + inline(trimmed[2:])})
+		case orderedItem.MatchString(trimmed):
+			flush()
+			match := orderedItem.FindStringSubmatch(trimmed)
+			blocks = append(blocks, Block{Style: StyleListItem, Text: match[1] + ". " + inline(match[2])})
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flush()
+	if inCode && len(code) > 0 {
+		blocks = append(blocks, Block{Style: StyleCode, Text: strings.Join(code, "\n")})
+	}
+	return blocks
+}
+
+// inline reduces links to their text and drops emphasis markers
+func inline(text string) string {
+	return strings.TrimSpace(mdEmphasis.ReplaceAllString(mdLink.ReplaceAllString(text, "$1"), ""))
+}
+
+// htmlBlocks maps block elements to styles; other allowed elements are
+// inline and only contribute their text
+var htmlBlocks = map[string]string{
+	"h1": StyleH1, "h2": StyleH2, "h3": StyleH3, "h4": StyleH3,
+	"p": StyleParagraph, "div": StyleParagraph, "li": StyleListItem,
+	"pre": StyleCode, "hr": StyleRule,
+}
+
+var htmlInline = map[string]bool{
+	"b": true, "strong": true, "i": true, "em": true, "u": true, "code": true,
+	"span": true, "a": true, "small": true, "br": true, "ul": true, "ol": true,
+}
+
+// htmlDropped elements are removed with their content
+var htmlDropped = map[string]bool{"script": true, "style": true, "template": true}
+
+// layoutHTML lays out the allowed subset of HTML; attributes are ignored
+// and unknown elements refused
+func layoutHTML(content string) ([]Block, error) {
+	decoder := xml.NewDecoder(strings.NewReader("<root>" + content + "</root>"))
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+
+	var blocks []Block
+	var text strings.Builder
+	style := StyleParagraph
+	var lists []int // Next number of each open list, 0 for bullets
+	dropped := 0
+	flush := func() {
+		if collapsed := strings.Join(strings.Fields(text.String()), " "); collapsed != "" || style == StyleRule {
+			blocks = append(blocks, Block{Style: style, Text: collapsed})
+		}
+		text.Reset()
+		style = StyleParagraph
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid html: %v", err)
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			name := strings.ToLower(element.Name.Local)
+			switch {
+			case name == "root":
+			case htmlDropped[name]:
+				dropped++
+			case htmlBlocks[name] != "":
+				flush()
+				style = htmlBlocks[name]
+				if name == "li" && len(lists) > 0 {
+					if number := lists[len(lists)-1]; number > 0 {
+						text.WriteString(strconv.Itoa(number) + ". ")
+						lists[len(lists)-1]++
+					} else {
+						text.WriteString("• ")
+					}
+				}
+			case htmlInline[name]:
+				switch name {
+				case "ul":
+					lists = append(lists, 0)
+				case "ol":
+					lists = append(lists, 1)
+				case "br":
+					text.WriteString(" ")
+				}
+			default:
+				return nil, fmt.Errorf("html element <%s> is not allowed", name)
+			}
+		case xml.EndElement:
+			name := strings.ToLower(element.Name.Local)
+			switch {
+			case htmlDropped[name]:
+				dropped--
+			case htmlBlocks[name] != "":
+				if name == "pre" {
+					blocks = append(blocks, Block{Style: StyleCode, Text: strings.Trim(text.String(), "\n")})
+					text.Reset()
+					style = StyleParagraph
+				} else {
+					flush()
+				}
+			case name == "ul" || name == "ol":
+				if len(lists) > 0 {
+					lists = lists[:len(lists)-1]
+				}
+			}
+		case xml.CharData:
+			if dropped == 0 {
+				text.Write(element)
+			}
+		}
+	}
+	flush()
+	return blocks, nil
+}
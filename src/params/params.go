@@ -0,0 +1,329 @@
+// Package params stores a world's parameters: typed values operators set
+// through the API and the server reads where a world's behaviour would
+// otherwise be code, such as a door's opening speed or a partner's API key.
+//
+// A parameter is a string, a number, a bool or any JSON value. Secret
+// parameters are never returned by the API once set; only the server reads
+// them, so they suit credentials plugins use. Binding expressions read
+// parameters with param('key') and webhook templates with .params, both
+// only those that are not secret. Plugins read any of them with Get and
+// the typed String, Number and Bool, and may follow changes with OnChange.
+//
+// Each world's parameters are written to the storage backend as one
+// object, so they survive restarts and are backed up with the world.
+package params
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"holodeck1/logging"
+	"holodeck1/storage"
+)
+
+// Parameter types
+const (
+	TypeString = "string"
+	TypeNumber = "number"
+	TypeBool   = "bool"
+	TypeJSON   = "json"
+)
+
+// Limits of a world's parameters
+const (
+	MaxParams            = 200
+	MaxValueSize         = 16 << 10 // Bytes of a value as JSON
+	MaxDescriptionLength = 500
+)
+
+// ErrNotFound is returned for unknown parameters
+var ErrNotFound = errors.New("parameter not found")
+
+// ErrTooMany is returned when a world holds its maximum of parameters
+var ErrTooMany = fmt.Errorf("worlds hold at most %d parameters", MaxParams)
+
+var (
+	keyPattern   = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]{0,63}$`)
+	worldPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+)
+
+// Param is a world's parameter
+type Param struct {
+	Key         string      `json:"key"`
+	Type        string      `json:"type"`
+	Value       interface{} `json:"value,omitempty"` // Absent from the API when secret
+	Secret      bool        `json:"secret"`
+	Description string      `json:"description,omitempty"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+	UpdatedBy   string      `json:"updated_by,omitempty"`
+}
+
+// TypeOf returns the type of a decoded JSON value
+func TypeOf(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return TypeString
+	case float64:
+		return TypeNumber
+	case bool:
+		return TypeBool
+	}
+	return TypeJSON
+}
+
+// Validate checks a parameter's key and that its value is of its type
+func (p *Param) Validate() error {
+	if !keyPattern.MatchString(p.Key) {
+		return fmt.Errorf("key must match %s", keyPattern)
+	}
+	if len(p.Description) > MaxDescriptionLength {
+		return fmt.Errorf("description longer than %d characters", MaxDescriptionLength)
+	}
+	if p.Value == nil {
+		return errors.New("value required")
+	}
+	switch p.Type {
+	case TypeString, TypeBool:
+		if TypeOf(p.Value) != p.Type {
+			return fmt.Errorf("value is not a %s", p.Type)
+		}
+	case TypeNumber:
+		number, ok := p.Value.(float64)
+		if !ok || math.IsNaN(number) || math.IsInf(number, 0) {
+			return errors.New("value is not a number")
+		}
+	case TypeJSON:
+	default:
+		return fmt.Errorf("type must be %s, %s, %s or %s", TypeString, TypeNumber, TypeBool, TypeJSON)
+	}
+	encoded, err := json.Marshal(p.Value)
+	if err != nil {
+		return err
+	}
+	if len(encoded) > MaxValueSize {
+		return fmt.Errorf("value larger than %d bytes", MaxValueSize)
+	}
+	return nil
+}
+
+// Redacted returns the parameter as the API shows it: without its value
+// when secret
+func (p *Param) Redacted() *Param {
+	copied := *p
+	if copied.Secret {
+		copied.Value = nil
+	}
+	return &copied
+}
+
+var (
+	worlds    = make(map[string]map[string]*Param)
+	watchers  []func(world, key string)
+	mutex     sync.RWMutex
+	saveMutex sync.Mutex // Orders writes of a world's object
+)
+
+func paramsKey(world string) (string, error) {
+	if !worldPattern.MatchString(world) {
+		return "", fmt.Errorf("invalid world %q", world)
+	}
+	return storage.Key(storage.NamespaceWorlds, world+"/params.json")
+}
+
+// Initialize loads every world's parameters from the storage backend
+func Initialize(ctx context.Context) error {
+	backend := storage.Default()
+	if backend == nil {
+		return fmt.Errorf("storage backend unavailable")
+	}
+	objects, err := backend.List(ctx, storage.NamespaceWorlds+"/")
+	if err != nil {
+		return err
+	}
+
+	loaded := 0
+	for _, object := range objects {
+		if !strings.HasSuffix(object.Key, "/params.json") {
+			continue
+		}
+		world := strings.TrimSuffix(strings.TrimPrefix(object.Key, storage.NamespaceWorlds+"/"), "/params.json")
+		body, _, err := backend.Get(ctx, object.Key)
+		if err != nil {
+			continue
+		}
+		var list []*Param
+		err = json.NewDecoder(body).Decode(&list)
+		body.Close()
+		if err != nil || !worldPattern.MatchString(world) {
+			logging.Warn("skipping unreadable world parameters", map[string]interface{}{"key": object.Key})
+			continue
+		}
+		params := make(map[string]*Param, len(list))
+		for _, param := range list {
+			if param == nil || param.Validate() != nil {
+				logging.Warn("skipping invalid world parameter", map[string]interface{}{"key": object.Key})
+				continue
+			}
+			params[param.Key] = param
+		}
+		mutex.Lock()
+		worlds[world] = params
+		mutex.Unlock()
+		loaded += len(params)
+	}
+
+	logging.Info("world parameters loaded", map[string]interface{}{
+		"parameters": loaded,
+	})
+	return nil
+}
+
+// Set stores a new or changed parameter of a world
+func Set(ctx context.Context, world string, param *Param) error {
+	if err := param.Validate(); err != nil {
+		return err
+	}
+	return save(ctx, world, param.Key, func(params map[string]*Param) error {
+		if _, exists := params[param.Key]; !exists && len(params) >= MaxParams {
+			return ErrTooMany
+		}
+		params[param.Key] = param
+		return nil
+	})
+}
+
+// Delete removes a world's parameter
+func Delete(ctx context.Context, world, key string) error {
+	return save(ctx, world, key, func(params map[string]*Param) error {
+		if _, exists := params[key]; !exists {
+			return ErrNotFound
+		}
+		delete(params, key)
+		return nil
+	})
+}
+
+// save applies a change to a copy of a world's parameters, writes the
+// copy and only then serves it, so readers never see what failed to store
+func save(ctx context.Context, world, key string, change func(map[string]*Param) error) error {
+	objectKey, err := paramsKey(world)
+	if err != nil {
+		return err
+	}
+	saveMutex.Lock()
+	defer saveMutex.Unlock()
+
+	mutex.RLock()
+	params := make(map[string]*Param, len(worlds[world])+1)
+	for k, param := range worlds[world] {
+		params[k] = param
+	}
+	mutex.RUnlock()
+	if err := change(params); err != nil {
+		return err
+	}
+
+	backend := storage.Default()
+	if backend == nil {
+		return fmt.Errorf("storage backend unavailable")
+	}
+	encoded, err := json.Marshal(sorted(params))
+	if err != nil {
+		return err
+	}
+	if err := backend.Put(ctx, objectKey, bytes.NewReader(encoded), int64(len(encoded)), "application/json"); err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	worlds[world] = params
+	notify := append([]func(world, key string){}, watchers...)
+	mutex.Unlock()
+	for _, fn := range notify {
+		fn(world, key)
+	}
+	return nil
+}
+
+func sorted(params map[string]*Param) []*Param {
+	list := make([]*Param, 0, len(params))
+	for _, param := range params {
+		list = append(list, param)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+// List returns a world's parameters, by key, secret values included
+func List(world string) []*Param {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return sorted(worlds[world])
+}
+
+// Get returns a world's parameter, secret or not
+func Get(world, key string) (*Param, error) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	param, ok := worlds[world][key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return param, nil
+}
+
+// Values returns the values of a world's parameters that are not secret,
+// by key, for scripts whose results others see
+func Values(world string) map[string]interface{} {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	values := make(map[string]interface{}, len(worlds[world]))
+	for key, param := range worlds[world] {
+		if !param.Secret {
+			values[key] = param.Value
+		}
+	}
+	return values
+}
+
+// String returns a string parameter's value, or fallback
+func String(world, key, fallback string) string {
+	if param, err := Get(world, key); err == nil && param.Type == TypeString {
+		return param.Value.(string)
+	}
+	return fallback
+}
+
+// Number returns a number parameter's value, or fallback
+func Number(world, key string, fallback float64) float64 {
+	if param, err := Get(world, key); err == nil && param.Type == TypeNumber {
+		return param.Value.(float64)
+	}
+	return fallback
+}
+
+// Bool returns a bool parameter's value, or fallback
+func Bool(world, key string, fallback bool) bool {
+	if param, err := Get(world, key); err == nil && param.Type == TypeBool {
+		return param.Value.(bool)
+	}
+	return fallback
+}
+
+// OnChange calls fn with the world and key of every parameter set or
+// deleted from now on. Plugins register from init functions; fn runs on
+// the caller's goroutine and must not block.
+func OnChange(fn func(world, key string)) {
+	mutex.Lock()
+	watchers = append(watchers, fn)
+	mutex.Unlock()
+}
@@ -0,0 +1,185 @@
+// Package particles defines particle emitters, the entity component behind
+// effects like fire, smoke and sparks.
+//
+// Emitters are simulated on every client rather than streamed. The server
+// fixes an emitter's seed and start time whenever it is created or changed,
+// and clients derive each particle from those alone: particle n is born
+// n/rate seconds after the start, and its lifetime, velocity and spawn point
+// are drawn from a generator seeded with the seed and n. Every client
+// therefore shows the same particles at the same server time.
+package particles
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"regexp"
+	"strings"
+	"time"
+
+	"holodeck1/assets"
+	"holodeck1/numbers"
+)
+
+// Emitter shapes particles spawn within
+const (
+	ShapePoint  = "point"
+	ShapeSphere = "sphere"
+	ShapeBox    = "box"
+	ShapeDisc   = "disc"
+)
+
+// Limits of a valid emitter, keeping every client able to simulate it
+const (
+	MaxParticles = 5000 // Alive at once: rate × longest lifetime
+	maxRate      = 1000 // Particles per second
+	maxLifetime  = 60   // Seconds
+	maxSpeed     = 100  // m/s on any axis
+	maxExtent    = 100  // Metres, spawn radius or box size
+	maxSize      = 10   // Metres per particle
+)
+
+// Defaults of optional fields
+const (
+	defaultSize  = 0.1
+	defaultColor = "#ffffff"
+)
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Vector is a direction or size in world space
+type Vector struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+// Range is a span particles draw a value from uniformly
+type Range struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// VectorRange spans velocities, drawn per axis
+type VectorRange struct {
+	Min Vector `json:"min"`
+	Max Vector `json:"max"`
+}
+
+// Emitter is the particles component of an entity, in the entity's local
+// space
+type Emitter struct {
+	Shape     string      `json:"shape"`             // point, sphere, box or disc
+	Radius    float64     `json:"radius,omitempty"`  // Sphere and disc radius, metres
+	Extent    *Vector     `json:"extent,omitempty"`  // Box size, metres
+	Rate      float64     `json:"rate"`              // Particles per second
+	Lifetime  Range       `json:"lifetime"`          // Seconds
+	Velocity  VectorRange `json:"velocity"`          // m/s
+	Size      float64     `json:"size,omitempty"`    // Metres, 0.1 when unset
+	Color     string      `json:"color,omitempty"`   // Tint, white when unset
+	Texture   string      `json:"texture,omitempty"` // Sprite asset reference (sha256:<digest>)
+	Seed      uint32      `json:"seed"`              // Particle generator seed, chosen by the server when 0
+	StartedAt int64       `json:"started_at"`        // Server time in ms particle 0 was born, set by the server
+}
+
+// Alive returns the most particles the emitter has alive at once
+func (e *Emitter) Alive() int {
+	return int(math.Ceil(e.Rate * e.Lifetime.Max))
+}
+
+// Validate checks an emitter against the schema
+func (e *Emitter) Validate() error {
+	switch e.Shape {
+	case ShapePoint:
+	case ShapeSphere, ShapeDisc:
+		if !numbers.Within(e.Radius, 0, maxExtent) || e.Radius == 0 {
+			return fmt.Errorf("%s emitters need a radius within 0-%dm", e.Shape, maxExtent)
+		}
+	case ShapeBox:
+		if e.Extent == nil {
+			return errors.New("box emitters need an extent")
+		}
+		for _, component := range []float64{e.Extent.X, e.Extent.Y, e.Extent.Z} {
+			if !numbers.Within(component, 0, maxExtent) {
+				return fmt.Errorf("box extent must be within 0-%dm", maxExtent)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown emitter shape: %q (point, sphere, box or disc)", e.Shape)
+	}
+
+	if !numbers.Within(e.Rate, 0, maxRate) || e.Rate == 0 {
+		return fmt.Errorf("rate must be within 0-%d particles per second", maxRate)
+	}
+	if !numbers.Within(e.Lifetime.Min, 0, maxLifetime) || !numbers.Within(e.Lifetime.Max, 0, maxLifetime) || e.Lifetime.Max == 0 {
+		return fmt.Errorf("lifetime must be within 0-%d seconds", maxLifetime)
+	}
+	if e.Lifetime.Min > e.Lifetime.Max {
+		return errors.New("lifetime min must not exceed max")
+	}
+	if e.Alive() > MaxParticles {
+		return fmt.Errorf("rate × maximum lifetime allows %d particles, at most %d", e.Alive(), MaxParticles)
+	}
+
+	min, max := e.Velocity.Min, e.Velocity.Max
+	for _, component := range []float64{min.X, min.Y, min.Z, max.X, max.Y, max.Z} {
+		if !numbers.Within(component, -maxSpeed, maxSpeed) {
+			return fmt.Errorf("velocity components must be within ±%d m/s", maxSpeed)
+		}
+	}
+	if min.X > max.X || min.Y > max.Y || min.Z > max.Z {
+		return errors.New("velocity min must not exceed max")
+	}
+
+	if !numbers.Within(e.Size, 0, maxSize) {
+		return fmt.Errorf("size must be within 0-%dm", maxSize)
+	}
+	if e.Color != "" && !colorPattern.MatchString(e.Color) {
+		return fmt.Errorf("color must be #rrggbb, got %q", e.Color)
+	}
+	if e.Texture != "" && !(strings.HasPrefix(e.Texture, assets.RefPrefix) && assets.ValidDigest(strings.TrimPrefix(e.Texture, assets.RefPrefix))) {
+		return fmt.Errorf("texture must be an asset reference (sha256:<digest>), got %q", e.Texture)
+	}
+	return nil
+}
+
+// Start fills in defaults and fixes the seed and start time, which clients
+// simulate from; call it whenever an emitter is created or changed
+func (e *Emitter) Start(now time.Time) {
+	if e.Size == 0 {
+		e.Size = defaultSize
+	}
+	if e.Color == "" {
+		e.Color = defaultColor
+	}
+	for e.Seed == 0 {
+		e.Seed = rand.Uint32()
+	}
+	e.StartedAt = now.UnixMilli()
+}
+
+// Data returns the emitter as entity operation data
+func (e *Emitter) Data() map[string]interface{} {
+	var data map[string]interface{}
+	encoded, _ := json.Marshal(e)
+	json.Unmarshal(encoded, &data)
+	return data
+}
+
+// Decode reads and validates an emitter from entity operation data
+func Decode(value interface{}) (*Emitter, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var emitter Emitter
+	if err := json.Unmarshal(encoded, &emitter); err != nil {
+		return nil, fmt.Errorf("invalid particles: %v", err)
+	}
+	if err := emitter.Validate(); err != nil {
+		return nil, err
+	}
+	return &emitter, nil
+}
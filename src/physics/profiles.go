@@ -0,0 +1,211 @@
+// Package physics defines the physics profiles a world runs under.
+//
+// A profile sets gravity, velocity damping and which collision layers
+// interact. Worlds pick a built-in profile by name or carry a custom one;
+// the active profile lives in the world's scene settings under "physics",
+// so it is versioned with the operation log and reaches clients as a
+// scene_update, where physics engines pick it up.
+package physics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+
+	"holodeck1/sync"
+)
+
+// DefaultProfile is the profile of worlds that never chose one
+const DefaultProfile = "earth"
+
+// Limits of a valid profile
+const (
+	maxGravity = 1000 // m/s², beyond anything a scene needs
+	maxLayers  = 32   // Fits the bitmasks engines use for collision groups
+)
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// Vector is a direction and magnitude in world space
+type Vector struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+// Layer is a collision layer and the layers its bodies collide with
+type Layer struct {
+	Name         string   `json:"name"`
+	CollidesWith []string `json:"collides_with"`
+}
+
+// Profile is a world's physics settings
+type Profile struct {
+	Name           string  `json:"name"`
+	Gravity        Vector  `json:"gravity"`         // m/s²
+	LinearDamping  float64 `json:"linear_damping"`  // Fraction of velocity lost per second, 0-1
+	AngularDamping float64 `json:"angular_damping"` // Fraction of spin lost per second, 0-1
+	Layers         []Layer `json:"collision_layers"`
+}
+
+// Selection picks a built-in profile by name or supplies a custom one, as
+// accepted by the API and world definitions. Custom profiles without
+// collision layers get the built-in ones.
+type Selection struct {
+	Profile string   `json:"profile,omitempty"`
+	Custom  *Profile `json:"custom,omitempty"`
+}
+
+// defaultLayers lets everything collide with the world and each other,
+// while avatars pass through one another
+func defaultLayers() []Layer {
+	return []Layer{
+		{Name: "default", CollidesWith: []string{"default", "static", "avatars"}},
+		{Name: "static", CollidesWith: []string{"default", "avatars"}},
+		{Name: "avatars", CollidesWith: []string{"default", "static"}},
+	}
+}
+
+// builtin profiles by name
+var builtin = map[string]Profile{
+	"earth":      {Name: "earth", Gravity: Vector{Y: -9.81}, LinearDamping: 0.01, AngularDamping: 0.01},
+	"moon":       {Name: "moon", Gravity: Vector{Y: -1.62}, LinearDamping: 0.01, AngularDamping: 0.01},
+	"mars":       {Name: "mars", Gravity: Vector{Y: -3.71}, LinearDamping: 0.01, AngularDamping: 0.01},
+	"zero_g":     {Name: "zero_g", LinearDamping: 0, AngularDamping: 0},
+	"underwater": {Name: "underwater", Gravity: Vector{Y: -2}, LinearDamping: 0.6, AngularDamping: 0.6},
+}
+
+// Builtin returns a built-in profile
+func Builtin(name string) (*Profile, bool) {
+	profile, ok := builtin[name]
+	if !ok {
+		return nil, false
+	}
+	profile.Layers = defaultLayers()
+	return &profile, true
+}
+
+// Builtins returns every built-in profile, sorted by name
+func Builtins() []*Profile {
+	profiles := make([]*Profile, 0, len(builtin))
+	for name := range builtin {
+		profile, _ := Builtin(name)
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles
+}
+
+// Resolve returns the selected profile, validated
+func (s *Selection) Resolve() (*Profile, error) {
+	switch {
+	case s.Profile != "" && s.Custom != nil:
+		return nil, errors.New("set either profile or custom, not both")
+	case s.Custom != nil:
+		custom := *s.Custom
+		if len(custom.Layers) == 0 {
+			custom.Layers = defaultLayers()
+		}
+		if err := custom.Validate(); err != nil {
+			return nil, err
+		}
+		return &custom, nil
+	case s.Profile != "":
+		profile, ok := Builtin(s.Profile)
+		if !ok {
+			return nil, fmt.Errorf("unknown physics profile: %q", s.Profile)
+		}
+		return profile, nil
+	}
+	return nil, errors.New("profile or custom is required")
+}
+
+// Validate checks a profile against the schema
+func (p *Profile) Validate() error {
+	if !namePattern.MatchString(p.Name) {
+		return fmt.Errorf("profile name %q must be lowercase letters, digits, '-' or '_'", p.Name)
+	}
+	for _, component := range []float64{p.Gravity.X, p.Gravity.Y, p.Gravity.Z} {
+		if math.IsNaN(component) || math.Abs(component) > maxGravity {
+			return fmt.Errorf("gravity components must be within ±%d m/s²", maxGravity)
+		}
+	}
+	if p.LinearDamping < 0 || p.LinearDamping > 1 || p.AngularDamping < 0 || p.AngularDamping > 1 {
+		return errors.New("damping must be between 0 and 1")
+	}
+	if len(p.Layers) == 0 {
+		return errors.New("at least one collision layer is required")
+	}
+	if len(p.Layers) > maxLayers {
+		return fmt.Errorf("at most %d collision layers", maxLayers)
+	}
+	layers := make(map[string]bool, len(p.Layers))
+	for _, layer := range p.Layers {
+		if !namePattern.MatchString(layer.Name) {
+			return fmt.Errorf("collision layer name %q must be lowercase letters, digits, '-' or '_'", layer.Name)
+		}
+		if layers[layer.Name] {
+			return fmt.Errorf("duplicate collision layer %q", layer.Name)
+		}
+		layers[layer.Name] = true
+	}
+	for _, layer := range p.Layers {
+		for _, other := range layer.CollidesWith {
+			if !layers[other] {
+				return fmt.Errorf("collision layer %q collides with unknown layer %q", layer.Name, other)
+			}
+		}
+	}
+	return nil
+}
+
+// Data returns the profile as scene_update data
+func (p *Profile) Data() map[string]interface{} {
+	var data map[string]interface{}
+	encoded, _ := json.Marshal(p)
+	json.Unmarshal(encoded, &data)
+	return data
+}
+
+// Decode reads a profile from scene settings, as stored by Data
+func Decode(value interface{}) (*Profile, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var profile Profile
+	if err := json.Unmarshal(encoded, &profile); err != nil {
+		return nil, fmt.Errorf("invalid physics profile: %v", err)
+	}
+	if err := profile.Validate(); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func init() {
+	// Raw scene updates carry profiles too; refuse ones engines cannot run
+	sync.RegisterOperation(sync.OpSceneUpdate, func(data map[string]interface{}) error {
+		if value, ok := data["physics"]; ok {
+			if _, err := Decode(value); err != nil {
+				return fmt.Errorf("invalid physics profile: %v", err)
+			}
+		}
+		return nil
+	})
+}
+
+// FromScene returns the profile in a world's scene settings, or the
+// default profile when there is none
+func FromScene(scene map[string]interface{}) *Profile {
+	if value, ok := scene["physics"]; ok {
+		if profile, err := Decode(value); err == nil {
+			return profile
+		}
+	}
+	profile, _ := Builtin(DefaultProfile)
+	return profile
+}
@@ -0,0 +1,88 @@
+// Package pointclouds defines point cloud entities: laser scans and
+// photogrammetry uploaded as LAS or PLY assets and shown as points.
+//
+// The asset store tiles every uploaded cloud into an octree whose nodes
+// each hold an even sample of the points in their cube, children adding
+// detail to their parent (see assets.PointCloud). An entity's pointcloud
+// component names the cloud; clients stream it progressively, loading the
+// nodes whose point spacing looks coarse from the camera first and
+// refining towards the viewer until the entity's point budget is spent.
+// The cloud stands on the entity's position, moved, turned and scaled by
+// its transform like any other entity.
+package pointclouds
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"holodeck1/assets"
+)
+
+// Limits of a valid point cloud component
+const (
+	DefaultPointSize = 0.02 // Metres
+	MaxPointSize     = 1
+	DefaultBudget    = 1000000 // Points a client shows at once
+	MinBudget        = 10000
+	MaxBudget        = 10000000
+)
+
+// PointCloud is the pointcloud component of an entity
+type PointCloud struct {
+	Source    string  `json:"source"`     // sha256:<digest> of a LAS or PLY asset
+	PointSize float64 `json:"point_size"` // Metres
+	Budget    int     `json:"budget"`     // Points shown at once
+}
+
+// Validate checks a point cloud component, defaulting the point size and
+// budget
+func (p *PointCloud) Validate() error {
+	if !strings.HasPrefix(p.Source, assets.RefPrefix) || !assets.ValidDigest(strings.TrimPrefix(p.Source, assets.RefPrefix)) {
+		return fmt.Errorf("source must be sha256:<digest> of an uploaded asset, got %q", p.Source)
+	}
+	if p.PointSize == 0 {
+		p.PointSize = DefaultPointSize
+	}
+	if p.Budget == 0 {
+		p.Budget = DefaultBudget
+	}
+	if math.IsNaN(p.PointSize) || p.PointSize < 0 || p.PointSize > MaxPointSize {
+		return fmt.Errorf("point_size must be within 0-%gm", float64(MaxPointSize))
+	}
+	if p.Budget < MinBudget || p.Budget > MaxBudget {
+		return fmt.Errorf("budget must be within %d-%d points", MinBudget, MaxBudget)
+	}
+	return nil
+}
+
+// Digest returns the digest of the cloud's asset
+func (p *PointCloud) Digest() string {
+	return strings.TrimPrefix(p.Source, assets.RefPrefix)
+}
+
+// Data returns the component as entity operation data
+func (p *PointCloud) Data() map[string]interface{} {
+	var data map[string]interface{}
+	encoded, _ := json.Marshal(p)
+	json.Unmarshal(encoded, &data)
+	return data
+}
+
+// Decode reads and validates a point cloud component from entity operation
+// data
+func Decode(value interface{}) (*PointCloud, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var cloud PointCloud
+	if err := json.Unmarshal(encoded, &cloud); err != nil {
+		return nil, fmt.Errorf("invalid pointcloud: %v", err)
+	}
+	if err := cloud.Validate(); err != nil {
+		return nil, err
+	}
+	return &cloud, nil
+}
@@ -0,0 +1,225 @@
+// Package polls keeps the polls running in each world, for classrooms and
+// design reviews held inside HD1.
+//
+// A poll asks one question with up to ten options. Each connected session
+// has one ballot, which it may change until the poll closes; tallies count
+// ballots per option and never reveal who voted for what. Polls live in
+// memory like the sessions voting in them, and every change is pushed to
+// the world's clients as a poll message with the current tallies.
+package polls
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Poll states
+const (
+	StatusOpen   = "open"
+	StatusClosed = "closed"
+)
+
+// Limits of a valid poll
+const (
+	MaxQuestionLength = 500
+	MaxOptionLength   = 200
+	MaxOptions        = 10
+	MaxPolls          = 100 // Per world; the oldest closed polls make room
+)
+
+// ErrNotFound is returned for unknown polls
+var ErrNotFound = errors.New("poll not found")
+
+// ErrClosed is returned when voting in a closed poll
+var ErrClosed = errors.New("poll is closed")
+
+// ErrTooMany is returned when a world holds MaxPolls open polls
+var ErrTooMany = fmt.Errorf("worlds hold at most %d open polls", MaxPolls)
+
+var worldPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Poll is a question put to a world. Votes maps each voting session to the
+// indexes of the options it chose and is never sent to clients.
+type Poll struct {
+	ID        string           `json:"id"`
+	World     string           `json:"world"`
+	Question  string           `json:"question"`
+	Options   []string         `json:"options"`
+	Multiple  bool             `json:"multiple"` // Ballots may choose several options
+	Status    string           `json:"status"`
+	CreatedBy string           `json:"created_by"`
+	CreatedAt time.Time        `json:"created_at"`
+	ClosedAt  *time.Time       `json:"closed_at,omitempty"`
+	Votes     map[string][]int `json:"-"`
+}
+
+// Tally is a poll as clients see it, with the votes counted
+type Tally struct {
+	*Poll
+	Counts []int `json:"counts"` // Per option
+	Voters int   `json:"voters"`
+}
+
+// Validate checks a poll as submitted, trimming its text
+func (p *Poll) Validate() error {
+	if !worldPattern.MatchString(p.World) {
+		return fmt.Errorf("world must match %s", worldPattern)
+	}
+	p.Question = strings.TrimSpace(p.Question)
+	if p.Question == "" || len(p.Question) > MaxQuestionLength {
+		return fmt.Errorf("question must be 1-%d characters", MaxQuestionLength)
+	}
+	if len(p.Options) < 2 || len(p.Options) > MaxOptions {
+		return fmt.Errorf("polls need 2-%d options", MaxOptions)
+	}
+	seen := make(map[string]bool, len(p.Options))
+	for i, option := range p.Options {
+		option = strings.TrimSpace(option)
+		if option == "" || len(option) > MaxOptionLength {
+			return fmt.Errorf("options must be 1-%d characters", MaxOptionLength)
+		}
+		if seen[option] {
+			return fmt.Errorf("duplicate option %q", option)
+		}
+		seen[option] = true
+		p.Options[i] = option
+	}
+	return nil
+}
+
+var (
+	polls = make(map[string]*Poll)
+	mutex sync.RWMutex
+)
+
+// Create opens a new poll, dropping the world's oldest closed poll when it
+// is full
+func Create(poll *Poll) error {
+	if err := poll.Validate(); err != nil {
+		return err
+	}
+	poll.ID = "poll-" + uuid.New().String()
+	poll.Status = StatusOpen
+	poll.Votes = make(map[string][]int)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	var held []*Poll
+	for _, existing := range polls {
+		if existing.World == poll.World {
+			held = append(held, existing)
+		}
+	}
+	if len(held) >= MaxPolls {
+		sort.Slice(held, func(i, j int) bool { return held[i].CreatedAt.Before(held[j].CreatedAt) })
+		dropped := false
+		for _, existing := range held {
+			if existing.Status == StatusClosed {
+				delete(polls, existing.ID)
+				dropped = true
+				break
+			}
+		}
+		if !dropped {
+			return ErrTooMany
+		}
+	}
+	polls[poll.ID] = poll
+	return nil
+}
+
+// Get returns a world's poll with its tallies
+func Get(world, id string) (*Tally, error) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	poll, ok := polls[id]
+	if !ok || poll.World != world {
+		return nil, ErrNotFound
+	}
+	return poll.tally(), nil
+}
+
+// List returns a world's polls with their tallies, oldest first
+func List(world string) []*Tally {
+	mutex.RLock()
+	result := []*Tally{}
+	for _, poll := range polls {
+		if poll.World == world {
+			result = append(result, poll.tally())
+		}
+	}
+	mutex.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result
+}
+
+// Vote replaces a session's ballot; an empty choice withdraws it
+func Vote(world, id, hd1ID string, choice []int) (*Tally, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	poll, ok := polls[id]
+	if !ok || poll.World != world {
+		return nil, ErrNotFound
+	}
+	if poll.Status != StatusOpen {
+		return nil, ErrClosed
+	}
+	if len(choice) > 1 && !poll.Multiple {
+		return nil, errors.New("this poll takes one option per ballot")
+	}
+	chosen := make(map[int]bool, len(choice))
+	for _, option := range choice {
+		if option < 0 || option >= len(poll.Options) {
+			return nil, fmt.Errorf("option %d out of range 0-%d", option, len(poll.Options)-1)
+		}
+		if chosen[option] {
+			return nil, fmt.Errorf("option %d chosen twice", option)
+		}
+		chosen[option] = true
+	}
+
+	if len(choice) == 0 {
+		delete(poll.Votes, hd1ID)
+	} else {
+		poll.Votes[hd1ID] = append([]int(nil), choice...)
+	}
+	return poll.tally(), nil
+}
+
+// Close ends voting and returns the final tallies
+func Close(world, id string, now time.Time) (*Tally, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	poll, ok := polls[id]
+	if !ok || poll.World != world {
+		return nil, ErrNotFound
+	}
+	if poll.Status == StatusOpen {
+		poll.Status = StatusClosed
+		closed := now.UTC()
+		poll.ClosedAt = &closed
+	}
+	return poll.tally(), nil
+}
+
+// tally counts a poll's votes; call it holding the mutex
+func (p *Poll) tally() *Tally {
+	snapshot := *p
+	snapshot.Options = append([]string(nil), p.Options...)
+	snapshot.Votes = nil
+	tally := &Tally{Poll: &snapshot, Counts: make([]int, len(p.Options)), Voters: len(p.Votes)}
+	for _, choice := range p.Votes {
+		for _, option := range choice {
+			tally.Counts[option]++
+		}
+	}
+	return tally
+}
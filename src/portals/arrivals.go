@@ -0,0 +1,140 @@
+package portals
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"holodeck1/config"
+)
+
+// An avatar stepping into a portal to another server's world is handed
+// over in two steps. The server it leaves POSTs an Arrival to the
+// destination's /api/worlds/{world}/arrivals, which keeps it under a
+// one-use ticket and answers with a deep link, /w/{world}?arrival=ticket.
+// The session's console follows the link and, once it joins, claims the
+// ticket, which places its new avatar where the arrival says.
+
+// Limits of pending arrivals
+const (
+	ArrivalTTL  = 2 * time.Minute // To follow the link and join
+	maxArrivals = 1000            // Pending at once
+)
+
+// ErrUnknownArrival is returned for tickets unknown, claimed or expired
+var ErrUnknownArrival = errors.New("arrival unknown or expired")
+
+// ErrTooManyArrivals is returned when maxArrivals are pending
+var ErrTooManyArrivals = fmt.Errorf("at most %d arrivals may be pending", maxArrivals)
+
+// Arrival is an avatar on its way through a portal from another server
+type Arrival struct {
+	Ticket    string    `json:"ticket,omitempty"`
+	World     string    `json:"world"`            // Destination
+	From      string    `json:"from"`             // World the avatar left
+	Portal    string    `json:"portal,omitempty"` // Entity it stepped into
+	HD1ID     string    `json:"hd1_id"`           // Session on the server it left
+	Name      string    `json:"name,omitempty"`
+	Position  *Position `json:"position,omitempty"`
+	View      string    `json:"view,omitempty"` // Resolved into a position by the destination
+	Yaw       float64   `json:"yaw"`
+	Pitch     float64   `json:"pitch"`
+	Link      string    `json:"link,omitempty"` // Deep link claiming the ticket
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+var (
+	arrivals      = map[string]*Arrival{}
+	arrivalsMutex sync.Mutex
+)
+
+// Expect keeps an arrival until its session claims it, returning it with
+// its ticket and link
+func Expect(arrival *Arrival, now time.Time) (*Arrival, error) {
+	arrivalsMutex.Lock()
+	defer arrivalsMutex.Unlock()
+	for ticket, pending := range arrivals {
+		if !now.Before(pending.ExpiresAt) {
+			delete(arrivals, ticket)
+		}
+	}
+	if len(arrivals) >= maxArrivals {
+		return nil, ErrTooManyArrivals
+	}
+
+	expected := *arrival
+	expected.Ticket = "arr-" + uuid.New().String()
+	expected.Link = "/w/" + url.PathEscape(expected.World) + "?arrival=" + url.QueryEscape(expected.Ticket)
+	expected.ExpiresAt = now.Add(ArrivalTTL).UTC()
+	arrivals[expected.Ticket] = &expected
+	copied := expected
+	return &copied, nil
+}
+
+// Claim takes a pending arrival; each ticket is claimed once
+func Claim(ticket string, now time.Time) (*Arrival, error) {
+	arrivalsMutex.Lock()
+	defer arrivalsMutex.Unlock()
+	arrival, ok := arrivals[ticket]
+	delete(arrivals, ticket)
+	if !ok || !now.Before(arrival.ExpiresAt) {
+		return nil, ErrUnknownArrival
+	}
+	return arrival, nil
+}
+
+// Send hands an arrival to its world's server, returning it as expected
+// there with the link made absolute
+func Send(ctx context.Context, destination *Destination, arrival *Arrival) (*Arrival, error) {
+	body, err := json.Marshal(arrival)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := destination.URL + "/api/worlds/" + url.PathEscape(arrival.World) + "/arrivals"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(signatureHeader, sign(destination.Secret, body))
+
+	client := &http.Client{
+		Timeout: config.GetPortalsTimeout(),
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	reply, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("%s answered %s: %s", arrival.World, resp.Status, bytes.TrimSpace(reply))
+	}
+	var response struct {
+		Arrival *Arrival `json:"arrival"`
+	}
+	if err := json.Unmarshal(reply, &response); err != nil || response.Arrival == nil || response.Arrival.Link == "" {
+		return nil, fmt.Errorf("%s answered without an arrival", arrival.World)
+	}
+	response.Arrival.Link = destination.URL + response.Arrival.Link
+	return response.Arrival, nil
+}
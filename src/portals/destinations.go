@@ -0,0 +1,146 @@
+package portals
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+)
+
+// Destinations are the servers of the worlds portals lead to, named by
+// world in the portals file (YAML). Both servers list each other, with the
+// same secret, so that each can hand avatars to the other:
+//
+//	worlds:
+//	  world_two:
+//	    url: https://two.example.com
+//	    secret: s3cret
+//
+// Arrivals are POSTed with the body signed in X-HD1-Signature-256 as
+// sha256=<hex HMAC> of the secret; a server accepts arrivals from the
+// worlds it lists. A missing file leaves portals within the served world.
+
+// ErrNoDestination is returned for worlds the portals file lacks
+var ErrNoDestination = errors.New("portal destination not configured")
+
+// Destination is the server of a world portals lead to
+type Destination struct {
+	World  string `yaml:"-"`
+	URL    string `yaml:"url"`    // Base URL of the server
+	Secret string `yaml:"secret"` // Signs arrivals both ways
+}
+
+// File is the format of the portals file
+type File struct {
+	Worlds map[string]*Destination `yaml:"worlds"`
+}
+
+var (
+	destinations      = map[string]*Destination{}
+	destinationsMutex sync.RWMutex
+)
+
+// Load reads the portals file; a missing file leaves no destinations
+func Load() error {
+	file := config.GetPortalsFile()
+	loaded := map[string]*Destination{}
+	raw, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		var document File
+		if err := yaml.Unmarshal(raw, &document); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		for world, destination := range document.Worlds {
+			if destination == nil {
+				destination = &Destination{}
+			}
+			destination.World = world
+			if err := destination.validate(); err != nil {
+				return fmt.Errorf("%s: world %q: %v", file, world, err)
+			}
+			loaded[world] = destination
+		}
+	}
+
+	destinationsMutex.Lock()
+	destinations = loaded
+	destinationsMutex.Unlock()
+
+	logging.Info("portal destinations loaded", map[string]interface{}{
+		"file":   file,
+		"worlds": len(loaded),
+	})
+	return nil
+}
+
+func (d *Destination) validate() error {
+	if !worldPattern.MatchString(d.World) {
+		return fmt.Errorf("world must match %s", worldPattern)
+	}
+	if d.World == config.GetWorldsDefaultWorld() {
+		return errors.New("the served world needs no destination")
+	}
+	parsed, err := url.Parse(d.URL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return errors.New("url must be an http or https URL")
+	}
+	if d.Secret == "" {
+		return errors.New("secret required")
+	}
+	d.URL = strings.TrimRight(d.URL, "/")
+	return nil
+}
+
+// LookupDestination returns the server of a world
+func LookupDestination(world string) (*Destination, error) {
+	destinationsMutex.RLock()
+	defer destinationsMutex.RUnlock()
+	destination, ok := destinations[world]
+	if !ok {
+		return nil, ErrNoDestination
+	}
+	return destination, nil
+}
+
+// Reachable reports whether portals may lead to a world: the served one,
+// or one the portals file names
+func Reachable(world string) error {
+	if world == config.GetWorldsDefaultWorld() {
+		return nil
+	}
+	_, err := LookupDestination(world)
+	return err
+}
+
+// signatureHeader carries the HMAC of an arrival
+const signatureHeader = "X-Hd1-Signature-256"
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether an arrival was signed by the server of the world
+// it comes from
+func Verify(from string, r *http.Request, body []byte) bool {
+	destination, err := LookupDestination(from)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(r.Header.Get(signatureHeader)), []byte(sign(destination.Secret, body)))
+}
@@ -0,0 +1,149 @@
+// Package portals links worlds through entities. An entity with a portal
+// component carries the avatars that step into its trigger volume to a
+// destination: a place in the served world, reached at once, or a place in
+// a world another HD1 server serves, reached through the arrival handoff
+// (see Send). Destination servers are named in the portals file.
+//
+// The trigger volume is a box centred on the entity, of the portal's size
+// or, without one, of the entity's scale in metres. It is axis-aligned: the
+// entity's rotation does not turn it.
+package portals
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits of a valid portal
+const (
+	maxLabel      = 200
+	maxSize       = 100 // Metres along each axis
+	maxCoordinate = 1e6 // Metres from the origin
+)
+
+var (
+	worldPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+	viewPattern  = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+)
+
+// Position is a point or an extent in world space, in metres
+type Position struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+// Portal is the portal component of an entity
+type Portal struct {
+	World    string    `json:"world"`              // Destination world
+	Position *Position `json:"position,omitempty"` // Where avatars arrive
+	View     string    `json:"view,omitempty"`     // Camera view of the destination to arrive at, without a position
+	Yaw      float64   `json:"yaw,omitempty"`      // Radians the arrival faces, with a position
+	Pitch    float64   `json:"pitch,omitempty"`
+	Size     *Position `json:"size,omitempty"`  // Trigger volume; the entity's scale without one
+	Label    string    `json:"label,omitempty"` // Shown to those passing through
+}
+
+// Validate checks a portal's destination and trigger volume
+func (p *Portal) Validate() error {
+	if !worldPattern.MatchString(p.World) {
+		return fmt.Errorf("world must match %s", worldPattern)
+	}
+	switch {
+	case p.Position == nil && p.View == "":
+		return errors.New("portal needs a position or a view to arrive at")
+	case p.Position != nil && p.View != "":
+		return errors.New("portal takes a position or a view, not both")
+	case p.View != "" && !viewPattern.MatchString(p.View):
+		return fmt.Errorf("view must match %s", viewPattern)
+	}
+	if p.Position != nil && !p.Position.within(maxCoordinate) {
+		return fmt.Errorf("position must be within %gm of the origin", float64(maxCoordinate))
+	}
+	if math.IsNaN(p.Yaw) || math.IsInf(p.Yaw, 0) {
+		return errors.New("yaw must be a number")
+	}
+	if !(math.Abs(p.Pitch) <= math.Pi/2) {
+		return errors.New("pitch must be within ±π/2")
+	}
+	if p.Size != nil && (!p.Size.within(maxSize) || p.Size.X <= 0 || p.Size.Y <= 0 || p.Size.Z <= 0) {
+		return fmt.Errorf("size must be positive and at most %gm along each axis", float64(maxSize))
+	}
+	p.Label = strings.TrimSpace(p.Label)
+	if utf8.RuneCountInString(p.Label) > maxLabel {
+		return fmt.Errorf("label must be at most %d characters", maxLabel)
+	}
+	return nil
+}
+
+func (p Position) within(limit float64) bool {
+	return math.Abs(p.X) <= limit && math.Abs(p.Y) <= limit && math.Abs(p.Z) <= limit
+}
+
+// Data returns the portal as entity operation data
+func (p *Portal) Data() map[string]interface{} {
+	var data map[string]interface{}
+	encoded, _ := json.Marshal(p)
+	json.Unmarshal(encoded, &data)
+	return data
+}
+
+// Decode reads and validates a portal from entity operation data
+func Decode(value interface{}) (*Portal, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var portal Portal
+	if err := json.Unmarshal(encoded, &portal); err != nil {
+		return nil, fmt.Errorf("invalid portal: %v", err)
+	}
+	if err := portal.Validate(); err != nil {
+		return nil, err
+	}
+	return &portal, nil
+}
+
+// Box is an axis-aligned trigger volume
+type Box struct {
+	Min Position
+	Max Position
+}
+
+// Contains reports whether a point is inside the box, edges included
+func (b Box) Contains(p Position) bool {
+	return p.X >= b.Min.X && p.X <= b.Max.X &&
+		p.Y >= b.Min.Y && p.Y <= b.Max.Y &&
+		p.Z >= b.Min.Z && p.Z <= b.Max.Z
+}
+
+// Volume returns the trigger volume of a portal on an entity, as the
+// operation log holds the entity
+func (p *Portal) Volume(entity map[string]interface{}) Box {
+	centre := vector(entity["position"], 0)
+	size := vector(entity["scale"], 1)
+	if p.Size != nil {
+		size = *p.Size
+	}
+	return Box{
+		Min: Position{centre.X - size.X/2, centre.Y - size.Y/2, centre.Z - size.Z/2},
+		Max: Position{centre.X + size.X/2, centre.Y + size.Y/2, centre.Z + size.Z/2},
+	}
+}
+
+// vector reads an {x, y, z} of entity data, missing components as fallback
+func vector(value interface{}, fallback float64) Position {
+	fields, _ := value.(map[string]interface{})
+	component := func(name string) float64 {
+		if number, ok := fields[name].(float64); ok {
+			return number
+		}
+		return fallback
+	}
+	return Position{component("x"), component("y"), component("z")}
+}
@@ -0,0 +1,137 @@
+package portals
+
+import (
+	stdSync "sync"
+
+	"holodeck1/logging"
+	"holodeck1/sync"
+)
+
+// The served world's portals are found by rebuilding the world, which only
+// happens again once an operation other than an avatar's changed it, so
+// the moves that check them stay cheap.
+
+// StateFunc rebuilds the entities of a world from its operation log,
+// starting at sequence 1; the portals package cannot rebuild world state
+// itself
+type StateFunc func(operations []*sync.Operation) (map[string]map[string]interface{}, error)
+
+type placed struct {
+	portal *Portal
+	volume Box
+}
+
+var tracker struct {
+	mutex   stdSync.Mutex
+	rebuild StateFunc
+	seqNum  uint64                     // Last operation looked at
+	stale   bool                       // An entity changed since the rebuild
+	portals map[string]placed          // By entity ID
+	inside  map[string]map[string]bool // Portals each avatar stands in
+}
+
+// SetStateFunc enables portals
+func SetStateFunc(rebuild StateFunc) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	tracker.rebuild = rebuild
+	tracker.stale = true
+	tracker.inside = make(map[string]map[string]bool)
+}
+
+// Enter reports the portal an avatar at a position has just stepped into:
+// one whose volume holds the position and did not hold the avatar's last
+// one. Avatars arriving inside a portal leave it before it carries them.
+func Enter(rs *sync.ReliableSync, avatarID string, at Position) (string, *Portal) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	if tracker.rebuild == nil {
+		return "", nil
+	}
+	refresh(rs)
+
+	was := tracker.inside[avatarID]
+	now := make(map[string]bool)
+	entered, enteredID := (*Portal)(nil), ""
+	for id, candidate := range tracker.portals {
+		if !candidate.volume.Contains(at) {
+			continue
+		}
+		now[id] = true
+		if !was[id] && (entered == nil || id < enteredID) {
+			entered, enteredID = candidate.portal, id
+		}
+	}
+	if len(now) > 0 {
+		tracker.inside[avatarID] = now
+	} else {
+		delete(tracker.inside, avatarID)
+	}
+	return enteredID, entered
+}
+
+// Inside marks an avatar placed at a position, so the portals it is placed
+// in do not carry it until it leaves them
+func Inside(avatarID string, at Position) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	if tracker.inside == nil {
+		return
+	}
+	now := make(map[string]bool)
+	for id, candidate := range tracker.portals {
+		if candidate.volume.Contains(at) {
+			now[id] = true
+		}
+	}
+	tracker.inside[avatarID] = now
+}
+
+// Forget drops an avatar that left
+func Forget(avatarID string) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	delete(tracker.inside, avatarID)
+}
+
+// refresh rebuilds the portals when an entity changed; callers hold the
+// mutex
+func refresh(rs *sync.ReliableSync) {
+	current := rs.GetCurrentSequence()
+	if current < tracker.seqNum {
+		// The log started over, such as after a rollback of the server
+		tracker.stale = true
+	}
+	for _, op := range rs.GetOperationsInRange(tracker.seqNum+1, current) {
+		if op.Type != sync.OpAvatarMove && op.Type != sync.OpAvatarUpdate {
+			tracker.stale = true
+			break
+		}
+	}
+	tracker.seqNum = current
+	if !tracker.stale {
+		return
+	}
+
+	entities, err := tracker.rebuild(rs.GetAllOperations())
+	if err != nil {
+		logging.Warn("portals unavailable, world state not rebuilt", map[string]interface{}{
+			"error": err.Error(),
+		})
+		tracker.portals = nil
+		tracker.stale = false
+		return
+	}
+	tracker.portals = make(map[string]placed)
+	for id, entity := range entities {
+		if entity["portal"] == nil {
+			continue
+		}
+		portal, err := Decode(entity["portal"])
+		if err != nil {
+			continue
+		}
+		tracker.portals[id] = placed{portal: portal, volume: portal.Volume(entity)}
+	}
+	tracker.stale = false
+}
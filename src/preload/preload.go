@@ -0,0 +1,94 @@
+// Package preload loads and warms worlds at startup, so the first visitor
+// does not pay for a cold start.
+//
+// For each configured world it validates the world's definition in the
+// worlds directory. For the served world it also resumes the snapshot an
+// earlier run left hibernating, claims the IDs of the entities it holds,
+// and rebuilds the world once into the checksum cache and the usage meter.
+// HD1 serves one world in memory; other worlds listed only have their
+// definitions checked.
+package preload
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/entityid"
+	"holodeck1/hibernation"
+	"holodeck1/logging"
+	"holodeck1/server"
+	"holodeck1/usage"
+	"holodeck1/worlds"
+)
+
+// clientID claims the IDs of resumed entities
+const clientID = "preload"
+
+// Run preloads the configured worlds in order. Failures are logged and
+// never stop startup; the world then loads on first use as it always did.
+func Run(hub *server.Hub) {
+	for _, world := range config.GetWorldsPreload() {
+		if world == "" {
+			continue
+		}
+		started := time.Now()
+		fields := map[string]interface{}{"world": world}
+		definition(world, fields)
+		if world == config.GetWorldsDefaultWorld() {
+			served(hub, world, fields)
+		}
+		fields["took_ms"] = time.Since(started).Milliseconds()
+		logging.Info("world preloaded", fields)
+	}
+}
+
+// definition validates a world's definition, when it has one
+func definition(world string, fields map[string]interface{}) {
+	dir := filepath.Join(config.GetWorldsDir(), world)
+	if _, err := os.Stat(dir); err != nil {
+		fields["definition"] = "none"
+		return
+	}
+	report, err := worlds.ValidateDir(dir)
+	if err != nil {
+		fields["definition"] = "unreadable"
+		fields["error"] = err.Error()
+		return
+	}
+	fields["definition"] = "valid"
+	if !report.Valid {
+		fields["definition"] = "invalid"
+		logging.Warn("preloaded world definition has errors", map[string]interface{}{
+			"world":    world,
+			"errors":   report.Errors,
+			"warnings": report.Warnings,
+		})
+	}
+}
+
+// served resumes and warms the world the hub serves
+func served(hub *server.Hub, world string, fields map[string]interface{}) {
+	resumed, err := hibernation.Resume(world, hub.GetSync())
+	if err != nil {
+		logging.Error("resuming hibernated world failed", map[string]interface{}{
+			"world": world,
+			"error": err.Error(),
+		})
+	}
+	fields["resumed_operations"] = resumed
+
+	if resumed > 0 {
+		state, err := worlds.Replay(hub.GetFullSync())
+		if err == nil {
+			for id := range state.Entities {
+				entityid.Claim(id, clientID)
+			}
+		}
+	}
+	entities, ok := hub.Warm()
+	fields["entities"] = entities
+	fields["checksum_cached"] = ok
+	fields["memory"] = usage.Current().Memory
+}
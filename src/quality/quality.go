@@ -0,0 +1,196 @@
+// Package quality decides how much each console should render, from the
+// frame telemetry it sends, so a session stays usable for everyone in it
+// when some of them are on weak hardware.
+//
+// Every session starts at level 0, full quality. Two samples in a row under
+// the target frame rate step it down a level: basic shadows and a capped
+// pixel ratio, then no shadows or post-processing, then culling entities
+// beyond the configured distance. Samples with half again the target's
+// frame rate step it back up, after four in a row at first; an upgrade the
+// console cannot hold, stepped down again within two samples, doubles the
+// samples the next one waits for, so a machine on the edge settles instead
+// of flickering between levels.
+//
+// Directives are control messages, never operations: they change how one
+// console draws the world, not the world.
+package quality
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"holodeck1/config"
+)
+
+// Levels of quality, from full to most degraded
+const (
+	LevelFull = iota
+	LevelReduced
+	LevelMinimal
+	LevelCulled
+)
+
+// Shadow qualities
+const (
+	ShadowsSoft  = "soft"
+	ShadowsBasic = "basic"
+	ShadowsOff   = "off"
+)
+
+// Steps of the policy, in samples
+const (
+	downgradeAfter = 2  // Samples under the target before stepping down
+	upgradeAfter   = 4  // Samples with headroom before stepping up, at first
+	maxPatience    = 64 // Most samples an upgrade waits for
+	failedUpgrade  = 2  // Samples within which stepping down again fails an upgrade
+)
+
+// headroom is how far above the target frame rate a console must run for
+// its quality to step up
+const headroom = 1.5
+
+// Directive tells a console how much to render
+type Directive struct {
+	Level          int     `json:"level"`   // 0 = full quality
+	Shadows        string  `json:"shadows"` // soft, basic or off
+	PostProcessing bool    `json:"post_processing"`
+	MaxPixelRatio  float64 `json:"max_pixel_ratio,omitempty"` // 0 = the device's own
+	CullDistance   float64 `json:"cull_distance,omitempty"`   // Metres, 0 = none
+	Reason         string  `json:"reason,omitempty"`
+}
+
+// For returns the directive of a level
+func For(level int) Directive {
+	switch level {
+	case LevelFull:
+		return Directive{Level: level, Shadows: ShadowsSoft, PostProcessing: true}
+	case LevelReduced:
+		return Directive{Level: level, Shadows: ShadowsBasic, PostProcessing: true, MaxPixelRatio: 1.5}
+	case LevelMinimal:
+		return Directive{Level: level, Shadows: ShadowsOff, MaxPixelRatio: 1}
+	}
+	return Directive{Level: LevelCulled, Shadows: ShadowsOff, MaxPixelRatio: 1, CullDistance: config.GetQualityCullDistance()}
+}
+
+// Levels returns the directive of every level, from full quality
+func Levels() []Directive {
+	levels := make([]Directive, 0, LevelCulled+1)
+	for level := LevelFull; level <= LevelCulled; level++ {
+		levels = append(levels, For(level))
+	}
+	return levels
+}
+
+// Session is a session's quality as the policy left it
+type Session struct {
+	HD1ID     string    `json:"hd1_id"`
+	Level     int       `json:"level"`
+	FPS       float64   `json:"fps"` // Of the latest sample
+	Reason    string    `json:"reason,omitempty"`
+	ChangedAt time.Time `json:"changed_at,omitempty"`
+}
+
+// state is the policy's memory of one session
+type state struct {
+	Session
+	under, over int // Samples in a row under the target, and with headroom
+	patience    int // Samples with headroom the next upgrade waits for
+	sinceUp     int // Samples since the last upgrade, -1 when none is on trial
+}
+
+var (
+	mutex    sync.Mutex
+	sessions = make(map[string]*state)
+)
+
+// Observe runs the policy on a session's sample and returns the directive
+// for its consoles when its level changed
+func Observe(hd1ID string, fps float64) (*Directive, bool) {
+	if !config.GetQualityAdaptive() {
+		return nil, false
+	}
+	target := float64(config.GetTelemetryTargetFPS())
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	s, ok := sessions[hd1ID]
+	if !ok {
+		s = &state{Session: Session{HD1ID: hd1ID}, patience: upgradeAfter, sinceUp: -1}
+		sessions[hd1ID] = s
+	}
+	s.FPS = fps
+	if s.sinceUp >= 0 {
+		s.sinceUp++
+	}
+
+	switch {
+	case fps < target:
+		s.under, s.over = s.under+1, 0
+	case fps >= target*headroom:
+		s.under, s.over = 0, s.over+1
+	default:
+		s.under, s.over = 0, 0
+	}
+
+	switch {
+	case s.under >= downgradeAfter && s.Level < LevelCulled:
+		if s.sinceUp >= 0 && s.sinceUp <= failedUpgrade {
+			s.patience = min(s.patience*2, maxPatience)
+		}
+		s.sinceUp = -1
+		s.change(s.Level+1, "frame rate under target")
+	case s.over >= s.patience && s.Level > LevelFull:
+		s.sinceUp = 0
+		s.change(s.Level-1, "frame rate above target")
+	default:
+		return nil, false
+	}
+	directive := For(s.Level)
+	directive.Reason = s.Reason
+	return &directive, true
+}
+
+func (s *state) change(level int, reason string) {
+	s.Level, s.Reason, s.ChangedAt = level, reason, time.Now().UTC()
+	s.under, s.over = 0, 0
+}
+
+// Current returns the directive a session's consoles follow, false at full
+// quality
+func Current(hd1ID string) (*Directive, bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	s, ok := sessions[hd1ID]
+	if !ok || s.Level == LevelFull {
+		return nil, false
+	}
+	directive := For(s.Level)
+	directive.Reason = s.Reason
+	return &directive, true
+}
+
+// Forget drops a session whose last console left
+func Forget(hd1ID string) {
+	mutex.Lock()
+	delete(sessions, hd1ID)
+	mutex.Unlock()
+}
+
+// Sessions returns the quality of every session the policy has seen, most
+// degraded first
+func Sessions() []Session {
+	mutex.Lock()
+	defer mutex.Unlock()
+	list := make([]Session, 0, len(sessions))
+	for _, s := range sessions {
+		list = append(list, s.Session)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Level != list[j].Level {
+			return list[i].Level > list[j].Level
+		}
+		return list[i].HD1ID < list[j].HD1ID
+	})
+	return list
+}
@@ -0,0 +1,380 @@
+// Package quotas holds callers to the request quotas of their
+// organization's plan.
+//
+// The plans file defines the plans, free, professional and enterprise out
+// of the box, and the plan of organizations not assigned one. A plan sets
+// a burst and a sustained rate for API calls, per session, and for WebSocket
+// messages, per connection, and how many sessions the organization may
+// have connected at once. Bursts are what a caller may spend at once; the
+// sustained rate refills them. Operators assign organizations their plan;
+// assignments are written to the storage backend and survive restarts.
+// Operators themselves are not held to quotas.
+package quotas
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+	"holodeck1/storage"
+)
+
+// Plans defined when the plans file does not define its own
+const (
+	PlanFree         = "free"
+	PlanProfessional = "professional"
+	PlanEnterprise   = "enterprise"
+)
+
+// idleAfter is how long a caller's bucket is kept without calls
+const idleAfter = 10 * time.Minute
+
+var (
+	// ErrUnknownPlan is returned assigning a plan the plans file does not
+	// define
+	ErrUnknownPlan = errors.New("unknown plan")
+	// ErrInvalidOrg is returned for organization IDs that cannot be stored
+	ErrInvalidOrg = errors.New("invalid organization")
+)
+
+var orgPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Tier is a burst and the sustained rate refilling it; a zero burst is
+// unlimited
+type Tier struct {
+	Burst     int     `yaml:"burst" json:"burst"`           // Calls or messages at once
+	PerMinute float64 `yaml:"per_minute" json:"per_minute"` // Sustained rate
+}
+
+// Limits are what a plan allows
+type Limits struct {
+	REST        Tier `yaml:"rest" json:"rest"`               // API calls per session
+	WebSocket   Tier `yaml:"websocket" json:"websocket"`     // Messages per connection
+	Connections int  `yaml:"connections" json:"connections"` // Sessions connected at once per organization, 0 = unlimited
+}
+
+// Plan is a named set of limits
+type Plan struct {
+	Name   string `yaml:"-" json:"name"`
+	Limits `yaml:",inline"`
+}
+
+// File is the format of the plans file
+type File struct {
+	Default string           `yaml:"default"` // Plan of organizations not assigned one
+	Plans   map[string]*Plan `yaml:"plans"`
+}
+
+// Assignment is the plan an operator assigned an organization
+type Assignment struct {
+	Org        string    `json:"org"`
+	Plan       string    `json:"plan"`
+	AssignedBy string    `json:"assigned_by"`
+	AssignedAt time.Time `json:"assigned_at"`
+}
+
+// builtin are the plans without a plans file
+var builtin = File{
+	Default: PlanFree,
+	Plans: map[string]*Plan{
+		PlanFree: {Limits: Limits{
+			REST:        Tier{Burst: 60, PerMinute: 300},
+			WebSocket:   Tier{Burst: 240, PerMinute: 7200},
+			Connections: 25,
+		}},
+		PlanProfessional: {Limits: Limits{
+			REST:        Tier{Burst: 300, PerMinute: 1200},
+			WebSocket:   Tier{Burst: 480, PerMinute: 14400},
+			Connections: 250,
+		}},
+		PlanEnterprise: {Limits: Limits{
+			REST:        Tier{Burst: 1000, PerMinute: 6000},
+			WebSocket:   Tier{Burst: 960, PerMinute: 28800},
+			Connections: 0,
+		}},
+	},
+}
+
+func (t Tier) validate() error {
+	if t.Burst < 0 || t.PerMinute < 0 {
+		return fmt.Errorf("burst and per_minute must not be negative")
+	}
+	if t.Burst > 0 && t.PerMinute == 0 {
+		return fmt.Errorf("per_minute is required with a burst")
+	}
+	return nil
+}
+
+func (p *Plan) validate() error {
+	if err := p.REST.validate(); err != nil {
+		return fmt.Errorf("rest: %v", err)
+	}
+	if err := p.WebSocket.validate(); err != nil {
+		return fmt.Errorf("websocket: %v", err)
+	}
+	if p.Connections < 0 {
+		return fmt.Errorf("connections must not be negative")
+	}
+	return nil
+}
+
+var (
+	plans       = map[string]*Plan{}
+	defaultPlan string
+	assigned    = map[string]*Assignment{}
+	mutex       sync.RWMutex
+)
+
+// Load reads the plans file; a missing file defines the built-in plans
+func Load() error {
+	file := config.GetQuotasFile()
+	document := builtin
+	raw, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		document = File{}
+		if err := yaml.Unmarshal(raw, &document); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+	}
+
+	loaded := map[string]*Plan{}
+	for name, plan := range document.Plans {
+		if plan == nil {
+			plan = &Plan{}
+		}
+		copied := *plan
+		copied.Name = name
+		if err := copied.validate(); err != nil {
+			return fmt.Errorf("%s: plan %q: %v", file, name, err)
+		}
+		loaded[name] = &copied
+	}
+	if _, ok := loaded[document.Default]; !ok {
+		return fmt.Errorf("%s: default plan %q is not defined", file, document.Default)
+	}
+
+	mutex.Lock()
+	plans, defaultPlan = loaded, document.Default
+	mutex.Unlock()
+	return nil
+}
+
+// Plans returns the plans by name, and the plan of organizations not
+// assigned one
+func Plans() ([]Plan, string) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	result := make([]Plan, 0, len(plans))
+	for _, plan := range plans {
+		result = append(result, *plan)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, defaultPlan
+}
+
+// PlanFor returns an organization's plan and its assignment, nil when it
+// is on the default plan. Organizations assigned a plan the plans file no
+// longer defines are held to the default one.
+func PlanFor(org string) (Plan, *Assignment) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	assignment := assigned[org]
+	if assignment != nil {
+		if plan, ok := plans[assignment.Plan]; ok {
+			copied := *assignment
+			return *plan, &copied
+		}
+	}
+	if plan, ok := plans[defaultPlan]; ok {
+		return *plan, nil
+	}
+	return Plan{}, nil // Plans not loaded: unlimited
+}
+
+func assignmentKey(org string) (string, error) {
+	return storage.Key(storage.NamespaceOrganizations, org+"/plan.json")
+}
+
+// Initialize loads the plan assignments from the storage backend
+func Initialize(ctx context.Context) error {
+	backend := storage.Default()
+	if backend == nil {
+		return fmt.Errorf("storage backend unavailable")
+	}
+	objects, err := backend.List(ctx, storage.NamespaceOrganizations+"/")
+	if err != nil {
+		return err
+	}
+
+	loaded := 0
+	for _, object := range objects {
+		if !strings.HasSuffix(object.Key, "/plan.json") {
+			continue
+		}
+		body, _, err := backend.Get(ctx, object.Key)
+		if err != nil {
+			continue
+		}
+		var assignment Assignment
+		err = json.NewDecoder(body).Decode(&assignment)
+		body.Close()
+		if err != nil || !orgPattern.MatchString(assignment.Org) {
+			logging.Warn("skipping unreadable plan assignment", map[string]interface{}{"key": object.Key})
+			continue
+		}
+		mutex.Lock()
+		assigned[assignment.Org] = &assignment
+		mutex.Unlock()
+		loaded++
+	}
+
+	logging.Info("organization plans loaded", map[string]interface{}{
+		"assignments": loaded,
+	})
+	return nil
+}
+
+// Assign puts an organization on a plan
+func Assign(ctx context.Context, org, plan, by string) (*Assignment, error) {
+	if !orgPattern.MatchString(org) {
+		return nil, ErrInvalidOrg
+	}
+	mutex.RLock()
+	_, ok := plans[plan]
+	mutex.RUnlock()
+	if !ok {
+		return nil, ErrUnknownPlan
+	}
+	backend := storage.Default()
+	if backend == nil {
+		return nil, fmt.Errorf("storage backend unavailable")
+	}
+	key, err := assignmentKey(org)
+	if err != nil {
+		return nil, err
+	}
+
+	assignment := &Assignment{Org: org, Plan: plan, AssignedBy: by, AssignedAt: time.Now().UTC()}
+	encoded, err := json.Marshal(assignment)
+	if err != nil {
+		return nil, err
+	}
+	if err := backend.Put(ctx, key, bytes.NewReader(encoded), int64(len(encoded)), "application/json"); err != nil {
+		return nil, err
+	}
+	mutex.Lock()
+	assigned[org] = assignment
+	mutex.Unlock()
+
+	logging.Info("organization plan assigned", map[string]interface{}{
+		"org":         org,
+		"plan":        plan,
+		"assigned_by": by,
+	})
+	copied := *assignment
+	return &copied, nil
+}
+
+// bucket holds what a caller may spend of a tier
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take spends one call of the tier, or returns how long until one is
+// available
+func (b *bucket) take(tier Tier, now time.Time) (bool, time.Duration) {
+	if tier.Burst <= 0 {
+		return true, 0
+	}
+	rate := tier.PerMinute / 60 // Per second
+	if b.last.IsZero() {
+		b.tokens = float64(tier.Burst)
+	} else {
+		b.tokens = math.Min(float64(tier.Burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+var (
+	callers      = map[string]*bucket{}
+	callersMutex sync.Mutex
+)
+
+// AllowCall spends one API call of a caller within its organization's
+// plan; refused calls get how long until the next is allowed
+func AllowCall(org, caller string) (bool, time.Duration) {
+	plan, _ := PlanFor(org)
+	callersMutex.Lock()
+	defer callersMutex.Unlock()
+	key := org + "\x00" + caller
+	b, ok := callers[key]
+	if !ok {
+		b = &bucket{}
+		callers[key] = b
+	}
+	return b.take(plan.REST, time.Now())
+}
+
+// Limiter holds one WebSocket connection to its organization's plan
+type Limiter struct {
+	org    string
+	bucket bucket
+	mutex  sync.Mutex
+}
+
+// NewLimiter returns a limiter for a connection of an organization
+func NewLimiter(org string) *Limiter {
+	return &Limiter{org: org}
+}
+
+// Allow spends one message; refused messages get how long until the next
+// is allowed
+func (l *Limiter) Allow() (bool, time.Duration) {
+	plan, _ := PlanFor(l.org)
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.bucket.take(plan.WebSocket, time.Now())
+}
+
+// Run forgets callers that made no call for a while, every minute until
+// ctx ends
+func Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			callersMutex.Lock()
+			for key, b := range callers {
+				if now.Sub(b.last) > idleAfter {
+					delete(callers, key)
+				}
+			}
+			callersMutex.Unlock()
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package quotas
+
+import (
+	"testing"
+	"time"
+)
+
+// testTier allows bursts of 3 calls, refilled at one a second
+var testTier = Tier{Burst: 3, PerMinute: 60}
+
+func TestBucketRefillsAndTellsHowLongToWait(t *testing.T) {
+	type call struct {
+		at      time.Duration // After the first call
+		allowed bool
+		wait    time.Duration // Until the next call is allowed, when refused
+	}
+	tests := []struct {
+		name  string
+		tier  Tier
+		calls []call
+	}{
+		{
+			name: "burst is spent at once, then refused for a refill",
+			tier: testTier,
+			calls: []call{
+				{at: 0, allowed: true},
+				{at: 0, allowed: true},
+				{at: 0, allowed: true},
+				{at: 0, allowed: false, wait: time.Second},
+			},
+		},
+		{
+			name: "refused call waits out what is left of the refill",
+			tier: testTier,
+			calls: []call{
+				{at: 0, allowed: true},
+				{at: 0, allowed: true},
+				{at: 0, allowed: true},
+				{at: 250 * time.Millisecond, allowed: false, wait: 750 * time.Millisecond},
+			},
+		},
+		{
+			name: "call after the wait is allowed",
+			tier: testTier,
+			calls: []call{
+				{at: 0, allowed: true},
+				{at: 0, allowed: true},
+				{at: 0, allowed: true},
+				{at: 0, allowed: false, wait: time.Second},
+				{at: time.Second, allowed: true},
+				{at: time.Second, allowed: false, wait: time.Second},
+			},
+		},
+		{
+			name: "refill stops at the burst",
+			tier: testTier,
+			calls: []call{
+				{at: 0, allowed: true},
+				{at: time.Hour, allowed: true},
+				{at: time.Hour, allowed: true},
+				{at: time.Hour, allowed: true},
+				{at: time.Hour, allowed: false, wait: time.Second},
+			},
+		},
+		{
+			name: "slower rate waits longer",
+			tier: Tier{Burst: 1, PerMinute: 6},
+			calls: []call{
+				{at: 0, allowed: true},
+				{at: 0, allowed: false, wait: 10 * time.Second},
+			},
+		},
+		{
+			name: "zero burst is unlimited",
+			tier: Tier{},
+			calls: []call{
+				{at: 0, allowed: true},
+				{at: 0, allowed: true},
+				{at: 0, allowed: true},
+				{at: 0, allowed: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+			var b bucket
+			for i, c := range tt.calls {
+				allowed, wait := b.take(tt.tier, start.Add(c.at))
+				if allowed != c.allowed {
+					t.Fatalf("call %d allowed = %v, want %v", i, allowed, c.allowed)
+				}
+				if diff := wait - c.wait; diff < -time.Millisecond || diff > time.Millisecond {
+					t.Errorf("call %d wait = %v, want %v", i, wait, c.wait)
+				}
+			}
+		})
+	}
+}
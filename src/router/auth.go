@@ -0,0 +1,100 @@
+package router
+
+import (
+	"net/http"
+
+	"holodeck1/api/shared"
+	"holodeck1/config"
+	"holodeck1/guests"
+	"holodeck1/server"
+	"holodeck1/spectators"
+)
+
+// Values of x-auth: who may reach an operation at all. Operators are local
+// callers and ones with the moderation token; signed operations are public
+// but check a secret of their own, as webhook receivers do.
+const (
+	authPublic   = "public"
+	authOperator = "operator"
+	authLocal    = "local"
+	authSigned   = "signed"
+)
+
+// authRequirement is an operation's x-auth and x-permissions
+type authRequirement struct {
+	auth        string
+	permissions []string
+}
+
+// authMiddleware enforces the specification's x-auth and x-permissions
+// before any handler runs, against the permissions the request context
+// grants. Mutating operations without x-permissions need edit. With
+// guests.require_link set, mutating calls from remote callers that are
+// neither guests nor operators are refused, unless the operation is
+// signed. In worlds with guest links, and while spectators watch, mutating
+// calls must carry a session token, so guests and spectators cannot shed
+// their scope by leaving out X-HD1-ID.
+func (ar *APIRouter) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := shared.Context(r)
+		requirement := ar.authRequirement(r)
+		switch requirement.auth {
+		case authOperator:
+			if !rc.Operator {
+				server.ReportRefusedOperator(r)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+		case authLocal:
+			if !server.IsLocalRequest(r) || rc.Impersonation != "" {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+		}
+
+		mutating := r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions
+		needed := requirement.permissions
+		if len(needed) == 0 && mutating {
+			needed = []string{guests.CapabilityEdit}
+		}
+
+		if rc.Guest == nil && mutating && config.GetGuestsRequireLink() && !rc.Operator && requirement.auth != authSigned {
+			http.Error(w, "This world requires a guest link", http.StatusForbidden)
+			return
+		}
+		if mutating && !rc.Authenticated && !rc.Operator && rc.Impersonation == "" && requirement.auth != authSigned {
+			if guests.Linked(rc.World) {
+				http.Error(w, "This world has guest links, changes need a session token", http.StatusForbidden)
+				return
+			}
+			if spectators.Watching() {
+				http.Error(w, "Spectators are watching, changes need a session token", http.StatusForbidden)
+				return
+			}
+		}
+		for _, permission := range needed {
+			if !rc.Can(permission) && rc.Impersonation != "" {
+				http.Error(w, "Impersonation scope does not allow this", http.StatusForbidden)
+				return
+			} else if !rc.Can(permission) && rc.Spectator {
+				http.Error(w, "Spectators may only view", http.StatusForbidden)
+				return
+			} else if !rc.Can(permission) {
+				http.Error(w, "Guest link does not allow this", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authRequirement returns the requirement of the operation a request was
+// routed to; unlisted operations are public
+func (ar *APIRouter) authRequirement(r *http.Request) authRequirement {
+	if path, ok := ar.operationPath(r); ok {
+		if requirement, found := operationAuth[r.Method+" "+path]; found {
+			return requirement
+		}
+	}
+	return authRequirement{auth: authPublic}
+}
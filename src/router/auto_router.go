@@ -34,6 +34,23 @@ import (
 	"holodeck1/api/scene"
 	"holodeck1/api/system"
 	"holodeck1/api/materials"
+	"holodeck1/api/accessibility"
+	"holodeck1/api/admin"
+	"holodeck1/api/anchors"
+	"holodeck1/api/assets"
+	"holodeck1/api/compliance"
+	"holodeck1/api/connectors"
+	"holodeck1/api/consent"
+	"holodeck1/api/email"
+	"holodeck1/api/forms"
+	"holodeck1/api/media"
+	"holodeck1/api/organizations"
+	"holodeck1/api/panels"
+	"holodeck1/api/screenshare"
+	"holodeck1/api/sessions"
+	"holodeck1/api/storage"
+	"holodeck1/api/whiteboard"
+	"holodeck1/api/worlds"
 )
 
 // APIRouter manages all auto-generated Three.js routes
@@ -71,70 +88,448 @@ func (ar *APIRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ar.router.ServeHTTP(w, r)
 }
 
+// apiVersion is the current API version from the specification (x-api-version)
+const apiVersion = "v1"
+
+// deprecatedOperations lists operations flagged deprecated in the specification
+var deprecatedOperations = map[string]deprecationInfo{
+}
+
+// maintenanceExempt lists mutating operations that stay open in maintenance
+// mode (x-maintenance: allow in the specification)
+var maintenanceExempt = map[string]bool{
+	"POST /admin/sync/deltas/{seqNum}/rebroadcast": true,
+	"POST /anchors/{anchorId}/resolve": true,
+	"POST /avatars": true,
+	"DELETE /avatars/{avatarId}": true,
+	"PUT /avatars/{avatarId}": true,
+	"POST /avatars/{sessionId}/move": true,
+	"GET /compliance/holds": true,
+	"POST /compliance/holds": true,
+	"DELETE /compliance/holds/{holdId}": true,
+	"GET /compliance/report": true,
+	"POST /connectors/test": true,
+	"GET /consent": true,
+	"POST /consent": true,
+	"GET /consent/report": true,
+	"POST /consent/withdraw": true,
+	"POST /email/messages": true,
+	"POST /entities/{entityId}/form": true,
+	"DELETE /sessions/impersonations/{impersonationId}": true,
+	"POST /sessions/tokens/revoke": true,
+	"POST /sessions/{hd1Id}/impersonation": true,
+	"DELETE /sessions/{hd1Id}/tokens": true,
+	"PUT /system/maintenance": true,
+	"POST /system/restore": true,
+	"POST /webhooks/{webhookId}/test": true,
+	"POST /worlds/validate": true,
+	"POST /worlds/{worldId}/arrivals": true,
+	"POST /worlds/{worldId}/arrivals/{ticket}/claim": true,
+	"POST /worlds/{worldId}/broadcasts": true,
+	"DELETE /worlds/{worldId}/broadcasts/{broadcastId}": true,
+	"DELETE /worlds/{worldId}/director": true,
+	"PUT /worlds/{worldId}/director": true,
+	"POST /worlds/{worldId}/guest-links": true,
+	"DELETE /worlds/{worldId}/guest-links/{linkId}": true,
+	"POST /worlds/{worldId}/migrate": true,
+	"POST /worlds/{worldId}/migration/snapshot": true,
+	"POST /worlds/{worldId}/migration/tail": true,
+	"POST /worlds/{worldId}/moderation/bans": true,
+	"DELETE /worlds/{worldId}/moderation/bans/{banId}": true,
+	"POST /worlds/{worldId}/moderation/kick": true,
+	"POST /worlds/{worldId}/moderation/mutes": true,
+	"DELETE /worlds/{worldId}/moderation/mutes/{hd1Id}": true,
+	"POST /worlds/{worldId}/polls": true,
+	"POST /worlds/{worldId}/polls/{pollId}/close": true,
+	"PUT /worlds/{worldId}/polls/{pollId}/vote": true,
+	"POST /worlds/{worldId}/telemetry": true,
+	"POST /worlds/{worldId}/views/{viewName}/visit": true,
+}
+
+// operationAuth lists who may call operations and the permissions they need
+// (x-auth and x-permissions in the specification). Unlisted operations are
+// public; unlisted mutating ones need edit.
+var operationAuth = map[string]authRequirement{
+	"GET /admin/sync/deltas": {auth: "operator"},
+	"GET /admin/sync/deltas/{seqNum}": {auth: "operator"},
+	"POST /admin/sync/deltas/{seqNum}/rebroadcast": {auth: "operator"},
+	"POST /admin/sync/deltas/{seqNum}/revert": {auth: "operator"},
+	"POST /anchors/{anchorId}/resolve": {permissions: []string{"view"}},
+	"GET /assets/quarantine": {auth: "operator"},
+	"DELETE /assets/quarantine/{digest}": {auth: "operator"},
+	"POST /assets/quarantine/{digest}/release": {auth: "operator"},
+	"POST /avatars": {permissions: []string{"view"}},
+	"DELETE /avatars/{avatarId}": {permissions: []string{"view"}},
+	"PUT /avatars/{avatarId}": {permissions: []string{"view"}},
+	"POST /avatars/{sessionId}/move": {permissions: []string{"view"}},
+	"GET /compliance/holds": {auth: "operator"},
+	"POST /compliance/holds": {auth: "operator"},
+	"DELETE /compliance/holds/{holdId}": {auth: "operator"},
+	"GET /compliance/report": {auth: "operator"},
+	"GET /connectors": {auth: "operator"},
+	"POST /connectors/test": {auth: "operator"},
+	"GET /consent/report": {auth: "operator"},
+	"POST /email/messages": {auth: "operator"},
+	"GET /email/templates": {auth: "operator"},
+	"POST /entities/{entityId}/form": {permissions: []string{"chat"}},
+	"DELETE /entities/{entityId}/form/submissions": {auth: "operator"},
+	"GET /entities/{entityId}/form/submissions": {auth: "operator"},
+	"GET /organizations/{orgId}/plan": {auth: "operator"},
+	"PUT /organizations/{orgId}/plan": {auth: "operator"},
+	"GET /organizations/{orgId}/usage/api": {auth: "operator"},
+	"GET /sessions/impersonations": {auth: "operator"},
+	"DELETE /sessions/impersonations/{impersonationId}": {auth: "operator"},
+	"POST /sessions/tokens/revoke": {permissions: []string{"view"}},
+	"POST /sessions/{hd1Id}/impersonation": {auth: "operator"},
+	"DELETE /sessions/{hd1Id}/tokens": {permissions: []string{"view"}},
+	"POST /storage/signed-url": {auth: "operator"},
+	"GET /system/backup": {auth: "operator"},
+	"PUT /system/maintenance": {auth: "local"},
+	"POST /system/restore": {auth: "operator"},
+	"GET /webhooks": {auth: "operator"},
+	"POST /webhooks/{webhookId}": {auth: "signed"},
+	"POST /webhooks/{webhookId}/test": {auth: "operator"},
+	"POST /worlds/validate": {auth: "operator", permissions: []string{"view"}},
+	"POST /worlds/{worldId}/arrivals": {auth: "signed"},
+	"POST /worlds/{worldId}/arrivals/{ticket}/claim": {permissions: []string{"view"}},
+	"GET /worlds/{worldId}/bookings": {auth: "operator"},
+	"POST /worlds/{worldId}/bookings": {auth: "operator"},
+	"DELETE /worlds/{worldId}/bookings/{bookingId}": {auth: "operator"},
+	"GET /worlds/{worldId}/bookings/{bookingId}": {auth: "operator"},
+	"PUT /worlds/{worldId}/bookings/{bookingId}": {auth: "operator"},
+	"GET /worlds/{worldId}/bookings/{bookingId}/ics": {auth: "operator"},
+	"GET /worlds/{worldId}/broadcasts": {auth: "operator"},
+	"POST /worlds/{worldId}/broadcasts": {auth: "operator"},
+	"DELETE /worlds/{worldId}/broadcasts/{broadcastId}": {auth: "operator"},
+	"GET /worlds/{worldId}/broadcasts/{broadcastId}": {auth: "operator"},
+	"GET /worlds/{worldId}/calendar": {auth: "operator"},
+	"PUT /worlds/{worldId}/clock": {auth: "operator"},
+	"POST /worlds/{worldId}/clock/pause": {auth: "operator"},
+	"POST /worlds/{worldId}/clock/resume": {auth: "operator"},
+	"PUT /worlds/{worldId}/constraints": {auth: "operator"},
+	"DELETE /worlds/{worldId}/director": {auth: "operator"},
+	"PUT /worlds/{worldId}/director": {auth: "operator"},
+	"POST /worlds/{worldId}/geo/tiles": {auth: "operator"},
+	"GET /worlds/{worldId}/guest-links": {auth: "operator"},
+	"POST /worlds/{worldId}/guest-links": {auth: "operator"},
+	"DELETE /worlds/{worldId}/guest-links/{linkId}": {auth: "operator"},
+	"GET /worlds/{worldId}/imports": {auth: "operator"},
+	"POST /worlds/{worldId}/imports": {auth: "operator"},
+	"GET /worlds/{worldId}/imports/{importId}": {auth: "operator"},
+	"POST /worlds/{worldId}/migrate": {auth: "operator"},
+	"POST /worlds/{worldId}/migration/snapshot": {auth: "operator"},
+	"POST /worlds/{worldId}/migration/tail": {auth: "operator"},
+	"GET /worlds/{worldId}/moderation/audit": {auth: "operator"},
+	"GET /worlds/{worldId}/moderation/bans": {auth: "operator"},
+	"POST /worlds/{worldId}/moderation/bans": {auth: "operator"},
+	"DELETE /worlds/{worldId}/moderation/bans/{banId}": {auth: "operator"},
+	"POST /worlds/{worldId}/moderation/kick": {auth: "operator"},
+	"GET /worlds/{worldId}/moderation/mutes": {auth: "operator"},
+	"POST /worlds/{worldId}/moderation/mutes": {auth: "operator"},
+	"DELETE /worlds/{worldId}/moderation/mutes/{hd1Id}": {auth: "operator"},
+	"GET /worlds/{worldId}/params": {auth: "operator"},
+	"DELETE /worlds/{worldId}/params/{key}": {auth: "operator"},
+	"GET /worlds/{worldId}/params/{key}": {auth: "operator"},
+	"PUT /worlds/{worldId}/params/{key}": {auth: "operator"},
+	"PUT /worlds/{worldId}/polls/{pollId}/vote": {permissions: []string{"chat"}},
+	"GET /worlds/{worldId}/quality": {auth: "operator"},
+	"GET /worlds/{worldId}/spectators": {auth: "operator"},
+	"GET /worlds/{worldId}/telemetry": {auth: "operator"},
+	"POST /worlds/{worldId}/telemetry": {permissions: []string{"view"}},
+	"GET /worlds/{worldId}/usage": {auth: "operator"},
+	"POST /worlds/{worldId}/views/{viewName}/visit": {permissions: []string{"view"}},
+}
+
+// compatibilityRoutes maps legacy paths (x-legacy-paths) onto current operations
+var compatibilityRoutes = []compatRoute{
+	{legacyPath: "/threejs/avatars", method: "GET", operationID: "getAvatars", sunset: ""},
+	{legacyPath: "/threejs/avatars", method: "POST", operationID: "createAvatar", sunset: ""},
+	{legacyPath: "/threejs/entities/{entityId}", method: "DELETE", operationID: "deleteEntity", sunset: ""},
+	{legacyPath: "/threejs/entities/{entityId}", method: "PUT", operationID: "updateEntity", sunset: ""},
+	{legacyPath: "/threejs/scene", method: "GET", operationID: "getScene", sunset: ""},
+	{legacyPath: "/threejs/scene", method: "PUT", operationID: "updateScene", sunset: ""},
+}
+
 // setupRoutes configures all API routes from specification
 func (ar *APIRouter) setupRoutes() {
-	// API prefix
-	api := ar.router.PathPrefix("/api").Subrouter()
+	// Versioned base first so the unversioned alias never shadows it;
+	// /api stays mounted as an alias of the current version
+	for _, base := range []string{"/api/" + apiVersion, "/api"} {
+		api := ar.router.PathPrefix(base).Subrouter()
+		api.Use(ar.contextMiddleware)
+		api.Use(ar.usageMiddleware)
+		api.Use(ar.quotaMiddleware)
+		api.Use(deprecationMiddleware)
+		api.Use(ar.maintenanceMiddleware)
+		api.Use(ar.impersonationMiddleware)
+		api.Use(ar.authMiddleware)
+		api.Use(ar.signingMiddleware)
+		ar.registerRoutes(api)
+		ar.registerCompatRoutes(api)
+	}
 	
+	logging.Info("HD1 API routes configured", map[string]interface{}{
+		"api_version": apiVersion,
+		"total_routes": 198,
+		"deprecated_ops": len(deprecatedOperations),
+		"compat_routes": len(compatibilityRoutes),
+		"sync_ops": 12,
+		"entity_ops": 3,
+		"avatar_ops": 5,
+		"scene_ops": 2,
+		"materials_ops": 4,
+		"system_ops": 12,
+		"extension_ops": 139,
+	})
+}
+
+// registerRoutes registers every specification route on one API base
+func (ar *APIRouter) registerRoutes(api *mux.Router) {
 	// ========================================
 	// SYNC OPERATIONS (Generated from spec)
 	// ========================================
 
-	api.HandleFunc("/sync/missing/{from}/{to}", sync.GetMissingOperations).Methods("GET")
-	api.HandleFunc("/sync/stats", sync.GetSyncStats).Methods("GET")
-	api.HandleFunc("/sync/operations", sync.SubmitOperation).Methods("POST")
-	api.HandleFunc("/sync/full", sync.GetFullSync).Methods("GET")
+	api.HandleFunc("/sync/chunks/{chunk}", sync.GetChunk).Methods("GET").Name("getSyncChunk")
+	api.HandleFunc("/sync/entities", sync.GetEntities).Methods("GET").Name("getSyncEntities")
+	api.HandleFunc("/sync/full", sync.GetFullSync).Methods("GET").Name("getFullSync")
+	api.HandleFunc("/sync/missing/{from}/{to}", sync.GetMissingOperations).Methods("GET").Name("getMissingOperations")
+	api.HandleFunc("/sync/operations", sync.SubmitOperation).Methods("POST").Name("submitOperation")
+	api.HandleFunc("/sync/stats", sync.GetSyncStats).Methods("GET").Name("getSyncStats")
+	api.HandleFunc("/sync/stream", sync.GetSyncStream).Methods("GET").Name("getSyncStream")
+	api.HandleFunc("/sync/transactions", sync.BeginTransaction).Methods("POST").Name("beginTransaction")
+	api.HandleFunc("/sync/transactions/{transactionId}", sync.RollbackTransaction).Methods("DELETE").Name("rollbackTransaction")
+	api.HandleFunc("/sync/transactions/{transactionId}", sync.GetTransaction).Methods("GET").Name("getTransaction")
+	api.HandleFunc("/sync/transactions/{transactionId}/commit", sync.CommitTransaction).Methods("POST").Name("commitTransaction")
+	api.HandleFunc("/sync/transactions/{transactionId}/operations", sync.QueueTransactionOperation).Methods("POST").Name("queueTransactionOperation")
 	
 	// ========================================
 	// ENTITIES (Generated from spec)
 	// ========================================
 
-	api.HandleFunc("/entities", entities.GetEntities).Methods("GET")
-	api.HandleFunc("/entities/{entityId}", entities.UpdateEntity).Methods("PUT")
-	api.HandleFunc("/entities/{entityId}", entities.DeleteEntity).Methods("DELETE")
+	api.HandleFunc("/entities", entities.GetEntities).Methods("GET").Name("getEntities")
+	api.HandleFunc("/entities/{entityId}", entities.DeleteEntity).Methods("DELETE").Name("deleteEntity")
+	api.HandleFunc("/entities/{entityId}", entities.UpdateEntity).Methods("PUT").Name("updateEntity")
 	
 	// ========================================
 	// AVATARS (Generated from spec)
 	// ========================================
 
-	api.HandleFunc("/avatars/{sessionId}/move", avatars.MoveAvatar).Methods("POST")
-	api.HandleFunc("/avatars/{avatarId}", avatars.UpdateAvatar).Methods("PUT")
-	api.HandleFunc("/avatars/{avatarId}", avatars.RemoveAvatar).Methods("DELETE")
-	api.HandleFunc("/avatars", avatars.GetAvatars).Methods("GET")
-	api.HandleFunc("/avatars", avatars.CreateAvatar).Methods("POST")
+	api.HandleFunc("/avatars", avatars.GetAvatars).Methods("GET").Name("getAvatars")
+	api.HandleFunc("/avatars", avatars.CreateAvatar).Methods("POST").Name("createAvatar")
+	api.HandleFunc("/avatars/{avatarId}", avatars.RemoveAvatar).Methods("DELETE").Name("removeAvatar")
+	api.HandleFunc("/avatars/{avatarId}", avatars.UpdateAvatar).Methods("PUT").Name("updateAvatar")
+	api.HandleFunc("/avatars/{sessionId}/move", avatars.MoveAvatar).Methods("POST").Name("moveAvatar")
 	
 	// ========================================
 	// SCENE MANAGEMENT (Generated from spec)
 	// ========================================
 
-	api.HandleFunc("/scene", scene.GetScene).Methods("GET")
-	api.HandleFunc("/scene", scene.UpdateScene).Methods("PUT")
+	api.HandleFunc("/scene", scene.GetScene).Methods("GET").Name("getScene")
+	api.HandleFunc("/scene", scene.UpdateScene).Methods("PUT").Name("updateScene")
 	
 	// ========================================
 	// MATERIALS (Generated from spec)
 	// ========================================
 
-	api.HandleFunc("/materials/basic", materials.CreateBasicMaterial).Methods("POST")
-	api.HandleFunc("/materials/phong", materials.CreatePhongMaterial).Methods("POST")
-	api.HandleFunc("/materials/standard", materials.CreateStandardMaterial).Methods("POST")
-	api.HandleFunc("/materials/physical", materials.CreatePhysicalMaterial).Methods("POST")
+	api.HandleFunc("/materials/basic", materials.CreateBasicMaterial).Methods("POST").Name("createBasicMaterial")
+	api.HandleFunc("/materials/phong", materials.CreatePhongMaterial).Methods("POST").Name("createPhongMaterial")
+	api.HandleFunc("/materials/physical", materials.CreatePhysicalMaterial).Methods("POST").Name("createPhysicalMaterial")
+	api.HandleFunc("/materials/standard", materials.CreateStandardMaterial).Methods("POST").Name("createStandardMaterial")
 	
 	// ========================================
 	// SYSTEM (Generated from spec)
 	// ========================================
 
+	api.HandleFunc("/system/backup", func(w http.ResponseWriter, r *http.Request) {
+		hub := r.Context().Value("hub").(*server.Hub)
+		system.GetBackupHandler(w, r, hub)
+	}).Methods("GET").Name("createBackup")
+	api.HandleFunc("/system/capabilities", func(w http.ResponseWriter, r *http.Request) {
+		hub := r.Context().Value("hub").(*server.Hub)
+		system.GetCapabilitiesHandler(w, r, hub)
+	}).Methods("GET").Name("getCapabilities")
+	api.HandleFunc("/system/features", func(w http.ResponseWriter, r *http.Request) {
+		hub := r.Context().Value("hub").(*server.Hub)
+		system.GetFeaturesHandler(w, r, hub)
+	}).Methods("GET").Name("getFeatures")
+	api.HandleFunc("/system/integrity", func(w http.ResponseWriter, r *http.Request) {
+		hub := r.Context().Value("hub").(*server.Hub)
+		system.GetIntegrityHandler(w, r, hub)
+	}).Methods("GET").Name("getIntegrity")
+	api.HandleFunc("/system/locales", func(w http.ResponseWriter, r *http.Request) {
+		hub := r.Context().Value("hub").(*server.Hub)
+		system.GetLocalesHandler(w, r, hub)
+	}).Methods("GET").Name("getLocales")
+	api.HandleFunc("/system/locales/{lang}", func(w http.ResponseWriter, r *http.Request) {
+		hub := r.Context().Value("hub").(*server.Hub)
+		system.GetLocaleHandler(w, r, hub)
+	}).Methods("GET").Name("getLocale")
+	api.HandleFunc("/system/maintenance", func(w http.ResponseWriter, r *http.Request) {
+		hub := r.Context().Value("hub").(*server.Hub)
+		system.GetMaintenanceHandler(w, r, hub)
+	}).Methods("GET").Name("getMaintenance")
+	api.HandleFunc("/system/maintenance", func(w http.ResponseWriter, r *http.Request) {
+		hub := r.Context().Value("hub").(*server.Hub)
+		system.SetMaintenanceHandler(w, r, hub)
+	}).Methods("PUT").Name("setMaintenance")
+	api.HandleFunc("/system/restore", func(w http.ResponseWriter, r *http.Request) {
+		hub := r.Context().Value("hub").(*server.Hub)
+		system.RestoreBackupHandler(w, r, hub)
+	}).Methods("POST").Name("restoreBackup")
+	api.HandleFunc("/system/simulation", func(w http.ResponseWriter, r *http.Request) {
+		hub := r.Context().Value("hub").(*server.Hub)
+		system.GetSimulationHandler(w, r, hub)
+	}).Methods("GET").Name("getSimulation")
+	api.HandleFunc("/system/time", func(w http.ResponseWriter, r *http.Request) {
+		hub := r.Context().Value("hub").(*server.Hub)
+		system.GetTimeHandler(w, r, hub)
+	}).Methods("GET").Name("getServerTime")
 	api.HandleFunc("/system/version", func(w http.ResponseWriter, r *http.Request) {
 		hub := r.Context().Value("hub").(*server.Hub)
 		system.GetVersionHandler(w, r, hub)
-	}).Methods("GET")
+	}).Methods("GET").Name("getVersion")
 	
-	logging.Info("HD1 API routes configured", map[string]interface{}{
-		"total_routes": 40,
-		"sync_ops": 4,
-		"entity_ops": 3,
-		"avatar_ops": 5,
-		"scene_ops": 2,
-		"materials_ops": 4,
-		"system_ops": 1,
-	})
+	// ========================================
+	// EXTENDED OPERATIONS (Generated from spec)
+	// ========================================
+
+	api.HandleFunc("/accessibility/descriptions", accessibility.GetDescriptions).Methods("GET").Name("getSceneDescriptions")
+	api.HandleFunc("/accessibility/world", accessibility.GetWorldView).Methods("GET").Name("getAccessibleWorldView")
+	api.HandleFunc("/admin/sync/deltas", admin.ListDeltas).Methods("GET").Name("listDeltas")
+	api.HandleFunc("/admin/sync/deltas/{seqNum}", admin.GetDelta).Methods("GET").Name("getDelta")
+	api.HandleFunc("/admin/sync/deltas/{seqNum}/rebroadcast", admin.RebroadcastDelta).Methods("POST").Name("rebroadcastDelta")
+	api.HandleFunc("/admin/sync/deltas/{seqNum}/revert", admin.RevertDelta).Methods("POST").Name("revertDelta")
+	api.HandleFunc("/anchors", anchors.ListAnchors).Methods("GET").Name("listAnchors")
+	api.HandleFunc("/anchors", anchors.CreateAnchor).Methods("POST").Name("createAnchor")
+	api.HandleFunc("/anchors/{anchorId}", anchors.DeleteAnchor).Methods("DELETE").Name("deleteAnchor")
+	api.HandleFunc("/anchors/{anchorId}", anchors.GetAnchor).Methods("GET").Name("getAnchor")
+	api.HandleFunc("/anchors/{anchorId}/resolve", anchors.ResolveAnchor).Methods("POST").Name("resolveAnchor")
+	api.HandleFunc("/assets", assets.UploadAsset).Methods("POST").Name("uploadAsset")
+	api.HandleFunc("/assets/gc", assets.CollectAssetGarbage).Methods("POST").Name("collectAssetGarbage")
+	api.HandleFunc("/assets/orphans", assets.GetOrphanAssets).Methods("GET").Name("getOrphanAssets")
+	api.HandleFunc("/assets/quarantine", assets.ListQuarantinedAssets).Methods("GET").Name("listQuarantinedAssets")
+	api.HandleFunc("/assets/quarantine/{digest}", assets.DiscardQuarantinedAsset).Methods("DELETE").Name("discardQuarantinedAsset")
+	api.HandleFunc("/assets/quarantine/{digest}/release", assets.ReleaseQuarantinedAsset).Methods("POST").Name("releaseQuarantinedAsset")
+	api.HandleFunc("/assets/settings", assets.GetAssetSettings).Methods("GET").Name("getAssetSettings")
+	api.HandleFunc("/assets/settings", assets.UpdateAssetSettings).Methods("PUT").Name("updateAssetSettings")
+	api.HandleFunc("/assets/{digest}", assets.GetAsset).Methods("GET").Name("getAsset")
+	api.HandleFunc("/assets/{digest}/pointcloud", assets.GetPointCloud).Methods("GET").Name("getAssetPointCloud")
+	api.HandleFunc("/assets/{digest}/variants", assets.GetAssetVariants).Methods("GET").Name("getAssetVariants")
+	api.HandleFunc("/compliance/holds", compliance.ListHolds).Methods("GET").Name("listLegalHolds")
+	api.HandleFunc("/compliance/holds", compliance.PlaceHold).Methods("POST").Name("placeLegalHold")
+	api.HandleFunc("/compliance/holds/{holdId}", compliance.ReleaseHold).Methods("DELETE").Name("releaseLegalHold")
+	api.HandleFunc("/compliance/report", compliance.GetComplianceReport).Methods("GET").Name("getComplianceReport")
+	api.HandleFunc("/connectors", connectors.ListConnectors).Methods("GET").Name("listConnectors")
+	api.HandleFunc("/connectors/test", connectors.TestConnectors).Methods("POST").Name("testConnectors")
+	api.HandleFunc("/consent", consent.GetConsent).Methods("GET").Name("getConsent")
+	api.HandleFunc("/consent", consent.AcceptConsent).Methods("POST").Name("acceptConsent")
+	api.HandleFunc("/consent/report", consent.GetConsentReport).Methods("GET").Name("getConsentReport")
+	api.HandleFunc("/consent/withdraw", consent.WithdrawConsent).Methods("POST").Name("withdrawConsent")
+	api.HandleFunc("/email/messages", email.SendMessage).Methods("POST").Name("sendEmail")
+	api.HandleFunc("/email/templates", email.ListTemplates).Methods("GET").Name("listEmailTemplates")
+	api.HandleFunc("/entities/{entityId}/form", forms.SubmitForm).Methods("POST").Name("submitForm")
+	api.HandleFunc("/entities/{entityId}/form/submissions", forms.ClearFormSubmissions).Methods("DELETE").Name("clearFormSubmissions")
+	api.HandleFunc("/entities/{entityId}/form/submissions", forms.ListFormSubmissions).Methods("GET").Name("listFormSubmissions")
+	api.HandleFunc("/entities/{entityId}/media", media.ControlMedia).Methods("POST").Name("controlEntityMedia")
+	api.HandleFunc("/entities/{entityId}/panel", panels.UpdatePanel).Methods("PUT").Name("updateEntityPanel")
+	api.HandleFunc("/entities/{entityId}/whiteboard", whiteboard.DrawWhiteboard).Methods("POST").Name("drawWhiteboard")
+	api.HandleFunc("/organizations/{orgId}/plan", organizations.GetPlan).Methods("GET").Name("getOrganizationPlan")
+	api.HandleFunc("/organizations/{orgId}/plan", organizations.AssignPlan).Methods("PUT").Name("assignOrganizationPlan")
+	api.HandleFunc("/organizations/{orgId}/usage/api", organizations.GetAPIUsage).Methods("GET").Name("getOrganizationAPIUsage")
+	api.HandleFunc("/physics/profiles", worlds.ListPhysicsProfiles).Methods("GET").Name("listPhysicsProfiles")
+	api.HandleFunc("/plans", organizations.ListPlans).Methods("GET").Name("listPlans")
+	api.HandleFunc("/schema/components", entities.ListComponents).Methods("GET").Name("listEntityComponents")
+	api.HandleFunc("/screenshares", screenshare.ListScreenShares).Methods("GET").Name("listScreenShares")
+	api.HandleFunc("/screenshares", screenshare.StartScreenShare).Methods("POST").Name("startScreenShare")
+	api.HandleFunc("/screenshares/{shareId}", screenshare.StopScreenShare).Methods("DELETE").Name("stopScreenShare")
+	api.HandleFunc("/sessions/impersonations", sessions.ListImpersonations).Methods("GET").Name("listImpersonations")
+	api.HandleFunc("/sessions/impersonations/{impersonationId}", sessions.EndImpersonation).Methods("DELETE").Name("endImpersonation")
+	api.HandleFunc("/sessions/presence", sessions.GetPresence).Methods("GET").Name("getPresence")
+	api.HandleFunc("/sessions/tokens/revoke", sessions.RevokeToken).Methods("POST").Name("revokeSessionToken")
+	api.HandleFunc("/sessions/{hd1Id}/impersonation", sessions.StartImpersonation).Methods("POST").Name("startImpersonation")
+	api.HandleFunc("/sessions/{hd1Id}/tokens", sessions.RevokeSession).Methods("DELETE").Name("revokeSession")
+	api.HandleFunc("/storage/signed-url", storage.CreateSignedURL).Methods("POST").Name("createSignedURL")
+	api.HandleFunc("/webhooks", sync.ListWebhooks).Methods("GET").Name("listWebhooks")
+	api.HandleFunc("/webhooks/{webhookId}", sync.ReceiveWebhook).Methods("POST").Name("receiveWebhook")
+	api.HandleFunc("/webhooks/{webhookId}/test", sync.TestWebhook).Methods("POST").Name("testWebhook")
+	api.HandleFunc("/worlds/validate", worlds.ValidateWorlds).Methods("POST").Name("validateWorlds")
+	api.HandleFunc("/worlds/{worldId}/arrivals", worlds.ExpectArrival).Methods("POST").Name("expectArrival")
+	api.HandleFunc("/worlds/{worldId}/arrivals/{ticket}/claim", worlds.ClaimArrival).Methods("POST").Name("claimArrival")
+	api.HandleFunc("/worlds/{worldId}/bookings", worlds.ListBookings).Methods("GET").Name("listBookings")
+	api.HandleFunc("/worlds/{worldId}/bookings", worlds.CreateBooking).Methods("POST").Name("createBooking")
+	api.HandleFunc("/worlds/{worldId}/bookings/{bookingId}", worlds.CancelBooking).Methods("DELETE").Name("cancelBooking")
+	api.HandleFunc("/worlds/{worldId}/bookings/{bookingId}", worlds.GetBooking).Methods("GET").Name("getBooking")
+	api.HandleFunc("/worlds/{worldId}/bookings/{bookingId}", worlds.UpdateBooking).Methods("PUT").Name("updateBooking")
+	api.HandleFunc("/worlds/{worldId}/bookings/{bookingId}/ics", worlds.GetBookingCalendar).Methods("GET").Name("getBookingCalendar")
+	api.HandleFunc("/worlds/{worldId}/broadcasts", worlds.ListBroadcasts).Methods("GET").Name("listBroadcasts")
+	api.HandleFunc("/worlds/{worldId}/broadcasts", worlds.StartBroadcast).Methods("POST").Name("startBroadcast")
+	api.HandleFunc("/worlds/{worldId}/broadcasts/{broadcastId}", worlds.StopBroadcast).Methods("DELETE").Name("stopBroadcast")
+	api.HandleFunc("/worlds/{worldId}/broadcasts/{broadcastId}", worlds.GetBroadcast).Methods("GET").Name("getBroadcast")
+	api.HandleFunc("/worlds/{worldId}/calendar", worlds.GetWorldCalendar).Methods("GET").Name("getWorldCalendar")
+	api.HandleFunc("/worlds/{worldId}/checkpoints", worlds.ListCheckpoints).Methods("GET").Name("listCheckpoints")
+	api.HandleFunc("/worlds/{worldId}/checkpoints", worlds.CreateCheckpoint).Methods("POST").Name("createCheckpoint")
+	api.HandleFunc("/worlds/{worldId}/checkpoints/{checkpointId}", worlds.GetCheckpoint).Methods("GET").Name("getCheckpoint")
+	api.HandleFunc("/worlds/{worldId}/checkpoints/{checkpointId}/rollback", worlds.RollbackCheckpoint).Methods("POST").Name("rollbackCheckpoint")
+	api.HandleFunc("/worlds/{worldId}/clock", worlds.GetClock).Methods("GET").Name("getWorldClock")
+	api.HandleFunc("/worlds/{worldId}/clock", worlds.SetClock).Methods("PUT").Name("setWorldClock")
+	api.HandleFunc("/worlds/{worldId}/clock/pause", worlds.PauseClock).Methods("POST").Name("pauseWorldClock")
+	api.HandleFunc("/worlds/{worldId}/clock/resume", worlds.ResumeClock).Methods("POST").Name("resumeWorldClock")
+	api.HandleFunc("/worlds/{worldId}/constraints", worlds.GetConstraints).Methods("GET").Name("getWorldConstraints")
+	api.HandleFunc("/worlds/{worldId}/constraints", worlds.SetConstraints).Methods("PUT").Name("setWorldConstraints")
+	api.HandleFunc("/worlds/{worldId}/diff", worlds.DiffCheckpoints).Methods("GET").Name("diffCheckpoints")
+	api.HandleFunc("/worlds/{worldId}/director", worlds.ReleaseDirector).Methods("DELETE").Name("releaseDirector")
+	api.HandleFunc("/worlds/{worldId}/director", worlds.SetDirector).Methods("PUT").Name("setDirector")
+	api.HandleFunc("/worlds/{worldId}/documents", worlds.ListDocuments).Methods("GET").Name("listDocuments")
+	api.HandleFunc("/worlds/{worldId}/documents", worlds.CreateDocument).Methods("POST").Name("createDocument")
+	api.HandleFunc("/worlds/{worldId}/documents/{documentId}", worlds.DeleteDocument).Methods("DELETE").Name("deleteDocument")
+	api.HandleFunc("/worlds/{worldId}/documents/{documentId}", worlds.GetDocument).Methods("GET").Name("getDocument")
+	api.HandleFunc("/worlds/{worldId}/documents/{documentId}", worlds.UpdateDocument).Methods("PUT").Name("updateDocument")
+	api.HandleFunc("/worlds/{worldId}/documents/{documentId}/operations", worlds.SubmitDocumentOperation).Methods("POST").Name("submitDocumentOperation")
+	api.HandleFunc("/worlds/{worldId}/environment", worlds.GetEnvironment).Methods("GET").Name("getWorldEnvironment")
+	api.HandleFunc("/worlds/{worldId}/environment", worlds.SetEnvironment).Methods("PUT").Name("setWorldEnvironment")
+	api.HandleFunc("/worlds/{worldId}/export", worlds.ExportWorld).Methods("GET").Name("exportWorld")
+	api.HandleFunc("/worlds/{worldId}/geo", worlds.GetGeo).Methods("GET").Name("getWorldGeo")
+	api.HandleFunc("/worlds/{worldId}/geo", worlds.SetGeo).Methods("PUT").Name("setWorldGeo")
+	api.HandleFunc("/worlds/{worldId}/geo/tiles", worlds.LoadGeoTiles).Methods("POST").Name("loadWorldGeoTiles")
+	api.HandleFunc("/worlds/{worldId}/guest-links", worlds.ListGuestLinks).Methods("GET").Name("listGuestLinks")
+	api.HandleFunc("/worlds/{worldId}/guest-links", worlds.CreateGuestLink).Methods("POST").Name("createGuestLink")
+	api.HandleFunc("/worlds/{worldId}/guest-links/{linkId}", worlds.RevokeGuestLink).Methods("DELETE").Name("revokeGuestLink")
+	api.HandleFunc("/worlds/{worldId}/imports", worlds.ListImports).Methods("GET").Name("listWorldImports")
+	api.HandleFunc("/worlds/{worldId}/imports", worlds.CreateImport).Methods("POST").Name("createWorldImport")
+	api.HandleFunc("/worlds/{worldId}/imports/{importId}", worlds.GetImport).Methods("GET").Name("getWorldImport")
+	api.HandleFunc("/worlds/{worldId}/lint", worlds.LintWorld).Methods("GET").Name("lintWorld")
+	api.HandleFunc("/worlds/{worldId}/migrate", worlds.MigrateWorld).Methods("POST").Name("migrateWorld")
+	api.HandleFunc("/worlds/{worldId}/migration/snapshot", worlds.ReceiveMigrationSnapshot).Methods("POST").Name("receiveMigrationSnapshot")
+	api.HandleFunc("/worlds/{worldId}/migration/tail", worlds.ReceiveMigrationTail).Methods("POST").Name("receiveMigrationTail")
+	api.HandleFunc("/worlds/{worldId}/moderation/audit", worlds.GetModerationAudit).Methods("GET").Name("getModerationAudit")
+	api.HandleFunc("/worlds/{worldId}/moderation/bans", worlds.ListBans).Methods("GET").Name("listBans")
+	api.HandleFunc("/worlds/{worldId}/moderation/bans", worlds.CreateBan).Methods("POST").Name("createBan")
+	api.HandleFunc("/worlds/{worldId}/moderation/bans/{banId}", worlds.RemoveBan).Methods("DELETE").Name("removeBan")
+	api.HandleFunc("/worlds/{worldId}/moderation/kick", worlds.KickSession).Methods("POST").Name("kickSession")
+	api.HandleFunc("/worlds/{worldId}/moderation/mutes", worlds.ListMutes).Methods("GET").Name("listMutes")
+	api.HandleFunc("/worlds/{worldId}/moderation/mutes", worlds.MuteSession).Methods("POST").Name("muteSession")
+	api.HandleFunc("/worlds/{worldId}/moderation/mutes/{hd1Id}", worlds.UnmuteSession).Methods("DELETE").Name("unmuteSession")
+	api.HandleFunc("/worlds/{worldId}/params", worlds.ListParams).Methods("GET").Name("listWorldParams")
+	api.HandleFunc("/worlds/{worldId}/params/{key}", worlds.DeleteParam).Methods("DELETE").Name("deleteWorldParam")
+	api.HandleFunc("/worlds/{worldId}/params/{key}", worlds.GetParam).Methods("GET").Name("getWorldParam")
+	api.HandleFunc("/worlds/{worldId}/params/{key}", worlds.SetParam).Methods("PUT").Name("setWorldParam")
+	api.HandleFunc("/worlds/{worldId}/physics", worlds.GetPhysics).Methods("GET").Name("getWorldPhysics")
+	api.HandleFunc("/worlds/{worldId}/physics", worlds.SetPhysics).Methods("PUT").Name("setWorldPhysics")
+	api.HandleFunc("/worlds/{worldId}/polls", worlds.ListPolls).Methods("GET").Name("listPolls")
+	api.HandleFunc("/worlds/{worldId}/polls", worlds.CreatePoll).Methods("POST").Name("createPoll")
+	api.HandleFunc("/worlds/{worldId}/polls/{pollId}", worlds.GetPoll).Methods("GET").Name("getPoll")
+	api.HandleFunc("/worlds/{worldId}/polls/{pollId}/close", worlds.ClosePoll).Methods("POST").Name("closePoll")
+	api.HandleFunc("/worlds/{worldId}/polls/{pollId}/vote", worlds.CastVote).Methods("PUT").Name("castVote")
+	api.HandleFunc("/worlds/{worldId}/quality", worlds.GetQuality).Methods("GET").Name("getWorldQuality")
+	api.HandleFunc("/worlds/{worldId}/space", worlds.GetSpace).Methods("GET").Name("getWorldSpace")
+	api.HandleFunc("/worlds/{worldId}/space", worlds.SetSpace).Methods("PUT").Name("setWorldSpace")
+	api.HandleFunc("/worlds/{worldId}/spectators", worlds.ListSpectators).Methods("GET").Name("listSpectators")
+	api.HandleFunc("/worlds/{worldId}/telemetry", worlds.GetTelemetry).Methods("GET").Name("getWorldTelemetry")
+	api.HandleFunc("/worlds/{worldId}/telemetry", worlds.ReportTelemetry).Methods("POST").Name("reportWorldTelemetry")
+	api.HandleFunc("/worlds/{worldId}/usage", worlds.GetUsage).Methods("GET").Name("getWorldUsage")
+	api.HandleFunc("/worlds/{worldId}/views", worlds.ListViews).Methods("GET").Name("listViews")
+	api.HandleFunc("/worlds/{worldId}/views/{viewName}", worlds.DeleteView).Methods("DELETE").Name("deleteView")
+	api.HandleFunc("/worlds/{worldId}/views/{viewName}", worlds.GetView).Methods("GET").Name("getView")
+	api.HandleFunc("/worlds/{worldId}/views/{viewName}", worlds.SaveView).Methods("PUT").Name("saveView")
+	api.HandleFunc("/worlds/{worldId}/views/{viewName}/visit", worlds.VisitView).Methods("POST").Name("visitView")
 }
\ No newline at end of file
@@ -0,0 +1,43 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"holodeck1/api/shared"
+)
+
+// contextMiddleware builds the request's shared.RequestContext before any
+// other middleware runs, so authorization and handlers read the caller, its
+// organization, session and permissions from one place. The span the
+// request runs in is returned as traceparent.
+func (ar *APIRouter) contextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := shared.NewRequestContext(r, ar.operationID(r))
+		w.Header().Set("traceparent", rc.Span.Traceparent())
+		next.ServeHTTP(w, shared.WithRequestContext(r, rc))
+	})
+}
+
+// operationID returns the operationId of the route a request was routed
+// to; legacy paths resolve to the operation they map onto
+func (ar *APIRouter) operationID(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return ""
+	}
+	if name := route.GetName(); name != "" {
+		return name
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+	path := stripAPIBase(template)
+	for _, compat := range compatibilityRoutes {
+		if compat.legacyPath == path && compat.method == r.Method {
+			return compat.operationID
+		}
+	}
+	return ""
+}
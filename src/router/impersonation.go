@@ -0,0 +1,49 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+
+	"holodeck1/api/shared"
+	"holodeck1/impersonation"
+)
+
+// impersonationMiddleware lets operator calls carrying an impersonation
+// token act as the impersonated session: the request context names the
+// session, holds what its grant and the impersonation's scope both allow,
+// and is no longer an operator's, so operator-only operations are refused.
+// Every call made this way is added to the audit log with its status.
+func (ar *APIRouter) impersonationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(impersonation.Header)
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rc := shared.Context(r)
+		if !rc.Operator {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		imp, ok := impersonation.Lookup(token)
+		if !ok {
+			http.Error(w, "Impersonation ended or invalid", http.StatusForbidden)
+			return
+		}
+
+		// The session's context, as its own calls get it, narrowed to the scope
+		r.Header.Set("X-HD1-ID", imp.HD1ID)
+		acting := shared.NewRequestContext(r, rc.Operation)
+		acting.Span, acting.Started = rc.Span, rc.Started
+		acting.Operator = false
+		acting.Authenticated = true
+		acting.Impersonation = imp.ID
+		acting.Permissions = imp.Permissions(acting.Permissions)
+		r = shared.WithRequestContext(r, acting)
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		impersonation.RecordRequest(r.Context(), imp.ID, acting.World,
+			r.Method+" "+r.URL.RequestURI()+" "+strconv.Itoa(recorder.status))
+	})
+}
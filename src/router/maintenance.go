@@ -0,0 +1,66 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"holodeck1/config"
+	"holodeck1/server"
+)
+
+// maintenanceMiddleware refuses mutating calls with 503 while the server,
+// or the world a request addresses, is in maintenance. Reads and the
+// operations marked x-maintenance: allow (presence, validation, the
+// maintenance switch itself) keep working.
+func (ar *APIRouter) maintenanceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		world := mux.Vars(r)["worldId"]
+		if world == "" {
+			world = config.GetWorldsDefaultWorld()
+		}
+		state := server.MaintenanceFor(world)
+		if !state.Enabled || ar.maintenanceAllowed(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		message := state.Message
+		if message == "" {
+			message = "Maintenance in progress, changes are disabled"
+		}
+		http.Error(w, message, http.StatusServiceUnavailable)
+	})
+}
+
+// maintenanceAllowed looks the route up in the exempt operations
+func (ar *APIRouter) maintenanceAllowed(r *http.Request) bool {
+	path, ok := ar.operationPath(r)
+	return ok && maintenanceExempt[r.Method+" "+path]
+}
+
+// operationPath returns the specification path of the operation a request
+// was routed to; legacy paths resolve to the operation they map onto
+func (ar *APIRouter) operationPath(r *http.Request) (string, bool) {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "", false
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return "", false
+	}
+	path := stripAPIBase(template)
+	for _, compat := range compatibilityRoutes {
+		if compat.legacyPath == path && compat.method == r.Method {
+			if current := ar.router.Get(compat.operationID); current != nil {
+				template, _ := current.GetPathTemplate()
+				return stripAPIBase(template), true
+			}
+		}
+	}
+	return path, true
+}
@@ -0,0 +1,38 @@
+package router
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"holodeck1/api/shared"
+	"holodeck1/quotas"
+	"holodeck1/tokens"
+)
+
+// quotaMiddleware holds callers to the REST quota of their organization's
+// plan, answering 429 with Retry-After past it. Callers presenting a
+// session token are held to the plan of the organization the session
+// joined, per session; everyone else to the default organization's, per
+// address, whatever bearer token or X-HD1-Org they send. Operators are not
+// held to quotas.
+func (ar *APIRouter) quotaMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := shared.Context(r)
+		if rc.Operator {
+			next.ServeHTTP(w, r)
+			return
+		}
+		org, caller := "default", "ip:"+rc.ClientIP
+		if token, err := tokens.Validate(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")); err == nil {
+			org, caller = token.Org, "session:"+token.HD1ID
+		}
+		if ok, wait := quotas.AllowCall(org, caller); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Request quota exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
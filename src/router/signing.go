@@ -0,0 +1,56 @@
+package router
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+
+	"holodeck1/api/shared"
+	"holodeck1/logging"
+	"holodeck1/signing"
+)
+
+// signingMiddleware refuses mutating calls a session did not sign, with
+// 401, when deltas are signed: X-HD1-Signature must hold the session's
+// signature of the call's method, target, X-HD1-Nonce and body, and the
+// nonce must not have been used, so a captured call cannot be made again.
+// Operators, calls made under an impersonation and signed operations,
+// which check a secret of their own, carry no session key and are exempt.
+func (ar *APIRouter) signingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := shared.Context(r)
+		mutating := r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions
+		if !signing.Enabled() || !mutating || rc.Operator || rc.Impersonation != "" || ar.authRequirement(r).auth == authSigned {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		nonce, _ := strconv.ParseUint(r.Header.Get("X-HD1-Nonce"), 10, 64)
+		message := signing.Message(r.Method, r.URL.RequestURI(), nonce, body)
+		if err := signing.Verify(rc.Session, message, r.Header.Get("X-HD1-Signature")); err != nil {
+			refuseUnsigned(w, rc, "call refused, signature not verified", err)
+			return
+		}
+		if err := signing.Accept(rc.Session, nonce); err != nil {
+			refuseUnsigned(w, rc, "call refused, nonce not accepted", err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	})
+}
+
+func refuseUnsigned(w http.ResponseWriter, rc *shared.RequestContext, message string, err error) {
+	logging.Warn(message, map[string]interface{}{
+		"hd1_id":    rc.Session,
+		"operation": rc.Operation,
+		"client_ip": rc.ClientIP,
+		"error":     err.Error(),
+	})
+	http.Error(w, err.Error(), http.StatusUnauthorized)
+}
@@ -0,0 +1,57 @@
+package router
+
+import (
+	"net/http"
+	"time"
+
+	"holodeck1/api/shared"
+	"holodeck1/apiusage"
+)
+
+// usageMiddleware hands every call, with the status it was answered with
+// and how long it took, to the API usage counters. It runs right after the
+// request context is built, so refusals by the middleware after it count
+// too.
+func (ar *APIRouter) usageMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := shared.Context(r)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		operation := rc.Operation
+		if operation == "" {
+			operation, _ = ar.operationPath(r)
+		}
+		apiusage.Observe(apiusage.Call{
+			Org:       rc.Org,
+			Key:       apiusage.KeyFor(r),
+			Operation: operation,
+			Status:    recorder.status,
+			Latency:   time.Since(rc.Started),
+			At:        rc.Started,
+		})
+	})
+}
+
+// statusRecorder notes the status a handler answered with
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// Flush passes through for streaming handlers
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController the wrapped writer
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
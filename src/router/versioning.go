@@ -0,0 +1,104 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"holodeck1/logging"
+)
+
+// deprecationInfo carries the lifecycle metadata of a deprecated operation
+type deprecationInfo struct {
+	sunset    string // x-sunset date (YYYY-MM-DD) after which the operation may be removed
+	successor string // x-successor path clients should migrate to
+}
+
+// compatRoute maps a legacy path onto the handler of a current operation
+type compatRoute struct {
+	legacyPath  string
+	method      string
+	operationID string
+	sunset      string
+}
+
+// deprecationMiddleware stamps the API version on every response and adds
+// Deprecation, Sunset and Link headers to operations flagged in the spec
+func deprecationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-HD1-API-Version", apiVersion)
+
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				key := r.Method + " " + stripAPIBase(template)
+				if info, deprecated := deprecatedOperations[key]; deprecated {
+					successor := info.successor
+					if successor != "" {
+						successor = "/api/" + apiVersion + successor
+					}
+					setDeprecationHeaders(w, info.sunset, successor)
+				}
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// registerCompatRoutes wires legacy paths to the handlers of the operations
+// that replaced them. Legacy path templates must use the same parameter names
+// as the current path so mux.Vars lookups in handlers keep working.
+func (ar *APIRouter) registerCompatRoutes(api *mux.Router) {
+	for _, compat := range compatibilityRoutes {
+		current := ar.router.Get(compat.operationID)
+		if current == nil || current.GetHandler() == nil {
+			logging.Warn("compatibility route target missing", map[string]interface{}{
+				"legacy_path":  compat.legacyPath,
+				"operation_id": compat.operationID,
+			})
+			continue
+		}
+
+		successor, _ := current.GetPathTemplate()
+		successor = "/api/" + apiVersion + stripAPIBase(successor)
+		handler := current.GetHandler()
+		sunset := compat.sunset
+
+		api.HandleFunc(compat.legacyPath, func(w http.ResponseWriter, r *http.Request) {
+			link := successor
+			for name, value := range mux.Vars(r) {
+				link = strings.ReplaceAll(link, "{"+name+"}", value)
+			}
+			setDeprecationHeaders(w, sunset, link)
+			logging.Trace("router", "legacy path served via compatibility router", map[string]interface{}{
+				"path":      r.URL.Path,
+				"successor": link,
+			})
+			handler.ServeHTTP(w, r)
+		}).Methods(compat.method)
+	}
+}
+
+// setDeprecationHeaders writes RFC 8594 Sunset and deprecation signalling headers
+func setDeprecationHeaders(w http.ResponseWriter, sunset, successor string) {
+	w.Header().Set("Deprecation", "true")
+	if sunset != "" {
+		if date, err := time.Parse("2006-01-02", sunset); err == nil {
+			w.Header().Set("Sunset", date.UTC().Format(http.TimeFormat))
+		} else {
+			w.Header().Set("Sunset", sunset)
+		}
+	}
+	if successor != "" {
+		w.Header().Add("Link", "<"+successor+">; rel=\"successor-version\"")
+	}
+}
+
+// stripAPIBase removes the /api or /api/{version} prefix from a path template
+func stripAPIBase(path string) string {
+	if trimmed := strings.TrimPrefix(path, "/api/"+apiVersion); trimmed != path {
+		return trimmed
+	}
+	return strings.TrimPrefix(path, "/api")
+}
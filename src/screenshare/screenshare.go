@@ -0,0 +1,107 @@
+// Package screenshare keeps the screen shares running in a world.
+//
+// A sharing client publishes its screen over WebRTC and the server places a
+// screen entity showing it. The media itself never passes through the
+// server: each participant who sees the screen opens a peer connection to
+// the sharer, with offers, answers and ICE candidates relayed over the
+// WebSocket. A share lives as long as its sharer's connection.
+package screenshare
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrNotFound is returned for unknown or ended shares
+var ErrNotFound = errors.New("screen share not found")
+
+// ErrAlreadySharing is returned when a session starts a second share
+var ErrAlreadySharing = errors.New("session is already sharing")
+
+// Share is a running screen share
+type Share struct {
+	ID        string    `json:"id"`
+	EntityID  string    `json:"entity_id"` // Screen entity showing the share
+	HD1ID     string    `json:"hd1_id"`    // Sharing session, the WebRTC publisher
+	Name      string    `json:"name,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// NewID generates a share ID
+func NewID() string {
+	return "share-" + uuid.New().String()
+}
+
+var (
+	shares = make(map[string]*Share)
+	mutex  sync.RWMutex
+)
+
+// Start records a new share; a session shares one screen at a time
+func Start(share *Share) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, existing := range shares {
+		if existing.HD1ID == share.HD1ID {
+			return ErrAlreadySharing
+		}
+	}
+	shares[share.ID] = share
+	return nil
+}
+
+// Get returns a running share
+func Get(id string) (*Share, error) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	share, ok := shares[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return share, nil
+}
+
+// List returns the running shares, oldest first
+func List() []*Share {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	list := make([]*Share, 0, len(shares))
+	for _, share := range shares {
+		list = append(list, share)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].StartedAt.Before(list[j].StartedAt)
+	})
+	return list
+}
+
+// Stop ends a share and returns it
+func Stop(id string) (*Share, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	share, ok := shares[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	delete(shares, id)
+	return share, nil
+}
+
+// ReleaseSession ends the shares of a disconnected session and returns
+// them, so their screens can be removed
+func ReleaseSession(hd1ID string) []*Share {
+	mutex.Lock()
+	defer mutex.Unlock()
+	var released []*Share
+	for id, share := range shares {
+		if share.HD1ID == hd1ID {
+			delete(shares, id)
+			released = append(released, share)
+		}
+	}
+	return released
+}
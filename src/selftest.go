@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+	"holodeck1/selftest"
+	"holodeck1/server"
+)
+
+// run_selftest boots the server in-process on a random loopback port with
+// the loaded configuration, runs the generated contract checks and a
+// two-client sync scenario against it and prints a report. The server
+// stores to a temporary directory, so nothing it writes reaches the
+// deployment's storage; its errors go to stderr.
+// Exit status is 0 when every check passes, 1 otherwise, 2 on usage errors.
+func run_selftest(args []string) int {
+	flags := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "Print the report as JSON")
+	timeout := flags.Duration("timeout", 2*time.Minute, "Longest the self-test may run")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: hd1 selftest [--json] [--timeout 2m]")
+	}
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		return exitUsage
+	}
+
+	dir, err := os.MkdirTemp("", "hd1-selftest-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "selftest: %v\n", err)
+		return exitFailed
+	}
+	defer os.RemoveAll(dir)
+	if err := logging.ApplyConfig(&logging.Config{
+		Level:  "ERROR",
+		LogDir: filepath.Join(dir, "logs"),
+		Format: config.GetLogFormat(),
+	}); err != nil {
+		fmt.Fprintf(os.Stderr, "selftest: %v\n", err)
+		return exitFailed
+	}
+	config.Config.Storage.Backend = "filesystem"
+	config.Config.Storage.Dir = filepath.Join(dir, "storage")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "selftest: %v\n", err)
+		return exitFailed
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	start_services(ctx)
+	httpServer := &http.Server{Handler: server.Compress(http.DefaultServeMux)}
+	go httpServer.Serve(listener)
+	defer httpServer.Close()
+
+	base := "http://" + listener.Addr().String()
+	report := selftest.Run(ctx, base)
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	} else {
+		print_selftest_report(base, report)
+	}
+	if !report.Passed {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// print_selftest_report writes a report one check per line
+func print_selftest_report(base string, report *selftest.Report) {
+	fmt.Printf("hd1 selftest against %s\n", base)
+	sections := []struct {
+		name    string
+		results []selftest.Result
+	}{
+		{"contract", report.Contract},
+		{"scenario", report.Scenario},
+	}
+	for _, section := range sections {
+		passed := 0
+		fmt.Printf("\n%s\n", section.name)
+		for _, result := range section.results {
+			status := "FAIL"
+			if result.Passed {
+				status = "PASS"
+				passed++
+			}
+			fmt.Printf("  %s  %s (%.1fms)\n", status, result.Name, result.DurationMS)
+			if result.Detail != "" {
+				fmt.Printf("        %s\n", result.Detail)
+			}
+		}
+		fmt.Printf("  %d/%d passed\n", passed, len(section.results))
+	}
+	if report.Passed {
+		fmt.Println("\nPASS")
+	} else {
+		fmt.Printf("\nFAIL: %d failed\n", report.Failures)
+	}
+}
@@ -0,0 +1,290 @@
+// Code generated by codegen/generator.go from the API specification. DO NOT
+// EDIT.
+
+package selftest
+
+// contract are the calls anyone may make without arguments, and what the
+// specification promises they answer
+var contract = []Check{
+	{
+		Operation: "getSceneDescriptions",
+		Method:    "GET",
+		Path:      "/accessibility/descriptions",
+		Status:    200,
+		JSON:      true,
+		Fields: map[string]string{
+			"current_sequence": "integer",
+			"descriptions":     "array",
+			"success":          "boolean",
+		},
+	},
+	{
+		Operation: "getAccessibleWorldView",
+		Method:    "GET",
+		Path:      "/accessibility/world",
+		Status:    200,
+		JSON:      true,
+		Fields: map[string]string{
+			"success": "boolean",
+		},
+	},
+	{
+		Operation: "listAnchors",
+		Method:    "GET",
+		Path:      "/anchors",
+		Status:    200,
+		JSON:      true,
+		Fields: map[string]string{
+			"anchors": "array",
+			"count":   "integer",
+			"success": "boolean",
+		},
+	},
+	{
+		Operation: "getOrphanAssets",
+		Method:    "GET",
+		Path:      "/assets/orphans",
+		Status:    200,
+		JSON:      true,
+		Fields: map[string]string{
+			"success": "boolean",
+		},
+	},
+	{
+		Operation: "getAssetSettings",
+		Method:    "GET",
+		Path:      "/assets/settings",
+		Status:    200,
+		JSON:      true,
+		Fields: map[string]string{
+			"org":              "string",
+			"pipeline_enabled": "boolean",
+			"success":          "boolean",
+		},
+	},
+	{
+		Operation: "getAvatars",
+		Method:    "GET",
+		Path:      "/avatars",
+		Status:    200,
+		JSON:      true,
+		Fields: map[string]string{
+			"avatars": "array",
+			"success": "boolean",
+		},
+	},
+	{
+		Operation: "getConsent",
+		Method:    "GET",
+		Path:      "/consent",
+		Status:    200,
+		JSON:      true,
+	},
+	{
+		Operation: "getEntities",
+		Method:    "GET",
+		Path:      "/entities",
+		Status:    200,
+		JSON:      true,
+		Fields: map[string]string{
+			"entities": "array",
+			"success":  "boolean",
+		},
+	},
+	{
+		Operation: "listPhysicsProfiles",
+		Method:    "GET",
+		Path:      "/physics/profiles",
+		Status:    200,
+		JSON:      true,
+		Fields: map[string]string{
+			"default":  "string",
+			"profiles": "array",
+			"success":  "boolean",
+		},
+	},
+	{
+		Operation: "listPlans",
+		Method:    "GET",
+		Path:      "/plans",
+		Status:    200,
+		JSON:      true,
+		Fields: map[string]string{
+			"default": "string",
+			"plans":   "array",
+			"success": "boolean",
+		},
+	},
+	{
+		Operation: "getScene",
+		Method:    "GET",
+		Path:      "/scene",
+		Status:    200,
+		JSON:      true,
+		Fields: map[string]string{
+			"scene":   "object",
+			"success": "boolean",
+		},
+	},
+	{
+		Operation: "listEntityComponents",
+		Method:    "GET",
+		Path:      "/schema/components",
+		Status:    200,
+		JSON:      true,
+		Fields: map[string]string{
+			"components": "array",
+			"strict":     "boolean",
+			"success":    "boolean",
+		},
+	},
+	{
+		Operation: "listScreenShares",
+		Method:    "GET",
+		Path:      "/screenshares",
+		Status:    200,
+		JSON:      true,
+		Fields: map[string]string{
+			"count":   "integer",
+			"shares":  "array",
+			"success": "boolean",
+		},
+	},
+	{
+		Operation: "getPresence",
+		Method:    "GET",
+		Path:      "/sessions/presence",
+		Status:    200,
+		JSON:      true,
+		Fields: map[string]string{
+			"clients":      "array",
+			"events":       "array",
+			"heartbeat_ms": "integer",
+			"seq":          "integer",
+			"stale_after":  "integer",
+			"success":      "boolean",
+		},
+	},
+	{
+		Operation: "getFullSync",
+		Method:    "GET",
+		Path:      "/sync/full",
+		Status:    200,
+		JSON:      true,
+		Fields: map[string]string{
+			"chunked":          "boolean",
+			"current_sequence": "integer",
+			"operations":       "array",
+			"success":          "boolean",
+		},
+	},
+	{
+		Operation: "getSyncStats",
+		Method:    "GET",
+		Path:      "/sync/stats",
+		Status:    200,
+		JSON:      true,
+		Fields: map[string]string{
+			"stats":   "object",
+			"success": "boolean",
+		},
+	},
+	{
+		Operation: "getCapabilities",
+		Method:    "GET",
+		Path:      "/system/capabilities",
+		Status:    200,
+		JSON:      true,
+		Fields: map[string]string{
+			"capabilities": "object",
+			"organization": "string",
+			"success":      "boolean",
+			"world":        "string",
+		},
+	},
+	{
+		Operation: "getFeatures",
+		Method:    "GET",
+		Path:      "/system/features",
+		Status:    200,
+		JSON:      true,
+		Fields: map[string]string{
+			"features":     "object",
+			"organization": "string",
+			"success":      "boolean",
+			"world":        "string",
+		},
+	},
+	{
+		Operation: "getIntegrity",
+		Method:    "GET",
+		Path:      "/system/integrity",
+		Status:    200,
+		JSON:      true,
+		Fields: map[string]string{
+			"algorithm":  "string",
+			"assets":     "array",
+			"js_version": "string",
+			"success":    "boolean",
+		},
+	},
+	{
+		Operation: "getLocales",
+		Method:    "GET",
+		Path:      "/system/locales",
+		Status:    200,
+		JSON:      true,
+		Fields: map[string]string{
+			"default": "string",
+			"locales": "array",
+			"success": "boolean",
+		},
+	},
+	{
+		Operation: "getMaintenance",
+		Method:    "GET",
+		Path:      "/system/maintenance",
+		Status:    200,
+		JSON:      true,
+	},
+	{
+		Operation: "getSimulation",
+		Method:    "GET",
+		Path:      "/system/simulation",
+		Status:    200,
+		JSON:      true,
+		Fields: map[string]string{
+			"success": "boolean",
+		},
+	},
+	{
+		Operation: "getServerTime",
+		Method:    "GET",
+		Path:      "/system/time",
+		Status:    200,
+		JSON:      true,
+		Fields: map[string]string{
+			"client_time":     "number",
+			"server_receive":  "number",
+			"server_transmit": "number",
+			"success":         "boolean",
+		},
+	},
+	{
+		Operation: "getVersion",
+		Method:    "GET",
+		Path:      "/system/version",
+		Status:    200,
+		JSON:      true,
+		Fields: map[string]string{
+			"api_version":     "string",
+			"build":           "object",
+			"build_timestamp": "string",
+			"compatibility":   "object",
+			"features":        "object",
+			"js_version":      "string",
+			"server_version":  "string",
+			"title":           "string",
+		},
+	},
+}
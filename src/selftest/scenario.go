@@ -0,0 +1,217 @@
+package selftest
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// waitFor bounds how long a client waits for a message
+const waitFor = 5 * time.Second
+
+// peer is one synthetic client connected to /ws
+type peer struct {
+	conn       *websocket.Conn
+	hd1ID      string
+	signingKey []byte // Set when deltas are signed
+	nonce      uint64
+	messages   chan map[string]interface{}
+}
+
+// connect opens a WebSocket and waits for the session client_init assigns
+func connect(ctx context.Context, base string) (*peer, error) {
+	url := "ws" + strings.TrimPrefix(base, "http") + "/ws"
+	conn, response, err := websocket.DefaultDialer.DialContext(ctx, url, nil)
+	if err != nil {
+		if response != nil {
+			return nil, fmt.Errorf("connect: %s", response.Status)
+		}
+		return nil, fmt.Errorf("connect: %v", err)
+	}
+	p := &peer{conn: conn, messages: make(chan map[string]interface{}, 256)}
+	go p.read()
+
+	init, err := p.await("client_init", func(map[string]interface{}) bool { return true })
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	p.hd1ID, _ = init["hd1_id"].(string)
+	if key, ok := init["signing_key"].(string); ok {
+		p.signingKey, _ = hex.DecodeString(key)
+	}
+	return p, nil
+}
+
+// read queues the messages the server sends until the connection closes
+func (p *peer) read() {
+	defer close(p.messages)
+	for {
+		_, data, err := p.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var message map[string]interface{}
+		if json.Unmarshal(data, &message) != nil {
+			continue
+		}
+		select {
+		case p.messages <- message:
+		default:
+			// Nobody waiting for this much; drop it
+		}
+	}
+}
+
+// await returns the first message of a type that matches, skipping others
+func (p *peer) await(messageType string, match func(map[string]interface{}) bool) (map[string]interface{}, error) {
+	timeout := time.After(waitFor)
+	for {
+		select {
+		case message, open := <-p.messages:
+			if !open {
+				return nil, fmt.Errorf("connection closed waiting for %s", messageType)
+			}
+			if message["type"] == messageType && match(message) {
+				return message, nil
+			}
+		case <-timeout:
+			return nil, fmt.Errorf("no %s within %s", messageType, waitFor)
+		}
+	}
+}
+
+// awaitOperation waits for the sync operation of a type on an entity
+func (p *peer) awaitOperation(operationType, entityID string) error {
+	_, err := p.await("sync_operation", func(message map[string]interface{}) bool {
+		operation, _ := message["operation"].(map[string]interface{})
+		data, _ := operation["data"].(map[string]interface{})
+		return operation["type"] == operationType && data["id"] == entityID
+	})
+	return err
+}
+
+// submit sends an operation through the API as this client, signed when
+// deltas are signed, and returns the entity ID issued for creates
+func (p *peer) submit(ctx context.Context, client *http.Client, base, operationType string, data map[string]interface{}) (string, error) {
+	request := map[string]interface{}{"type": operationType, "data": data}
+	if p.signingKey != nil {
+		p.nonce++
+		request["nonce"] = p.nonce
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	call, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/api/sync/operations", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	call.Header.Set("Content-Type", "application/json")
+	call.Header.Set("X-HD1-ID", p.hd1ID)
+	if p.signingKey != nil {
+		mac := hmac.New(sha256.New, p.signingKey)
+		mac.Write(body)
+		call.Header.Set("X-HD1-Signature", hex.EncodeToString(mac.Sum(nil)))
+	}
+	response, err := client.Do(call)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	var answer struct {
+		EntityID string `json:"entity_id"`
+	}
+	if response.StatusCode != http.StatusOK {
+		var detail bytes.Buffer
+		detail.ReadFrom(response.Body)
+		return "", fmt.Errorf("%s answered %d: %s", operationType, response.StatusCode, firstLine(detail.Bytes()))
+	}
+	if err := json.NewDecoder(response.Body).Decode(&answer); err != nil {
+		return "", err
+	}
+	return answer.EntityID, nil
+}
+
+// runScenario connects two clients to the same world and has each see the
+// other's changes to an entity: one creates it, the other moves it, the
+// first deletes it
+func runScenario(ctx context.Context, client *http.Client, base string) []Result {
+	var first, second *peer
+	var entityID string
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"two clients connect", func() error {
+			var err error
+			if first, err = connect(ctx, base); err != nil {
+				return err
+			}
+			second, err = connect(ctx, base)
+			return err
+		}},
+		{"entity created by one client reaches the other", func() error {
+			var err error
+			entityID, err = first.submit(ctx, client, base, "entity_create", map[string]interface{}{
+				"name":     "selftest",
+				"geometry": map[string]interface{}{"type": "box"},
+				"position": map[string]interface{}{"x": 0, "y": 1, "z": 0},
+			})
+			if err != nil {
+				return err
+			}
+			if entityID == "" {
+				return fmt.Errorf("entity_create issued no entity ID")
+			}
+			return second.awaitOperation("entity_create", entityID)
+		}},
+		{"entity moved by the other client reaches the first", func() error {
+			if _, err := second.submit(ctx, client, base, "entity_update", map[string]interface{}{
+				"id":       entityID,
+				"position": map[string]interface{}{"x": 2, "y": 1, "z": 0},
+			}); err != nil {
+				return err
+			}
+			return first.awaitOperation("entity_update", entityID)
+		}},
+		{"entity deleted by the first client reaches the other", func() error {
+			if _, err := first.submit(ctx, client, base, "entity_delete", map[string]interface{}{
+				"id": entityID,
+			}); err != nil {
+				return err
+			}
+			return second.awaitOperation("entity_delete", entityID)
+		}},
+	}
+
+	results := []Result{}
+	failed := false
+	for _, step := range steps {
+		if failed {
+			results = append(results, Result{Name: step.name, Detail: "skipped after an earlier step failed"})
+			continue
+		}
+		result := timed(step.name, step.run)
+		failed = !result.Passed
+		results = append(results, result)
+	}
+
+	for _, p := range []*peer{first, second} {
+		if p != nil {
+			p.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			p.conn.Close()
+		}
+	}
+	return results
+}
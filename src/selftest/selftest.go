@@ -0,0 +1,185 @@
+// Package selftest checks a running server against its API specification:
+// the calls anyone may make without arguments answer as the specification
+// promises, and two clients connected to the same world see each other's
+// changes. hd1 selftest runs it against a server it boots in-process, to
+// verify a deployment.
+//
+// The contract checks are generated from the specification with the
+// router. A check passes when the call answers its documented success
+// status, with JSON when JSON is documented, carrying the fields the
+// response requires and giving each documented field it has the
+// documented type.
+package selftest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// callTimeout bounds each contract call
+const callTimeout = 10 * time.Second
+
+// Check is a call the contract makes, and what the specification promises
+// it answers
+type Check struct {
+	Operation string
+	Method    string
+	Path      string // Under /api
+	Status    int
+	JSON      bool
+	Required  []string          // Top-level fields the response must have
+	Fields    map[string]string // Types of the top-level fields it may have
+}
+
+// Result is how one check or scenario step went
+type Result struct {
+	Name       string  `json:"name"`
+	Passed     bool    `json:"passed"`
+	Detail     string  `json:"detail,omitempty"` // Why it failed
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// Report is what a self-test found
+type Report struct {
+	Passed   bool     `json:"passed"`
+	Contract []Result `json:"contract"`
+	Scenario []Result `json:"scenario"`
+	Failures int      `json:"failures"`
+}
+
+// Run checks the server at base, http://host:port, and reports every
+// check and step
+func Run(ctx context.Context, base string) *Report {
+	report := &Report{}
+	client := &http.Client{Timeout: callTimeout}
+	for _, check := range contract {
+		report.Contract = append(report.Contract, timed(check.Operation+" "+check.Method+" "+check.Path, func() error {
+			return check.run(ctx, client, base)
+		}))
+	}
+	report.Scenario = runScenario(ctx, client, base)
+
+	for _, result := range append(append([]Result{}, report.Contract...), report.Scenario...) {
+		if !result.Passed {
+			report.Failures++
+		}
+	}
+	report.Passed = report.Failures == 0
+	return report
+}
+
+// timed runs one check or step
+func timed(name string, run func() error) Result {
+	start := time.Now()
+	err := run()
+	result := Result{
+		Name:       name,
+		Passed:     err == nil,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Detail = err.Error()
+	}
+	return result
+}
+
+// run makes the call and compares the answer with the specification
+func (c Check) run(ctx context.Context, client *http.Client, base string) error {
+	request, err := http.NewRequestWithContext(ctx, c.Method, base+"/api"+c.Path, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != c.Status {
+		return fmt.Errorf("answered %d, expected %d: %s", response.StatusCode, c.Status, firstLine(body))
+	}
+	if !c.JSON {
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		return fmt.Errorf("answered %q, expected application/json", response.Header.Get("Content-Type"))
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+	object, isObject := decoded.(map[string]interface{})
+	if !isObject {
+		if len(c.Required) > 0 || len(c.Fields) > 0 {
+			return fmt.Errorf("answered a JSON %s, expected an object", jsonType(decoded))
+		}
+		return nil
+	}
+	for _, field := range c.Required {
+		if _, ok := object[field]; !ok {
+			return fmt.Errorf("response lacks required field %q", field)
+		}
+	}
+	for field, expected := range c.Fields {
+		value, ok := object[field]
+		if !ok || value == nil {
+			continue
+		}
+		if !typeMatches(expected, value) {
+			return fmt.Errorf("field %q is a %s, expected %s", field, jsonType(value), expected)
+		}
+	}
+	return nil
+}
+
+// typeMatches reports whether a decoded value has a specification type
+func typeMatches(expected string, value interface{}) bool {
+	actual := jsonType(value)
+	switch expected {
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == float64(int64(number))
+	case "number":
+		return actual == "number"
+	default:
+		return actual == expected
+	}
+}
+
+// jsonType names the type of a decoded value as the specification does
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// firstLine shortens a response body for a failure detail
+func firstLine(body []byte) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(string(body)), "\n")
+	if len(line) > 200 {
+		line = line[:200] + "..."
+	}
+	return line
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	stdSync "sync"
+	"time"
+	"unicode/utf8"
+
+	"holodeck1/accessibility"
+	"holodeck1/config"
+	"holodeck1/guests"
+	"holodeck1/logging"
+	"holodeck1/moderation"
+	"holodeck1/sync"
+)
+
+// Accessibility channel.
+//
+// Assistive clients opt in to text streams; nothing is sent until they do:
+//
+//	→ accessibility_subscribe {descriptions, captions}
+//	← accessibility_subscribed {descriptions, captions}
+//	← scene_description {seq_num, text}
+//	→ caption {text, final, lang?}
+//	← caption {hd1_id, name, text, final, lang, server_time}
+//
+// Descriptions are generated from the same sync operations the client
+// receives, so they follow its throttled view of the world. Captions come
+// from the speaker's own speech recognition and are relayed, not stored;
+// interim results are rate limited, final ones always go through.
+
+// accessibilityState is one client's subscription
+type accessibilityState struct {
+	mutex        stdSync.Mutex
+	descriptions bool
+	captions     bool
+	since        uint64 // operations up to here predate the subscription
+	lastCaption  time.Time
+
+	// scene is only touched by forwardSyncOperations
+	scene *accessibility.Scene
+}
+
+// handleAccessibilitySubscribe updates which text streams the client receives
+func (c *Client) handleAccessibilitySubscribe(message []byte) {
+	var msg struct {
+		Descriptions *bool `json:"descriptions"`
+		Captions     *bool `json:"captions"`
+	}
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return
+	}
+
+	a := &c.accessibility
+	a.mutex.Lock()
+	if msg.Descriptions != nil {
+		if *msg.Descriptions && !a.descriptions {
+			a.since = c.hub.sync.GetCurrentSequence()
+		}
+		a.descriptions = *msg.Descriptions
+	}
+	if msg.Captions != nil {
+		a.captions = *msg.Captions
+	}
+	reply := map[string]interface{}{
+		"type":         "accessibility_subscribed",
+		"descriptions": a.descriptions,
+		"captions":     a.captions,
+	}
+	a.mutex.Unlock()
+
+	logging.Info("accessibility subscription updated", map[string]interface{}{
+		"hd1_id":       c.GetClientID(),
+		"descriptions": reply["descriptions"],
+		"captions":     reply["captions"],
+	})
+
+	if jsonData, err := json.Marshal(reply); err == nil {
+		select {
+		case c.send <- jsonData:
+		default:
+			// Client Go channel blocked, don't wait
+		}
+	}
+}
+
+// describeOperation sends a scene_description for an operation the client
+// has just been sent. Called only from forwardSyncOperations.
+func (c *Client) describeOperation(operation *sync.Operation) {
+	a := &c.accessibility
+	a.mutex.Lock()
+	enabled, since := a.descriptions, a.since
+	a.mutex.Unlock()
+
+	if !enabled {
+		a.scene = nil
+		return
+	}
+	if a.scene == nil {
+		// Catch up silently so labels and positions are known
+		a.scene = accessibility.Replay(c.hub.sync.GetMissingOperations(1, operation.SeqNum-1))
+	}
+	if operation.SeqNum <= a.scene.Sequence {
+		return // Already applied during catch-up
+	}
+
+	text := a.scene.Apply(operation)
+	if text == "" || operation.SeqNum <= since {
+		return
+	}
+
+	message := map[string]interface{}{
+		"type":    "scene_description",
+		"seq_num": operation.SeqNum,
+		"text":    text,
+	}
+	if jsonData, err := json.Marshal(message); err == nil {
+		select {
+		case c.send <- jsonData:
+		default:
+			// Client Go channel blocked, don't wait
+		}
+	}
+}
+
+// handleCaption relays a speech caption to subscribed clients
+func (c *Client) handleCaption(message []byte) {
+	var msg struct {
+		Text  string `json:"text"`
+		Final bool   `json:"final"`
+		Lang  string `json:"lang"`
+	}
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return
+	}
+	msg.Text = strings.TrimSpace(msg.Text)
+	if msg.Text == "" || !utf8.ValidString(msg.Text) || len(msg.Lang) > 35 {
+		return
+	}
+	if max := config.GetAccessibilityCaptionMaxLength(); max > 0 && utf8.RuneCountInString(msg.Text) > max {
+		msg.Text = string([]rune(msg.Text)[:max])
+	}
+
+	avatarID := c.GetAvatarID()
+	if avatarID == "" || c.muted() || !c.guestAllows(guests.CapabilityChat) {
+		return
+	}
+
+	if !msg.Final {
+		a := &c.accessibility
+		a.mutex.Lock()
+		rate := config.GetAccessibilityCaptionRate()
+		limited := rate > 0 && time.Since(a.lastCaption) < time.Second/time.Duration(rate)
+		if !limited {
+			a.lastCaption = time.Now()
+		}
+		a.mutex.Unlock()
+		if limited {
+			return
+		}
+	}
+
+	// Interim captions are replaced by their final one, so only that reports a rejection
+	text, allowed := c.screenText(moderation.KindCaption, msg.Text, msg.Final)
+	if !allowed {
+		return
+	}
+	msg.Text = text
+
+	name := avatarID
+	if avatar, ok := c.hub.avatarRegistry.GetAvatar(avatarID); ok {
+		name = avatar.Name
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"type":        "caption",
+		"hd1_id":      avatarID,
+		"name":        name,
+		"text":        msg.Text,
+		"final":       msg.Final,
+		"lang":        msg.Lang,
+		"server_time": ServerMillis(c.lastSeen),
+	})
+	if err != nil {
+		return
+	}
+	c.hub.relayCaption(c, data)
+}
+
+// relayCaption sends a caption to every caption subscriber except its speaker
+func (h *Hub) relayCaption(sender *Client, data []byte) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for client := range h.clients {
+		if client == sender {
+			continue
+		}
+		client.accessibility.mutex.Lock()
+		subscribed := client.accessibility.captions
+		client.accessibility.mutex.Unlock()
+		if !subscribed {
+			continue
+		}
+		select {
+		case client.send <- data:
+		default:
+			// Captions are live; a blocked client misses this one
+		}
+	}
+}
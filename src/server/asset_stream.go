@@ -0,0 +1,315 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	stdSync "sync"
+
+	"holodeck1/assets"
+	"holodeck1/config"
+	"holodeck1/features"
+	"holodeck1/logging"
+	"holodeck1/storage"
+)
+
+// Progressive asset streaming over the sync channel.
+//
+// Large GLB files do not fit in a single WebSocket message, so clients ask
+// for them in chunks instead:
+//
+//	→ asset_stream_request {stream_id, digest, offset?, capabilities?}
+//	← asset_stream_start   {stream_id, digest, content_digest, variant, size, offset, chunk_size}
+//	← asset_stream_chunk   {stream_id, index, offset, data (base64), sha256}   (repeated)
+//	← asset_stream_end     {stream_id, content_digest, size}
+//	← asset_stream_error   {stream_id, error}
+//	→ asset_stream_cancel  {stream_id}
+//
+// Every chunk carries its own SHA-256 and the whole transfer is verified
+// against content_digest, which is also the blob's address. An interrupted
+// transfer resumes by requesting content_digest again with offset set to the
+// bytes already received.
+
+// assetStreamOverhead reserves room for the JSON envelope around a chunk
+const assetStreamOverhead = 512
+
+// assetStreamRequest is the client message opening or resuming a stream
+type assetStreamRequest struct {
+	StreamID     string `json:"stream_id"`
+	Digest       string `json:"digest"`
+	Offset       int64  `json:"offset"`
+	Capabilities string `json:"capabilities"`
+}
+
+// assetStreams tracks the in-flight transfers of one client
+type assetStreams struct {
+	mutex   stdSync.Mutex
+	cancels map[string]context.CancelFunc
+	wg      stdSync.WaitGroup
+	closed  bool
+}
+
+// assetChunkSize returns the raw chunk size, capped so the base64 payload
+// plus envelope stays within the WebSocket max message size
+func assetChunkSize() int {
+	size := config.GetWebSocketAssetChunkSize()
+	limit := int((getMaxMessageSize() - assetStreamOverhead) / 4 * 3)
+	if size <= 0 || size > limit {
+		size = limit
+	}
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+// startAssetStream validates a request and streams the blob in the background
+func (c *Client) startAssetStream(message []byte) {
+	var req assetStreamRequest
+	if err := json.Unmarshal(message, &req); err != nil || req.StreamID == "" {
+		c.sendAssetStreamError(req.StreamID, "stream_id required")
+		return
+	}
+	if !features.Enabled(features.AssetStreaming, c.org, config.GetWorldsDefaultWorld()) {
+		c.sendAssetStreamError(req.StreamID, "feature not enabled: "+features.AssetStreaming)
+		return
+	}
+	req.Digest = strings.TrimPrefix(req.Digest, assets.RefPrefix)
+
+	key, err := assets.BlobKey(req.Digest)
+	if err != nil {
+		c.sendAssetStreamError(req.StreamID, err.Error())
+		return
+	}
+	if req.Offset < 0 {
+		c.sendAssetStreamError(req.StreamID, "offset must not be negative")
+		return
+	}
+
+	backend := storage.Default()
+	if backend == nil {
+		c.sendAssetStreamError(req.StreamID, "storage backend unavailable")
+		return
+	}
+	if quarantine, err := assets.LoadQuarantine(context.Background(), backend, req.Digest); err != nil {
+		c.sendAssetStreamError(req.StreamID, "storage backend unavailable")
+		return
+	} else if quarantine != nil {
+		c.sendAssetStreamError(req.StreamID, "asset is quarantined")
+		return
+	}
+
+	c.assetStreams.mutex.Lock()
+	if c.assetStreams.closed {
+		c.assetStreams.mutex.Unlock()
+		return
+	}
+	if c.assetStreams.cancels == nil {
+		c.assetStreams.cancels = make(map[string]context.CancelFunc)
+	}
+	if _, exists := c.assetStreams.cancels[req.StreamID]; exists {
+		c.assetStreams.mutex.Unlock()
+		c.sendAssetStreamError(req.StreamID, "stream already active")
+		return
+	}
+	if len(c.assetStreams.cancels) >= config.GetWebSocketMaxAssetStreams() {
+		c.assetStreams.mutex.Unlock()
+		c.sendAssetStreamError(req.StreamID, "too many concurrent asset streams")
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.assetStreams.cancels[req.StreamID] = cancel
+	c.assetStreams.wg.Add(1)
+	c.assetStreams.mutex.Unlock()
+
+	go func() {
+		defer c.assetStreams.wg.Done()
+		defer c.finishAssetStream(req.StreamID)
+
+		if err := c.streamAsset(ctx, backend, key, req); err != nil && ctx.Err() == nil {
+			logging.Warn("asset stream failed", map[string]interface{}{
+				"hd1_id":    c.GetClientID(),
+				"stream_id": req.StreamID,
+				"digest":    req.Digest,
+				"error":     err.Error(),
+			})
+			c.sendAssetStreamError(req.StreamID, err.Error())
+		}
+	}()
+}
+
+// streamAsset sends start, chunk and end messages for one transfer
+func (c *Client) streamAsset(ctx context.Context, backend storage.Backend, key string, req assetStreamRequest) error {
+	contentDigest := req.Digest
+	variant := "source"
+
+	// Explicit capabilities override the negotiated profile
+	profile := c.Profile()
+	capabilities := profile.Capabilities()
+	if req.Capabilities != "" {
+		capabilities = req.Capabilities
+	}
+	if capabilities != "" || profile.MaxTextureSize > 0 {
+		manifest, _ := assets.LoadManifest(ctx, backend, req.Digest)
+		if selected := manifest.SelectVariant(assets.ParseCapabilities(capabilities), profile.MaxTextureSize); selected != nil {
+			if variantKey, err := assets.BlobKey(selected.Digest); err == nil {
+				key = variantKey
+				contentDigest = selected.Digest
+				variant = selected.Label()
+			}
+		}
+	}
+
+	body, info, err := backend.Get(ctx, key)
+	if err == storage.ErrNotFound {
+		return errors.New("asset not found")
+	} else if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if req.Offset > info.Size {
+		return errors.New("offset beyond end of asset")
+	}
+	if req.Offset > 0 {
+		if _, err := io.CopyN(io.Discard, body, req.Offset); err != nil {
+			return err
+		}
+	}
+
+	chunkSize := assetChunkSize()
+	if !c.queueAssetStreamMessage(ctx, map[string]interface{}{
+		"type":           "asset_stream_start",
+		"stream_id":      req.StreamID,
+		"digest":         req.Digest,
+		"content_digest": contentDigest,
+		"variant":        variant,
+		"size":           info.Size,
+		"offset":         req.Offset,
+		"chunk_size":     chunkSize,
+	}) {
+		return ctx.Err()
+	}
+
+	buffer := make([]byte, chunkSize)
+	offset := req.Offset
+	index := req.Offset / int64(chunkSize)
+	for offset < info.Size {
+		n, err := io.ReadFull(body, buffer)
+		if n > 0 {
+			sum := sha256.Sum256(buffer[:n])
+			if !c.queueAssetStreamMessage(ctx, map[string]interface{}{
+				"type":      "asset_stream_chunk",
+				"stream_id": req.StreamID,
+				"index":     index,
+				"offset":    offset,
+				"data":      base64.StdEncoding.EncodeToString(buffer[:n]),
+				"sha256":    hex.EncodeToString(sum[:]),
+			}) {
+				return ctx.Err()
+			}
+			offset += int64(n)
+			index++
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if offset != info.Size {
+		return errors.New("asset truncated during transfer")
+	}
+
+	c.queueAssetStreamMessage(ctx, map[string]interface{}{
+		"type":           "asset_stream_end",
+		"stream_id":      req.StreamID,
+		"content_digest": contentDigest,
+		"size":           info.Size,
+	})
+
+	logging.Debug("asset stream completed", map[string]interface{}{
+		"hd1_id":    c.GetClientID(),
+		"stream_id": req.StreamID,
+		"digest":    contentDigest,
+		"variant":   variant,
+		"bytes":     info.Size - req.Offset,
+	})
+	return nil
+}
+
+// queueAssetStreamMessage blocks until the writer accepts the message so
+// a slow client throttles its own stream instead of dropping chunks
+func (c *Client) queueAssetStreamMessage(ctx context.Context, message map[string]interface{}) bool {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return false
+	}
+	select {
+	case c.send <- data:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// sendAssetStreamError reports a failed request without blocking the reader
+func (c *Client) sendAssetStreamError(streamID, reason string) {
+	data, err := json.Marshal(map[string]interface{}{
+		"type":      "asset_stream_error",
+		"stream_id": streamID,
+		"error":     reason,
+	})
+	if err != nil {
+		return
+	}
+
+	c.assetStreams.mutex.Lock()
+	defer c.assetStreams.mutex.Unlock()
+	if c.assetStreams.closed {
+		return
+	}
+	select {
+	case c.send <- data:
+	default:
+		// Client Go channel blocked, don't wait
+	}
+}
+
+// cancelAssetStream stops a transfer at the client's request
+func (c *Client) cancelAssetStream(streamID string) {
+	c.assetStreams.mutex.Lock()
+	cancel, ok := c.assetStreams.cancels[streamID]
+	c.assetStreams.mutex.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+// finishAssetStream forgets a completed or cancelled transfer
+func (c *Client) finishAssetStream(streamID string) {
+	c.assetStreams.mutex.Lock()
+	defer c.assetStreams.mutex.Unlock()
+	if cancel, ok := c.assetStreams.cancels[streamID]; ok {
+		cancel()
+		delete(c.assetStreams.cancels, streamID)
+	}
+}
+
+// stopAssetStreams cancels every transfer and waits for them to exit; the
+// hub calls it before closing the send channel
+func (c *Client) stopAssetStreams() {
+	c.assetStreams.mutex.Lock()
+	c.assetStreams.closed = true
+	for _, cancel := range c.assetStreams.cancels {
+		cancel()
+	}
+	c.assetStreams.mutex.Unlock()
+	c.assetStreams.wg.Wait()
+}
@@ -8,6 +8,7 @@ import (
 
 	"holodeck1/logging"
 	syncPkg "holodeck1/sync"
+	"holodeck1/xr"
 )
 
 // Avatar represents a connected client in the Three.js scene
@@ -20,6 +21,8 @@ type Avatar struct {
 	Animation    string                 `json:"animation,omitempty"`
 	Capabilities []string               `json:"capabilities"`
 	ClientInfo   *ClientInfo            `json:"client_info,omitempty"`
+	Pose         *xr.Pose               `json:"pose,omitempty"` // Latest XR pose, never mutated in place
+	IK           *xr.IKMetadata         `json:"ik,omitempty"`
 	ConnectedAt  time.Time              `json:"connected_at"`
 	LastSeen     time.Time              `json:"last_seen"`
 	Client       *Client                `json:"-"` // Reference to WebSocket client
@@ -88,7 +91,7 @@ func (ar *AvatarRegistry) CreateAvatar(client *Client) *Avatar {
 	// Submit avatar_create operation to sync system
 	operation := &syncPkg.Operation{
 		ClientID: client.GetHD1ID(),
-		Type:     "avatar_create",
+		Type:     syncPkg.OpAvatarCreate,
 		Data: map[string]interface{}{
 			"hd1_id":       avatarID,
 			"name":         avatar.Name,
@@ -144,14 +147,17 @@ func (ar *AvatarRegistry) ReconnectClient(clientID string, newClient *Client) *A
 	return nil
 }
 
-// RemoveAvatar removes an avatar when client disconnects
-func (ar *AvatarRegistry) RemoveAvatar(avatarID string) {
+// ReleaseClient removes the avatar of a disconnecting client, unless a
+// reconnect took the avatar over, and reports whether it did; the sync
+// layer announces the departure
+func (ar *AvatarRegistry) ReleaseClient(client *Client) bool {
 	ar.mutex.Lock()
 	defer ar.mutex.Unlock()
 
+	avatarID := client.GetAvatarID()
 	avatar, exists := ar.avatars[avatarID]
-	if !exists {
-		return
+	if !exists || avatar.Client != client {
+		return false
 	}
 
 	// Remove from registry
@@ -160,21 +166,10 @@ func (ar *AvatarRegistry) RemoveAvatar(avatarID string) {
 	logging.Info("avatar removed", map[string]interface{}{
 		"avatar_id":  avatarID,
 		"client_id":  avatar.ClientID,
-		"session_id": avatar.Client.GetSessionID(),
+		"session_id": client.GetSessionID(),
 		"duration":   time.Since(avatar.ConnectedAt).String(),
 	})
-
-	// Submit avatar_remove operation to sync system
-	operation := &syncPkg.Operation{
-		ClientID: avatar.ClientID,
-		Type:     "avatar_remove",
-		Data: map[string]interface{}{
-			"hd1_id": avatarID,
-		},
-		Timestamp: time.Now(),
-	}
-
-	ar.hub.SubmitOperation(operation)
+	return true
 }
 
 // RemoveAvatarByClientID removes an avatar by client ID (for session cleanup)
@@ -197,7 +192,7 @@ func (ar *AvatarRegistry) RemoveAvatarByClientID(clientID string) bool {
 			// Submit avatar_remove operation to sync system
 			operation := &syncPkg.Operation{
 				ClientID: clientID,
-				Type:     "avatar_remove",
+				Type:     syncPkg.OpAvatarRemove,
 				Data: map[string]interface{}{
 					"hd1_id": avatarID,
 				},
@@ -238,6 +233,59 @@ func (ar *AvatarRegistry) UpdateAvatarPosition(avatarID string, positionData map
 	}
 }
 
+// UpdateAvatarPose merges an XR pose delta into the avatar's pose and
+// returns the resulting full pose
+func (ar *AvatarRegistry) UpdateAvatarPose(avatarID string, delta *xr.Pose) (*xr.Pose, bool) {
+	ar.mutex.Lock()
+	defer ar.mutex.Unlock()
+	
+	avatar, exists := ar.avatars[avatarID]
+	if !exists {
+		return nil, false
+	}
+	
+	// Replace rather than mutate so readers holding the old pose stay consistent
+	pose := avatar.Pose.Clone()
+	if pose == nil {
+		pose = &xr.Pose{}
+	}
+	pose.Merge(delta)
+	avatar.Pose = pose
+	avatar.LastSeen = time.Now()
+	
+	return pose, true
+}
+
+// SetAvatarIK stores an avatar's IK metadata and broadcasts it
+func (ar *AvatarRegistry) SetAvatarIK(avatarID string, ik *xr.IKMetadata) error {
+	ar.mutex.Lock()
+	avatar, exists := ar.avatars[avatarID]
+	if !exists {
+		ar.mutex.Unlock()
+		return fmt.Errorf("avatar not found: %s", avatarID)
+	}
+	avatar.IK = ik
+	avatar.LastSeen = time.Now()
+	ar.mutex.Unlock()
+	
+	logging.Info("avatar IK metadata updated", map[string]interface{}{
+		"avatar_id": avatarID,
+		"rig":       ik.Rig,
+		"height":    ik.Height,
+	})
+	
+	ar.hub.SubmitOperation(&syncPkg.Operation{
+		ClientID: avatarID,
+		Type:     syncPkg.OpAvatarUpdate,
+		Data: map[string]interface{}{
+			"hd1_id": avatarID,
+			"ik":     ik,
+		},
+		Timestamp: time.Now(),
+	})
+	return nil
+}
+
 // GetAvatar gets an avatar by ID
 func (ar *AvatarRegistry) GetAvatar(avatarID string) (*Avatar, bool) {
 	ar.mutex.RLock()
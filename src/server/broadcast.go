@@ -0,0 +1,99 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"holodeck1/broadcast"
+	"holodeck1/logging"
+)
+
+// A broadcast's render client streams its recording over its own
+// connection, apart from the console's:
+//
+//	GET /ws/broadcast?id=...&token=...
+//	server → client  broadcast_start  {width, height, frame_rate, bitrate_kbps}
+//	client → server  binary WebM pieces, in order
+//
+// The server closes the connection with 1000 when the broadcast ends, and
+// with 1011 when every endpoint failed; a render client reconnects after
+// anything but the first.
+
+// maxBroadcastMessage bounds one piece of recording
+const maxBroadcastMessage = 8 << 20
+
+// ServeBroadcast feeds a render client's recording to its broadcast's
+// encoders
+func ServeBroadcast(w http.ResponseWriter, r *http.Request) {
+	if !checkOrigin(r) {
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return
+	}
+	query := r.URL.Query()
+	ingest, err := broadcast.Open(query.Get("id"), query.Get("token"), time.Now())
+	switch err {
+	case nil:
+	case broadcast.ErrNotFound:
+		http.Error(w, "Broadcast not found", http.StatusNotFound)
+		return
+	case broadcast.ErrToken:
+		http.Error(w, "Broadcast token invalid", http.StatusForbidden)
+		return
+	case broadcast.ErrEnded:
+		http.Error(w, "Broadcast ended", http.StatusConflict)
+		return
+	case broadcast.ErrBusy:
+		http.Error(w, "Broadcast already has a render client", http.StatusConflict)
+		return
+	default:
+		http.Error(w, "Broadcast encoders failed to start", http.StatusBadGateway)
+		return
+	}
+
+	upgrader := getUpgrader()
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		ingest.Close()
+		logging.Error("broadcast websocket upgrade failed", map[string]interface{}{
+			"error":     err.Error(),
+			"remote_ip": ClientIP(r),
+		})
+		return
+	}
+	defer conn.Close()
+	defer ingest.Close()
+	conn.SetReadLimit(maxBroadcastMessage)
+
+	settings := ingest.Broadcast()
+	conn.WriteJSON(map[string]interface{}{
+		"type":         "broadcast_start",
+		"width":        settings.Width,
+		"height":       settings.Height,
+		"frame_rate":   settings.FrameRate,
+		"bitrate_kbps": settings.Bitrate,
+	})
+
+	// The broadcast ending closes the connection under the reader
+	go func() {
+		<-ingest.Done()
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, "broadcast ended"), time.Now().Add(time.Second))
+		conn.Close()
+	}()
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if messageType != websocket.BinaryMessage {
+			continue
+		}
+		if _, err := ingest.Write(data); err != nil {
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseInternalServerErr, err.Error()), time.Now().Add(time.Second))
+			return
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"sort"
+	"strings"
+	stdSync "sync"
+	"time"
+
+	"holodeck1/assets"
+	"holodeck1/config"
+	"holodeck1/sync"
+)
+
+// Capability tiers negotiated from client_info
+const (
+	TierUnknown  = "unknown"
+	TierLow      = "low"
+	TierStandard = "standard"
+	TierHigh     = "high"
+)
+
+// CapabilityProfile is the server's decision on how to deliver content to
+// one client: which asset variants it can decode, the texture resolution
+// worth sending, how often it receives avatar movement and whether it draws
+// crowds of avatars instanced.
+type CapabilityProfile struct {
+	Tier           string   `json:"tier"`
+	AssetFeatures  []string `json:"asset_features"`
+	MaxTextureSize int      `json:"max_texture_size"` // 0 = no cap
+	UpdateRate     int      `json:"update_rate"`      // avatar updates per second, 0 = unthrottled
+	Instancing     bool     `json:"instancing"`       // Far crowd avatars as one instanced mesh
+}
+
+// defaultProfile applies until a client reports its capabilities, keeping
+// API consumers and older clients on unthrottled source delivery
+func defaultProfile() CapabilityProfile {
+	return CapabilityProfile{Tier: TierUnknown, AssetFeatures: []string{}}
+}
+
+// NegotiateProfile derives a capability profile from reported client info
+func NegotiateProfile(info *ClientInfo) CapabilityProfile {
+	if info == nil {
+		return defaultProfile()
+	}
+	caps := info.Capabilities
+
+	webglVersion := caps.WebGLVersion
+	if webglVersion == 0 && caps.WebGL {
+		webglVersion = 1
+	}
+
+	profile := CapabilityProfile{AssetFeatures: []string{}}
+	switch {
+	case webglVersion >= 2 && !caps.Mobile:
+		profile.Tier = TierHigh
+		profile.UpdateRate = config.GetClientsHighUpdateRate()
+		profile.MaxTextureSize = config.GetClientsHighTextureSize()
+	case webglVersion >= 2 || (webglVersion == 1 && !caps.Mobile):
+		profile.Tier = TierStandard
+		profile.UpdateRate = config.GetClientsStandardUpdateRate()
+		profile.MaxTextureSize = config.GetClientsStandardTextureSize()
+	default:
+		profile.Tier = TierLow
+		profile.UpdateRate = config.GetClientsLowUpdateRate()
+		profile.MaxTextureSize = config.GetClientsLowTextureSize()
+	}
+
+	// The GPU limit wins over the tier cap
+	if caps.MaxTextureSize > 0 && (profile.MaxTextureSize == 0 || caps.MaxTextureSize < profile.MaxTextureSize) {
+		profile.MaxTextureSize = caps.MaxTextureSize
+	}
+
+	// Instanced drawing is core in WebGL 2 and an extension in WebGL 1
+	profile.Instancing = webglVersion >= 2 || caps.Instancing
+
+	if caps.Draco {
+		profile.AssetFeatures = append(profile.AssetFeatures, assets.FeatureDraco)
+	}
+	if caps.Meshopt {
+		profile.AssetFeatures = append(profile.AssetFeatures, assets.FeatureMeshopt)
+	}
+	if caps.KTX2 {
+		profile.AssetFeatures = append(profile.AssetFeatures, assets.FeatureKTX2)
+	}
+	return profile
+}
+
+// Capabilities returns the asset features in assets.ParseCapabilities form
+func (p CapabilityProfile) Capabilities() string {
+	return strings.Join(p.AssetFeatures, ",")
+}
+
+// UpdateInterval is the minimum spacing between avatar updates, 0 = none
+func (p CapabilityProfile) UpdateInterval() time.Duration {
+	if p.UpdateRate <= 0 {
+		return 0
+	}
+	return time.Second / time.Duration(p.UpdateRate)
+}
+
+// clientProfile guards a client's negotiated profile, which is written by
+// the read pump and read by the forwarder and API handlers
+type clientProfile struct {
+	mutex      stdSync.RWMutex
+	current    CapabilityProfile
+	negotiated bool
+}
+
+// Profile returns the client's negotiated capability profile
+func (c *Client) Profile() CapabilityProfile {
+	c.profile.mutex.RLock()
+	defer c.profile.mutex.RUnlock()
+	if !c.profile.negotiated {
+		return defaultProfile()
+	}
+	return c.profile.current
+}
+
+func (c *Client) setProfile(profile CapabilityProfile) {
+	c.profile.mutex.Lock()
+	c.profile.current = profile
+	c.profile.negotiated = true
+	c.profile.mutex.Unlock()
+}
+
+// GetClientProfile returns the capability profile of a connected client
+func (h *Hub) GetClientProfile(hd1ID string) (CapabilityProfile, bool) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for client := range h.clients {
+		if client.GetHD1ID() == hd1ID {
+			return client.Profile(), true
+		}
+	}
+	return defaultProfile(), false
+}
+
+// moveThrottle paces avatar_move operations for one client. It is only
+// used from the client's forwarding goroutine.
+type moveThrottle struct {
+	lastSent map[string]time.Time
+	pending  map[string]heldMove
+}
+
+// heldMove is an avatar's latest move and when it may be sent
+type heldMove struct {
+	operation *sync.Operation
+	due       time.Time
+}
+
+func newMoveThrottle() *moveThrottle {
+	return &moveThrottle{
+		lastSent: make(map[string]time.Time),
+		pending:  make(map[string]heldMove),
+	}
+}
+
+// hold returns how long to wait before operation may be sent, keeping it
+// as the avatar's pending move; 0 means send now
+func (t *moveThrottle) hold(operation *sync.Operation, interval time.Duration) time.Duration {
+	if operation.Type == sync.OpAvatarRemove || operation.Type == sync.OpAvatarLeave {
+		// A held move must not resurrect a removed avatar
+		delete(t.pending, moveAvatarID(operation))
+		return 0
+	}
+	if operation.Type != sync.OpAvatarMove || interval <= 0 {
+		return 0
+	}
+	avatarID := moveAvatarID(operation)
+	if avatarID == "" {
+		return 0
+	}
+
+	now := time.Now()
+	if wait := interval - now.Sub(t.lastSent[avatarID]); wait > 0 {
+		t.pending[avatarID] = heldMove{operation: operation, due: now.Add(wait)}
+		return wait
+	}
+	t.lastSent[avatarID] = now
+	delete(t.pending, avatarID)
+	return 0
+}
+
+// release returns the held moves that are due, in sequence order, and how
+// long until the next of those still held is; 0 when none is
+func (t *moveThrottle) release() ([]*sync.Operation, time.Duration) {
+	now := time.Now()
+	due := make([]*sync.Operation, 0, len(t.pending))
+	var next time.Duration
+	for avatarID, held := range t.pending {
+		if wait := held.due.Sub(now); wait > 0 {
+			if next == 0 || wait < next {
+				next = wait
+			}
+			continue
+		}
+		due = append(due, held.operation)
+		t.lastSent[avatarID] = now
+		delete(t.pending, avatarID)
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].SeqNum < due[j].SeqNum })
+	return due, next
+}
+
+func moveAvatarID(operation *sync.Operation) string {
+	avatarID, _ := operation.Data["hd1_id"].(string)
+	return avatarID
+}
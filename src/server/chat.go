@@ -0,0 +1,30 @@
+package server
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Chat messages are pushed to consoles as chat messages; the server keeps
+// no history of them.
+
+// ChatMessage is a line in the world's chat
+type ChatMessage struct {
+	From   string    `json:"from"`
+	Text   string    `json:"text"`
+	Source string    `json:"source,omitempty"` // What posted it, such as webhook:grafana
+	Time   time.Time `json:"time"`
+}
+
+// PublishChat sends a chat message to every client; every client is in the
+// served world
+func (h *Hub) PublishChat(message ChatMessage) {
+	if message.Time.IsZero() {
+		message.Time = time.Now().UTC()
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":    "chat",
+		"message": message,
+	})
+	h.Broadcast(data)
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+
+	"holodeck1/chunks"
+	"holodeck1/logging"
+	"holodeck1/sync"
+)
+
+// chunkMessage is a chunks.Event as clients receive it
+type chunkMessage struct {
+	Type string `json:"type"`
+	chunks.Event
+}
+
+// newChunkStream returns a stream with the chunks around the spawn point
+// loaded, or nil when clients are sent whole worlds. The avatar's first
+// move brings in the chunks around it.
+func (c *Client) newChunkStream() *chunks.Stream {
+	if !chunks.Enabled() {
+		return nil
+	}
+	stream := chunks.NewStream()
+	c.sendChunkEvents(stream.Follow(c.hub.sync, chunks.Key{}))
+	return stream
+}
+
+// streamOperation reports whether an operation is forwarded to the client,
+// following its avatar from chunk to chunk and sending the chunk events
+// that come with the operation
+func (c *Client) streamOperation(stream *chunks.Stream, operation *sync.Operation) bool {
+	if stream == nil {
+		return true
+	}
+	if key, ok := chunks.Moved(operation, c.GetHD1ID()); ok {
+		c.sendChunkEvents(stream.Follow(c.hub.sync, key))
+	}
+	send, events := stream.Filter(c.hub.sync, operation)
+	c.sendChunkEvents(events)
+	return send
+}
+
+// requestChunkReload asks the forwarder to send the client's chunks again,
+// after the console cleared its scene
+func (c *Client) requestChunkReload() {
+	select {
+	case c.chunkReload <- struct{}{}:
+	default:
+		// A reload is already pending
+	}
+}
+
+// sendChunkEvents queues chunk events for the WebSocket writer
+func (c *Client) sendChunkEvents(events []chunks.Event) {
+	for _, event := range events {
+		data, err := json.Marshal(chunkMessage{Type: "chunk", Event: event})
+		if err != nil {
+			continue
+		}
+		c.hub.mutex.RLock()
+		if !c.hub.clients[c] {
+			c.hub.mutex.RUnlock()
+			return
+		}
+		select {
+		case c.send <- data:
+			logging.Trace("websocket", "chunk event sent to client", map[string]interface{}{
+				"hd1_id": c.GetHD1ID(),
+				"event":  event.Event,
+				"chunk":  event.Chunk.String(),
+			})
+		default:
+			logging.Error("chunk event dropped - client send channel blocked", map[string]interface{}{
+				"hd1_id":   c.GetHD1ID(),
+				"event":    event.Event,
+				"chunk":    event.Chunk.String(),
+				"entities": len(event.Entities),
+			})
+		}
+		c.hub.mutex.RUnlock()
+	}
+}
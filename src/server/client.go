@@ -9,7 +9,12 @@ import (
 
 	"github.com/gorilla/websocket"
 	"holodeck1/config"
+	"holodeck1/guests"
 	"holodeck1/logging"
+	"holodeck1/moderation"
+	"holodeck1/quotas"
+	"holodeck1/signing"
+	"holodeck1/tokens"
 	"holodeck1/sync"
 )
 
@@ -34,9 +39,7 @@ func getUpgrader() websocket.Upgrader {
 	return websocket.Upgrader{
 		ReadBufferSize:  config.GetWebSocketReadBufferSize(),
 		WriteBufferSize: config.GetWebSocketWriteBufferSize(),
-		CheckOrigin: func(r *http.Request) bool {
-			return true // Allow all origins for now
-		},
+		CheckOrigin:     checkOrigin,
 	}
 }
 
@@ -52,9 +55,15 @@ type ClientInfo struct {
 		Height int `json:"height"`
 	} `json:"canvas"`
 	Capabilities struct {
-		WebGL  bool `json:"webgl"`
-		Touch  bool `json:"touch"`
-		Mobile bool `json:"mobile"`
+		WebGL          bool `json:"webgl"`
+		WebGLVersion   int  `json:"webglVersion"`
+		Touch          bool `json:"touch"`
+		Mobile         bool `json:"mobile"`
+		MaxTextureSize int  `json:"maxTextureSize"`
+		Draco          bool `json:"draco"`
+		Meshopt        bool `json:"meshopt"`
+		KTX2           bool `json:"ktx2"`
+		Instancing     bool `json:"instancing"`
 	} `json:"capabilities"`
 }
 
@@ -67,6 +76,18 @@ type Client struct {
 	hd1ID          string  // Single unified identifier - SINGLE SOURCE OF TRUTH
 	avatarCreated  bool    // Track if avatar has been created for this client
 	syncChan       chan *sync.Operation  // Sync system channel - SINGLE SOURCE OF TRUTH
+	assetStreams   assetStreams          // In-flight chunked asset transfers
+	profile        clientProfile         // Negotiated capability profile
+	xrRelay        xrRelay               // Pending XR poses from other avatars
+	accessibility  accessibilityState    // Description and caption subscriptions
+	remoteIP       string                // Client address, behind any trusted proxies
+	org            string                // Organization, for per-organization feature flags
+	session        sessionState          // Session token and last activity
+	chunkReload    chan struct{}         // Asks the forwarder to load the client's chunks again
+	limiter        *quotas.Limiter       // Message quota, nil for operators
+	limitedAt      time.Time             // Last told its messages were dropped
+	heartbeat      heartbeatState        // Heartbeat metrics and health score
+	spectator      bool                  // Joined without an avatar, read-only
 }
 
 // generateHD1ID generates a unified HD1 identifier
@@ -110,11 +131,13 @@ func (c *Client) ensureRegistered() {
 		
 		// Send client ID to browser
 		clientID := c.GetClientID()
-		initMessage := map[string]interface{}{
-			"type":    "client_init",
-			"hd1_id":  clientID,
-			"message": "HD1 ID assigned by server",
-		}
+		initMessage := c.issueToken()
+		initMessage["type"] = "client_init"
+		initMessage["hd1_id"] = clientID
+		initMessage["message"] = "HD1 ID assigned by server"
+		initMessage["heartbeat_ms"] = config.GetAvatarsHeartbeatFrequency().Milliseconds()
+		initMessage["telemetry_ms"] = config.GetTelemetryInterval().Milliseconds()
+		initMessage["world"] = config.GetWorldsDefaultWorld()
 		
 		if initData, err := json.Marshal(initMessage); err == nil {
 			select {
@@ -166,6 +189,11 @@ func (c *Client) readPump() {
 		// Update last seen time for any message activity
 		c.lastSeen = time.Now()
 		
+		// Messages past the organization's quota are dropped
+		if !c.allowMessage() {
+			continue
+		}
+		
 		// Handle special client messages
 		c.handleClientMessage(message)
 	}
@@ -195,12 +223,59 @@ func (c *Client) handleClientMessage(message []byte) {
 		return
 	}
 	
+	// Keepalives and automatic replies alone do not keep a session from
+	// going inactive
+	if msgType != "ping" && msgType != "heartbeat" && msgType != "checksum_response" {
+		c.touch()
+	}
+	
+	// With signed deltas, avatar deltas only count in a signed envelope
+	if signedMessages[msgType] && signing.Enabled() {
+		logging.Trace("signing", "unsigned delta dropped", map[string]interface{}{
+			"hd1_id": c.GetHD1ID(),
+			"type":   msgType,
+		})
+		return
+	}
+	
 	switch msgType {
+	case "signed":
+		c.handleSignedMessage(message)
+		
 	case "client_reconnect":
 		// Handle client reconnection with existing client ID
 		if existingClientID, ok := msg["hd1_id"].(string); ok {
-			// Try to reconnect to existing avatar
+			// Only the holder of a session token may take its identity back
+			value, _ := msg["token"].(string)
+			if token, err := tokens.Validate(value); err != nil || token.HD1ID != existingClientID {
+				logging.Warn("client reconnection refused, invalid session token", map[string]interface{}{
+					"requested_hd1_id": existingClientID,
+					"remote_ip":        c.remoteIP,
+				})
+				return
+			}
+			
+			// A banned session may not take its identity back
+			if ban := moderation.Banned(config.GetWorldsDefaultWorld(), existingClientID, ""); ban != nil {
+				c.hd1ID = existingClientID
+				c.refuseBanned()
+				return
+			}
+			
+			// Try to reconnect to existing avatar; the identity assigned on
+			// connect is abandoned
+			assignedID := c.GetHD1ID()
 			if avatar := c.hub.avatarRegistry.ReconnectClient(existingClientID, c); avatar != nil {
+				tokens.RevokeSession(assignedID)
+				c.releaseSigningKey()
+				
+				// A guest grant moves to the resumed identity; one the
+				// identity already holds stays
+				if grant := guests.GrantFor(assignedID); grant != nil {
+					guests.Release(assignedID)
+					guests.Bind(existingClientID, grant)
+				}
+				
 				// Set client ID to the existing one
 				c.hd1ID = existingClientID
 				
@@ -210,12 +285,14 @@ func (c *Client) handleClientMessage(message []byte) {
 				// Pure in-memory architecture - no session persistence needed
 				
 				// Send confirmation back to client
-				confirmMsg := map[string]interface{}{
-					"type":      "client_reconnect_success",
-					"hd1_id":    existingClientID,
-					"avatar_id": avatar.ID,
-					"message":   "Reconnected to existing avatar",
-				}
+				confirmMsg := c.resumeToken(value)
+				confirmMsg["type"] = "client_reconnect_success"
+				confirmMsg["hd1_id"] = existingClientID
+				confirmMsg["avatar_id"] = avatar.ID
+				confirmMsg["message"] = "Reconnected to existing avatar"
+				confirmMsg["heartbeat_ms"] = config.GetAvatarsHeartbeatFrequency().Milliseconds()
+				confirmMsg["telemetry_ms"] = config.GetTelemetryInterval().Milliseconds()
+				confirmMsg["world"] = config.GetWorldsDefaultWorld()
 				if jsonData, err := json.Marshal(confirmMsg); err == nil {
 					select {
 					case c.send <- jsonData:
@@ -227,6 +304,9 @@ func (c *Client) handleClientMessage(message []byte) {
 						// Client Go channel blocked, don't wait
 					}
 				}
+				
+				// A degraded session's console renders as its others do
+				c.sendQualityDirective()
 				return // Don't broadcast this message
 			} else {
 				logging.Info("client reconnection failed, creating new identity", map[string]interface{}{
@@ -272,38 +352,38 @@ func (c *Client) handleClientMessage(message []byte) {
 			c.info = &info
 			c.lastSeen = time.Now()
 			
+			profile := NegotiateProfile(&info)
+			c.setProfile(profile)
+			
 			logging.Info("client info updated", map[string]interface{}{
 				"screen": info.Screen,
 				"capabilities": info.Capabilities,
+				"tier": profile.Tier,
 			})
+			
+			// Tell the client what it will receive
+			profileMsg := map[string]interface{}{
+				"type":    "capability_profile",
+				"profile": profile,
+			}
+			if jsonData, err := json.Marshal(profileMsg); err == nil {
+				select {
+				case c.send <- jsonData:
+				default:
+					// Client Go channel blocked, don't wait
+				}
+			}
 		}
 		
-	case "ping":
-		// Handle client ping for latency measurement
-		pongMsg := map[string]interface{}{
-			"type": "pong",
-		}
-		
-		// Copy ping_id and timestamp for round-trip calculation
-		if pingID, ok := msg["ping_id"]; ok {
-			pongMsg["ping_id"] = pingID
-		}
-		if timestamp, ok := msg["timestamp"]; ok {
-			pongMsg["timestamp"] = timestamp
-		}
+	case "checksum_response":
+		c.verifyChecksum(msg)
 		
-		// Send pong response immediately
-		if jsonData, err := json.Marshal(pongMsg); err == nil {
-			select {
-			case c.send <- jsonData:
-			default:
-				// Client Go channel blocked, don't wait
-			}
-		}
+	case "ping":
+		// Latency measurement and clock synchronization
+		c.handlePing(msg, c.lastSeen)
 		
-		logging.Trace("websocket", "ping pong latency", map[string]interface{}{
-			"ping_id": msg["ping_id"],
-		})
+	case "heartbeat":
+		c.recordHeartbeat(msg)
 
 	case "session_associate":
 		// Legacy session association - eliminated for unified HD1 ID system
@@ -323,6 +403,40 @@ func (c *Client) handleClientMessage(message []byte) {
 	case "avatar_asset_request":
 		// Avatar asset requests not used in minimal build
 		
+	case "asset_stream_request":
+		c.startAssetStream(message)
+		
+	case "asset_stream_cancel":
+		if streamID, ok := msg["stream_id"].(string); ok {
+			c.cancelAssetStream(streamID)
+		}
+		
+	case "xr_pose":
+		c.lastSeen = time.Now()
+		c.handlePoseMessage(message)
+		
+	case "xr_ik":
+		c.handleIKMessage(message)
+		
+	case "accessibility_subscribe":
+		c.handleAccessibilitySubscribe(message)
+		
+	case "caption":
+		c.lastSeen = time.Now()
+		c.handleCaption(message)
+		
+	case "share_signal":
+		c.handleShareSignal(message)
+		
+	case "document_cursor":
+		c.handleDocumentCursor(message)
+		
+	case "chunks_reload":
+		c.requestChunkReload()
+		
+	case "spectator_follow":
+		c.handleSpectatorFollow(message)
+		
 	default:
 		// Ensure client is registered if not already (for first non-reconnect message)
 		c.ensureRegistered()
@@ -331,32 +445,89 @@ func (c *Client) handleClientMessage(message []byte) {
 	}
 }
 
-// forwardSyncOperations listens to sync channel and forwards operations to WebSocket
+// forwardSyncOperations listens to sync channel and forwards operations to WebSocket.
+// avatar_move operations are paced to the client's negotiated update rate,
+// or to the crowd's far update rate for avatars far from its own: moves
+// arriving too soon are held and only the latest per avatar is sent.
+// When worlds are streamed in chunks, entity operations outside the
+// client's chunks are held back first.
 func (c *Client) forwardSyncOperations() {
-	for operation := range c.syncChan {
-		// Convert sync operation to WebSocket message
-		message := map[string]interface{}{
-			"type":      "sync_operation",
-			"operation": operation,
-		}
-		
-		if messageData, err := json.Marshal(message); err == nil {
-			select {
-			case c.send <- messageData:
-				logging.Trace("websocket", "sync operation forwarded to client", map[string]interface{}{
-					"hd1_id":  c.GetClientID(),
-					"seq_num": operation.SeqNum,
-					"op_type": operation.Type,
-				})
-			default:
-				logging.Error("sync operation dropped - client send channel blocked", map[string]interface{}{
-					"hd1_id":  c.GetClientID(),
-					"seq_num": operation.SeqNum,
-					"op_type": operation.Type,
-				})
+	throttle := newMoveThrottle()
+	stream := c.newChunkStream()
+	crowd := c.newCrowdTracker()
+	var flush <-chan time.Time
+	var flushAt time.Time
+	
+	for {
+		select {
+		case operation, ok := <-c.syncChan:
+			if !ok {
+				return
+			}
+			if !c.streamOperation(stream, operation) {
+				continue
+			}
+			c.followCrowd(crowd, operation)
+			if wait := throttle.hold(operation, c.moveInterval(crowd, operation)); wait > 0 {
+				if at := time.Now().Add(wait); flush == nil || at.Before(flushAt) {
+					flush, flushAt = time.After(wait), at
+				}
+				continue
 			}
+			c.sendSyncOperation(operation)
+			
+		case <-c.chunkReload:
+			if stream != nil {
+				c.sendChunkEvents(stream.Reload(c.hub.sync))
+			}
+			
+		case <-flush:
+			flush = nil
+			due, next := throttle.release()
+			for _, operation := range due {
+				c.sendSyncOperation(operation)
+			}
+			if next > 0 {
+				flush, flushAt = time.After(next), time.Now().Add(next)
+			}
+		}
+	}
+}
+
+// sendSyncOperation queues one sync operation for the WebSocket writer
+func (c *Client) sendSyncOperation(operation *sync.Operation) {
+	// Convert sync operation to WebSocket message
+	message := map[string]interface{}{
+		"type":      "sync_operation",
+		"operation": operation,
+	}
+	
+	if messageData, err := json.Marshal(message); err == nil {
+		// Operations still buffered when the client unregisters must not
+		// reach its closed send channel
+		c.hub.mutex.RLock()
+		if !c.hub.clients[c] {
+			c.hub.mutex.RUnlock()
+			return
+		}
+		select {
+		case c.send <- messageData:
+			logging.Trace("websocket", "sync operation forwarded to client", map[string]interface{}{
+				"hd1_id":  c.GetClientID(),
+				"seq_num": operation.SeqNum,
+				"op_type": operation.Type,
+			})
+		default:
+			logging.Error("sync operation dropped - client send channel blocked", map[string]interface{}{
+				"hd1_id":  c.GetClientID(),
+				"seq_num": operation.SeqNum,
+				"op_type": operation.Type,
+			})
 		}
+		c.hub.mutex.RUnlock()
 	}
+	
+	c.describeOperation(operation)
 }
 
 // sendInitialSync sends existing operations to newly connected client
@@ -428,29 +599,91 @@ func (c *Client) writePump() {
 }
 
 func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	remoteIP := ClientIP(r)
+	if IsDraining() {
+		http.Error(w, "Server draining", http.StatusServiceUnavailable)
+		return
+	}
+	if !checkOrigin(r) {
+		logging.Warn("websocket origin rejected", map[string]interface{}{
+			"origin":    r.Header.Get("Origin"),
+			"remote_ip": remoteIP,
+		})
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return
+	}
+	if ban := moderation.Banned(config.GetWorldsDefaultWorld(), "", remoteIP); ban != nil {
+		logging.Info("banned address refused", map[string]interface{}{
+			"remote_ip": remoteIP,
+			"ban_id":    ban.ID,
+		})
+		reportSecurity(requestOrg(r), "Banned address "+remoteIP+" tried to join", ban.Reason, ban.ID)
+		http.Error(w, "Banned from this world", http.StatusForbidden)
+		return
+	}
+	grant, admitted := admitGuest(w, r)
+	if !admitted {
+		return
+	}
+	if !admitConsent(w, r) {
+		return
+	}
+	if !admitQuota(w, r, hub) {
+		return
+	}
+	spectator, follows, admitted := admitSpectator(w, r)
+	if !admitted {
+		return
+	}
+
 	upgrader := getUpgrader()
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		logging.Error("websocket upgrade failed", map[string]interface{}{
-			"error": err.Error(),
+			"error":     err.Error(),
+			"remote_ip": remoteIP,
 		})
 		return
 	}
 	
+	// Browsers cannot set headers on upgrades, so ?org= stands in for X-HD1-Org
 	client := &Client{
-		hub:  hub, 
-		conn: conn, 
-		send: make(chan []byte, config.GetWebSocketClientWorldBuffer()),
+		hub:      hub, 
+		conn:     conn, 
+		send:     make(chan []byte, config.GetWebSocketClientWorldBuffer()),
+		remoteIP: remoteIP,
+		org:      requestOrg(r),
+		chunkReload: make(chan struct{}, 1),
+		spectator:   spectator,
+	}
+	if !IsOperator(r) {
+		client.limiter = quotas.NewLimiter(client.org)
 	}
 	
 	// Generate client ID immediately
 	clientID := client.GetClientID()
+	client.touch()
+	if grant != nil {
+		guests.Bind(clientID, grant)
+	}
+	if spectator {
+		client.joinSpectating(follows)
+	}
 	
-	// Send client ID to browser for unified identification
-	initMessage := map[string]interface{}{
-		"type":    "client_init",
-		"hd1_id":  clientID,
-		"message": "HD1 ID assigned by server",
+	// Send client ID and its session token to browser for unified identification
+	initMessage := client.issueToken()
+	initMessage["type"] = "client_init"
+	initMessage["hd1_id"] = clientID
+	initMessage["message"] = "HD1 ID assigned by server"
+	initMessage["heartbeat_ms"] = config.GetAvatarsHeartbeatFrequency().Milliseconds()
+	initMessage["telemetry_ms"] = config.GetTelemetryInterval().Milliseconds()
+	initMessage["world"] = config.GetWorldsDefaultWorld()
+	if grant != nil {
+		initMessage["guest"] = grant
+	}
+	if spectator {
+		initMessage["spectator"] = true
+		initMessage["follows"] = follows
 	}
 	
 	if initData, err := json.Marshal(initMessage); err == nil {
@@ -472,6 +705,21 @@ func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request) {
 		})
 	}
 	
+	// Consoles show a banner while maintenance is in progress
+	client.sendMaintenanceState()
+	
+	// Consoles of a world that moved follow it to its new server
+	client.sendMigrationState()
+	
+	// Consoles show a banner while support staff act as the session
+	client.sendImpersonationState()
+	
+	// Consoles show the polls running in the world
+	client.sendOpenPolls()
+	
+	// Spectators following the director start at its shot
+	client.sendDirectorShot()
+	
 	// Register client immediately - SINGLE SOURCE OF TRUTH
 	hub.register <- client
 	
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"encoding/json"
+	"time"
+
+	"holodeck1/logging"
+)
+
+// Clock synchronization.
+//
+// Clients estimate the server clock NTP-style from a ping:
+//
+//	→ ping {ping_id, timestamp: t0}
+//	← pong {ping_id, timestamp: t0, server_receive: t1, server_transmit: t2}
+//
+// With t3 the local receive time, offset = ((t1 - t0) + (t2 - t3)) / 2 and
+// round trip = (t3 - t0) - (t2 - t1). Every timestamp the server attaches
+// to deltas - operation timestamps, xr_poses and captions - is server time,
+// so clients can place them on their own timeline with the offset.
+
+// ServerMillis returns t as fractional milliseconds since the Unix epoch,
+// the unit JavaScript clocks use
+func ServerMillis(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Millisecond)
+}
+
+// handlePing answers a clock sync ping; receivedAt is when the message was read
+func (c *Client) handlePing(msg map[string]interface{}, receivedAt time.Time) {
+	pongMsg := map[string]interface{}{
+		"type":           "pong",
+		"server_receive": ServerMillis(receivedAt),
+	}
+
+	// Copy ping_id and timestamp for round-trip calculation
+	if pingID, ok := msg["ping_id"]; ok {
+		pongMsg["ping_id"] = pingID
+	}
+	if timestamp, ok := msg["timestamp"]; ok {
+		pongMsg["timestamp"] = timestamp
+	}
+	pongMsg["server_transmit"] = ServerMillis(time.Now())
+
+	// Send pong response immediately
+	if jsonData, err := json.Marshal(pongMsg); err == nil {
+		select {
+		case c.send <- jsonData:
+		default:
+			// Client Go channel blocked, don't wait
+		}
+	}
+
+	logging.Trace("websocket", "ping pong latency", map[string]interface{}{
+		"ping_id": msg["ping_id"],
+	})
+}
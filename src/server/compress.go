@@ -0,0 +1,229 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	stdSync "sync"
+
+	"github.com/andybalholm/brotli"
+	"holodeck1/config"
+)
+
+// Responses are compressed with brotli or gzip, whichever the client
+// prefers, when their content type is on the allow-list and they are large
+// enough to gain from it. Already compressed formats (GLB, images, media)
+// stay off the list. Bodies are buffered up to the minimum size so small
+// responses without a Content-Length go out unchanged.
+
+var (
+	gzipWriters   = stdSync.Pool{New: func() interface{} { return gzip.NewWriter(io.Discard) }}
+	brotliWriters = stdSync.Pool{New: func() interface{} { return brotli.NewWriterLevel(io.Discard, 5) }}
+)
+
+// Compress wraps a handler with response compression, unless disabled
+func Compress(next http.Handler) http.Handler {
+	if !config.GetCompressionEnabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// WebSocket upgrades hijack the connection; ranges address raw bytes
+		if r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" || r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding picks br or gzip from Accept-Encoding, by q-value with
+// br winning ties
+func negotiateEncoding(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "br" && name != "gzip" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > bestQ || (q == bestQ && name == "br") {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// compressible reports whether a content type is on the allow-list.
+// Entries are media types, or type/* for a whole family.
+func compressible(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	for _, allowed := range config.GetCompressionTypes() {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed == mediaType || (strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(allowed, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter holds the status and the first bytes of a response until
+// it can decide whether to compress
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	status   int
+	buffer   []byte
+	decided  bool
+	encoder  io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.decided {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if cw.status == 0 {
+		cw.status = status
+	}
+	// Informational responses go straight out; the real one follows
+	if status >= 100 && status < 200 {
+		cw.status = 0
+		cw.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.decided {
+		if cw.encoder != nil {
+			return cw.encoder.Write(p)
+		}
+		return cw.ResponseWriter.Write(p)
+	}
+	cw.buffer = append(cw.buffer, p...)
+	if len(cw.buffer) < config.GetCompressionMinSize() && cw.Header().Get("Content-Length") == "" {
+		return len(p), nil
+	}
+	if err := cw.decide(); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// decide sends the headers, compressed or not, then the buffered bytes
+func (cw *compressWriter) decide() error {
+	cw.decided = true
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	header := cw.Header()
+	if header.Get("Content-Type") == "" && len(cw.buffer) > 0 {
+		header.Set("Content-Type", http.DetectContentType(cw.buffer)) // As net/http would
+	}
+
+	size := len(cw.buffer)
+	if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil {
+		size = length
+	}
+	eligible := compressible(header.Get("Content-Type"))
+	if eligible {
+		header.Add("Vary", "Accept-Encoding")
+	}
+	if eligible && size >= config.GetCompressionMinSize() && header.Get("Content-Encoding") == "" &&
+		cw.status >= 200 && cw.status != http.StatusNoContent && cw.status != http.StatusNotModified {
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		header.Del("Accept-Ranges")
+		cw.encoder = cw.newEncoder()
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+	buffered := cw.buffer
+	cw.buffer = nil
+	if len(buffered) == 0 {
+		return nil
+	}
+	if cw.encoder != nil {
+		_, err := cw.encoder.Write(buffered)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buffered)
+	return err
+}
+
+func (cw *compressWriter) newEncoder() io.WriteCloser {
+	if cw.encoding == "br" {
+		writer := brotliWriters.Get().(*brotli.Writer)
+		writer.Reset(cw.ResponseWriter)
+		return writer
+	}
+	writer := gzipWriters.Get().(*gzip.Writer)
+	writer.Reset(cw.ResponseWriter)
+	return writer
+}
+
+// Flush sends everything so far, compressed, for streamed responses
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide()
+	}
+	switch encoder := cw.encoder.(type) {
+	case *gzip.Writer:
+		encoder.Flush()
+	case *brotli.Writer:
+		encoder.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close finishes the response and returns the encoder to its pool
+func (cw *compressWriter) Close() error {
+	if !cw.decided && (cw.status != 0 || len(cw.buffer) > 0) {
+		cw.decide()
+	}
+	if cw.encoder == nil {
+		return nil
+	}
+	err := cw.encoder.Close()
+	switch encoder := cw.encoder.(type) {
+	case *gzip.Writer:
+		gzipWriters.Put(encoder)
+	case *brotli.Writer:
+		brotliWriters.Put(encoder)
+	}
+	cw.encoder = nil
+	return err
+}
+
+// Hijack passes through for handlers that take over the connection
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := cw.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, fmt.Errorf("response writer does not support hijacking")
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
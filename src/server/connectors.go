@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net/http"
+
+	"holodeck1/config"
+	"holodeck1/connectors"
+)
+
+// The hub reports sessions joining, organizations reaching capacity, and
+// security events it sees to the organization's connectors.
+
+// orgSessionsLocked counts an organization's connected sessions; the
+// caller holds the hub mutex
+func (h *Hub) orgSessionsLocked(org string) int {
+	sessions := map[string]bool{}
+	for client := range h.clients {
+		if client.org == org {
+			sessions[client.GetHD1ID()] = true
+		}
+	}
+	return len(sessions)
+}
+
+// reportSessionStartedLocked publishes a new session joining; the caller
+// holds the hub mutex
+func (h *Hub) reportSessionStartedLocked(client *Client) {
+	world := config.GetWorldsDefaultWorld()
+	sessions := h.orgSessionsLocked(client.org)
+	connectors.Publish(connectors.Event{
+		Type:     connectors.EventSessionStarted,
+		Org:      client.org,
+		World:    world,
+		Session:  client.GetHD1ID(),
+		Sessions: sessions,
+		Key:      client.GetHD1ID(),
+	})
+	connectors.Occupancy(client.org, world, sessions)
+}
+
+// reportOccupancyLocked tells the connectors an organization's sessions
+// changed; the caller holds the hub mutex
+func (h *Hub) reportOccupancyLocked(org string) {
+	connectors.Occupancy(org, config.GetWorldsDefaultWorld(), h.orgSessionsLocked(org))
+}
+
+// reportSecurity publishes a high-risk security event in the served world.
+// Repeats with the same key are dropped within the connectors' cooldown.
+func reportSecurity(org, summary, detail, key string) {
+	connectors.Publish(connectors.Event{
+		Type:    connectors.EventSecurity,
+		Org:     org,
+		World:   config.GetWorldsDefaultWorld(),
+		Summary: summary,
+		Detail:  detail,
+		Key:     key,
+	})
+}
+
+// requestOrg returns the organization of a request, as X-HD1-Org or, on
+// WebSocket upgrades, ?org=
+func requestOrg(r *http.Request) string {
+	org := r.Header.Get("X-HD1-Org")
+	if org == "" {
+		org = r.URL.Query().Get("org")
+	}
+	if org == "" {
+		org = "default"
+	}
+	return org
+}
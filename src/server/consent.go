@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"holodeck1/consent"
+	"holodeck1/logging"
+	"holodeck1/storage"
+)
+
+// admitConsent refuses connections whose ?consent=<token> has not accepted
+// the current version of every required document, writing 403. Operators
+// join without consent, as they do without a guest link.
+func admitConsent(w http.ResponseWriter, r *http.Request) bool {
+	if !consent.Gating() || IsOperator(r) {
+		return true
+	}
+	backend := storage.Default()
+	if backend == nil {
+		http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+		return false
+	}
+
+	var record *consent.Record
+	if token := r.URL.Query().Get("consent"); token != "" {
+		found, err := consent.Lookup(r.Context(), backend, token)
+		if err != nil && err != consent.ErrInvalid {
+			http.Error(w, "Storage backend unavailable", http.StatusServiceUnavailable)
+			return false
+		}
+		record = found
+	}
+	pending := consent.Pending(record)
+	if len(pending) == 0 {
+		return true
+	}
+
+	ids := make([]string, 0, len(pending))
+	for _, doc := range pending {
+		ids = append(ids, doc.ID)
+	}
+	logging.Info("connection refused pending consent", map[string]interface{}{
+		"remote_ip": ClientIP(r),
+		"pending":   ids,
+	})
+	http.Error(w, "Consent required: "+strings.Join(ids, ", "), http.StatusForbidden)
+	return false
+}
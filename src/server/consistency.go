@@ -0,0 +1,175 @@
+package server
+
+import (
+	"encoding/json"
+	stdSync "sync"
+
+	"holodeck1/chunks"
+	"holodeck1/logging"
+	"holodeck1/signing"
+	"holodeck1/sync"
+)
+
+// The hub periodically broadcasts a checksum_challenge with the world's
+// checksum at its current sequence number. Consoles answer with a
+// checksum_response carrying the checksum of what they render and the last
+// sequence number they applied, which the server checks against the world
+// at that sequence number, so clients that are merely behind still match.
+// A client that diverged is sent resync with the hash of every entity in
+// the world, and reloads only the entities whose hashes differ.
+
+// ChecksumFunc rebuilds a world from its operation log, starting at
+// sequence 1, and returns its checksum and the hash of each entity; see
+// worlds.ChecksumOperations
+type ChecksumFunc func(operations []*sync.Operation, algorithm string) (string, map[string]string, error)
+
+// maxCachedChecksums bounds the checksums kept for lagging clients
+const maxCachedChecksums = 64
+
+// checksumCache remembers world checksums by sequence number; a checksum
+// never changes once computed, since the log is append-only
+type checksumCache struct {
+	mutex     stdSync.Mutex
+	compute   ChecksumFunc
+	checksums map[uint64]worldChecksum
+}
+
+type worldChecksum struct {
+	checksum string
+	entities int
+}
+
+// SetChecksumFunc enables consistency checks; the server package cannot
+// rebuild world state itself
+func (h *Hub) SetChecksumFunc(compute ChecksumFunc) {
+	h.checksums.mutex.Lock()
+	defer h.checksums.mutex.Unlock()
+	h.checksums.compute = compute
+}
+
+// worldChecksumAt returns the world checksum after operation seqNum, or
+// false when the log no longer reaches back to sequence 1
+func (h *Hub) worldChecksumAt(seqNum uint64) (worldChecksum, bool) {
+	h.checksums.mutex.Lock()
+	defer h.checksums.mutex.Unlock()
+	if cached, ok := h.checksums.checksums[seqNum]; ok {
+		return cached, true
+	}
+	if h.checksums.compute == nil {
+		return worldChecksum{}, false
+	}
+
+	checksum, hashes, err := h.checksums.compute(h.sync.GetOperationsInRange(1, seqNum), signing.ChecksumAlgorithm())
+	if err != nil {
+		return worldChecksum{}, false
+	}
+	if h.checksums.checksums == nil || len(h.checksums.checksums) >= maxCachedChecksums {
+		h.checksums.checksums = make(map[uint64]worldChecksum)
+	}
+	computed := worldChecksum{checksum: checksum, entities: len(hashes)}
+	h.checksums.checksums[seqNum] = computed
+	return computed, true
+}
+
+// entityHashesAt returns the hash of every entity after operation seqNum;
+// they are only needed for resyncs, so they are not cached
+func (h *Hub) entityHashesAt(seqNum uint64) (map[string]string, bool) {
+	h.checksums.mutex.Lock()
+	compute := h.checksums.compute
+	h.checksums.mutex.Unlock()
+	if compute == nil {
+		return nil, false
+	}
+	_, hashes, err := compute(h.sync.GetOperationsInRange(1, seqNum), signing.ChecksumAlgorithm())
+	return hashes, err == nil
+}
+
+// challengeClients broadcasts the current world checksum. With nobody to
+// answer it is skipped, which also leaves a hibernating log unloaded, and
+// so it is when worlds are streamed in chunks, since no client holds the
+// whole world.
+func (h *Hub) challengeClients() {
+	if h.GetClientCount() == 0 || chunks.Enabled() {
+		return
+	}
+	seqNum := h.sync.GetCurrentSequence()
+	current, ok := h.worldChecksumAt(seqNum)
+	if !ok {
+		logging.Debug("consistency check skipped, operation log truncated", map[string]interface{}{
+			"seq_num": seqNum,
+		})
+		return
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":      "checksum_challenge",
+		"seq":       seqNum,
+		"checksum":  current.checksum,
+		"algorithm": signing.ChecksumAlgorithm(),
+		"entities":  current.entities,
+	})
+	h.Broadcast(data)
+}
+
+// verifyChecksum compares a checksum_response with the world at the
+// sequence number the client reached, and resyncs a client that diverged
+func (c *Client) verifyChecksum(msg map[string]interface{}) {
+	seqValue, _ := msg["seq"].(float64)
+	seqNum := uint64(seqValue)
+	checksum, _ := msg["checksum"].(string)
+	if checksum == "" {
+		// The console cannot compute the algorithm, e.g. sha256 outside
+		// a secure context
+		logging.Debug("client skipped checksum challenge", map[string]interface{}{
+			"hd1_id":    c.GetHD1ID(),
+			"algorithm": signing.ChecksumAlgorithm(),
+		})
+		return
+	}
+	currentSeq := c.hub.sync.GetCurrentSequence()
+	if seqNum > currentSeq {
+		seqNum = currentSeq
+	}
+
+	expected, ok := c.hub.worldChecksumAt(seqNum)
+	if !ok || expected.checksum == checksum {
+		return
+	}
+
+	entities, _ := msg["entities"].(float64)
+	logging.Warn("client world state diverged, resyncing", map[string]interface{}{
+		"hd1_id":           c.GetHD1ID(),
+		"remote_ip":        c.remoteIP,
+		"seq_num":          seqNum,
+		"lag":              currentSeq - seqNum,
+		"algorithm":        signing.ChecksumAlgorithm(),
+		"server_checksum":  expected.checksum,
+		"client_checksum":  checksum,
+		"server_entities":  expected.entities,
+		"client_entities":  int(entities),
+		"reported_seq_num": uint64(seqValue),
+	})
+
+	// Without hashes the console falls back to a full resync
+	resync := map[string]interface{}{
+		"type":   "resync",
+		"reason": "checksum_mismatch",
+		"seq":    currentSeq,
+	}
+	if hashes, ok := c.hub.entityHashesAt(currentSeq); ok {
+		resync["hashes"] = hashes
+	}
+	data, _ := json.Marshal(resync)
+	select {
+	case c.send <- data:
+	default:
+		// Client Go channel blocked; the next challenge tries again
+	}
+}
+
+// Warm rebuilds the world at its current sequence number into the checksum
+// cache, so the first consistency check after startup is answered at once.
+// It returns the world's entity count, or false when the log is truncated.
+func (h *Hub) Warm() (int, bool) {
+	current, ok := h.worldChecksumAt(h.sync.GetCurrentSequence())
+	return current.entities, ok
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+	"holodeck1/sync"
+)
+
+// A world with the configured crowd threshold of avatars or more is a
+// crowd. Each client's forwarder then paces the moves of avatars beyond the
+// near distance of its own avatar to the far update rate, and tells its
+// console, which draws those avatars as one instanced mesh when its
+// capability profile allows instancing. A crowd ends below four fifths of
+// the threshold, so one avatar coming and going does not switch modes back
+// and forth.
+
+// CrowdState tells a console whether its world is a crowd
+type CrowdState struct {
+	Active        bool    `json:"active"`
+	Avatars       int     `json:"avatars"`
+	NearDistance  float64 `json:"near_distance"`   // Metres from the client's avatar drawn and moved in full
+	FarUpdateRate int     `json:"far_update_rate"` // Moves a second of avatars further away
+}
+
+// crowdTracker is a forwarder's view of the crowd: whether the world is one
+// and where the client's own avatar stands on the ground plane. It is only
+// used from the client's forwarding goroutine.
+type crowdTracker struct {
+	active bool
+	x, z   float64
+	placed bool
+}
+
+// newCrowdTracker tells the console whether it joined a crowd
+func (c *Client) newCrowdTracker() *crowdTracker {
+	tracker := &crowdTracker{}
+	c.updateCrowd(tracker)
+	return tracker
+}
+
+// followCrowd follows the client's avatar and, as avatars come and go,
+// whether the world is a crowd
+func (c *Client) followCrowd(tracker *crowdTracker, operation *sync.Operation) {
+	switch operation.Type {
+	case sync.OpAvatarCreate, sync.OpAvatarMove, sync.OpAvatarUpdate:
+		if id, _ := operation.Data["hd1_id"].(string); id == c.GetHD1ID() {
+			if x, z, ok := groundPosition(operation.Data["position"]); ok {
+				tracker.x, tracker.z, tracker.placed = x, z, true
+			}
+		}
+	}
+	switch operation.Type {
+	case sync.OpAvatarCreate, sync.OpAvatarRemove, sync.OpAvatarLeave:
+		c.updateCrowd(tracker)
+	}
+}
+
+// updateCrowd tells the console when the world became a crowd or stopped
+// being one
+func (c *Client) updateCrowd(tracker *crowdTracker) {
+	threshold := config.GetCrowdThreshold()
+	avatars := c.hub.sync.AvatarCount()
+	active := tracker.active
+	switch {
+	case threshold <= 0:
+		active = false
+	case avatars >= threshold:
+		active = true
+	case avatars*5 < threshold*4:
+		active = false
+	}
+	if active == tracker.active {
+		return
+	}
+	tracker.active = active
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"type": "crowd",
+		"crowd": CrowdState{
+			Active:        active,
+			Avatars:       avatars,
+			NearDistance:  config.GetCrowdNearDistance(),
+			FarUpdateRate: config.GetCrowdFarUpdateRate(),
+		},
+	})
+	c.hub.mutex.RLock()
+	defer c.hub.mutex.RUnlock()
+	if !c.hub.clients[c] {
+		return
+	}
+	select {
+	case c.send <- data:
+		logging.Debug("crowd state sent to client", map[string]interface{}{
+			"hd1_id":  c.GetHD1ID(),
+			"active":  active,
+			"avatars": avatars,
+		})
+	default:
+		// Client Go channel blocked, don't wait
+	}
+}
+
+// moveInterval is the least time between moves of an operation's avatar
+// sent to the client: its negotiated update interval, or the far update
+// interval for avatars beyond the near distance of a crowd
+func (c *Client) moveInterval(tracker *crowdTracker, operation *sync.Operation) time.Duration {
+	interval := c.Profile().UpdateInterval()
+	if !tracker.active || !tracker.placed || operation.Type != sync.OpAvatarMove {
+		return interval
+	}
+	x, z, ok := groundPosition(operation.Data["position"])
+	if !ok || math.Hypot(x-tracker.x, z-tracker.z) <= config.GetCrowdNearDistance() {
+		return interval
+	}
+	return max(interval, time.Second/time.Duration(config.GetCrowdFarUpdateRate()))
+}
+
+// groundPosition reads x and z of an operation's position, which is a
+// decoded JSON object or, for operations the server made, a struct
+func groundPosition(position interface{}) (x, z float64, ok bool) {
+	if fields, isMap := position.(map[string]interface{}); isMap {
+		x, xOK := fields["x"].(float64)
+		z, zOK := fields["z"].(float64)
+		return x, z, xOK && zOK
+	}
+	if position == nil {
+		return 0, 0, false
+	}
+	var point struct {
+		X *float64 `json:"x"`
+		Z *float64 `json:"z"`
+	}
+	encoded, err := json.Marshal(position)
+	if err != nil || json.Unmarshal(encoded, &point) != nil || point.X == nil || point.Z == nil {
+		return 0, 0, false
+	}
+	return *point.X, *point.Z, true
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/documents"
+	"holodeck1/guests"
+	"holodeck1/logging"
+)
+
+// Shared documents reach consoles as document messages when they are
+// created, changed or deleted, as document_operation messages for each
+// edit, and as document_cursor messages when a session moves its cursor.
+// Consoles send document_cursor messages themselves; edits go through the
+// API.
+
+// maxDocumentCursor bounds a document_cursor message
+const maxDocumentCursor = 512
+
+// PublishDocument tells every client a document was created, updated or
+// deleted; every client is in the served world
+func (h *Hub) PublishDocument(event string, document *documents.Document) {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":     "document",
+		"event":    event,
+		"document": document,
+	})
+	h.Broadcast(data)
+}
+
+// PublishDocumentEdit sends an applied edit to every client, the editor
+// that made it included, which takes it as its acknowledgement
+func (h *Hub) PublishDocumentEdit(edit *documents.Edit) {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type": "document_operation",
+		"edit": edit,
+	})
+	h.Broadcast(data)
+}
+
+func documentCursorMessage(world, documentID, hd1ID string, revision int, cursor *documents.Cursor) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":        "document_cursor",
+		"world":       world,
+		"document_id": documentID,
+		"hd1_id":      hd1ID,
+		"revision":    revision,
+		"cursor":      cursor, // null once the session leaves the document
+	})
+	return data
+}
+
+// handleDocumentCursor places the session's cursor in a document and shows
+// it to everyone else
+func (c *Client) handleDocumentCursor(message []byte) {
+	var msg struct {
+		DocumentID string `json:"document_id"`
+		Revision   int    `json:"revision"`
+		Position   int    `json:"position"`
+		Anchor     *int   `json:"anchor"`
+	}
+	if len(message) > maxDocumentCursor || json.Unmarshal(message, &msg) != nil {
+		return
+	}
+	hd1ID := c.GetHD1ID()
+	if hd1ID == "" || !c.guestAllows(guests.CapabilityEdit) {
+		return
+	}
+	anchor := msg.Position
+	if msg.Anchor != nil {
+		anchor = *msg.Anchor
+	}
+	name := ""
+	if avatar, ok := c.hub.avatarRegistry.GetAvatar(c.GetAvatarID()); ok {
+		name = avatar.Name
+	}
+
+	world := config.GetWorldsDefaultWorld()
+	cursor, revision, err := documents.SetCursor(world, msg.DocumentID, hd1ID, name, msg.Revision, msg.Position, anchor, time.Now())
+	if err != nil {
+		logging.Debug("document cursor dropped", map[string]interface{}{
+			"document_id": msg.DocumentID,
+			"hd1_id":      hd1ID,
+			"error":       err.Error(),
+		})
+		return
+	}
+	c.hub.Broadcast(documentCursorMessage(world, msg.DocumentID, hd1ID, revision, cursor))
+}
+
+// releaseDocumentCursorsLocked removes a departed session's cursors; call
+// it holding the hub's mutex
+func (h *Hub) releaseDocumentCursorsLocked(hd1ID string) {
+	for _, document := range documents.ReleaseSession(hd1ID) {
+		data := documentCursorMessage(document.World, document.ID, hd1ID, document.Revision, nil)
+		for client := range h.clients {
+			select {
+			case client.send <- data:
+			default:
+				// Client Go channel blocked, don't wait
+			}
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+)
+
+// Static assets are served under content-hashed names, such as
+// /static/js/hd1lib.3f9a1c0b7e2d.js, with immutable cache headers: a new
+// build changes the name, so browsers never see stale code. Codegen writes
+// the hashes to the asset manifest; in dev mode the plain names are served
+// uncached instead.
+//
+// The manifest also carries Subresource Integrity hashes. Templates put
+// them on script and link tags, and /api/system/integrity lists them so
+// embedders can check they run the code this build shipped.
+
+// AssetManifestFile is written by codegen into the static directory
+const AssetManifestFile = "asset-manifest.json"
+
+// ImmutableCacheControl is sent with fingerprinted assets
+const ImmutableCacheControl = "public, max-age=31536000, immutable"
+
+// AssetManifest maps static paths, such as js/hd1lib.js, to content hashes
+// and Subresource Integrity values
+type AssetManifest struct {
+	Assets    map[string]string `json:"assets"`
+	Integrity map[string]string `json:"integrity,omitempty"`
+}
+
+// templatedAssets are processed before serving, so their hash covers the
+// processed output
+var templatedAssets = map[string]bool{
+	"js/hd1-console.js": true,
+}
+
+// Fingerprint returns the content hash used in asset names
+func Fingerprint(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// Integrity returns the Subresource Integrity value of content
+func Integrity(content []byte) string {
+	sum := sha512.Sum384(content)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// FingerprintedName inserts a hash before a path's extension
+func FingerprintedName(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+var (
+	assetURLs      = map[string]string{} // /static/js/hd1lib.js -> fingerprinted URL
+	assetOriginals = map[string]string{} // fingerprinted URL -> /static/js/hd1lib.js
+	assetIntegrity = map[string]string{} // /static/js/hd1lib.js -> sha384-...
+)
+
+// loadAssetManifest reads the codegen manifest. Entries whose file changed
+// since codegen ran are skipped, so an edited asset is served uncached
+// under its plain name rather than under a hash it no longer matches.
+func loadAssetManifest(root fs.FS) {
+	if config.GetStaticDevMode() {
+		logging.Info("static dev mode, assets served uncached")
+		return
+	}
+	raw, err := fs.ReadFile(root, "static/"+AssetManifestFile)
+	if err != nil {
+		logging.Warn("no asset manifest, run codegen to fingerprint static assets", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	var manifest AssetManifest
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		logging.Warn("invalid asset manifest", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var stale []string
+	for name, hash := range manifest.Assets {
+		var content []byte
+		if templatedAssets[name] {
+			processed, err := templateProcessor.ProcessTemplate("static/" + name)
+			content = []byte(processed)
+			if err != nil {
+				content = nil
+			}
+		} else {
+			content, _ = fs.ReadFile(root, "static/"+name)
+		}
+		if content == nil || Fingerprint(content) != hash {
+			stale = append(stale, name)
+			continue
+		}
+		url := "/static/" + name
+		assetURLs[url] = "/static/" + FingerprintedName(name, hash)
+		assetOriginals[assetURLs[url]] = url
+		if integrity := manifest.Integrity[name]; integrity != "" && integrity == Integrity(content) {
+			assetIntegrity[url] = integrity
+		}
+	}
+
+	logging.Info("static asset fingerprints loaded", map[string]interface{}{
+		"assets":    len(assetURLs),
+		"integrity": len(assetIntegrity),
+		"stale":     stale,
+	})
+}
+
+// AssetURL returns the URL to reference a static asset by: fingerprinted
+// when the manifest covers it, unchanged otherwise
+func AssetURL(url string) string {
+	if fingerprinted, ok := assetURLs[url]; ok {
+		return fingerprinted
+	}
+	return url
+}
+
+// AssetIntegrity returns the Subresource Integrity value for a static
+// asset URL, or "" when the build did not record one
+func AssetIntegrity(url string) string {
+	return assetIntegrity[url]
+}
+
+// AssetIntegrities returns every static asset URL with its integrity value
+func AssetIntegrities() map[string]string {
+	integrities := make(map[string]string, len(assetIntegrity))
+	for url, integrity := range assetIntegrity {
+		integrities[url] = integrity
+	}
+	return integrities
+}
+
+// ResolveFingerprint maps a fingerprinted URL back to the asset's plain URL
+func ResolveFingerprint(url string) (string, bool) {
+	original, ok := assetOriginals[url]
+	return original, ok
+}
+
+var (
+	assetPlaceholder     = regexp.MustCompile(`\$\{ASSET:([^}]+)\}`)
+	integrityPlaceholder = regexp.MustCompile(`\$\{INTEGRITY:([^}]+)\}`)
+)
+
+// replaceAssetURLs expands ${ASSET:/static/...} placeholders in templates,
+// and ${INTEGRITY:/static/...} to the asset's integrity value; an empty
+// integrity attribute makes browsers skip the check
+func replaceAssetURLs(content string) string {
+	content = assetPlaceholder.ReplaceAllStringFunc(content, func(placeholder string) string {
+		return AssetURL(assetPlaceholder.FindStringSubmatch(placeholder)[1])
+	})
+	return integrityPlaceholder.ReplaceAllStringFunc(content, func(placeholder string) string {
+		return AssetIntegrity(integrityPlaceholder.FindStringSubmatch(placeholder)[1])
+	})
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"holodeck1/config"
+	"holodeck1/guests"
+	"holodeck1/logging"
+	"holodeck1/tokens"
+	"holodeck1/webhooks"
+)
+
+// Guests join through a link carrying ?guest=<token> on /ws. The grant it
+// redeems is bound to the session's HD1 ID, follows it across reconnects,
+// and ends the session when the link expires or is revoked. With
+// guests.require_link set, remote sessions without a link are refused.
+
+// IsOperator reports whether the caller may run moderation and repair
+// actions: local callers, and remote ones with the moderation token as
+// bearer token
+func IsOperator(r *http.Request) bool {
+	if IsLocalRequest(r) {
+		return true
+	}
+	token := config.GetModerationToken()
+	bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token != "" && bearer != "" && subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1
+}
+
+// ReportRefusedOperator raises a security event for a caller refused an
+// operator-only action, when its bearer token is no credential of this
+// server. Session tokens and webhook secrets are sent with calls of their
+// own and are not mistaken for a wrong moderation token, nor is the right
+// one refused under an impersonation.
+func ReportRefusedOperator(r *http.Request) {
+	token := config.GetModerationToken()
+	bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || bearer == "" || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1 {
+		return
+	}
+	if _, err := tokens.Validate(bearer); err == nil || webhooks.IsSecret(bearer) {
+		return
+	}
+	reportSecurity(requestOrg(r), "Wrong moderation token from "+ClientIP(r), r.Method+" "+r.URL.Path, ClientIP(r))
+}
+
+// admitGuest redeems the guest link a connection presents, writing 403 when
+// it is refused. A reconnecting guest passes its session token as
+// ?session= and keeps its grant without using the link again.
+func admitGuest(w http.ResponseWriter, r *http.Request) (*guests.Grant, bool) {
+	query := r.URL.Query()
+	value := query.Get("guest")
+	if value == "" {
+		if config.GetGuestsRequireLink() && !IsOperator(r) {
+			http.Error(w, "This world requires a guest link", http.StatusForbidden)
+			return nil, false
+		}
+		return nil, true
+	}
+
+	if token, err := tokens.Validate(query.Get("session")); err == nil {
+		if grant, ok := guests.Resume(token.HD1ID, value); ok {
+			return grant, true
+		}
+	}
+	grant, err := guests.Redeem(r.Context(), value)
+	if err != nil {
+		logging.Info("guest link refused", map[string]interface{}{
+			"remote_ip": ClientIP(r),
+			"error":     err.Error(),
+		})
+		http.Error(w, "Guest link "+strings.TrimPrefix(err.Error(), "guest link "), http.StatusForbidden)
+		return nil, false
+	}
+	return grant, true
+}
+
+// guestAllows reports whether the client may use a capability; sessions
+// not admitted through a link may use all of them, spectators only view
+func (c *Client) guestAllows(capability string) bool {
+	if c.spectator && capability != guests.CapabilityView {
+		return false
+	}
+	grant := guests.GrantFor(c.GetHD1ID())
+	return grant == nil || grant.Allows(capability)
+}
+
+// EndGuestLink ends the sessions admitted through a link and revokes their
+// tokens, returning how many were connected
+func (h *Hub) EndGuestLink(linkID string) int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	ended := 0
+	for client := range h.clients {
+		if grant := guests.GrantFor(client.GetHD1ID()); grant != nil && grant.LinkID == linkID {
+			tokens.RevokeSession(client.GetHD1ID())
+			client.endSession(RevokedGuestLink)
+			ended++
+		}
+	}
+	return ended
+}
+
+// GuestURL returns the console URL joining through a guest token, on the
+// scheme and host the request reached the server by
+func GuestURL(r *http.Request, token string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" && fromTrustedProxy(r) {
+		scheme = strings.ToLower(strings.TrimSpace(strings.Split(proto, ",")[0]))
+	}
+	return scheme + "://" + r.Host + "/?guest=" + url.QueryEscape(token)
+}
@@ -1,15 +1,18 @@
 package server
 
 import (
+	"io/fs"
 	"net/http"
 	"holodeck1/logging"
 )
 
 var templateProcessor *TemplateProcessor
 
-// InitializeTemplateProcessor sets up the template processor
-func InitializeTemplateProcessor(staticDir string) {
-	templateProcessor = NewTemplateProcessor(staticDir)
+// InitializeTemplateProcessor sets up the template processor and the
+// static asset fingerprints templates refer to
+func InitializeTemplateProcessor(root fs.FS) {
+	templateProcessor = NewTemplateProcessor(root)
+	loadAssetManifest(root)
 }
 
 func ServeHome(w http.ResponseWriter, r *http.Request) {
@@ -43,7 +46,7 @@ func ServeHome(w http.ResponseWriter, r *http.Request) {
 
 // ServeConsoleJS serves the hd1-console.js with template processing
 func ServeConsoleJS(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
+	if r.Method != "GET" && r.Method != "HEAD" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
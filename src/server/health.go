@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+)
+
+// Orchestrators probe /healthz to restart a stuck process and /readyz to
+// route traffic. Before a pod stops, its preStop hook runs `hd1 drain`,
+// which POSTs /drain: readiness fails, so no new sessions arrive, while
+// connected clients finish and move on when they reconnect elsewhere.
+
+var draining, starting atomic.Bool
+
+// Drain stops accepting new sessions; it cannot be undone
+func Drain() {
+	if !draining.Swap(true) {
+		logging.Info("draining, readiness now failing")
+	}
+}
+
+// IsDraining reports whether Drain has been called
+func IsDraining() bool {
+	return draining.Load()
+}
+
+// SetStarting makes readiness fail while startup work, such as lifecycle
+// hooks, is still running
+func SetStarting(pending bool) {
+	starting.Store(pending)
+}
+
+// ServeHealthz handles GET /healthz: the process is alive
+func ServeHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+	})
+}
+
+// ServeReadyz handles GET /readyz: the server accepts new sessions
+func ServeReadyz(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	status, code := "ready", http.StatusOK
+	if IsDraining() {
+		status, code = "draining", http.StatusServiceUnavailable
+	} else if starting.Load() {
+		status, code = "starting", http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  status,
+		"clients": hub.GetClientCount(),
+	})
+}
+
+// IsLocalRequest reports whether a request comes straight from this host:
+// loopback, or a Unix socket when server.socket_operators allows it, and
+// not relayed by a proxy. Anyone in the socket's group can connect to it,
+// so socket peers are not trusted by default.
+func IsLocalRequest(r *http.Request) bool {
+	proxied := r.Header.Get("X-Forwarded-For") != "" || r.Header.Get("Forwarded") != ""
+	ip := peer(r)
+	if ip == nil {
+		return !proxied && config.GetSocketOperators()
+	}
+	return !proxied && ip.IsLoopback()
+}
+
+// ServeDrain handles POST /drain. Only local callers, such as a preStop
+// hook in the same pod, may drain the server; requests relayed by a proxy
+// on the same host carry forwarding headers and are refused.
+func ServeDrain(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !IsLocalRequest(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	Drain()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"status":  "draining",
+		"clients": hub.GetClientCount(),
+	})
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"holodeck1/config"
+	"holodeck1/htdocs"
+)
+
+// Static sources
+const (
+	StaticSourceAuto     = "auto"     // The static directory when it exists, else embedded
+	StaticSourceEmbedded = "embedded" // Assets built into the binary
+	StaticSourceDisk     = "disk"     // The static directory
+)
+
+// OpenHtDocs returns the console's document root, index.html and static/,
+// and where it came from. On disk, the document root is the static
+// directory's parent.
+func OpenHtDocs() (fs.FS, string, error) {
+	staticDir := config.GetStaticDir()
+	source := config.GetStaticSource()
+	auto := source == StaticSourceAuto
+	if auto {
+		source = StaticSourceEmbedded
+		if stat, err := os.Stat(staticDir); err == nil && stat.IsDir() {
+			source = StaticSourceDisk
+		}
+	}
+
+	switch source {
+	case StaticSourceDisk:
+		if stat, err := os.Stat(staticDir); err != nil || !stat.IsDir() {
+			return nil, source, fmt.Errorf("static directory does not exist: %s", staticDir)
+		}
+		return os.DirFS(filepath.Dir(staticDir)), source, nil
+	case StaticSourceEmbedded:
+		root := htdocs.FS()
+		if root == nil && auto {
+			return nil, source, fmt.Errorf("static directory %s does not exist and the binary has no embedded assets (build with make build)", staticDir)
+		} else if root == nil {
+			return nil, source, fmt.Errorf("binary has no embedded assets (build with make build)")
+		}
+		return root, source, nil
+	}
+	return nil, source, fmt.Errorf("unknown static source %q (auto, embedded, disk)", source)
+}
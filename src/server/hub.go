@@ -5,9 +5,19 @@ package server
 import (
 	"context"
 	stdSync "sync"
+	"time"
 
+	"holodeck1/anchors"
+	"holodeck1/config"
+	"holodeck1/entityid"
 	"holodeck1/logging"
+	"holodeck1/movement"
+	"holodeck1/portals"
+	"holodeck1/quality"
+	"holodeck1/screenshare"
+	"holodeck1/spectators"
 	"holodeck1/sync"
+	"holodeck1/throttle"
 )
 
 // Hub represents the TCP-simple WebSocket coordination hub
@@ -24,6 +34,9 @@ type Hub struct {
 	// Avatar management
 	avatarRegistry *AvatarRegistry
 	
+	// World checksums for consistency checks
+	checksums checksumCache
+	
 	// Message routing - REMOVED: Using sync system directly
 }
 
@@ -60,6 +73,19 @@ func (h *Hub) Run(ctx context.Context) {
 		"stateless": true,
 	})
 	
+	sessionSweep := time.NewTicker(sessionSweepInterval())
+	defer sessionSweep.Stop()
+	avatarSweep := time.NewTicker(config.GetAvatarsHealthCheckInterval())
+	defer avatarSweep.Stop()
+	healthCheck := time.NewTicker(config.GetAvatarsHeartbeatFrequency())
+	defer healthCheck.Stop()
+	var consistencyCheck <-chan time.Time
+	if interval := config.GetSyncConsistencyInterval(); interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		consistencyCheck = ticker.C
+	}
+	
 	for {
 		select {
 		case <-ctx.Done():
@@ -70,6 +96,18 @@ func (h *Hub) Run(ctx context.Context) {
 			
 		case client := <-h.unregister:
 			h.unregisterClient(client)
+			
+		case <-sessionSweep.C:
+			h.sweepSessions()
+			
+		case <-avatarSweep.C:
+			h.evictIdleAvatars()
+			
+		case <-healthCheck.C:
+			h.evaluateHealth()
+			
+		case <-consistencyCheck:
+			h.challengeClients()
 		}
 	}
 }
@@ -81,8 +119,14 @@ func (h *Hub) registerClient(client *Client) {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 	
+	if client.refuseBanned() {
+		return
+	}
 	h.clients[client] = true
 	
+	// A hibernating world wakes as a client joins, before it asks for the log
+	h.sync.Wake()
+	
 	// Register client with sync system - SINGLE SOURCE OF TRUTH
 	syncChan := h.sync.RegisterClient(client.GetHD1ID())
 	client.syncChan = syncChan
@@ -93,23 +137,35 @@ func (h *Hub) registerClient(client *Client) {
 	// Send initial sync for existing operations
 	client.sendInitialSync()
 	
-	// Only create avatar if client doesn't already have one (not a reconnection)
-	if client.GetAvatarID() == "" {
+	// Only create avatar if client doesn't already have one (not a
+	// reconnection); spectators watch without one
+	if client.spectator {
+		logging.Info("client registered as spectator with sync channel", map[string]interface{}{
+			"client_count": len(h.clients),
+			"hd1_id":       client.GetClientID(),
+			"remote_ip":    client.remoteIP,
+		})
+		h.reportSessionStartedLocked(client)
+	} else if client.GetAvatarID() == "" {
 		avatar := h.avatarRegistry.CreateAvatar(client)
 		
 		logging.Info("client registered with new avatar and sync channel", map[string]interface{}{
 			"client_count": len(h.clients),
 			"hd1_id":       client.GetClientID(),
+			"remote_ip":    client.remoteIP,
 			"avatar_id":    avatar.ID,
 			"avatar_count": h.avatarRegistry.GetAvatarCount(),
 		})
+		h.reportSessionStartedLocked(client)
 	} else {
 		logging.Info("client registered with existing avatar and sync channel", map[string]interface{}{
 			"client_count": len(h.clients),
 			"hd1_id":       client.GetClientID(),
+			"remote_ip":    client.remoteIP,
 			"avatar_id":    client.GetAvatarID(),
 			"avatar_count": h.avatarRegistry.GetAvatarCount(),
 		})
+		h.reportOccupancyLocked(client.org)
 	}
 }
 
@@ -120,19 +176,58 @@ func (h *Hub) unregisterClient(client *Client) {
 	
 	if _, ok := h.clients[client]; ok {
 		delete(h.clients, client)
+		client.stopAssetStreams()
+		client.stopXRRelay()
 		close(client.send)
 		
 		// Unregister from sync system - SINGLE SOURCE OF TRUTH
 		h.sync.UnregisterClient(client.GetHD1ID())
+		client.releaseSigningKey()
+		
+		// Session-scoped anchors go away with their creator
+		for _, anchor := range anchors.ReleaseSession(client.GetHD1ID()) {
+			h.sync.SubmitOperation(&sync.Operation{
+				ClientID:  client.GetHD1ID(),
+				Type:      sync.OpAnchorDelete,
+				Data:      map[string]interface{}{"id": anchor.ID, "world": anchor.World},
+				Timestamp: time.Now(),
+			})
+		}
+		
+		// Screen shares end with their sharer's connection
+		for _, share := range screenshare.ReleaseSession(client.GetHD1ID()) {
+			h.sync.SubmitOperation(&sync.Operation{
+				ClientID:  client.GetHD1ID(),
+				Type:      sync.OpEntityDelete,
+				Data:      map[string]interface{}{"id": share.EntityID},
+				Timestamp: time.Now(),
+			})
+			entityid.Release(share.EntityID)
+			throttle.Release(share.EntityID)
+		}
 		
-		// Remove avatar when client disconnects
-		if avatarID := client.GetAvatarID(); avatarID != "" {
-			h.avatarRegistry.RemoveAvatar(avatarID)
+		// The avatar leaves with its connection, and the avatars the
+		// session created over the API with its last connection
+		reason := client.leaveReason()
+		if h.avatarRegistry.ReleaseClient(client) {
+			h.sync.UnregisterAvatar(client.GetAvatarID(), reason)
+			movement.Forget(client.GetAvatarID())
+			portals.Forget(client.GetAvatarID())
+		}
+		if !h.hasSessionLocked(client.GetHD1ID()) {
+			h.sync.UnregisterSessionAvatars(client.GetHD1ID(), reason)
+			h.releaseDocumentCursorsLocked(client.GetHD1ID())
+			quality.Forget(client.GetHD1ID())
 		}
+		if client.spectator {
+			spectators.Leave(client.GetHD1ID())
+		}
+		h.reportOccupancyLocked(client.org)
 		
 		logging.Info("client unregistered with avatar cleanup and sync cleanup", map[string]interface{}{
 			"client_count": len(h.clients),
 			"hd1_id":       client.GetClientID(),
+			"remote_ip":    client.remoteIP,
 			"avatar_id":    client.GetAvatarID(),
 			"avatar_count": h.avatarRegistry.GetAvatarCount(),
 		})
@@ -177,6 +272,56 @@ func (h *Hub) GetMissingOperations(from, to uint64) []*sync.Operation {
 	return h.sync.GetOperationsInRange(from, to)
 }
 
+// GetClientCount returns the number of connected clients
+func (h *Hub) GetClientCount() int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.clients)
+}
+
+// IsConnected reports whether a session has a live connection
+func (h *Hub) IsConnected(hd1ID string) bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.hasSessionLocked(hd1ID)
+}
+
+// hasSessionLocked reports whether a session has a live connection;
+// callers hold the mutex
+func (h *Hub) hasSessionLocked(hd1ID string) bool {
+	for client := range h.clients {
+		if client.GetHD1ID() == hd1ID {
+			return true
+		}
+	}
+	return false
+}
+
+// evictIdleAvatars removes avatars of departed sessions once their world's
+// idle timeout has passed
+func (h *Hub) evictIdleAvatars() {
+	h.sync.EvictIdleAvatars(func(world string) time.Duration {
+		if world == "" {
+			world = config.GetWorldsDefaultWorld()
+		}
+		return config.GetAvatarsIdleTimeout(world)
+	}, h.IsConnected)
+}
+
+// Broadcast sends a message to every connected client, skipping clients
+// whose send buffer is full
+func (h *Hub) Broadcast(data []byte) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for client := range h.clients {
+		select {
+		case client.send <- data:
+		default:
+			// Client Go channel blocked, don't wait
+		}
+	}
+}
+
 // GetAvatarRegistry returns the avatar registry
 func (h *Hub) GetAvatarRegistry() *AvatarRegistry {
 	return h.avatarRegistry
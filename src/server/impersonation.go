@@ -0,0 +1,77 @@
+package server
+
+import (
+	"encoding/json"
+	stdSync "sync"
+	"time"
+)
+
+// While support staff act as a session, its consoles show a banner naming
+// who and why, until when. They are sent an impersonation message when it
+// starts and ends, and when they connect while it lasts.
+
+// Impersonation states sent to consoles
+const (
+	ImpersonationStarted = "started"
+	ImpersonationEnded   = "ended"
+)
+
+// ImpersonationNotice is what a session's consoles are told of support
+// staff acting as it
+type ImpersonationNotice struct {
+	ID        string    `json:"id"`
+	Operator  string    `json:"operator"`
+	Reason    string    `json:"reason"`
+	Scope     []string  `json:"scope"`
+	ExpiresAt time.Time `json:"expires_at"`
+	EndedBy   string    `json:"ended_by,omitempty"`
+}
+
+var impersonated = struct {
+	mutex    stdSync.RWMutex
+	sessions map[string]*ImpersonationNotice
+}{sessions: map[string]*ImpersonationNotice{}}
+
+// SetImpersonation tells a session's consoles support staff act as it
+func SetImpersonation(hub *Hub, hd1ID string, notice *ImpersonationNotice) {
+	impersonated.mutex.Lock()
+	impersonated.sessions[hd1ID] = notice
+	impersonated.mutex.Unlock()
+	hub.sendToSession(hd1ID, impersonationMessage(ImpersonationStarted, notice))
+}
+
+// ClearImpersonation tells a session's consoles support staff stopped
+// acting as it
+func ClearImpersonation(hub *Hub, hd1ID string, notice *ImpersonationNotice) {
+	impersonated.mutex.Lock()
+	if current, ok := impersonated.sessions[hd1ID]; ok && current.ID == notice.ID {
+		delete(impersonated.sessions, hd1ID)
+	}
+	impersonated.mutex.Unlock()
+	hub.sendToSession(hd1ID, impersonationMessage(ImpersonationEnded, notice))
+}
+
+func impersonationMessage(state string, notice *ImpersonationNotice) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":          "impersonation",
+		"state":         state,
+		"impersonation": notice,
+	})
+	return data
+}
+
+// sendImpersonationState tells a new client support staff act as its
+// session
+func (c *Client) sendImpersonationState() {
+	impersonated.mutex.RLock()
+	notice, ok := impersonated.sessions[c.GetHD1ID()]
+	impersonated.mutex.RUnlock()
+	if !ok || !time.Now().Before(notice.ExpiresAt) {
+		return
+	}
+	select {
+	case c.send <- impersonationMessage(ImpersonationStarted, notice):
+	default:
+		// Client Go channel blocked, don't wait
+	}
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"encoding/json"
+	stdSync "sync"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+)
+
+// Maintenance mode makes the whole server, or one world, read-only:
+// mutating API calls answer 503 while reads, presence and /ws keep working.
+// Consoles are sent a maintenance message to show as a banner when the
+// switch changes and when they connect.
+
+// MaintenanceState is one read-only switch
+type MaintenanceState struct {
+	Enabled bool       `json:"enabled"`
+	Message string     `json:"message,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+var maintenance = struct {
+	mutex  stdSync.RWMutex
+	server MaintenanceState
+	worlds map[string]MaintenanceState
+}{worlds: map[string]MaintenanceState{}}
+
+// SetMaintenance switches maintenance for the server, or for a world when
+// world is set, and tells connected consoles when their banner changes
+func SetMaintenance(hub *Hub, world string, enabled bool, message string) MaintenanceState {
+	state := MaintenanceState{Enabled: enabled}
+	if enabled {
+		now := time.Now()
+		state.Message, state.Since = message, &now
+	}
+
+	served := config.GetWorldsDefaultWorld()
+	before := MaintenanceFor(served)
+	maintenance.mutex.Lock()
+	if world == "" {
+		maintenance.server = state
+	} else if enabled {
+		maintenance.worlds[world] = state
+	} else {
+		delete(maintenance.worlds, world)
+	}
+	maintenance.mutex.Unlock()
+	if world != "" && !enabled {
+		clearMigration(world)
+	}
+
+	scope := "server"
+	if world != "" {
+		scope = "world"
+	}
+	logging.Info("maintenance mode changed", map[string]interface{}{
+		"scope":   scope,
+		"world":   world,
+		"enabled": enabled,
+		"message": message,
+	})
+
+	// Every client is in the served world
+	if after := MaintenanceFor(served); after.Enabled != before.Enabled || after.Message != before.Message {
+		hub.Broadcast(maintenanceMessage(served, after))
+	}
+	return state
+}
+
+// MaintenanceFor returns the switch in effect for a world: the server's
+// when it is on, otherwise the world's own
+func MaintenanceFor(world string) MaintenanceState {
+	maintenance.mutex.RLock()
+	defer maintenance.mutex.RUnlock()
+	if maintenance.server.Enabled {
+		return maintenance.server
+	}
+	return maintenance.worlds[world]
+}
+
+// MaintenanceStatus returns the server switch and every world in maintenance
+func MaintenanceStatus() (MaintenanceState, map[string]MaintenanceState) {
+	maintenance.mutex.RLock()
+	defer maintenance.mutex.RUnlock()
+	worlds := make(map[string]MaintenanceState, len(maintenance.worlds))
+	for world, state := range maintenance.worlds {
+		worlds[world] = state
+	}
+	return maintenance.server, worlds
+}
+
+func maintenanceMessage(world string, state MaintenanceState) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":    "maintenance",
+		"world":   world,
+		"enabled": state.Enabled,
+		"message": state.Message,
+	})
+	return data
+}
+
+// sendMaintenanceState tells a new client about maintenance in progress
+func (c *Client) sendMaintenanceState() {
+	world := config.GetWorldsDefaultWorld()
+	if state := MaintenanceFor(world); state.Enabled {
+		select {
+		case c.send <- maintenanceMessage(world, state):
+		default:
+			// Client Go channel blocked, don't wait
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	stdSync "sync"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+)
+
+// A world migrated to another server sends its consoles there: they are
+// sent a migrate message to reconnect to the target when the world moves
+// and whenever they connect afterwards. The world stays in maintenance
+// here; switching maintenance off for it serves it here again.
+
+// Migration is where a world moved
+type Migration struct {
+	World   string    `json:"world"`
+	URL     string    `json:"url"` // Where consoles reconnect
+	Message string    `json:"message,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+var migrations = struct {
+	mutex  stdSync.RWMutex
+	worlds map[string]Migration
+}{worlds: map[string]Migration{}}
+
+// SetMigration records that a world moved and sends its consoles to the
+// target
+func SetMigration(hub *Hub, migration Migration) {
+	migration.At = time.Now()
+	migrations.mutex.Lock()
+	migrations.worlds[migration.World] = migration
+	migrations.mutex.Unlock()
+
+	logging.Info("world migrated, redirecting clients", map[string]interface{}{
+		"world":   migration.World,
+		"url":     migration.URL,
+		"clients": hub.GetClientCount(),
+	})
+
+	// Every client is in the served world
+	if migration.World == config.GetWorldsDefaultWorld() {
+		hub.Broadcast(migrationMessage(migration))
+	}
+}
+
+// MigrationFor returns where a world moved, and whether it did
+func MigrationFor(world string) (Migration, bool) {
+	migrations.mutex.RLock()
+	defer migrations.mutex.RUnlock()
+	migration, ok := migrations.worlds[world]
+	return migration, ok
+}
+
+// clearMigration serves a world here again
+func clearMigration(world string) {
+	migrations.mutex.Lock()
+	_, moved := migrations.worlds[world]
+	delete(migrations.worlds, world)
+	migrations.mutex.Unlock()
+	if moved {
+		logging.Info("world served here again after migration", map[string]interface{}{
+			"world": world,
+		})
+	}
+}
+
+func migrationMessage(migration Migration) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":    "migrate",
+		"world":   migration.World,
+		"url":     migration.URL,
+		"message": migration.Message,
+	})
+	return data
+}
+
+// sendMigrationState sends a new client on to the server its world moved
+// to
+func (c *Client) sendMigrationState() {
+	if migration, ok := MigrationFor(config.GetWorldsDefaultWorld()); ok {
+		select {
+		case c.send <- migrationMessage(migration):
+		default:
+			// Client Go channel blocked, don't wait
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"holodeck1/config"
+	"holodeck1/logging"
+	"holodeck1/moderation"
+)
+
+// Moderation is enforced by the hub: banned addresses are refused at /ws,
+// banned sessions on registration, and muted sessions' captions are not
+// relayed. Sessions a moderator acts on are sent a moderation message;
+// kicked and banned ones are then disconnected.
+
+// kickGrace lets the moderation message reach a client before its
+// connection closes
+const kickGrace = time.Second
+
+// ModerationEvent tells a client a moderator acted on its session
+type ModerationEvent struct {
+	Action    string     `json:"action"`
+	Reason    string     `json:"reason,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func moderationMessage(event ModerationEvent) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":       "moderation",
+		"world":      config.GetWorldsDefaultWorld(),
+		"action":     event.Action,
+		"reason":     event.Reason,
+		"expires_at": event.ExpiresAt,
+	})
+	return data
+}
+
+// Moderate sends an event to every session match selects, by HD1 ID and
+// remote address, and disconnects them for kicks and bans. It returns the
+// number of sessions affected.
+func (h *Hub) Moderate(match func(hd1ID, ip string) bool, event ModerationEvent) int {
+	data := moderationMessage(event)
+	disconnect := event.Action == moderation.ActionKick || event.Action == moderation.ActionBan
+
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	affected := 0
+	for client := range h.clients {
+		if !match(client.GetHD1ID(), client.remoteIP) {
+			continue
+		}
+		affected++
+		if disconnect {
+			client.disconnect(data, "moderation")
+			continue
+		}
+		select {
+		case client.send <- data:
+		default:
+			// Client Go channel blocked, don't wait
+		}
+	}
+	return affected
+}
+
+// disconnect queues a final message, then closes the connection with a
+// policy violation; the read pump unregisters the client as for any other
+// disconnect
+func (c *Client) disconnect(data []byte, reason string) {
+	select {
+	case c.send <- data:
+	default:
+		// Client Go channel blocked, close regardless
+	}
+	time.AfterFunc(kickGrace, func() {
+		c.conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason),
+			time.Now().Add(getWriteWait()))
+		c.conn.Close()
+	})
+}
+
+// refuseBanned disconnects a client a ban covers, reporting whether it did
+func (c *Client) refuseBanned() bool {
+	ban := moderation.Banned(config.GetWorldsDefaultWorld(), c.GetHD1ID(), c.remoteIP)
+	if ban == nil {
+		return false
+	}
+	logging.Info("banned client refused", map[string]interface{}{
+		"hd1_id":    c.GetHD1ID(),
+		"remote_ip": c.remoteIP,
+		"ban_id":    ban.ID,
+	})
+	reportSecurity(c.org, "Banned session "+c.GetHD1ID()+" tried to rejoin", ban.Reason, ban.ID)
+	c.disconnect(moderationMessage(ModerationEvent{
+		Action:    moderation.ActionBan,
+		Reason:    ban.Reason,
+		ExpiresAt: ban.ExpiresAt,
+	}), "moderation")
+	return true
+}
+
+// screenText runs text the client sent through its organization's content
+// policy, returning the text to use, or false when rejected. A rejection is
+// reported back to the client when notify is set.
+func (c *Client) screenText(kind, text string, notify bool) (string, bool) {
+	verdict := moderation.Screen(context.Background(), moderation.Content{
+		Kind:  kind,
+		Org:   c.org,
+		World: config.GetWorldsDefaultWorld(),
+		HD1ID: c.GetHD1ID(),
+		Text:  text,
+	})
+	if verdict.Action != moderation.Reject {
+		return verdict.Text, true
+	}
+	if notify {
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":   "content_rejected",
+			"kind":   kind,
+			"reason": verdict.Reason,
+		})
+		select {
+		case c.send <- data:
+		default:
+			// Client Go channel blocked, don't wait
+		}
+	}
+	return "", false
+}
+
+// muted reports whether a moderator silenced the client
+func (c *Client) muted() bool {
+	return moderation.Muted(config.GetWorldsDefaultWorld(), c.GetHD1ID()) != nil
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"encoding/json"
+
+	"holodeck1/config"
+	"holodeck1/polls"
+)
+
+// Poll tallies are pushed to consoles as poll messages whenever a poll is
+// created, voted in or closed, and the open polls are sent to consoles when
+// they connect.
+
+func pollMessage(tally *polls.Tally) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type": "poll",
+		"poll": tally,
+	})
+	return data
+}
+
+// PublishPoll sends a poll's current tallies to every client; every client
+// is in the served world
+func (h *Hub) PublishPoll(tally *polls.Tally) {
+	h.Broadcast(pollMessage(tally))
+}
+
+// sendOpenPolls tells a new client about the polls it can vote in
+func (c *Client) sendOpenPolls() {
+	for _, tally := range polls.List(config.GetWorldsDefaultWorld()) {
+		if tally.Status != polls.StatusOpen {
+			continue
+		}
+		select {
+		case c.send <- pollMessage(tally):
+		default:
+			// Client Go channel blocked, don't wait
+		}
+	}
+}
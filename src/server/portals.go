@@ -0,0 +1,44 @@
+package server
+
+import (
+	"encoding/json"
+
+	"holodeck1/portals"
+)
+
+// PortalTransfer tells a session's consoles where a portal carried it:
+// within the world, to a position the camera moves to, or to another
+// server's world, by a link the console follows
+type PortalTransfer struct {
+	Portal   string            `json:"portal"` // Entity stepped into
+	World    string            `json:"world"`
+	Label    string            `json:"label,omitempty"`
+	URL      string            `json:"url,omitempty"`
+	Position *portals.Position `json:"position,omitempty"`
+	Yaw      float64           `json:"yaw"`
+	Pitch    float64           `json:"pitch"`
+	Error    string            `json:"error,omitempty"` // Why the transfer failed
+}
+
+// SendPortalTransfer sends a transfer to a session's consoles
+func (h *Hub) SendPortalTransfer(hd1ID string, transfer *PortalTransfer) {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":     "portal_transfer",
+		"transfer": transfer,
+	})
+	h.sendToSession(hd1ID, data)
+}
+
+// PublishPortal tells every client an avatar departed through a portal to
+// another server's world, or is expected or arrived from one. The ticket
+// and link stay with the session they were made for.
+func (h *Hub) PublishPortal(event string, arrival *portals.Arrival) {
+	public := *arrival
+	public.Ticket, public.Link = "", ""
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":    "portal",
+		"event":   event,
+		"arrival": &public,
+	})
+	h.Broadcast(data)
+}
@@ -0,0 +1,265 @@
+package server
+
+import (
+	"encoding/json"
+	"math"
+	stdSync "sync"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+)
+
+// Consoles send a heartbeat every heartbeat_ms, as client_init tells them,
+// with their round trip, frame rate and whether their tab is hidden. The
+// hub scores each client from how regularly its heartbeats arrive and what
+// they report, every heartbeat interval: healthy, degraded, or stale once
+// none arrived for --session-stale-after. Clients stale past
+// --session-deactivate-after are disconnected. Changes of state are
+// presence events, sent to the organization's consoles and kept for the
+// presence API. Clients that never sent a heartbeat, such as scripts, are
+// not scored.
+
+// Health states of a client
+const (
+	HealthUnknown     = "unknown" // No heartbeat yet
+	HealthHealthy     = "healthy"
+	HealthDegraded    = "degraded"
+	HealthStale       = "stale"
+	HealthDeactivated = "deactivated"
+)
+
+// RevokedUnresponsive is given in session_revoked to clients disconnected
+// for sending no heartbeat
+const RevokedUnresponsive = "unresponsive"
+
+// healthyScore is the lowest score of a healthy client
+const healthyScore = 70
+
+// presenceEvents bounds the presence events kept for the presence API
+const presenceEvents = 256
+
+// Health is how a client's heartbeats look
+type Health struct {
+	HD1ID         string     `json:"hd1_id"`
+	Org           string     `json:"org"`
+	State         string     `json:"state"`
+	Score         int        `json:"score"` // 0-100
+	LastHeartbeat *time.Time `json:"last_heartbeat,omitempty"`
+	IntervalMS    float64    `json:"interval_ms"` // Mean time between heartbeats
+	RTTMS         float64    `json:"rtt_ms"`      // Round trip the console measured
+	FPS           float64    `json:"fps"`         // Frames rendered per second
+	Hidden        bool       `json:"hidden"`      // Tab in the background
+}
+
+// PresenceEvent is a client changing health state
+type PresenceEvent struct {
+	Seq      uint64    `json:"seq"`
+	HD1ID    string    `json:"hd1_id"`
+	Org      string    `json:"org"`
+	State    string    `json:"state"`
+	Previous string    `json:"previous"`
+	Score    int       `json:"score"`
+	At       time.Time `json:"at"`
+}
+
+// heartbeatState is what a client's heartbeats added up to
+type heartbeatState struct {
+	mutex    stdSync.Mutex
+	last     time.Time
+	interval float64 // Moving average, milliseconds
+	rtt, fps float64
+	hidden   bool
+	state    string
+	score    int
+}
+
+// presenceLog keeps the latest presence events
+type presenceLog struct {
+	mutex  stdSync.Mutex
+	seq    uint64
+	events []PresenceEvent
+}
+
+var presence presenceLog
+
+// recordHeartbeat takes a heartbeat's metrics
+func (c *Client) recordHeartbeat(msg map[string]interface{}) {
+	now := time.Now()
+	h := &c.heartbeat
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if !h.last.IsZero() {
+		ms := float64(now.Sub(h.last)) / float64(time.Millisecond)
+		if h.interval == 0 {
+			h.interval = ms
+		} else {
+			h.interval = 0.7*h.interval + 0.3*ms
+		}
+	}
+	h.last = now
+	h.rtt, _ = msg["rtt_ms"].(float64)
+	h.fps, _ = msg["fps"].(float64)
+	h.hidden, _ = msg["hidden"].(bool)
+}
+
+// scoreAt rates a client's heartbeats at a time: late heartbeats cost up to
+// half the score, irregular ones, slow round trips and low frame rates the
+// rest
+func (h *heartbeatState) scoreAt(now time.Time) (int, string) {
+	expected := config.GetAvatarsHeartbeatFrequency()
+	stale := config.GetSessionStaleAfter()
+	age := now.Sub(h.last)
+	if age >= stale {
+		return 0, HealthStale
+	}
+
+	score := 100.0
+	if age > expected {
+		score -= 50 * float64(age-expected) / float64(stale-expected)
+	}
+	if ms := float64(expected) / float64(time.Millisecond); h.interval > ms {
+		score -= math.Min(20, 20*(h.interval/ms-1))
+	}
+	if h.rtt > 150 {
+		score -= math.Min(15, 15*(h.rtt-150)/850)
+	}
+	if h.fps > 0 && h.fps < 30 && !h.hidden {
+		score -= 15 * (30 - h.fps) / 30
+	}
+	result := int(math.Round(math.Max(0, score)))
+	if result >= healthyScore {
+		return result, HealthHealthy
+	}
+	return result, HealthDegraded
+}
+
+// health reports a client's heartbeats as last scored
+func (c *Client) health() Health {
+	h := &c.heartbeat
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	health := Health{
+		HD1ID:      c.GetHD1ID(),
+		Org:        c.org,
+		State:      HealthUnknown,
+		Score:      h.score,
+		IntervalMS: math.Round(h.interval),
+		RTTMS:      h.rtt,
+		FPS:        h.fps,
+		Hidden:     h.hidden,
+	}
+	if !h.last.IsZero() {
+		health.State = h.state
+		last := h.last.UTC()
+		health.LastHeartbeat = &last
+	}
+	return health
+}
+
+// evaluateHealth scores every client that sends heartbeats, publishing
+// changes of state and disconnecting clients stale for too long
+func (h *Hub) evaluateHealth() {
+	now := time.Now()
+	deactivate := config.GetSessionDeactivateAfter()
+
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for client := range h.clients {
+		beat := &client.heartbeat
+		beat.mutex.Lock()
+		if beat.last.IsZero() {
+			beat.mutex.Unlock()
+			continue
+		}
+		score, state := beat.scoreAt(now)
+		if deactivate > 0 && now.Sub(beat.last) >= deactivate {
+			state = HealthDeactivated
+		}
+		previous := beat.state
+		beat.score, beat.state = score, state
+		beat.mutex.Unlock()
+
+		if state == previous {
+			continue
+		}
+		h.publishPresenceLocked(client, state, previous, score, now)
+		if state == HealthDeactivated {
+			client.endSession(RevokedUnresponsive)
+		}
+	}
+}
+
+// publishPresenceLocked records a change of state and sends it to the
+// organization's consoles; the caller holds the hub mutex
+func (h *Hub) publishPresenceLocked(client *Client, state, previous string, score int, at time.Time) {
+	if previous == "" {
+		previous = HealthUnknown
+	}
+	presence.mutex.Lock()
+	presence.seq++
+	event := PresenceEvent{
+		Seq:      presence.seq,
+		HD1ID:    client.GetHD1ID(),
+		Org:      client.org,
+		State:    state,
+		Previous: previous,
+		Score:    score,
+		At:       at.UTC(),
+	}
+	presence.events = append(presence.events, event)
+	if len(presence.events) > presenceEvents {
+		presence.events = presence.events[len(presence.events)-presenceEvents:]
+	}
+	presence.mutex.Unlock()
+
+	if state != HealthHealthy {
+		logging.Info("client health changed", map[string]interface{}{
+			"hd1_id":   event.HD1ID,
+			"state":    state,
+			"previous": previous,
+			"score":    score,
+		})
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"type":  "presence",
+		"event": event,
+	})
+	if err != nil {
+		return
+	}
+	for other := range h.clients {
+		if other.org != client.org || other == client {
+			continue
+		}
+		select {
+		case other.send <- data:
+		default:
+			// Client Go channel blocked, don't wait
+		}
+	}
+}
+
+// Presence returns the health of an organization's connected clients, the
+// organization's presence events after since, and the latest event's
+// sequence number
+func (h *Hub) Presence(org string, since uint64) ([]Health, []PresenceEvent, uint64) {
+	h.mutex.RLock()
+	clients := []Health{}
+	for client := range h.clients {
+		if client.org == org {
+			clients = append(clients, client.health())
+		}
+	}
+	h.mutex.RUnlock()
+
+	presence.mutex.Lock()
+	defer presence.mutex.Unlock()
+	events := []PresenceEvent{}
+	for _, event := range presence.events {
+		if event.Seq > since && event.Org == org {
+			events = append(events, event)
+		}
+	}
+	return clients, events, presence.seq
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	stdSync "sync"
+
+	"holodeck1/config"
+)
+
+// Behind a load balancer every connection comes from the proxy, and the
+// client's address travels in X-Forwarded-For. The header is only believed
+// from configured trusted proxies: anyone else could write anything in it.
+
+var (
+	trustedOnce     stdSync.Once
+	trustedNetworks []*net.IPNet
+	trustUnix       bool
+)
+
+func loadTrustedProxies() {
+	for _, proxy := range config.GetTrustedProxies() {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "unix" {
+			trustUnix = true
+			continue
+		}
+		if ip := net.ParseIP(proxy); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			trustedNetworks = append(trustedNetworks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			trustedNetworks = append(trustedNetworks, network)
+		}
+	}
+}
+
+func isTrustedIP(ip net.IP) bool {
+	trustedOnce.Do(loadTrustedProxies)
+	for _, network := range trustedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// peer returns the connection's remote IP; nil for Unix socket peers,
+// which have no address
+func peer(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+// fromTrustedProxy reports whether the request came through a trusted proxy
+func fromTrustedProxy(r *http.Request) bool {
+	ip := peer(r)
+	if ip == nil {
+		trustedOnce.Do(loadTrustedProxies)
+		return trustUnix
+	}
+	return isTrustedIP(ip)
+}
+
+// ClientIP returns the address of the client behind any trusted proxies.
+// X-Forwarded-For is walked from the right, skipping trusted hops, so
+// entries a client prepended itself are never reached.
+func ClientIP(r *http.Request) string {
+	ip := peer(r)
+	client := "unix"
+	if ip != nil {
+		client = ip.String()
+	}
+	if !fromTrustedProxy(r) {
+		return client
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	if len(hops) == 0 {
+		if realIP := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); realIP != nil {
+			return realIP.String()
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		client = hop.String()
+		if !isTrustedIP(hop) {
+			break
+		}
+	}
+	return client
+}
+
+// checkOrigin protects /ws from cross-site WebSocket hijacking: a browser
+// page may only connect from the server's own origin or an allowed one.
+// Requests without an Origin header come from non-browser clients.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+
+	if strings.EqualFold(parsed.Host, r.Host) {
+		return true
+	}
+	if forwardedHost := r.Header.Get("X-Forwarded-Host"); forwardedHost != "" && fromTrustedProxy(r) {
+		forwardedHost = strings.TrimSpace(strings.Split(forwardedHost, ",")[0])
+		if strings.EqualFold(parsed.Host, forwardedHost) {
+			return true
+		}
+	}
+
+	for _, allowed := range config.GetWebSocketAllowedOrigins() {
+		allowed = strings.TrimSuffix(strings.TrimSpace(allowed), "/")
+		switch {
+		case allowed == "*":
+			return true
+		case strings.EqualFold(allowed, origin):
+			return true
+		case strings.Contains(allowed, "://*."):
+			// https://*.example.com allows any subdomain over that scheme
+			scheme, domain, _ := strings.Cut(allowed, "://*")
+			if strings.EqualFold(parsed.Scheme, scheme) && strings.HasSuffix(strings.ToLower(parsed.Host), strings.ToLower(domain)) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"encoding/json"
+
+	"holodeck1/quality"
+)
+
+func qualityMessage(directive *quality.Directive) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":      "quality",
+		"directive": directive,
+	})
+	return data
+}
+
+// SendQualityDirective tells a session's consoles how much to render
+func (h *Hub) SendQualityDirective(hd1ID string, directive *quality.Directive) {
+	h.sendToSession(hd1ID, qualityMessage(directive))
+}
+
+// sendQualityDirective tells a resumed console the quality its session was
+// stepped down to
+func (c *Client) sendQualityDirective() {
+	if directive, degraded := quality.Current(c.GetHD1ID()); degraded {
+		select {
+		case c.send <- qualityMessage(directive):
+		default:
+			// Client Go channel blocked, don't wait
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"holodeck1/logging"
+	"holodeck1/quotas"
+)
+
+// Connections are held to the WebSocket quotas of their organization's
+// plan: how many sessions it may have connected, and how many messages
+// each connection may send. Messages past the quota are dropped and the
+// console is told, at most once a second. Operators are not held to
+// quotas.
+
+// OrgSessions counts an organization's connected sessions
+func (h *Hub) OrgSessions(org string) int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.orgSessionsLocked(org)
+}
+
+// admitQuota refuses connections once the organization has its plan's
+// sessions connected, writing 429
+func admitQuota(w http.ResponseWriter, r *http.Request, hub *Hub) bool {
+	if IsOperator(r) {
+		return true
+	}
+	org := requestOrg(r)
+	plan, _ := quotas.PlanFor(org)
+	if plan.Connections == 0 || hub.OrgSessions(org) < plan.Connections {
+		return true
+	}
+	logging.Info("connection refused over session quota", map[string]interface{}{
+		"org":         org,
+		"plan":        plan.Name,
+		"connections": plan.Connections,
+		"remote_ip":   ClientIP(r),
+	})
+	http.Error(w, "Organization session quota reached", http.StatusTooManyRequests)
+	return false
+}
+
+// allowMessage spends one message of the connection's quota
+func (c *Client) allowMessage() bool {
+	if c.limiter == nil {
+		return true
+	}
+	ok, wait := c.limiter.Allow()
+	if ok {
+		return true
+	}
+	if now := time.Now(); now.Sub(c.limitedAt) >= time.Second {
+		c.limitedAt = now
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":           "rate_limited",
+			"retry_after_ms": wait.Milliseconds(),
+		})
+		select {
+		case c.send <- data:
+		default:
+			// Client Go channel blocked, don't wait
+		}
+	}
+	return false
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"encoding/json"
+	stdSync "sync"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/guests"
+	"holodeck1/logging"
+	"holodeck1/signing"
+	"holodeck1/sync"
+	"holodeck1/tokens"
+)
+
+// Every connection carries its session's current token. The hub sweeps
+// sessions periodically: tokens close to expiry are rotated and pushed to
+// the client as session_token, and connections whose session has no valid
+// token left, or that sent nothing but pings for the inactivity timeout,
+// are sent session_revoked and closed.
+
+// Reasons given in session_revoked
+const (
+	RevokedExplicitly = "revoked"
+	RevokedInactive   = "inactive"
+	RevokedGuestLink  = "guest_link" // The link a guest joined through expired or was revoked
+)
+
+type sessionState struct {
+	mutex      stdSync.Mutex
+	token      string
+	expiresAt  time.Time
+	lastActive time.Time
+	ended      bool
+	signingKey string // Key the session signs deltas with, when they are signed
+}
+
+// sessionSweepInterval leaves room for several sweeps before a token expires
+func sessionSweepInterval() time.Duration {
+	interval := config.GetSessionCleanupInterval()
+	if quarter := config.GetSessionTokenTTL() / 4; interval <= 0 || quarter < interval {
+		interval = quarter
+	}
+	return interval
+}
+
+// touch records activity other than keepalives
+func (c *Client) touch() {
+	c.session.mutex.Lock()
+	c.session.lastActive = time.Now()
+	c.session.mutex.Unlock()
+}
+
+// issueToken gives the connection's session a new token and returns the
+// fields client_init and client_reconnect_success carry it in, with the
+// session's signing key
+func (c *Client) issueToken() map[string]interface{} {
+	token, err := tokens.Issue(c.GetHD1ID(), c.org)
+	if err != nil {
+		logging.Error("failed to issue session token", map[string]interface{}{
+			"hd1_id": c.GetHD1ID(),
+			"error":  err.Error(),
+		})
+		return map[string]interface{}{}
+	}
+	return c.issueSigningKey(c.useToken(token))
+}
+
+// useToken makes token the connection's current one and returns the
+// message fields that carry it
+func (c *Client) useToken(token *tokens.Token) map[string]interface{} {
+	c.session.mutex.Lock()
+	c.session.token = token.Value
+	c.session.expiresAt = token.ExpiresAt
+	c.session.mutex.Unlock()
+	return map[string]interface{}{
+		"token":            token.Value,
+		"token_expires_at": token.ExpiresAt,
+	}
+}
+
+// resumeToken rotates the token a reconnecting client presented, so the
+// one it sent over the new connection is retired
+func (c *Client) resumeToken(value string) map[string]interface{} {
+	token, err := tokens.Rotate(value)
+	if err != nil {
+		return c.issueToken()
+	}
+	return c.issueSigningKey(c.useToken(token))
+}
+
+// issueSigningKey gives the session a new key to sign deltas with, when
+// they are signed, and adds it to message
+func (c *Client) issueSigningKey(message map[string]interface{}) map[string]interface{} {
+	if !signing.Enabled() {
+		return message
+	}
+	key, err := signing.Issue(c.GetHD1ID())
+	if err != nil {
+		logging.Error("failed to issue signing key", map[string]interface{}{
+			"hd1_id": c.GetHD1ID(),
+			"error":  err.Error(),
+		})
+		return message
+	}
+	c.session.mutex.Lock()
+	c.session.signingKey = key
+	c.session.mutex.Unlock()
+	message["signing_key"] = key
+	return message
+}
+
+// releaseSigningKey forgets the connection's signing key, unless a newer
+// connection of the session replaced it
+func (c *Client) releaseSigningKey() {
+	c.session.mutex.Lock()
+	key := c.session.signingKey
+	c.session.mutex.Unlock()
+	if key != "" {
+		signing.Release(c.GetHD1ID(), key)
+	}
+}
+
+// rotateToken replaces a token close to expiry, or one rotated over HTTP,
+// and pushes the new one to the client
+func (c *Client) rotateToken(current string) {
+	// The old token is retired on rotation, so only rotate when the new
+	// one can be delivered
+	if len(c.send) == cap(c.send) {
+		return
+	}
+	token, err := tokens.Rotate(current)
+	if err != nil {
+		token, err = tokens.Issue(c.GetHD1ID(), c.org)
+	}
+	if err != nil {
+		logging.Error("failed to rotate session token", map[string]interface{}{
+			"hd1_id": c.GetHD1ID(),
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	message := c.useToken(token)
+	message["type"] = "session_token"
+	data, _ := json.Marshal(message)
+	select {
+	case c.send <- data:
+	default:
+		// Client Go channel blocked; the old token still works for the
+		// rotation grace period
+	}
+}
+
+// endSession tells the client why its session ended and closes the
+// connection, once
+func (c *Client) endSession(reason string) {
+	c.session.mutex.Lock()
+	ended := c.session.ended
+	c.session.ended = true
+	c.session.mutex.Unlock()
+	if ended {
+		return
+	}
+
+	logging.Info("session ended", map[string]interface{}{
+		"hd1_id":    c.GetHD1ID(),
+		"remote_ip": c.remoteIP,
+		"reason":    reason,
+	})
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":   "session_revoked",
+		"reason": reason,
+	})
+	c.disconnect(data, "session "+reason)
+}
+
+// leaveReason tells other clients why the connection's avatar left
+func (c *Client) leaveReason() string {
+	c.session.mutex.Lock()
+	defer c.session.mutex.Unlock()
+	if c.session.ended {
+		return sync.LeaveSessionEnded
+	}
+	return sync.LeaveDisconnected
+}
+
+// sweepSessions rotates, expires and revokes session tokens
+func (h *Hub) sweepSessions() {
+	now := time.Now()
+	ttl := config.GetSessionTokenTTL()
+	inactivity := config.GetSessionInactivityTimeout()
+
+	// Grants of sessions that can no longer resume are dropped
+	guests.Prune(tokens.Active)
+
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for client := range h.clients {
+		client.session.mutex.Lock()
+		current, expiresAt, lastActive := client.session.token, client.session.expiresAt, client.session.lastActive
+		client.session.mutex.Unlock()
+		if current == "" {
+			continue
+		}
+
+		hd1ID := client.GetHD1ID()
+		if !tokens.Active(hd1ID) {
+			client.endSession(RevokedExplicitly)
+			continue
+		}
+		if grant := guests.GrantFor(hd1ID); grant != nil && !guests.Valid(grant) {
+			tokens.RevokeSession(hd1ID)
+			client.endSession(RevokedGuestLink)
+			continue
+		}
+		if inactivity > 0 && now.Sub(lastActive) >= inactivity {
+			tokens.RevokeSession(hd1ID)
+			client.endSession(RevokedInactive)
+			continue
+		}
+		if _, err := tokens.Validate(current); err != nil || expiresAt.Sub(now) < ttl/3 {
+			client.rotateToken(current)
+		}
+	}
+}
+
+// RevokeSession revokes every token of a session and closes its
+// connections, returning how many were closed
+func (h *Hub) RevokeSession(hd1ID string) int {
+	tokens.RevokeSession(hd1ID)
+
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	closed := 0
+	for client := range h.clients {
+		if client.GetHD1ID() == hd1ID {
+			client.endSession(RevokedExplicitly)
+			closed++
+		}
+	}
+	return closed
+}
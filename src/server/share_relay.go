@@ -0,0 +1,76 @@
+package server
+
+import (
+	"encoding/json"
+
+	"holodeck1/logging"
+	"holodeck1/screenshare"
+)
+
+// Screen share signaling.
+//
+// Viewers open a WebRTC peer connection to the sharer; the hub relays the
+// offers, answers and ICE candidates between them without reading them:
+//
+//	→ share_signal {share_id, to?, signal}
+//	← share_signal {share_id, from, signal}
+//
+// A viewer's signals go to the sharer; the sharer names the viewer it
+// answers with to. Signals for shares that ended are dropped.
+
+// maxShareSignal bounds a relayed signal; SDP offers run to a few KB
+const maxShareSignal = 64 * 1024
+
+// handleShareSignal relays a signal between a share's sharer and a viewer
+func (c *Client) handleShareSignal(message []byte) {
+	var msg struct {
+		ShareID string          `json:"share_id"`
+		To      string          `json:"to"`
+		Signal  json.RawMessage `json:"signal"`
+	}
+	if len(message) > maxShareSignal || json.Unmarshal(message, &msg) != nil || len(msg.Signal) == 0 {
+		return
+	}
+	share, err := screenshare.Get(msg.ShareID)
+	if err != nil {
+		logging.Debug("signal for unknown screen share dropped", map[string]interface{}{
+			"share_id": msg.ShareID,
+			"hd1_id":   c.GetHD1ID(),
+		})
+		return
+	}
+
+	from := c.GetHD1ID()
+	to := share.HD1ID
+	if from == share.HD1ID {
+		if msg.To == "" || msg.To == from {
+			return
+		}
+		to = msg.To
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":     "share_signal",
+		"share_id": share.ID,
+		"from":     from,
+		"signal":   msg.Signal,
+	})
+	c.hub.sendToSession(to, data)
+}
+
+// sendToSession sends a message to every connection of a session,
+// skipping connections whose send buffer is full
+func (h *Hub) sendToSession(hd1ID string, data []byte) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for client := range h.clients {
+		if client.GetHD1ID() != hd1ID {
+			continue
+		}
+		select {
+		case client.send <- data:
+		default:
+			// Client Go channel blocked, don't wait
+		}
+	}
+}
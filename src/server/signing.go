@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+
+	"holodeck1/logging"
+	"holodeck1/signing"
+)
+
+// With signed deltas, the avatar deltas a session sends over its WebSocket
+// are signed like its API calls, in an envelope:
+//
+//	→ signed {message: "<the delta as JSON>", nonce, signature: "<hex HMAC>"}
+//
+// The signature is the session's, of signing.Message("WS", "/ws", nonce,
+// message), and the nonce is drawn from the same count as its calls'.
+// Unsigned deltas, envelopes whose signature does not match and replayed
+// ones are dropped.
+
+// signedMessages are the message types that must arrive signed
+var signedMessages = map[string]bool{
+	"xr_pose": true,
+	"xr_ik":   true,
+}
+
+// handleSignedMessage verifies a signed envelope, uses its nonce and
+// handles the message it carries
+func (c *Client) handleSignedMessage(message []byte) {
+	var envelope struct {
+		Message   string `json:"message"`
+		Nonce     uint64 `json:"nonce"`
+		Signature string `json:"signature"`
+	}
+	if err := json.Unmarshal(message, &envelope); err != nil {
+		return
+	}
+	if err := signing.Verify(c.GetHD1ID(), signing.Message("WS", "/ws", envelope.Nonce, []byte(envelope.Message)), envelope.Signature); err != nil {
+		c.refuseSigned("signed message refused, signature not verified", err)
+		return
+	}
+	if err := signing.Accept(c.GetHD1ID(), envelope.Nonce); err != nil {
+		c.refuseSigned("signed message refused, nonce not accepted", err)
+		return
+	}
+	message = []byte(envelope.Message)
+
+	var inner struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(message, &inner); err != nil {
+		return
+	}
+	switch inner.Type {
+	case "xr_pose":
+		c.handlePoseMessage(message)
+	case "xr_ik":
+		c.handleIKMessage(message)
+	default:
+		c.handleClientMessage(message)
+	}
+}
+
+func (c *Client) refuseSigned(message string, err error) {
+	logging.Warn(message, map[string]interface{}{
+		"hd1_id":    c.GetHD1ID(),
+		"remote_ip": c.remoteIP,
+		"error":     err.Error(),
+	})
+}
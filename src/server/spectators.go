@@ -0,0 +1,116 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"holodeck1/logging"
+	"holodeck1/spectators"
+)
+
+// Spectators join with ?spectator=1 and get no avatar; see package
+// spectators. Their consoles follow the director's shot while they ask to:
+//
+//	server → client  director          {shot: {position, yaw, pitch, fov?, transition_ms?, view?, take, ...} | null}
+//	client → server  spectator_follow  {follow: bool}
+//
+// A null shot hands a following console its own camera back.
+
+// admitSpectator reads whether a client joins as a spectator and follows
+// the director, writing 403 or 503 when it may not join as one
+func admitSpectator(w http.ResponseWriter, r *http.Request) (spectator, follows, ok bool) {
+	query := r.URL.Query()
+	if value := query.Get("spectator"); value != "1" && value != "true" {
+		return false, false, true
+	}
+	switch err := spectators.Admit(); err {
+	case nil:
+	case spectators.ErrFull:
+		http.Error(w, "Spectator limit reached", http.StatusServiceUnavailable)
+		return false, false, false
+	default:
+		http.Error(w, "Spectators not allowed", http.StatusForbidden)
+		return false, false, false
+	}
+	return true, query.Get("follow") == "director", true
+}
+
+func directorMessage(shot *spectators.Shot) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type": "director",
+		"shot": shot,
+	})
+	return data
+}
+
+// Direct sends a shot to the spectators following the director, or with
+// nil gives them their cameras back, and returns how many it reached
+func (h *Hub) Direct(shot *spectators.Shot) int {
+	data := directorMessage(shot)
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	reached := 0
+	for client := range h.clients {
+		if !client.spectator || !spectators.Follows(client.GetHD1ID()) {
+			continue
+		}
+		select {
+		case client.send <- data:
+			reached++
+		default:
+			// Client Go channel blocked, don't wait
+		}
+	}
+	return reached
+}
+
+// sendDirectorShot moves a following spectator's camera to the director's
+// shot, when there is one
+func (c *Client) sendDirectorShot() {
+	if !c.spectator || !spectators.Follows(c.GetHD1ID()) {
+		return
+	}
+	if shot, ok := spectators.Current(); ok {
+		select {
+		case c.send <- directorMessage(shot):
+		default:
+			// Client Go channel blocked, don't wait
+		}
+	}
+}
+
+// handleSpectatorFollow starts or stops a spectator following the director;
+// a spectator starting to follow moves to the current shot at once
+func (c *Client) handleSpectatorFollow(message []byte) {
+	var msg struct {
+		Follow bool `json:"follow"`
+	}
+	if !c.spectator || json.Unmarshal(message, &msg) != nil {
+		return
+	}
+	spectators.Follow(c.GetHD1ID(), msg.Follow)
+	if msg.Follow {
+		c.sendDirectorShot()
+	} else {
+		select {
+		case c.send <- directorMessage(nil):
+		default:
+			// Client Go channel blocked, don't wait
+		}
+	}
+	logging.Debug("spectator follow changed", map[string]interface{}{
+		"hd1_id": c.GetHD1ID(),
+		"follow": msg.Follow,
+	})
+}
+
+// joinSpectating records a spectator's connection
+func (c *Client) joinSpectating(follows bool) {
+	spectators.Join(c.GetHD1ID(), follows, time.Now())
+	logging.Info("spectator joined", map[string]interface{}{
+		"hd1_id":    c.GetHD1ID(),
+		"follows":   follows,
+		"remote_ip": c.remoteIP,
+	})
+}
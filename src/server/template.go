@@ -2,31 +2,30 @@ package server
 
 import (
 	"fmt"
-	"io/ioutil"
+	"io/fs"
 	"net/http"
-	"path/filepath"
 	"strings"
+
+	"holodeck1/config"
 )
 
 // TemplateProcessor handles server-side template variable replacement
 type TemplateProcessor struct {
-	staticDir string
-	htdocsDir string
+	root fs.FS // Document root: index.html and static/
 }
 
 // NewTemplateProcessor creates a new template processor
-func NewTemplateProcessor(staticDir string) *TemplateProcessor {
-	htdocsDir := filepath.Join(staticDir, "..")
+func NewTemplateProcessor(root fs.FS) *TemplateProcessor {
 	return &TemplateProcessor{
-		staticDir: staticDir,
-		htdocsDir: htdocsDir,
+		root: root,
 	}
 }
 
-// ProcessTemplate reads a file and processes template variables
+// ProcessTemplate reads a file relative to the document root and processes
+// template variables
 func (tp *TemplateProcessor) ProcessTemplate(filePath string) (string, error) {
 	// Read the template file
-	content, err := ioutil.ReadFile(filePath)
+	content, err := fs.ReadFile(tp.root, filePath)
 	if err != nil {
 		return "", fmt.Errorf("failed to read template file %s: %v", filePath, err)
 	}
@@ -34,17 +33,16 @@ func (tp *TemplateProcessor) ProcessTemplate(filePath string) (string, error) {
 	// Process template variables
 	processed := string(content)
 	processed = strings.ReplaceAll(processed, "${JS_VERSION}", GetJSVersion())
+	processed = strings.ReplaceAll(processed, "${DEFAULT_LOCALE}", config.GetClientLocale())
+	processed = replaceAssetURLs(processed)
 	
 	return processed, nil
 }
 
 // ServeTemplate serves a processed template file with proper headers
 func (tp *TemplateProcessor) ServeTemplate(w http.ResponseWriter, r *http.Request, templatePath string, contentType string) error {
-	// Get the full path to the template file
-	fullPath := filepath.Join(tp.htdocsDir, templatePath)
-	
 	// Process the template
-	content, err := tp.ProcessTemplate(fullPath)
+	content, err := tp.ProcessTemplate(templatePath)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+	"holodeck1/views"
+)
+
+// PublishView tells every client a camera view was saved or deleted, so
+// consoles keep their view lists current; every client is in the served
+// world
+func (h *Hub) PublishView(event string, view *views.View) {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":  "view",
+		"event": event,
+		"view":  view,
+	})
+	h.Broadcast(data)
+}
+
+// ServeWorldLink serves the console for a deep link such as
+// /w/world_one?view=lobby; the console reads the view from the URL once it
+// joins. Only the served world has links.
+func ServeWorldLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if strings.TrimPrefix(r.URL.Path, "/w/") != config.GetWorldsDefaultWorld() {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if templateProcessor == nil {
+		http.Error(w, "Server configuration error", http.StatusInternalServerError)
+		return
+	}
+	if err := templateProcessor.ServeIndex(w, r); err != nil {
+		logging.Error("failed to serve index template", map[string]interface{}{
+			"error": err.Error(),
+		})
+		http.Error(w, "Template processing failed", http.StatusInternalServerError)
+	}
+}
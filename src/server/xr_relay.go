@@ -0,0 +1,206 @@
+package server
+
+import (
+	"encoding/json"
+	stdSync "sync"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+	"holodeck1/xr"
+)
+
+// XR pose channel.
+//
+// VR clients send head and controller deltas at display rate:
+//
+//	→ xr_pose  {pose: {t, head?, left?, right?}}
+//	→ xr_ik    {ik: {rig, height, arm_span?, handedness?}}
+//	← xr_poses {server_time, poses: [{hd1_id, pose, full, server_time}]}
+//
+// Poses are ephemeral - they bypass the operation log, which would grow by
+// ~90 entries per second per headset. Each receiver gets the deltas merged
+// since its last relay at most PoseRate times per second (lower if its
+// capability profile asks for fewer updates), plus a full pose every
+// KeyframeInterval so a dropped delta never leaves a joint stale for long.
+// IK metadata changes rarely and travels as a reliable avatar_update.
+// Each entry's server_time is when its latest delta reached the server, so
+// receivers can order and interpolate poses on one clock (see clock.go).
+
+// xrPoseEntry is one avatar in an xr_poses message
+type xrPoseEntry struct {
+	HD1ID      string   `json:"hd1_id"`
+	Pose       *xr.Pose `json:"pose"`
+	Full       bool     `json:"full"`
+	ServerTime float64  `json:"server_time"`
+}
+
+// xrRelay buffers pose deltas bound for one client
+type xrRelay struct {
+	mutex     stdSync.Mutex
+	pending   map[string]*xr.Pose // merged deltas since the last relay
+	latest    map[string]*xr.Pose // full pose, used for keyframes
+	received  map[string]time.Time
+	lastFull  map[string]time.Time
+	lastFlush time.Time
+	timer     *time.Timer
+	closed    bool
+}
+
+// handlePoseMessage merges a client's pose delta and relays it
+func (c *Client) handlePoseMessage(message []byte) {
+	var msg struct {
+		Pose *xr.Pose `json:"pose"`
+	}
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return
+	}
+	if err := msg.Pose.Validate(); err != nil {
+		logging.Trace("xr", "invalid pose dropped", map[string]interface{}{
+			"hd1_id": c.GetClientID(),
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	avatarID := c.GetAvatarID()
+	if avatarID == "" {
+		return
+	}
+	full, ok := c.hub.avatarRegistry.UpdateAvatarPose(avatarID, msg.Pose)
+	if !ok {
+		return
+	}
+	c.hub.relayPose(c, avatarID, msg.Pose, full, c.lastSeen)
+}
+
+// handleIKMessage stores a client's IK metadata
+func (c *Client) handleIKMessage(message []byte) {
+	var msg struct {
+		IK *xr.IKMetadata `json:"ik"`
+	}
+	if err := json.Unmarshal(message, &msg); err != nil || msg.IK == nil {
+		return
+	}
+	if err := msg.IK.Validate(); err != nil {
+		logging.Warn("invalid IK metadata", map[string]interface{}{
+			"hd1_id": c.GetClientID(),
+			"error":  err.Error(),
+		})
+		return
+	}
+	if avatarID := c.GetAvatarID(); avatarID != "" {
+		c.hub.avatarRegistry.SetAvatarIK(avatarID, msg.IK)
+	}
+}
+
+// relayPose queues a pose delta for every client except its sender
+func (h *Hub) relayPose(sender *Client, avatarID string, delta, full *xr.Pose, receivedAt time.Time) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for client := range h.clients {
+		if client != sender {
+			client.queuePose(avatarID, delta, full, receivedAt)
+		}
+	}
+}
+
+// poseInterval is the minimum spacing between relays to this client
+func (c *Client) poseInterval() time.Duration {
+	rate := config.GetXRPoseRate()
+	if profileRate := c.Profile().UpdateRate; profileRate > 0 && (rate <= 0 || profileRate < rate) {
+		rate = profileRate
+	}
+	if rate <= 0 {
+		return 0
+	}
+	return time.Second / time.Duration(rate)
+}
+
+// queuePose merges a delta into the client's pending relay
+func (c *Client) queuePose(avatarID string, delta, full *xr.Pose, receivedAt time.Time) {
+	r := &c.xrRelay
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return
+	}
+	if r.pending == nil {
+		r.pending = make(map[string]*xr.Pose)
+		r.latest = make(map[string]*xr.Pose)
+		r.lastFull = make(map[string]time.Time)
+		r.received = make(map[string]time.Time)
+	}
+
+	if pending, ok := r.pending[avatarID]; ok {
+		pending.Merge(delta)
+	} else {
+		r.pending[avatarID] = delta.Clone()
+	}
+	r.latest[avatarID] = full
+	r.received[avatarID] = receivedAt
+
+	if r.timer == nil {
+		wait := c.poseInterval() - time.Since(r.lastFlush)
+		if wait < 0 {
+			wait = 0
+		}
+		r.timer = time.AfterFunc(wait, c.flushPoses)
+	}
+}
+
+// flushPoses sends every pending pose in one xr_poses message
+func (c *Client) flushPoses() {
+	r := &c.xrRelay
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.timer = nil
+	if r.closed || len(r.pending) == 0 {
+		return
+	}
+
+	now := time.Now()
+	r.lastFlush = now
+	keyframe := config.GetXRKeyframeInterval()
+	entries := make([]xrPoseEntry, 0, len(r.pending))
+	for avatarID, delta := range r.pending {
+		entry := xrPoseEntry{HD1ID: avatarID, Pose: delta, ServerTime: ServerMillis(r.received[avatarID])}
+		if now.Sub(r.lastFull[avatarID]) >= keyframe {
+			entry.Pose = r.latest[avatarID]
+			entry.Full = true
+			r.lastFull[avatarID] = now
+		}
+		entries = append(entries, entry)
+		delete(r.pending, avatarID)
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"type":        "xr_poses",
+		"server_time": ServerMillis(now),
+		"poses":       entries,
+	})
+	if err != nil {
+		return
+	}
+	select {
+	case c.send <- data:
+	default:
+		// Dropped deltas are repaired by forcing keyframes next time
+		for _, entry := range entries {
+			delete(r.lastFull, entry.HD1ID)
+		}
+	}
+}
+
+// stopXRRelay discards pending poses; the hub calls it before closing the
+// send channel so a late timer cannot write to it
+func (c *Client) stopXRRelay() {
+	r := &c.xrRelay
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.closed = true
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+}
@@ -0,0 +1,123 @@
+package signing
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"holodeck1/config"
+)
+
+// Errors accepting a delta's nonce
+var (
+	ErrNoNonce  = errors.New("signed changes must carry a nonce in X-HD1-Nonce, counting up from 1")
+	ErrReplayed = errors.New("delta nonce already used")
+	ErrStale    = errors.New("delta nonce is too old to tell whether it was used")
+)
+
+// Replay rejection counters, since the server started
+var (
+	accepted atomic.Uint64
+	replayed atomic.Uint64
+	stale    atomic.Uint64
+	missing  atomic.Uint64
+)
+
+// ReplayStats reports nonce checks since the server started
+type ReplayStats struct {
+	Window   int    `json:"window"`   // Nonces below the highest still accepted
+	Sessions int    `json:"sessions"` // Sessions holding a signing key
+	Accepted uint64 `json:"accepted"`
+	Replayed uint64 `json:"replayed"` // Refused, the nonce was used
+	Stale    uint64 `json:"stale"`    // Refused, the nonce fell out of the window
+	Missing  uint64 `json:"missing"`  // Refused, the delta carried no nonce
+}
+
+// window is a session's sliding window of used nonces: the highest nonce
+// seen, and a bit for each of the size nonces up to it. Deltas that
+// overtake each other in transit still pass, as long as they are no more
+// than size apart.
+type window struct {
+	highest uint64
+	size    uint64
+	used    []uint64 // Bit n%size marks nonce n
+}
+
+func newWindow(size int) *window {
+	return &window{size: uint64(size), used: make([]uint64, (size+63)/64)}
+}
+
+func (w *window) bit(nonce uint64) (int, uint64) {
+	n := nonce % w.size
+	return int(n / 64), 1 << (n % 64)
+}
+
+// accept marks a nonce used, or says why it cannot be
+func (w *window) accept(nonce uint64) error {
+	switch {
+	case nonce > w.highest:
+		// Slide forward, forgetting the nonces that leave the window
+		if nonce-w.highest >= w.size {
+			for i := range w.used {
+				w.used[i] = 0
+			}
+		} else {
+			for n := w.highest + 1; n < nonce; n++ {
+				word, mask := w.bit(n)
+				w.used[word] &^= mask
+			}
+		}
+		w.highest = nonce
+	case w.highest-nonce >= w.size:
+		return ErrStale
+	default:
+		if word, mask := w.bit(nonce); w.used[word]&mask != 0 {
+			return ErrReplayed
+		}
+	}
+	word, mask := w.bit(nonce)
+	w.used[word] |= mask
+	return nil
+}
+
+// Accept uses a verified call's nonce, refusing nonces the session used
+// before or that fell out of its window
+func Accept(hd1ID string, nonce uint64) error {
+	if nonce == 0 {
+		missing.Add(1)
+		return ErrNoNonce
+	}
+	mutex.Lock()
+	current, ok := sessions[hd1ID]
+	var err error
+	if !ok {
+		err = ErrNoKey
+	} else {
+		err = current.window.accept(nonce)
+	}
+	mutex.Unlock()
+
+	switch err {
+	case nil:
+		accepted.Add(1)
+	case ErrReplayed:
+		replayed.Add(1)
+	case ErrStale:
+		stale.Add(1)
+	}
+	return err
+}
+
+// Replays returns the nonce check counters
+func Replays() ReplayStats {
+	mutex.Lock()
+	count := len(sessions)
+	mutex.Unlock()
+	return ReplayStats{
+		Window:   config.GetSyncReplayWindow(),
+		Sessions: count,
+		Accepted: accepted.Load(),
+		Replayed: replayed.Load(),
+		Stale:    stale.Load(),
+		Missing:  missing.Load(),
+	}
+}
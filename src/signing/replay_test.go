@@ -0,0 +1,160 @@
+package signing
+
+import "testing"
+
+const testWindow = 64
+
+func TestWindowAcceptsEachNonceOnceWithinTheWindow(t *testing.T) {
+	tests := []struct {
+		name string
+		// used are the nonces accepted before, in order
+		used  []uint64
+		nonce uint64
+		want  error
+	}{
+		{
+			name:  "first nonce is accepted",
+			nonce: 1,
+			want:  nil,
+		},
+		{
+			name:  "next nonce is accepted",
+			used:  []uint64{1, 2, 3},
+			nonce: 4,
+			want:  nil,
+		},
+		{
+			name:  "nonce used before is refused",
+			used:  []uint64{1, 2, 3},
+			nonce: 2,
+			want:  ErrReplayed,
+		},
+		{
+			name:  "highest nonce used is refused",
+			used:  []uint64{1, 2, 3},
+			nonce: 3,
+			want:  ErrReplayed,
+		},
+		{
+			name:  "nonce overtaken in transit is accepted",
+			used:  []uint64{1, 3},
+			nonce: 2,
+			want:  nil,
+		},
+		{
+			name:  "skipped nonce at the edge of the window is accepted",
+			used:  []uint64{testWindow},
+			nonce: 1,
+			want:  nil,
+		},
+		{
+			name:  "nonce past the edge of the window is stale",
+			used:  []uint64{testWindow + 1},
+			nonce: 1,
+			want:  ErrStale,
+		},
+		{
+			name:  "nonce used before a jump past the window is stale",
+			used:  []uint64{5, 5 + 2*testWindow},
+			nonce: 5,
+			want:  ErrStale,
+		},
+		{
+			name:  "nonce whose bit a slide reused is accepted",
+			used:  []uint64{1, 2, testWindow + 1},
+			nonce: testWindow,
+			want:  nil,
+		},
+		{
+			name:  "nonce sharing a bit with one that left the window is accepted",
+			used:  []uint64{2, testWindow + 1},
+			nonce: testWindow + 2,
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newWindow(testWindow)
+			for _, nonce := range tt.used {
+				if err := w.accept(nonce); err != nil {
+					t.Fatalf("accepting used nonce %d: %v", nonce, err)
+				}
+			}
+			if err := w.accept(tt.nonce); err != tt.want {
+				t.Errorf("accept(%d) = %v, want %v", tt.nonce, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAcceptRefusesMissingUnkeyedAndReplayedNonces(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyed   bool
+		nonces  []uint64
+		want    []error
+		refused ReplayStats // Counters expected to grow by the refusals
+	}{
+		{
+			name:   "nonces counting up are accepted",
+			keyed:  true,
+			nonces: []uint64{1, 2, 3},
+			want:   []error{nil, nil, nil},
+		},
+		{
+			name:    "delta without a nonce is refused",
+			keyed:   true,
+			nonces:  []uint64{0},
+			want:    []error{ErrNoNonce},
+			refused: ReplayStats{Missing: 1},
+		},
+		{
+			name:    "duplicate nonce is refused",
+			keyed:   true,
+			nonces:  []uint64{1, 2, 2, 1},
+			want:    []error{nil, nil, ErrReplayed, ErrReplayed},
+			refused: ReplayStats{Replayed: 2},
+		},
+		{
+			name:    "nonce behind the window is refused",
+			keyed:   true,
+			nonces:  []uint64{1, testWindow + 1, 1},
+			want:    []error{nil, nil, ErrStale},
+			refused: ReplayStats{Stale: 1},
+		},
+		{
+			name:   "session without a key is refused",
+			keyed:  false,
+			nonces: []uint64{1},
+			want:   []error{ErrNoKey},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hd1ID := "session-" + tt.name
+			if tt.keyed {
+				if _, err := Issue(hd1ID); err != nil {
+					t.Fatalf("issuing key: %v", err)
+				}
+			}
+			before := Replays()
+			for i, nonce := range tt.nonces {
+				if err := Accept(hd1ID, nonce); err != tt.want[i] {
+					t.Errorf("Accept(%d) = %v, want %v", nonce, err, tt.want[i])
+				}
+			}
+			after := Replays()
+			if got := after.Missing - before.Missing; got != tt.refused.Missing {
+				t.Errorf("missing grew by %d, want %d", got, tt.refused.Missing)
+			}
+			if got := after.Replayed - before.Replayed; got != tt.refused.Replayed {
+				t.Errorf("replayed grew by %d, want %d", got, tt.refused.Replayed)
+			}
+			if got := after.Stale - before.Stale; got != tt.refused.Stale {
+				t.Errorf("stale grew by %d, want %d", got, tt.refused.Stale)
+			}
+		})
+	}
+}
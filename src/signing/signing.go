@@ -0,0 +1,148 @@
+// Package signing verifies deltas clients sign, so the server can tell an
+// operation was not altered in transit by a proxy between it and the
+// client.
+//
+// Signing is switched on by a signing sync checksum algorithm,
+// hmac-sha256. Every WebSocket session is then given a key of its own in
+// client_init, and must sign each mutating call it makes with it:
+//
+//	X-HD1-ID: <hd1_id>
+//	X-HD1-Signature: <hex HMAC-SHA256 of the call's Message under the key>
+//
+// Avatar deltas sent over the WebSocket travel in a signed envelope. Unsigned
+// calls and calls whose signature does not match are refused.
+// So are replays: each signed call carries a nonce in X-HD1-Nonce,
+// counting up from 1 under the key, that may be used once. See Accept.
+// World checksums keep using the algorithm's hash, since clients holding
+// different keys must agree on them.
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"strconv"
+	"sync"
+
+	"holodeck1/config"
+)
+
+// HMACSHA256 signs deltas with HMAC-SHA256 and checksums worlds with sha256
+const HMACSHA256 = "hmac-sha256"
+
+// Errors verifying a delta
+var (
+	ErrUnsigned = errors.New("changes must be signed with the session's key in X-HD1-Signature")
+	ErrNoKey    = errors.New("session holds no signing key, reconnect to be issued one")
+	ErrMismatch = errors.New("signature does not match")
+)
+
+// algorithm is a sync checksum algorithm that signs deltas
+type algorithm struct {
+	hash     func() hash.Hash // Signs deltas under HMAC
+	checksum string           // World checksum algorithm clients reproduce
+}
+
+// algorithms are the signing sync checksum algorithms by name
+var algorithms = map[string]algorithm{
+	HMACSHA256: {hash: sha256.New, checksum: "sha256"},
+}
+
+// session is what the server holds of a session signing its deltas
+type session struct {
+	key    []byte
+	window *window // Nonces used under the key
+}
+
+var (
+	sessions = map[string]*session{}
+	mutex    sync.Mutex
+)
+
+// Enabled reports whether deltas must be signed
+func Enabled() bool {
+	_, ok := algorithms[config.GetSyncChecksumAlgorithm()]
+	return ok
+}
+
+// ChecksumAlgorithm returns the algorithm world checksums are computed
+// with: the configured one, or the hash of a signing one
+func ChecksumAlgorithm() string {
+	configured := config.GetSyncChecksumAlgorithm()
+	if signer, ok := algorithms[configured]; ok {
+		return signer.checksum
+	}
+	return configured
+}
+
+// Issue gives a session a new signing key, replacing any it held, and
+// returns it hex encoded. Nonces count from 1 again under the new key;
+// deltas signed with the old one no longer verify.
+func Issue(hd1ID string) (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	mutex.Lock()
+	sessions[hd1ID] = &session{key: key, window: newWindow(config.GetSyncReplayWindow())}
+	mutex.Unlock()
+	return hex.EncodeToString(key), nil
+}
+
+// Release forgets a session's key, unless it was replaced since it was
+// issued: a reconnect may be given a new key before the old connection
+// closes
+func Release(hd1ID, key string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if current, ok := sessions[hd1ID]; ok && hex.EncodeToString(current.key) == key {
+		delete(sessions, hd1ID)
+	}
+}
+
+// Message is what a session signs of a call: its method and target, the
+// path and query, on the first line, its nonce on the second, then its
+// body. A signed body cannot be replayed against another operation, nor
+// its nonce changed.
+func Message(method, target string, nonce uint64, body []byte) []byte {
+	message := make([]byte, 0, len(method)+len(target)+24+len(body))
+	message = append(message, method...)
+	message = append(message, ' ')
+	message = append(message, target...)
+	message = append(message, '\n')
+	message = strconv.AppendUint(message, nonce, 10)
+	message = append(message, '\n')
+	return append(message, body...)
+}
+
+// Verify checks a session's signature of a call's Message; its nonce is
+// checked with Accept once the body is read
+func Verify(hd1ID string, message []byte, signature string) error {
+	if hd1ID == "" || signature == "" {
+		return ErrUnsigned
+	}
+	mutex.Lock()
+	current, ok := sessions[hd1ID]
+	mutex.Unlock()
+	if !ok {
+		return ErrNoKey
+	}
+	given, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(given, sum(current.key, message)) {
+		return ErrMismatch
+	}
+	return nil
+}
+
+func sum(key, message []byte) []byte {
+	signer, ok := algorithms[config.GetSyncChecksumAlgorithm()]
+	if !ok {
+		signer = algorithms[HMACSHA256]
+	}
+	mac := hmac.New(signer.hash, key)
+	mac.Write(message)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,90 @@
+package simulation
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Speed limits of the clock
+const (
+	MinSpeed = 0.01
+	MaxSpeed = 100
+)
+
+// Clock is the pace of the served world's simulation. Simulation time is
+// where bindings, the environment cycle and client animations are; it runs
+// at speed times real time and stands still while paused. It lives in the
+// world's scene settings under "clock" so clients follow it, but the loop
+// holds the one that counts.
+type Clock struct {
+	Paused bool    `json:"paused"`
+	Speed  float64 `json:"speed"`  // Simulation seconds per real second
+	Time   int64   `json:"time"`   // Simulation time at SetAt, Unix ms
+	SetAt  int64   `json:"set_at"` // Server time the clock was last set, Unix ms
+}
+
+// ClockChange pauses, resumes or changes the speed of the clock; fields
+// left out keep their value
+type ClockChange struct {
+	Paused *bool    `json:"paused"`
+	Speed  *float64 `json:"speed"`
+}
+
+// At returns the simulation time at a server time
+func (c Clock) At(now time.Time) time.Time {
+	if c.Paused {
+		return time.UnixMilli(c.Time)
+	}
+	elapsed := float64(now.UnixMilli()-c.SetAt) * c.Speed
+	return time.UnixMilli(c.Time + int64(elapsed))
+}
+
+// Data returns the clock as scene_update data
+func (c Clock) Data() map[string]interface{} {
+	var data map[string]interface{}
+	encoded, _ := json.Marshal(c)
+	json.Unmarshal(encoded, &data)
+	return data
+}
+
+// clock starts running at real time
+var clock = Clock{Speed: 1, Time: time.Now().UnixMilli(), SetAt: time.Now().UnixMilli()}
+
+// CurrentClock returns the clock
+func CurrentClock() Clock {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return clock
+}
+
+// Now returns the simulation time
+func Now() time.Time {
+	return CurrentClock().At(time.Now())
+}
+
+// SetClock applies a change to the clock. Simulation time carries on from
+// where it stands, so pausing and changing speed never jump it.
+func SetClock(change ClockChange) (Clock, error) {
+	if change.Speed != nil {
+		if speed := *change.Speed; math.IsNaN(speed) || speed < MinSpeed || speed > MaxSpeed {
+			return Clock{}, fmt.Errorf("speed must be within %g-%g", MinSpeed, float64(MaxSpeed))
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	now := time.Now()
+	updated := clock
+	updated.Time = clock.At(now).UnixMilli()
+	updated.SetAt = now.UnixMilli()
+	if change.Paused != nil {
+		updated.Paused = *change.Paused
+	}
+	if change.Speed != nil {
+		updated.Speed = *change.Speed
+	}
+	clock = updated
+	return updated, nil
+}
@@ -0,0 +1,211 @@
+// Package simulation steps the served world's server-side systems, such as
+// entity bindings and the environment cycle, on one tick loop that runs
+// whether or not anyone is connected.
+//
+// Each system registers a step and the interval it wants between steps.
+// The loop wakes every tick and steps the systems that are due. With no
+// clients connected it wakes only every idle tick, so an empty world keeps
+// advancing at a low rate instead of freezing. When the first client
+// connects again every system steps at once, so the state it syncs is
+// at most a tick behind rather than an idle tick.
+//
+// Systems step in simulation time rather than real time, following the
+// world's clock: paused, a step sees the same time as the last and
+// nothing moves; at double speed it sees twice the time pass.
+package simulation
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+)
+
+// Step advances a system to now, in simulation time
+type Step func(now time.Time)
+
+// system is a registered step and its record
+type system struct {
+	name     string
+	interval time.Duration
+	step     Step
+	last     time.Time
+	steps    uint64
+	took     time.Duration // Last step
+	busy     time.Duration // All steps
+	failures uint64
+}
+
+// SystemStatus reports one system of the loop
+type SystemStatus struct {
+	Name     string     `json:"name"`
+	Interval string     `json:"interval"` // Wanted between steps; idle ticks may stretch it
+	Steps    uint64     `json:"steps"`
+	Failures uint64     `json:"failures"` // Steps that panicked
+	LastStep *time.Time `json:"last_step,omitempty"`
+	Took     float64    `json:"took_ms"` // Duration of the last step
+	Busy     float64    `json:"busy_ms"` // Time spent in every step so far
+}
+
+// Status reports the loop
+type Status struct {
+	Running  bool           `json:"running"`
+	Idle     bool           `json:"idle"` // No clients connected, ticking at the idle rate
+	Clients  int            `json:"clients"`
+	Tick     string         `json:"tick"`
+	IdleTick string         `json:"idle_tick"`
+	Ticks    uint64         `json:"ticks"`
+	Clock    Clock          `json:"clock"`
+	Now      int64          `json:"now"` // Simulation time, Unix ms
+	Systems  []SystemStatus `json:"systems"`
+}
+
+var (
+	systems []*system
+	running bool
+	idle    bool
+	clients int
+	ticks   uint64
+	mutex   sync.Mutex
+)
+
+// Register adds a system stepped every interval, at most once a tick. A
+// nil step, from a system that is switched off, is ignored.
+func Register(name string, interval time.Duration, step Step) {
+	if step == nil {
+		return
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	systems = append(systems, &system{name: name, interval: interval, step: step})
+}
+
+// Run steps the registered systems until ctx ends. connected reports how
+// many clients are connected, switching between the tick and idle tick.
+func Run(ctx context.Context, connected func() int) {
+	tick, idleTick := config.GetSimulationTick(), config.GetSimulationIdleTick()
+	mutex.Lock()
+	running = true
+	names := make([]string, len(systems))
+	for i, s := range systems {
+		names[i] = s.name
+	}
+	mutex.Unlock()
+	logging.Info("simulation loop started", map[string]interface{}{
+		"tick":      tick.String(),
+		"idle_tick": idleTick.String(),
+		"systems":   names,
+	})
+
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	var woke time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			mutex.Lock()
+			running = false
+			mutex.Unlock()
+			return
+		case now := <-ticker.C:
+			count := connected()
+			mutex.Lock()
+			wasIdle := idle
+			idle, clients = count == 0, count
+			mutex.Unlock()
+
+			joined := wasIdle && count > 0
+			if joined {
+				logging.Debug("simulation catching up for a joining client", map[string]interface{}{
+					"clients": count,
+				})
+			}
+			if count == 0 && now.Sub(woke) < idleTick {
+				continue
+			}
+			woke = now
+			advance(now, joined)
+		}
+	}
+}
+
+// advance steps the systems that are due, or all of them
+func advance(now time.Time, all bool) {
+	mutex.Lock()
+	ticks++
+	at := clock.At(now)
+	due := make([]*system, 0, len(systems))
+	for _, s := range systems {
+		if all || now.Sub(s.last) >= s.interval {
+			due = append(due, s)
+		}
+	}
+	mutex.Unlock()
+
+	for _, s := range due {
+		started := time.Now()
+		err := step(s, at)
+		mutex.Lock()
+		s.last = now
+		s.steps++
+		s.took = time.Since(started)
+		s.busy += s.took
+		if err != nil {
+			s.failures++
+		}
+		mutex.Unlock()
+		if err != nil {
+			logging.Error("simulation step failed", map[string]interface{}{
+				"system": s.name,
+				"error":  err.Error(),
+			})
+		}
+	}
+}
+
+// step runs one step, so a panicking system cannot stop the others
+func step(s *system, now time.Time) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+	s.step(now)
+	return nil
+}
+
+// Stats reports the loop and its systems
+func Stats() Status {
+	mutex.Lock()
+	defer mutex.Unlock()
+	status := Status{
+		Running:  running,
+		Idle:     idle,
+		Clients:  clients,
+		Tick:     config.GetSimulationTick().String(),
+		IdleTick: config.GetSimulationIdleTick().String(),
+		Ticks:    ticks,
+		Clock:    clock,
+		Now:      clock.At(time.Now()).UnixMilli(),
+		Systems:  make([]SystemStatus, 0, len(systems)),
+	}
+	for _, s := range systems {
+		entry := SystemStatus{
+			Name:     s.name,
+			Interval: s.interval.String(),
+			Steps:    s.steps,
+			Failures: s.failures,
+			Took:     float64(s.took.Microseconds()) / 1000,
+			Busy:     float64(s.busy.Microseconds()) / 1000,
+		}
+		if !s.last.IsZero() {
+			last := s.last.UTC()
+			entry.LastStep = &last
+		}
+		status.Systems = append(status.Systems, entry)
+	}
+	return status
+}
@@ -0,0 +1,230 @@
+// Package spectators keeps the sessions watching the served world without
+// an avatar, and the director's shot they may follow.
+//
+// A console joins as a spectator with ?spectator=1 on its WebSocket URL. It
+// receives the world's operations like any other client but holds only the
+// view permission: it cannot change the scene, chat or place an avatar, so
+// a streamed event can have thousands of viewers without any of them in
+// it. A spectator follows the director with ?follow=director, or later by
+// asking over its connection; operators set the director's shot, a camera
+// position and orientation or a saved view, and following consoles move
+// their camera to it. Spectators and the shot live in memory.
+package spectators
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/views"
+)
+
+// Limits of a valid shot
+const (
+	MinFOV          = 10  // Degrees
+	MaxFOV          = 120 // Degrees
+	MaxTransitionMS = 60000
+	maxCoordinate   = 1e6 // Metres from the origin
+)
+
+var (
+	// ErrDisabled is returned when clients may not join as spectators
+	ErrDisabled = errors.New("spectators not allowed")
+	// ErrFull is returned when the configured spectators are connected
+	ErrFull = errors.New("spectator limit reached")
+	// ErrNoShot is returned when the director has no shot to release
+	ErrNoShot = errors.New("director has no shot")
+)
+
+// Spectator is a session watching the world
+type Spectator struct {
+	HD1ID    string    `json:"hd1_id"`
+	Follows  bool      `json:"follows"` // Moves its camera with the director's shot
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// Shot is where the director's camera stands and looks, as consoles hold
+// a camera: looking along -z turned by Yaw about the vertical axis, then
+// tilted by Pitch
+type Shot struct {
+	Position     views.Position `json:"position"`
+	Yaw          float64        `json:"yaw"`                     // Radians, counter-clockwise seen from above
+	Pitch        float64        `json:"pitch"`                   // Radians, up positive, within ±π/2
+	FOV          float64        `json:"fov,omitempty"`           // Vertical, degrees; 0 keeps the console's
+	TransitionMS int            `json:"transition_ms,omitempty"` // Glide from the previous shot, 0 cuts
+	View         string         `json:"view,omitempty"`          // Saved view the shot was taken from
+	Take         uint64         `json:"take"`                    // Counts the director's shots
+	SetBy        string         `json:"set_by"`
+	SetAt        time.Time      `json:"set_at"`
+}
+
+// Validate checks a shot before it is taken, turning its yaw into ±π
+func (s *Shot) Validate() error {
+	for _, coordinate := range []float64{s.Position.X, s.Position.Y, s.Position.Z} {
+		if !(math.Abs(coordinate) <= maxCoordinate) {
+			return errors.New("position must be within 1000000m of the origin")
+		}
+	}
+	if math.IsNaN(s.Yaw) || math.IsInf(s.Yaw, 0) {
+		return errors.New("yaw must be a number")
+	}
+	if !(math.Abs(s.Pitch) <= math.Pi/2) {
+		return errors.New("pitch must be within ±π/2")
+	}
+	if s.FOV != 0 && !(s.FOV >= MinFOV && s.FOV <= MaxFOV) {
+		return errors.New("fov must be between 10 and 120 degrees")
+	}
+	if s.TransitionMS < 0 || s.TransitionMS > MaxTransitionMS {
+		return errors.New("transition_ms must be between 0 and 60000")
+	}
+	s.Yaw = math.Remainder(s.Yaw, 2*math.Pi)
+	return nil
+}
+
+// spectator is a spectating session and its connections
+type spectator struct {
+	Spectator
+	connections int
+}
+
+var (
+	mutex    sync.RWMutex
+	sessions = make(map[string]*spectator)
+	shot     *Shot
+	takes    uint64
+)
+
+// Admit checks a client may join as a spectator now
+func Admit() error {
+	if !config.GetSpectatorsEnabled() {
+		return ErrDisabled
+	}
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if max := config.GetSpectatorsMax(); max > 0 && len(sessions) >= max {
+		return ErrFull
+	}
+	return nil
+}
+
+// Join records a connection of a spectating session
+func Join(hd1ID string, follows bool, now time.Time) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	s, ok := sessions[hd1ID]
+	if !ok {
+		s = &spectator{Spectator: Spectator{HD1ID: hd1ID, JoinedAt: now.UTC()}}
+		sessions[hd1ID] = s
+	}
+	s.Follows = follows
+	s.connections++
+}
+
+// Leave drops a connection of a spectating session, and the session with
+// its last
+func Leave(hd1ID string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if s, ok := sessions[hd1ID]; ok {
+		if s.connections--; s.connections <= 0 {
+			delete(sessions, hd1ID)
+		}
+	}
+}
+
+// Is reports whether a session is spectating
+func Is(hd1ID string) bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	_, ok := sessions[hd1ID]
+	return ok
+}
+
+// Watching reports whether any session is spectating
+func Watching() bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return len(sessions) > 0
+}
+
+// Follow starts or stops a spectator following the director, false for
+// sessions not spectating
+func Follow(hd1ID string, follows bool) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	s, ok := sessions[hd1ID]
+	if ok {
+		s.Follows = follows
+	}
+	return ok
+}
+
+// Follows reports whether a session spectates following the director
+func Follows(hd1ID string) bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	s, ok := sessions[hd1ID]
+	return ok && s.Follows
+}
+
+// List returns the spectators, longest watching first
+func List() []Spectator {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	list := make([]Spectator, 0, len(sessions))
+	for _, s := range sessions {
+		list = append(list, s.Spectator)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].JoinedAt.Equal(list[j].JoinedAt) {
+			return list[i].JoinedAt.Before(list[j].JoinedAt)
+		}
+		return list[i].HD1ID < list[j].HD1ID
+	})
+	return list
+}
+
+// Direct takes a shot, which following spectators move to, and returns it
+// as taken
+func Direct(next *Shot, setBy string, now time.Time) (*Shot, error) {
+	if err := next.Validate(); err != nil {
+		return nil, err
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	takes++
+	taken := *next
+	taken.Take = takes
+	taken.SetBy = setBy
+	taken.SetAt = now.UTC()
+	shot = &taken
+	copied := taken
+	return &copied, nil
+}
+
+// Current returns the director's shot, false when there is none
+func Current() (*Shot, bool) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if shot == nil {
+		return nil, false
+	}
+	copied := *shot
+	return &copied, true
+}
+
+// Release ends the director's shot, handing following spectators their
+// own cameras, and returns the shot it ended
+func Release() (*Shot, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if shot == nil {
+		return nil, ErrNoShot
+	}
+	released := shot
+	shot = nil
+	return released, nil
+}
@@ -0,0 +1,598 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+)
+
+// Objects in the encrypted namespaces are sealed with AES-256-GCM before
+// they reach the backend. Every object gets its own data key, wrapped by a
+// key provider: the static provider holds keys from the environment, and
+// KMS plugins register with RegisterKeyProvider. Bodies are sealed in
+// 64 KiB chunks so large recordings stream without being held in memory.
+// The last chunk is marked, so truncation is detected, and the object key
+// is authenticated, so ciphertext cannot be moved to another key.
+//
+// Layout: "HD1E" | version | key ID length | key ID | wrapped key length
+// (2 bytes) | wrapped key | nonce prefix (7 bytes) | sealed chunks.
+//
+// Plaintext in an encrypted namespace is refused, since anyone able to
+// write to the backend could plant it. Objects stored before encryption
+// was enabled are read only with HD1_STORAGE_ENCRYPTION_MIGRATE, which
+// re-encrypts each one as it is first read.
+
+const (
+	encryptionMagic   = "HD1E"
+	encryptionVersion = 1
+	chunkSize         = 64 * 1024
+	tagSize           = 16
+	noncePrefixSize   = 7
+	dataKeySize       = 32
+)
+
+// ErrTampered is returned when an encrypted object fails authentication
+var ErrTampered = errors.New("encrypted object failed authentication")
+
+// ErrUnencrypted is returned reading plaintext from an encrypted namespace
+var ErrUnencrypted = errors.New("object in an encrypted namespace is not encrypted")
+
+// errPlaintext marks objects stored without encryption
+var errPlaintext = errors.New("object is not encrypted")
+
+// KeyProvider wraps and unwraps per-object data keys. KMS plugins implement
+// it and register with RegisterKeyProvider.
+type KeyProvider interface {
+	// WrapKey encrypts a new data key, returning the ID of the key used
+	WrapKey(ctx context.Context, dataKey []byte) (keyID string, wrapped []byte, err error)
+	// UnwrapKey decrypts a data key wrapped under keyID
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+var (
+	keyProviders      = map[string]KeyProvider{}
+	keyProvidersMutex sync.RWMutex
+)
+
+// RegisterKeyProvider makes a KMS plugin selectable with
+// HD1_STORAGE_ENCRYPTION_PROVIDER=name. Plugins register from init
+// functions, before storage is initialized.
+func RegisterKeyProvider(name string, provider KeyProvider) {
+	keyProvidersMutex.Lock()
+	defer keyProvidersMutex.Unlock()
+	keyProviders[name] = provider
+}
+
+func keyProvider(name string) (KeyProvider, error) {
+	if name == "static" {
+		return newStaticKeyProvider(config.GetStorageEncryptionKeys())
+	}
+	keyProvidersMutex.RLock()
+	defer keyProvidersMutex.RUnlock()
+	provider, ok := keyProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key provider: %s", name)
+	}
+	return provider, nil
+}
+
+// staticKeyProvider wraps data keys with keys given in configuration. The
+// first key wraps new objects; the others still unwrap, so keys can be
+// rotated by prepending a new one.
+type staticKeyProvider struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// newStaticKeyProvider parses "id:base64[,id:base64]", each key 32 bytes
+func newStaticKeyProvider(spec string) (*staticKeyProvider, error) {
+	provider := &staticKeyProvider{keys: map[string]cipher.AEAD{}}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("encryption keys must be id:base64 pairs")
+		}
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(raw) != dataKeySize {
+			return nil, fmt.Errorf("encryption key %q must be %d bytes, base64 encoded", id, dataKeySize)
+		}
+		if provider.keys[id], err = newAEAD(raw); err != nil {
+			return nil, err
+		}
+		if provider.current == "" {
+			provider.current = id
+		}
+	}
+	if provider.current == "" {
+		return nil, fmt.Errorf("static encryption provider needs HD1_STORAGE_ENCRYPTION_KEYS")
+	}
+	return provider, nil
+}
+
+func (p *staticKeyProvider) WrapKey(ctx context.Context, dataKey []byte) (string, []byte, error) {
+	aead := p.keys[p.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	return p.current, aead.Seal(nonce, nonce, dataKey, []byte(p.current)), nil
+}
+
+func (p *staticKeyProvider) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key %q", keyID)
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrTampered
+	}
+	dataKey, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(keyID))
+	if err != nil {
+		return nil, ErrTampered
+	}
+	return dataKey, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptedBackend seals objects in selected namespaces before handing
+// them to another backend. Signed URLs are served by the daemon, which
+// decrypts downloads and encrypts uploads; List reports stored sizes.
+type EncryptedBackend struct {
+	inner      Backend
+	provider   KeyProvider
+	namespaces map[string]bool
+	signer     *urlSigner
+	migrate    bool // Re-encrypt plaintext in encrypted namespaces rather than refuse it
+}
+
+// NewEncryptedBackend wraps inner, encrypting the given namespaces with
+// data keys from the named provider
+func NewEncryptedBackend(inner Backend, providerName string, namespaces []string) (*EncryptedBackend, error) {
+	provider, err := keyProvider(providerName)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := newURLSigner(config.GetStorageSigningKey())
+	if err != nil {
+		return nil, err
+	}
+
+	eb := &EncryptedBackend{inner: inner, provider: provider, namespaces: map[string]bool{}, signer: signer, migrate: config.GetStorageEncryptionMigrate()}
+	for _, namespace := range namespaces {
+		namespace = strings.TrimSpace(namespace)
+		if _, err := Key(namespace, "check"); err != nil {
+			return nil, err
+		}
+		eb.namespaces[namespace] = true
+	}
+	return eb, nil
+}
+
+// Name identifies the underlying backend
+func (eb *EncryptedBackend) Name() string {
+	return eb.inner.Name()
+}
+
+func (eb *EncryptedBackend) encrypted(key string) bool {
+	namespace, _, _ := strings.Cut(key, "/")
+	return eb.namespaces[namespace]
+}
+
+// Put seals the object when its namespace is encrypted
+func (eb *EncryptedBackend) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	if !eb.encrypted(key) {
+		return eb.inner.Put(ctx, key, body, size, contentType)
+	}
+
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return err
+	}
+	keyID, wrapped, err := eb.provider.WrapKey(ctx, dataKey)
+	if err != nil {
+		return fmt.Errorf("failed to wrap data key: %v", err)
+	}
+	if len(keyID) > 255 || len(wrapped) > 65535 {
+		return fmt.Errorf("key provider returned an oversized key")
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+
+	h := header{keyID: keyID, wrapped: wrapped, prefix: make([]byte, noncePrefixSize)}
+	if _, err := rand.Read(h.prefix); err != nil {
+		return err
+	}
+	encoded := h.marshal()
+	sealer := &sealReader{
+		chunks: chunks{aead: aead, prefix: h.prefix, key: []byte(key)},
+		source: bufio.NewReaderSize(body, chunkSize),
+		plain:  make([]byte, chunkSize),
+	}
+
+	stored := int64(-1)
+	if size >= 0 {
+		stored = int64(len(encoded)) + sealedSize(size)
+	}
+	return eb.inner.Put(ctx, key, io.MultiReader(bytes.NewReader(encoded), sealer), stored, contentType)
+}
+
+// Get opens the object, decrypting it when it was stored encrypted
+func (eb *EncryptedBackend) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	return eb.open(ctx, key, true)
+}
+
+// Stat returns object metadata with the decrypted size
+func (eb *EncryptedBackend) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	body, info, err := eb.open(ctx, key, false)
+	if err != nil {
+		return nil, err
+	}
+	body.Close()
+	return info, nil
+}
+
+// open reads the object's header. Without decrypt the body is returned
+// positioned after it, for metadata only.
+func (eb *EncryptedBackend) open(ctx context.Context, key string, decrypt bool) (io.ReadCloser, *ObjectInfo, error) {
+	body, info, err := eb.inner.Get(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	source := bufio.NewReaderSize(body, chunkSize+tagSize)
+	h, length, err := readHeader(source)
+	if err == errPlaintext {
+		switch {
+		case !eb.encrypted(key), eb.migrate && !decrypt:
+			return readCloser{source, body}, info, nil
+		case eb.migrate:
+			body.Close()
+			if err := eb.reencrypt(ctx, key); err != nil {
+				return nil, nil, err
+			}
+			return eb.open(ctx, key, true)
+		}
+		body.Close()
+		logging.Warn("unencrypted object refused", map[string]interface{}{
+			"key": key,
+		})
+		return nil, nil, ErrUnencrypted
+	}
+	if err != nil {
+		body.Close()
+		return nil, nil, err
+	}
+
+	decrypted := *info
+	if info.Size >= 0 {
+		decrypted.Size = plainSize(info.Size - int64(length))
+	}
+	if !decrypt {
+		return body, &decrypted, nil
+	}
+
+	dataKey, err := eb.provider.UnwrapKey(ctx, h.keyID, h.wrapped)
+	if err != nil {
+		body.Close()
+		return nil, nil, fmt.Errorf("failed to unwrap data key for %s: %v", key, err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		body.Close()
+		return nil, nil, err
+	}
+	opener := &openReader{
+		chunks: chunks{aead: aead, prefix: h.prefix, key: []byte(key)},
+		source: source,
+		sealed: make([]byte, chunkSize+tagSize),
+	}
+	return readCloser{opener, body}, &decrypted, nil
+}
+
+// reencrypt seals an object stored before encryption was enabled in place
+func (eb *EncryptedBackend) reencrypt(ctx context.Context, key string) error {
+	body, info, err := eb.inner.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	source := bufio.NewReader(body)
+	if _, _, err := readHeader(source); err != errPlaintext {
+		return err // Sealed meanwhile, or damaged
+	}
+	if err := eb.Put(ctx, key, source, info.Size, info.ContentType); err != nil {
+		return fmt.Errorf("failed to re-encrypt %s: %v", key, err)
+	}
+	logging.Info("unencrypted object re-encrypted", map[string]interface{}{
+		"key":  key,
+		"size": info.Size,
+	})
+	return nil
+}
+
+// Delete removes the object
+func (eb *EncryptedBackend) Delete(ctx context.Context, key string) error {
+	return eb.inner.Delete(ctx, key)
+}
+
+// List returns objects with their stored, not decrypted, sizes
+func (eb *EncryptedBackend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	return eb.inner.List(ctx, prefix)
+}
+
+// SignedURL returns a daemon-relative URL; the object store only ever holds
+// ciphertext, so clients cannot be sent to it directly
+func (eb *EncryptedBackend) SignedURL(key, method string, ttl time.Duration) (string, error) {
+	namespace, name, _ := strings.Cut(key, "/")
+	if _, err := Key(namespace, name); err != nil {
+		return "", err
+	}
+	return eb.signer.url(key, method, ttl), nil
+}
+
+// ServeHTTP serves signed GET/HEAD downloads and PUT uploads under
+// SignedPathPrefix, decrypting and encrypting on the way through
+func (eb *EncryptedBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key, ok := eb.signer.verify(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		body, info, err := eb.Get(r.Context(), key)
+		if err == ErrNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Storage error", http.StatusInternalServerError)
+			return
+		}
+		defer body.Close()
+		if info.ContentType != "" {
+			w.Header().Set("Content-Type", info.ContentType)
+		}
+		if info.Size >= 0 {
+			w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+		}
+		w.Header().Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+		if r.Method == http.MethodHead {
+			return
+		}
+		if _, err := io.Copy(w, body); err != nil {
+			// Headers are gone; a short body tells the client it failed
+			logging.Error("signed download failed", map[string]interface{}{
+				"key":   key,
+				"error": err.Error(),
+			})
+		}
+	case http.MethodPut:
+		if err := eb.Put(r.Context(), key, r.Body, r.ContentLength, r.Header.Get("Content-Type")); err != nil {
+			logging.Error("signed upload failed", map[string]interface{}{
+				"key":   key,
+				"error": err.Error(),
+			})
+			http.Error(w, "Storage error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// header precedes the sealed chunks of an encrypted object
+type header struct {
+	keyID   string
+	wrapped []byte
+	prefix  []byte
+}
+
+func (h header) marshal() []byte {
+	encoded := []byte(encryptionMagic)
+	encoded = append(encoded, encryptionVersion, byte(len(h.keyID)))
+	encoded = append(encoded, h.keyID...)
+	encoded = binary.BigEndian.AppendUint16(encoded, uint16(len(h.wrapped)))
+	encoded = append(encoded, h.wrapped...)
+	return append(encoded, h.prefix...)
+}
+
+// readHeader consumes an object's header and returns it with its length,
+// or errPlaintext, consuming nothing, when the object is not encrypted
+func readHeader(r *bufio.Reader) (header, int, error) {
+	var h header
+	start, err := r.Peek(len(encryptionMagic) + 1)
+	if err != nil || string(start[:len(encryptionMagic)]) != encryptionMagic || start[len(encryptionMagic)] != encryptionVersion {
+		return h, 0, errPlaintext
+	}
+	r.Discard(len(start))
+
+	length := len(start)
+	field := func(n int) ([]byte, error) {
+		value := make([]byte, n)
+		if _, err := io.ReadFull(r, value); err != nil {
+			return nil, ErrTampered
+		}
+		length += n
+		return value, nil
+	}
+
+	size, err := field(1)
+	if err != nil {
+		return h, 0, err
+	}
+	keyID, err := field(int(size[0]))
+	if err != nil {
+		return h, 0, err
+	}
+	if size, err = field(2); err != nil {
+		return h, 0, err
+	}
+	if h.wrapped, err = field(int(binary.BigEndian.Uint16(size))); err != nil {
+		return h, 0, err
+	}
+	if h.prefix, err = field(noncePrefixSize); err != nil {
+		return h, 0, err
+	}
+	h.keyID = string(keyID)
+	return h, length, nil
+}
+
+// sealedSize is the stored size of plain bytes: every chunk, and at least
+// one, carries a tag
+func sealedSize(plain int64) int64 {
+	count := (plain + chunkSize - 1) / chunkSize
+	if count == 0 {
+		count = 1
+	}
+	return plain + count*tagSize
+}
+
+// plainSize inverts sealedSize
+func plainSize(sealed int64) int64 {
+	count := (sealed + chunkSize + tagSize - 1) / (chunkSize + tagSize)
+	return sealed - count*tagSize
+}
+
+// chunks holds what sealing and opening one object's chunks share
+type chunks struct {
+	aead   cipher.AEAD
+	prefix []byte
+	key    []byte // Object key, authenticated with every chunk
+	index  uint32
+}
+
+// nonce is the prefix, the chunk index and whether the chunk is the last
+func (c *chunks) nonce(last bool) ([]byte, error) {
+	if c.index == ^uint32(0) {
+		return nil, fmt.Errorf("object too large to encrypt")
+	}
+	nonce := make([]byte, 0, noncePrefixSize+5)
+	nonce = append(nonce, c.prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, c.index)
+	if last {
+		return append(nonce, 1), nil
+	}
+	return append(nonce, 0), nil
+}
+
+// last reports whether source is exhausted after a chunk of n bytes
+// filling size bytes
+func last(source *bufio.Reader, n, size int) (bool, error) {
+	if n < size {
+		return true, nil
+	}
+	if _, err := source.Peek(1); err == io.EOF {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// sealReader encrypts a plaintext stream chunk by chunk
+type sealReader struct {
+	chunks
+	source *bufio.Reader
+	plain  []byte
+	buffer []byte
+	out    []byte
+	done   bool
+}
+
+func (s *sealReader) Read(p []byte) (int, error) {
+	for len(s.out) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(s.source, s.plain)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		if s.done, err = last(s.source, n, len(s.plain)); err != nil {
+			return 0, err
+		}
+		nonce, err := s.nonce(s.done)
+		if err != nil {
+			return 0, err
+		}
+		s.buffer = s.aead.Seal(s.buffer[:0], nonce, s.plain[:n], s.key)
+		s.out = s.buffer
+		s.index++
+	}
+	n := copy(p, s.out)
+	s.out = s.out[n:]
+	return n, nil
+}
+
+// openReader decrypts a sealed stream chunk by chunk
+type openReader struct {
+	chunks
+	source *bufio.Reader
+	sealed []byte
+	buffer []byte
+	out    []byte
+	done   bool
+}
+
+func (o *openReader) Read(p []byte) (int, error) {
+	for len(o.out) == 0 {
+		if o.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(o.source, o.sealed)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		if o.done, err = last(o.source, n, len(o.sealed)); err != nil {
+			return 0, err
+		}
+		nonce, err := o.nonce(o.done)
+		if err != nil {
+			return 0, err
+		}
+		if o.buffer, err = o.aead.Open(o.buffer[:0], nonce, o.sealed[:n], o.key); err != nil {
+			return 0, ErrTampered
+		}
+		o.out = o.buffer
+		o.index++
+	}
+	n := copy(p, o.out)
+	o.out = o.out[n:]
+	return n, nil
+}
+
+// readCloser reads through a wrapper and closes the underlying body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"testing"
+)
+
+const (
+	testSealedKey = NamespaceRecordings + "/session-1.json"
+	testPlainKey  = NamespaceExports + "/world_one.json"
+)
+
+var testContent = bytes.Repeat([]byte("recorded frame\n"), chunkSize/8)
+
+// newTestEncryptedBackend returns a backend encrypting recordings, over a
+// filesystem backend it also returns
+func newTestEncryptedBackend(t *testing.T, migrate bool) (*EncryptedBackend, *FilesystemBackend) {
+	t.Helper()
+	inner, err := NewFilesystemBackend(t.TempDir(), "")
+	if err != nil {
+		t.Fatalf("creating backend: %v", err)
+	}
+	provider, err := newStaticKeyProvider("k1:" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, dataKeySize)))
+	if err != nil {
+		t.Fatalf("creating key provider: %v", err)
+	}
+	eb := &EncryptedBackend{
+		inner:      inner,
+		provider:   provider,
+		namespaces: map[string]bool{NamespaceRecordings: true},
+		migrate:    migrate,
+	}
+	return eb, inner
+}
+
+// putTestObject stores content under key
+func putTestObject(t *testing.T, backend Backend, key string, content []byte) {
+	t.Helper()
+	if err := backend.Put(context.Background(), key, bytes.NewReader(content), int64(len(content)), "application/json"); err != nil {
+		t.Fatalf("storing %s: %v", key, err)
+	}
+}
+
+// readTestObject returns an object's content, or the error opening or
+// reading it
+func readTestObject(backend Backend, key string) ([]byte, error) {
+	body, _, err := backend.Get(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+func TestEncryptedBackendRefusesPlaintextUnlessMigrating(t *testing.T) {
+	tests := []struct {
+		name    string
+		migrate bool
+		key     string
+		// store writes the object under key, through the encrypted backend
+		// or straight to the one beneath it
+		store  func(t *testing.T, eb *EncryptedBackend, inner Backend, key string)
+		stat   bool  // Stat the object before reading it
+		want   error // From reading the object back
+		sealed bool  // The stored object is encrypted afterwards
+	}{
+		{
+			name: "object written through the backend is sealed and reads back",
+			key:  testSealedKey,
+			store: func(t *testing.T, eb *EncryptedBackend, inner Backend, key string) {
+				putTestObject(t, eb, key, testContent)
+			},
+			want:   nil,
+			sealed: true,
+		},
+		{
+			name: "plaintext in an encrypted namespace is refused",
+			key:  testSealedKey,
+			store: func(t *testing.T, eb *EncryptedBackend, inner Backend, key string) {
+				putTestObject(t, inner, key, testContent)
+			},
+			want:   ErrUnencrypted,
+			sealed: false,
+		},
+		{
+			name:    "plaintext read while migrating is re-encrypted",
+			migrate: true,
+			key:     testSealedKey,
+			store: func(t *testing.T, eb *EncryptedBackend, inner Backend, key string) {
+				putTestObject(t, inner, key, testContent)
+			},
+			want:   nil,
+			sealed: true,
+		},
+		{
+			name:    "plaintext statted while migrating stays as stored until read",
+			migrate: true,
+			key:     testSealedKey,
+			store: func(t *testing.T, eb *EncryptedBackend, inner Backend, key string) {
+				putTestObject(t, inner, key, testContent)
+			},
+			stat:   true,
+			want:   nil,
+			sealed: true,
+		},
+		{
+			name: "plaintext outside the encrypted namespaces is read as stored",
+			key:  testPlainKey,
+			store: func(t *testing.T, eb *EncryptedBackend, inner Backend, key string) {
+				putTestObject(t, eb, key, testContent)
+			},
+			want:   nil,
+			sealed: false,
+		},
+		{
+			name: "ciphertext moved to another key fails authentication",
+			key:  testSealedKey,
+			store: func(t *testing.T, eb *EncryptedBackend, inner Backend, key string) {
+				putTestObject(t, eb, NamespaceRecordings+"/session-2.json", testContent)
+				sealed, err := readTestObject(inner, NamespaceRecordings+"/session-2.json")
+				if err != nil {
+					t.Fatalf("reading sealed object: %v", err)
+				}
+				putTestObject(t, inner, key, sealed)
+			},
+			want:   ErrTampered,
+			sealed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eb, inner := newTestEncryptedBackend(t, tt.migrate)
+			tt.store(t, eb, inner, tt.key)
+
+			if tt.stat {
+				info, err := eb.Stat(context.Background(), tt.key)
+				if err != nil {
+					t.Fatalf("Stat: %v", err)
+				}
+				if info.Size != int64(len(testContent)) {
+					t.Errorf("Stat size = %d, want %d", info.Size, len(testContent))
+				}
+				if stored, _ := readTestObject(inner, tt.key); !bytes.Equal(stored, testContent) {
+					t.Errorf("Stat changed the stored object")
+				}
+			}
+
+			got, err := readTestObject(eb, tt.key)
+			if err != tt.want {
+				t.Fatalf("reading %s: %v, want %v", tt.key, err, tt.want)
+			}
+			if err == nil && !bytes.Equal(got, testContent) {
+				t.Errorf("read %d bytes differing from the %d stored", len(got), len(testContent))
+			}
+
+			stored, err := readTestObject(inner, tt.key)
+			if err != nil {
+				t.Fatalf("reading stored object: %v", err)
+			}
+			if sealed := bytes.HasPrefix(stored, []byte(encryptionMagic)); sealed != tt.sealed {
+				t.Errorf("stored object sealed = %v, want %v", sealed, tt.sealed)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"holodeck1/logging"
+)
+
+// SignedPathPrefix is where the daemon serves filesystem signed URLs
+const SignedPathPrefix = "/storage/"
+
+// FilesystemBackend stores objects as files below a root directory
+type FilesystemBackend struct {
+	root   string
+	signer *urlSigner
+}
+
+// NewFilesystemBackend creates the root directory if needed. An empty
+// signingKey generates a random per-process key.
+func NewFilesystemBackend(root, signingKey string) (*FilesystemBackend, error) {
+	if root == "" {
+		return nil, fmt.Errorf("filesystem storage requires a directory")
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory %s: %v", root, err)
+	}
+
+	signer, err := newURLSigner(signingKey)
+	if err != nil {
+		return nil, err
+	}
+	return &FilesystemBackend{root: root, signer: signer}, nil
+}
+
+// Name identifies the backend
+func (fb *FilesystemBackend) Name() string {
+	return "filesystem"
+}
+
+// path maps a key to a file below root
+func (fb *FilesystemBackend) path(key string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash("/" + key))
+	if clean == string(filepath.Separator) || strings.Contains(key, "..") {
+		return "", fmt.Errorf("invalid object key: %q", key)
+	}
+	return filepath.Join(fb.root, clean), nil
+}
+
+// Put writes the object atomically via a temporary file
+func (fb *FilesystemBackend) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	target, err := fb.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// Get opens the object for reading
+func (fb *FilesystemBackend) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	info, err := fb.Stat(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	target, _ := fb.path(key)
+	file, err := os.Open(target)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, info, nil
+}
+
+// Stat returns object metadata
+func (fb *FilesystemBackend) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	target, err := fb.path(key)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(target)
+	if os.IsNotExist(err) || (err == nil && stat.IsDir()) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectInfo{
+		Key:          key,
+		Size:         stat.Size(),
+		ContentType:  mime.TypeByExtension(filepath.Ext(target)),
+		LastModified: stat.ModTime().UTC(),
+	}, nil
+}
+
+// Delete removes the object; deleting a missing object is not an error
+func (fb *FilesystemBackend) Delete(ctx context.Context, key string) error {
+	target, err := fb.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List returns all objects whose key starts with prefix
+func (fb *FilesystemBackend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := filepath.Walk(fb.root, func(file string, stat os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if stat.IsDir() || strings.HasPrefix(stat.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(fb.root, file)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, ObjectInfo{
+				Key:          key,
+				Size:         stat.Size(),
+				ContentType:  mime.TypeByExtension(filepath.Ext(file)),
+				LastModified: stat.ModTime().UTC(),
+			})
+		}
+		return nil
+	})
+	return objects, err
+}
+
+// SignedURL returns a daemon-relative URL valid until ttl elapses
+func (fb *FilesystemBackend) SignedURL(key, method string, ttl time.Duration) (string, error) {
+	if _, err := fb.path(key); err != nil {
+		return "", err
+	}
+	return fb.signer.url(key, method, ttl), nil
+}
+
+// ServeHTTP serves signed GET/HEAD downloads and PUT uploads under SignedPathPrefix
+func (fb *FilesystemBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key, ok := fb.signer.verify(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		body, info, err := fb.Get(r.Context(), key)
+		if err == ErrNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Storage error", http.StatusInternalServerError)
+			return
+		}
+		defer body.Close()
+		if info.ContentType != "" {
+			w.Header().Set("Content-Type", info.ContentType)
+		}
+		http.ServeContent(w, r, filepath.Base(key), info.LastModified, body.(io.ReadSeeker))
+	case http.MethodPut:
+		if err := fb.Put(r.Context(), key, r.Body, r.ContentLength, r.Header.Get("Content-Type")); err != nil {
+			logging.Error("signed upload failed", map[string]interface{}{
+				"key":   key,
+				"error": err.Error(),
+			})
+			http.Error(w, "Storage error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// urlSigner issues and checks the daemon-served signed URLs below
+// SignedPathPrefix
+type urlSigner struct {
+	key []byte
+}
+
+// newURLSigner uses secret as the HMAC key, or a random per-process key
+// when it is empty
+func newURLSigner(secret string) (*urlSigner, error) {
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate signing key: %v", err)
+		}
+	}
+	return &urlSigner{key: key}, nil
+}
+
+func (s *urlSigner) url(key, method string, ttl time.Duration) string {
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	query := url.Values{}
+	query.Set("method", method)
+	query.Set("expires", expires)
+	query.Set("signature", s.sign(method, key, expires))
+	return SignedPathPrefix + key + "?" + query.Encode()
+}
+
+func (s *urlSigner) sign(method, key, expires string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(method + "\n" + key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify checks a request's signature and expiry, answering 403 when
+// either fails, and returns the object key
+func (s *urlSigner) verify(w http.ResponseWriter, r *http.Request) (string, bool) {
+	key := strings.TrimPrefix(r.URL.Path, SignedPathPrefix)
+	query := r.URL.Query()
+	method := query.Get("method")
+	expires := query.Get("expires")
+
+	signedMethod := r.Method
+	if signedMethod == http.MethodHead {
+		signedMethod = http.MethodGet
+	}
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || method != signedMethod ||
+		!hmac.Equal([]byte(query.Get("signature")), []byte(s.sign(method, key, expires))) {
+		http.Error(w, "Invalid signature", http.StatusForbidden)
+		return "", false
+	}
+	if time.Now().Unix() > expiresAt {
+		http.Error(w, "Signed URL expired", http.StatusForbidden)
+		return "", false
+	}
+	return key, true
+}
@@ -0,0 +1,25 @@
+package storage
+
+import "fmt"
+
+// gcsEndpoint is the S3-interoperable XML API of Google Cloud Storage
+const gcsEndpoint = "https://storage.googleapis.com"
+
+// NewGCSBackend creates a Google Cloud Storage backend. It uses the XML API's
+// S3 interoperability with HMAC keys (Cloud Storage > Settings >
+// Interoperability), which supports SigV4 requests and presigned URLs.
+func NewGCSBackend(bucket, prefix, accessKey, secretKey string) (*S3Backend, error) {
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("gcs storage requires HMAC interoperability keys in HD1_STORAGE_ACCESS_KEY and HD1_STORAGE_SECRET_KEY")
+	}
+	return NewS3Backend(S3Options{
+		Name:      "gcs",
+		Endpoint:  gcsEndpoint,
+		Region:    "auto",
+		Bucket:    bucket,
+		Prefix:    prefix,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		PathStyle: true,
+	})
+}
@@ -0,0 +1,401 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unsignedPayload skips body hashing; integrity is covered by TLS
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3Options configures an S3-compatible backend
+type S3Options struct {
+	Name      string // Backend name reported by Name(), default "s3"
+	Endpoint  string // e.g. https://minio.local:9000; empty selects AWS for Region
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool
+}
+
+// S3Backend talks to S3-compatible object stores using AWS Signature V4
+type S3Backend struct {
+	opts     S3Options
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// NewS3Backend validates options and builds the backend. Custom endpoints
+// default to path-style addressing, which every S3 clone supports.
+func NewS3Backend(opts S3Options) (*S3Backend, error) {
+	if opts.Bucket == "" {
+		return nil, fmt.Errorf("s3 storage requires a bucket")
+	}
+	if opts.AccessKey == "" || opts.SecretKey == "" {
+		return nil, fmt.Errorf("s3 storage requires HD1_STORAGE_ACCESS_KEY and HD1_STORAGE_SECRET_KEY")
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.Name == "" {
+		opts.Name = "s3"
+	}
+	opts.Prefix = strings.Trim(opts.Prefix, "/")
+
+	rawEndpoint := opts.Endpoint
+	if rawEndpoint == "" {
+		rawEndpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", opts.Region)
+	} else {
+		opts.PathStyle = true
+	}
+	endpoint, err := url.Parse(rawEndpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid storage endpoint: %s", rawEndpoint)
+	}
+
+	return &S3Backend{
+		opts:     opts,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+// Name identifies the backend
+func (sb *S3Backend) Name() string {
+	return sb.opts.Name
+}
+
+// objectURL returns the unsigned URL of an object (key may be empty for the bucket)
+func (sb *S3Backend) objectURL(key string) *url.URL {
+	u := *sb.endpoint
+	objectPath := sb.fullKey(key)
+	if sb.opts.PathStyle {
+		u.Path = "/" + sb.opts.Bucket
+		if objectPath != "" {
+			u.Path += "/" + objectPath
+		}
+	} else {
+		u.Host = sb.opts.Bucket + "." + u.Host
+		u.Path = "/" + objectPath
+	}
+	u.RawPath = ""
+	return &u
+}
+
+func (sb *S3Backend) fullKey(key string) string {
+	if key == "" || sb.opts.Prefix == "" {
+		return key
+	}
+	return sb.opts.Prefix + "/" + key
+}
+
+// Put uploads an object with a single PUT
+func (sb *S3Backend) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, sb.objectURL(key).String(), body)
+	if err != nil {
+		return err
+	}
+	if size >= 0 {
+		req.ContentLength = size
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := sb.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get downloads an object; the caller closes the returned reader
+func (sb *S3Backend) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sb.objectURL(key).String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := sb.do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.Body, objectInfoFromHeaders(key, resp), nil
+}
+
+// Stat issues a HEAD request for object metadata
+func (sb *S3Backend) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, sb.objectURL(key).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := sb.do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return objectInfoFromHeaders(key, resp), nil
+}
+
+// Delete removes an object; S3 reports success for missing keys
+func (sb *S3Backend) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, sb.objectURL(key).String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := sb.do(req)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return nil
+}
+
+// listBucketResult is the subset of ListObjectsV2 output HD1 needs
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		ETag         string    `xml:"ETag"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List pages through ListObjectsV2 for every key under prefix
+func (sb *S3Backend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	token := ""
+	for {
+		u := sb.objectURL("")
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", sb.fullKey(prefix))
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		u.RawQuery = query.Encode()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := sb.do(req)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid list response: %v", err)
+		}
+
+		for _, content := range result.Contents {
+			key := content.Key
+			if sb.opts.Prefix != "" {
+				key = strings.TrimPrefix(key, sb.opts.Prefix+"/")
+			}
+			objects = append(objects, ObjectInfo{
+				Key:          key,
+				Size:         content.Size,
+				ETag:         strings.Trim(content.ETag, `"`),
+				LastModified: content.LastModified,
+			})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// SignedURL returns a SigV4 presigned URL for direct client access
+func (sb *S3Backend) SignedURL(key, method string, ttl time.Duration) (string, error) {
+	seconds := int64(ttl / time.Second)
+	if seconds < 1 || seconds > 604800 {
+		return "", fmt.Errorf("signed URL lifetime must be between 1s and 7 days")
+	}
+	return sb.presign(sb.objectURL(key), method, seconds, time.Now().UTC()), nil
+}
+
+// presign adds SigV4 query authentication to u
+func (sb *S3Backend) presign(u *url.URL, method string, seconds int64, now time.Time) string {
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", sb.opts.AccessKey+"/"+sb.scope(now))
+	query.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", strconv.FormatInt(seconds, 10))
+	query.Set("X-Amz-SignedHeaders", "host")
+	u.RawQuery = canonicalQuery(query)
+
+	canonical := strings.Join([]string{
+		method,
+		canonicalPath(u.Path),
+		u.RawQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+	u.RawQuery += "&X-Amz-Signature=" + sb.signature(now, canonical)
+	return u.String()
+}
+
+// do signs and sends a request, mapping 404 to ErrNotFound
+func (sb *S3Backend) do(req *http.Request) (*http.Response, error) {
+	sb.signRequest(req, time.Now().UTC())
+	resp, err := sb.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s: %s", req.Method, sb.Name(), resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return resp, nil
+}
+
+// signRequest adds SigV4 Authorization headers
+func (sb *S3Backend) signRequest(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": unsignedPayload,
+		"x-amz-date":           amzDate,
+	}
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		headers["content-type"] = contentType
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		canonicalPath(req.URL.Path),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sb.opts.AccessKey, sb.scope(now), signedHeaders, sb.signature(now, canonical)))
+}
+
+func (sb *S3Backend) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + sb.opts.Region + "/s3/aws4_request"
+}
+
+// signature derives the SigV4 signing key and signs the canonical request
+func (sb *S3Backend) signature(now time.Time, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format("20060102T150405Z"),
+		sb.scope(now),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+sb.opts.SecretKey), now.Format("20060102"))
+	key = hmacSHA256(key, sb.opts.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalPath URI-encodes each path segment as SigV4 requires
+func canonicalPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery sorts and strictly encodes query parameters
+func canonicalQuery(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		vals := append([]string(nil), values[key]...)
+		sort.Strings(vals)
+		for _, value := range vals {
+			parts = append(parts, uriEncode(key)+"="+uriEncode(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes everything except RFC 3986 unreserved characters
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func objectInfoFromHeaders(key string, resp *http.Response) *ObjectInfo {
+	info := &ObjectInfo{
+		Key:         key,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag:        strings.Trim(resp.Header.Get("ETag"), `"`),
+	}
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.LastModified = modified.UTC()
+	}
+	return info
+}
@@ -0,0 +1,161 @@
+// Package storage abstracts where HD1 keeps binary content - assets,
+// recordings and world exports - so multi-node deployments can share an
+// object store instead of a local disk.
+//
+// Backends:
+//   - filesystem: local directory, signed URLs served by the daemon at /storage/
+//   - s3: AWS S3 or any S3-compatible store (MinIO, R2, Ceph)
+//   - gcs: Google Cloud Storage through its S3-interoperable XML API (HMAC keys)
+//
+// Any backend can be wrapped to encrypt objects at rest (see encryption.go).
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+)
+
+// Namespaces partition the key space by content type. Only assets,
+// recordings and exports are exposed through signed URLs, and assets for
+// download only.
+const (
+	NamespaceAssets     = "assets"
+	NamespaceRecordings = "recordings"
+	NamespaceExports    = "exports"
+	// NamespaceWorlds holds server-managed per-world state (e.g. anchors)
+	NamespaceWorlds = "worlds"
+	// NamespaceConsent holds the terms and privacy consent people gave
+	NamespaceConsent = "consent"
+	// NamespaceCompliance holds compliance records such as legal holds
+	NamespaceCompliance = "compliance"
+	// NamespaceOrganizations holds organization settings such as their plan
+	NamespaceOrganizations = "organizations"
+)
+
+// MaxSignedURLTTL bounds how long a signed URL stays valid
+const MaxSignedURLTTL = time.Hour
+
+// ErrNotFound is returned when an object does not exist
+var ErrNotFound = errors.New("object not found")
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// Backend is implemented by every storage provider. Keys are slash-separated
+// and always start with a namespace (see Key).
+type Backend interface {
+	// Name identifies the backend in logs and API responses
+	Name() string
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// SignedURL returns a time-limited URL letting clients GET or PUT the
+	// object directly without further authentication
+	SignedURL(key, method string, ttl time.Duration) (string, error)
+}
+
+var (
+	defaultBackend Backend
+	defaultMutex   sync.RWMutex
+)
+
+// Initialize creates the configured backend and makes it the default
+func Initialize() error {
+	backend, err := New(config.GetStorageBackend())
+	if err != nil {
+		return err
+	}
+	encryption := config.GetStorageEncryptionProvider()
+	if encryption != "" {
+		if backend, err = NewEncryptedBackend(backend, encryption, config.GetStorageEncryptionNamespaces()); err != nil {
+			return err
+		}
+	}
+
+	defaultMutex.Lock()
+	defaultBackend = backend
+	defaultMutex.Unlock()
+
+	logging.Info("storage backend initialized", map[string]interface{}{
+		"backend":    backend.Name(),
+		"bucket":     config.GetStorageBucket(),
+		"prefix":     config.GetStoragePrefix(),
+		"encryption": encryption,
+	})
+	return nil
+}
+
+// New creates a backend by name from the current configuration
+func New(name string) (Backend, error) {
+	switch name {
+	case "", "filesystem":
+		return NewFilesystemBackend(config.GetStorageDir(), config.GetStorageSigningKey())
+	case "s3":
+		return NewS3Backend(S3Options{
+			Endpoint:  config.GetStorageEndpoint(),
+			Region:    config.GetStorageRegion(),
+			Bucket:    config.GetStorageBucket(),
+			Prefix:    config.GetStoragePrefix(),
+			AccessKey: config.GetStorageAccessKey(),
+			SecretKey: config.GetStorageSecretKey(),
+			PathStyle: config.GetStoragePathStyle(),
+		})
+	case "gcs":
+		return NewGCSBackend(config.GetStorageBucket(), config.GetStoragePrefix(),
+			config.GetStorageAccessKey(), config.GetStorageSecretKey())
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", name)
+	}
+}
+
+// Default returns the configured backend, lazily initializing it
+func Default() Backend {
+	defaultMutex.RLock()
+	backend := defaultBackend
+	defaultMutex.RUnlock()
+	if backend != nil {
+		return backend
+	}
+
+	if err := Initialize(); err != nil {
+		logging.Error("storage backend unavailable", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return nil
+	}
+	defaultMutex.RLock()
+	defer defaultMutex.RUnlock()
+	return defaultBackend
+}
+
+// Key builds a namespaced object key, rejecting traversal and empty names
+func Key(namespace, name string) (string, error) {
+	switch namespace {
+	case NamespaceAssets, NamespaceRecordings, NamespaceExports, NamespaceWorlds, NamespaceConsent, NamespaceCompliance, NamespaceOrganizations:
+	default:
+		return "", fmt.Errorf("unknown storage namespace: %s", namespace)
+	}
+
+	clean := path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+	if clean == "/" || strings.Contains(name, "..") {
+		return "", fmt.Errorf("invalid object name: %q", name)
+	}
+	return namespace + clean, nil
+}
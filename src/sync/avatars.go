@@ -0,0 +1,171 @@
+package sync
+
+import (
+	"sort"
+	"time"
+
+	"holodeck1/logging"
+)
+
+// Reasons carried by avatar_leave
+const (
+	LeaveDisconnected = "disconnected"
+	LeaveSessionEnded = "session_ended"
+	LeaveIdle         = "idle"
+	LeavePortal       = "portal" // Carried to another server's world
+)
+
+// AvatarPresence is an avatar the operation log says is in a world
+type AvatarPresence struct {
+	ID       string    `json:"hd1_id"`
+	Owner    string    `json:"owner"` // Session that created it
+	World    string    `json:"world,omitempty"`
+	JoinedAt time.Time `json:"joined_at"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// trackAvatar follows avatar operations so avatars can be unregistered when
+// their session goes away; callers hold the mutex
+func (rs *ReliableSync) trackAvatar(op *Operation) {
+	avatarID, _ := op.Data["hd1_id"].(string)
+	if avatarID == "" {
+		return
+	}
+
+	switch op.Type {
+	case OpAvatarCreate:
+		world, _ := op.Data["world"].(string)
+		rs.avatars[avatarID] = &AvatarPresence{
+			ID:       avatarID,
+			Owner:    op.ClientID,
+			World:    world,
+			JoinedAt: op.Timestamp,
+			LastSeen: op.Timestamp,
+		}
+	case OpAvatarMove, OpAvatarUpdate:
+		if avatar, exists := rs.avatars[avatarID]; exists {
+			avatar.LastSeen = op.Timestamp
+		}
+	case OpAvatarRemove, OpAvatarLeave:
+		delete(rs.avatars, avatarID)
+	}
+}
+
+// GetAvatar returns an avatar the operation log says is present
+func (rs *ReliableSync) GetAvatar(avatarID string) (AvatarPresence, bool) {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+	if avatar, exists := rs.avatars[avatarID]; exists {
+		return *avatar, true
+	}
+	return AvatarPresence{}, false
+}
+
+// AvatarCount returns how many avatars the operation log says are present
+func (rs *ReliableSync) AvatarCount() int {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+	return len(rs.avatars)
+}
+
+// UnregisterAvatar broadcasts avatar_leave for an avatar and stops tracking
+// it; nil when the avatar is not present
+func (rs *ReliableSync) UnregisterAvatar(avatarID, reason string) *Operation {
+	rs.mutex.RLock()
+	avatar, exists := rs.avatars[avatarID]
+	rs.mutex.RUnlock()
+	if !exists {
+		return nil
+	}
+	return rs.submitLeave(avatar, reason)
+}
+
+// UnregisterSessionAvatars broadcasts avatar_leave for every avatar a
+// session created, including ones created over the REST API
+func (rs *ReliableSync) UnregisterSessionAvatars(owner, reason string) []*Operation {
+	var leaves []*Operation
+	for _, avatar := range rs.collectAvatars(func(avatar *AvatarPresence) bool {
+		return avatar.Owner == owner
+	}) {
+		if op := rs.submitLeave(avatar, reason); op != nil {
+			leaves = append(leaves, op)
+		}
+	}
+	return leaves
+}
+
+// EvictIdleAvatars removes avatars of sessions that are no longer live once
+// they have not been seen for their world's timeout; a timeout of 0 keeps a
+// world's avatars
+func (rs *ReliableSync) EvictIdleAvatars(timeout func(world string) time.Duration, live func(owner string) bool) []*Operation {
+	now := time.Now()
+	idle := rs.collectAvatars(func(avatar *AvatarPresence) bool {
+		limit := timeout(avatar.World)
+		return limit > 0 && now.Sub(avatar.LastSeen) >= limit
+	})
+
+	var evicted []*Operation
+	for _, avatar := range idle {
+		if live(avatar.Owner) {
+			continue
+		}
+		if op := rs.submitLeave(avatar, LeaveIdle); op != nil {
+			evicted = append(evicted, op)
+		}
+	}
+	if len(evicted) > 0 {
+		logging.Info("idle avatars evicted", map[string]interface{}{
+			"count": len(evicted),
+		})
+	}
+	return evicted
+}
+
+// collectAvatars copies the avatars matching keep, oldest first
+func (rs *ReliableSync) collectAvatars(keep func(*AvatarPresence) bool) []*AvatarPresence {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	var matched []*AvatarPresence
+	for _, avatar := range rs.avatars {
+		if keep(avatar) {
+			presence := *avatar
+			matched = append(matched, &presence)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].JoinedAt.Before(matched[j].JoinedAt) })
+	return matched
+}
+
+// submitLeave broadcasts avatar_leave unless the avatar left meanwhile
+func (rs *ReliableSync) submitLeave(avatar *AvatarPresence, reason string) *Operation {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	if _, exists := rs.avatars[avatar.ID]; !exists {
+		return nil
+	}
+
+	data := map[string]interface{}{
+		"hd1_id": avatar.ID,
+		"reason": reason,
+	}
+	if avatar.World != "" {
+		data["world"] = avatar.World
+	}
+	op := &Operation{
+		ClientID: avatar.Owner,
+		Type:     OpAvatarLeave,
+		Data:     data,
+	}
+	rs.submitLocked(op)
+
+	logging.Info("avatar left", map[string]interface{}{
+		"avatar_id": avatar.ID,
+		"hd1_id":    avatar.Owner,
+		"world":     avatar.World,
+		"reason":    reason,
+		"duration":  time.Since(avatar.JoinedAt).String(),
+	})
+	return op
+}
@@ -0,0 +1,139 @@
+package sync
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"holodeck1/logging"
+)
+
+// Store keeps the operations of a hibernating log
+type Store interface {
+	Save(ops []*Operation) error
+	Load() ([]*Operation, error) // Reads them back for the log to hold again
+	Peek() ([]*Operation, error) // Reads them, leaving them stored
+}
+
+// SetStore sets where Hibernate unloads operations to
+func (rs *ReliableSync) SetStore(store Store) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	rs.store = store
+}
+
+// Hibernated reports whether the log's operations are unloaded
+func (rs *ReliableSync) Hibernated() bool {
+	return rs.parked.Load() > 0
+}
+
+// Hibernate saves every stored operation to the store and unloads them,
+// returning how many it unloaded. Sequence numbers carry on, and reading
+// any unloaded operation loads them all back first, so readers never see
+// the difference. Operations submitted while hibernating stay loaded.
+func (rs *ReliableSync) Hibernate() (int, error) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	if rs.store == nil || rs.parked.Load() > 0 || len(rs.operations) == 0 {
+		return 0, nil
+	}
+
+	ops := make([]*Operation, 0, len(rs.operations))
+	for _, op := range rs.operations {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].SeqNum < ops[j].SeqNum })
+	if err := rs.store.Save(ops); err != nil {
+		return 0, err
+	}
+	// A new map, as deleting keys never shrinks one
+	rs.operations = make(map[uint64]*Operation)
+	rs.parked.Store(rs.nextSeqNum - 1)
+	return len(ops), nil
+}
+
+// PeekAllOperations returns every stored operation as GetAllOperations
+// does, but reads a hibernating log's unloaded operations from its store
+// without loading them back, so background readers let it sleep. Should
+// the store fail, the log is woken instead.
+func (rs *ReliableSync) PeekAllOperations() []*Operation {
+	rs.mutex.RLock()
+	parked, store := rs.parked.Load(), rs.store
+	ops := make([]*Operation, 0, len(rs.operations))
+	for _, op := range rs.operations {
+		ops = append(ops, op)
+	}
+	rs.mutex.RUnlock()
+	if parked == 0 {
+		sort.Slice(ops, func(i, j int) bool { return ops[i].SeqNum < ops[j].SeqNum })
+		return ops
+	}
+
+	unloaded, err := store.Peek()
+	if err != nil {
+		// Woken meanwhile, or unreadable: the log itself has them all
+		return rs.GetAllOperations()
+	}
+	for _, op := range unloaded {
+		if op.SeqNum <= parked {
+			ops = append(ops, op)
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].SeqNum < ops[j].SeqNum })
+	return ops
+}
+
+// Wake loads a hibernating log back
+func (rs *ReliableSync) Wake() {
+	rs.wake(1)
+}
+
+// wake loads the unloaded operations back when from is among them
+func (rs *ReliableSync) wake(from uint64) {
+	if from > rs.parked.Load() {
+		return
+	}
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	parked := rs.parked.Load()
+	if parked == 0 {
+		return // Woken while waiting for the lock
+	}
+
+	started := time.Now()
+	ops, err := rs.store.Load()
+	if err != nil {
+		// Stay hibernating so the next read tries again
+		logging.Error("waking hibernated operation log failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	for _, op := range ops {
+		if op.SeqNum <= parked {
+			rs.operations[op.SeqNum] = op
+		}
+	}
+	rs.parked.Store(0)
+	logging.Info("operation log woken", map[string]interface{}{
+		"operations": len(ops),
+		"took_ms":    time.Since(started).Milliseconds(),
+	})
+}
+
+// Resume loads the operations of a log saved by an earlier run into this
+// empty one, under their original sequence numbers
+func (rs *ReliableSync) Resume(ops []*Operation) error {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	if rs.nextSeqNum != 1 || rs.parked.Load() > 0 {
+		return fmt.Errorf("operation log is not empty")
+	}
+	for _, op := range ops {
+		rs.operations[op.SeqNum] = op
+		if op.SeqNum >= rs.nextSeqNum {
+			rs.nextSeqNum = op.SeqNum + 1
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+// Code generated by codegen/generator.go from x-operation-types in the API
+// specification. DO NOT EDIT.
+
+package sync
+
+// Operation types of the sync log
+const (
+	OpAnchorCreate     = "anchor_create"     // Spatial anchor placed
+	OpAnchorDelete     = "anchor_delete"     // Spatial anchor removed
+	OpAnimationControl = "animation_control" // Animation played, paused or stopped
+	OpAnimationCreate  = "animation_create"  // Animation clip defined
+	OpAvatarCreate     = "avatar_create"     // Avatar joined the world
+	OpAvatarLeave      = "avatar_leave"      // Avatar left with its session, with the reason
+	OpAvatarMove       = "avatar_move"       // Avatar moved
+	OpAvatarRemove     = "avatar_remove"     // Avatar removed
+	OpAvatarUpdate     = "avatar_update"     // Avatar appearance or pose changed
+	OpEntityCreate     = "entity_create"     // Entity created, or replaced when its ID exists
+	OpEntityDelete     = "entity_delete"     // Entity deleted
+	OpEntityUpdate     = "entity_update"     // Entity components changed
+	OpMaterialCreate   = "material_create"   // Material defined
+	OpSceneUpdate      = "scene_update"      // Scene properties changed, such as physics or environment
+	OpTextureCreate    = "texture_create"    // Texture defined
+	OpTextureLoad      = "texture_load"      // Texture loaded from a URL
+	OpTransaction      = "transaction"       // Entity operations committed together under one sequence number
+	OpWhiteboardDelta  = "whiteboard_delta"  // Strokes added to or erased from a whiteboard
+)
+
+// declaredOperations are the operation types the specification declares
+var declaredOperations = []OperationType{
+	{Type: OpAnchorCreate, Description: "Spatial anchor placed", Submit: false},
+	{Type: OpAnchorDelete, Description: "Spatial anchor removed", Submit: false},
+	{Type: OpAnimationControl, Description: "Animation played, paused or stopped", Submit: false},
+	{Type: OpAnimationCreate, Description: "Animation clip defined", Submit: false},
+	{Type: OpAvatarCreate, Description: "Avatar joined the world", Submit: true},
+	{Type: OpAvatarLeave, Description: "Avatar left with its session, with the reason", Submit: false},
+	{Type: OpAvatarMove, Description: "Avatar moved", Submit: true},
+	{Type: OpAvatarRemove, Description: "Avatar removed", Submit: true},
+	{Type: OpAvatarUpdate, Description: "Avatar appearance or pose changed", Submit: false},
+	{Type: OpEntityCreate, Description: "Entity created, or replaced when its ID exists", Submit: true},
+	{Type: OpEntityDelete, Description: "Entity deleted", Submit: true},
+	{Type: OpEntityUpdate, Description: "Entity components changed", Submit: true},
+	{Type: OpMaterialCreate, Description: "Material defined", Submit: false},
+	{Type: OpSceneUpdate, Description: "Scene properties changed, such as physics or environment", Submit: true},
+	{Type: OpTextureCreate, Description: "Texture defined", Submit: false},
+	{Type: OpTextureLoad, Description: "Texture loaded from a URL", Submit: false},
+	{Type: OpTransaction, Description: "Entity operations committed together under one sequence number", Submit: false},
+	{Type: OpWhiteboardDelta, Description: "Strokes added to or erased from a whiteboard", Submit: true},
+}
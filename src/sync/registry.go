@@ -0,0 +1,119 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Handler checks the data of an operation before it is sequenced; an error
+// refuses the operation
+type Handler func(data map[string]interface{}) error
+
+// OperationType is a registered operation type
+type OperationType struct {
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+	Submit      bool   `json:"submit"` // Clients may send it to /sync/operations
+
+	handlers []Handler
+}
+
+// ErrUnknownOperation is returned for operations of unregistered types
+var ErrUnknownOperation = errors.New("unknown operation type")
+
+var typePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+var (
+	operationTypes = map[string]*OperationType{}
+	operationMutex sync.RWMutex
+)
+
+func init() {
+	for _, declared := range declaredOperations {
+		operationType := declared
+		operationTypes[operationType.Type] = &operationType
+	}
+}
+
+// RegisterOperation adds a handler checking operations of a type before
+// they are sequenced. Handlers run in registration order. A type the API
+// specification does not declare is registered with its first handler,
+// and clients may submit it. Malformed types panic, like duplicate HTTP
+// routes, as they are programming errors.
+func RegisterOperation(opType string, handler Handler) {
+	if !typePattern.MatchString(opType) {
+		panic(fmt.Sprintf("sync: operation type %q must match %s", opType, typePattern))
+	}
+	if handler == nil {
+		panic("sync: nil handler for operation type " + opType)
+	}
+	operationMutex.Lock()
+	defer operationMutex.Unlock()
+	operationType, ok := operationTypes[opType]
+	if !ok {
+		operationType = &OperationType{Type: opType, Submit: true}
+		operationTypes[opType] = operationType
+	}
+	operationType.handlers = append(operationType.handlers, handler)
+}
+
+// Registered reports whether an operation type is registered
+func Registered(opType string) bool {
+	operationMutex.RLock()
+	defer operationMutex.RUnlock()
+	_, ok := operationTypes[opType]
+	return ok
+}
+
+// OperationTypes returns the registered operation types by type
+func OperationTypes() []OperationType {
+	operationMutex.RLock()
+	defer operationMutex.RUnlock()
+	list := make([]OperationType, 0, len(operationTypes))
+	for _, operationType := range operationTypes {
+		list = append(list, *operationType)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Type < list[j].Type })
+	return list
+}
+
+// CheckSubmission checks an operation a client submits: its type must be
+// registered and open to clients, and its handlers must accept its data.
+// Errors name the types clients may submit.
+func CheckSubmission(opType string, data map[string]interface{}) error {
+	operationMutex.RLock()
+	operationType, ok := operationTypes[opType]
+	var handlers []Handler
+	if ok {
+		handlers = operationType.handlers
+	}
+	operationMutex.RUnlock()
+
+	switch {
+	case !ok:
+		return fmt.Errorf("%w %q, expected one of %s", ErrUnknownOperation, opType, strings.Join(submittable(), ", "))
+	case !operationType.Submit:
+		return fmt.Errorf("%s operations are sequenced by the server, submit one of %s", opType, strings.Join(submittable(), ", "))
+	}
+	for _, handler := range handlers {
+		if err := handler(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// submittable returns the types clients may submit, sorted
+func submittable() []string {
+	types := []string{}
+	for _, operationType := range OperationTypes() {
+		if operationType.Submit {
+			types = append(types, operationType.Type)
+		}
+	}
+	return types
+}
@@ -4,6 +4,7 @@ package sync
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 	
 	"holodeck1/logging"
@@ -13,7 +14,7 @@ import (
 type Operation struct {
 	SeqNum    uint64                 `json:"seq_num"`    // Global sequence number
 	ClientID  string                 `json:"client_id"`  // Who sent it
-	Type      string                 `json:"type"`       // "avatar_move", "entity_create", etc.
+	Type      string                 `json:"type"`       // A registered type, such as OpEntityCreate
 	Data      map[string]interface{} `json:"data"`       // The actual change
 	Timestamp time.Time              `json:"timestamp"`  // When it happened
 }
@@ -29,9 +30,19 @@ type ReliableSync struct {
 	clientLastSeen map[string]uint64
 	clients        map[string]chan *Operation
 	
+	// Avatars present, by avatar ID
+	avatars        map[string]*AvatarPresence
+	
 	// Cleanup
 	maxOperations  int
 	cleanupCounter uint64
+	
+	// Hibernation: operations up to parked are unloaded into the store
+	parked         atomic.Uint64
+	store          Store
+	
+	// Closed when the next operation is sequenced, for long polls
+	sequenced      chan struct{}
 }
 
 // NewReliableSync creates a new TCP-simple sync system
@@ -41,6 +52,7 @@ func NewReliableSync() *ReliableSync {
 		operations:     make(map[uint64]*Operation),
 		clientLastSeen: make(map[string]uint64),
 		clients:        make(map[string]chan *Operation),
+		avatars:        make(map[string]*AvatarPresence),
 		maxOperations:  100000, // Keep last 100k operations
 		cleanupCounter: 0,
 	}
@@ -51,6 +63,20 @@ func (rs *ReliableSync) SubmitOperation(op *Operation) {
 	rs.mutex.Lock()
 	defer rs.mutex.Unlock()
 	
+	rs.submitLocked(op)
+}
+
+// submitLocked sequences, stores and broadcasts an operation; callers hold
+// the mutex
+func (rs *ReliableSync) submitLocked(op *Operation) {
+	// Clients are refused unknown types; the server's own should be known
+	if !Registered(op.Type) {
+		logging.Error("unregistered operation type sequenced", map[string]interface{}{
+			"type":      op.Type,
+			"client_id": op.ClientID,
+		})
+	}
+	
 	// Assign sequence number
 	op.SeqNum = rs.nextSeqNum
 	op.Timestamp = time.Now()
@@ -58,6 +84,7 @@ func (rs *ReliableSync) SubmitOperation(op *Operation) {
 	
 	// Store operation
 	rs.operations[op.SeqNum] = op
+	rs.trackAvatar(op)
 	
 	logging.Debug("operation submitted", map[string]interface{}{
 		"seq_num":   op.SeqNum,
@@ -68,6 +95,12 @@ func (rs *ReliableSync) SubmitOperation(op *Operation) {
 	// Broadcast to all clients
 	rs.broadcastOperation(op)
 	
+	// Wake long polls waiting for it
+	if rs.sequenced != nil {
+		close(rs.sequenced)
+		rs.sequenced = nil
+	}
+	
 	// Periodic cleanup
 	rs.cleanupCounter++
 	if rs.cleanupCounter%1000 == 0 {
@@ -115,8 +148,20 @@ func (rs *ReliableSync) GetCurrentSequence() uint64 {
 	return rs.nextSeqNum - 1
 }
 
+// Sequenced returns a channel closed once the next operation is sequenced
+func (rs *ReliableSync) Sequenced() <-chan struct{} {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	
+	if rs.sequenced == nil {
+		rs.sequenced = make(chan struct{})
+	}
+	return rs.sequenced
+}
+
 // GetMissingOperations returns operations from 'from' to 'to' (inclusive)
 func (rs *ReliableSync) GetMissingOperations(from, to uint64) []*Operation {
+	rs.wake(from)
 	rs.mutex.RLock()
 	defer rs.mutex.RUnlock()
 	
@@ -132,6 +177,7 @@ func (rs *ReliableSync) GetMissingOperations(from, to uint64) []*Operation {
 
 // GetAllOperations returns all operations for new client sync
 func (rs *ReliableSync) GetAllOperations() []*Operation {
+	rs.wake(1)
 	rs.mutex.RLock()
 	defer rs.mutex.RUnlock()
 	
@@ -145,6 +191,37 @@ func (rs *ReliableSync) GetAllOperations() []*Operation {
 	return allOps
 }
 
+// GetOperation returns one stored operation
+func (rs *ReliableSync) GetOperation(seqNum uint64) (*Operation, bool) {
+	rs.wake(seqNum)
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+	
+	op, exists := rs.operations[seqNum]
+	return op, exists
+}
+
+// Rebroadcast sends a stored operation to every connected client again,
+// under its original sequence number, for clients whose state diverged
+func (rs *ReliableSync) Rebroadcast(seqNum uint64) (*Operation, bool) {
+	rs.wake(seqNum)
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+	
+	op, exists := rs.operations[seqNum]
+	if !exists {
+		return nil, false
+	}
+	rs.broadcastOperation(op)
+	
+	logging.Info("operation rebroadcast", map[string]interface{}{
+		"seq_num": seqNum,
+		"type":    op.Type,
+		"clients": len(rs.clients),
+	})
+	return op, true
+}
+
 // UpdateClientLastSeen updates the last seen sequence for a client
 func (rs *ReliableSync) UpdateClientLastSeen(clientID string, seqNum uint64) {
 	rs.mutex.Lock()
@@ -237,7 +314,9 @@ func (rs *ReliableSync) GetStats() map[string]interface{} {
 		"next_sequence":    rs.nextSeqNum,
 		"stored_operations": len(rs.operations),
 		"connected_clients": len(rs.clients),
+		"avatars":          len(rs.avatars),
 		"max_operations":   rs.maxOperations,
+		"hibernated":       rs.parked.Load() > 0,
 	}
 }
 
@@ -250,6 +329,7 @@ func (rs *ReliableSync) GetPendingOperations() []*Operation {
 
 // GetOperationsInRange returns operations within a sequence range
 func (rs *ReliableSync) GetOperationsInRange(from, to uint64) []*Operation {
+	rs.wake(from)
 	rs.mutex.RLock()
 	defer rs.mutex.RUnlock()
 	
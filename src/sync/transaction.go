@@ -0,0 +1,68 @@
+package sync
+
+import "time"
+
+// TransactionType is the operation committing a scene transaction: the
+// entity operations it queued travel as one operation under one sequence
+// number, so every client applies all of them or none.
+//
+//	{"type": "transaction", "data": {"transaction_id": "...",
+//	  "operations": [{"type": "entity_create", "data": {...}}, ...]}}
+const TransactionType = OpTransaction
+
+// NewTransaction returns the operation committing parts as one
+func NewTransaction(clientID, transactionID string, parts []*Operation) *Operation {
+	operations := make([]interface{}, len(parts))
+	for i, part := range parts {
+		operations[i] = map[string]interface{}{
+			"type": part.Type,
+			"data": part.Data,
+		}
+	}
+	return &Operation{
+		ClientID: clientID,
+		Type:     TransactionType,
+		Data: map[string]interface{}{
+			"transaction_id": transactionID,
+			"operations":     operations,
+		},
+		Timestamp: time.Now(),
+	}
+}
+
+// Parts returns the operations an operation applies in order: a
+// transaction's, each under the transaction's sequence number, client and
+// time, or the operation itself
+func (op *Operation) Parts() []*Operation {
+	if op.Type != TransactionType {
+		return []*Operation{op}
+	}
+	operations, _ := op.Data["operations"].([]interface{})
+	parts := make([]*Operation, 0, len(operations))
+	for _, value := range operations {
+		operation, _ := value.(map[string]interface{})
+		opType, _ := operation["type"].(string)
+		data, _ := operation["data"].(map[string]interface{})
+		if opType == "" || data == nil {
+			continue
+		}
+		parts = append(parts, &Operation{
+			SeqNum:    op.SeqNum,
+			ClientID:  op.ClientID,
+			Type:      opType,
+			Data:      data,
+			Timestamp: op.Timestamp,
+		})
+	}
+	return parts
+}
+
+// Expand returns a log with its transactions replaced by their parts, for
+// readers that replay entity operations one at a time
+func Expand(ops []*Operation) []*Operation {
+	expanded := make([]*Operation, 0, len(ops))
+	for _, op := range ops {
+		expanded = append(expanded, op.Parts()...)
+	}
+	return expanded
+}
@@ -0,0 +1,365 @@
+// Package telemetry collects how consoles render worlds: frame rate, frame
+// time, GPU time, draw calls, triangles and memory, so decisions on what a
+// world may hold rest on what its visitors' machines actually manage.
+//
+// Consoles send a sample every configured interval, summarizing the frames
+// since the last. Samples are added up per world, by entity density bucket,
+// the entities the console had loaded, and by client tier, the capability
+// tier the server negotiated with it. A world that runs at 60 frames a
+// second with 400 entities on standard clients and at 20 with 3000 on low
+// ones shows as two buckets. Counters are kept in memory from the start of
+// the server; nothing about a session is reported but how many sent
+// samples.
+package telemetry
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"holodeck1/config"
+)
+
+// Densities are the upper bounds of the entity density buckets; consoles
+// with more entities than the last fall in an open bucket
+var Densities = []int{100, 500, 2000, 10000}
+
+// maxSessions bounds the sessions a bucket counts; samples of further
+// sessions are added up but not counted as another session
+const maxSessions = 10000
+
+// ErrDisabled is returned when consoles are configured to report nothing
+var ErrDisabled = errors.New("telemetry disabled")
+
+// ErrTooFrequent is returned for a session's samples closer together than
+// half the configured interval
+var ErrTooFrequent = errors.New("telemetry sent too frequently")
+
+// Bucket bounds of each metric; percentiles are reported as the bound of
+// the bucket they fall in
+var (
+	fpsBounds      = []float64{10, 15, 20, 24, 30, 45, 60, 75, 90, 120, 144, 240}
+	msBounds       = []float64{1, 2, 4, 6, 8, 11, 16.7, 25, 33.3, 50, 100, 250}
+	drawCallBounds = []float64{10, 25, 50, 100, 200, 300, 500, 1000, 2000, 5000}
+	triangleBounds = []float64{1e4, 5e4, 1e5, 2.5e5, 5e5, 1e6, 2e6, 5e6, 1e7}
+	memoryMBBounds = []float64{64, 128, 256, 512, 1024, 2048, 4096}
+)
+
+// Largest values a sample may hold
+const (
+	maxFPS       = 1000
+	maxMS        = 10000
+	maxMemoryMB  = 1 << 20
+	maxDrawCalls = 1000000
+	maxTriangles = 1000000000
+	maxEntities  = 10000000
+)
+
+// Sample summarizes the frames a console rendered over one interval
+type Sample struct {
+	FPS       float64  `json:"fps"`                 // Frames a second
+	FrameMS   float64  `json:"frame_ms"`            // Mean CPU time of a frame
+	GPUMS     *float64 `json:"gpu_ms,omitempty"`    // Mean GPU time of a frame, where the console can time it
+	DrawCalls int      `json:"draw_calls"`          // Of the last frame
+	Triangles int      `json:"triangles"`           // Of the last frame
+	MemoryMB  *float64 `json:"memory_mb,omitempty"` // Script heap in use, where the browser reports it
+	Entities  int      `json:"entities"`            // Entities loaded
+}
+
+// Validate checks a sample's values are in range
+func (s *Sample) Validate() error {
+	if !inRange(s.FPS, maxFPS) {
+		return fmt.Errorf("fps must be between 0 and %d", maxFPS)
+	}
+	if !inRange(s.FrameMS, maxMS) {
+		return fmt.Errorf("frame_ms must be between 0 and %d", maxMS)
+	}
+	if s.GPUMS != nil && !inRange(*s.GPUMS, maxMS) {
+		return fmt.Errorf("gpu_ms must be between 0 and %d", maxMS)
+	}
+	if s.MemoryMB != nil && !inRange(*s.MemoryMB, maxMemoryMB) {
+		return fmt.Errorf("memory_mb must be between 0 and %d", maxMemoryMB)
+	}
+	if s.DrawCalls < 0 || s.DrawCalls > maxDrawCalls {
+		return fmt.Errorf("draw_calls must be between 0 and %d", maxDrawCalls)
+	}
+	if s.Triangles < 0 || s.Triangles > maxTriangles {
+		return fmt.Errorf("triangles must be between 0 and %d", maxTriangles)
+	}
+	if s.Entities < 0 || s.Entities > maxEntities {
+		return fmt.Errorf("entities must be between 0 and %d", maxEntities)
+	}
+	return nil
+}
+
+func inRange(value float64, max int) bool {
+	return !math.IsNaN(value) && value >= 0 && value <= float64(max)
+}
+
+// Density names the entity density bucket of a number of entities, such
+// as "100-500" or "10000+"
+func Density(entities int) string {
+	low := 0
+	for _, bound := range Densities {
+		if entities < bound {
+			return fmt.Sprintf("%d-%d", low, bound)
+		}
+		low = bound
+	}
+	return fmt.Sprintf("%d+", low)
+}
+
+// Summary summarizes one metric over a bucket's samples
+type Summary struct {
+	Samples uint64  `json:"samples"`
+	Mean    float64 `json:"mean"`
+	P5      float64 `json:"p5"`
+	P50     float64 `json:"p50"`
+	P95     float64 `json:"p95"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+}
+
+// Bucket is what consoles of one tier, with entities in one density range,
+// reported of a world
+type Bucket struct {
+	Density     string  `json:"density"`
+	MinEntities int     `json:"min_entities"`
+	MaxEntities int     `json:"max_entities,omitempty"` // Exclusive; absent for the open bucket
+	Tier        string  `json:"tier"`
+	Samples     uint64  `json:"samples"`
+	Sessions    int     `json:"sessions"`
+	OverBudget  float64 `json:"over_budget"` // Share of samples under the target frame rate
+	FPS         Summary `json:"fps"`
+	FrameMS     Summary `json:"frame_ms"`
+	GPUMS       Summary `json:"gpu_ms"`
+	DrawCalls   Summary `json:"draw_calls"`
+	Triangles   Summary `json:"triangles"`
+	MemoryMB    Summary `json:"memory_mb"`
+}
+
+// Report is what consoles reported of a world
+type Report struct {
+	World     string    `json:"world"`
+	Since     time.Time `json:"since"`      // Counting started
+	Interval  float64   `json:"interval_s"` // Seconds between a console's samples
+	TargetFPS int       `json:"target_fps"`
+	Samples   uint64    `json:"samples"`
+	Sessions  int       `json:"sessions"` // Sending samples now
+	Buckets   []Bucket  `json:"buckets"`  // By density, then tier
+}
+
+// histogram adds up one metric
+type histogram struct {
+	bounds        []float64
+	buckets       []uint64 // One per bound, and one past the last
+	count         uint64
+	sum, min, max float64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, buckets: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) add(value float64) {
+	if h.count == 0 || value < h.min {
+		h.min = value
+	}
+	if value > h.max {
+		h.max = value
+	}
+	h.count++
+	h.sum += value
+	h.buckets[sort.SearchFloat64s(h.bounds, value)]++
+}
+
+func (h *histogram) summary() Summary {
+	if h.count == 0 {
+		return Summary{}
+	}
+	return Summary{
+		Samples: h.count,
+		Mean:    h.sum / float64(h.count),
+		P5:      h.percentile(0.05),
+		P50:     h.percentile(0.50),
+		P95:     h.percentile(0.95),
+		Min:     h.min,
+		Max:     h.max,
+	}
+}
+
+// percentile returns the bound of the bucket the q-th sample falls in,
+// within the smallest and largest seen
+func (h *histogram) percentile(q float64) float64 {
+	rank := uint64(q*float64(h.count) + 0.5)
+	if rank == 0 {
+		rank = 1
+	}
+	var seen uint64
+	for i, count := range h.buckets {
+		seen += count
+		if seen >= rank {
+			if i < len(h.bounds) && h.bounds[i] < h.max {
+				return math.Max(h.bounds[i], h.min)
+			}
+			return h.max
+		}
+	}
+	return h.max
+}
+
+type bucketKey struct {
+	density int // Index into Densities, len(Densities) for the open bucket
+	tier    string
+}
+
+// counter adds up a bucket's samples
+type counter struct {
+	samples, overBudget                                 uint64
+	sessions                                            map[string]struct{}
+	fps, frameMS, gpuMS, drawCalls, triangles, memoryMB *histogram
+}
+
+func newCounter() *counter {
+	return &counter{
+		sessions:  make(map[string]struct{}),
+		fps:       newHistogram(fpsBounds),
+		frameMS:   newHistogram(msBounds),
+		gpuMS:     newHistogram(msBounds),
+		drawCalls: newHistogram(drawCallBounds),
+		triangles: newHistogram(triangleBounds),
+		memoryMB:  newHistogram(memoryMBBounds),
+	}
+}
+
+func (c *counter) add(session string, sample *Sample, targetFPS int) {
+	c.samples++
+	if sample.FPS < float64(targetFPS) {
+		c.overBudget++
+	}
+	if len(c.sessions) < maxSessions {
+		c.sessions[session] = struct{}{}
+	}
+	c.fps.add(sample.FPS)
+	c.frameMS.add(sample.FrameMS)
+	if sample.GPUMS != nil {
+		c.gpuMS.add(*sample.GPUMS)
+	}
+	c.drawCalls.add(float64(sample.DrawCalls))
+	c.triangles.add(float64(sample.Triangles))
+	if sample.MemoryMB != nil {
+		c.memoryMB.add(*sample.MemoryMB)
+	}
+}
+
+var (
+	mutex   sync.Mutex
+	worlds  = make(map[string]map[bucketKey]*counter)
+	samples = make(map[string]uint64)
+	last    = make(map[string]time.Time) // Latest sample of each session
+	since   = time.Now().UTC()
+	swept   time.Time // Sessions that stopped sending were last forgotten
+)
+
+// Record adds a session's sample to its world's counters. tier is the
+// capability tier the server negotiated with the session.
+func Record(world, session, tier string, sample *Sample) error {
+	interval := config.GetTelemetryInterval()
+	if interval <= 0 {
+		return ErrDisabled
+	}
+	if err := sample.Validate(); err != nil {
+		return err
+	}
+	now := time.Now()
+	density := sort.SearchInts(Densities, sample.Entities+1)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if previous, ok := last[session]; ok && now.Sub(previous) < interval/2 {
+		return ErrTooFrequent
+	}
+	last[session] = now
+	forget(now, interval)
+
+	key := bucketKey{density: density, tier: tier}
+	if worlds[world] == nil {
+		worlds[world] = make(map[bucketKey]*counter)
+	}
+	c, ok := worlds[world][key]
+	if !ok {
+		c = newCounter()
+		worlds[world][key] = c
+	}
+	c.add(session, sample, config.GetTelemetryTargetFPS())
+	samples[world]++
+	return nil
+}
+
+// forget drops sessions that stopped sending samples, once an interval;
+// called with mutex held
+func forget(now time.Time, interval time.Duration) {
+	if now.Sub(swept) < interval {
+		return
+	}
+	swept = now
+	for session, at := range last {
+		if now.Sub(at) > 3*interval {
+			delete(last, session)
+		}
+	}
+}
+
+// For reports what consoles reported of a world
+func For(world string) *Report {
+	interval := config.GetTelemetryInterval()
+	now := time.Now()
+	mutex.Lock()
+	defer mutex.Unlock()
+	report := &Report{
+		World:     world,
+		Since:     since,
+		Interval:  interval.Seconds(),
+		TargetFPS: config.GetTelemetryTargetFPS(),
+		Samples:   samples[world],
+		Buckets:   []Bucket{},
+	}
+	for _, at := range last {
+		if now.Sub(at) <= 2*interval {
+			report.Sessions++
+		}
+	}
+	for key, c := range worlds[world] {
+		bucket := Bucket{
+			Tier:       key.tier,
+			Samples:    c.samples,
+			Sessions:   len(c.sessions),
+			OverBudget: float64(c.overBudget) / float64(c.samples),
+			FPS:        c.fps.summary(),
+			FrameMS:    c.frameMS.summary(),
+			GPUMS:      c.gpuMS.summary(),
+			DrawCalls:  c.drawCalls.summary(),
+			Triangles:  c.triangles.summary(),
+			MemoryMB:   c.memoryMB.summary(),
+		}
+		if key.density > 0 {
+			bucket.MinEntities = Densities[key.density-1]
+		}
+		if key.density < len(Densities) {
+			bucket.MaxEntities = Densities[key.density]
+		}
+		bucket.Density = Density(bucket.MinEntities)
+		report.Buckets = append(report.Buckets, bucket)
+	}
+	sort.Slice(report.Buckets, func(i, j int) bool {
+		a, b := report.Buckets[i], report.Buckets[j]
+		if a.MinEntities != b.MinEntities {
+			return a.MinEntities < b.MinEntities
+		}
+		return a.Tier < b.Tier
+	})
+	return report
+}
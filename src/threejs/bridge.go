@@ -8,6 +8,7 @@ import (
 	"sync"
 
 	"holodeck1/logging"
+	hd1sync "holodeck1/sync"
 )
 
 // Bridge represents the Three.js integration bridge
@@ -50,15 +51,15 @@ func (b *Bridge) ApplyOperation(operation map[string]interface{}) error {
 	}
 
 	switch opType {
-	case "avatar_move":
+	case hd1sync.OpAvatarMove:
 		return b.applyAvatarMove(data)
-	case "entity_create":
+	case hd1sync.OpEntityCreate:
 		return b.applyEntityCreate(data)
-	case "entity_update":
+	case hd1sync.OpEntityUpdate:
 		return b.applyEntityUpdate(data)
-	case "entity_delete":
+	case hd1sync.OpEntityDelete:
 		return b.applyEntityDelete(data)
-	case "scene_update":
+	case hd1sync.OpSceneUpdate:
 		return b.applySceneUpdate(data)
 	default:
 		return fmt.Errorf("unknown operation type: %s", opType)
@@ -0,0 +1,172 @@
+// Package throttle keeps a single client from flooding a shared world with
+// entities.
+//
+// Every session has a creation budget: entities per minute, live entities,
+// and the estimated triangles of its live entities. Deleting an entity,
+// by anyone, returns its share of its creator's budget. A creation over
+// budget is refused; each further violation blocks the session for longer,
+// doubling from the base penalty up to the maximum.
+// Strikes are forgiven once the session stays within budget for the
+// maximum penalty.
+package throttle
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+)
+
+// Refusal is returned when a creation is over budget
+type Refusal struct {
+	Reason     string
+	RetryAfter time.Duration // Zero when waiting alone will not help
+}
+
+func (r *Refusal) Error() string {
+	return r.Reason
+}
+
+type session struct {
+	created      []time.Time // Creations in the last minute, oldest first
+	entities     int
+	triangles    int
+	strikes      int
+	lastStrike   time.Time
+	blockedUntil time.Time
+}
+
+// owner charges a live entity to the session that created it
+type owner struct {
+	session   string
+	triangles int
+}
+
+var (
+	sessions  = map[string]*session{}
+	owners    = map[string]owner{}
+	lastSweep time.Time
+	mutex     sync.Mutex
+)
+
+// prune drops creations older than a minute and forgives old strikes
+func (s *session) prune(now time.Time) {
+	cut := 0
+	for cut < len(s.created) && now.Sub(s.created[cut]) >= time.Minute {
+		cut++
+	}
+	s.created = s.created[cut:]
+	if s.strikes > 0 && now.Sub(s.lastStrike) >= config.GetEntitiesPenaltyMax() {
+		s.strikes = 0
+	}
+}
+
+func (s *session) idle() bool {
+	return s.entities == 0 && s.strikes == 0 && len(s.created) == 0
+}
+
+// over reports the first budget a creation would exceed
+func (s *session) over(triangles int, now time.Time) *Refusal {
+	if rate := config.GetEntitiesCreateRate(); rate > 0 && len(s.created) >= rate {
+		return &Refusal{
+			Reason:     fmt.Sprintf("creation rate exceeded: %d entities per minute", rate),
+			RetryAfter: time.Minute - now.Sub(s.created[0]),
+		}
+	}
+	if max := config.GetEntitiesMaxPerSession(); max > 0 && s.entities >= max {
+		return &Refusal{Reason: fmt.Sprintf("entity limit reached: %d entities", max)}
+	}
+	if max := config.GetEntitiesMaxTriangles(); max > 0 && s.triangles+triangles > max {
+		return &Refusal{Reason: fmt.Sprintf("triangle budget exceeded: %d triangles", max)}
+	}
+	return nil
+}
+
+// penalty is the block after a strike: none for the first, then the base
+// penalty doubling per strike up to the maximum
+func penalty(strikes int) time.Duration {
+	if strikes < 2 {
+		return 0
+	}
+	block, max := config.GetEntitiesPenalty(), config.GetEntitiesPenaltyMax()
+	for i := 2; i < strikes && block < max; i++ {
+		block *= 2
+	}
+	if block > max {
+		block = max
+	}
+	return block
+}
+
+// Admit charges a new entity to a session, or refuses it with a *Refusal
+func Admit(key, entityID string, triangles int) error {
+	now := time.Now()
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	// Sessions that never kept an entity are dropped once they go quiet
+	if now.Sub(lastSweep) >= time.Minute {
+		lastSweep = now
+		for other, s := range sessions {
+			s.prune(now)
+			if s.idle() && !now.Before(s.blockedUntil) {
+				delete(sessions, other)
+			}
+		}
+	}
+
+	s, ok := sessions[key]
+	if !ok {
+		s = &session{}
+		sessions[key] = s
+	}
+	s.prune(now)
+
+	if now.Before(s.blockedUntil) {
+		return &Refusal{Reason: "entity creation blocked after repeated violations", RetryAfter: s.blockedUntil.Sub(now)}
+	}
+	if refusal := s.over(triangles, now); refusal != nil {
+		s.strikes++
+		s.lastStrike = now
+		if block := penalty(s.strikes); block > 0 {
+			s.blockedUntil = now.Add(block)
+			if block > refusal.RetryAfter {
+				refusal.RetryAfter = block
+			}
+		}
+		logging.Warn("entity creation throttled", map[string]interface{}{
+			"session":     key,
+			"reason":      refusal.Reason,
+			"strikes":     s.strikes,
+			"retry_after": refusal.RetryAfter.String(),
+		})
+		return refusal
+	}
+
+	s.created = append(s.created, now)
+	s.entities++
+	s.triangles += triangles
+	owners[entityID] = owner{session: key, triangles: triangles}
+	return nil
+}
+
+// Release returns a deleted entity's share of its creator's budget
+func Release(entityID string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	o, ok := owners[entityID]
+	if !ok {
+		return
+	}
+	delete(owners, entityID)
+	if s, ok := sessions[o.session]; ok {
+		s.entities--
+		s.triangles -= o.triangles
+		s.prune(time.Now())
+		if s.idle() {
+			delete(sessions, o.session)
+		}
+	}
+}
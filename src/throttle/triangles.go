@@ -0,0 +1,74 @@
+package throttle
+
+import (
+	"math"
+	"unicode/utf8"
+)
+
+// maxSegments caps a segment count before it is multiplied, so absurd
+// requests cost the whole budget instead of overflowing
+const maxSegments = 1 << 16
+
+// trianglesPerGlyph approximates extruded text, bevels included
+const trianglesPerGlyph = 200
+
+// segments reads a segment count with the Three.js default
+func segments(params map[string]interface{}, key string, fallback int) int64 {
+	value, ok := params[key].(float64)
+	if !ok {
+		if integer, isInt := params[key].(int); isInt {
+			value, ok = float64(integer), true
+		}
+	}
+	if !ok || math.IsNaN(value) || value < 1 {
+		return int64(fallback)
+	}
+	if value > maxSegments {
+		return maxSegments
+	}
+	return int64(value)
+}
+
+// Triangles estimates the triangles Three.js builds for a geometry from its
+// parameters, with the same defaults. Models are counted as one box: their
+// meshes are not inspected. A "particles" parameter adds that many
+// particles, two triangles each.
+func Triangles(geometryType string, params map[string]interface{}) int {
+	var count int64
+	switch geometryType {
+	case "box":
+		w, h, d := segments(params, "widthSegments", 1), segments(params, "heightSegments", 1), segments(params, "depthSegments", 1)
+		count = 4 * (w*h + h*d + w*d)
+	case "sphere":
+		count = 2 * segments(params, "widthSegments", 32) * segments(params, "heightSegments", 16)
+	case "plane":
+		count = 2 * segments(params, "widthSegments", 1) * segments(params, "heightSegments", 1)
+	case "cylinder":
+		radial := segments(params, "radialSegments", 32)
+		count = 2*radial*segments(params, "heightSegments", 1) + 2*radial
+	case "cone":
+		radial := segments(params, "radialSegments", 32)
+		count = 2*radial*segments(params, "heightSegments", 1) + radial
+	case "capsule":
+		radial := segments(params, "radialSegments", 8)
+		count = 2 * radial * (2*segments(params, "capSegments", 4) + 1)
+	case "circle":
+		count = segments(params, "segments", 32)
+	case "ring":
+		count = 2 * segments(params, "thetaSegments", 32) * segments(params, "phiSegments", 1)
+	case "torus":
+		count = 2 * segments(params, "radialSegments", 12) * segments(params, "tubularSegments", 48)
+	case "torusknot":
+		count = 2 * segments(params, "radialSegments", 8) * segments(params, "tubularSegments", 64)
+	case "text":
+		text, _ := params["text"].(string)
+		count = int64(utf8.RuneCountInString(text)) * trianglesPerGlyph
+	default:
+		count = 12
+	}
+	count += 2 * segments(params, "particles", 0)
+	if count > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return int(count)
+}
@@ -0,0 +1,155 @@
+// Package tokens issues the short-lived tokens that prove a WebSocket
+// client owns its HD1 ID.
+//
+// A session is given a token when it connects and must present it to take
+// its identity back after a reconnect. While connected, the hub rotates the
+// token before it expires and drops the connection once every token of its
+// session is revoked, expired, or the session has been inactive too long.
+// A rotated token stays valid for a short grace period, so a reconnect
+// racing the rotation still succeeds.
+package tokens
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+
+	"holodeck1/config"
+)
+
+// RotationGrace is how long a rotated token keeps working
+const RotationGrace = 30 * time.Second
+
+// ErrInvalid is returned for unknown, expired and revoked tokens
+var ErrInvalid = errors.New("invalid or expired session token")
+
+// Token authenticates one session
+type Token struct {
+	Value     string    `json:"token"`
+	HD1ID     string    `json:"hd1_id"`
+	Org       string    `json:"org"` // Organization the session joined
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+var (
+	tokens    = map[string]*Token{}
+	lastSweep time.Time
+	mutex     sync.Mutex
+)
+
+// sweep drops expired tokens once a minute; callers hold the mutex
+func sweep(now time.Time) {
+	if now.Sub(lastSweep) < time.Minute {
+		return
+	}
+	lastSweep = now
+	for value, token := range tokens {
+		if !now.Before(token.ExpiresAt) {
+			delete(tokens, value)
+		}
+	}
+}
+
+// Issue creates a token for a session of an organization
+func Issue(hd1ID, org string) (*Token, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	token := &Token{
+		Value:     base64.RawURLEncoding.EncodeToString(raw),
+		HD1ID:     hd1ID,
+		Org:       org,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(config.GetSessionTokenTTL()),
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	sweep(now)
+	tokens[token.Value] = token
+	issued := *token
+	return &issued, nil
+}
+
+// Validate returns the token a value stands for, or ErrInvalid
+func Validate(value string) (*Token, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	token, ok := tokens[value]
+	if !ok || !time.Now().Before(token.ExpiresAt) {
+		return nil, ErrInvalid
+	}
+	valid := *token
+	return &valid, nil
+}
+
+// Rotate issues a new token for the session a valid token belongs to; the
+// old one expires after RotationGrace
+func Rotate(value string) (*Token, error) {
+	current, err := Validate(value)
+	if err != nil {
+		return nil, err
+	}
+	next, err := Issue(current.HD1ID, current.Org)
+	if err != nil {
+		return nil, err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if token, ok := tokens[value]; ok {
+		if grace := time.Now().Add(RotationGrace); grace.Before(token.ExpiresAt) {
+			token.ExpiresAt = grace
+		}
+	}
+	return next, nil
+}
+
+// Revoke invalidates one token and returns it
+func Revoke(value string) (*Token, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	token, ok := tokens[value]
+	if !ok || !time.Now().Before(token.ExpiresAt) {
+		return nil, ErrInvalid
+	}
+	delete(tokens, value)
+	return token, nil
+}
+
+// RevokeSession invalidates every token of a session and returns how many
+// were still valid
+func RevokeSession(hd1ID string) int {
+	mutex.Lock()
+	defer mutex.Unlock()
+	now := time.Now()
+	revoked := 0
+	for value, token := range tokens {
+		if token.HD1ID != hd1ID {
+			continue
+		}
+		if now.Before(token.ExpiresAt) {
+			revoked++
+		}
+		delete(tokens, value)
+	}
+	return revoked
+}
+
+// Active reports whether a session holds any valid token
+func Active(hd1ID string) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	now := time.Now()
+	for _, token := range tokens {
+		if token.HD1ID == hd1ID && now.Before(token.ExpiresAt) {
+			return true
+		}
+	}
+	return false
+}
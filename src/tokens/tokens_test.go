@@ -0,0 +1,143 @@
+package tokens
+
+import (
+	"testing"
+	"time"
+)
+
+// expireTestToken moves a token's expiry to the past
+func expireTestToken(t *testing.T, value string) {
+	t.Helper()
+	mutex.Lock()
+	defer mutex.Unlock()
+	token, ok := tokens[value]
+	if !ok {
+		t.Fatalf("token not issued")
+	}
+	token.ExpiresAt = time.Now().Add(-time.Second)
+}
+
+func TestValidateFollowsIssueRotateAndRevoke(t *testing.T) {
+	tests := []struct {
+		name string
+		// act does something to the token issued to the session, and
+		// returns the value then presented
+		act   func(t *testing.T, hd1ID string, issued *Token) string
+		valid bool
+	}{
+		{
+			name: "issued token is valid",
+			act: func(t *testing.T, hd1ID string, issued *Token) string {
+				return issued.Value
+			},
+			valid: true,
+		},
+		{
+			name: "unknown token is invalid",
+			act: func(t *testing.T, hd1ID string, issued *Token) string {
+				return issued.Value + "x"
+			},
+			valid: false,
+		},
+		{
+			name: "empty token is invalid",
+			act: func(t *testing.T, hd1ID string, issued *Token) string {
+				return ""
+			},
+			valid: false,
+		},
+		{
+			name: "expired token is invalid",
+			act: func(t *testing.T, hd1ID string, issued *Token) string {
+				expireTestToken(t, issued.Value)
+				return issued.Value
+			},
+			valid: false,
+		},
+		{
+			name: "rotated token is valid during the grace period",
+			act: func(t *testing.T, hd1ID string, issued *Token) string {
+				if _, err := Rotate(issued.Value); err != nil {
+					t.Fatalf("Rotate: %v", err)
+				}
+				return issued.Value
+			},
+			valid: true,
+		},
+		{
+			name: "token a rotation issued is valid",
+			act: func(t *testing.T, hd1ID string, issued *Token) string {
+				next, err := Rotate(issued.Value)
+				if err != nil {
+					t.Fatalf("Rotate: %v", err)
+				}
+				return next.Value
+			},
+			valid: true,
+		},
+		{
+			name: "expired token cannot be rotated",
+			act: func(t *testing.T, hd1ID string, issued *Token) string {
+				expireTestToken(t, issued.Value)
+				if next, err := Rotate(issued.Value); err != ErrInvalid {
+					t.Fatalf("Rotate = %v, %v, want ErrInvalid", next, err)
+				}
+				return issued.Value
+			},
+			valid: false,
+		},
+		{
+			name: "revoked token is invalid",
+			act: func(t *testing.T, hd1ID string, issued *Token) string {
+				if _, err := Revoke(issued.Value); err != nil {
+					t.Fatalf("Revoke: %v", err)
+				}
+				return issued.Value
+			},
+			valid: false,
+		},
+		{
+			name: "token of a revoked session is invalid, rotated ones too",
+			act: func(t *testing.T, hd1ID string, issued *Token) string {
+				next, err := Rotate(issued.Value)
+				if err != nil {
+					t.Fatalf("Rotate: %v", err)
+				}
+				if revoked := RevokeSession(hd1ID); revoked != 2 {
+					t.Errorf("RevokeSession revoked %d tokens, want 2", revoked)
+				}
+				return next.Value
+			},
+			valid: false,
+		},
+		{
+			name: "token of another session outlives a session's revocation",
+			act: func(t *testing.T, hd1ID string, issued *Token) string {
+				RevokeSession(hd1ID + "-other")
+				return issued.Value
+			},
+			valid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hd1ID := "session-" + tt.name
+			issued, err := Issue(hd1ID, "acme")
+			if err != nil {
+				t.Fatalf("Issue: %v", err)
+			}
+			value := tt.act(t, hd1ID, issued)
+
+			token, err := Validate(value)
+			switch {
+			case tt.valid && err != nil:
+				t.Fatalf("Validate: %v, want valid", err)
+			case !tt.valid && err != ErrInvalid:
+				t.Fatalf("Validate = %v, %v, want ErrInvalid", token, err)
+			case tt.valid && (token.HD1ID != hd1ID || token.Org != "acme"):
+				t.Errorf("token for %s of %s, want %s of acme", token.HD1ID, token.Org, hd1ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+// Package transactions holds open scene transactions: entity operations a
+// session queues one by one and then commits as a single sync operation,
+// so a composite edit is never seen half-applied.
+//
+// Queued operations are validated when queued; creates claim their entity
+// IDs and creation budget then. A transaction that is rolled back, fails
+// its commit or stays open past its timeout releases both. Open
+// transactions live in memory and belong to the session that began them.
+package transactions
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"holodeck1/config"
+	"holodeck1/entityid"
+	"holodeck1/logging"
+	"holodeck1/throttle"
+)
+
+var (
+	// ErrNotFound is returned for unknown, expired and others' transactions
+	ErrNotFound = errors.New("transaction not found")
+	// ErrFull is returned when a transaction holds its maximum of operations
+	ErrFull = errors.New("transaction holds its maximum of operations")
+	// ErrEmpty is returned when committing a transaction without operations
+	ErrEmpty = errors.New("transaction has no operations")
+)
+
+// sweepInterval is how often expired transactions are rolled back
+const sweepInterval = 10 * time.Second
+
+// Operation is a queued entity operation
+type Operation struct {
+	Type string                 `json:"type"`
+	Data map[string]interface{} `json:"data"`
+}
+
+// Transaction is an open scene transaction
+type Transaction struct {
+	ID         string      `json:"id"`
+	Owner      string      `json:"owner"`
+	Operations []Operation `json:"operations"`
+	Created    []string    `json:"created,omitempty"` // Entity IDs claimed by queued creates
+	CreatedAt  time.Time   `json:"created_at"`
+	ExpiresAt  time.Time   `json:"expires_at"`
+}
+
+var (
+	open  = make(map[string]*Transaction)
+	mutex sync.Mutex
+)
+
+// Begin opens a transaction for owner
+func Begin(owner string) *Transaction {
+	now := time.Now().UTC()
+	t := &Transaction{
+		ID:         "txn-" + uuid.New().String(),
+		Owner:      owner,
+		Operations: []Operation{},
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(config.GetSyncTransactionTimeout()),
+	}
+
+	mutex.Lock()
+	open[t.ID] = t
+	mutex.Unlock()
+
+	logging.Info("transaction begun", map[string]interface{}{
+		"transaction_id": t.ID,
+		"owner":          owner,
+	})
+	return t.copy()
+}
+
+// Get returns a copy of an owner's open transaction
+func Get(id, owner string) (*Transaction, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	t, err := lookupLocked(id, owner)
+	if err != nil {
+		return nil, err
+	}
+	return t.copy(), nil
+}
+
+// Room reports whether an owner's transaction can take another operation,
+// so callers can refuse before validating one
+func Room(id, owner string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	t, err := lookupLocked(id, owner)
+	if err != nil {
+		return err
+	}
+	if len(t.Operations) >= config.GetSyncTransactionMaxOperations() {
+		return ErrFull
+	}
+	return nil
+}
+
+// Queue appends an operation and returns its index. created names the
+// entity ID the operation claimed, if any; the transaction releases it
+// unless committed. On error nothing was queued and created is not kept.
+func Queue(id, owner string, op Operation, created string) (int, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	t, err := lookupLocked(id, owner)
+	if err != nil {
+		return 0, err
+	}
+	if len(t.Operations) >= config.GetSyncTransactionMaxOperations() {
+		return 0, ErrFull
+	}
+	t.Operations = append(t.Operations, op)
+	if created != "" {
+		t.Created = append(t.Created, created)
+	}
+	return len(t.Operations) - 1, nil
+}
+
+// Take closes an owner's transaction for its commit. The caller submits
+// its operations, or calls Release when the commit fails.
+func Take(id, owner string) (*Transaction, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	t, err := lookupLocked(id, owner)
+	if err != nil {
+		return nil, err
+	}
+	if len(t.Operations) == 0 {
+		return nil, ErrEmpty
+	}
+	delete(open, id)
+	return t, nil
+}
+
+// Rollback discards an owner's transaction
+func Rollback(id, owner string) error {
+	mutex.Lock()
+	t, err := lookupLocked(id, owner)
+	if err == nil {
+		delete(open, id)
+	}
+	mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+	Release(t)
+	logging.Info("transaction rolled back", map[string]interface{}{
+		"transaction_id": t.ID,
+		"owner":          owner,
+		"operations":     len(t.Operations),
+	})
+	return nil
+}
+
+// Release frees the entity IDs and creation budget a closed transaction's
+// creates claimed
+func Release(t *Transaction) {
+	for _, id := range t.Created {
+		entityid.Release(id)
+		throttle.Release(id)
+	}
+}
+
+// Run rolls back transactions left open past their timeout until ctx ends
+func Run(ctx context.Context) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, t := range expire(now) {
+				Release(t)
+				logging.Info("transaction expired", map[string]interface{}{
+					"transaction_id": t.ID,
+					"owner":          t.Owner,
+					"operations":     len(t.Operations),
+				})
+			}
+		}
+	}
+}
+
+// expire closes and returns the transactions open past their timeout
+func expire(now time.Time) []*Transaction {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	var expired []*Transaction
+	for id, t := range open {
+		if now.After(t.ExpiresAt) {
+			delete(open, id)
+			expired = append(expired, t)
+		}
+	}
+	return expired
+}
+
+// lookupLocked returns an owner's live transaction; the caller holds the
+// mutex. Expired ones are left for Run to release.
+func lookupLocked(id, owner string) (*Transaction, error) {
+	t, ok := open[id]
+	if !ok || t.Owner != owner || time.Now().After(t.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+	return t, nil
+}
+
+func (t *Transaction) copy() *Transaction {
+	copied := *t
+	copied.Operations = append([]Operation{}, t.Operations...)
+	copied.Created = append([]string(nil), t.Created...)
+	return &copied
+}
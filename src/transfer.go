@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// run_world_export downloads the live world as an hd1-world/1 document:
+// hd1 world export [WORLD] [-o FILE]. A file is written in place only once
+// the whole export has arrived, so a failed run leaves an older backup be.
+func run_world_export(args []string) int {
+	flags := flag.NewFlagSet("world export", flag.ContinueOnError)
+	output := flags.String("o", "", "Write the export to this file instead of stdout")
+	quiet := flags.Bool("quiet", false, "No progress bar")
+	address := flags.String("address", "", "Server address (default: the first listener)")
+	profile := flags.String("profile", "", "Server profile (see hd1 login)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: hd1 world export [WORLD] [-o scene.json] [--quiet] [--address host:port|unix:///path | --profile NAME]")
+	}
+	world, args := leading_argument(args)
+	if err := flags.Parse(args); err != nil || flags.NArg() > 1 || (world != "" && flags.NArg() != 0) {
+		flags.Usage()
+		return exitUsage
+	}
+	if flags.NArg() == 1 {
+		world = flags.Arg(0)
+	}
+	target, ok := transfer_target("world export", *address, *profile)
+	if !ok {
+		return exitUsage
+	}
+	client, base := target.client, target.base
+	if world == "" {
+		world = target.world
+	}
+
+	response, err := client.Get(base + "/api/worlds/" + url.PathEscape(world) + "/export")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "world export: %v\n", err)
+		return exitFailed
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "world export: server answered %s\n", response.Status)
+		return exitFailed
+	}
+
+	out, partial := os.Stdout, ""
+	if *output != "" {
+		partial = *output + ".partial"
+		file, err := os.Create(partial)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "world export: %v\n", err)
+			return exitFailed
+		}
+		defer os.Remove(partial) // Gone once renamed
+		defer file.Close()
+		out = file
+	}
+
+	progress := new_progress("export "+world, response.ContentLength, !*quiet)
+	_, err = io.Copy(out, progress.reader(response.Body))
+	progress.finish()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "world export: %v\n", err)
+		return exitFailed
+	}
+	if partial != "" {
+		if err := out.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "world export: %v\n", err)
+			return exitFailed
+		}
+		if err := os.Rename(partial, *output); err != nil {
+			fmt.Fprintf(os.Stderr, "world export: %v\n", err)
+			return exitFailed
+		}
+	}
+	return exitOK
+}
+
+// run_world_import loads an export into the live world: hd1 world import
+// FILE [--world W] [--label L] [--stage]. The file is uploaded as a
+// checkpoint, then the world is rolled back to it, which saves the state it
+// replaces as a backup checkpoint first. With --stage it is only uploaded.
+func run_world_import(args []string) int {
+	flags := flag.NewFlagSet("world import", flag.ContinueOnError)
+	world := flags.String("world", "", "World to import into (default: the served world)")
+	label := flags.String("label", "", "Checkpoint label (default: Import of FILE)")
+	stage := flags.Bool("stage", false, "Only create the checkpoint; roll back to it later")
+	quiet := flags.Bool("quiet", false, "No progress bar")
+	address := flags.String("address", "", "Server address (default: the first listener)")
+	profile := flags.String("profile", "", "Server profile (see hd1 login)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: hd1 world import [--world NAME] [--label TEXT] [--stage] [--quiet] [--address host:port|unix:///path | --profile NAME] scene.json")
+	}
+	path, args := leading_argument(args)
+	if err := flags.Parse(args); err != nil || flags.NArg() > 1 || (path != "" && flags.NArg() != 0) {
+		flags.Usage()
+		return exitUsage
+	}
+	if flags.NArg() == 1 {
+		path = flags.Arg(0)
+	}
+	if path == "" {
+		flags.Usage()
+		return exitUsage
+	}
+	if *label == "" {
+		*label = "Import of " + filepath.Base(path)
+	}
+
+	// Refuse a file the server would, before uploading it
+	if _, err := read_world_export(path); err != nil {
+		fmt.Fprintf(os.Stderr, "world import: %v\n", err)
+		return exitUsage
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "world import: %v\n", err)
+		return exitUsage
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "world import: %v\n", err)
+		return exitUsage
+	}
+	target, ok := transfer_target("world import", *address, *profile)
+	if !ok {
+		return exitUsage
+	}
+	client, base := target.client, target.base
+	if *world == "" {
+		*world = target.world
+	}
+
+	// The export is streamed into the request as its state, in chunks
+	encodedLabel, _ := json.Marshal(*label)
+	progress := new_progress("import "+filepath.Base(path), info.Size(), !*quiet)
+	body := io.MultiReader(
+		strings.NewReader(`{"label":`+string(encodedLabel)+`,"state":`),
+		progress.reader(file),
+		strings.NewReader(`}`),
+	)
+	checkpoints := base + "/api/worlds/" + url.PathEscape(*world) + "/checkpoints"
+	response, err := client.Post(checkpoints, "application/json", body)
+	progress.finish()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "world import: %v\n", err)
+		return exitFailed
+	}
+	created, err := read_transfer_response(response, http.StatusCreated)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "world import: %v\n", err)
+		return exitFailed
+	}
+	if *stage {
+		os.Stdout.Write(created)
+		return exitOK
+	}
+
+	var checkpoint struct {
+		Checkpoint struct {
+			ID string `json:"id"`
+		} `json:"checkpoint"`
+	}
+	json.Unmarshal(created, &checkpoint)
+	response, err = client.Post(checkpoints+"/"+url.PathEscape(checkpoint.Checkpoint.ID)+"/rollback", "application/json", nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "world import: %v\n", err)
+		return exitFailed
+	}
+	applied, err := read_transfer_response(response, http.StatusOK)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "world import: staged as checkpoint %s, applying it failed: %v\n", checkpoint.Checkpoint.ID, err)
+		return exitFailed
+	}
+	os.Stdout.Write(applied)
+	return exitOK
+}
+
+// leading_argument takes a leading positional argument off args, so it may
+// come before the flags as well as after them
+func leading_argument(args []string) (string, []string) {
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		return args[0], args[1:]
+	}
+	return "", args
+}
+
+// transfer_target returns the command's server, its client without the
+// request timeout, as large worlds take a while to move
+func transfer_target(command, address, profile string) (*server_target, bool) {
+	target, ok := resolve_target(command, address, profile)
+	if ok {
+		target.client.Timeout = 0
+	}
+	return target, ok
+}
+
+// read_transfer_response reads a response body, or fails with the
+// server's answer when the status is not the expected one
+func read_transfer_response(response *http.Response, status int) ([]byte, error) {
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != status {
+		return nil, fmt.Errorf("server answered %s: %s", response.Status, bytes.TrimSpace(body))
+	}
+	return body, nil
+}
+
+// progress draws a transfer's progress bar on stderr, when it is a
+// terminal. A total of -1 means the size is not known up front.
+type progress struct {
+	label   string
+	total   int64
+	done    int64
+	started time.Time
+	drawn   time.Time
+	enabled bool
+}
+
+// progress_width is the bar's width in characters
+const progress_width = 30
+
+func new_progress(label string, total int64, enabled bool) *progress {
+	if info, err := os.Stderr.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		enabled = false
+	}
+	return &progress{label: label, total: total, started: time.Now(), enabled: enabled}
+}
+
+// reader counts what is read through r
+func (p *progress) reader(r io.Reader) io.Reader {
+	return &progress_reader{r, p}
+}
+
+type progress_reader struct {
+	io.Reader
+	progress *progress
+}
+
+func (r *progress_reader) Read(buffer []byte) (int, error) {
+	n, err := r.Reader.Read(buffer)
+	r.progress.add(int64(n))
+	return n, err
+}
+
+// add counts n more bytes, redrawing at most ten times a second
+func (p *progress) add(n int64) {
+	p.done += n
+	if time.Since(p.drawn) >= 100*time.Millisecond {
+		p.draw()
+	}
+}
+
+func (p *progress) draw() {
+	if !p.enabled {
+		return
+	}
+	p.drawn = time.Now()
+	rate := float64(p.done) / time.Since(p.started).Seconds()
+	if p.total > 0 {
+		filled := int(p.done * progress_width / p.total)
+		if filled > progress_width {
+			filled = progress_width
+		}
+		fmt.Fprintf(os.Stderr, "\r%s [%s%s] %3d%% %s / %s %s/s ", p.label,
+			strings.Repeat("#", filled), strings.Repeat("-", progress_width-filled),
+			p.done*100/p.total, format_bytes(p.done), format_bytes(p.total), format_bytes(int64(rate)))
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\r%s %s %s/s ", p.label, format_bytes(p.done), format_bytes(int64(rate)))
+}
+
+// finish draws the final state and ends the line
+func (p *progress) finish() {
+	if !p.enabled {
+		return
+	}
+	p.draw()
+	fmt.Fprintln(os.Stderr)
+}
+
+// format_bytes renders a byte count for people
+func format_bytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,209 @@
+package units
+
+import (
+	"encoding/json"
+	"math"
+
+	"holodeck1/numbers"
+)
+
+// lengths are the geometry parameters measured in world units; angles and
+// segment counts are left alone
+var lengths = []string{
+	"width", "height", "depth", "length", "radius", "radiusTop", "radiusBottom",
+	"tube", "innerRadius", "outerRadius", "size", "bevelSize", "bevelThickness", "bevelOffset",
+}
+
+// matrix is a 3x3 rotation, row major
+type matrix [3][3]float64
+
+// axes maps HD1 axes onto the space's: the identity for y up, a quarter
+// turn about x for z up, taking HD1's -z (forward) to +y
+func (s *Space) axes() matrix {
+	if s.UpAxis == "z" {
+		return matrix{{1, 0, 0}, {0, 0, -1}, {0, 1, 0}}
+	}
+	return matrix{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+}
+
+// Export returns a copy of entity data, in HD1's space, converted into s.
+// Geometry keeps its own frame: rotations turn it into the space, and its
+// lengths, or a model's scale, carry the units.
+func (s *Space) Export(entity map[string]interface{}) map[string]interface{} {
+	entity = clone(entity)
+	if s.IsDefault() {
+		return entity
+	}
+	m, factor := s.axes(), metres[s.Units]
+
+	if position, ok := vector(entity["position"]); ok {
+		p := m.apply(position)
+		entity["position"] = object([3]float64{p[0]/factor + s.Origin.X, p[1]/factor + s.Origin.Y, p[2]/factor + s.Origin.Z})
+	}
+	rotation, _ := vector(entity["rotation"])
+	if turned := m.times(euler(rotation)).angles(); turned != rotation || entity["rotation"] != nil {
+		entity["rotation"] = object(turned)
+	}
+	s.scaleLengths(entity, 1/factor)
+	return entity
+}
+
+// Import returns a copy of entity data, in s, converted into HD1's space
+func (s *Space) Import(entity map[string]interface{}) map[string]interface{} {
+	entity = clone(entity)
+	if s.IsDefault() {
+		return entity
+	}
+	m, factor := s.axes(), metres[s.Units]
+
+	if position, ok := vector(entity["position"]); ok {
+		offset := [3]float64{(position[0] - s.Origin.X) * factor, (position[1] - s.Origin.Y) * factor, (position[2] - s.Origin.Z) * factor}
+		entity["position"] = object(m.transpose().apply(offset))
+	}
+	rotation, _ := vector(entity["rotation"])
+	if turned := m.transpose().times(euler(rotation)).angles(); turned != rotation || entity["rotation"] != nil {
+		entity["rotation"] = object(turned)
+	}
+	s.scaleLengths(entity, factor)
+	return entity
+}
+
+// ImportModel corrects the requested transform of an entity created with
+// a model in place, so a model authored in s shows upright and at its size.
+// It reports whether the transform changed.
+func (s *Space) ImportModel(data map[string]interface{}) bool {
+	if model, _ := data["model"].(string); model == "" || s.IsDefault() {
+		return false
+	}
+	m, factor := s.axes(), metres[s.Units]
+
+	rotation, _ := vector(data["rotation"])
+	data["rotation"] = object(euler(rotation).times(m.transpose()).angles())
+
+	// The model's axes turn under the requested scale
+	scale, ok := vector(data["scale"])
+	if !ok {
+		scale = [3]float64{1, 1, 1}
+	}
+	var corrected [3]float64
+	for i := range corrected {
+		for j := range scale {
+			corrected[i] += math.Abs(m[i][j]) * scale[j]
+		}
+		corrected[i] = numbers.Round(corrected[i]*factor, precision)
+	}
+	data["scale"] = object(corrected)
+	return true
+}
+
+// scaleLengths multiplies a model's scale, or the lengths of a geometry,
+// by factor
+func (s *Space) scaleLengths(entity map[string]interface{}, factor float64) {
+	if model, _ := entity["model"].(string); model != "" {
+		scale, ok := vector(entity["scale"])
+		if !ok {
+			scale = [3]float64{1, 1, 1}
+		}
+		entity["scale"] = object([3]float64{numbers.Round(scale[0]*factor, precision), numbers.Round(scale[1]*factor, precision), numbers.Round(scale[2]*factor, precision)})
+		return
+	}
+	geometry, _ := entity["geometry"].(map[string]interface{})
+	for _, key := range lengths {
+		if value, ok := geometry[key].(float64); ok {
+			geometry[key] = numbers.Round(value*factor, precision)
+		}
+	}
+}
+
+func (m matrix) apply(v [3]float64) [3]float64 {
+	var out [3]float64
+	for i := range out {
+		out[i] = m[i][0]*v[0] + m[i][1]*v[1] + m[i][2]*v[2]
+	}
+	return out
+}
+
+func (m matrix) times(n matrix) matrix {
+	var out matrix
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				out[i][j] += m[i][k] * n[k][j]
+			}
+		}
+	}
+	return out
+}
+
+func (m matrix) transpose() matrix {
+	var out matrix
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			out[i][j] = m[j][i]
+		}
+	}
+	return out
+}
+
+// euler returns the rotation of three.js Euler angles in their default
+// XYZ order
+func euler(angles [3]float64) matrix {
+	cx, sx := math.Cos(angles[0]), math.Sin(angles[0])
+	cy, sy := math.Cos(angles[1]), math.Sin(angles[1])
+	cz, sz := math.Cos(angles[2]), math.Sin(angles[2])
+	x := matrix{{1, 0, 0}, {0, cx, -sx}, {0, sx, cx}}
+	y := matrix{{cy, 0, sy}, {0, 1, 0}, {-sy, 0, cy}}
+	z := matrix{{cz, -sz, 0}, {sz, cz, 0}, {0, 0, 1}}
+	return x.times(y).times(z)
+}
+
+// angles returns the XYZ Euler angles of a rotation, as three.js reads
+// them
+func (m matrix) angles() [3]float64 {
+	var a [3]float64
+	a[1] = math.Asin(math.Max(-1, math.Min(1, m[0][2])))
+	if math.Abs(m[0][2]) < 0.9999999 {
+		a[0] = math.Atan2(-m[1][2], m[2][2])
+		a[2] = math.Atan2(-m[0][1], m[0][0])
+	} else {
+		a[0] = math.Atan2(m[2][1], m[1][1])
+	}
+	return [3]float64{numbers.Round(a[0], precision), numbers.Round(a[1], precision), numbers.Round(a[2], precision)}
+}
+
+// precision drops the float noise of conversion, keeping nanometres
+const precision = 9
+
+// vector reads an x, y, z value, decoded through JSON where operation
+// data holds typed structs
+func vector(value interface{}) ([3]float64, bool) {
+	fields, isMap := value.(map[string]interface{})
+	if !isMap && value != nil {
+		if encoded, err := json.Marshal(value); err == nil {
+			json.Unmarshal(encoded, &fields)
+		}
+	}
+	var v [3]float64
+	for i, axis := range []string{"x", "y", "z"} {
+		component, ok := fields[axis].(float64)
+		if !ok {
+			return v, false
+		}
+		v[i] = component
+	}
+	return v, true
+}
+
+func object(v [3]float64) map[string]interface{} {
+	return map[string]interface{}{"x": numbers.Round(v[0], precision), "y": numbers.Round(v[1], precision), "z": numbers.Round(v[2], precision)}
+}
+
+// clone copies entity data through JSON, leaving plain maps throughout
+func clone(entity map[string]interface{}) map[string]interface{} {
+	var copied map[string]interface{}
+	encoded, err := json.Marshal(entity)
+	if err == nil {
+		json.Unmarshal(encoded, &copied)
+	}
+	return copied
+}
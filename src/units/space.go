@@ -0,0 +1,160 @@
+// Package units defines the unit system and coordinate space a world is
+// exchanged in.
+//
+// HD1 itself works in metres with y up, like three.js. A world may declare
+// another space: units (meters, centimeters, millimeters, feet or inches),
+// the up axis (y or z, right-handed) and an origin offset, the coordinates
+// HD1's origin has in that space. The space lives in the world's scene
+// settings under "space", so it is versioned with the operation log like
+// the physics profile.
+//
+// Conversion happens at the edges. Exports are written in the world's
+// space and declare it; imported documents that declare a space are
+// converted back. Models are assumed authored in the world's space, so an
+// entity created with a model gets the scale and rotation that show it
+// upright and at its size.
+package units
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"holodeck1/sync"
+)
+
+// Units
+const (
+	Meters      = "meters"
+	Centimeters = "centimeters"
+	Millimeters = "millimeters"
+	Feet        = "feet"
+	Inches      = "inches"
+)
+
+// metres per unit
+var metres = map[string]float64{
+	Meters:      1,
+	Centimeters: 0.01,
+	Millimeters: 0.001,
+	Feet:        0.3048,
+	Inches:      0.0254,
+}
+
+// maxOrigin bounds origin components, enough for projected map coordinates
+const maxOrigin = 1e8
+
+// Vector is a point in a space
+type Vector struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+// Space is a world's unit system and coordinate space
+type Space struct {
+	Units  string `json:"units"`   // meters, centimeters, millimeters, feet or inches
+	UpAxis string `json:"up_axis"` // y or z
+	Origin Vector `json:"origin"`  // HD1's origin in this space's units and axes
+}
+
+// Default returns HD1's own space: metres, y up, no offset
+func Default() *Space {
+	return &Space{Units: Meters, UpAxis: "y"}
+}
+
+// Validate checks a space, defaulting omitted units and up axis
+func (s *Space) Validate() error {
+	if s.Units == "" {
+		s.Units = Meters
+	}
+	if s.UpAxis == "" {
+		s.UpAxis = "y"
+	}
+	if _, ok := metres[s.Units]; !ok {
+		names := make([]string, 0, len(metres))
+		for name := range metres {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown units %q (%s)", s.Units, strings.Join(names, ", "))
+	}
+	if s.UpAxis != "y" && s.UpAxis != "z" {
+		return fmt.Errorf("up_axis must be y or z")
+	}
+	for _, component := range []float64{s.Origin.X, s.Origin.Y, s.Origin.Z} {
+		if math.IsNaN(component) || math.Abs(component) > maxOrigin {
+			return fmt.Errorf("origin components must be within ±%g", float64(maxOrigin))
+		}
+	}
+	return nil
+}
+
+// IsDefault reports whether the space is HD1's own, so conversion is a
+// no-op
+func (s *Space) IsDefault() bool {
+	return *s == *Default()
+}
+
+// Data returns the space as scene_update data
+func (s *Space) Data() map[string]interface{} {
+	var data map[string]interface{}
+	encoded, _ := json.Marshal(s)
+	json.Unmarshal(encoded, &data)
+	return data
+}
+
+// Decode reads a space from scene settings or a document
+func Decode(value interface{}) (*Space, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var space Space
+	if err := json.Unmarshal(encoded, &space); err != nil {
+		return nil, fmt.Errorf("invalid space: %v", err)
+	}
+	if err := space.Validate(); err != nil {
+		return nil, err
+	}
+	return &space, nil
+}
+
+func init() {
+	// A space set by a raw scene update is checked as the endpoint checks it
+	sync.RegisterOperation(sync.OpSceneUpdate, func(data map[string]interface{}) error {
+		if value, ok := data["space"]; ok {
+			if _, err := Decode(value); err != nil {
+				return fmt.Errorf("invalid space: %v", err)
+			}
+		}
+		return nil
+	})
+}
+
+// FromScene returns the space in a world's scene settings, or the default
+// space when there is none
+func FromScene(scene map[string]interface{}) *Space {
+	if value, ok := scene["space"]; ok {
+		if space, err := Decode(value); err == nil {
+			return space
+		}
+	}
+	return Default()
+}
+
+// FromLog returns the space last set in an operation log. Scene settings
+// cannot be unset, so the latest scene_update naming it is current.
+func FromLog(ops []*sync.Operation) *Space {
+	for i := len(ops) - 1; i >= 0; i-- {
+		if ops[i].Type != sync.OpSceneUpdate {
+			continue
+		}
+		if value, ok := ops[i].Data["space"]; ok {
+			return FromScene(map[string]interface{}{"space": value})
+		}
+	}
+	return Default()
+}
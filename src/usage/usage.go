@@ -0,0 +1,247 @@
+// Package usage measures what the served world costs the server and holds
+// it to its budgets.
+//
+// The meter follows the operation log: it keeps the estimated size of
+// every live entity and scene setting, field by field, so the world's
+// memory is the JSON it would take to send the world to a joining client.
+// Once a second the simulation loop samples the log's sequence and the
+// time bindings spent stepping, giving the delta rate and script CPU over
+// the last minute.
+//
+// Budgets cap a world's live entities and memory. A creation that would go
+// over is refused; entities admitted but not yet in the log are held
+// against the budget for a minute, so a burst of creations, or one large
+// transaction, cannot slip past it.
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"holodeck1/config"
+	"holodeck1/simulation"
+	hd1sync "holodeck1/sync"
+)
+
+// window is the span rates are averaged over
+const window = time.Minute
+
+// scripts names the simulation system whose CPU counts as script time
+const scripts = "bindings"
+
+// Log is the operation log the meter follows
+type Log interface {
+	GetCurrentSequence() uint64
+	GetOperationsInRange(from, to uint64) []*hd1sync.Operation
+}
+
+// Budget is what a world may hold; 0 means no limit
+type Budget struct {
+	MaxEntities int   `json:"max_entities"`
+	MaxMemory   int64 `json:"max_memory"` // Estimated bytes
+}
+
+// Usage reports what a world costs
+type Usage struct {
+	World      string  `json:"world"`
+	Entities   int     `json:"entities"`   // Live entities, admitted ones included
+	Memory     int64   `json:"memory"`     // Estimated bytes of entities and scene settings
+	DeltaRate  float64 `json:"delta_rate"` // Operations a second over the last minute
+	ScriptCPU  float64 `json:"script_cpu"` // Share of one core bindings took over the last minute
+	Operations uint64  `json:"operations"` // Operations the world has sequenced
+	Budget     Budget  `json:"budget"`     // Budgets the world is held to
+	Refused    uint64  `json:"refused"`    // Creations refused over budget
+}
+
+// sample is the log and script time at one moment
+type sample struct {
+	at     time.Time
+	seqNum uint64
+	busy   float64 // Milliseconds bindings spent stepping
+}
+
+var (
+	log      Log
+	world    string
+	seqNum   uint64
+	entities = map[string]map[string]int{} // Field sizes of live entities
+	scene    = map[string]int{}            // Sizes of scene settings
+	memory   int64
+	admitted = map[string]time.Time{} // Entities admitted but not yet seen
+	samples  []sample
+	refused  uint64
+	mutex    sync.Mutex
+)
+
+// Track starts metering a world's operation log
+func Track(name string, l Log) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	world, log = name, l
+}
+
+// Stepper returns the step sampling the log's rate and script time; the
+// simulation loop calls it every second
+func Stepper() func(now time.Time) {
+	return func(time.Time) {
+		var busy float64
+		for _, system := range simulation.Stats().Systems {
+			if system.Name == scripts {
+				busy = system.Busy
+			}
+		}
+		// Rates are over real time whatever the world's clock does
+		now := time.Now()
+		mutex.Lock()
+		defer mutex.Unlock()
+		catchUp()
+		samples = append(samples, sample{at: now, seqNum: seqNum, busy: busy})
+		cut := 0
+		for cut < len(samples)-1 && now.Sub(samples[cut].at) > window {
+			cut++
+		}
+		samples = samples[cut:]
+	}
+}
+
+// catchUp applies the operations sequenced since the last call; callers
+// hold the mutex
+func catchUp() {
+	if log == nil {
+		return
+	}
+	current := log.GetCurrentSequence()
+	if current <= seqNum {
+		return
+	}
+	for _, op := range log.GetOperationsInRange(seqNum+1, current) {
+		for _, part := range op.Parts() {
+			apply(part)
+		}
+	}
+	seqNum = current
+}
+
+// size estimates the bytes of one field as JSON
+func size(key string, value interface{}) int {
+	encoded, _ := json.Marshal(value)
+	return len(key) + len(encoded) + 4 // Quotes, colon and comma
+}
+
+// apply meters one operation
+func apply(op *hd1sync.Operation) {
+	id, _ := op.Data["id"].(string)
+	switch op.Type {
+	case hd1sync.OpEntityCreate:
+		if id == "" {
+			return
+		}
+		if fields, ok := entities[id]; ok {
+			for _, n := range fields {
+				memory -= int64(n)
+			}
+		}
+		fields := make(map[string]int, len(op.Data))
+		for key, value := range op.Data {
+			fields[key] = size(key, value)
+			memory += int64(fields[key])
+		}
+		entities[id] = fields
+		delete(admitted, id)
+	case hd1sync.OpEntityUpdate:
+		fields, ok := entities[id]
+		if !ok {
+			return
+		}
+		for key, value := range op.Data {
+			memory += int64(size(key, value) - fields[key])
+			fields[key] = size(key, value)
+		}
+	case hd1sync.OpEntityDelete:
+		for _, n := range entities[id] {
+			memory -= int64(n)
+		}
+		delete(entities, id)
+	case hd1sync.OpSceneUpdate:
+		if _, ok := op.Data["operation"]; ok {
+			return // add_light, set_camera
+		}
+		for key, value := range op.Data {
+			memory += int64(size(key, value) - scene[key])
+			scene[key] = size(key, value)
+		}
+	}
+}
+
+// budget returns the served world's budget
+func budget() Budget {
+	return Budget{
+		MaxEntities: config.GetBudgetsMaxEntities(world),
+		MaxMemory:   config.GetBudgetsMaxMemory(world),
+	}
+}
+
+// count returns the live and admitted entities; callers hold the mutex
+func count(now time.Time) int {
+	for id, at := range admitted {
+		if now.Sub(at) >= window {
+			delete(admitted, id)
+		}
+	}
+	return len(entities) + len(admitted)
+}
+
+// Admit holds a new entity against the world's budgets, or returns why
+// it is refused
+func Admit(entityID string) error {
+	now := time.Now()
+	mutex.Lock()
+	defer mutex.Unlock()
+	catchUp()
+	b := budget()
+	if b.MaxEntities > 0 && count(now) >= b.MaxEntities {
+		refused++
+		return fmt.Errorf("world entity budget reached: %d entities", b.MaxEntities)
+	}
+	if b.MaxMemory > 0 && memory >= b.MaxMemory {
+		refused++
+		return fmt.Errorf("world memory budget reached: %d bytes", b.MaxMemory)
+	}
+	admitted[entityID] = now
+	return nil
+}
+
+// Release drops entities admitted but never created, such as those of a
+// refused import
+func Release(entityIDs ...string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, id := range entityIDs {
+		delete(admitted, id)
+	}
+}
+
+// Current reports the served world's usage
+func Current() Usage {
+	mutex.Lock()
+	defer mutex.Unlock()
+	catchUp()
+	usage := Usage{
+		World:      world,
+		Entities:   count(time.Now()),
+		Memory:     memory,
+		Operations: seqNum,
+		Budget:     budget(),
+		Refused:    refused,
+	}
+	if len(samples) > 1 {
+		first, last := samples[0], samples[len(samples)-1]
+		if elapsed := last.at.Sub(first.at); elapsed > 0 {
+			usage.DeltaRate = float64(last.seqNum-first.seqNum) / elapsed.Seconds()
+			usage.ScriptCPU = (last.busy - first.busy) / float64(elapsed.Milliseconds())
+		}
+	}
+	return usage
+}
@@ -0,0 +1,243 @@
+// Package views keeps the named camera viewpoints of each world, such as
+// "lobby" or "stage", so visitors of large scenes can jump between them and
+// share deep links that open a world at one:
+//
+//	/w/world_one?view=lobby
+//
+// Views are written to the storage backend and reloaded on restart.
+package views
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"holodeck1/logging"
+	"holodeck1/storage"
+)
+
+// Limits of a valid view
+const (
+	MaxViews       = 200 // Per world
+	MaxTitleLength = 200
+	maxCoordinate  = 1e6 // Metres from the origin
+)
+
+// ErrNotFound is returned for unknown views
+var ErrNotFound = errors.New("view not found")
+
+// ErrTooMany is returned when a world holds MaxViews views
+var ErrTooMany = fmt.Errorf("worlds hold at most %d views", MaxViews)
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Position is where a view's camera stands, in metres
+type Position struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+// View is a named camera viewpoint. The camera looks along -z turned by
+// Yaw about the vertical axis, then tilted by Pitch, as consoles hold it.
+type View struct {
+	Name      string    `json:"name"`
+	World     string    `json:"world"`
+	Title     string    `json:"title,omitempty"`
+	Position  Position  `json:"position"`
+	Yaw       float64   `json:"yaw"`   // Radians, counter-clockwise seen from above
+	Pitch     float64   `json:"pitch"` // Radians, up positive, within ±π/2
+	Link      string    `json:"link"`  // Deep link opening the world at the view
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Validate checks a view before it is stored, trimming its title and
+// turning its yaw into ±π
+func (v *View) Validate() error {
+	if !namePattern.MatchString(v.Name) {
+		return fmt.Errorf("name must match %s", namePattern)
+	}
+	if !namePattern.MatchString(v.World) {
+		return fmt.Errorf("world must match %s", namePattern)
+	}
+	v.Title = strings.TrimSpace(v.Title)
+	if utf8.RuneCountInString(v.Title) > MaxTitleLength {
+		return fmt.Errorf("title must be at most %d characters", MaxTitleLength)
+	}
+	for _, coordinate := range []float64{v.Position.X, v.Position.Y, v.Position.Z} {
+		if !(math.Abs(coordinate) <= maxCoordinate) {
+			return fmt.Errorf("position must be within %gm of the origin", float64(maxCoordinate))
+		}
+	}
+	if math.IsNaN(v.Yaw) || math.IsInf(v.Yaw, 0) {
+		return errors.New("yaw must be a number")
+	}
+	if !(math.Abs(v.Pitch) <= math.Pi/2) {
+		return errors.New("pitch must be within ±π/2")
+	}
+	v.Yaw = math.Remainder(v.Yaw, 2*math.Pi)
+	return nil
+}
+
+// Link returns the deep link opening a world at a view
+func Link(world, name string) string {
+	return "/w/" + url.PathEscape(world) + "?view=" + url.QueryEscape(name)
+}
+
+var (
+	views = make(map[string]*View) // Keyed by world and name
+	mutex sync.RWMutex
+)
+
+func viewKey(world, name string) string {
+	return world + "/" + name
+}
+
+func storageKey(v *View) (string, error) {
+	return storage.Key(storage.NamespaceWorlds, v.World+"/views/"+v.Name+".json")
+}
+
+// Initialize loads views from the storage backend
+func Initialize(ctx context.Context) error {
+	backend := storage.Default()
+	if backend == nil {
+		return fmt.Errorf("storage backend unavailable")
+	}
+	objects, err := backend.List(ctx, storage.NamespaceWorlds+"/")
+	if err != nil {
+		return err
+	}
+
+	loaded := 0
+	for _, object := range objects {
+		if !strings.Contains(object.Key, "/views/") || !strings.HasSuffix(object.Key, ".json") {
+			continue
+		}
+		body, _, err := backend.Get(ctx, object.Key)
+		if err != nil {
+			continue
+		}
+		var view View
+		err = json.NewDecoder(body).Decode(&view)
+		body.Close()
+		if err != nil || view.Validate() != nil {
+			logging.Warn("skipping unreadable view", map[string]interface{}{"key": object.Key})
+			continue
+		}
+		view.Link = Link(view.World, view.Name)
+		mutex.Lock()
+		views[viewKey(view.World, view.Name)] = &view
+		mutex.Unlock()
+		loaded++
+	}
+
+	logging.Info("camera views loaded", map[string]interface{}{
+		"views": loaded,
+	})
+	return nil
+}
+
+// Put stores a view, replacing the one of its name; a replaced view keeps
+// its creator and creation time. It returns the view as stored.
+func Put(ctx context.Context, view *View, now time.Time) (*View, error) {
+	if err := view.Validate(); err != nil {
+		return nil, err
+	}
+	now = now.UTC()
+	stored := *view
+	stored.Link = Link(view.World, view.Name)
+	stored.CreatedAt = now
+	stored.UpdatedAt = now
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if existing, ok := views[viewKey(view.World, view.Name)]; ok {
+		stored.CreatedBy = existing.CreatedBy
+		stored.CreatedAt = existing.CreatedAt
+	} else if held := len(listLocked(view.World)); held >= MaxViews {
+		return nil, ErrTooMany
+	}
+
+	key, err := storageKey(&stored)
+	if err != nil {
+		return nil, err
+	}
+	backend := storage.Default()
+	if backend == nil {
+		return nil, fmt.Errorf("storage backend unavailable")
+	}
+	encoded, err := json.Marshal(&stored)
+	if err != nil {
+		return nil, err
+	}
+	if err := backend.Put(ctx, key, bytes.NewReader(encoded), int64(len(encoded)), "application/json"); err != nil {
+		return nil, err
+	}
+	views[viewKey(view.World, view.Name)] = &stored
+	copied := stored
+	return &copied, nil
+}
+
+// Get returns a world's view
+func Get(world, name string) (*View, error) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	view, ok := views[viewKey(world, name)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *view
+	return &copied, nil
+}
+
+// List returns a world's views by name
+func List(world string) []*View {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return listLocked(world)
+}
+
+// listLocked copies a world's views; call it holding the mutex
+func listLocked(world string) []*View {
+	result := []*View{}
+	for _, view := range views {
+		if view.World == world {
+			copied := *view
+			result = append(result, &copied)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Delete removes a view and its stored copy, returning it as it was
+func Delete(ctx context.Context, world, name string) (*View, error) {
+	mutex.Lock()
+	view, ok := views[viewKey(world, name)]
+	delete(views, viewKey(world, name))
+	mutex.Unlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if backend := storage.Default(); backend != nil {
+		if key, err := storageKey(view); err == nil {
+			if err := backend.Delete(ctx, key); err != nil && err != storage.ErrNotFound {
+				return view, err
+			}
+		}
+	}
+	return view, nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	hd1sync "holodeck1/sync"
+)
+
+// watch_filter picks the events hd1 watch prints
+type watch_filter struct {
+	entity string
+	types  map[string]bool
+	after  uint64 // Operations up to here were sent before watching began
+}
+
+// run_watch tails the local server's WebSocket: hd1 watch [--world W]
+// [--entity ID] [--type T,...] [--format pretty|jsonl] [--history]. It
+// prints the world's operations as they are sequenced; --type also takes
+// other message types, such as maintenance. It runs until interrupted or
+// the server closes the connection.
+func run_watch(args []string) int {
+	flags := flag.NewFlagSet("watch", flag.ContinueOnError)
+	world := flags.String("world", "", "World to watch (default: the served world)")
+	entity := flags.String("entity", "", "Only operations on this entity")
+	types := flags.String("type", "", "Only these operation or message types, comma separated")
+	format := flags.String("format", "pretty", "Output format: pretty or jsonl")
+	history := flags.Bool("history", false, "Print the operations sequenced before watching began")
+	address := flags.String("address", "", "Server address (default: the first listener)")
+	profile := flags.String("profile", "", "Server profile (see hd1 login)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: hd1 watch [--world NAME] [--entity ID] [--type T,...] [--format pretty|jsonl] [--history] [--address host:port|unix:///path | --profile NAME]")
+	}
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		return exitUsage
+	}
+	if *format != "pretty" && *format != "jsonl" {
+		fmt.Fprintf(os.Stderr, "watch: unknown format: %s\n", *format)
+		return exitUsage
+	}
+	target, ok := resolve_target("watch", *address, *profile)
+	if !ok {
+		return exitUsage
+	}
+
+	filter := watch_filter{entity: *entity}
+	if *types != "" {
+		filter.types = map[string]bool{}
+		for _, name := range strings.Split(*types, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				filter.types[name] = true
+			}
+		}
+	}
+
+	client, base := target.client, target.base
+	if *world != "" {
+		// Only the served world has a clock; any other is not found
+		response, err := client.Get(base + "/api/worlds/" + *world + "/clock")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "watch: %v\n", err)
+			return exitFailed
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			fmt.Fprintf(os.Stderr, "watch: world %s answered %s\n", *world, response.Status)
+			return exitFailed
+		}
+	}
+	if !*history {
+		var stats struct {
+			Stats struct {
+				NextSequence uint64 `json:"next_sequence"`
+			} `json:"stats"`
+		}
+		response, err := client.Get(base + "/api/sync/stats")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "watch: %v\n", err)
+			return exitFailed
+		}
+		json.NewDecoder(response.Body).Decode(&stats)
+		response.Body.Close()
+		if stats.Stats.NextSequence > 0 {
+			filter.after = stats.Stats.NextSequence - 1
+		}
+	}
+
+	dialer, url, header := target.websocket()
+	conn, response, err := dialer.Dial(url, header)
+	if err != nil {
+		if response != nil {
+			fmt.Fprintf(os.Stderr, "watch: server answered %s\n", response.Status)
+		} else {
+			fmt.Fprintf(os.Stderr, "watch: %v\n", err)
+		}
+		return exitFailed
+	}
+	defer conn.Close()
+
+	interrupt := make(chan os.Signal, 1)
+	stopped := make(chan struct{})
+	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-interrupt
+		close(stopped)
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		conn.Close()
+	}()
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			select {
+			case <-stopped:
+				return exitOK
+			default:
+			}
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				fmt.Fprintln(os.Stderr, "watch: server closed the connection")
+				return exitOK
+			}
+			fmt.Fprintf(os.Stderr, "watch: %v\n", err)
+			return exitFailed
+		}
+		if filter.matches(message) {
+			print_event(os.Stdout, message, *format)
+		}
+	}
+}
+
+// matches reports whether a message from /ws passes the filter
+func (f watch_filter) matches(message []byte) bool {
+	var envelope struct {
+		Type      string             `json:"type"`
+		Operation *hd1sync.Operation `json:"operation"`
+	}
+	if err := json.Unmarshal(message, &envelope); err != nil {
+		return false
+	}
+	if envelope.Type != "sync_operation" || envelope.Operation == nil {
+		// Other messages only when asked for by type
+		return f.types[envelope.Type] && f.entity == ""
+	}
+	op := envelope.Operation
+	if op.SeqNum <= f.after {
+		return false
+	}
+	if f.types == nil && f.entity == "" {
+		return true
+	}
+	for _, part := range op.Parts() {
+		if f.types != nil && !f.types[part.Type] && !f.types[op.Type] {
+			continue
+		}
+		if id, _ := part.Data["id"].(string); f.entity != "" && id != f.entity {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// print_event writes one message: as it arrived for jsonl, or a summary
+// line and indented data for pretty
+func print_event(out io.Writer, message []byte, format string) {
+	if format == "jsonl" {
+		var compact bytes.Buffer
+		if json.Compact(&compact, message) == nil {
+			message = compact.Bytes()
+		}
+		fmt.Fprintf(out, "%s\n", message)
+		return
+	}
+
+	var envelope struct {
+		Type      string             `json:"type"`
+		Operation *hd1sync.Operation `json:"operation"`
+	}
+	json.Unmarshal(message, &envelope)
+	var body []byte
+	if op := envelope.Operation; op != nil {
+		fmt.Fprintf(out, "%s  #%d  %s  by %s\n", op.Timestamp.Local().Format("15:04:05.000"), op.SeqNum, op.Type, op.ClientID)
+		body, _ = json.MarshalIndent(op.Data, "  ", "  ")
+	} else {
+		fmt.Fprintf(out, "%s  %s\n", time.Now().Format("15:04:05.000"), envelope.Type)
+		var indented bytes.Buffer
+		json.Indent(&indented, message, "  ", "  ")
+		body = indented.Bytes()
+	}
+	fmt.Fprintf(out, "  %s\n", body)
+}
+
+// websocket returns a dialer, /ws URL and headers for the target. The
+// local server is reached as local_client reaches it.
+func (t *server_target) websocket() (*websocket.Dialer, string, http.Header) {
+	dialer := &websocket.Dialer{HandshakeTimeout: 5 * time.Second}
+	header := http.Header{}
+	if t.token != "" {
+		header.Set("Authorization", "Bearer "+t.token)
+	}
+	if t.listen != nil && t.listen.network == "unix" {
+		dialer.NetDialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", t.listen.address)
+		}
+		return dialer, "ws://hd1/ws", header
+	}
+
+	if strings.HasPrefix(t.base, "https://") {
+		if t.listen != nil {
+			dialer.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		}
+		return dialer, "wss://" + strings.TrimPrefix(t.base, "https://") + "/ws", header
+	}
+	return dialer, "ws://" + strings.TrimPrefix(t.base, "http://") + "/ws", header
+}
@@ -0,0 +1,350 @@
+package webhooks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"holodeck1/config"
+	"holodeck1/entityid"
+	hd1sync "holodeck1/sync"
+)
+
+// An alertmanager webhook is a built-in mapping for Prometheus
+// Alertmanager's webhook receiver. Each alert is a box, coloured and sized
+// by its severity label, and alerts are laid out in rows by the labels in
+// group_by, one row per group with a label naming it:
+//
+//	webhooks:
+//	  alerts:
+//	    secret: s3cret
+//	    alertmanager:
+//	      group_by: [namespace]
+//	      severities:
+//	        page: {color: "#ff00ff", size: 2}
+//
+// Resolved alerts are deleted, or with resolved: keep, turn green. Rows and
+// places in them are kept in memory; after a restart alerts move into new
+// places as Alertmanager resends them.
+
+// MonitoringWorld is the world alertmanager webhooks change unless they
+// name another
+const MonitoringWorld = "monitoring"
+
+// What becomes of resolved alerts
+const (
+	ResolvedDelete = "delete"
+	ResolvedKeep   = "keep"
+)
+
+// Severity is how alerts of a severity look
+type Severity struct {
+	Color string  `yaml:"color"`
+	Size  float64 `yaml:"size"` // Metres along each side
+}
+
+// severities are the built-in looks, by severity label; alerts with
+// another are drawn as unknownSeverity
+var severities = map[string]Severity{
+	"critical": {Color: "#d7263d", Size: 1.6},
+	"error":    {Color: "#e8590c", Size: 1.4},
+	"warning":  {Color: "#f49d37", Size: 1.2},
+	"info":     {Color: "#3f88c5", Size: 0.9},
+}
+
+var (
+	unknownSeverity  = Severity{Color: "#9e9e9e", Size: 0.8}
+	resolvedSeverity = Severity{Color: "#2e933c", Size: 0.8}
+)
+
+var (
+	colorPattern       = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+	fingerprintPattern = regexp.MustCompile(`^[0-9a-f]{1,32}$`)
+)
+
+// Alertmanager is the alertmanager mapping of a webhook
+type Alertmanager struct {
+	GroupBy    []string            `yaml:"group_by"`   // Labels grouping alerts into rows; alertname when empty
+	Resolved   string              `yaml:"resolved"`   // delete (the default) or keep
+	Severities map[string]Severity `yaml:"severities"` // Looks by severity label, over the built-in ones
+	Spacing    float64             `yaml:"spacing"`    // Metres between places; 2.5 when 0
+	Chat       bool                `yaml:"chat"`       // Also post alerts firing and resolving to chat
+}
+
+// layout is where alerts are: a row per group, a place per alert
+type layout struct {
+	rows   map[string]int            // Group key -> row
+	places map[string]map[string]int // Group key -> alert entity ID -> place
+}
+
+func (l *layout) clone() *layout {
+	copied := &layout{rows: map[string]int{}, places: map[string]map[string]int{}}
+	if l == nil {
+		return copied
+	}
+	for key, row := range l.rows {
+		copied.rows[key] = row
+	}
+	for key, places := range l.places {
+		copied.places[key] = map[string]int{}
+		for id, place := range places {
+			copied.places[key][id] = place
+		}
+	}
+	return copied
+}
+
+// take returns the row of a group and the place of an alert in it, taking
+// the first free ones for new groups and alerts
+func (l *layout) take(key, id string) (int, int, bool) {
+	row, ok := l.rows[key]
+	if !ok {
+		row = lowestFree(l.rows)
+		l.rows[key] = row
+		l.places[key] = map[string]int{}
+	}
+	place, known := l.places[key][id]
+	if !known {
+		place = lowestFree(l.places[key])
+		l.places[key][id] = place
+	}
+	return row, place, !ok
+}
+
+// free gives up an alert's place, and its group's row when it was the last
+func (l *layout) free(key, id string) (emptied bool) {
+	if _, ok := l.places[key][id]; !ok {
+		return false // Placed before a restart; its group may hold others
+	}
+	delete(l.places[key], id)
+	if len(l.places[key]) > 0 {
+		return false
+	}
+	delete(l.places, key)
+	delete(l.rows, key)
+	return true
+}
+
+// lowestFree returns the lowest index none of taken holds
+func lowestFree(taken map[string]int) int {
+	used := map[int]bool{}
+	for _, index := range taken {
+		used[index] = true
+	}
+	index := 0
+	for used[index] {
+		index++
+	}
+	return index
+}
+
+func (a *Alertmanager) validate() error {
+	switch a.Resolved {
+	case "":
+		a.Resolved = ResolvedDelete
+	case ResolvedDelete, ResolvedKeep:
+	default:
+		return fmt.Errorf("resolved must be %s or %s", ResolvedDelete, ResolvedKeep)
+	}
+	if len(a.GroupBy) == 0 {
+		a.GroupBy = []string{"alertname"}
+	}
+	if a.Spacing == 0 {
+		a.Spacing = 2.5
+	}
+	if a.Spacing < 0 || a.Spacing > 100 || math.IsNaN(a.Spacing) {
+		return fmt.Errorf("spacing must be within 0-100m")
+	}
+	for name, severity := range a.Severities {
+		if !colorPattern.MatchString(severity.Color) {
+			return fmt.Errorf("severity %s: color must be #rrggbb", name)
+		}
+		if !(severity.Size > 0 && severity.Size <= 10) {
+			return fmt.Errorf("severity %s: size must be within 0-10m", name)
+		}
+	}
+	return nil
+}
+
+// look returns how an alert of a severity is drawn
+func (a *Alertmanager) look(severity string) Severity {
+	severity = strings.ToLower(severity)
+	if look, ok := a.Severities[severity]; ok {
+		return look
+	}
+	if look, ok := severities[severity]; ok {
+		return look
+	}
+	return unknownSeverity
+}
+
+// alert is an alert as Alertmanager sends it
+type alert struct {
+	Status      string            `json:"status"` // firing or resolved
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	Fingerprint string            `json:"fingerprint"`
+}
+
+// plan lays out a notification's alerts
+func (a *Alertmanager) plan(h *Webhook, delivery *Delivery) (*Plan, error) {
+	plan := &Plan{Webhook: h.Name, World: h.TargetWorld(), Operations: []Operation{}, Messages: []Message{}}
+	alerts, err := decodeAlerts(delivery.Payload)
+	if err != nil {
+		return nil, err
+	}
+	places := h.layout.Load().clone()
+	unannounced := 0
+	labelled := map[string]bool{} // Groups whose label this delivery already places
+	for i, alert := range alerts {
+		id := alertID(alert)
+		key, title := a.group(alert.Labels)
+		live := entityid.Live(id)
+		resolved := alert.Status == "resolved"
+		at := fmt.Sprintf("alert %d (%s)", i, id)
+
+		if resolved && !live {
+			plan.Skipped = append(plan.Skipped, at+": resolved, not shown")
+			continue
+		}
+		if resolved && a.Resolved == ResolvedDelete {
+			plan.Operations = append(plan.Operations, Operation{Type: hd1sync.OpEntityDelete, Data: map[string]interface{}{"id": id}})
+			if places.free(key, id) && entityid.Live(groupID(key)) {
+				plan.Operations = append(plan.Operations, Operation{Type: hd1sync.OpEntityDelete, Data: map[string]interface{}{"id": groupID(key)}})
+			}
+		} else {
+			look := a.look(alert.Labels["severity"])
+			if resolved {
+				look = resolvedSeverity
+			}
+			row, place, added := places.take(key, id)
+			z := -float64(row) * a.Spacing
+			operation := Operation{Type: hd1sync.OpEntityCreate, Data: map[string]interface{}{
+				"id":       id,
+				"geometry": map[string]interface{}{"type": "box", "width": look.Size, "height": look.Size, "depth": look.Size},
+				"material": map[string]interface{}{"color": look.Color},
+				"position": map[string]interface{}{"x": float64(place+1) * a.Spacing, "y": look.Size / 2, "z": z},
+			}}
+			if live {
+				operation.Type = hd1sync.OpEntityUpdate
+			}
+			if (added || !entityid.Live(groupID(key))) && !labelled[key] {
+				labelled[key] = true
+				label := Operation{Type: hd1sync.OpEntityCreate, Data: map[string]interface{}{
+					"id":       groupID(key),
+					"panel":    map[string]interface{}{"kind": "label", "content": title},
+					"position": map[string]interface{}{"x": 0, "y": 0.5, "z": z},
+				}}
+				if entityid.Live(groupID(key)) {
+					label.Type = hd1sync.OpEntityUpdate
+				}
+				plan.Operations = append(plan.Operations, label)
+			}
+			plan.Operations = append(plan.Operations, operation)
+		}
+
+		if a.Chat && live == resolved {
+			// Announced when it appears or goes, not on every resend
+			if len(plan.Messages) == MaxMessages {
+				unannounced++
+				continue
+			}
+			plan.Messages = append(plan.Messages, Message{From: "Alertmanager", Text: announcement(alert)})
+		}
+	}
+	if max := config.GetSyncTransactionMaxOperations(); len(plan.Operations) > max {
+		return nil, fmt.Errorf("more than %d entity operations", max)
+	}
+	if unannounced > 0 {
+		plan.Skipped = append(plan.Skipped, fmt.Sprintf("chat: %d more alerts not announced", unannounced))
+	}
+	plan.layout = places
+	return plan, nil
+}
+
+// decodeAlerts reads the alerts of a notification
+func decodeAlerts(payload interface{}) ([]alert, error) {
+	notification, _ := payload.(map[string]interface{})
+	list, ok := notification["alerts"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("not an Alertmanager notification: no alerts")
+	}
+	alerts := make([]alert, 0, len(list))
+	for i, item := range list {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("alert %d is not an object", i)
+		}
+		decoded := alert{Labels: stringFields(fields["labels"]), Annotations: stringFields(fields["annotations"])}
+		decoded.Status, _ = fields["status"].(string)
+		decoded.Fingerprint, _ = fields["fingerprint"].(string)
+		alerts = append(alerts, decoded)
+	}
+	return alerts, nil
+}
+
+// stringFields reads an object of strings, such as labels
+func stringFields(value interface{}) map[string]string {
+	result := map[string]string{}
+	fields, _ := value.(map[string]interface{})
+	for key, field := range fields {
+		if text, ok := field.(string); ok {
+			result[key] = text
+		}
+	}
+	return result
+}
+
+// group returns the key of an alert's group and the title of its row
+func (a *Alertmanager) group(labels map[string]string) (string, string) {
+	values := make([]string, len(a.GroupBy))
+	pairs := make([]string, len(a.GroupBy))
+	for i, name := range a.GroupBy {
+		values[i] = labels[name]
+		if values[i] == "" {
+			values[i] = "-"
+		}
+		pairs[i] = name + "=" + values[i]
+	}
+	return strings.Join(values, "\x00"), strings.Join(pairs, " ")
+}
+
+// alertID returns an alert's entity ID: from its fingerprint, or from its
+// labels when Alertmanager sent none
+func alertID(a alert) string {
+	if fingerprintPattern.MatchString(a.Fingerprint) {
+		return "alert-" + a.Fingerprint
+	}
+	names := make([]string, 0, len(a.Labels))
+	for name := range a.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sum := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(sum, "%s\x00%s\x00", name, a.Labels[name])
+	}
+	return "alert-" + hex.EncodeToString(sum.Sum(nil))[:16]
+}
+
+// groupID returns the entity ID of a group's label
+func groupID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "alert-group-" + hex.EncodeToString(sum[:])[:12]
+}
+
+// announcement is an alert's chat message
+func announcement(a alert) string {
+	text := strings.ToUpper(a.Status) + " " + a.Labels["alertname"]
+	if severity := a.Labels["severity"]; severity != "" {
+		text += " (" + severity + ")"
+	}
+	if summary := a.Annotations["summary"]; summary != "" {
+		text += ": " + summary
+	}
+	return text
+}
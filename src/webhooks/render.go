@@ -0,0 +1,356 @@
+package webhooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"holodeck1/config"
+	"holodeck1/entityid"
+	"holodeck1/params"
+	hd1sync "holodeck1/sync"
+)
+
+// MaxMessages bounds the chat messages one delivery posts
+const MaxMessages = 20
+
+// funcs are the functions templates may call besides the built-in ones
+var funcs = template.FuncMap{
+	// json renders a value as JSON, so a whole object or list can be copied
+	"json": func(value interface{}) (string, error) {
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	},
+	// string renders a value as a JSON string, keeping "404" from becoming
+	// a number in entity data
+	"string": func(value interface{}) string {
+		encoded, _ := json.Marshal(fmt.Sprint(value))
+		return string(encoded)
+	},
+	"default": func(fallback, value interface{}) interface{} {
+		if value == nil || value == "" {
+			return fallback
+		}
+		return value
+	},
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// Delivery is an inbound request as rules see it
+type Delivery struct {
+	Payload interface{}
+	Headers http.Header
+	Query   url.Values
+}
+
+// Operation is an entity operation a delivery submits
+type Operation struct {
+	Type string                 `json:"type"` // entity_create, entity_update or entity_delete
+	Data map[string]interface{} `json:"data"`
+}
+
+// Message is a chat message a delivery posts
+type Message struct {
+	From string `json:"from"`
+	Text string `json:"text"`
+}
+
+// Plan is what a delivery changes, in rule order
+type Plan struct {
+	Webhook    string      `json:"webhook"`
+	World      string      `json:"world"`
+	Operations []Operation `json:"operations"`
+	Messages   []Message   `json:"messages"`
+	Skipped    []string    `json:"skipped,omitempty"` // Rules or items that changed nothing, and why
+
+	layout *layout // Alert places once applied
+}
+
+// Decode reads a delivery's body: JSON, or a form whose payload field is
+// JSON, as GitHub sends with the form content type
+func Decode(r *http.Request, body []byte) (*Delivery, error) {
+	delivery := &Delivery{Headers: r.Header, Query: r.URL.Query()}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		if form, err := url.ParseQuery(string(body)); err == nil && form.Has("payload") {
+			body = []byte(form.Get("payload"))
+		}
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return delivery, nil
+	}
+	if err := json.Unmarshal(body, &delivery.Payload); err != nil {
+		return nil, fmt.Errorf("invalid JSON payload: %v", err)
+	}
+	return delivery, nil
+}
+
+// Plan renders a delivery's rules, or lays out its alerts. Updates and deletes of entities that
+// will not exist, and creates of ones that will, are skipped; so are rules
+// whose templates fail on this payload.
+func (h *Webhook) Plan(delivery *Delivery) (*Plan, error) {
+	if h.Alertmanager != nil {
+		return h.Alertmanager.plan(h, delivery)
+	}
+	plan := &Plan{Webhook: h.Name, World: h.TargetWorld(), Operations: []Operation{}, Messages: []Message{}}
+	headers := map[string]string{}
+	for name := range delivery.Headers {
+		headers[name] = delivery.Headers.Get(name)
+	}
+	query := map[string]string{}
+	for name := range delivery.Query {
+		query[name] = delivery.Query.Get(name)
+	}
+	values := params.Values(plan.World)
+
+	// Entities created or deleted by earlier rules of the delivery
+	exists := map[string]bool{}
+	live := func(id string) bool {
+		if known, ok := exists[id]; ok {
+			return known
+		}
+		return entityid.Live(id)
+	}
+
+	for i := range h.Rules {
+		rule := &h.Rules[i]
+		name := fmt.Sprintf("rule %d", i+1)
+		items := []interface{}{nil}
+		if rule.Each != "" {
+			list, ok := lookup(delivery.Payload, rule.Each).([]interface{})
+			if !ok {
+				plan.Skipped = append(plan.Skipped, fmt.Sprintf("%s: each: %s is not a list", name, rule.Each))
+				continue
+			}
+			items = list
+		}
+		for index, item := range items {
+			data := map[string]interface{}{
+				"payload": delivery.Payload,
+				"headers": headers,
+				"query":   query,
+				"webhook": h.Name,
+				"params":  values,
+			}
+			at := name
+			if rule.Each != "" {
+				data["item"], data["index"] = item, index
+				at = fmt.Sprintf("%s item %d", name, index)
+			}
+			applies, err := render(rule.when, data)
+			if err != nil {
+				plan.Skipped = append(plan.Skipped, fmt.Sprintf("%s: when: %v", at, err))
+				continue
+			}
+			switch strings.ToLower(strings.TrimSpace(applies)) {
+			case "", "false", "0", "no":
+				if rule.When != "" {
+					plan.Skipped = append(plan.Skipped, at+": when is false")
+					continue
+				}
+			}
+
+			if rule.Chat != nil {
+				message, err := rule.Chat.render(h.Name, data)
+				if err != nil {
+					plan.Skipped = append(plan.Skipped, fmt.Sprintf("%s: %v", at, err))
+					continue
+				}
+				if len(plan.Messages) == MaxMessages {
+					return nil, fmt.Errorf("more than %d chat messages", MaxMessages)
+				}
+				plan.Messages = append(plan.Messages, *message)
+				continue
+			}
+
+			operation, err := rule.Entity.render(data, live)
+			if err != nil {
+				plan.Skipped = append(plan.Skipped, fmt.Sprintf("%s: %v", at, err))
+				continue
+			}
+			if max := config.GetSyncTransactionMaxOperations(); len(plan.Operations) == max {
+				return nil, fmt.Errorf("more than %d entity operations", max)
+			}
+			if id, _ := operation.Data["id"].(string); id != "" {
+				exists[id] = operation.Type != hd1sync.OpEntityDelete
+			}
+			plan.Operations = append(plan.Operations, *operation)
+		}
+	}
+	return plan, nil
+}
+
+// render fills an entity action's templates, resolving upserts against the
+// entities that will exist when it applies
+func (a *EntityAction) render(data map[string]interface{}, live func(string) bool) (*Operation, error) {
+	id, err := render(a.id, data)
+	if err != nil {
+		return nil, fmt.Errorf("id: %v", err)
+	}
+	id = strings.TrimSpace(id)
+	if id == "" && a.Op != OpCreate {
+		return nil, fmt.Errorf("id renders empty")
+	}
+
+	operation := &Operation{Data: map[string]interface{}{}}
+	switch a.Op {
+	case OpCreate:
+		if id != "" && live(id) {
+			return nil, fmt.Errorf("entity %s exists", id)
+		}
+		operation.Type = hd1sync.OpEntityCreate
+	case OpUpsert:
+		operation.Type = hd1sync.OpEntityCreate
+		if live(id) {
+			operation.Type = hd1sync.OpEntityUpdate
+		}
+	case OpUpdate, OpDelete:
+		if !live(id) {
+			return nil, fmt.Errorf("entity %s does not exist", id)
+		}
+		operation.Type = "entity_" + a.Op
+	}
+
+	if a.Op != OpDelete {
+		rendered, err := renderData(a.data, data)
+		if err != nil {
+			return nil, fmt.Errorf("data: %v", err)
+		}
+		if fields, ok := rendered.(map[string]interface{}); ok {
+			operation.Data = fields
+		}
+	}
+	if id != "" {
+		operation.Data["id"] = id
+	}
+	return operation, nil
+}
+
+// render fills a chat action's templates
+func (a *ChatAction) render(webhook string, data map[string]interface{}) (*Message, error) {
+	from, err := render(a.from, data)
+	if err != nil {
+		return nil, fmt.Errorf("from: %v", err)
+	}
+	text, err := render(a.text, data)
+	if err != nil {
+		return nil, fmt.Errorf("text: %v", err)
+	}
+	message := &Message{From: strings.TrimSpace(from), Text: strings.TrimSpace(text)}
+	if message.From == "" {
+		message.From = webhook
+	}
+	if message.Text == "" {
+		return nil, fmt.Errorf("text renders empty")
+	}
+	return message, nil
+}
+
+// parse parses a template string; an empty one renders empty
+func parse(name, text string) (*template.Template, error) {
+	parsed, err := template.New(name).Funcs(funcs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %v", name, err)
+	}
+	return parsed, nil
+}
+
+// parseData parses the template strings in entity data, leaving other
+// values as they are
+func parseData(name string, value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		parsed := make(map[string]interface{}, len(value))
+		for key, field := range value {
+			var err error
+			if parsed[key], err = parseData(name+"."+key, field); err != nil {
+				return nil, err
+			}
+		}
+		return parsed, nil
+	case []interface{}:
+		parsed := make([]interface{}, len(value))
+		for i, element := range value {
+			var err error
+			if parsed[i], err = parseData(name+"."+strconv.Itoa(i), element); err != nil {
+				return nil, err
+			}
+		}
+		return parsed, nil
+	case string:
+		if strings.Contains(value, "{{") {
+			return parse(name, value)
+		}
+	}
+	return value, nil
+}
+
+// renderData fills parsed entity data. A filled template that is JSON
+// becomes the value it encodes; any other is text.
+func renderData(value interface{}, data map[string]interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		rendered := make(map[string]interface{}, len(value))
+		for key, field := range value {
+			var err error
+			if rendered[key], err = renderData(field, data); err != nil {
+				return nil, err
+			}
+		}
+		return rendered, nil
+	case []interface{}:
+		rendered := make([]interface{}, len(value))
+		for i, element := range value {
+			var err error
+			if rendered[i], err = renderData(element, data); err != nil {
+				return nil, err
+			}
+		}
+		return rendered, nil
+	case *template.Template:
+		text, err := render(value, data)
+		if err != nil {
+			return nil, err
+		}
+		var decoded interface{}
+		if json.Unmarshal([]byte(text), &decoded) == nil {
+			return decoded, nil
+		}
+		return text, nil
+	}
+	return value, nil
+}
+
+// render executes a template. Keys missing from the payload render empty
+// rather than as "<no value>".
+func render(tmpl *template.Template, data map[string]interface{}) (string, error) {
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(out.String(), "<no value>", ""), nil
+}
+
+// lookup follows a dotted path through a payload's objects and lists
+func lookup(value interface{}, path string) interface{} {
+	for _, key := range strings.Split(path, ".") {
+		switch current := value.(type) {
+		case map[string]interface{}:
+			value = current[key]
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(current) {
+				return nil
+			}
+			value = current[index]
+		default:
+			return nil
+		}
+	}
+	return value
+}
@@ -0,0 +1,337 @@
+// Package webhooks turns inbound webhook deliveries, such as GitHub events
+// or Grafana alerts, into changes to a world: entity mutations and chat
+// messages. Each webhook is a named mapping in the webhooks file (YAML):
+//
+//	webhooks:
+//	  grafana:
+//	    secret: s3cret
+//	    rules:
+//	      - each: alerts
+//	        entity:
+//	          op: upsert
+//	          id: 'alert-{{ .item.fingerprint }}'
+//	          data:
+//	            geometry: {type: box}
+//	            material:
+//	              color: '{{ if eq .item.status "firing" }}#ff3030{{ else }}#30c030{{ end }}'
+//	      - when: '{{ eq .payload.status "firing" }}'
+//	        chat:
+//	          text: '{{ .payload.title }}'
+//
+// Rules apply in order; a rule's when, each and actions are described with
+// Rule. Instead of rules, a webhook may use a built-in mapping: alertmanager
+// lays out Prometheus alerts. Senders prove they know the secret with a GitHub-style
+// X-Hub-Signature-256, a bearer token or a token query parameter; webhooks
+// without one take deliveries from operators only. A missing file leaves
+// no webhooks.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+
+	"holodeck1/config"
+	"holodeck1/logging"
+)
+
+// Entity operations a rule may perform
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpUpsert = "upsert" // Update when the entity exists, create it otherwise
+	OpDelete = "delete"
+)
+
+// MaxRules bounds a webhook's rules
+const MaxRules = 50
+
+// MaxPayload bounds a delivery's body
+const MaxPayload = 1 << 20
+
+var webhookName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ErrNotFound is returned for unknown webhooks
+var ErrNotFound = errors.New("webhook not found")
+
+// Webhook maps one sender's deliveries to changes to a world
+type Webhook struct {
+	Name         string        `yaml:"-"`
+	World        string        `yaml:"world"`  // World changed; the served one, or monitoring for alertmanager, when empty
+	Secret       string        `yaml:"secret"` // Shared with the sender; operators only when empty
+	Rules        []Rule        `yaml:"rules"`
+	Alertmanager *Alertmanager `yaml:"alertmanager"`
+
+	deliveries sync.Mutex
+	layout     atomic.Pointer[layout] // Where the alertmanager mapping placed alerts
+}
+
+// Rule is one change a delivery may make. Its template strings are Go
+// text/template strings filled with the delivery: .payload, .headers (by
+// canonical name), .query and .webhook, plus .item and .index under each,
+// and the target world's parameters that are not secret as .params.
+type Rule struct {
+	When   string        `yaml:"when"` // Skipped when it renders empty, false, 0 or no
+	Each   string        `yaml:"each"` // Dotted path to a list in the payload; applied once per item
+	Entity *EntityAction `yaml:"entity"`
+	Chat   *ChatAction   `yaml:"chat"`
+
+	when *template.Template
+}
+
+// EntityAction creates, updates or deletes an entity. Template leaves of
+// its data are read as JSON when they render to JSON, so a position can be
+// a number; text otherwise.
+type EntityAction struct {
+	Op   string                 `yaml:"op"`
+	ID   string                 `yaml:"id"` // Template; issued by the server for creates without one
+	Data map[string]interface{} `yaml:"data"`
+
+	id   *template.Template
+	data interface{} // Data with its template strings parsed
+}
+
+// ChatAction posts a message to the world's chat
+type ChatAction struct {
+	From string `yaml:"from"` // Template; the webhook's name when empty
+	Text string `yaml:"text"` // Template
+
+	from *template.Template
+	text *template.Template
+}
+
+// Document is the format of the webhooks file
+type Document struct {
+	Webhooks map[string]*Webhook `yaml:"webhooks"`
+}
+
+// Summary describes a webhook without its secret
+type Summary struct {
+	Name   string `json:"name"`
+	Kind   string `json:"kind"` // rules or alertmanager
+	World  string `json:"world"`
+	Rules  int    `json:"rules"`
+	Signed bool   `json:"signed"` // Whether senders prove a secret; operators only otherwise
+}
+
+var (
+	webhooks = map[string]*Webhook{}
+	mutex    sync.RWMutex
+)
+
+// Load reads the webhooks file; a missing file leaves no webhooks
+func Load() error {
+	file := config.GetWebhooksFile()
+	loaded := map[string]*Webhook{}
+	raw, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		var document Document
+		if err := yaml.Unmarshal(raw, &document); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		for name, webhook := range document.Webhooks {
+			if webhook == nil {
+				webhook = &Webhook{}
+			}
+			webhook.Name = name
+			if err := webhook.validate(); err != nil {
+				return fmt.Errorf("%s: webhook %q: %v", file, name, err)
+			}
+			loaded[name] = webhook
+		}
+	}
+
+	mutex.Lock()
+	webhooks = loaded
+	mutex.Unlock()
+
+	logging.Info("webhooks loaded", map[string]interface{}{
+		"file":     file,
+		"webhooks": len(loaded),
+	})
+	return nil
+}
+
+func (h *Webhook) validate() error {
+	if !webhookName.MatchString(h.Name) {
+		return fmt.Errorf("name must match %s", webhookName)
+	}
+	if h.Alertmanager != nil {
+		if len(h.Rules) > 0 {
+			return fmt.Errorf("rules and alertmanager exclude each other")
+		}
+		return h.Alertmanager.validate()
+	}
+	if len(h.Rules) == 0 {
+		return fmt.Errorf("no rules")
+	}
+	if len(h.Rules) > MaxRules {
+		return fmt.Errorf("at most %d rules", MaxRules)
+	}
+	for i := range h.Rules {
+		if err := h.Rules[i].validate(); err != nil {
+			return fmt.Errorf("rule %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (r *Rule) validate() error {
+	if (r.Entity == nil) == (r.Chat == nil) {
+		return fmt.Errorf("needs one of entity or chat")
+	}
+	var err error
+	if r.when, err = parse("when", r.When); err != nil {
+		return err
+	}
+	if r.Entity != nil {
+		return r.Entity.validate()
+	}
+	return r.Chat.validate()
+}
+
+func (a *EntityAction) validate() error {
+	switch a.Op {
+	case OpCreate:
+	case OpUpdate, OpUpsert, OpDelete:
+		if a.ID == "" {
+			return fmt.Errorf("entity %s needs an id", a.Op)
+		}
+	default:
+		return fmt.Errorf("entity op must be %s, %s, %s or %s", OpCreate, OpUpdate, OpUpsert, OpDelete)
+	}
+	if _, ok := a.Data["id"]; ok {
+		return fmt.Errorf("entity id goes in id, not data")
+	}
+	var err error
+	if a.id, err = parse("id", a.ID); err != nil {
+		return err
+	}
+	a.data, err = parseData("data", map[string]interface{}(a.Data))
+	return err
+}
+
+func (a *ChatAction) validate() error {
+	if a.Text == "" {
+		return fmt.Errorf("chat needs text")
+	}
+	var err error
+	if a.from, err = parse("from", a.From); err != nil {
+		return err
+	}
+	a.text, err = parse("text", a.Text)
+	return err
+}
+
+// Get returns a webhook by name
+func Get(name string) (*Webhook, error) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if webhook, ok := webhooks[name]; ok {
+		return webhook, nil
+	}
+	return nil, ErrNotFound
+}
+
+// IsSecret reports whether a value is the secret of a webhook
+func IsSecret(value string) bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	for _, webhook := range webhooks {
+		if webhook.Secret != "" && subtle.ConstantTimeCompare([]byte(value), []byte(webhook.Secret)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// List describes the webhooks
+func List() []Summary {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	result := []Summary{}
+	for _, webhook := range webhooks {
+		kind := "rules"
+		if webhook.Alertmanager != nil {
+			kind = "alertmanager"
+		}
+		result = append(result, Summary{
+			Name:   webhook.Name,
+			Kind:   kind,
+			World:  webhook.TargetWorld(),
+			Rules:  len(webhook.Rules),
+			Signed: webhook.Secret != "",
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// TargetWorld returns the world the webhook changes
+func (h *Webhook) TargetWorld() string {
+	if h.World != "" {
+		return h.World
+	}
+	if h.Alertmanager != nil {
+		return MonitoringWorld
+	}
+	return config.GetWorldsDefaultWorld()
+}
+
+// Lock holds off the webhook's other deliveries, from planning one until
+// it is committed or abandoned
+func (h *Webhook) Lock() {
+	h.deliveries.Lock()
+}
+
+// Unlock lets the webhook's next delivery through
+func (h *Webhook) Unlock() {
+	h.deliveries.Unlock()
+}
+
+// Commit records that a delivery's plan was applied, keeping where it
+// placed alerts for the next one
+func (h *Webhook) Commit(plan *Plan) {
+	if plan.layout != nil {
+		h.layout.Store(plan.layout)
+	}
+}
+
+// Verify reports whether a delivery proves the webhook's secret: by an
+// X-Hub-Signature-256 HMAC of its body, an Authorization bearer token, or a
+// token query parameter. Webhooks without a secret verify nothing.
+func (h *Webhook) Verify(r *http.Request, body []byte) bool {
+	if h.Secret == "" {
+		return false
+	}
+	if signature := r.Header.Get("X-Hub-Signature-256"); signature != "" {
+		sent, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha256.New, []byte(h.Secret))
+		mac.Write(body)
+		return hmac.Equal(sent, mac.Sum(nil))
+	}
+	token := r.URL.Query().Get("token")
+	if bearer, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		token = bearer
+	}
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.Secret)) == 1
+}
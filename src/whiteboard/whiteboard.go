@@ -0,0 +1,259 @@
+// Package whiteboard defines whiteboard entities: shared 2D drawing
+// surfaces in a world.
+//
+// A board's strokes change through whiteboard_delta operations that add
+// strokes, remove them by ID or clear the board. Deltas merge as a CRDT
+// ordered by the operation log: each takes its clock from its sequence
+// number, a clear removes only the strokes that came before it, and a
+// removed stroke ID stays removed even if its stroke arrives later. Every
+// replica applying the same operations holds the same board, whichever
+// client drew what concurrently. The merged board lives in the entity's
+// data, so it is checkpointed and exported with the world.
+package whiteboard
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"holodeck1/numbers"
+	"holodeck1/sync"
+)
+
+// OperationType is the operation carrying a delta
+const OperationType = sync.OpWhiteboardDelta
+
+func init() {
+	// Deltas are checked as submitted; boards merge them as they replay
+	sync.RegisterOperation(OperationType, func(data map[string]interface{}) error {
+		if _, err := DecodeDelta(data); err != nil {
+			return fmt.Errorf("invalid whiteboard delta: %v", err)
+		}
+		return nil
+	})
+}
+
+// Limits of a valid board
+const (
+	MaxStrokes    = 2000 // Strokes on a board; adds beyond are dropped
+	maxPoints     = 1000 // Points per stroke
+	maxStrokeSize = 0.1  // Line width, as a share of the board width
+	maxRemoved    = 2000 // Tombstones kept until the next clear
+	maxDimension  = 50   // Metres
+	defaultWidth  = 2
+	defaultHeight = 1.2
+)
+
+var (
+	idPattern    = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+	colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+// Stroke is a polyline drawn on a board
+type Stroke struct {
+	ID     string    `json:"id"`     // Chosen by the drawing client, unique per board
+	Color  string    `json:"color"`  // #rrggbb
+	Size   float64   `json:"size"`   // Line width, as a share of the board width
+	Points []float64 `json:"points"` // x0, y0, x1, y1, ... within 0-1, origin top left
+	Clock  uint64    `json:"clock"`  // Sequence number of the delta that added it, set on merge
+}
+
+// Validate checks a stroke as submitted
+func (s *Stroke) Validate() error {
+	if !idPattern.MatchString(s.ID) {
+		return fmt.Errorf("stroke id must match %s", idPattern)
+	}
+	if !colorPattern.MatchString(s.Color) {
+		return fmt.Errorf("stroke color must be #rrggbb, got %q", s.Color)
+	}
+	if !numbers.Within(s.Size, 0, maxStrokeSize) || s.Size == 0 {
+		return fmt.Errorf("stroke size must be within 0-%g of the board width", maxStrokeSize)
+	}
+	if len(s.Points) < 2 || len(s.Points)%2 != 0 || len(s.Points) > 2*maxPoints {
+		return fmt.Errorf("stroke points must be 1-%d x, y pairs", maxPoints)
+	}
+	for _, coordinate := range s.Points {
+		if !numbers.Within(coordinate, 0, 1) {
+			return errors.New("stroke points must be within 0-1")
+		}
+	}
+	return nil
+}
+
+// Board is the whiteboard component of an entity
+type Board struct {
+	Width      float64  `json:"width,omitempty"`      // Metres, 2 when unset
+	Height     float64  `json:"height,omitempty"`     // Metres, 1.2 when unset
+	Background string   `json:"background,omitempty"` // #rrggbb, white when unset
+	Strokes    []Stroke `json:"strokes"`              // In clock order, drawn first to last
+	Removed    []string `json:"removed"`              // Tombstones of removed strokes
+	Cleared    uint64   `json:"cleared"`              // Clock of the last clear
+}
+
+// Validate checks a board, filling in defaults
+func (b *Board) Validate() error {
+	if b.Width == 0 {
+		b.Width = defaultWidth
+	}
+	if b.Height == 0 {
+		b.Height = defaultHeight
+	}
+	if b.Background == "" {
+		b.Background = "#ffffff"
+	}
+	for _, dimension := range []float64{b.Width, b.Height} {
+		if !numbers.Within(dimension, 0, maxDimension) {
+			return fmt.Errorf("width and height must be within 0-%dm", maxDimension)
+		}
+	}
+	if !colorPattern.MatchString(b.Background) {
+		return fmt.Errorf("background must be #rrggbb, got %q", b.Background)
+	}
+	if len(b.Strokes) > MaxStrokes {
+		return fmt.Errorf("boards hold at most %d strokes", MaxStrokes)
+	}
+	for i := range b.Strokes {
+		if err := b.Strokes[i].Validate(); err != nil {
+			return err
+		}
+	}
+	if len(b.Removed) > maxRemoved {
+		return fmt.Errorf("boards keep at most %d removed strokes", maxRemoved)
+	}
+	if b.Strokes == nil {
+		b.Strokes = []Stroke{}
+	}
+	if b.Removed == nil {
+		b.Removed = []string{}
+	}
+	return nil
+}
+
+// Delta changes a board's strokes
+type Delta struct {
+	Clear  bool     `json:"clear,omitempty"`  // Removes every earlier stroke
+	Remove []string `json:"remove,omitempty"` // Stroke IDs
+	Add    []Stroke `json:"add,omitempty"`
+}
+
+// Validate checks a delta as submitted
+func (d *Delta) Validate() error {
+	if !d.Clear && len(d.Remove) == 0 && len(d.Add) == 0 {
+		return errors.New("a delta must clear, remove or add strokes")
+	}
+	if len(d.Add) > MaxStrokes || len(d.Remove) > maxRemoved {
+		return errors.New("delta too large")
+	}
+	for _, id := range d.Remove {
+		if !idPattern.MatchString(id) {
+			return fmt.Errorf("stroke id must match %s", idPattern)
+		}
+	}
+	for i := range d.Add {
+		if err := d.Add[i].Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Merge applies a delta to a board at a clock, the delta's sequence
+// number: clear first, then removals, then additions. Adding a stroke
+// that is present or was removed changes nothing, so replaying a delta
+// twice is harmless.
+func (b *Board) Merge(delta *Delta, clock uint64) {
+	if delta.Clear && clock > b.Cleared {
+		b.Cleared = clock
+		kept := b.Strokes[:0]
+		for _, stroke := range b.Strokes {
+			if stroke.Clock > clock {
+				kept = append(kept, stroke)
+			}
+		}
+		b.Strokes = kept
+		// IDs are unique, so tombstones only matter for strokes in flight
+		b.Removed = []string{}
+	}
+
+	for _, id := range delta.Remove {
+		if contains(b.Removed, id) {
+			continue
+		}
+		if len(b.Removed) < maxRemoved {
+			b.Removed = append(b.Removed, id)
+		}
+		for i, stroke := range b.Strokes {
+			if stroke.ID == id {
+				b.Strokes = append(b.Strokes[:i], b.Strokes[i+1:]...)
+				break
+			}
+		}
+	}
+
+	for _, stroke := range delta.Add {
+		if len(b.Strokes) >= MaxStrokes || contains(b.Removed, stroke.ID) || b.has(stroke.ID) {
+			continue
+		}
+		stroke.Clock = clock
+		b.Strokes = append(b.Strokes, stroke)
+	}
+}
+
+func (b *Board) has(id string) bool {
+	for _, stroke := range b.Strokes {
+		if stroke.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Data returns the board as entity data
+func (b *Board) Data() map[string]interface{} {
+	var data map[string]interface{}
+	encoded, _ := json.Marshal(b)
+	json.Unmarshal(encoded, &data)
+	return data
+}
+
+// Decode reads and validates a board from entity data
+func Decode(value interface{}) (*Board, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var board Board
+	if err := json.Unmarshal(encoded, &board); err != nil {
+		return nil, fmt.Errorf("invalid whiteboard: %v", err)
+	}
+	if err := board.Validate(); err != nil {
+		return nil, err
+	}
+	return &board, nil
+}
+
+// DecodeDelta reads and validates a delta from operation data
+func DecodeDelta(data map[string]interface{}) (*Delta, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var delta Delta
+	if err := json.Unmarshal(encoded, &delta); err != nil {
+		return nil, fmt.Errorf("invalid delta: %v", err)
+	}
+	if err := delta.Validate(); err != nil {
+		return nil, err
+	}
+	return &delta, nil
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package worlds
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"holodeck1/storage"
+)
+
+// Checkpoints are named snapshots of a world's state kept in the storage
+// backend under worlds/<world>/checkpoints/<id>.json. Rolling back submits
+// the operations that turn the live world into the snapshot, so connected
+// clients follow along like any other change.
+
+// ErrCheckpointNotFound is returned for unknown checkpoint IDs
+var ErrCheckpointNotFound = errors.New("checkpoint not found")
+
+var checkpointIDPattern = regexp.MustCompile(`^cp-[0-9a-f-]{36}$`)
+
+// MaxLabelLength bounds checkpoint labels, in characters
+const MaxLabelLength = 128
+
+// Checkpoint is a labelled world snapshot
+type Checkpoint struct {
+	ID        string    `json:"id"`
+	World     string    `json:"world"`
+	Label     string    `json:"label"`
+	SeqNum    uint64    `json:"seq_num"` // Last operation included
+	Entities  int       `json:"entities"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	State     *State    `json:"state,omitempty"`
+}
+
+// NewCheckpoint labels a state. IDs are time-ordered, so they sort by
+// creation.
+func NewCheckpoint(world, label, createdBy string, state *State) (*Checkpoint, error) {
+	label = strings.TrimSpace(label)
+	if label == "" || !utf8.ValidString(label) || utf8.RuneCountInString(label) > MaxLabelLength {
+		return nil, fmt.Errorf("label must be 1-%d characters", MaxLabelLength)
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+	return &Checkpoint{
+		ID:        "cp-" + id.String(),
+		World:     world,
+		Label:     label,
+		SeqNum:    state.SeqNum,
+		Entities:  len(state.Entities),
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+		State:     state,
+	}, nil
+}
+
+// Summary returns the checkpoint without its state
+func (c *Checkpoint) Summary() *Checkpoint {
+	summary := *c
+	summary.State = nil
+	return &summary
+}
+
+func checkpointKey(world, id string) (string, error) {
+	if !worldIDPattern.MatchString(world) {
+		return "", fmt.Errorf("invalid world id: %q", world)
+	}
+	return storage.Key(storage.NamespaceWorlds, world+"/checkpoints/"+id+".json")
+}
+
+// SaveCheckpoint writes a checkpoint to the storage backend
+func SaveCheckpoint(ctx context.Context, checkpoint *Checkpoint) error {
+	backend := storage.Default()
+	if backend == nil {
+		return fmt.Errorf("storage backend unavailable")
+	}
+	key, err := checkpointKey(checkpoint.World, checkpoint.ID)
+	if err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	return backend.Put(ctx, key, bytes.NewReader(encoded), int64(len(encoded)), "application/json")
+}
+
+// LoadCheckpoint reads a checkpoint with its state
+func LoadCheckpoint(ctx context.Context, world, id string) (*Checkpoint, error) {
+	if !checkpointIDPattern.MatchString(id) {
+		return nil, ErrCheckpointNotFound
+	}
+	backend := storage.Default()
+	if backend == nil {
+		return nil, fmt.Errorf("storage backend unavailable")
+	}
+	key, err := checkpointKey(world, id)
+	if err != nil {
+		return nil, err
+	}
+	body, _, err := backend.Get(ctx, key)
+	if err == storage.ErrNotFound {
+		return nil, ErrCheckpointNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var checkpoint Checkpoint
+	if err := json.NewDecoder(body).Decode(&checkpoint); err != nil {
+		return nil, fmt.Errorf("checkpoint %s: %w", id, err)
+	}
+	if checkpoint.State == nil {
+		checkpoint.State = NewState()
+	}
+	return &checkpoint, nil
+}
+
+// ListCheckpoints returns a world's checkpoint summaries, oldest first
+func ListCheckpoints(ctx context.Context, world string) ([]*Checkpoint, error) {
+	backend := storage.Default()
+	if backend == nil {
+		return nil, fmt.Errorf("storage backend unavailable")
+	}
+	if !worldIDPattern.MatchString(world) {
+		return nil, fmt.Errorf("invalid world id: %q", world)
+	}
+	objects, err := backend.List(ctx, storage.NamespaceWorlds+"/"+world+"/checkpoints/")
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoints := []*Checkpoint{}
+	for _, object := range objects {
+		id := strings.TrimSuffix(object.Key[strings.LastIndex(object.Key, "/")+1:], ".json")
+		checkpoint, err := LoadCheckpoint(ctx, world, id)
+		if err != nil {
+			continue
+		}
+		checkpoints = append(checkpoints, checkpoint.Summary())
+	}
+	sort.Slice(checkpoints, func(i, j int) bool { return checkpoints[i].ID < checkpoints[j].ID })
+	return checkpoints, nil
+}
@@ -0,0 +1,110 @@
+package worlds
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"holodeck1/sync"
+)
+
+// Checksum algorithms clients can reproduce: fnv1a works everywhere,
+// sha256 needs WebCrypto, which browsers only offer in secure contexts
+const (
+	ChecksumSHA256 = "sha256"
+	ChecksumFNV1a  = "fnv1a"
+)
+
+// NewChecksumHash returns the hash for a checksum algorithm
+func NewChecksumHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case ChecksumSHA256:
+		return sha256.New(), nil
+	case ChecksumFNV1a:
+		return fnv.New32a(), nil
+	}
+	return nil, fmt.Errorf("unknown checksum algorithm: %q", algorithm)
+}
+
+// Checksum hashes what clients render of every entity: its transform and
+// visibility. Each entity is one line, sorted by ID,
+//
+//	id|px,py,pz|rx,ry,rz|sx,sy,sz|visible
+//
+// with coordinates in thousandths rounded by floor(v*1000+0.5), missing
+// position and rotation as 0, missing scale as 1, and visible as 1 or 0.
+// The console computes the same lines from its meshes.
+func (s *State) Checksum(algorithm string) (string, error) {
+	h, err := NewChecksumHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	ids := make([]string, 0, len(s.Entities))
+	for id := range s.Entities {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		h.Write([]byte(canonicalLine(id, s.Entities[id])))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// EntityHashes returns the fnv1a hash of each entity's checksum line, so a
+// client whose checksum differs can find the entities that diverged; eight
+// hex digits per entity keep the map small whatever the world checksum
+// algorithm
+func (s *State) EntityHashes() map[string]string {
+	hashes := make(map[string]string, len(s.Entities))
+	for id, entity := range s.Entities {
+		h := fnv.New32a()
+		h.Write([]byte(canonicalLine(id, entity)))
+		hashes[id] = hex.EncodeToString(h.Sum(nil))
+	}
+	return hashes
+}
+
+// canonicalLine is an entity's line in the world checksum
+func canonicalLine(id string, entity map[string]interface{}) string {
+	visible := "1"
+	if shown, ok := entity["visible"].(bool); ok && !shown {
+		visible = "0"
+	}
+	return id +
+		"|" + canonicalVector(entity["position"], 0) +
+		"|" + canonicalVector(entity["rotation"], 0) +
+		"|" + canonicalVector(entity["scale"], 1) +
+		"|" + visible + "\n"
+}
+
+// canonicalVector formats a {x, y, z} value in thousandths
+func canonicalVector(value interface{}, missing float64) string {
+	vector, _ := value.(map[string]interface{})
+	parts := make([]string, 3)
+	for i, axis := range []string{"x", "y", "z"} {
+		component, ok := vector[axis].(float64)
+		if !ok {
+			component = missing
+		}
+		parts[i] = strconv.FormatInt(int64(math.Floor(component*1000+0.5)), 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+// ChecksumOperations rebuilds a world from its log and returns its
+// checksum and entity hashes
+func ChecksumOperations(operations []*sync.Operation, algorithm string) (string, map[string]string, error) {
+	state, err := Replay(operations)
+	if err != nil {
+		return "", nil, err
+	}
+	checksum, err := state.Checksum(algorithm)
+	return checksum, state.EntityHashes(), err
+}
@@ -0,0 +1,164 @@
+// Package worlds defines the on-disk world format and its validation.
+//
+// A world is a directory holding a config.yaml (name configurable through
+// HD1_WORLDS_CONFIG_FILE) plus the assets it references:
+//
+//	world:
+//	  id: world_one
+//	  name: World One
+//	scene:
+//	  background: "#87CEEB"
+//	  fog: {color: "#cccccc", near: 10, far: 100}
+//	  physics: {profile: moon}
+//	  space: {units: feet, up_axis: z}
+//	  geo: {latitude: 51.5072, longitude: -0.1276, altitude: 11}
+//	assets:
+//	  - models/tree.glb
+//	entities:
+//	  - id: ground
+//	    geometry: {type: plane, width: 50, height: 50}
+//	    material: {type: phong, color: "#777777"}
+//	    position: {x: 0, y: 0, z: 0}
+//	  - id: tree
+//	    model: models/tree.glb
+//	  - id: campfire
+//	    particles: {shape: disc, radius: 0.3, rate: 40, lifetime: {min: 1, max: 2},
+//	                velocity: {min: {x: -0.2, y: 1, z: -0.2}, max: {x: 0.2, y: 2, z: 0.2}},
+//	                texture: textures/flame.png}
+//	  - id: welcome
+//	    panel: {kind: billboard, format: markdown, content: "# Welcome"}
+//	    position: {x: 0, y: 2, z: -4}
+//	  - id: screen
+//	    media: {kind: hls, source: "https://example.com/live/stream.m3u8", playing: true}
+//	    position: {x: 4, y: 2, z: -4}
+//	  - id: sketches
+//	    whiteboard: {width: 3, height: 2}
+//	    position: {x: -4, y: 1.5, z: -4}
+//	  - id: sign-in
+//	    form:
+//	      title: Sign in
+//	      schema:
+//	        type: object
+//	        properties:
+//	          name: {type: string, title: Name}
+//	          email: {type: string, format: email}
+//	        required: [name]
+//	    position: {x: 4, y: 1.5, z: 0}
+//	  - id: gate
+//	    geometry: {type: plane, width: 2, height: 2.5}
+//	    material: {type: standard, color: "#44aaff"}
+//	    portal: {world: world_two, view: lobby, size: {x: 2, y: 2.5, z: 0.5}}
+//	    position: {x: 0, y: 1.25, z: -10}
+//
+// Entity geometry and material documents use the same schema as the
+// /entities API so worlds and API clients accept identical payloads.
+package worlds
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"holodeck1/api/entities"
+	"holodeck1/api/shared"
+	"holodeck1/forms"
+	"holodeck1/geo"
+	"holodeck1/media"
+	"holodeck1/panels"
+	"holodeck1/particles"
+	"holodeck1/physics"
+	"holodeck1/portals"
+	"holodeck1/units"
+	"holodeck1/whiteboard"
+)
+
+// Definition is a parsed world config.yaml
+type Definition struct {
+	World    WorldInfo          `json:"world"`
+	Scene    SceneDefinition    `json:"scene"`
+	Assets   []string           `json:"assets,omitempty"`
+	Entities []EntityDefinition `json:"entities,omitempty"`
+}
+
+// WorldInfo identifies a world
+type WorldInfo struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// SceneDefinition holds scene-wide rendering settings
+type SceneDefinition struct {
+	Background string             `json:"background,omitempty"`
+	Fog        *FogDefinition     `json:"fog,omitempty"`
+	Camera     *shared.Vector3    `json:"camera,omitempty"`
+	Physics    *physics.Selection `json:"physics,omitempty"` // Built-in profile name or custom profile
+	Space      *units.Space       `json:"space,omitempty"`   // Units and axes the world is exchanged in
+	Geo        *geo.Reference     `json:"geo,omitempty"`     // WGS84 position of the origin
+}
+
+// FogDefinition configures linear scene fog
+type FogDefinition struct {
+	Color string  `json:"color"`
+	Near  float64 `json:"near"`
+	Far   float64 `json:"far"`
+}
+
+// EntityDefinition is an entity document placed in the world at load time.
+// Either Geometry and Material or Model must be set.
+type EntityDefinition struct {
+	ID         string             `json:"id"`
+	Geometry   *entities.Geometry `json:"geometry,omitempty"`
+	Material   *entities.Material `json:"material,omitempty"`
+	Model      string             `json:"model,omitempty"`
+	Particles  *particles.Emitter `json:"particles,omitempty"` // Texture is a path in the world directory
+	Panel      *panels.Panel      `json:"panel,omitempty"`
+	Media      *media.Media       `json:"media,omitempty"`
+	Whiteboard *whiteboard.Board  `json:"whiteboard,omitempty"`
+	Form       *forms.Form        `json:"form,omitempty"`
+	Portal     *portals.Portal    `json:"portal,omitempty"`
+	Position   *shared.Vector3    `json:"position,omitempty"`
+	Rotation   *shared.Vector3    `json:"rotation,omitempty"`
+	Scale      *shared.Vector3    `json:"scale,omitempty"`
+	Visible    *bool              `json:"visible,omitempty"`
+}
+
+// LoadDefinition reads a world config file. YAML is normalised through JSON
+// so the json tags shared with the API types are authoritative. Unknown
+// fields do not fail loading; they are returned as lint notes instead.
+func LoadDefinition(path string) (*Definition, []string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var doc interface{}
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, nil, fmt.Errorf("invalid YAML: %v", err)
+	}
+	if doc == nil {
+		return nil, nil, fmt.Errorf("empty world definition")
+	}
+
+	normalised, err := json.Marshal(doc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unsupported YAML content: %v", err)
+	}
+
+	var def Definition
+	if err := json.Unmarshal(normalised, &def); err != nil {
+		return nil, nil, fmt.Errorf("invalid world definition: %v", err)
+	}
+
+	// Strict pass only to surface typos such as "postion"
+	var lint []string
+	strict := json.NewDecoder(bytes.NewReader(normalised))
+	strict.DisallowUnknownFields()
+	if err := strict.Decode(&Definition{}); err != nil {
+		lint = append(lint, strings.TrimPrefix(err.Error(), "json: "))
+	}
+	return &def, lint, nil
+}
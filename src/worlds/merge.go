@@ -0,0 +1,266 @@
+package worlds
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"time"
+
+	"holodeck1/units"
+)
+
+// ExportFormat identifies world export documents
+const ExportFormat = "hd1-world/1"
+
+// Export is a world state as written to a file: the live world from
+// GET /worlds/{worldId}/export, or the result of a merge. Entities are in
+// the declared space; documents without one are in metres with y up.
+type Export struct {
+	Format     string       `json:"format"`
+	World      string       `json:"world,omitempty"`
+	ExportedAt time.Time    `json:"exported_at"`
+	Space      *units.Space `json:"space,omitempty"`
+	*State
+}
+
+// NewExport wraps a state for writing, converting its entities into space
+// unless that is nil
+func NewExport(world string, state *State, space *units.Space) *Export {
+	export := &Export{Format: ExportFormat, World: world, ExportedAt: time.Now(), State: state}
+	if space != nil && !space.IsDefault() {
+		converted := *state
+		converted.Entities = make(map[string]map[string]interface{}, len(state.Entities))
+		for id, entity := range state.Entities {
+			converted.Entities[id] = space.Export(entity)
+		}
+		export.State, export.Space = &converted, space
+	}
+	return export
+}
+
+// Internal returns the exported state in HD1's space, normalized
+func (e *Export) Internal() (*State, error) {
+	state := e.State
+	if state == nil {
+		state = NewState()
+	}
+	if err := state.Normalize(); err != nil {
+		return nil, err
+	}
+	if e.Space == nil {
+		return state, nil
+	}
+	if err := e.Space.Validate(); err != nil {
+		return nil, fmt.Errorf("space: %v", err)
+	}
+	converted := *state
+	converted.Entities = make(map[string]map[string]interface{}, len(state.Entities))
+	for id, entity := range state.Entities {
+		converted.Entities[id] = e.Space.Import(entity)
+	}
+	return &converted, nil
+}
+
+// ReadExport loads a state from an export document or a checkpoint, as
+// returned by GET /worlds/{worldId}/checkpoints/{checkpointId}, in HD1's
+// space
+func ReadExport(r io.Reader) (*State, error) {
+	var document struct {
+		Format     string      `json:"format"`
+		Checkpoint *Checkpoint `json:"checkpoint"`
+		State      *State      `json:"state"`
+	}
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &document); err != nil {
+		return nil, err
+	}
+
+	var state *State
+	switch {
+	case document.Checkpoint != nil && document.Checkpoint.State != nil:
+		state = document.Checkpoint.State
+	case document.State != nil:
+		state = document.State // bare checkpoint
+	case document.Format == ExportFormat:
+		export := &Export{State: NewState()}
+		if err := json.Unmarshal(raw, export); err != nil {
+			return nil, err
+		}
+		return export.Internal()
+	default:
+		return nil, fmt.Errorf("not a world export or checkpoint (format %q)", document.Format)
+	}
+
+	if err := state.Normalize(); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Conflict kinds
+const (
+	ConflictModify = "modify/modify" // both sides changed a value differently
+	ConflictDelete = "delete/modify" // one side removed what the other changed
+	ConflictAdd    = "add/add"       // both sides added different values
+)
+
+// Conflict is a value both sides of a merge changed incompatibly. Entity is
+// empty for scene settings; Path is empty when the whole entity conflicts.
+type Conflict struct {
+	Entity string      `json:"entity,omitempty"`
+	Path   string      `json:"path,omitempty"`
+	Kind   string      `json:"kind"`
+	Base   interface{} `json:"base,omitempty"`
+	Ours   interface{} `json:"ours,omitempty"`
+	Theirs interface{} `json:"theirs,omitempty"`
+}
+
+// String describes a conflict on one line
+func (c Conflict) String() string {
+	target := "scene"
+	if c.Entity != "" {
+		target = "entity " + c.Entity
+	}
+	if c.Path != "" {
+		target += " " + c.Path
+	}
+	return fmt.Sprintf("conflict (%s): %s", c.Kind, target)
+}
+
+// Preferences for resolving conflicts
+const (
+	PreferOurs   = "ours"
+	PreferTheirs = "theirs"
+)
+
+// value is a possibly absent JSON value
+type value struct {
+	v       interface{}
+	present bool
+}
+
+func (a value) equal(b value) bool {
+	return a.present == b.present && (!a.present || reflect.DeepEqual(a.v, b.v))
+}
+
+type merger struct {
+	prefer    string
+	entity    string
+	conflicts []Conflict
+}
+
+// merge3 merges one value. Changes on a single side win; changes on both
+// sides recurse into objects, so edits to different fields combine.
+func (m *merger) merge3(path string, base, ours, theirs value) value {
+	switch {
+	case ours.equal(theirs):
+		return ours
+	case base.equal(ours):
+		return theirs
+	case base.equal(theirs):
+		return ours
+	}
+
+	oursObject, oursIsObject := ours.v.(map[string]interface{})
+	theirsObject, theirsIsObject := theirs.v.(map[string]interface{})
+	if oursIsObject && theirsIsObject {
+		baseObject, _ := base.v.(map[string]interface{})
+		keys := make(map[string]bool)
+		for key := range oursObject {
+			keys[key] = true
+		}
+		for key := range theirsObject {
+			keys[key] = true
+		}
+		merged := make(map[string]interface{})
+		for _, key := range sortedKeys(keys) {
+			child := key
+			if path != "" {
+				child = path + "." + key
+			}
+			result := m.merge3(child, lookup(baseObject, key), lookup(oursObject, key), lookup(theirsObject, key))
+			if result.present {
+				merged[key] = result.v
+			}
+		}
+		return value{merged, true}
+	}
+
+	kind := ConflictModify
+	if !ours.present || !theirs.present {
+		kind = ConflictDelete
+	} else if !base.present {
+		kind = ConflictAdd
+	}
+	m.conflicts = append(m.conflicts, Conflict{
+		Entity: m.entity,
+		Path:   path,
+		Kind:   kind,
+		Base:   base.v,
+		Ours:   ours.v,
+		Theirs: theirs.v,
+	})
+	if m.prefer == PreferTheirs {
+		return theirs
+	}
+	return ours
+}
+
+func lookup(object map[string]interface{}, key string) value {
+	v, ok := object[key]
+	return value{v, ok}
+}
+
+func sortedKeys(keys map[string]bool) []string {
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// Merge combines two states derived from a common base. Non-overlapping
+// changes from both sides are kept; each conflict is resolved with the
+// preferred side (ours unless prefer is "theirs") and reported. The merged
+// state has no sequence number: it never existed in an operation log.
+func Merge(base, ours, theirs *State, prefer string) (*State, []Conflict) {
+	m := &merger{prefer: prefer}
+	merged := NewState()
+
+	scene := m.merge3("", value{base.Scene, true}, value{ours.Scene, true}, value{theirs.Scene, true})
+	if object, ok := scene.v.(map[string]interface{}); ok {
+		merged.Scene = object
+	}
+
+	ids := make(map[string]bool)
+	for _, state := range []*State{base, ours, theirs} {
+		for id := range state.Entities {
+			ids[id] = true
+		}
+	}
+	for _, id := range sortedKeys(ids) {
+		m.entity = id
+		result := m.merge3("", entityValue(base, id), entityValue(ours, id), entityValue(theirs, id))
+		if !result.present {
+			continue
+		}
+		entity := result.v.(map[string]interface{})
+		entity["id"] = id
+		merged.Entities[id] = entity
+	}
+	return merged, m.conflicts
+}
+
+func entityValue(state *State, id string) value {
+	entity, ok := state.Entities[id]
+	if !ok {
+		return value{}
+	}
+	return value{entity, true}
+}
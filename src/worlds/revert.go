@@ -0,0 +1,129 @@
+package worlds
+
+import (
+	"errors"
+
+	"holodeck1/sync"
+)
+
+var (
+	// ErrNotRevertible is returned for operations outside the versioned
+	// state: avatars, anchors, lights, cameras and the simulation clock
+	ErrNotRevertible = errors.New("operation cannot be reverted")
+
+	// ErrRevertConflict is returned when later operations removed or
+	// recreated what the operation touched
+	ErrRevertConflict = errors.New("operation conflicts with the current world")
+)
+
+// Revert returns current with one operation undone: what it created is
+// deleted, what it deleted is recreated, and the entity fields and scene
+// settings it set get their values from before it. Later changes to other
+// fields are kept. before is the world just before the operation.
+func Revert(before, current *State, op *sync.Operation) (*State, error) {
+	if op.Type == sync.TransactionType {
+		return revertTransaction(before, current, op)
+	}
+	data := normalize(op.Data)
+	if data == nil {
+		return nil, ErrNotRevertible
+	}
+	id, _ := data["id"].(string)
+	target := current.clone()
+
+	switch op.Type {
+	case sync.OpEntityCreate:
+		if _, live := current.Entities[id]; !live {
+			return nil, ErrRevertConflict
+		}
+		delete(target.Entities, id)
+		if entity, existed := before.Entities[id]; existed {
+			target.Entities[id] = copyObject(entity)
+		}
+
+	case sync.OpEntityUpdate:
+		entity, live := target.Entities[id]
+		if !live {
+			return nil, ErrRevertConflict
+		}
+		previous := before.Entities[id]
+		for key := range data {
+			if key == "id" {
+				continue
+			}
+			if value, ok := previous[key]; ok {
+				entity[key] = value
+			} else {
+				delete(entity, key)
+			}
+		}
+
+	case sync.OpEntityDelete:
+		entity, existed := before.Entities[id]
+		if !existed {
+			return nil, ErrNotRevertible // Deleted nothing
+		}
+		if _, live := current.Entities[id]; live {
+			return nil, ErrRevertConflict
+		}
+		target.Entities[id] = copyObject(entity)
+
+	case sync.OpSceneUpdate:
+		if _, ok := data["operation"]; ok {
+			return nil, ErrNotRevertible // add_light, set_camera
+		}
+		for key := range data {
+			if liveSettings[key] {
+				return nil, ErrNotRevertible // The clock moved on
+			}
+			if value, ok := before.Scene[key]; ok {
+				target.Scene[key] = value
+			}
+		}
+
+	default:
+		return nil, ErrNotRevertible
+	}
+	return target, nil
+}
+
+// revertTransaction undoes a transaction's operations last to first, each
+// against the world just before it. Any that cannot be reverted fails all.
+func revertTransaction(before, current *State, op *sync.Operation) (*State, error) {
+	parts := op.Parts()
+	befores := make([]*State, len(parts))
+	state := before.clone()
+	for i, part := range parts {
+		befores[i] = state.clone()
+		state.Apply(part)
+	}
+
+	target := current
+	for i := len(parts) - 1; i >= 0; i-- {
+		var err error
+		if target, err = Revert(befores[i], target, parts[i]); err != nil {
+			return nil, err
+		}
+	}
+	return target, nil
+}
+
+// clone deep-copies a state, so a target can be edited without touching
+// the state it came from
+func (s *State) clone() *State {
+	copied := NewState()
+	copied.SeqNum = s.SeqNum
+	copied.Scene = copyObject(s.Scene)
+	for id, entity := range s.Entities {
+		copied.Entities[id] = copyObject(entity)
+	}
+	return copied
+}
+
+// copyObject deep-copies decoded JSON
+func copyObject(object map[string]interface{}) map[string]interface{} {
+	if copied := normalize(object); copied != nil {
+		return copied
+	}
+	return make(map[string]interface{})
+}
@@ -0,0 +1,312 @@
+package worlds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"holodeck1/entityid"
+	"holodeck1/sync"
+	"holodeck1/whiteboard"
+)
+
+// ErrTruncatedLog is returned when early operations have been cleaned up,
+// so the world can no longer be rebuilt from the log
+var ErrTruncatedLog = errors.New("operation log truncated")
+
+// State is a world rebuilt from the operation log: every live entity with
+// its merged create/update data, and the scene settings set through
+// /scene. Lights and cameras are additive scene operations with no removal
+// counterpart, so they are not part of the versioned state.
+type State struct {
+	SeqNum   uint64                            `json:"seq_num"` // Last operation applied
+	Scene    map[string]interface{}            `json:"scene"`
+	Entities map[string]map[string]interface{} `json:"entities"`
+}
+
+// NewState returns an empty world
+func NewState() *State {
+	return &State{
+		Scene:    make(map[string]interface{}),
+		Entities: make(map[string]map[string]interface{}),
+	}
+}
+
+// Normalize checks a state read from outside the operation log and fills
+// in what documents may omit: empty maps, and entity IDs from their keys
+func (s *State) Normalize() error {
+	if s.Scene == nil {
+		s.Scene = make(map[string]interface{})
+	}
+	if s.Entities == nil {
+		s.Entities = make(map[string]map[string]interface{})
+	}
+	for id, entity := range s.Entities {
+		if err := entityid.Validate(id); err != nil {
+			return err
+		}
+		if entity == nil {
+			return fmt.Errorf("entity %s: empty document", id)
+		}
+		if entityID, ok := entity["id"]; ok && entityID != id {
+			return fmt.Errorf("entity %s: id field %v does not match its key", id, entityID)
+		}
+		entity["id"] = id
+	}
+	return nil
+}
+
+// Replay rebuilds a world from operations in sequence order, starting at
+// sequence 1
+func Replay(operations []*sync.Operation) (*State, error) {
+	state := NewState()
+	if len(operations) > 0 && operations[0].SeqNum != 1 {
+		return nil, ErrTruncatedLog
+	}
+	for _, op := range operations {
+		state.Apply(op)
+	}
+	return state, nil
+}
+
+// ReplayEntities rebuilds the entities of a world from its operation log;
+// see portals.StateFunc and chunks.StateFunc
+func ReplayEntities(operations []*sync.Operation) (map[string]map[string]interface{}, error) {
+	state, err := Replay(operations)
+	if err != nil {
+		return nil, err
+	}
+	return state.Entities, nil
+}
+
+// normalize decodes operation data through JSON. In memory it holds typed
+// structs; stored checkpoints hold plain maps, and the two must compare equal.
+func normalize(data map[string]interface{}) map[string]interface{} {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil
+	}
+	var plain map[string]interface{}
+	if err := json.Unmarshal(encoded, &plain); err != nil {
+		return nil
+	}
+	return plain
+}
+
+// Apply advances the state by one operation
+func (s *State) Apply(op *sync.Operation) {
+	if op.SeqNum > s.SeqNum {
+		s.SeqNum = op.SeqNum
+	}
+	if op.Type == sync.TransactionType {
+		for _, part := range op.Parts() {
+			s.Apply(part)
+		}
+		return
+	}
+
+	switch op.Type {
+	case sync.OpEntityCreate, sync.OpEntityUpdate, sync.OpEntityDelete, sync.OpSceneUpdate, whiteboard.OperationType:
+	default:
+		return
+	}
+	data := normalize(op.Data)
+	if data == nil {
+		return
+	}
+	id, _ := data["id"].(string)
+
+	switch op.Type {
+	case sync.OpEntityCreate:
+		if id != "" {
+			s.Entities[id] = data
+		}
+	case sync.OpEntityUpdate:
+		if entity, ok := s.Entities[id]; ok {
+			for key, value := range data {
+				entity[key] = value
+			}
+		}
+	case sync.OpEntityDelete:
+		delete(s.Entities, id)
+	case whiteboard.OperationType:
+		entity, ok := s.Entities[id]
+		if !ok || entity["whiteboard"] == nil {
+			return
+		}
+		board, err := whiteboard.Decode(entity["whiteboard"])
+		delta, deltaErr := whiteboard.DecodeDelta(data)
+		if err != nil || deltaErr != nil {
+			return
+		}
+		board.Merge(delta, op.SeqNum)
+		entity["whiteboard"] = board.Data()
+	case sync.OpSceneUpdate:
+		if _, ok := data["operation"]; ok {
+			return // add_light, set_camera
+		}
+		for key, value := range data {
+			s.Scene[key] = value
+		}
+	}
+}
+
+// FieldChange is one differing value, addressed by a dotted path such as
+// "position.x". A missing side means the field is absent there.
+type FieldChange struct {
+	Path string      `json:"path"`
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+// EntityChange lists the fields that differ for one entity: top-level
+// names, and every differing leaf value
+type EntityChange struct {
+	ID      string        `json:"id"`
+	Fields  []string      `json:"fields"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// Diff describes how to get from one state to another
+type Diff struct {
+	Added        []string       `json:"added"`
+	Removed      []string       `json:"removed"`
+	Changed      []EntityChange `json:"changed"`
+	Scene        []string       `json:"scene"` // Scene settings that differ
+	SceneChanges []FieldChange  `json:"scene_changes"`
+}
+
+// Compare returns the changes from one state to another
+func Compare(from, to *State) *Diff {
+	diff := &Diff{
+		Added:   []string{},
+		Removed: []string{},
+		Changed: []EntityChange{},
+		Scene:   changedFields(from.Scene, to.Scene),
+	}
+	diff.SceneChanges = fieldChanges("", from.Scene, to.Scene, []FieldChange{})
+	for id, entity := range to.Entities {
+		previous, ok := from.Entities[id]
+		if !ok {
+			diff.Added = append(diff.Added, id)
+		} else if fields := changedFields(previous, entity); len(fields) > 0 {
+			diff.Changed = append(diff.Changed, EntityChange{
+				ID:      id,
+				Fields:  fields,
+				Changes: fieldChanges("", previous, entity, []FieldChange{}),
+			})
+		}
+	}
+	for id := range from.Entities {
+		if _, ok := to.Entities[id]; !ok {
+			diff.Removed = append(diff.Removed, id)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].ID < diff.Changed[j].ID })
+	return diff
+}
+
+func changedFields(from, to map[string]interface{}) []string {
+	fields := []string{}
+	for key, value := range to {
+		if !reflect.DeepEqual(from[key], value) {
+			fields = append(fields, key)
+		}
+	}
+	for key := range from {
+		if _, ok := to[key]; !ok {
+			fields = append(fields, key)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// fieldChanges appends the differing leaves of two objects, recursing
+// into nested objects so a moved entity reports position.x, not position
+func fieldChanges(prefix string, from, to map[string]interface{}, changes []FieldChange) []FieldChange {
+	for _, key := range changedFields(from, to) {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		fromObject, fromIsObject := from[key].(map[string]interface{})
+		toObject, toIsObject := to[key].(map[string]interface{})
+		if fromIsObject && toIsObject {
+			changes = fieldChanges(path, fromObject, toObject, changes)
+			continue
+		}
+		changes = append(changes, FieldChange{Path: path, From: from[key], To: to[key]})
+	}
+	return changes
+}
+
+// updatable are the entity fields entity_update can change in place; any
+// other difference needs the entity recreated
+var updatable = map[string]bool{
+	"position": true,
+	"rotation": true,
+	"scale":    true,
+	"visible":  true,
+	"material": true,
+}
+
+// liveSettings are scene settings the server keeps running rather than
+// restoring; the simulation clock carries on where it stands
+var liveSettings = map[string]bool{
+	"clock": true,
+}
+
+// Restore returns the operations that turn current into target, in the
+// order they must be submitted. Operations carry no client ID or sequence.
+func Restore(current, target *State) []*sync.Operation {
+	diff := Compare(current, target)
+	var operations []*sync.Operation
+	emit := func(opType string, data map[string]interface{}) {
+		operations = append(operations, &sync.Operation{Type: opType, Data: data})
+	}
+
+	for _, id := range diff.Removed {
+		emit(sync.OpEntityDelete, map[string]interface{}{"id": id})
+	}
+	for _, change := range diff.Changed {
+		inPlace := true
+		for _, field := range change.Fields {
+			if _, present := target.Entities[change.ID][field]; !updatable[field] || !present {
+				inPlace = false
+				break
+			}
+		}
+		if !inPlace {
+			emit(sync.OpEntityDelete, map[string]interface{}{"id": change.ID})
+			emit(sync.OpEntityCreate, target.Entities[change.ID])
+			continue
+		}
+		update := map[string]interface{}{"id": change.ID}
+		for _, field := range change.Fields {
+			update[field] = target.Entities[change.ID][field]
+		}
+		emit(sync.OpEntityUpdate, update)
+	}
+	for _, id := range diff.Added {
+		emit(sync.OpEntityCreate, target.Entities[id])
+	}
+
+	// Scene settings can be changed but not unset; ones the target never
+	// had keep their current value
+	scene := make(map[string]interface{})
+	for _, key := range diff.Scene {
+		if value, ok := target.Scene[key]; ok && !liveSettings[key] {
+			scene[key] = value
+		}
+	}
+	if len(scene) > 0 {
+		emit(sync.OpSceneUpdate, scene)
+	}
+	return operations
+}
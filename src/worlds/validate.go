@@ -0,0 +1,309 @@
+package worlds
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"holodeck1/api/entities"
+	"holodeck1/config"
+)
+
+// Severity levels reported by the validator
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+var (
+	worldIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	colorPattern   = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+	// knownAssetTypes lists file extensions the client can load
+	knownAssetTypes = map[string]bool{
+		".glb": true, ".gltf": true, ".obj": true, ".fbx": true,
+		".png": true, ".jpg": true, ".jpeg": true, ".webp": true, ".ktx2": true,
+		".hdr": true, ".mp3": true, ".ogg": true, ".wav": true, ".mp4": true, ".webm": true,
+	}
+)
+
+// Issue is a single validation finding
+type Issue struct {
+	Severity string `json:"severity"`
+	Field    string `json:"field"`
+	Message  string `json:"message"`
+}
+
+// WorldReport holds the findings for one world config file
+type WorldReport struct {
+	File     string  `json:"file"`
+	WorldID  string  `json:"world_id,omitempty"`
+	Valid    bool    `json:"valid"`
+	Entities int     `json:"entities"`
+	Assets   int     `json:"assets"`
+	Issues   []Issue `json:"issues"`
+}
+
+// Report is the machine-readable result of validating a directory
+type Report struct {
+	Valid     bool          `json:"valid"`
+	Directory string        `json:"directory"`
+	Errors    int           `json:"errors"`
+	Warnings  int           `json:"warnings"`
+	Worlds    []WorldReport `json:"worlds"`
+	CheckedAt time.Time     `json:"checked_at"`
+}
+
+// ValidateDir validates every world config file under dir. dir may be a
+// single world directory or a worlds root holding one directory per world.
+// The returned error covers only unreadable input; findings are in the report.
+func ValidateDir(dir string) (*Report, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	configName := filepath.Base(config.GetWorldsConfigFile())
+
+	var files []string
+	err = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && d.Name() == configName {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no %s found under %s", configName, dir)
+	}
+
+	report := &Report{
+		Valid:     true,
+		Directory: dir,
+		Worlds:    []WorldReport{},
+		CheckedAt: time.Now().UTC(),
+	}
+
+	seenIDs := make(map[string]string)
+	for _, file := range files {
+		world := ValidateFile(file)
+		if world.WorldID != "" {
+			if previous, duplicate := seenIDs[world.WorldID]; duplicate {
+				world.addError("world.id", "duplicate world id, also defined in %s", previous)
+			} else {
+				seenIDs[world.WorldID] = file
+			}
+		}
+
+		for _, issue := range world.Issues {
+			if issue.Severity == SeverityError {
+				report.Errors++
+			} else {
+				report.Warnings++
+			}
+		}
+		report.Valid = report.Valid && world.Valid
+		report.Worlds = append(report.Worlds, world)
+	}
+
+	return report, nil
+}
+
+// ValidateFile lints one world config file and checks its assets and entities
+func ValidateFile(file string) WorldReport {
+	world := WorldReport{File: file, Valid: true, Issues: []Issue{}}
+
+	def, lint, err := LoadDefinition(file)
+	if err != nil {
+		world.addError("", "%v", err)
+		return world
+	}
+	for _, note := range lint {
+		world.addWarning("", "%s", note)
+	}
+
+	world.WorldID = def.World.ID
+	world.Entities = len(def.Entities)
+	world.Assets = len(def.Assets)
+	worldDir := filepath.Dir(file)
+
+	// World identity
+	switch {
+	case def.World.ID == "":
+		world.addError("world.id", "world id is required")
+	case !worldIDPattern.MatchString(def.World.ID):
+		world.addError("world.id", "world id %q must be lowercase letters, digits, '-' or '_'", def.World.ID)
+	case filepath.Base(worldDir) != def.World.ID && filepath.Base(worldDir) != "worlds":
+		world.addWarning("world.id", "world id %q does not match directory name %q", def.World.ID, filepath.Base(worldDir))
+	}
+	if def.World.Name == "" {
+		world.addWarning("world.name", "world name is empty")
+	}
+
+	// Scene settings
+	if def.Scene.Background != "" && !colorPattern.MatchString(def.Scene.Background) {
+		world.addError("scene.background", "invalid color %q", def.Scene.Background)
+	}
+	if fog := def.Scene.Fog; fog != nil {
+		if !colorPattern.MatchString(fog.Color) {
+			world.addError("scene.fog.color", "invalid color %q", fog.Color)
+		}
+		if fog.Near < 0 || fog.Far <= fog.Near {
+			world.addError("scene.fog", "fog requires 0 <= near < far (near=%g, far=%g)", fog.Near, fog.Far)
+		}
+	}
+	if selection := def.Scene.Physics; selection != nil {
+		if _, err := selection.Resolve(); err != nil {
+			world.addError("scene.physics", "%v", err)
+		}
+	}
+	if space := def.Scene.Space; space != nil {
+		if err := space.Validate(); err != nil {
+			world.addError("scene.space", "%v", err)
+		}
+	}
+	if reference := def.Scene.Geo; reference != nil {
+		if err := reference.Validate(); err != nil {
+			world.addError("scene.geo", "%v", err)
+		}
+	}
+
+	// Declared assets
+	declared := make(map[string]bool)
+	for i, asset := range def.Assets {
+		field := fmt.Sprintf("assets[%d]", i)
+		if declared[asset] {
+			world.addWarning(field, "asset %q declared more than once", asset)
+		}
+		declared[asset] = true
+		world.checkAsset(worldDir, field, asset)
+	}
+
+	// Entity documents
+	ids := make(map[string]bool)
+	for i, entity := range def.Entities {
+		field := fmt.Sprintf("entities[%d]", i)
+		if entity.ID == "" {
+			world.addError(field+".id", "entity id is required")
+		} else if ids[entity.ID] {
+			world.addError(field+".id", "duplicate entity id %q", entity.ID)
+		}
+		ids[entity.ID] = true
+
+		if entity.Model == "" && entity.Geometry == nil && entity.Particles == nil && entity.Panel == nil && entity.Media == nil && entity.Whiteboard == nil && entity.Form == nil {
+			world.addError(field, "entity needs geometry, a model, particles, a panel, media, a whiteboard or a form")
+		}
+		if entity.Form != nil {
+			form := *entity.Form
+			if err := form.Layout(); err != nil {
+				world.addError(field+".form", "%v", err)
+			}
+		}
+		if entity.Portal != nil {
+			portal := *entity.Portal
+			if err := portal.Validate(); err != nil {
+				world.addError(field+".portal", "%v", err)
+			}
+		}
+		if entity.Whiteboard != nil {
+			board := *entity.Whiteboard
+			if err := board.Validate(); err != nil {
+				world.addError(field+".whiteboard", "%v", err)
+			}
+		}
+		if entity.Media != nil {
+			if err := entity.Media.Validate(); err != nil {
+				world.addError(field+".media", "%v", err)
+			}
+		}
+		if entity.Panel != nil {
+			panel := *entity.Panel
+			if err := panel.Layout(); err != nil {
+				world.addError(field+".panel", "%v", err)
+			}
+		}
+		if entity.Geometry != nil {
+			if err := entities.ValidateGeometry(*entity.Geometry); err != nil {
+				world.addError(field+".geometry", "%v", err)
+			}
+			if entity.Material == nil {
+				world.addError(field+".material", "geometry entities require a material")
+			}
+		}
+		if entity.Material != nil {
+			if err := entities.ValidateMaterial(*entity.Material); err != nil {
+				world.addError(field+".material", "%v", err)
+			} else if !colorPattern.MatchString(entity.Material.Color) {
+				world.addError(field+".material.color", "invalid color %q", entity.Material.Color)
+			}
+			if entity.Material.Opacity < 0 || entity.Material.Opacity > 1 {
+				world.addError(field+".material.opacity", "opacity must be between 0 and 1")
+			}
+		}
+		if entity.Scale != nil && (entity.Scale.X == 0 || entity.Scale.Y == 0 || entity.Scale.Z == 0) {
+			world.addWarning(field+".scale", "zero scale makes the entity invisible")
+		}
+		if entity.Model != "" {
+			if world.checkAsset(worldDir, field+".model", entity.Model) && len(def.Assets) > 0 && !declared[entity.Model] {
+				world.addWarning(field+".model", "model %q is not listed in assets", entity.Model)
+			}
+		}
+		if entity.Particles != nil {
+			// Textures are world files here, asset references once loaded
+			emitter := *entity.Particles
+			emitter.Texture = ""
+			if err := emitter.Validate(); err != nil {
+				world.addError(field+".particles", "%v", err)
+			}
+			if texture := entity.Particles.Texture; texture != "" {
+				if world.checkAsset(worldDir, field+".particles.texture", texture) && len(def.Assets) > 0 && !declared[texture] {
+					world.addWarning(field+".particles.texture", "texture %q is not listed in assets", texture)
+				}
+			}
+		}
+	}
+
+	return world
+}
+
+// checkAsset verifies an asset path stays inside the world and exists
+func (w *WorldReport) checkAsset(worldDir, field, asset string) bool {
+	if asset == "" {
+		w.addError(field, "asset path is empty")
+		return false
+	}
+	if filepath.IsAbs(asset) || strings.HasPrefix(filepath.Clean(asset), "..") {
+		w.addError(field, "asset path %q must be relative to the world directory", asset)
+		return false
+	}
+	if !knownAssetTypes[strings.ToLower(filepath.Ext(asset))] {
+		w.addWarning(field, "unrecognised asset type %q", filepath.Ext(asset))
+	}
+	if _, err := os.Stat(filepath.Join(worldDir, asset)); err != nil {
+		w.addError(field, "asset %q not found", asset)
+		return false
+	}
+	return true
+}
+
+func (w *WorldReport) addError(field, format string, args ...interface{}) {
+	w.Valid = false
+	w.Issues = append(w.Issues, Issue{Severity: SeverityError, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (w *WorldReport) addWarning(field, format string, args ...interface{}) {
+	w.Issues = append(w.Issues, Issue{Severity: SeverityWarning, Field: field, Message: fmt.Sprintf(format, args...)})
+}
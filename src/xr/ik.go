@@ -0,0 +1,42 @@
+package xr
+
+import "fmt"
+
+// Supported IK rigs
+const (
+	// RigThreePoint solves a full body from head and both controllers
+	RigThreePoint = "three-point"
+	// RigHeadOnly drives the upper body from the head alone (no controllers)
+	RigHeadOnly = "head-only"
+)
+
+// IKMetadata tells remote clients how to solve a body for an avatar's
+// tracked joints. It changes rarely, so it travels as a reliable
+// avatar_update operation rather than on the pose channel.
+type IKMetadata struct {
+	Rig        string  `json:"rig"`
+	Height     float64 `json:"height"`               // standing height, metres
+	ArmSpan    float64 `json:"arm_span,omitempty"`   // metres, defaults to height
+	Handedness string  `json:"handedness,omitempty"` // left or right
+}
+
+// Validate checks IK metadata values
+func (m *IKMetadata) Validate() error {
+	switch m.Rig {
+	case RigThreePoint, RigHeadOnly:
+	default:
+		return fmt.Errorf("rig must be %s or %s", RigThreePoint, RigHeadOnly)
+	}
+	if m.Height < 0.5 || m.Height > 3 {
+		return fmt.Errorf("height must be between 0.5 and 3 metres")
+	}
+	if m.ArmSpan != 0 && (m.ArmSpan < 0.5 || m.ArmSpan > 3.5) {
+		return fmt.Errorf("arm_span must be between 0.5 and 3.5 metres")
+	}
+	switch m.Handedness {
+	case "", "left", "right":
+	default:
+		return fmt.Errorf("handedness must be left or right")
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+// Package xr defines the compact pose format VR/XR clients use to share
+// embodied presence: a head and two controllers, each a millimetre position
+// plus a quaternion packed into 32 bits.
+//
+// Poses travel as deltas - only the joints that moved are included - and
+// are merged server-side into the avatar's current pose.
+package xr
+
+import (
+	"fmt"
+	"math"
+)
+
+// maxPositionMM bounds joint positions to ±100km so bad input cannot
+// overflow the int32 wire format
+const maxPositionMM = 100000000
+
+// Quaternion is an unpacked rotation
+type Quaternion struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+	W float64 `json:"w"`
+}
+
+// Joint is one tracked point: position in millimetres and a packed rotation
+type Joint struct {
+	Position [3]int32 `json:"p"`
+	Rotation uint32   `json:"q"` // see PackQuaternion
+}
+
+// Pose is a full pose or a delta, depending on which joints are present
+type Pose struct {
+	Time  int64  `json:"t,omitempty"` // client timestamp, milliseconds
+	Head  *Joint `json:"head,omitempty"`
+	Left  *Joint `json:"left,omitempty"`
+	Right *Joint `json:"right,omitempty"`
+}
+
+// Validate rejects empty deltas and out-of-range positions
+func (p *Pose) Validate() error {
+	if p == nil || (p.Head == nil && p.Left == nil && p.Right == nil) {
+		return fmt.Errorf("pose must contain head, left or right")
+	}
+	for name, joint := range map[string]*Joint{"head": p.Head, "left": p.Left, "right": p.Right} {
+		if joint == nil {
+			continue
+		}
+		for _, v := range joint.Position {
+			if v > maxPositionMM || v < -maxPositionMM {
+				return fmt.Errorf("%s position out of range", name)
+			}
+		}
+	}
+	return nil
+}
+
+// Merge applies a delta, replacing the joints it contains
+func (p *Pose) Merge(delta *Pose) {
+	if delta == nil {
+		return
+	}
+	if delta.Time > p.Time {
+		p.Time = delta.Time
+	}
+	if delta.Head != nil {
+		head := *delta.Head
+		p.Head = &head
+	}
+	if delta.Left != nil {
+		left := *delta.Left
+		p.Left = &left
+	}
+	if delta.Right != nil {
+		right := *delta.Right
+		p.Right = &right
+	}
+}
+
+// Clone returns an independent copy
+func (p *Pose) Clone() *Pose {
+	if p == nil {
+		return nil
+	}
+	clone := &Pose{}
+	clone.Merge(p)
+	return clone
+}
+
+// Millimetres converts metres to the wire position unit
+func Millimetres(metres float64) int32 {
+	return int32(math.Round(metres * 1000))
+}
+
+// Metres converts a wire position back to metres
+func Metres(mm int32) float64 {
+	return float64(mm) / 1000
+}
+
+// Packed quaternions use "smallest three": the largest component is
+// dropped (it is recoverable from the unit length) and its index stored in
+// the top 2 bits; the other three, each within ±1/√2, take 10 bits apiece.
+// The scale is even so zero is exactly representable; worst-case error is
+// about a quarter of a degree.
+const (
+	componentBits  = 10
+	componentScale = 1<<componentBits - 2
+	componentMask  = 1<<componentBits - 1
+)
+
+var componentRange = 1 / math.Sqrt2
+
+// PackQuaternion compresses a rotation into 32 bits
+func PackQuaternion(q Quaternion) uint32 {
+	c := [4]float64{q.X, q.Y, q.Z, q.W}
+
+	length := math.Sqrt(c[0]*c[0] + c[1]*c[1] + c[2]*c[2] + c[3]*c[3])
+	if length == 0 || math.IsNaN(length) {
+		c = [4]float64{0, 0, 0, 1}
+		length = 1
+	}
+
+	largest := 0
+	for i := 1; i < 4; i++ {
+		if math.Abs(c[i]) > math.Abs(c[largest]) {
+			largest = i
+		}
+	}
+	// q and -q are the same rotation; make the dropped component positive
+	sign := 1.0
+	if c[largest] < 0 {
+		sign = -1
+	}
+
+	packed := uint32(largest) << (3 * componentBits)
+	shift := 2 * componentBits
+	for i := 0; i < 4; i++ {
+		if i == largest {
+			continue
+		}
+		v := sign * c[i] / length
+		v = math.Max(-componentRange, math.Min(componentRange, v))
+		quantized := uint32(math.Round((v + componentRange) / (2 * componentRange) * componentScale))
+		packed |= quantized << uint(shift)
+		shift -= componentBits
+	}
+	return packed
+}
+
+// UnpackQuaternion restores a packed rotation
+func UnpackQuaternion(packed uint32) Quaternion {
+	largest := int(packed >> (3 * componentBits) & 3)
+
+	var c [4]float64
+	sum := 0.0
+	shift := 2 * componentBits
+	for i := 0; i < 4; i++ {
+		if i == largest {
+			continue
+		}
+		quantized := float64(packed >> uint(shift) & componentMask)
+		c[i] = quantized/componentScale*(2*componentRange) - componentRange
+		sum += c[i] * c[i]
+		shift -= componentBits
+	}
+	c[largest] = math.Sqrt(math.Max(0, 1-sum))
+
+	return Quaternion{X: c[0], Y: c[1], Z: c[2], W: c[3]}
+}
@@ -0,0 +1,67 @@
+package xr
+
+import "math"
+
+// Vector3 is a position in metres
+type Vector3 struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+// Transform is a rigid pose: rotation then translation
+type Transform struct {
+	Position Vector3    `json:"position"`
+	Rotation Quaternion `json:"rotation"`
+}
+
+// Normalize returns a unit quaternion; a zero quaternion becomes identity
+func (q Quaternion) Normalize() Quaternion {
+	length := math.Sqrt(q.X*q.X + q.Y*q.Y + q.Z*q.Z + q.W*q.W)
+	if length == 0 || math.IsNaN(length) {
+		return Quaternion{W: 1}
+	}
+	return Quaternion{X: q.X / length, Y: q.Y / length, Z: q.Z / length, W: q.W / length}
+}
+
+// Multiply returns q * r, the rotation r followed by q
+func (q Quaternion) Multiply(r Quaternion) Quaternion {
+	return Quaternion{
+		X: q.W*r.X + q.X*r.W + q.Y*r.Z - q.Z*r.Y,
+		Y: q.W*r.Y - q.X*r.Z + q.Y*r.W + q.Z*r.X,
+		Z: q.W*r.Z + q.X*r.Y - q.Y*r.X + q.Z*r.W,
+		W: q.W*r.W - q.X*r.X - q.Y*r.Y - q.Z*r.Z,
+	}
+}
+
+// Conjugate is the inverse of a unit quaternion
+func (q Quaternion) Conjugate() Quaternion {
+	return Quaternion{X: -q.X, Y: -q.Y, Z: -q.Z, W: q.W}
+}
+
+// Rotate applies the rotation to v
+func (q Quaternion) Rotate(v Vector3) Vector3 {
+	p := q.Multiply(Quaternion{X: v.X, Y: v.Y, Z: v.Z}).Multiply(q.Conjugate())
+	return Vector3{X: p.X, Y: p.Y, Z: p.Z}
+}
+
+// Normalize returns t with a unit rotation
+func (t Transform) Normalize() Transform {
+	return Transform{Position: t.Position, Rotation: t.Rotation.Normalize()}
+}
+
+// Compose returns t ∘ other: a point is transformed by other, then by t
+func (t Transform) Compose(other Transform) Transform {
+	rotated := t.Rotation.Rotate(other.Position)
+	return Transform{
+		Position: Vector3{X: rotated.X + t.Position.X, Y: rotated.Y + t.Position.Y, Z: rotated.Z + t.Position.Z},
+		Rotation: t.Rotation.Multiply(other.Rotation).Normalize(),
+	}
+}
+
+// Inverse returns the transform undoing t
+func (t Transform) Inverse() Transform {
+	inverse := t.Rotation.Conjugate()
+	p := inverse.Rotate(t.Position)
+	return Transform{Position: Vector3{X: -p.X, Y: -p.Y, Z: -p.Z}, Rotation: inverse}
+}